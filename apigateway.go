@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/apigateway"
 	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -29,79 +31,52 @@ type APIGateway interface {
 	Describe(writer *descriptionWriter) error
 }
 
-var defaultCORSHeaders = map[string]interface{}{
-	"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key",
-	"Access-Control-Allow-Methods": "*",
-	"Access-Control-Allow-Origin":  "*",
-}
-
 const (
 	// OutputAPIGatewayURL is the keyname used in the CloudFormation Output
 	// that stores the APIGateway provisioned URL
 	// @enum OutputKey
 	OutputAPIGatewayURL = "APIGatewayURL"
+
+	// OutputAPIGatewayCustomDomainURL is the keyname used in the CloudFormation
+	// Output that stores the APIGateway custom domain URL
+	// @enum OutputKey
+	OutputAPIGatewayCustomDomainURL = "APIGatewayCustomDomainURL"
 )
 
-func corsMethodResponseParams(api *API) map[string]bool {
+const (
+	// APIGatewayModelEmpty is the built-in API Gateway model for an
+	// empty response body
+	// @enum APIGatewayModel
+	APIGatewayModelEmpty = "Empty"
+	// APIGatewayModelError is the built-in API Gateway model for an
+	// error response body
+	// @enum APIGatewayModel
+	APIGatewayModelError = "Error"
+)
 
-	var userDefinedHeaders map[string]interface{}
-	if api != nil &&
-		api.CORSOptions != nil {
-		userDefinedHeaders = api.CORSOptions.Headers
-	}
-	if len(userDefinedHeaders) <= 0 {
-		userDefinedHeaders = defaultCORSHeaders
-	}
-	responseParams := make(map[string]bool)
-	for eachHeader := range userDefinedHeaders {
-		keyName := fmt.Sprintf("method.response.header.%s", eachHeader)
-		responseParams[keyName] = true
-	}
-	return responseParams
-}
+// jsonSchemaDraft4 is the only JSON Schema version supported by API Gateway
+const jsonSchemaDraft4 = "http://json-schema.org/draft-04/schema#"
 
-func corsIntegrationResponseParams(api *API) map[string]interface{} {
-
-	var userDefinedHeaders map[string]interface{}
-	if api != nil &&
-		api.CORSOptions != nil {
-		userDefinedHeaders = api.CORSOptions.Headers
-	}
-	if len(userDefinedHeaders) <= 0 {
-		userDefinedHeaders = defaultCORSHeaders
-	}
-	responseParams := make(map[string]interface{})
-	for eachHeader, eachHeaderValue := range userDefinedHeaders {
-		keyName := fmt.Sprintf("method.response.header.%s", eachHeader)
-		switch headerVal := eachHeaderValue.(type) {
-		case *gocf.StringExpr:
-			responseParams[keyName] = gocf.Join("",
-				gocf.String("'"),
-				headerVal.String(),
-				gocf.String("'"))
-		default:
-			responseParams[keyName] = fmt.Sprintf("'%s'", eachHeaderValue)
-		}
-	}
-	return responseParams
-}
+// reModelName matches valid API Gateway model names
+var reModelName = regexp.MustCompile("^[A-Za-z0-9]+$")
 
 // DefaultMethodResponses returns the default set of Method HTTPStatus->Response
 // pass through responses.  The successfulHTTPStatusCode param is the single
 // 2XX response code to use for the method.
-func methodResponses(api *API, userResponses map[int]*Response, corsEnabled bool) *gocf.APIGatewayMethodMethodResponseList {
+func methodResponses(api *API,
+	apiGatewayResName string,
+	userResponses map[int]*Response,
+	cors *corsConfig,
+	template *gocf.Template) (*gocf.APIGatewayMethodMethodResponseList, error) {
 
 	var responses gocf.APIGatewayMethodMethodResponseList
 	for eachHTTPStatusCode, eachResponse := range userResponses {
-		methodResponseParams := eachResponse.Parameters
-		if corsEnabled {
-			for eachString, eachBool := range corsMethodResponseParams(api) {
-				methodResponseParams[eachString] = eachBool
-			}
-		}
 		// Then transform them all to strings because internet
-		methodResponseStringParams := make(map[string]string, len(methodResponseParams))
-		for eachKey, eachBool := range methodResponseParams {
+		methodResponseStringParams := make(map[string]string, len(eachResponse.Parameters))
+		for eachKey, eachBool := range eachResponse.Parameters {
+			methodResponseStringParams[eachKey] = fmt.Sprintf("%t", eachBool)
+		}
+		for eachKey, eachBool := range corsMethodResponseParams(cors) {
 			methodResponseStringParams[eachKey] = fmt.Sprintf("%t", eachBool)
 		}
 		methodResponse := gocf.APIGatewayMethodMethodResponse{
@@ -110,45 +85,92 @@ func methodResponses(api *API, userResponses map[int]*Response, corsEnabled bool
 		if len(methodResponseStringParams) != 0 {
 			methodResponse.ResponseParameters = methodResponseStringParams
 		}
+		if len(eachResponse.Models) != 0 {
+			responseModels := make(map[string]*gocf.StringExpr)
+			for eachContentType, eachModel := range eachResponse.Models {
+				modelRef, modelRefErr := apiGatewayModelResource(apiGatewayResName,
+					eachContentType,
+					eachModel,
+					template)
+				if modelRefErr != nil {
+					return nil, modelRefErr
+				}
+				responseModels[eachContentType] = modelRef
+			}
+			methodResponse.ResponseModels = responseModels
+		}
 		responses = append(responses, methodResponse)
 	}
-	return &responses
+	return &responses, nil
 }
 
-func integrationResponses(api *API, userResponses map[int]*IntegrationResponse, corsEnabled bool) *gocf.APIGatewayMethodIntegrationResponseList {
+func integrationResponses(api *API, userResponses map[int]*IntegrationResponse, cors *corsConfig) *gocf.APIGatewayMethodIntegrationResponseList {
 
 	var integrationResponses gocf.APIGatewayMethodIntegrationResponseList
 
 	// We've already populated this entire map in the NewMethod call
 	for eachHTTPStatusCode, eachMethodIntegrationResponse := range userResponses {
-		responseParameters := eachMethodIntegrationResponse.Parameters
-		if corsEnabled {
-			for eachKey, eachValue := range corsIntegrationResponseParams(api) {
-				responseParameters[eachKey] = eachValue
-			}
+		responseParameters := make(map[string]interface{}, len(eachMethodIntegrationResponse.Parameters))
+		for eachKey, eachValue := range eachMethodIntegrationResponse.Parameters {
+			responseParameters[eachKey] = eachValue
+		}
+		for eachKey, eachValue := range corsIntegrationResponseParams(cors) {
+			responseParameters[eachKey] = eachValue
 		}
 
+		responseTemplates := eachMethodIntegrationResponse.Templates
+		if len(api.BinaryMediaTypes) != 0 {
+			responseTemplates = make(map[string]string, len(eachMethodIntegrationResponse.Templates))
+			for eachKey, eachValue := range eachMethodIntegrationResponse.Templates {
+				responseTemplates[eachKey] = eachValue
+			}
+			for _, eachMediaType := range api.BinaryMediaTypes {
+				if _, exists := responseTemplates[eachMediaType]; !exists {
+					responseTemplates[eachMediaType] = binaryResponseTemplate()
+				}
+			}
+		}
 		integrationResponse := gocf.APIGatewayMethodIntegrationResponse{
-			ResponseTemplates: eachMethodIntegrationResponse.Templates,
-			SelectionPattern:  gocf.String(eachMethodIntegrationResponse.SelectionPattern),
-			StatusCode:        gocf.String(strconv.Itoa(eachHTTPStatusCode)),
+			SelectionPattern: gocf.String(eachMethodIntegrationResponse.SelectionPattern),
+			StatusCode:       gocf.String(strconv.Itoa(eachHTTPStatusCode)),
+		}
+		if len(responseTemplates) != 0 {
+			integrationResponse.ResponseTemplates = cors.responseTemplates(responseTemplates)
 		}
 		if len(responseParameters) != 0 {
 			integrationResponse.ResponseParameters = responseParameters
 		}
+		if eachMethodIntegrationResponse.ContentHandling != "" {
+			integrationResponse.ContentHandling = gocf.String(eachMethodIntegrationResponse.ContentHandling)
+		}
 		integrationResponses = append(integrationResponses, integrationResponse)
 	}
 
 	return &integrationResponses
 }
 
-func methodRequestTemplates(method *Method) (map[string]string, error) {
+func methodRequestTemplates(api *API, method *Method) (map[string]string, error) {
+	// User defined templates supersede the Sparta templates
+	if method.replaceRequestTemplates {
+		userTemplates := make(map[string]string, len(method.Integration.RequestTemplates))
+		for eachContentType, eachTemplate := range method.Integration.RequestTemplates {
+			userTemplates[eachContentType] = eachTemplate
+		}
+		return userTemplates, nil
+	}
 	supportedTemplates := map[string]string{
 		"application/json":                  _escFSMustString(false, "/resources/provision/apigateway/inputmapping_json.vtl"),
 		"text/plain":                        _escFSMustString(false, "/resources/provision/apigateway/inputmapping_default.vtl"),
 		"application/x-www-form-urlencoded": _escFSMustString(false, "/resources/provision/apigateway/inputmapping_formencoded.vtl"),
 		"multipart/form-data":               _escFSMustString(false, "/resources/provision/apigateway/inputmapping_default.vtl"),
 	}
+	// Binary payloads are base64 encoded by the integration
+	for _, eachMediaType := range api.BinaryMediaTypes {
+		supportedTemplates[eachMediaType] = binaryRequestTemplate()
+	}
+	for eachContentType, eachTemplate := range method.Integration.RequestTemplates {
+		supportedTemplates[eachContentType] = eachTemplate
+	}
 	if len(method.SupportedRequestContentTypes) <= 0 {
 		return supportedTemplates, nil
 	}
@@ -162,46 +184,85 @@ func methodRequestTemplates(method *Method) (map[string]string, error) {
 		}
 		userDefinedTemplates[eachContentType] = vtlMapping
 	}
+	// Explicit overrides are always included
+	for eachContentType, eachTemplate := range method.Integration.RequestTemplates {
+		userDefinedTemplates[eachContentType] = eachTemplate
+	}
 	return userDefinedTemplates, nil
 }
 
-func corsOptionsGatewayMethod(api *API, restAPIID gocf.Stringable, resourceID gocf.Stringable) *gocf.APIGatewayMethod {
-	methodResponse := gocf.APIGatewayMethodMethodResponse{
-		StatusCode:         gocf.String("200"),
-		ResponseParameters: corsMethodResponseParams(api),
+// apiGatewayModelResource returns the model name reference for the given
+// method request or response model. User defined models are created as
+// AWS::ApiGateway::Model resources and shared by name.
+func apiGatewayModelResource(apiGatewayResName string,
+	contentType string,
+	model *Model,
+	template *gocf.Template) (*gocf.StringExpr, error) {
+	if model == nil || model.Name == "" {
+		return nil, fmt.Errorf("model for Content-Type %s must have a name", contentType)
+	}
+	if !reModelName.MatchString(model.Name) {
+		return nil, fmt.Errorf("model name %s must be alphanumeric", model.Name)
 	}
+	// Built-in models don't need a resource
+	if model.Schema == "" &&
+		(model.Name == APIGatewayModelEmpty || model.Name == APIGatewayModelError) {
+		return gocf.String(model.Name), nil
+	}
+	modelResName := CloudFormationResourceName("APIGatewayModel", apiGatewayResName, model.Name)
+	if _, exists := template.Resources[modelResName]; exists {
+		return gocf.Ref(modelResName).String(), nil
+	}
+	var schema interface{}
+	if model.Schema != "" {
+		unmarshalErr := json.Unmarshal([]byte(model.Schema), &schema)
+		if unmarshalErr != nil {
+			return nil, errors.Wrapf(unmarshalErr, "Failed to parse schema for model: %s", model.Name)
+		}
+		// API Gateway only supports draft 4
+		if schemaMap, schemaMapOk := schema.(map[string]interface{}); schemaMapOk {
+			if _, hasSchema := schemaMap["$schema"]; !hasSchema {
+				schemaMap["$schema"] = jsonSchemaDraft4
+			}
+		}
+	}
+	apiGatewayModel := &gocf.APIGatewayModel{
+		ContentType: gocf.String(contentType),
+		Name:        gocf.String(model.Name),
+		RestAPIID:   gocf.Ref(apiGatewayResName).String(),
+		Schema:      schema,
+	}
+	if model.Description != "" {
+		apiGatewayModel.Description = gocf.String(model.Description)
+	}
+	template.AddResource(modelResName, apiGatewayModel)
+	return gocf.Ref(modelResName).String(), nil
+}
 
-	integrationResponse := gocf.APIGatewayMethodIntegrationResponse{
-		ResponseTemplates: map[string]string{
-			"application/*": "",
-			"text/*":        "",
-		},
-		StatusCode:         gocf.String("200"),
-		ResponseParameters: corsIntegrationResponseParams(api),
-	}
-
-	methodIntegrationIntegrationResponseList := gocf.APIGatewayMethodIntegrationResponseList{}
-	methodIntegrationIntegrationResponseList = append(methodIntegrationIntegrationResponseList,
-		integrationResponse)
-	methodResponseList := gocf.APIGatewayMethodMethodResponseList{}
-	methodResponseList = append(methodResponseList, methodResponse)
-
-	corsMethod := &gocf.APIGatewayMethod{
-		HTTPMethod:        gocf.String("OPTIONS"),
-		AuthorizationType: gocf.String("NONE"),
-		RestAPIID:         restAPIID.String(),
-		ResourceID:        resourceID.String(),
-		Integration: &gocf.APIGatewayMethodIntegration{
-			Type: gocf.String("MOCK"),
-			RequestTemplates: map[string]string{
-				"application/json": "{\"statusCode\": 200}",
-				"text/plain":       "statusCode: 200",
-			},
-			IntegrationResponses: &methodIntegrationIntegrationResponseList,
-		},
-		MethodResponses: &methodResponseList,
+// apiGatewayRequestValidatorResource returns the logical name of the
+// AWS::ApiGateway::RequestValidator resource for the method's validation
+// settings. There is at most one validator for each combination.
+func apiGatewayRequestValidatorResource(apiGatewayResName string,
+	method *Method,
+	template *gocf.Template) string {
+	validatorName := "params"
+	if method.ValidateRequestBody && method.ValidateRequestParameters {
+		validatorName = "body-and-params"
+	} else if method.ValidateRequestBody {
+		validatorName = "body"
+	}
+	validatorResName := CloudFormationResourceName("APIGatewayValidator",
+		apiGatewayResName,
+		validatorName)
+	if _, exists := template.Resources[validatorResName]; !exists {
+		template.AddResource(validatorResName, &gocf.APIGatewayRequestValidator{
+			Name:                      gocf.String(validatorName),
+			RestAPIID:                 gocf.Ref(apiGatewayResName).String(),
+			ValidateRequestBody:       gocf.Bool(method.ValidateRequestBody),
+			ValidateRequestParameters: gocf.Bool(method.ValidateRequestParameters),
+		})
 	}
-	return corsMethod
+	return validatorResName
 }
 
 func apiStageInfo(apiName string,
@@ -351,14 +412,48 @@ type APIGatewayLambdaJSONEvent struct {
 
 // Model proxies the AWS SDK's Model data.  See
 // http://docs.aws.amazon.com/sdk-for-go/api/service/apigateway.html#Model
-//
-// TODO: Support Dynamic Model creation
+// Method request and response models are created as AWS::ApiGateway::Model
+// resources whose Schema is the JSON Schema (draft 4) document. Models are
+// shared by Name across the API. A Model with an empty Schema and the
+// APIGatewayModelEmpty or APIGatewayModelError Name references the
+// corresponding built-in model.
 type Model struct {
 	Description string `json:",omitempty"`
 	Name        string `json:",omitempty"`
 	Schema      string `json:",omitempty"`
 }
 
+// NewModel returns a new Model with the given alphanumeric name. The schema
+// value is either a JSON Schema (draft 4) string or []byte, or a value
+// that is marshaled to a JSON Schema document.
+func NewModel(name string, schema interface{}) (*Model, error) {
+	if !reModelName.MatchString(name) {
+		return nil, errors.Errorf("Model name %s must be alphanumeric", name)
+	}
+	var schemaBytes []byte
+	switch typedSchema := schema.(type) {
+	case string:
+		schemaBytes = []byte(typedSchema)
+	case []byte:
+		schemaBytes = typedSchema
+	default:
+		jsonBytes, jsonBytesErr := json.Marshal(schema)
+		if jsonBytesErr != nil {
+			return nil, errors.Wrapf(jsonBytesErr, "Failed to marshal schema for model: %s", name)
+		}
+		schemaBytes = jsonBytes
+	}
+	var schemaObject map[string]interface{}
+	unmarshalErr := json.Unmarshal(schemaBytes, &schemaObject)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Invalid JSON Schema for model: %s", name)
+	}
+	return &Model{
+		Name:   name,
+		Schema: string(schemaBytes),
+	}, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 //
 
@@ -378,6 +473,10 @@ type IntegrationResponse struct {
 	Parameters       map[string]interface{} `json:",omitempty"`
 	SelectionPattern string                 `json:",omitempty"`
 	Templates        map[string]string      `json:",omitempty"`
+	// Optional response payload conversion. One of the
+	// APIGatewayContentHandling values. Use CONVERT_TO_BINARY to return
+	// the body of an apigateway.NewBinaryResponse as a binary blob.
+	ContentHandling string `json:",omitempty"`
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -386,11 +485,17 @@ type IntegrationResponse struct {
 // Integration proxies the AWS SDK's Integration data.  See
 // http://docs.aws.amazon.com/sdk-for-go/api/service/apigateway.html#Integration
 type Integration struct {
-	Parameters         map[string]string
+	Parameters map[string]string
+	// Optional request templates keyed by Content-Type. These supersede
+	// the Sparta generated templates. See Method.SetRequestTemplate.
 	RequestTemplates   map[string]string
 	CacheKeyParameters []string
 	CacheNamespace     string
 	Credentials        string
+	// Optional request payload conversion. One of the
+	// APIGatewayContentHandling values. Defaults to CONVERT_TO_TEXT
+	// if the API defines BinaryMediaTypes.
+	ContentHandling string
 
 	Responses map[int]*IntegrationResponse
 
@@ -407,12 +512,33 @@ type Method struct {
 	authorizationID         gocf.Stringable
 	httpMethod              string
 	defaultHTTPResponseCode int
+	// Optional AWS service integration that replaces the lambda function
+	serviceIntegration *APIServiceIntegration
+	// Should the Integration.RequestTemplates replace the Sparta templates?
+	replaceRequestTemplates bool
 
 	APIKeyRequired bool
 
+	// Optional OAuth scopes for methods with a Cognito APIAuthorizer
+	AuthorizationScopes []string
+
+	// Optional CORS options for this method. If non-nil, supersedes
+	// the Resource and API CORS options.
+	CORSOptions *CORSOptions
+
+	// Optional OperationName for SDK generation
+	OperationName string
+
 	// Request data
 	Parameters map[string]bool
-	Models     map[string]*Model
+	// Request models keyed by Content-Type
+	Models map[string]*Model
+
+	// Request validation. If either value is true, API Gateway rejects
+	// requests that don't satisfy the request Models and/or required
+	// Parameters before the lambda function is invoked.
+	ValidateRequestBody       bool
+	ValidateRequestParameters bool
 
 	// Supported HTTP request Content-Types. Used to limit the amount of VTL
 	// injected into the CloudFormation template. Eligible values include:
@@ -438,6 +564,9 @@ type Resource struct {
 	pathPart     string
 	parentLambda *LambdaAWSInfo
 	Methods      map[string]*Method
+	// Optional CORS options for this resource. If non-nil, supersedes
+	// the API CORS options.
+	CORSOptions *CORSOptions
 }
 
 // Stage proxies the AWS SDK's Stage data.  See
@@ -448,18 +577,200 @@ type Stage struct {
 	CacheClusterSize    string
 	Description         string
 	Variables           map[string]string
+	// Optional default throttle for all methods in the stage
+	Throttle *APIThrottle
+	// Optional access log settings
+	AccessLog *APIAccessLog
+	// Enable detailed CloudWatch metrics for all methods in the stage
+	MetricsEnabled bool
+	// Optional execution logging level. One of the APIGatewayLoggingLevel values.
+	LoggingLevel string
+	// Log full request and response data
+	DataTraceEnabled bool
+	// Enable AWS X-Ray tracing
+	TracingEnabled bool
+	// Optional per-method settings keyed by "/resource/path/HTTP_METHOD",
+	// for example "/hello/GET". Use "/*/*" for all methods.
+	MethodSettings map[string]*APIMethodSettings
+	// Create the account level CloudWatch Logs role required for
+	// access and execution logging. The role is shared by all APIs
+	// in the account region.
+	ProvisionCloudWatchRole bool
+	// Optional lambda function alias (eg: live) that the stage's lambda
+	// integrations invoke. If any of the API stages defines a LambdaAlias,
+	// all stages must. The alias must exist for every API lambda function.
+	LambdaAlias string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 //
 
-// CORSOptions is a struct that clients supply to the API in order to enable
-// and parameterize CORS API values
-type CORSOptions struct {
-	// Headers represent the CORS headers that should be used for an OPTIONS
-	// preflight request. These should be of the form key-value as in:
-	// "Access-Control-Allow-Headers"="Content-Type,X-Amz-Date,Authorization,X-Api-Key"
-	Headers map[string]interface{}
+// APICustomDomain represents a custom domain name for a deployed API. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/how-to-custom-domains.html
+type APICustomDomain struct {
+	// The custom domain name (eg: api.example.com)
+	DomainName string
+	// Optional existing ACM certificate ARN. If nil, a DNS validated
+	// certificate is created in the stack's region. EDGE endpoints
+	// require a certificate in us-east-1.
+	CertificateArn gocf.Stringable
+	// Optional Route53 hosted zone ID for the domain. If defined, the
+	// created certificate's DNS validation records and an alias record
+	// for the domain name are created in the hosted zone.
+	HostedZoneID string
+	// Optional base path that maps to the API stage. Defaults to the root.
+	BasePath string
+	// The endpoint type: REGIONAL (default) or EDGE
+	EndpointType string
+	// Optional TLS version policy: TLS_1_0 or TLS_1_2
+	SecurityPolicy string
+	// Optional mutual TLS settings. Requires a REGIONAL endpoint and
+	// the TLS_1_2 SecurityPolicy.
+	MutualTLS *APIMutualTLS
+}
+
+// APIMutualTLS represents the truststore used to authenticate client
+// certificates for a custom domain. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/rest-api-mutual-tls.html
+type APIMutualTLS struct {
+	// The S3 URI of the PEM encoded truststore (eg: s3://bucket/truststore.pem)
+	TruststoreURI string
+	// Optional S3 object version of the truststore
+	TruststoreVersion string
+}
+
+// marshal adds the custom domain resources for the deployed stage
+func (customDomain *APICustomDomain) marshal(apiGatewayResName string,
+	stageName string,
+	deploymentResName string,
+	template *gocf.Template) error {
+
+	if customDomain.DomainName == "" {
+		return fmt.Errorf("custom domain name for API %s must not be empty", apiGatewayResName)
+	}
+	endpointType := strings.ToUpper(customDomain.EndpointType)
+	if endpointType == "" {
+		endpointType = "REGIONAL"
+	}
+	if endpointType != "REGIONAL" && endpointType != "EDGE" {
+		return fmt.Errorf("unsupported custom domain endpoint type: %s", customDomain.EndpointType)
+	}
+
+	// Certificate
+	var certificateArn *gocf.StringExpr
+	if customDomain.CertificateArn != nil {
+		certificateArn = customDomain.CertificateArn.String()
+	} else {
+		certificate := &certificateManagerCertificate{
+			CertificateManagerCertificate: gocf.CertificateManagerCertificate{
+				DomainName:       gocf.String(customDomain.DomainName),
+				ValidationMethod: gocf.String("DNS"),
+			},
+		}
+		if customDomain.HostedZoneID != "" {
+			certificate.DomainValidationOptions = []certificateManagerCertificateDomainValidationOption{
+				{
+					DomainName:   gocf.String(customDomain.DomainName),
+					HostedZoneID: gocf.String(customDomain.HostedZoneID),
+				},
+			}
+		}
+		certificateResName := CloudFormationResourceName("APIGatewayCertificate",
+			customDomain.DomainName)
+		template.AddResource(certificateResName, certificate)
+		certificateArn = gocf.Ref(certificateResName).String()
+	}
+
+	// DomainName
+	domainName := &apiGatewayDomainName{
+		APIGatewayDomainName: gocf.APIGatewayDomainName{
+			DomainName: gocf.String(customDomain.DomainName),
+			EndpointConfiguration: &gocf.APIGatewayDomainNameEndpointConfiguration{
+				Types: gocf.StringList(gocf.String(endpointType)),
+			},
+		},
+	}
+	if endpointType == "EDGE" {
+		domainName.CertificateArn = certificateArn
+	} else {
+		domainName.RegionalCertificateArn = certificateArn
+	}
+	if customDomain.SecurityPolicy != "" {
+		domainName.SecurityPolicy = gocf.String(customDomain.SecurityPolicy)
+	}
+	if customDomain.MutualTLS != nil {
+		if endpointType != "REGIONAL" {
+			return fmt.Errorf("mutual TLS for custom domain %s requires a REGIONAL endpoint",
+				customDomain.DomainName)
+		}
+		if !strings.HasPrefix(customDomain.MutualTLS.TruststoreURI, "s3://") {
+			return fmt.Errorf("mutual TLS truststore for custom domain %s must be an S3 URI: %s",
+				customDomain.DomainName,
+				customDomain.MutualTLS.TruststoreURI)
+		}
+		switch customDomain.SecurityPolicy {
+		case "":
+			domainName.SecurityPolicy = gocf.String("TLS_1_2")
+		case "TLS_1_2":
+			// NOP
+		default:
+			return fmt.Errorf("mutual TLS for custom domain %s requires the TLS_1_2 security policy",
+				customDomain.DomainName)
+		}
+		domainName.MutualTLSAuthentication = &apiGatewayDomainNameMutualTLSAuthentication{
+			TruststoreURI: gocf.String(customDomain.MutualTLS.TruststoreURI),
+		}
+		if customDomain.MutualTLS.TruststoreVersion != "" {
+			domainName.MutualTLSAuthentication.TruststoreVersion =
+				gocf.String(customDomain.MutualTLS.TruststoreVersion)
+		}
+	}
+	domainNameResName := CloudFormationResourceName("APIGatewayDomainName",
+		customDomain.DomainName)
+	template.AddResource(domainNameResName, domainName)
+
+	// BasePathMapping
+	basePathMapping := &gocf.APIGatewayBasePathMapping{
+		DomainName: gocf.Ref(domainNameResName).String(),
+		RestAPIID:  gocf.Ref(apiGatewayResName).String(),
+		Stage:      gocf.String(stageName),
+	}
+	if customDomain.BasePath != "" {
+		basePathMapping.BasePath = gocf.String(strings.Trim(customDomain.BasePath, "/"))
+	}
+	basePathMappingResName := CloudFormationResourceName("APIGatewayBasePathMapping",
+		customDomain.DomainName,
+		customDomain.BasePath)
+	mappingResource := template.AddResource(basePathMappingResName, basePathMapping)
+	// The stage is created by the deployment
+	mappingResource.DependsOn = append(mappingResource.DependsOn, deploymentResName)
+
+	// Alias record
+	if customDomain.HostedZoneID != "" {
+		aliasTarget := &gocf.Route53RecordSetAliasTarget{
+			DNSName:      gocf.GetAtt(domainNameResName, "RegionalDomainName"),
+			HostedZoneID: gocf.GetAtt(domainNameResName, "RegionalHostedZoneId"),
+		}
+		if endpointType == "EDGE" {
+			aliasTarget.DNSName = gocf.GetAtt(domainNameResName, "DistributionDomainName")
+			aliasTarget.HostedZoneID = gocf.GetAtt(domainNameResName, "DistributionHostedZoneId")
+		}
+		template.AddResource(CloudFormationResourceName("APIGatewayDomainRecord",
+			customDomain.DomainName),
+			&gocf.Route53RecordSet{
+				AliasTarget:  aliasTarget,
+				HostedZoneID: gocf.String(customDomain.HostedZoneID),
+				Name:         gocf.String(customDomain.DomainName),
+				Type:         gocf.String("A"),
+			})
+	}
+	template.Outputs[OutputAPIGatewayCustomDomainURL] = &gocf.Output{
+		Description: "API Gateway custom domain URL",
+		Value: gocf.String(fmt.Sprintf("https://%s/%s",
+			customDomain.DomainName,
+			strings.Trim(customDomain.BasePath, "/"))),
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -474,6 +785,8 @@ type API struct {
 	name string
 	// Optional stage. If defined, the API will be deployed
 	stage *Stage
+	// Additional stages created by AddStage
+	stages []*Stage
 	// Existing API to CloneFrom
 	CloneFrom string
 	// API Description
@@ -486,6 +799,20 @@ type API struct {
 	CORSOptions *CORSOptions
 	// Endpoint configuration information
 	EndpointConfiguration *gocf.APIGatewayRestAPIEndpointConfiguration
+	// Optional custom domain name for the API stage. Requires a stage.
+	CustomDomain *APICustomDomain
+	// Disable the default execute-api endpoint so that clients must use
+	// the CustomDomain. Recommended for mutual TLS.
+	DisableExecuteAPIEndpoint bool
+	// Optional WAFv2 WebACL associated with the API stage. Requires a stage.
+	WebACL *APIWebACL
+	// Optional media types (eg: image/png, application/octet-stream) that
+	// API Gateway treats as binary payloads
+	BinaryMediaTypes []string
+	// Optional gateway responses keyed by APIGatewayResponseType
+	GatewayResponses map[string]*APIGatewayResponse
+	// Usage plans created by NewUsagePlan
+	usagePlans []*APIUsagePlan
 }
 
 // LogicalResourceName returns the CloudFormation logical
@@ -505,10 +832,6 @@ func (api *API) RestAPIURL() *gocf.StringExpr {
 		gocf.String(".amazonaws.com"))
 }
 
-func (api *API) corsEnabled() bool {
-	return api.CORSEnabled || (api.CORSOptions != nil)
-}
-
 // Describe writes the API to a graph for visualization
 func (api *API) Describe(describer *descriptionWriter) error {
 
@@ -520,7 +843,7 @@ func (api *API) Describe(describer *descriptionWriter) error {
 		return writeErr
 	}
 	for _, eachResource := range api.resources {
-		for eachMethod := range eachResource.Methods {
+		for eachMethod, eachMethodDef := range eachResource.Methods {
 			// Create the PATH node
 			var nodeName = fmt.Sprintf("%s - %s", eachMethod, eachResource.pathPart)
 			writeErr = describer.writeNode(
@@ -536,12 +859,33 @@ func (api *API) Describe(describer *descriptionWriter) error {
 			if writeErr != nil {
 				return writeErr
 			}
-			writeErr = describer.writeEdge(nodeName,
-				eachResource.parentLambda.lambdaFunctionName(),
-				"")
+			if eachMethodDef.serviceIntegration != nil {
+				serviceNodeName := eachMethodDef.serviceIntegration.name()
+				writeErr = describer.writeNode(serviceNodeName,
+					nodeColorAPIGateway,
+					eachMethodDef.serviceIntegration.describeIcon())
+				if writeErr != nil {
+					return writeErr
+				}
+				writeErr = describer.writeEdge(nodeName, serviceNodeName, "")
+			} else {
+				writeErr = describer.writeEdge(nodeName,
+					eachResource.parentLambda.lambdaFunctionName(),
+					"")
+			}
 			if writeErr != nil {
 				return writeErr
 			}
+			// Lambda authorizers
+			authorizer, isAuthorizer := eachMethodDef.authorizationID.(*APIAuthorizer)
+			if isAuthorizer && authorizer.lambdaFn != nil {
+				writeErr = describer.writeEdge(nodeName,
+					authorizer.lambdaFn.lambdaFunctionName(),
+					"authorizer")
+				if writeErr != nil {
+					return writeErr
+				}
+			}
 		}
 	}
 	return nil
@@ -564,10 +908,22 @@ func (api *API) Marshal(serviceName string,
 	}
 
 	// Create an API gateway entry
-	apiGatewayRes := &gocf.APIGatewayRestAPI{
-		Description:    gocf.String(api.Description),
-		FailOnWarnings: gocf.Bool(false),
-		Name:           gocf.String(api.name),
+	apiGatewayRes := &apiGatewayRestAPI{
+		APIGatewayRestAPI: gocf.APIGatewayRestAPI{
+			Description:    gocf.String(api.Description),
+			FailOnWarnings: gocf.Bool(false),
+			Name:           gocf.String(api.name),
+		},
+	}
+	if api.DisableExecuteAPIEndpoint {
+		apiGatewayRes.DisableExecuteAPIEndpoint = gocf.Bool(true)
+	}
+	if len(api.BinaryMediaTypes) != 0 {
+		var binaryMediaTypes []gocf.Stringable
+		for _, eachMediaType := range api.BinaryMediaTypes {
+			binaryMediaTypes = append(binaryMediaTypes, gocf.String(eachMediaType))
+		}
+		apiGatewayRes.BinaryMediaTypes = gocf.StringList(binaryMediaTypes...)
 	}
 	if api.CloneFrom != "" {
 		apiGatewayRes.CloneFrom = gocf.String(api.CloneFrom)
@@ -589,6 +945,27 @@ func (api *API) Marshal(serviceName string,
 	// deployment can DependOn them
 	optionsMethodPathMap := make(map[string]bool)
 	var apiMethodCloudFormationResources []string
+
+	// API level CORS headers are also included in the default and user
+	// defined gateway responses so that browsers can read API Gateway errors
+	apiCORS, apiCORSErr := newCORSConfig(api.corsOptions(), []string{"*"})
+	if apiCORSErr != nil {
+		return errors.Wrapf(apiCORSErr, "Failed to create CORS headers for API: %s", api.name)
+	}
+	gatewayResponses, gatewayResponsesErr := api.gatewayResponses(apiCORS, apiGatewayResName, template)
+	if gatewayResponsesErr != nil {
+		return errors.Wrapf(gatewayResponsesErr, "Failed to create gateway responses for API: %s", api.name)
+	}
+	apiMethodCloudFormationResources = append(apiMethodCloudFormationResources,
+		gatewayResponses...)
+	corsPaths := api.corsPaths()
+	lambdaAliases, lambdaAliasesErr := api.lambdaAliases()
+	if lambdaAliasesErr != nil {
+		return lambdaAliasesErr
+	}
+	// The role API Gateway assumes for direct service integrations
+	serviceRoleResName := CloudFormationResourceName("APIGatewayServiceRole", apiGatewayResName)
+	var servicePrivileges []IAMRolePrivilege
 	for eachResourceMethodKey, eachResourceDef := range api.resources {
 		// First walk all the user resources and create intermediate paths
 		// to repreesent all the resources
@@ -613,26 +990,34 @@ func (api *API) Marshal(serviceName string,
 			parentResource = gocf.Ref(resourcePathName).String()
 		}
 
-		// Add the lambda permission
-		apiGatewayPermissionResourceName := CloudFormationResourceName("APIGatewayLambdaPerm",
-			eachResourceMethodKey)
-		lambdaInvokePermission := &gocf.LambdaPermission{
-			Action:       gocf.String("lambda:InvokeFunction"),
-			FunctionName: gocf.GetAtt(eachResourceDef.parentLambda.LogicalResourceName(), "Arn"),
-			Principal:    gocf.String(APIGatewayPrincipal),
+		// Add the lambda permissions. Service resources don't have a lambda function.
+		var apiGatewayPermissionResourceNames []string
+		if eachResourceDef.parentLambda != nil {
+			apiGatewayPermissionResourceNames = lambdaPermissions(eachResourceMethodKey,
+				eachResourceDef.parentLambda,
+				lambdaAliases,
+				template)
 		}
-		template.AddResource(apiGatewayPermissionResourceName, lambdaInvokePermission)
 
 		// BEGIN CORS - OPTIONS verb
-		// CORS is API global, but it's possible that there are multiple different lambda functions
-		// that are handling the same HTTP resource. In this case, track whether we've already created an
-		// OPTIONS entry for this path and only append iff this is the first time through
-		if api.corsEnabled() {
+		// CORS may be enabled for the API, the resource, or a method, and it's possible that
+		// there are multiple different lambda functions that are handling the same HTTP resource.
+		// In this case, track whether we've already created an OPTIONS entry for this path and
+		// only append iff this is the first time through
+		resourceCORSPath := corsPaths[eachResourceDef.pathPart]
+		if resourceCORSPath.preflight != nil {
 			methodResourceName := CloudFormationResourceName(fmt.Sprintf("%s-OPTIONS",
 				eachResourceDef.pathPart), eachResourceDef.pathPart)
 			_, resourceExists := optionsMethodPathMap[methodResourceName]
 			if !resourceExists {
-				template.AddResource(methodResourceName, corsOptionsGatewayMethod(api,
+				preflightCORS, preflightCORSErr := newCORSConfig(resourceCORSPath.preflight,
+					resourceCORSPath.methods)
+				if preflightCORSErr != nil {
+					return errors.Wrapf(preflightCORSErr,
+						"Failed to create CORS preflight for resource: %s",
+						eachResourceDef.pathPart)
+				}
+				template.AddResource(methodResourceName, corsOptionsGatewayMethod(preflightCORS,
 					apiGatewayRestAPIID,
 					parentResource))
 				apiMethodCloudFormationResources = append(apiMethodCloudFormationResources, methodResourceName)
@@ -644,34 +1029,88 @@ func (api *API) Marshal(serviceName string,
 		// BEGIN - user defined verbs
 		for eachMethodName, eachMethodDef := range eachResourceDef.Methods {
 
-			methodRequestTemplates, methodRequestTemplatesErr := methodRequestTemplates(eachMethodDef)
-			if methodRequestTemplatesErr != nil {
-				return methodRequestTemplatesErr
+			contentHandling := eachMethodDef.Integration.ContentHandling
+			if contentHandling == "" && len(api.BinaryMediaTypes) != 0 {
+				contentHandling = APIGatewayContentHandlingConvertToText
 			}
-			apiGatewayMethod := &gocf.APIGatewayMethod{
-				HTTPMethod: gocf.String(eachMethodName),
-				ResourceID: parentResource.String(),
-				RestAPIID:  apiGatewayRestAPIID.String(),
-				Integration: &gocf.APIGatewayMethodIntegration{
+			contentHandlingErr := validateContentHandling(contentHandling)
+			if contentHandlingErr != nil {
+				return contentHandlingErr
+			}
+			for _, eachResponse := range eachMethodDef.Integration.Responses {
+				contentHandlingErr = validateContentHandling(eachResponse.ContentHandling)
+				if contentHandlingErr != nil {
+					return contentHandlingErr
+				}
+			}
+			var methodIntegration *gocf.APIGatewayMethodIntegration
+			if eachMethodDef.serviceIntegration != nil {
+				serviceIntegration, serviceIntegrationErr := eachMethodDef.serviceIntegration.methodIntegration(gocf.GetAtt(serviceRoleResName, "Arn"))
+				if serviceIntegrationErr != nil {
+					return serviceIntegrationErr
+				}
+				// Method template overrides apply to service integrations as well
+				requestTemplates := serviceIntegration.RequestTemplates.(map[string]interface{})
+				if eachMethodDef.replaceRequestTemplates {
+					requestTemplates = make(map[string]interface{})
+					serviceIntegration.RequestTemplates = requestTemplates
+				}
+				for eachContentType, eachTemplate := range eachMethodDef.Integration.RequestTemplates {
+					requestTemplates[eachContentType] = eachTemplate
+				}
+				methodIntegration = serviceIntegration
+				servicePrivileges = append(servicePrivileges, eachMethodDef.serviceIntegration.privilege)
+			} else {
+				if eachResourceDef.parentLambda == nil {
+					return fmt.Errorf("method %s for service resource %s must be created by NewServiceMethod",
+						eachMethodName,
+						eachResourceDef.pathPart)
+				}
+				methodRequestTemplates, methodRequestTemplatesErr := methodRequestTemplates(api, eachMethodDef)
+				if methodRequestTemplatesErr != nil {
+					return methodRequestTemplatesErr
+				}
+				methodIntegration = &gocf.APIGatewayMethodIntegration{
 					IntegrationHTTPMethod: gocf.String("POST"),
 					Type:                  gocf.String("AWS"),
 					RequestTemplates:      methodRequestTemplates,
-					URI: gocf.Join("",
-						gocf.String("arn:aws:apigateway:"),
-						gocf.Ref("AWS::Region"),
-						gocf.String(":lambda:path/2015-03-31/functions/"),
-						gocf.GetAtt(eachResourceDef.parentLambda.LogicalResourceName(), "Arn"),
-						gocf.String("/invocations")),
-				},
+					URI:                   lambdaIntegrationURI(eachResourceDef.parentLambda, lambdaAliases),
+				}
+			}
+			apiGatewayMethod := &gocf.APIGatewayMethod{
+				HTTPMethod:  gocf.String(eachMethodName),
+				ResourceID:  parentResource.String(),
+				RestAPIID:   apiGatewayRestAPIID.String(),
+				Integration: methodIntegration,
+			}
+			if contentHandling != "" {
+				apiGatewayMethod.Integration.ContentHandling = gocf.String(contentHandling)
 			}
 			// Handle authorization
 			if eachMethodDef.authorizationID != nil {
 				// See https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-apigateway-method.html#cfn-apigateway-method-authorizationtype
 				apiGatewayMethod.AuthorizationType = gocf.String("CUSTOM")
 				apiGatewayMethod.AuthorizerID = eachMethodDef.authorizationID.String()
+				if authorizer, isAuthorizer := eachMethodDef.authorizationID.(*APIAuthorizer); isAuthorizer {
+					authorizerErr := authorizer.marshal(apiGatewayResName, template)
+					if authorizerErr != nil {
+						return authorizerErr
+					}
+					apiGatewayMethod.AuthorizationType = gocf.String(authorizer.methodAuthorizationType())
+				}
+				if len(eachMethodDef.AuthorizationScopes) != 0 {
+					var scopes []gocf.Stringable
+					for _, eachScope := range eachMethodDef.AuthorizationScopes {
+						scopes = append(scopes, gocf.String(eachScope))
+					}
+					apiGatewayMethod.AuthorizationScopes = gocf.StringList(scopes...)
+				}
 			} else {
 				apiGatewayMethod.AuthorizationType = gocf.String("NONE")
 			}
+			if eachMethodDef.APIKeyRequired {
+				apiGatewayMethod.APIKeyRequired = gocf.Bool(true)
+			}
 			if len(eachMethodDef.Parameters) != 0 {
 				requestParams := make(map[string]string)
 				for eachKey, eachBool := range eachMethodDef.Parameters {
@@ -679,26 +1118,72 @@ func (api *API) Marshal(serviceName string,
 				}
 				apiGatewayMethod.RequestParameters = requestParams
 			}
+			if eachMethodDef.OperationName != "" {
+				apiGatewayMethod.OperationName = gocf.String(eachMethodDef.OperationName)
+			}
+			// Request models and validation
+			if len(eachMethodDef.Models) != 0 {
+				requestModels := make(map[string]*gocf.StringExpr)
+				for eachContentType, eachModel := range eachMethodDef.Models {
+					modelRef, modelRefErr := apiGatewayModelResource(apiGatewayResName,
+						eachContentType,
+						eachModel,
+						template)
+					if modelRefErr != nil {
+						return modelRefErr
+					}
+					requestModels[eachContentType] = modelRef
+				}
+				apiGatewayMethod.RequestModels = requestModels
+			} else if eachMethodDef.ValidateRequestBody {
+				logger.WithFields(logrus.Fields{
+					"Resource": eachResourceDef.pathPart,
+					"Method":   eachMethodName,
+				}).Warn("Request body validation enabled without any request Models")
+			}
+			if eachMethodDef.ValidateRequestBody || eachMethodDef.ValidateRequestParameters {
+				validatorResName := apiGatewayRequestValidatorResource(apiGatewayResName,
+					eachMethodDef,
+					template)
+				apiGatewayMethod.RequestValidatorID = gocf.Ref(validatorResName).String()
+			}
 
+			methodCORS, methodCORSErr := newCORSConfig(api.methodCORSOptions(eachResourceDef, eachMethodDef),
+				resourceCORSPath.methods)
+			if methodCORSErr != nil {
+				return errors.Wrapf(methodCORSErr,
+					"Failed to create CORS headers for method: %s %s",
+					eachMethodName,
+					eachResourceDef.pathPart)
+			}
 			// Add the integration response RegExps
 			apiGatewayMethod.Integration.IntegrationResponses = integrationResponses(api,
 				eachMethodDef.Integration.Responses,
-				api.corsEnabled())
+				methodCORS)
 
 			// Add outbound method responses
-			apiGatewayMethod.MethodResponses = methodResponses(api,
+			methodResponseList, methodResponsesErr := methodResponses(api,
+				apiGatewayResName,
 				eachMethodDef.Responses,
-				api.corsEnabled())
+				methodCORS,
+				template)
+			if methodResponsesErr != nil {
+				return methodResponsesErr
+			}
+			apiGatewayMethod.MethodResponses = methodResponseList
 
 			prefix := fmt.Sprintf("%s%s", eachMethodDef.httpMethod, eachResourceMethodKey)
 			methodResourceName := CloudFormationResourceName(prefix, eachResourceMethodKey, serviceName)
 			res := template.AddResource(methodResourceName, apiGatewayMethod)
-			res.DependsOn = append(res.DependsOn, apiGatewayPermissionResourceName)
+			res.DependsOn = append(res.DependsOn, apiGatewayPermissionResourceNames...)
 			apiMethodCloudFormationResources = append(apiMethodCloudFormationResources,
 				methodResourceName)
 		}
 	}
 	// END
+	if len(servicePrivileges) != 0 {
+		serviceIntegrationRole(serviceRoleResName, servicePrivileges, template)
+	}
 	if nil != api.stage {
 		// Is the stack already deployed?
 		stageName := api.stage.name
@@ -710,30 +1195,27 @@ func (api *API) Marshal(serviceName string,
 		if nil != stageInfoErr {
 			return stageInfoErr
 		}
+		var deploymentResName string
 		if nil == stageInfo {
 			// Use a stable identifier so that we can update the existing deployment
 			apiDeploymentResName := CloudFormationResourceName("APIGatewayDeployment",
 				serviceName)
-			apiDeployment := &gocf.APIGatewayDeployment{
-				Description: gocf.String(api.stage.Description),
-				RestAPIID:   apiGatewayRestAPIID.String(),
-				StageName:   gocf.String(stageName),
-				StageDescription: &gocf.APIGatewayDeploymentStageDescription{
-					Description: gocf.String(api.stage.Description),
-					Variables:   api.stage.Variables,
-				},
-			}
-			if api.stage.CacheClusterEnabled {
-				apiDeployment.StageDescription.CacheClusterEnabled =
-					gocf.Bool(api.stage.CacheClusterEnabled)
+			stageDescription, stageDependsOn, stageDescriptionErr := api.stage.stageDescription(apiGatewayResName,
+				template)
+			if stageDescriptionErr != nil {
+				return stageDescriptionErr
 			}
-			if api.stage.CacheClusterSize != "" {
-				apiDeployment.StageDescription.CacheClusterSize =
-					gocf.String(api.stage.CacheClusterSize)
+			apiDeployment := &gocf.APIGatewayDeployment{
+				Description:      gocf.String(api.stage.Description),
+				RestAPIID:        apiGatewayRestAPIID.String(),
+				StageName:        gocf.String(stageName),
+				StageDescription: stageDescription,
 			}
 			deployment := template.AddResource(apiDeploymentResName, apiDeployment)
+			deployment.DependsOn = append(deployment.DependsOn, stageDependsOn...)
 			deployment.DependsOn = append(deployment.DependsOn, apiMethodCloudFormationResources...)
 			deployment.DependsOn = append(deployment.DependsOn, apiGatewayResName)
+			deploymentResName = apiDeploymentResName
 		} else {
 			newDeployment := &gocf.APIGatewayDeployment{
 				Description: gocf.String("Deployment"),
@@ -744,7 +1226,7 @@ func (api *API) Marshal(serviceName string,
 			}
 			// Use an unstable ID s.t. we can actually create a new deployment event.  Not sure how this
 			// is going to work with deletes...
-			deploymentResName := CloudFormationResourceName("APIGatewayDeployment")
+			deploymentResName = CloudFormationResourceName("APIGatewayDeployment")
 			deployment := template.AddResource(deploymentResName, newDeployment)
 			deployment.DependsOn = append(deployment.DependsOn, apiMethodCloudFormationResources...)
 			deployment.DependsOn = append(deployment.DependsOn, apiGatewayResName)
@@ -760,6 +1242,63 @@ func (api *API) Marshal(serviceName string,
 				gocf.String(".amazonaws.com/"),
 				gocf.String(stageName)),
 		}
+		// Additional stages share the deployment
+		for _, eachStage := range api.stages {
+			stageResource, stageDependsOn, stageResourceErr := eachStage.stageResource(apiGatewayResName,
+				deploymentResName,
+				template)
+			if stageResourceErr != nil {
+				return stageResourceErr
+			}
+			stageRes := template.AddResource(CloudFormationResourceName("APIGatewayStage",
+				apiGatewayResName,
+				eachStage.name),
+				stageResource)
+			stageRes.DependsOn = append(stageRes.DependsOn, stageDependsOn...)
+			template.Outputs[stageURLOutputName(eachStage.name)] = &gocf.Output{
+				Description: fmt.Sprintf("API Gateway %s stage URL", eachStage.name),
+				Value: gocf.Join("",
+					gocf.String("https://"),
+					apiGatewayRestAPIID,
+					gocf.String(".execute-api."),
+					gocf.Ref("AWS::Region"),
+					gocf.String(".amazonaws.com/"),
+					gocf.String(eachStage.name)),
+			}
+		}
+		if api.CustomDomain != nil {
+			customDomainErr := api.CustomDomain.marshal(apiGatewayResName,
+				stageName,
+				deploymentResName,
+				template)
+			if customDomainErr != nil {
+				return customDomainErr
+			}
+		}
+		if api.WebACL != nil {
+			webACLErr := api.WebACL.marshal(apiGatewayResName,
+				stageName,
+				deploymentResName,
+				template)
+			if webACLErr != nil {
+				return webACLErr
+			}
+		}
+		for _, eachUsagePlan := range api.usagePlans {
+			usagePlanErr := eachUsagePlan.marshal(apiGatewayResName,
+				stageName,
+				deploymentResName,
+				template)
+			if usagePlanErr != nil {
+				return usagePlanErr
+			}
+		}
+	} else if api.CustomDomain != nil {
+		return fmt.Errorf("API %s must have a stage to use a custom domain", api.name)
+	} else if len(api.usagePlans) != 0 {
+		return fmt.Errorf("API %s must have a stage to use usage plans", api.name)
+	} else if api.WebACL != nil {
+		return fmt.Errorf("API %s must have a stage to use a WebACL", api.name)
 	}
 	return nil
 }
@@ -916,7 +1455,8 @@ func (resource *Resource) NewMethod(httpMethod string,
 
 // NewAuthorizedMethod associates the httpMethod name and authorizationID with
 // the given Resource. The authorizerID param is a cloudformation.Strinable
-// satisfying value
+// satisfying value. Provide an *APIAuthorizer value to create the authorizer
+// together with the API.
 func (resource *Resource) NewAuthorizedMethod(httpMethod string,
 	authorizerID gocf.Stringable,
 	defaultHTTPStatusCode int,
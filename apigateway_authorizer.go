@@ -0,0 +1,201 @@
+package sparta
+
+import (
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIAuthorizerTypeToken is a lambda authorizer that receives the
+	// caller's bearer token
+	// @enum APIAuthorizerType
+	APIAuthorizerTypeToken = "TOKEN"
+	// APIAuthorizerTypeRequest is a lambda authorizer that receives the
+	// request's identity sources
+	// @enum APIAuthorizerType
+	APIAuthorizerTypeRequest = "REQUEST"
+	// APIAuthorizerTypeCognito is a Cognito User Pool authorizer
+	// @enum APIAuthorizerType
+	APIAuthorizerTypeCognito = "COGNITO_USER_POOLS"
+)
+
+// defaultAuthorizerIdentitySource is the identity source used for TOKEN and
+// Cognito authorizers
+const defaultAuthorizerIdentitySource = "method.request.header.Authorization"
+
+// APIAuthorizer represents an API Gateway authorizer that is implemented
+// by either a Sparta lambda function or a Cognito User Pool. APIAuthorizer
+// satisfies the gocf.Stringable interface so that it can be provided
+// to NewAuthorizedMethod. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/apigateway-control-access-to-api.html
+type APIAuthorizer struct {
+	name           string
+	authorizerType string
+	lambdaFn       *LambdaAWSInfo
+	providerARNs   []gocf.Stringable
+	// Comma separated identity sources. Defaults to the Authorization
+	// header for TOKEN and Cognito authorizers.
+	IdentitySource string
+	// Optional regular expression used to validate TOKEN authorizer tokens
+	// before the lambda function is invoked
+	IdentityValidationExpression string
+	// Optional authorization result cache TTL. Zero uses the API Gateway
+	// default of 300 seconds. Negative values disable caching.
+	ResultTTLSeconds int64
+}
+
+// LogicalResourceName returns the CloudFormation logical
+// resource name for this authorizer
+func (authorizer *APIAuthorizer) LogicalResourceName() string {
+	return CloudFormationResourceName("APIGatewayAuthorizer", authorizer.name)
+}
+
+// String satisfies the gocf.Stringable interface and returns the
+// authorizer ID
+func (authorizer *APIAuthorizer) String() *gocf.StringExpr {
+	return gocf.Ref(authorizer.LogicalResourceName()).String()
+}
+
+// methodAuthorizationType returns the AWS::ApiGateway::Method AuthorizationType
+// for the authorizer
+func (authorizer *APIAuthorizer) methodAuthorizationType() string {
+	if authorizer.authorizerType == APIAuthorizerTypeCognito {
+		return APIAuthorizerTypeCognito
+	}
+	return "CUSTOM"
+}
+
+// marshal adds the authorizer and any lambda permission to the template
+func (authorizer *APIAuthorizer) marshal(apiGatewayResName string,
+	template *gocf.Template) error {
+
+	authorizerResName := authorizer.LogicalResourceName()
+	if _, exists := template.Resources[authorizerResName]; exists {
+		return nil
+	}
+	authorizerRes := &gocf.APIGatewayAuthorizer{
+		Name:      gocf.String(authorizer.name),
+		RestAPIID: gocf.Ref(apiGatewayResName).String(),
+		Type:      gocf.String(authorizer.authorizerType),
+	}
+	identitySource := authorizer.IdentitySource
+	if identitySource == "" && authorizer.authorizerType != APIAuthorizerTypeRequest {
+		identitySource = defaultAuthorizerIdentitySource
+	}
+	if identitySource != "" {
+		authorizerRes.IdentitySource = gocf.String(identitySource)
+	}
+	if authorizer.IdentityValidationExpression != "" {
+		authorizerRes.IdentityValidationExpression = gocf.String(authorizer.IdentityValidationExpression)
+	}
+	if authorizer.ResultTTLSeconds > 0 {
+		authorizerRes.AuthorizerResultTTLInSeconds = gocf.Integer(authorizer.ResultTTLSeconds)
+	} else if authorizer.ResultTTLSeconds < 0 {
+		authorizerRes.AuthorizerResultTTLInSeconds = gocf.Integer(0)
+	}
+
+	if authorizer.authorizerType == APIAuthorizerTypeCognito {
+		authorizerRes.ProviderARNs = gocf.StringList(authorizer.providerARNs...)
+	} else {
+		lambdaArn := lambdaInvocationArn(authorizer.lambdaFn)
+		authorizerRes.AuthorizerURI = gocf.Join("",
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":apigateway:"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(":lambda:path/2015-03-31/functions/"),
+			lambdaArn,
+			gocf.String("/invocations"))
+
+		// API Gateway must be able to invoke the authorizer
+		template.AddResource(CloudFormationResourceName("APIGatewayAuthorizerPerm",
+			authorizer.name),
+			&gocf.LambdaPermission{
+				Action:       gocf.String("lambda:InvokeFunction"),
+				FunctionName: lambdaArn,
+				Principal:    gocf.String(APIGatewayPrincipal),
+				SourceArn: gocf.Join("",
+					gocf.String("arn:"),
+					gocf.Ref("AWS::Partition"),
+					gocf.String(":execute-api:"),
+					gocf.Ref("AWS::Region"),
+					gocf.String(":"),
+					gocf.Ref("AWS::AccountId"),
+					gocf.String(":"),
+					gocf.Ref(apiGatewayResName),
+					gocf.String("/authorizers/"),
+					gocf.Ref(authorizerResName)),
+			})
+	}
+	template.AddResource(authorizerResName, authorizerRes)
+	return nil
+}
+
+func newLambdaAuthorizer(name string,
+	authorizerType string,
+	lambdaFn *LambdaAWSInfo) (*APIAuthorizer, error) {
+	if name == "" {
+		return nil, errors.Errorf("%s authorizer name must not be empty", authorizerType)
+	}
+	if lambdaFn == nil {
+		return nil, errors.Errorf("%s authorizer %s must have a lambda function", authorizerType, name)
+	}
+	return &APIAuthorizer{
+		name:           name,
+		authorizerType: authorizerType,
+		lambdaFn:       lambdaFn,
+	}, nil
+}
+
+// NewLambdaTokenAuthorizer returns a TOKEN APIAuthorizer implemented by the
+// lambdaFn Sparta function. The function receives an
+// events.APIGatewayCustomAuthorizerRequest with the bearer token from the
+// Authorization header and returns an
+// events.APIGatewayCustomAuthorizerResponse. The lambdaFn must also be
+// included in the service's set of lambda functions.
+func NewLambdaTokenAuthorizer(name string, lambdaFn *LambdaAWSInfo) (*APIAuthorizer, error) {
+	return newLambdaAuthorizer(name, APIAuthorizerTypeToken, lambdaFn)
+}
+
+// NewLambdaRequestAuthorizer returns a REQUEST APIAuthorizer implemented by the
+// lambdaFn Sparta function. The function receives an
+// events.APIGatewayCustomAuthorizerRequestTypeRequest. The optional
+// identitySources (eg: method.request.header.Auth, method.request.querystring.token)
+// are required request values that are also used as the authorization
+// cache key. The lambdaFn must also be included in the service's set of
+// lambda functions.
+func NewLambdaRequestAuthorizer(name string,
+	lambdaFn *LambdaAWSInfo,
+	identitySources ...string) (*APIAuthorizer, error) {
+	authorizer, authorizerErr := newLambdaAuthorizer(name, APIAuthorizerTypeRequest, lambdaFn)
+	if authorizerErr != nil {
+		return nil, authorizerErr
+	}
+	authorizer.IdentitySource = strings.Join(identitySources, ",")
+	if authorizer.IdentitySource == "" {
+		// Without identity sources the authorization result can't be cached
+		authorizer.ResultTTLSeconds = -1
+	}
+	return authorizer, nil
+}
+
+// NewCognitoAuthorizer returns a COGNITO_USER_POOLS APIAuthorizer that
+// validates the identity token in the Authorization header against the
+// Cognito User Pool ARNs.
+func NewCognitoAuthorizer(name string, userPoolARNs ...gocf.Stringable) (*APIAuthorizer, error) {
+	if name == "" {
+		return nil, errors.Errorf("%s authorizer name must not be empty", APIAuthorizerTypeCognito)
+	}
+	if len(userPoolARNs) == 0 {
+		return nil, errors.Errorf("%s authorizer %s must have at least one user pool ARN",
+			APIAuthorizerTypeCognito,
+			name)
+	}
+	return &APIAuthorizer{
+		name:           name,
+		authorizerType: APIAuthorizerTypeCognito,
+		providerARNs:   userPoolARNs,
+	}, nil
+}
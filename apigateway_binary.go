@@ -0,0 +1,60 @@
+package sparta
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIGatewayContentHandlingConvertToBinary converts a base64 encoded
+	// string payload to the corresponding binary blob
+	// @enum APIGatewayContentHandling
+	APIGatewayContentHandlingConvertToBinary = "CONVERT_TO_BINARY"
+	// APIGatewayContentHandlingConvertToText converts a binary payload
+	// to a base64 encoded string
+	// @enum APIGatewayContentHandling
+	APIGatewayContentHandlingConvertToText = "CONVERT_TO_TEXT"
+)
+
+// validateContentHandling ensures the value is either empty or one of
+// the APIGatewayContentHandling values
+func validateContentHandling(contentHandling string) error {
+	switch contentHandling {
+	case "",
+		APIGatewayContentHandlingConvertToBinary,
+		APIGatewayContentHandlingConvertToText:
+		return nil
+	default:
+		return errors.Errorf("Invalid ContentHandling value: %s. Must be one of %s or %s",
+			contentHandling,
+			APIGatewayContentHandlingConvertToBinary,
+			APIGatewayContentHandlingConvertToText)
+	}
+}
+
+// binaryRequestTemplate returns the request mapping template used for
+// API.BinaryMediaTypes. The integration converts the binary payload to a
+// base64 encoded string which is passed as the raw body value.
+func binaryRequestTemplate() string {
+	defaultTemplate := _escFSMustString(false, "/resources/provision/apigateway/inputmapping_default.vtl")
+	return strings.Replace(defaultTemplate,
+		`"body" : "$input.path('$')",`,
+		`"body" : "$input.body",
+  "isBase64Encoded" : true,`,
+		1)
+}
+
+// binaryResponseTemplate returns the integration response mapping template
+// used for API.BinaryMediaTypes. The response body is the unquoted base64
+// encoded string returned by apigateway.NewBinaryResponse so that
+// API Gateway can CONVERT_TO_BINARY.
+func binaryResponseTemplate() string {
+	jsonTemplate := _escFSMustString(false, "/resources/provision/apigateway/outputmapping_json.vtl")
+	// Trailing ## comments the newline so that it isn't included
+	// in the decoded payload
+	return strings.Replace(jsonTemplate,
+		"$input.json('$.body')\n",
+		"$input.path('$.body')##\n",
+		1)
+}
@@ -0,0 +1,324 @@
+package sparta
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+var defaultCORSHeaders = map[string]interface{}{
+	"Access-Control-Allow-Headers": "Content-Type,X-Amz-Date,Authorization,X-Api-Key",
+	"Access-Control-Allow-Methods": "*",
+	"Access-Control-Allow-Origin":  "*",
+}
+
+// corsGatewayResponseTypes are the gateway responses that include the
+// API level CORS headers so that browsers can read API Gateway errors
+var corsGatewayResponseTypes = []string{"DEFAULT_4XX", "DEFAULT_5XX"}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+
+// CORSOptions is a struct that clients supply to the API, a Resource, or a
+// Method in order to enable and parameterize CORS API values. Method options
+// supersede Resource options, which supersede the API options.
+type CORSOptions struct {
+	// Headers represent the CORS headers that should be used for an OPTIONS
+	// preflight request. These should be of the form key-value as in:
+	// "Access-Control-Allow-Headers"="Content-Type,X-Amz-Date,Authorization,X-Api-Key"
+	// Headers supersede the values produced by the fields below.
+	Headers map[string]interface{}
+	// Allowed origins (eg: https://www.example.com). Defaults to "*". If there
+	// are multiple origins, the request's Origin header is returned iff it's
+	// in the list.
+	AllowedOrigins []string
+	// Allowed request headers. Defaults to
+	// Content-Type,X-Amz-Date,Authorization,X-Api-Key
+	AllowedHeaders []string
+	// Allowed HTTP methods. Defaults to the methods defined for the
+	// resource path.
+	AllowedMethods []string
+	// Response headers that browsers are allowed to access
+	ExposedHeaders []string
+	// Optional number of seconds the preflight response can be cached
+	MaxAge int64
+	// Should the response include Access-Control-Allow-Credentials?
+	AllowCredentials bool
+}
+
+func (options *CORSOptions) isDefault() bool {
+	return len(options.AllowedOrigins) == 0 &&
+		len(options.AllowedHeaders) == 0 &&
+		len(options.AllowedMethods) == 0 &&
+		len(options.ExposedHeaders) == 0 &&
+		options.MaxAge == 0 &&
+		!options.AllowCredentials
+}
+
+// corsConfig is the resolved set of CORS response headers
+type corsConfig struct {
+	headers map[string]interface{}
+	// Response mapping template prefix that returns the request Origin
+	// iff there are multiple allowed origins
+	originTemplate string
+}
+
+// newCORSConfig returns the CORS headers for the options and resource methods,
+// or nil if options is nil
+func newCORSConfig(options *CORSOptions, resourceMethods []string) (*corsConfig, error) {
+	if options == nil {
+		return nil, nil
+	}
+	config := &corsConfig{
+		headers: make(map[string]interface{}),
+	}
+	if options.isDefault() {
+		if len(options.Headers) == 0 {
+			for eachKey, eachValue := range defaultCORSHeaders {
+				config.headers[eachKey] = eachValue
+			}
+		}
+	} else {
+		origins := options.AllowedOrigins
+		if len(origins) == 0 {
+			origins = []string{"*"}
+		}
+		for _, eachOrigin := range origins {
+			if eachOrigin == "*" {
+				if len(origins) != 1 {
+					return nil, errors.Errorf("CORS AllowedOrigins must not include * together with other origins")
+				}
+				if options.AllowCredentials {
+					return nil, errors.Errorf("CORS AllowCredentials requires explicit AllowedOrigins")
+				}
+			} else if (!strings.HasPrefix(eachOrigin, "https://") &&
+				!strings.HasPrefix(eachOrigin, "http://")) ||
+				strings.ContainsAny(eachOrigin, "\"' ") {
+				return nil, errors.Errorf("Invalid CORS origin: %s", eachOrigin)
+			}
+		}
+		config.headers["Access-Control-Allow-Origin"] = origins[0]
+		if len(origins) > 1 {
+			config.headers["Vary"] = "Origin"
+			config.originTemplate = corsOriginTemplate(origins)
+		}
+		allowedHeaders := options.AllowedHeaders
+		if len(allowedHeaders) == 0 {
+			allowedHeaders = []string{defaultCORSHeaders["Access-Control-Allow-Headers"].(string)}
+		}
+		config.headers["Access-Control-Allow-Headers"] = strings.Join(allowedHeaders, ",")
+		allowedMethods := options.AllowedMethods
+		if len(allowedMethods) == 0 {
+			allowedMethods = resourceMethods
+		}
+		config.headers["Access-Control-Allow-Methods"] = strings.Join(allowedMethods, ",")
+		if len(options.ExposedHeaders) != 0 {
+			config.headers["Access-Control-Expose-Headers"] = strings.Join(options.ExposedHeaders, ",")
+		}
+		if options.MaxAge > 0 {
+			config.headers["Access-Control-Max-Age"] = strconv.FormatInt(options.MaxAge, 10)
+		}
+		if options.AllowCredentials {
+			config.headers["Access-Control-Allow-Credentials"] = "true"
+		}
+	}
+	for eachKey, eachValue := range options.Headers {
+		config.headers[eachKey] = eachValue
+	}
+	return config, nil
+}
+
+// corsOriginTemplate returns the VTL that overrides the static
+// Access-Control-Allow-Origin value with the request's Origin iff
+// the Origin is in the allowed list.
+// Ref: https://docs.aws.amazon.com/apigateway/latest/developerguide/apigateway-override-request-response-parameters.html
+func corsOriginTemplate(origins []string) string {
+	quotedOrigins := make([]string, len(origins))
+	for index, eachOrigin := range origins {
+		quotedOrigins[index] = fmt.Sprintf("\"%s\"", eachOrigin)
+	}
+	return fmt.Sprintf(`#set($corsOrigins = [%s])##
+#set($corsOrigin = $input.params().header.get("Origin"))##
+#if("$!corsOrigin" == "")#set($corsOrigin = $input.params().header.get("origin"))#end##
+#if($corsOrigins.contains($corsOrigin))##
+#set($corsHeader = "Access-Control-Allow-Origin")##
+#set($context.responseOverride.header[$corsHeader] = $corsOrigin)##
+#end##
+`, strings.Join(quotedOrigins, ","))
+}
+
+// responseTemplates returns the response mapping templates with the
+// origin override prepended
+func (config *corsConfig) responseTemplates(templates map[string]string) map[string]string {
+	if config == nil || config.originTemplate == "" {
+		return templates
+	}
+	corsTemplates := make(map[string]string, len(templates))
+	for eachContentType, eachTemplate := range templates {
+		corsTemplates[eachContentType] = config.originTemplate + eachTemplate
+	}
+	return corsTemplates
+}
+
+// corsHeaderValue returns the quoted static header value for an
+// API Gateway response parameter
+func corsHeaderValue(headerValue interface{}) interface{} {
+	switch typedValue := headerValue.(type) {
+	case *gocf.StringExpr:
+		return gocf.Join("",
+			gocf.String("'"),
+			typedValue.String(),
+			gocf.String("'"))
+	default:
+		return fmt.Sprintf("'%s'", headerValue)
+	}
+}
+
+func corsMethodResponseParams(config *corsConfig) map[string]bool {
+	responseParams := make(map[string]bool)
+	if config == nil {
+		return responseParams
+	}
+	for eachHeader := range config.headers {
+		keyName := fmt.Sprintf("method.response.header.%s", eachHeader)
+		responseParams[keyName] = true
+	}
+	return responseParams
+}
+
+func corsIntegrationResponseParams(config *corsConfig) map[string]interface{} {
+	responseParams := make(map[string]interface{})
+	if config == nil {
+		return responseParams
+	}
+	for eachHeader, eachHeaderValue := range config.headers {
+		keyName := fmt.Sprintf("method.response.header.%s", eachHeader)
+		responseParams[keyName] = corsHeaderValue(eachHeaderValue)
+	}
+	return responseParams
+}
+
+func corsOptionsGatewayMethod(config *corsConfig,
+	restAPIID gocf.Stringable,
+	resourceID gocf.Stringable) *gocf.APIGatewayMethod {
+	methodResponse := gocf.APIGatewayMethodMethodResponse{
+		StatusCode:         gocf.String("200"),
+		ResponseParameters: corsMethodResponseParams(config),
+	}
+
+	integrationResponse := gocf.APIGatewayMethodIntegrationResponse{
+		ResponseTemplates: config.responseTemplates(map[string]string{
+			"application/*": "",
+			"text/*":        "",
+		}),
+		StatusCode:         gocf.String("200"),
+		ResponseParameters: corsIntegrationResponseParams(config),
+	}
+
+	methodIntegrationIntegrationResponseList := gocf.APIGatewayMethodIntegrationResponseList{}
+	methodIntegrationIntegrationResponseList = append(methodIntegrationIntegrationResponseList,
+		integrationResponse)
+	methodResponseList := gocf.APIGatewayMethodMethodResponseList{}
+	methodResponseList = append(methodResponseList, methodResponse)
+
+	corsMethod := &gocf.APIGatewayMethod{
+		HTTPMethod:        gocf.String("OPTIONS"),
+		AuthorizationType: gocf.String("NONE"),
+		RestAPIID:         restAPIID.String(),
+		ResourceID:        resourceID.String(),
+		Integration: &gocf.APIGatewayMethodIntegration{
+			Type: gocf.String("MOCK"),
+			RequestTemplates: map[string]string{
+				"application/json": "{\"statusCode\": 200}",
+				"text/plain":       "statusCode: 200",
+			},
+			IntegrationResponses: &methodIntegrationIntegrationResponseList,
+		},
+		MethodResponses: &methodResponseList,
+	}
+	return corsMethod
+}
+
+// corsOptions returns the API level CORS options, or nil if CORS
+// isn't enabled for the API
+func (api *API) corsOptions() *CORSOptions {
+	if api.CORSOptions != nil {
+		return api.CORSOptions
+	}
+	if api.CORSEnabled {
+		return &CORSOptions{}
+	}
+	return nil
+}
+
+// methodCORSOptions returns the CORS options for the resource method, or nil
+// if CORS isn't enabled for the method
+func (api *API) methodCORSOptions(resource *Resource, method *Method) *CORSOptions {
+	if method.CORSOptions != nil {
+		return method.CORSOptions
+	}
+	if resource.CORSOptions != nil {
+		return resource.CORSOptions
+	}
+	return api.corsOptions()
+}
+
+// corsPath is the CORS preflight information for a resource path, which
+// may be shared by multiple Resources
+type corsPath struct {
+	methods   []string
+	preflight *CORSOptions
+}
+
+// corsPaths returns the CORS information for each resource path
+func (api *API) corsPaths() map[string]*corsPath {
+	var resourceKeys []string
+	for eachKey := range api.resources {
+		resourceKeys = append(resourceKeys, eachKey)
+	}
+	sort.Strings(resourceKeys)
+
+	paths := make(map[string]*corsPath)
+	methodOptions := make(map[string]*CORSOptions)
+	for _, eachKey := range resourceKeys {
+		eachResource := api.resources[eachKey]
+		path, pathExists := paths[eachResource.pathPart]
+		if !pathExists {
+			path = &corsPath{
+				methods: []string{"OPTIONS"},
+			}
+			paths[eachResource.pathPart] = path
+		}
+		if path.preflight == nil {
+			path.preflight = eachResource.CORSOptions
+		}
+		var methodNames []string
+		for eachMethodName := range eachResource.Methods {
+			methodNames = append(methodNames, eachMethodName)
+		}
+		sort.Strings(methodNames)
+		for _, eachMethodName := range methodNames {
+			path.methods = append(path.methods, eachMethodName)
+			if _, exists := methodOptions[eachResource.pathPart]; !exists &&
+				eachResource.Methods[eachMethodName].CORSOptions != nil {
+				methodOptions[eachResource.pathPart] = eachResource.Methods[eachMethodName].CORSOptions
+			}
+		}
+	}
+	// Resource options supersede the API options, which supersede
+	// any method options
+	for eachPathPart, eachPath := range paths {
+		sort.Strings(eachPath.methods)
+		if eachPath.preflight == nil {
+			eachPath.preflight = api.corsOptions()
+		}
+		if eachPath.preflight == nil {
+			eachPath.preflight = methodOptions[eachPathPart]
+		}
+	}
+	return paths
+}
@@ -0,0 +1,210 @@
+package sparta
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// API Gateway response types. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/supported-gateway-response-types.html
+const (
+	// APIGatewayResponseDefault4XX is the default response for 4XX errors
+	// @enum APIGatewayResponseType
+	APIGatewayResponseDefault4XX = "DEFAULT_4XX"
+	// APIGatewayResponseDefault5XX is the default response for 5XX errors
+	// @enum APIGatewayResponseType
+	APIGatewayResponseDefault5XX = "DEFAULT_5XX"
+	// APIGatewayResponseAccessDenied is the response for authorization failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseAccessDenied = "ACCESS_DENIED"
+	// APIGatewayResponseAPIConfigurationError is the response for an invalid API configuration
+	// @enum APIGatewayResponseType
+	APIGatewayResponseAPIConfigurationError = "API_CONFIGURATION_ERROR"
+	// APIGatewayResponseAuthorizerConfigurationError is the response for authorizer connection failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseAuthorizerConfigurationError = "AUTHORIZER_CONFIGURATION_ERROR"
+	// APIGatewayResponseAuthorizerFailure is the response for authorizer failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseAuthorizerFailure = "AUTHORIZER_FAILURE"
+	// APIGatewayResponseBadRequestParameters is the response for request parameter validation failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseBadRequestParameters = "BAD_REQUEST_PARAMETERS"
+	// APIGatewayResponseBadRequestBody is the response for request body validation failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseBadRequestBody = "BAD_REQUEST_BODY"
+	// APIGatewayResponseExpiredToken is the response for expired AWS authentication tokens
+	// @enum APIGatewayResponseType
+	APIGatewayResponseExpiredToken = "EXPIRED_TOKEN"
+	// APIGatewayResponseIntegrationFailure is the response for integration failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseIntegrationFailure = "INTEGRATION_FAILURE"
+	// APIGatewayResponseIntegrationTimeout is the response for integration timeouts
+	// @enum APIGatewayResponseType
+	APIGatewayResponseIntegrationTimeout = "INTEGRATION_TIMEOUT"
+	// APIGatewayResponseInvalidAPIKey is the response for invalid API keys
+	// @enum APIGatewayResponseType
+	APIGatewayResponseInvalidAPIKey = "INVALID_API_KEY"
+	// APIGatewayResponseInvalidSignature is the response for invalid AWS signatures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseInvalidSignature = "INVALID_SIGNATURE"
+	// APIGatewayResponseMissingAuthenticationToken is the response for missing
+	// authentication tokens, including requests for undefined resources
+	// @enum APIGatewayResponseType
+	APIGatewayResponseMissingAuthenticationToken = "MISSING_AUTHENTICATION_TOKEN"
+	// APIGatewayResponseQuotaExceeded is the response for usage plan quota failures
+	// @enum APIGatewayResponseType
+	APIGatewayResponseQuotaExceeded = "QUOTA_EXCEEDED"
+	// APIGatewayResponseRequestTooLarge is the response for requests that are too large
+	// @enum APIGatewayResponseType
+	APIGatewayResponseRequestTooLarge = "REQUEST_TOO_LARGE"
+	// APIGatewayResponseResourceNotFound is the response for resources that aren't found
+	// @enum APIGatewayResponseType
+	APIGatewayResponseResourceNotFound = "RESOURCE_NOT_FOUND"
+	// APIGatewayResponseThrottled is the response for throttled requests
+	// @enum APIGatewayResponseType
+	APIGatewayResponseThrottled = "THROTTLED"
+	// APIGatewayResponseUnauthorized is the response for authorizer rejections
+	// @enum APIGatewayResponseType
+	APIGatewayResponseUnauthorized = "UNAUTHORIZED"
+	// APIGatewayResponseUnsupportedMediaType is the response for unsupported
+	// Content-Type payloads
+	// @enum APIGatewayResponseType
+	APIGatewayResponseUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	// APIGatewayResponseWAFFiltered is the response for requests blocked by
+	// the API WebACL
+	// @enum APIGatewayResponseType
+	APIGatewayResponseWAFFiltered = "WAF_FILTERED"
+)
+
+var apiGatewayResponseTypes = map[string]bool{
+	APIGatewayResponseDefault4XX:                   true,
+	APIGatewayResponseDefault5XX:                   true,
+	APIGatewayResponseAccessDenied:                 true,
+	APIGatewayResponseAPIConfigurationError:        true,
+	APIGatewayResponseAuthorizerConfigurationError: true,
+	APIGatewayResponseAuthorizerFailure:            true,
+	APIGatewayResponseBadRequestParameters:         true,
+	APIGatewayResponseBadRequestBody:               true,
+	APIGatewayResponseExpiredToken:                 true,
+	APIGatewayResponseIntegrationFailure:           true,
+	APIGatewayResponseIntegrationTimeout:           true,
+	APIGatewayResponseInvalidAPIKey:                true,
+	APIGatewayResponseInvalidSignature:             true,
+	APIGatewayResponseMissingAuthenticationToken:   true,
+	APIGatewayResponseQuotaExceeded:                true,
+	APIGatewayResponseRequestTooLarge:              true,
+	APIGatewayResponseResourceNotFound:             true,
+	APIGatewayResponseThrottled:                    true,
+	APIGatewayResponseUnauthorized:                 true,
+	APIGatewayResponseUnsupportedMediaType:         true,
+	APIGatewayResponseWAFFiltered:                  true,
+}
+
+// DefaultAPIGatewayResponseTemplate is the application/json response template
+// used if APIGatewayResponse.Templates is empty. The JSON envelope matches the
+// aws/apigateway Error type returned by Sparta lambda functions. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-mapping-template-reference.html#context-variable-reference
+const DefaultAPIGatewayResponseTemplate = `{"err":"$context.error.responseType",` +
+	`"message":$context.error.messageString,` +
+	`"context":{"requestId":"$context.requestId"}}`
+
+// APIGatewayResponse customizes the response API Gateway returns when it
+// rejects a request or the integration fails. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-gatewayResponse-definition.html
+type APIGatewayResponse struct {
+	// Optional HTTP status code. Defaults to the response type status code.
+	StatusCode int
+	// Optional static response header values. Values are either strings
+	// or *gocf.StringExpr values.
+	Headers map[string]interface{}
+	// Optional response templates keyed by Content-Type. Defaults to
+	// the application/json DefaultAPIGatewayResponseTemplate.
+	Templates map[string]string
+}
+
+// gatewayResponses adds the user defined gateway responses, together with the
+// responses that include the API level CORS headers, and returns their
+// logical resource names
+func (api *API) gatewayResponses(cors *corsConfig,
+	apiGatewayResName string,
+	template *gocf.Template) ([]string, error) {
+
+	responseTypes := make(map[string]*APIGatewayResponse)
+	for eachResponseType, eachResponse := range api.GatewayResponses {
+		if !apiGatewayResponseTypes[eachResponseType] {
+			return nil, errors.Errorf("Unsupported gateway response type: %s", eachResponseType)
+		}
+		if eachResponse == nil {
+			eachResponse = &APIGatewayResponse{}
+		}
+		if eachResponse.StatusCode != 0 &&
+			(eachResponse.StatusCode < 100 || eachResponse.StatusCode > 599) {
+			return nil, errors.Errorf("Invalid StatusCode %d for gateway response: %s",
+				eachResponse.StatusCode,
+				eachResponseType)
+		}
+		responseTypes[eachResponseType] = eachResponse
+	}
+	if cors != nil {
+		for _, eachResponseType := range corsGatewayResponseTypes {
+			if _, exists := responseTypes[eachResponseType]; !exists {
+				responseTypes[eachResponseType] = nil
+			}
+		}
+	}
+	var sortedTypes []string
+	for eachResponseType := range responseTypes {
+		sortedTypes = append(sortedTypes, eachResponseType)
+	}
+	sort.Strings(sortedTypes)
+
+	var resourceNames []string
+	for _, eachResponseType := range sortedTypes {
+		responseParams := make(map[string]interface{})
+		if cors != nil {
+			for eachHeader, eachHeaderValue := range cors.headers {
+				// Only meaningful for preflight responses
+				if eachHeader == "Access-Control-Max-Age" {
+					continue
+				}
+				keyName := fmt.Sprintf("gatewayresponse.header.%s", eachHeader)
+				responseParams[keyName] = corsHeaderValue(eachHeaderValue)
+			}
+		}
+		gatewayResponse := &gocf.APIGatewayGatewayResponse{
+			ResponseType: gocf.String(eachResponseType),
+			RestAPIID:    gocf.Ref(apiGatewayResName).String(),
+		}
+		// CORS only responses use the API Gateway defaults
+		userResponse := responseTypes[eachResponseType]
+		if userResponse != nil {
+			for eachHeader, eachHeaderValue := range userResponse.Headers {
+				keyName := fmt.Sprintf("gatewayresponse.header.%s", eachHeader)
+				responseParams[keyName] = corsHeaderValue(eachHeaderValue)
+			}
+			if userResponse.StatusCode != 0 {
+				gatewayResponse.StatusCode = gocf.String(strconv.Itoa(userResponse.StatusCode))
+			}
+			templates := userResponse.Templates
+			if len(templates) == 0 {
+				templates = map[string]string{
+					"application/json": DefaultAPIGatewayResponseTemplate,
+				}
+			}
+			gatewayResponse.ResponseTemplates = templates
+		}
+		if len(responseParams) != 0 {
+			gatewayResponse.ResponseParameters = responseParams
+		}
+		resourceName := CloudFormationResourceName("APIGatewayResponse",
+			apiGatewayResName,
+			eachResponseType)
+		template.AddResource(resourceName, gatewayResponse)
+		resourceNames = append(resourceNames, resourceName)
+	}
+	return resourceNames, nil
+}
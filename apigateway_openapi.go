@@ -0,0 +1,866 @@
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// openAPIMethods are the OpenAPI Path Item keys that define operations
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// openAPIParameterLocations maps OpenAPI parameter locations to
+// API Gateway method request parameter locations
+var openAPIParameterLocations = map[string]string{
+	"path":   "path",
+	"query":  "querystring",
+	"header": "header",
+}
+
+// openAPISchemaPrefixes are the supported local schema reference prefixes
+// for OpenAPI 3.x and Swagger 2.0 documents
+var openAPISchemaPrefixes = []string{"#/components/schemas/", "#/definitions/"}
+
+var reOpenAPIModelName = regexp.MustCompile("[^A-Za-z0-9]+")
+
+type openAPIParameter struct {
+	Ref      string          `json:"$ref"`
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema json.RawMessage `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Ref         string                       `json:"$ref"`
+	Description string                       `json:"description"`
+	Required    bool                         `json:"required"`
+	Content     map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIRequestValidator struct {
+	ValidateRequestBody       bool `json:"validateRequestBody"`
+	ValidateRequestParameters bool `json:"validateRequestParameters"`
+}
+
+type openAPIOperation struct {
+	OperationID      string                     `json:"operationId"`
+	Parameters       []*openAPIParameter        `json:"parameters"`
+	RequestBody      *openAPIRequestBody        `json:"requestBody"`
+	Consumes         []string                   `json:"consumes"`
+	Responses        map[string]json.RawMessage `json:"responses"`
+	RequestValidator string                     `json:"x-amazon-apigateway-request-validator"`
+}
+
+type openAPIPathItem struct {
+	Parameters []*openAPIParameter `json:"parameters"`
+}
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Swagger string `json:"swagger"`
+	Info    struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas       map[string]json.RawMessage     `json:"schemas"`
+		Parameters    map[string]*openAPIParameter   `json:"parameters"`
+		RequestBodies map[string]*openAPIRequestBody `json:"requestBodies"`
+	} `json:"components"`
+	// Swagger 2.0
+	Definitions map[string]json.RawMessage   `json:"definitions"`
+	Parameters  map[string]*openAPIParameter `json:"parameters"`
+	Consumes    []string                     `json:"consumes"`
+	// API Gateway extensions
+	RequestValidators map[string]*openAPIRequestValidator `json:"x-amazon-apigateway-request-validators"`
+	RequestValidator  string                              `json:"x-amazon-apigateway-request-validator"`
+	BinaryMediaTypes  []string                            `json:"x-amazon-apigateway-binary-media-types"`
+}
+
+// schemas returns the named schemas for either document version
+func (doc *openAPIDocument) schemas() map[string]json.RawMessage {
+	if doc.Swagger != "" {
+		return doc.Definitions
+	}
+	return doc.Components.Schemas
+}
+
+// parameter returns the parameter, resolving any local reference
+func (doc *openAPIDocument) parameter(param *openAPIParameter) (*openAPIParameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	parameters := doc.Components.Parameters
+	refPrefix := "#/components/parameters/"
+	if doc.Swagger != "" {
+		parameters = doc.Parameters
+		refPrefix = "#/parameters/"
+	}
+	resolved, exists := parameters[strings.TrimPrefix(param.Ref, refPrefix)]
+	if !strings.HasPrefix(param.Ref, refPrefix) || !exists {
+		return nil, fmt.Errorf("unsupported parameter reference: %s", param.Ref)
+	}
+	return resolved, nil
+}
+
+// requestBody returns the operation's request body, resolving any local reference
+func (doc *openAPIDocument) requestBody(operation *openAPIOperation) (*openAPIRequestBody, error) {
+	body := operation.RequestBody
+	if body == nil || body.Ref == "" {
+		return body, nil
+	}
+	refPrefix := "#/components/requestBodies/"
+	resolved, exists := doc.Components.RequestBodies[strings.TrimPrefix(body.Ref, refPrefix)]
+	if !strings.HasPrefix(body.Ref, refPrefix) || !exists {
+		return nil, fmt.Errorf("unsupported request body reference: %s", body.Ref)
+	}
+	return resolved, nil
+}
+
+// openAPISchemaResolver rewrites local schema references to JSON Schema
+// definitions s.t. each model is a self contained document
+type openAPISchemaResolver struct {
+	schemas     map[string]json.RawMessage
+	definitions map[string]interface{}
+	referenced  map[string]bool
+}
+
+func (resolver *openAPISchemaResolver) schemaName(ref string) (string, error) {
+	for _, eachPrefix := range openAPISchemaPrefixes {
+		if strings.HasPrefix(ref, eachPrefix) {
+			return strings.TrimPrefix(ref, eachPrefix), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported schema reference: %s", ref)
+}
+
+func (resolver *openAPISchemaResolver) define(schemaName string) (interface{}, error) {
+	if definition, exists := resolver.definitions[schemaName]; exists {
+		return definition, nil
+	}
+	rawSchema, exists := resolver.schemas[schemaName]
+	if !exists {
+		return nil, fmt.Errorf("undefined schema: %s", schemaName)
+	}
+	var schema interface{}
+	unmarshalErr := json.Unmarshal(rawSchema, &schema)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse schema: %s", schemaName)
+	}
+	// Placeholder for recursive schemas
+	resolver.definitions[schemaName] = schema
+	resolved, resolvedErr := resolver.resolve(schema)
+	if resolvedErr != nil {
+		return nil, resolvedErr
+	}
+	resolver.definitions[schemaName] = resolved
+	return resolved, nil
+}
+
+func (resolver *openAPISchemaResolver) resolve(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			if ref, isRef := eachValue.(string); isRef && eachKey == "$ref" {
+				schemaName, schemaNameErr := resolver.schemaName(ref)
+				if schemaNameErr != nil {
+					return nil, schemaNameErr
+				}
+				_, defineErr := resolver.define(schemaName)
+				if defineErr != nil {
+					return nil, defineErr
+				}
+				resolver.referenced[schemaName] = true
+				resolved[eachKey] = "#/definitions/" + schemaName
+				continue
+			}
+			resolvedValue, resolvedValueErr := resolver.resolve(eachValue)
+			if resolvedValueErr != nil {
+				return nil, resolvedValueErr
+			}
+			resolved[eachKey] = resolvedValue
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			resolvedValue, resolvedValueErr := resolver.resolve(eachValue)
+			if resolvedValueErr != nil {
+				return nil, resolvedValueErr
+			}
+			resolved[eachIndex] = resolvedValue
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// openAPIModel returns the API Gateway Model for an OpenAPI schema. Schemas
+// that reference a named schema use that name, otherwise defaultName.
+func openAPIModel(doc *openAPIDocument,
+	defaultName string,
+	rawSchema json.RawMessage) (*Model, error) {
+	var schema interface{}
+	unmarshalErr := json.Unmarshal(rawSchema, &schema)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse schema for model: %s", defaultName)
+	}
+	resolver := &openAPISchemaResolver{
+		schemas:     doc.schemas(),
+		definitions: make(map[string]interface{}),
+		referenced:  make(map[string]bool),
+	}
+	modelName := defaultName
+	var resolved interface{}
+	var resolvedErr error
+
+	rootMap, rootMapOk := schema.(map[string]interface{})
+	if rootRef, rootRefOk := rootMap["$ref"].(string); rootMapOk && rootRefOk && len(rootMap) == 1 {
+		schemaName, schemaNameErr := resolver.schemaName(rootRef)
+		if schemaNameErr != nil {
+			return nil, schemaNameErr
+		}
+		modelName = schemaName
+		resolved, resolvedErr = resolver.define(schemaName)
+	} else {
+		resolved, resolvedErr = resolver.resolve(schema)
+	}
+	if resolvedErr != nil {
+		return nil, resolvedErr
+	}
+	modelName = reOpenAPIModelName.ReplaceAllString(modelName, "")
+	if modelName == "" {
+		return nil, fmt.Errorf("invalid model name for schema: %s", string(rawSchema))
+	}
+	resolvedMap, resolvedMapOk := resolved.(map[string]interface{})
+	if !resolvedMapOk {
+		return nil, fmt.Errorf("schema for model %s must be an object", modelName)
+	}
+	// Copy it so that the shared definition isn't mutated
+	modelSchema := map[string]interface{}{
+		"$schema": jsonSchemaDraft4,
+		"title":   modelName,
+	}
+	for eachKey, eachValue := range resolvedMap {
+		modelSchema[eachKey] = eachValue
+	}
+	if len(resolver.referenced) != 0 {
+		definitions := make(map[string]interface{})
+		for eachName := range resolver.referenced {
+			definitions[eachName] = resolver.definitions[eachName]
+		}
+		modelSchema["definitions"] = definitions
+	}
+	schemaBytes, schemaBytesErr := json.Marshal(modelSchema)
+	if schemaBytesErr != nil {
+		return nil, errors.Wrapf(schemaBytesErr, "Failed to marshal schema for model: %s", modelName)
+	}
+	description, _ := resolvedMap["description"].(string)
+	return &Model{
+		Description: description,
+		Name:        modelName,
+		Schema:      string(schemaBytes),
+	}, nil
+}
+
+// openAPIDefaultStatusCode returns the lowest 2xx response code
+// defined by the operation, or 200
+func openAPIDefaultStatusCode(operation *openAPIOperation) int {
+	defaultCode := 0
+	for eachKey := range operation.Responses {
+		statusCode, statusCodeErr := strconv.Atoi(eachKey)
+		if statusCodeErr == nil &&
+			statusCode >= http.StatusOK &&
+			statusCode < http.StatusMultipleChoices &&
+			(defaultCode == 0 || statusCode < defaultCode) {
+			defaultCode = statusCode
+		}
+	}
+	if defaultCode == 0 {
+		defaultCode = http.StatusOK
+	}
+	return defaultCode
+}
+
+// newOpenAPIMethod creates the Method for a single OpenAPI operation
+func newOpenAPIMethod(doc *openAPIDocument,
+	api *API,
+	resource *Resource,
+	httpMethod string,
+	pathItem *openAPIPathItem,
+	operation *openAPIOperation) (*Method, error) {
+
+	method, methodErr := resource.NewMethod(strings.ToUpper(httpMethod),
+		openAPIDefaultStatusCode(operation))
+	if methodErr != nil {
+		return nil, methodErr
+	}
+	method.OperationName = operation.OperationID
+
+	// Operation parameters override the path item parameters
+	// with the same name and location
+	params := make(map[string]*openAPIParameter)
+	var paramKeys []string
+	for _, eachParam := range append(pathItem.Parameters, operation.Parameters...) {
+		param, paramErr := doc.parameter(eachParam)
+		if paramErr != nil {
+			return nil, paramErr
+		}
+		paramKey := fmt.Sprintf("%s.%s", param.In, param.Name)
+		if _, exists := params[paramKey]; !exists {
+			paramKeys = append(paramKeys, paramKey)
+		}
+		params[paramKey] = param
+	}
+	var bodyRequired bool
+	bodySchemas := make(map[string]json.RawMessage)
+	for _, eachKey := range paramKeys {
+		param := params[eachKey]
+		if param.In == "body" {
+			// Swagger 2.0 request body
+			contentTypes := operation.Consumes
+			if len(contentTypes) == 0 {
+				contentTypes = doc.Consumes
+			}
+			if len(contentTypes) == 0 {
+				contentTypes = []string{"application/json"}
+			}
+			for _, eachContentType := range contentTypes {
+				bodySchemas[eachContentType] = param.Schema
+			}
+			bodyRequired = param.Required
+			continue
+		}
+		location, locationExists := openAPIParameterLocations[param.In]
+		if !locationExists {
+			// Cookie and form parameters aren't method request parameters
+			continue
+		}
+		required := param.Required || param.In == "path"
+		method.Parameters[fmt.Sprintf("method.request.%s.%s", location, param.Name)] = required
+		if required && param.In != "path" {
+			method.ValidateRequestParameters = true
+		}
+	}
+	requestBody, requestBodyErr := doc.requestBody(operation)
+	if requestBodyErr != nil {
+		return nil, requestBodyErr
+	}
+	if requestBody != nil {
+		for eachContentType, eachMediaType := range requestBody.Content {
+			bodySchemas[eachContentType] = eachMediaType.Schema
+		}
+		bodyRequired = requestBody.Required
+	}
+
+	// Request models
+	var contentTypes []string
+	for eachContentType := range bodySchemas {
+		contentTypes = append(contentTypes, eachContentType)
+	}
+	sort.Strings(contentTypes)
+	for eachIndex, eachContentType := range contentTypes {
+		method.SupportedRequestContentTypes = append(method.SupportedRequestContentTypes,
+			eachContentType)
+		if len(bodySchemas[eachContentType]) == 0 {
+			continue
+		}
+		modelName := fmt.Sprintf("%sRequest", operation.OperationID)
+		if len(contentTypes) > 1 {
+			modelName = fmt.Sprintf("%s%d", modelName, eachIndex)
+		}
+		model, modelErr := openAPIModel(doc, modelName, bodySchemas[eachContentType])
+		if modelErr != nil {
+			return nil, errors.Wrapf(modelErr,
+				"Failed to create %s request model for operation: %s",
+				eachContentType,
+				operation.OperationID)
+		}
+		method.Models[eachContentType] = model
+		method.ValidateRequestBody = bodyRequired
+	}
+	// Verify the Content-Types are supported now rather than when marshaling
+	_, templatesErr := methodRequestTemplates(api, method)
+	if templatesErr != nil {
+		return nil, errors.Wrapf(templatesErr, "Operation: %s", operation.OperationID)
+	}
+
+	// An explicit request validator replaces the inferred settings
+	validatorName := operation.RequestValidator
+	if validatorName == "" {
+		validatorName = doc.RequestValidator
+	}
+	if validatorName != "" {
+		validator, validatorExists := doc.RequestValidators[validatorName]
+		if !validatorExists {
+			return nil, fmt.Errorf("undefined request validator %s for operation: %s",
+				validatorName,
+				operation.OperationID)
+		}
+		method.ValidateRequestBody = validator.ValidateRequestBody
+		method.ValidateRequestParameters = validator.ValidateRequestParameters
+	}
+	return method, nil
+}
+
+// NewAPIGatewayFromOpenAPI returns a new API Gateway structure whose resources
+// and methods are defined by the JSON encoded OpenAPI 3.x or Swagger 2.0
+// document. Each operation is handled by the lambda function in handlers
+// keyed by the operation's `operationId`. Operation request body schemas
+// are created as request Models, and required parameters and bodies are
+// validated by API Gateway. The document's
+// `x-amazon-apigateway-request-validators` extension and the
+// `x-amazon-apigateway-request-validator` extension, either at the document
+// or operation level, can be used to override the inferred validation.
+func NewAPIGatewayFromOpenAPI(name string,
+	stage *Stage,
+	openAPIDocumentBytes []byte,
+	handlers map[string]*LambdaAWSInfo) (*API, error) {
+
+	if !bytes.HasPrefix(bytes.TrimSpace(openAPIDocumentBytes), []byte("{")) {
+		return nil, fmt.Errorf("OpenAPI document must be JSON encoded")
+	}
+	var doc openAPIDocument
+	unmarshalErr := json.Unmarshal(openAPIDocumentBytes, &doc)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse OpenAPI document")
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") && doc.Swagger != "2.0" {
+		return nil, fmt.Errorf("unsupported OpenAPI document version. Only OpenAPI 3.x and Swagger 2.0 are supported")
+	}
+
+	api := NewAPIGateway(name, stage)
+	api.Description = doc.Info.Description
+	if api.Description == "" {
+		api.Description = doc.Info.Title
+	}
+	api.BinaryMediaTypes = doc.BinaryMediaTypes
+
+	var paths []string
+	for eachPath := range doc.Paths {
+		paths = append(paths, eachPath)
+	}
+	sort.Strings(paths)
+	var missingHandlers []string
+	for _, eachPath := range paths {
+		pathItemMap := doc.Paths[eachPath]
+		var pathItem openAPIPathItem
+		if rawParams, exists := pathItemMap["parameters"]; exists {
+			unmarshalErr = json.Unmarshal(rawParams, &pathItem.Parameters)
+			if unmarshalErr != nil {
+				return nil, errors.Wrapf(unmarshalErr, "Failed to parse parameters for path: %s", eachPath)
+			}
+		}
+		for _, eachMethod := range openAPIMethods {
+			rawOperation, exists := pathItemMap[eachMethod]
+			if !exists {
+				continue
+			}
+			var operation openAPIOperation
+			unmarshalErr = json.Unmarshal(rawOperation, &operation)
+			if unmarshalErr != nil {
+				return nil, errors.Wrapf(unmarshalErr,
+					"Failed to parse operation %s %s",
+					strings.ToUpper(eachMethod),
+					eachPath)
+			}
+			if operation.OperationID == "" {
+				return nil, fmt.Errorf("operation %s %s doesn't define an operationId",
+					strings.ToUpper(eachMethod),
+					eachPath)
+			}
+			handler, handlerExists := handlers[operation.OperationID]
+			if !handlerExists || handler == nil {
+				missingHandlers = append(missingHandlers, operation.OperationID)
+				continue
+			}
+			// Reuse the resource if the lambda handles multiple methods
+			resource, resourceExists := api.resources[fmt.Sprintf("%s%s",
+				handler.lambdaFunctionName(),
+				eachPath)]
+			if !resourceExists {
+				var resourceErr error
+				resource, resourceErr = api.NewResource(eachPath, handler)
+				if resourceErr != nil {
+					return nil, resourceErr
+				}
+			}
+			_, methodErr := newOpenAPIMethod(&doc, api, resource, eachMethod, &pathItem, &operation)
+			if methodErr != nil {
+				return nil, errors.Wrapf(methodErr,
+					"Failed to create method for operation %s %s",
+					strings.ToUpper(eachMethod),
+					eachPath)
+			}
+		}
+	}
+	if len(missingHandlers) != 0 {
+		return nil, fmt.Errorf("no lambda function provided for operationIds: %s",
+			strings.Join(missingHandlers, ", "))
+	}
+	return api, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// OpenAPI export
+//
+
+// openAPIComponentSchemas converts the JSON Schema definitions references
+// in value to OpenAPI component schema references
+func openAPIComponentSchemas(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			if ref, isRef := eachValue.(string); isRef && eachKey == "$ref" {
+				converted[eachKey] = strings.Replace(ref,
+					"#/definitions/",
+					"#/components/schemas/",
+					1)
+				continue
+			}
+			converted[eachKey] = openAPIComponentSchemas(eachValue)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			converted[eachIndex] = openAPIComponentSchemas(eachValue)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// openAPIExporter accumulates the shared OpenAPI components
+type openAPIExporter struct {
+	schemas         map[string]interface{}
+	securitySchemes map[string]interface{}
+}
+
+// modelSchema adds the Model to the component schemas and returns
+// the schema reference
+func (exporter *openAPIExporter) modelSchema(model *Model) (map[string]interface{}, error) {
+	if model == nil || model.Name == "" {
+		return nil, fmt.Errorf("models must have a name")
+	}
+	schema := make(map[string]interface{})
+	if model.Schema != "" {
+		unmarshalErr := json.Unmarshal([]byte(model.Schema), &schema)
+		if unmarshalErr != nil {
+			return nil, errors.Wrapf(unmarshalErr, "Failed to parse schema for model: %s", model.Name)
+		}
+	}
+	definitions, _ := schema["definitions"].(map[string]interface{})
+	for eachName, eachDefinition := range definitions {
+		if _, exists := exporter.schemas[eachName]; !exists {
+			exporter.schemas[eachName] = openAPIComponentSchemas(eachDefinition)
+		}
+	}
+	delete(schema, "definitions")
+	delete(schema, "$schema")
+	if _, exists := schema["description"]; !exists && model.Description != "" {
+		schema["description"] = model.Description
+	}
+	exporter.schemas[model.Name] = openAPIComponentSchemas(schema)
+	return map[string]interface{}{
+		"$ref": "#/components/schemas/" + model.Name,
+	}, nil
+}
+
+// modelContent returns the OpenAPI content map for the Models
+func (exporter *openAPIExporter) modelContent(models map[string]*Model) (map[string]interface{}, error) {
+	content := make(map[string]interface{})
+	for eachContentType, eachModel := range models {
+		schema, schemaErr := exporter.modelSchema(eachModel)
+		if schemaErr != nil {
+			return nil, schemaErr
+		}
+		content[eachContentType] = map[string]interface{}{
+			"schema": schema,
+		}
+	}
+	return content, nil
+}
+
+// security returns the OpenAPI security requirements for the method
+func (exporter *openAPIExporter) security(method *Method) []interface{} {
+	requirement := make(map[string]interface{})
+	if authorizer, isAuthorizer := method.authorizationID.(*APIAuthorizer); isAuthorizer {
+		identitySource := authorizer.IdentitySource
+		if identitySource == "" {
+			identitySource = defaultAuthorizerIdentitySource
+		}
+		authType := "custom"
+		if authorizer.authorizerType == APIAuthorizerTypeCognito {
+			authType = "cognito_user_pools"
+		}
+		// The scheme identifies the first identity source
+		identityParts := strings.SplitN(strings.Split(identitySource, ",")[0], ".", 4)
+		identityLocation := "header"
+		identityName := "Authorization"
+		if len(identityParts) == 4 && identityParts[0] == "method" && identityParts[1] == "request" {
+			identityLocation = identityParts[2]
+			identityName = identityParts[3]
+			if identityLocation == "querystring" {
+				identityLocation = "query"
+			}
+		}
+		exporter.securitySchemes[authorizer.name] = map[string]interface{}{
+			"type":                         "apiKey",
+			"name":                         identityName,
+			"in":                           identityLocation,
+			"x-amazon-apigateway-authtype": authType,
+		}
+		scopes := method.AuthorizationScopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		requirement[authorizer.name] = scopes
+	} else if method.authorizationID != nil {
+		// Use the authorizer's logical resource name if it's a reference
+		schemeName := "authorizer"
+		var authorizerRef struct {
+			Ref string
+		}
+		authorizerBytes, authorizerBytesErr := json.Marshal(method.authorizationID.String())
+		if authorizerBytesErr == nil &&
+			json.Unmarshal(authorizerBytes, &authorizerRef) == nil &&
+			authorizerRef.Ref != "" {
+			schemeName = authorizerRef.Ref
+		}
+		exporter.securitySchemes[schemeName] = map[string]interface{}{
+			"type":                         "apiKey",
+			"name":                         "Authorization",
+			"in":                           "header",
+			"x-amazon-apigateway-authtype": "custom",
+		}
+		requirement[schemeName] = []string{}
+	}
+	if method.APIKeyRequired {
+		exporter.securitySchemes["api_key"] = map[string]interface{}{
+			"type": "apiKey",
+			"name": "x-api-key",
+			"in":   "header",
+		}
+		requirement["api_key"] = []string{}
+	}
+	if len(requirement) == 0 {
+		return nil
+	}
+	return []interface{}{requirement}
+}
+
+// operation returns the OpenAPI operation for the resource's method
+func (exporter *openAPIExporter) operation(resource *Resource,
+	method *Method) (map[string]interface{}, error) {
+
+	operationID := method.OperationName
+	if operationID == "" {
+		// Default to the HTTP method and function name, eg: getMainHelloWorld,
+		// or the service action for service integrations, eg: postSqsSendMessage
+		operationID = strings.ToLower(method.httpMethod)
+		operationSource := ""
+		if method.serviceIntegration != nil {
+			operationSource = method.serviceIntegration.name()
+		} else {
+			operationSource = resource.parentLambda.lambdaFunctionName()
+		}
+		for _, eachPart := range reOpenAPIModelName.Split(operationSource, -1) {
+			if eachPart != "" {
+				operationID += strings.ToUpper(eachPart[0:1]) + eachPart[1:]
+			}
+		}
+	}
+	operation := map[string]interface{}{
+		"operationId": operationID,
+	}
+	if resource.parentLambda != nil &&
+		resource.parentLambda.Options != nil &&
+		resource.parentLambda.Options.Description != "" {
+		operation["description"] = resource.parentLambda.Options.Description
+	}
+
+	// Parameters
+	var paramNames []string
+	for eachName := range method.Parameters {
+		paramNames = append(paramNames, eachName)
+	}
+	sort.Strings(paramNames)
+	var parameters []interface{}
+	for _, eachName := range paramNames {
+		nameParts := strings.SplitN(eachName, ".", 4)
+		if len(nameParts) != 4 || nameParts[0] != "method" || nameParts[1] != "request" {
+			return nil, fmt.Errorf("unsupported method request parameter: %s", eachName)
+		}
+		location := nameParts[2]
+		if location == "querystring" {
+			location = "query"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     nameParts[3],
+			"in":       location,
+			"required": method.Parameters[eachName] || location == "path",
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(parameters) != 0 {
+		operation["parameters"] = parameters
+	}
+
+	// Request body
+	if len(method.Models) != 0 {
+		content, contentErr := exporter.modelContent(method.Models)
+		if contentErr != nil {
+			return nil, contentErr
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"content":  content,
+			"required": method.ValidateRequestBody,
+		}
+	}
+
+	// Responses. Only include the default response and the responses
+	// that define models or headers, since every status code is eligible
+	// by default.
+	responses := make(map[string]interface{})
+	for eachStatusCode, eachResponse := range method.Responses {
+		if eachStatusCode != method.defaultHTTPResponseCode &&
+			len(eachResponse.Models) == 0 &&
+			len(eachResponse.Parameters) == 0 {
+			continue
+		}
+		response := map[string]interface{}{
+			"description": http.StatusText(eachStatusCode),
+		}
+		if len(eachResponse.Models) != 0 {
+			content, contentErr := exporter.modelContent(eachResponse.Models)
+			if contentErr != nil {
+				return nil, contentErr
+			}
+			response["content"] = content
+		}
+		headers := make(map[string]interface{})
+		for eachParam := range eachResponse.Parameters {
+			if strings.HasPrefix(eachParam, "method.response.header.") {
+				headers[strings.TrimPrefix(eachParam, "method.response.header.")] = map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string"},
+				}
+			}
+		}
+		if len(headers) != 0 {
+			response["headers"] = headers
+		}
+		responses[strconv.Itoa(eachStatusCode)] = response
+	}
+	if _, exists := responses[strconv.Itoa(method.defaultHTTPResponseCode)]; !exists {
+		responses[strconv.Itoa(method.defaultHTTPResponseCode)] = map[string]interface{}{
+			"description": http.StatusText(method.defaultHTTPResponseCode),
+		}
+	}
+	operation["responses"] = responses
+
+	if security := exporter.security(method); security != nil {
+		operation["security"] = security
+	}
+	return operation, nil
+}
+
+// OpenAPI returns the JSON encoded OpenAPI 3.0 document that describes the
+// API's resources, methods, request and response models and authorization
+// schemes. Methods without an OperationName use an operationId derived
+// from the HTTP method and lambda function name. The CORS OPTIONS methods
+// and lambda integrations aren't included.
+func (api *API) OpenAPI() ([]byte, error) {
+	exporter := &openAPIExporter{
+		schemas:         make(map[string]interface{}),
+		securitySchemes: make(map[string]interface{}),
+	}
+	var resourceKeys []string
+	for eachKey := range api.resources {
+		resourceKeys = append(resourceKeys, eachKey)
+	}
+	sort.Strings(resourceKeys)
+
+	paths := make(map[string]interface{})
+	for _, eachKey := range resourceKeys {
+		resource := api.resources[eachKey]
+		pathItem, _ := paths[resource.pathPart].(map[string]interface{})
+		if pathItem == nil {
+			pathItem = make(map[string]interface{})
+			paths[resource.pathPart] = pathItem
+		}
+		for eachMethodName, eachMethod := range resource.Methods {
+			methodKey := strings.ToLower(eachMethodName)
+			if _, exists := pathItem[methodKey]; exists {
+				return nil, fmt.Errorf("method %s is defined more than once for path: %s",
+					eachMethodName,
+					resource.pathPart)
+			}
+			operation, operationErr := exporter.operation(resource, eachMethod)
+			if operationErr != nil {
+				return nil, errors.Wrapf(operationErr,
+					"Failed to export method %s %s",
+					eachMethodName,
+					resource.pathPart)
+			}
+			pathItem[methodKey] = operation
+		}
+	}
+
+	info := map[string]interface{}{
+		"title":   api.name,
+		"version": "1.0",
+	}
+	if api.Description != "" {
+		info["description"] = api.Description
+	}
+	document := map[string]interface{}{
+		"openapi": "3.0.1",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(api.BinaryMediaTypes) != 0 {
+		document["x-amazon-apigateway-binary-media-types"] = api.BinaryMediaTypes
+	}
+	if api.stage != nil {
+		document["servers"] = []interface{}{
+			map[string]interface{}{
+				"url": fmt.Sprintf("https://{restApiId}.execute-api.{region}.amazonaws.com/%s",
+					api.stage.name),
+				"description": fmt.Sprintf("The %s stack Output value", OutputAPIGatewayURL),
+				"variables": map[string]interface{}{
+					"restApiId": map[string]interface{}{"default": "restApiId"},
+					"region":    map[string]interface{}{"default": "us-east-1"},
+				},
+			},
+		}
+	}
+	components := make(map[string]interface{})
+	if len(exporter.schemas) != 0 {
+		components["schemas"] = exporter.schemas
+	}
+	if len(exporter.securitySchemes) != 0 {
+		components["securitySchemes"] = exporter.securitySchemes
+	}
+	if len(components) != 0 {
+		document["components"] = components
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
@@ -0,0 +1,285 @@
+package sparta
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// APIServiceIntegration represents an API method that integrates directly
+// with an AWS service rather than a lambda function. Sparta creates the IAM
+// role that API Gateway assumes to call the service. Create instances with
+// NewSQSSendMessageIntegration, NewDynamoDBPutItemIntegration, or
+// NewStepFunctionsStartExecutionIntegration. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/getting-started-aws-proxy.html
+type APIServiceIntegration struct {
+	// The AWS service and action (eg: sqs, SendMessage)
+	service string
+	action  string
+	// The integration URI
+	uri *gocf.StringExpr
+	// The privilege granted to the API Gateway service role
+	privilege IAMRolePrivilege
+	// Static integration request parameters
+	requestParameters map[string]interface{}
+	// Request templates keyed by Content-Type that produce the service
+	// action request. Values are either strings or *gocf.StringExpr values.
+	// Defaults to an application/json template for the action.
+	RequestTemplates map[string]interface{}
+	// Optional response templates for the successful method response
+	// keyed by Content-Type. Defaults to the service response.
+	ResponseTemplates map[string]string
+}
+
+// serviceIntegrationURI returns the API Gateway service action URI
+func serviceIntegrationURI(service string, path ...gocf.Stringable) *gocf.StringExpr {
+	uriParts := []gocf.Stringable{
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":apigateway:"),
+		gocf.Ref("AWS::Region"),
+		gocf.String(fmt.Sprintf(":%s:", service)),
+	}
+	uriParts = append(uriParts, path...)
+	return gocf.Join("", uriParts...)
+}
+
+// NewSQSSendMessageIntegration returns an integration that sends the request
+// body to the SQS queue. The queueName is the name (not URL) of a queue in
+// the stack's account and region, eg: gocf.GetAtt("MyQueue", "QueueName").
+func NewSQSSendMessageIntegration(queueName gocf.Stringable) *APIServiceIntegration {
+	return &APIServiceIntegration{
+		service: "sqs",
+		action:  "SendMessage",
+		uri: serviceIntegrationURI("sqs",
+			gocf.String("path/"),
+			gocf.Ref("AWS::AccountId"),
+			gocf.String("/"),
+			queueName),
+		privilege: IAMRolePrivilege{
+			Actions: []string{"sqs:SendMessage"},
+			Resource: gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":sqs:"),
+				gocf.Ref("AWS::Region"),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId"),
+				gocf.String(":"),
+				queueName),
+		},
+		requestParameters: map[string]interface{}{
+			"integration.request.header.Content-Type": "'application/x-www-form-urlencoded'",
+		},
+		RequestTemplates: map[string]interface{}{
+			"application/json": "Action=SendMessage&MessageBody=$util.urlEncode($input.body)",
+		},
+	}
+}
+
+// NewDynamoDBPutItemIntegration returns an integration that puts an item
+// in the DynamoDB table. The tableName is the name of a table in the
+// stack's account and region, eg: gocf.Ref("MyTable"). The default
+// request template stores the request body as the "body" attribute of an
+// item whose "id" is the API Gateway request ID. Provide an application/json
+// RequestTemplates value to map the body to the table's attributes.
+func NewDynamoDBPutItemIntegration(tableName gocf.Stringable) *APIServiceIntegration {
+	return &APIServiceIntegration{
+		service: "dynamodb",
+		action:  "PutItem",
+		uri:     serviceIntegrationURI("dynamodb", gocf.String("action/PutItem")),
+		privilege: IAMRolePrivilege{
+			Actions: []string{"dynamodb:PutItem"},
+			Resource: gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":dynamodb:"),
+				gocf.Ref("AWS::Region"),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId"),
+				gocf.String(":table/"),
+				tableName),
+		},
+		RequestTemplates: map[string]interface{}{
+			"application/json": gocf.Join("",
+				gocf.String(`{"TableName":"`),
+				tableName,
+				gocf.String(`","Item":{"id":{"S":"$context.requestId"},`+
+					`"body":{"S":"$util.escapeJavaScript($input.body).replaceAll("\\'","'")"}}}`)),
+		},
+	}
+}
+
+// NewStepFunctionsStartExecutionIntegration returns an integration that
+// starts an execution of the state machine with the request body as the
+// execution input. The stateMachineArn is typically gocf.Ref("MyStateMachine").
+func NewStepFunctionsStartExecutionIntegration(stateMachineArn gocf.Stringable) *APIServiceIntegration {
+	return &APIServiceIntegration{
+		service: "states",
+		action:  "StartExecution",
+		uri:     serviceIntegrationURI("states", gocf.String("action/StartExecution")),
+		privilege: IAMRolePrivilege{
+			Actions:  []string{"states:StartExecution"},
+			Resource: stateMachineArn.String(),
+		},
+		RequestTemplates: map[string]interface{}{
+			"application/json": gocf.Join("",
+				gocf.String(`{"input":"$util.escapeJavaScript($input.json('$')).replaceAll("\\'","'")",`+
+					`"stateMachineArn":"`),
+				stateMachineArn,
+				gocf.String(`"}`)),
+		},
+	}
+}
+
+// name returns the service:Action name of the integration
+func (integration *APIServiceIntegration) name() string {
+	return fmt.Sprintf("%s:%s", integration.service, integration.action)
+}
+
+// methodIntegration returns the AWS::ApiGateway::Method Integration for
+// the service
+func (integration *APIServiceIntegration) methodIntegration(credentials *gocf.StringExpr) (*gocf.APIGatewayMethodIntegration, error) {
+	if len(integration.RequestTemplates) == 0 {
+		return nil, errors.Errorf("Service integration %s must define at least one RequestTemplates value",
+			integration.name())
+	}
+	requestTemplates := make(map[string]interface{}, len(integration.RequestTemplates))
+	for eachContentType, eachTemplate := range integration.RequestTemplates {
+		switch typedTemplate := eachTemplate.(type) {
+		case string:
+			requestTemplates[eachContentType] = typedTemplate
+		case gocf.Stringable:
+			requestTemplates[eachContentType] = typedTemplate.String()
+		default:
+			return nil, errors.Errorf("Unsupported service integration %s request template type: %T",
+				integration.name(),
+				eachTemplate)
+		}
+	}
+	methodIntegration := &gocf.APIGatewayMethodIntegration{
+		Credentials:           credentials,
+		IntegrationHTTPMethod: gocf.String("POST"),
+		// Reject Content-Types without a template rather than forward
+		// the raw request to the service
+		PassthroughBehavior: gocf.String("NEVER"),
+		RequestTemplates:    requestTemplates,
+		Type:                gocf.String("AWS"),
+		URI:                 integration.uri,
+	}
+	if len(integration.requestParameters) != 0 {
+		methodIntegration.RequestParameters = integration.requestParameters
+	}
+	return methodIntegration, nil
+}
+
+// serviceIntegrationRole adds the IAM role that API Gateway assumes to call the
+// integrated services
+func serviceIntegrationRole(roleResName string,
+	privileges []IAMRolePrivilege,
+	template *gocf.Template) {
+	var statements []spartaIAM.PolicyStatement
+	for _, eachPrivilege := range privileges {
+		statements = append(statements, eachPrivilege.policyStatement())
+	}
+	template.AddResource(roleResName, &gocf.IAMRole{
+		AssumeRolePolicyDocument: ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []ArbitraryJSONObject{
+				{
+					"Effect": "Allow",
+					"Principal": ArbitraryJSONObject{
+						"Service": []string{APIGatewayPrincipal},
+					},
+					"Action": []string{"sts:AssumeRole"},
+				},
+			},
+		},
+		Policies: &gocf.IAMRolePolicyList{
+			gocf.IAMRolePolicy{
+				PolicyDocument: ArbitraryJSONObject{
+					"Version":   "2012-10-17",
+					"Statement": statements,
+				},
+				PolicyName: gocf.String("APIGatewayServiceIntegrationPolicy"),
+			},
+		},
+	})
+}
+
+// NewServiceResource returns a Resource whose methods integrate directly
+// with AWS services. Use NewServiceMethod to add methods.
+func (api *API) NewServiceResource(pathPart string) (*Resource, error) {
+	resourcesKey := fmt.Sprintf("APIGatewayService%s", pathPart)
+	_, exists := api.resources[resourcesKey]
+	if exists {
+		return nil, fmt.Errorf("service path %s already defined", pathPart)
+	}
+	resource := &Resource{
+		pathPart: pathPart,
+		Methods:  make(map[string]*Method),
+	}
+	api.resources[resourcesKey] = resource
+	return resource, nil
+}
+
+// NewServiceMethod associates the httpMethod name with the AWS service
+// integration. Service 4XX and 5XX responses are returned as 400 and 500
+// responses respectively.
+func (resource *Resource) NewServiceMethod(httpMethod string,
+	defaultHTTPStatusCode int,
+	integration *APIServiceIntegration) (*Method, error) {
+	if integration == nil {
+		return nil, fmt.Errorf("service integration for method %s must not be nil", httpMethod)
+	}
+	method, methodErr := resource.NewMethod(httpMethod, defaultHTTPStatusCode)
+	if methodErr != nil {
+		return nil, methodErr
+	}
+	method.serviceIntegration = integration
+
+	// The Lambda response mapping doesn't apply to services
+	responseTemplates := make(map[string]string, len(integration.ResponseTemplates))
+	for eachContentType, eachTemplate := range integration.ResponseTemplates {
+		responseTemplates[eachContentType] = eachTemplate
+	}
+	method.Integration.Responses = map[int]*IntegrationResponse{
+		defaultHTTPStatusCode: {
+			Parameters: make(map[string]interface{}),
+			Templates:  responseTemplates,
+		},
+	}
+	errorResponses := map[int]string{
+		http.StatusBadRequest:          `4\d{2}`,
+		http.StatusInternalServerError: `5\d{2}`,
+	}
+	for eachStatusCode, eachPattern := range errorResponses {
+		if eachStatusCode == defaultHTTPStatusCode {
+			continue
+		}
+		method.Integration.Responses[eachStatusCode] = &IntegrationResponse{
+			Parameters:       make(map[string]interface{}),
+			SelectionPattern: eachPattern,
+		}
+	}
+	return method, nil
+}
+
+// serviceIntegrationIcons are the describe icons for the integrated services
+var serviceIntegrationIcons = map[string]string{
+	"sqs":      "AWSIcons/Messaging/Messaging_AmazonSQS.svg",
+	"dynamodb": "AWSIcons/Database/Database_AmazonDynamoDB.svg",
+}
+
+// describeIcon returns the describe icon for the service
+func (integration *APIServiceIntegration) describeIcon() string {
+	icon, iconExists := serviceIntegrationIcons[strings.ToLower(integration.service)]
+	if !iconExists {
+		icon = "AWSIcons/General/General_AWScloud.svg"
+	}
+	return icon
+}
@@ -0,0 +1,497 @@
+package sparta
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIGatewayLoggingLevelOff disables stage execution logging
+	// @enum APIGatewayLoggingLevel
+	APIGatewayLoggingLevelOff = "OFF"
+	// APIGatewayLoggingLevelError logs stage execution errors
+	// @enum APIGatewayLoggingLevel
+	APIGatewayLoggingLevelError = "ERROR"
+	// APIGatewayLoggingLevelInfo logs all stage execution events
+	// @enum APIGatewayLoggingLevel
+	APIGatewayLoggingLevelInfo = "INFO"
+)
+
+// APIGatewayLambdaAliasStageVariable is the stage variable that stores the
+// Stage.LambdaAlias value. Lambda integrations invoke the alias named by the
+// stage variable iff the API's stages define a LambdaAlias.
+const APIGatewayLambdaAliasStageVariable = "lambdaAlias"
+
+var (
+	reStageName         = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+	reStageVariableName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	reLambdaAliasName   = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+	// Output names are alphanumeric
+	reOutputNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9]`)
+	// See https://docs.aws.amazon.com/apigateway/latest/developerguide/stage-variables.html
+	reStageVariableValue = regexp.MustCompile(`^[A-Za-z0-9\-._~:/?#&=,]+$`)
+)
+
+// DefaultAPIAccessLogFormat is the JSON access log format used if
+// APIAccessLog.Format is empty. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-mapping-template-reference.html#context-variable-reference
+const DefaultAPIAccessLogFormat = `{"requestId":"$context.requestId",` +
+	`"ip":"$context.identity.sourceIp",` +
+	`"caller":"$context.identity.caller",` +
+	`"user":"$context.identity.user",` +
+	`"requestTime":"$context.requestTime",` +
+	`"httpMethod":"$context.httpMethod",` +
+	`"resourcePath":"$context.resourcePath",` +
+	`"status":"$context.status",` +
+	`"protocol":"$context.protocol",` +
+	`"responseLength":"$context.responseLength",` +
+	`"integrationLatency":"$context.integrationLatency",` +
+	`"responseLatency":"$context.responseLatency",` +
+	`"xrayTraceId":"$context.xrayTraceId"}`
+
+// APIAccessLog represents the stage access log settings. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-logging.html
+type APIAccessLog struct {
+	// Optional CloudWatch Logs log group or Kinesis Data Firehose ARN. If
+	// undefined, Sparta creates a log group for the stage.
+	DestinationArn gocf.Stringable
+	// Optional retention for the log group created by Sparta. Defaults
+	// to never expire.
+	RetentionInDays int64
+	// Optional log format. Defaults to DefaultAPIAccessLogFormat.
+	Format string
+}
+
+// APIMethodSettings represents per-method stage settings that
+// supersede the Stage values
+type APIMethodSettings struct {
+	// Optional execution logging level. One of the APIGatewayLoggingLevel values.
+	LoggingLevel string
+	// Enable detailed CloudWatch metrics for this method
+	MetricsEnabled bool
+	// Log full request and response data for this method
+	DataTraceEnabled bool
+	// Optional method throttle
+	Throttle *APIThrottle
+	// Enable response caching for this method. Requires the
+	// Stage CacheClusterEnabled value.
+	CachingEnabled bool
+	// Optional response cache TTL
+	CacheTTLSeconds int64
+}
+
+// stageMethodSetting returns the AWS::ApiGateway::Deployment MethodSetting for the
+// "/resource/path/HTTP_METHOD" key
+func (settings *APIMethodSettings) stageMethodSetting(methodKey string,
+	stage *Stage) (*gocf.APIGatewayDeploymentMethodSetting, error) {
+	separatorIndex := strings.LastIndex(methodKey, "/")
+	if settings == nil || separatorIndex < 0 || separatorIndex == len(methodKey)-1 {
+		return nil, errors.Errorf("Invalid stage method setting: %s. Keys must be of the form /resource/path/HTTP_METHOD",
+			methodKey)
+	}
+	resourcePath := methodKey[0:separatorIndex]
+	if resourcePath == "" {
+		resourcePath = "/"
+	}
+	// Forward slashes are encoded as ~1, eg: /resource/subresource
+	// is /~1resource~1subresource. See
+	// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-properties-apigateway-deployment-stagedescription-methodsetting.html
+	if resourcePath != "/*" {
+		resourcePath = "/" + strings.Replace(resourcePath, "/", "~1", -1)
+	}
+	methodSetting := &gocf.APIGatewayDeploymentMethodSetting{
+		ResourcePath:     gocf.String(resourcePath),
+		HTTPMethod:       gocf.String(methodKey[separatorIndex+1:]),
+		MetricsEnabled:   gocf.Bool(stage.MetricsEnabled || settings.MetricsEnabled),
+		DataTraceEnabled: gocf.Bool(stage.DataTraceEnabled || settings.DataTraceEnabled),
+	}
+	loggingLevel := settings.LoggingLevel
+	if loggingLevel == "" {
+		loggingLevel = stage.LoggingLevel
+	}
+	if loggingLevel != "" {
+		methodSetting.LoggingLevel = gocf.String(loggingLevel)
+	}
+	throttle := settings.Throttle
+	if throttle == nil {
+		throttle = stage.Throttle
+	}
+	if throttle != nil {
+		if throttle.RateLimit != 0 {
+			methodSetting.ThrottlingRateLimit = gocf.Integer(throttle.RateLimit)
+		}
+		if throttle.BurstLimit != 0 {
+			methodSetting.ThrottlingBurstLimit = gocf.Integer(throttle.BurstLimit)
+		}
+	}
+	if settings.CachingEnabled {
+		if !stage.CacheClusterEnabled {
+			return nil, errors.Errorf("Stage method setting %s enables caching without a stage cache cluster",
+				methodKey)
+		}
+		methodSetting.CachingEnabled = gocf.Bool(true)
+		if settings.CacheTTLSeconds != 0 {
+			methodSetting.CacheTTLInSeconds = gocf.Integer(settings.CacheTTLSeconds)
+		}
+	}
+	return methodSetting, nil
+}
+
+// stageDescription returns the AWS::ApiGateway::Deployment StageDescription
+// for the stage, adding any access log and account resources to the template.
+// The returned slice includes the resources the deployment depends on.
+func (stage *Stage) stageDescription(apiGatewayResName string,
+	template *gocf.Template) (*gocf.APIGatewayDeploymentStageDescription, []string, error) {
+	var dependsOn []string
+
+	stageDescription := &gocf.APIGatewayDeploymentStageDescription{
+		Description: gocf.String(stage.Description),
+		Variables:   stage.variables(),
+	}
+	if stage.CacheClusterEnabled {
+		stageDescription.CacheClusterEnabled =
+			gocf.Bool(stage.CacheClusterEnabled)
+	}
+	if stage.CacheClusterSize != "" {
+		stageDescription.CacheClusterSize =
+			gocf.String(stage.CacheClusterSize)
+	}
+	if stage.Throttle != nil {
+		if stage.Throttle.RateLimit != 0 {
+			stageDescription.ThrottlingRateLimit =
+				gocf.Integer(stage.Throttle.RateLimit)
+		}
+		if stage.Throttle.BurstLimit != 0 {
+			stageDescription.ThrottlingBurstLimit =
+				gocf.Integer(stage.Throttle.BurstLimit)
+		}
+	}
+	if stage.MetricsEnabled {
+		stageDescription.MetricsEnabled = gocf.Bool(true)
+	}
+	if stage.DataTraceEnabled {
+		stageDescription.DataTraceEnabled = gocf.Bool(true)
+	}
+	if stage.LoggingLevel != "" {
+		stageDescription.LoggingLevel = gocf.String(stage.LoggingLevel)
+	}
+	if stage.TracingEnabled {
+		stageDescription.TracingEnabled = gocf.Bool(true)
+	}
+
+	// Method settings
+	if len(stage.MethodSettings) != 0 {
+		var methodKeys []string
+		for eachKey := range stage.MethodSettings {
+			methodKeys = append(methodKeys, eachKey)
+		}
+		sort.Strings(methodKeys)
+		methodSettings := gocf.APIGatewayDeploymentMethodSettingList{}
+		for _, eachKey := range methodKeys {
+			methodSetting, methodSettingErr := stage.MethodSettings[eachKey].stageMethodSetting(eachKey, stage)
+			if methodSettingErr != nil {
+				return nil, nil, methodSettingErr
+			}
+			methodSettings = append(methodSettings, *methodSetting)
+		}
+		stageDescription.MethodSettings = &methodSettings
+	}
+
+	// Access logs
+	if stage.AccessLog != nil {
+		var destinationArn *gocf.StringExpr
+		if stage.AccessLog.DestinationArn != nil {
+			destinationArn = stage.AccessLog.DestinationArn.String()
+		} else {
+			logGroupResName := CloudFormationResourceName("APIGatewayAccessLogs",
+				apiGatewayResName,
+				stage.name)
+			logGroup := &gocf.LogsLogGroup{}
+			if stage.AccessLog.RetentionInDays != 0 {
+				logGroup.RetentionInDays = gocf.Integer(stage.AccessLog.RetentionInDays)
+			}
+			template.AddResource(logGroupResName, logGroup)
+			// The log group Arn attribute includes a trailing :* that
+			// API Gateway doesn't accept
+			destinationArn = gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":logs:"),
+				gocf.Ref("AWS::Region"),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId"),
+				gocf.String(":log-group:"),
+				gocf.Ref(logGroupResName))
+			dependsOn = append(dependsOn, logGroupResName)
+		}
+		format := stage.AccessLog.Format
+		if format == "" {
+			format = DefaultAPIAccessLogFormat
+		}
+		stageDescription.AccessLogSetting = &gocf.APIGatewayDeploymentAccessLogSetting{
+			DestinationArn: destinationArn,
+			Format:         gocf.String(format),
+		}
+	}
+
+	// The account level role that allows API Gateway to write logs
+	if stage.ProvisionCloudWatchRole {
+		roleResName := CloudFormationResourceName("APIGatewayCloudWatchRole", apiGatewayResName)
+		template.AddResource(roleResName, &gocf.IAMRole{
+			ManagedPolicyArns: gocf.StringList(gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":iam::aws:policy/service-role/AmazonAPIGatewayPushToCloudWatchLogs"))),
+			AssumeRolePolicyDocument: ArbitraryJSONObject{
+				"Version": "2012-10-17",
+				"Statement": []ArbitraryJSONObject{{
+					"Action": []string{"sts:AssumeRole"},
+					"Effect": "Allow",
+					"Principal": ArbitraryJSONObject{
+						"Service": []string{APIGatewayPrincipal},
+					}},
+				},
+			},
+		})
+		accountResName := CloudFormationResourceName("APIGatewayAccount", apiGatewayResName)
+		template.AddResource(accountResName, &gocf.APIGatewayAccount{
+			CloudWatchRoleArn: gocf.GetAtt(roleResName, "Arn"),
+		})
+		dependsOn = append(dependsOn, accountResName)
+	} else if stage.AccessLog != nil ||
+		(stage.LoggingLevel != "" && stage.LoggingLevel != APIGatewayLoggingLevelOff) {
+		if OptionsGlobal.Logger != nil {
+			OptionsGlobal.Logger.WithField("Stage", stage.name).
+				Debug("API Gateway logging requires an account level CloudWatch Logs role. " +
+					"Set Stage.ProvisionCloudWatchRole to create one.")
+		}
+	}
+	return stageDescription, dependsOn, nil
+}
+
+// variables returns the stage variables, including the LambdaAlias
+func (stage *Stage) variables() map[string]string {
+	if stage.LambdaAlias == "" {
+		return stage.Variables
+	}
+	variables := make(map[string]string, len(stage.Variables)+1)
+	for eachKey, eachValue := range stage.Variables {
+		variables[eachKey] = eachValue
+	}
+	variables[APIGatewayLambdaAliasStageVariable] = stage.LambdaAlias
+	return variables
+}
+
+// validate ensures the stage name and variables are supported by API Gateway
+func (stage *Stage) validate() error {
+	if !reStageName.MatchString(stage.name) {
+		return errors.Errorf("Invalid stage name: %s. Stage names may only contain alphanumeric, hyphen, and underscore characters",
+			stage.name)
+	}
+	for eachKey, eachValue := range stage.Variables {
+		if !reStageVariableName.MatchString(eachKey) {
+			return errors.Errorf("Invalid stage %s variable name: %s", stage.name, eachKey)
+		}
+		if eachValue != "" && !reStageVariableValue.MatchString(eachValue) {
+			return errors.Errorf("Invalid stage %s variable %s value: %s", stage.name, eachKey, eachValue)
+		}
+	}
+	if stage.LambdaAlias != "" {
+		if _, exists := stage.Variables[APIGatewayLambdaAliasStageVariable]; exists {
+			return errors.Errorf("Stage %s LambdaAlias conflicts with the %s stage variable",
+				stage.name,
+				APIGatewayLambdaAliasStageVariable)
+		}
+		if !reLambdaAliasName.MatchString(stage.LambdaAlias) {
+			return errors.Errorf("Invalid stage %s LambdaAlias: %s", stage.name, stage.LambdaAlias)
+		}
+	}
+	return nil
+}
+
+// stageResource returns the AWS::ApiGateway::Stage resource for an
+// additional stage of the deployment, adding any access log and
+// account resources to the template. The returned slice includes the
+// resources the stage depends on.
+func (stage *Stage) stageResource(apiGatewayResName string,
+	deploymentResName string,
+	template *gocf.Template) (*gocf.APIGatewayStage, []string, error) {
+	// Settings that apply to all methods are expressed as the /*/* method setting
+	methodSettings := stage.MethodSettings
+	if _, exists := methodSettings["/*/*"]; !exists &&
+		(stage.Throttle != nil ||
+			stage.MetricsEnabled ||
+			stage.DataTraceEnabled ||
+			stage.LoggingLevel != "") {
+		methodSettings = make(map[string]*APIMethodSettings, len(stage.MethodSettings)+1)
+		for eachKey, eachValue := range stage.MethodSettings {
+			methodSettings[eachKey] = eachValue
+		}
+		methodSettings["/*/*"] = &APIMethodSettings{}
+	}
+	settingsStage := *stage
+	settingsStage.MethodSettings = methodSettings
+	stageDescription, dependsOn, stageDescriptionErr := settingsStage.stageDescription(apiGatewayResName,
+		template)
+	if stageDescriptionErr != nil {
+		return nil, nil, stageDescriptionErr
+	}
+	stageResource := &gocf.APIGatewayStage{
+		CacheClusterEnabled: stageDescription.CacheClusterEnabled,
+		CacheClusterSize:    stageDescription.CacheClusterSize,
+		DeploymentID:        gocf.Ref(deploymentResName).String(),
+		Description:         stageDescription.Description,
+		RestAPIID:           gocf.Ref(apiGatewayResName).String(),
+		StageName:           gocf.String(stage.name),
+		TracingEnabled:      stageDescription.TracingEnabled,
+		Variables:           stageDescription.Variables,
+	}
+	if stageDescription.AccessLogSetting != nil {
+		stageResource.AccessLogSetting = &gocf.APIGatewayStageAccessLogSetting{
+			DestinationArn: stageDescription.AccessLogSetting.DestinationArn,
+			Format:         stageDescription.AccessLogSetting.Format,
+		}
+	}
+	if stageDescription.MethodSettings != nil {
+		stageMethodSettings := gocf.APIGatewayStageMethodSettingList{}
+		for _, eachSetting := range *stageDescription.MethodSettings {
+			stageMethodSettings = append(stageMethodSettings, gocf.APIGatewayStageMethodSetting{
+				CacheTTLInSeconds:    eachSetting.CacheTTLInSeconds,
+				CachingEnabled:       eachSetting.CachingEnabled,
+				DataTraceEnabled:     eachSetting.DataTraceEnabled,
+				HTTPMethod:           eachSetting.HTTPMethod,
+				LoggingLevel:         eachSetting.LoggingLevel,
+				MetricsEnabled:       eachSetting.MetricsEnabled,
+				ResourcePath:         eachSetting.ResourcePath,
+				ThrottlingBurstLimit: eachSetting.ThrottlingBurstLimit,
+				ThrottlingRateLimit:  eachSetting.ThrottlingRateLimit,
+			})
+		}
+		stageResource.MethodSettings = &stageMethodSettings
+	}
+	return stageResource, append(dependsOn, deploymentResName), nil
+}
+
+// stageURLOutputName returns the Output name for the stage URL
+func stageURLOutputName(stageName string) string {
+	return fmt.Sprintf("%s%s",
+		OutputAPIGatewayURL,
+		reOutputNameInvalidChars.ReplaceAllString(strings.Title(stageName), ""))
+}
+
+// AddStage adds an additional stage to the API that is deployed together
+// with the NewAPIGateway stage. CustomDomain, WebACL, and usage plans only
+// apply to the NewAPIGateway stage.
+func (api *API) AddStage(stage *Stage) error {
+	if api.stage == nil {
+		return errors.Errorf("API %s must have a stage to add stage %s", api.name, stage.name)
+	}
+	for _, eachStage := range api.allStages() {
+		if eachStage.name == stage.name {
+			return errors.Errorf("Stage %s is already defined for API %s", stage.name, api.name)
+		}
+	}
+	api.stages = append(api.stages, stage)
+	return nil
+}
+
+// allStages returns the NewAPIGateway stage together with the additional stages
+func (api *API) allStages() []*Stage {
+	if api.stage == nil {
+		return nil
+	}
+	return append([]*Stage{api.stage}, api.stages...)
+}
+
+// lambdaAliases returns the sorted set of Stage.LambdaAlias values. Every
+// stage must define a LambdaAlias if any stage does.
+func (api *API) lambdaAliases() ([]string, error) {
+	aliases := make(map[string]bool)
+	var missingAliases []string
+	for _, eachStage := range api.allStages() {
+		validateErr := eachStage.validate()
+		if validateErr != nil {
+			return nil, validateErr
+		}
+		if eachStage.LambdaAlias == "" {
+			missingAliases = append(missingAliases, eachStage.name)
+		} else {
+			aliases[eachStage.LambdaAlias] = true
+		}
+	}
+	if len(aliases) != 0 && len(missingAliases) != 0 {
+		return nil, errors.Errorf("API %s stages must all define a LambdaAlias. Missing: %s",
+			api.name,
+			strings.Join(missingAliases, ", "))
+	}
+	var sortedAliases []string
+	for eachAlias := range aliases {
+		sortedAliases = append(sortedAliases, eachAlias)
+	}
+	sort.Strings(sortedAliases)
+	return sortedAliases, nil
+}
+
+// lambdaIntegrationURI returns the integration URI for the lambda function. The
+// URI includes the alias stage variable iff the stages define a LambdaAlias.
+// Otherwise the URI targets the function's published alias, if any.
+func lambdaIntegrationURI(lambdaFn *LambdaAWSInfo, lambdaAliases []string) *gocf.StringExpr {
+	functionArn := []gocf.Stringable{lambdaInvocationArn(lambdaFn)}
+	if len(lambdaAliases) != 0 {
+		functionArn = []gocf.Stringable{gocf.GetAtt(lambdaFn.LogicalResourceName(), "Arn"),
+			gocf.String(fmt.Sprintf(":${stageVariables.%s}", APIGatewayLambdaAliasStageVariable))}
+	}
+	uriParts := []gocf.Stringable{
+		gocf.String("arn:aws:apigateway:"),
+		gocf.Ref("AWS::Region"),
+		gocf.String(":lambda:path/2015-03-31/functions/"),
+	}
+	uriParts = append(uriParts, functionArn...)
+	uriParts = append(uriParts, gocf.String("/invocations"))
+	return gocf.Join("", uriParts...)
+}
+
+// lambdaPermissions adds the permissions that allow API Gateway to invoke the
+// lambda function, its published alias, or each of the stage aliases, and
+// returns their logical resource names
+func lambdaPermissions(resourceKey string,
+	lambdaFn *LambdaAWSInfo,
+	lambdaAliases []string,
+	template *gocf.Template) []string {
+	if len(lambdaAliases) == 0 {
+		permissionResName := CloudFormationResourceName("APIGatewayLambdaPerm",
+			resourceKey)
+		template.AddResource(permissionResName, &gocf.LambdaPermission{
+			Action:       gocf.String("lambda:InvokeFunction"),
+			FunctionName: lambdaInvocationArn(lambdaFn),
+			Principal:    gocf.String(APIGatewayPrincipal),
+		})
+		return []string{permissionResName}
+	}
+	var permissionResNames []string
+	for _, eachAlias := range lambdaAliases {
+		permissionResName := CloudFormationResourceName("APIGatewayLambdaPerm",
+			resourceKey,
+			eachAlias)
+		permission := template.AddResource(permissionResName, &gocf.LambdaPermission{
+			Action: gocf.String("lambda:InvokeFunction"),
+			FunctionName: gocf.Join("",
+				gocf.GetAtt(lambdaFn.LogicalResourceName(), "Arn"),
+				gocf.String(":"),
+				gocf.String(eachAlias)),
+			Principal: gocf.String(APIGatewayPrincipal),
+		})
+		// Aliases published by Sparta must exist before the permission
+		if eachAlias == publishedAliasName(lambdaFn.Options) {
+			permission.DependsOn = append(permission.DependsOn,
+				CloudFormationResourceName("LambdaAlias", lambdaFn.LogicalResourceName(), eachAlias))
+		}
+		permissionResNames = append(permissionResNames, permissionResName)
+	}
+	return permissionResNames
+}
@@ -0,0 +1,135 @@
+package sparta
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Content-Types (eg: application/json, text/*) that key mapping templates
+var reMappingTemplateContentType = regexp.MustCompile(`^[A-Za-z0-9!#$&^_.+\-]+/([A-Za-z0-9!#$&^_.+\-]+|\*)$`)
+
+// APIMappingTemplates is a custom set of VTL mapping templates that replaces
+// the Sparta generated templates for a Method. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/models-mappings.html
+type APIMappingTemplates struct {
+	// Request templates keyed by Content-Type. If non-empty, replaces the
+	// Sparta request templates.
+	Request map[string]string
+	// Response templates keyed by Content-Type for the default HTTP status
+	// code. If non-empty, replaces the Sparta response templates.
+	Response map[string]string
+}
+
+func validateMappingTemplateContentType(contentType string) error {
+	if !reMappingTemplateContentType.MatchString(contentType) {
+		return errors.Errorf("Invalid mapping template Content-Type: %s", contentType)
+	}
+	return nil
+}
+
+// SetMappingTemplates replaces the Sparta generated request and default
+// response mapping templates with the custom set. Use SetRequestTemplate and
+// SetResponseTemplate to override a single template.
+func (method *Method) SetMappingTemplates(templates *APIMappingTemplates) error {
+	if templates == nil {
+		return errors.Errorf("Mapping templates for method %s must not be nil", method.httpMethod)
+	}
+	for eachContentType := range templates.Request {
+		if err := validateMappingTemplateContentType(eachContentType); err != nil {
+			return err
+		}
+	}
+	for eachContentType := range templates.Response {
+		if err := validateMappingTemplateContentType(eachContentType); err != nil {
+			return err
+		}
+	}
+	if len(templates.Request) != 0 {
+		method.Integration.RequestTemplates = make(map[string]string, len(templates.Request))
+		for eachContentType, eachTemplate := range templates.Request {
+			method.Integration.RequestTemplates[eachContentType] = eachTemplate
+		}
+		method.replaceRequestTemplates = true
+	}
+	if len(templates.Response) != 0 {
+		defaultResponse, exists := method.Integration.Responses[method.defaultHTTPResponseCode]
+		if !exists {
+			return errors.Errorf("Method %s doesn't define an integration response for status code: %d",
+				method.httpMethod,
+				method.defaultHTTPResponseCode)
+		}
+		defaultResponse.Templates = make(map[string]string, len(templates.Response))
+		for eachContentType, eachTemplate := range templates.Response {
+			defaultResponse.Templates[eachContentType] = eachTemplate
+		}
+	}
+	return nil
+}
+
+// SetRequestTemplate sets the request mapping template for the Content-Type. The
+// template supersedes the Sparta generated template for the Content-Type.
+func (method *Method) SetRequestTemplate(contentType string, template string) error {
+	if err := validateMappingTemplateContentType(contentType); err != nil {
+		return err
+	}
+	if method.Integration.RequestTemplates == nil {
+		method.Integration.RequestTemplates = make(map[string]string)
+	}
+	method.Integration.RequestTemplates[contentType] = template
+	return nil
+}
+
+// SetResponseTemplate sets the response mapping template for the Content-Type of
+// the integration response with the given HTTP status code. Use
+// NewIntegrationResponse to add an integration response for a status code
+// other than the default.
+func (method *Method) SetResponseTemplate(statusCode int, contentType string, template string) error {
+	if err := validateMappingTemplateContentType(contentType); err != nil {
+		return err
+	}
+	integrationResponse, exists := method.Integration.Responses[statusCode]
+	if !exists {
+		return errors.Errorf("Method %s doesn't define an integration response for status code: %d",
+			method.httpMethod,
+			statusCode)
+	}
+	if integrationResponse.Templates == nil {
+		integrationResponse.Templates = make(map[string]string)
+	}
+	integrationResponse.Templates[contentType] = template
+	return nil
+}
+
+// NewIntegrationResponse adds an integration response for the HTTP status code
+// that is selected by the regular expression. For lambda integrations the
+// selectionPattern matches the error message of a failed invocation. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/handle-errors-in-lambda-integration.html
+func (method *Method) NewIntegrationResponse(statusCode int, selectionPattern string) (*IntegrationResponse, error) {
+	if _, exists := method.Integration.Responses[statusCode]; exists {
+		return nil, errors.Errorf("Method %s already defines an integration response for status code: %d",
+			method.httpMethod,
+			statusCode)
+	}
+	if selectionPattern == "" {
+		return nil, errors.Errorf("Integration response %d for method %s requires a selection pattern",
+			statusCode,
+			method.httpMethod)
+	}
+	if _, compileErr := regexp.Compile(selectionPattern); compileErr != nil {
+		return nil, errors.Wrapf(compileErr, "Invalid selection pattern for status code: %d", statusCode)
+	}
+	integrationResponse := &IntegrationResponse{
+		Parameters:       make(map[string]interface{}),
+		SelectionPattern: selectionPattern,
+		Templates:        make(map[string]string),
+	}
+	method.Integration.Responses[statusCode] = integrationResponse
+	if _, exists := method.Responses[statusCode]; !exists {
+		method.Responses[statusCode] = &Response{
+			Parameters: make(map[string]bool),
+			Models:     make(map[string]*Model),
+		}
+	}
+	return integrationResponse, nil
+}
@@ -2,13 +2,18 @@ package sparta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
 	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/sirupsen/logrus"
 )
 
@@ -104,3 +109,1223 @@ func TestAPIV2Gateway(t *testing.T) {
 		false,
 		nil)
 }
+
+const testOpenAPIDocument = `{
+	"openapi": "3.0.0",
+	"info": {"title": "Pets", "version": "1.0.0"},
+	"paths": {
+		"/pets": {
+			"get": {
+				"operationId": "listPets",
+				"parameters": [{"name": "limit", "in": "query", "required": true, "schema": {"type": "integer"}}],
+				"responses": {"200": {"description": "Pets"}}
+			},
+			"post": {
+				"operationId": "createPet",
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}
+				},
+				"responses": {"201": {"description": "Created"}, "400": {"description": "Invalid"}}
+			}
+		},
+		"/pets/{petId}": {
+			"parameters": [{"$ref": "#/components/parameters/PetID"}],
+			"get": {
+				"operationId": "showPetById",
+				"x-amazon-apigateway-request-validator": "none",
+				"responses": {"default": {"description": "Pet"}}
+			}
+		}
+	},
+	"components": {
+		"parameters": {
+			"PetID": {"name": "petId", "in": "path", "required": true, "schema": {"type": "string"}}
+		},
+		"schemas": {
+			"Pet": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"name": {"type": "string"}, "owner": {"$ref": "#/components/schemas/Owner"}}
+			},
+			"Owner": {"type": "object", "properties": {"name": {"type": "string"}}}
+		}
+	},
+	"x-amazon-apigateway-request-validators": {
+		"none": {"validateRequestBody": false, "validateRequestParameters": false}
+	}
+}`
+
+func TestAPIGatewayFromOpenAPI(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda(LambdaName(mockLambda1),
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn2, _ := NewAWSLambda(LambdaName(mockLambda2),
+		mockLambda2,
+		IAMRoleDefinition{})
+	handlers := map[string]*LambdaAWSInfo{
+		"listPets":    lambdaFn,
+		"createPet":   lambdaFn,
+		"showPetById": lambdaFn2,
+	}
+	api, apiErr := NewAPIGatewayFromOpenAPI("SpartaOpenAPI",
+		nil,
+		[]byte(testOpenAPIDocument),
+		handlers)
+	if apiErr != nil {
+		t.Fatalf("Failed to create API from OpenAPI document: %s", apiErr)
+	}
+	if len(api.resources) != 2 {
+		t.Fatalf("Unexpected number of API resources: %d", len(api.resources))
+	}
+	createMethod := api.resources[lambdaFn.lambdaFunctionName()+"/pets"].Methods["POST"]
+	if createMethod == nil ||
+		createMethod.defaultHTTPResponseCode != http.StatusCreated ||
+		createMethod.OperationName != "createPet" ||
+		!createMethod.ValidateRequestBody ||
+		createMethod.Models["application/json"].Name != "Pet" {
+		t.Fatalf("Unexpected POST method: %#v", createMethod)
+	}
+	listMethod := api.resources[lambdaFn.lambdaFunctionName()+"/pets"].Methods["GET"]
+	if !listMethod.Parameters["method.request.querystring.limit"] ||
+		!listMethod.ValidateRequestParameters {
+		t.Fatalf("Unexpected GET method: %#v", listMethod)
+	}
+	showMethod := api.resources[lambdaFn2.lambdaFunctionName()+"/pets/{petId}"].Methods["GET"]
+	if !showMethod.Parameters["method.request.path.petId"] ||
+		showMethod.ValidateRequestParameters {
+		t.Fatalf("Unexpected GET {petId} method: %#v", showMethod)
+	}
+
+	// Every operation requires a handler
+	delete(handlers, "showPetById")
+	_, apiErr = NewAPIGatewayFromOpenAPI("SpartaOpenAPI", nil, []byte(testOpenAPIDocument), handlers)
+	if apiErr == nil || !strings.Contains(apiErr.Error(), "showPetById") {
+		t.Fatalf("Failed to reject OpenAPI document with missing handler: %v", apiErr)
+	}
+}
+
+func TestAPIGatewayOpenAPI(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda(LambdaName(mockLambda1),
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn2, _ := NewAWSLambda(LambdaName(mockLambda2),
+		mockLambda2,
+		IAMRoleDefinition{})
+	api, apiErr := NewAPIGatewayFromOpenAPI("SpartaOpenAPI",
+		NewStage("v1"),
+		[]byte(testOpenAPIDocument),
+		map[string]*LambdaAWSInfo{
+			"listPets":    lambdaFn,
+			"createPet":   lambdaFn,
+			"showPetById": lambdaFn2,
+		})
+	if apiErr != nil {
+		t.Fatalf("Failed to create API from OpenAPI document: %s", apiErr)
+	}
+	// Add an authorized method without an OperationName
+	resource, _ := api.NewResource("/owners", lambdaFn2)
+	method, _ := resource.NewAuthorizedMethod("GET", gocf.Ref("MyAuthorizer"), http.StatusOK)
+	method.APIKeyRequired = true
+
+	openAPIBytes, openAPIBytesErr := api.OpenAPI()
+	if openAPIBytesErr != nil {
+		t.Fatalf("Failed to export OpenAPI document: %s", openAPIBytesErr)
+	}
+	var doc map[string]interface{}
+	unmarshalErr := json.Unmarshal(openAPIBytes, &doc)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to parse OpenAPI document: %s", unmarshalErr)
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	schemas, _ := templateValue(doc, "components", "schemas").(map[string]interface{})
+	if doc["openapi"] == nil || len(paths) != 3 || len(schemas) != 2 {
+		t.Fatalf("Unexpected OpenAPI document: %s", string(openAPIBytes))
+	}
+	expectTemplateValue(t, doc, "createPet", "paths", "/pets", "post", "operationId")
+	expectTemplateValue(t, doc, "#/components/schemas/Pet",
+		"paths", "/pets", "post", "requestBody", "content", "application/json", "schema", "$ref")
+	expectTemplateValue(t, doc, "#/components/schemas/Owner",
+		"components", "schemas", "Pet", "properties", "owner", "$ref")
+	expectTemplateValue(t, doc, "Created", "paths", "/pets", "post", "responses", "201", "description")
+	expectTemplateValue(t, doc, "limit", "paths", "/pets", "get", "parameters", 0, "name")
+	expectTemplateValue(t, doc, "getGithubComMweagleSpartaMockLambda2",
+		"paths", "/owners", "get", "operationId")
+	expectTemplateValue(t, doc, []interface{}{
+		map[string]interface{}{
+			"MyAuthorizer": []string{},
+			"api_key":      []string{},
+		},
+	}, "paths", "/owners", "get", "security")
+	expectTemplateValue(t, doc, "custom",
+		"components", "securitySchemes", "MyAuthorizer", "x-amazon-apigateway-authtype")
+	expectTemplateValue(t, doc, "x-api-key", "components", "securitySchemes", "api_key", "name")
+	serverURL, _ := templateValue(doc, "servers", 0, "url").(string)
+	if !strings.HasSuffix(serverURL, "/v1") {
+		t.Fatalf("Unexpected OpenAPI server URL: %s", serverURL)
+	}
+
+	// The exported document can be imported
+	_, apiErr = NewAPIGatewayFromOpenAPI("SpartaOpenAPI",
+		nil,
+		openAPIBytes,
+		map[string]*LambdaAWSInfo{
+			"listPets":                             lambdaFn,
+			"createPet":                            lambdaFn,
+			"showPetById":                          lambdaFn2,
+			"getGithubComMweagleSpartaMockLambda2": lambdaFn2,
+		})
+	if apiErr != nil {
+		t.Fatalf("Failed to import exported OpenAPI document: %s", apiErr)
+	}
+}
+
+func TestAPIV2ConnectionTableDecorator(t *testing.T) {
+	stage, _ := NewAPIV2Stage("v1")
+	apiGateway, _ := NewAPIV2(Websocket,
+		"sample",
+		"$request.body.message",
+		stage)
+	lambdaFn, _ := NewAWSLambda(LambdaName(mockLambda1),
+		mockLambda1,
+		IAMRoleDefinition{})
+	_, routeErr := apiGateway.NewAPIV2Route(APIV2RouteConnect, lambdaFn)
+	if routeErr != nil {
+		t.Fatalf("Failed to create route: %s", routeErr)
+	}
+	decorator, _ := apiGateway.NewConnectionTableDecorator("CONNECTION_TABLE",
+		"connectionID",
+		5,
+		5)
+	annotateErr := decorator.AnnotateLambdas([]*LambdaAWSInfo{lambdaFn})
+	if annotateErr != nil {
+		t.Fatalf("Failed to annotate lambda functions: %s", annotateErr)
+	}
+	if lambdaFn.Options.Environment[spartaAPIGateway.EnvVarConnectionsEndpoint] == nil {
+		t.Fatalf("Failed to publish connections endpoint")
+	}
+	var manageConnections bool
+	for _, eachPrivilege := range lambdaFn.RoleDefinition.Privileges {
+		for _, eachAction := range eachPrivilege.Actions {
+			manageConnections = manageConnections || eachAction == "execute-api:ManageConnections"
+		}
+	}
+	if !manageConnections {
+		t.Fatalf("Failed to add execute-api:ManageConnections privilege: %#v",
+			lambdaFn.RoleDefinition.Privileges)
+	}
+}
+
+// apiTestTemplate is the decoded template that the API tests verify
+type apiTestTemplate struct {
+	Resources map[string]struct {
+		Type       string
+		Properties map[string]interface{}
+	}
+	Outputs map[string]interface{}
+}
+
+func newAPITestTemplate(t *testing.T, template *gocf.Template) *apiTestTemplate {
+	templateBytes, templateBytesErr := json.Marshal(template)
+	if templateBytesErr != nil {
+		t.Fatalf("Failed to marshal template: %s", templateBytesErr)
+	}
+	apiTemplate := &apiTestTemplate{}
+	unmarshalErr := json.Unmarshal(templateBytes, apiTemplate)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to decode template: %s", unmarshalErr)
+	}
+	return apiTemplate
+}
+
+// resourceNames returns the sorted logical names of the resources with
+// the given type
+func (apiTemplate *apiTestTemplate) resourceNames(resourceType string) []string {
+	names := make([]string, 0)
+	for eachName, eachResource := range apiTemplate.Resources {
+		if eachResource.Type == resourceType {
+			names = append(names, eachName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resource returns the logical name and properties of the only resource
+// with the given type
+func (apiTemplate *apiTestTemplate) resource(t *testing.T,
+	resourceType string) (string, map[string]interface{}) {
+	names := apiTemplate.resourceNames(resourceType)
+	if len(names) != 1 {
+		t.Fatalf("Expected a single %s resource, got: %v", resourceType, names)
+	}
+	return names[0], apiTemplate.Resources[names[0]].Properties
+}
+
+// resourceWith returns the logical name and properties of the resource with
+// the given type whose property value at the path is equal to expected
+func (apiTemplate *apiTestTemplate) resourceWith(t *testing.T,
+	resourceType string,
+	expected interface{},
+	path ...interface{}) (string, map[string]interface{}) {
+	for _, eachName := range apiTemplate.resourceNames(resourceType) {
+		properties := apiTemplate.Resources[eachName].Properties
+		if reflect.DeepEqual(templateValue(properties, path...), jsonValue(expected)) {
+			return eachName, properties
+		}
+	}
+	t.Fatalf("Failed to find %s resource with %v: %v", resourceType, path, expected)
+	return "", nil
+}
+
+// resourcePath returns the API path of the AWS::ApiGateway::Resource
+func (apiTemplate *apiTestTemplate) resourcePath(logicalName string) string {
+	resource, resourceExists := apiTemplate.Resources[logicalName]
+	if !resourceExists {
+		return ""
+	}
+	pathPart, _ := resource.Properties["PathPart"].(string)
+	parentName, _ := templateValue(resource.Properties, "ParentId", "Ref").(string)
+	return apiTemplate.resourcePath(parentName) + "/" + pathPart
+}
+
+// method returns the properties of the AWS::ApiGateway::Method for the
+// API path and HTTP method
+func (apiTemplate *apiTestTemplate) method(t *testing.T,
+	resourcePath string,
+	httpMethod string) map[string]interface{} {
+	for _, eachName := range apiTemplate.resourceNames("AWS::ApiGateway::Method") {
+		properties := apiTemplate.Resources[eachName].Properties
+		resourceName, _ := templateValue(properties, "ResourceId", "Ref").(string)
+		if properties["HttpMethod"] == httpMethod &&
+			apiTemplate.resourcePath(resourceName) == resourcePath {
+			return properties
+		}
+	}
+	t.Fatalf("Failed to find %s %s method", httpMethod, resourcePath)
+	return nil
+}
+
+// statusCodeValue returns the element of the list at the path whose
+// StatusCode is statusCode
+func statusCodeValue(t *testing.T,
+	value interface{},
+	statusCode string,
+	path ...interface{}) map[string]interface{} {
+	values, _ := templateValue(value, path...).([]interface{})
+	for _, eachValue := range values {
+		if mapValue, mapValueOk := eachValue.(map[string]interface{}); mapValueOk &&
+			mapValue["StatusCode"] == statusCode {
+			return mapValue
+		}
+	}
+	t.Fatalf("Failed to find %v with StatusCode %s", path, statusCode)
+	return nil
+}
+
+// templateValue returns the value at the path of map keys and slice
+// indices, or nil if it doesn't exist
+func templateValue(value interface{}, path ...interface{}) interface{} {
+	for _, eachElement := range path {
+		switch element := eachElement.(type) {
+		case string:
+			mapValue, mapValueOk := value.(map[string]interface{})
+			if !mapValueOk {
+				return nil
+			}
+			value = mapValue[element]
+		case int:
+			sliceValue, sliceValueOk := value.([]interface{})
+			if !sliceValueOk || element >= len(sliceValue) {
+				return nil
+			}
+			value = sliceValue[element]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// jsonValue returns the value as it's decoded from JSON
+func jsonValue(value interface{}) interface{} {
+	valueBytes, _ := json.Marshal(value)
+	var decoded interface{}
+	_ = json.Unmarshal(valueBytes, &decoded)
+	return decoded
+}
+
+// expectTemplateValue fails the test if the value at the path isn't
+// equal to expected
+func expectTemplateValue(t *testing.T,
+	value interface{},
+	expected interface{},
+	path ...interface{}) {
+	t.Helper()
+	actual := templateValue(value, path...)
+	if !reflect.DeepEqual(actual, jsonValue(expected)) {
+		t.Fatalf("Unexpected value at %v: %#v (expected: %#v)", path, actual, expected)
+	}
+}
+
+// expectTemplateSubstring fails the test if the string at the path
+// doesn't contain expected
+func expectTemplateSubstring(t *testing.T,
+	value interface{},
+	expected string,
+	path ...interface{}) {
+	t.Helper()
+	actual, _ := templateValue(value, path...).(string)
+	if !strings.Contains(actual, expected) {
+		t.Fatalf("Failed to find %s at %v: %s", expected, path, actual)
+	}
+}
+
+// expectJoinPart fails the test if the Fn::Join at the path doesn't
+// include the literal part
+func expectJoinPart(t *testing.T,
+	value interface{},
+	part string,
+	path ...interface{}) {
+	t.Helper()
+	joinPath := append(append([]interface{}{}, path...), "Fn::Join", 1)
+	parts, _ := templateValue(value, joinPath...).([]interface{})
+	for _, eachPart := range parts {
+		if eachPart == part {
+			return
+		}
+	}
+	t.Fatalf("Failed to find %s in %v: %#v", part, path, parts)
+}
+
+// apiTestFixture is the API marshaled by a TestAPIGatewayResources case.
+// Each invalid function changes the API so that it fails to marshal.
+type apiTestFixture struct {
+	api     *API
+	invalid []func()
+}
+
+func TestAPIGatewayResources(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda(LambdaName(mockLambda1),
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn2, _ := NewAWSLambda(LambdaName(mockLambda2),
+		mockLambda2,
+		IAMRoleDefinition{})
+	lambdaARN := map[string]interface{}{
+		"Fn::GetAtt": []string{lambdaFn.LogicalResourceName(), "Arn"},
+	}
+
+	// newTestAPI returns an API with a GET /test method
+	newTestAPI := func(stage *Stage) (*API, *Method) {
+		apiGateway := NewAPIGateway("SpartaAPIGateway", stage)
+		apiGatewayResource, _ := apiGateway.NewResource("/test", lambdaFn)
+		method, _ := apiGatewayResource.NewMethod("GET", http.StatusOK)
+		return apiGateway, method
+	}
+
+	testCases := []struct {
+		name    string
+		fixture func(t *testing.T) *apiTestFixture
+		verify  func(t *testing.T, apiTemplate *apiTestTemplate)
+	}{
+		{
+			name: "OpenAPI",
+			fixture: func(t *testing.T) *apiTestFixture {
+				api, apiErr := NewAPIGatewayFromOpenAPI("SpartaOpenAPI",
+					nil,
+					[]byte(testOpenAPIDocument),
+					map[string]*LambdaAWSInfo{
+						"listPets":    lambdaFn,
+						"createPet":   lambdaFn,
+						"showPetById": lambdaFn2,
+					})
+				if apiErr != nil {
+					t.Fatalf("Failed to create API from OpenAPI document: %s", apiErr)
+				}
+				return &apiTestFixture{api: api}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				if len(apiTemplate.resourceNames("AWS::ApiGateway::Method")) != 3 ||
+					len(apiTemplate.resourceNames("AWS::ApiGateway::RequestValidator")) != 2 {
+					t.Fatalf("Unexpected OpenAPI resources: %#v", apiTemplate.Resources)
+				}
+				modelName, model := apiTemplate.resource(t, "AWS::ApiGateway::Model")
+				expectTemplateValue(t, model, "Pet", "Name")
+				expectTemplateValue(t, model, "#/definitions/Owner",
+					"Schema", "properties", "owner", "$ref")
+
+				createMethod := apiTemplate.method(t, "/pets", "POST")
+				expectTemplateValue(t, createMethod, "createPet", "OperationName")
+				expectTemplateValue(t, createMethod, modelName,
+					"RequestModels", "application/json", "Ref")
+				validatorName, _ := templateValue(createMethod, "RequestValidatorId", "Ref").(string)
+				expectTemplateValue(t, apiTemplate.Resources[validatorName].Properties,
+					true,
+					"ValidateRequestBody")
+				expectTemplateValue(t, createMethod, lambdaARN, "Integration", "Uri", "Fn::Join", 1, 3)
+
+				listMethod := apiTemplate.method(t, "/pets", "GET")
+				expectTemplateValue(t, listMethod, "listPets", "OperationName")
+				expectTemplateValue(t, listMethod, "true",
+					"RequestParameters", "method.request.querystring.limit")
+				showMethod := apiTemplate.method(t, "/pets/{petId}", "GET")
+				expectTemplateValue(t, showMethod, nil, "RequestValidatorId")
+				expectTemplateValue(t, showMethod, map[string]interface{}{
+					"Fn::GetAtt": []string{lambdaFn2.LogicalResourceName(), "Arn"},
+				}, "Integration", "Uri", "Fn::Join", 1, 3)
+			},
+		},
+		{
+			name: "CustomDomain",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway, _ := newTestAPI(NewStage("v1"))
+				apiGateway.CustomDomain = &APICustomDomain{
+					DomainName:     "api.example.com",
+					HostedZoneID:   "Z1234567890",
+					BasePath:       "/hello",
+					SecurityPolicy: "TLS_1_2",
+				}
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// A custom domain requires a stage
+						func() { apiGateway.stage = nil },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				certificateName, certificate := apiTemplate.resource(t, "AWS::CertificateManager::Certificate")
+				expectTemplateValue(t, certificate, "Z1234567890",
+					"DomainValidationOptions", 0, "HostedZoneId")
+				domainName, domain := apiTemplate.resource(t, "AWS::ApiGateway::DomainName")
+				expectTemplateValue(t, domain, certificateName, "RegionalCertificateArn", "Ref")
+				expectTemplateValue(t, domain, "TLS_1_2", "SecurityPolicy")
+				expectTemplateValue(t, domain, []string{"REGIONAL"}, "EndpointConfiguration", "Types")
+				_, mapping := apiTemplate.resource(t, "AWS::ApiGateway::BasePathMapping")
+				expectTemplateValue(t, mapping, "hello", "BasePath")
+				expectTemplateValue(t, mapping, domainName, "DomainName", "Ref")
+				expectTemplateValue(t, mapping, "v1", "Stage")
+				_, record := apiTemplate.resource(t, "AWS::Route53::RecordSet")
+				expectTemplateValue(t, record, "Z1234567890", "HostedZoneId")
+				expectTemplateValue(t, record, []string{domainName, "RegionalHostedZoneId"},
+					"AliasTarget", "HostedZoneId", "Fn::GetAtt")
+				expectTemplateValue(t, apiTemplate.Outputs, "https://api.example.com/hello",
+					"APIGatewayCustomDomainURL", "Value")
+			},
+		},
+		{
+			name: "Authorizers",
+			fixture: func(t *testing.T) *apiTestFixture {
+				tokenAuthorizer, tokenAuthorizerErr := NewLambdaTokenAuthorizer("TokenAuthorizer", lambdaFn2)
+				if tokenAuthorizerErr != nil {
+					t.Fatalf("Failed to create token authorizer: %s", tokenAuthorizerErr)
+				}
+				tokenAuthorizer.ResultTTLSeconds = 60
+				cognitoAuthorizer, cognitoAuthorizerErr := NewCognitoAuthorizer("CognitoAuthorizer",
+					gocf.String("arn:aws:cognito-idp:us-west-2:123412341234:userpool/us-west-2_abc"))
+				if cognitoAuthorizerErr != nil {
+					t.Fatalf("Failed to create cognito authorizer: %s", cognitoAuthorizerErr)
+				}
+				_, missingLambdaErr := NewLambdaRequestAuthorizer("RequestAuthorizer", nil)
+				if missingLambdaErr == nil {
+					t.Fatalf("Failed to reject request authorizer without a lambda function")
+				}
+				apiGateway := NewAPIGateway("SpartaAPIGateway", nil)
+				apiGatewayResource, _ := apiGateway.NewResource("/test", lambdaFn)
+				apiGatewayResource.NewAuthorizedMethod("GET", tokenAuthorizer, http.StatusOK)
+				apiGatewayResource.NewAuthorizedMethod("PUT", tokenAuthorizer, http.StatusOK)
+				cognitoMethod, _ := apiGatewayResource.NewAuthorizedMethod("POST", cognitoAuthorizer, http.StatusOK)
+				cognitoMethod.AuthorizationScopes = []string{"pets/write"}
+				return &apiTestFixture{api: apiGateway}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				authorizerARN := map[string]interface{}{
+					"Fn::GetAtt": []string{lambdaFn2.LogicalResourceName(), "Arn"},
+				}
+				tokenAuthorizerName, tokenAuthorizer := apiTemplate.resourceWith(t, "AWS::ApiGateway::Authorizer",
+					"TokenAuthorizer",
+					"Name")
+				expectTemplateValue(t, tokenAuthorizer, "TOKEN", "Type")
+				expectTemplateValue(t, tokenAuthorizer, 60, "AuthorizerResultTtlInSeconds")
+				expectTemplateValue(t, tokenAuthorizer, "method.request.header.Authorization", "IdentitySource")
+				expectTemplateValue(t, tokenAuthorizer, authorizerARN, "AuthorizerUri", "Fn::Join", 1, 5)
+				cognitoAuthorizerName, cognitoAuthorizer := apiTemplate.resourceWith(t, "AWS::ApiGateway::Authorizer",
+					"CognitoAuthorizer",
+					"Name")
+				expectTemplateValue(t, cognitoAuthorizer, "COGNITO_USER_POOLS", "Type")
+				expectTemplateValue(t, cognitoAuthorizer,
+					[]string{"arn:aws:cognito-idp:us-west-2:123412341234:userpool/us-west-2_abc"},
+					"ProviderARNs")
+
+				for _, eachMethod := range []string{"GET", "PUT"} {
+					method := apiTemplate.method(t, "/test", eachMethod)
+					expectTemplateValue(t, method, "CUSTOM", "AuthorizationType")
+					expectTemplateValue(t, method, tokenAuthorizerName, "AuthorizerId", "Ref")
+				}
+				cognitoMethod := apiTemplate.method(t, "/test", "POST")
+				expectTemplateValue(t, cognitoMethod, "COGNITO_USER_POOLS", "AuthorizationType")
+				expectTemplateValue(t, cognitoMethod, []string{"pets/write"}, "AuthorizationScopes")
+				expectTemplateValue(t, cognitoMethod, cognitoAuthorizerName, "AuthorizerId", "Ref")
+
+				// The API method permission and the token authorizer permission
+				if len(apiTemplate.resourceNames("AWS::Lambda::Permission")) != 2 {
+					t.Fatalf("Unexpected lambda permissions: %v",
+						apiTemplate.resourceNames("AWS::Lambda::Permission"))
+				}
+				_, authorizerPermission := apiTemplate.resourceWith(t, "AWS::Lambda::Permission",
+					authorizerARN,
+					"FunctionName")
+				expectTemplateValue(t, authorizerPermission, "apigateway.amazonaws.com", "Principal")
+				expectJoinPart(t, authorizerPermission, "/authorizers/", "SourceArn")
+			},
+		},
+		{
+			name: "UsagePlan",
+			fixture: func(t *testing.T) *apiTestFixture {
+				stage := NewStage("v1")
+				stage.Throttle = &APIThrottle{
+					RateLimit:  100,
+					BurstLimit: 200,
+				}
+				apiGateway, method := newTestAPI(stage)
+				method.APIKeyRequired = true
+				usagePlan, usagePlanErr := apiGateway.NewUsagePlan("Basic", NewAPIKey("Customer"))
+				if usagePlanErr != nil {
+					t.Fatalf("Failed to create usage plan: %s", usagePlanErr)
+				}
+				usagePlan.Quota = &APIQuota{
+					Limit:  5000,
+					Period: APIUsagePlanQuotaPeriodMonth,
+				}
+				usagePlan.Throttle = &APIThrottle{
+					RateLimit:  10,
+					BurstLimit: 20,
+				}
+				usagePlan.MethodThrottles = map[string]*APIThrottle{
+					"/test/GET": {RateLimit: 5},
+				}
+				_, duplicateErr := apiGateway.NewUsagePlan("Basic")
+				if duplicateErr == nil {
+					t.Fatalf("Failed to reject duplicate usage plan")
+				}
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Usage plans require a stage
+						func() { apiGateway.stage = nil },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				expectTemplateValue(t, apiTemplate.method(t, "/test", "GET"), true, "ApiKeyRequired")
+				_, deployment := apiTemplate.resource(t, "AWS::ApiGateway::Deployment")
+				expectTemplateValue(t, deployment, 100, "StageDescription", "ThrottlingRateLimit")
+				expectTemplateValue(t, deployment, 200, "StageDescription", "ThrottlingBurstLimit")
+				usagePlanName, usagePlan := apiTemplate.resource(t, "AWS::ApiGateway::UsagePlan")
+				expectTemplateValue(t, usagePlan, map[string]interface{}{
+					"Limit":  5000,
+					"Period": "MONTH",
+				}, "Quota")
+				expectTemplateValue(t, usagePlan, map[string]interface{}{
+					"BurstLimit": 20,
+					"RateLimit":  10,
+				}, "Throttle")
+				expectTemplateValue(t, usagePlan, "v1", "ApiStages", 0, "Stage")
+				expectTemplateValue(t, usagePlan, map[string]interface{}{
+					"/test/GET": map[string]interface{}{"RateLimit": 5},
+				}, "ApiStages", 0, "Throttle")
+				apiKeyName, apiKey := apiTemplate.resource(t, "AWS::ApiGateway::ApiKey")
+				expectTemplateValue(t, apiKey, true, "Enabled")
+				_, usagePlanKey := apiTemplate.resource(t, "AWS::ApiGateway::UsagePlanKey")
+				expectTemplateValue(t, usagePlanKey, apiKeyName, "KeyId", "Ref")
+				expectTemplateValue(t, usagePlanKey, usagePlanName, "UsagePlanId", "Ref")
+				expectTemplateValue(t, usagePlanKey, "API_KEY", "KeyType")
+				if _, outputExists := apiTemplate.Outputs[apiKeyName]; !outputExists {
+					t.Fatalf("Failed to find API key output: %s", apiKeyName)
+				}
+			},
+		},
+		{
+			name: "RequestValidation",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway := NewAPIGateway("SpartaAPIGateway", nil)
+				apiGatewayResource, _ := apiGateway.NewResource("/pets", lambdaFn)
+				method, _ := apiGatewayResource.NewMethod("POST", http.StatusCreated, http.StatusBadRequest)
+				petModel, petModelErr := NewModel("Pet", map[string]interface{}{
+					"type":     "object",
+					"required": []string{"name"},
+					"properties": map[string]interface{}{
+						"name": map[string]string{"type": "string"},
+					},
+				})
+				if petModelErr != nil {
+					t.Fatalf("Failed to create model: %s", petModelErr)
+				}
+				_, invalidModelErr := NewModel("Pet-Model", `{"type": "object"}`)
+				if invalidModelErr == nil {
+					t.Fatalf("Failed to reject non-alphanumeric model name")
+				}
+				_, invalidSchemaErr := NewModel("Invalid", "not json")
+				if invalidSchemaErr == nil {
+					t.Fatalf("Failed to reject invalid model schema")
+				}
+				method.Models["application/json"] = petModel
+				method.Parameters["method.request.header.X-Request-ID"] = true
+				method.ValidateRequestBody = true
+				method.ValidateRequestParameters = true
+				method.Responses[http.StatusCreated].Models["application/json"] = petModel
+				method.Responses[http.StatusBadRequest].Models["application/json"] = &Model{
+					Name: APIGatewayModelError,
+				}
+				return &apiTestFixture{api: apiGateway}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				modelName, model := apiTemplate.resource(t, "AWS::ApiGateway::Model")
+				expectTemplateValue(t, model, "http://json-schema.org/draft-04/schema#", "Schema", "$schema")
+				expectTemplateValue(t, model, []string{"name"}, "Schema", "required")
+				validatorName, validator := apiTemplate.resource(t, "AWS::ApiGateway::RequestValidator")
+				expectTemplateValue(t, validator, true, "ValidateRequestBody")
+				expectTemplateValue(t, validator, true, "ValidateRequestParameters")
+
+				method := apiTemplate.method(t, "/pets", "POST")
+				expectTemplateValue(t, method, validatorName, "RequestValidatorId", "Ref")
+				expectTemplateValue(t, method, modelName, "RequestModels", "application/json", "Ref")
+				expectTemplateValue(t, method, map[string]string{
+					"method.request.header.X-Request-ID": "true",
+				}, "RequestParameters")
+				expectTemplateValue(t, statusCodeValue(t, method, "201", "MethodResponses"),
+					modelName,
+					"ResponseModels", "application/json", "Ref")
+				expectTemplateValue(t, statusCodeValue(t, method, "400", "MethodResponses"),
+					"Error",
+					"ResponseModels", "application/json")
+			},
+		},
+		{
+			name: "ResourceCORS",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway := NewAPIGateway("SpartaAPIGateway", nil)
+				corsResource, _ := apiGateway.NewResource("/cors", lambdaFn)
+				corsResource.CORSOptions = &CORSOptions{
+					AllowedOrigins:   []string{"https://www.example.com", "https://admin.example.com"},
+					ExposedHeaders:   []string{"X-Request-ID"},
+					MaxAge:           600,
+					AllowCredentials: true,
+				}
+				corsResource.NewMethod("GET", http.StatusOK)
+				postMethod, _ := corsResource.NewMethod("POST", http.StatusCreated)
+				postMethod.CORSOptions = &CORSOptions{
+					AllowedOrigins: []string{"https://www.example.com"},
+					AllowedMethods: []string{"POST"},
+				}
+				privateResource, _ := apiGateway.NewResource("/private", lambdaFn)
+				privateResource.NewMethod("GET", http.StatusOK)
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Credentials require explicit origins
+						func() {
+							corsResource.CORSOptions = &CORSOptions{
+								AllowCredentials: true,
+							}
+						},
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				if len(apiTemplate.resourceNames("AWS::ApiGateway::GatewayResponse")) != 0 {
+					t.Fatalf("Unexpected gateway responses for resource CORS")
+				}
+				optionsCount := 0
+				for _, eachName := range apiTemplate.resourceNames("AWS::ApiGateway::Method") {
+					if apiTemplate.Resources[eachName].Properties["HttpMethod"] == "OPTIONS" {
+						optionsCount++
+					}
+				}
+				if optionsCount != 1 {
+					t.Fatalf("Unexpected number of OPTIONS methods: %d", optionsCount)
+				}
+				preflight := statusCodeValue(t,
+					apiTemplate.method(t, "/cors", "OPTIONS"),
+					"200",
+					"Integration", "IntegrationResponses")
+				for eachHeader, eachValue := range map[string]string{
+					"Access-Control-Allow-Origin":      "'https://www.example.com'",
+					"Access-Control-Allow-Methods":     "'GET,OPTIONS,POST'",
+					"Access-Control-Allow-Credentials": "'true'",
+					"Access-Control-Expose-Headers":    "'X-Request-ID'",
+					"Access-Control-Max-Age":           "'600'",
+					"Vary":                             "'Origin'",
+				} {
+					expectTemplateValue(t, preflight, eachValue,
+						"ResponseParameters", "method.response.header."+eachHeader)
+				}
+				expectTemplateSubstring(t, preflight,
+					`#set($corsOrigins = ["https://www.example.com","https://admin.example.com"])`,
+					"ResponseTemplates", "application/*")
+
+				postResponse := statusCodeValue(t,
+					apiTemplate.method(t, "/cors", "POST"),
+					"201",
+					"Integration", "IntegrationResponses")
+				expectTemplateValue(t, postResponse, "'POST'",
+					"ResponseParameters", "method.response.header.Access-Control-Allow-Methods")
+				privateResponse := statusCodeValue(t,
+					apiTemplate.method(t, "/private", "GET"),
+					"200",
+					"Integration", "IntegrationResponses")
+				expectTemplateValue(t, privateResponse, nil, "ResponseParameters")
+			},
+		},
+		{
+			name: "APICORS",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway, _ := newTestAPI(nil)
+				apiGateway.CORSEnabled = true
+				return &apiTestFixture{api: apiGateway}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				_, gatewayResponse := apiTemplate.resourceWith(t, "AWS::ApiGateway::GatewayResponse",
+					APIGatewayResponseDefault4XX,
+					"ResponseType")
+				expectTemplateValue(t, gatewayResponse, "'*'",
+					"ResponseParameters", "gatewayresponse.header.Access-Control-Allow-Origin")
+				preflight := statusCodeValue(t,
+					apiTemplate.method(t, "/test", "OPTIONS"),
+					"200",
+					"Integration", "IntegrationResponses")
+				expectTemplateValue(t, preflight, "'*'",
+					"ResponseParameters", "method.response.header.Access-Control-Allow-Origin")
+			},
+		},
+		{
+			name: "StageSettings",
+			fixture: func(t *testing.T) *apiTestFixture {
+				stage := NewStage("v1")
+				stage.AccessLog = &APIAccessLog{
+					RetentionInDays: 14,
+				}
+				stage.MetricsEnabled = true
+				stage.LoggingLevel = APIGatewayLoggingLevelError
+				stage.TracingEnabled = true
+				stage.CacheClusterEnabled = true
+				stage.CacheClusterSize = "0.5"
+				stage.ProvisionCloudWatchRole = true
+				stage.MethodSettings = map[string]*APIMethodSettings{
+					"/hello/world/GET": {
+						LoggingLevel:    APIGatewayLoggingLevelInfo,
+						Throttle:        &APIThrottle{RateLimit: 5, BurstLimit: 10},
+						CachingEnabled:  true,
+						CacheTTLSeconds: 60,
+					},
+				}
+				apiGateway := NewAPIGateway("SpartaAPIGateway", stage)
+				apiGatewayResource, _ := apiGateway.NewResource("/hello/world", lambdaFn)
+				apiGatewayResource.NewMethod("GET", http.StatusOK)
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Method caching requires a cache cluster
+						func() { stage.CacheClusterEnabled = false },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				logGroupName, logGroup := apiTemplate.resource(t, "AWS::Logs::LogGroup")
+				expectTemplateValue(t, logGroup, 14, "RetentionInDays")
+				_, deployment := apiTemplate.resource(t, "AWS::ApiGateway::Deployment")
+				stageDescription := templateValue(deployment, "StageDescription")
+				expectJoinPart(t, stageDescription, ":log-group:", "AccessLogSetting", "DestinationArn")
+				expectTemplateValue(t, stageDescription, map[string]string{"Ref": logGroupName},
+					"AccessLogSetting", "DestinationArn", "Fn::Join", 1, 7)
+				expectTemplateSubstring(t, stageDescription, `"requestId":"$context.requestId"`,
+					"AccessLogSetting", "Format")
+				expectTemplateValue(t, stageDescription, true, "MetricsEnabled")
+				expectTemplateValue(t, stageDescription, "ERROR", "LoggingLevel")
+				expectTemplateValue(t, stageDescription, true, "TracingEnabled")
+				expectTemplateValue(t, stageDescription, true, "CacheClusterEnabled")
+				expectTemplateValue(t, stageDescription, "0.5", "CacheClusterSize")
+				expectTemplateValue(t, stageDescription, map[string]interface{}{
+					"CacheTtlInSeconds":    60,
+					"CachingEnabled":       true,
+					"DataTraceEnabled":     false,
+					"HttpMethod":           "GET",
+					"LoggingLevel":         "INFO",
+					"MetricsEnabled":       true,
+					"ResourcePath":         "/~1hello~1world",
+					"ThrottlingBurstLimit": 10,
+					"ThrottlingRateLimit":  5,
+				}, "MethodSettings", 0)
+				roleName, _ := apiTemplate.resource(t, "AWS::IAM::Role")
+				_, account := apiTemplate.resource(t, "AWS::ApiGateway::Account")
+				expectTemplateValue(t, account, []string{roleName, "Arn"}, "CloudWatchRoleArn", "Fn::GetAtt")
+			},
+		},
+		{
+			name: "MutualTLSWebACL",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway, _ := newTestAPI(NewStage("v1"))
+				apiGateway.CustomDomain = &APICustomDomain{
+					DomainName: "api.example.com",
+					MutualTLS: &APIMutualTLS{
+						TruststoreURI:     "s3://truststore-bucket/truststore.pem",
+						TruststoreVersion: "1",
+					},
+				}
+				apiGateway.DisableExecuteAPIEndpoint = true
+				apiGateway.WebACL = &APIWebACL{
+					ManagedRuleGroups: []string{"AWSManagedRulesSQLiRuleSet"},
+					RateLimit:         1000,
+				}
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Mutual TLS requires a REGIONAL endpoint
+						func() { apiGateway.CustomDomain.EndpointType = "EDGE" },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				_, domain := apiTemplate.resource(t, "AWS::ApiGateway::DomainName")
+				expectTemplateValue(t, domain, map[string]string{
+					"TruststoreUri":     "s3://truststore-bucket/truststore.pem",
+					"TruststoreVersion": "1",
+				}, "MutualTlsAuthentication")
+				expectTemplateValue(t, domain, "TLS_1_2", "SecurityPolicy")
+				_, restAPI := apiTemplate.resource(t, "AWS::ApiGateway::RestApi")
+				expectTemplateValue(t, restAPI, true, "DisableExecuteApiEndpoint")
+				webACLName, webACL := apiTemplate.resource(t, "AWS::WAFv2::WebACL")
+				expectTemplateValue(t, webACL, map[string]interface{}{
+					"AggregateKeyType": "IP",
+					"Limit":            1000,
+				}, "Rules", 0, "Statement", "RateBasedStatement")
+				expectTemplateValue(t, webACL, map[string]string{
+					"Name":       "AWSManagedRulesSQLiRuleSet",
+					"VendorName": "AWS",
+				}, "Rules", 1, "Statement", "ManagedRuleGroupStatement")
+				_, association := apiTemplate.resource(t, "AWS::WAFv2::WebACLAssociation")
+				expectTemplateValue(t, association, []string{webACLName, "Arn"}, "WebACLArn", "Fn::GetAtt")
+				expectJoinPart(t, association, "/stages/", "ResourceArn")
+			},
+		},
+		{
+			name: "ExistingWebACL",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway, _ := newTestAPI(NewStage("v1"))
+				apiGateway.WebACL = &APIWebACL{
+					WebACLArn: gocf.String("arn:aws:wafv2:us-west-2:123412341234:regional/webacl/existing/abc"),
+				}
+				return &apiTestFixture{api: apiGateway}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				if len(apiTemplate.resourceNames("AWS::WAFv2::WebACL")) != 0 {
+					t.Fatalf("Unexpected WebACL resource for existing WebACL")
+				}
+				_, association := apiTemplate.resource(t, "AWS::WAFv2::WebACLAssociation")
+				expectTemplateValue(t, association,
+					"arn:aws:wafv2:us-west-2:123412341234:regional/webacl/existing/abc",
+					"WebACLArn")
+			},
+		},
+		{
+			name: "BinaryMediaTypes",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway := NewAPIGateway("SpartaAPIGateway", NewStage("v1"))
+				apiGateway.BinaryMediaTypes = []string{"image/png"}
+				apiGatewayResource, _ := apiGateway.NewResource("/image", lambdaFn)
+				method, _ := apiGatewayResource.NewMethod("POST", http.StatusOK)
+				method.Integration.Responses[http.StatusOK].ContentHandling = APIGatewayContentHandlingConvertToBinary
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Invalid content handling
+						func() { method.Integration.ContentHandling = "CONVERT_TO_IMAGE" },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				_, restAPI := apiTemplate.resource(t, "AWS::ApiGateway::RestApi")
+				expectTemplateValue(t, restAPI, []string{"image/png"}, "BinaryMediaTypes")
+				method := apiTemplate.method(t, "/image", "POST")
+				expectTemplateValue(t, method, "CONVERT_TO_TEXT", "Integration", "ContentHandling")
+				expectTemplateSubstring(t, method, `"isBase64Encoded" : true`,
+					"Integration", "RequestTemplates", "image/png")
+				integrationResponse := statusCodeValue(t, method, "200", "Integration", "IntegrationResponses")
+				expectTemplateValue(t, integrationResponse, "CONVERT_TO_BINARY", "ContentHandling")
+				expectTemplateSubstring(t, integrationResponse, "$input.path('$.body')##",
+					"ResponseTemplates", "image/png")
+			},
+		},
+		{
+			name: "GatewayResponses",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway, _ := newTestAPI(nil)
+				apiGateway.CORSEnabled = true
+				apiGateway.GatewayResponses = map[string]*APIGatewayResponse{
+					APIGatewayResponseDefault4XX: {},
+					APIGatewayResponseUnauthorized: {
+						StatusCode: http.StatusUnauthorized,
+						Headers: map[string]interface{}{
+							"WWW-Authenticate": "Bearer",
+						},
+					},
+				}
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Unsupported response type
+						func() { apiGateway.GatewayResponses["DEFAULT_3XX"] = &APIGatewayResponse{} },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				if len(apiTemplate.resourceNames("AWS::ApiGateway::GatewayResponse")) != 3 {
+					t.Fatalf("Unexpected gateway responses: %v",
+						apiTemplate.resourceNames("AWS::ApiGateway::GatewayResponse"))
+				}
+				_, serverError := apiTemplate.resourceWith(t, "AWS::ApiGateway::GatewayResponse",
+					APIGatewayResponseDefault5XX,
+					"ResponseType")
+				expectTemplateValue(t, serverError, nil, "ResponseTemplates")
+				_, unauthorized := apiTemplate.resourceWith(t, "AWS::ApiGateway::GatewayResponse",
+					APIGatewayResponseUnauthorized,
+					"ResponseType")
+				expectTemplateValue(t, unauthorized, "401", "StatusCode")
+				expectTemplateValue(t, unauthorized, "'Bearer'",
+					"ResponseParameters", "gatewayresponse.header.WWW-Authenticate")
+				expectTemplateValue(t, unauthorized, "'*'",
+					"ResponseParameters", "gatewayresponse.header.Access-Control-Allow-Origin")
+				expectTemplateSubstring(t, unauthorized, `"err":"$context.error.responseType"`,
+					"ResponseTemplates", "application/json")
+			},
+		},
+		{
+			name: "ServiceIntegrations",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway := NewAPIGateway("SpartaAPIGateway", NewStage("v1"))
+				serviceResource, _ := apiGateway.NewServiceResource("/events")
+				_, sqsErr := serviceResource.NewServiceMethod("POST",
+					http.StatusAccepted,
+					NewSQSSendMessageIntegration(gocf.GetAtt("EventsQueue", "QueueName")))
+				if sqsErr != nil {
+					t.Fatalf("Failed to create SQS method: %s", sqsErr)
+				}
+				_, dynamoErr := serviceResource.NewServiceMethod("PUT",
+					http.StatusOK,
+					NewDynamoDBPutItemIntegration(gocf.Ref("EventsTable")))
+				if dynamoErr != nil {
+					t.Fatalf("Failed to create DynamoDB method: %s", dynamoErr)
+				}
+				workflowResource, _ := apiGateway.NewServiceResource("/workflow")
+				workflowResource.NewServiceMethod("POST",
+					http.StatusOK,
+					NewStepFunctionsStartExecutionIntegration(gocf.Ref("Workflow")))
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Service resources require service methods
+						func() { serviceResource.NewMethod("GET", http.StatusOK) },
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				if len(apiTemplate.resourceNames("AWS::Lambda::Permission")) != 0 {
+					t.Fatalf("Unexpected lambda permissions for service integrations")
+				}
+				roleName, role := apiTemplate.resource(t, "AWS::IAM::Role")
+				expectTemplateValue(t, role, []string{"apigateway.amazonaws.com"},
+					"AssumeRolePolicyDocument", "Statement", 0, "Principal", "Service")
+				statements, _ := templateValue(role, "Policies", 0, "PolicyDocument", "Statement").([]interface{})
+				actions := make([]string, 0)
+				for eachIndex := range statements {
+					for _, eachAction := range templateValue(statements, eachIndex, "Action").([]interface{}) {
+						actions = append(actions, eachAction.(string))
+					}
+				}
+				sort.Strings(actions)
+				if !reflect.DeepEqual(actions, []string{"dynamodb:PutItem",
+					"sqs:SendMessage",
+					"states:StartExecution"}) {
+					t.Fatalf("Unexpected service role actions: %v", actions)
+				}
+
+				sqsMethod := apiTemplate.method(t, "/events", "POST")
+				expectJoinPart(t, sqsMethod, ":sqs:", "Integration", "Uri")
+				expectTemplateValue(t, sqsMethod, "Action=SendMessage&MessageBody=$util.urlEncode($input.body)",
+					"Integration", "RequestTemplates", "application/json")
+				dynamoMethod := apiTemplate.method(t, "/events", "PUT")
+				expectJoinPart(t, dynamoMethod, "action/PutItem", "Integration", "Uri")
+				workflowMethod := apiTemplate.method(t, "/workflow", "POST")
+				expectJoinPart(t, workflowMethod, "action/StartExecution", "Integration", "Uri")
+				for _, eachMethod := range []map[string]interface{}{sqsMethod, dynamoMethod, workflowMethod} {
+					expectTemplateValue(t, eachMethod, "AWS", "Integration", "Type")
+					expectTemplateValue(t, eachMethod, "NEVER", "Integration", "PassthroughBehavior")
+					expectTemplateValue(t, eachMethod, []string{roleName, "Arn"},
+						"Integration", "Credentials", "Fn::GetAtt")
+					expectTemplateValue(t,
+						statusCodeValue(t, eachMethod, "400", "Integration", "IntegrationResponses"),
+						`4\d{2}`,
+						"SelectionPattern")
+				}
+			},
+		},
+		{
+			name: "MultipleStages",
+			fixture: func(t *testing.T) *apiTestFixture {
+				aliasFn, _ := NewAWSLambda(LambdaName(mockLambda1),
+					mockLambda1,
+					IAMRoleDefinition{})
+				aliasFn.Options.AutoPublishAlias = "live"
+				devStage := NewStage("dev")
+				devStage.LambdaAlias = "live"
+				devStage.Variables["tableName"] = "dev-table"
+				apiGateway := NewAPIGateway("SpartaAPIGateway", devStage)
+				apiGatewayResource, _ := apiGateway.NewResource("/test", aliasFn)
+				apiGatewayResource.NewMethod("GET", http.StatusOK)
+
+				prodStage := NewStage("prod")
+				prodStage.LambdaAlias = "stable"
+				prodStage.Variables["tableName"] = "prod-table"
+				prodStage.Throttle = &APIThrottle{
+					RateLimit:  100,
+					BurstLimit: 200,
+				}
+				addErr := apiGateway.AddStage(prodStage)
+				if addErr != nil {
+					t.Fatalf("Failed to add stage: %s", addErr)
+				}
+				if apiGateway.AddStage(NewStage("prod")) == nil {
+					t.Fatalf("Failed to reject duplicate stage")
+				}
+				return &apiTestFixture{
+					api: apiGateway,
+					invalid: []func(){
+						// Every stage must define a LambdaAlias
+						func() { prodStage.LambdaAlias = "" },
+						// Stage variable names are alphanumeric
+						func() {
+							prodStage.LambdaAlias = "stable"
+							prodStage.Variables["invalid value"] = "value"
+						},
+					},
+				}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				_, deployment := apiTemplate.resource(t, "AWS::ApiGateway::Deployment")
+				expectTemplateValue(t, deployment, "dev", "StageName")
+				expectTemplateValue(t, deployment, map[string]string{
+					"lambdaAlias": "live",
+					"tableName":   "dev-table",
+				}, "StageDescription", "Variables")
+				_, stage := apiTemplate.resource(t, "AWS::ApiGateway::Stage")
+				expectTemplateValue(t, stage, "prod", "StageName")
+				expectTemplateValue(t, stage, map[string]string{
+					"lambdaAlias": "stable",
+					"tableName":   "prod-table",
+				}, "Variables")
+				expectTemplateValue(t, stage, map[string]interface{}{
+					"DataTraceEnabled":     false,
+					"HttpMethod":           "*",
+					"MetricsEnabled":       false,
+					"ResourcePath":         "/*",
+					"ThrottlingBurstLimit": 200,
+					"ThrottlingRateLimit":  100,
+				}, "MethodSettings", 0)
+				for _, eachAlias := range []string{"live", "stable"} {
+					_, permission := apiTemplate.resourceWith(t, "AWS::Lambda::Permission",
+						eachAlias,
+						"FunctionName", "Fn::Join", 1, 2)
+					expectTemplateValue(t, permission, lambdaARN, "FunctionName", "Fn::Join", 1, 0)
+				}
+				expectJoinPart(t, apiTemplate.method(t, "/test", "GET"),
+					":${stageVariables.lambdaAlias}",
+					"Integration", "Uri")
+				if _, exists := apiTemplate.Outputs[stageURLOutputName("prod")]; !exists {
+					t.Fatalf("Failed to find prod stage URL output")
+				}
+			},
+		},
+		{
+			name: "MappingTemplates",
+			fixture: func(t *testing.T) *apiTestFixture {
+				apiGateway := NewAPIGateway("SpartaAPIGateway", nil)
+				apiGatewayResource, _ := apiGateway.NewResource("/test", lambdaFn)
+				getMethod, _ := apiGatewayResource.NewMethod("GET", http.StatusOK)
+				getMethod.SupportedRequestContentTypes = []string{"application/json"}
+				if err := getMethod.SetRequestTemplate("application/xml", `{"xml":"$util.escapeJavaScript($input.body)"}`); err != nil {
+					t.Fatalf("Failed to set request template: %s", err)
+				}
+				notFound, notFoundErr := getMethod.NewIntegrationResponse(http.StatusNotFound, ".*NotFound.*")
+				if notFoundErr != nil {
+					t.Fatalf("Failed to create integration response: %s", notFoundErr)
+				}
+				if err := getMethod.SetResponseTemplate(http.StatusNotFound, "application/json", `{"missing":true}`); err != nil {
+					t.Fatalf("Failed to set response template: %s", err)
+				}
+				if notFound.Templates["application/json"] != `{"missing":true}` {
+					t.Fatalf("Failed to update integration response template")
+				}
+				if getMethod.SetResponseTemplate(http.StatusConflict, "application/json", "{}") == nil {
+					t.Fatalf("Failed to reject template for an undefined integration response")
+				}
+				if getMethod.SetRequestTemplate("json", "{}") == nil {
+					t.Fatalf("Failed to reject an invalid Content-Type")
+				}
+				postMethod, _ := apiGatewayResource.NewMethod("POST", http.StatusCreated)
+				setErr := postMethod.SetMappingTemplates(&APIMappingTemplates{
+					Request: map[string]string{
+						"application/json": `{"custom":$input.json('$')}`,
+					},
+					Response: map[string]string{
+						"application/json": `$input.json('$.body')`,
+					},
+				})
+				if setErr != nil {
+					t.Fatalf("Failed to set mapping templates: %s", setErr)
+				}
+				return &apiTestFixture{api: apiGateway}
+			},
+			verify: func(t *testing.T, apiTemplate *apiTestTemplate) {
+				getMethod := apiTemplate.method(t, "/test", "GET")
+				getTemplates, _ := templateValue(getMethod, "Integration", "RequestTemplates").(map[string]interface{})
+				if len(getTemplates) != 2 {
+					t.Fatalf("Unexpected GET request templates: %#v", getTemplates)
+				}
+				expectTemplateValue(t, getTemplates, `{"xml":"$util.escapeJavaScript($input.body)"}`,
+					"application/xml")
+				notFound := statusCodeValue(t, getMethod, "404", "Integration", "IntegrationResponses")
+				expectTemplateValue(t, notFound, ".*NotFound.*", "SelectionPattern")
+				expectTemplateValue(t, notFound, `{"missing":true}`, "ResponseTemplates", "application/json")
+
+				postMethod := apiTemplate.method(t, "/test", "POST")
+				expectTemplateValue(t, postMethod, map[string]string{
+					"application/json": `{"custom":$input.json('$')}`,
+				}, "Integration", "RequestTemplates")
+				expectTemplateValue(t,
+					statusCodeValue(t, postMethod, "201", "Integration", "IntegrationResponses"),
+					map[string]string{"application/json": `$input.json('$.body')`},
+					"ResponseTemplates")
+			},
+		},
+	}
+	for _, eachTest := range testCases {
+		testCase := eachTest
+		t.Run(testCase.name, func(t *testing.T) {
+			fixture := testCase.fixture(t)
+			template := gocf.NewTemplate()
+			marshalErr := fixture.api.Marshal(testCase.name, nil, "", "", "", nil, template, true, logrus.New())
+			if marshalErr != nil {
+				t.Fatalf("Failed to marshal API: %s", marshalErr)
+			}
+			testCase.verify(t, newAPITestTemplate(t, template))
+			for eachIndex, eachInvalid := range fixture.invalid {
+				eachInvalid()
+				marshalErr = fixture.api.Marshal(testCase.name, nil, "", "", "", nil, gocf.NewTemplate(), true, logrus.New())
+				if marshalErr == nil {
+					t.Fatalf("Failed to reject invalid API %d", eachIndex)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package sparta
+
+import (
+	"fmt"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIUsagePlanQuotaPeriodDay is a daily usage plan quota
+	// @enum APIUsagePlanQuotaPeriod
+	APIUsagePlanQuotaPeriodDay = "DAY"
+	// APIUsagePlanQuotaPeriodWeek is a weekly usage plan quota
+	// @enum APIUsagePlanQuotaPeriod
+	APIUsagePlanQuotaPeriodWeek = "WEEK"
+	// APIUsagePlanQuotaPeriodMonth is a monthly usage plan quota
+	// @enum APIUsagePlanQuotaPeriod
+	APIUsagePlanQuotaPeriodMonth = "MONTH"
+)
+
+// APIThrottle represents the steady-state request rate and burst limits
+// for a stage, usage plan, or method
+type APIThrottle struct {
+	// Steady-state requests per second
+	RateLimit int64
+	// Maximum concurrent request bucket size
+	BurstLimit int64
+}
+
+func (throttle *APIThrottle) usagePlanThrottle() *gocf.APIGatewayUsagePlanThrottleSettings {
+	throttleSettings := &gocf.APIGatewayUsagePlanThrottleSettings{}
+	if throttle.RateLimit != 0 {
+		throttleSettings.RateLimit = gocf.Integer(throttle.RateLimit)
+	}
+	if throttle.BurstLimit != 0 {
+		throttleSettings.BurstLimit = gocf.Integer(throttle.BurstLimit)
+	}
+	return throttleSettings
+}
+
+// APIQuota represents the maximum number of requests a client
+// can make in a given time period
+type APIQuota struct {
+	// Maximum number of requests in the Period
+	Limit int64
+	// One of the APIUsagePlanQuotaPeriod values. Defaults to DAY.
+	Period string
+	// Optional number of requests subtracted from the Limit
+	// in the first Period
+	Offset int64
+}
+
+// APIKey represents an API Gateway API key that is associated with
+// one or more usage plans. See
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-api-usage-plans.html
+type APIKey struct {
+	name string
+	// Optional description
+	Description string
+	// Optional AWS Marketplace customer identifier
+	CustomerID string
+	// Optional key value of at least 20 characters. If undefined API Gateway
+	// generates the value. Prefer a dynamic reference such as
+	// {{resolve:secretsmanager:MySecret:SecretString:apiKey}} to a literal.
+	Value gocf.Stringable
+}
+
+// LogicalResourceName returns the CloudFormation logical
+// resource name for this API key
+func (apiKey *APIKey) LogicalResourceName() string {
+	return CloudFormationResourceName("APIGatewayAPIKey", apiKey.name)
+}
+
+// OutputName returns the CloudFormation Output key that
+// stores the API key ID
+func (apiKey *APIKey) OutputName() string {
+	return apiKey.LogicalResourceName()
+}
+
+// NewAPIKey returns a new APIKey with the given name
+func NewAPIKey(name string) *APIKey {
+	return &APIKey{
+		name: name,
+	}
+}
+
+// APIUsagePlan represents an API Gateway usage plan that meters and
+// throttles the API's stage for the associated API keys. Methods
+// must set APIKeyRequired to be metered by the usage plan.
+type APIUsagePlan struct {
+	name string
+	// Optional description
+	Description string
+	// Optional request quota
+	Quota *APIQuota
+	// Optional usage plan throttle
+	Throttle *APIThrottle
+	// Optional per-method throttles keyed by "/resource/path/HTTP_METHOD",
+	// for example "/hello/GET"
+	MethodThrottles map[string]*APIThrottle
+	// API keys associated with this usage plan
+	APIKeys []*APIKey
+}
+
+// LogicalResourceName returns the CloudFormation logical
+// resource name for this usage plan
+func (usagePlan *APIUsagePlan) LogicalResourceName() string {
+	return CloudFormationResourceName("APIGatewayUsagePlan", usagePlan.name)
+}
+
+// marshal adds the usage plan, its API keys, and the API key outputs
+// to the template
+func (usagePlan *APIUsagePlan) marshal(apiGatewayResName string,
+	stageName string,
+	deploymentResName string,
+	template *gocf.Template) error {
+
+	apiStage := gocf.APIGatewayUsagePlanAPIStage{
+		APIID: gocf.Ref(apiGatewayResName).String(),
+		Stage: gocf.String(stageName),
+	}
+	if len(usagePlan.MethodThrottles) != 0 {
+		methodThrottles := make(map[string]*gocf.APIGatewayUsagePlanThrottleSettings)
+		for eachMethodPath, eachThrottle := range usagePlan.MethodThrottles {
+			if eachThrottle == nil {
+				return errors.Errorf("Usage plan %s has an undefined throttle for method: %s",
+					usagePlan.name,
+					eachMethodPath)
+			}
+			methodThrottles[eachMethodPath] = eachThrottle.usagePlanThrottle()
+		}
+		apiStage.Throttle = methodThrottles
+	}
+	usagePlanRes := &gocf.APIGatewayUsagePlan{
+		UsagePlanName: gocf.Join("-",
+			gocf.Ref("AWS::StackName"),
+			gocf.String(usagePlan.name)),
+		APIStages: &gocf.APIGatewayUsagePlanAPIStageList{apiStage},
+	}
+	if usagePlan.Description != "" {
+		usagePlanRes.Description = gocf.String(usagePlan.Description)
+	}
+	if usagePlan.Throttle != nil {
+		usagePlanRes.Throttle = usagePlan.Throttle.usagePlanThrottle()
+	}
+	if usagePlan.Quota != nil {
+		if usagePlan.Quota.Limit <= 0 {
+			return errors.Errorf("Usage plan %s quota limit must be greater than 0", usagePlan.name)
+		}
+		period := usagePlan.Quota.Period
+		if period == "" {
+			period = APIUsagePlanQuotaPeriodDay
+		}
+		usagePlanRes.Quota = &gocf.APIGatewayUsagePlanQuotaSettings{
+			Limit:  gocf.Integer(usagePlan.Quota.Limit),
+			Period: gocf.String(period),
+		}
+		if usagePlan.Quota.Offset != 0 {
+			usagePlanRes.Quota.Offset = gocf.Integer(usagePlan.Quota.Offset)
+		}
+	}
+	usagePlanResName := usagePlan.LogicalResourceName()
+	// The stage is created by the deployment
+	usagePlanResource := template.AddResource(usagePlanResName, usagePlanRes)
+	usagePlanResource.DependsOn = append(usagePlanResource.DependsOn, deploymentResName)
+
+	for _, eachAPIKey := range usagePlan.APIKeys {
+		apiKeyResName := eachAPIKey.LogicalResourceName()
+		// API keys may be shared across usage plans
+		if _, exists := template.Resources[apiKeyResName]; !exists {
+			apiKeyRes := &gocf.APIGatewayAPIKey{
+				Name: gocf.Join("-",
+					gocf.Ref("AWS::StackName"),
+					gocf.String(eachAPIKey.name)),
+				Enabled: gocf.Bool(true),
+			}
+			if eachAPIKey.Description != "" {
+				apiKeyRes.Description = gocf.String(eachAPIKey.Description)
+			}
+			if eachAPIKey.CustomerID != "" {
+				apiKeyRes.CustomerID = gocf.String(eachAPIKey.CustomerID)
+			}
+			if eachAPIKey.Value != nil {
+				apiKeyRes.Value = eachAPIKey.Value.String()
+			}
+			template.AddResource(apiKeyResName, apiKeyRes)
+
+			// CloudFormation doesn't expose API key values. Publish the key ID
+			// so that the value can be fetched with:
+			// aws apigateway get-api-key --api-key ID --include-value
+			template.Outputs[eachAPIKey.OutputName()] = &gocf.Output{
+				Description: fmt.Sprintf("API key ID: %s", eachAPIKey.name),
+				Value:       gocf.Ref(apiKeyResName),
+			}
+		}
+		template.AddResource(CloudFormationResourceName("APIGatewayUsagePlanKey",
+			usagePlan.name,
+			eachAPIKey.name),
+			&gocf.APIGatewayUsagePlanKey{
+				KeyID:       gocf.Ref(apiKeyResName).String(),
+				KeyType:     gocf.String("API_KEY"),
+				UsagePlanID: gocf.Ref(usagePlanResName).String(),
+			})
+	}
+	return nil
+}
+
+// NewUsagePlan returns a new APIUsagePlan associated with the API's stage. The
+// API must have a stage to provision a usage plan.
+func (api *API) NewUsagePlan(name string, apiKeys ...*APIKey) (*APIUsagePlan, error) {
+	if name == "" {
+		return nil, errors.Errorf("Usage plan name must not be empty")
+	}
+	for _, eachUsagePlan := range api.usagePlans {
+		if eachUsagePlan.name == name {
+			return nil, errors.Errorf("Usage plan %s already exists", name)
+		}
+	}
+	usagePlan := &APIUsagePlan{
+		name:    name,
+		APIKeys: apiKeys,
+	}
+	api.usagePlans = append(api.usagePlans, usagePlan)
+	return usagePlan, nil
+}
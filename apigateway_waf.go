@@ -0,0 +1,141 @@
+package sparta
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// defaultWebACLManagedRuleGroups are the AWS managed rule groups included
+// in a Sparta generated WebACL if APIWebACL.ManagedRuleGroups is empty
+var defaultWebACLManagedRuleGroups = []string{
+	"AWSManagedRulesCommonRuleSet",
+	"AWSManagedRulesKnownBadInputsRuleSet",
+	"AWSManagedRulesAmazonIpReputationList",
+}
+
+// APIWebACL represents the AWS WAFv2 WebACL associated with an API stage.
+// Provide either an existing WebACLArn or the settings for a Sparta
+// generated WebACL. See
+// https://docs.aws.amazon.com/waf/latest/developerguide/waf-chapter.html
+type APIWebACL struct {
+	// Optional existing REGIONAL WebACL ARN. If defined, the remaining
+	// fields are ignored.
+	WebACLArn gocf.Stringable
+	// AWS managed rule group names (eg: AWSManagedRulesSQLiRuleSet) for the
+	// generated WebACL. Defaults to AWSManagedRulesCommonRuleSet,
+	// AWSManagedRulesKnownBadInputsRuleSet, and AWSManagedRulesAmazonIpReputationList.
+	ManagedRuleGroups []string
+	// Optional maximum number of requests from a single IP address
+	// in any five minute period. Requests that exceed the limit
+	// are blocked.
+	RateLimit int64
+	// Count, rather than block, requests that match the rules. Use
+	// this to evaluate the rules before enforcing them.
+	CountOnly bool
+}
+
+func webACLVisibilityConfig(metricName string) *wafv2VisibilityConfig {
+	return &wafv2VisibilityConfig{
+		CloudWatchMetricsEnabled: gocf.Bool(true),
+		MetricName:               gocf.String(metricName),
+		SampledRequestsEnabled:   gocf.Bool(true),
+	}
+}
+
+// marshal adds the WebACL and the stage association to the template
+func (webACL *APIWebACL) marshal(apiGatewayResName string,
+	stageName string,
+	deploymentResName string,
+	template *gocf.Template) error {
+
+	var webACLArn *gocf.StringExpr
+	if webACL.WebACLArn != nil {
+		webACLArn = webACL.WebACLArn.String()
+	} else {
+		if webACL.RateLimit != 0 && webACL.RateLimit < 100 {
+			return errors.Errorf("WebACL RateLimit for API %s must be at least 100", apiGatewayResName)
+		}
+		webACLResName := CloudFormationResourceName("APIGatewayWebACL", apiGatewayResName)
+		webACLRes := &wafv2WebACL{
+			DefaultAction: &wafv2DefaultAction{
+				Allow: &wafv2Empty{},
+			},
+			Description:      gocf.String("Sparta API Gateway WebACL"),
+			Scope:            gocf.String("REGIONAL"),
+			VisibilityConfig: webACLVisibilityConfig(webACLResName),
+		}
+		managedRuleGroups := webACL.ManagedRuleGroups
+		if len(managedRuleGroups) == 0 {
+			managedRuleGroups = defaultWebACLManagedRuleGroups
+		}
+		priority := int64(0)
+		if webACL.RateLimit != 0 {
+			ruleAction := &wafv2RuleAction{
+				Block: &wafv2Empty{},
+			}
+			if webACL.CountOnly {
+				ruleAction = &wafv2RuleAction{
+					Count: &wafv2Empty{},
+				}
+			}
+			webACLRes.Rules = append(webACLRes.Rules, wafv2Rule{
+				Action:   ruleAction,
+				Name:     gocf.String("RateLimit"),
+				Priority: gocf.Integer(priority),
+				Statement: &wafv2Statement{
+					RateBasedStatement: &wafv2RateBasedStatement{
+						AggregateKeyType: gocf.String("IP"),
+						Limit:            gocf.Integer(webACL.RateLimit),
+					},
+				},
+				VisibilityConfig: webACLVisibilityConfig("RateLimit"),
+			})
+			priority++
+		}
+		for _, eachRuleGroup := range managedRuleGroups {
+			overrideAction := &wafv2OverrideAction{
+				None: &wafv2Empty{},
+			}
+			if webACL.CountOnly {
+				overrideAction = &wafv2OverrideAction{
+					Count: &wafv2Empty{},
+				}
+			}
+			webACLRes.Rules = append(webACLRes.Rules, wafv2Rule{
+				Name:           gocf.String(eachRuleGroup),
+				OverrideAction: overrideAction,
+				Priority:       gocf.Integer(priority),
+				Statement: &wafv2Statement{
+					ManagedRuleGroupStatement: &wafv2ManagedRuleGroupStatement{
+						Name:       gocf.String(eachRuleGroup),
+						VendorName: gocf.String("AWS"),
+					},
+				},
+				VisibilityConfig: webACLVisibilityConfig(eachRuleGroup),
+			})
+			priority++
+		}
+		template.AddResource(webACLResName, webACLRes)
+		webACLArn = gocf.GetAtt(webACLResName, "Arn")
+	}
+
+	// Associate it with the stage
+	association := &wafv2WebACLAssociation{
+		ResourceArn: gocf.Join("",
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":apigateway:"),
+			gocf.Ref("AWS::Region"),
+			gocf.String("::/restapis/"),
+			gocf.Ref(apiGatewayResName),
+			gocf.String("/stages/"),
+			gocf.String(stageName)),
+		WebACLArn: webACLArn,
+	}
+	associationResource := template.AddResource(CloudFormationResourceName("APIGatewayWebACLAssociation",
+		apiGatewayResName),
+		association)
+	// The stage is created by the deployment
+	associationResource.DependsOn = append(associationResource.DependsOn, deploymentResName)
+	return nil
+}
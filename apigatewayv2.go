@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws/session"
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -22,6 +23,16 @@ const (
 	Websocket APIV2Protocol = "WEBSOCKET"
 )
 
+const (
+	// APIV2RouteConnect is the route key used when a client connects
+	APIV2RouteConnect APIV2RouteSelectionExpression = "$connect"
+	// APIV2RouteDisconnect is the route key used when a client disconnects
+	APIV2RouteDisconnect APIV2RouteSelectionExpression = "$disconnect"
+	// APIV2RouteDefault is the route key used when the route selection
+	// expression doesn't match any other route
+	APIV2RouteDefault APIV2RouteSelectionExpression = "$default"
+)
+
 // APIV2 contains the information necessary for the routes in here.
 // Please tell me they can use the same routes...
 // They cannot
@@ -42,6 +53,7 @@ type APIV2 struct {
 // APIV2GatewayDecorator is the compound decorator that handles both
 // the DDB table creation and the lambda decorator...winning.
 type APIV2GatewayDecorator struct {
+	apiv2           *APIV2
 	envTableKeyName string
 	propertyName    string
 	readCapacity    int64
@@ -54,7 +66,7 @@ func (apigd *APIV2GatewayDecorator) logicalResourceName() string {
 }
 
 // DecorateService handles inserting the DDB Table
-func (apigd *APIV2GatewayDecorator) DecorateService(context map[string]interface{},
+func (apigd *APIV2GatewayDecorator) DecorateService(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -140,6 +152,9 @@ func (apigd *APIV2GatewayDecorator) AnnotateLambdas(lambdaFns []*LambdaAWSInfo)
 		// Add the permission
 		eachLambda.RoleDefinition.Privileges = append(eachLambda.RoleDefinition.Privileges,
 			ddbPermissions...)
+		// Every function can message the connected clients
+		eachLambda.RoleDefinition.Privileges = append(eachLambda.RoleDefinition.Privileges,
+			apigd.apiv2.ManageConnectionsPrivilege())
 
 		// Add the env
 		env := eachLambda.Options.Environment
@@ -147,6 +162,7 @@ func (apigd *APIV2GatewayDecorator) AnnotateLambdas(lambdaFns []*LambdaAWSInfo)
 			env = make(map[string]*gocf.StringExpr)
 		}
 		env[apigd.envTableKeyName] = gocf.Ref(apigd.logicalResourceName()).String()
+		env[spartaAPIGateway.EnvVarConnectionsEndpoint] = apigd.apiv2.ConnectionsEndpoint()
 		eachLambda.Options.Environment = env
 	}
 	return nil
@@ -160,6 +176,7 @@ func (apiv2 *APIV2) NewConnectionTableDecorator(envTableNameKey string,
 	writeCapacity int64) (*APIV2GatewayDecorator, error) {
 
 	return &APIV2GatewayDecorator{
+		apiv2:           apiv2,
 		envTableKeyName: envTableNameKey,
 		propertyName:    propertyName,
 		readCapacity:    readCapacity,
@@ -167,6 +184,39 @@ func (apiv2 *APIV2) NewConnectionTableDecorator(envTableNameKey string,
 	}, nil
 }
 
+// ManageConnectionsPrivilege returns the IAMRolePrivilege that allows a lambda
+// function to send messages to, and disconnect, the API's connected clients.
+// See the aws/apigateway package for runtime helpers.
+func (apiv2 *APIV2) ManageConnectionsPrivilege() IAMRolePrivilege {
+	return IAMRolePrivilege{
+		Actions: []string{"execute-api:ManageConnections"},
+		Resource: gocf.Join("",
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":execute-api:"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(":"),
+			gocf.Ref("AWS::AccountId"),
+			gocf.String(":"),
+			gocf.Ref(apiv2.LogicalResourceName()),
+			gocf.String("/"),
+			gocf.String(apiv2.stage.name),
+			gocf.String("/*/@connections/*")),
+	}
+}
+
+// ConnectionsEndpoint returns the API Gateway Management API endpoint used
+// to manage the API's connected clients
+func (apiv2 *APIV2) ConnectionsEndpoint() *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String("https://"),
+		gocf.Ref(apiv2.LogicalResourceName()),
+		gocf.String(".execute-api."),
+		gocf.Ref("AWS::Region"),
+		gocf.String(".amazonaws.com/"),
+		gocf.String(apiv2.stage.name))
+}
+
 // NewAPIV2Route returns a new Route
 func (apiv2 *APIV2) NewAPIV2Route(routeKey APIV2RouteSelectionExpression,
 	lambdaFn *LambdaAWSInfo) (*APIV2Route, error) {
@@ -298,7 +348,7 @@ func (apiv2 *APIV2) Marshal(serviceName string,
 				gocf.String("arn:aws:apigateway:"),
 				gocf.Ref("AWS::Region"),
 				gocf.String(":lambda:path/2015-03-31/functions/"),
-				gocf.GetAtt(eachRoute.lambdaFn.LogicalResourceName(), "Arn"),
+				lambdaInvocationArn(eachRoute.lambdaFn),
 				gocf.String("/invocations")),
 			PassthroughBehavior: marshalString(eachRoute.Integration.PassthroughBehavior),
 			// TODO - auto create this...
@@ -314,7 +364,7 @@ func (apiv2 *APIV2) Marshal(serviceName string,
 			string(eachExpression))
 		lambdaInvokePermission := &gocf.LambdaPermission{
 			Action:       gocf.String("lambda:InvokeFunction"),
-			FunctionName: gocf.GetAtt(eachRoute.lambdaFn.LogicalResourceName(), "Arn"),
+			FunctionName: lambdaInvocationArn(eachRoute.lambdaFn),
 			Principal:    gocf.String(APIGatewayPrincipal),
 		}
 		template.AddResource(apiGatewayPermissionResourceName, lambdaInvokePermission)
@@ -1,7 +1,11 @@
 package archetype
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"testing"
 
 	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
@@ -43,6 +47,16 @@ func (at *archetypeTest) OnCloudWatchMessage(ctx context.Context,
 	return nil, nil
 }
 
+func (at *archetypeTest) OnCloudWatchLogs(ctx context.Context,
+	logsData awsLambdaEvents.CloudwatchLogsData) (interface{}, error) {
+	return nil, nil
+}
+
+func (at *archetypeTest) OnSESEvent(ctx context.Context,
+	sesEvent awsLambdaEvents.SimpleEmailEvent) (interface{}, error) {
+	return nil, nil
+}
+
 func (at *archetypeTest) OnDynamoEvent(ctx context.Context,
 	dynamoEvent awsLambdaEvents.DynamoDBEvent) (interface{}, error) {
 	return nil, nil
@@ -95,6 +109,55 @@ func TestS3ScopedArchetype(t *testing.T) {
 	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
 }
 
+func TestS3FilteredArchetype(t *testing.T) {
+	testStruct := &archetypeTest{}
+
+	lambdaFn, lambdaFnErr := NewS3FilteredReactor(testStruct,
+		gocf.String("s3Bucket"),
+		[]sparta.S3Notification{
+			{
+				Events: []string{"s3:ObjectCreated:*"},
+				Prefix: "images/",
+				Suffix: ".jpg",
+			},
+			{
+				Events: []string{"s3:ObjectCreated:*"},
+				Prefix: "images/",
+				Suffix: ".png",
+			},
+			{
+				Events: []string{"s3:ObjectRemoved:*"},
+				Prefix: "images/",
+			},
+		},
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate S3Reactor: %s", lambdaFnErr.Error())
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+
+	// Overlapping notifications are rejected
+	lambdaFn, lambdaFnErr = NewS3FilteredReactor(S3ReactorFunc(testStruct.OnS3Event),
+		gocf.String("s3Bucket"),
+		[]sparta.S3Notification{
+			{
+				Events: []string{"s3:ObjectCreated:*"},
+				Prefix: "images/",
+			},
+			{
+				Events: []string{"s3:ObjectCreated:Put"},
+				Prefix: "images/thumbnails/",
+			},
+		},
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate S3Reactor: %s", lambdaFnErr.Error())
+	}
+	spartaTesting.Provision(t,
+		[]*sparta.LambdaAWSInfo{lambdaFn},
+		spartaTesting.AssertError("Failed to reject overlapping S3 notifications"))
+}
+
 func TestSNSArchetype(t *testing.T) {
 	testStruct := &archetypeTest{}
 
@@ -215,3 +278,92 @@ func TestCloudWatchScheduled(t *testing.T) {
 	}
 	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
 }
+
+func TestCloudWatchLogs(t *testing.T) {
+	testStruct := &archetypeTest{}
+
+	lambdaFn, lambdaFnErr := NewCloudWatchLogsReactor(testStruct,
+		map[string]sparta.CloudWatchLogsSubscriptionFilter{
+			"errors": {
+				LogGroupName:  "/aws/lambda/someFunction",
+				FilterPattern: "ERROR",
+			}},
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate NewCloudWatchLogsReactor: %s", lambdaFnErr.Error())
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+
+	lambdaFn, lambdaFnErr = NewCloudWatchLogsReactor(CloudWatchLogsReactorFunc(testStruct.OnCloudWatchLogs),
+		map[string]sparta.CloudWatchLogsSubscriptionFilter{
+			"errors": {
+				LogGroupName:  "/aws/lambda/someFunction",
+				FilterPattern: "ERROR",
+			}},
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate NewCloudWatchLogsReactor: %s", lambdaFnErr.Error())
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+}
+
+func TestDecodeCloudWatchLogsEvent(t *testing.T) {
+	logsData := awsLambdaEvents.CloudwatchLogsData{
+		LogGroup: "/aws/lambda/someFunction",
+		LogEvents: []awsLambdaEvents.CloudwatchLogsLogEvent{
+			{
+				ID:      "1",
+				Message: "ERROR Something happened",
+			},
+		},
+	}
+	jsonBytes, _ := json.Marshal(logsData)
+	var gzipBuffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBuffer)
+	_, _ = gzipWriter.Write(jsonBytes)
+	_ = gzipWriter.Close()
+
+	cwLogs := awsLambdaEvents.CloudwatchLogsEvent{
+		AWSLogs: awsLambdaEvents.CloudwatchLogsRawData{
+			Data: base64.StdEncoding.EncodeToString(gzipBuffer.Bytes()),
+		},
+	}
+	decoded, decodedErr := DecodeCloudWatchLogsEvent(cwLogs)
+	if decodedErr != nil {
+		t.Fatalf("Failed to decode CloudWatch Logs event: %s", decodedErr)
+	}
+	if decoded.LogGroup != logsData.LogGroup || len(decoded.LogEvents) != 1 {
+		t.Fatalf("Failed to roundtrip CloudWatch Logs event: %#v", decoded)
+	}
+}
+
+func TestSESArchetype(t *testing.T) {
+	testStruct := &archetypeTest{}
+
+	lambdaFn, lambdaFnErr := NewSESReactor(testStruct,
+		nil,
+		"",
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate SESReactor: %s", lambdaFnErr.Error())
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+
+	lambdaFn, lambdaFnErr = NewSESReactor(SESReactorFunc(testStruct.OnSESEvent),
+		[]sparta.ReceiptRule{
+			{
+				Name:       "Inbound",
+				Recipients: []string{"inbound@example.com"},
+				TLSPolicy:  "Require",
+			},
+		},
+		"InboundMessages",
+		nil)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate SESReactor: %s", lambdaFnErr.Error())
+	}
+	if _, exists := lambdaFn.Options.Environment[EnvVarSESMessageBodyBucket]; !exists {
+		t.Fatalf("Failed to publish SES message body bucket name")
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+}
@@ -0,0 +1,92 @@
+package archetype
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/pkg/errors"
+)
+
+// CloudWatchLogsReactor represents a lambda function that responds to
+// CloudWatch Logs subscription filter deliveries
+type CloudWatchLogsReactor interface {
+	// OnCloudWatchLogs is called with the decoded (gunzipped and base64
+	// decoded) log data delivered by the subscription filter
+	OnCloudWatchLogs(ctx context.Context,
+		logsData awsLambdaEvents.CloudwatchLogsData) (interface{}, error)
+}
+
+// CloudWatchLogsReactorFunc is a free function that adapts a CloudWatchLogsReactor
+// compliant signature into a function that exposes an OnEvent
+// function
+type CloudWatchLogsReactorFunc func(ctx context.Context,
+	logsData awsLambdaEvents.CloudwatchLogsData) (interface{}, error)
+
+// OnCloudWatchLogs satisfies the CloudWatchLogsReactor interface
+func (reactorFunc CloudWatchLogsReactorFunc) OnCloudWatchLogs(ctx context.Context,
+	logsData awsLambdaEvents.CloudwatchLogsData) (interface{}, error) {
+	return reactorFunc(ctx, logsData)
+}
+
+// ReactorName provides the name of the reactor func
+func (reactorFunc CloudWatchLogsReactorFunc) ReactorName() string {
+	return runtime.FuncForPC(reflect.ValueOf(reactorFunc).Pointer()).Name()
+}
+
+// DecodeCloudWatchLogsEvent returns the decoded log data from the raw
+// CloudWatch Logs subscription event. Subscription filter payloads are
+// gzip compressed and base64 encoded.
+func DecodeCloudWatchLogsEvent(cwLogs awsLambdaEvents.CloudwatchLogsEvent) (awsLambdaEvents.CloudwatchLogsData, error) {
+	logsData, logsDataErr := cwLogs.AWSLogs.Parse()
+	if logsDataErr != nil {
+		return logsData, errors.Wrapf(logsDataErr, "Failed to decode CloudWatch Logs event")
+	}
+	return logsData, nil
+}
+
+// NewCloudWatchLogsReactor returns a lambda function that is subscribed to
+// the given log groups via AWS::Logs::SubscriptionFilter resources. The filters
+// map is a map of filter names to the log group and filter pattern. See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/FilterAndPatternSyntax.html
+// for the filter pattern syntax. Example:
+// 	map[string]sparta.CloudWatchLogsSubscriptionFilter{
+//		"errors": sparta.CloudWatchLogsSubscriptionFilter{
+//			LogGroupName:  "/aws/lambda/myFunction",
+//			FilterPattern: "ERROR",
+//		},
+//	}
+func NewCloudWatchLogsReactor(reactor CloudWatchLogsReactor,
+	filters map[string]sparta.CloudWatchLogsSubscriptionFilter,
+	additionalLambdaPermissions []sparta.IAMRolePrivilege) (*sparta.LambdaAWSInfo, error) {
+	if len(filters) <= 0 {
+		return nil, errors.Errorf("CloudWatchLogs filter map must not be empty")
+	}
+
+	reactorLambda := func(ctx context.Context, cwLogs awsLambdaEvents.CloudwatchLogsEvent) (interface{}, error) {
+		logsData, logsDataErr := DecodeCloudWatchLogsEvent(cwLogs)
+		if logsDataErr != nil {
+			return nil, logsDataErr
+		}
+		return reactor.OnCloudWatchLogs(ctx, logsData)
+	}
+	lambdaFn, lambdaFnErr := sparta.NewAWSLambda(reactorName(reactor),
+		reactorLambda,
+		sparta.IAMRoleDefinition{})
+	if lambdaFnErr != nil {
+		return nil, errors.Wrapf(lambdaFnErr, "attempting to create reactor")
+	}
+	subscriptionPermission := sparta.CloudWatchLogsSubscriptionPermission{}
+	subscriptionPermission.Filters = make(map[string]sparta.CloudWatchLogsSubscriptionFilter)
+	for eachFilterName, eachFilter := range filters {
+		subscriptionPermission.Filters[eachFilterName] = eachFilter
+	}
+	lambdaFn.Permissions = append(lambdaFn.Permissions, subscriptionPermission)
+
+	if len(additionalLambdaPermissions) != 0 {
+		lambdaFn.RoleDefinition.Privileges = additionalLambdaPermissions
+	}
+	return lambdaFn, nil
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -78,11 +79,7 @@ func NewKinesisFirehoseLambdaTransformer(reactor KinesisFirehoseReactor,
 				return nil, errors.Wrapf(responseRecordErr, "Failed to transform record")
 			}
 			if responseRecord == nil {
-				responseRecord = &awsEvents.KinesisFirehoseResponseRecord{
-					RecordID: eachRecord.RecordID,
-					Result:   awsEvents.KinesisFirehoseTransformedStateDropped,
-					Data:     eachRecord.Data,
-				}
+				responseRecord = KinesisFirehoseRecordDropped(&eachRecord)
 			}
 			response.Records[eachIndex] = *responseRecord
 		}
@@ -92,7 +89,14 @@ func NewKinesisFirehoseLambdaTransformer(reactor KinesisFirehoseReactor,
 	lambdaFn, lambdaFnErr := sparta.NewAWSLambda(reactorName(reactor),
 		reactorLambda,
 		sparta.IAMRoleDefinition{})
-	return lambdaFn, lambdaFnErr
+	if lambdaFnErr != nil {
+		return nil, errors.Wrapf(lambdaFnErr, "attempting to create Kinesis Firehose reactor")
+	}
+	if timeout != 0 {
+		lambdaFn.Options.Timeout = (timeout.Milliseconds() / 1000)
+	}
+	lambdaFn.Permissions = append(lambdaFn.Permissions, sparta.KinesisFirehosePermission{})
+	return lambdaFn, nil
 }
 
 // NewKinesisFirehoseTransformer returns a new firehose proocessor that supports
@@ -120,10 +124,11 @@ func NewKinesisFirehoseTransformer(xformFilePath string,
 	// Borrow the resource name creator to get a name for the archive
 	lambdaFn.Options.Environment[envVarKinesisFirehoseTransformName] = gocf.String(archiveEntryName)
 	lambdaFn.Options.Timeout = (timeout.Milliseconds() / 1000)
+	lambdaFn.Permissions = append(lambdaFn.Permissions, sparta.KinesisFirehosePermission{})
 
 	// Create the decorator that adds the file to the ZIP archive using
 	// the transform name...
-	archiveDecorator := func(context map[string]interface{},
+	archiveDecorator := func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		zipWriter *zip.Writer,
 		awsSession *session.Session,
@@ -162,6 +167,63 @@ func NewKinesisFirehoseTransformer(xformFilePath string,
 	return lambdaFn, nil
 }
 
+// KinesisFirehoseRecordOK returns a response record that marks the source
+// record as successfully transformed to the given data
+func KinesisFirehoseRecordOK(record *awsEvents.KinesisFirehoseEventRecord,
+	data []byte) *awsEvents.KinesisFirehoseResponseRecord {
+	return &awsEvents.KinesisFirehoseResponseRecord{
+		RecordID: record.RecordID,
+		Result:   awsEvents.KinesisFirehoseTransformedStateOk,
+		Data:     data,
+	}
+}
+
+// KinesisFirehoseRecordDropped returns a response record that marks the source
+// record as intentionally dropped
+func KinesisFirehoseRecordDropped(record *awsEvents.KinesisFirehoseEventRecord) *awsEvents.KinesisFirehoseResponseRecord {
+	return &awsEvents.KinesisFirehoseResponseRecord{
+		RecordID: record.RecordID,
+		Result:   awsEvents.KinesisFirehoseTransformedStateDropped,
+		Data:     record.Data,
+	}
+}
+
+// KinesisFirehoseRecordProcessingFailed returns a response record that marks
+// the source record as failed. Firehose delivers failed records to the
+// processing-failed S3 prefix.
+func KinesisFirehoseRecordProcessingFailed(record *awsEvents.KinesisFirehoseEventRecord) *awsEvents.KinesisFirehoseResponseRecord {
+	return &awsEvents.KinesisFirehoseResponseRecord{
+		RecordID: record.RecordID,
+		Result:   awsEvents.KinesisFirehoseTransformedStateProcessingFailed,
+		Data:     record.Data,
+	}
+}
+
+// UnmarshalKinesisFirehoseRecord unmarshals the JSON record data
+// into the value pointed to by v
+func UnmarshalKinesisFirehoseRecord(record *awsEvents.KinesisFirehoseEventRecord,
+	v interface{}) error {
+	unmarshalErr := json.Unmarshal(record.Data, v)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr,
+			"Failed to unmarshal Kinesis Firehose record: %s",
+			record.RecordID)
+	}
+	return nil
+}
+
+// KinesisFirehoseRecordJSON returns an OK response record whose data is the
+// newline-terminated JSON representation of v. If v cannot be marshaled,
+// the record is marked as ProcessingFailed.
+func KinesisFirehoseRecordJSON(record *awsEvents.KinesisFirehoseEventRecord,
+	v interface{}) *awsEvents.KinesisFirehoseResponseRecord {
+	jsonBytes, jsonBytesErr := json.Marshal(v)
+	if jsonBytesErr != nil {
+		return KinesisFirehoseRecordProcessingFailed(record)
+	}
+	return KinesisFirehoseRecordOK(record, append(jsonBytes, '\n'))
+}
+
 // ApplyTransformToKinesisFirehoseEvent is the generic transformation function that applies
 // a template.Template transformation to each
 func ApplyTransformToKinesisFirehoseEvent(ctx context.Context,
@@ -6,9 +6,12 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	awsEvents "github.com/aws/aws-lambda-go/events"
 	awsEventsTest "github.com/aws/aws-lambda-go/events/test"
+	sparta "github.com/mweagle/Sparta"
+	spartaTesting "github.com/mweagle/Sparta/testing"
 	"github.com/pkg/errors"
 )
 
@@ -175,3 +178,45 @@ func TestLambdaTransform(t *testing.T) {
 	}
 
 }
+
+func TestKinesisFirehoseRecordHelpers(t *testing.T) {
+	data := testData(t, "test/records-sm.json")
+	eachRecord := data.Records[0]
+
+	jsonMap := make(map[string]interface{})
+	unmarshalErr := UnmarshalKinesisFirehoseRecord(&eachRecord, &jsonMap)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal record: %s", unmarshalErr)
+	}
+	jsonMap["transformed"] = true
+	response := KinesisFirehoseRecordJSON(&eachRecord, jsonMap)
+	if response.Result != awsEvents.KinesisFirehoseTransformedStateOk ||
+		response.RecordID != eachRecord.RecordID ||
+		!strings.HasSuffix(string(response.Data), "\n") {
+		t.Fatalf("Unexpected JSON response record: %#v", response)
+	}
+	response = KinesisFirehoseRecordJSON(&eachRecord, make(chan int))
+	if response.Result != awsEvents.KinesisFirehoseTransformedStateProcessingFailed {
+		t.Fatalf("Failed to mark unmarshalable record as failed: %#v", response)
+	}
+	response = KinesisFirehoseRecordDropped(&eachRecord)
+	if response.Result != awsEvents.KinesisFirehoseTransformedStateDropped {
+		t.Fatalf("Failed to mark record as dropped: %#v", response)
+	}
+}
+
+func TestKinesisFirehoseLambdaTransformer(t *testing.T) {
+	reactor := func(ctx context.Context,
+		kinesisRecord *awsEvents.KinesisFirehoseEventRecord) (*awsEvents.KinesisFirehoseResponseRecord, error) {
+		return KinesisFirehoseRecordOK(kinesisRecord, kinesisRecord.Data), nil
+	}
+	lambdaFn, lambdaFnErr := NewKinesisFirehoseLambdaTransformer(KinesisFirehoseReactorFunc(reactor),
+		2*time.Minute)
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to instantiate KinesisFirehoseTransformer: %s", lambdaFnErr.Error())
+	}
+	if lambdaFn.Options.Timeout != 120 {
+		t.Fatalf("Failed to apply transformer timeout: %d", lambdaFn.Options.Timeout)
+	}
+	spartaTesting.Provision(t, []*sparta.LambdaAWSInfo{lambdaFn}, nil)
+}
@@ -78,6 +78,60 @@ func NewS3ScopedReactor(reactor S3Reactor,
 	keyPathPrefix string,
 	additionalLambdaPermissions []sparta.IAMRolePrivilege) (*sparta.LambdaAWSInfo, error) {
 
+	lambdaFn, lambdaFnErr := newS3Reactor(reactor, s3Bucket, additionalLambdaPermissions)
+	if lambdaFnErr != nil {
+		return nil, lambdaFnErr
+	}
+	// Event Triggers
+	lambdaFn.Permissions = append(lambdaFn.Permissions,
+		s3NotificationPrefixBasedPermission(s3Bucket, keyPathPrefix))
+
+	return lambdaFn, nil
+}
+
+// NewS3FilteredReactor returns an S3 reactor lambda function that is only
+// invoked for the given notifications. Each notification defines the set
+// of S3 events and the optional key prefix and suffix filters. Example:
+//
+//	[]sparta.S3Notification{
+//		{
+//			Events: []string{"s3:ObjectCreated:*"},
+//			Prefix: "images/",
+//			Suffix: ".jpg",
+//		},
+//		{
+//			Events: []string{"s3:ObjectRemoved:*"},
+//			Prefix: "images/",
+//		},
+//	}
+func NewS3FilteredReactor(reactor S3Reactor,
+	s3Bucket gocf.Stringable,
+	notifications []sparta.S3Notification,
+	additionalLambdaPermissions []sparta.IAMRolePrivilege) (*sparta.LambdaAWSInfo, error) {
+	if len(notifications) <= 0 {
+		return nil, errors.Errorf("S3 notifications must not be empty")
+	}
+	lambdaFn, lambdaFnErr := newS3Reactor(reactor, s3Bucket, additionalLambdaPermissions)
+	if lambdaFnErr != nil {
+		return nil, lambdaFnErr
+	}
+	// Event Triggers
+	lambdaFn.Permissions = append(lambdaFn.Permissions,
+		sparta.S3Permission{
+			BasePermission: sparta.BasePermission{
+				SourceArn: s3Bucket.String(),
+			},
+			Notifications: notifications,
+		})
+	return lambdaFn, nil
+}
+
+// newS3Reactor returns the reactor lambda function, without any
+// event triggers, that has access to the bucket keys
+func newS3Reactor(reactor S3Reactor,
+	s3Bucket gocf.Stringable,
+	additionalLambdaPermissions []sparta.IAMRolePrivilege) (*sparta.LambdaAWSInfo, error) {
+
 	reactorLambda := func(ctx context.Context, event awsLambdaEvents.S3Event) (interface{}, error) {
 		return reactor.OnS3Event(ctx, event)
 	}
@@ -100,10 +154,5 @@ func NewS3ScopedReactor(reactor S3Reactor,
 
 	// IAM Role privileges
 	lambdaFn.RoleDefinition.Privileges = privileges
-
-	// Event Triggers
-	lambdaFn.Permissions = append(lambdaFn.Permissions,
-		s3NotificationPrefixBasedPermission(s3Bucket, keyPathPrefix))
-
 	return lambdaFn, nil
 }
@@ -0,0 +1,135 @@
+package archetype
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/pkg/errors"
+)
+
+// EnvVarSESMessageBodyBucket is the environment variable that stores the
+// name of the S3 bucket to which SES message bodies are saved. It's
+// only defined if the SES reactor was created with message body storage.
+const EnvVarSESMessageBodyBucket = "SPARTA_SES_MESSAGE_BODY_BUCKET"
+
+// SESReactor represents a lambda function that responds to inbound SES email
+type SESReactor interface {
+	// OnSESEvent when an inbound email is received. The sesEvent
+	// contains the message headers and receipt information, but not
+	// the message body
+	OnSESEvent(ctx context.Context, sesEvent awsLambdaEvents.SimpleEmailEvent) (interface{}, error)
+}
+
+// SESReactorFunc is a free function that adapts a SESReactor
+// compliant signature into a function that exposes an OnEvent
+// function
+type SESReactorFunc func(ctx context.Context,
+	sesEvent awsLambdaEvents.SimpleEmailEvent) (interface{}, error)
+
+// OnSESEvent satisfies the SESReactor interface
+func (reactorFunc SESReactorFunc) OnSESEvent(ctx context.Context,
+	sesEvent awsLambdaEvents.SimpleEmailEvent) (interface{}, error) {
+	return reactorFunc(ctx, sesEvent)
+}
+
+// ReactorName provides the name of the reactor func
+func (reactorFunc SESReactorFunc) ReactorName() string {
+	return runtime.FuncForPC(reflect.ValueOf(reactorFunc).Pointer()).Name()
+}
+
+// NewSESReactor returns an SES reactor lambda function. The receiptRules are
+// provisioned in the shared Sparta SES RuleSet and each rule invokes the
+// reactor. If receiptRules is empty, a single rule that accepts email for all
+// verified domains is created. If messageBodyBucketLogicalName is non-empty,
+// a new S3 bucket is provisioned to store the MIME message bodies, the
+// reactor is granted s3:GetObject access to it, and the bucket name is
+// published in the EnvVarSESMessageBodyBucket environment variable. See
+// FetchSESMessageBody to read the message body at runtime.
+func NewSESReactor(reactor SESReactor,
+	receiptRules []sparta.ReceiptRule,
+	messageBodyBucketLogicalName string,
+	additionalLambdaPermissions []sparta.IAMRolePrivilege) (*sparta.LambdaAWSInfo, error) {
+
+	reactorLambda := func(ctx context.Context, sesEvent awsLambdaEvents.SimpleEmailEvent) (interface{}, error) {
+		return reactor.OnSESEvent(ctx, sesEvent)
+	}
+
+	lambdaFn, lambdaFnErr := sparta.NewAWSLambda(reactorName(reactor),
+		reactorLambda,
+		sparta.IAMRoleDefinition{})
+	if lambdaFnErr != nil {
+		return nil, errors.Wrapf(lambdaFnErr, "attempting to create reactor")
+	}
+	if len(additionalLambdaPermissions) != 0 {
+		lambdaFn.RoleDefinition.Privileges = additionalLambdaPermissions
+	}
+
+	sesPermission := sparta.SESPermission{
+		BasePermission: sparta.BasePermission{
+			SourceArn: "*",
+		},
+		InvocationType: "Event",
+		ReceiptRules:   receiptRules,
+	}
+	// The default SESPermission rule doesn't include a Lambda action,
+	// so create one that forwards everything to this reactor
+	if len(sesPermission.ReceiptRules) == 0 {
+		sesPermission.ReceiptRules = []sparta.ReceiptRule{
+			{
+				Name:      "Default",
+				TLSPolicy: "Optional",
+			},
+		}
+	}
+	if messageBodyBucketLogicalName != "" {
+		messageBodyStorage, messageBodyStorageErr := sesPermission.NewMessageBodyStorageResource(messageBodyBucketLogicalName)
+		if messageBodyStorageErr != nil {
+			return nil, errors.Wrapf(messageBodyStorageErr, "attempting to create SES message body storage")
+		}
+		sesPermission.MessageBodyStorage = messageBodyStorage
+		lambdaFn.RoleDefinition.Privileges = append(lambdaFn.RoleDefinition.Privileges,
+			sparta.IAMRolePrivilege{
+				Actions:  []string{"s3:GetObject"},
+				Resource: messageBodyStorage.BucketArnAllKeys(),
+			})
+		lambdaFn.Options.Environment[EnvVarSESMessageBodyBucket] = messageBodyStorage.BucketName()
+	}
+	lambdaFn.Permissions = append(lambdaFn.Permissions, sesPermission)
+	return lambdaFn, nil
+}
+
+// FetchSESMessageBody returns the raw MIME message body for the given SES
+// record. The message body is read from the bucket defined by the
+// EnvVarSESMessageBodyBucket environment variable. The objectKeyPrefix
+// must match the ReceiptRule BodyStorageOptions.ObjectKeyPrefix value.
+func FetchSESMessageBody(ctx context.Context,
+	awsSession *session.Session,
+	sesRecord awsLambdaEvents.SimpleEmailRecord,
+	objectKeyPrefix string) ([]byte, error) {
+
+	bucketName := os.Getenv(EnvVarSESMessageBodyBucket)
+	if bucketName == "" {
+		return nil, errors.Errorf("SES message body storage is not enabled (%s is empty)",
+			EnvVarSESMessageBodyBucket)
+	}
+	s3Svc := s3.New(awsSession)
+	getObjectResult, getObjectErr := s3Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKeyPrefix + sesRecord.SES.Mail.MessageID),
+	})
+	if getObjectErr != nil {
+		return nil, errors.Wrapf(getObjectErr,
+			"Failed to fetch SES message body: %s",
+			sesRecord.SES.Mail.MessageID)
+	}
+	defer getObjectResult.Body.Close()
+	return ioutil.ReadAll(getObjectResult.Body)
+}
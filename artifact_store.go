@@ -0,0 +1,82 @@
+package sparta
+
+import (
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - ArtifactStore
+//
+
+// ArtifactStore uploads the service artifacts (eg, the Lambda code archive
+// and the CloudFormation template) that the template references. Set
+// WorkflowHooks.ArtifactStore to replace the default S3 upload (eg, to
+// upload via pre-signed URLs, or to a cross-account bucket using an assumed
+// role).
+type ArtifactStore interface {
+	// Upload stores the local file as the keyName object in s3Bucket and
+	// returns the object URL. The URL may include a versionId query
+	// parameter if the bucket has versioning enabled. The progress
+	// function is optional.
+	Upload(localPath string,
+		s3Bucket string,
+		keyName string,
+		progress spartaS3.UploadProgressFunc,
+		logger *logrus.Logger) (string, error)
+	// Delete deletes the object at the URL returned by Upload. It's called
+	// if provisioning fails.
+	Delete(s3Bucket string,
+		artifactURL string,
+		logger *logrus.Logger) error
+}
+
+// S3ArtifactStore is the default ArtifactStore, which uploads the artifacts
+// with the S3 client
+type S3ArtifactStore struct {
+	// S3 is the client used to upload and delete the artifacts
+	S3 s3iface.S3API
+}
+
+// Upload satisfies the ArtifactStore interface
+func (store *S3ArtifactStore) Upload(localPath string,
+	s3Bucket string,
+	keyName string,
+	progress spartaS3.UploadProgressFunc,
+	logger *logrus.Logger) (string, error) {
+	if store.S3 == nil {
+		return "", errors.New("S3ArtifactStore doesn't define an S3 client")
+	}
+	return spartaS3.UploadLocalFileToS3WithClient(localPath,
+		store.S3,
+		s3Bucket,
+		keyName,
+		progress,
+		logger)
+}
+
+// Delete satisfies the ArtifactStore interface
+func (store *S3ArtifactStore) Delete(s3Bucket string,
+	artifactURL string,
+	logger *logrus.Logger) error {
+	if store.S3 == nil {
+		return errors.New("S3ArtifactStore doesn't define an S3 client")
+	}
+	return spartaS3.CreateS3RollbackFuncWithClient(store.S3, s3Bucket, artifactURL)(logger)
+}
+
+// artifactRollbackFunc returns the rollback function that deletes the
+// uploaded artifact
+func artifactRollbackFunc(store ArtifactStore,
+	s3Bucket string,
+	artifactURL string) spartaS3.RollbackFunction {
+	return func(logger *logrus.Logger) error {
+		return store.Delete(s3Bucket, artifactURL, logger)
+	}
+}
+
+//
+// END - ArtifactStore
+////////////////////////////////////////////////////////////////////////////////
@@ -1,3 +1,4 @@
 /*Package apigateway provides a standard serialization format to wrap API Gateway
-responses that translate into specific end-user errors.*/
+responses that translate into specific end-user errors. It also includes
+helpers to send messages to WebSocket API connections.*/
 package apigateway
@@ -1,6 +1,7 @@
 package apigateway
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -106,3 +107,22 @@ func NewResponse(code int, body interface{}, headers ...map[string]string) *Resp
 	}
 	return response
 }
+
+// NewBinaryResponse returns an API Gateway response whose body is the
+// base64 encoded body. The Content-Type header is set to contentType. The
+// API must include contentType in its BinaryMediaTypes and the integration
+// response must use the CONVERT_TO_BINARY ContentHandling to return the
+// decoded bytes to the client.
+func NewBinaryResponse(code int,
+	body []byte,
+	contentType string,
+	headers ...map[string]string) *Response {
+	response := NewResponse(code,
+		base64.StdEncoding.EncodeToString(body),
+		headers...)
+	if response.Headers == nil {
+		response.Headers = make(map[string]string)
+	}
+	response.Headers["Content-Type"] = contentType
+	return response
+}
@@ -0,0 +1,94 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go/service/apigatewaymanagementapi/apigatewaymanagementapiiface"
+	"github.com/pkg/errors"
+)
+
+// EnvVarConnectionsEndpoint is the environment variable that stores the
+// API Gateway Management API endpoint for a WebSocket API. It's published
+// to lambda functions annotated by the sparta.APIV2GatewayDecorator.
+const EnvVarConnectionsEndpoint = "SPARTA_APIV2_CONNECTIONS_ENDPOINT"
+
+// ErrConnectionGone is returned by PostToConnection when the WebSocket
+// client is no longer connected. Stale connections should be removed
+// from any connection store.
+var ErrConnectionGone = errors.New("WebSocket connection is no longer available")
+
+// ConnectionsEndpoint returns the API Gateway Management API endpoint for the
+// WebSocket API that sent the request
+func ConnectionsEndpoint(requestContext events.APIGatewayWebsocketProxyRequestContext) string {
+	return fmt.Sprintf("https://%s/%s",
+		requestContext.DomainName,
+		requestContext.Stage)
+}
+
+// NewConnectionsClient returns an API Gateway Management API client for the
+// WebSocket API endpoint. If endpoint is empty, the value of the
+// EnvVarConnectionsEndpoint environment variable is used.
+func NewConnectionsClient(configProvider client.ConfigProvider,
+	endpoint string) (*apigatewaymanagementapi.ApiGatewayManagementApi, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv(EnvVarConnectionsEndpoint)
+	}
+	if endpoint == "" {
+		return nil, errors.Errorf("WebSocket connections endpoint is undefined. Provide an endpoint or set the %s environment variable",
+			EnvVarConnectionsEndpoint)
+	}
+	return apigatewaymanagementapi.New(configProvider,
+		aws.NewConfig().WithEndpoint(endpoint)), nil
+}
+
+// PostToConnection sends the data to the WebSocket connection. A []byte
+// or string data value is sent as is, all other values are JSON encoded.
+// ErrConnectionGone is returned if the client is no longer connected.
+func PostToConnection(ctx context.Context,
+	connectionsClient apigatewaymanagementapiiface.ApiGatewayManagementApiAPI,
+	connectionID string,
+	data interface{}) error {
+
+	var dataBytes []byte
+	switch typedData := data.(type) {
+	case []byte:
+		dataBytes = typedData
+	case string:
+		dataBytes = []byte(typedData)
+	default:
+		jsonBytes, jsonBytesErr := json.Marshal(data)
+		if jsonBytesErr != nil {
+			return errors.Wrapf(jsonBytesErr, "Failed to marshal data for connection: %s", connectionID)
+		}
+		dataBytes = jsonBytes
+	}
+	_, postErr := connectionsClient.PostToConnectionWithContext(ctx,
+		&apigatewaymanagementapi.PostToConnectionInput{
+			ConnectionId: aws.String(connectionID),
+			Data:         dataBytes,
+		})
+	if awsErr, isAWSErr := postErr.(awserr.Error); isAWSErr &&
+		awsErr.Code() == apigatewaymanagementapi.ErrCodeGoneException {
+		return ErrConnectionGone
+	}
+	return postErr
+}
+
+// DeleteConnection disconnects the WebSocket client
+func DeleteConnection(ctx context.Context,
+	connectionsClient apigatewaymanagementapiiface.ApiGatewayManagementApiAPI,
+	connectionID string) error {
+	_, deleteErr := connectionsClient.DeleteConnectionWithContext(ctx,
+		&apigatewaymanagementapi.DeleteConnectionInput{
+			ConnectionId: aws.String(connectionID),
+		})
+	return deleteErr
+}
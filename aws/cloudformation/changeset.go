@@ -0,0 +1,149 @@
+package cloudformation
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangeSetOptions are the options for the stack operations performed by
+// ConvergeStackStateWithClient and CreateStackChangeSetWithOptions
+type ChangeSetOptions struct {
+	// Parameters are the template parameter values. Set UsePreviousValue to
+	// keep the stack's existing value. UsePreviousValue parameters are
+	// ignored when the stack is created.
+	Parameters []*cloudformation.Parameter
+	// Capabilities replaces the capabilities inferred from the template
+	// (eg, CAPABILITY_IAM) if non-nil
+	Capabilities []string
+	// RetryPolicy is the policy used to back off when CloudFormation
+	// throttles the requests that poll the change set and stack status.
+	// Defaults to spartaAWS.DefaultRetryPolicy().
+	RetryPolicy *spartaAWS.RetryPolicy
+}
+
+// pollingRetryPolicy returns the policy for the status polling requests
+func (options *ChangeSetOptions) pollingRetryPolicy() *spartaAWS.RetryPolicy {
+	if options == nil {
+		return nil
+	}
+	return options.RetryPolicy
+}
+
+// stackCapabilities returns the capabilities for the template
+func (options *ChangeSetOptions) stackCapabilities(template *gocf.Template) []*string {
+	if options == nil || options.Capabilities == nil {
+		return stackCapabilities(template)
+	}
+	return aws.StringSlice(options.Capabilities)
+}
+
+// stackParameters returns the parameters for the change set type
+func (options *ChangeSetOptions) stackParameters(changeSetType string,
+	logger *logrus.Logger) []*cloudformation.Parameter {
+	if options == nil || len(options.Parameters) == 0 {
+		return nil
+	}
+	if changeSetType != cloudformation.ChangeSetTypeCreate {
+		return options.Parameters
+	}
+	parameters := []*cloudformation.Parameter{}
+	for _, eachParameter := range options.Parameters {
+		if aws.BoolValue(eachParameter.UsePreviousValue) {
+			logger.WithField("Parameter", aws.StringValue(eachParameter.ParameterKey)).
+				Warn("Ignoring UsePreviousValue parameter for new stack")
+			continue
+		}
+		parameters = append(parameters, eachParameter)
+	}
+	return parameters
+}
+
+// ParseParameterOverrides returns the parameters for the Key=Value
+// overrides. A Key value without a value uses the stack's existing
+// parameter value.
+func ParseParameterOverrides(overrides []string) ([]*cloudformation.Parameter, error) {
+	parameters := []*cloudformation.Parameter{}
+	for _, eachOverride := range overrides {
+		overrideParts := strings.SplitN(eachOverride, "=", 2)
+		parameterKey := strings.TrimSpace(overrideParts[0])
+		if parameterKey == "" {
+			return nil, errors.Errorf("Invalid parameter override: %s", eachOverride)
+		}
+		parameter := &cloudformation.Parameter{
+			ParameterKey: aws.String(parameterKey),
+		}
+		if len(overrideParts) == 2 {
+			parameter.ParameterValue = aws.String(overrideParts[1])
+		} else {
+			parameter.UsePreviousValue = aws.Bool(true)
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, nil
+}
+
+// describeStackStatus returns the stack status, or an empty string if the
+// stack doesn't exist
+func describeStackStatus(stackName string,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) (string, error) {
+	describeStacksOutput, describeStacksErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if describeStacksErr != nil {
+		if strings.Contains(describeStacksErr.Error(), "does not exist") {
+			return "", nil
+		}
+		return "", describeStacksErr
+	}
+	if len(describeStacksOutput.Stacks) == 0 {
+		return "", nil
+	}
+	stackStatus := aws.StringValue(describeStacksOutput.Stacks[0].StackStatus)
+	logger.WithFields(logrus.Fields{
+		"StackName": stackName,
+		"Status":    stackStatus,
+	}).Debug("Stack status")
+	return stackStatus, nil
+}
+
+// deleteStaleChangeSets deletes the change sets of a stack that's in the
+// REVIEW_IN_PROGRESS state, which are left behind by create operations that
+// didn't execute their change set
+func deleteStaleChangeSets(stackName string,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) error {
+	listInput := &cloudformation.ListChangeSetsInput{
+		StackName: aws.String(stackName),
+	}
+	for {
+		listOutput, listErr := awsCloudFormation.ListChangeSets(listInput)
+		if listErr != nil {
+			return errors.Wrapf(listErr, "Failed to list change sets for stack: %s", stackName)
+		}
+		for _, eachSummary := range listOutput.Summaries {
+			logger.WithFields(logrus.Fields{
+				"StackName":     stackName,
+				"ChangeSetName": aws.StringValue(eachSummary.ChangeSetName),
+				"Status":        aws.StringValue(eachSummary.Status),
+			}).Info("Deleting stale change set")
+			_, deleteErr := DeleteChangeSet(stackName,
+				aws.StringValue(eachSummary.ChangeSetName),
+				awsCloudFormation)
+			if deleteErr != nil {
+				return errors.Wrapf(deleteErr, "Failed to delete stale change set")
+			}
+		}
+		if listOutput.NextToken == nil {
+			return nil
+		}
+		listInput.NextToken = listOutput.NextToken
+	}
+}
@@ -0,0 +1,114 @@
+package cloudformation
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+type mockChangeSetCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	stackStatus string
+	changeSets  []string
+}
+
+func (mockCF *mockChangeSetCloudFormation) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	if mockCF.stackStatus == "" {
+		return nil, awserr.New("ValidationError", "Stack with id MyStack does not exist", nil)
+	}
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackName:   input.StackName,
+				StackStatus: aws.String(mockCF.stackStatus),
+			},
+		},
+	}, nil
+}
+
+func (mockCF *mockChangeSetCloudFormation) ListChangeSets(input *cloudformation.ListChangeSetsInput) (*cloudformation.ListChangeSetsOutput, error) {
+	output := &cloudformation.ListChangeSetsOutput{}
+	for _, eachName := range mockCF.changeSets {
+		output.Summaries = append(output.Summaries, &cloudformation.ChangeSetSummary{
+			ChangeSetName: aws.String(eachName),
+			Status:        aws.String(cloudformation.ChangeSetStatusCreateComplete),
+		})
+	}
+	return output, nil
+}
+
+func (mockCF *mockChangeSetCloudFormation) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	remaining := []string{}
+	for _, eachName := range mockCF.changeSets {
+		if eachName != aws.StringValue(input.ChangeSetName) {
+			remaining = append(remaining, eachName)
+		}
+	}
+	mockCF.changeSets = remaining
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func TestParseParameterOverrides(t *testing.T) {
+	parameters, parametersErr := ParseParameterOverrides([]string{"Stage=prod", "Secret", "Query=a=b"})
+	if parametersErr != nil {
+		t.Fatalf("Failed to parse parameter overrides: %s", parametersErr)
+	}
+	if len(parameters) != 3 ||
+		aws.StringValue(parameters[0].ParameterValue) != "prod" ||
+		!aws.BoolValue(parameters[1].UsePreviousValue) ||
+		aws.StringValue(parameters[2].ParameterValue) != "a=b" {
+		t.Fatalf("Unexpected parameters: %v", parameters)
+	}
+	_, parametersErr = ParseParameterOverrides([]string{"=value"})
+	if parametersErr == nil {
+		t.Fatalf("Failed to reject parameter override without a key")
+	}
+
+	// New stacks can't use previous values
+	logger := logrus.New()
+	options := &ChangeSetOptions{
+		Parameters:   parameters,
+		Capabilities: []string{"CAPABILITY_AUTO_EXPAND"},
+	}
+	if len(options.stackParameters(cloudformation.ChangeSetTypeCreate, logger)) != 2 {
+		t.Fatalf("Failed to ignore UsePreviousValue parameters for create")
+	}
+	if len(options.stackParameters(cloudformation.ChangeSetTypeUpdate, logger)) != 3 {
+		t.Fatalf("Failed to include UsePreviousValue parameters for update")
+	}
+	capabilities := options.stackCapabilities(gocf.NewTemplate())
+	if len(capabilities) != 1 || aws.StringValue(capabilities[0]) != "CAPABILITY_AUTO_EXPAND" {
+		t.Fatalf("Failed to override capabilities: %v", capabilities)
+	}
+	var nilOptions *ChangeSetOptions
+	if nilOptions.stackParameters(cloudformation.ChangeSetTypeUpdate, logger) != nil {
+		t.Fatalf("Unexpected parameters for nil options")
+	}
+}
+
+func TestReviewInProgressChangeSets(t *testing.T) {
+	logger := logrus.New()
+	mockCF := &mockChangeSetCloudFormation{}
+	stackStatus, stackStatusErr := describeStackStatus("MyStack", mockCF, logger)
+	if stackStatusErr != nil || stackStatus != "" {
+		t.Fatalf("Unexpected status for missing stack: %s (%v)", stackStatus, stackStatusErr)
+	}
+	mockCF.stackStatus = cloudformation.StackStatusReviewInProgress
+	mockCF.changeSets = []string{"ChangeSet1", "ChangeSet2"}
+	stackStatus, stackStatusErr = describeStackStatus("MyStack", mockCF, logger)
+	if stackStatusErr != nil || stackStatus != cloudformation.StackStatusReviewInProgress {
+		t.Fatalf("Unexpected stack status: %s (%v)", stackStatus, stackStatusErr)
+	}
+	deleteErr := deleteStaleChangeSets("MyStack", mockCF, logger)
+	if deleteErr != nil {
+		t.Fatalf("Failed to delete stale change sets: %s", deleteErr)
+	}
+	if len(mockCF.changeSets) != 0 {
+		t.Fatalf("Failed to delete stale change sets: %v", mockCF.changeSets)
+	}
+}
@@ -0,0 +1,58 @@
+package cloudformation
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DetectStackDrift starts a drift detection operation for the stack and
+// waits up to timeout for the result. Throttled status requests back off
+// with the retryPolicy. A nil policy uses spartaAWS.DefaultRetryPolicy().
+func DetectStackDrift(stackName string,
+	timeout time.Duration,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	retryPolicy *spartaAWS.RetryPolicy,
+	logger *logrus.Logger) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+
+	detectResponse, detectErr := awsCloudFormation.DetectStackDrift(&cloudformation.DetectStackDriftInput{
+		StackName: aws.String(stackName),
+	})
+	if detectErr != nil {
+		return nil, errors.Wrapf(detectErr, "Failed to detect drift for stack: %s", stackName)
+	}
+	logger.WithField("DetectionID", aws.StringValue(detectResponse.StackDriftDetectionId)).
+		Info("Waiting for stack drift detection to complete")
+
+	startTime := time.Now()
+	poller := newAdaptivePoller(retryPolicy, logger)
+	for {
+		statusResponse, statusErr := awsCloudFormation.DescribeStackDriftDetectionStatus(&cloudformation.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: detectResponse.StackDriftDetectionId,
+		})
+		if !poller.throttled(statusErr) {
+			if statusErr != nil {
+				return nil, statusErr
+			}
+			switch aws.StringValue(statusResponse.DetectionStatus) {
+			case cloudformation.StackDriftDetectionStatusDetectionInProgress:
+				// Keep polling
+			case cloudformation.StackDriftDetectionStatusDetectionFailed:
+				return nil, errors.Errorf("Stack drift detection failed: %s",
+					aws.StringValue(statusResponse.DetectionStatusReason))
+			default:
+				return statusResponse, nil
+			}
+		}
+		if time.Since(startTime) > timeout {
+			return nil, errors.Errorf("Stack drift detection didn't complete within %s",
+				timeout.String())
+		}
+		time.Sleep(poller.delay(cloudformationPollingDelay()))
+	}
+}
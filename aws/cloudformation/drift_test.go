@@ -0,0 +1,100 @@
+package cloudformation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/sirupsen/logrus"
+)
+
+// mockDriftCloudFormation returns the next detection status for each
+// DescribeStackDriftDetectionStatus request. An empty status is a
+// throttled request.
+type mockDriftCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	statuses []string
+	requests int
+}
+
+func (mockCF *mockDriftCloudFormation) DetectStackDrift(input *cloudformation.DetectStackDriftInput) (*cloudformation.DetectStackDriftOutput, error) {
+	return &cloudformation.DetectStackDriftOutput{
+		StackDriftDetectionId: aws.String("detection-id"),
+	}, nil
+}
+
+func (mockCF *mockDriftCloudFormation) DescribeStackDriftDetectionStatus(input *cloudformation.DescribeStackDriftDetectionStatusInput) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	mockCF.requests++
+	status := cloudformation.StackDriftDetectionStatusDetectionInProgress
+	if len(mockCF.statuses) != 0 {
+		status = mockCF.statuses[0]
+		mockCF.statuses = mockCF.statuses[1:]
+	}
+	if status == "" {
+		return nil, awserr.New("Throttling", "Rate exceeded", nil)
+	}
+	return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+		DetectionStatus:           aws.String(status),
+		DetectionStatusReason:     aws.String("reason"),
+		StackDriftStatus:          aws.String(cloudformation.StackDriftStatusDrifted),
+		DriftedStackResourceCount: aws.Int64(1),
+	}, nil
+}
+
+func TestDetectStackDrift(t *testing.T) {
+	defaultPollingDelay := cloudformationPollingDelay
+	cloudformationPollingDelay = func() time.Duration {
+		return time.Millisecond
+	}
+	defer func() {
+		cloudformationPollingDelay = defaultPollingDelay
+	}()
+	logger := logrus.New()
+	retryPolicy := &spartaAWS.RetryPolicy{
+		MaxRetries:       2,
+		MinThrottleDelay: time.Millisecond,
+		MaxThrottleDelay: time.Millisecond,
+	}
+
+	// Throttled status requests are retried
+	mockCF := &mockDriftCloudFormation{
+		statuses: []string{cloudformation.StackDriftDetectionStatusDetectionInProgress,
+			"",
+			cloudformation.StackDriftDetectionStatusDetectionComplete},
+	}
+	driftStatus, driftErr := DetectStackDrift("MyStack", time.Minute, mockCF, retryPolicy, logger)
+	if driftErr != nil {
+		t.Fatalf("Failed to detect stack drift: %s", driftErr)
+	}
+	if aws.StringValue(driftStatus.StackDriftStatus) != cloudformation.StackDriftStatusDrifted ||
+		mockCF.requests != 3 {
+		t.Fatalf("Unexpected drift detection result: %#v (%d requests)", driftStatus, mockCF.requests)
+	}
+
+	// Failed detections and exhausted retries return an error
+	failedCF := &mockDriftCloudFormation{
+		statuses: []string{cloudformation.StackDriftDetectionStatusDetectionFailed},
+	}
+	_, driftErr = DetectStackDrift("MyStack", time.Minute, failedCF, retryPolicy, logger)
+	if driftErr == nil {
+		t.Fatalf("Failed to report failed drift detection")
+	}
+	throttledCF := &mockDriftCloudFormation{
+		statuses: []string{"", "", ""},
+	}
+	_, driftErr = DetectStackDrift("MyStack", time.Minute, throttledCF, retryPolicy, logger)
+	if driftErr == nil || throttledCF.requests != 3 {
+		t.Fatalf("Failed to report throttled drift detection: %v", driftErr)
+	}
+
+	// Detections that don't complete time out
+	inProgressCF := &mockDriftCloudFormation{}
+	_, driftErr = DetectStackDrift("MyStack", 10*time.Millisecond, inProgressCF, retryPolicy, logger)
+	if driftErr == nil {
+		t.Fatalf("Failed to time out drift detection")
+	}
+}
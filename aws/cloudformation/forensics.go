@@ -0,0 +1,311 @@
+package cloudformation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/sirupsen/logrus"
+)
+
+// maximum depth of nested stacks that are searched for the root cause
+const maxNestedStackForensicsDepth = 5
+
+// Reasons that are reported when a resource fails because another
+// resource failed
+var cascadingFailureReasons = []string{
+	"cancelled",
+	"The following resource(s) failed to",
+	"Embedded stack",
+}
+
+// stackFailureHint associates a hint with failure reasons that match the
+// pattern. The first submatch, if any, replaces the %s verb in the hint.
+type stackFailureHint struct {
+	pattern *regexp.Regexp
+	hint    string
+}
+
+var stackFailureHints = []stackFailureHint{
+	{regexp.MustCompile(`Encountered unsupported property (\S+)`),
+		"Remove or rename the unsupported %s property"},
+	{regexp.MustCompile(`Value of property \{?/?([^}\s]+)\}?`),
+		"Check the value of the %s property"},
+	{regexp.MustCompile(`(?i)already exists`),
+		"A resource with the same name exists outside the stack. Remove the explicit name so that CloudFormation generates one, or delete the existing resource."},
+	{regexp.MustCompile(`(?i)not authorized to perform:? (\S+)`),
+		"The provisioning credentials require the %s permission"},
+	{regexp.MustCompile(`(?i)AccessDenied|Access Denied`),
+		"The provisioning credentials or the resource's IAM role don't have access to the resource"},
+	{regexp.MustCompile(`(?i)cannot be assumed by Lambda`),
+		"The IAM role may not have propagated yet. Retry the provision operation."},
+	{regexp.MustCompile(`(?i)NoSuchKey|NoSuchBucket`),
+		"The S3 artifact doesn't exist. Verify the S3 bucket region and lifecycle policy."},
+	{regexp.MustCompile(`(?i)limit exceeded|LimitExceeded|quota`),
+		"A service quota was exceeded. Request a quota increase or remove unused resources."},
+	{regexp.MustCompile(`(?i)Rate exceeded|Throttling`),
+		"The request was throttled. Retry the provision operation or increase --maxRetries."},
+}
+
+// StackFailure is a resource failure reported by a stack operation
+type StackFailure struct {
+	// StackName is the name of the stack that reported the failure. It's the
+	// nested stack name for failures in nested stacks.
+	StackName string
+	// LogicalResourceID is the logical ID of the failed resource
+	LogicalResourceID string
+	// ResourceType is the CloudFormation type of the failed resource
+	ResourceType string
+	// ResourceStatus is the failed status (eg, CREATE_FAILED)
+	ResourceStatus string
+	// Reason is the CloudFormation status reason
+	Reason string
+	// Timestamp is the time of the failure event
+	Timestamp time.Time
+	// Hints are the suggested fixes for the failure
+	Hints []string
+	// DocumentationURL is the CloudFormation documentation for the resource type
+	DocumentationURL string
+}
+
+// String returns the failure summary
+func (failure *StackFailure) String() string {
+	return fmt.Sprintf("%s (%s): %s",
+		failure.LogicalResourceID,
+		failure.ResourceType,
+		failure.Reason)
+}
+
+// StackOperationError is the error returned when a stack operation fails.
+// RootCause is the first failure that wasn't caused by another failure.
+type StackOperationError struct {
+	StackName   string
+	StackStatus string
+	RootCause   *StackFailure
+	// Failures are all the non-cascading failures in the order they occurred,
+	// including the RootCause
+	Failures []*StackFailure
+}
+
+// Error satisfies the error interface
+func (stackErr *StackOperationError) Error() string {
+	if stackErr.RootCause == nil {
+		return fmt.Sprintf("failed to provision: %s (%s)",
+			stackErr.StackName,
+			stackErr.StackStatus)
+	}
+	return fmt.Sprintf("failed to provision: %s (%s). Root cause: %s",
+		stackErr.StackName,
+		stackErr.StackStatus,
+		stackErr.RootCause.String())
+}
+
+// Log writes the root cause, hints and the other failures to the logger
+func (stackErr *StackOperationError) Log(logger *logrus.Logger) {
+	logger.WithFields(logrus.Fields{
+		"StackName": stackErr.StackName,
+		"Status":    stackErr.StackStatus,
+	}).Error("Stack provisioning error")
+	if stackErr.RootCause == nil {
+		logger.Error("The stack events don't include a resource failure")
+		return
+	}
+	rootCause := stackErr.RootCause
+	logger.WithFields(logrus.Fields{
+		"Resource": rootCause.LogicalResourceID,
+		"Type":     rootCause.ResourceType,
+		"Stack":    rootCause.StackName,
+		"Status":   rootCause.ResourceStatus,
+	}).Error(fmt.Sprintf("Root cause: %s", rootCause.Reason))
+	for _, eachHint := range rootCause.Hints {
+		logger.Error(fmt.Sprintf("    Hint: %s", eachHint))
+	}
+	if rootCause.DocumentationURL != "" {
+		logger.Error(fmt.Sprintf("    Docs: %s", rootCause.DocumentationURL))
+	}
+	for _, eachFailure := range stackErr.Failures {
+		if eachFailure != rootCause {
+			logger.Error(fmt.Sprintf("\tError ensuring %s", eachFailure.String()))
+		}
+	}
+}
+
+// isCascadingFailure returns true if the reason indicates that the resource
+// failed because another resource failed
+func isCascadingFailure(reason string) bool {
+	for _, eachReason := range cascadingFailureReasons {
+		if strings.Contains(reason, eachReason) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFailedResourceStatus returns true for the failed resource statuses
+func isFailedResourceStatus(resourceStatus string) bool {
+	switch resourceStatus {
+	case cloudformation.ResourceStatusCreateFailed,
+		cloudformation.ResourceStatusDeleteFailed,
+		cloudformation.ResourceStatusUpdateFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// resourceTypeDocumentationURL returns the CloudFormation documentation URL
+// for the resource type
+func resourceTypeDocumentationURL(resourceType string) string {
+	if strings.HasPrefix(resourceType, "Custom::") {
+		resourceType = "AWS::CloudFormation::CustomResource"
+	}
+	typeParts := strings.Split(resourceType, "::")
+	if len(typeParts) != 3 || typeParts[0] != "AWS" {
+		return ""
+	}
+	return fmt.Sprintf("https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-%s-%s.html",
+		strings.ToLower(typeParts[1]),
+		strings.ToLower(typeParts[2]))
+}
+
+// stackFailureHintsForReason returns the hints that match the reason
+func stackFailureHintsForReason(reason string) []string {
+	hints := []string{}
+	for _, eachHint := range stackFailureHints {
+		matches := eachHint.pattern.FindStringSubmatch(reason)
+		if matches == nil {
+			continue
+		}
+		if strings.Contains(eachHint.hint, "%s") {
+			if len(matches) < 2 {
+				continue
+			}
+			hints = append(hints, fmt.Sprintf(eachHint.hint, strings.Trim(matches[1], "{}/,.")))
+		} else {
+			hints = append(hints, eachHint.hint)
+		}
+	}
+	return hints
+}
+
+// newStackFailure returns the StackFailure for the event
+func newStackFailure(stackName string, event *cloudformation.StackEvent) *StackFailure {
+	resourceType := aws.StringValue(event.ResourceType)
+	reason := aws.StringValue(event.ResourceStatusReason)
+	return &StackFailure{
+		StackName:         stackName,
+		LogicalResourceID: aws.StringValue(event.LogicalResourceId),
+		ResourceType:      resourceType,
+		ResourceStatus:    aws.StringValue(event.ResourceStatus),
+		Reason:            reason,
+		Timestamp:         aws.TimeValue(event.Timestamp),
+		Hints:             stackFailureHintsForReason(reason),
+		DocumentationURL:  resourceTypeDocumentationURL(resourceType),
+	}
+}
+
+// stackEventFailures returns the failed nested stack resource events and
+// the non-cascading resource failures, in the order they occurred
+func stackEventFailures(stackName string,
+	events []*cloudformation.StackEvent) ([]*cloudformation.StackEvent, []*StackFailure) {
+	sortedEvents := make([]*cloudformation.StackEvent, len(events))
+	copy(sortedEvents, events)
+	sort.SliceStable(sortedEvents, func(i, j int) bool {
+		return aws.TimeValue(sortedEvents[i].Timestamp).Before(aws.TimeValue(sortedEvents[j].Timestamp))
+	})
+	nestedStackEvents := []*cloudformation.StackEvent{}
+	failures := []*StackFailure{}
+	for _, eachEvent := range sortedEvents {
+		if !isFailedResourceStatus(aws.StringValue(eachEvent.ResourceStatus)) {
+			continue
+		}
+		// Events for the stack itself summarize the resource failures
+		if aws.StringValue(eachEvent.PhysicalResourceId) == aws.StringValue(eachEvent.StackId) {
+			continue
+		}
+		if aws.StringValue(eachEvent.ResourceType) == "AWS::CloudFormation::Stack" &&
+			aws.StringValue(eachEvent.PhysicalResourceId) != "" {
+			nestedStackEvents = append(nestedStackEvents, eachEvent)
+		}
+		if !isCascadingFailure(aws.StringValue(eachEvent.ResourceStatusReason)) {
+			failures = append(failures, newStackFailure(stackName, eachEvent))
+		}
+	}
+	return nestedStackEvents, failures
+}
+
+// collectStackFailures returns the failures for the stack and the nested
+// stacks that failed
+func collectStackFailures(stackID string,
+	startTime time.Time,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	depth int,
+	logger *logrus.Logger) ([]*StackFailure, error) {
+
+	events, eventsErr := StackEventsWithClient(stackID, startTime, awsCloudFormation)
+	if eventsErr != nil {
+		return nil, eventsErr
+	}
+	stackName := stackID
+	if len(events) != 0 {
+		stackName = aws.StringValue(events[0].StackName)
+	}
+	nestedStackEvents, failures := stackEventFailures(stackName, events)
+	if depth >= maxNestedStackForensicsDepth {
+		return failures, nil
+	}
+	for _, eachNestedStackEvent := range nestedStackEvents {
+		nestedFailures, nestedFailuresErr := collectStackFailures(aws.StringValue(eachNestedStackEvent.PhysicalResourceId),
+			startTime,
+			awsCloudFormation,
+			depth+1,
+			logger)
+		if nestedFailuresErr != nil {
+			logger.WithFields(logrus.Fields{
+				"NestedStack": aws.StringValue(eachNestedStackEvent.LogicalResourceId),
+				"Error":       nestedFailuresErr,
+			}).Warn("Failed to read nested stack events")
+			continue
+		}
+		failures = append(failures, nestedFailures...)
+	}
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Timestamp.Before(failures[j].Timestamp)
+	})
+	return failures, nil
+}
+
+// DiagnoseStackFailure walks the stack and nested stack events since
+// startTime and returns the StackOperationError for the failed operation.
+// The root cause is the first failure that wasn't caused by another
+// failure.
+func DiagnoseStackFailure(stackID string,
+	stackStatus string,
+	startTime time.Time,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) *StackOperationError {
+
+	stackErr := &StackOperationError{
+		StackName:   stackID,
+		StackStatus: stackStatus,
+	}
+	failures, failuresErr := collectStackFailures(stackID,
+		startTime,
+		awsCloudFormation,
+		0,
+		logger)
+	if failuresErr != nil {
+		logger.WithField("Error", failuresErr).Warn("Failed to read stack events")
+		return stackErr
+	}
+	stackErr.Failures = failures
+	if len(failures) != 0 {
+		stackErr.RootCause = failures[0]
+	}
+	return stackErr
+}
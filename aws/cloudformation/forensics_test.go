@@ -0,0 +1,98 @@
+package cloudformation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/sirupsen/logrus"
+)
+
+type mockEventsCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	stackEvents map[string][]*cloudformation.StackEvent
+}
+
+func (mockCF *mockEventsCloudFormation) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	return &cloudformation.DescribeStackEventsOutput{
+		StackEvents: mockCF.stackEvents[aws.StringValue(input.StackName)],
+	}, nil
+}
+
+func mockStackEvent(stackID string,
+	logicalID string,
+	physicalID string,
+	resourceType string,
+	status string,
+	reason string,
+	timestamp time.Time) *cloudformation.StackEvent {
+	return &cloudformation.StackEvent{
+		StackId:              aws.String(stackID),
+		StackName:            aws.String(stackID),
+		LogicalResourceId:    aws.String(logicalID),
+		PhysicalResourceId:   aws.String(physicalID),
+		ResourceType:         aws.String(resourceType),
+		ResourceStatus:       aws.String(status),
+		ResourceStatusReason: aws.String(reason),
+		Timestamp:            aws.Time(timestamp),
+	}
+}
+
+func TestDiagnoseStackFailure(t *testing.T) {
+	startTime := time.Now()
+	at := func(seconds int) time.Time {
+		return startTime.Add(time.Duration(seconds) * time.Second)
+	}
+	// Events are returned newest first
+	mockCF := &mockEventsCloudFormation{
+		stackEvents: map[string][]*cloudformation.StackEvent{
+			"MyStack": {
+				mockStackEvent("MyStack", "MyStack", "MyStack", "AWS::CloudFormation::Stack",
+					cloudformation.ResourceStatusCreateFailed,
+					"The following resource(s) failed to create: [Nested, Queue]", at(5)),
+				mockStackEvent("MyStack", "Queue", "", "AWS::SQS::Queue",
+					cloudformation.ResourceStatusCreateFailed,
+					"Resource creation cancelled", at(4)),
+				mockStackEvent("MyStack", "Nested", "NestedStack", "AWS::CloudFormation::Stack",
+					cloudformation.ResourceStatusCreateFailed,
+					"Embedded stack NestedStack was not successfully created", at(3)),
+				mockStackEvent("MyStack", "Function", "", "AWS::Lambda::Function",
+					cloudformation.ResourceStatusCreateFailed,
+					"Properties validation failed for resource Function with message: Encountered unsupported property Timeot", at(2)),
+			},
+			"NestedStack": {
+				mockStackEvent("NestedStack", "Table", "", "AWS::DynamoDB::Table",
+					cloudformation.ResourceStatusCreateFailed,
+					"MyTable already exists", at(1)),
+			},
+		},
+	}
+	stackErr := DiagnoseStackFailure("MyStack",
+		cloudformation.StackStatusRollbackComplete,
+		startTime,
+		mockCF,
+		logrus.New())
+	if len(stackErr.Failures) != 2 {
+		t.Fatalf("Unexpected failures: %v", stackErr.Failures)
+	}
+	rootCause := stackErr.RootCause
+	if rootCause == nil ||
+		rootCause.LogicalResourceID != "Table" ||
+		rootCause.StackName != "NestedStack" {
+		t.Fatalf("Unexpected root cause: %v", rootCause)
+	}
+	if len(rootCause.Hints) != 1 ||
+		rootCause.DocumentationURL != "https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-dynamodb-table.html" {
+		t.Fatalf("Unexpected root cause hints: %v (%s)", rootCause.Hints, rootCause.DocumentationURL)
+	}
+	if !strings.Contains(stackErr.Error(), "Table (AWS::DynamoDB::Table)") {
+		t.Fatalf("Root cause isn't included in error: %s", stackErr.Error())
+	}
+	functionHints := stackErr.Failures[1].Hints
+	if len(functionHints) != 1 || !strings.Contains(functionHints[0], "Timeot") {
+		t.Fatalf("Unexpected property hints: %v", functionHints)
+	}
+}
@@ -113,3 +113,78 @@ var APIGatewayMapping = &gocf.Mapping{
 		HostedZoneID: "ZCMLWB8V5SYIT",
 	},
 }
+
+// LayerArn property
+const LayerArn = "layerArn"
+
+// LambdaInsightsMapping is the mapping for the x86_64 Lambda Insights
+// extension (1.0.143.0) layer in each region. See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/Lambda-Insights-extension-versionsx86-64.html
+var LambdaInsightsMapping = &gocf.Mapping{
+	"us-east-1": map[string]string{
+		LayerArn: "arn:aws:lambda:us-east-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"us-east-2": map[string]string{
+		LayerArn: "arn:aws:lambda:us-east-2:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"us-west-1": map[string]string{
+		LayerArn: "arn:aws:lambda:us-west-1:580247275435:layer:LambdaInsightsExtension:20",
+	},
+	"us-west-2": map[string]string{
+		LayerArn: "arn:aws:lambda:us-west-2:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"af-south-1": map[string]string{
+		LayerArn: "arn:aws:lambda:af-south-1:012438385374:layer:LambdaInsightsExtension:13",
+	},
+	"ap-east-1": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-east-1:519774774795:layer:LambdaInsightsExtension:13",
+	},
+	"ap-south-1": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-south-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"ap-northeast-1": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-northeast-1:580247275435:layer:LambdaInsightsExtension:31",
+	},
+	"ap-northeast-2": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-northeast-2:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"ap-southeast-1": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-southeast-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"ap-southeast-2": map[string]string{
+		LayerArn: "arn:aws:lambda:ap-southeast-2:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"ca-central-1": map[string]string{
+		LayerArn: "arn:aws:lambda:ca-central-1:580247275435:layer:LambdaInsightsExtension:20",
+	},
+	"eu-central-1": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-central-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"eu-west-1": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-west-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"eu-west-2": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-west-2:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"eu-west-3": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-west-3:580247275435:layer:LambdaInsightsExtension:20",
+	},
+	"eu-south-1": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-south-1:339249233099:layer:LambdaInsightsExtension:13",
+	},
+	"eu-north-1": map[string]string{
+		LayerArn: "arn:aws:lambda:eu-north-1:580247275435:layer:LambdaInsightsExtension:20",
+	},
+	"me-south-1": map[string]string{
+		LayerArn: "arn:aws:lambda:me-south-1:285320876703:layer:LambdaInsightsExtension:13",
+	},
+	"sa-east-1": map[string]string{
+		LayerArn: "arn:aws:lambda:sa-east-1:580247275435:layer:LambdaInsightsExtension:21",
+	},
+	"cn-north-1": map[string]string{
+		LayerArn: "arn:aws-cn:lambda:cn-north-1:488211338238:layer:LambdaInsightsExtension:14",
+	},
+	"cn-northwest-1": map[string]string{
+		LayerArn: "arn:aws-cn:lambda:cn-northwest-1:488211338238:layer:LambdaInsightsExtension:14",
+	},
+}
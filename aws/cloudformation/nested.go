@@ -0,0 +1,393 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Nested stacks
+//
+
+// NestedStackGroupFunc returns the name of the nested stack that should
+// include the resource. Resources with an empty group name remain in the
+// parent stack.
+type NestedStackGroupFunc func(logicalResourceName string, resource *gocf.Resource) string
+
+// NestedStackTemplateURLFunc publishes the nested stack template and
+// returns the URL to use for the AWS::CloudFormation::Stack TemplateURL
+type NestedStackTemplateURLFunc func(stackResourceName string,
+	template *gocf.Template) (string, error)
+
+// NestedStackGroupByAPI groups API Gateway resources into an "API"
+// nested stack
+func NestedStackGroupByAPI(logicalResourceName string, resource *gocf.Resource) string {
+	resourceType := resource.Properties.CfnResourceType()
+	if strings.HasPrefix(resourceType, "AWS::ApiGateway::") ||
+		strings.HasPrefix(resourceType, "AWS::ApiGatewayV2::") {
+		return "API"
+	}
+	return ""
+}
+
+// NestedStackGroupByEventSource groups the resources that connect event
+// sources to lambda functions into an "EventSources" nested stack
+func NestedStackGroupByEventSource(logicalResourceName string, resource *gocf.Resource) string {
+	switch resource.Properties.CfnResourceType() {
+	case "AWS::Lambda::Permission",
+		"AWS::Lambda::EventSourceMapping",
+		"AWS::Events::Rule",
+		"AWS::Logs::SubscriptionFilter",
+		"AWS::SNS::Subscription",
+		"AWS::Scheduler::Schedule":
+		return "EventSources"
+	}
+	return ""
+}
+
+// NestedStackGroups returns a NestedStackGroupFunc that returns the first
+// non-empty group name from the groupFuncs
+func NestedStackGroups(groupFuncs ...NestedStackGroupFunc) NestedStackGroupFunc {
+	return func(logicalResourceName string, resource *gocf.Resource) string {
+		for _, eachGroupFunc := range groupFuncs {
+			if groupName := eachGroupFunc(logicalResourceName, resource); groupName != "" {
+				return groupName
+			}
+		}
+		return ""
+	}
+}
+
+// Pseudo parameters that refer to the parent stack, rather than the nested
+// stack, and the nested stack parameters that provide their values
+var parentStackPseudoParameters = map[string]string{
+	"AWS::StackName": "ParentStackName",
+	"AWS::StackId":   "ParentStackId",
+}
+
+// rawResourceProperties is a resource whose properties have been rewritten
+// as generic JSON values
+type rawResourceProperties struct {
+	resourceType string
+	properties   interface{}
+}
+
+func (raw rawResourceProperties) CfnResourceType() string {
+	return raw.resourceType
+}
+
+func (raw rawResourceProperties) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+func (raw rawResourceProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(raw.properties)
+}
+
+// nestedStack is an AWS::CloudFormation::Stack resource that also tracks
+// the capabilities its template requires
+type nestedStack struct {
+	gocf.CloudFormationStack
+	capabilities []*string
+}
+
+// nestedStackSplitter tracks the state of a SplitNestedStacks operation
+type nestedStackSplitter struct {
+	parent *gocf.Template
+	// Resource name to group name
+	resourceGroups map[string]string
+	// Group name to nested stack template
+	templates map[string]*gocf.Template
+	// Group name to the parent values of the nested stack parameters
+	parameters map[string]map[string]interface{}
+}
+
+func (splitter *nestedStackSplitter) stackResourceName(groupName string) string {
+	return "NestedStack" + reCloudFormationInvalidChars.ReplaceAllString(groupName, "")
+}
+
+// crossStackReference returns the value that ownerGroup uses to reference
+// the targetGroup resource. The attribute name is empty for Ref values.
+func (splitter *nestedStackSplitter) crossStackReference(ownerGroup string,
+	targetGroup string,
+	resourceName string,
+	attributeName string) interface{} {
+
+	var value interface{} = map[string]interface{}{"Ref": resourceName}
+	if attributeName != "" {
+		value = map[string]interface{}{"Fn::GetAtt": []interface{}{resourceName, attributeName}}
+	}
+	referenceName := reCloudFormationInvalidChars.ReplaceAllString(resourceName+attributeName, "")
+	// Export the value from the nested stack
+	if targetGroup != "" {
+		splitter.templates[targetGroup].Outputs[referenceName] = &gocf.Output{
+			Value: value,
+		}
+		value = map[string]interface{}{
+			"Fn::GetAtt": []interface{}{splitter.stackResourceName(targetGroup),
+				"Outputs." + referenceName},
+		}
+	}
+	if ownerGroup == "" {
+		return value
+	}
+	// And import it into the owner
+	splitter.templates[ownerGroup].Parameters[referenceName] = &gocf.Parameter{
+		Type: "String",
+	}
+	splitter.parameters[ownerGroup][referenceName] = value
+	return map[string]interface{}{"Ref": referenceName}
+}
+
+// rewrite replaces the references in the value to resources in other
+// groups with cross stack references
+func (splitter *nestedStackSplitter) rewrite(value interface{}, ownerGroup string) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case []interface{}:
+		rewritten := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			rewrittenValue, rewrittenValueErr := splitter.rewrite(eachValue, ownerGroup)
+			if rewrittenValueErr != nil {
+				return nil, rewrittenValueErr
+			}
+			rewritten[eachIndex] = rewrittenValue
+		}
+		return rewritten, nil
+	case map[string]interface{}:
+		if len(typedValue) == 1 {
+			if refName, refNameOk := typedValue["Ref"].(string); refNameOk {
+				targetGroup, targetExists := splitter.resourceGroups[refName]
+				if targetExists && targetGroup != ownerGroup {
+					return splitter.crossStackReference(ownerGroup, targetGroup, refName, ""), nil
+				}
+				// Nested stacks reference the parent stack identity
+				if parentRef, parentRefOk := parentStackPseudoParameters[refName]; parentRefOk && ownerGroup != "" {
+					splitter.templates[ownerGroup].Parameters[parentRef] = &gocf.Parameter{
+						Type: "String",
+					}
+					splitter.parameters[ownerGroup][parentRef] = typedValue
+					return map[string]interface{}{"Ref": parentRef}, nil
+				}
+				// Parent parameters are passed to the nested stack
+				if parameter, parameterExists := splitter.parent.Parameters[refName]; parameterExists && ownerGroup != "" {
+					splitter.templates[ownerGroup].Parameters[refName] = parameter
+					splitter.parameters[ownerGroup][refName] = map[string]interface{}{"Ref": refName}
+				}
+				return typedValue, nil
+			}
+			if getAtt, getAttOk := typedValue["Fn::GetAtt"]; getAttOk {
+				var getAttParts []string
+				switch typedGetAtt := getAtt.(type) {
+				case string:
+					getAttParts = strings.SplitN(typedGetAtt, ".", 2)
+				case []interface{}:
+					for _, eachPart := range typedGetAtt {
+						partString, _ := eachPart.(string)
+						getAttParts = append(getAttParts, partString)
+					}
+				}
+				if len(getAttParts) == 2 {
+					targetGroup, targetExists := splitter.resourceGroups[getAttParts[0]]
+					if targetExists && targetGroup != ownerGroup {
+						return splitter.crossStackReference(ownerGroup,
+							targetGroup,
+							getAttParts[0],
+							getAttParts[1]), nil
+					}
+				}
+				return typedValue, nil
+			}
+			if sub, subOk := typedValue["Fn::Sub"]; subOk {
+				subJSON, _ := json.Marshal(sub)
+				for eachResourceName, eachGroup := range splitter.resourceGroups {
+					if eachGroup != ownerGroup &&
+						(strings.Contains(string(subJSON), "${"+eachResourceName+"}") ||
+							strings.Contains(string(subJSON), "${"+eachResourceName+".")) {
+						return nil, errors.Errorf("Fn::Sub references to resources in other nested stacks are not supported: %s",
+							eachResourceName)
+					}
+				}
+				return typedValue, nil
+			}
+		}
+		rewritten := make(map[string]interface{})
+		for eachKey, eachValue := range typedValue {
+			rewrittenValue, rewrittenValueErr := splitter.rewrite(eachValue, ownerGroup)
+			if rewrittenValueErr != nil {
+				return nil, rewrittenValueErr
+			}
+			rewritten[eachKey] = rewrittenValue
+		}
+		return rewritten, nil
+	}
+	return value, nil
+}
+
+// rewriteValue returns the value with cross stack references as generic
+// JSON values, and whether any references were rewritten
+func (splitter *nestedStackSplitter) rewriteValue(value interface{},
+	ownerGroup string) (interface{}, bool, error) {
+	valueJSON, valueJSONErr := json.Marshal(value)
+	if valueJSONErr != nil {
+		return nil, false, errors.Wrapf(valueJSONErr, "Failed to marshal value")
+	}
+	var genericValue interface{}
+	unmarshalErr := json.Unmarshal(valueJSON, &genericValue)
+	if unmarshalErr != nil {
+		return nil, false, errors.Wrapf(unmarshalErr, "Failed to unmarshal value")
+	}
+	rewritten, rewrittenErr := splitter.rewrite(genericValue, ownerGroup)
+	if rewrittenErr != nil {
+		return nil, false, rewrittenErr
+	}
+	rewrittenJSON, rewrittenJSONErr := json.Marshal(rewritten)
+	if rewrittenJSONErr != nil {
+		return nil, false, errors.Wrapf(rewrittenJSONErr, "Failed to marshal value")
+	}
+	// Preserve the typed value if nothing changed
+	if string(rewrittenJSON) == string(valueJSON) {
+		return value, false, nil
+	}
+	return rewritten, true, nil
+}
+
+// SplitNestedStacks moves the template resources into nested
+// AWS::CloudFormation::Stack resources according to the groupFunc. References
+// between stacks are converted to nested stack Outputs and Parameters and
+// DependsOn values are converted to dependencies on the nested stack. The
+// templateURLFunc publishes each nested stack template. Resources that
+// define a Condition remain in the parent stack.
+func SplitNestedStacks(template *gocf.Template,
+	groupFunc NestedStackGroupFunc,
+	templateURLFunc NestedStackTemplateURLFunc) error {
+
+	splitter := &nestedStackSplitter{
+		parent:         template,
+		resourceGroups: make(map[string]string),
+		templates:      make(map[string]*gocf.Template),
+		parameters:     make(map[string]map[string]interface{}),
+	}
+	resourceNames := make([]string, 0)
+	for eachResourceName := range template.Resources {
+		resourceNames = append(resourceNames, eachResourceName)
+	}
+	sort.Strings(resourceNames)
+
+	// Assign the groups
+	for _, eachResourceName := range resourceNames {
+		eachResource := template.Resources[eachResourceName]
+		groupName := ""
+		if eachResource.Condition == "" {
+			groupName = groupFunc(eachResourceName, eachResource)
+		}
+		splitter.resourceGroups[eachResourceName] = groupName
+		if groupName == "" || splitter.templates[groupName] != nil {
+			continue
+		}
+		stackResourceName := splitter.stackResourceName(groupName)
+		if _, exists := template.Resources[stackResourceName]; exists {
+			return errors.Errorf("Nested stack %s conflicts with an existing resource", stackResourceName)
+		}
+		nestedTemplate := gocf.NewTemplate()
+		nestedTemplate.Description = fmt.Sprintf("%s (%s)", template.Description, groupName)
+		nestedTemplate.Mappings = template.Mappings
+		splitter.templates[groupName] = nestedTemplate
+		splitter.parameters[groupName] = make(map[string]interface{})
+	}
+	if len(splitter.templates) == 0 {
+		return nil
+	}
+
+	// Rewrite the references and move the resources
+	stackDependencies := make(map[string]map[string]bool)
+	for eachGroupName := range splitter.templates {
+		stackDependencies[eachGroupName] = make(map[string]bool)
+	}
+	for _, eachResourceName := range resourceNames {
+		eachResource := template.Resources[eachResourceName]
+		ownerGroup := splitter.resourceGroups[eachResourceName]
+		rewrittenProperties, rewritten, rewrittenErr := splitter.rewriteValue(eachResource.Properties, ownerGroup)
+		if rewrittenErr != nil {
+			return errors.Wrapf(rewrittenErr, "Failed to split resource: %s", eachResourceName)
+		}
+		if rewritten {
+			eachResource.Properties = rawResourceProperties{
+				resourceType: eachResource.Properties.CfnResourceType(),
+				properties:   rewrittenProperties,
+			}
+		}
+
+		dependsOn := []string{}
+		for _, eachDependency := range eachResource.DependsOn {
+			dependencyGroup := splitter.resourceGroups[eachDependency]
+			switch {
+			case dependencyGroup == ownerGroup:
+				dependsOn = append(dependsOn, eachDependency)
+			case ownerGroup == "":
+				dependsOn = append(dependsOn, splitter.stackResourceName(dependencyGroup))
+			case dependencyGroup == "":
+				stackDependencies[ownerGroup][eachDependency] = true
+			default:
+				stackDependencies[ownerGroup][splitter.stackResourceName(dependencyGroup)] = true
+			}
+		}
+		eachResource.DependsOn = nil
+		dependsOnSet := make(map[string]bool)
+		for _, eachDependency := range dependsOn {
+			if !dependsOnSet[eachDependency] {
+				dependsOnSet[eachDependency] = true
+				eachResource.DependsOn = append(eachResource.DependsOn, eachDependency)
+			}
+		}
+		if ownerGroup != "" {
+			splitter.templates[ownerGroup].Resources[eachResourceName] = eachResource
+			delete(template.Resources, eachResourceName)
+		}
+	}
+	for eachOutputName, eachOutput := range template.Outputs {
+		rewrittenValue, _, rewrittenErr := splitter.rewriteValue(eachOutput.Value, "")
+		if rewrittenErr != nil {
+			return errors.Wrapf(rewrittenErr, "Failed to split output: %s", eachOutputName)
+		}
+		eachOutput.Value = rewrittenValue
+	}
+
+	// Publish the nested stacks
+	groupNames := make([]string, 0)
+	for eachGroupName := range splitter.templates {
+		groupNames = append(groupNames, eachGroupName)
+	}
+	sort.Strings(groupNames)
+	for _, eachGroupName := range groupNames {
+		stackResourceName := splitter.stackResourceName(eachGroupName)
+		nestedTemplate := splitter.templates[eachGroupName]
+		templateURL, templateURLErr := templateURLFunc(stackResourceName, nestedTemplate)
+		if templateURLErr != nil {
+			return errors.Wrapf(templateURLErr, "Failed to publish nested stack: %s", stackResourceName)
+		}
+		stackResource := nestedStack{
+			CloudFormationStack: gocf.CloudFormationStack{
+				TemplateURL: gocf.String(templateURL),
+			},
+			capabilities: stackCapabilities(nestedTemplate),
+		}
+		if len(splitter.parameters[eachGroupName]) != 0 {
+			stackResource.Parameters = splitter.parameters[eachGroupName]
+		}
+		cfResource := template.AddResource(stackResourceName, stackResource)
+		for eachDependency := range stackDependencies[eachGroupName] {
+			cfResource.DependsOn = append(cfResource.DependsOn, eachDependency)
+		}
+		sort.Strings(cfResource.DependsOn)
+	}
+	return nil
+}
+
+//
+// END - Nested stacks
+////////////////////////////////////////////////////////////////////////////////
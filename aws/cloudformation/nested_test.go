@@ -0,0 +1,96 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestSplitNestedStacks(t *testing.T) {
+	template := gocf.NewTemplate()
+	template.AddResource("MyRole", gocf.IAMRole{
+		RoleName: gocf.String("MyRoleName"),
+	})
+	template.AddResource("MyLambda", &gocf.LambdaFunction{
+		Role: gocf.GetAtt("MyRole", "Arn"),
+	})
+	template.AddResource("MyPermission", &gocf.LambdaPermission{
+		FunctionName: gocf.GetAtt("MyLambda", "Arn"),
+		SourceAccount: gocf.Join("",
+			gocf.Ref("AWS::StackName"),
+			gocf.Ref("MyAPI")),
+	})
+	template.AddResource("MyAPI", &gocf.APIGatewayRestAPI{
+		Name: gocf.String("MyAPI"),
+	})
+	dependentResource := template.AddResource("MyDependentRole", gocf.IAMRole{})
+	dependentResource.DependsOn = []string{"MyPermission"}
+	template.Outputs["APIID"] = &gocf.Output{
+		Value: gocf.Ref("MyAPI"),
+	}
+
+	nestedTemplates := make(map[string]*gocf.Template)
+	splitErr := SplitNestedStacks(template,
+		NestedStackGroups(NestedStackGroupByAPI,
+			NestedStackGroupByEventSource,
+			func(logicalResourceName string, resource *gocf.Resource) string {
+				if logicalResourceName == "MyRole" {
+					return "IAM"
+				}
+				return ""
+			}),
+		func(stackResourceName string, nestedTemplate *gocf.Template) (string, error) {
+			nestedTemplates[stackResourceName] = nestedTemplate
+			return "https://s3.amazonaws.com/bucket/" + stackResourceName + ".json", nil
+		})
+	if splitErr != nil {
+		t.Fatalf("Failed to split template: %s", splitErr)
+	}
+	if len(nestedTemplates) != 3 {
+		t.Fatalf("Unexpected nested stack count: %d", len(nestedTemplates))
+	}
+	for _, eachResourceName := range []string{"MyLambda",
+		"MyDependentRole",
+		"NestedStackAPI",
+		"NestedStackEventSources",
+		"NestedStackIAM"} {
+		if _, exists := template.Resources[eachResourceName]; !exists {
+			t.Fatalf("Failed to find %s in parent template", eachResourceName)
+		}
+	}
+	if len(template.Resources) != 5 {
+		t.Fatalf("Unexpected parent resource count: %d", len(template.Resources))
+	}
+	if template.Resources["MyDependentRole"].DependsOn[0] != "NestedStackEventSources" {
+		t.Fatalf("Failed to convert DependsOn to nested stack dependency")
+	}
+	if _, exists := nestedTemplates["NestedStackEventSources"].Resources["MyPermission"]; !exists {
+		t.Fatalf("Failed to move resource to nested stack")
+	}
+	parentJSON, _ := json.Marshal(template)
+	eventSourcesJSON, _ := json.Marshal(nestedTemplates["NestedStackEventSources"])
+	apiJSON, _ := json.Marshal(nestedTemplates["NestedStackAPI"])
+	expectations := []struct {
+		templateJSON string
+		expected     string
+	}{
+		{string(parentJSON), `"Outputs.MyRoleArn"`},
+		{string(parentJSON), `"Outputs.MyAPI"`},
+		{string(parentJSON), `"ParentStackName":{"Ref":"AWS::StackName"}`},
+		{string(parentJSON), `"MyLambdaArn":{"Fn::GetAtt":["MyLambda","Arn"]}`},
+		{string(eventSourcesJSON), `"FunctionName":{"Ref":"MyLambdaArn"}`},
+		{string(eventSourcesJSON), `{"Ref":"ParentStackName"}`},
+		{string(apiJSON), `"Outputs":{"MyAPI":{"Value":{"Ref":"MyAPI"}}}`},
+	}
+	for _, eachExpectation := range expectations {
+		if !strings.Contains(eachExpectation.templateJSON, eachExpectation.expected) {
+			t.Fatalf("Failed to find %s in %s", eachExpectation.expected, eachExpectation.templateJSON)
+		}
+	}
+	capabilities := stackCapabilities(template)
+	if len(capabilities) != 2 {
+		t.Fatalf("Failed to propagate nested stack capabilities: %d", len(capabilities))
+	}
+}
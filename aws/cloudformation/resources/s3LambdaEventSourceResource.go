@@ -11,6 +11,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// S3LambdaEventSourceNotification is a single S3 notification configuration
+// that forwards the Events, optionally scoped by Filter, to the target lambda
+type S3LambdaEventSourceNotification struct {
+	Events []string
+	Filter *s3.NotificationConfigurationFilter `json:"Filter,omitempty"`
+}
+
 // S3LambdaEventSourceResourceRequest is what the UserProperties
 // should be set to in the CustomResource invocation
 type S3LambdaEventSourceResourceRequest struct {
@@ -18,6 +25,9 @@ type S3LambdaEventSourceResourceRequest struct {
 	Events          []string
 	LambdaTargetArn *gocf.StringExpr
 	Filter          *s3.NotificationConfigurationFilter `json:"Filter,omitempty"`
+	// Notifications, if non-empty, supersedes the Events and Filter
+	// values and registers one configuration per notification
+	Notifications []*S3LambdaEventSourceNotification `json:"Notifications,omitempty"`
 }
 
 // S3LambdaEventSourceResource manages registering a Lambda function with S3 event
@@ -65,18 +75,29 @@ func (command S3LambdaEventSourceResource) updateNotification(isTargetActive boo
 	}
 
 	if isTargetActive {
-		var eventPtrs []*string
-		for _, eachString := range command.Events {
-			eventPtrs = append(eventPtrs, aws.String(eachString))
-		}
-		commandConfig := &s3.LambdaFunctionConfiguration{
-			LambdaFunctionArn: aws.String(command.LambdaTargetArn.Literal),
-			Events:            eventPtrs,
+		notifications := command.Notifications
+		if len(notifications) == 0 {
+			notifications = []*S3LambdaEventSourceNotification{
+				{
+					Events: command.Events,
+					Filter: command.Filter,
+				},
+			}
 		}
-		if command.Filter != nil {
-			commandConfig.Filter = command.Filter
+		for _, eachNotification := range notifications {
+			var eventPtrs []*string
+			for _, eachString := range eachNotification.Events {
+				eventPtrs = append(eventPtrs, aws.String(eachString))
+			}
+			commandConfig := &s3.LambdaFunctionConfiguration{
+				LambdaFunctionArn: aws.String(command.LambdaTargetArn.Literal),
+				Events:            eventPtrs,
+			}
+			if eachNotification.Filter != nil {
+				commandConfig.Filter = eachNotification.Filter
+			}
+			lambdaConfigurations = append(lambdaConfigurations, commandConfig)
 		}
-		lambdaConfigurations = append(lambdaConfigurations, commandConfig)
 	}
 	config.LambdaFunctionConfigurations = lambdaConfigurations
 
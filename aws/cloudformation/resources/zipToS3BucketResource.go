@@ -3,6 +3,8 @@ package resources
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +12,9 @@ import (
 	"mime"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -24,6 +28,65 @@ import (
 // at the root of the S3 bucket with user-supplied metadata
 const DefaultManifestName = "MANIFEST.json"
 
+const (
+	// ZipToS3BucketChangedPaths is the ZipToS3BucketResource attribute
+	// that stores the comma separated URL paths that were uploaded or deleted
+	ZipToS3BucketChangedPaths = "ChangedPaths"
+	// ZipToS3BucketAllPaths is the ChangedPaths value used when every
+	// object changed or there are too many paths to list
+	ZipToS3BucketAllPaths = "/*"
+	// ZipToS3BucketNoChangedPaths is the ChangedPaths value used when
+	// no objects changed
+	ZipToS3BucketNoChangedPaths = "NONE"
+)
+
+const (
+	// maxChangedPathsCount is the maximum number of individual paths
+	// reported before ChangedPaths falls back to ZipToS3BucketAllPaths
+	maxChangedPathsCount = 100
+	// maxChangedPathsLength is the maximum length of the ChangedPaths
+	// value before falling back to ZipToS3BucketAllPaths
+	maxChangedPathsLength = 2048
+)
+
+// changedPathsValue returns the ChangedPaths attribute value for the
+// set of changed object keys
+func changedPathsValue(changedKeys []string, allChanged bool) string {
+	if allChanged {
+		return ZipToS3BucketAllPaths
+	}
+	if len(changedKeys) == 0 {
+		return ZipToS3BucketNoChangedPaths
+	}
+	if len(changedKeys) > maxChangedPathsCount {
+		return ZipToS3BucketAllPaths
+	}
+	paths := make([]string, 0, len(changedKeys))
+	for _, eachKey := range changedKeys {
+		// Keys that can't be listed unambiguously invalidate everything
+		if strings.ContainsAny(eachKey, ", \t\n*") {
+			return ZipToS3BucketAllPaths
+		}
+		paths = append(paths, fmt.Sprintf("/%s", eachKey))
+	}
+	sort.Strings(paths)
+	value := strings.Join(paths, ",")
+	if len(value) > maxChangedPathsLength {
+		return ZipToS3BucketAllPaths
+	}
+	return value
+}
+
+// ZipToS3BucketObjectHeaders are the HTTP headers applied to the
+// objects whose keys match the Pattern
+type ZipToS3BucketObjectHeaders struct {
+	// Pattern is a path.Match pattern (eg: *.html, assets/*). Patterns
+	// without a "/" are also matched against the key's base name.
+	Pattern      *gocf.StringExpr
+	ContentType  *gocf.StringExpr `json:",omitempty"`
+	CacheControl *gocf.StringExpr `json:",omitempty"`
+}
+
 // ZipToS3BucketResourceRequest is the data request made to a ZipToS3BucketResource
 // lambda handler
 type ZipToS3BucketResourceRequest struct {
@@ -32,6 +95,152 @@ type ZipToS3BucketResourceRequest struct {
 	DestBucket   *gocf.StringExpr
 	ManifestName string
 	Manifest     map[string]interface{}
+	// Incremental only uploads the files whose MD5 digest differs
+	// from the existing object's ETag
+	Incremental *gocf.BoolExpr `json:",omitempty"`
+	// DeleteRemoved deletes the existing objects that aren't
+	// in the archive
+	DeleteRemoved *gocf.BoolExpr `json:",omitempty"`
+	// ObjectHeaders are applied in order, with the values of later
+	// matching entries taking precedence
+	ObjectHeaders []*ZipToS3BucketObjectHeaders `json:",omitempty"`
+	// RootObject is the optional object served for the root URL path. If
+	// the RootObject changes the root path is included in the ChangedPaths.
+	RootObject string `json:",omitempty"`
+	// ConfigFile is the optional key of a JSON object written with the
+	// Manifest output values
+	ConfigFile string `json:",omitempty"`
+	// TemplateFiles are path.Match patterns of the archive files that
+	// are rendered as text/template templates with the Manifest output values
+	TemplateFiles []string `json:",omitempty"`
+	// Optional TemplateFiles delimiters. Default to "{{" and "}}".
+	TemplateLeftDelim  string `json:",omitempty"`
+	TemplateRightDelim string `json:",omitempty"`
+}
+
+// templateData returns the ConfigFile and TemplateFiles data. Each Manifest
+// output is represented by its Value.
+func (request *ZipToS3BucketResourceRequest) templateData() map[string]interface{} {
+	data := make(map[string]interface{}, len(request.Manifest))
+	for eachKey, eachValue := range request.Manifest {
+		data[eachKey] = eachValue
+		// The userdata value is the user supplied map
+		outputValue, outputValueOk := eachValue.(map[string]interface{})
+		if outputValueOk && eachKey != "userdata" {
+			if value, valueExists := outputValue["Value"]; valueExists {
+				data[eachKey] = value
+			}
+		}
+	}
+	return data
+}
+
+// isTemplateFile returns true if the key matches one of the TemplateFiles
+func (request *ZipToS3BucketResourceRequest) isTemplateFile(key string) bool {
+	for _, eachPattern := range request.TemplateFiles {
+		matched, _ := path.Match(eachPattern, key)
+		if !matched && !strings.Contains(eachPattern, "/") {
+			matched, _ = path.Match(eachPattern, path.Base(key))
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTemplate renders the file contents with the templateData
+func (request *ZipToS3BucketResourceRequest) renderTemplate(key string,
+	contents []byte,
+	data map[string]interface{}) ([]byte, error) {
+	fileTemplate, fileTemplateErr := template.New(key).
+		Delims(request.TemplateLeftDelim, request.TemplateRightDelim).
+		Option("missingkey=error").
+		Parse(string(contents))
+	if fileTemplateErr != nil {
+		return nil, errors.Wrapf(fileTemplateErr, "Failed to parse template file %s", key)
+	}
+	var output bytes.Buffer
+	executeErr := fileTemplate.Execute(&output, data)
+	if executeErr != nil {
+		return nil, errors.Wrapf(executeErr, "Failed to render template file %s", key)
+	}
+	return output.Bytes(), nil
+}
+
+// objectHeaders returns the Content-Type and Cache-Control values for the key
+func (request *ZipToS3BucketResourceRequest) objectHeaders(key string) (string, string) {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	cacheControl := ""
+	for _, eachHeaders := range request.ObjectHeaders {
+		if eachHeaders == nil || eachHeaders.Pattern == nil {
+			continue
+		}
+		pattern := eachHeaders.Pattern.Literal
+		matched, _ := path.Match(pattern, key)
+		if !matched && !strings.Contains(pattern, "/") {
+			matched, _ = path.Match(pattern, path.Base(key))
+		}
+		if !matched {
+			continue
+		}
+		if eachHeaders.ContentType != nil && eachHeaders.ContentType.Literal != "" {
+			contentType = eachHeaders.ContentType.Literal
+		}
+		if eachHeaders.CacheControl != nil && eachHeaders.CacheControl.Literal != "" {
+			cacheControl = eachHeaders.CacheControl.Literal
+		}
+	}
+	return contentType, cacheControl
+}
+
+// boolValue returns the literal value of the optional BoolExpr
+func boolValue(expr *gocf.BoolExpr) bool {
+	return expr != nil && expr.Literal
+}
+
+// existingObjectETags returns the existing object keys in the bucket
+// together with their unquoted ETag values
+func existingObjectETags(svc *s3.S3, bucket string) (map[string]string, error) {
+	objectETags := make(map[string]string)
+	params := &s3.ListObjectsInput{
+		Bucket:  aws.String(bucket),
+		MaxKeys: aws.Int64(1000),
+	}
+	listErr := svc.ListObjectsPages(params,
+		func(objectOutputs *s3.ListObjectsOutput, lastPage bool) bool {
+			for _, eachObject := range objectOutputs.Contents {
+				objectETags[aws.StringValue(eachObject.Key)] =
+					strings.Trim(aws.StringValue(eachObject.ETag), `"`)
+			}
+			return true
+		})
+	if listErr != nil {
+		return nil, listErr
+	}
+	return objectETags, nil
+}
+
+// objectHeadersChanged returns true if the ObjectHeaders differ from the
+// values in the previous resource properties
+func (request *ZipToS3BucketResourceRequest) objectHeadersChanged(event *CloudFormationLambdaEvent) bool {
+	if len(event.OldResourceProperties) == 0 {
+		return false
+	}
+	oldRequest := ZipToS3BucketResourceRequest{}
+	unmarshalErr := json.Unmarshal(event.OldResourceProperties, &oldRequest)
+	if unmarshalErr != nil {
+		return true
+	}
+	oldHeaders, oldHeadersErr := json.Marshal(oldRequest.ObjectHeaders)
+	newHeaders, newHeadersErr := json.Marshal(request.ObjectHeaders)
+	if oldHeadersErr != nil || newHeadersErr != nil {
+		return true
+	}
+	return !bytes.Equal(oldHeaders, newHeaders)
 }
 
 // ZipToS3BucketResource manages populating an S3 bucket with the contents
@@ -75,12 +284,48 @@ func (command ZipToS3BucketResource) unzip(session *session.Session,
 	if nil != zipErr {
 		return nil, zipErr
 	}
+	manifestName := command.ManifestName
+	if manifestName == "" {
+		manifestName = DefaultManifestName
+	}
+
+	// In incremental mode, compare against the existing objects. Changed
+	// headers require every object to be rewritten.
+	incremental := boolValue(command.Incremental)
+	deleteRemoved := boolValue(command.DeleteRemoved)
+	var existingETags map[string]string
+	if incremental || deleteRemoved {
+		etags, etagsErr := existingObjectETags(svc, command.DestBucket.Literal)
+		if etagsErr != nil {
+			return nil, errors.Wrapf(etagsErr, "Failed to list existing S3 objects")
+		}
+		existingETags = etags
+	}
+	if incremental && command.objectHeadersChanged(event) {
+		logger.Info("S3 object headers changed. Uploading all files.")
+		incremental = false
+	}
+	archiveKeys := make(map[string]bool)
+	configKey := strings.TrimLeft(command.ConfigFile, "/")
+	if configKey != "" {
+		archiveKeys[configKey] = true
+	}
+	templateData := command.templateData()
+
 	// Iterate through the files in the archive,
 	// printing some of their contents.
 	// TODO - refactor to a worker pool
 	totalFiles := 0
+	uploadedFiles := 0
+	var changedKeys []string
 	for _, eachFile := range zipReader.File {
 		totalFiles++
+		normalizedName := strings.TrimLeft(eachFile.Name, "/")
+		if len(normalizedName) == 0 ||
+			(incremental && eachFile.FileInfo().IsDir()) {
+			continue
+		}
+		archiveKeys[normalizedName] = true
 
 		stream, streamErr := eachFile.Open()
 		if nil != streamErr {
@@ -90,29 +335,98 @@ func (command ZipToS3BucketResource) unzip(session *session.Session,
 		if nil != bodySourceErr {
 			return nil, bodySourceErr
 		}
-		normalizedName := strings.TrimLeft(eachFile.Name, "/")
-		// Mime type?
-		fileExtension := path.Ext(eachFile.Name)
-		mimeType := mime.TypeByExtension(fileExtension)
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
+		errClose := stream.Close()
+		if errClose != nil {
+			return nil, errors.Wrapf(errClose, "Failed to close S3 PutObject stream")
 		}
-
-		if len(normalizedName) > 0 {
+		if command.isTemplateFile(normalizedName) {
+			rendered, renderedErr := command.renderTemplate(normalizedName,
+				bodySource,
+				templateData)
+			if renderedErr != nil {
+				return nil, renderedErr
+			}
+			bodySource = rendered
+		}
+		if incremental {
+			digest := md5.Sum(bodySource)
+			if existingETags[normalizedName] == hex.EncodeToString(digest[:]) {
+				continue
+			}
+		}
+		contentType, cacheControl := command.objectHeaders(normalizedName)
+		s3PutObject := &s3.PutObjectInput{
+			Body:        bytes.NewReader(bodySource),
+			Bucket:      aws.String(command.DestBucket.Literal),
+			Key:         aws.String(fmt.Sprintf("/%s", eachFile.Name)),
+			ContentType: aws.String(contentType),
+		}
+		if cacheControl != "" {
+			s3PutObject.CacheControl = aws.String(cacheControl)
+		}
+		_, err := svc.PutObject(s3PutObject)
+		if err != nil {
+			return nil, err
+		}
+		uploadedFiles++
+		changedKeys = append(changedKeys, normalizedName)
+		// The root object is also served as the root path
+		if command.RootObject != "" && normalizedName == command.RootObject {
+			changedKeys = append(changedKeys, "")
+		}
+	}
+	// Remove the objects that are no longer part of the site
+	deletedFiles := 0
+	if deleteRemoved {
+		var removedObjects []*s3.ObjectIdentifier
+		for eachKey := range existingETags {
+			if !archiveKeys[eachKey] && eachKey != manifestName {
+				removedObjects = append(removedObjects, &s3.ObjectIdentifier{
+					Key: aws.String(eachKey),
+				})
+				changedKeys = append(changedKeys, eachKey)
+			}
+		}
+		// DeleteObjects accepts at most 1000 keys
+		for len(removedObjects) != 0 {
+			batchSize := len(removedObjects)
+			if batchSize > 1000 {
+				batchSize = 1000
+			}
+			_, deleteErr := svc.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: aws.String(command.DestBucket.Literal),
+				Delete: &s3.Delete{
+					Objects: removedObjects[0:batchSize],
+					Quiet:   aws.Bool(true),
+				},
+			})
+			if deleteErr != nil {
+				return nil, errors.Wrapf(deleteErr, "Failed to delete removed S3 objects")
+			}
+			deletedFiles += batchSize
+			removedObjects = removedObjects[batchSize:]
+		}
+	}
+	// Write the config file with the output values
+	if configKey != "" {
+		configBytes, configErr := json.MarshalIndent(templateData, "", " ")
+		if configErr != nil {
+			return nil, errors.Wrapf(configErr, "Failed to marshal config file %s", configKey)
+		}
+		digest := md5.Sum(configBytes)
+		if !incremental || existingETags[configKey] != hex.EncodeToString(digest[:]) {
 			s3PutObject := &s3.PutObjectInput{
-				Body:        bytes.NewReader(bodySource),
-				Bucket:      aws.String(command.DestBucket.Literal),
-				Key:         aws.String(fmt.Sprintf("/%s", eachFile.Name)),
-				ContentType: aws.String(mimeType),
+				Body:         bytes.NewReader(configBytes),
+				Bucket:       aws.String(command.DestBucket.Literal),
+				Key:          aws.String(configKey),
+				ContentType:  aws.String("application/json"),
+				CacheControl: aws.String("no-cache"),
 			}
 			_, err := svc.PutObject(s3PutObject)
 			if err != nil {
 				return nil, err
 			}
-		}
-		errClose := stream.Close()
-		if errClose != nil {
-			return nil, errors.Wrapf(errClose, "Failed to close S3 PutObject stream")
+			changedKeys = append(changedKeys, configKey)
 		}
 	}
 	// Need to add the manifest data iff defined
@@ -121,14 +435,10 @@ func (command ZipToS3BucketResource) unzip(session *session.Session,
 		if nil != manifestErr {
 			return nil, manifestErr
 		}
-		name := command.ManifestName
-		if name == "" {
-			name = DefaultManifestName
-		}
 		s3PutObject := &s3.PutObjectInput{
 			Body:        bytes.NewReader(manifestBytes),
 			Bucket:      aws.String(command.DestBucket.Literal),
-			Key:         aws.String(name),
+			Key:         aws.String(manifestName),
 			ContentType: aws.String("application/json"),
 		}
 		_, err := svc.PutObject(s3PutObject)
@@ -138,13 +448,17 @@ func (command ZipToS3BucketResource) unzip(session *session.Session,
 	}
 	// Log some information
 	logger.WithFields(logrus.Fields{
-		"TotalFileCount": totalFiles,
-		"ArchiveSize":    *s3Object.ContentLength,
-		"S3Bucket":       command.DestBucket,
+		"TotalFileCount":    totalFiles,
+		"UploadedFileCount": uploadedFiles,
+		"DeletedFileCount":  deletedFiles,
+		"ArchiveSize":       *s3Object.ContentLength,
+		"S3Bucket":          command.DestBucket,
 	}).Info("Expanded ZIP archive")
 
-	// All good
-	return nil, nil
+	// Report the paths that changed so that caches can be invalidated
+	return map[string]interface{}{
+		ZipToS3BucketChangedPaths: changedPathsValue(changedKeys, !incremental),
+	}, nil
 }
 
 // IAMPrivileges returns the IAM privs for this custom action
@@ -2,6 +2,7 @@ package resources
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -63,3 +64,109 @@ func TestUnzip(t *testing.T) {
 	}
 	t.Logf("TestUnzip outputs: %#v", deleteOutputs)
 }
+
+func TestUnzipObjectHeaders(t *testing.T) {
+	request := &ZipToS3BucketResourceRequest{
+		ObjectHeaders: []*ZipToS3BucketObjectHeaders{
+			{
+				Pattern:      gocf.String("*"),
+				CacheControl: gocf.String("public, max-age=31536000, immutable"),
+			},
+			{
+				Pattern:      gocf.String("*.html"),
+				ContentType:  gocf.String("text/html"),
+				CacheControl: gocf.String("no-cache"),
+			},
+			{
+				Pattern:     gocf.String("data/*.bin"),
+				ContentType: gocf.String("application/x-sparta"),
+			},
+		},
+	}
+	testCases := []struct {
+		key          string
+		contentType  string
+		cacheControl string
+	}{
+		{"index.html", "text/html", "no-cache"},
+		{"docs/index.html", "text/html", "no-cache"},
+		{"assets/app.spartaext", "application/octet-stream", "public, max-age=31536000, immutable"},
+		{"data/blob.bin", "application/x-sparta", "public, max-age=31536000, immutable"},
+		{"other/blob.bin", "application/octet-stream", "public, max-age=31536000, immutable"},
+	}
+	for _, eachTestCase := range testCases {
+		contentType, cacheControl := request.objectHeaders(eachTestCase.key)
+		if contentType != eachTestCase.contentType ||
+			cacheControl != eachTestCase.cacheControl {
+			t.Fatalf("Unexpected headers for %s. Found (%s, %s), expected (%s, %s)",
+				eachTestCase.key,
+				contentType,
+				cacheControl,
+				eachTestCase.contentType,
+				eachTestCase.cacheControl)
+		}
+	}
+}
+
+func TestUnzipChangedPaths(t *testing.T) {
+	manyKeys := make([]string, maxChangedPathsCount+1)
+	for eachIndex := range manyKeys {
+		manyKeys[eachIndex] = fmt.Sprintf("file%d.html", eachIndex)
+	}
+	testCases := []struct {
+		keys       []string
+		allChanged bool
+		expected   string
+	}{
+		{nil, false, ZipToS3BucketNoChangedPaths},
+		{[]string{"index.html"}, true, ZipToS3BucketAllPaths},
+		{[]string{"index.html", "", "assets/app.css"}, false, "/,/assets/app.css,/index.html"},
+		{[]string{"my file.html"}, false, ZipToS3BucketAllPaths},
+		{manyKeys, false, ZipToS3BucketAllPaths},
+	}
+	for _, eachTestCase := range testCases {
+		value := changedPathsValue(eachTestCase.keys, eachTestCase.allChanged)
+		if value != eachTestCase.expected {
+			t.Fatalf("Unexpected ChangedPaths for %v. Found %s, expected %s",
+				eachTestCase.keys,
+				value,
+				eachTestCase.expected)
+		}
+	}
+}
+
+func TestUnzipTemplateFiles(t *testing.T) {
+	request := &ZipToS3BucketResourceRequest{
+		Manifest: map[string]interface{}{
+			"APIGatewayURL": map[string]interface{}{
+				"Description": "API Gateway URL",
+				"Value":       "https://api.example.com/v1",
+			},
+			"userdata": map[string]interface{}{
+				"Value": "user",
+			},
+		},
+		TemplateFiles:      []string{"*.js"},
+		TemplateLeftDelim:  "[[",
+		TemplateRightDelim: "]]",
+	}
+	if !request.isTemplateFile("assets/config.js") || request.isTemplateFile("index.html") {
+		t.Fatalf("Unexpected TemplateFiles match")
+	}
+	data := request.templateData()
+	rendered, renderedErr := request.renderTemplate("config.js",
+		[]byte(`const api = "[[ .APIGatewayURL ]]"; const user = "[[ .userdata.Value ]]"; const ng = "{{ value }}";`),
+		data)
+	if renderedErr != nil {
+		t.Fatalf("Failed to render template: %s", renderedErr)
+	}
+	expected := `const api = "https://api.example.com/v1"; const user = "user"; const ng = "{{ value }}";`
+	if string(rendered) != expected {
+		t.Fatalf("Unexpected rendered template. Found %s, expected %s", string(rendered), expected)
+	}
+	// Missing values are errors
+	_, renderedErr = request.renderTemplate("config.js", []byte(`[[ .Missing ]]`), data)
+	if renderedErr == nil {
+		t.Fatalf("Expected error for missing template value")
+	}
+}
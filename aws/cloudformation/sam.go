@@ -0,0 +1,688 @@
+package cloudformation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - SAM
+//
+
+// SAMTransform is the AWS Serverless Application Model transform
+// Ref: https://docs.aws.amazon.com/serverless-application-model/latest/developerguide/sam-specification.html
+const SAMTransform = "AWS::Serverless-2016-10-31"
+
+// AWS::Lambda::Function properties that have the same name and
+// representation for AWS::Serverless::Function
+var samFunctionPassthroughProperties = map[string]bool{
+	"Architectures":                true,
+	"CodeSigningConfigArn":         true,
+	"Description":                  true,
+	"Environment":                  true,
+	"EphemeralStorage":             true,
+	"FileSystemConfigs":            true,
+	"FunctionName":                 true,
+	"Handler":                      true,
+	"ImageConfig":                  true,
+	"KmsKeyArn":                    true,
+	"Layers":                       true,
+	"MemorySize":                   true,
+	"PackageType":                  true,
+	"ReservedConcurrentExecutions": true,
+	"Role":                         true,
+	"Runtime":                      true,
+	"Timeout":                      true,
+	"VpcConfig":                    true,
+}
+
+// AWS::ApiGateway::RestApi properties that have the same name and
+// representation for AWS::Serverless::Api
+var samAPIPassthroughProperties = map[string]bool{
+	"BinaryMediaTypes":       true,
+	"Description":            true,
+	"FailOnWarnings":         true,
+	"MinimumCompressionSize": true,
+	"Name":                   true,
+}
+
+// AWS::ApiGateway::Method.Integration properties and their
+// x-amazon-apigateway-integration names
+// Ref: https://docs.aws.amazon.com/apigateway/latest/developerguide/api-gateway-swagger-extensions-integration.html
+var samIntegrationProperties = map[string]string{
+	"CacheKeyParameters":    "cacheKeyParameters",
+	"CacheNamespace":        "cacheNamespace",
+	"ContentHandling":       "contentHandling",
+	"Credentials":           "credentials",
+	"IntegrationHttpMethod": "httpMethod",
+	"PassthroughBehavior":   "passthroughBehavior",
+	"RequestParameters":     "requestParameters",
+	"RequestTemplates":      "requestTemplates",
+	"TimeoutInMillis":       "timeoutInMillis",
+	"Type":                  "type",
+	"Uri":                   "uri",
+}
+
+// samResourceMap returns the value as a JSON object
+func samResourceMap(value interface{}) map[string]interface{} {
+	typedValue, typedValueOk := value.(map[string]interface{})
+	if !typedValueOk {
+		return nil
+	}
+	return typedValue
+}
+
+// samResourceType returns the Type of the named template resource
+func samResourceType(resources map[string]interface{}, name string) string {
+	resourceType, _ := samResourceMap(resources[name])["Type"].(string)
+	return resourceType
+}
+
+// samReferenceName returns the logical name of a Ref or Fn::GetAtt value
+func samReferenceName(value interface{}) string {
+	object := samResourceMap(value)
+	if len(object) != 1 {
+		return ""
+	}
+	if refName, refNameOk := object["Ref"].(string); refNameOk {
+		return refName
+	}
+	if getAtt, getAttOk := object["Fn::GetAtt"].([]interface{}); getAttOk && len(getAtt) == 2 {
+		resourceName, _ := getAtt[0].(string)
+		return resourceName
+	}
+	return ""
+}
+
+// samDeadLetterQueueType returns the DeadLetterQueue Type (SNS or SQS)
+// for the DeadLetterConfig TargetArn
+func samDeadLetterQueueType(targetArn interface{}, resources map[string]interface{}) string {
+	if literalArn, literalArnOk := targetArn.(string); literalArnOk {
+		parsedArn, parsedArnErr := arn.Parse(literalArn)
+		if parsedArnErr != nil {
+			return ""
+		}
+		switch parsedArn.Service {
+		case "sqs":
+			return "SQS"
+		case "sns":
+			return "SNS"
+		}
+		return ""
+	}
+	switch samResourceType(resources, samReferenceName(targetArn)) {
+	case "AWS::SQS::Queue":
+		return "SQS"
+	case "AWS::SNS::Topic":
+		return "SNS"
+	}
+	return ""
+}
+
+// samFunctionProperties returns the AWS::Serverless::Function properties
+// for the AWS::Lambda::Function properties
+func samFunctionProperties(properties map[string]interface{},
+	resources map[string]interface{},
+	codeURIs map[string]string) (map[string]interface{}, error) {
+
+	samProperties := make(map[string]interface{})
+	for eachKey, eachValue := range properties {
+		switch eachKey {
+		case "Code":
+			code := samResourceMap(eachValue)
+			if zipFile, zipFileExists := code["ZipFile"]; zipFileExists {
+				samProperties["InlineCode"] = zipFile
+			} else if imageURI, imageURIExists := code["ImageUri"]; imageURIExists {
+				samProperties["ImageUri"] = imageURI
+			} else if s3Key, s3KeyOk := code["S3Key"].(string); s3KeyOk && codeURIs[s3Key] != "" {
+				samProperties["CodeUri"] = codeURIs[s3Key]
+			} else if code != nil {
+				codeURI := map[string]interface{}{
+					"Bucket": code["S3Bucket"],
+					"Key":    code["S3Key"],
+				}
+				if version, versionExists := code["S3ObjectVersion"]; versionExists {
+					codeURI["Version"] = version
+				}
+				samProperties["CodeUri"] = codeURI
+			} else {
+				return nil, errors.Errorf("Unsupported Code value: %v", eachValue)
+			}
+		case "TracingConfig":
+			mode, modeExists := samResourceMap(eachValue)["Mode"]
+			if !modeExists {
+				return nil, errors.Errorf("Unsupported TracingConfig value: %v", eachValue)
+			}
+			samProperties["Tracing"] = mode
+		case "Tags":
+			tagList, tagListOk := eachValue.([]interface{})
+			if !tagListOk {
+				return nil, errors.Errorf("Unsupported Tags value: %v", eachValue)
+			}
+			tags := make(map[string]interface{})
+			for _, eachTag := range tagList {
+				tagKey, tagKeyOk := samResourceMap(eachTag)["Key"].(string)
+				tagValue, tagValueOk := samResourceMap(eachTag)["Value"].(string)
+				if !tagKeyOk || !tagValueOk {
+					return nil, errors.Errorf("Tags must be literal values: %v", eachTag)
+				}
+				tags[tagKey] = tagValue
+			}
+			samProperties["Tags"] = tags
+		case "DeadLetterConfig":
+			targetArn := samResourceMap(eachValue)["TargetArn"]
+			queueType := samDeadLetterQueueType(targetArn, resources)
+			if queueType == "" {
+				return nil, errors.Errorf("Unable to determine DeadLetterConfig type: %v", targetArn)
+			}
+			samProperties["DeadLetterQueue"] = map[string]interface{}{
+				"Type":      queueType,
+				"TargetArn": targetArn,
+			}
+		default:
+			if !samFunctionPassthroughProperties[eachKey] {
+				return nil, errors.Errorf("Unsupported property: %s", eachKey)
+			}
+			samProperties[eachKey] = eachValue
+		}
+	}
+	return samProperties, nil
+}
+
+// samSubExpression returns the Fn::Sub equivalent of an Fn::Join expression
+// with an empty delimiter. SAM local resolves Fn::Sub integration URIs.
+func samSubExpression(value interface{}) interface{} {
+	join, joinOk := samResourceMap(value)["Fn::Join"].([]interface{})
+	if !joinOk || len(join) != 2 || join[0] != "" {
+		return value
+	}
+	parts, partsOk := join[1].([]interface{})
+	if !partsOk {
+		return value
+	}
+	var subString bytes.Buffer
+	for _, eachPart := range parts {
+		if literal, literalOk := eachPart.(string); literalOk {
+			subString.WriteString(strings.Replace(literal, "${", "${!", -1))
+			continue
+		}
+		object := samResourceMap(eachPart)
+		if refName, refNameOk := object["Ref"].(string); refNameOk && len(object) == 1 {
+			subString.WriteString(fmt.Sprintf("${%s}", refName))
+			continue
+		}
+		getAtt, getAttOk := object["Fn::GetAtt"].([]interface{})
+		if getAttOk && len(object) == 1 && len(getAtt) == 2 {
+			resourceName, resourceNameOk := getAtt[0].(string)
+			attrName, attrNameOk := getAtt[1].(string)
+			if resourceNameOk && attrNameOk {
+				subString.WriteString(fmt.Sprintf("${%s.%s}", resourceName, attrName))
+				continue
+			}
+		}
+		return value
+	}
+	return map[string]interface{}{"Fn::Sub": subString.String()}
+}
+
+// samIntegration returns the x-amazon-apigateway-integration for the
+// AWS::ApiGateway::Method Integration
+func samIntegration(integration map[string]interface{}) (map[string]interface{}, error) {
+	samIntegration := make(map[string]interface{})
+	for eachKey, eachValue := range integration {
+		switch eachKey {
+		case "IntegrationResponses":
+			responseList, _ := eachValue.([]interface{})
+			responses := make(map[string]interface{})
+			for _, eachResponse := range responseList {
+				response := samResourceMap(eachResponse)
+				selectionPattern, _ := response["SelectionPattern"].(string)
+				if selectionPattern == "" {
+					selectionPattern = "default"
+				}
+				samResponse := map[string]interface{}{
+					"statusCode": response["StatusCode"],
+				}
+				for eachResponseKey, eachResponseValue := range response {
+					switch eachResponseKey {
+					case "ContentHandling":
+						samResponse["contentHandling"] = eachResponseValue
+					case "ResponseParameters":
+						samResponse["responseParameters"] = eachResponseValue
+					case "ResponseTemplates":
+						samResponse["responseTemplates"] = eachResponseValue
+					}
+				}
+				responses[selectionPattern] = samResponse
+			}
+			samIntegration["responses"] = responses
+		default:
+			samKey, samKeyExists := samIntegrationProperties[eachKey]
+			if !samKeyExists {
+				return nil, errors.Errorf("Unsupported Integration property: %s", eachKey)
+			}
+			switch eachKey {
+			case "Type", "PassthroughBehavior":
+				stringValue, stringValueOk := eachValue.(string)
+				if !stringValueOk {
+					return nil, errors.Errorf("Integration %s must be a literal value", eachKey)
+				}
+				samIntegration[samKey] = strings.ToLower(stringValue)
+			case "Uri":
+				samIntegration[samKey] = samSubExpression(eachValue)
+			default:
+				samIntegration[samKey] = eachValue
+			}
+		}
+	}
+	return samIntegration, nil
+}
+
+// samOperation returns the OpenAPI operation for the AWS::ApiGateway::Method
+func samOperation(properties map[string]interface{}) (map[string]interface{}, error) {
+	operation := make(map[string]interface{})
+	for eachKey, eachValue := range properties {
+		switch eachKey {
+		case "HttpMethod", "ResourceId", "RestApiId":
+			// Used to determine the path
+		case "AuthorizationType":
+			if eachValue != "NONE" {
+				return nil, errors.Errorf("Unsupported AuthorizationType: %v", eachValue)
+			}
+		case "ApiKeyRequired":
+			if eachValue != false {
+				return nil, errors.Errorf("Unsupported ApiKeyRequired value: %v", eachValue)
+			}
+		case "OperationName":
+			operation["operationId"] = eachValue
+		case "Integration":
+			integration, integrationErr := samIntegration(samResourceMap(eachValue))
+			if integrationErr != nil {
+				return nil, integrationErr
+			}
+			operation["x-amazon-apigateway-integration"] = integration
+		case "RequestParameters":
+			parameterNames := make([]string, 0)
+			for eachName := range samResourceMap(eachValue) {
+				parameterNames = append(parameterNames, eachName)
+			}
+			sort.Strings(parameterNames)
+			parameters := make([]interface{}, 0)
+			for _, eachName := range parameterNames {
+				nameParts := strings.SplitN(eachName, ".", 4)
+				if len(nameParts) != 4 || nameParts[0] != "method" || nameParts[1] != "request" {
+					return nil, errors.Errorf("Unsupported RequestParameter: %s", eachName)
+				}
+				location := nameParts[2]
+				if location == "querystring" {
+					location = "query"
+				}
+				required := fmt.Sprintf("%v", samResourceMap(eachValue)[eachName]) == "true"
+				parameters = append(parameters, map[string]interface{}{
+					"name":     nameParts[3],
+					"in":       location,
+					"required": required || location == "path",
+					"type":     "string",
+				})
+			}
+			operation["parameters"] = parameters
+		case "MethodResponses":
+			responseList, _ := eachValue.([]interface{})
+			responses := make(map[string]interface{})
+			for _, eachResponse := range responseList {
+				response := samResourceMap(eachResponse)
+				statusCode := fmt.Sprintf("%v", response["StatusCode"])
+				samResponse := map[string]interface{}{
+					"description": fmt.Sprintf("%s response", statusCode),
+				}
+				headers := make(map[string]interface{})
+				for eachParam := range samResourceMap(response["ResponseParameters"]) {
+					headerName := strings.TrimPrefix(eachParam, "method.response.header.")
+					headers[headerName] = map[string]interface{}{"type": "string"}
+				}
+				if len(headers) != 0 {
+					samResponse["headers"] = headers
+				}
+				responses[statusCode] = samResponse
+			}
+			operation["responses"] = responses
+		default:
+			return nil, errors.Errorf("Unsupported Method property: %s", eachKey)
+		}
+	}
+	if _, responsesExist := operation["responses"]; !responsesExist {
+		operation["responses"] = map[string]interface{}{}
+	}
+	return operation, nil
+}
+
+// samReferences returns the logical names referenced by the value
+func samReferences(value interface{}, references map[string]bool) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if refName := samReferenceName(typedValue); refName != "" {
+			references[refName] = true
+		}
+		if subValue, subValueOk := typedValue["Fn::Sub"]; subValueOk {
+			subString, _ := subValue.(string)
+			if subArgs, subArgsOk := subValue.([]interface{}); subArgsOk && len(subArgs) != 0 {
+				subString, _ = subArgs[0].(string)
+			}
+			for _, eachPart := range strings.Split(subString, "${")[1:] {
+				name := strings.SplitN(strings.SplitN(eachPart, "}", 2)[0], ".", 2)[0]
+				references[name] = true
+			}
+		}
+		for _, eachValue := range typedValue {
+			samReferences(eachValue, references)
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			samReferences(eachValue, references)
+		}
+	}
+}
+
+// samAPI replaces the AWS::ApiGateway::RestApi and its Resource, Method and
+// Deployment resources with an AWS::Serverless::Api whose DefinitionBody
+// includes the existing integrations
+func samAPI(apiName string, template map[string]interface{}) error {
+	resources := samResourceMap(template["Resources"])
+	apiResource := samResourceMap(resources[apiName])
+	apiProperties := samResourceMap(apiResource["Properties"])
+	samProperties := make(map[string]interface{})
+	for eachKey, eachValue := range apiProperties {
+		switch {
+		case eachKey == "EndpointConfiguration":
+			endpointTypes, _ := samResourceMap(eachValue)["Types"].([]interface{})
+			if len(endpointTypes) != 1 {
+				return errors.Errorf("Unsupported EndpointConfiguration: %v", eachValue)
+			}
+			endpointConfiguration := map[string]interface{}{
+				"Type": endpointTypes[0],
+			}
+			if vpcEndpointIDs, vpcEndpointIDsExist := samResourceMap(eachValue)["VpcEndpointIds"]; vpcEndpointIDsExist {
+				endpointConfiguration["VPCEndpointIds"] = vpcEndpointIDs
+			}
+			samProperties[eachKey] = endpointConfiguration
+		case samAPIPassthroughProperties[eachKey]:
+			samProperties[eachKey] = eachValue
+		default:
+			return errors.Errorf("Unsupported RestApi property: %s", eachKey)
+		}
+	}
+	isAPIReference := func(value interface{}) bool {
+		refName, _ := samResourceMap(value)["Ref"].(string)
+		return refName == apiName
+	}
+
+	// Find everything that belongs to this API
+	pathResources := make(map[string]map[string]interface{})
+	methodResources := make(map[string]map[string]interface{})
+	deploymentNames := make([]string, 0)
+	for eachName, eachResource := range resources {
+		properties := samResourceMap(samResourceMap(eachResource)["Properties"])
+		if !isAPIReference(properties["RestApiId"]) {
+			continue
+		}
+		switch samResourceType(resources, eachName) {
+		case "AWS::ApiGateway::Resource":
+			pathResources[eachName] = properties
+		case "AWS::ApiGateway::Method":
+			methodResources[eachName] = properties
+		case "AWS::ApiGateway::Deployment":
+			deploymentNames = append(deploymentNames, eachName)
+		case "AWS::ApiGateway::Stage":
+			return errors.Errorf("Unsupported AWS::ApiGateway::Stage resource: %s", eachName)
+		}
+	}
+	if len(deploymentNames) != 1 {
+		return errors.Errorf("RestApi must have a single Deployment. Found: %d", len(deploymentNames))
+	}
+	deploymentName := deploymentNames[0]
+	deploymentProperties := samResourceMap(samResourceMap(resources[deploymentName])["Properties"])
+	stageName, stageNameOk := deploymentProperties["StageName"].(string)
+	if !stageNameOk {
+		return errors.Errorf("Deployment %s must have a literal StageName", deploymentName)
+	}
+	samProperties["StageName"] = stageName
+	for eachKey, eachValue := range samResourceMap(deploymentProperties["StageDescription"]) {
+		switch eachKey {
+		case "CacheClusterEnabled", "CacheClusterSize", "Variables":
+			samProperties[eachKey] = eachValue
+		case "Description":
+		default:
+			return errors.Errorf("Unsupported StageDescription property: %s", eachKey)
+		}
+	}
+
+	// Resolve the path of each AWS::ApiGateway::Resource
+	var resourcePath func(parent interface{}, depth int) (string, error)
+	resourcePath = func(parent interface{}, depth int) (string, error) {
+		parentName := samReferenceName(parent)
+		if parentName == apiName {
+			return "", nil
+		}
+		pathResource, pathResourceExists := pathResources[parentName]
+		if !pathResourceExists || depth > len(pathResources) {
+			return "", errors.Errorf("Unable to resolve resource path: %v", parent)
+		}
+		parentPath, parentPathErr := resourcePath(pathResource["ParentId"], depth+1)
+		if parentPathErr != nil {
+			return "", parentPathErr
+		}
+		return fmt.Sprintf("%s/%v", parentPath, pathResource["PathPart"]), nil
+	}
+	paths := make(map[string]interface{})
+	for eachName, eachProperties := range methodResources {
+		methodPath, methodPathErr := resourcePath(eachProperties["ResourceId"], 0)
+		if methodPathErr != nil {
+			return errors.Wrapf(methodPathErr, "Method %s", eachName)
+		}
+		if methodPath == "" {
+			methodPath = "/"
+		}
+		operation, operationErr := samOperation(eachProperties)
+		if operationErr != nil {
+			return errors.Wrapf(operationErr, "Method %s", eachName)
+		}
+		httpMethod := strings.ToLower(fmt.Sprintf("%v", eachProperties["HttpMethod"]))
+		if httpMethod == "any" {
+			httpMethod = "x-amazon-apigateway-any-method"
+		}
+		if _, pathExists := paths[methodPath]; !pathExists {
+			paths[methodPath] = make(map[string]interface{})
+		}
+		samResourceMap(paths[methodPath])[httpMethod] = operation
+	}
+
+	// The replaced resources can't be referenced by the remaining template
+	replacedResources := map[string]bool{deploymentName: true}
+	for eachName := range pathResources {
+		replacedResources[eachName] = true
+	}
+	for eachName := range methodResources {
+		replacedResources[eachName] = true
+	}
+	references := make(map[string]bool)
+	for eachName, eachResource := range resources {
+		if replacedResources[eachName] {
+			continue
+		}
+		samReferences(eachResource, references)
+		switch dependsOn := samResourceMap(eachResource)["DependsOn"].(type) {
+		case string:
+			references[dependsOn] = true
+		case []interface{}:
+			for _, eachDependency := range dependsOn {
+				references[fmt.Sprintf("%v", eachDependency)] = true
+			}
+		}
+	}
+	samReferences(template["Outputs"], references)
+	for eachName := range replacedResources {
+		if references[eachName] {
+			return errors.Errorf("Resource %s is referenced outside the RestApi", eachName)
+		}
+	}
+
+	samProperties["DefinitionBody"] = map[string]interface{}{
+		"swagger": "2.0",
+		"info": map[string]interface{}{
+			"title":   apiName,
+			"version": "1.0",
+		},
+		"paths": paths,
+	}
+	apiResource["Type"] = "AWS::Serverless::Api"
+	apiResource["Properties"] = samProperties
+	for eachName := range replacedResources {
+		delete(resources, eachName)
+	}
+	return nil
+}
+
+// ExportSAMTemplate returns an AWS SAM version of the JSON CloudFormation
+// template. AWS::Lambda::Function resources are rewritten as
+// AWS::Serverless::Function resources and AWS::ApiGateway::RestApi
+// resources as AWS::Serverless::Api resources with an OpenAPI
+// DefinitionBody. Functions whose Code S3Key is a key in codeURIs use the
+// local path value as the CodeUri. Resources that can't be represented
+// by SAM are included unchanged.
+func ExportSAMTemplate(templateJSON []byte,
+	codeURIs map[string]string,
+	logger *logrus.Logger) ([]byte, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(templateJSON))
+	decoder.UseNumber()
+	var template map[string]interface{}
+	decodeErr := decoder.Decode(&template)
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "Failed to decode template")
+	}
+	resources := samResourceMap(template["Resources"])
+	resourceNames := make([]string, 0, len(resources))
+	for eachName := range resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+
+	for _, eachName := range resourceNames {
+		if samResourceType(resources, eachName) != "AWS::Lambda::Function" {
+			continue
+		}
+		resource := samResourceMap(resources[eachName])
+		samProperties, samPropertiesErr := samFunctionProperties(samResourceMap(resource["Properties"]),
+			resources,
+			codeURIs)
+		if samPropertiesErr != nil {
+			logger.WithFields(logrus.Fields{
+				"Resource": eachName,
+				"Reason":   samPropertiesErr,
+			}).Warn("Function not exported as AWS::Serverless::Function")
+			continue
+		}
+		resource["Type"] = "AWS::Serverless::Function"
+		resource["Properties"] = samProperties
+	}
+	for _, eachName := range resourceNames {
+		if samResourceType(resources, eachName) != "AWS::ApiGateway::RestApi" {
+			continue
+		}
+		apiErr := samAPI(eachName, template)
+		if apiErr != nil {
+			logger.WithFields(logrus.Fields{
+				"Resource": eachName,
+				"Reason":   apiErr,
+			}).Warn("RestApi not exported as AWS::Serverless::Api")
+		}
+	}
+
+	switch typedTransform := template["Transform"].(type) {
+	case nil:
+		template["Transform"] = SAMTransform
+	case string:
+		if typedTransform != SAMTransform {
+			template["Transform"] = []interface{}{typedTransform, SAMTransform}
+		}
+	case []interface{}:
+		transformExists := false
+		for _, eachTransform := range typedTransform {
+			transformExists = transformExists || eachTransform == SAMTransform
+		}
+		if !transformExists {
+			template["Transform"] = append(typedTransform, SAMTransform)
+		}
+	}
+	return json.Marshal(template)
+}
+
+// SAMConfig is the set of `sam deploy` parameters written to samconfig.toml
+// Ref: https://docs.aws.amazon.com/serverless-application-model/latest/developerguide/serverless-sam-cli-config.html
+type SAMConfig struct {
+	StackName    string
+	S3Bucket     string
+	S3Prefix     string
+	Region       string
+	Capabilities []string
+	Tags         map[string]string
+}
+
+// MarshalTOML returns the samconfig.toml representation
+func (config *SAMConfig) MarshalTOML() ([]byte, error) {
+	tomlString := func(value string) (string, error) {
+		// JSON strings are valid TOML basic strings
+		var quoted bytes.Buffer
+		encoder := json.NewEncoder(&quoted)
+		encoder.SetEscapeHTML(false)
+		if encodeErr := encoder.Encode(value); encodeErr != nil {
+			return "", encodeErr
+		}
+		return strings.TrimSuffix(quoted.String(), "\n"), nil
+	}
+	tagKeys := make([]string, 0, len(config.Tags))
+	for eachKey := range config.Tags {
+		tagKeys = append(tagKeys, eachKey)
+	}
+	sort.Strings(tagKeys)
+	tags := make([]string, 0, len(tagKeys))
+	for _, eachKey := range tagKeys {
+		quotedValue, quotedValueErr := tomlString(config.Tags[eachKey])
+		if quotedValueErr != nil {
+			return nil, quotedValueErr
+		}
+		tags = append(tags, fmt.Sprintf("%s=%s", eachKey, quotedValue))
+	}
+	parameters := [][]string{
+		{"stack_name", config.StackName},
+		{"s3_bucket", config.S3Bucket},
+		{"s3_prefix", config.S3Prefix},
+		{"region", config.Region},
+		{"capabilities", strings.Join(config.Capabilities, " ")},
+		{"tags", strings.Join(tags, " ")},
+	}
+	var output bytes.Buffer
+	output.WriteString("version = 0.1\n\n[default.deploy.parameters]\n")
+	for _, eachParameter := range parameters {
+		if eachParameter[1] == "" {
+			continue
+		}
+		value, valueErr := tomlString(eachParameter[1])
+		if valueErr != nil {
+			return nil, valueErr
+		}
+		output.WriteString(fmt.Sprintf("%s = %s\n", eachParameter[0], value))
+	}
+	return output.Bytes(), nil
+}
+
+//
+// END - SAM
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,210 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const samSourceTemplate = `{
+	"Resources": {
+		"HelloFunction": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {
+				"Code": {"S3Bucket": "my-bucket", "S3Key": "MyService/MyService-code.zip"},
+				"Handler": "MyService",
+				"Runtime": "go1.x",
+				"Role": {"Fn::GetAtt": ["HelloRole", "Arn"]},
+				"TracingConfig": {"Mode": "Active"},
+				"DeadLetterConfig": {"TargetArn": {"Fn::GetAtt": ["DLQ", "Arn"]}},
+				"Tags": [{"Key": "team", "Value": "core"}]
+			}
+		},
+		"UnsupportedFunction": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {
+				"Code": {"S3Bucket": "my-bucket", "S3Key": "other.zip"},
+				"Handler": "MyService",
+				"SnapStart": {"ApplyOn": "None"}
+			}
+		},
+		"DLQ": {"Type": "AWS::SQS::Queue"},
+		"MyAPI": {
+			"Type": "AWS::ApiGateway::RestApi",
+			"Properties": {"Name": "MyAPI", "EndpointConfiguration": {"Types": ["REGIONAL"]}}
+		},
+		"HelloResource": {
+			"Type": "AWS::ApiGateway::Resource",
+			"Properties": {
+				"RestApiId": {"Ref": "MyAPI"},
+				"ParentId": {"Fn::GetAtt": ["MyAPI", "RootResourceId"]},
+				"PathPart": "hello"
+			}
+		},
+		"HelloIDResource": {
+			"Type": "AWS::ApiGateway::Resource",
+			"Properties": {
+				"RestApiId": {"Ref": "MyAPI"},
+				"ParentId": {"Ref": "HelloResource"},
+				"PathPart": "{id}"
+			}
+		},
+		"HelloMethod": {
+			"Type": "AWS::ApiGateway::Method",
+			"DependsOn": ["HelloPermission"],
+			"Properties": {
+				"RestApiId": {"Ref": "MyAPI"},
+				"ResourceId": {"Ref": "HelloIDResource"},
+				"HttpMethod": "GET",
+				"AuthorizationType": "NONE",
+				"RequestParameters": {"method.request.path.id": "true"},
+				"Integration": {
+					"Type": "AWS",
+					"IntegrationHttpMethod": "POST",
+					"Uri": {"Fn::Join": ["", [
+						"arn:aws:apigateway:",
+						{"Ref": "AWS::Region"},
+						":lambda:path/2015-03-31/functions/",
+						{"Fn::GetAtt": ["HelloFunction", "Arn"]},
+						"/invocations"
+					]]},
+					"RequestTemplates": {"application/json": "$input.json('$')"},
+					"IntegrationResponses": [{"StatusCode": "200"}, {"StatusCode": "500", "SelectionPattern": ".*Error.*"}]
+				},
+				"MethodResponses": [{"StatusCode": "200", "ResponseParameters": {"method.response.header.Content-Type": true}}]
+			}
+		},
+		"HelloPermission": {
+			"Type": "AWS::Lambda::Permission",
+			"Properties": {
+				"Action": "lambda:InvokeFunction",
+				"FunctionName": {"Fn::GetAtt": ["HelloFunction", "Arn"]},
+				"Principal": "apigateway.amazonaws.com"
+			}
+		},
+		"MyAPIDeployment": {
+			"Type": "AWS::ApiGateway::Deployment",
+			"DependsOn": ["HelloMethod", "MyAPI"],
+			"Properties": {
+				"RestApiId": {"Ref": "MyAPI"},
+				"StageName": "v1",
+				"StageDescription": {"Description": "v1", "Variables": {"Stage": "v1"}}
+			}
+		}
+	},
+	"Outputs": {
+		"APIGatewayURL": {"Value": {"Fn::Join": ["", ["https://", {"Ref": "MyAPI"}, ".execute-api.amazonaws.com/v1"]]}}
+	}
+}`
+
+func TestExportSAMTemplate(t *testing.T) {
+	logger := logrus.New()
+	samJSON, samJSONErr := ExportSAMTemplate([]byte(samSourceTemplate),
+		map[string]string{"MyService/MyService-code.zip": "MyService-code.zip"},
+		logger)
+	if samJSONErr != nil {
+		t.Fatalf("Failed to export SAM template: %s", samJSONErr)
+	}
+	var samTemplate map[string]interface{}
+	unmarshalErr := json.Unmarshal(samJSON, &samTemplate)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal SAM template: %s", unmarshalErr)
+	}
+	if samTemplate["Transform"] != SAMTransform {
+		t.Fatalf("Unexpected Transform: %v", samTemplate["Transform"])
+	}
+	resources := samResourceMap(samTemplate["Resources"])
+	if samResourceType(resources, "HelloFunction") != "AWS::Serverless::Function" ||
+		samResourceType(resources, "UnsupportedFunction") != "AWS::Lambda::Function" ||
+		samResourceType(resources, "MyAPI") != "AWS::Serverless::Api" {
+		t.Fatalf("Unexpected resource types: %s", string(samJSON))
+	}
+	functionProps := samResourceMap(samResourceMap(resources["HelloFunction"])["Properties"])
+	if functionProps["CodeUri"] != "MyService-code.zip" ||
+		functionProps["Tracing"] != "Active" ||
+		samResourceMap(functionProps["DeadLetterQueue"])["Type"] != "SQS" ||
+		samResourceMap(functionProps["Tags"])["team"] != "core" {
+		t.Fatalf("Unexpected function properties: %v", functionProps)
+	}
+	for _, eachName := range []string{"HelloResource", "HelloIDResource", "HelloMethod", "MyAPIDeployment"} {
+		if _, exists := resources[eachName]; exists {
+			t.Fatalf("Failed to replace API resource: %s", eachName)
+		}
+	}
+	if _, exists := resources["HelloPermission"]; !exists {
+		t.Fatalf("Failed to preserve Lambda permission")
+	}
+	apiProps := samResourceMap(samResourceMap(resources["MyAPI"])["Properties"])
+	if apiProps["StageName"] != "v1" ||
+		samResourceMap(apiProps["EndpointConfiguration"])["Type"] != "REGIONAL" {
+		t.Fatalf("Unexpected API properties: %v", apiProps)
+	}
+	paths := samResourceMap(samResourceMap(apiProps["DefinitionBody"])["paths"])
+	operation := samResourceMap(samResourceMap(paths["/hello/{id}"])["get"])
+	integration := samResourceMap(operation["x-amazon-apigateway-integration"])
+	expectedURI := "arn:aws:apigateway:${AWS::Region}:lambda:path/2015-03-31/functions/${HelloFunction.Arn}/invocations"
+	if integration["type"] != "aws" ||
+		samResourceMap(integration["uri"])["Fn::Sub"] != expectedURI ||
+		samResourceMap(integration["responses"])[".*Error.*"] == nil {
+		t.Fatalf("Unexpected integration: %v", integration)
+	}
+
+	// Referenced API resources are not replaced
+	referencedTemplate := strings.Replace(samSourceTemplate,
+		`{"Ref": "MyAPI"}, ".execute-api`,
+		`{"Ref": "MyAPIDeployment"}, ".execute-api`,
+		1)
+	samJSON, samJSONErr = ExportSAMTemplate([]byte(referencedTemplate), nil, logger)
+	if samJSONErr != nil {
+		t.Fatalf("Failed to export SAM template: %s", samJSONErr)
+	}
+	if !strings.Contains(string(samJSON), `"AWS::ApiGateway::RestApi"`) ||
+		!strings.Contains(string(samJSON), `"Bucket":"my-bucket"`) {
+		t.Fatalf("Unexpected SAM template: %s", string(samJSON))
+	}
+}
+
+func TestSAMConfig(t *testing.T) {
+	config := &SAMConfig{
+		StackName:    "MyService",
+		S3Bucket:     "my-bucket",
+		Capabilities: []string{"CAPABILITY_IAM", "CAPABILITY_AUTO_EXPAND"},
+		Tags: map[string]string{
+			"team":  "core",
+			"owner": "a b",
+		},
+	}
+	configTOML, configTOMLErr := config.MarshalTOML()
+	if configTOMLErr != nil {
+		t.Fatalf("Failed to marshal SAM config: %s", configTOMLErr)
+	}
+	expected := `version = 0.1
+
+[default.deploy.parameters]
+stack_name = "MyService"
+s3_bucket = "my-bucket"
+capabilities = "CAPABILITY_IAM CAPABILITY_AUTO_EXPAND"
+tags = "owner=\"a b\" team=\"core\""
+`
+	if string(configTOML) != expected {
+		t.Fatalf("Unexpected SAM config:\n%s", string(configTOML))
+	}
+}
+
+func TestSAMDeadLetterQueueType(t *testing.T) {
+	expected := map[string]string{
+		"arn:aws:sqs:us-west-2:123412341234:MyQueue":        "SQS",
+		"arn:aws-cn:sqs:cn-north-1:123412341234:MyQueue":    "SQS",
+		"arn:aws-us-gov:sns:us-gov-west-1:123412341234:Tpc": "SNS",
+		"arn:aws:lambda:us-west-2:123412341234:function:fn": "",
+		"not-an-arn": "",
+	}
+	for eachArn, eachType := range expected {
+		queueType := samDeadLetterQueueType(eachArn, map[string]interface{}{})
+		if queueType != eachType {
+			t.Fatalf("Unexpected DeadLetterQueue type for %s: %s", eachArn, queueType)
+		}
+	}
+}
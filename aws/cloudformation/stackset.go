@@ -0,0 +1,689 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - StackSets
+//
+
+// StackSetTarget is a set of accounts and regions that share the same
+// stack instance parameter overrides
+type StackSetTarget struct {
+	// Accounts are the AWS account IDs to deploy to
+	Accounts []string `json:",omitempty"`
+	// OrganizationalUnits are AWS Organizations OU IDs (eg, ou-ab12-cdef3456).
+	// Every account in the OU and its child OUs is a target.
+	OrganizationalUnits []string `json:",omitempty"`
+	// Regions are the regions to deploy to in each account
+	Regions []string
+	// ParameterOverrides are the stack instance parameter values
+	ParameterOverrides map[string]string `json:",omitempty"`
+}
+
+// StackSetDeployment defines how a service is published as a CloudFormation
+// StackSet.
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/what-is-cfnstacksets.html
+type StackSetDeployment struct {
+	// StackSetName is the StackSet name. Defaults to the service name.
+	StackSetName string `json:",omitempty"`
+	// AdministrationRoleARN is the optional role CloudFormation assumes in the
+	// administrator account. Defaults to AWSCloudFormationStackSetAdministrationRole.
+	AdministrationRoleARN string `json:",omitempty"`
+	// ExecutionRoleName is the optional role name CloudFormation assumes in
+	// each target account. Defaults to AWSCloudFormationStackSetExecutionRole.
+	ExecutionRoleName string `json:",omitempty"`
+	// MaxConcurrentPercentage is the percentage of accounts per region
+	// that are deployed to concurrently. Defaults to 1 account at a time.
+	MaxConcurrentPercentage int64 `json:",omitempty"`
+	// FailureTolerancePercentage is the percentage of accounts per region
+	// that can fail before the operation is stopped.
+	FailureTolerancePercentage int64 `json:",omitempty"`
+	// GrantArtifactAccess adds a statement to the artifact bucket policy that
+	// allows the target accounts to read the service artifacts. Otherwise
+	// the bucket policy must already grant the target accounts access.
+	GrantArtifactAccess bool `json:",omitempty"`
+	// Targets are the stack instance accounts and regions
+	Targets []*StackSetTarget
+}
+
+// stackSetInstanceOperation is a CreateStackInstances or UpdateStackInstances
+// request
+type stackSetInstanceOperation struct {
+	create             bool
+	accounts           []string
+	regions            []string
+	parameterOverrides map[string]string
+}
+
+// reInvalidStackSetSidChars are the characters that aren't valid in a
+// bucket policy statement ID
+var reInvalidStackSetSidChars = regexp.MustCompile("[^A-Za-z0-9]")
+
+func stackSetInstanceKey(account string, region string) string {
+	return fmt.Sprintf("%s/%s", account, region)
+}
+
+// NewStackSetDeployment returns a validated StackSetDeployment from the
+// JSON data
+func NewStackSetDeployment(reader io.Reader) (*StackSetDeployment, error) {
+	deployment := &StackSetDeployment{}
+	decodeErr := json.NewDecoder(reader).Decode(deployment)
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "Failed to parse StackSet deployment")
+	}
+	if len(deployment.Targets) == 0 {
+		return nil, errors.Errorf("StackSet deployment must include at least one target")
+	}
+	if deployment.MaxConcurrentPercentage < 0 || deployment.MaxConcurrentPercentage > 100 {
+		return nil, errors.Errorf("Invalid StackSet MaxConcurrentPercentage: %d",
+			deployment.MaxConcurrentPercentage)
+	}
+	if deployment.FailureTolerancePercentage < 0 || deployment.FailureTolerancePercentage > 100 {
+		return nil, errors.Errorf("Invalid StackSet FailureTolerancePercentage: %d",
+			deployment.FailureTolerancePercentage)
+	}
+	for eachIndex, eachTarget := range deployment.Targets {
+		if eachTarget == nil {
+			return nil, errors.Errorf("StackSet target %d is empty", eachIndex)
+		}
+		if len(eachTarget.Accounts) == 0 && len(eachTarget.OrganizationalUnits) == 0 {
+			return nil, errors.Errorf("StackSet target %d must include Accounts or OrganizationalUnits",
+				eachIndex)
+		}
+		if len(eachTarget.Regions) == 0 {
+			return nil, errors.Errorf("StackSet target %d must include Regions", eachIndex)
+		}
+	}
+	return deployment, nil
+}
+
+// organizationalUnitAccounts returns the IDs of the accounts in the OU
+// and all of its child OUs
+func organizationalUnitAccounts(ouID string,
+	awsOrganizations *organizations.Organizations) ([]string, error) {
+
+	accounts := make([]string, 0)
+	accountsErr := awsOrganizations.ListAccountsForParentPages(&organizations.ListAccountsForParentInput{
+		ParentId: aws.String(ouID),
+	}, func(page *organizations.ListAccountsForParentOutput, lastPage bool) bool {
+		for _, eachAccount := range page.Accounts {
+			// Suspended accounts can't host stack instances
+			if aws.StringValue(eachAccount.Status) == organizations.AccountStatusActive {
+				accounts = append(accounts, aws.StringValue(eachAccount.Id))
+			}
+		}
+		return true
+	})
+	if accountsErr != nil {
+		return nil, errors.Wrapf(accountsErr, "Failed to list accounts for OU: %s", ouID)
+	}
+	childOUs := make([]string, 0)
+	childOUsErr := awsOrganizations.ListOrganizationalUnitsForParentPages(&organizations.ListOrganizationalUnitsForParentInput{
+		ParentId: aws.String(ouID),
+	}, func(page *organizations.ListOrganizationalUnitsForParentOutput, lastPage bool) bool {
+		for _, eachOU := range page.OrganizationalUnits {
+			childOUs = append(childOUs, aws.StringValue(eachOU.Id))
+		}
+		return true
+	})
+	if childOUsErr != nil {
+		return nil, errors.Wrapf(childOUsErr, "Failed to list child OUs for OU: %s", ouID)
+	}
+	for _, eachChildOU := range childOUs {
+		childAccounts, childAccountsErr := organizationalUnitAccounts(eachChildOU, awsOrganizations)
+		if childAccountsErr != nil {
+			return nil, childAccountsErr
+		}
+		accounts = append(accounts, childAccounts...)
+	}
+	return accounts, nil
+}
+
+// resolveStackSetTargets returns the account IDs for each target, with
+// any OrganizationalUnits expanded to their member accounts
+func resolveStackSetTargets(targets []*StackSetTarget,
+	awsSession *session.Session,
+	logger *logrus.Logger) ([][]string, error) {
+
+	var awsOrganizations *organizations.Organizations
+	resolved := make([][]string, len(targets))
+	for eachIndex, eachTarget := range targets {
+		accounts := append([]string{}, eachTarget.Accounts...)
+		for _, eachOU := range eachTarget.OrganizationalUnits {
+			if awsOrganizations == nil {
+				awsOrganizations = organizations.New(awsSession)
+			}
+			ouAccounts, ouAccountsErr := organizationalUnitAccounts(eachOU, awsOrganizations)
+			if ouAccountsErr != nil {
+				return nil, ouAccountsErr
+			}
+			logger.WithFields(logrus.Fields{
+				"OrganizationalUnit": eachOU,
+				"Accounts":           ouAccounts,
+			}).Info("Resolved StackSet organizational unit")
+			accounts = append(accounts, ouAccounts...)
+		}
+		resolved[eachIndex] = accounts
+	}
+	return resolved, nil
+}
+
+// stackSetInstanceOperations returns the instance operations that converge
+// the existing stack instances to the targets. Accounts that require the
+// same operation in the same regions are batched together. Existing
+// instances are only updated if the target includes ParameterOverrides.
+func stackSetInstanceOperations(targets []*StackSetTarget,
+	targetAccounts [][]string,
+	existingInstances map[string]bool) ([]*stackSetInstanceOperation, error) {
+
+	operations := make([]*stackSetInstanceOperation, 0)
+	claimedInstances := make(map[string]bool)
+	for eachIndex, eachTarget := range targets {
+		targetOperations := make(map[string]*stackSetInstanceOperation)
+		appendAccount := func(create bool, account string, regions []string) {
+			if len(regions) == 0 {
+				return
+			}
+			operationKey := fmt.Sprintf("%t:%s", create, strings.Join(regions, ","))
+			operation, operationExists := targetOperations[operationKey]
+			if !operationExists {
+				operation = &stackSetInstanceOperation{
+					create:             create,
+					regions:            regions,
+					parameterOverrides: eachTarget.ParameterOverrides,
+				}
+				targetOperations[operationKey] = operation
+			}
+			operation.accounts = append(operation.accounts, account)
+		}
+		for _, eachAccount := range targetAccounts[eachIndex] {
+			var createRegions []string
+			var updateRegions []string
+			for _, eachRegion := range eachTarget.Regions {
+				instanceKey := stackSetInstanceKey(eachAccount, eachRegion)
+				if claimedInstances[instanceKey] {
+					return nil, errors.Errorf("StackSet instance %s is included in multiple targets",
+						instanceKey)
+				}
+				claimedInstances[instanceKey] = true
+				if existingInstances[instanceKey] {
+					updateRegions = append(updateRegions, eachRegion)
+				} else {
+					createRegions = append(createRegions, eachRegion)
+				}
+			}
+			appendAccount(true, eachAccount, createRegions)
+			if len(eachTarget.ParameterOverrides) != 0 {
+				appendAccount(false, eachAccount, updateRegions)
+			}
+		}
+		// Stable ordering
+		operationKeys := make([]string, 0, len(targetOperations))
+		for eachKey := range targetOperations {
+			operationKeys = append(operationKeys, eachKey)
+		}
+		sort.Strings(operationKeys)
+		for _, eachKey := range operationKeys {
+			operations = append(operations, targetOperations[eachKey])
+		}
+	}
+	return operations, nil
+}
+
+// stackSetOperationPreferences returns the API preferences for the deployment
+func stackSetOperationPreferences(deployment *StackSetDeployment) *cloudformation.StackSetOperationPreferences {
+	preferences := &cloudformation.StackSetOperationPreferences{}
+	if deployment.MaxConcurrentPercentage != 0 {
+		preferences.MaxConcurrentPercentage = aws.Int64(deployment.MaxConcurrentPercentage)
+	}
+	if deployment.FailureTolerancePercentage != 0 {
+		preferences.FailureTolerancePercentage = aws.Int64(deployment.FailureTolerancePercentage)
+	}
+	return preferences
+}
+
+// waitForStackSetOperation polls the StackSet operation until it completes.
+// If the operation didn't succeed, the failed stack instances are logged.
+func waitForStackSetOperation(stackSetName string,
+	operationID string,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) error {
+
+	startTime := time.Now()
+	describeInput := &cloudformation.DescribeStackSetOperationInput{
+		StackSetName: aws.String(stackSetName),
+		OperationId:  aws.String(operationID),
+	}
+	operationStatus := ""
+	for operationStatus == "" {
+		time.Sleep(cloudformationPollingDelay())
+		describeOutput, describeErr := awsCloudFormation.DescribeStackSetOperation(describeInput)
+		if describeErr != nil {
+			return errors.Wrapf(describeErr, "Failed to describe StackSet operation")
+		}
+		switch status := aws.StringValue(describeOutput.StackSetOperation.Status); status {
+		case cloudformation.StackSetOperationStatusSucceeded,
+			cloudformation.StackSetOperationStatusFailed,
+			cloudformation.StackSetOperationStatusStopped:
+			operationStatus = status
+		default:
+			logger.WithFields(logrus.Fields{
+				"OperationId": operationID,
+				"Status":      status,
+				"Elapsed":     time.Since(startTime).Round(time.Second).String(),
+			}).Info("Waiting for StackSet operation to complete")
+		}
+	}
+	if operationStatus == cloudformation.StackSetOperationStatusSucceeded {
+		return nil
+	}
+	resultsInput := &cloudformation.ListStackSetOperationResultsInput{
+		StackSetName: aws.String(stackSetName),
+		OperationId:  aws.String(operationID),
+	}
+	for {
+		resultsOutput, resultsErr := awsCloudFormation.ListStackSetOperationResults(resultsInput)
+		if resultsErr != nil {
+			logger.WithField("Error", resultsErr).Warn("Failed to list StackSet operation results")
+			break
+		}
+		for _, eachResult := range resultsOutput.Summaries {
+			if aws.StringValue(eachResult.Status) == cloudformation.StackSetOperationResultStatusSucceeded {
+				continue
+			}
+			logger.WithFields(logrus.Fields{
+				"Account": aws.StringValue(eachResult.Account),
+				"Region":  aws.StringValue(eachResult.Region),
+				"Status":  aws.StringValue(eachResult.Status),
+				"Reason":  aws.StringValue(eachResult.StatusReason),
+			}).Error("StackSet instance operation failed")
+		}
+		if aws.StringValue(resultsOutput.NextToken) == "" {
+			break
+		}
+		resultsInput.NextToken = resultsOutput.NextToken
+	}
+	return errors.Errorf("StackSet %s operation %s: %s",
+		stackSetName,
+		operationID,
+		operationStatus)
+}
+
+// stackSetArtifactPolicy returns the bucket policy document with a
+// statement that allows the accounts to read the objects under the key
+// prefix. An existing statement with the same Sid is replaced.
+func stackSetArtifactPolicy(policyDocument string,
+	statementID string,
+	partition string,
+	s3Bucket string,
+	keyPrefix string,
+	accounts []string) (string, error) {
+
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+	}
+	if policyDocument != "" {
+		unmarshalErr := json.Unmarshal([]byte(policyDocument), &policy)
+		if unmarshalErr != nil {
+			return "", errors.Wrapf(unmarshalErr, "Failed to parse bucket policy for: %s", s3Bucket)
+		}
+	}
+	// Statement may be a single object or a list
+	statements := make([]interface{}, 0)
+	switch existingStatements := policy["Statement"].(type) {
+	case []interface{}:
+		statements = existingStatements
+	case map[string]interface{}:
+		statements = append(statements, existingStatements)
+	}
+	policyStatements := make([]interface{}, 0, len(statements)+1)
+	for _, eachStatement := range statements {
+		if statementMap, statementMapOk := eachStatement.(map[string]interface{}); statementMapOk &&
+			statementMap["Sid"] == statementID {
+			continue
+		}
+		policyStatements = append(policyStatements, eachStatement)
+	}
+	sortedAccounts := append([]string{}, accounts...)
+	sort.Strings(sortedAccounts)
+	policyStatements = append(policyStatements, map[string]interface{}{
+		"Sid":    statementID,
+		"Effect": "Allow",
+		"Principal": map[string]interface{}{
+			"AWS": sortedAccounts,
+		},
+		"Action": []string{"s3:GetObject", "s3:GetObjectVersion"},
+		"Resource": fmt.Sprintf("arn:%s:s3:::%s/%s/*",
+			partition,
+			s3Bucket,
+			keyPrefix),
+	})
+	policy["Statement"] = policyStatements
+	policyJSON, policyJSONErr := json.Marshal(policy)
+	if policyJSONErr != nil {
+		return "", errors.Wrapf(policyJSONErr, "Failed to marshal bucket policy for: %s", s3Bucket)
+	}
+	return string(policyJSON), nil
+}
+
+// ensureStackSetArtifactAccess updates the artifact bucket policy so that
+// the stack instances in the target accounts can read the Lambda code and
+// the other service artifacts
+func ensureStackSetArtifactAccess(stackSetName string,
+	s3Bucket string,
+	keyPrefix string,
+	accounts []string,
+	awsSession *session.Session,
+	s3Svc s3iface.S3API,
+	logger *logrus.Logger) error {
+
+	partition := "aws"
+	if regionPartition, regionPartitionOk := endpoints.PartitionForRegion(endpoints.DefaultPartitions(),
+		aws.StringValue(awsSession.Config.Region)); regionPartitionOk {
+		partition = regionPartition.ID()
+	}
+	policyDocument := ""
+	getPolicyOutput, getPolicyErr := s3Svc.GetBucketPolicy(&s3.GetBucketPolicyInput{
+		Bucket: aws.String(s3Bucket),
+	})
+	if getPolicyErr != nil {
+		awsErr, awsErrOk := getPolicyErr.(awserr.Error)
+		if !awsErrOk || awsErr.Code() != "NoSuchBucketPolicy" {
+			return errors.Wrapf(getPolicyErr, "Failed to get bucket policy for: %s", s3Bucket)
+		}
+	} else {
+		policyDocument = aws.StringValue(getPolicyOutput.Policy)
+	}
+	// Sids are alphanumeric
+	statementID := fmt.Sprintf("SpartaStackSet%s",
+		reInvalidStackSetSidChars.ReplaceAllString(stackSetName, ""))
+	policy, policyErr := stackSetArtifactPolicy(policyDocument,
+		statementID,
+		partition,
+		s3Bucket,
+		keyPrefix,
+		accounts)
+	if policyErr != nil {
+		return policyErr
+	}
+	_, putPolicyErr := s3Svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(s3Bucket),
+		Policy: aws.String(policy),
+	})
+	if putPolicyErr != nil {
+		return errors.Wrapf(putPolicyErr, "Failed to update bucket policy for: %s", s3Bucket)
+	}
+	logger.WithFields(logrus.Fields{
+		"Bucket":   s3Bucket,
+		"Sid":      statementID,
+		"Accounts": len(accounts),
+	}).Info("Granted StackSet accounts access to the service artifacts")
+	return nil
+}
+
+// ConvergeStackSetState publishes the template as a CloudFormation
+// StackSet and ensures a stack instance exists for every target account
+// and region. Existing stack instances are updated with the new template.
+// Stack instances that aren't included in the deployment are logged but
+// not deleted. The artifacts are expected under the serviceName prefix of
+// s3Bucket.
+func ConvergeStackSetState(serviceName string,
+	cfTemplate *gocf.Template,
+	s3Bucket string,
+	templateURL string,
+	tags map[string]string,
+	deployment *StackSetDeployment,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+	return ConvergeStackSetStateWithClients(serviceName,
+		cfTemplate,
+		s3Bucket,
+		templateURL,
+		tags,
+		deployment,
+		nil,
+		awsSession,
+		cloudformation.New(awsSession),
+		s3.New(awsSession),
+		logger)
+}
+
+// ConvergeStackSetStateWithClients is ConvergeStackSetState with the given
+// CloudFormation and S3 clients and optional ChangeSetOptions. The options
+// Parameters and Capabilities apply to the StackSet. The session resolves
+// the Organizations accounts and the artifact bucket partition.
+func ConvergeStackSetStateWithClients(serviceName string,
+	cfTemplate *gocf.Template,
+	s3Bucket string,
+	templateURL string,
+	tags map[string]string,
+	deployment *StackSetDeployment,
+	options *ChangeSetOptions,
+	awsSession *session.Session,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	s3Svc s3iface.S3API,
+	logger *logrus.Logger) error {
+
+	stackSetName := deployment.StackSetName
+	if stackSetName == "" {
+		stackSetName = serviceName
+	}
+	targetAccounts, targetAccountsErr := resolveStackSetTargets(deployment.Targets,
+		awsSession,
+		logger)
+	if targetAccountsErr != nil {
+		return targetAccountsErr
+	}
+	if deployment.GrantArtifactAccess {
+		accounts := make([]string, 0)
+		for _, eachTargetAccounts := range targetAccounts {
+			accounts = append(accounts, eachTargetAccounts...)
+		}
+		accessErr := ensureStackSetArtifactAccess(stackSetName,
+			s3Bucket,
+			serviceName,
+			accounts,
+			awsSession,
+			s3Svc,
+			logger)
+		if accessErr != nil {
+			return accessErr
+		}
+	}
+	awsTags := make([]*cloudformation.Tag, 0)
+	for eachKey, eachValue := range tags {
+		awsTags = append(awsTags, &cloudformation.Tag{
+			Key:   aws.String(eachKey),
+			Value: aws.String(eachValue),
+		})
+	}
+	operationPreferences := stackSetOperationPreferences(deployment)
+
+	// Create or update the StackSet
+	_, describeErr := awsCloudFormation.DescribeStackSet(&cloudformation.DescribeStackSetInput{
+		StackSetName: aws.String(stackSetName),
+	})
+	stackSetExists := true
+	if describeErr != nil {
+		awsErr, awsErrOk := describeErr.(awserr.Error)
+		if !awsErrOk || awsErr.Code() != cloudformation.ErrCodeStackSetNotFoundException {
+			return errors.Wrapf(describeErr, "Failed to describe StackSet: %s", stackSetName)
+		}
+		stackSetExists = false
+	}
+	existingInstances := make(map[string]bool)
+	if !stackSetExists {
+		createInput := &cloudformation.CreateStackSetInput{
+			StackSetName: aws.String(stackSetName),
+			TemplateURL:  aws.String(templateURL),
+			Parameters:   options.stackParameters(cloudformation.ChangeSetTypeCreate, logger),
+			Capabilities: options.stackCapabilities(cfTemplate),
+			Description:  aws.String(fmt.Sprintf("Sparta service: %s", serviceName)),
+		}
+		if len(awsTags) != 0 {
+			createInput.Tags = awsTags
+		}
+		if deployment.AdministrationRoleARN != "" {
+			createInput.AdministrationRoleARN = aws.String(deployment.AdministrationRoleARN)
+		}
+		if deployment.ExecutionRoleName != "" {
+			createInput.ExecutionRoleName = aws.String(deployment.ExecutionRoleName)
+		}
+		_, createErr := awsCloudFormation.CreateStackSet(createInput)
+		if createErr != nil {
+			return errors.Wrapf(createErr, "Failed to create StackSet: %s", stackSetName)
+		}
+		logger.WithField("StackSetName", stackSetName).Info("Created StackSet")
+	} else {
+		listInput := &cloudformation.ListStackInstancesInput{
+			StackSetName: aws.String(stackSetName),
+		}
+		for {
+			listOutput, listErr := awsCloudFormation.ListStackInstances(listInput)
+			if listErr != nil {
+				return errors.Wrapf(listErr, "Failed to list StackSet instances: %s", stackSetName)
+			}
+			for _, eachInstance := range listOutput.Summaries {
+				instanceKey := stackSetInstanceKey(aws.StringValue(eachInstance.Account),
+					aws.StringValue(eachInstance.Region))
+				existingInstances[instanceKey] = true
+			}
+			if aws.StringValue(listOutput.NextToken) == "" {
+				break
+			}
+			listInput.NextToken = listOutput.NextToken
+		}
+		updateInput := &cloudformation.UpdateStackSetInput{
+			StackSetName:         aws.String(stackSetName),
+			TemplateURL:          aws.String(templateURL),
+			Parameters:           options.stackParameters(cloudformation.ChangeSetTypeUpdate, logger),
+			Capabilities:         options.stackCapabilities(cfTemplate),
+			OperationPreferences: operationPreferences,
+		}
+		if len(awsTags) != 0 {
+			updateInput.Tags = awsTags
+		}
+		if deployment.AdministrationRoleARN != "" {
+			updateInput.AdministrationRoleARN = aws.String(deployment.AdministrationRoleARN)
+		}
+		if deployment.ExecutionRoleName != "" {
+			updateInput.ExecutionRoleName = aws.String(deployment.ExecutionRoleName)
+		}
+		updateOutput, updateErr := awsCloudFormation.UpdateStackSet(updateInput)
+		if updateErr != nil {
+			return errors.Wrapf(updateErr, "Failed to update StackSet: %s", stackSetName)
+		}
+		logger.WithFields(logrus.Fields{
+			"StackSetName": stackSetName,
+			"Instances":    len(existingInstances),
+		}).Info("Updating StackSet")
+		waitErr := waitForStackSetOperation(stackSetName,
+			aws.StringValue(updateOutput.OperationId),
+			awsCloudFormation,
+			logger)
+		if waitErr != nil {
+			return waitErr
+		}
+	}
+
+	// Converge the stack instances
+	operations, operationsErr := stackSetInstanceOperations(deployment.Targets,
+		targetAccounts,
+		existingInstances)
+	if operationsErr != nil {
+		return operationsErr
+	}
+	for _, eachOperation := range operations {
+		parameterOverrides := make([]*cloudformation.Parameter, 0)
+		for eachKey, eachValue := range eachOperation.parameterOverrides {
+			parameterOverrides = append(parameterOverrides, &cloudformation.Parameter{
+				ParameterKey:   aws.String(eachKey),
+				ParameterValue: aws.String(eachValue),
+			})
+		}
+		operationID := ""
+		if eachOperation.create {
+			createOutput, createErr := awsCloudFormation.CreateStackInstances(&cloudformation.CreateStackInstancesInput{
+				StackSetName:         aws.String(stackSetName),
+				Accounts:             aws.StringSlice(eachOperation.accounts),
+				Regions:              aws.StringSlice(eachOperation.regions),
+				ParameterOverrides:   parameterOverrides,
+				OperationPreferences: operationPreferences,
+			})
+			if createErr != nil {
+				return errors.Wrapf(createErr, "Failed to create StackSet instances")
+			}
+			operationID = aws.StringValue(createOutput.OperationId)
+		} else {
+			updateOutput, updateErr := awsCloudFormation.UpdateStackInstances(&cloudformation.UpdateStackInstancesInput{
+				StackSetName:         aws.String(stackSetName),
+				Accounts:             aws.StringSlice(eachOperation.accounts),
+				Regions:              aws.StringSlice(eachOperation.regions),
+				ParameterOverrides:   parameterOverrides,
+				OperationPreferences: operationPreferences,
+			})
+			if updateErr != nil {
+				return errors.Wrapf(updateErr, "Failed to update StackSet instances")
+			}
+			operationID = aws.StringValue(updateOutput.OperationId)
+		}
+		logger.WithFields(logrus.Fields{
+			"Create":   eachOperation.create,
+			"Accounts": eachOperation.accounts,
+			"Regions":  eachOperation.regions,
+		}).Info("Converging StackSet instances")
+		waitErr := waitForStackSetOperation(stackSetName,
+			operationID,
+			awsCloudFormation,
+			logger)
+		if waitErr != nil {
+			return waitErr
+		}
+	}
+
+	// Instances we don't manage
+	targetInstances := make(map[string]bool)
+	for eachIndex, eachTarget := range deployment.Targets {
+		for _, eachAccount := range targetAccounts[eachIndex] {
+			for _, eachRegion := range eachTarget.Regions {
+				targetInstances[stackSetInstanceKey(eachAccount, eachRegion)] = true
+			}
+		}
+	}
+	for eachInstance := range existingInstances {
+		if !targetInstances[eachInstance] {
+			logger.WithField("Instance", eachInstance).
+				Warn("StackSet instance is not included in the deployment targets and was not deleted")
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"StackSetName": stackSetName,
+		"Instances":    len(targetInstances),
+	}).Info("StackSet provisioned")
+	return nil
+}
+
+//
+// END - StackSets
+////////////////////////////////////////////////////////////////////////////////
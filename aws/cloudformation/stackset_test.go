@@ -0,0 +1,298 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+// mockStackSetCloudFormation records the StackSet create and update
+// requests. The StackSet exists if exists is true and every operation
+// succeeds.
+type mockStackSetCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	exists      bool
+	createInput *cloudformation.CreateStackSetInput
+	updateInput *cloudformation.UpdateStackSetInput
+}
+
+func (mockCF *mockStackSetCloudFormation) DescribeStackSet(input *cloudformation.DescribeStackSetInput) (*cloudformation.DescribeStackSetOutput, error) {
+	if !mockCF.exists {
+		return nil, awserr.New(cloudformation.ErrCodeStackSetNotFoundException, "not found", nil)
+	}
+	return &cloudformation.DescribeStackSetOutput{}, nil
+}
+
+func (mockCF *mockStackSetCloudFormation) CreateStackSet(input *cloudformation.CreateStackSetInput) (*cloudformation.CreateStackSetOutput, error) {
+	mockCF.createInput = input
+	return &cloudformation.CreateStackSetOutput{}, nil
+}
+
+func (mockCF *mockStackSetCloudFormation) ListStackInstances(input *cloudformation.ListStackInstancesInput) (*cloudformation.ListStackInstancesOutput, error) {
+	return &cloudformation.ListStackInstancesOutput{}, nil
+}
+
+func (mockCF *mockStackSetCloudFormation) UpdateStackSet(input *cloudformation.UpdateStackSetInput) (*cloudformation.UpdateStackSetOutput, error) {
+	mockCF.updateInput = input
+	return &cloudformation.UpdateStackSetOutput{
+		OperationId: aws.String("operation-id"),
+	}, nil
+}
+
+func (mockCF *mockStackSetCloudFormation) DescribeStackSetOperation(input *cloudformation.DescribeStackSetOperationInput) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	return &cloudformation.DescribeStackSetOperationOutput{
+		StackSetOperation: &cloudformation.StackSetOperation{
+			Status: aws.String(cloudformation.StackSetOperationStatusSucceeded),
+		},
+	}, nil
+}
+
+func TestNewStackSetDeployment(t *testing.T) {
+	deployment, deploymentErr := NewStackSetDeployment(strings.NewReader(`{
+		"StackSetName": "MyStackSet",
+		"MaxConcurrentPercentage": 25,
+		"Targets": [{
+			"Accounts": ["111111111111"],
+			"OrganizationalUnits": ["ou-ab12-cdef3456"],
+			"Regions": ["us-west-2"],
+			"ParameterOverrides": {"Stage": "prod"}
+		}]
+	}`))
+	if deploymentErr != nil {
+		t.Fatalf("Failed to parse StackSet deployment: %s", deploymentErr)
+	}
+	if deployment.StackSetName != "MyStackSet" ||
+		len(deployment.Targets) != 1 ||
+		deployment.Targets[0].ParameterOverrides["Stage"] != "prod" {
+		t.Fatalf("Unexpected StackSet deployment: %#v", deployment)
+	}
+
+	invalidDeployments := []string{
+		`{"Targets": []}`,
+		`{"Targets": [{"Regions": ["us-west-2"]}]}`,
+		`{"Targets": [{"Accounts": ["111111111111"]}]}`,
+		`{"MaxConcurrentPercentage": 101, "Targets": [{"Accounts": ["111111111111"], "Regions": ["us-west-2"]}]}`,
+	}
+	for _, eachDeployment := range invalidDeployments {
+		_, invalidErr := NewStackSetDeployment(strings.NewReader(eachDeployment))
+		if invalidErr == nil {
+			t.Fatalf("Failed to reject invalid StackSet deployment: %s", eachDeployment)
+		}
+	}
+}
+
+func TestStackSetInstanceOperations(t *testing.T) {
+	targets := []*StackSetTarget{
+		{
+			Regions: []string{"us-east-1", "us-west-2"},
+		},
+		{
+			Regions:            []string{"eu-west-1"},
+			ParameterOverrides: map[string]string{"Stage": "prod"},
+		},
+	}
+	targetAccounts := [][]string{
+		{"111111111111", "222222222222"},
+		{"333333333333"},
+	}
+	existingInstances := map[string]bool{
+		stackSetInstanceKey("222222222222", "us-west-2"): true,
+		stackSetInstanceKey("333333333333", "eu-west-1"): true,
+	}
+	operations, operationsErr := stackSetInstanceOperations(targets,
+		targetAccounts,
+		existingInstances)
+	if operationsErr != nil {
+		t.Fatalf("Failed to compute StackSet operations: %s", operationsErr)
+	}
+	if len(operations) != 3 {
+		t.Fatalf("Expected 3 StackSet operations, got: %d", len(operations))
+	}
+	// Accounts that need the same regions are batched
+	expected := []struct {
+		create   bool
+		accounts string
+		regions  string
+	}{
+		{true, "222222222222", "us-east-1"},
+		{true, "111111111111", "us-east-1,us-west-2"},
+		{false, "333333333333", "eu-west-1"},
+	}
+	for eachIndex, eachExpected := range expected {
+		operation := operations[eachIndex]
+		if operation.create != eachExpected.create ||
+			strings.Join(operation.accounts, ",") != eachExpected.accounts ||
+			strings.Join(operation.regions, ",") != eachExpected.regions {
+			t.Fatalf("Unexpected StackSet operation %d: %#v", eachIndex, operation)
+		}
+	}
+	if operations[2].parameterOverrides["Stage"] != "prod" {
+		t.Fatalf("Failed to apply ParameterOverrides: %#v", operations[2])
+	}
+
+	// Instances can only be managed by a single target
+	duplicateAccounts := [][]string{
+		{"111111111111"},
+		{"111111111111"},
+	}
+	targets[1].Regions = []string{"us-west-2"}
+	_, duplicateErr := stackSetInstanceOperations(targets,
+		duplicateAccounts,
+		existingInstances)
+	if duplicateErr == nil {
+		t.Fatalf("Failed to reject duplicate StackSet instance")
+	}
+}
+
+func TestStackSetArtifactPolicy(t *testing.T) {
+	existingPolicy := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Sid": "Existing", "Effect": "Deny", "Principal": "*", "Action": "s3:DeleteBucket", "Resource": "arn:aws:s3:::my-bucket"},
+			{"Sid": "SpartaStackSetMyService", "Effect": "Allow", "Principal": {"AWS": ["999999999999"]}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::my-bucket/MyService/*"}
+		]
+	}`
+	policyJSON, policyErr := stackSetArtifactPolicy(existingPolicy,
+		"SpartaStackSetMyService",
+		"aws-cn",
+		"my-bucket",
+		"MyService",
+		[]string{"222222222222", "111111111111"})
+	if policyErr != nil {
+		t.Fatalf("Failed to create bucket policy: %s", policyErr)
+	}
+	policy := struct {
+		Statement []struct {
+			Sid       string
+			Principal interface{}
+			Action    interface{}
+			Resource  string
+		}
+	}{}
+	unmarshalErr := json.Unmarshal([]byte(policyJSON), &policy)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to parse bucket policy: %s", unmarshalErr)
+	}
+	if len(policy.Statement) != 2 ||
+		policy.Statement[0].Sid != "Existing" ||
+		policy.Statement[1].Sid != "SpartaStackSetMyService" {
+		t.Fatalf("Unexpected bucket policy statements: %s", policyJSON)
+	}
+	grant := policy.Statement[1]
+	principal, principalOk := grant.Principal.(map[string]interface{})
+	if !principalOk {
+		t.Fatalf("Unexpected bucket policy principal: %#v", grant.Principal)
+	}
+	accounts, accountsOk := principal["AWS"].([]interface{})
+	if !accountsOk ||
+		len(accounts) != 2 ||
+		accounts[0] != "111111111111" ||
+		accounts[1] != "222222222222" {
+		t.Fatalf("Unexpected bucket policy accounts: %#v", principal["AWS"])
+	}
+	if grant.Resource != "arn:aws-cn:s3:::my-bucket/MyService/*" {
+		t.Fatalf("Unexpected bucket policy resource: %s", grant.Resource)
+	}
+
+	// Empty policies are created
+	emptyPolicyJSON, emptyPolicyErr := stackSetArtifactPolicy("",
+		"SpartaStackSetMyService",
+		"aws",
+		"my-bucket",
+		"MyService",
+		[]string{"111111111111"})
+	if emptyPolicyErr != nil {
+		t.Fatalf("Failed to create bucket policy: %s", emptyPolicyErr)
+	}
+	if !strings.Contains(emptyPolicyJSON, `"Version":"2012-10-17"`) {
+		t.Fatalf("Unexpected bucket policy: %s", emptyPolicyJSON)
+	}
+}
+
+func TestConvergeStackSetStateOptions(t *testing.T) {
+	defaultPollingDelay := cloudformationPollingDelay
+	cloudformationPollingDelay = func() time.Duration {
+		return time.Millisecond
+	}
+	defer func() {
+		cloudformationPollingDelay = defaultPollingDelay
+	}()
+	logger := logrus.New()
+	options := &ChangeSetOptions{
+		Parameters: []*cloudformation.Parameter{
+			{
+				ParameterKey:   aws.String("Stage"),
+				ParameterValue: aws.String("prod"),
+			},
+			{
+				ParameterKey:     aws.String("Version"),
+				UsePreviousValue: aws.Bool(true),
+			},
+		},
+		Capabilities: []string{cloudformation.CapabilityCapabilityNamedIam},
+	}
+	deployment := &StackSetDeployment{}
+
+	// New StackSets ignore UsePreviousValue parameters
+	mockCF := &mockStackSetCloudFormation{}
+	convergeErr := ConvergeStackSetStateWithClients("MyService",
+		gocf.NewTemplate(),
+		"bucket",
+		"https://bucket.s3.amazonaws.com/template.json",
+		nil,
+		deployment,
+		options,
+		nil,
+		mockCF,
+		nil,
+		logger)
+	if convergeErr != nil {
+		t.Fatalf("Failed to create StackSet: %s", convergeErr)
+	}
+	if mockCF.createInput == nil {
+		t.Fatalf("Failed to create StackSet")
+	}
+	if len(mockCF.createInput.Parameters) != 1 ||
+		aws.StringValue(mockCF.createInput.Parameters[0].ParameterKey) != "Stage" {
+		t.Fatalf("Unexpected CreateStackSet Parameters: %#v", mockCF.createInput.Parameters)
+	}
+	if strings.Join(aws.StringValueSlice(mockCF.createInput.Capabilities), ",") !=
+		cloudformation.CapabilityCapabilityNamedIam {
+		t.Fatalf("Unexpected CreateStackSet Capabilities: %#v", mockCF.createInput.Capabilities)
+	}
+
+	// Existing StackSets receive every parameter
+	mockCF = &mockStackSetCloudFormation{exists: true}
+	convergeErr = ConvergeStackSetStateWithClients("MyService",
+		gocf.NewTemplate(),
+		"bucket",
+		"https://bucket.s3.amazonaws.com/template.json",
+		nil,
+		deployment,
+		options,
+		nil,
+		mockCF,
+		nil,
+		logger)
+	if convergeErr != nil {
+		t.Fatalf("Failed to update StackSet: %s", convergeErr)
+	}
+	if mockCF.updateInput == nil {
+		t.Fatalf("Failed to update StackSet")
+	}
+	if len(mockCF.updateInput.Parameters) != 2 {
+		t.Fatalf("Unexpected UpdateStackSet Parameters: %#v", mockCF.updateInput.Parameters)
+	}
+	if strings.Join(aws.StringValueSlice(mockCF.updateInput.Capabilities), ",") !=
+		cloudformation.CapabilityCapabilityNamedIam {
+		t.Fatalf("Unexpected UpdateStackSet Capabilities: %#v", mockCF.updateInput.Capabilities)
+	}
+}
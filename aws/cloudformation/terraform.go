@@ -0,0 +1,1079 @@
+package cloudformation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Terraform
+//
+
+// tfStackNameVariable is the variable that replaces the AWS::StackName
+// pseudo parameter
+const tfStackNameVariable = "stack_name"
+
+var reTFIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// tfExpression is a raw HCL expression (eg, a resource attribute reference)
+type tfExpression string
+
+// tfAttribute is an HCL attribute or nested block. Exactly one of
+// value or block is set.
+type tfAttribute struct {
+	name  string
+	value interface{}
+	block []*tfAttribute
+}
+
+// tfResource is a Terraform resource converted from a CloudFormation resource
+type tfResource struct {
+	resourceType string
+	name         string
+	attributes   []*tfAttribute
+}
+
+// tfResourceType describes how a CloudFormation resource type is converted
+type tfResourceType struct {
+	// resourceType is the Terraform resource type
+	resourceType string
+	// refAttribute is the Terraform attribute equivalent to Ref
+	refAttribute string
+	// getAttAttributes maps Fn::GetAtt attribute names to Terraform attributes
+	getAttAttributes map[string]string
+	// convert returns the Terraform resources
+	convert func(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error)
+}
+
+// tfResourceTypes are the CloudFormation resource types that can be exported
+var tfResourceTypes = map[string]*tfResourceType{
+	"AWS::Lambda::Function": {
+		resourceType:     "aws_lambda_function",
+		refAttribute:     "function_name",
+		getAttAttributes: map[string]string{"Arn": "arn"},
+		convert:          tfLambdaFunction,
+	},
+	"AWS::IAM::Role": {
+		resourceType:     "aws_iam_role",
+		refAttribute:     "name",
+		getAttAttributes: map[string]string{"Arn": "arn", "RoleId": "unique_id"},
+		convert:          tfIAMRole,
+	},
+	"AWS::IAM::Policy": {
+		resourceType: "aws_iam_role_policy",
+		refAttribute: "id",
+		convert:      tfIAMPolicy,
+	},
+	"AWS::Lambda::Permission": {
+		resourceType: "aws_lambda_permission",
+		refAttribute: "id",
+		convert: tfSimpleResource("aws_lambda_permission", map[string]string{
+			"Action":           "action",
+			"EventSourceToken": "event_source_token",
+			"FunctionName":     "function_name",
+			"Principal":        "principal",
+			"SourceAccount":    "source_account",
+			"SourceArn":        "source_arn",
+		}),
+	},
+	"AWS::Lambda::EventSourceMapping": {
+		resourceType: "aws_lambda_event_source_mapping",
+		refAttribute: "uuid",
+		convert: tfSimpleResource("aws_lambda_event_source_mapping", map[string]string{
+			"BatchSize":                      "batch_size",
+			"BisectBatchOnFunctionError":     "bisect_batch_on_function_error",
+			"Enabled":                        "enabled",
+			"EventSourceArn":                 "event_source_arn",
+			"FunctionName":                   "function_name",
+			"MaximumBatchingWindowInSeconds": "maximum_batching_window_in_seconds",
+			"MaximumRecordAgeInSeconds":      "maximum_record_age_in_seconds",
+			"MaximumRetryAttempts":           "maximum_retry_attempts",
+			"ParallelizationFactor":          "parallelization_factor",
+			"StartingPosition":               "starting_position",
+		}),
+	},
+	"AWS::Events::Rule": {
+		resourceType:     "aws_cloudwatch_event_rule",
+		refAttribute:     "name",
+		getAttAttributes: map[string]string{"Arn": "arn"},
+		convert:          tfEventsRule,
+	},
+	"AWS::SNS::Topic": {
+		resourceType:     "aws_sns_topic",
+		refAttribute:     "arn",
+		getAttAttributes: map[string]string{"TopicName": "name"},
+		convert: tfSimpleResource("aws_sns_topic", map[string]string{
+			"DisplayName": "display_name",
+			"TopicName":   "name",
+		}),
+	},
+	"AWS::SNS::Subscription": {
+		resourceType: "aws_sns_topic_subscription",
+		refAttribute: "arn",
+		convert: tfSimpleResource("aws_sns_topic_subscription", map[string]string{
+			"Endpoint": "endpoint",
+			"Protocol": "protocol",
+			"TopicArn": "topic_arn",
+		}),
+	},
+	"AWS::SQS::Queue": {
+		resourceType:     "aws_sqs_queue",
+		refAttribute:     "url",
+		getAttAttributes: map[string]string{"Arn": "arn", "QueueName": "name"},
+		convert: tfSimpleResource("aws_sqs_queue", map[string]string{
+			"DelaySeconds":           "delay_seconds",
+			"MessageRetentionPeriod": "message_retention_seconds",
+			"QueueName":              "name",
+			"VisibilityTimeout":      "visibility_timeout_seconds",
+		}),
+	},
+	"AWS::Logs::LogGroup": {
+		resourceType:     "aws_cloudwatch_log_group",
+		refAttribute:     "name",
+		getAttAttributes: map[string]string{"Arn": "arn"},
+		convert: tfSimpleResource("aws_cloudwatch_log_group", map[string]string{
+			"LogGroupName":    "name",
+			"RetentionInDays": "retention_in_days",
+		}),
+	},
+}
+
+// tfPseudoParameters are the Terraform equivalents of the supported
+// CloudFormation pseudo parameters. The data source is declared if
+// the parameter is used.
+var tfPseudoParameters = map[string][2]string{
+	"AWS::AccountId": {"data.aws_caller_identity.current.account_id", `data "aws_caller_identity" "current" {}`},
+	"AWS::Partition": {"data.aws_partition.current.partition", `data "aws_partition" "current" {}`},
+	"AWS::Region":    {"data.aws_region.current.name", `data "aws_region" "current" {}`},
+	"AWS::StackName": {"var." + tfStackNameVariable, ""},
+	// There isn't a stack, so the stack name is the best available identifier
+	"AWS::StackId":   {"var." + tfStackNameVariable, ""},
+	"AWS::URLSuffix": {"data.aws_partition.current.dns_suffix", `data "aws_partition" "current" {}`},
+}
+
+// tfConverter converts CloudFormation values to Terraform values
+type tfConverter struct {
+	// resourceTypes are the supported resource types
+	resourceTypes map[string]*tfResourceType
+	resources     map[string]interface{}
+	// exported are the logical names of the exported resources
+	exported map[string]bool
+	// parameters are the template Parameter names
+	parameters map[string]bool
+	// dataSources are the data sources used by pseudo parameters
+	dataSources map[string]bool
+	// codePaths maps Lambda Code S3Keys to local archive paths
+	codePaths map[string]string
+}
+
+// reference returns the Terraform expression for the Ref or Fn::GetAtt
+func (converter *tfConverter) reference(name string, attribute string) (tfExpression, error) {
+	if attribute == "" {
+		if pseudoParam, pseudoParamExists := tfPseudoParameters[name]; pseudoParamExists {
+			if pseudoParam[1] != "" {
+				converter.dataSources[pseudoParam[1]] = true
+			}
+			return tfExpression(pseudoParam[0]), nil
+		}
+		if converter.parameters[name] {
+			return tfExpression(fmt.Sprintf("var.%s", name)), nil
+		}
+	}
+	if !converter.exported[name] {
+		return "", errors.Errorf("Reference to unsupported resource: %s", name)
+	}
+	resourceType, _ := samResourceMap(converter.resources[name])["Type"].(string)
+	typeInfo := converter.resourceTypes[resourceType]
+	tfAttributeName := typeInfo.refAttribute
+	if attribute != "" {
+		tfAttributeName = typeInfo.getAttAttributes[attribute]
+		if tfAttributeName == "" {
+			return "", errors.Errorf("Unsupported attribute: %s.%s", name, attribute)
+		}
+	}
+	return tfExpression(fmt.Sprintf("%s.%s.%s", typeInfo.resourceType, name, tfAttributeName)), nil
+}
+
+// subExpression returns the HCL template string for the Fn::Sub value
+func (converter *tfConverter) subExpression(subString string, variables map[string]interface{}) (tfExpression, error) {
+	var output bytes.Buffer
+	output.WriteString(`"`)
+	remaining := subString
+	for remaining != "" {
+		start := strings.Index(remaining, "${")
+		if start < 0 {
+			output.WriteString(tfEscapeString(remaining))
+			break
+		}
+		output.WriteString(tfEscapeString(remaining[:start]))
+		end := strings.Index(remaining[start:], "}")
+		if end < 0 {
+			return "", errors.Errorf("Invalid Fn::Sub string: %s", subString)
+		}
+		name := remaining[start+2 : start+end]
+		remaining = remaining[start+end+1:]
+		if strings.HasPrefix(name, "!") {
+			output.WriteString(tfEscapeString("${" + name[1:] + "}"))
+			continue
+		}
+		var expr tfExpression
+		var exprErr error
+		if variableValue, variableExists := variables[name]; variableExists {
+			expr, exprErr = converter.expression(variableValue)
+		} else {
+			nameParts := strings.SplitN(name, ".", 2)
+			if len(nameParts) == 2 {
+				expr, exprErr = converter.reference(nameParts[0], nameParts[1])
+			} else {
+				expr, exprErr = converter.reference(name, "")
+			}
+		}
+		if exprErr != nil {
+			return "", exprErr
+		}
+		output.WriteString(fmt.Sprintf("${%s}", expr))
+	}
+	output.WriteString(`"`)
+	return tfExpression(output.String()), nil
+}
+
+// intrinsic returns the Terraform expression for the intrinsic function
+func (converter *tfConverter) intrinsic(fnName string, args interface{}) (tfExpression, error) {
+	argList, _ := args.([]interface{})
+	expressionList := func(values []interface{}) ([]string, error) {
+		expressions := make([]string, len(values))
+		for eachIndex, eachValue := range values {
+			expr, exprErr := converter.expression(eachValue)
+			if exprErr != nil {
+				return nil, exprErr
+			}
+			expressions[eachIndex] = string(expr)
+		}
+		return expressions, nil
+	}
+	switch fnName {
+	case "Ref":
+		refName, _ := args.(string)
+		return converter.reference(refName, "")
+	case "Fn::GetAtt":
+		if len(argList) == 2 {
+			resourceName, _ := argList[0].(string)
+			attrName, _ := argList[1].(string)
+			return converter.reference(resourceName, attrName)
+		}
+	case "Fn::Sub":
+		if subString, subStringOk := args.(string); subStringOk {
+			return converter.subExpression(subString, nil)
+		}
+		if len(argList) == 2 {
+			subString, subStringOk := argList[0].(string)
+			if subStringOk {
+				return converter.subExpression(subString, samResourceMap(argList[1]))
+			}
+		}
+	case "Fn::Join":
+		if len(argList) == 2 {
+			parts, partsOk := argList[1].([]interface{})
+			if partsOk {
+				delimiter, delimiterErr := converter.expression(argList[0])
+				expressions, expressionsErr := expressionList(parts)
+				if delimiterErr == nil && expressionsErr == nil {
+					return tfExpression(fmt.Sprintf("join(%s, [%s])",
+						delimiter,
+						strings.Join(expressions, ", "))), nil
+				}
+				if delimiterErr != nil {
+					return "", delimiterErr
+				}
+				return "", expressionsErr
+			}
+		}
+	case "Fn::Select":
+		expressions, expressionsErr := expressionList(argList)
+		if expressionsErr != nil {
+			return "", expressionsErr
+		}
+		if len(expressions) == 2 {
+			return tfExpression(fmt.Sprintf("element(%s, %s)", expressions[1], expressions[0])), nil
+		}
+	case "Fn::Split":
+		expressions, expressionsErr := expressionList(argList)
+		if expressionsErr != nil {
+			return "", expressionsErr
+		}
+		if len(expressions) == 2 {
+			return tfExpression(fmt.Sprintf("split(%s, %s)", expressions[0], expressions[1])), nil
+		}
+	case "Fn::Base64":
+		expr, exprErr := converter.expression(args)
+		if exprErr != nil {
+			return "", exprErr
+		}
+		return tfExpression(fmt.Sprintf("base64encode(%s)", expr)), nil
+	}
+	return "", errors.Errorf("Unsupported intrinsic function: %s", fnName)
+}
+
+// value returns the Terraform value for the CloudFormation value. Intrinsic
+// functions are returned as tfExpression values.
+func (converter *tfConverter) value(cfValue interface{}) (interface{}, error) {
+	switch typedValue := cfValue.(type) {
+	case map[string]interface{}:
+		if len(typedValue) == 1 {
+			for eachKey, eachValue := range typedValue {
+				if eachKey == "Ref" || strings.HasPrefix(eachKey, "Fn::") {
+					return converter.intrinsic(eachKey, eachValue)
+				}
+			}
+		}
+		object := make(map[string]interface{})
+		for eachKey, eachValue := range typedValue {
+			converted, convertedErr := converter.value(eachValue)
+			if convertedErr != nil {
+				return nil, convertedErr
+			}
+			object[eachKey] = converted
+		}
+		return object, nil
+	case []interface{}:
+		list := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			converted, convertedErr := converter.value(eachValue)
+			if convertedErr != nil {
+				return nil, convertedErr
+			}
+			list[eachIndex] = converted
+		}
+		return list, nil
+	}
+	return cfValue, nil
+}
+
+// expression returns the single line HCL expression for the CloudFormation value
+func (converter *tfConverter) expression(cfValue interface{}) (tfExpression, error) {
+	converted, convertedErr := converter.value(cfValue)
+	if convertedErr != nil {
+		return "", convertedErr
+	}
+	var output bytes.Buffer
+	writeErr := tfWriteValue(&output, converted, -1)
+	return tfExpression(output.String()), writeErr
+}
+
+// tfEscapeString escapes the HCL template sequences in a string
+func tfEscapeString(value string) string {
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	// Remove the JSON quotes and trailing newline
+	escaped := strings.TrimSpace(quoted.String())
+	escaped = escaped[1 : len(escaped)-1]
+	escaped = strings.Replace(escaped, "${", "$${", -1)
+	return strings.Replace(escaped, "%{", "%%{", -1)
+}
+
+// tfWriteValue writes the HCL value. Objects and lists are written on
+// multiple lines unless the indent is negative.
+func tfWriteValue(output *bytes.Buffer, value interface{}, indent int) error {
+	switch typedValue := value.(type) {
+	case tfExpression:
+		output.WriteString(string(typedValue))
+	case nil:
+		output.WriteString("null")
+	case bool:
+		output.WriteString(fmt.Sprintf("%t", typedValue))
+	case json.Number:
+		output.WriteString(typedValue.String())
+	case string:
+		output.WriteString(`"` + tfEscapeString(typedValue) + `"`)
+	case []interface{}:
+		output.WriteString("[")
+		for eachIndex, eachValue := range typedValue {
+			if indent >= 0 {
+				output.WriteString("\n" + strings.Repeat("  ", indent+1))
+			} else if eachIndex != 0 {
+				output.WriteString(" ")
+			}
+			nextIndent := indent
+			if indent >= 0 {
+				nextIndent = indent + 1
+			}
+			if writeErr := tfWriteValue(output, eachValue, nextIndent); writeErr != nil {
+				return writeErr
+			}
+			if indent >= 0 {
+				output.WriteString(",")
+			}
+		}
+		if indent >= 0 && len(typedValue) != 0 {
+			output.WriteString("\n" + strings.Repeat("  ", indent))
+		}
+		output.WriteString("]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typedValue))
+		for eachKey := range typedValue {
+			keys = append(keys, eachKey)
+		}
+		sort.Strings(keys)
+		names := make([]string, len(keys))
+		values := make([]string, len(keys))
+		for eachIndex, eachKey := range keys {
+			names[eachIndex] = eachKey
+			if !reTFIdentifier.MatchString(eachKey) {
+				names[eachIndex] = `"` + tfEscapeString(eachKey) + `"`
+			}
+			nextIndent := indent
+			if indent >= 0 {
+				nextIndent = indent + 1
+			}
+			var value bytes.Buffer
+			if writeErr := tfWriteValue(&value, typedValue[eachKey], nextIndent); writeErr != nil {
+				return writeErr
+			}
+			values[eachIndex] = value.String()
+		}
+		if indent < 0 || len(keys) == 0 {
+			output.WriteString("{")
+			for eachIndex := range names {
+				if eachIndex != 0 {
+					output.WriteString(", ")
+				}
+				output.WriteString(names[eachIndex] + " = " + values[eachIndex])
+			}
+			output.WriteString("}")
+			break
+		}
+		output.WriteString("{\n")
+		tfWriteAligned(output, names, values, indent+1)
+		output.WriteString(strings.Repeat("  ", indent) + "}")
+	default:
+		return errors.Errorf("Unsupported Terraform value: %#v", value)
+	}
+	return nil
+}
+
+// tfWriteAligned writes the name = value lines with the equals signs of
+// consecutive single line values aligned, as `terraform fmt` does
+func tfWriteAligned(output *bytes.Buffer, names []string, values []string, indent int) {
+	for groupStart := 0; groupStart < len(names); {
+		groupEnd := groupStart + 1
+		for groupEnd < len(names) &&
+			!strings.Contains(values[groupEnd-1], "\n") {
+			groupEnd++
+		}
+		nameWidth := 0
+		for eachIndex := groupStart; eachIndex < groupEnd; eachIndex++ {
+			if len(names[eachIndex]) > nameWidth {
+				nameWidth = len(names[eachIndex])
+			}
+		}
+		for eachIndex := groupStart; eachIndex < groupEnd; eachIndex++ {
+			output.WriteString(fmt.Sprintf("%s%-*s = %s\n",
+				strings.Repeat("  ", indent),
+				nameWidth,
+				names[eachIndex],
+				values[eachIndex]))
+		}
+		groupStart = groupEnd
+	}
+}
+
+// tfWriteAttributes writes the attributes followed by the nested blocks.
+// The depends_on meta-argument is written last.
+func tfWriteAttributes(output *bytes.Buffer, attributes []*tfAttribute, indent int) error {
+	sorted := make([]*tfAttribute, len(attributes))
+	copy(sorted, attributes)
+	attributeOrder := func(attribute *tfAttribute) int {
+		switch {
+		case attribute.name == "depends_on":
+			return 2
+		case attribute.block != nil:
+			return 1
+		}
+		return 0
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if attributeOrder(sorted[i]) != attributeOrder(sorted[j]) {
+			return attributeOrder(sorted[i]) < attributeOrder(sorted[j])
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	names := make([]string, 0)
+	values := make([]string, 0)
+	lastWasBlock := false
+	for eachIndex, eachAttribute := range sorted {
+		if eachAttribute.block == nil {
+			var value bytes.Buffer
+			if writeErr := tfWriteValue(&value, eachAttribute.value, indent); writeErr != nil {
+				return writeErr
+			}
+			names = append(names, eachAttribute.name)
+			values = append(values, value.String())
+			continue
+		}
+		tfWriteAligned(output, names, values, indent)
+		names, values = nil, nil
+		if eachIndex != 0 {
+			output.WriteString("\n")
+		}
+		output.WriteString(strings.Repeat("  ", indent) + eachAttribute.name + " {\n")
+		if writeErr := tfWriteAttributes(output, eachAttribute.block, indent+1); writeErr != nil {
+			return writeErr
+		}
+		output.WriteString(strings.Repeat("  ", indent) + "}\n")
+		lastWasBlock = true
+	}
+	if lastWasBlock && len(names) != 0 {
+		output.WriteString("\n")
+	}
+	tfWriteAligned(output, names, values, indent)
+	return nil
+}
+
+// attributes returns the Terraform attributes for the mapped properties.
+// Properties that aren't mapped are unsupported.
+func (converter *tfConverter) attributes(properties map[string]interface{},
+	propertyNames map[string]string) ([]*tfAttribute, error) {
+
+	attributes := make([]*tfAttribute, 0)
+	for eachKey, eachValue := range properties {
+		attributeName, attributeNameExists := propertyNames[eachKey]
+		if !attributeNameExists {
+			return nil, errors.Errorf("Unsupported property: %s", eachKey)
+		}
+		converted, convertedErr := converter.value(eachValue)
+		if convertedErr != nil {
+			return nil, errors.Wrapf(convertedErr, "Property %s", eachKey)
+		}
+		attributes = append(attributes, &tfAttribute{name: attributeName, value: converted})
+	}
+	return attributes, nil
+}
+
+// jsonEncoded returns the jsonencode() expression for the CloudFormation value
+func (converter *tfConverter) jsonEncoded(cfValue interface{}) (interface{}, error) {
+	converted, convertedErr := converter.value(cfValue)
+	if convertedErr != nil {
+		return nil, convertedErr
+	}
+	var output bytes.Buffer
+	writeErr := tfWriteValue(&output, converted, -1)
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return tfExpression(fmt.Sprintf("jsonencode(%s)", output.String())), nil
+}
+
+// tags returns the tags map for a CloudFormation TagList
+func (converter *tfConverter) tags(cfValue interface{}) (interface{}, error) {
+	tagList, tagListOk := cfValue.([]interface{})
+	if !tagListOk {
+		return nil, errors.Errorf("Unsupported Tags value: %v", cfValue)
+	}
+	tags := make(map[string]interface{})
+	for _, eachTag := range tagList {
+		tagKey, tagKeyOk := samResourceMap(eachTag)["Key"].(string)
+		if !tagKeyOk {
+			return nil, errors.Errorf("Tag keys must be literal values: %v", eachTag)
+		}
+		tagValue, tagValueErr := converter.value(samResourceMap(eachTag)["Value"])
+		if tagValueErr != nil {
+			return nil, tagValueErr
+		}
+		tags[tagKey] = tagValue
+	}
+	return tags, nil
+}
+
+// tfSimpleResource returns a converter for resources whose properties
+// map directly to Terraform attributes
+func tfSimpleResource(resourceType string,
+	propertyNames map[string]string) func(string, map[string]interface{}, *tfConverter) ([]*tfResource, error) {
+	return func(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error) {
+		attributes, attributesErr := converter.attributes(properties, propertyNames)
+		if attributesErr != nil {
+			return nil, attributesErr
+		}
+		return []*tfResource{{resourceType: resourceType, name: name, attributes: attributes}}, nil
+	}
+}
+
+func tfLambdaFunction(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error) {
+	simpleProperties := make(map[string]interface{})
+	attributes := make([]*tfAttribute, 0)
+	nestedBlock := func(blockName string, cfValue interface{}, propertyNames map[string]string) error {
+		blockAttributes, blockAttributesErr := converter.attributes(samResourceMap(cfValue), propertyNames)
+		if blockAttributesErr != nil {
+			return errors.Wrapf(blockAttributesErr, "Property %s", blockName)
+		}
+		attributes = append(attributes, &tfAttribute{name: blockName, block: blockAttributes})
+		return nil
+	}
+	for eachKey, eachValue := range properties {
+		var blockErr error
+		switch eachKey {
+		case "Code":
+			code := samResourceMap(eachValue)
+			s3Key, _ := code["S3Key"].(string)
+			if localPath := converter.codePaths[s3Key]; localPath != "" {
+				attributes = append(attributes,
+					&tfAttribute{name: "filename", value: localPath},
+					&tfAttribute{name: "source_code_hash",
+						value: tfExpression(fmt.Sprintf("filebase64sha256(%q)", localPath))})
+				continue
+			}
+			codeAttributes, codeAttributesErr := converter.attributes(code, map[string]string{
+				"ImageUri":        "image_uri",
+				"S3Bucket":        "s3_bucket",
+				"S3Key":           "s3_key",
+				"S3ObjectVersion": "s3_object_version",
+			})
+			if codeAttributesErr != nil {
+				return nil, codeAttributesErr
+			}
+			attributes = append(attributes, codeAttributes...)
+		case "Environment":
+			blockErr = nestedBlock("environment", eachValue, map[string]string{"Variables": "variables"})
+		case "TracingConfig":
+			blockErr = nestedBlock("tracing_config", eachValue, map[string]string{"Mode": "mode"})
+		case "DeadLetterConfig":
+			blockErr = nestedBlock("dead_letter_config", eachValue, map[string]string{"TargetArn": "target_arn"})
+		case "EphemeralStorage":
+			blockErr = nestedBlock("ephemeral_storage", eachValue, map[string]string{"Size": "size"})
+		case "VpcConfig":
+			blockErr = nestedBlock("vpc_config", eachValue, map[string]string{
+				"SecurityGroupIds": "security_group_ids",
+				"SubnetIds":        "subnet_ids",
+			})
+		case "FileSystemConfigs":
+			fileSystemConfigs, _ := eachValue.([]interface{})
+			for _, eachConfig := range fileSystemConfigs {
+				blockErr = nestedBlock("file_system_config", eachConfig, map[string]string{
+					"Arn":            "arn",
+					"LocalMountPath": "local_mount_path",
+				})
+				if blockErr != nil {
+					break
+				}
+			}
+		case "Tags":
+			tags, tagsErr := converter.tags(eachValue)
+			if tagsErr != nil {
+				return nil, tagsErr
+			}
+			attributes = append(attributes, &tfAttribute{name: "tags", value: tags})
+		default:
+			simpleProperties[eachKey] = eachValue
+		}
+		if blockErr != nil {
+			return nil, blockErr
+		}
+	}
+	simpleAttributes, simpleAttributesErr := converter.attributes(simpleProperties, map[string]string{
+		"Architectures":                "architectures",
+		"CodeSigningConfigArn":         "code_signing_config_arn",
+		"Description":                  "description",
+		"FunctionName":                 "function_name",
+		"Handler":                      "handler",
+		"KmsKeyArn":                    "kms_key_arn",
+		"Layers":                       "layers",
+		"MemorySize":                   "memory_size",
+		"PackageType":                  "package_type",
+		"ReservedConcurrentExecutions": "reserved_concurrent_executions",
+		"Role":                         "role",
+		"Runtime":                      "runtime",
+		"Timeout":                      "timeout",
+	})
+	if simpleAttributesErr != nil {
+		return nil, simpleAttributesErr
+	}
+	return []*tfResource{{
+		resourceType: "aws_lambda_function",
+		name:         name,
+		attributes:   append(simpleAttributes, attributes...),
+	}}, nil
+}
+
+func tfIAMRole(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error) {
+	simpleProperties := make(map[string]interface{})
+	attributes := make([]*tfAttribute, 0)
+	for eachKey, eachValue := range properties {
+		switch eachKey {
+		case "AssumeRolePolicyDocument":
+			policy, policyErr := converter.jsonEncoded(eachValue)
+			if policyErr != nil {
+				return nil, policyErr
+			}
+			attributes = append(attributes, &tfAttribute{name: "assume_role_policy", value: policy})
+		case "Policies":
+			policies, _ := eachValue.([]interface{})
+			for _, eachPolicy := range policies {
+				policyName, policyNameErr := converter.value(samResourceMap(eachPolicy)["PolicyName"])
+				if policyNameErr != nil {
+					return nil, policyNameErr
+				}
+				policyDocument, policyDocumentErr := converter.jsonEncoded(samResourceMap(eachPolicy)["PolicyDocument"])
+				if policyDocumentErr != nil {
+					return nil, policyDocumentErr
+				}
+				attributes = append(attributes, &tfAttribute{
+					name: "inline_policy",
+					block: []*tfAttribute{
+						{name: "name", value: policyName},
+						{name: "policy", value: policyDocument},
+					},
+				})
+			}
+		case "Tags":
+			tags, tagsErr := converter.tags(eachValue)
+			if tagsErr != nil {
+				return nil, tagsErr
+			}
+			attributes = append(attributes, &tfAttribute{name: "tags", value: tags})
+		default:
+			simpleProperties[eachKey] = eachValue
+		}
+	}
+	simpleAttributes, simpleAttributesErr := converter.attributes(simpleProperties, map[string]string{
+		"Description":         "description",
+		"ManagedPolicyArns":   "managed_policy_arns",
+		"MaxSessionDuration":  "max_session_duration",
+		"Path":                "path",
+		"PermissionsBoundary": "permissions_boundary",
+		"RoleName":            "name",
+	})
+	if simpleAttributesErr != nil {
+		return nil, simpleAttributesErr
+	}
+	return []*tfResource{{
+		resourceType: "aws_iam_role",
+		name:         name,
+		attributes:   append(simpleAttributes, attributes...),
+	}}, nil
+}
+
+func tfIAMPolicy(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error) {
+	roles, _ := properties["Roles"].([]interface{})
+	if len(roles) == 0 {
+		return nil, errors.Errorf("Only IAM policies attached to roles are supported")
+	}
+	policyName, policyNameErr := converter.value(properties["PolicyName"])
+	if policyNameErr != nil {
+		return nil, policyNameErr
+	}
+	policyDocument, policyDocumentErr := converter.jsonEncoded(properties["PolicyDocument"])
+	if policyDocumentErr != nil {
+		return nil, policyDocumentErr
+	}
+	for eachKey := range properties {
+		switch eachKey {
+		case "PolicyName", "PolicyDocument", "Roles":
+		default:
+			return nil, errors.Errorf("Unsupported property: %s", eachKey)
+		}
+	}
+	resources := make([]*tfResource, 0)
+	for eachIndex, eachRole := range roles {
+		role, roleErr := converter.value(eachRole)
+		if roleErr != nil {
+			return nil, roleErr
+		}
+		resourceName := name
+		if len(roles) > 1 {
+			resourceName = fmt.Sprintf("%s_%d", name, eachIndex)
+		}
+		resources = append(resources, &tfResource{
+			resourceType: "aws_iam_role_policy",
+			name:         resourceName,
+			attributes: []*tfAttribute{
+				{name: "name", value: policyName},
+				{name: "policy", value: policyDocument},
+				{name: "role", value: role},
+			},
+		})
+	}
+	return resources, nil
+}
+
+func tfEventsRule(name string, properties map[string]interface{}, converter *tfConverter) ([]*tfResource, error) {
+	simpleProperties := make(map[string]interface{})
+	attributes := make([]*tfAttribute, 0)
+	var targets []interface{}
+	for eachKey, eachValue := range properties {
+		switch eachKey {
+		case "EventPattern":
+			pattern, patternErr := converter.jsonEncoded(eachValue)
+			if patternErr != nil {
+				return nil, patternErr
+			}
+			attributes = append(attributes, &tfAttribute{name: "event_pattern", value: pattern})
+		case "State":
+			state, stateOk := eachValue.(string)
+			if !stateOk {
+				return nil, errors.Errorf("State must be a literal value")
+			}
+			attributes = append(attributes, &tfAttribute{name: "is_enabled", value: state == "ENABLED"})
+		case "Targets":
+			targets, _ = eachValue.([]interface{})
+		default:
+			simpleProperties[eachKey] = eachValue
+		}
+	}
+	simpleAttributes, simpleAttributesErr := converter.attributes(simpleProperties, map[string]string{
+		"Description":        "description",
+		"Name":               "name",
+		"RoleArn":            "role_arn",
+		"ScheduleExpression": "schedule_expression",
+	})
+	if simpleAttributesErr != nil {
+		return nil, simpleAttributesErr
+	}
+	resources := []*tfResource{{
+		resourceType: "aws_cloudwatch_event_rule",
+		name:         name,
+		attributes:   append(simpleAttributes, attributes...),
+	}}
+	for eachIndex, eachTarget := range targets {
+		targetAttributes, targetAttributesErr := converter.attributes(samResourceMap(eachTarget), map[string]string{
+			"Arn":       "arn",
+			"Id":        "target_id",
+			"Input":     "input",
+			"InputPath": "input_path",
+			"RoleArn":   "role_arn",
+		})
+		if targetAttributesErr != nil {
+			return nil, errors.Wrapf(targetAttributesErr, "Target %d", eachIndex)
+		}
+		targetAttributes = append(targetAttributes, &tfAttribute{
+			name:  "rule",
+			value: tfExpression(fmt.Sprintf("aws_cloudwatch_event_rule.%s.name", name)),
+		})
+		resources = append(resources, &tfResource{
+			resourceType: "aws_cloudwatch_event_target",
+			name:         fmt.Sprintf("%s_%d", name, eachIndex),
+			attributes:   targetAttributes,
+		})
+	}
+	return resources, nil
+}
+
+// ExportTerraform returns the Terraform HCL configuration equivalent to
+// the JSON CloudFormation template. The AWS::StackName pseudo parameter
+// is replaced by a stack_name variable whose default is stackName, which
+// is also used for AWS::StackId. The stackTags are applied as the AWS
+// provider default_tags.
+// Functions whose Code S3Key is a key in codePaths are deployed from the
+// local archive path value. Resources that can't be represented, and
+// resources that reference them, are written as comments.
+func ExportTerraform(templateJSON []byte,
+	stackName string,
+	stackTags map[string]string,
+	codePaths map[string]string,
+	logger *logrus.Logger) ([]byte, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(templateJSON))
+	decoder.UseNumber()
+	var template map[string]interface{}
+	decodeErr := decoder.Decode(&template)
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "Failed to decode template")
+	}
+	converter := &tfConverter{
+		resourceTypes: tfResourceTypes,
+		resources:     samResourceMap(template["Resources"]),
+		exported:      make(map[string]bool),
+		parameters:    make(map[string]bool),
+		dataSources:   make(map[string]bool),
+		codePaths:     codePaths,
+	}
+	for eachName := range samResourceMap(template["Parameters"]) {
+		converter.parameters[eachName] = true
+	}
+	resourceNames := make([]string, 0, len(converter.resources))
+	for eachName, eachResource := range converter.resources {
+		resourceNames = append(resourceNames, eachName)
+		resourceType, _ := samResourceMap(eachResource)["Type"].(string)
+		if tfResourceTypes[resourceType] != nil && reTFIdentifier.MatchString(eachName) {
+			converter.exported[eachName] = true
+		}
+	}
+	sort.Strings(resourceNames)
+
+	// Unsupported resources make the resources that reference them
+	// unsupported, so iterate until nothing changes
+	unsupported := make(map[string]error)
+	convertedResources := make(map[string][]*tfResource)
+	for converged := false; !converged; {
+		converged = true
+		for _, eachName := range resourceNames {
+			if !converter.exported[eachName] {
+				continue
+			}
+			resource := samResourceMap(converter.resources[eachName])
+			resourceType, _ := resource["Type"].(string)
+			var resourcesErr error
+			var resources []*tfResource
+			if _, conditionExists := resource["Condition"]; conditionExists {
+				resourcesErr = errors.Errorf("Conditional resources are not supported")
+			} else {
+				resources, resourcesErr = tfResourceTypes[resourceType].convert(eachName,
+					samResourceMap(resource["Properties"]),
+					converter)
+			}
+			var dependsOn []interface{}
+			switch typedDependsOn := resource["DependsOn"].(type) {
+			case string:
+				dependsOn = []interface{}{typedDependsOn}
+			case []interface{}:
+				dependsOn = typedDependsOn
+			}
+			dependencies := make([]interface{}, 0)
+			for _, eachDependency := range dependsOn {
+				dependencyName := fmt.Sprintf("%v", eachDependency)
+				if resourcesErr == nil && !converter.exported[dependencyName] {
+					resourcesErr = errors.Errorf("Depends on unsupported resource: %s", dependencyName)
+				}
+				dependencyType, _ := samResourceMap(converter.resources[dependencyName])["Type"].(string)
+				if dependencyInfo := tfResourceTypes[dependencyType]; dependencyInfo != nil {
+					dependencies = append(dependencies,
+						tfExpression(fmt.Sprintf("%s.%s", dependencyInfo.resourceType, dependencyName)))
+				}
+			}
+			if resourcesErr != nil {
+				unsupported[eachName] = resourcesErr
+				delete(converter.exported, eachName)
+				converged = false
+				continue
+			}
+			if len(dependencies) != 0 {
+				resources[0].attributes = append(resources[0].attributes,
+					&tfAttribute{name: "depends_on", value: dependencies})
+			}
+			convertedResources[eachName] = resources
+		}
+	}
+
+	var body bytes.Buffer
+	for _, eachName := range resourceNames {
+		resource := samResourceMap(converter.resources[eachName])
+		if !converter.exported[eachName] {
+			reason := unsupported[eachName]
+			if reason == nil {
+				reason = errors.Errorf("Unsupported resource type")
+			}
+			logger.WithFields(logrus.Fields{
+				"Resource": eachName,
+				"Type":     resource["Type"],
+				"Reason":   reason,
+			}).Warn("Resource not exported to Terraform")
+			body.WriteString(fmt.Sprintf("# %s (%v) is not exported: %s\n\n",
+				eachName,
+				resource["Type"],
+				strings.Replace(reason.Error(), "\n", " ", -1)))
+			continue
+		}
+		for _, eachResource := range convertedResources[eachName] {
+			body.WriteString(fmt.Sprintf("resource %q %q {\n", eachResource.resourceType, eachResource.name))
+			if writeErr := tfWriteAttributes(&body, eachResource.attributes, 1); writeErr != nil {
+				return nil, writeErr
+			}
+			body.WriteString("}\n\n")
+		}
+	}
+
+	outputs := samResourceMap(template["Outputs"])
+	outputNames := make([]string, 0, len(outputs))
+	for eachName := range outputs {
+		outputNames = append(outputNames, eachName)
+	}
+	sort.Strings(outputNames)
+	for _, eachName := range outputNames {
+		output := samResourceMap(outputs[eachName])
+		outputValue, outputValueErr := converter.value(output["Value"])
+		if outputValueErr != nil {
+			logger.WithFields(logrus.Fields{
+				"Output": eachName,
+				"Reason": outputValueErr,
+			}).Warn("Output not exported to Terraform")
+			body.WriteString(fmt.Sprintf("# Output %s is not exported: %s\n\n", eachName, outputValueErr))
+			continue
+		}
+		attributes := []*tfAttribute{{name: "value", value: outputValue}}
+		if description, descriptionExists := output["Description"]; descriptionExists {
+			attributes = append([]*tfAttribute{{name: "description", value: description}}, attributes...)
+		}
+		body.WriteString(fmt.Sprintf("output %q {\n", eachName))
+		if writeErr := tfWriteAttributes(&body, attributes, 1); writeErr != nil {
+			return nil, writeErr
+		}
+		body.WriteString("}\n\n")
+	}
+
+	// Header with the variables and data sources the body uses
+	var output bytes.Buffer
+	output.WriteString("terraform {\n  required_providers {\n    aws = {\n      source = \"hashicorp/aws\"\n    }\n  }\n}\n\n")
+	if len(stackTags) != 0 {
+		defaultTags := make(map[string]interface{})
+		for eachKey, eachValue := range stackTags {
+			defaultTags[eachKey] = eachValue
+		}
+		output.WriteString("provider \"aws\" {\n")
+		writeErr := tfWriteAttributes(&output, []*tfAttribute{{
+			name:  "default_tags",
+			block: []*tfAttribute{{name: "tags", value: defaultTags}},
+		}}, 1)
+		if writeErr != nil {
+			return nil, writeErr
+		}
+		output.WriteString("}\n\n")
+	}
+	output.WriteString(fmt.Sprintf("variable %q {\n  type    = string\n  default = \"%s\"\n}\n\n",
+		tfStackNameVariable,
+		tfEscapeString(stackName)))
+	parameters := samResourceMap(template["Parameters"])
+	parameterNames := make([]string, 0, len(parameters))
+	for eachName := range parameters {
+		parameterNames = append(parameterNames, eachName)
+	}
+	sort.Strings(parameterNames)
+	for _, eachName := range parameterNames {
+		parameter := samResourceMap(parameters[eachName])
+		attributes := []*tfAttribute{{name: "type", value: tfExpression("string")}}
+		if parameter["Type"] == "Number" {
+			attributes[0].value = tfExpression("number")
+		}
+		if description, descriptionExists := parameter["Description"]; descriptionExists {
+			attributes = append(attributes, &tfAttribute{name: "description", value: description})
+		}
+		if defaultValue, defaultValueExists := parameter["Default"]; defaultValueExists {
+			attributes = append(attributes, &tfAttribute{name: "default", value: defaultValue})
+		}
+		output.WriteString(fmt.Sprintf("variable %q {\n", eachName))
+		if writeErr := tfWriteAttributes(&output, attributes, 1); writeErr != nil {
+			return nil, writeErr
+		}
+		output.WriteString("}\n\n")
+	}
+	dataSources := make([]string, 0, len(converter.dataSources))
+	for eachDataSource := range converter.dataSources {
+		dataSources = append(dataSources, eachDataSource)
+	}
+	sort.Strings(dataSources)
+	for _, eachDataSource := range dataSources {
+		output.WriteString(eachDataSource + "\n\n")
+	}
+	output.Write(body.Bytes())
+	return bytes.TrimRight(output.Bytes(), "\n"), nil
+}
+
+//
+// END - Terraform
+////////////////////////////////////////////////////////////////////////////////
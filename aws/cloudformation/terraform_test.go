@@ -0,0 +1,143 @@
+package cloudformation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const terraformSourceTemplate = `{
+	"Parameters": {
+		"Stage": {"Type": "String", "Default": "dev"}
+	},
+	"Resources": {
+		"HelloFunction": {
+			"Type": "AWS::Lambda::Function",
+			"DependsOn": ["HelloRole"],
+			"Properties": {
+				"Code": {"S3Bucket": "my-bucket", "S3Key": "MyService/MyService-code.zip"},
+				"FunctionName": {"Fn::Join": ["", [{"Ref": "AWS::StackName"}, "_Hello"]]},
+				"Handler": "MyService",
+				"MemorySize": 128,
+				"Runtime": "go1.x",
+				"Role": {"Fn::GetAtt": ["HelloRole", "Arn"]},
+				"Environment": {"Variables": {
+					"QUOTED": {"Fn::Join": ["", ["\"", {"Ref": "AWS::StackId"}, "\""]]},
+				"STAGE": {"Ref": "Stage"},
+					"TOPIC": {"Fn::Sub": "arn:aws:sns:${AWS::Region}:${AWS::AccountId}:${!Literal}"}
+				}},
+				"TracingConfig": {"Mode": "Active"},
+				"Tags": [{"Key": "team", "Value": "core"}]
+			}
+		},
+		"HelloRole": {
+			"Type": "AWS::IAM::Role",
+			"Properties": {
+				"AssumeRolePolicyDocument": {
+					"Version": "2012-10-17",
+					"Statement": [{"Effect": "Allow", "Principal": {"Service": ["lambda.amazonaws.com"]}, "Action": ["sts:AssumeRole"]}]
+				},
+				"Policies": [{
+					"PolicyName": "Logs",
+					"PolicyDocument": {"Statement": [{"Effect": "Allow", "Action": ["logs:*"], "Resource": "*"}]}
+				}]
+			}
+		},
+		"HelloSchedule": {
+			"Type": "AWS::Events::Rule",
+			"Properties": {
+				"ScheduleExpression": "rate(5 minutes)",
+				"State": "ENABLED",
+				"Targets": [{"Arn": {"Fn::GetAtt": ["HelloFunction", "Arn"]}, "Id": "Hello"}]
+			}
+		},
+		"SchedulePermission": {
+			"Type": "AWS::Lambda::Permission",
+			"Properties": {
+				"Action": "lambda:InvokeFunction",
+				"FunctionName": {"Ref": "HelloFunction"},
+				"Principal": "events.amazonaws.com",
+				"SourceArn": {"Fn::GetAtt": ["HelloSchedule", "Arn"]}
+			}
+		},
+		"S3Config": {
+			"Type": "AWS::CloudFormation::CustomResource",
+			"Properties": {"ServiceToken": "arn"}
+		},
+		"S3Permission": {
+			"Type": "AWS::Lambda::Permission",
+			"Properties": {
+				"Action": "lambda:InvokeFunction",
+				"FunctionName": {"Ref": "HelloFunction"},
+				"Principal": "s3.amazonaws.com",
+				"SourceArn": {"Fn::GetAtt": ["S3Config", "Arn"]}
+			}
+		}
+	},
+	"Outputs": {
+		"FunctionArn": {"Description": "Function ARN", "Value": {"Fn::GetAtt": ["HelloFunction", "Arn"]}}
+	}
+}`
+
+func TestExportTerraform(t *testing.T) {
+	logger := logrus.New()
+	hcl, hclErr := ExportTerraform([]byte(terraformSourceTemplate),
+		"MyService",
+		map[string]string{"team": "core"},
+		map[string]string{"MyService/MyService-code.zip": "MyService-code.zip"},
+		logger)
+	if hclErr != nil {
+		t.Fatalf("Failed to export Terraform configuration: %s", hclErr)
+	}
+	expected := []string{
+		`variable "stack_name" {`,
+		`  default = "MyService"`,
+		`variable "Stage" {`,
+		`data "aws_caller_identity" "current" {}`,
+		`data "aws_region" "current" {}`,
+		`    tags = {` + "\n" + `      team = "core"`,
+		`resource "aws_lambda_function" "HelloFunction" {`,
+		`  }` + "\n\n" + `  depends_on = [` + "\n" + `    aws_iam_role.HelloRole,`,
+		`  filename         = "MyService-code.zip"`,
+		`  source_code_hash = filebase64sha256("MyService-code.zip")`,
+		`  function_name    = join("", [var.stack_name, "_Hello"])`,
+		`  memory_size      = 128`,
+		`  role             = aws_iam_role.HelloRole.arn`,
+		`      QUOTED = join("", ["\"", var.stack_name, "\""])`,
+		`      STAGE  = var.Stage`,
+		`      TOPIC  = "arn:aws:sns:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:$${Literal}"`,
+		`  tracing_config {` + "\n" + `    mode = "Active"`,
+		`resource "aws_iam_role" "HelloRole" {`,
+		`  assume_role_policy = jsonencode({Statement = [{Action = ["sts:AssumeRole"], Effect = "Allow", Principal = {Service = ["lambda.amazonaws.com"]}}], Version = "2012-10-17"})`,
+		`  inline_policy {` + "\n" + `    name   = "Logs"`,
+		`resource "aws_cloudwatch_event_rule" "HelloSchedule" {`,
+		`  is_enabled          = true`,
+		`resource "aws_cloudwatch_event_target" "HelloSchedule_0" {`,
+		`  rule      = aws_cloudwatch_event_rule.HelloSchedule.name`,
+		`resource "aws_lambda_permission" "SchedulePermission" {`,
+		`  function_name = aws_lambda_function.HelloFunction.function_name`,
+		`  source_arn    = aws_cloudwatch_event_rule.HelloSchedule.arn`,
+		`# S3Config (AWS::CloudFormation::CustomResource) is not exported`,
+		`# S3Permission (AWS::Lambda::Permission) is not exported: Property SourceArn: Reference to unsupported resource: S3Config`,
+		`output "FunctionArn" {` + "\n" + `  description = "Function ARN"` + "\n" + `  value       = aws_lambda_function.HelloFunction.arn`,
+	}
+	for _, eachExpected := range expected {
+		if !strings.Contains(string(hcl), eachExpected) {
+			t.Fatalf("Failed to find:\n%s\nin Terraform configuration:\n%s", eachExpected, string(hcl))
+		}
+	}
+	if strings.Contains(string(hcl), `resource "aws_lambda_permission" "S3Permission"`) {
+		t.Fatalf("Exported resource that references an unsupported resource:\n%s", string(hcl))
+	}
+
+	// Uploaded archives are referenced by S3 location
+	hcl, hclErr = ExportTerraform([]byte(terraformSourceTemplate), "MyService", nil, nil, logger)
+	if hclErr != nil {
+		t.Fatalf("Failed to export Terraform configuration: %s", hclErr)
+	}
+	if !strings.Contains(string(hcl), `  s3_key        = "MyService/MyService-code.zip"`) ||
+		strings.Contains(string(hcl), `provider "aws"`) {
+		t.Fatalf("Unexpected Terraform configuration:\n%s", string(hcl))
+	}
+}
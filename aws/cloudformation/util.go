@@ -18,11 +18,14 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/briandowns/spinner"
 	humanize "github.com/dustin/go-humanize"
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -191,10 +194,62 @@ func (converter *templateConverter) results() (*gocf.StringExpr, error) {
 
 // END - templateConverter
 
-func cloudformationPollingDelay() time.Duration {
+// cloudformationPollingDelay returns the delay between status requests
+var cloudformationPollingDelay = func() time.Duration {
 	return time.Duration(3+rand.Int31n(5)) * time.Second
 }
 
+// adaptivePoller extends the polling interval while CloudFormation throttles
+// the polling requests
+type adaptivePoller struct {
+	policy    *spartaAWS.RetryPolicy
+	throttles int
+	logger    *logrus.Logger
+}
+
+// newAdaptivePoller returns a poller for the policy. A nil policy uses
+// the default policy.
+func newAdaptivePoller(policy *spartaAWS.RetryPolicy, logger *logrus.Logger) *adaptivePoller {
+	if policy == nil {
+		policy = spartaAWS.DefaultRetryPolicy()
+	}
+	return &adaptivePoller{
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// delay returns the polling delay, which includes the throttling backoff
+func (poller *adaptivePoller) delay(baseDelay time.Duration) time.Duration {
+	if poller.policy == nil || poller.throttles <= 0 {
+		return baseDelay
+	}
+	return baseDelay + poller.policy.Backoff(poller.throttles-1, true)
+}
+
+// throttled records the result of a polling request and returns true if
+// the request was throttled and should be retried. Successful requests
+// reduce the backoff.
+func (poller *adaptivePoller) throttled(err error) bool {
+	if err == nil {
+		if poller.throttles > 0 {
+			poller.throttles--
+		}
+		return false
+	}
+	if poller.policy == nil ||
+		!request.IsErrorThrottle(err) ||
+		poller.throttles >= poller.policy.MaxRetries {
+		return false
+	}
+	poller.throttles++
+	poller.logger.WithFields(logrus.Fields{
+		"Error":    err,
+		"Attempts": poller.throttles,
+	}).Warn("CloudFormation polling request throttled. Backing off.")
+	return true
+}
+
 // func existingStackTemplate(serviceName string,
 // 	session *session.Session,
 // 	logger *logrus.Logger) (*gocf.Template, error) {
@@ -239,16 +294,20 @@ func updateStackViaChangeSet(serviceName string,
 	cfTemplate *gocf.Template,
 	cfTemplateURL string,
 	awsTags []*cloudformation.Tag,
-	awsCloudFormation *cloudformation.CloudFormation,
+	changeSetType string,
+	options *ChangeSetOptions,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
 	logger *logrus.Logger) error {
 
 	// Create a change set name...
 	changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sChangeSet", serviceName))
-	_, changesErr := CreateStackChangeSet(changeSetRequestName,
+	_, changesErr := CreateStackChangeSetWithOptions(changeSetRequestName,
 		serviceName,
 		cfTemplate,
 		cfTemplateURL,
 		awsTags,
+		changeSetType,
+		options,
 		awsCloudFormation,
 		logger)
 	if nil != changesErr {
@@ -377,9 +436,33 @@ func stackCapabilities(template *gocf.Template) []*string {
 			capabilitiesMap["CAPABILITY_IAM"] = true
 			switch typedResource := eachResource.Properties.(type) {
 			case gocf.IAMRole:
-				capabilitiesMap["CAPABILITY_NAMED_IAM"] = (typedResource.RoleName != nil)
+				if typedResource.RoleName != nil {
+					capabilitiesMap["CAPABILITY_NAMED_IAM"] = true
+				}
 			case *gocf.IAMRole:
-				capabilitiesMap["CAPABILITY_NAMED_IAM"] = (typedResource.RoleName != nil)
+				if typedResource.RoleName != nil {
+					capabilitiesMap["CAPABILITY_NAMED_IAM"] = true
+				}
+			case rawResourceProperties:
+				if typedProperties, typedPropertiesOk := typedResource.properties.(map[string]interface{}); typedPropertiesOk &&
+					typedProperties["RoleName"] != nil {
+					capabilitiesMap["CAPABILITY_NAMED_IAM"] = true
+				}
+			default:
+				// Types that extend the IAM role schema
+				var typedProperties map[string]interface{}
+				propertiesJSON, propertiesJSONErr := json.Marshal(typedResource)
+				if propertiesJSONErr == nil &&
+					json.Unmarshal(propertiesJSON, &typedProperties) == nil &&
+					typedProperties["RoleName"] != nil {
+					capabilitiesMap["CAPABILITY_NAMED_IAM"] = true
+				}
+			}
+		}
+		// Nested stacks require the capabilities of their templates
+		if typedStack, typedStackOk := eachResource.Properties.(nestedStack); typedStackOk {
+			for _, eachCapability := range typedStack.capabilities {
+				capabilitiesMap[*eachCapability] = true
 			}
 		}
 	}
@@ -481,12 +564,30 @@ func ConvertToInlineJSONTemplateExpression(templateData io.Reader,
 	return converter.expandTemplate().parseData().results()
 }
 
+// isTerminalWriter returns true if the writer is a terminal
+func isTerminalWriter(writer io.Writer) bool {
+	outputFile, isFile := writer.(*os.File)
+	if !isFile {
+		return false
+	}
+	outputFileInfo, outputFileInfoErr := outputFile.Stat()
+	return outputFileInfoErr == nil && (outputFileInfo.Mode()&os.ModeCharDevice) != 0
+}
+
 // StackEvents returns the slice of cloudformation.StackEvents for the given stackID or stackName
 func StackEvents(stackID string,
 	eventFilterLowerBoundInclusive time.Time,
 	awsSession *session.Session) ([]*cloudformation.StackEvent, error) {
+	return StackEventsWithClient(stackID,
+		eventFilterLowerBoundInclusive,
+		cloudformation.New(awsSession))
+}
+
+// StackEventsWithClient is StackEvents with the given CloudFormation client
+func StackEventsWithClient(stackID string,
+	eventFilterLowerBoundInclusive time.Time,
+	cfService cloudformationiface.CloudFormationAPI) ([]*cloudformation.StackEvent, error) {
 
-	cfService := cloudformation.New(awsSession)
 	var events []*cloudformation.StackEvent
 
 	nextToken := ""
@@ -529,7 +630,22 @@ type WaitForStackOperationCompleteResult struct {
 // to determine if an operation is complete
 func WaitForStackOperationComplete(stackID string,
 	pollingMessage string,
-	awsCloudFormation *cloudformation.CloudFormation,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) (*WaitForStackOperationCompleteResult, error) {
+	return WaitForStackOperationCompleteWithPolicy(stackID,
+		pollingMessage,
+		awsCloudFormation,
+		nil,
+		logger)
+}
+
+// WaitForStackOperationCompleteWithPolicy is WaitForStackOperationComplete
+// with the policy used to back off when the polling requests are
+// throttled. A nil policy uses spartaAWS.DefaultRetryPolicy().
+func WaitForStackOperationCompleteWithPolicy(stackID string,
+	pollingMessage string,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	retryPolicy *spartaAWS.RetryPolicy,
 	logger *logrus.Logger) (*WaitForStackOperationCompleteResult, error) {
 
 	result := &WaitForStackOperationCompleteResult{}
@@ -541,19 +657,21 @@ func WaitForStackOperationComplete(stackID string,
 	cliSpinner := spinner.New(spinner.CharSets[charSetIndex],
 		333*time.Millisecond)
 	cliSpinnerStarted := false
+	// The spinner writes directly to stdout, so only use it if the
+	// log output is a terminal
+	_, isJSONFormatter := logger.Formatter.(*logrus.JSONFormatter)
+	useSpinner := !isJSONFormatter && isTerminalWriter(logger.Out)
 
 	// Poll for the current stackID state, and
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(stackID),
 	}
+	poller := newAdaptivePoller(retryPolicy, logger)
 	for waitComplete := false; !waitComplete; {
 		// Startup the spinner if needed...
-		switch logger.Formatter.(type) {
-		case *logrus.JSONFormatter:
-			{
-				logger.Info(pollingMessage)
-			}
-		default:
+		if !useSpinner {
+			logger.Info(pollingMessage)
+		} else {
 			if !cliSpinnerStarted {
 				cliSpinner.Start()
 				defer cliSpinner.Stop()
@@ -566,12 +684,14 @@ func WaitForStackOperationComplete(stackID string,
 		}
 
 		// Then sleep and figure out if things are done...
-		sleepDuration := time.Duration(11+rand.Int31n(13)) * time.Second
+		sleepDuration := poller.delay(time.Duration(11+rand.Int31n(13)) * time.Second)
 		time.Sleep(sleepDuration)
 
 		describeStacksOutput, err := awsCloudFormation.DescribeStacks(describeStacksInput)
+		if poller.throttled(err) {
+			continue
+		}
 		if nil != err {
-			// TODO - add retry iff we're RateExceeded due to collective access
 			return nil, err
 		}
 		if len(describeStacksOutput.Stacks) <= 0 {
@@ -683,7 +803,13 @@ func UploadTemplate(serviceName string,
 
 // StackExists returns whether the given stackName or stackID currently exists
 func StackExists(stackNameOrID string, awsSession *session.Session, logger *logrus.Logger) (bool, error) {
-	cf := cloudformation.New(awsSession)
+	return StackExistsWithClient(stackNameOrID, cloudformation.New(awsSession), logger)
+}
+
+// StackExistsWithClient is StackExists with the given CloudFormation client
+func StackExistsWithClient(stackNameOrID string,
+	cf cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) (bool, error) {
 
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(stackNameOrID),
@@ -718,15 +844,39 @@ func CreateStackChangeSet(changeSetRequestName string,
 	cfTemplate *gocf.Template,
 	templateURL string,
 	awsTags []*cloudformation.Tag,
-	awsCloudFormation *cloudformation.CloudFormation,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	logger *logrus.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	return CreateStackChangeSetWithOptions(changeSetRequestName,
+		serviceName,
+		cfTemplate,
+		templateURL,
+		awsTags,
+		cloudformation.ChangeSetTypeUpdate,
+		nil,
+		awsCloudFormation,
+		logger)
+}
+
+// CreateStackChangeSetWithOptions is CreateStackChangeSet with the
+// change set type (eg, cloudformation.ChangeSetTypeCreate) and the
+// optional parameter and capabilities overrides
+func CreateStackChangeSetWithOptions(changeSetRequestName string,
+	serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	awsTags []*cloudformation.Tag,
+	changeSetType string,
+	options *ChangeSetOptions,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
 	logger *logrus.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
 
-	capabilities := stackCapabilities(cfTemplate)
 	changeSetInput := &cloudformation.CreateChangeSetInput{
-		Capabilities:  capabilities,
+		Capabilities:  options.stackCapabilities(cfTemplate),
 		ChangeSetName: aws.String(changeSetRequestName),
+		ChangeSetType: aws.String(changeSetType),
 		ClientToken:   aws.String(changeSetRequestName),
 		Description:   aws.String(fmt.Sprintf("Change set for service: %s", serviceName)),
+		Parameters:    options.stackParameters(changeSetType, logger),
 		StackName:     aws.String(serviceName),
 		TemplateURL:   aws.String(templateURL),
 	}
@@ -752,12 +902,15 @@ func CreateStackChangeSet(changeSetRequestName string,
 	// Loop, with a total timeout of 3 minutes
 	startTime := time.Now()
 	changeSetStabilized := false
+	poller := newAdaptivePoller(options.pollingRetryPolicy(), logger)
 	for !changeSetStabilized {
-		sleepDuration := cloudformationPollingDelay()
+		sleepDuration := poller.delay(cloudformationPollingDelay())
 		time.Sleep(sleepDuration)
 
 		changeSetOutput, describeChangeSetError := awsCloudFormation.DescribeChangeSet(&describeChangeSetInput)
-
+		if poller.throttled(describeChangeSetError) {
+			continue
+		}
 		if nil != describeChangeSetError {
 			return nil, describeChangeSetError
 		}
@@ -805,7 +958,7 @@ func CreateStackChangeSet(changeSetRequestName string,
 // logic in case of EC
 func DeleteChangeSet(stackName string,
 	changeSetRequestName string,
-	awsCloudFormation *cloudformation.CloudFormation) (*cloudformation.DeleteChangeSetOutput, error) {
+	awsCloudFormation cloudformationiface.CloudFormationAPI) (*cloudformation.DeleteChangeSetOutput, error) {
 
 	// Delete request...
 	deleteChangeSetInput := cloudformation.DeleteChangeSetInput{
@@ -871,8 +1024,36 @@ func ConvergeStackState(serviceName string,
 	outputsDividerChar string,
 	dividerWidth int,
 	logger *logrus.Logger) (*cloudformation.Stack, error) {
+	return ConvergeStackStateWithClient(serviceName,
+		cfTemplate,
+		templateURL,
+		tags,
+		startTime,
+		operationTimeout,
+		cloudformation.New(awsSession),
+		nil,
+		outputsDividerChar,
+		dividerWidth,
+		logger)
+}
+
+// ConvergeStackStateWithClient is ConvergeStackState with the given
+// CloudFormation client and optional ChangeSetOptions. Existing stacks are
+// updated with a change set. Stacks in the REVIEW_IN_PROGRESS state (eg,
+// after a create change set wasn't executed) are created with a new change
+// set.
+func ConvergeStackStateWithClient(serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	tags map[string]string,
+	startTime time.Time,
+	operationTimeout time.Duration,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	options *ChangeSetOptions,
+	outputsDividerChar string,
+	dividerWidth int,
+	logger *logrus.Logger) (*cloudformation.Stack, error) {
 
-	awsCloudFormation := cloudformation.New(awsSession)
 	// Update the tags
 	awsTags := make([]*cloudformation.Tag, 0)
 	if nil != tags {
@@ -884,16 +1065,30 @@ func ConvergeStackState(serviceName string,
 				})
 		}
 	}
-	exists, existsErr := StackExists(serviceName, awsSession, logger)
-	if nil != existsErr {
-		return nil, existsErr
+	stackStatus, stackStatusErr := describeStackStatus(serviceName, awsCloudFormation, logger)
+	if nil != stackStatusErr {
+		return nil, stackStatusErr
 	}
 	stackID := ""
-	if exists {
+	if stackStatus != "" {
+		// A stack that's waiting for its create change set to be executed
+		// doesn't have any resources, so replace the change set
+		changeSetType := cloudformation.ChangeSetTypeUpdate
+		if stackStatus == cloudformation.StackStatusReviewInProgress {
+			logger.WithField("StackName", serviceName).
+				Warn("Stack is in REVIEW_IN_PROGRESS state. Replacing the pending create change set.")
+			deleteErr := deleteStaleChangeSets(serviceName, awsCloudFormation, logger)
+			if nil != deleteErr {
+				return nil, deleteErr
+			}
+			changeSetType = cloudformation.ChangeSetTypeCreate
+		}
 		updateErr := updateStackViaChangeSet(serviceName,
 			cfTemplate,
 			templateURL,
 			awsTags,
+			changeSetType,
+			options,
 			awsCloudFormation,
 			logger)
 
@@ -908,7 +1103,8 @@ func ConvergeStackState(serviceName string,
 			TemplateURL:      aws.String(templateURL),
 			TimeoutInMinutes: aws.Int64(int64(operationTimeout.Minutes())),
 			OnFailure:        aws.String(cloudformation.OnFailureDelete),
-			Capabilities:     stackCapabilities(cfTemplate),
+			Capabilities:     options.stackCapabilities(cfTemplate),
+			Parameters:       options.stackParameters(cloudformation.ChangeSetTypeCreate, logger),
 		}
 		if len(awsTags) != 0 {
 			createStackInput.Tags = awsTags
@@ -925,9 +1121,10 @@ func ConvergeStackState(serviceName string,
 	}
 	// Wait for the operation to succeed
 	pollingMessage := "Waiting for CloudFormation operation to complete"
-	convergeResult, convergeErr := WaitForStackOperationComplete(stackID,
+	convergeResult, convergeErr := WaitForStackOperationCompleteWithPolicy(stackID,
 		pollingMessage,
 		awsCloudFormation,
+		options.pollingRetryPolicy(),
 		logger)
 	if nil != convergeErr {
 		return nil, convergeErr
@@ -935,26 +1132,13 @@ func ConvergeStackState(serviceName string,
 	// Get the events and assemble them into either errors to output
 	// or summary information
 	resourceMetrics := make(map[string]*resourceProvisionMetrics)
-	errorMessages := []string{}
-	events, err := StackEvents(stackID, startTime, awsSession)
+	events, err := StackEventsWithClient(stackID, startTime, awsCloudFormation)
 	if nil != err {
 		return nil, fmt.Errorf("failed to retrieve stack events: %s", err.Error())
 	}
 
 	for _, eachEvent := range events {
 		switch *eachEvent.ResourceStatus {
-		case cloudformation.ResourceStatusCreateFailed,
-			cloudformation.ResourceStatusDeleteFailed,
-			cloudformation.ResourceStatusUpdateFailed:
-			errMsg := fmt.Sprintf("\tError ensuring %s (%s): %s",
-				aws.StringValue(eachEvent.ResourceType),
-				aws.StringValue(eachEvent.LogicalResourceId),
-				aws.StringValue(eachEvent.ResourceStatusReason))
-			// Only append if the resource failed because something else failed
-			// and this resource was canceled.
-			if !strings.Contains(errMsg, "cancelled") {
-				errorMessages = append(errorMessages, errMsg)
-			}
 		case cloudformation.ResourceStatusCreateInProgress,
 			cloudformation.ResourceStatusUpdateInProgress:
 			existingMetric, existingMetricExists := resourceMetrics[*eachEvent.LogicalResourceId]
@@ -981,11 +1165,14 @@ func ConvergeStackState(serviceName string,
 
 	// If it didn't work, then output some failure information
 	if !convergeResult.operationSuccessful {
-		logger.Error("Stack provisioning error")
-		for _, eachError := range errorMessages {
-			logger.Error(eachError)
-		}
-		return nil, fmt.Errorf("failed to provision: %s", serviceName)
+		stackErr := DiagnoseStackFailure(stackID,
+			aws.StringValue(convergeResult.stackInfo.StackStatus),
+			startTime,
+			awsCloudFormation,
+			logger)
+		stackErr.StackName = serviceName
+		stackErr.Log(logger)
+		return nil, stackErr
 	}
 
 	// Rip through the events so that we can output exactly how long it took to
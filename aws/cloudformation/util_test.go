@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	"github.com/sirupsen/logrus"
 )
@@ -163,3 +165,35 @@ func TestPlatformScopedName(t *testing.T) {
 		t.Fatalf("Failed to get `user` AWS account name for Stack")
 	}
 }
+
+func TestAdaptivePoller(t *testing.T) {
+	logger := logrus.New()
+	poller := newAdaptivePoller(&spartaAWS.RetryPolicy{
+		MaxRetries:       2,
+		MinThrottleDelay: time.Second,
+		MaxThrottleDelay: 3 * time.Second,
+	}, logger)
+	throttleErr := awserr.New("Throttling", "Rate exceeded", nil)
+	baseDelay := 5 * time.Second
+	if poller.delay(baseDelay) != baseDelay {
+		t.Fatalf("Unexpected delay before throttling")
+	}
+	for i := 0; i != 2; i++ {
+		if !poller.throttled(throttleErr) {
+			t.Fatalf("Failed to retry throttled request: %d", i)
+		}
+	}
+	throttledDelay := poller.delay(baseDelay)
+	if throttledDelay < baseDelay+time.Second || throttledDelay > baseDelay+2*time.Second {
+		t.Fatalf("Unexpected throttled delay: %s", throttledDelay)
+	}
+	if poller.throttled(throttleErr) {
+		t.Fatalf("Failed to stop retrying after MaxRetries")
+	}
+	if poller.throttled(awserr.New("ValidationError", "Stack does not exist", nil)) {
+		t.Fatalf("Retried request that wasn't throttled")
+	}
+	if poller.throttled(nil) || poller.throttles != 1 {
+		t.Fatalf("Failed to reduce backoff after successful request")
+	}
+}
@@ -0,0 +1,360 @@
+package cloudformation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - YAML
+//
+
+// yamlMapEntry is a key/value pair in a yamlMap
+type yamlMapEntry struct {
+	key   string
+	value interface{}
+}
+
+// yamlMap is a JSON object that preserves the marshaled key order
+type yamlMap []yamlMapEntry
+
+// yamlIndentWidth is the number of spaces per nesting level
+const yamlIndentWidth = 2
+
+// intrinsicShortForms are the intrinsic functions that have a YAML short
+// form tag (eg, Fn::GetAtt => !GetAtt)
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/intrinsic-function-reference.html
+var intrinsicShortForms = map[string]string{
+	"Ref":             "!Ref",
+	"Condition":       "!Condition",
+	"Fn::And":         "!And",
+	"Fn::Base64":      "!Base64",
+	"Fn::Cidr":        "!Cidr",
+	"Fn::Equals":      "!Equals",
+	"Fn::FindInMap":   "!FindInMap",
+	"Fn::GetAtt":      "!GetAtt",
+	"Fn::GetAZs":      "!GetAZs",
+	"Fn::If":          "!If",
+	"Fn::ImportValue": "!ImportValue",
+	"Fn::Join":        "!Join",
+	"Fn::Not":         "!Not",
+	"Fn::Or":          "!Or",
+	"Fn::Select":      "!Select",
+	"Fn::Split":       "!Split",
+	"Fn::Sub":         "!Sub",
+}
+
+// Plain (unquoted) scalars are limited to values that can't be confused
+// with YAML indicators, numbers, timestamps or booleans
+var reYAMLPlainScalar = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_ ./:@()*+=$%{}\[\]-]*$`)
+
+var yamlReservedScalars = map[string]bool{
+	"true":  true,
+	"false": true,
+	"yes":   true,
+	"no":    true,
+	"on":    true,
+	"off":   true,
+	"y":     true,
+	"n":     true,
+	"null":  true,
+}
+
+// decodeOrderedJSON decodes the next JSON value, preserving the object
+// key order
+func decodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	token, tokenErr := decoder.Token()
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	switch typedToken := token.(type) {
+	case json.Delim:
+		switch typedToken {
+		case '{':
+			object := yamlMap{}
+			for decoder.More() {
+				keyToken, keyTokenErr := decoder.Token()
+				if keyTokenErr != nil {
+					return nil, keyTokenErr
+				}
+				key, keyOk := keyToken.(string)
+				if !keyOk {
+					return nil, errors.Errorf("Invalid JSON object key: %v", keyToken)
+				}
+				value, valueErr := decodeOrderedJSON(decoder)
+				if valueErr != nil {
+					return nil, valueErr
+				}
+				object = append(object, yamlMapEntry{key: key, value: value})
+			}
+			_, closeErr := decoder.Token()
+			return object, closeErr
+		case '[':
+			array := make([]interface{}, 0)
+			for decoder.More() {
+				value, valueErr := decodeOrderedJSON(decoder)
+				if valueErr != nil {
+					return nil, valueErr
+				}
+				array = append(array, value)
+			}
+			_, closeErr := decoder.Token()
+			return array, closeErr
+		}
+		return nil, errors.Errorf("Unexpected JSON delimiter: %v", typedToken)
+	default:
+		return token, nil
+	}
+}
+
+// yamlShortForm returns the short form tag and argument if the value is an
+// intrinsic function. Intrinsics whose argument is itself an intrinsic
+// function use the full function name because YAML doesn't support
+// immediately nested tags.
+func yamlShortForm(value interface{}) (string, interface{}, bool) {
+	object, objectOk := value.(yamlMap)
+	if !objectOk || len(object) != 1 {
+		return "", nil, false
+	}
+	tag, tagExists := intrinsicShortForms[object[0].key]
+	if !tagExists {
+		return "", nil, false
+	}
+	if _, _, nestedShortForm := yamlShortForm(object[0].value); nestedShortForm {
+		return "", nil, false
+	}
+	argument := object[0].value
+	// !GetAtt uses the dotted form for literal names
+	if tag == "!GetAtt" {
+		if attrs, attrsOk := argument.([]interface{}); attrsOk && len(attrs) == 2 {
+			resourceName, resourceNameOk := attrs[0].(string)
+			attrName, attrNameOk := attrs[1].(string)
+			if resourceNameOk && attrNameOk {
+				argument = fmt.Sprintf("%s.%s", resourceName, attrName)
+			}
+		}
+	}
+	return tag, argument, true
+}
+
+// yamlScalar returns the single line representation of the scalar value
+func yamlScalar(value interface{}) (string, error) {
+	switch typedValue := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		if typedValue {
+			return "true", nil
+		}
+		return "false", nil
+	case json.Number:
+		return typedValue.String(), nil
+	case string:
+		if reYAMLPlainScalar.MatchString(typedValue) &&
+			!yamlReservedScalars[strings.ToLower(typedValue)] &&
+			!strings.HasSuffix(typedValue, " ") &&
+			!strings.HasSuffix(typedValue, ":") &&
+			!strings.Contains(typedValue, ": ") {
+			return typedValue, nil
+		}
+		// JSON strings are valid YAML double-quoted scalars
+		var quoted bytes.Buffer
+		encoder := json.NewEncoder(&quoted)
+		encoder.SetEscapeHTML(false)
+		if encodeErr := encoder.Encode(typedValue); encodeErr != nil {
+			return "", encodeErr
+		}
+		return strings.TrimSuffix(quoted.String(), "\n"), nil
+	}
+	return "", errors.Errorf("Unsupported YAML scalar: %#v", value)
+}
+
+// yamlBlockScalar returns true if the string should be written as a
+// literal block scalar
+func yamlBlockScalar(value interface{}) bool {
+	stringValue, stringValueOk := value.(string)
+	if !stringValueOk || !strings.Contains(stringValue, "\n") {
+		return false
+	}
+	if strings.HasPrefix(stringValue, " ") ||
+		strings.HasPrefix(stringValue, "\n") ||
+		strings.HasSuffix(stringValue, "\n\n") {
+		return false
+	}
+	for _, eachRune := range stringValue {
+		if eachRune != '\n' && eachRune != '\t' && (eachRune < 0x20 || eachRune == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlWriter writes the YAML document
+type yamlWriter struct {
+	output bytes.Buffer
+}
+
+func (writer *yamlWriter) indent(level int) {
+	writer.output.WriteString(strings.Repeat(" ", level))
+}
+
+// writeBlockScalar writes a literal block scalar at the given indentation
+func (writer *yamlWriter) writeBlockScalar(value string, level int) {
+	chomp := "-"
+	if strings.HasSuffix(value, "\n") {
+		chomp = ""
+		value = strings.TrimSuffix(value, "\n")
+	}
+	writer.output.WriteString(" |" + chomp + "\n")
+	for _, eachLine := range strings.Split(value, "\n") {
+		if eachLine != "" {
+			writer.indent(level)
+			writer.output.WriteString(eachLine)
+		}
+		writer.output.WriteString("\n")
+	}
+}
+
+// writeValue writes the value that follows a mapping key or sequence
+// indicator. Nested collections are written at the given indentation.
+func (writer *yamlWriter) writeValue(value interface{}, level int) error {
+	if tag, argument, shortForm := yamlShortForm(value); shortForm {
+		writer.output.WriteString(" " + tag)
+		return writer.writeValue(argument, level)
+	}
+	switch typedValue := value.(type) {
+	case yamlMap:
+		if len(typedValue) == 0 {
+			writer.output.WriteString(" {}\n")
+			return nil
+		}
+		writer.output.WriteString("\n")
+		return writer.writeMap(typedValue, level)
+	case []interface{}:
+		if len(typedValue) == 0 {
+			writer.output.WriteString(" []\n")
+			return nil
+		}
+		writer.output.WriteString("\n")
+		return writer.writeSequence(typedValue, level)
+	}
+	if yamlBlockScalar(value) {
+		writer.writeBlockScalar(value.(string), level)
+		return nil
+	}
+	scalar, scalarErr := yamlScalar(value)
+	if scalarErr != nil {
+		return scalarErr
+	}
+	writer.output.WriteString(" " + scalar + "\n")
+	return nil
+}
+
+func (writer *yamlWriter) writeMap(object yamlMap, level int) error {
+	for _, eachEntry := range object {
+		key, keyErr := yamlScalar(eachEntry.key)
+		if keyErr != nil {
+			return keyErr
+		}
+		writer.indent(level)
+		writer.output.WriteString(key + ":")
+		if valueErr := writer.writeValue(eachEntry.value, level+yamlIndentWidth); valueErr != nil {
+			return valueErr
+		}
+	}
+	return nil
+}
+
+func (writer *yamlWriter) writeSequence(array []interface{}, level int) error {
+	for _, eachValue := range array {
+		writer.indent(level)
+		writer.output.WriteString("-")
+		// Compact form for nested mappings and sequences
+		var nested yamlWriter
+		var nestedErr error
+		compact := false
+		switch typedValue := eachValue.(type) {
+		case yamlMap:
+			if _, _, shortForm := yamlShortForm(typedValue); !shortForm && len(typedValue) != 0 {
+				nestedErr = nested.writeMap(typedValue, level+yamlIndentWidth)
+				compact = true
+			}
+		case []interface{}:
+			if len(typedValue) != 0 {
+				nestedErr = nested.writeSequence(typedValue, level+yamlIndentWidth)
+				compact = true
+			}
+		}
+		if nestedErr != nil {
+			return nestedErr
+		}
+		if compact {
+			writer.output.WriteString(" ")
+			writer.output.WriteString(strings.TrimLeft(nested.output.String(), " "))
+			continue
+		}
+		if valueErr := writer.writeValue(eachValue, level+yamlIndentWidth); valueErr != nil {
+			return valueErr
+		}
+	}
+	return nil
+}
+
+// JSONToYAML converts the JSON document to YAML. Object key order is
+// preserved and CloudFormation intrinsic functions use the short form
+// tags (eg, !Ref, !GetAtt, !Sub).
+func JSONToYAML(jsonData []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	document, documentErr := decodeOrderedJSON(decoder)
+	if documentErr != nil {
+		return nil, errors.Wrapf(documentErr, "Failed to decode JSON")
+	}
+	if _, trailingErr := decoder.Token(); trailingErr != io.EOF {
+		return nil, errors.Errorf("Unexpected data following JSON document")
+	}
+	writer := &yamlWriter{}
+	switch typedDocument := document.(type) {
+	case yamlMap:
+		if len(typedDocument) == 0 {
+			return []byte("{}\n"), nil
+		}
+		if writeErr := writer.writeMap(typedDocument, 0); writeErr != nil {
+			return nil, writeErr
+		}
+	case []interface{}:
+		if len(typedDocument) == 0 {
+			return []byte("[]\n"), nil
+		}
+		if writeErr := writer.writeSequence(typedDocument, 0); writeErr != nil {
+			return nil, writeErr
+		}
+	default:
+		scalar, scalarErr := yamlScalar(typedDocument)
+		if scalarErr != nil {
+			return nil, scalarErr
+		}
+		writer.output.WriteString(scalar + "\n")
+	}
+	return writer.output.Bytes(), nil
+}
+
+// MarshalYAML returns the YAML representation of the CloudFormation
+// template. See JSONToYAML.
+func MarshalYAML(template interface{}) ([]byte, error) {
+	templateJSON, templateJSONErr := json.Marshal(template)
+	if templateJSONErr != nil {
+		return nil, errors.Wrapf(templateJSONErr, "Failed to marshal template")
+	}
+	return JSONToYAML(templateJSON)
+}
+
+//
+// END - YAML
+////////////////////////////////////////////////////////////////////////////////
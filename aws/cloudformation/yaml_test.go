@@ -0,0 +1,85 @@
+package cloudformation
+
+import (
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestMarshalYAML(t *testing.T) {
+	template := gocf.NewTemplate()
+	template.Description = "Sample: YAML"
+	template.Parameters["Stage"] = &gocf.Parameter{
+		Type:          "String",
+		AllowedValues: []string{"dev", "prod"},
+	}
+	template.AddResource("MyFunction", &gocf.LambdaFunction{
+		Role:       gocf.GetAtt("MyRole", "Arn"),
+		MemorySize: gocf.Integer(128),
+		Environment: &gocf.LambdaFunctionEnvironment{
+			Variables: map[string]interface{}{
+				"STAGE":  gocf.Ref("Stage"),
+				"REGION": map[string]interface{}{"Fn::Sub": "${AWS::Region}"},
+				"TABLE": gocf.Join("-",
+					gocf.Ref("AWS::StackName"),
+					gocf.String("true")),
+				"ENCODED": map[string]interface{}{
+					"Fn::Base64": map[string]interface{}{"Fn::Sub": "${AWS::Region}"},
+				},
+				"SCRIPT": "#!/bin/sh\necho hello\n",
+			},
+		},
+	})
+	templateYAML, templateYAMLErr := MarshalYAML(template)
+	if templateYAMLErr != nil {
+		t.Fatalf("Failed to marshal YAML: %s", templateYAMLErr)
+	}
+	expected := `AWSTemplateFormatVersion: "2010-09-09"
+Description: "Sample: YAML"
+Parameters:
+  Stage:
+    Type: String
+    AllowedValues:
+      - dev
+      - prod
+Resources:
+  MyFunction:
+    Type: AWS::Lambda::Function
+    Properties:
+      Environment:
+        Variables:
+          ENCODED:
+            Fn::Base64: !Sub "${AWS::Region}"
+          REGION: !Sub "${AWS::Region}"
+          SCRIPT: |
+            #!/bin/sh
+            echo hello
+          STAGE: !Ref Stage
+          TABLE: !Join
+            - "-"
+            - - !Ref AWS::StackName
+              - "true"
+      MemorySize: 128
+      Role: !GetAtt MyRole.Arn
+`
+	if string(templateYAML) != expected {
+		t.Fatalf("Unexpected YAML. Found:\n%s\nExpected:\n%s", templateYAML, expected)
+	}
+
+	sequenceYAML, sequenceYAMLErr := JSONToYAML([]byte(`[{"Effect":"Allow","Action":["s3:*"]},{},[]]`))
+	if sequenceYAMLErr != nil {
+		t.Fatalf("Failed to convert JSON to YAML: %s", sequenceYAMLErr)
+	}
+	expected = `- Effect: Allow
+  Action:
+    - s3:*
+- {}
+- []
+`
+	if string(sequenceYAML) != expected {
+		t.Fatalf("Unexpected YAML. Found:\n%s\nExpected:\n%s", sequenceYAML, expected)
+	}
+	if _, invalidErr := JSONToYAML([]byte(`{"Key": }`)); invalidErr == nil {
+		t.Fatalf("Failed to reject invalid JSON")
+	}
+}
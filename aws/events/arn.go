@@ -0,0 +1,33 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mockARNRegion returns the region of the ARN, or the mock region if the
+// ARN doesn't include one
+func mockARNRegion(arn string) string {
+	// arn:partition:service:region:account-id:resource
+	arnParts := strings.SplitN(arn, ":", 6)
+	if len(arnParts) == 6 && arnParts[3] != "" {
+		return arnParts[3]
+	}
+	return mockRegion
+}
+
+// mockARNAccountID returns the account ID of the ARN, or the mock account ID
+// if the ARN doesn't include one
+func mockARNAccountID(arn string) string {
+	arnParts := strings.SplitN(arn, ":", 6)
+	if len(arnParts) == 6 && arnParts[4] != "" {
+		return arnParts[4]
+	}
+	return mockAccountID
+}
+
+// mockSequenceNumber returns a zero padded sequence number that sorts in
+// record order
+func mockSequenceNumber(base string, index int) string {
+	return fmt.Sprintf("%s%020d", base, index+1)
+}
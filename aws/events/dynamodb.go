@@ -0,0 +1,218 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// DynamoDBEventBuilder builds a DynamoDB stream event with a record for
+// each item change. The records match the batch delivered by a DynamoDB
+// EventSourceMapping. Item values are converted to attribute values:
+// strings are S, numbers are N, booleans are BOOL, nil is NULL, []byte
+// is B, maps and structs are M and slices are L.
+type DynamoDBEventBuilder struct {
+	streamArn      string
+	streamViewType awsLambdaEvents.DynamoDBStreamViewType
+	records        []awsLambdaEvents.DynamoDBEventRecord
+	err            error
+}
+
+// NewDynamoDBEventBuilder returns a builder for records from the stream.
+// The stream view type defaults to NEW_AND_OLD_IMAGES.
+func NewDynamoDBEventBuilder(streamArn string) *DynamoDBEventBuilder {
+	return &DynamoDBEventBuilder{
+		streamArn:      streamArn,
+		streamViewType: awsLambdaEvents.DynamoDBStreamViewTypeNewAndOldImages,
+	}
+}
+
+// StreamViewType sets the stream view type, which determines the item
+// images included in the records
+func (builder *DynamoDBEventBuilder) StreamViewType(viewType awsLambdaEvents.DynamoDBStreamViewType) *DynamoDBEventBuilder {
+	builder.streamViewType = viewType
+	return builder
+}
+
+// Insert adds an INSERT record for the new item
+func (builder *DynamoDBEventBuilder) Insert(keys map[string]interface{},
+	newImage map[string]interface{}) *DynamoDBEventBuilder {
+	return builder.record(awsLambdaEvents.DynamoDBOperationTypeInsert, keys, nil, newImage)
+}
+
+// Modify adds a MODIFY record for the updated item
+func (builder *DynamoDBEventBuilder) Modify(keys map[string]interface{},
+	oldImage map[string]interface{},
+	newImage map[string]interface{}) *DynamoDBEventBuilder {
+	return builder.record(awsLambdaEvents.DynamoDBOperationTypeModify, keys, oldImage, newImage)
+}
+
+// Remove adds a REMOVE record for the deleted item
+func (builder *DynamoDBEventBuilder) Remove(keys map[string]interface{},
+	oldImage map[string]interface{}) *DynamoDBEventBuilder {
+	return builder.record(awsLambdaEvents.DynamoDBOperationTypeRemove, keys, oldImage, nil)
+}
+
+func (builder *DynamoDBEventBuilder) record(operationType awsLambdaEvents.DynamoDBOperationType,
+	keys map[string]interface{},
+	oldImage map[string]interface{},
+	newImage map[string]interface{}) *DynamoDBEventBuilder {
+	if builder.err != nil {
+		return builder
+	}
+	keyAttributes, keyAttributesErr := dynamoDBItem(keys)
+	if keyAttributesErr != nil {
+		builder.err = keyAttributesErr
+		return builder
+	}
+	oldAttributes, oldAttributesErr := dynamoDBItem(oldImage)
+	if oldAttributesErr != nil {
+		builder.err = oldAttributesErr
+		return builder
+	}
+	newAttributes, newAttributesErr := dynamoDBItem(newImage)
+	if newAttributesErr != nil {
+		builder.err = newAttributesErr
+		return builder
+	}
+	index := len(builder.records)
+	builder.records = append(builder.records, awsLambdaEvents.DynamoDBEventRecord{
+		AWSRegion:      mockARNRegion(builder.streamArn),
+		EventID:        fmt.Sprintf("%032x", index+1),
+		EventName:      string(operationType),
+		EventSource:    "aws:dynamodb",
+		EventVersion:   "1.1",
+		EventSourceArn: builder.streamArn,
+		Change: awsLambdaEvents.DynamoDBStreamRecord{
+			ApproximateCreationDateTime: awsLambdaEvents.SecondsEpochTime{Time: time.Now().Truncate(time.Second)},
+			Keys:                        keyAttributes,
+			NewImage:                    newAttributes,
+			OldImage:                    oldAttributes,
+			SequenceNumber:              mockSequenceNumber("1", index),
+		},
+	})
+	return builder
+}
+
+// Build returns the DynamoDB event, or the first item conversion error.
+// The item images are filtered by the stream view type.
+func (builder *DynamoDBEventBuilder) Build() (*awsLambdaEvents.DynamoDBEvent, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+	dynamoDBEvent := &awsLambdaEvents.DynamoDBEvent{
+		Records: make([]awsLambdaEvents.DynamoDBEventRecord, len(builder.records)),
+	}
+	for eachIndex, eachRecord := range builder.records {
+		switch builder.streamViewType {
+		case awsLambdaEvents.DynamoDBStreamViewTypeKeysOnly:
+			eachRecord.Change.NewImage = nil
+			eachRecord.Change.OldImage = nil
+		case awsLambdaEvents.DynamoDBStreamViewTypeNewImage:
+			eachRecord.Change.OldImage = nil
+		case awsLambdaEvents.DynamoDBStreamViewTypeOldImage:
+			eachRecord.Change.NewImage = nil
+		}
+		eachRecord.Change.StreamViewType = string(builder.streamViewType)
+		recordJSON, recordJSONErr := json.Marshal(eachRecord.Change)
+		if recordJSONErr != nil {
+			return nil, recordJSONErr
+		}
+		eachRecord.Change.SizeBytes = int64(len(recordJSON))
+		dynamoDBEvent.Records[eachIndex] = eachRecord
+	}
+	return dynamoDBEvent, nil
+}
+
+// dynamoDBItem returns the attribute values for the item, or nil if the
+// item is nil
+func dynamoDBItem(item map[string]interface{}) (map[string]awsLambdaEvents.DynamoDBAttributeValue, error) {
+	if item == nil {
+		return nil, nil
+	}
+	attributes := make(map[string]awsLambdaEvents.DynamoDBAttributeValue, len(item))
+	for eachName, eachValue := range item {
+		attributeValue, attributeValueErr := dynamoDBAttributeValue(eachValue)
+		if attributeValueErr != nil {
+			return nil, fmt.Errorf("invalid value for attribute %s: %s", eachName, attributeValueErr)
+		}
+		attributes[eachName] = attributeValue
+	}
+	return attributes, nil
+}
+
+// dynamoDBAttributeValue returns the attribute value for the Go value
+func dynamoDBAttributeValue(value interface{}) (awsLambdaEvents.DynamoDBAttributeValue, error) {
+	switch typedValue := value.(type) {
+	case nil:
+		return awsLambdaEvents.NewNullAttribute(), nil
+	case awsLambdaEvents.DynamoDBAttributeValue:
+		return typedValue, nil
+	case string:
+		return awsLambdaEvents.NewStringAttribute(typedValue), nil
+	case bool:
+		return awsLambdaEvents.NewBooleanAttribute(typedValue), nil
+	case []byte:
+		return awsLambdaEvents.NewBinaryAttribute(typedValue), nil
+	case json.Number:
+		return awsLambdaEvents.NewNumberAttribute(typedValue.String()), nil
+	}
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return awsLambdaEvents.NewNumberAttribute(strconv.FormatInt(reflectValue.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return awsLambdaEvents.NewNumberAttribute(strconv.FormatUint(reflectValue.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return awsLambdaEvents.NewNumberAttribute(strconv.FormatFloat(reflectValue.Float(), 'f', -1, 64)), nil
+	case reflect.Ptr:
+		if reflectValue.IsNil() {
+			return awsLambdaEvents.NewNullAttribute(), nil
+		}
+		return dynamoDBAttributeValue(reflectValue.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		listValues := make([]awsLambdaEvents.DynamoDBAttributeValue, reflectValue.Len())
+		for index := 0; index < reflectValue.Len(); index++ {
+			listValue, listValueErr := dynamoDBAttributeValue(reflectValue.Index(index).Interface())
+			if listValueErr != nil {
+				return awsLambdaEvents.DynamoDBAttributeValue{}, listValueErr
+			}
+			listValues[index] = listValue
+		}
+		return awsLambdaEvents.NewListAttribute(listValues), nil
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() != reflect.String {
+			return awsLambdaEvents.DynamoDBAttributeValue{}, fmt.Errorf("unsupported map key type: %s",
+				reflectValue.Type().Key())
+		}
+		mapValues := make(map[string]awsLambdaEvents.DynamoDBAttributeValue, reflectValue.Len())
+		for _, eachKey := range reflectValue.MapKeys() {
+			mapValue, mapValueErr := dynamoDBAttributeValue(reflectValue.MapIndex(eachKey).Interface())
+			if mapValueErr != nil {
+				return awsLambdaEvents.DynamoDBAttributeValue{}, mapValueErr
+			}
+			mapValues[eachKey.String()] = mapValue
+		}
+		return awsLambdaEvents.NewMapAttribute(mapValues), nil
+	case reflect.Struct:
+		// Structs are converted with their JSON representation
+		structJSON, structJSONErr := json.Marshal(value)
+		if structJSONErr != nil {
+			return awsLambdaEvents.DynamoDBAttributeValue{}, structJSONErr
+		}
+		decoder := json.NewDecoder(bytes.NewReader(structJSON))
+		decoder.UseNumber()
+		var structMap map[string]interface{}
+		decodeErr := decoder.Decode(&structMap)
+		if decodeErr != nil {
+			return awsLambdaEvents.DynamoDBAttributeValue{}, decodeErr
+		}
+		return dynamoDBAttributeValue(structMap)
+	}
+	return awsLambdaEvents.DynamoDBAttributeValue{}, fmt.Errorf("unsupported type: %T", value)
+}
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strings"
@@ -23,7 +24,7 @@ type APIGatewayIdentity struct {
 
 // APIGatewayContext is the API-Gateway context information
 type APIGatewayContext struct {
-	AppID        string             `json:"appId"`
+	AppID        string             `json:"apiId"`
 	Method       string             `json:"method"`
 	RequestID    string             `json:"requestId"`
 	ResourceID   string             `json:"resourceId"`
@@ -48,6 +49,22 @@ type APIGatewayEnvelope struct {
 type APIGatewayRequest struct {
 	APIGatewayEnvelope
 	Body interface{} `json:"body"`
+	// IsBase64Encoded is true if the Body is the base64 encoded
+	// value of a binary media type payload
+	IsBase64Encoded bool `json:"isBase64Encoded,omitempty"`
+}
+
+// BinaryBody returns the decoded bytes of a base64 encoded binary
+// media type request Body.
+func (request *APIGatewayRequest) BinaryBody() ([]byte, error) {
+	if !request.IsBase64Encoded {
+		return nil, fmt.Errorf("request body is not base64 encoded")
+	}
+	encodedBody, isString := request.Body.(string)
+	if !isString {
+		return nil, fmt.Errorf("unsupported base64 encoded body type: %T", request.Body)
+	}
+	return base64.StdEncoding.DecodeString(encodedBody)
 }
 
 // NewAPIGatewayMockRequest creates a mock API Gateway request.
@@ -112,3 +129,86 @@ func NewAPIGatewayMockRequest(lambdaName string,
 	}
 	return apiGatewayRequest, nil
 }
+
+// APIGatewayRequestBuilder builds an API Gateway request that matches the
+// event produced by the Sparta request mapping templates for a lambda
+// integration
+type APIGatewayRequestBuilder struct {
+	request *APIGatewayRequest
+}
+
+// NewAPIGatewayRequestBuilder returns a builder for a request to the
+// resource path (eg, /pets/{name}). The body defaults to an empty object.
+func NewAPIGatewayRequestBuilder(httpMethod string, resourcePath string) *APIGatewayRequestBuilder {
+	return &APIGatewayRequestBuilder{
+		request: &APIGatewayRequest{
+			Body: map[string]interface{}{},
+			APIGatewayEnvelope: APIGatewayEnvelope{
+				Method:      httpMethod,
+				Headers:     make(map[string]string),
+				QueryParams: make(map[string]string),
+				PathParams:  make(map[string]string),
+				Authorizer:  make(map[string]interface{}),
+				Context: APIGatewayContext{
+					AppID:        "mockapi",
+					Method:       httpMethod,
+					RequestID:    mockRequestID,
+					ResourceID:   "anon42",
+					ResourcePath: resourcePath,
+					Stage:        "mock",
+					Identity: APIGatewayIdentity{
+						AccountID: mockAccountID,
+						SourceIP:  "127.0.0.1",
+						UserAgent: "Mozilla/Gecko",
+					},
+				},
+			},
+		},
+	}
+}
+
+// Header sets the request header
+func (builder *APIGatewayRequestBuilder) Header(name string, value string) *APIGatewayRequestBuilder {
+	builder.request.Headers[name] = value
+	return builder
+}
+
+// QueryParam sets the query string parameter
+func (builder *APIGatewayRequestBuilder) QueryParam(name string, value string) *APIGatewayRequestBuilder {
+	builder.request.QueryParams[name] = value
+	return builder
+}
+
+// PathParam sets the value of the resource path parameter
+func (builder *APIGatewayRequestBuilder) PathParam(name string, value string) *APIGatewayRequestBuilder {
+	builder.request.PathParams[name] = value
+	return builder
+}
+
+// Authorizer sets the authorizer context value
+func (builder *APIGatewayRequestBuilder) Authorizer(key string, value interface{}) *APIGatewayRequestBuilder {
+	builder.request.Authorizer[key] = value
+	return builder
+}
+
+// Body sets the request body. Use a value that marshals to a JSON object
+// for application/json requests, or a string for text/plain requests.
+func (builder *APIGatewayRequestBuilder) Body(body interface{}) *APIGatewayRequestBuilder {
+	builder.request.Body = body
+	builder.request.IsBase64Encoded = false
+	return builder
+}
+
+// BinaryBody sets the base64 encoded body and Content-Type of a binary
+// media type request
+func (builder *APIGatewayRequestBuilder) BinaryBody(body []byte, contentType string) *APIGatewayRequestBuilder {
+	builder.request.Body = base64.StdEncoding.EncodeToString(body)
+	builder.request.IsBase64Encoded = true
+	builder.request.Headers["Content-Type"] = contentType
+	return builder
+}
+
+// Build returns the API Gateway request
+func (builder *APIGatewayRequestBuilder) Build() *APIGatewayRequest {
+	return builder.request
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// roundTrip marshals the event and unmarshals it into the target type,
+// as the lambda runtime does
+func roundTrip(t *testing.T, event interface{}, target interface{}) {
+	eventJSON, eventJSONErr := json.Marshal(event)
+	if eventJSONErr != nil {
+		t.Fatalf("Failed to marshal event: %s", eventJSONErr)
+	}
+	unmarshalErr := json.Unmarshal(eventJSON, target)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal event: %s", unmarshalErr)
+	}
+}
+
+func TestS3EventBuilder(t *testing.T) {
+	var s3Event awsLambdaEvents.S3Event
+	roundTrip(t, NewS3EventBuilder("bucket").
+		Region("us-west-2").
+		ObjectCreated("my file.json", 42).
+		ObjectRemoved("old.json").
+		Build(), &s3Event)
+	if len(s3Event.Records) != 2 {
+		t.Fatalf("Unexpected records: %v", s3Event.Records)
+	}
+	created := s3Event.Records[0]
+	if created.EventName != S3EventObjectCreatedPut ||
+		created.AWSRegion != "us-west-2" ||
+		created.S3.Object.Key != "my+file.json" ||
+		created.S3.Object.Size != 42 ||
+		created.S3.Bucket.Arn != "arn:aws:s3:::bucket" {
+		t.Fatalf("Unexpected ObjectCreated record: %#v", created)
+	}
+	removed := s3Event.Records[1]
+	if removed.EventName != S3EventObjectRemovedDelete || removed.S3.Object.ETag != "" {
+		t.Fatalf("Unexpected ObjectRemoved record: %#v", removed)
+	}
+}
+
+func TestSNSAndSQSEventBuilders(t *testing.T) {
+	var snsEvent awsLambdaEvents.SNSEvent
+	roundTrip(t, NewSNSEventBuilder("arn:aws:sns:eu-west-1:111122223333:topic").
+		MessageWithAttributes("subject", "message", map[string]string{"key": "value"}).
+		Build(), &snsEvent)
+	if len(snsEvent.Records) != 1 ||
+		snsEvent.Records[0].SNS.Message != "message" ||
+		snsEvent.Records[0].SNS.MessageAttributes["key"] == nil {
+		t.Fatalf("Unexpected SNS event: %#v", snsEvent)
+	}
+
+	var sqsEvent awsLambdaEvents.SQSEvent
+	roundTrip(t, NewSQSEventBuilder("arn:aws:sqs:eu-west-1:111122223333:queue").
+		Message("one").
+		MessageWithAttributes("two", map[string]string{"key": "value"}).
+		Build(), &sqsEvent)
+	if len(sqsEvent.Records) != 2 {
+		t.Fatalf("Unexpected SQS records: %v", sqsEvent.Records)
+	}
+	message := sqsEvent.Records[1]
+	if message.Body != "two" ||
+		message.AWSRegion != "eu-west-1" ||
+		message.Attributes["SenderId"] != "111122223333" ||
+		message.MessageAttributes["key"].StringValue == nil ||
+		message.MessageId == sqsEvent.Records[0].MessageId {
+		t.Fatalf("Unexpected SQS message: %#v", message)
+	}
+}
+
+func TestDynamoDBEventBuilder(t *testing.T) {
+	type item struct {
+		Count int      `json:"count"`
+		Tags  []string `json:"tags"`
+	}
+	keys := map[string]interface{}{"id": "one"}
+	dynamoDBEvent, dynamoDBEventErr := NewDynamoDBEventBuilder("arn:aws:dynamodb:us-east-1:123412341234:table/Table/stream/label").
+		Insert(keys, map[string]interface{}{"id": "one", "count": 1, "enabled": true, "item": item{Count: 2, Tags: []string{"a"}}}).
+		Modify(keys, map[string]interface{}{"count": 1}, map[string]interface{}{"count": 2.5}).
+		Remove(keys, map[string]interface{}{"missing": nil}).
+		Build()
+	if dynamoDBEventErr != nil {
+		t.Fatalf("Failed to build DynamoDB event: %s", dynamoDBEventErr)
+	}
+	var roundTripEvent awsLambdaEvents.DynamoDBEvent
+	roundTrip(t, dynamoDBEvent, &roundTripEvent)
+	if len(roundTripEvent.Records) != 3 {
+		t.Fatalf("Unexpected DynamoDB records: %v", roundTripEvent.Records)
+	}
+	insert := roundTripEvent.Records[0]
+	if insert.EventName != "INSERT" ||
+		insert.Change.NewImage["count"].Number() != "1" ||
+		!insert.Change.NewImage["enabled"].Boolean() ||
+		insert.Change.NewImage["item"].Map()["tags"].List()[0].String() != "a" ||
+		insert.Change.OldImage != nil {
+		t.Fatalf("Unexpected INSERT record: %#v", insert)
+	}
+	modify := roundTripEvent.Records[1]
+	if modify.Change.NewImage["count"].Number() != "2.5" ||
+		modify.Change.OldImage["count"].Number() != "1" ||
+		modify.Change.SequenceNumber <= insert.Change.SequenceNumber {
+		t.Fatalf("Unexpected MODIFY record: %#v", modify)
+	}
+	if !roundTripEvent.Records[2].Change.OldImage["missing"].IsNull() {
+		t.Fatalf("Unexpected REMOVE record: %#v", roundTripEvent.Records[2])
+	}
+
+	keysOnlyEvent, _ := NewDynamoDBEventBuilder("arn").
+		StreamViewType(awsLambdaEvents.DynamoDBStreamViewTypeKeysOnly).
+		Insert(keys, keys).
+		Build()
+	if keysOnlyEvent.Records[0].Change.NewImage != nil {
+		t.Fatalf("Unexpected image for KEYS_ONLY stream")
+	}
+	_, invalidErr := NewDynamoDBEventBuilder("arn").
+		Insert(keys, map[string]interface{}{"invalid": make(chan int)}).
+		Build()
+	if invalidErr == nil {
+		t.Fatalf("Expected error for unsupported attribute type")
+	}
+}
+
+func TestKinesisAndEventBridgeEvents(t *testing.T) {
+	var kinesisEvent awsLambdaEvents.KinesisEvent
+	roundTrip(t, NewKinesisEventBuilder("arn:aws:kinesis:us-east-1:123412341234:stream/Stream").
+		Record("key", []byte("data")).
+		Build(), &kinesisEvent)
+	if len(kinesisEvent.Records) != 1 ||
+		string(kinesisEvent.Records[0].Kinesis.Data) != "data" ||
+		kinesisEvent.Records[0].Kinesis.PartitionKey != "key" {
+		t.Fatalf("Unexpected Kinesis event: %#v", kinesisEvent)
+	}
+
+	eventBridgeEvent, eventBridgeEventErr := NewEventBridgeEvent("com.example",
+		"Order Placed",
+		map[string]int{"quantity": 2})
+	if eventBridgeEventErr != nil {
+		t.Fatalf("Failed to create EventBridge event: %s", eventBridgeEventErr)
+	}
+	var roundTripEvent awsLambdaEvents.CloudWatchEvent
+	roundTrip(t, eventBridgeEvent, &roundTripEvent)
+	if roundTripEvent.DetailType != "Order Placed" ||
+		string(roundTripEvent.Detail) != `{"quantity":2}` {
+		t.Fatalf("Unexpected EventBridge event: %#v", roundTripEvent)
+	}
+}
+
+func TestAPIGatewayRequestBuilder(t *testing.T) {
+	request := NewAPIGatewayRequestBuilder("POST", "/pets/{name}").
+		PathParam("name", "fido").
+		QueryParam("verbose", "true").
+		Header("X-Custom", "value").
+		Authorizer("principalId", "user").
+		BinaryBody([]byte("binary"), "image/png").
+		Build()
+	var roundTripRequest APIGatewayRequest
+	roundTrip(t, request, &roundTripRequest)
+	binaryBody, binaryBodyErr := roundTripRequest.BinaryBody()
+	if binaryBodyErr != nil || string(binaryBody) != "binary" {
+		t.Fatalf("Unexpected binary body: %s (%v)", binaryBody, binaryBodyErr)
+	}
+	if roundTripRequest.PathParams["name"] != "fido" ||
+		roundTripRequest.Headers["Content-Type"] != "image/png" ||
+		roundTripRequest.Context.ResourcePath != "/pets/{name}" ||
+		roundTripRequest.Authorizer["principalId"] != "user" {
+		t.Fatalf("Unexpected request: %#v", roundTripRequest)
+	}
+}
+
+func TestNewMockEvent(t *testing.T) {
+	for _, eachSource := range MockEventSources() {
+		mockEvent, mockEventErr := NewMockEvent(eachSource)
+		if mockEventErr != nil || mockEvent == nil {
+			t.Fatalf("Failed to create mock %s event: %v", eachSource, mockEventErr)
+		}
+	}
+	_, unsupportedErr := NewMockEvent("unsupported")
+	if unsupportedErr == nil {
+		t.Fatalf("Expected error for unsupported event source")
+	}
+}
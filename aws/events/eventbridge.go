@@ -0,0 +1,50 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// NewEventBridgeEvent returns an EventBridge (CloudWatch Events) event with
+// the source, detail type and detail. The detail is marshaled to JSON
+// unless it's a json.RawMessage. The event matches the event delivered by
+// an EventBridge rule target.
+func NewEventBridgeEvent(source string,
+	detailType string,
+	detail interface{},
+	resources ...string) (*awsLambdaEvents.CloudWatchEvent, error) {
+
+	var detailJSON json.RawMessage
+	switch typedDetail := detail.(type) {
+	case json.RawMessage:
+		detailJSON = typedDetail
+	case nil:
+		detailJSON = json.RawMessage("{}")
+	default:
+		marshaledDetail, marshaledDetailErr := json.Marshal(detail)
+		if marshaledDetailErr != nil {
+			return nil, fmt.Errorf("failed to marshal event detail: %s", marshaledDetailErr)
+		}
+		detailJSON = marshaledDetail
+	}
+	if !json.Valid(detailJSON) {
+		return nil, fmt.Errorf("event detail isn't valid JSON")
+	}
+	if resources == nil {
+		resources = []string{}
+	}
+	return &awsLambdaEvents.CloudWatchEvent{
+		Version:    "0",
+		ID:         mockRequestID,
+		DetailType: detailType,
+		Source:     source,
+		AccountID:  mockAccountID,
+		Time:       time.Now().UTC().Truncate(time.Second),
+		Region:     mockRegion,
+		Resources:  resources,
+		Detail:     detailJSON,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// KinesisEventBuilder builds a Kinesis event with a record for each
+// data blob. The records match the batch delivered by a Kinesis
+// EventSourceMapping.
+type KinesisEventBuilder struct {
+	streamArn string
+	records   []awsLambdaEvents.KinesisEventRecord
+}
+
+// NewKinesisEventBuilder returns a builder for records from the stream
+func NewKinesisEventBuilder(streamArn string) *KinesisEventBuilder {
+	return &KinesisEventBuilder{
+		streamArn: streamArn,
+	}
+}
+
+// Record adds a record for the data with the partition key. The data is
+// base64 encoded when the event is marshaled, as it is in Kinesis events.
+func (builder *KinesisEventBuilder) Record(partitionKey string, data []byte) *KinesisEventBuilder {
+	sequenceNumber := mockSequenceNumber("4959033827149025660855969253836157109592", len(builder.records))
+	builder.records = append(builder.records, awsLambdaEvents.KinesisEventRecord{
+		AwsRegion:      mockARNRegion(builder.streamArn),
+		EventID:        fmt.Sprintf("shardId-000000000000:%s", sequenceNumber),
+		EventName:      "aws:kinesis:record",
+		EventSource:    "aws:kinesis",
+		EventSourceArn: builder.streamArn,
+		EventVersion:   "1.0",
+		InvokeIdentityArn: fmt.Sprintf("arn:aws:iam::%s:role/SpartaMockRole",
+			mockARNAccountID(builder.streamArn)),
+		Kinesis: awsLambdaEvents.KinesisRecord{
+			ApproximateArrivalTimestamp: awsLambdaEvents.SecondsEpochTime{Time: time.Now().Truncate(time.Second)},
+			Data:                        data,
+			PartitionKey:                partitionKey,
+			SequenceNumber:              sequenceNumber,
+			KinesisSchemaVersion:        "1.0",
+		},
+	})
+	return builder
+}
+
+// Build returns the Kinesis event
+func (builder *KinesisEventBuilder) Build() *awsLambdaEvents.KinesisEvent {
+	return &awsLambdaEvents.KinesisEvent{
+		Records: append([]awsLambdaEvents.KinesisEventRecord{}, builder.records...),
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	// MockEventSourceS3 is the NewMockEvent name for S3 events
+	MockEventSourceS3 = "s3"
+	// MockEventSourceSNS is the NewMockEvent name for SNS events
+	MockEventSourceSNS = "sns"
+	// MockEventSourceSQS is the NewMockEvent name for SQS events
+	MockEventSourceSQS = "sqs"
+	// MockEventSourceAPIGateway is the NewMockEvent name for API Gateway
+	// requests
+	MockEventSourceAPIGateway = "apigateway"
+	// MockEventSourceDynamoDB is the NewMockEvent name for DynamoDB
+	// stream events
+	MockEventSourceDynamoDB = "dynamodb"
+	// MockEventSourceKinesis is the NewMockEvent name for Kinesis events
+	MockEventSourceKinesis = "kinesis"
+	// MockEventSourceEventBridge is the NewMockEvent name for EventBridge
+	// events
+	MockEventSourceEventBridge = "eventbridge"
+)
+
+const (
+	mockAccountID = "123412341234"
+	mockRegion    = "us-east-1"
+	mockRequestID = "12341234-1234-1234-1234-123412341234"
+)
+
+// NewS3MockEvent creates a mock s3:ObjectCreated:Put event for the
+// bucket and object key
+func NewS3MockEvent(bucketName string, objectKey string) *awsLambdaEvents.S3Event {
+	return NewS3EventBuilder(bucketName).
+		ObjectCreated(objectKey, 1024).
+		Build()
+}
+
+// NewSNSMockEvent creates a mock SNS notification event for the topic
+func NewSNSMockEvent(topicArn string, subject string, message string) *awsLambdaEvents.SNSEvent {
+	return NewSNSEventBuilder(topicArn).
+		Message(subject, message).
+		Build()
+}
+
+// NewSQSMockEvent creates a mock SQS event with a message for each body
+func NewSQSMockEvent(queueArn string, messageBodies ...string) *awsLambdaEvents.SQSEvent {
+	builder := NewSQSEventBuilder(queueArn)
+	for _, eachBody := range messageBodies {
+		builder.Message(eachBody)
+	}
+	return builder.Build()
+}
+
+// mockEventFactories are the NewMockEvent constructors for each event
+// source name
+var mockEventFactories = map[string]func() (interface{}, error){
+	MockEventSourceS3: func() (interface{}, error) {
+		return NewS3MockEvent("sparta-mock-bucket", "mock/object.json"), nil
+	},
+	MockEventSourceSNS: func() (interface{}, error) {
+		return NewSNSMockEvent(fmt.Sprintf("arn:aws:sns:%s:%s:SpartaMockTopic", mockRegion, mockAccountID),
+			"Mock subject",
+			"Mock message"), nil
+	},
+	MockEventSourceSQS: func() (interface{}, error) {
+		return NewSQSMockEvent(fmt.Sprintf("arn:aws:sqs:%s:%s:SpartaMockQueue", mockRegion, mockAccountID),
+			`{"message":"Mock message"}`), nil
+	},
+	MockEventSourceAPIGateway: func() (interface{}, error) {
+		return NewAPIGatewayRequestBuilder("GET", "/mock").
+			Header("Content-Type", "application/json").
+			Build(), nil
+	},
+	MockEventSourceDynamoDB: func() (interface{}, error) {
+		streamArn := fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/SpartaMockTable/stream/2020-01-01T00:00:00.000",
+			mockRegion,
+			mockAccountID)
+		return NewDynamoDBEventBuilder(streamArn).
+			Insert(map[string]interface{}{"id": "mock"},
+				map[string]interface{}{"id": "mock", "message": "Mock message"}).
+			Build()
+	},
+	MockEventSourceKinesis: func() (interface{}, error) {
+		streamArn := fmt.Sprintf("arn:aws:kinesis:%s:%s:stream/SpartaMockStream", mockRegion, mockAccountID)
+		return NewKinesisEventBuilder(streamArn).
+			Record("mock", []byte(`{"message":"Mock message"}`)).
+			Build(), nil
+	},
+	MockEventSourceEventBridge: func() (interface{}, error) {
+		return NewEventBridgeEvent("com.sparta.mock",
+			"Mock Event",
+			map[string]string{"message": "Mock message"})
+	},
+}
+
+// MockEventSources returns the event source names supported by NewMockEvent
+func MockEventSources() []string {
+	return []string{MockEventSourceAPIGateway,
+		MockEventSourceDynamoDB,
+		MockEventSourceEventBridge,
+		MockEventSourceKinesis,
+		MockEventSourceS3,
+		MockEventSourceSNS,
+		MockEventSourceSQS}
+}
+
+// NewMockEvent creates a mock event with placeholder values for the event
+// source name (eg, "s3"). See MockEventSources for the supported names.
+// Use the event builders (eg, NewS3EventBuilder) for events with specific
+// values.
+func NewMockEvent(eventSource string) (interface{}, error) {
+	factory, factoryExists := mockEventFactories[strings.ToLower(eventSource)]
+	if !factoryExists {
+		return nil, fmt.Errorf("unsupported mock event source: %s (supported: %s)",
+			eventSource,
+			strings.Join(MockEventSources(), ", "))
+	}
+	return factory()
+}
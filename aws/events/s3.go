@@ -0,0 +1,110 @@
+package events
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	// S3EventObjectCreatedPut is the S3 event name for a PutObject request
+	S3EventObjectCreatedPut = "ObjectCreated:Put"
+	// S3EventObjectCreatedCopy is the S3 event name for a CopyObject request
+	S3EventObjectCreatedCopy = "ObjectCreated:Copy"
+	// S3EventObjectRemovedDelete is the S3 event name for a DeleteObject
+	// request
+	S3EventObjectRemovedDelete = "ObjectRemoved:Delete"
+)
+
+// S3EventBuilder builds an S3 notification event with a record for each
+// object operation. The records match the event delivered by an
+// S3Permission bucket notification.
+type S3EventBuilder struct {
+	bucketName string
+	region     string
+	records    []awsLambdaEvents.S3EventRecord
+}
+
+// NewS3EventBuilder returns a builder for notifications from the bucket
+func NewS3EventBuilder(bucketName string) *S3EventBuilder {
+	return &S3EventBuilder{
+		bucketName: bucketName,
+		region:     mockRegion,
+	}
+}
+
+// Region sets the region of the bucket. Defaults to us-east-1.
+func (builder *S3EventBuilder) Region(region string) *S3EventBuilder {
+	builder.region = region
+	return builder
+}
+
+// ObjectCreated adds an ObjectCreated:Put record for the object
+func (builder *S3EventBuilder) ObjectCreated(objectKey string, size int64) *S3EventBuilder {
+	return builder.Record(S3EventObjectCreatedPut, objectKey, size)
+}
+
+// ObjectRemoved adds an ObjectRemoved:Delete record for the object
+func (builder *S3EventBuilder) ObjectRemoved(objectKey string) *S3EventBuilder {
+	return builder.Record(S3EventObjectRemovedDelete, objectKey, 0)
+}
+
+// Record adds a record with the event name (eg, ObjectCreated:Copy) for
+// the object. The object key is URL encoded as it is in S3 notifications.
+func (builder *S3EventBuilder) Record(eventName string, objectKey string, size int64) *S3EventBuilder {
+	s3Object := awsLambdaEvents.S3Object{
+		Key:       url.QueryEscape(objectKey),
+		Sequencer: fmt.Sprintf("%018X", time.Now().UnixNano()+int64(len(builder.records))),
+	}
+	// Removed objects don't have a size or ETag
+	if eventName != S3EventObjectRemovedDelete {
+		keyHash := md5.Sum([]byte(objectKey))
+		s3Object.Size = size
+		s3Object.ETag = hex.EncodeToString(keyHash[:])
+	}
+	builder.records = append(builder.records, awsLambdaEvents.S3EventRecord{
+		EventVersion: "2.1",
+		EventSource:  "aws:s3",
+		EventTime:    time.Now().UTC(),
+		EventName:    eventName,
+		PrincipalID: awsLambdaEvents.S3UserIdentity{
+			PrincipalID: "AWS:MOCKPRINCIPAL",
+		},
+		RequestParameters: awsLambdaEvents.S3RequestParameters{
+			SourceIPAddress: "127.0.0.1",
+		},
+		ResponseElements: map[string]string{
+			"x-amz-request-id": mockRequestID,
+			"x-amz-id-2":       "mock",
+		},
+		S3: awsLambdaEvents.S3Entity{
+			SchemaVersion:   "1.0",
+			ConfigurationID: "SpartaMockEvent",
+			Bucket: awsLambdaEvents.S3Bucket{
+				Name: builder.bucketName,
+				OwnerIdentity: awsLambdaEvents.S3UserIdentity{
+					PrincipalID: "MOCKOWNER",
+				},
+				Arn: fmt.Sprintf("arn:aws:s3:::%s", builder.bucketName),
+			},
+			Object: s3Object,
+		},
+	})
+	return builder
+}
+
+// Build returns the S3 event
+func (builder *S3EventBuilder) Build() *awsLambdaEvents.S3Event {
+	s3Event := &awsLambdaEvents.S3Event{
+		Records: make([]awsLambdaEvents.S3EventRecord, len(builder.records)),
+	}
+	for eachIndex, eachRecord := range builder.records {
+		eachRecord.AWSRegion = builder.region
+		s3Event.Records[eachIndex] = eachRecord
+	}
+	return s3Event
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// SNSEventBuilder builds an SNS notification event with a record for each
+// published message. The records match the event delivered by an
+// SNSPermission topic subscription.
+type SNSEventBuilder struct {
+	topicArn string
+	records  []awsLambdaEvents.SNSEventRecord
+}
+
+// NewSNSEventBuilder returns a builder for notifications from the topic
+func NewSNSEventBuilder(topicArn string) *SNSEventBuilder {
+	return &SNSEventBuilder{
+		topicArn: topicArn,
+	}
+}
+
+// Message adds a record for the published message
+func (builder *SNSEventBuilder) Message(subject string, message string) *SNSEventBuilder {
+	return builder.MessageWithAttributes(subject, message, nil)
+}
+
+// MessageWithAttributes adds a record for the published message with
+// String message attributes
+func (builder *SNSEventBuilder) MessageWithAttributes(subject string,
+	message string,
+	attributes map[string]string) *SNSEventBuilder {
+
+	messageAttributes := make(map[string]interface{}, len(attributes))
+	for eachName, eachValue := range attributes {
+		messageAttributes[eachName] = map[string]interface{}{
+			"Type":  "String",
+			"Value": eachValue,
+		}
+	}
+	region := mockARNRegion(builder.topicArn)
+	messageID := fmt.Sprintf("%s-%d", mockRequestID, len(builder.records))
+	builder.records = append(builder.records, awsLambdaEvents.SNSEventRecord{
+		EventVersion:         "1.0",
+		EventSubscriptionArn: fmt.Sprintf("%s:%s", builder.topicArn, mockRequestID),
+		EventSource:          "aws:sns",
+		SNS: awsLambdaEvents.SNSEntity{
+			SignatureVersion:  "1",
+			Timestamp:         time.Now().UTC(),
+			Signature:         "mock",
+			SigningCertURL:    fmt.Sprintf("https://sns.%s.amazonaws.com/mock.pem", region),
+			MessageID:         messageID,
+			Message:           message,
+			MessageAttributes: messageAttributes,
+			Type:              "Notification",
+			UnsubscribeURL: fmt.Sprintf("https://sns.%s.amazonaws.com/?Action=Unsubscribe&SubscriptionArn=%s:%s",
+				region,
+				builder.topicArn,
+				mockRequestID),
+			TopicArn: builder.topicArn,
+			Subject:  subject,
+		},
+	})
+	return builder
+}
+
+// Build returns the SNS event
+func (builder *SNSEventBuilder) Build() *awsLambdaEvents.SNSEvent {
+	return &awsLambdaEvents.SNSEvent{
+		Records: append([]awsLambdaEvents.SNSEventRecord{}, builder.records...),
+	}
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+)
+
+// SQSEventBuilder builds an SQS event with a record for each received
+// message. The records match the batch delivered by an SQS
+// EventSourceMapping.
+type SQSEventBuilder struct {
+	queueArn string
+	records  []awsLambdaEvents.SQSMessage
+}
+
+// NewSQSEventBuilder returns a builder for messages received from the queue
+func NewSQSEventBuilder(queueArn string) *SQSEventBuilder {
+	return &SQSEventBuilder{
+		queueArn: queueArn,
+	}
+}
+
+// Message adds a record for the message body
+func (builder *SQSEventBuilder) Message(body string) *SQSEventBuilder {
+	return builder.MessageWithAttributes(body, nil)
+}
+
+// MessageWithAttributes adds a record for the message body with String
+// message attributes
+func (builder *SQSEventBuilder) MessageWithAttributes(body string, attributes map[string]string) *SQSEventBuilder {
+	messageAttributes := make(map[string]awsLambdaEvents.SQSMessageAttribute, len(attributes))
+	for eachName, eachValue := range attributes {
+		stringValue := eachValue
+		messageAttributes[eachName] = awsLambdaEvents.SQSMessageAttribute{
+			StringValue:      &stringValue,
+			StringListValues: []string{},
+			BinaryListValues: [][]byte{},
+			DataType:         "String",
+		}
+	}
+	bodyHash := md5.Sum([]byte(body))
+	sentTimestamp := fmt.Sprintf("%d", time.Now().UnixNano()/int64(time.Millisecond))
+	builder.records = append(builder.records, awsLambdaEvents.SQSMessage{
+		MessageId:     fmt.Sprintf("%s-%d", mockRequestID, len(builder.records)),
+		ReceiptHandle: "MockReceiptHandle",
+		Body:          body,
+		Md5OfBody:     hex.EncodeToString(bodyHash[:]),
+		Attributes: map[string]string{
+			"ApproximateReceiveCount":          "1",
+			"SentTimestamp":                    sentTimestamp,
+			"SenderId":                         mockARNAccountID(builder.queueArn),
+			"ApproximateFirstReceiveTimestamp": sentTimestamp,
+		},
+		MessageAttributes: messageAttributes,
+		EventSourceARN:    builder.queueArn,
+		EventSource:       "aws:sqs",
+		AWSRegion:         mockARNRegion(builder.queueArn),
+	})
+	return builder
+}
+
+// Build returns the SQS event
+func (builder *SQSEventBuilder) Build() *awsLambdaEvents.SQSEvent {
+	return &awsLambdaEvents.SQSEvent{
+		Records: append([]awsLambdaEvents.SQSMessage{}, builder.records...),
+	}
+}
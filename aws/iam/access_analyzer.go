@@ -0,0 +1,116 @@
+package iam
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/restjson"
+	"github.com/pkg/errors"
+)
+
+// The vendored aws-sdk-go release predates the IAM Access Analyzer
+// ValidatePolicy API, so this file includes a minimal client for it.
+// Ref: https://docs.aws.amazon.com/access-analyzer/latest/APIReference/API_ValidatePolicy.html
+
+// Access Analyzer ValidatePolicy finding types
+const (
+	// @enum PolicyFindingType
+	PolicyFindingTypeError = "ERROR"
+	// @enum PolicyFindingType
+	PolicyFindingTypeSecurityWarning = "SECURITY_WARNING"
+	// @enum PolicyFindingType
+	PolicyFindingTypeWarning = "WARNING"
+	// @enum PolicyFindingType
+	PolicyFindingTypeSuggestion = "SUGGESTION"
+)
+
+const (
+	accessAnalyzerEndpointsID = "access-analyzer"
+	accessAnalyzerServiceName = "AccessAnalyzer"
+	accessAnalyzerAPIVersion  = "2019-11-01"
+	// Only identity policies are attached to Lambda execution roles
+	policyTypeIdentityPolicy = "IDENTITY_POLICY"
+)
+
+// PolicyFinding is an IAM Access Analyzer policy validation finding
+type PolicyFinding struct {
+	_ struct{} `type:"structure"`
+	// FindingType is one of the PolicyFindingType* values
+	FindingType *string `locationName:"findingType" type:"string"`
+	// IssueCode identifies the issue (eg, MISSING_VERSION)
+	IssueCode *string `locationName:"issueCode" type:"string"`
+	// FindingDetails describes the issue
+	FindingDetails *string `locationName:"findingDetails" type:"string"`
+	// LearnMoreLink is a link to the finding's documentation
+	LearnMoreLink *string `locationName:"learnMoreLink" type:"string"`
+}
+
+type validatePolicyInput struct {
+	_              struct{} `type:"structure"`
+	MaxResults     *int64   `location:"querystring" locationName:"maxResults" type:"integer"`
+	NextToken      *string  `location:"querystring" locationName:"nextToken" type:"string"`
+	PolicyDocument *string  `locationName:"policyDocument" type:"string" required:"true"`
+	PolicyType     *string  `locationName:"policyType" type:"string" required:"true"`
+}
+
+type validatePolicyOutput struct {
+	_         struct{}         `type:"structure"`
+	Findings  []*PolicyFinding `locationName:"findings" type:"list"`
+	NextToken *string          `locationName:"nextToken" type:"string"`
+}
+
+func newAccessAnalyzerClient(awsSession *session.Session) *client.Client {
+	clientConfig := awsSession.ClientConfig(accessAnalyzerEndpointsID)
+	if clientConfig.SigningNameDerived || len(clientConfig.SigningName) == 0 {
+		clientConfig.SigningName = accessAnalyzerEndpointsID
+	}
+	analyzerClient := client.New(*clientConfig.Config,
+		metadata.ClientInfo{
+			ServiceName:   accessAnalyzerServiceName,
+			ServiceID:     accessAnalyzerServiceName,
+			SigningName:   clientConfig.SigningName,
+			SigningRegion: clientConfig.SigningRegion,
+			Endpoint:      clientConfig.Endpoint,
+			APIVersion:    accessAnalyzerAPIVersion,
+		},
+		clientConfig.Handlers)
+	analyzerClient.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	analyzerClient.Handlers.Build.PushBackNamed(restjson.BuildHandler)
+	analyzerClient.Handlers.Unmarshal.PushBackNamed(restjson.UnmarshalHandler)
+	analyzerClient.Handlers.UnmarshalMeta.PushBackNamed(restjson.UnmarshalMetaHandler)
+	analyzerClient.Handlers.UnmarshalError.PushBackNamed(restjson.UnmarshalErrorHandler)
+	return analyzerClient
+}
+
+// ValidatePolicy runs the identity policy document through the IAM
+// Access Analyzer ValidatePolicy API and returns all the findings. The
+// document must not include CloudFormation intrinsic functions.
+func ValidatePolicy(awsSession *session.Session, policyDocument string) ([]*PolicyFinding, error) {
+	analyzerClient := newAccessAnalyzerClient(awsSession)
+	operation := &request.Operation{
+		Name:       "ValidatePolicy",
+		HTTPMethod: "POST",
+		HTTPPath:   "/policy/validation",
+	}
+	findings := make([]*PolicyFinding, 0)
+	input := &validatePolicyInput{
+		PolicyDocument: aws.String(policyDocument),
+		PolicyType:     aws.String(policyTypeIdentityPolicy),
+	}
+	for {
+		output := &validatePolicyOutput{}
+		validateRequest := analyzerClient.NewRequest(operation, input, output)
+		if sendErr := validateRequest.Send(); sendErr != nil {
+			return nil, errors.Wrapf(sendErr, "Failed to validate IAM policy")
+		}
+		findings = append(findings, output.Findings...)
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	return findings, nil
+}
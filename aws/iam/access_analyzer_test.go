@@ -0,0 +1,61 @@
+package iam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if r.URL.Path != "/policy/validation" {
+			t.Errorf("Unexpected ValidatePolicy path: %s", r.URL.Path)
+		}
+		body := make(map[string]string)
+		if decodeErr := json.NewDecoder(r.Body).Decode(&body); decodeErr != nil ||
+			body["policyType"] != policyTypeIdentityPolicy ||
+			body["policyDocument"] == "" {
+			t.Errorf("Unexpected ValidatePolicy request: %v (%v)", body, decodeErr)
+		}
+		response := map[string]interface{}{
+			"findings": []map[string]string{
+				{
+					"findingType": PolicyFindingTypeSecurityWarning,
+					"issueCode":   "PASS_ROLE_WITH_STAR_IN_RESOURCE",
+				},
+			},
+		}
+		if r.URL.Query().Get("nextToken") == "" {
+			response["nextToken"] = "page2"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	findings, findingsErr := ValidatePolicy(awsSession,
+		`{"Version":"2012-10-17","Statement":[]}`)
+	if findingsErr != nil {
+		t.Fatalf("Failed to validate policy: %s", findingsErr)
+	}
+	if requestCount != 2 || len(findings) != 2 {
+		t.Fatalf("Failed to page ValidatePolicy findings. Requests: %d, Findings: %d",
+			requestCount,
+			len(findings))
+	}
+	if aws.StringValue(findings[0].FindingType) != PolicyFindingTypeSecurityWarning {
+		t.Fatalf("Unexpected finding type: %s", aws.StringValue(findings[0].FindingType))
+	}
+}
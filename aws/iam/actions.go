@@ -0,0 +1,272 @@
+package iam
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// reAction is the format of an IAM action: <service-prefix>:<action>. The
+// action may include wildcards (eg, s3:Get*). Service prefixes are case
+// insensitive (eg, SQS:ReceiveMessage).
+var reAction = regexp.MustCompile(`^([A-Za-z0-9-]+):([A-Za-z0-9*?]+)$`)
+
+// knownServicePrefixes is the set of IAM service prefixes used to validate
+// policy actions. See
+// https://docs.aws.amazon.com/service-authorization/latest/reference/reference_policies_actions-resources-contextkeys.html
+// for the complete list. Use RegisterServicePrefix to add prefixes that
+// aren't included.
+var knownServicePrefixes = map[string]bool{
+	"a4b":                      true,
+	"access-analyzer":          true,
+	"acm":                      true,
+	"acm-pca":                  true,
+	"airflow":                  true,
+	"amplify":                  true,
+	"aoss":                     true,
+	"apigateway":               true,
+	"app-integrations":         true,
+	"appconfig":                true,
+	"appflow":                  true,
+	"application-autoscaling":  true,
+	"application-cost-profile": true,
+	"applicationinsights":      true,
+	"appmesh":                  true,
+	"apprunner":                true,
+	"appstream":                true,
+	"appsync":                  true,
+	"athena":                   true,
+	"autoscaling":              true,
+	"autoscaling-plans":        true,
+	"aws-marketplace":          true,
+	"aws-portal":               true,
+	"backup":                   true,
+	"batch":                    true,
+	"bedrock":                  true,
+	"budgets":                  true,
+	"ce":                       true,
+	"chatbot":                  true,
+	"cloud9":                   true,
+	"clouddirectory":           true,
+	"cloudformation":           true,
+	"cloudfront":               true,
+	"cloudhsm":                 true,
+	"cloudsearch":              true,
+	"cloudshell":               true,
+	"cloudtrail":               true,
+	"cloudwatch":               true,
+	"cloudwatch-synthetics":    true,
+	"codeartifact":             true,
+	"codebuild":                true,
+	"codecommit":               true,
+	"codedeploy":               true,
+	"codeguru-profiler":        true,
+	"codeguru-reviewer":        true,
+	"codepipeline":             true,
+	"codestar":                 true,
+	"codestar-connections":     true,
+	"codestar-notifications":   true,
+	"cognito-identity":         true,
+	"cognito-idp":              true,
+	"cognito-sync":             true,
+	"comprehend":               true,
+	"config":                   true,
+	"connect":                  true,
+	"cur":                      true,
+	"databrew":                 true,
+	"dataexchange":             true,
+	"datapipeline":             true,
+	"datasync":                 true,
+	"dax":                      true,
+	"detective":                true,
+	"devicefarm":               true,
+	"directconnect":            true,
+	"dlm":                      true,
+	"dms":                      true,
+	"ds":                       true,
+	"dynamodb":                 true,
+	"ebs":                      true,
+	"ec2":                      true,
+	"ec2-instance-connect":     true,
+	"ec2messages":              true,
+	"ecr":                      true,
+	"ecr-public":               true,
+	"ecs":                      true,
+	"eks":                      true,
+	"elasticache":              true,
+	"elasticbeanstalk":         true,
+	"elasticfilesystem":        true,
+	"elasticloadbalancing":     true,
+	"elasticmapreduce":         true,
+	"elastictranscoder":        true,
+	"emr-containers":           true,
+	"emr-serverless":           true,
+	"es":                       true,
+	"events":                   true,
+	"execute-api":              true,
+	"firehose":                 true,
+	"fis":                      true,
+	"fms":                      true,
+	"forecast":                 true,
+	"frauddetector":            true,
+	"fsx":                      true,
+	"gamelift":                 true,
+	"geo":                      true,
+	"glacier":                  true,
+	"globalaccelerator":        true,
+	"glue":                     true,
+	"grafana":                  true,
+	"greengrass":               true,
+	"groundstation":            true,
+	"guardduty":                true,
+	"health":                   true,
+	"iam":                      true,
+	"identitystore":            true,
+	"imagebuilder":             true,
+	"inspector":                true,
+	"inspector2":               true,
+	"iot":                      true,
+	"iotanalytics":             true,
+	"iotevents":                true,
+	"iotsitewise":              true,
+	"iottwinmaker":             true,
+	"ivs":                      true,
+	"kafka":                    true,
+	"kafka-cluster":            true,
+	"kafkaconnect":             true,
+	"kendra":                   true,
+	"kinesis":                  true,
+	"kinesisanalytics":         true,
+	"kinesisvideo":             true,
+	"kms":                      true,
+	"lakeformation":            true,
+	"lambda":                   true,
+	"lex":                      true,
+	"license-manager":          true,
+	"lightsail":                true,
+	"logs":                     true,
+	"lookoutvision":            true,
+	"machinelearning":          true,
+	"macie2":                   true,
+	"managedblockchain":        true,
+	"mediaconvert":             true,
+	"medialive":                true,
+	"mediapackage":             true,
+	"mediastore":               true,
+	"mediatailor":              true,
+	"memorydb":                 true,
+	"mgh":                      true,
+	"mobileanalytics":          true,
+	"mq":                       true,
+	"neptune-db":               true,
+	"network-firewall":         true,
+	"networkmanager":           true,
+	"opsworks":                 true,
+	"organizations":            true,
+	"outposts":                 true,
+	"personalize":              true,
+	"pi":                       true,
+	"pipes":                    true,
+	"polly":                    true,
+	"pricing":                  true,
+	"qldb":                     true,
+	"quicksight":               true,
+	"ram":                      true,
+	"rds":                      true,
+	"rds-data":                 true,
+	"rds-db":                   true,
+	"redshift":                 true,
+	"redshift-data":            true,
+	"redshift-serverless":      true,
+	"rekognition":              true,
+	"resource-explorer-2":      true,
+	"resource-groups":          true,
+	"robomaker":                true,
+	"route53":                  true,
+	"route53domains":           true,
+	"route53resolver":          true,
+	"rum":                      true,
+	"s3":                       true,
+	"s3-object-lambda":         true,
+	"s3-outposts":              true,
+	"sagemaker":                true,
+	"savingsplans":             true,
+	"scheduler":                true,
+	"schemas":                  true,
+	"sdb":                      true,
+	"secretsmanager":           true,
+	"securityhub":              true,
+	"serverlessrepo":           true,
+	"servicecatalog":           true,
+	"servicediscovery":         true,
+	"servicequotas":            true,
+	"ses":                      true,
+	"shield":                   true,
+	"signer":                   true,
+	"sms":                      true,
+	"sms-voice":                true,
+	"snowball":                 true,
+	"sns":                      true,
+	"sqs":                      true,
+	"ssm":                      true,
+	"ssm-contacts":             true,
+	"ssm-incidents":            true,
+	"ssmmessages":              true,
+	"sso":                      true,
+	"sso-directory":            true,
+	"states":                   true,
+	"storagegateway":           true,
+	"sts":                      true,
+	"support":                  true,
+	"swf":                      true,
+	"synthetics":               true,
+	"tag":                      true,
+	"textract":                 true,
+	"timestream":               true,
+	"transcribe":               true,
+	"transfer":                 true,
+	"translate":                true,
+	"trustedadvisor":           true,
+	"verifiedpermissions":      true,
+	"waf":                      true,
+	"waf-regional":             true,
+	"wafv2":                    true,
+	"wellarchitected":          true,
+	"workdocs":                 true,
+	"worklink":                 true,
+	"workmail":                 true,
+	"workspaces":               true,
+	"xray":                     true,
+}
+var knownServicePrefixesMutex sync.RWMutex
+
+// RegisterServicePrefix adds an IAM service prefix to the set of
+// prefixes that ValidateAction accepts
+func RegisterServicePrefix(prefix string) {
+	knownServicePrefixesMutex.Lock()
+	defer knownServicePrefixesMutex.Unlock()
+	knownServicePrefixes[strings.ToLower(prefix)] = true
+}
+
+// ValidateAction returns an error if the IAM action isn't of the form
+// <service-prefix>:<action> or if the service prefix isn't known
+func ValidateAction(action string) error {
+	if action == "*" {
+		return nil
+	}
+	matches := reAction.FindStringSubmatch(action)
+	if len(matches) != 3 {
+		return errors.Errorf("IAM action must be of the form <service-prefix>:<action>. Found: %s",
+			action)
+	}
+	knownServicePrefixesMutex.RLock()
+	defer knownServicePrefixesMutex.RUnlock()
+	if !knownServicePrefixes[strings.ToLower(matches[1])] {
+		return errors.Errorf("IAM action %s has an unknown service prefix: %s. Use RegisterServicePrefix to add it",
+			action,
+			matches[1])
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package iam
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+// RegionalARN returns an ARN for a resource in the stack's partition,
+// region, and account. The resourceParts are joined without a delimiter:
+//
+//	RegionalARN("sqs", gocf.String("MyQueue"))
+//
+// produces arn:${AWS::Partition}:sqs:${AWS::Region}:${AWS::AccountId}:MyQueue
+func RegionalARN(service string, resourceParts ...gocf.Stringable) *gocf.StringExpr {
+	arnParts := []gocf.Stringable{
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":" + service + ":"),
+		gocf.Ref("AWS::Region"),
+		gocf.String(":"),
+		gocf.Ref("AWS::AccountId"),
+		gocf.String(":"),
+	}
+	return gocf.Join("", append(arnParts, resourceParts...)...)
+}
+
+// GlobalARN returns an ARN for a resource in the stack's partition
+// that doesn't include a region or account (eg, S3 buckets):
+//
+//	GlobalARN("s3", gocf.Ref("MyBucket"), gocf.String("/*"))
+//
+// produces arn:${AWS::Partition}:s3:::${MyBucket}/*
+func GlobalARN(service string, resourceParts ...gocf.Stringable) *gocf.StringExpr {
+	arnParts := []gocf.Stringable{
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":" + service + ":::"),
+	}
+	return gocf.Join("", append(arnParts, resourceParts...)...)
+}
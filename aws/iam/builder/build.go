@@ -19,6 +19,7 @@ import (
 type IAMResourceBuilder struct {
 	builder       *IAMBuilder
 	resourceParts []gocf.Stringable
+	notResource   bool
 }
 
 // Ref inserts a go-cloudformation Ref entry
@@ -129,28 +130,53 @@ func (iamRes *IAMResourceBuilder) Literal(arnPart string) *IAMResourceBuilder {
 
 // ToPolicyStatement finalizes the builder and returns a spartaIAM.PolicyStatements
 func (iamRes *IAMResourceBuilder) ToPolicyStatement() spartaIAM.PolicyStatement {
-	return spartaIAM.PolicyStatement{
-		Action:   iamRes.builder.apiCalls,
-		Effect:   iamRes.builder.effect,
-		Resource: gocf.Join("", iamRes.resourceParts...),
+	statement := spartaIAM.PolicyStatement{
+		Effect:    iamRes.builder.effect,
+		Condition: iamRes.builder.condition,
+	}
+	if iamRes.builder.notActions {
+		statement.NotAction = iamRes.builder.apiCalls
+	} else {
+		statement.Action = iamRes.builder.apiCalls
+	}
+	if iamRes.notResource {
+		statement.NotResource = gocf.Join("", iamRes.resourceParts...)
+	} else {
+		statement.Resource = gocf.Join("", iamRes.resourceParts...)
 	}
+	return statement
 }
 
 // ToPrivilege returns a legacy sparta.IAMRolePrivilege type for this
 // entry
 func (iamRes *IAMResourceBuilder) ToPrivilege() sparta.IAMRolePrivilege {
-	return sparta.IAMRolePrivilege{
-		Actions:  iamRes.builder.apiCalls,
-		Resource: gocf.Join("", iamRes.resourceParts...),
+	privilege := sparta.IAMRolePrivilege{
+		Condition: iamRes.builder.condition,
 	}
+	// Allow is the default
+	if iamRes.builder.effect != "Allow" {
+		privilege.Effect = iamRes.builder.effect
+	}
+	if iamRes.builder.notActions {
+		privilege.NotActions = iamRes.builder.apiCalls
+	} else {
+		privilege.Actions = iamRes.builder.apiCalls
+	}
+	if iamRes.notResource {
+		privilege.NotResource = gocf.Join("", iamRes.resourceParts...)
+	} else {
+		privilege.Resource = gocf.Join("", iamRes.resourceParts...)
+	}
+	return privilege
 }
 
 // IAMBuilder is the intermediate type that
 // creates the Resource to which the privilege applies
 type IAMBuilder struct {
-	apiCalls  []string
-	effect    string
-	condition interface{}
+	apiCalls   []string
+	effect     string
+	condition  interface{}
+	notActions bool
 }
 
 // ForResource returns the IAMPrivilegeBuilder instance
@@ -162,6 +188,23 @@ func (iamRes *IAMBuilder) ForResource() *IAMResourceBuilder {
 	}
 }
 
+// ForNotResource returns the IAMResourceBuilder instance for the
+// resource that the privilege does not apply to (NotResource)
+func (iamRes *IAMBuilder) ForNotResource() *IAMResourceBuilder {
+	return &IAMResourceBuilder{
+		builder:       iamRes,
+		resourceParts: make([]gocf.Stringable, 0),
+		notResource:   true,
+	}
+}
+
+// AsNotActions applies the privilege to every action except the
+// supplied API calls (NotAction)
+func (iamRes *IAMBuilder) AsNotActions() *IAMBuilder {
+	iamRes.notActions = true
+	return iamRes
+}
+
 // WithCondition applies the given condition to the policy
 func (iamRes *IAMBuilder) WithCondition(conditionExpression interface{}) *IAMBuilder {
 	iamRes.condition = conditionExpression
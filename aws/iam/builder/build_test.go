@@ -30,6 +30,23 @@ var iamBuilders = []sparta.IAMRolePrivilege{
 	Allow("sts:AssumeRole").
 		ForPrincipals("ecs-tasks.amazonaws.com").
 		ToPrivilege(),
+	Deny("s3:*").
+		WithCondition(map[string]interface{}{
+			"Bool": map[string]string{
+				"aws:SecureTransport": "false",
+			},
+		}).
+		ForResource().
+		Literal("arn:aws:s3:::").
+		Ref("MyDynamicS3Bucket").
+		Literal("/*").
+		ToPrivilege(),
+	Allow("iam:*", "organizations:*").
+		AsNotActions().
+		ForNotResource().
+		Literal("arn:aws:s3:::").
+		Ref("MyDynamicS3Bucket").
+		ToPrivilege(),
 }
 
 func ExampleIAMResourceBuilder_ssm() {
@@ -6,9 +6,11 @@ import (
 
 // PolicyStatement represents an entry in an IAM policy document
 type PolicyStatement struct {
-	Effect    string
-	Action    []string
-	Resource  *gocf.StringExpr   `json:",omitempty"`
-	Principal *gocf.IAMPrincipal `json:",omitempty"`
-	Condition interface{}        `json:",omitempty"`
+	Effect      string
+	Action      []string           `json:",omitempty"`
+	NotAction   []string           `json:",omitempty"`
+	Resource    *gocf.StringExpr   `json:",omitempty"`
+	NotResource *gocf.StringExpr   `json:",omitempty"`
+	Principal   *gocf.IAMPrincipal `json:",omitempty"`
+	Condition   interface{}        `json:",omitempty"`
 }
@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RetryPolicy is the retry and backoff configuration for AWS API requests.
+// Throttled requests (eg, Rate exceeded) use the throttle delays, which are
+// typically longer, so that concurrent provision operations in the same
+// account spread out their requests.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a request is retried
+	MaxRetries int
+	// MinRetryDelay is the initial backoff for retryable errors
+	MinRetryDelay time.Duration
+	// MaxRetryDelay is the maximum backoff for retryable errors
+	MaxRetryDelay time.Duration
+	// MinThrottleDelay is the initial backoff for throttled requests
+	MinThrottleDelay time.Duration
+	// MaxThrottleDelay is the maximum backoff for throttled requests
+	MaxThrottleDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used by the provision workflow
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:       8,
+		MinRetryDelay:    100 * time.Millisecond,
+		MaxRetryDelay:    10 * time.Second,
+		MinThrottleDelay: 500 * time.Millisecond,
+		MaxThrottleDelay: 30 * time.Second,
+	}
+}
+
+// Backoff returns the jittered exponential delay before the given retry
+// attempt, which starts at 0. The delay is between half and all of the
+// exponential value, capped at the maximum delay.
+func (policy *RetryPolicy) Backoff(attempt int, throttled bool) time.Duration {
+	minDelay := policy.MinRetryDelay
+	maxDelay := policy.MaxRetryDelay
+	if throttled {
+		minDelay = policy.MinThrottleDelay
+		maxDelay = policy.MaxThrottleDelay
+	}
+	if minDelay <= 0 {
+		return 0
+	}
+	delay := maxDelay
+	// Guard against overflow for large attempt counts
+	if attempt < 30 && minDelay<<uint(attempt) < maxDelay {
+		delay = minDelay << uint(attempt)
+	}
+	halfDelay := delay / 2
+	if halfDelay <= 0 {
+		return delay
+	}
+	/* #nosec */
+	return halfDelay + time.Duration(rand.Int63n(int64(halfDelay)+1))
+}
+
+// Apply sets the policy as the retryer for clients created from the
+// configuration and returns the configuration
+func (policy *RetryPolicy) Apply(awsConfig *aws.Config) *aws.Config {
+	return request.WithRetryer(awsConfig, &policyRetryer{
+		DefaultRetryer: client.DefaultRetryer{
+			NumMaxRetries: policy.MaxRetries,
+		},
+		policy: policy,
+	})
+}
+
+// policyRetryer is the request.Retryer for a RetryPolicy. The SDK's
+// DefaultRetryer determines which errors are retryable.
+type policyRetryer struct {
+	client.DefaultRetryer
+	policy *RetryPolicy
+}
+
+// RetryRules returns the delay before retrying the request
+func (retryer *policyRetryer) RetryRules(r *request.Request) time.Duration {
+	return retryer.policy.Backoff(r.RetryCount, r.IsErrorThrottle())
+}
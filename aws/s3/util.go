@@ -2,6 +2,7 @@ package s3
 
 import (
 	"fmt"
+	"io"
 	"mime"
 	"net/url"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	humanize "github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
@@ -20,10 +22,43 @@ import (
 // RollbackFunction called in the event of a stack provisioning failure
 type RollbackFunction func(logger *logrus.Logger) error
 
+// ObjectKey returns the key of the object in s3Bucket at the given URL.
+// Path-style URLs (eg, localstack endpoints) include the bucket name
+// in the URL path. Virtual-hosted URLs include it in the host name.
+func ObjectKey(s3Bucket string, s3ObjectURL string) (string, error) {
+	objectURLParts, objectURLPartsErr := url.Parse(s3ObjectURL)
+	if nil != objectURLPartsErr {
+		return "", objectURLPartsErr
+	}
+	objectKey := strings.TrimPrefix(objectURLParts.Path, "/")
+	hostName := objectURLParts.Hostname()
+	virtualHosted := hostName == s3Bucket || strings.HasPrefix(hostName, s3Bucket+".")
+	if !virtualHosted {
+		objectKey = strings.TrimPrefix(objectKey, s3Bucket+"/")
+	}
+	return objectKey, nil
+}
+
 // CreateS3RollbackFunc creates an S3 rollback function that attempts to delete a previously
 // uploaded item. Note that s3ArtifactURL may include a `versionId` query arg
 // to denote the specific version to delete.
 func CreateS3RollbackFunc(awsSession *session.Session, s3ArtifactURL string) RollbackFunction {
+	artifactURLParts, artifactURLPartsErr := url.Parse(s3ArtifactURL)
+	if nil != artifactURLPartsErr {
+		return func(logger *logrus.Logger) error {
+			return artifactURLPartsErr
+		}
+	}
+	// Bucket is the first component
+	s3Bucket := strings.Split(artifactURLParts.Host, ".")[0]
+	return CreateS3RollbackFuncWithClient(s3.New(awsSession), s3Bucket, s3ArtifactURL)
+}
+
+// CreateS3RollbackFuncWithClient is CreateS3RollbackFunc with the given S3
+// client for an object in s3Bucket
+func CreateS3RollbackFuncWithClient(s3Client s3iface.S3API,
+	s3Bucket string,
+	s3ArtifactURL string) RollbackFunction {
 	return func(logger *logrus.Logger) error {
 		logger.WithFields(logrus.Fields{
 			"URL": s3ArtifactURL,
@@ -32,12 +67,13 @@ func CreateS3RollbackFunc(awsSession *session.Session, s3ArtifactURL string) Rol
 		if nil != artifactURLPartsErr {
 			return artifactURLPartsErr
 		}
-		// Bucket is the first component
-		s3Bucket := strings.Split(artifactURLParts.Host, ".")[0]
-		s3Client := s3.New(awsSession)
+		objectKey, objectKeyErr := ObjectKey(s3Bucket, s3ArtifactURL)
+		if nil != objectKeyErr {
+			return objectKeyErr
+		}
 		params := &s3.DeleteObjectInput{
 			Bucket: aws.String(s3Bucket),
-			Key:    aws.String(artifactURLParts.Path),
+			Key:    aws.String(objectKey),
 		}
 		versionID := artifactURLParts.Query().Get("versionId")
 		if versionID != "" {
@@ -53,6 +89,27 @@ func CreateS3RollbackFunc(awsSession *session.Session, s3ArtifactURL string) Rol
 	}
 }
 
+// UploadProgressFunc is called as a local file is uploaded to S3 with
+// the number of bytes read so far and the total file size
+type UploadProgressFunc func(bytesRead int64, totalBytes int64)
+
+// progressReader reports the number of bytes read from the underlying
+// reader. It intentionally doesn't implement io.ReaderAt so that the
+// uploader reads the body sequentially.
+type progressReader struct {
+	reader     io.Reader
+	bytesRead  int64
+	totalBytes int64
+	progress   UploadProgressFunc
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	readCount, readErr := reader.reader.Read(p)
+	reader.bytesRead += int64(readCount)
+	reader.progress(reader.bytesRead, reader.totalBytes)
+	return readCount, readErr
+}
+
 // UploadLocalFileToS3 takes a local path and uploads the content at localPath
 // to the given S3Bucket and KeyPrefix.  The final S3 keyname is the S3KeyPrefix+
 // the basename of the localPath.
@@ -61,6 +118,38 @@ func UploadLocalFileToS3(localPath string,
 	S3Bucket string,
 	S3KeyName string,
 	logger *logrus.Logger) (string, error) {
+	return UploadLocalFileToS3WithProgress(localPath,
+		awsSession,
+		S3Bucket,
+		S3KeyName,
+		nil,
+		logger)
+}
+
+// UploadLocalFileToS3WithProgress is UploadLocalFileToS3 with an optional
+// function that's notified as the file is read
+func UploadLocalFileToS3WithProgress(localPath string,
+	awsSession *session.Session,
+	S3Bucket string,
+	S3KeyName string,
+	progress UploadProgressFunc,
+	logger *logrus.Logger) (string, error) {
+	return UploadLocalFileToS3WithClient(localPath,
+		s3.New(awsSession),
+		S3Bucket,
+		S3KeyName,
+		progress,
+		logger)
+}
+
+// UploadLocalFileToS3WithClient is UploadLocalFileToS3WithProgress with the
+// given S3 client
+func UploadLocalFileToS3WithClient(localPath string,
+	s3Svc s3iface.S3API,
+	S3Bucket string,
+	S3KeyName string,
+	progress UploadProgressFunc,
+	logger *logrus.Logger) (string, error) {
 
 	// Then do the actual work
 	/* #nosec */
@@ -68,6 +157,7 @@ func UploadLocalFileToS3(localPath string,
 	if nil != err {
 		return "", fmt.Errorf("failed to open local archive for S3 upload: %s", err.Error())
 	}
+	defer reader.Close()
 	uploadInput := &s3manager.UploadInput{
 		Bucket:      &S3Bucket,
 		Key:         &S3KeyName,
@@ -95,8 +185,15 @@ func UploadLocalFileToS3(localPath string,
 		"Key":    S3KeyName,
 		"Size":   humanize.Bytes(uint64(stat.Size())),
 	}).Info("Uploading local file to S3")
+	if progress != nil {
+		uploadInput.Body = &progressReader{
+			reader:     reader,
+			totalBytes: stat.Size(),
+			progress:   progress,
+		}
+	}
 
-	uploader := s3manager.NewUploader(awsSession)
+	uploader := s3manager.NewUploaderWithClient(s3Svc)
 	result, err := uploader.Upload(uploadInput)
 	if nil != err {
 		return "", errors.Wrapf(err, "Failed to upload object to S3")
@@ -124,8 +221,15 @@ func UploadLocalFileToS3(localPath string,
 func BucketVersioningEnabled(awsSession *session.Session,
 	S3Bucket string,
 	logger *logrus.Logger) (bool, error) {
+	return BucketVersioningEnabledWithClient(s3.New(awsSession), S3Bucket, logger)
+}
+
+// BucketVersioningEnabledWithClient is BucketVersioningEnabled with the
+// given S3 client
+func BucketVersioningEnabledWithClient(s3Svc s3iface.S3API,
+	S3Bucket string,
+	logger *logrus.Logger) (bool, error) {
 
-	s3Svc := s3.New(awsSession)
 	params := &s3.GetBucketVersioningInput{
 		Bucket: aws.String(S3Bucket), // Required
 	}
@@ -156,3 +260,14 @@ func BucketRegion(awsSession *session.Session,
 		S3Bucket,
 		regionHint)
 }
+
+// BucketRegionWithClient returns the AWS region that hosts the bucket. The
+// client's region is used as the hint.
+func BucketRegionWithClient(s3Svc s3iface.S3API,
+	S3Bucket string,
+	logger *logrus.Logger) (string, error) {
+	awsContext := aws.BackgroundContext()
+	return s3manager.GetBucketRegionWithClient(awsContext,
+		s3Svc,
+		S3Bucket)
+}
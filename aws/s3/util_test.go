@@ -0,0 +1,27 @@
+package s3
+
+import (
+	"testing"
+)
+
+func TestObjectKey(t *testing.T) {
+	testURLs := map[string]string{
+		"https://my-bucket.s3.amazonaws.com/MyService/code.zip":                  "MyService/code.zip",
+		"https://my-bucket.s3.us-west-2.amazonaws.com/MyService/code.zip?v=1":    "MyService/code.zip",
+		"https://s3.us-west-2.amazonaws.com/my-bucket/MyService/code.zip":        "MyService/code.zip",
+		"http://localhost:4566/my-bucket/MyService/code.zip":                     "MyService/code.zip",
+		"https://my-bucket-logs.s3.amazonaws.com/my-bucket/MyService/code.zip":   "MyService/code.zip",
+		"https://s3.amazonaws.com/my-bucket/my-bucket/MyService/code.zip":        "my-bucket/MyService/code.zip",
+		"https://my-bucket.s3.amazonaws.com/my-bucket/MyService/code.zip":        "my-bucket/MyService/code.zip",
+		"https://s3.us-west-2.amazonaws.com/my-bucket/my-bucket-prefix/code.zip": "my-bucket-prefix/code.zip",
+	}
+	for eachURL, expectedKey := range testURLs {
+		objectKey, objectKeyErr := ObjectKey("my-bucket", eachURL)
+		if objectKeyErr != nil {
+			t.Fatalf("Failed to parse object URL %s: %s", eachURL, objectKeyErr)
+		}
+		if objectKey != expectedKey {
+			t.Fatalf("Unexpected object key for %s: %s", eachURL, objectKey)
+		}
+	}
+}
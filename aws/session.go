@@ -1,12 +1,26 @@
 package aws
 
 import (
+	"os"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// LocalstackEndpointEnvVar is the environment variable that provides the
+	// localstack endpoint if the --localstack flag isn't set
+	LocalstackEndpointEnvVar = "SPARTA_LOCALSTACK_ENDPOINT"
+	// DefaultLocalstackEndpoint is the localstack edge service endpoint
+	DefaultLocalstackEndpoint = "http://localhost:4566"
+	// localstackDefaultRegion is the region used if AWS_REGION and
+	// AWS_DEFAULT_REGION aren't set
+	localstackDefaultRegion = "us-east-1"
+)
+
 type logrusProxy struct {
 	logger *logrus.Logger
 }
@@ -77,3 +91,32 @@ func NewSessionWithConfigLevel(awsConfig *aws.Config,
 	}).Debug("AWS SDK Info")
 	return sess
 }
+
+// NewLocalstackSession returns an AWS Session whose clients use the
+// localstack (https://github.com/localstack/localstack) endpoint. S3 requests
+// use path-style addressing and requests are signed with static test
+// credentials, so AWS credentials aren't required.
+func NewLocalstackSession(endpoint string, logger *logrus.Logger) *session.Session {
+	if endpoint == "" {
+		endpoint = DefaultLocalstackEndpoint
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = localstackDefaultRegion
+	}
+	awsConfig := &aws.Config{
+		Endpoint:                      aws.String(endpoint),
+		Region:                        aws.String(region),
+		S3ForcePathStyle:              aws.Bool(true),
+		Credentials:                   credentials.NewStaticCredentials("test", "test", ""),
+		CredentialsChainVerboseErrors: aws.Bool(true),
+	}
+	logger.WithFields(logrus.Fields{
+		"Endpoint": endpoint,
+		"Region":   region,
+	}).Info("Using localstack endpoint")
+	return NewSessionWithConfig(awsConfig, logger)
+}
@@ -0,0 +1,41 @@
+package step
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+// The following types extend the go-cloudformation
+// AWS::StepFunctions::StateMachine definition with properties that were
+// introduced after the schema was generated.
+
+type stepFunctionsStateMachineCloudWatchLogsLogGroup struct {
+	LogGroupArn *gocf.StringExpr `json:"LogGroupArn,omitempty"`
+}
+
+type stepFunctionsStateMachineLogDestination struct {
+	CloudWatchLogsLogGroup *stepFunctionsStateMachineCloudWatchLogsLogGroup `json:"CloudWatchLogsLogGroup,omitempty"`
+}
+
+type stepFunctionsStateMachineLoggingConfiguration struct {
+	Destinations         []stepFunctionsStateMachineLogDestination `json:"Destinations,omitempty"`
+	IncludeExecutionData *gocf.BoolExpr                            `json:"IncludeExecutionData,omitempty"`
+	Level                *gocf.StringExpr                          `json:"Level,omitempty"`
+}
+
+// stepFunctionsStateMachine represents the AWS::StepFunctions::StateMachine
+// resource, including the StateMachineType and LoggingConfiguration properties
+type stepFunctionsStateMachine struct {
+	gocf.StepFunctionsStateMachine
+	LoggingConfiguration *stepFunctionsStateMachineLoggingConfiguration `json:"LoggingConfiguration,omitempty"`
+	StateMachineType     *gocf.StringExpr                               `json:"StateMachineType,omitempty"`
+}
+
+// CfnResourceType returns AWS::StepFunctions::StateMachine to implement the ResourceProperties interface
+func (s stepFunctionsStateMachine) CfnResourceType() string {
+	return "AWS::StepFunctions::StateMachine"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s stepFunctionsStateMachine) CfnResourceAttributes() []string {
+	return []string{"Name"}
+}
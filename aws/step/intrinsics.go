@@ -0,0 +1,101 @@
+package step
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Intrinsic functions are used as the values of dynamic parameters,
+// whose field names end with `.$`. Arguments are either JSONPath
+// expressions, nested intrinsic functions, or literal values. Use
+// IntrinsicString to quote literal string arguments.
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/amazon-states-language-intrinsic-functions.html
+
+// IntrinsicString returns a single-quoted string literal argument,
+// escaping the reserved characters
+func IntrinsicString(value string) string {
+	escaper := strings.NewReplacer(`\`, `\\`,
+		`'`, `\'`,
+		`{`, `\{`,
+		`}`, `\}`)
+	return fmt.Sprintf("'%s'", escaper.Replace(value))
+}
+
+func intrinsicFunction(functionName string, args ...string) string {
+	return fmt.Sprintf("States.%s(%s)", functionName, strings.Join(args, ", "))
+}
+
+// IntrinsicFormat returns a States.Format expression. The template is
+// a literal string with `{}` placeholders.
+func IntrinsicFormat(template string, args ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	allArgs := append([]string{fmt.Sprintf("'%s'", escaper.Replace(template))}, args...)
+	return intrinsicFunction("Format", allArgs...)
+}
+
+// IntrinsicStringToJSON returns a States.StringToJson expression
+func IntrinsicStringToJSON(arg string) string {
+	return intrinsicFunction("StringToJson", arg)
+}
+
+// IntrinsicJSONToString returns a States.JsonToString expression
+func IntrinsicJSONToString(arg string) string {
+	return intrinsicFunction("JsonToString", arg)
+}
+
+// IntrinsicArray returns a States.Array expression
+func IntrinsicArray(args ...string) string {
+	return intrinsicFunction("Array", args...)
+}
+
+// IntrinsicArrayPartition returns a States.ArrayPartition expression
+func IntrinsicArrayPartition(array string, chunkSize string) string {
+	return intrinsicFunction("ArrayPartition", array, chunkSize)
+}
+
+// IntrinsicArrayContains returns a States.ArrayContains expression
+func IntrinsicArrayContains(array string, value string) string {
+	return intrinsicFunction("ArrayContains", array, value)
+}
+
+// IntrinsicArrayLength returns a States.ArrayLength expression
+func IntrinsicArrayLength(array string) string {
+	return intrinsicFunction("ArrayLength", array)
+}
+
+// IntrinsicJSONMerge returns a States.JsonMerge expression. Only shallow
+// merges are supported by Step Functions.
+func IntrinsicJSONMerge(left string, right string) string {
+	return intrinsicFunction("JsonMerge", left, right, "false")
+}
+
+// IntrinsicMathAdd returns a States.MathAdd expression
+func IntrinsicMathAdd(left string, right string) string {
+	return intrinsicFunction("MathAdd", left, right)
+}
+
+// IntrinsicStringSplit returns a States.StringSplit expression
+func IntrinsicStringSplit(value string, delimiter string) string {
+	return intrinsicFunction("StringSplit", value, delimiter)
+}
+
+// IntrinsicHash returns a States.Hash expression. The algorithm is
+// one of MD5, SHA-1, SHA-256, SHA-384, SHA-512.
+func IntrinsicHash(value string, algorithm string) string {
+	return intrinsicFunction("Hash", value, IntrinsicString(algorithm))
+}
+
+// IntrinsicBase64Encode returns a States.Base64Encode expression
+func IntrinsicBase64Encode(value string) string {
+	return intrinsicFunction("Base64Encode", value)
+}
+
+// IntrinsicBase64Decode returns a States.Base64Decode expression
+func IntrinsicBase64Decode(value string) string {
+	return intrinsicFunction("Base64Decode", value)
+}
+
+// IntrinsicUUID returns a States.UUID expression
+func IntrinsicUUID() string {
+	return intrinsicFunction("UUID")
+}
@@ -0,0 +1,59 @@
+package step
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// AWSSDKTaskState represents bindings for the AWS SDK service integrations
+// that call any AWS API action directly from the state machine. The
+// state machine IAM role must be granted the API action privileges
+// via StateMachine.WithRolePrivileges.
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/supported-services-awssdk.html
+type AWSSDKTaskState struct {
+	BaseTask
+	serviceName string
+	apiAction   string
+	parameters  map[string]interface{}
+}
+
+// MarshalJSON for custom marshalling, since this will be stringified and we need it
+// to turn into a stringified
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/supported-services-awssdk.html
+func (sdk *AWSSDKTaskState) MarshalJSON() ([]byte, error) {
+	parameters := sdk.parameters
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	return sdk.BaseTask.marshalMergedParams(fmt.Sprintf("arn:aws:states:::aws-sdk:%s:%s",
+		sdk.serviceName,
+		sdk.apiAction),
+		parameters)
+}
+
+// NewAWSSDKTaskState returns an initialized AWSSDKTaskState. The serviceName
+// is the lowercase SDK service name (eg: "s3", "dynamodb") and the apiAction
+// is the camelCase API action name (eg: "listBuckets"). Parameter names
+// use the PascalCase API request field names. Example:
+//
+//	NewAWSSDKTaskState("ListObjects", "s3", "listObjectsV2", map[string]interface{}{
+//		"Bucket":   "myBucket",
+//		"Prefix.$": "$.prefix",
+//	})
+func NewAWSSDKTaskState(stateName string,
+	serviceName string,
+	apiAction string,
+	parameters map[string]interface{}) *AWSSDKTaskState {
+
+	return &AWSSDKTaskState{
+		BaseTask: BaseTask{
+			baseInnerState: baseInnerState{
+				name: stateName,
+				id:   rand.Int63(),
+			},
+		},
+		serviceName: serviceName,
+		apiAction:   apiAction,
+		parameters:  parameters,
+	}
+}
@@ -29,6 +29,24 @@ import (
 }
 */
 
+const (
+	// MapModeInline processes the Map items within the context of the
+	// parent workflow execution
+	MapModeInline = "INLINE"
+	// MapModeDistributed processes the Map items as child workflow
+	// executions. Only supported by STANDARD state machines.
+	MapModeDistributed = "DISTRIBUTED"
+)
+
+// MapProcessorConfig is the ItemProcessor ProcessorConfig value
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/amazon-states-language-itemprocessor.html
+type MapProcessorConfig struct {
+	Mode string `json:",omitempty"`
+	// ExecutionType is required for DISTRIBUTED mode and is one of
+	// StateMachineTypeStandard or StateMachineTypeExpress
+	ExecutionType string `json:",omitempty"`
+}
+
 // MapState is a synthetic state that executes a dynamically determined set
 // of nodes in parallel
 type MapState struct {
@@ -40,6 +58,20 @@ type MapState struct {
 	MaxConcurrency int    //optional
 	Retriers       []*TaskRetry
 	Catchers       []*TaskCatch
+	// ProcessorConfig is optional. If non-nil, the States are serialized
+	// as the ItemProcessor field and the Parameters as the ItemSelector
+	// field, rather than the legacy Iterator and Parameters fields.
+	ProcessorConfig *MapProcessorConfig
+}
+
+// WithProcessorConfig is the fluent builder for the ItemProcessor
+// ProcessorConfig
+func (ms *MapState) WithProcessorConfig(mode string, executionType string) *MapState {
+	ms.ProcessorConfig = &MapProcessorConfig{
+		Mode:          mode,
+		ExecutionType: executionType,
+	}
+	return ms
 }
 
 // WithResultPath is the fluent builder for the result path
@@ -74,10 +106,14 @@ func (ms *MapState) Next(nextState MachineState) MachineState {
 
 // AdjacentStates returns nodes reachable from this node
 func (ms *MapState) AdjacentStates() []MachineState {
-	if ms.next == nil {
-		return nil
+	adjacent := []MachineState{}
+	if ms.next != nil {
+		adjacent = append(adjacent, ms.next)
+	}
+	for _, eachCatcher := range ms.Catchers {
+		adjacent = append(adjacent, eachCatcher.next)
 	}
-	return []MachineState{ms.next}
+	return adjacent
 }
 
 // Name returns the name of this Task state
@@ -123,7 +159,17 @@ func (ms *MapState) MarshalJSON() ([]byte, error) {
 	// Don't marshal the "End" flag
 	ms.States.disableEndState = true
 	additionalParams := make(map[string]interface{})
-	additionalParams["Iterator"] = ms.States
+	parametersKeyName := "Parameters"
+	if ms.ProcessorConfig != nil {
+		ms.States.processorConfig = ms.ProcessorConfig
+		additionalParams["ItemProcessor"] = ms.States
+		parametersKeyName = "ItemSelector"
+	} else {
+		additionalParams["Iterator"] = ms.States
+	}
+	if ms.MaxConcurrency != 0 {
+		additionalParams["MaxConcurrency"] = ms.MaxConcurrency
+	}
 	if ms.ItemsPath != "" {
 		additionalParams["ItemsPath"] = ms.ItemsPath
 	}
@@ -137,7 +183,7 @@ func (ms *MapState) MarshalJSON() ([]byte, error) {
 		additionalParams["Catch"] = ms.Catchers
 	}
 	if ms.Parameters != nil {
-		additionalParams["Parameters"] = ms.Parameters
+		additionalParams[parametersKeyName] = ms.Parameters
 	}
 
 	return ms.marshalStateJSON("Map", additionalParams)
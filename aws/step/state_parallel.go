@@ -51,10 +51,14 @@ func (ps *ParallelState) Next(nextState MachineState) MachineState {
 
 // AdjacentStates returns nodes reachable from this node
 func (ps *ParallelState) AdjacentStates() []MachineState {
-	if ps.next == nil {
-		return nil
+	adjacent := []MachineState{}
+	if ps.next != nil {
+		adjacent = append(adjacent, ps.next)
 	}
-	return []MachineState{ps.next}
+	for _, eachCatcher := range ps.Catchers {
+		adjacent = append(adjacent, eachCatcher.next)
+	}
+	return adjacent
 }
 
 // Name returns the name of this Task state
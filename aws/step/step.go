@@ -300,6 +300,24 @@ func (tr *TaskRetry) WithBackoffRate(backoffRate float32) *TaskRetry {
 	return tr
 }
 
+// MarshalJSON for custom marshalling s.t. the IntervalSeconds value is
+// expressed in seconds
+func (tr *TaskRetry) MarshalJSON() ([]byte, error) {
+	retryJSON := map[string]interface{}{
+		"ErrorEquals": tr.ErrorEquals,
+	}
+	if tr.IntervalSeconds.Seconds() != 0 {
+		retryJSON["IntervalSeconds"] = int64(tr.IntervalSeconds.Seconds())
+	}
+	if tr.MaxAttempts != 0 {
+		retryJSON["MaxAttempts"] = tr.MaxAttempts
+	}
+	if tr.BackoffRate != 0 {
+		retryJSON["BackoffRate"] = tr.BackoffRate
+	}
+	return json.Marshal(retryJSON)
+}
+
 // NewTaskRetry returns a new TaskRetry instance
 func NewTaskRetry() *TaskRetry {
 	return &TaskRetry{}
@@ -322,7 +340,7 @@ type TaskCatch struct {
 func (tc *TaskCatch) MarshalJSON() ([]byte, error) {
 	catchJSON := map[string]interface{}{
 		"ErrorEquals": tc.errorEquals,
-		"Next":        tc.next,
+		"Next":        tc.next.Name(),
 	}
 	return json.Marshal(catchJSON)
 }
@@ -390,17 +408,10 @@ func (bt *BaseTask) additionalParams() map[string]interface{} {
 		additionalParams["ResultPath"] = bt.ResultPath
 	}
 	if len(bt.Retriers) != 0 {
-		additionalParams["Retry"] = make([]map[string]interface{}, 0)
+		additionalParams["Retry"] = bt.Retriers
 	}
 	if bt.Catchers != nil {
-		catcherMap := make([]map[string]interface{}, len(bt.Catchers))
-		for index, eachCatcher := range bt.Catchers {
-			catcherMap[index] = map[string]interface{}{
-				"ErrorEquals": eachCatcher.errorEquals,
-				"Next":        eachCatcher.next.Name(),
-			}
-		}
-		additionalParams["Catch"] = catcherMap
+		additionalParams["Catch"] = bt.Catchers
 	}
 	return additionalParams
 }
@@ -495,6 +506,9 @@ func (bt *BaseTask) MarshalJSON() ([]byte, error) {
 // LambdaTaskState is the core state, responsible for delegating to a Lambda function
 type LambdaTaskState struct {
 	BaseTask
+	// Parameters is the optional payload template. Keys with the `.$`
+	// suffix are resolved from paths or intrinsic functions.
+	Parameters                map[string]interface{}
 	lambdaFn                  *sparta.LambdaAWSInfo
 	lambdaLogicalResourceName string
 	preexistingDecorator      sparta.TemplateDecorator
@@ -519,7 +533,7 @@ func NewLambdaTaskState(stateName string, lambdaFn *sparta.LambdaAWSInfo) *Lambd
 		S3Key string,
 		buildID string,
 		cfTemplate *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 		if ts.preexistingDecorator != nil {
 			preexistingLambdaDecoratorErr := ts.preexistingDecorator(
@@ -555,6 +569,9 @@ func NewLambdaTaskState(stateName string, lambdaFn *sparta.LambdaAWSInfo) *Lambd
 func (ts *LambdaTaskState) MarshalJSON() ([]byte, error) {
 	additionalParams := ts.BaseTask.additionalParams()
 	additionalParams["Resource"] = gocf.GetAtt(ts.lambdaLogicalResourceName, "Arn")
+	if ts.Parameters != nil {
+		additionalParams["Parameters"] = ts.Parameters
+	}
 	return ts.marshalStateJSON("Task", additionalParams)
 }
 
@@ -781,6 +798,26 @@ Validate-All": {
 // StateMachine
 ////////////////////////////////////////////////////////////////////////////////
 
+const (
+	// StateMachineTypeStandard is the default, long-running, exactly-once
+	// state machine type
+	StateMachineTypeStandard = "STANDARD"
+	// StateMachineTypeExpress is the high-volume, short-duration, at-least-once
+	// state machine type
+	// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/concepts-standard-vs-express.html
+	StateMachineTypeExpress = "EXPRESS"
+)
+
+// StateMachineLoggingConfiguration defines the CloudWatch Logs
+// configuration for the state machine
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/cw-logs.html
+type StateMachineLoggingConfiguration struct {
+	// Level is one of ALL, ERROR, FATAL, OFF
+	Level                string
+	IncludeExecutionData bool
+	LogGroupArn          gocf.Stringable
+}
+
 // StateMachine is the top level item
 type StateMachine struct {
 	name                 string
@@ -789,9 +826,14 @@ type StateMachine struct {
 	startAt              TransitionState
 	uniqueStates         map[string]MachineState
 	roleArn              gocf.Stringable
+	stateMachineType     string
+	loggingConfiguration *StateMachineLoggingConfiguration
+	rolePrivileges       []spartaIAM.PolicyStatement
 	// internal flag to suppress the automatic "End" property
 	// from being serialized for Map states
 	disableEndState bool
+	// internal ItemProcessor config for Map states
+	processorConfig *MapProcessorConfig
 }
 
 //Comment sets the StateMachine comment
@@ -806,6 +848,29 @@ func (sm *StateMachine) WithRoleArn(roleArn gocf.Stringable) *StateMachine {
 	return sm
 }
 
+// WithStateMachineType sets the state machine type. The default
+// type is StateMachineTypeStandard.
+func (sm *StateMachine) WithStateMachineType(stateMachineType string) *StateMachine {
+	sm.stateMachineType = stateMachineType
+	return sm
+}
+
+// WithLoggingConfiguration sets the state machine CloudWatch Logs configuration
+func (sm *StateMachine) WithLoggingConfiguration(loggingConfig *StateMachineLoggingConfiguration) *StateMachine {
+	sm.loggingConfiguration = loggingConfig
+	return sm
+}
+
+// WithRolePrivileges adds IAM statements to the Sparta-managed state machine
+// IAM role. This is typically needed for AWSSDKTaskState and other
+// service integration states. If the state machine doesn't include any
+// LambdaTaskStates and WithRoleArn is used to supply an existing role,
+// the privileges are ignored.
+func (sm *StateMachine) WithRolePrivileges(privileges ...spartaIAM.PolicyStatement) *StateMachine {
+	sm.rolePrivileges = append(sm.rolePrivileges, privileges...)
+	return sm
+}
+
 // validate performs any validation against the state machine
 // prior to marshaling
 func (sm *StateMachine) validate() []error {
@@ -813,16 +878,43 @@ func (sm *StateMachine) validate() []error {
 	if sm.stateDefinitionError != nil {
 		validationErrors = append(validationErrors, sm.stateDefinitionError)
 	}
-
-	// TODO - add Catcher validator
-	/*
-		Each Catcher MUST contain a field named “ErrorEquals”, specified exactly as with the Retrier “ErrorEquals” field, and a field named “Next” whose value MUST be a string exactly matching a State Name.
-
-		When a state reports an error and either there is no Retry field, or retries have failed to resolve the error, the interpreter scans through the Catchers in array order, and when the Error Name appears in the value of a Catcher’s “ErrorEquals” field, transitions the machine to the state named in the value of the “Next” field.
-
-		The reserved name “States.ALL” appearing in a Retrier’s “ErrorEquals” field is a wild-card and matches any Error Name. Such a value MUST appear alone in the “ErrorEquals” array and MUST appear in the last Catcher in the “Catch” array.
-	*/
-	return validationErrors
+	switch sm.stateMachineType {
+	case "", StateMachineTypeStandard, StateMachineTypeExpress:
+		// NOP
+	default:
+		validationErrors = append(validationErrors,
+			errors.Errorf("unsupported StateMachineType: %s", sm.stateMachineType))
+	}
+	if sm.loggingConfiguration != nil {
+		switch sm.loggingConfiguration.Level {
+		case "ALL", "ERROR", "FATAL", "OFF":
+			// NOP
+		default:
+			validationErrors = append(validationErrors,
+				errors.Errorf("unsupported LoggingConfiguration Level: %s",
+					sm.loggingConfiguration.Level))
+		}
+		if sm.loggingConfiguration.Level != "OFF" &&
+			sm.loggingConfiguration.LogGroupArn == nil {
+			validationErrors = append(validationErrors,
+				errors.Errorf("LoggingConfiguration requires a LogGroupArn"))
+		}
+	}
+	// Validate the serialized definition, which is the canonical
+	// representation of all the states
+	jsonBytes, jsonBytesErr := json.Marshal(sm)
+	if jsonBytesErr != nil {
+		return append(validationErrors, jsonBytesErr)
+	}
+	var definition map[string]interface{}
+	unmarshalErr := json.Unmarshal(jsonBytes, &definition)
+	if unmarshalErr != nil {
+		return append(validationErrors, unmarshalErr)
+	}
+	return append(validationErrors,
+		validateStatesDefinition(sm.name,
+			definition,
+			sm.stateMachineType == StateMachineTypeExpress)...)
 }
 
 // StateMachineDecorator is a decorator that returns a default
@@ -835,7 +927,7 @@ func (sm *StateMachine) StateMachineDecorator() sparta.ServiceDecoratorHookFunc
 // StateMachineNamedDecorator is the hook exposed by the StateMachine
 // to insert the AWS Step function into the CloudFormation template
 func (sm *StateMachine) StateMachineNamedDecorator(stepFunctionResourceName string) sparta.ServiceDecoratorHookFunc {
-	return func(context map[string]interface{},
+	return func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -910,7 +1002,9 @@ func (sm *StateMachine) StateMachineNamedDecorator(stepFunctionResourceName stri
 			},
 		}
 		var iamRoleResourceName string
-		if len(lambdaFunctionResourceNames) != 0 {
+		if len(lambdaFunctionResourceNames) != 0 ||
+			(sm.roleArn == nil &&
+				(len(sm.rolePrivileges) != 0 || sm.loggingConfiguration != nil)) {
 			statesIAMRole := &gocf.IAMRole{
 				AssumeRolePolicyDocument: AssumePolicyDocument,
 			}
@@ -926,6 +1020,25 @@ func (sm *StateMachine) StateMachineNamedDecorator(stepFunctionResourceName stri
 					},
 				)
 			}
+			statements = append(statements, sm.rolePrivileges...)
+			// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/cw-logs.html#cloudwatch-iam-policy
+			if sm.loggingConfiguration != nil {
+				statements = append(statements,
+					spartaIAM.PolicyStatement{
+						Effect: "Allow",
+						Action: []string{
+							"logs:CreateLogDelivery",
+							"logs:GetLogDelivery",
+							"logs:UpdateLogDelivery",
+							"logs:DeleteLogDelivery",
+							"logs:ListLogDeliveries",
+							"logs:PutResourcePolicy",
+							"logs:DescribeResourcePolicies",
+							"logs:DescribeLogGroups",
+						},
+						Resource: gocf.String("*"),
+					})
+			}
 			iamPolicies := gocf.IAMRolePolicyList{}
 			iamPolicies = append(iamPolicies, gocf.IAMRolePolicy{
 				PolicyDocument: sparta.ArbitraryJSONObject{
@@ -959,9 +1072,30 @@ func (sm *StateMachine) StateMachineNamedDecorator(stepFunctionResourceName stri
 		}
 
 		// Awsome - add an AWS::StepFunction to the template with this info and roll with it...
-		stepFunctionResource := &gocf.StepFunctionsStateMachine{
-			StateMachineName: gocf.String(sm.name),
-			DefinitionString: templateExpr,
+		stepFunctionResource := &stepFunctionsStateMachine{
+			StepFunctionsStateMachine: gocf.StepFunctionsStateMachine{
+				StateMachineName: gocf.String(sm.name),
+				DefinitionString: templateExpr,
+			},
+		}
+		if sm.stateMachineType != "" {
+			stepFunctionResource.StateMachineType = gocf.String(sm.stateMachineType)
+		}
+		if sm.loggingConfiguration != nil {
+			loggingConfig := &stepFunctionsStateMachineLoggingConfiguration{
+				Level:                gocf.String(sm.loggingConfiguration.Level),
+				IncludeExecutionData: gocf.Bool(sm.loggingConfiguration.IncludeExecutionData),
+			}
+			if sm.loggingConfiguration.LogGroupArn != nil {
+				loggingConfig.Destinations = []stepFunctionsStateMachineLogDestination{
+					{
+						CloudWatchLogsLogGroup: &stepFunctionsStateMachineCloudWatchLogsLogGroup{
+							LogGroupArn: sm.loggingConfiguration.LogGroupArn.String(),
+						},
+					},
+				}
+			}
+			stepFunctionResource.LoggingConfiguration = loggingConfig
 		}
 		if iamRoleResourceName != "" {
 			stepFunctionResource.RoleArn = gocf.GetAtt(iamRoleResourceName, "Arn").String()
@@ -978,15 +1112,17 @@ func (sm *StateMachine) MarshalJSON() ([]byte, error) {
 
 	// If there aren't any states, then it's the end
 	return json.Marshal(&struct {
-		Comment string                  `json:",omitempty"`
-		StartAt string                  `json:",omitempty"`
-		States  map[string]MachineState `json:",omitempty"`
-		End     bool                    `json:",omitempty"`
+		Comment         string                  `json:",omitempty"`
+		StartAt         string                  `json:",omitempty"`
+		States          map[string]MachineState `json:",omitempty"`
+		End             bool                    `json:",omitempty"`
+		ProcessorConfig *MapProcessorConfig     `json:",omitempty"`
 	}{
-		Comment: sm.comment,
-		StartAt: sm.startAt.Name(),
-		States:  sm.uniqueStates,
-		End:     (len(sm.uniqueStates) == 1) && !sm.disableEndState,
+		Comment:         sm.comment,
+		StartAt:         sm.startAt.Name(),
+		States:          sm.uniqueStates,
+		End:             (len(sm.uniqueStates) == 1) && !sm.disableEndState,
+		ProcessorConfig: sm.processorConfig,
 	})
 }
 
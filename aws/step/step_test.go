@@ -2,14 +2,18 @@ package step
 
 import (
 	"context"
+	"encoding/json"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
 	sparta "github.com/mweagle/Sparta"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
 	spartaTesting "github.com/mweagle/Sparta/testing"
 	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -220,3 +224,98 @@ func TestParallelState(t *testing.T) {
 		[]*sparta.LambdaAWSInfo{lambdaMapFn, lambdaProducerFn},
 		stateMachine)
 }
+
+func TestExpressStateMachine(t *testing.T) {
+	lambdaFn, _ := sparta.NewAWSLambda("expressLambdaCallback",
+		applyCallback,
+		sparta.IAMRoleDefinition{})
+	lambdaTaskState := NewLambdaTaskState("lambdaExpress", lambdaFn)
+	lambdaTaskState.Parameters = map[string]interface{}{
+		"greeting.$": IntrinsicFormat("Hello {}", "$.name"),
+		"id.$":       IntrinsicUUID(),
+	}
+	failState := NewFailState("failed", "ExpressFailed", errors.New("Failed to process"))
+	lambdaTaskState.WithRetriers(NewTaskRetry().
+		WithErrors(StatesTaskFailed).
+		WithInterval(2 * time.Second).
+		WithMaxAttempts(3).
+		WithBackoffRate(1.5))
+	lambdaTaskState.WithCatchers(NewTaskCatch(failState, StatesAll))
+
+	// Direct SDK integration
+	listBucketsState := NewAWSSDKTaskState("listBuckets", "s3", "listBuckets", nil)
+	lambdaTaskState.Next(listBucketsState)
+
+	// Inline Map with an ItemProcessor
+	mapTaskState := NewPassState("mapPass", nil)
+	mapState := NewMapState("mapItems", NewStateMachine("mapMachine", mapTaskState)).
+		WithProcessorConfig(MapModeInline, "")
+	mapState.ItemsPath = "$.Buckets"
+	mapState.MaxConcurrency = 4
+	listBucketsState.Next(mapState)
+	mapState.Next(NewSuccessState("success"))
+
+	stateMachineName := spartaCF.UserScopedStackName("TestExpressStateMachine")
+	stateMachine := NewStateMachine(stateMachineName, lambdaTaskState).
+		WithStateMachineType(StateMachineTypeExpress).
+		WithLoggingConfiguration(&StateMachineLoggingConfiguration{
+			Level:       "ERROR",
+			LogGroupArn: gocf.String("arn:aws:logs:us-west-2:123412341234:log-group:states:*"),
+		}).
+		WithRolePrivileges(spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"s3:ListAllMyBuckets"},
+			Resource: gocf.String("*"),
+		})
+
+	jsonBytes, jsonBytesErr := json.Marshal(stateMachine)
+	if jsonBytesErr != nil {
+		t.Fatalf("Failed to marshal state machine: %s", jsonBytesErr)
+	}
+	definition := string(jsonBytes)
+	for _, eachExpected := range []string{`"IntervalSeconds":2`,
+		`"Catch":[{"ErrorEquals":["States.ALL"],"Next":"failed"}]`,
+		"arn:aws:states:::aws-sdk:s3:listBuckets",
+		`"ItemProcessor"`,
+		`States.Format('Hello {}', $.name)`} {
+		if !strings.Contains(definition, eachExpected) {
+			t.Fatalf("Failed to find %s in state machine definition: %s",
+				eachExpected,
+				definition)
+		}
+	}
+	testStepProvision(t,
+		[]*sparta.LambdaAWSInfo{lambdaFn},
+		stateMachine)
+}
+
+func TestInvalidStateMachine(t *testing.T) {
+	successState := NewSuccessState("success")
+	failState := NewFailState("failed", "Failed", errors.New("Failed to process"))
+
+	// States.ALL must be in the last Catcher
+	sqsState := NewAWSSDKTaskState("sendMessage", "sqs", "sendMessage.waitForTaskToken", nil)
+	sqsState.WithCatchers(NewTaskCatch(failState, StatesAll),
+		NewTaskCatch(successState, StatesTimeout))
+	sqsState.Next(successState)
+
+	stateMachine := NewStateMachine(spartaCF.UserScopedStackName("TestInvalidStateMachine"),
+		sqsState).
+		WithStateMachineType(StateMachineTypeExpress)
+	validationErrors := stateMachine.validate()
+	if len(validationErrors) != 2 {
+		t.Fatalf("Expected 2 validation errors, found: %#v", validationErrors)
+	}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			stateMachine.StateMachineDecorator(),
+		},
+	}
+	spartaTesting.ProvisionEx(t,
+		nil,
+		nil,
+		nil,
+		workflowHooks,
+		false,
+		spartaTesting.AssertError("Failed to reject invalid state machine"))
+}
@@ -0,0 +1,204 @@
+package step
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum length of a state name
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/limits-overview.html
+const maxStateNameLength = 80
+
+// Integration pattern suffixes that aren't supported by Express workflows
+// Ref: https://docs.aws.amazon.com/step-functions/latest/dg/connect-supported-services.html
+var expressUnsupportedResourceSuffixes = []string{
+	".sync",
+	".sync:2",
+	".waitForTaskToken",
+}
+
+// validateErrorEquals verifies that the reserved States.ALL value
+// appears alone and in the last element of the Retry or Catch list
+func validateErrorEquals(stateName string, fieldName string, entries []interface{}) []error {
+	validationErrors := make([]error, 0)
+	for eachIndex, eachEntry := range entries {
+		entryMap, entryMapOk := eachEntry.(map[string]interface{})
+		if !entryMapOk {
+			continue
+		}
+		errorEquals, _ := entryMap["ErrorEquals"].([]interface{})
+		if len(errorEquals) == 0 {
+			validationErrors = append(validationErrors,
+				errors.Errorf("state %s %s[%d] must define ErrorEquals",
+					stateName,
+					fieldName,
+					eachIndex))
+		}
+		for _, eachError := range errorEquals {
+			if eachError == string(StatesAll) &&
+				(len(errorEquals) != 1 || eachIndex != len(entries)-1) {
+				validationErrors = append(validationErrors,
+					errors.Errorf("state %s %s[%d] %s must appear alone in the last entry",
+						stateName,
+						fieldName,
+						eachIndex,
+						StatesAll))
+			}
+		}
+	}
+	return validationErrors
+}
+
+// validateDynamicParameters verifies that keys with the `.$` suffix refer
+// to either a path or an intrinsic function
+func validateDynamicParameters(stateName string, params interface{}) []error {
+	validationErrors := make([]error, 0)
+	switch typedParams := params.(type) {
+	case map[string]interface{}:
+		for eachKey, eachValue := range typedParams {
+			if strings.HasSuffix(eachKey, ".$") {
+				stringValue, stringValueOk := eachValue.(string)
+				if !stringValueOk ||
+					!(strings.HasPrefix(stringValue, "$") ||
+						strings.HasPrefix(stringValue, "States.")) {
+					validationErrors = append(validationErrors,
+						errors.Errorf("state %s parameter %s must be a path or intrinsic function. Found: %v",
+							stateName,
+							eachKey,
+							eachValue))
+				}
+				continue
+			}
+			validationErrors = append(validationErrors,
+				validateDynamicParameters(stateName, eachValue)...)
+		}
+	case []interface{}:
+		for _, eachValue := range typedParams {
+			validationErrors = append(validationErrors,
+				validateDynamicParameters(stateName, eachValue)...)
+		}
+	}
+	return validationErrors
+}
+
+// validateStatesDefinition validates the JSON representation of a state
+// machine (or Map/Parallel sub-machine) against a subset of the
+// Amazon States Language rules
+func validateStatesDefinition(machineName string,
+	definition map[string]interface{},
+	isExpress bool) []error {
+
+	validationErrors := make([]error, 0)
+	states, _ := definition["States"].(map[string]interface{})
+	startAt, _ := definition["StartAt"].(string)
+	if _, startAtExists := states[startAt]; !startAtExists {
+		validationErrors = append(validationErrors,
+			errors.Errorf("state machine %s StartAt state %s not found", machineName, startAt))
+	}
+	stateExists := func(stateName interface{}) bool {
+		name, nameOk := stateName.(string)
+		if !nameOk {
+			return false
+		}
+		_, exists := states[name]
+		return exists
+	}
+
+	for eachStateName, eachStateValue := range states {
+		stateMap, stateMapOk := eachStateValue.(map[string]interface{})
+		if !stateMapOk {
+			continue
+		}
+		if len(eachStateName) > maxStateNameLength {
+			validationErrors = append(validationErrors,
+				errors.Errorf("state name %s exceeds the maximum length of %d characters",
+					eachStateName,
+					maxStateNameLength))
+		}
+		if nextState, nextStateExists := stateMap["Next"]; nextStateExists && !stateExists(nextState) {
+			validationErrors = append(validationErrors,
+				errors.Errorf("state %s Next state %v is not defined in the same scope",
+					eachStateName,
+					nextState))
+		}
+		for _, eachPathField := range []string{"InputPath", "OutputPath", "ResultPath", "ItemsPath"} {
+			pathValue, pathValueOk := stateMap[eachPathField].(string)
+			if pathValueOk && !strings.HasPrefix(pathValue, "$") {
+				validationErrors = append(validationErrors,
+					errors.Errorf("state %s %s must be a JSONPath starting with `$`. Found: %s",
+						eachStateName,
+						eachPathField,
+						pathValue))
+			}
+		}
+		if retries, retriesOk := stateMap["Retry"].([]interface{}); retriesOk {
+			validationErrors = append(validationErrors,
+				validateErrorEquals(eachStateName, "Retry", retries)...)
+		}
+		if catches, catchesOk := stateMap["Catch"].([]interface{}); catchesOk {
+			validationErrors = append(validationErrors,
+				validateErrorEquals(eachStateName, "Catch", catches)...)
+			for eachIndex, eachCatch := range catches {
+				catchMap, _ := eachCatch.(map[string]interface{})
+				if !stateExists(catchMap["Next"]) {
+					validationErrors = append(validationErrors,
+						errors.Errorf("state %s Catch[%d] Next state %v is not defined in the same scope",
+							eachStateName,
+							eachIndex,
+							catchMap["Next"]))
+				}
+			}
+		}
+		for _, eachParamsField := range []string{"Parameters", "ItemSelector"} {
+			if params, paramsExist := stateMap[eachParamsField]; paramsExist {
+				validationErrors = append(validationErrors,
+					validateDynamicParameters(eachStateName, params)...)
+			}
+		}
+		// Express workflows don't support the .sync or .waitForTaskToken
+		// integration patterns
+		if resource, resourceOk := stateMap["Resource"].(string); resourceOk && isExpress {
+			for _, eachSuffix := range expressUnsupportedResourceSuffixes {
+				if strings.HasSuffix(resource, eachSuffix) {
+					validationErrors = append(validationErrors,
+						errors.Errorf("state %s Resource %s uses an integration pattern that is not supported by %s state machines",
+							eachStateName,
+							resource,
+							StateMachineTypeExpress))
+				}
+			}
+		}
+		// Recurse into the sub machines
+		for _, eachIteratorField := range []string{"Iterator", "ItemProcessor"} {
+			iterator, iteratorOk := stateMap[eachIteratorField].(map[string]interface{})
+			if !iteratorOk {
+				continue
+			}
+			if processorConfig, processorConfigOk := iterator["ProcessorConfig"].(map[string]interface{}); processorConfigOk {
+				if processorConfig["Mode"] == MapModeDistributed && isExpress {
+					validationErrors = append(validationErrors,
+						errors.Errorf("state %s %s Map mode is not supported by %s state machines",
+							eachStateName,
+							MapModeDistributed,
+							StateMachineTypeExpress))
+				}
+			}
+			validationErrors = append(validationErrors,
+				validateStatesDefinition(eachStateName, iterator, isExpress)...)
+		}
+		if branches, branchesOk := stateMap["Branches"].([]interface{}); branchesOk {
+			for eachIndex, eachBranch := range branches {
+				branchMap, branchMapOk := eachBranch.(map[string]interface{})
+				if branchMapOk {
+					validationErrors = append(validationErrors,
+						validateStatesDefinition(fmt.Sprintf("%s.Branches[%d]", eachStateName, eachIndex),
+							branchMap,
+							isExpress)...)
+				}
+			}
+		}
+	}
+	return validationErrors
+}
@@ -0,0 +1,106 @@
+package sparta
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWSClients
+//
+
+// AWSClients are the AWS service clients used by the provision workflow
+// and the other service commands. Set WorkflowHooks.AWSClients to replace a
+// client (eg, with a mock in tests). Clients that aren't set are created
+// from the provisioning session.
+type AWSClients struct {
+	// S3 uploads the service artifacts and manages the provision lock
+	S3 s3iface.S3API
+	// IAM verifies the existing IAM roles referenced by the service
+	IAM iamiface.IAMAPI
+	// CloudFormation creates and updates the service's stack
+	CloudFormation cloudformationiface.CloudFormationAPI
+	// Lambda applies in-place function code updates
+	Lambda lambdaiface.LambdaAPI
+	// SSM resolves the values published by other services
+	SSM ssmiface.SSMAPI
+	// CloudWatchLogs verifies that the log groups added to an existing stack
+	// don't already exist
+	CloudWatchLogs cloudwatchlogsiface.CloudWatchLogsAPI
+}
+
+// newWorkflowSession returns the session used by the workflow commands. If
+// the localstack endpoint or the spartaAWS.LocalstackEndpointEnvVar
+// environment variable is set, the session's clients use localstack.
+func newWorkflowSession(localstackEndpoint string, logger *logrus.Logger) *session.Session {
+	if localstackEndpoint == "" {
+		localstackEndpoint = os.Getenv(spartaAWS.LocalstackEndpointEnvVar)
+	}
+	if localstackEndpoint != "" {
+		return spartaAWS.NewLocalstackSession(localstackEndpoint, logger)
+	}
+	return spartaAWS.NewSession(logger)
+}
+
+// newAWSClients returns the clients to use for provisioning. The
+// injected clients take precedence over clients created from the session.
+func newAWSClients(awsSession *session.Session, injected *AWSClients) *AWSClients {
+	clients := &AWSClients{}
+	if injected != nil {
+		*clients = *injected
+	}
+	if clients.S3 == nil {
+		clients.S3 = s3.New(awsSession)
+	}
+	if clients.IAM == nil {
+		clients.IAM = iam.New(awsSession)
+	}
+	if clients.CloudFormation == nil {
+		clients.CloudFormation = cloudformation.New(awsSession)
+	}
+	if clients.Lambda == nil {
+		clients.Lambda = lambda.New(awsSession)
+	}
+	if clients.SSM == nil {
+		clients.SSM = ssm.New(awsSession)
+	}
+	if clients.CloudWatchLogs == nil {
+		clients.CloudWatchLogs = cloudwatchlogs.New(awsSession)
+	}
+	return clients
+}
+
+// workflowHookAWSClients returns the provisioning clients published in the
+// hook context, or clients created from the session if the context doesn't
+// include them
+func workflowHookAWSClients(hookContext *WorkflowHookContext,
+	awsSession *session.Session) *AWSClients {
+	if hookContext != nil {
+		hookClients, hookClientsOk := hookContext.Get(WorkflowHookContextKeyAWSClients)
+		if typedClients, typedClientsOk := hookClients.(*AWSClients); hookClientsOk &&
+			typedClientsOk &&
+			typedClients != nil {
+			return typedClients
+		}
+	}
+	return newAWSClients(awsSession, nil)
+}
+
+//
+// END - AWSClients
+////////////////////////////////////////////////////////////////////////////////
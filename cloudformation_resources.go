@@ -69,13 +69,18 @@ func resourceOutputs(resourceName string,
 
 	outputProps := []string{}
 	switch typedResource := resource.(type) {
-	case gocf.IAMRole:
+	case gocf.IAMRole,
+		*gocf.IAMRole,
+		iamRole,
+		*iamRole:
 		// NOP
 	case *gocf.DynamoDBTable:
+		outputProps = append(outputProps, "Arn")
 		if typedResource.StreamSpecification != nil {
 			outputProps = append(outputProps, "StreamArn")
 		}
 	case gocf.DynamoDBTable:
+		outputProps = append(outputProps, "Arn")
 		if typedResource.StreamSpecification != nil {
 			outputProps = append(outputProps, "StreamArn")
 		}
@@ -89,7 +94,9 @@ func resourceOutputs(resourceName string,
 		*gocf.S3Bucket:
 		outputProps = append(outputProps, "DomainName", "WebsiteURL")
 	case gocf.SNSTopic,
-		*gocf.SNSTopic:
+		*gocf.SNSTopic,
+		snsTopicResource,
+		*snsTopicResource:
 		outputProps = append(outputProps, "TopicName")
 	case gocf.SQSQueue,
 		*gocf.SQSQueue:
@@ -0,0 +1,806 @@
+package sparta
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+// This file contains CloudFormation resource property definitions for
+// properties that were introduced after the go-cloudformation schema
+// (ResourceSpecificationVersion) was generated. Each type mirrors the
+// corresponding go-cloudformation type and adds the newer properties.
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::EventSourceMapping
+
+// lambdaEventSourceMappingSourceAccessConfiguration represents the
+// AWS::Lambda::EventSourceMapping.SourceAccessConfiguration property type
+type lambdaEventSourceMappingSourceAccessConfiguration struct {
+	Type *gocf.StringExpr `json:"Type,omitempty"`
+	URI  *gocf.StringExpr `json:"URI,omitempty"`
+}
+
+// lambdaEventSourceMappingEndpoints represents the
+// AWS::Lambda::EventSourceMapping.Endpoints property type
+type lambdaEventSourceMappingEndpoints struct {
+	KafkaBootstrapServers *gocf.StringListExpr `json:"KafkaBootstrapServers,omitempty"`
+}
+
+// lambdaEventSourceMappingSelfManagedEventSource represents the
+// AWS::Lambda::EventSourceMapping.SelfManagedEventSource property type
+type lambdaEventSourceMappingSelfManagedEventSource struct {
+	Endpoints *lambdaEventSourceMappingEndpoints `json:"Endpoints,omitempty"`
+}
+
+// lambdaEventSourceMappingKafkaConfig represents both the
+// AWS::Lambda::EventSourceMapping.AmazonManagedKafkaEventSourceConfig and
+// AWS::Lambda::EventSourceMapping.SelfManagedKafkaEventSourceConfig
+// property types, which share the same shape
+type lambdaEventSourceMappingKafkaConfig struct {
+	ConsumerGroupID *gocf.StringExpr `json:"ConsumerGroupId,omitempty"`
+}
+
+// lambdaEventSourceMapping represents the AWS::Lambda::EventSourceMapping
+// resource, including the properties required for Kafka event sources
+type lambdaEventSourceMapping struct {
+	gocf.LambdaEventSourceMapping
+	AmazonManagedKafkaEventSourceConfig *lambdaEventSourceMappingKafkaConfig                `json:"AmazonManagedKafkaEventSourceConfig,omitempty"`
+	SelfManagedEventSource              *lambdaEventSourceMappingSelfManagedEventSource     `json:"SelfManagedEventSource,omitempty"`
+	SelfManagedKafkaEventSourceConfig   *lambdaEventSourceMappingKafkaConfig                `json:"SelfManagedKafkaEventSourceConfig,omitempty"`
+	SourceAccessConfigurations          []lambdaEventSourceMappingSourceAccessConfiguration `json:"SourceAccessConfigurations,omitempty"`
+	Topics                              *gocf.StringListExpr                                `json:"Topics,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::EventSourceMapping to implement the ResourceProperties interface
+func (s lambdaEventSourceMapping) CfnResourceType() string {
+	return "AWS::Lambda::EventSourceMapping"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaEventSourceMapping) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::Lambda::EventSourceMapping
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Scheduler::Schedule
+
+// schedulerScheduleFlexibleTimeWindow represents the
+// AWS::Scheduler::Schedule.FlexibleTimeWindow property type
+type schedulerScheduleFlexibleTimeWindow struct {
+	Mode                   *gocf.StringExpr  `json:"Mode,omitempty"`
+	MaximumWindowInMinutes *gocf.IntegerExpr `json:"MaximumWindowInMinutes,omitempty"`
+}
+
+// schedulerScheduleTarget represents the
+// AWS::Scheduler::Schedule.Target property type
+type schedulerScheduleTarget struct {
+	Arn     *gocf.StringExpr `json:"Arn,omitempty"`
+	RoleArn *gocf.StringExpr `json:"RoleArn,omitempty"`
+	Input   *gocf.StringExpr `json:"Input,omitempty"`
+}
+
+// schedulerSchedule represents the AWS::Scheduler::Schedule resource
+type schedulerSchedule struct {
+	Description                *gocf.StringExpr                     `json:"Description,omitempty"`
+	EndDate                    *gocf.StringExpr                     `json:"EndDate,omitempty"`
+	FlexibleTimeWindow         *schedulerScheduleFlexibleTimeWindow `json:"FlexibleTimeWindow,omitempty"`
+	GroupName                  *gocf.StringExpr                     `json:"GroupName,omitempty"`
+	Name                       *gocf.StringExpr                     `json:"Name,omitempty"`
+	ScheduleExpression         *gocf.StringExpr                     `json:"ScheduleExpression,omitempty"`
+	ScheduleExpressionTimezone *gocf.StringExpr                     `json:"ScheduleExpressionTimezone,omitempty"`
+	StartDate                  *gocf.StringExpr                     `json:"StartDate,omitempty"`
+	State                      *gocf.StringExpr                     `json:"State,omitempty"`
+	Target                     *schedulerScheduleTarget             `json:"Target,omitempty"`
+}
+
+// CfnResourceType returns AWS::Scheduler::Schedule to implement the ResourceProperties interface
+func (s schedulerSchedule) CfnResourceType() string {
+	return "AWS::Scheduler::Schedule"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s schedulerSchedule) CfnResourceAttributes() []string {
+	return []string{"Arn"}
+}
+
+// END - AWS::Scheduler::Schedule
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::EventInvokeConfig
+
+// lambdaEventInvokeConfigDestination represents both the
+// AWS::Lambda::EventInvokeConfig.OnSuccess and
+// AWS::Lambda::EventInvokeConfig.OnFailure property types
+type lambdaEventInvokeConfigDestination struct {
+	Destination *gocf.StringExpr `json:"Destination,omitempty"`
+}
+
+// lambdaEventInvokeConfigDestinationConfig represents the
+// AWS::Lambda::EventInvokeConfig.DestinationConfig property type
+type lambdaEventInvokeConfigDestinationConfig struct {
+	OnFailure *lambdaEventInvokeConfigDestination `json:"OnFailure,omitempty"`
+	OnSuccess *lambdaEventInvokeConfigDestination `json:"OnSuccess,omitempty"`
+}
+
+// lambdaEventInvokeConfig represents the AWS::Lambda::EventInvokeConfig resource
+type lambdaEventInvokeConfig struct {
+	DestinationConfig        *lambdaEventInvokeConfigDestinationConfig `json:"DestinationConfig,omitempty"`
+	FunctionName             *gocf.StringExpr                          `json:"FunctionName,omitempty"`
+	MaximumEventAgeInSeconds *gocf.IntegerExpr                         `json:"MaximumEventAgeInSeconds,omitempty"`
+	MaximumRetryAttempts     *gocf.IntegerExpr                         `json:"MaximumRetryAttempts,omitempty"`
+	Qualifier                *gocf.StringExpr                          `json:"Qualifier,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::EventInvokeConfig to implement the ResourceProperties interface
+func (s lambdaEventInvokeConfig) CfnResourceType() string {
+	return "AWS::Lambda::EventInvokeConfig"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaEventInvokeConfig) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::Lambda::EventInvokeConfig
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::Alias
+
+// lambdaAliasProvisionedConcurrencyConfiguration represents the
+// AWS::Lambda::Alias.ProvisionedConcurrencyConfiguration property type
+type lambdaAliasProvisionedConcurrencyConfiguration struct {
+	ProvisionedConcurrentExecutions *gocf.IntegerExpr `json:"ProvisionedConcurrentExecutions,omitempty"`
+}
+
+// lambdaAlias represents the AWS::Lambda::Alias resource, including the
+// ProvisionedConcurrencyConfig property
+type lambdaAlias struct {
+	gocf.LambdaAlias
+	ProvisionedConcurrencyConfig *lambdaAliasProvisionedConcurrencyConfiguration `json:"ProvisionedConcurrencyConfig,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::Alias to implement the ResourceProperties interface
+func (s lambdaAlias) CfnResourceType() string {
+	return "AWS::Lambda::Alias"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaAlias) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::Lambda::Alias
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::ApplicationAutoScaling::ScalingPolicy
+
+// applicationAutoScalingTargetTrackingConfiguration represents the
+// AWS::ApplicationAutoScaling::ScalingPolicy.TargetTrackingScalingPolicyConfiguration
+// property type. The go-cloudformation TargetValue is an integer, which
+// can't express Lambda provisioned concurrency utilization targets.
+type applicationAutoScalingTargetTrackingConfiguration struct {
+	DisableScaleIn                *gocf.BoolExpr                                                         `json:"DisableScaleIn,omitempty"`
+	PredefinedMetricSpecification *gocf.ApplicationAutoScalingScalingPolicyPredefinedMetricSpecification `json:"PredefinedMetricSpecification,omitempty"`
+	ScaleInCooldown               *gocf.IntegerExpr                                                      `json:"ScaleInCooldown,omitempty"`
+	ScaleOutCooldown              *gocf.IntegerExpr                                                      `json:"ScaleOutCooldown,omitempty"`
+	TargetValue                   float64                                                                `json:"TargetValue"`
+}
+
+// applicationAutoScalingScalingPolicy represents the
+// AWS::ApplicationAutoScaling::ScalingPolicy resource
+type applicationAutoScalingScalingPolicy struct {
+	gocf.ApplicationAutoScalingScalingPolicy
+	TargetTrackingScalingPolicyConfiguration *applicationAutoScalingTargetTrackingConfiguration `json:"TargetTrackingScalingPolicyConfiguration,omitempty"`
+}
+
+// CfnResourceType returns AWS::ApplicationAutoScaling::ScalingPolicy to implement the ResourceProperties interface
+func (s applicationAutoScalingScalingPolicy) CfnResourceType() string {
+	return "AWS::ApplicationAutoScaling::ScalingPolicy"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s applicationAutoScalingScalingPolicy) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::ApplicationAutoScaling::ScalingPolicy
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::Function
+
+// lambdaFunctionEphemeralStorage represents the
+// AWS::Lambda::Function.EphemeralStorage property type
+type lambdaFunctionEphemeralStorage struct {
+	Size *gocf.IntegerExpr `json:"Size,omitempty"`
+}
+
+// lambdaFunctionFileSystemConfig represents the
+// AWS::Lambda::Function.FileSystemConfig property type
+type lambdaFunctionFileSystemConfig struct {
+	Arn            *gocf.StringExpr `json:"Arn,omitempty"`
+	LocalMountPath *gocf.StringExpr `json:"LocalMountPath,omitempty"`
+}
+
+// lambdaFunctionLoggingConfig represents the
+// AWS::Lambda::Function.LoggingConfig property type
+type lambdaFunctionLoggingConfig struct {
+	LogGroup *gocf.StringExpr `json:"LogGroup,omitempty"`
+}
+
+// lambdaFunction represents the AWS::Lambda::Function resource, including
+// the CodeSigningConfigArn, EphemeralStorage, FileSystemConfigs and
+// LoggingConfig properties. It's only used for functions that require the
+// newer properties.
+type lambdaFunction struct {
+	gocf.LambdaFunction
+	CodeSigningConfigArn *gocf.StringExpr                 `json:"CodeSigningConfigArn,omitempty"`
+	EphemeralStorage     *lambdaFunctionEphemeralStorage  `json:"EphemeralStorage,omitempty"`
+	FileSystemConfigs    []lambdaFunctionFileSystemConfig `json:"FileSystemConfigs,omitempty"`
+	LoggingConfig        *lambdaFunctionLoggingConfig     `json:"LoggingConfig,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::Function to implement the ResourceProperties interface
+func (s lambdaFunction) CfnResourceType() string {
+	return "AWS::Lambda::Function"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaFunction) CfnResourceAttributes() []string {
+	return []string{"Arn"}
+}
+
+// END - AWS::Lambda::Function
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::IAM::Role
+
+// iamRole represents the AWS::IAM::Role resource, including the Tags
+// property
+type iamRole struct {
+	gocf.IAMRole
+	Tags *gocf.TagList `json:"Tags,omitempty"`
+}
+
+// CfnResourceType returns AWS::IAM::Role to implement the ResourceProperties interface
+func (s iamRole) CfnResourceType() string {
+	return "AWS::IAM::Role"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s iamRole) CfnResourceAttributes() []string {
+	return []string{"Arn", "RoleId"}
+}
+
+// templateIAMRole returns the IAMRole properties of a template resource
+// that's either a gocf.IAMRole or a tagged iamRole
+func templateIAMRole(resource *gocf.Resource) (gocf.IAMRole, bool) {
+	switch typedResource := resource.Properties.(type) {
+	case gocf.IAMRole:
+		return typedResource, true
+	case *gocf.IAMRole:
+		return *typedResource, true
+	case iamRole:
+		return typedResource.IAMRole, true
+	case *iamRole:
+		return typedResource.IAMRole, true
+	}
+	return gocf.IAMRole{}, false
+}
+
+// setTemplateIAMRole updates the IAMRole properties of a template resource.
+// The Tags of a tagged iamRole are preserved.
+func setTemplateIAMRole(resource *gocf.Resource, role gocf.IAMRole) {
+	switch typedResource := resource.Properties.(type) {
+	case *gocf.IAMRole:
+		*typedResource = role
+	case iamRole:
+		typedResource.IAMRole = role
+		resource.Properties = typedResource
+	case *iamRole:
+		typedResource.IAMRole = role
+	default:
+		resource.Properties = role
+	}
+}
+
+// END - AWS::IAM::Role
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::EFS::AccessPoint
+
+// efsAccessPointPosixUser represents the
+// AWS::EFS::AccessPoint.PosixUser property type
+type efsAccessPointPosixUser struct {
+	Gid           *gocf.StringExpr     `json:"Gid,omitempty"`
+	SecondaryGids *gocf.StringListExpr `json:"SecondaryGids,omitempty"`
+	UID           *gocf.StringExpr     `json:"Uid,omitempty"`
+}
+
+// efsAccessPointCreationInfo represents the
+// AWS::EFS::AccessPoint.CreationInfo property type
+type efsAccessPointCreationInfo struct {
+	OwnerGid    *gocf.StringExpr `json:"OwnerGid,omitempty"`
+	OwnerUID    *gocf.StringExpr `json:"OwnerUid,omitempty"`
+	Permissions *gocf.StringExpr `json:"Permissions,omitempty"`
+}
+
+// efsAccessPointRootDirectory represents the
+// AWS::EFS::AccessPoint.RootDirectory property type
+type efsAccessPointRootDirectory struct {
+	CreationInfo *efsAccessPointCreationInfo `json:"CreationInfo,omitempty"`
+	Path         *gocf.StringExpr            `json:"Path,omitempty"`
+}
+
+// efsAccessPoint represents the AWS::EFS::AccessPoint resource
+type efsAccessPoint struct {
+	FileSystemID  *gocf.StringExpr             `json:"FileSystemId,omitempty"`
+	PosixUser     *efsAccessPointPosixUser     `json:"PosixUser,omitempty"`
+	RootDirectory *efsAccessPointRootDirectory `json:"RootDirectory,omitempty"`
+}
+
+// CfnResourceType returns AWS::EFS::AccessPoint to implement the ResourceProperties interface
+func (s efsAccessPoint) CfnResourceType() string {
+	return "AWS::EFS::AccessPoint"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s efsAccessPoint) CfnResourceAttributes() []string {
+	return []string{"AccessPointId", "Arn"}
+}
+
+// END - AWS::EFS::AccessPoint
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::SNS::Topic
+
+// snsTopicResource represents the AWS::SNS::Topic resource, including the
+// ContentBasedDeduplication and FifoTopic properties
+type snsTopicResource struct {
+	gocf.SNSTopic
+	ContentBasedDeduplication *gocf.BoolExpr `json:"ContentBasedDeduplication,omitempty"`
+	FifoTopic                 *gocf.BoolExpr `json:"FifoTopic,omitempty"`
+}
+
+// CfnResourceType returns AWS::SNS::Topic to implement the ResourceProperties interface
+func (s snsTopicResource) CfnResourceType() string {
+	return "AWS::SNS::Topic"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s snsTopicResource) CfnResourceAttributes() []string {
+	return []string{"TopicName"}
+}
+
+// END - AWS::SNS::Topic
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::CodeSigningConfig
+
+// lambdaCodeSigningConfigAllowedPublishers represents the
+// AWS::Lambda::CodeSigningConfig.AllowedPublishers property type
+type lambdaCodeSigningConfigAllowedPublishers struct {
+	SigningProfileVersionArns *gocf.StringListExpr `json:"SigningProfileVersionArns,omitempty"`
+}
+
+// lambdaCodeSigningConfigCodeSigningPolicies represents the
+// AWS::Lambda::CodeSigningConfig.CodeSigningPolicies property type
+type lambdaCodeSigningConfigCodeSigningPolicies struct {
+	UntrustedArtifactOnDeployment *gocf.StringExpr `json:"UntrustedArtifactOnDeployment,omitempty"`
+}
+
+// lambdaCodeSigningConfig represents the AWS::Lambda::CodeSigningConfig resource
+type lambdaCodeSigningConfig struct {
+	AllowedPublishers   *lambdaCodeSigningConfigAllowedPublishers   `json:"AllowedPublishers,omitempty"`
+	CodeSigningPolicies *lambdaCodeSigningConfigCodeSigningPolicies `json:"CodeSigningPolicies,omitempty"`
+	Description         *gocf.StringExpr                            `json:"Description,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::CodeSigningConfig to implement the ResourceProperties interface
+func (s lambdaCodeSigningConfig) CfnResourceType() string {
+	return "AWS::Lambda::CodeSigningConfig"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaCodeSigningConfig) CfnResourceAttributes() []string {
+	return []string{"CodeSigningConfigArn", "CodeSigningConfigId"}
+}
+
+// END - AWS::Lambda::CodeSigningConfig
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::CertificateManager::Certificate
+
+// certificateManagerCertificateDomainValidationOption represents the
+// AWS::CertificateManager::Certificate.DomainValidationOption property type
+type certificateManagerCertificateDomainValidationOption struct {
+	DomainName   *gocf.StringExpr `json:"DomainName,omitempty"`
+	HostedZoneID *gocf.StringExpr `json:"HostedZoneId,omitempty"`
+}
+
+// certificateManagerCertificate represents the
+// AWS::CertificateManager::Certificate resource, including the
+// HostedZoneId used to automatically create DNS validation records
+type certificateManagerCertificate struct {
+	gocf.CertificateManagerCertificate
+	DomainValidationOptions []certificateManagerCertificateDomainValidationOption `json:"DomainValidationOptions,omitempty"`
+}
+
+// CfnResourceType returns AWS::CertificateManager::Certificate to implement the ResourceProperties interface
+func (s certificateManagerCertificate) CfnResourceType() string {
+	return "AWS::CertificateManager::Certificate"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s certificateManagerCertificate) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::CertificateManager::Certificate
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::ApiGateway::DomainName
+
+// apiGatewayDomainNameMutualTLSAuthentication represents the
+// AWS::ApiGateway::DomainName.MutualTlsAuthentication property type
+type apiGatewayDomainNameMutualTLSAuthentication struct {
+	TruststoreURI     *gocf.StringExpr `json:"TruststoreUri,omitempty"`
+	TruststoreVersion *gocf.StringExpr `json:"TruststoreVersion,omitempty"`
+}
+
+// apiGatewayDomainName represents the AWS::ApiGateway::DomainName resource,
+// including the SecurityPolicy and MutualTlsAuthentication properties
+type apiGatewayDomainName struct {
+	gocf.APIGatewayDomainName
+	MutualTLSAuthentication *apiGatewayDomainNameMutualTLSAuthentication `json:"MutualTlsAuthentication,omitempty"`
+	SecurityPolicy          *gocf.StringExpr                             `json:"SecurityPolicy,omitempty"`
+}
+
+// CfnResourceType returns AWS::ApiGateway::DomainName to implement the ResourceProperties interface
+func (s apiGatewayDomainName) CfnResourceType() string {
+	return "AWS::ApiGateway::DomainName"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s apiGatewayDomainName) CfnResourceAttributes() []string {
+	return []string{"DistributionDomainName",
+		"DistributionHostedZoneId",
+		"RegionalDomainName",
+		"RegionalHostedZoneId"}
+}
+
+// END - AWS::ApiGateway::DomainName
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::ApiGateway::RestApi
+
+// apiGatewayRestAPI represents the AWS::ApiGateway::RestApi resource,
+// including the DisableExecuteApiEndpoint property
+type apiGatewayRestAPI struct {
+	gocf.APIGatewayRestAPI
+	DisableExecuteAPIEndpoint *gocf.BoolExpr `json:"DisableExecuteApiEndpoint,omitempty"`
+}
+
+// CfnResourceType returns AWS::ApiGateway::RestApi to implement the ResourceProperties interface
+func (s apiGatewayRestAPI) CfnResourceType() string {
+	return "AWS::ApiGateway::RestApi"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s apiGatewayRestAPI) CfnResourceAttributes() []string {
+	return []string{"RootResourceId"}
+}
+
+// END - AWS::ApiGateway::RestApi
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::WAFv2::WebACL
+
+// wafv2Empty represents the empty WAFv2 action objects (eg: Allow, Block, None)
+type wafv2Empty struct{}
+
+// wafv2VisibilityConfig represents the AWS::WAFv2::WebACL.VisibilityConfig
+// property type
+type wafv2VisibilityConfig struct {
+	CloudWatchMetricsEnabled *gocf.BoolExpr   `json:"CloudWatchMetricsEnabled,omitempty"`
+	MetricName               *gocf.StringExpr `json:"MetricName,omitempty"`
+	SampledRequestsEnabled   *gocf.BoolExpr   `json:"SampledRequestsEnabled,omitempty"`
+}
+
+// wafv2DefaultAction represents the AWS::WAFv2::WebACL.DefaultAction property type
+type wafv2DefaultAction struct {
+	Allow *wafv2Empty `json:"Allow,omitempty"`
+	Block *wafv2Empty `json:"Block,omitempty"`
+}
+
+// wafv2RuleAction represents the AWS::WAFv2::WebACL.RuleAction property type
+type wafv2RuleAction struct {
+	Block *wafv2Empty `json:"Block,omitempty"`
+	Count *wafv2Empty `json:"Count,omitempty"`
+}
+
+// wafv2OverrideAction represents the AWS::WAFv2::WebACL.OverrideAction property type
+type wafv2OverrideAction struct {
+	Count *wafv2Empty `json:"Count,omitempty"`
+	None  *wafv2Empty `json:"None,omitempty"`
+}
+
+// wafv2ManagedRuleGroupStatement represents the
+// AWS::WAFv2::WebACL.ManagedRuleGroupStatement property type
+type wafv2ManagedRuleGroupStatement struct {
+	Name       *gocf.StringExpr `json:"Name,omitempty"`
+	VendorName *gocf.StringExpr `json:"VendorName,omitempty"`
+}
+
+// wafv2RateBasedStatement represents the
+// AWS::WAFv2::WebACL.RateBasedStatement property type
+type wafv2RateBasedStatement struct {
+	AggregateKeyType *gocf.StringExpr  `json:"AggregateKeyType,omitempty"`
+	Limit            *gocf.IntegerExpr `json:"Limit,omitempty"`
+}
+
+// wafv2Statement represents the AWS::WAFv2::WebACL.Statement property type
+type wafv2Statement struct {
+	ManagedRuleGroupStatement *wafv2ManagedRuleGroupStatement `json:"ManagedRuleGroupStatement,omitempty"`
+	RateBasedStatement        *wafv2RateBasedStatement        `json:"RateBasedStatement,omitempty"`
+}
+
+// wafv2Rule represents the AWS::WAFv2::WebACL.Rule property type
+type wafv2Rule struct {
+	Action           *wafv2RuleAction       `json:"Action,omitempty"`
+	Name             *gocf.StringExpr       `json:"Name,omitempty"`
+	OverrideAction   *wafv2OverrideAction   `json:"OverrideAction,omitempty"`
+	Priority         *gocf.IntegerExpr      `json:"Priority,omitempty"`
+	Statement        *wafv2Statement        `json:"Statement,omitempty"`
+	VisibilityConfig *wafv2VisibilityConfig `json:"VisibilityConfig,omitempty"`
+}
+
+// wafv2WebACL represents the AWS::WAFv2::WebACL resource
+type wafv2WebACL struct {
+	DefaultAction    *wafv2DefaultAction    `json:"DefaultAction,omitempty"`
+	Description      *gocf.StringExpr       `json:"Description,omitempty"`
+	Rules            []wafv2Rule            `json:"Rules,omitempty"`
+	Scope            *gocf.StringExpr       `json:"Scope,omitempty"`
+	VisibilityConfig *wafv2VisibilityConfig `json:"VisibilityConfig,omitempty"`
+}
+
+// CfnResourceType returns AWS::WAFv2::WebACL to implement the ResourceProperties interface
+func (s wafv2WebACL) CfnResourceType() string {
+	return "AWS::WAFv2::WebACL"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s wafv2WebACL) CfnResourceAttributes() []string {
+	return []string{"Arn", "Capacity", "Id"}
+}
+
+// END - AWS::WAFv2::WebACL
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::WAFv2::WebACLAssociation
+
+// wafv2WebACLAssociation represents the AWS::WAFv2::WebACLAssociation resource
+type wafv2WebACLAssociation struct {
+	ResourceArn *gocf.StringExpr `json:"ResourceArn,omitempty"`
+	WebACLArn   *gocf.StringExpr `json:"WebACLArn,omitempty"`
+}
+
+// CfnResourceType returns AWS::WAFv2::WebACLAssociation to implement the ResourceProperties interface
+func (s wafv2WebACLAssociation) CfnResourceType() string {
+	return "AWS::WAFv2::WebACLAssociation"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s wafv2WebACLAssociation) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::WAFv2::WebACLAssociation
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::CloudFront::OriginAccessControl
+
+// cloudFrontOriginAccessControlConfig represents the
+// AWS::CloudFront::OriginAccessControl.OriginAccessControlConfig property type
+type cloudFrontOriginAccessControlConfig struct {
+	Description                   *gocf.StringExpr `json:"Description,omitempty"`
+	Name                          *gocf.StringExpr `json:"Name,omitempty"`
+	OriginAccessControlOriginType *gocf.StringExpr `json:"OriginAccessControlOriginType,omitempty"`
+	SigningBehavior               *gocf.StringExpr `json:"SigningBehavior,omitempty"`
+	SigningProtocol               *gocf.StringExpr `json:"SigningProtocol,omitempty"`
+}
+
+// cloudFrontOriginAccessControl represents the
+// AWS::CloudFront::OriginAccessControl resource
+type cloudFrontOriginAccessControl struct {
+	OriginAccessControlConfig *cloudFrontOriginAccessControlConfig `json:"OriginAccessControlConfig,omitempty"`
+}
+
+// CfnResourceType returns AWS::CloudFront::OriginAccessControl to implement the ResourceProperties interface
+func (s cloudFrontOriginAccessControl) CfnResourceType() string {
+	return "AWS::CloudFront::OriginAccessControl"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s cloudFrontOriginAccessControl) CfnResourceAttributes() []string {
+	return []string{"Id"}
+}
+
+// END - AWS::CloudFront::OriginAccessControl
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::CloudFront::Distribution
+
+// cloudFrontDistributionOrigin represents the
+// AWS::CloudFront::Distribution.Origin property type, including the
+// OriginAccessControlId property
+type cloudFrontDistributionOrigin struct {
+	gocf.CloudFrontDistributionOrigin
+	OriginAccessControlID *gocf.StringExpr `json:"OriginAccessControlId,omitempty"`
+}
+
+// cloudFrontDistributionConfig represents the
+// AWS::CloudFront::Distribution.DistributionConfig property type using
+// the cloudFrontDistributionOrigin origins
+type cloudFrontDistributionConfig struct {
+	gocf.CloudFrontDistributionDistributionConfig
+	Origins []cloudFrontDistributionOrigin `json:"Origins,omitempty"`
+}
+
+// cloudFrontDistribution represents the AWS::CloudFront::Distribution resource
+type cloudFrontDistribution struct {
+	DistributionConfig *cloudFrontDistributionConfig `json:"DistributionConfig,omitempty"`
+	Tags               *gocf.TagList                 `json:"Tags,omitempty"`
+}
+
+// CfnResourceType returns AWS::CloudFront::Distribution to implement the ResourceProperties interface
+func (s cloudFrontDistribution) CfnResourceType() string {
+	return "AWS::CloudFront::Distribution"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s cloudFrontDistribution) CfnResourceAttributes() []string {
+	return []string{"DomainName", "Id"}
+}
+
+// END - AWS::CloudFront::Distribution
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::S3::Bucket
+
+// s3BucketOwnershipControlsRule represents the
+// AWS::S3::Bucket.OwnershipControlsRule property type
+type s3BucketOwnershipControlsRule struct {
+	ObjectOwnership *gocf.StringExpr `json:"ObjectOwnership,omitempty"`
+}
+
+// s3BucketOwnershipControls represents the
+// AWS::S3::Bucket.OwnershipControls property type
+type s3BucketOwnershipControls struct {
+	Rules []s3BucketOwnershipControlsRule `json:"Rules,omitempty"`
+}
+
+// s3BucketResource represents the AWS::S3::Bucket resource, including the
+// OwnershipControls property
+type s3BucketResource struct {
+	gocf.S3Bucket
+	OwnershipControls *s3BucketOwnershipControls `json:"OwnershipControls,omitempty"`
+}
+
+// CfnResourceType returns AWS::S3::Bucket to implement the ResourceProperties interface
+func (s s3BucketResource) CfnResourceType() string {
+	return "AWS::S3::Bucket"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s s3BucketResource) CfnResourceAttributes() []string {
+	return []string{"RegionalDomainName",
+		"WebsiteURL",
+		"Arn",
+		"DomainName",
+		"DualStackDomainName"}
+}
+
+// END - AWS::S3::Bucket
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::Url
+
+// lambdaURLCors represents the AWS::Lambda::Url.Cors property type
+type lambdaURLCors struct {
+	AllowCredentials *gocf.BoolExpr       `json:"AllowCredentials,omitempty"`
+	AllowHeaders     *gocf.StringListExpr `json:"AllowHeaders,omitempty"`
+	AllowMethods     *gocf.StringListExpr `json:"AllowMethods,omitempty"`
+	AllowOrigins     *gocf.StringListExpr `json:"AllowOrigins,omitempty"`
+	ExposeHeaders    *gocf.StringListExpr `json:"ExposeHeaders,omitempty"`
+	MaxAge           *gocf.IntegerExpr    `json:"MaxAge,omitempty"`
+}
+
+// lambdaURL represents the AWS::Lambda::Url resource
+type lambdaURL struct {
+	AuthType          *gocf.StringExpr `json:"AuthType,omitempty"`
+	Cors              *lambdaURLCors   `json:"Cors,omitempty"`
+	InvokeMode        *gocf.StringExpr `json:"InvokeMode,omitempty"`
+	Qualifier         *gocf.StringExpr `json:"Qualifier,omitempty"`
+	TargetFunctionArn *gocf.StringExpr `json:"TargetFunctionArn,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::Url to implement the ResourceProperties interface
+func (s lambdaURL) CfnResourceType() string {
+	return "AWS::Lambda::Url"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaURL) CfnResourceAttributes() []string {
+	return []string{"FunctionArn", "FunctionUrl"}
+}
+
+// END - AWS::Lambda::Url
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Lambda::Permission
+
+// lambdaPermission represents the AWS::Lambda::Permission resource,
+// including the FunctionUrlAuthType property
+type lambdaPermission struct {
+	gocf.LambdaPermission
+	FunctionURLAuthType *gocf.StringExpr `json:"FunctionUrlAuthType,omitempty"`
+}
+
+// CfnResourceType returns AWS::Lambda::Permission to implement the ResourceProperties interface
+func (s lambdaPermission) CfnResourceType() string {
+	return "AWS::Lambda::Permission"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s lambdaPermission) CfnResourceAttributes() []string {
+	return []string{}
+}
+
+// END - AWS::Lambda::Permission
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::Logs::LogGroup
+
+// logsLogGroup represents the AWS::Logs::LogGroup resource, including the
+// KmsKeyId, DataProtectionPolicy and Tags properties
+type logsLogGroup struct {
+	DataProtectionPolicy interface{}       `json:"DataProtectionPolicy,omitempty"`
+	KmsKeyID             *gocf.StringExpr  `json:"KmsKeyId,omitempty"`
+	LogGroupName         *gocf.StringExpr  `json:"LogGroupName,omitempty"`
+	RetentionInDays      *gocf.IntegerExpr `json:"RetentionInDays,omitempty"`
+	Tags                 *gocf.TagList     `json:"Tags,omitempty"`
+}
+
+// CfnResourceType returns AWS::Logs::LogGroup to implement the ResourceProperties interface
+func (s logsLogGroup) CfnResourceType() string {
+	return "AWS::Logs::LogGroup"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s logsLogGroup) CfnResourceAttributes() []string {
+	return []string{"Arn"}
+}
+
+// END - AWS::Logs::LogGroup
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,46 @@
+package sparta
+
+// LambdaCostHints are the expected usage values for a lambda function that
+// are used to estimate its monthly cost
+type LambdaCostHints struct {
+	// InvocationsPerMonth is the expected number of invocations. Defaults
+	// to the CostEstimate.DefaultInvocationsPerMonth value.
+	InvocationsPerMonth int64
+	// AverageDurationMillis is the expected average billed duration.
+	// Defaults to the function Timeout, which is the upper bound.
+	AverageDurationMillis int64
+}
+
+// CostEstimate enables the provision-time estimate of the service's
+// monthly cost. Lambda functions are estimated from their MemorySize,
+// Timeout and LambdaFunctionOptions.CostHints values. API Gateway,
+// CloudFront and DynamoDB resources in the template, including those
+// created by decorators, are estimated from the usage values below.
+// Prices are queried from the AWS Price List API and default to the
+// us-east-1 list prices if the API isn't available.
+//
+// The estimate excludes free tier usage, data transfer other than
+// CloudFront, and any resources not listed above.
+type CostEstimate struct {
+	// DefaultInvocationsPerMonth is the invocation count for functions that
+	// don't provide CostHints
+	DefaultInvocationsPerMonth int64
+	// APIRequestsPerMonth is the request count for each API Gateway REST or
+	// HTTP API
+	APIRequestsPerMonth int64
+	// CloudFrontRequestsPerMonth is the HTTPS request count for each
+	// CloudFront distribution
+	CloudFrontRequestsPerMonth int64
+	// CloudFrontDataTransferGB is the data transferred out to the internet
+	// by each CloudFront distribution
+	CloudFrontDataTransferGB float64
+	// DynamoDBReadRequestsPerMonth is the read request unit count for each
+	// on-demand DynamoDB table. Provisioned tables are estimated from
+	// their provisioned capacity.
+	DynamoDBReadRequestsPerMonth int64
+	// DynamoDBWriteRequestsPerMonth is the write request unit count for
+	// each on-demand DynamoDB table
+	DynamoDBWriteRequestsPerMonth int64
+	// DynamoDBStorageGB is the storage for each DynamoDB table
+	DynamoDBStorageGB float64
+}
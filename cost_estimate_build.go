@@ -0,0 +1,405 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	costHoursPerMonth = 730
+	// The Price List API is only available in a subset of regions
+	costPricingRegion = "us-east-1"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - costPrice
+//
+
+// costPrice is a Price List API product price. The default is the
+// us-east-1 list price used when the API isn't available.
+type costPrice struct {
+	serviceCode string
+	// regional prices include the location filter
+	regional   bool
+	filters    map[string]string
+	defaultUSD float64
+}
+
+var (
+	costPriceLambdaRequest = &costPrice{
+		serviceCode: "AWSLambda",
+		regional:    true,
+		filters:     map[string]string{"group": "AWS-Lambda-Requests"},
+		defaultUSD:  0.0000002,
+	}
+	costPriceLambdaGBSecond = &costPrice{
+		serviceCode: "AWSLambda",
+		regional:    true,
+		filters:     map[string]string{"group": "AWS-Lambda-Duration"},
+		defaultUSD:  0.0000166667,
+	}
+	costPriceAPIGatewayRESTRequest = &costPrice{
+		serviceCode: "AmazonApiGateway",
+		regional:    true,
+		filters:     map[string]string{"operation": "ApiGatewayRequest"},
+		defaultUSD:  0.0000035,
+	}
+	costPriceAPIGatewayHTTPRequest = &costPrice{
+		serviceCode: "AmazonApiGateway",
+		regional:    true,
+		filters:     map[string]string{"operation": "ApiGatewayHttpApi"},
+		defaultUSD:  0.000001,
+	}
+	costPriceCloudFrontRequest = &costPrice{
+		serviceCode: "AmazonCloudFront",
+		filters:     map[string]string{"usagetype": "US-Requests-Tier2-HTTPS"},
+		defaultUSD:  0.000001,
+	}
+	costPriceCloudFrontDataTransferGB = &costPrice{
+		serviceCode: "AmazonCloudFront",
+		filters:     map[string]string{"usagetype": "US-DataTransfer-Out-Bytes"},
+		defaultUSD:  0.085,
+	}
+	costPriceDynamoDBReadRequest = &costPrice{
+		serviceCode: "AmazonDynamoDB",
+		regional:    true,
+		filters: map[string]string{
+			"productFamily": "Amazon DynamoDB PayPerRequest Throughput",
+			"group":         "DDB-ReadUnits",
+		},
+		defaultUSD: 0.000000125,
+	}
+	costPriceDynamoDBWriteRequest = &costPrice{
+		serviceCode: "AmazonDynamoDB",
+		regional:    true,
+		filters: map[string]string{
+			"productFamily": "Amazon DynamoDB PayPerRequest Throughput",
+			"group":         "DDB-WriteUnits",
+		},
+		defaultUSD: 0.000000625,
+	}
+	costPriceDynamoDBReadCapacityHour = &costPrice{
+		serviceCode: "AmazonDynamoDB",
+		regional:    true,
+		filters: map[string]string{
+			"productFamily": "Provisioned IOPS",
+			"group":         "DDB-ReadUnits",
+		},
+		defaultUSD: 0.00013,
+	}
+	costPriceDynamoDBWriteCapacityHour = &costPrice{
+		serviceCode: "AmazonDynamoDB",
+		regional:    true,
+		filters: map[string]string{
+			"productFamily": "Provisioned IOPS",
+			"group":         "DDB-WriteUnits",
+		},
+		defaultUSD: 0.00065,
+	}
+	costPriceDynamoDBStorageGB = &costPrice{
+		serviceCode: "AmazonDynamoDB",
+		regional:    true,
+		filters: map[string]string{
+			"productFamily": "Database Storage",
+			"volumeType":    "Amazon DynamoDB - Indexed DataStore",
+		},
+		defaultUSD: 0.25,
+	}
+)
+
+// costPriceFunc returns the USD unit price
+type costPriceFunc func(price *costPrice) float64
+
+// defaultCostPrice returns the us-east-1 list price
+func defaultCostPrice(price *costPrice) float64 {
+	return price.defaultUSD
+}
+
+// firstTierUSDPrice returns the USD price of the first pricing tier in a
+// Price List API product
+func firstTierUSDPrice(product aws.JSONValue) (float64, bool) {
+	terms, _ := product["terms"].(map[string]interface{})
+	onDemand, _ := terms["OnDemand"].(map[string]interface{})
+	for _, eachTerm := range onDemand {
+		term, _ := eachTerm.(map[string]interface{})
+		dimensions, _ := term["priceDimensions"].(map[string]interface{})
+		for _, eachDimension := range dimensions {
+			dimension, _ := eachDimension.(map[string]interface{})
+			if beginRange, _ := dimension["beginRange"].(string); beginRange != "0" {
+				continue
+			}
+			pricePerUnit, _ := dimension["pricePerUnit"].(map[string]interface{})
+			usd, _ := pricePerUnit["USD"].(string)
+			usdValue, usdValueErr := strconv.ParseFloat(usd, 64)
+			if usdValueErr == nil && usdValue > 0 {
+				return usdValue, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// newPriceListCostPrice returns a costPriceFunc that queries the Price
+// List API for the region's prices. Prices that can't be found use the
+// default value.
+func newPriceListCostPrice(awsSession *session.Session,
+	logger *logrus.Logger) (costPriceFunc, string) {
+
+	region := aws.StringValue(awsSession.Config.Region)
+	location := ""
+	if awsRegion, awsRegionOk := endpoints.AwsPartition().Regions()[region]; awsRegionOk {
+		location = awsRegion.Description()
+	}
+	if location == "" {
+		logger.WithField("Region", region).
+			Warn("Unsupported cost estimate region. Using us-east-1 list prices.")
+		return defaultCostPrice, "us-east-1 list prices"
+	}
+	pricingSvc := pricing.New(awsSession, aws.NewConfig().WithRegion(costPricingRegion))
+	cache := make(map[*costPrice]float64)
+	priceFunc := func(price *costPrice) float64 {
+		if cachedPrice, cachedPriceOk := cache[price]; cachedPriceOk {
+			return cachedPrice
+		}
+		input := &pricing.GetProductsInput{
+			ServiceCode: aws.String(price.serviceCode),
+			MaxResults:  aws.Int64(10),
+		}
+		filters := make(map[string]string)
+		for eachKey, eachValue := range price.filters {
+			filters[eachKey] = eachValue
+		}
+		if price.regional {
+			filters["location"] = location
+		}
+		for eachKey, eachValue := range filters {
+			input.Filters = append(input.Filters, &pricing.Filter{
+				Type:  aws.String(pricing.FilterTypeTermMatch),
+				Field: aws.String(eachKey),
+				Value: aws.String(eachValue),
+			})
+		}
+		unitPrice := price.defaultUSD
+		output, outputErr := pricingSvc.GetProducts(input)
+		if outputErr != nil {
+			logger.WithFields(logrus.Fields{
+				"ServiceCode": price.serviceCode,
+				"Error":       outputErr,
+			}).Warn("Failed to query AWS Price List API. Using us-east-1 list price.")
+		} else {
+			for _, eachProduct := range output.PriceList {
+				if productPrice, productPriceOk := firstTierUSDPrice(eachProduct); productPriceOk {
+					unitPrice = productPrice
+					break
+				}
+			}
+		}
+		cache[price] = unitPrice
+		return unitPrice
+	}
+	return priceFunc, fmt.Sprintf("AWS Price List API (%s)", location)
+}
+
+//
+// END - costPrice
+////////////////////////////////////////////////////////////////////////////////
+
+// costEstimateItem is the estimated monthly cost of a single resource
+type costEstimateItem struct {
+	resourceName string
+	resourceType string
+	basis        string
+	monthlyUSD   float64
+}
+
+// costPropertyValue returns the literal numeric value of a JSON property
+func costPropertyValue(properties map[string]interface{}, name string) float64 {
+	value, _ := properties[name].(float64)
+	return value
+}
+
+// dynamoDBProvisionedCapacity returns the total provisioned read and write
+// capacity for the table and its global secondary indexes
+func dynamoDBProvisionedCapacity(properties map[string]interface{}) (float64, float64) {
+	throughputs := []interface{}{properties["ProvisionedThroughput"]}
+	indexes, _ := properties["GlobalSecondaryIndexes"].([]interface{})
+	for _, eachIndex := range indexes {
+		if index, indexOk := eachIndex.(map[string]interface{}); indexOk {
+			throughputs = append(throughputs, index["ProvisionedThroughput"])
+		}
+	}
+	readCapacity := 0.0
+	writeCapacity := 0.0
+	for _, eachThroughput := range throughputs {
+		if throughput, throughputOk := eachThroughput.(map[string]interface{}); throughputOk {
+			readCapacity += costPropertyValue(throughput, "ReadCapacityUnits")
+			writeCapacity += costPropertyValue(throughput, "WriteCapacityUnits")
+		}
+	}
+	return readCapacity, writeCapacity
+}
+
+// estimateMonthlyCost returns the estimated monthly cost for the lambda
+// functions and the supported template resources
+func estimateMonthlyCost(estimate *CostEstimate,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	template *gocf.Template,
+	priceFunc costPriceFunc) ([]*costEstimateItem, error) {
+
+	items := make([]*costEstimateItem, 0)
+	for _, eachLambda := range lambdaAWSInfos {
+		invocations := estimate.DefaultInvocationsPerMonth
+		durationMillis := int64(0)
+		memorySize := int64(128)
+		if eachLambda.Options != nil {
+			if eachLambda.Options.Timeout != 0 {
+				durationMillis = eachLambda.Options.Timeout * 1000
+			}
+			if eachLambda.Options.MemorySize != 0 {
+				memorySize = eachLambda.Options.MemorySize
+			}
+			if eachLambda.Options.CostHints != nil {
+				hints := eachLambda.Options.CostHints
+				if hints.InvocationsPerMonth < 0 || hints.AverageDurationMillis < 0 {
+					return nil, errors.Errorf("Invalid CostHints for function %s: %#v",
+						eachLambda.lambdaFunctionName(),
+						hints)
+				}
+				if hints.InvocationsPerMonth != 0 {
+					invocations = hints.InvocationsPerMonth
+				}
+				if hints.AverageDurationMillis != 0 {
+					durationMillis = hints.AverageDurationMillis
+				}
+			}
+		}
+		if durationMillis == 0 {
+			// The Lambda default timeout is 3 seconds
+			durationMillis = 3000
+		}
+		gbSeconds := float64(invocations) *
+			(float64(durationMillis) / 1000) *
+			(float64(memorySize) / 1024)
+		items = append(items, &costEstimateItem{
+			resourceName: eachLambda.LogicalResourceName(),
+			resourceType: "AWS::Lambda::Function",
+			basis: fmt.Sprintf("%d invocations, %d MB, %d ms",
+				invocations,
+				memorySize,
+				durationMillis),
+			monthlyUSD: float64(invocations)*priceFunc(costPriceLambdaRequest) +
+				gbSeconds*priceFunc(costPriceLambdaGBSecond),
+		})
+	}
+
+	resourceNames := make([]string, 0, len(template.Resources))
+	for eachName := range template.Resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+	for _, eachName := range resourceNames {
+		resource := template.Resources[eachName]
+		if resource.Properties == nil {
+			continue
+		}
+		resourceType := resource.Properties.CfnResourceType()
+		item := &costEstimateItem{
+			resourceName: eachName,
+			resourceType: resourceType,
+		}
+		switch resourceType {
+		case "AWS::ApiGateway::RestApi":
+			item.basis = fmt.Sprintf("%d requests", estimate.APIRequestsPerMonth)
+			item.monthlyUSD = float64(estimate.APIRequestsPerMonth) *
+				priceFunc(costPriceAPIGatewayRESTRequest)
+		case "AWS::ApiGatewayV2::Api":
+			item.basis = fmt.Sprintf("%d requests", estimate.APIRequestsPerMonth)
+			item.monthlyUSD = float64(estimate.APIRequestsPerMonth) *
+				priceFunc(costPriceAPIGatewayHTTPRequest)
+		case "AWS::CloudFront::Distribution":
+			item.basis = fmt.Sprintf("%d requests, %.1f GB",
+				estimate.CloudFrontRequestsPerMonth,
+				estimate.CloudFrontDataTransferGB)
+			item.monthlyUSD = float64(estimate.CloudFrontRequestsPerMonth)*
+				priceFunc(costPriceCloudFrontRequest) +
+				estimate.CloudFrontDataTransferGB*priceFunc(costPriceCloudFrontDataTransferGB)
+		case "AWS::DynamoDB::Table":
+			properties := resourcePropertiesMap(resource)
+			storageUSD := estimate.DynamoDBStorageGB * priceFunc(costPriceDynamoDBStorageGB)
+			if billingMode, _ := properties["BillingMode"].(string); billingMode == "PAY_PER_REQUEST" {
+				item.basis = fmt.Sprintf("%d reads, %d writes, %.1f GB",
+					estimate.DynamoDBReadRequestsPerMonth,
+					estimate.DynamoDBWriteRequestsPerMonth,
+					estimate.DynamoDBStorageGB)
+				item.monthlyUSD = float64(estimate.DynamoDBReadRequestsPerMonth)*
+					priceFunc(costPriceDynamoDBReadRequest) +
+					float64(estimate.DynamoDBWriteRequestsPerMonth)*
+						priceFunc(costPriceDynamoDBWriteRequest) +
+					storageUSD
+			} else {
+				readCapacity, writeCapacity := dynamoDBProvisionedCapacity(properties)
+				item.basis = fmt.Sprintf("%.f RCU, %.f WCU, %.1f GB",
+					readCapacity,
+					writeCapacity,
+					estimate.DynamoDBStorageGB)
+				item.monthlyUSD = costHoursPerMonth*
+					(readCapacity*priceFunc(costPriceDynamoDBReadCapacityHour)+
+						writeCapacity*priceFunc(costPriceDynamoDBWriteCapacityHour)) +
+					storageUSD
+			}
+		default:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// logCostEstimate logs the estimated monthly cost of the service
+func logCostEstimate(estimate *CostEstimate,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	template *gocf.Template,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+
+	if estimate.DefaultInvocationsPerMonth < 0 ||
+		estimate.APIRequestsPerMonth < 0 ||
+		estimate.CloudFrontRequestsPerMonth < 0 ||
+		estimate.CloudFrontDataTransferGB < 0 ||
+		estimate.DynamoDBReadRequestsPerMonth < 0 ||
+		estimate.DynamoDBWriteRequestsPerMonth < 0 ||
+		estimate.DynamoDBStorageGB < 0 {
+		return errors.Errorf("Invalid CostEstimate: %#v", estimate)
+	}
+	priceFunc, priceSource := newPriceListCostPrice(awsSession, logger)
+	items, itemsErr := estimateMonthlyCost(estimate, lambdaAWSInfos, template, priceFunc)
+	if itemsErr != nil {
+		return itemsErr
+	}
+	logger.Info(headerDivider)
+	logger.WithField("Prices", priceSource).Info("Estimated Monthly Cost (USD)")
+	logger.Info(headerDivider)
+	totalUSD := 0.0
+	for _, eachItem := range items {
+		totalUSD += eachItem.monthlyUSD
+		logger.WithFields(logrus.Fields{
+			"Type":  eachItem.resourceType,
+			"Basis": eachItem.basis,
+			"USD":   fmt.Sprintf("%.2f", eachItem.monthlyUSD),
+		}).Info(eachItem.resourceName)
+	}
+	logger.WithField("USD", fmt.Sprintf("%.2f", totalUSD)).
+		Info("Total estimated monthly cost")
+	return nil
+}
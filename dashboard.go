@@ -0,0 +1,14 @@
+package sparta
+
+// ServiceDashboard configures the CloudWatch dashboard that Sparta creates
+// for the service. The dashboard is generated from the provisioned template,
+// so it includes every Lambda function, API Gateway stage, SQS queue and
+// Step Functions state machine in the stack and is updated as resources are
+// added or removed. Each function is grouped with the SQS queues that it
+// consumes or uses as a dead letter queue.
+type ServiceDashboard struct {
+	// Name is the dashboard name. Defaults to the stack name.
+	Name string
+	// PeriodSeconds is the metric period. Defaults to 300.
+	PeriodSeconds int
+}
@@ -0,0 +1,471 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OutputServiceDashboardURL is the keyname used in the CloudFormation
+	// Output that stores the WorkflowHooks.Dashboard URL
+	// @enum OutputKey
+	OutputServiceDashboardURL = "ServiceDashboardURL"
+)
+
+const (
+	dashboardWidthUnits           = 24
+	dashboardMetricWidthUnits     = 8
+	dashboardMetricHeightUnits    = 6
+	dashboardDefaultPeriodSeconds = 300
+)
+
+// reDashboardToken matches the ${Ref:Name} and ${GetAtt:Name.Attribute}
+// placeholders in the marshalled dashboard body
+var reDashboardToken = regexp.MustCompile(`\$\{(Ref|GetAtt):([^}]+)\}`)
+
+func dashboardRef(logicalResourceName string) string {
+	return fmt.Sprintf("${Ref:%s}", logicalResourceName)
+}
+
+func dashboardGetAtt(logicalResourceName string, attribute string) string {
+	return fmt.Sprintf("${GetAtt:%s.%s}", logicalResourceName, attribute)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - dashboardLayout
+//
+
+// dashboardWidget is a CloudWatch dashboard widget. See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/CloudWatch-Dashboard-Body-Structure.html
+type dashboardWidget struct {
+	Type       string                 `json:"type"`
+	X          int                    `json:"x"`
+	Y          int                    `json:"y"`
+	Width      int                    `json:"width"`
+	Height     int                    `json:"height"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// dashboardLayout places widgets left to right in rows
+type dashboardLayout struct {
+	periodSeconds int
+	widgets       []*dashboardWidget
+	x             int
+	y             int
+	rowHeight     int
+}
+
+func (layout *dashboardLayout) newRow() {
+	layout.y += layout.rowHeight
+	layout.x = 0
+	layout.rowHeight = 0
+}
+
+func (layout *dashboardLayout) add(widget *dashboardWidget) {
+	if layout.x+widget.Width > dashboardWidthUnits {
+		layout.newRow()
+	}
+	widget.X = layout.x
+	widget.Y = layout.y
+	layout.x += widget.Width
+	if widget.Height > layout.rowHeight {
+		layout.rowHeight = widget.Height
+	}
+	layout.widgets = append(layout.widgets, widget)
+}
+
+// addText adds a full width markdown widget on a new row
+func (layout *dashboardLayout) addText(markdown string, height int) {
+	if layout.x != 0 {
+		layout.newRow()
+	}
+	layout.add(&dashboardWidget{
+		Type:   "text",
+		Width:  dashboardWidthUnits,
+		Height: height,
+		Properties: map[string]interface{}{
+			"markdown": markdown,
+		},
+	})
+	layout.newRow()
+}
+
+// addMetrics adds a time series widget
+func (layout *dashboardLayout) addMetrics(title string, metrics ...[]interface{}) {
+	layout.add(&dashboardWidget{
+		Type:   "metric",
+		Width:  dashboardMetricWidthUnits,
+		Height: dashboardMetricHeightUnits,
+		Properties: map[string]interface{}{
+			"view":    "timeSeries",
+			"stacked": false,
+			"region":  dashboardRef("AWS::Region"),
+			"period":  layout.periodSeconds,
+			"title":   title,
+			"metrics": metrics,
+		},
+	})
+}
+
+// addQueue adds the SQS queue metrics widget
+func (layout *dashboardLayout) addQueue(queueResourceName string) {
+	queueName := dashboardGetAtt(queueResourceName, "QueueName")
+	layout.addMetrics(fmt.Sprintf("SQS: %s", queueName),
+		[]interface{}{"AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", queueName,
+			map[string]string{"stat": "Maximum"}},
+		[]interface{}{"AWS/SQS", "ApproximateAgeOfOldestMessage", "QueueName", queueName,
+			map[string]string{"stat": "Maximum", "yAxis": "right"}})
+}
+
+//
+// END - dashboardLayout
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - dashboardResources
+//
+
+// dashboardAPIStage is an API Gateway stage. REST APIs are identified by
+// name and HTTP APIs by ID.
+type dashboardAPIStage struct {
+	apiName   string
+	apiID     string
+	stage     string
+	isHTTPAPI bool
+}
+
+// dashboardResources are the template resources included in the dashboard
+type dashboardResources struct {
+	functions      []string
+	functionQueues map[string][]string
+	queues         []string
+	apiStages      []*dashboardAPIStage
+	stateMachines  []string
+}
+
+// resourcePropertiesMap returns the JSON representation of the resource
+// properties so that the wrapped and gocf resource types are handled the
+// same way
+func resourcePropertiesMap(resource *gocf.Resource) map[string]interface{} {
+	properties := make(map[string]interface{})
+	jsonBytes, jsonBytesErr := json.Marshal(resource.Properties)
+	if jsonBytesErr == nil {
+		_ = json.Unmarshal(jsonBytes, &properties)
+	}
+	return properties
+}
+
+// dashboardRefTarget returns the resource name for a {"Ref": ...} value
+func dashboardRefTarget(value interface{}) string {
+	refMap, refMapOk := value.(map[string]interface{})
+	if !refMapOk {
+		return ""
+	}
+	target, _ := refMap["Ref"].(string)
+	return target
+}
+
+// dashboardGetAttTarget returns the resource name for a
+// {"Fn::GetAtt": [..., attribute]} value
+func dashboardGetAttTarget(value interface{}, attribute string) string {
+	getAttMap, getAttMapOk := value.(map[string]interface{})
+	if !getAttMapOk {
+		return ""
+	}
+	getAtt, getAttOk := getAttMap["Fn::GetAtt"].([]interface{})
+	if !getAttOk || len(getAtt) != 2 || getAtt[1] != attribute {
+		return ""
+	}
+	target, _ := getAtt[0].(string)
+	return target
+}
+
+// newDashboardResources categorizes the template resources
+func newDashboardResources(template *gocf.Template) *dashboardResources {
+	resources := &dashboardResources{
+		functionQueues: make(map[string][]string),
+	}
+	resourceNames := make([]string, 0, len(template.Resources))
+	for eachName := range template.Resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+
+	functions := make(map[string]bool)
+	queues := make(map[string]bool)
+	aliases := make(map[string]string)
+	restAPINames := make(map[string]string)
+	var eventSourceMappings []map[string]interface{}
+	var restStages [][]string
+	apiStages := make(map[string]bool)
+
+	for _, eachName := range resourceNames {
+		resource := template.Resources[eachName]
+		if resource.Properties == nil {
+			continue
+		}
+		switch resource.Properties.CfnResourceType() {
+		case "AWS::Lambda::Function":
+			functions[eachName] = true
+			resources.functions = append(resources.functions, eachName)
+		case "AWS::Lambda::Alias":
+			aliases[eachName] = dashboardRefTarget(resourcePropertiesMap(resource)["FunctionName"])
+		case "AWS::Lambda::EventSourceMapping":
+			eventSourceMappings = append(eventSourceMappings, resourcePropertiesMap(resource))
+		case "AWS::SQS::Queue":
+			queues[eachName] = true
+			resources.queues = append(resources.queues, eachName)
+		case "AWS::StepFunctions::StateMachine":
+			resources.stateMachines = append(resources.stateMachines, eachName)
+		case "AWS::ApiGateway::RestApi":
+			apiName, _ := resourcePropertiesMap(resource)["Name"].(string)
+			restAPINames[eachName] = apiName
+		case "AWS::ApiGateway::Stage", "AWS::ApiGateway::Deployment":
+			properties := resourcePropertiesMap(resource)
+			stageName, _ := properties["StageName"].(string)
+			restAPIName := dashboardRefTarget(properties["RestApiId"])
+			if stageName != "" && restAPIName != "" {
+				restStages = append(restStages, []string{restAPIName, stageName})
+			}
+		case "AWS::ApiGatewayV2::Stage":
+			properties := resourcePropertiesMap(resource)
+			stageName, _ := properties["StageName"].(string)
+			apiID := dashboardRefTarget(properties["ApiId"])
+			stageKey := fmt.Sprintf("%s/%s", apiID, stageName)
+			if stageName != "" && apiID != "" && !apiStages[stageKey] {
+				apiStages[stageKey] = true
+				resources.apiStages = append(resources.apiStages, &dashboardAPIStage{
+					apiID:     apiID,
+					stage:     stageName,
+					isHTTPAPI: true,
+				})
+			}
+		}
+	}
+	// REST API metrics use the API name, which must be a literal
+	for _, eachStage := range restStages {
+		apiName := restAPINames[eachStage[0]]
+		stageKey := fmt.Sprintf("%s/%s", eachStage[0], eachStage[1])
+		if apiName != "" && !apiStages[stageKey] {
+			apiStages[stageKey] = true
+			resources.apiStages = append(resources.apiStages, &dashboardAPIStage{
+				apiName: apiName,
+				stage:   eachStage[1],
+			})
+		}
+	}
+
+	// Group each function with the queues it consumes or uses as a DLQ
+	functionName := func(value interface{}) string {
+		target := dashboardGetAttTarget(value, "Arn")
+		if target == "" {
+			target = dashboardRefTarget(value)
+		}
+		if aliasTarget, isAlias := aliases[target]; isAlias {
+			target = aliasTarget
+		}
+		if !functions[target] {
+			return ""
+		}
+		return target
+	}
+	groupedQueues := make(map[string]bool)
+	addFunctionQueue := func(function string, queueArn interface{}) {
+		queue := dashboardGetAttTarget(queueArn, "Arn")
+		if function == "" || !queues[queue] {
+			return
+		}
+		for _, eachQueue := range resources.functionQueues[function] {
+			if eachQueue == queue {
+				return
+			}
+		}
+		groupedQueues[queue] = true
+		resources.functionQueues[function] = append(resources.functionQueues[function], queue)
+	}
+	for _, eachMapping := range eventSourceMappings {
+		addFunctionQueue(functionName(eachMapping["FunctionName"]), eachMapping["EventSourceArn"])
+	}
+	for _, eachFunction := range resources.functions {
+		properties := resourcePropertiesMap(template.Resources[eachFunction])
+		if deadLetterConfig, deadLetterConfigOk := properties["DeadLetterConfig"].(map[string]interface{}); deadLetterConfigOk {
+			addFunctionQueue(eachFunction, deadLetterConfig["TargetArn"])
+		}
+	}
+	// The remaining queues are listed separately
+	ungroupedQueues := make([]string, 0)
+	for _, eachQueue := range resources.queues {
+		if !groupedQueues[eachQueue] {
+			ungroupedQueues = append(ungroupedQueues, eachQueue)
+		}
+	}
+	resources.queues = ungroupedQueues
+	return resources
+}
+
+//
+// END - dashboardResources
+////////////////////////////////////////////////////////////////////////////////
+
+// dashboardBody returns the Fn::Join expression for the marshalled body,
+// replacing the placeholders with the intrinsic functions
+func dashboardBody(body string) *gocf.StringExpr {
+	var parts []gocf.Stringable
+	lastIndex := 0
+	for _, eachMatch := range reDashboardToken.FindAllStringSubmatchIndex(body, -1) {
+		if eachMatch[0] > lastIndex {
+			parts = append(parts, gocf.String(body[lastIndex:eachMatch[0]]))
+		}
+		target := body[eachMatch[4]:eachMatch[5]]
+		if body[eachMatch[2]:eachMatch[3]] == "Ref" {
+			parts = append(parts, gocf.Ref(target))
+		} else {
+			attributeIndex := strings.LastIndex(target, ".")
+			parts = append(parts, gocf.GetAtt(target[:attributeIndex], target[attributeIndex+1:]))
+		}
+		lastIndex = eachMatch[1]
+	}
+	if lastIndex < len(body) {
+		parts = append(parts, gocf.String(body[lastIndex:]))
+	}
+	return gocf.Join("", parts...)
+}
+
+// exportServiceDashboard adds the service dashboard for the template
+// resources to the template
+func exportServiceDashboard(serviceName string,
+	dashboard *ServiceDashboard,
+	template *gocf.Template,
+	logger *logrus.Logger) error {
+
+	periodSeconds := dashboard.PeriodSeconds
+	if periodSeconds == 0 {
+		periodSeconds = dashboardDefaultPeriodSeconds
+	}
+	if periodSeconds < 60 || periodSeconds%60 != 0 {
+		return errors.Errorf("ServiceDashboard PeriodSeconds must be a multiple of 60. Found: %d",
+			periodSeconds)
+	}
+	resources := newDashboardResources(template)
+	layout := &dashboardLayout{
+		periodSeconds: periodSeconds,
+	}
+	queueCount := len(resources.queues)
+	for _, eachQueues := range resources.functionQueues {
+		queueCount += len(eachQueues)
+	}
+	stackName := dashboardRef("AWS::StackName")
+	region := dashboardRef("AWS::Region")
+	layout.addText(fmt.Sprintf("## %s\n"+
+		"[CloudFormation Stack](https://%s.console.aws.amazon.com/cloudformation/home?region=%s#/stacks/stackinfo?stackId=%s) "+
+		"| [X-Ray](https://%s.console.aws.amazon.com/xray/home?region=%s#/service-map) "+
+		"| **Lambda Functions**: %d | **API Stages**: %d | **SQS Queues**: %d | **State Machines**: %d",
+		stackName,
+		region,
+		region,
+		dashboardRef("AWS::StackId"),
+		region,
+		region,
+		len(resources.functions),
+		len(resources.apiStages),
+		queueCount,
+		len(resources.stateMachines)),
+		2)
+
+	for _, eachFunction := range resources.functions {
+		functionName := dashboardRef(eachFunction)
+		layout.addText(fmt.Sprintf("### λ %s [Logs](https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#logsV2:log-groups)",
+			functionName,
+			region,
+			region),
+			1)
+		layout.addMetrics("Invocations",
+			[]interface{}{"AWS/Lambda", "Invocations", "FunctionName", functionName, map[string]string{"stat": "Sum"}},
+			[]interface{}{"AWS/Lambda", "Errors", "FunctionName", functionName, map[string]string{"stat": "Sum"}},
+			[]interface{}{"AWS/Lambda", "Throttles", "FunctionName", functionName, map[string]string{"stat": "Sum"}})
+		layout.addMetrics("Duration",
+			[]interface{}{"AWS/Lambda", "Duration", "FunctionName", functionName, map[string]string{"stat": "Average"}},
+			[]interface{}{"AWS/Lambda", "Duration", "FunctionName", functionName, map[string]string{"stat": "p99"}})
+		layout.addMetrics("Concurrent Executions",
+			[]interface{}{"AWS/Lambda", "ConcurrentExecutions", "FunctionName", functionName, map[string]string{"stat": "Maximum"}})
+		for _, eachQueue := range resources.functionQueues[eachFunction] {
+			layout.addQueue(eachQueue)
+		}
+	}
+	if len(resources.apiStages) != 0 {
+		layout.addText("### API Gateway", 1)
+		for _, eachStage := range resources.apiStages {
+			dimensionName := "ApiName"
+			dimensionValue := eachStage.apiName
+			countMetric, clientErrorMetric, serverErrorMetric := "Count", "4XXError", "5XXError"
+			if eachStage.isHTTPAPI {
+				dimensionName = "ApiId"
+				dimensionValue = dashboardRef(eachStage.apiID)
+				clientErrorMetric, serverErrorMetric = "4xx", "5xx"
+			}
+			layout.addMetrics(fmt.Sprintf("API: %s (%s)", dimensionValue, eachStage.stage),
+				[]interface{}{"AWS/ApiGateway", countMetric, dimensionName, dimensionValue, "Stage", eachStage.stage, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/ApiGateway", clientErrorMetric, dimensionName, dimensionValue, "Stage", eachStage.stage, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/ApiGateway", serverErrorMetric, dimensionName, dimensionValue, "Stage", eachStage.stage, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/ApiGateway", "Latency", dimensionName, dimensionValue, "Stage", eachStage.stage, map[string]string{"stat": "p99", "yAxis": "right"}})
+		}
+	}
+	if len(resources.queues) != 0 {
+		layout.addText("### SQS", 1)
+		for _, eachQueue := range resources.queues {
+			layout.addQueue(eachQueue)
+		}
+	}
+	if len(resources.stateMachines) != 0 {
+		layout.addText("### Step Functions", 1)
+		for _, eachStateMachine := range resources.stateMachines {
+			stateMachineArn := dashboardRef(eachStateMachine)
+			layout.addMetrics(fmt.Sprintf("State Machine: %s", dashboardGetAtt(eachStateMachine, "Name")),
+				[]interface{}{"AWS/States", "ExecutionsStarted", "StateMachineArn", stateMachineArn, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/States", "ExecutionsSucceeded", "StateMachineArn", stateMachineArn, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/States", "ExecutionsFailed", "StateMachineArn", stateMachineArn, map[string]string{"stat": "Sum"}},
+				[]interface{}{"AWS/States", "ExecutionsTimedOut", "StateMachineArn", stateMachineArn, map[string]string{"stat": "Sum"}})
+		}
+	}
+	bodyBytes, bodyBytesErr := json.Marshal(map[string]interface{}{
+		"widgets": layout.widgets,
+	})
+	if bodyBytesErr != nil {
+		return errors.Wrapf(bodyBytesErr, "Failed to marshal service dashboard")
+	}
+
+	dashboardResource := &gocf.CloudWatchDashboard{
+		DashboardBody: dashboardBody(string(bodyBytes)),
+		DashboardName: gocf.Ref("AWS::StackName").String(),
+	}
+	if dashboard.Name != "" {
+		dashboardResource.DashboardName = gocf.String(dashboard.Name)
+	}
+	dashboardResourceName := CloudFormationResourceName("ServiceDashboard", serviceName)
+	template.AddResource(dashboardResourceName, dashboardResource)
+	template.Outputs[OutputServiceDashboardURL] = &gocf.Output{
+		Description: "CloudWatch Dashboard URL",
+		Value: gocf.Join("",
+			gocf.String("https://"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(".console.aws.amazon.com/cloudwatch/home?region="),
+			gocf.Ref("AWS::Region"),
+			gocf.String("#dashboards:name="),
+			gocf.Ref(dashboardResourceName)),
+	}
+	logger.WithFields(logrus.Fields{
+		"Functions":     len(resources.functions),
+		"APIStages":     len(resources.apiStages),
+		"StateMachines": len(resources.stateMachines),
+	}).Debug("Created service dashboard")
+	return nil
+}
@@ -27,7 +27,7 @@ func CloudWatchErrorAlarmDecorator(periodWindow int,
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		periodInSeconds := minutesPerPeriod * 60
@@ -0,0 +1,299 @@
+package decorator
+
+import (
+	"fmt"
+	"strings"
+
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LambdaAlarmThreshold is the configuration for a single alarm in a
+// LambdaAlarmPack. The alarm state is ALARM if the statistic is greater
+// than or equal to the Threshold.
+type LambdaAlarmThreshold struct {
+	// Threshold is the value that triggers the alarm
+	Threshold int64
+	// PeriodSeconds is the statistic period. Defaults to 60.
+	PeriodSeconds int64
+	// EvaluationPeriods is the number of periods that are compared to the
+	// Threshold. Defaults to 5.
+	EvaluationPeriods int64
+	// DatapointsToAlarm is the number of breaching periods that trigger
+	// the alarm. Defaults to EvaluationPeriods.
+	DatapointsToAlarm int64
+}
+
+// LambdaAlarmPack is the set of standard health alarms for a lambda
+// function. Nil thresholds disable the corresponding alarm. Use
+// NewLambdaAlarmPack for the default thresholds.
+type LambdaAlarmPack struct {
+	// AlarmActions are the ARNs (eg, an SNS topic) notified when an alarm
+	// enters the ALARM state
+	AlarmActions []gocf.Stringable
+	// OKActions are the ARNs notified when an alarm returns to the OK state
+	OKActions []gocf.Stringable
+	// Owner is the optional team or individual responsible for the
+	// function. It's included in each alarm description.
+	Owner string
+	// Errors alarms on the Sum of the function Errors
+	Errors *LambdaAlarmThreshold
+	// Throttles alarms on the Sum of the function Throttles
+	Throttles *LambdaAlarmThreshold
+	// DurationP99 alarms on the p99 function Duration, in milliseconds.
+	// A zero Threshold defaults to 80% of the function timeout.
+	DurationP99 *LambdaAlarmThreshold
+	// IteratorAge alarms on the Maximum IteratorAge, in milliseconds. Only
+	// enable it for functions with Kinesis or DynamoDB stream event sources.
+	IteratorAge *LambdaAlarmThreshold
+	// DeadLetterQueueDepth alarms on the Maximum number of visible messages
+	// in the function's SQS dead letter queue. It's ignored for functions
+	// that don't have an SQS DeadLetterConfig.
+	DeadLetterQueueDepth *LambdaAlarmThreshold
+}
+
+// NewLambdaAlarmPack returns a LambdaAlarmPack with the default Errors,
+// Throttles, DurationP99 and DeadLetterQueueDepth alarms that notify
+// the alarmActions
+func NewLambdaAlarmPack(alarmActions ...gocf.Stringable) *LambdaAlarmPack {
+	return &LambdaAlarmPack{
+		AlarmActions:         alarmActions,
+		Errors:               &LambdaAlarmThreshold{Threshold: 1},
+		Throttles:            &LambdaAlarmThreshold{Threshold: 1},
+		DurationP99:          &LambdaAlarmThreshold{},
+		DeadLetterQueueDepth: &LambdaAlarmThreshold{Threshold: 1},
+	}
+}
+
+// lambdaAlarmDefinition is a single alarm in the pack
+type lambdaAlarmDefinition struct {
+	name       string
+	threshold  *LambdaAlarmThreshold
+	namespace  string
+	metricName string
+	statistic  string
+	dimensions gocf.CloudWatchAlarmDimensionList
+	unit       string
+}
+
+// alarmResource returns the CloudWatch alarm for the definition
+func (pack *LambdaAlarmPack) alarmResource(lambdaResourceName string,
+	definition *lambdaAlarmDefinition) (*gocf.CloudWatchAlarm, error) {
+
+	threshold := definition.threshold
+	periodSeconds := threshold.PeriodSeconds
+	if periodSeconds == 0 {
+		periodSeconds = 60
+	}
+	evaluationPeriods := threshold.EvaluationPeriods
+	if evaluationPeriods == 0 {
+		evaluationPeriods = 5
+	}
+	datapointsToAlarm := threshold.DatapointsToAlarm
+	if datapointsToAlarm == 0 {
+		datapointsToAlarm = evaluationPeriods
+	}
+	if periodSeconds < 0 || evaluationPeriods < 0 || datapointsToAlarm > evaluationPeriods {
+		return nil, errors.Errorf("Invalid %s alarm threshold: %#v", definition.name, threshold)
+	}
+	descriptionParts := []gocf.Stringable{
+		gocf.String(fmt.Sprintf("%s %s is greater than or equal to %d for AWS Lambda function",
+			definition.metricName,
+			definition.statistic,
+			threshold.Threshold)),
+		gocf.Ref(lambdaResourceName),
+		gocf.String("(Stack:"),
+		gocf.Ref("AWS::StackName"),
+		gocf.String(")"),
+	}
+	if pack.Owner != "" {
+		descriptionParts = append(descriptionParts,
+			gocf.String(fmt.Sprintf("Owner: %s", pack.Owner)))
+	}
+	alarm := &gocf.CloudWatchAlarm{
+		AlarmName: gocf.Join("-",
+			gocf.Ref(lambdaResourceName),
+			gocf.String(definition.name)),
+		AlarmDescription:   gocf.Join(" ", descriptionParts...),
+		Namespace:          gocf.String(definition.namespace),
+		MetricName:         gocf.String(definition.metricName),
+		Period:             gocf.Integer(periodSeconds),
+		EvaluationPeriods:  gocf.Integer(evaluationPeriods),
+		DatapointsToAlarm:  gocf.Integer(datapointsToAlarm),
+		Threshold:          gocf.Integer(threshold.Threshold),
+		ComparisonOperator: gocf.String("GreaterThanOrEqualToThreshold"),
+		Dimensions:         &definition.dimensions,
+		TreatMissingData:   gocf.String("notBreaching"),
+	}
+	if strings.HasPrefix(definition.statistic, "p") {
+		alarm.ExtendedStatistic = gocf.String(definition.statistic)
+	} else {
+		alarm.Statistic = gocf.String(definition.statistic)
+	}
+	if definition.unit != "" {
+		alarm.Unit = gocf.String(definition.unit)
+	}
+	if len(pack.AlarmActions) != 0 {
+		alarm.AlarmActions = gocf.StringList(pack.AlarmActions...)
+	}
+	if len(pack.OKActions) != 0 {
+		alarm.OKActions = gocf.StringList(pack.OKActions...)
+	}
+	return alarm, nil
+}
+
+// deadLetterQueueName returns the QueueName dimension value for an SQS
+// dead letter queue, or nil if the target isn't an SQS queue that can
+// be resolved
+func deadLetterQueueName(lambdaResource gocf.LambdaFunction) *gocf.StringExpr {
+	if lambdaResource.DeadLetterConfig == nil ||
+		lambdaResource.DeadLetterConfig.TargetArn == nil {
+		return nil
+	}
+	targetArn := lambdaResource.DeadLetterConfig.TargetArn
+	var getAtt *gocf.GetAttFunc
+	switch typedFunc := targetArn.Func.(type) {
+	case gocf.GetAttFunc:
+		getAtt = &typedFunc
+	case *gocf.GetAttFunc:
+		getAtt = typedFunc
+	}
+	if getAtt != nil {
+		if getAtt.Name != "Arn" {
+			return nil
+		}
+		return gocf.GetAtt(getAtt.Resource, "QueueName")
+	}
+	// arn:aws:sqs:region:account-id:queuename
+	arnParts := strings.Split(targetArn.Literal, ":")
+	if len(arnParts) == 6 && arnParts[2] == "sqs" {
+		return gocf.String(arnParts[5])
+	}
+	return nil
+}
+
+// definitions returns the enabled alarm definitions for the function
+func (pack *LambdaAlarmPack) definitions(lambdaResourceName string,
+	lambdaResource gocf.LambdaFunction,
+	logger *logrus.Logger) []*lambdaAlarmDefinition {
+
+	functionDimensions := gocf.CloudWatchAlarmDimensionList{
+		gocf.CloudWatchAlarmDimension{
+			Name:  gocf.String("FunctionName"),
+			Value: gocf.Ref(lambdaResourceName).String(),
+		},
+	}
+	definitions := make([]*lambdaAlarmDefinition, 0)
+	if pack.Errors != nil {
+		definitions = append(definitions, &lambdaAlarmDefinition{
+			name:       "Errors",
+			threshold:  pack.Errors,
+			namespace:  "AWS/Lambda",
+			metricName: "Errors",
+			statistic:  "Sum",
+			dimensions: functionDimensions,
+		})
+	}
+	if pack.Throttles != nil {
+		definitions = append(definitions, &lambdaAlarmDefinition{
+			name:       "Throttles",
+			threshold:  pack.Throttles,
+			namespace:  "AWS/Lambda",
+			metricName: "Throttles",
+			statistic:  "Sum",
+			dimensions: functionDimensions,
+		})
+	}
+	if pack.DurationP99 != nil {
+		durationThreshold := *pack.DurationP99
+		if durationThreshold.Threshold == 0 {
+			// The Lambda default timeout is 3 seconds
+			timeoutSeconds := int64(3)
+			if lambdaResource.Timeout != nil && lambdaResource.Timeout.Literal != 0 {
+				timeoutSeconds = lambdaResource.Timeout.Literal
+			}
+			durationThreshold.Threshold = timeoutSeconds * 800
+		}
+		definitions = append(definitions, &lambdaAlarmDefinition{
+			name:       "DurationP99",
+			threshold:  &durationThreshold,
+			namespace:  "AWS/Lambda",
+			metricName: "Duration",
+			statistic:  "p99",
+			dimensions: functionDimensions,
+			unit:       "Milliseconds",
+		})
+	}
+	if pack.IteratorAge != nil {
+		definitions = append(definitions, &lambdaAlarmDefinition{
+			name:       "IteratorAge",
+			threshold:  pack.IteratorAge,
+			namespace:  "AWS/Lambda",
+			metricName: "IteratorAge",
+			statistic:  "Maximum",
+			dimensions: functionDimensions,
+			unit:       "Milliseconds",
+		})
+	}
+	if pack.DeadLetterQueueDepth != nil {
+		queueName := deadLetterQueueName(lambdaResource)
+		if queueName != nil {
+			definitions = append(definitions, &lambdaAlarmDefinition{
+				name:       "DeadLetterQueueDepth",
+				threshold:  pack.DeadLetterQueueDepth,
+				namespace:  "AWS/SQS",
+				metricName: "ApproximateNumberOfMessagesVisible",
+				statistic:  "Maximum",
+				dimensions: gocf.CloudWatchAlarmDimensionList{
+					gocf.CloudWatchAlarmDimension{
+						Name:  gocf.String("QueueName"),
+						Value: queueName,
+					},
+				},
+			})
+		} else {
+			logger.WithField("Resource", lambdaResourceName).
+				Debug("Skipping DeadLetterQueueDepth alarm for function without an SQS dead letter queue")
+		}
+	}
+	return definitions
+}
+
+// DecorateTemplate adds the alarms to the template. It satisfies the
+// sparta.TemplateDecoratorHandler interface.
+func (pack *LambdaAlarmPack) DecorateTemplate(serviceName string,
+	lambdaResourceName string,
+	lambdaResource gocf.LambdaFunction,
+	resourceMetadata map[string]interface{},
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	template *gocf.Template,
+	context *sparta.WorkflowHookContext,
+	logger *logrus.Logger) error {
+
+	for _, eachDefinition := range pack.definitions(lambdaResourceName, lambdaResource, logger) {
+		alarm, alarmErr := pack.alarmResource(lambdaResourceName, eachDefinition)
+		if alarmErr != nil {
+			return alarmErr
+		}
+		alarmResourceName := sparta.CloudFormationResourceName(
+			fmt.Sprintf("Alarm%s", eachDefinition.name),
+			lambdaResourceName)
+		template.AddResource(alarmResourceName, alarm)
+	}
+	return nil
+}
+
+// DecorateAll adds the pack to each function's Decorators so that every
+// function in the service has the same alarms
+func (pack *LambdaAlarmPack) DecorateAll(lambdaFunctions []*sparta.LambdaAWSInfo) {
+	for _, eachLambda := range lambdaFunctions {
+		eachLambda.Decorators = append(eachLambda.Decorators, pack)
+	}
+}
+
+// Ensure compliance
+var _ sparta.TemplateDecoratorHandler = (*LambdaAlarmPack)(nil)
@@ -0,0 +1,106 @@
+package decorator
+
+import (
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func newAlarmPackLambda(t *testing.T) *sparta.LambdaAWSInfo {
+	lambdaFn, lambdaFnErr := sparta.NewAWSLambda("Orders",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to create lambda: %s", lambdaFnErr)
+	}
+	return lambdaFn
+}
+
+func TestLambdaAlarmPack(t *testing.T) {
+	pack := NewLambdaAlarmPack(gocf.Ref("AlarmTopic"))
+	pack.Owner = "orders-team"
+	pack.IteratorAge = &LambdaAlarmThreshold{Threshold: 60000}
+	lambdaFn := newAlarmPackLambda(t)
+	lambdaFn.Options.Timeout = 10
+	lambdaFn.Options.DeadLetterConfigArn = gocf.GetAtt("OrdersDLQ", "Arn")
+	lambdaResourceName := lambdaFn.LogicalResourceName()
+
+	harness := spartaTesting.NewDecoratorHarness(t)
+	decorateErr := harness.RunTemplateDecorator(lambdaFn, pack)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate template: %s", decorateErr)
+	}
+	alarmNames := harness.ResourceNames("AWS::CloudWatch::Alarm")
+	if len(alarmNames) != 5 {
+		t.Fatalf("Expected 5 alarms. Found: %d", len(alarmNames))
+	}
+	alarmProperties := func(name string) map[string]interface{} {
+		return harness.ResourceProperties(t,
+			sparta.CloudFormationResourceName("Alarm"+name, lambdaResourceName),
+			"AWS::CloudWatch::Alarm")
+	}
+	functionDimensions := gocf.CloudWatchAlarmDimensionList{
+		gocf.CloudWatchAlarmDimension{
+			Name:  gocf.String("FunctionName"),
+			Value: gocf.Ref(lambdaResourceName).String(),
+		},
+	}
+	errorsAlarm := alarmProperties("Errors")
+	spartaTesting.AssertTemplateValue(t, errorsAlarm, "Errors", "MetricName")
+	spartaTesting.AssertTemplateValue(t, errorsAlarm, "Sum", "Statistic")
+	spartaTesting.AssertTemplateValue(t, errorsAlarm, functionDimensions, "Dimensions")
+	spartaTesting.AssertTemplateValue(t, errorsAlarm,
+		[]*gocf.StringExpr{gocf.Ref("AlarmTopic").String()},
+		"AlarmActions")
+	spartaTesting.AssertTemplateValue(t, errorsAlarm,
+		"Owner: orders-team",
+		"AlarmDescription", "Fn::Join", 1, 5)
+
+	spartaTesting.AssertTemplateValue(t, alarmProperties("Throttles"), "Throttles", "MetricName")
+
+	durationAlarm := alarmProperties("DurationP99")
+	spartaTesting.AssertTemplateValue(t, durationAlarm, "p99", "ExtendedStatistic")
+	spartaTesting.AssertTemplateValue(t, durationAlarm, 8000, "Threshold")
+
+	iteratorAgeAlarm := alarmProperties("IteratorAge")
+	spartaTesting.AssertTemplateValue(t, iteratorAgeAlarm, "IteratorAge", "MetricName")
+	spartaTesting.AssertTemplateValue(t, iteratorAgeAlarm, 60000, "Threshold")
+
+	dlqAlarm := alarmProperties("DeadLetterQueueDepth")
+	spartaTesting.AssertTemplateValue(t, dlqAlarm, "AWS/SQS", "Namespace")
+	spartaTesting.AssertTemplateValue(t, dlqAlarm,
+		gocf.GetAtt("OrdersDLQ", "QueueName"),
+		"Dimensions", 0, "Value")
+
+	// Functions without an SQS dead letter queue don't have a DLQ alarm
+	lambdaFn = newAlarmPackLambda(t)
+	lambdaFn.Options.DeadLetterConfigArn = gocf.String("arn:aws:sns:us-west-2:000000000000:dlq")
+	harness = spartaTesting.NewDecoratorHarness(t)
+	decorateErr = harness.RunTemplateDecorator(lambdaFn,
+		NewLambdaAlarmPack(gocf.Ref("AlarmTopic")))
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate template: %s", decorateErr)
+	}
+	alarmNames = harness.ResourceNames("AWS::CloudWatch::Alarm")
+	if len(alarmNames) != 3 {
+		t.Fatalf("Expected 3 default alarms. Found: %v", alarmNames)
+	}
+	// The default duration threshold is 80% of the 3 second timeout
+	spartaTesting.AssertTemplateValue(t, alarmProperties("DurationP99"), 2400, "Threshold")
+
+	// Invalid thresholds are rejected
+	invalidPack := &LambdaAlarmPack{
+		Errors: &LambdaAlarmThreshold{
+			Threshold:         1,
+			EvaluationPeriods: 2,
+			DatapointsToAlarm: 3,
+		},
+	}
+	decorateErr = spartaTesting.NewDecoratorHarness(t).RunTemplateDecorator(newAlarmPackLambda(t),
+		invalidPack)
+	if decorateErr == nil {
+		t.Fatalf("Failed to reject invalid alarm threshold")
+	}
+}
@@ -26,7 +26,7 @@ func APIGatewayDomainDecorator(apiGateway *sparta.API,
 	domainName string) sparta.ServiceDecoratorHookHandler {
 
 	// Attach the domain decorator to the API GW instance
-	domainDecorator := func(context map[string]interface{},
+	domainDecorator := func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
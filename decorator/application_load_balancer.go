@@ -77,7 +77,7 @@ func (albd *ApplicationLoadBalancerDecorator) AddMultiConditionalEntryWithPriori
 }
 
 // DecorateService satisfies the ServiceDecoratorHookHandler interface
-func (albd *ApplicationLoadBalancerDecorator) DecorateService(context map[string]interface{},
+func (albd *ApplicationLoadBalancerDecorator) DecorateService(context *sparta.WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -0,0 +1,342 @@
+package decorator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OutputCostAlertTopicArn is the keyname used in the CloudFormation
+	// Output that stores the SNS topic ARN created by the CostBudget
+	// decorator
+	// @enum OutputKey
+	OutputCostAlertTopicArn = "CostAlertTopicArn"
+)
+
+// stackNameCostAllocationTag is the AWS generated tag that CloudFormation
+// applies to the stack resources
+const stackNameCostAllocationTag = "aws:cloudformation:stack-name"
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::CE::AnomalyMonitor
+
+// ceAnomalyMonitor represents the AWS::CE::AnomalyMonitor resource, which
+// isn't included in the go-cloudformation schema
+type ceAnomalyMonitor struct {
+	MonitorName          *gocf.StringExpr `json:"MonitorName,omitempty"`
+	MonitorType          *gocf.StringExpr `json:"MonitorType,omitempty"`
+	MonitorSpecification *gocf.StringExpr `json:"MonitorSpecification,omitempty"`
+}
+
+// CfnResourceType returns AWS::CE::AnomalyMonitor to implement the ResourceProperties interface
+func (s ceAnomalyMonitor) CfnResourceType() string {
+	return "AWS::CE::AnomalyMonitor"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s ceAnomalyMonitor) CfnResourceAttributes() []string {
+	return []string{"MonitorArn"}
+}
+
+// END - AWS::CE::AnomalyMonitor
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::CE::AnomalySubscription
+
+// ceAnomalySubscriptionSubscriber represents the
+// AWS::CE::AnomalySubscription.Subscriber property type
+type ceAnomalySubscriptionSubscriber struct {
+	Address *gocf.StringExpr `json:"Address,omitempty"`
+	Type    *gocf.StringExpr `json:"Type,omitempty"`
+}
+
+// ceAnomalySubscription represents the AWS::CE::AnomalySubscription
+// resource, which isn't included in the go-cloudformation schema
+type ceAnomalySubscription struct {
+	Frequency           *gocf.StringExpr                  `json:"Frequency,omitempty"`
+	MonitorArnList      *gocf.StringListExpr              `json:"MonitorArnList,omitempty"`
+	Subscribers         []ceAnomalySubscriptionSubscriber `json:"Subscribers,omitempty"`
+	SubscriptionName    *gocf.StringExpr                  `json:"SubscriptionName,omitempty"`
+	ThresholdExpression *gocf.StringExpr                  `json:"ThresholdExpression,omitempty"`
+}
+
+// CfnResourceType returns AWS::CE::AnomalySubscription to implement the ResourceProperties interface
+func (s ceAnomalySubscription) CfnResourceType() string {
+	return "AWS::CE::AnomalySubscription"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s ceAnomalySubscription) CfnResourceAttributes() []string {
+	return []string{"SubscriptionArn"}
+}
+
+// END - AWS::CE::AnomalySubscription
+////////////////////////////////////////////////////////////////////////////////
+
+// BudgetNotification is a CostBudget notification threshold
+type BudgetNotification struct {
+	// ThresholdPercent is the percentage of the budget limit that triggers
+	// the notification
+	ThresholdPercent int64
+	// Forecasted notifies when the forecasted, rather than actual, spend
+	// exceeds the threshold
+	Forecasted bool
+}
+
+// CostBudget is a ServiceDecoratorHookHandler that creates an AWS Budgets
+// monthly cost budget, and optionally a Cost Anomaly Detection monitor,
+// scoped to the service's cost allocation tag. Notifications are published
+// to an SNS topic. Use NewCostBudget for the default notifications.
+//
+// The cost allocation tag must be activated in the Billing console before
+// costs are reported for it.
+type CostBudget struct {
+	// MonthlyLimitUSD is the monthly budget amount
+	MonthlyLimitUSD int64
+	// TagKey is the cost allocation tag key that identifies the service
+	// costs. Defaults to the aws:cloudformation:stack-name tag that
+	// CloudFormation applies to the stack resources.
+	TagKey string
+	// TagValue is the cost allocation tag value. Defaults to the stack name.
+	TagValue gocf.Stringable
+	// Notifications are the budget thresholds that publish to the topic
+	Notifications []*BudgetNotification
+	// TopicArn is the optional existing SNS topic for the notifications.
+	// The topic policy must allow the budgets.amazonaws.com and
+	// costalerts.amazonaws.com service principals to publish. If empty,
+	// the decorator creates the topic.
+	TopicArn gocf.Stringable
+	// EmailAddresses are subscribed to the topic created by the decorator
+	EmailAddresses []string
+	// AnomalyThresholdUSD optionally creates a Cost Anomaly Detection
+	// monitor for the cost allocation tag that notifies the topic of
+	// anomalies with a total impact greater than or equal to the value
+	AnomalyThresholdUSD int64
+}
+
+// NewCostBudget returns a CostBudget that notifies the emailAddresses when
+// the actual spend exceeds 80% and 100% of the monthlyLimitUSD, and when
+// the forecasted spend exceeds 100%
+func NewCostBudget(monthlyLimitUSD int64, emailAddresses ...string) *CostBudget {
+	return &CostBudget{
+		MonthlyLimitUSD: monthlyLimitUSD,
+		Notifications: []*BudgetNotification{
+			{ThresholdPercent: 80},
+			{ThresholdPercent: 100},
+			{ThresholdPercent: 100, Forecasted: true},
+		},
+		EmailAddresses: emailAddresses,
+	}
+}
+
+func (budget *CostBudget) validate() error {
+	if budget.MonthlyLimitUSD <= 0 {
+		return errors.Errorf("CostBudget MonthlyLimitUSD must be greater than zero. Found: %d",
+			budget.MonthlyLimitUSD)
+	}
+	if budget.AnomalyThresholdUSD < 0 {
+		return errors.Errorf("CostBudget AnomalyThresholdUSD must not be negative. Found: %d",
+			budget.AnomalyThresholdUSD)
+	}
+	for _, eachNotification := range budget.Notifications {
+		if eachNotification.ThresholdPercent <= 0 {
+			return errors.Errorf("CostBudget notification ThresholdPercent must be greater than zero. Found: %d",
+				eachNotification.ThresholdPercent)
+		}
+	}
+	if budget.TopicArn != nil && len(budget.EmailAddresses) != 0 {
+		return errors.Errorf("CostBudget EmailAddresses are only supported for the decorator created topic")
+	}
+	return nil
+}
+
+// costAllocationTag returns the tag key and value expression
+func (budget *CostBudget) costAllocationTag() (string, *gocf.StringExpr) {
+	tagKey := budget.TagKey
+	if tagKey == "" {
+		tagKey = stackNameCostAllocationTag
+	}
+	tagValue := gocf.Ref("AWS::StackName").String()
+	if budget.TagValue != nil {
+		tagValue = budget.TagValue.String()
+	}
+	return tagKey, tagValue
+}
+
+// topicArn returns the notification topic, adding the topic to the
+// template if necessary. The notification resources depend on the
+// returned resource names.
+func (budget *CostBudget) topicArn(serviceName string, template *gocf.Template) (*gocf.StringExpr, []string) {
+	if budget.TopicArn != nil {
+		return budget.TopicArn.String(), nil
+	}
+	topicResourceName := sparta.CloudFormationResourceName("CostAlertTopic", serviceName)
+	topic := &gocf.SNSTopic{
+		DisplayName: gocf.String("Cost Alerts"),
+	}
+	if len(budget.EmailAddresses) != 0 {
+		subscriptions := gocf.SNSTopicSubscriptionList{}
+		for _, eachAddress := range budget.EmailAddresses {
+			subscriptions = append(subscriptions, gocf.SNSTopicSubscription{
+				Endpoint: gocf.String(eachAddress),
+				Protocol: gocf.String("email"),
+			})
+		}
+		topic.Subscription = &subscriptions
+	}
+	template.AddResource(topicResourceName, topic)
+	topicPolicyResourceName := sparta.CloudFormationResourceName("CostAlertTopicPolicy", serviceName)
+	template.AddResource(topicPolicyResourceName,
+		&gocf.SNSTopicPolicy{
+			Topics: gocf.StringList(gocf.Ref(topicResourceName)),
+			PolicyDocument: sparta.ArbitraryJSONObject{
+				"Version": "2012-10-17",
+				"Statement": []sparta.ArbitraryJSONObject{
+					{
+						"Sid":    "CostAlertPublish",
+						"Effect": "Allow",
+						"Principal": sparta.ArbitraryJSONObject{
+							"Service": []string{
+								"budgets.amazonaws.com",
+								"costalerts.amazonaws.com",
+							},
+						},
+						"Action":   "sns:Publish",
+						"Resource": gocf.Ref(topicResourceName),
+					},
+				},
+			},
+		})
+	template.Outputs[OutputCostAlertTopicArn] = &gocf.Output{
+		Description: "Cost alert SNS topic ARN",
+		Value:       gocf.Ref(topicResourceName),
+	}
+	return gocf.Ref(topicResourceName).String(), []string{topicPolicyResourceName}
+}
+
+// DecorateService adds the budget resources to the template. It satisfies
+// the sparta.ServiceDecoratorHookHandler interface.
+func (budget *CostBudget) DecorateService(context *sparta.WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	validateErr := budget.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	tagKey, tagValue := budget.costAllocationTag()
+	topicArn, dependsOn := budget.topicArn(serviceName, template)
+
+	// Budgets filter user-defined tags with the user: prefix
+	costFilterTagKey := tagKey
+	if !strings.HasPrefix(tagKey, "aws:") {
+		costFilterTagKey = fmt.Sprintf("user:%s", tagKey)
+	}
+	notifications := gocf.BudgetsBudgetNotificationWithSubscribersList{}
+	for _, eachNotification := range budget.Notifications {
+		notificationType := "ACTUAL"
+		if eachNotification.Forecasted {
+			notificationType = "FORECASTED"
+		}
+		notifications = append(notifications, gocf.BudgetsBudgetNotificationWithSubscribers{
+			Notification: &gocf.BudgetsBudgetNotification{
+				ComparisonOperator: gocf.String("GREATER_THAN"),
+				NotificationType:   gocf.String(notificationType),
+				Threshold:          gocf.Integer(eachNotification.ThresholdPercent),
+				ThresholdType:      gocf.String("PERCENTAGE"),
+			},
+			Subscribers: &gocf.BudgetsBudgetSubscriberList{
+				gocf.BudgetsBudgetSubscriber{
+					Address:          topicArn,
+					SubscriptionType: gocf.String("SNS"),
+				},
+			},
+		})
+	}
+	budgetResource := &gocf.BudgetsBudget{
+		Budget: &gocf.BudgetsBudgetBudgetData{
+			// Budget names are unique per account
+			BudgetName: gocf.Join("-",
+				gocf.Ref("AWS::StackName"),
+				gocf.Ref("AWS::Region")),
+			BudgetType: gocf.String("COST"),
+			TimeUnit:   gocf.String("MONTHLY"),
+			BudgetLimit: &gocf.BudgetsBudgetSpend{
+				Amount: gocf.Integer(budget.MonthlyLimitUSD),
+				Unit:   gocf.String("USD"),
+			},
+			CostFilters: map[string]interface{}{
+				"TagKeyValue": []*gocf.StringExpr{
+					gocf.Join("",
+						gocf.String(fmt.Sprintf("%s$", costFilterTagKey)),
+						tagValue),
+				},
+			},
+		},
+	}
+	if len(notifications) != 0 {
+		budgetResource.NotificationsWithSubscribers = &notifications
+	}
+	budgetCfResource := template.AddResource(sparta.CloudFormationResourceName("CostBudget", serviceName),
+		budgetResource)
+	budgetCfResource.DependsOn = dependsOn
+
+	if budget.AnomalyThresholdUSD != 0 {
+		tagKeyJSON, tagKeyJSONErr := json.Marshal(tagKey)
+		if tagKeyJSONErr != nil {
+			return errors.Wrapf(tagKeyJSONErr, "Failed to marshal cost allocation tag key")
+		}
+		monitorResourceName := sparta.CloudFormationResourceName("CostAnomalyMonitor", serviceName)
+		template.AddResource(monitorResourceName, &ceAnomalyMonitor{
+			MonitorName: gocf.Join("-",
+				gocf.Ref("AWS::StackName"),
+				gocf.Ref("AWS::Region")),
+			MonitorType: gocf.String("CUSTOM"),
+			MonitorSpecification: gocf.Join("",
+				gocf.String(fmt.Sprintf(`{"Tags":{"Key":%s,"Values":["`, string(tagKeyJSON))),
+				tagValue,
+				gocf.String(`"]}}`)),
+		})
+		subscriptionCfResource := template.AddResource(sparta.CloudFormationResourceName("CostAnomalySubscription", serviceName),
+			&ceAnomalySubscription{
+				SubscriptionName: gocf.Join("-",
+					gocf.Ref("AWS::StackName"),
+					gocf.Ref("AWS::Region")),
+				// SNS subscribers require immediate notifications
+				Frequency:      gocf.String("IMMEDIATE"),
+				MonitorArnList: gocf.StringList(gocf.Ref(monitorResourceName)),
+				Subscribers: []ceAnomalySubscriptionSubscriber{
+					{
+						Address: topicArn,
+						Type:    gocf.String("SNS"),
+					},
+				},
+				ThresholdExpression: gocf.String(fmt.Sprintf(`{"Dimensions":{"Key":"ANOMALY_TOTAL_IMPACT_ABSOLUTE","MatchOptions":["GREATER_THAN_OR_EQUAL"],"Values":["%d"]}}`,
+					budget.AnomalyThresholdUSD)),
+			})
+		subscriptionCfResource.DependsOn = dependsOn
+	}
+	logger.WithFields(logrus.Fields{
+		"MonthlyLimitUSD":     budget.MonthlyLimitUSD,
+		"TagKey":              tagKey,
+		"AnomalyThresholdUSD": budget.AnomalyThresholdUSD,
+	}).Debug("Created cost budget")
+	return nil
+}
+
+// Ensure compliance
+var _ sparta.ServiceDecoratorHookHandler = (*CostBudget)(nil)
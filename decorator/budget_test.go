@@ -0,0 +1,114 @@
+package decorator
+
+import (
+	"encoding/json"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestCostBudget(t *testing.T) {
+	budget := NewCostBudget(100, "team@example.com")
+	budget.AnomalyThresholdUSD = 25
+	harness := spartaTesting.NewDecoratorHarness(t)
+	decorateErr := harness.RunServiceDecorator(budget)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate service: %s", decorateErr)
+	}
+	// Topic, topic policy, budget, anomaly monitor and subscription
+	if len(harness.Template.Resources) != 5 {
+		t.Fatalf("Unexpected cost budget resources: %d", len(harness.Template.Resources))
+	}
+	harness.AssertOutput(t, OutputCostAlertTopicArn)
+	serviceName := harness.ServiceName
+	topicResourceName := sparta.CloudFormationResourceName("CostAlertTopic", serviceName)
+	topicProperties := harness.ResourceProperties(t, topicResourceName, "AWS::SNS::Topic")
+	spartaTesting.AssertTemplateValue(t, topicProperties, "email", "Subscription", 0, "Protocol")
+	spartaTesting.AssertTemplateValue(t, topicProperties, "team@example.com", "Subscription", 0, "Endpoint")
+	topicPolicyProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("CostAlertTopicPolicy", serviceName),
+		"AWS::SNS::TopicPolicy")
+	spartaTesting.AssertTemplateValue(t, topicPolicyProperties,
+		"budgets.amazonaws.com",
+		"PolicyDocument", "Statement", 0, "Principal", "Service", 0)
+
+	budgetProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("CostBudget", serviceName),
+		"AWS::Budgets::Budget")
+	spartaTesting.AssertTemplateValue(t, budgetProperties,
+		[]*gocf.StringExpr{gocf.Join("",
+			gocf.String("aws:cloudformation:stack-name$"),
+			gocf.Ref("AWS::StackName"))},
+		"Budget", "CostFilters", "TagKeyValue")
+	spartaTesting.AssertTemplateValue(t, budgetProperties,
+		"FORECASTED",
+		"NotificationsWithSubscribers", 2, "Notification", "NotificationType")
+	spartaTesting.AssertTemplateValue(t, budgetProperties,
+		gocf.Ref(topicResourceName),
+		"NotificationsWithSubscribers", 0, "Subscribers", 0, "Address")
+
+	monitorProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("CostAnomalyMonitor", serviceName),
+		"AWS::CE::AnomalyMonitor")
+	spartaTesting.AssertTemplateValue(t, monitorProperties,
+		gocf.Join("",
+			gocf.String(`{"Tags":{"Key":"aws:cloudformation:stack-name","Values":["`),
+			gocf.Ref("AWS::StackName"),
+			gocf.String(`"]}}`)),
+		"MonitorSpecification")
+	subscriptionProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("CostAnomalySubscription", serviceName),
+		"AWS::CE::AnomalySubscription")
+	thresholdExpression, _ := spartaTesting.TemplateValue(subscriptionProperties,
+		"ThresholdExpression").(string)
+	var threshold interface{}
+	unmarshalErr := json.Unmarshal([]byte(thresholdExpression), &threshold)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to decode ThresholdExpression: %s", unmarshalErr)
+	}
+	spartaTesting.AssertTemplateValue(t, threshold, []string{"25"}, "Dimensions", "Values")
+
+	// User-defined tags and existing topics
+	budget = NewCostBudget(100)
+	budget.TagKey = "team"
+	budget.TagValue = gocf.String("orders")
+	budget.TopicArn = gocf.String("arn:aws:sns:us-west-2:000000000000:alerts")
+	harness = spartaTesting.NewDecoratorHarness(t)
+	decorateErr = harness.RunServiceDecorator(budget)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate service: %s", decorateErr)
+	}
+	if len(harness.Template.Resources) != 1 {
+		t.Fatalf("Unexpected user tag cost budget resources: %d", len(harness.Template.Resources))
+	}
+	budgetProperties = harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("CostBudget", serviceName),
+		"AWS::Budgets::Budget")
+	spartaTesting.AssertTemplateValue(t, budgetProperties,
+		[]*gocf.StringExpr{gocf.Join("",
+			gocf.String("user:team$"),
+			gocf.String("orders"))},
+		"Budget", "CostFilters", "TagKeyValue")
+	spartaTesting.AssertTemplateValue(t, budgetProperties,
+		"arn:aws:sns:us-west-2:000000000000:alerts",
+		"NotificationsWithSubscribers", 0, "Subscribers", 0, "Address")
+}
+
+func TestInvalidCostBudget(t *testing.T) {
+	invalidBudgets := []*CostBudget{
+		NewCostBudget(0),
+		{MonthlyLimitUSD: 10, AnomalyThresholdUSD: -1},
+		{MonthlyLimitUSD: 10, Notifications: []*BudgetNotification{{}}},
+		{MonthlyLimitUSD: 10,
+			TopicArn:       gocf.String("arn:aws:sns:us-west-2:000000000000:alerts"),
+			EmailAddresses: []string{"team@example.com"}},
+	}
+	for _, eachBudget := range invalidBudgets {
+		decorateErr := spartaTesting.NewDecoratorHarness(t).RunServiceDecorator(eachBudget)
+		if decorateErr == nil {
+			t.Fatalf("Failed to reject invalid CostBudget: %#v", eachBudget)
+		}
+	}
+}
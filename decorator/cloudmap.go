@@ -56,7 +56,7 @@ func (cmsd *CloudMapServiceDecorator) LogicalResourceName() string {
 }
 
 // DecorateService satisfies the ServiceDecoratorHookHandler interface
-func (cmsd *CloudMapServiceDecorator) DecorateService(context map[string]interface{},
+func (cmsd *CloudMapServiceDecorator) DecorateService(context *sparta.WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -0,0 +1,112 @@
+package decorator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CrossStackExportSource is where a CrossStackExport value is published
+type CrossStackExportSource string
+
+const (
+	// CrossStackExportCloudFormation publishes the value as a
+	// CloudFormation stack output export
+	// @enum CrossStackExportSource
+	CrossStackExportCloudFormation CrossStackExportSource = "cloudformation"
+	// CrossStackExportSSM publishes the value as an SSM Parameter Store
+	// String parameter
+	// @enum CrossStackExportSource
+	CrossStackExportSSM CrossStackExportSource = "ssm"
+)
+
+// CrossStackExport is a value that a service publishes so that other
+// Sparta services can resolve it with sparta.DiscoveryInfo.CrossStackResource
+type CrossStackExport struct {
+	// Value is the published value (eg, gocf.Ref(queueResourceName))
+	Value gocf.Stringable
+	// Description is the optional export description
+	Description string
+	// Sources are where the value is published. Defaults to
+	// CrossStackExportCloudFormation.
+	Sources []CrossStackExportSource
+}
+
+// CrossStackExportDecorator returns a ServiceDecoratorHookHandler that
+// publishes each export, keyed by name, as a CloudFormation export named
+// sparta.CrossStackExportName and/or an SSM parameter named
+// sparta.CrossStackParameterName. Names must be alphanumeric.
+func CrossStackExportDecorator(exports map[string]*CrossStackExport) sparta.ServiceDecoratorHookHandler {
+	exportDecorator := func(context *sparta.WorkflowHookContext,
+		serviceName string,
+		template *gocf.Template,
+		S3Bucket string,
+		S3Key string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+
+		// Stable template ordering
+		exportNames := make([]string, 0, len(exports))
+		for eachName := range exports {
+			exportNames = append(exportNames, eachName)
+		}
+		sort.Strings(exportNames)
+
+		for _, eachName := range exportNames {
+			eachExport := exports[eachName]
+			if eachName == "" || sanitizedKeyName(eachName) != eachName {
+				return errors.Errorf("CrossStackExport name must be alphanumeric. Found: %s", eachName)
+			}
+			if eachExport == nil || eachExport.Value == nil {
+				return errors.Errorf("CrossStackExport %s must define a Value", eachName)
+			}
+			description := eachExport.Description
+			if description == "" {
+				description = fmt.Sprintf("%s %s cross stack export", serviceName, eachName)
+			}
+			sources := eachExport.Sources
+			if len(sources) == 0 {
+				sources = []CrossStackExportSource{CrossStackExportCloudFormation}
+			}
+			for _, eachSource := range sources {
+				switch eachSource {
+				case CrossStackExportCloudFormation:
+					template.Outputs[fmt.Sprintf("CrossStack%s", eachName)] = &gocf.Output{
+						Description: description,
+						Value:       eachExport.Value.String(),
+						Export: &gocf.OutputExport{
+							Name: gocf.String(sparta.CrossStackExportName(serviceName, eachName)),
+						},
+					}
+				case CrossStackExportSSM:
+					parameterResourceName := sparta.CloudFormationResourceName("CrossStackParameter",
+						serviceName,
+						eachName)
+					template.AddResource(parameterResourceName, &gocf.SSMParameter{
+						Name:        gocf.String(sparta.CrossStackParameterName(serviceName, eachName)),
+						Description: gocf.String(description),
+						Type:        gocf.String("String"),
+						Value:       eachExport.Value.String(),
+					})
+				default:
+					return errors.Errorf("CrossStackExport %s has an unsupported source: %s",
+						eachName,
+						eachSource)
+				}
+			}
+			logger.WithFields(logrus.Fields{
+				"Name":    eachName,
+				"Sources": sources,
+			}).Debug("Publishing cross stack export")
+		}
+		return nil
+	}
+	return sparta.ServiceDecoratorHookFunc(exportDecorator)
+}
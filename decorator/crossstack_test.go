@@ -0,0 +1,68 @@
+package decorator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestCrossStackExportDecorator(t *testing.T) {
+	logger, _ := sparta.NewLogger("info")
+	exportDecorator := CrossStackExportDecorator(map[string]*CrossStackExport{
+		"OrdersQueueURL": {
+			Value:   gocf.Ref("OrdersQueue"),
+			Sources: []CrossStackExportSource{CrossStackExportCloudFormation, CrossStackExportSSM},
+		},
+		"OrdersTable": {
+			Value: gocf.Ref("OrdersTable"),
+		},
+	})
+	template := gocf.NewTemplate()
+	decorateErr := exportDecorator.DecorateService(sparta.NewWorkflowHookContext(nil),
+		"OrdersService",
+		template,
+		"",
+		"",
+		"",
+		nil,
+		false,
+		logger)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate service: %s", decorateErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{`"Name":"OrdersService-OrdersQueueURL"`,
+		`"Name":"OrdersService-OrdersTable"`,
+		"AWS::SSM::Parameter",
+		"/sparta/OrdersService/OrdersQueueURL"} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in template: %s", eachExpected, string(templateJSON))
+		}
+	}
+	if strings.Contains(string(templateJSON), "/sparta/OrdersService/OrdersTable") {
+		t.Fatalf("Unexpected SSM parameter for OrdersTable: %s", string(templateJSON))
+	}
+
+	invalidExports := []map[string]*CrossStackExport{
+		{"Orders-Queue": {Value: gocf.Ref("OrdersQueue")}},
+		{"OrdersQueue": {}},
+		{"OrdersQueue": {Value: gocf.Ref("OrdersQueue"), Sources: []CrossStackExportSource{"s3"}}},
+	}
+	for _, eachExports := range invalidExports {
+		decorateErr := CrossStackExportDecorator(eachExports).DecorateService(sparta.NewWorkflowHookContext(nil),
+			"OrdersService",
+			gocf.NewTemplate(),
+			"",
+			"",
+			"",
+			nil,
+			false,
+			logger)
+		if decorateErr == nil {
+			t.Fatalf("Failed to reject invalid exports: %#v", eachExports)
+		}
+	}
+}
@@ -129,7 +129,7 @@ var templateFuncMap = template.FuncMap{
 // can be attached the workflow to create a dashboard
 func DashboardDecorator(lambdaAWSInfo []*sparta.LambdaAWSInfo,
 	timeSeriesPeriod int) sparta.ServiceDecoratorHookFunc {
-	return func(context map[string]interface{},
+	return func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		cfTemplate *gocf.Template,
 		S3Bucket string,
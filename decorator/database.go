@@ -0,0 +1,774 @@
+package decorator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// envVarDatabaseEndpointFormat is the environment variable that stores
+	// the endpoint of a connected database
+	envVarDatabaseEndpointFormat = "SPARTA_DATABASE_%s_ENDPOINT"
+	// envVarDatabasePortFormat is the environment variable that stores the
+	// port of a connected database
+	envVarDatabasePortFormat = "SPARTA_DATABASE_%s_PORT"
+	// envVarDatabaseTLSFormat is the environment variable that is true if
+	// connections to the database require TLS
+	envVarDatabaseTLSFormat = "SPARTA_DATABASE_%s_TLS"
+	// envVarDatabaseSecretFormat is the environment variable that stores
+	// the LambdaFunctionOptions.Secrets name of the database credentials
+	envVarDatabaseSecretFormat = "SPARTA_DATABASE_%s_SECRET"
+	// secretDatabaseCredentialsFormat is the LambdaFunctionOptions.Secrets
+	// name of the database credentials
+	secretDatabaseCredentialsFormat = "DATABASE_%s_CREDENTIALS"
+)
+
+var reDatabaseName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// databaseEnvName returns the environment name component for the database
+func databaseEnvName(name string) string {
+	return strings.ToUpper(name)
+}
+
+// DatabaseNetwork is the VPC placement shared by the functions that connect
+// to a database and the resources that the database decorators create
+type DatabaseNetwork struct {
+	// VpcID is the VPC of the subnets. It's required to create the
+	// security groups.
+	VpcID gocf.Stringable
+	// SubnetIDs are the private subnets for the functions and the created
+	// resources (Required)
+	SubnetIDs []gocf.Stringable
+	// ClientSecurityGroupIDs are the existing security groups that are
+	// allowed to connect to the database. If empty, the decorator creates
+	// a client security group. Required to connect to an existing database.
+	ClientSecurityGroupIDs []gocf.Stringable
+}
+
+func (network *DatabaseNetwork) validate(decoratorName string, existing bool) error {
+	if network == nil || len(network.SubnetIDs) == 0 {
+		return errors.Errorf("%s Network must define SubnetIDs", decoratorName)
+	}
+	if existing && len(network.ClientSecurityGroupIDs) == 0 {
+		return errors.Errorf("%s Network must define ClientSecurityGroupIDs to connect to an existing database",
+			decoratorName)
+	}
+	if !existing && network.VpcID == nil {
+		return errors.Errorf("%s Network must define VpcID to create the database security groups",
+			decoratorName)
+	}
+	return nil
+}
+
+// clientSecurityGroupIDs returns the security groups applied to the
+// connected functions
+func (network *DatabaseNetwork) clientSecurityGroupIDs(clientResourceName string) []gocf.Stringable {
+	if len(network.ClientSecurityGroupIDs) != 0 {
+		return network.ClientSecurityGroupIDs
+	}
+	return []gocf.Stringable{gocf.Ref(clientResourceName)}
+}
+
+// exportSecurityGroups adds the client security group, if necessary, and the
+// database security group that allows connections from the clients on the
+// port. It returns the database security group ID.
+func (network *DatabaseNetwork) exportSecurityGroups(clientResourceName string,
+	databaseResourceName string,
+	description string,
+	port int64,
+	template *gocf.Template) *gocf.StringExpr {
+	if len(network.ClientSecurityGroupIDs) == 0 {
+		template.AddResource(clientResourceName, &gocf.EC2SecurityGroup{
+			GroupDescription: gocf.String(fmt.Sprintf("%s clients", description)),
+			VPCID:            network.VpcID.String(),
+		})
+	}
+	ingressRules := gocf.EC2SecurityGroupIngressPropertyList{}
+	for _, eachClientGroup := range network.clientSecurityGroupIDs(clientResourceName) {
+		ingressRules = append(ingressRules, gocf.EC2SecurityGroupIngressProperty{
+			Description:           gocf.String(fmt.Sprintf("%s clients", description)),
+			IPProtocol:            gocf.String("tcp"),
+			FromPort:              gocf.Integer(port),
+			ToPort:                gocf.Integer(port),
+			SourceSecurityGroupID: eachClientGroup.String(),
+		})
+	}
+	template.AddResource(databaseResourceName, &gocf.EC2SecurityGroup{
+		GroupDescription:     gocf.String(description),
+		VPCID:                network.VpcID.String(),
+		SecurityGroupIngress: &ingressRules,
+	})
+	return gocf.GetAtt(databaseResourceName, "GroupId")
+}
+
+// databaseConnection is the connection information that a database
+// decorator injects into the connected functions
+type databaseConnection struct {
+	name            string
+	network         *DatabaseNetwork
+	clientGroupName string
+	endpoint        *gocf.StringExpr
+	port            *gocf.StringExpr
+	tls             bool
+	credentials     *sparta.SecretReference
+}
+
+// connectLambda places the function in the database network and injects
+// the connection environment variables and credentials secret. The
+// function's options may be shared with other functions, so they're
+// copied before they're updated.
+func (conn *databaseConnection) connectLambda(lambdaInfo *sparta.LambdaAWSInfo) error {
+	lambdaOptions := sparta.LambdaFunctionOptions{}
+	if lambdaInfo.Options != nil {
+		lambdaOptions = *lambdaInfo.Options
+	}
+	if lambdaOptions.VpcConfig != nil {
+		return errors.Errorf("Lambda function %s must use VPCDiscovery rather than VpcConfig to connect to database %s",
+			lambdaInfo.LogicalResourceName(),
+			conn.name)
+	}
+	clientGroups := conn.network.clientSecurityGroupIDs(conn.clientGroupName)
+	if lambdaOptions.VPCDiscovery == nil {
+		lambdaOptions.VPCDiscovery = &sparta.VPCConfig{
+			SubnetIDs: append([]gocf.Stringable{}, conn.network.SubnetIDs...),
+		}
+	} else {
+		vpcConfig := *lambdaOptions.VPCDiscovery
+		vpcConfig.SecurityGroupIDs = append([]gocf.Stringable{}, vpcConfig.SecurityGroupIDs...)
+		lambdaOptions.VPCDiscovery = &vpcConfig
+	}
+	lambdaOptions.VPCDiscovery.SecurityGroupIDs = append(lambdaOptions.VPCDiscovery.SecurityGroupIDs,
+		clientGroups...)
+
+	environment := make(map[string]*gocf.StringExpr, len(lambdaOptions.Environment)+4)
+	for eachKey, eachValue := range lambdaOptions.Environment {
+		environment[eachKey] = eachValue
+	}
+	lambdaOptions.Environment = environment
+	envName := databaseEnvName(conn.name)
+	lambdaOptions.Environment[fmt.Sprintf(envVarDatabaseEndpointFormat, envName)] = conn.endpoint
+	lambdaOptions.Environment[fmt.Sprintf(envVarDatabasePortFormat, envName)] = conn.port
+	lambdaOptions.Environment[fmt.Sprintf(envVarDatabaseTLSFormat, envName)] = gocf.String(strconv.FormatBool(conn.tls))
+
+	if conn.credentials != nil {
+		secretName := fmt.Sprintf(secretDatabaseCredentialsFormat, envName)
+		if _, exists := lambdaOptions.Secrets[secretName]; exists {
+			return errors.Errorf("Lambda function %s already defines Secret %s",
+				lambdaInfo.LogicalResourceName(),
+				secretName)
+		}
+		secrets := make(map[string]*sparta.SecretReference, len(lambdaOptions.Secrets)+1)
+		for eachKey, eachValue := range lambdaOptions.Secrets {
+			secrets[eachKey] = eachValue
+		}
+		secrets[secretName] = conn.credentials
+		lambdaOptions.Secrets = secrets
+		lambdaOptions.Environment[fmt.Sprintf(envVarDatabaseSecretFormat, envName)] = gocf.String(secretName)
+	}
+	lambdaInfo.Options = &lambdaOptions
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::RDS::DBProxy
+
+// rdsDBProxyAuth represents the AWS::RDS::DBProxy.AuthFormat property type
+type rdsDBProxyAuth struct {
+	AuthScheme *gocf.StringExpr `json:"AuthScheme,omitempty"`
+	IAMAuth    *gocf.StringExpr `json:"IAMAuth,omitempty"`
+	SecretArn  *gocf.StringExpr `json:"SecretArn,omitempty"`
+}
+
+// rdsDBProxy represents the AWS::RDS::DBProxy resource, which isn't
+// included in the go-cloudformation schema
+type rdsDBProxy struct {
+	Auth                []rdsDBProxyAuth     `json:"Auth,omitempty"`
+	DBProxyName         *gocf.StringExpr     `json:"DBProxyName,omitempty"`
+	EngineFamily        *gocf.StringExpr     `json:"EngineFamily,omitempty"`
+	RequireTLS          *gocf.BoolExpr       `json:"RequireTLS,omitempty"`
+	RoleArn             *gocf.StringExpr     `json:"RoleArn,omitempty"`
+	VpcSecurityGroupIds *gocf.StringListExpr `json:"VpcSecurityGroupIds,omitempty"`
+	VpcSubnetIds        *gocf.StringListExpr `json:"VpcSubnetIds,omitempty"`
+}
+
+// CfnResourceType returns AWS::RDS::DBProxy to implement the ResourceProperties interface
+func (s rdsDBProxy) CfnResourceType() string {
+	return "AWS::RDS::DBProxy"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s rdsDBProxy) CfnResourceAttributes() []string {
+	return []string{"DBProxyArn", "Endpoint", "VpcId"}
+}
+
+// END - AWS::RDS::DBProxy
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AWS::RDS::DBProxyTargetGroup
+
+// rdsDBProxyTargetGroup represents the AWS::RDS::DBProxyTargetGroup
+// resource, which isn't included in the go-cloudformation schema
+type rdsDBProxyTargetGroup struct {
+	DBClusterIdentifiers  *gocf.StringListExpr `json:"DBClusterIdentifiers,omitempty"`
+	DBInstanceIdentifiers *gocf.StringListExpr `json:"DBInstanceIdentifiers,omitempty"`
+	DBProxyName           *gocf.StringExpr     `json:"DBProxyName,omitempty"`
+	TargetGroupName       *gocf.StringExpr     `json:"TargetGroupName,omitempty"`
+}
+
+// CfnResourceType returns AWS::RDS::DBProxyTargetGroup to implement the ResourceProperties interface
+func (s rdsDBProxyTargetGroup) CfnResourceType() string {
+	return "AWS::RDS::DBProxyTargetGroup"
+}
+
+// CfnResourceAttributes returns the attributes produced by this resource
+func (s rdsDBProxyTargetGroup) CfnResourceAttributes() []string {
+	return []string{"TargetGroupArn"}
+}
+
+// END - AWS::RDS::DBProxyTargetGroup
+////////////////////////////////////////////////////////////////////////////////
+
+// rdsProxyEnginePorts are the default ports of the RDS Proxy engine families
+var rdsProxyEnginePorts = map[string]int64{
+	"MYSQL":      3306,
+	"POSTGRESQL": 5432,
+}
+
+// RDSProxyDecorator is a ServiceDecoratorHookHandler that connects lambda
+// functions to a relational database through an RDS Proxy. The decorator
+// creates a proxy for the DBInstanceIdentifier or DBClusterIdentifier, or
+// references the existing ProxyEndpoint. Use ConnectLambda to place each
+// function in the Network, grant it access to the credentials secret and
+// inject the proxy endpoint. At runtime, use DiscoverDatabase to get the
+// connection information.
+type RDSProxyDecorator struct {
+	// Name is the alphanumeric name of the database connection (Required)
+	Name string
+	// Network is the VPC placement of the functions and proxy (Required)
+	Network *DatabaseNetwork
+	// SecretArn is the Secrets Manager secret that stores the database
+	// username and password keys (Required)
+	SecretArn gocf.Stringable
+	// SecretKmsKeyArn is the optional customer managed KMS key that
+	// encrypts the secret
+	SecretKmsKeyArn gocf.Stringable
+	// EngineFamily is the proxy engine family: MYSQL or POSTGRESQL
+	EngineFamily string
+	// Port is the database port. Defaults to the EngineFamily port.
+	Port int64
+	// ProxyEndpoint is the endpoint of an existing proxy. Mutually
+	// exclusive with DBInstanceIdentifier and DBClusterIdentifier.
+	ProxyEndpoint gocf.Stringable
+	// DBInstanceIdentifier is the RDS instance that the created proxy
+	// connects to
+	DBInstanceIdentifier gocf.Stringable
+	// DBClusterIdentifier is the Aurora cluster that the created proxy
+	// connects to
+	DBClusterIdentifier gocf.Stringable
+	// DatabaseSecurityGroupID is the optional security group of the
+	// instance or cluster. The decorator allows connections to it from
+	// the created proxy.
+	DatabaseSecurityGroupID gocf.Stringable
+	// RequireTLS requires TLS connections to the created proxy
+	RequireTLS bool
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the created proxy
+func (proxy *RDSProxyDecorator) LogicalResourceName() string {
+	return sparta.CloudFormationResourceName("RDSProxy", proxy.Name)
+}
+
+func (proxy *RDSProxyDecorator) clientSecurityGroupName() string {
+	return sparta.CloudFormationResourceName("RDSProxyClientSecurityGroup", proxy.Name)
+}
+
+func (proxy *RDSProxyDecorator) port() int64 {
+	if proxy.Port != 0 {
+		return proxy.Port
+	}
+	return rdsProxyEnginePorts[proxy.EngineFamily]
+}
+
+func (proxy *RDSProxyDecorator) validate() error {
+	if !reDatabaseName.MatchString(proxy.Name) {
+		return errors.Errorf("RDSProxyDecorator Name must match %s. Found: %s",
+			reDatabaseName.String(),
+			proxy.Name)
+	}
+	existing := proxy.ProxyEndpoint != nil
+	if networkErr := proxy.Network.validate("RDSProxyDecorator", existing); networkErr != nil {
+		return networkErr
+	}
+	if proxy.SecretArn == nil {
+		return errors.Errorf("RDSProxyDecorator %s must define SecretArn", proxy.Name)
+	}
+	if proxy.EngineFamily != "" {
+		if _, validFamily := rdsProxyEnginePorts[proxy.EngineFamily]; !validFamily {
+			return errors.Errorf("RDSProxyDecorator %s EngineFamily must be one of MYSQL or POSTGRESQL. Found: %s",
+				proxy.Name,
+				proxy.EngineFamily)
+		}
+	}
+	if proxy.port() <= 0 {
+		return errors.Errorf("RDSProxyDecorator %s must define either EngineFamily or Port", proxy.Name)
+	}
+	targetCount := 0
+	for _, eachTarget := range []gocf.Stringable{proxy.ProxyEndpoint,
+		proxy.DBInstanceIdentifier,
+		proxy.DBClusterIdentifier} {
+		if eachTarget != nil {
+			targetCount++
+		}
+	}
+	if targetCount != 1 {
+		return errors.Errorf("RDSProxyDecorator %s must define exactly one of ProxyEndpoint, DBInstanceIdentifier or DBClusterIdentifier",
+			proxy.Name)
+	}
+	if !existing && proxy.EngineFamily == "" {
+		return errors.Errorf("RDSProxyDecorator %s must define EngineFamily to create a proxy", proxy.Name)
+	}
+	if existing && (proxy.DatabaseSecurityGroupID != nil || proxy.RequireTLS) {
+		return errors.Errorf("RDSProxyDecorator %s DatabaseSecurityGroupID and RequireTLS are only supported for created proxies",
+			proxy.Name)
+	}
+	return nil
+}
+
+func (proxy *RDSProxyDecorator) connection() *databaseConnection {
+	endpoint := gocf.GetAtt(proxy.LogicalResourceName(), "Endpoint")
+	if proxy.ProxyEndpoint != nil {
+		endpoint = proxy.ProxyEndpoint.String()
+	}
+	return &databaseConnection{
+		name:            proxy.Name,
+		network:         proxy.Network,
+		clientGroupName: proxy.clientSecurityGroupName(),
+		endpoint:        endpoint,
+		port:            gocf.String(strconv.FormatInt(proxy.port(), 10)),
+		tls:             proxy.RequireTLS,
+		credentials: &sparta.SecretReference{
+			Source:    sparta.SecretSourceSecretsManager,
+			ID:        proxy.SecretArn,
+			KmsKeyArn: proxy.SecretKmsKeyArn,
+		},
+	}
+}
+
+// ConnectLambda places the function in the Network, grants it access to the
+// credentials secret and injects the proxy connection information
+func (proxy *RDSProxyDecorator) ConnectLambda(lambdaInfo *sparta.LambdaAWSInfo) error {
+	if validateErr := proxy.validate(); validateErr != nil {
+		return validateErr
+	}
+	return proxy.connection().connectLambda(lambdaInfo)
+}
+
+// proxyRole returns the role that the proxy assumes to read the
+// credentials secret
+func (proxy *RDSProxyDecorator) proxyRole() *gocf.IAMRole {
+	statements := []spartaIAM.PolicyStatement{
+		{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: proxy.SecretArn.String(),
+		},
+	}
+	if proxy.SecretKmsKeyArn != nil {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"kms:Decrypt"},
+			Resource: proxy.SecretKmsKeyArn.String(),
+			Condition: sparta.ArbitraryJSONObject{
+				"StringEquals": sparta.ArbitraryJSONObject{
+					"kms:ViaService": gocf.Join("",
+						gocf.String("secretsmanager."),
+						gocf.Ref("AWS::Region"),
+						gocf.String(".amazonaws.com")),
+				},
+			},
+		})
+	}
+	return &gocf.IAMRole{
+		AssumeRolePolicyDocument: sparta.ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []sparta.ArbitraryJSONObject{
+				{
+					"Effect": "Allow",
+					"Principal": sparta.ArbitraryJSONObject{
+						"Service": []string{"rds.amazonaws.com"},
+					},
+					"Action": []string{"sts:AssumeRole"},
+				},
+			},
+		},
+		Policies: &gocf.IAMRolePolicyList{
+			gocf.IAMRolePolicy{
+				PolicyDocument: sparta.ArbitraryJSONObject{
+					"Version":   "2012-10-17",
+					"Statement": statements,
+				},
+				PolicyName: gocf.String("RDSProxySecretPolicy"),
+			},
+		},
+	}
+}
+
+// DecorateService adds the proxy resources to the template. It satisfies
+// the sparta.ServiceDecoratorHookHandler interface.
+func (proxy *RDSProxyDecorator) DecorateService(context *sparta.WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	validateErr := proxy.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	if proxy.ProxyEndpoint != nil {
+		logger.WithFields(logrus.Fields{
+			"Name": proxy.Name,
+		}).Debug("Using existing RDS Proxy")
+		return nil
+	}
+	proxyResourceName := proxy.LogicalResourceName()
+	proxySecurityGroupResourceName := sparta.CloudFormationResourceName("RDSProxySecurityGroup",
+		proxy.Name)
+	proxySecurityGroupID := proxy.Network.exportSecurityGroups(proxy.clientSecurityGroupName(),
+		proxySecurityGroupResourceName,
+		fmt.Sprintf("RDS Proxy %s", proxy.Name),
+		proxy.port(),
+		template)
+
+	proxyRoleResourceName := sparta.CloudFormationResourceName("RDSProxyRole", proxy.Name)
+	template.AddResource(proxyRoleResourceName, proxy.proxyRole())
+
+	subnetIDs := make([]gocf.Stringable, 0, len(proxy.Network.SubnetIDs))
+	subnetIDs = append(subnetIDs, proxy.Network.SubnetIDs...)
+	template.AddResource(proxyResourceName, &rdsDBProxy{
+		Auth: []rdsDBProxyAuth{
+			{
+				AuthScheme: gocf.String("SECRETS"),
+				IAMAuth:    gocf.String("DISABLED"),
+				SecretArn:  proxy.SecretArn.String(),
+			},
+		},
+		DBProxyName: gocf.Join("-",
+			gocf.Ref("AWS::StackName"),
+			gocf.String(strings.ToLower(proxy.Name))),
+		EngineFamily:        gocf.String(proxy.EngineFamily),
+		RequireTLS:          gocf.Bool(proxy.RequireTLS),
+		RoleArn:             gocf.GetAtt(proxyRoleResourceName, "Arn"),
+		VpcSecurityGroupIds: gocf.StringList(proxySecurityGroupID),
+		VpcSubnetIds:        gocf.StringList(subnetIDs...),
+	})
+
+	targetGroup := &rdsDBProxyTargetGroup{
+		DBProxyName:     gocf.Ref(proxyResourceName).String(),
+		TargetGroupName: gocf.String("default"),
+	}
+	if proxy.DBInstanceIdentifier != nil {
+		targetGroup.DBInstanceIdentifiers = gocf.StringList(proxy.DBInstanceIdentifier)
+	} else {
+		targetGroup.DBClusterIdentifiers = gocf.StringList(proxy.DBClusterIdentifier)
+	}
+	template.AddResource(sparta.CloudFormationResourceName("RDSProxyTargetGroup", proxy.Name),
+		targetGroup)
+
+	if proxy.DatabaseSecurityGroupID != nil {
+		template.AddResource(sparta.CloudFormationResourceName("RDSProxyDatabaseIngress", proxy.Name),
+			&gocf.EC2SecurityGroupIngress{
+				Description:           gocf.String(fmt.Sprintf("RDS Proxy %s", proxy.Name)),
+				GroupID:               proxy.DatabaseSecurityGroupID.String(),
+				IPProtocol:            gocf.String("tcp"),
+				FromPort:              gocf.Integer(proxy.port()),
+				ToPort:                gocf.Integer(proxy.port()),
+				SourceSecurityGroupID: proxySecurityGroupID,
+			})
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - ElastiCacheDecorator
+
+// elastiCacheRedisPort is the default Redis port
+const elastiCacheRedisPort = 6379
+
+// ElastiCacheDecorator is a ServiceDecoratorHookHandler that connects
+// lambda functions to an ElastiCache for Redis replication group. The
+// decorator creates an encrypted replication group, or references the
+// existing Endpoint. Use ConnectLambda to place each function in the
+// Network, grant it access to the optional AUTH token secret and inject the
+// primary endpoint. At runtime, use DiscoverDatabase to get the connection
+// information.
+type ElastiCacheDecorator struct {
+	// Name is the alphanumeric name of the cache connection (Required)
+	Name string
+	// Network is the VPC placement of the functions and cache (Required)
+	Network *DatabaseNetwork
+	// Endpoint is the primary endpoint address of an existing replication
+	// group
+	Endpoint gocf.Stringable
+	// Port is the cache port. Defaults to 6379.
+	Port int64
+	// AuthTokenSecretArn is the optional Secrets Manager secret that
+	// stores the Redis AUTH token. The secret must be a literal name or
+	// ARN for created replication groups, which resolve the token with a
+	// CloudFormation dynamic reference.
+	AuthTokenSecretArn gocf.Stringable
+	// AuthTokenJSONKey optionally selects the AUTH token key from a secret
+	// whose value is a JSON object
+	AuthTokenJSONKey string
+	// TLS is true if the existing replication group requires TLS.
+	// Created replication groups always enable transit encryption.
+	TLS bool
+	// CacheNodeType is the node type of the created replication group.
+	// Defaults to cache.t3.micro.
+	CacheNodeType string
+	// EngineVersion is the optional Redis version of the created
+	// replication group
+	EngineVersion string
+	// NumCacheClusters is the number of nodes in the created replication
+	// group. Defaults to 1. Automatic failover is enabled for more than
+	// one node.
+	NumCacheClusters int64
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the created replication group
+func (cache *ElastiCacheDecorator) LogicalResourceName() string {
+	return sparta.CloudFormationResourceName("ElastiCache", cache.Name)
+}
+
+func (cache *ElastiCacheDecorator) clientSecurityGroupName() string {
+	return sparta.CloudFormationResourceName("ElastiCacheClientSecurityGroup", cache.Name)
+}
+
+func (cache *ElastiCacheDecorator) port() int64 {
+	if cache.Port != 0 {
+		return cache.Port
+	}
+	return elastiCacheRedisPort
+}
+
+func (cache *ElastiCacheDecorator) validate() error {
+	if !reDatabaseName.MatchString(cache.Name) {
+		return errors.Errorf("ElastiCacheDecorator Name must match %s. Found: %s",
+			reDatabaseName.String(),
+			cache.Name)
+	}
+	existing := cache.Endpoint != nil
+	if networkErr := cache.Network.validate("ElastiCacheDecorator", existing); networkErr != nil {
+		return networkErr
+	}
+	if cache.Port < 0 || cache.NumCacheClusters < 0 {
+		return errors.Errorf("ElastiCacheDecorator %s Port and NumCacheClusters must not be negative",
+			cache.Name)
+	}
+	if cache.AuthTokenJSONKey != "" && cache.AuthTokenSecretArn == nil {
+		return errors.Errorf("ElastiCacheDecorator %s AuthTokenJSONKey requires AuthTokenSecretArn",
+			cache.Name)
+	}
+	if existing {
+		if cache.CacheNodeType != "" ||
+			cache.EngineVersion != "" ||
+			cache.NumCacheClusters != 0 {
+			return errors.Errorf("ElastiCacheDecorator %s CacheNodeType, EngineVersion and NumCacheClusters are only supported for created replication groups",
+				cache.Name)
+		}
+		return nil
+	}
+	if cache.AuthTokenSecretArn != nil &&
+		cache.AuthTokenSecretArn.String().Func != nil {
+		return errors.Errorf("ElastiCacheDecorator %s AuthTokenSecretArn must be a literal value to create a replication group",
+			cache.Name)
+	}
+	return nil
+}
+
+func (cache *ElastiCacheDecorator) connection() *databaseConnection {
+	conn := &databaseConnection{
+		name:            cache.Name,
+		network:         cache.Network,
+		clientGroupName: cache.clientSecurityGroupName(),
+		tls:             true,
+	}
+	if cache.Endpoint != nil {
+		conn.endpoint = cache.Endpoint.String()
+		conn.port = gocf.String(strconv.FormatInt(cache.port(), 10))
+		conn.tls = cache.TLS
+	} else {
+		conn.endpoint = gocf.GetAtt(cache.LogicalResourceName(), "PrimaryEndPoint.Address")
+		conn.port = gocf.GetAtt(cache.LogicalResourceName(), "PrimaryEndPoint.Port")
+	}
+	if cache.AuthTokenSecretArn != nil {
+		conn.credentials = &sparta.SecretReference{
+			Source:  sparta.SecretSourceSecretsManager,
+			ID:      cache.AuthTokenSecretArn,
+			JSONKey: cache.AuthTokenJSONKey,
+		}
+	}
+	return conn
+}
+
+// ConnectLambda places the function in the Network, grants it access to the
+// AUTH token secret and injects the cache connection information
+func (cache *ElastiCacheDecorator) ConnectLambda(lambdaInfo *sparta.LambdaAWSInfo) error {
+	if validateErr := cache.validate(); validateErr != nil {
+		return validateErr
+	}
+	return cache.connection().connectLambda(lambdaInfo)
+}
+
+// DecorateService adds the replication group resources to the template.
+// It satisfies the sparta.ServiceDecoratorHookHandler interface.
+func (cache *ElastiCacheDecorator) DecorateService(context *sparta.WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	validateErr := cache.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	if cache.Endpoint != nil {
+		logger.WithFields(logrus.Fields{
+			"Name": cache.Name,
+		}).Debug("Using existing ElastiCache replication group")
+		return nil
+	}
+	description := fmt.Sprintf("ElastiCache %s", cache.Name)
+	cacheSecurityGroupID := cache.Network.exportSecurityGroups(cache.clientSecurityGroupName(),
+		sparta.CloudFormationResourceName("ElastiCacheSecurityGroup", cache.Name),
+		description,
+		cache.port(),
+		template)
+
+	subnetIDs := make([]gocf.Stringable, 0, len(cache.Network.SubnetIDs))
+	subnetIDs = append(subnetIDs, cache.Network.SubnetIDs...)
+	subnetGroupResourceName := sparta.CloudFormationResourceName("ElastiCacheSubnetGroup", cache.Name)
+	template.AddResource(subnetGroupResourceName, &gocf.ElastiCacheSubnetGroup{
+		Description: gocf.String(description),
+		SubnetIDs:   gocf.StringList(subnetIDs...),
+	})
+
+	nodeType := cache.CacheNodeType
+	if nodeType == "" {
+		nodeType = "cache.t3.micro"
+	}
+	numCacheClusters := cache.NumCacheClusters
+	if numCacheClusters == 0 {
+		numCacheClusters = 1
+	}
+	replicationGroup := &gocf.ElastiCacheReplicationGroup{
+		ReplicationGroupDescription: gocf.String(description),
+		Engine:                      gocf.String("redis"),
+		CacheNodeType:               gocf.String(nodeType),
+		NumCacheClusters:            gocf.Integer(numCacheClusters),
+		AutomaticFailoverEnabled:    gocf.Bool(numCacheClusters > 1),
+		CacheSubnetGroupName:        gocf.Ref(subnetGroupResourceName).String(),
+		SecurityGroupIDs:            gocf.StringList(cacheSecurityGroupID),
+		Port:                        gocf.Integer(cache.port()),
+		AtRestEncryptionEnabled:     gocf.Bool(true),
+		TransitEncryptionEnabled:    gocf.Bool(true),
+	}
+	if cache.EngineVersion != "" {
+		replicationGroup.EngineVersion = gocf.String(cache.EngineVersion)
+	}
+	if cache.AuthTokenSecretArn != nil {
+		// CloudFormation resolves the token so that it isn't included in
+		// the template
+		authTokenReference := fmt.Sprintf("{{resolve:secretsmanager:%s:SecretString",
+			cache.AuthTokenSecretArn.String().Literal)
+		if cache.AuthTokenJSONKey != "" {
+			authTokenReference += ":" + cache.AuthTokenJSONKey
+		}
+		replicationGroup.AuthToken = gocf.String(authTokenReference + "}}")
+	}
+	template.AddResource(cache.LogicalResourceName(), replicationGroup)
+	return nil
+}
+
+// END - ElastiCacheDecorator
+////////////////////////////////////////////////////////////////////////////////
+
+// DatabaseConnection is the runtime connection information of a database
+// connected with the RDSProxyDecorator or ElastiCacheDecorator
+type DatabaseConnection struct {
+	// Endpoint is the database hostname
+	Endpoint string
+	// Port is the database port
+	Port int64
+	// TLS is true if connections require TLS
+	TLS bool
+	// Username is the credentials secret username key, if any
+	Username string
+	// Password is the credentials secret password key, or the ElastiCache
+	// AUTH token
+	Password string
+}
+
+// DiscoverDatabase returns the connection information of the named
+// database. The credentials are resolved from Secrets Manager the first
+// time they're requested and then cached for the lifetime of the execution
+// environment.
+func DiscoverDatabase(ctx context.Context, name string) (*DatabaseConnection, error) {
+	envName := databaseEnvName(name)
+	endpoint := os.Getenv(fmt.Sprintf(envVarDatabaseEndpointFormat, envName))
+	if endpoint == "" {
+		return nil, errors.Errorf("Database %s is not connected to this function", name)
+	}
+	port, portErr := strconv.ParseInt(os.Getenv(fmt.Sprintf(envVarDatabasePortFormat, envName)), 10, 64)
+	if portErr != nil {
+		return nil, errors.Wrapf(portErr, "Database %s has an invalid port", name)
+	}
+	conn := &DatabaseConnection{
+		Endpoint: endpoint,
+		Port:     port,
+		TLS:      os.Getenv(fmt.Sprintf(envVarDatabaseTLSFormat, envName)) == "true",
+	}
+	secretName := os.Getenv(fmt.Sprintf(envVarDatabaseSecretFormat, envName))
+	if secretName == "" {
+		return conn, nil
+	}
+	secretValue, secretErr := sparta.ResolveSecret(ctx, secretName)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	// RDS credentials are a JSON object. AUTH tokens may be the plain value.
+	credentials := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{}
+	if json.Unmarshal([]byte(secretValue), &credentials) == nil {
+		conn.Username = credentials.Username
+		conn.Password = credentials.Password
+	} else {
+		conn.Password = secretValue
+	}
+	return conn, nil
+}
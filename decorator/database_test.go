@@ -0,0 +1,272 @@
+package decorator
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestRDSProxyDecorator(t *testing.T) {
+	lambdaFn, _ := sparta.NewAWSLambda("Orders",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	proxy := &RDSProxyDecorator{
+		Name: "orders",
+		Network: &DatabaseNetwork{
+			VpcID:     gocf.String("vpc-1"),
+			SubnetIDs: []gocf.Stringable{gocf.String("subnet-1"), gocf.String("subnet-2")},
+		},
+		SecretArn:               gocf.Ref("DatabaseSecret"),
+		EngineFamily:            "POSTGRESQL",
+		DBInstanceIdentifier:    gocf.Ref("Database"),
+		DatabaseSecurityGroupID: gocf.String("sg-database"),
+		RequireTLS:              true,
+	}
+	connectErr := proxy.ConnectLambda(lambdaFn)
+	if connectErr != nil {
+		t.Fatalf("Failed to connect lambda: %s", connectErr)
+	}
+	options := lambdaFn.Options
+	if options.VPCDiscovery == nil ||
+		len(options.VPCDiscovery.SubnetIDs) != 2 ||
+		len(options.VPCDiscovery.SecurityGroupIDs) != 1 ||
+		options.Secrets["DATABASE_ORDERS_CREDENTIALS"] == nil ||
+		options.Environment["SPARTA_DATABASE_ORDERS_PORT"].Literal != "5432" ||
+		options.Environment["SPARTA_DATABASE_ORDERS_TLS"].Literal != "true" {
+		t.Fatalf("Unexpected connected lambda options: %#v", options)
+	}
+	harness := spartaTesting.NewDecoratorHarness(t)
+	decorateErr := harness.RunServiceDecorator(proxy)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate service: %s", decorateErr)
+	}
+	// Client and proxy security groups, role, proxy, target group and
+	// database ingress
+	if len(harness.Template.Resources) != 6 {
+		t.Fatalf("Unexpected RDS Proxy resources: %d", len(harness.Template.Resources))
+	}
+	proxyProperties := harness.ResourceProperties(t,
+		proxy.LogicalResourceName(),
+		"AWS::RDS::DBProxy")
+	spartaTesting.AssertTemplateValue(t, proxyProperties, "POSTGRESQL", "EngineFamily")
+	spartaTesting.AssertTemplateValue(t, proxyProperties, "SECRETS", "Auth", 0, "AuthScheme")
+	spartaTesting.AssertTemplateValue(t, proxyProperties,
+		gocf.Ref("DatabaseSecret"),
+		"Auth", 0, "SecretArn")
+	targetGroupProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("RDSProxyTargetGroup", proxy.Name),
+		"AWS::RDS::DBProxyTargetGroup")
+	spartaTesting.AssertTemplateValue(t, targetGroupProperties,
+		[]*gocf.StringExpr{gocf.Ref("Database").String()},
+		"DBInstanceIdentifiers")
+	roleProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("RDSProxyRole", proxy.Name),
+		"AWS::IAM::Role")
+	spartaTesting.AssertTemplateValue(t, roleProperties,
+		[]string{"rds.amazonaws.com"},
+		"AssumeRolePolicyDocument", "Statement", 0, "Principal", "Service")
+	ingressProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("RDSProxyDatabaseIngress", proxy.Name),
+		"AWS::EC2::SecurityGroupIngress")
+	spartaTesting.AssertTemplateValue(t, ingressProperties, "sg-database", "GroupId")
+	spartaTesting.AssertTemplateValue(t, ingressProperties, 5432, "FromPort")
+	proxySecurityGroupName := sparta.CloudFormationResourceName("RDSProxySecurityGroup", proxy.Name)
+	spartaTesting.AssertTemplateValue(t, ingressProperties,
+		gocf.GetAtt(proxySecurityGroupName, "GroupId"),
+		"SourceSecurityGroupId")
+	// The proxy accepts connections from the client security group
+	proxySecurityGroupProperties := harness.ResourceProperties(t,
+		proxySecurityGroupName,
+		"AWS::EC2::SecurityGroup")
+	spartaTesting.AssertTemplateValue(t, proxySecurityGroupProperties,
+		gocf.Ref(proxy.clientSecurityGroupName()),
+		"SecurityGroupIngress", 0, "SourceSecurityGroupId")
+	harness.AssertResource(t, proxy.clientSecurityGroupName(), "AWS::EC2::SecurityGroup")
+
+	// Existing proxies don't add resources
+	existingProxy := &RDSProxyDecorator{
+		Name: "existing",
+		Network: &DatabaseNetwork{
+			SubnetIDs:              []gocf.Stringable{gocf.String("subnet-1")},
+			ClientSecurityGroupIDs: []gocf.Stringable{gocf.String("sg-client")},
+		},
+		SecretArn:     gocf.String("arn:aws:secretsmanager:us-west-2:000000000000:secret:db"),
+		EngineFamily:  "MYSQL",
+		ProxyEndpoint: gocf.String("proxy.example.com"),
+	}
+	harness = spartaTesting.NewDecoratorHarness(t)
+	decorateErr = harness.RunServiceDecorator(existingProxy)
+	if decorateErr != nil || len(harness.Template.Resources) != 0 {
+		t.Fatalf("Unexpected existing proxy resources: %v", decorateErr)
+	}
+}
+
+func TestConnectLambdaSharedOptions(t *testing.T) {
+	sharedOptions := &sparta.LambdaFunctionOptions{
+		Environment: map[string]*gocf.StringExpr{
+			"STAGE": gocf.String("prod"),
+		},
+		Secrets: map[string]*sparta.SecretReference{},
+	}
+	connectedFn, _ := sparta.NewAWSLambda("Orders",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	connectedFn.Options = sharedOptions
+	otherFn, _ := sparta.NewAWSLambda("Reports",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	otherFn.Options = sharedOptions
+
+	proxy := &RDSProxyDecorator{
+		Name: "orders",
+		Network: &DatabaseNetwork{
+			VpcID:     gocf.String("vpc-1"),
+			SubnetIDs: []gocf.Stringable{gocf.String("subnet-1")},
+		},
+		SecretArn:            gocf.Ref("DatabaseSecret"),
+		EngineFamily:         "POSTGRESQL",
+		DBInstanceIdentifier: gocf.Ref("Database"),
+	}
+	connectErr := proxy.ConnectLambda(connectedFn)
+	if connectErr != nil {
+		t.Fatalf("Failed to connect lambda: %s", connectErr)
+	}
+	if connectedFn.Options == sharedOptions ||
+		connectedFn.Options.Environment["STAGE"].Literal != "prod" ||
+		connectedFn.Options.Secrets["DATABASE_ORDERS_CREDENTIALS"] == nil {
+		t.Fatalf("Unexpected connected lambda options: %#v", connectedFn.Options)
+	}
+	if otherFn.Options.VPCDiscovery != nil ||
+		len(otherFn.Options.Environment) != 1 ||
+		len(otherFn.Options.Secrets) != 0 {
+		t.Fatalf("Connecting a lambda updated the shared options: %#v", otherFn.Options)
+	}
+}
+
+func TestInvalidRDSProxyDecorator(t *testing.T) {
+	network := &DatabaseNetwork{
+		SubnetIDs: []gocf.Stringable{gocf.String("subnet-1")},
+	}
+	invalid := []*RDSProxyDecorator{
+		// Missing secret
+		{Name: "db",
+			Network:              &DatabaseNetwork{VpcID: gocf.String("vpc-1"), SubnetIDs: network.SubnetIDs},
+			EngineFamily:         "MYSQL",
+			DBInstanceIdentifier: gocf.String("db")},
+		// Existing proxy without client security groups
+		{Name: "db",
+			Network:       network,
+			SecretArn:     gocf.String("secret"),
+			EngineFamily:  "MYSQL",
+			ProxyEndpoint: gocf.String("proxy.example.com")},
+		// Multiple targets
+		{Name: "db",
+			Network:              &DatabaseNetwork{VpcID: gocf.String("vpc-1"), SubnetIDs: network.SubnetIDs},
+			SecretArn:            gocf.String("secret"),
+			EngineFamily:         "MYSQL",
+			DBInstanceIdentifier: gocf.String("db"),
+			DBClusterIdentifier:  gocf.String("cluster")},
+		// Unsupported engine
+		{Name: "db",
+			Network:              &DatabaseNetwork{VpcID: gocf.String("vpc-1"), SubnetIDs: network.SubnetIDs},
+			SecretArn:            gocf.String("secret"),
+			EngineFamily:         "ORACLE",
+			DBInstanceIdentifier: gocf.String("db")},
+	}
+	for eachIndex, eachProxy := range invalid {
+		if eachProxy.validate() == nil {
+			t.Fatalf("Failed to reject invalid RDSProxyDecorator: %d", eachIndex)
+		}
+	}
+}
+
+func TestElastiCacheDecorator(t *testing.T) {
+	lambdaFn, _ := sparta.NewAWSLambda("Sessions",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	lambdaFn.Options = &sparta.LambdaFunctionOptions{
+		VPCDiscovery: &sparta.VPCConfig{
+			SubnetIDs:        []gocf.Stringable{gocf.String("subnet-1")},
+			SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-app")},
+		},
+	}
+	sharedVPCConfig := lambdaFn.Options.VPCDiscovery
+	cache := &ElastiCacheDecorator{
+		Name: "sessions",
+		Network: &DatabaseNetwork{
+			VpcID:     gocf.String("vpc-1"),
+			SubnetIDs: []gocf.Stringable{gocf.String("subnet-1")},
+		},
+		AuthTokenSecretArn: gocf.String("sessions/auth"),
+		AuthTokenJSONKey:   "token",
+		NumCacheClusters:   2,
+	}
+	connectErr := cache.ConnectLambda(lambdaFn)
+	if connectErr != nil {
+		t.Fatalf("Failed to connect lambda: %s", connectErr)
+	}
+	if len(lambdaFn.Options.VPCDiscovery.SecurityGroupIDs) != 2 ||
+		len(sharedVPCConfig.SecurityGroupIDs) != 1 {
+		t.Fatalf("Unexpected connected lambda VPCConfig")
+	}
+	harness := spartaTesting.NewDecoratorHarness(t)
+	decorateErr := harness.RunServiceDecorator(cache)
+	if decorateErr != nil {
+		t.Fatalf("Failed to decorate service: %s", decorateErr)
+	}
+	subnetGroupName := sparta.CloudFormationResourceName("ElastiCacheSubnetGroup", cache.Name)
+	subnetGroupProperties := harness.ResourceProperties(t,
+		subnetGroupName,
+		"AWS::ElastiCache::SubnetGroup")
+	spartaTesting.AssertTemplateValue(t, subnetGroupProperties,
+		[]string{"subnet-1"},
+		"SubnetIds")
+	cacheProperties := harness.ResourceProperties(t,
+		cache.LogicalResourceName(),
+		"AWS::ElastiCache::ReplicationGroup")
+	spartaTesting.AssertTemplateValue(t, cacheProperties,
+		"{{resolve:secretsmanager:sessions/auth:SecretString:token}}",
+		"AuthToken")
+	spartaTesting.AssertTemplateValue(t, cacheProperties, 2, "NumCacheClusters")
+	spartaTesting.AssertTemplateValue(t, cacheProperties, true, "AutomaticFailoverEnabled")
+	spartaTesting.AssertTemplateValue(t, cacheProperties, true, "TransitEncryptionEnabled")
+	spartaTesting.AssertTemplateValue(t, cacheProperties,
+		gocf.Ref(subnetGroupName),
+		"CacheSubnetGroupName")
+
+	// Created replication groups require a literal secret
+	cache.AuthTokenSecretArn = gocf.Ref("AuthSecret")
+	decorateErr = spartaTesting.NewDecoratorHarness(t).RunServiceDecorator(cache)
+	if decorateErr == nil {
+		t.Fatalf("Failed to reject non-literal AuthTokenSecretArn")
+	}
+}
+
+func TestDiscoverDatabase(t *testing.T) {
+	os.Setenv("SPARTA_DATABASE_CACHE_ENDPOINT", "cache.example.com")
+	os.Setenv("SPARTA_DATABASE_CACHE_PORT", "6379")
+	os.Setenv("SPARTA_DATABASE_CACHE_TLS", "true")
+	defer func() {
+		os.Unsetenv("SPARTA_DATABASE_CACHE_ENDPOINT")
+		os.Unsetenv("SPARTA_DATABASE_CACHE_PORT")
+		os.Unsetenv("SPARTA_DATABASE_CACHE_TLS")
+	}()
+	conn, connErr := DiscoverDatabase(context.Background(), "cache")
+	if connErr != nil {
+		t.Fatalf("Failed to discover database: %s", connErr)
+	}
+	if conn.Endpoint != "cache.example.com" ||
+		conn.Port != 6379 ||
+		!conn.TLS ||
+		conn.Password != "" {
+		t.Fatalf("Unexpected database connection: %#v", conn)
+	}
+	_, connErr = DiscoverDatabase(context.Background(), "missing")
+	if connErr == nil {
+		t.Fatalf("Failed to reject unconnected database")
+	}
+}
@@ -45,7 +45,7 @@ func CloudFrontSiteDistributionDecoratorWithCert(s3Site *sparta.S3Site,
 	cert *gocf.CloudFrontDistributionViewerCertificate) sparta.ServiceDecoratorHookHandler {
 
 	// Setup the CF distro
-	distroDecorator := func(context map[string]interface{},
+	distroDecorator := func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -79,7 +79,7 @@ func (lad *LogAggregatorDecorator) KinesisLogicalResourceName() string {
 }
 
 // DecorateService annotates the service with the Kinesis hook
-func (lad *LogAggregatorDecorator) DecorateService(context map[string]interface{},
+func (lad *LogAggregatorDecorator) DecorateService(context *sparta.WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -139,7 +139,7 @@ func (lad *LogAggregatorDecorator) DecorateTemplate(serviceName string,
 	S3Key string,
 	buildID string,
 	template *gocf.Template,
-	context map[string]interface{},
+	context *sparta.WorkflowHookContext,
 	logger *logrus.Logger) error {
 
 	// The relay function should consume the stream
@@ -0,0 +1,421 @@
+package decorator
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Log forwarding destination types
+const (
+	logForwarderKinesis    = "Kinesis"
+	logForwarderFirehose   = "Firehose"
+	logForwarderLambda     = "Lambda"
+	logForwarderOpenSearch = "OpenSearch"
+)
+
+// OpenSearchLogDestination is the Amazon OpenSearch Service domain that
+// receives the log events. CloudWatch Logs can't subscribe to a domain
+// directly, so the events are delivered by a Kinesis Data Firehose stream
+// that decompresses the CloudWatch Logs records.
+type OpenSearchLogDestination struct {
+	// DomainArn is the OpenSearch Service domain ARN
+	DomainArn gocf.Stringable
+	// IndexName is the index that receives the log events
+	IndexName string
+	// IndexRotationPeriod is one of NoRotation, OneHour, OneDay, OneWeek or
+	// OneMonth. Defaults to OneDay.
+	IndexRotationPeriod string
+	// BackupBucketArn is the S3 bucket that stores the events that can't be
+	// delivered to the domain
+	BackupBucketArn gocf.Stringable
+}
+
+// LogForwarder is a decorator that subscribes the log groups of the
+// service's lambda functions to a centralized logging destination. It
+// satisfies both the TemplateDecoratorHandler and the
+// ServiceDecoratorHookHandler interfaces and includes the IAM role or
+// lambda permission that the destination requires.
+//
+// Use DecorateAll to forward the logs of every lambda function and add the
+// LogForwarder to the WorkflowHooks.ServiceDecorators slice. Functions
+// without a LambdaFunctionOptions.LogGroup value have their
+// /aws/lambda/<FunctionName> log group created by the decorator.
+type LogForwarder struct {
+	// FilterPattern is the optional CloudWatch Logs filter pattern that
+	// selects the forwarded events. Defaults to all events.
+	FilterPattern string
+
+	destinationType string
+	destinationArn  *gocf.StringExpr
+	openSearch      *OpenSearchLogDestination
+	lambdaFunctions map[string]*sparta.LambdaAWSInfo
+}
+
+// NewKinesisLogForwarder returns a LogForwarder for a Kinesis Data Stream
+func NewKinesisLogForwarder(streamArn gocf.Stringable) *LogForwarder {
+	return &LogForwarder{
+		destinationType: logForwarderKinesis,
+		destinationArn:  streamArn.String(),
+	}
+}
+
+// NewFirehoseLogForwarder returns a LogForwarder for a Kinesis Data
+// Firehose delivery stream
+func NewFirehoseLogForwarder(deliveryStreamArn gocf.Stringable) *LogForwarder {
+	return &LogForwarder{
+		destinationType: logForwarderFirehose,
+		destinationArn:  deliveryStreamArn.String(),
+	}
+}
+
+// NewLambdaLogForwarder returns a LogForwarder for a lambda function. If
+// the function is part of the service, its own log group isn't forwarded.
+func NewLambdaLogForwarder(functionArn gocf.Stringable) *LogForwarder {
+	return &LogForwarder{
+		destinationType: logForwarderLambda,
+		destinationArn:  functionArn.String(),
+	}
+}
+
+// NewOpenSearchLogForwarder returns a LogForwarder for an Amazon
+// OpenSearch Service domain
+func NewOpenSearchLogForwarder(destination *OpenSearchLogDestination) *LogForwarder {
+	return &LogForwarder{
+		destinationType: logForwarderOpenSearch,
+		openSearch:      destination,
+	}
+}
+
+// DecorateAll adds the forwarder to each function's Decorators
+func (forwarder *LogForwarder) DecorateAll(lambdaFunctions []*sparta.LambdaAWSInfo) {
+	if forwarder.lambdaFunctions == nil {
+		forwarder.lambdaFunctions = make(map[string]*sparta.LambdaAWSInfo)
+	}
+	for _, eachLambda := range lambdaFunctions {
+		forwarder.lambdaFunctions[eachLambda.LogicalResourceName()] = eachLambda
+		eachLambda.Decorators = append(eachLambda.Decorators, forwarder)
+	}
+}
+
+func (forwarder *LogForwarder) validate() error {
+	switch forwarder.destinationType {
+	case logForwarderKinesis, logForwarderFirehose, logForwarderLambda:
+		if forwarder.destinationArn == nil {
+			return errors.Errorf("LogForwarder %s destination ARN is required",
+				forwarder.destinationType)
+		}
+	case logForwarderOpenSearch:
+		if forwarder.openSearch == nil ||
+			forwarder.openSearch.DomainArn == nil ||
+			forwarder.openSearch.BackupBucketArn == nil ||
+			forwarder.openSearch.IndexName == "" {
+			return errors.Errorf("LogForwarder OpenSearch destination requires a DomainArn, IndexName and BackupBucketArn")
+		}
+	default:
+		return errors.Errorf("Unsupported LogForwarder destination type: %s",
+			forwarder.destinationType)
+	}
+	return nil
+}
+
+// roleResourceName is the role that CloudWatch Logs assumes to publish to
+// the stream destinations
+func (forwarder *LogForwarder) roleResourceName(serviceName string) string {
+	return sparta.CloudFormationResourceName("LogForwarderRole", serviceName)
+}
+
+// permissionResourceName is the permission that allows CloudWatch Logs to
+// invoke the lambda destination
+func (forwarder *LogForwarder) permissionResourceName(serviceName string) string {
+	return sparta.CloudFormationResourceName("LogForwarderPermission", serviceName)
+}
+
+// deliveryStreamResourceName is the Firehose stream for the OpenSearch
+// destination
+func (forwarder *LogForwarder) deliveryStreamResourceName(serviceName string) string {
+	return sparta.CloudFormationResourceName("LogForwarderDeliveryStream", serviceName)
+}
+
+// destination returns the subscription filter DestinationArn
+func (forwarder *LogForwarder) destination(serviceName string) *gocf.StringExpr {
+	if forwarder.destinationType == logForwarderOpenSearch {
+		return gocf.GetAtt(forwarder.deliveryStreamResourceName(serviceName), "Arn")
+	}
+	return forwarder.destinationArn
+}
+
+// isDestinationFunction returns true if the lambda function is the
+// forwarding destination
+func (forwarder *LogForwarder) isDestinationFunction(lambdaResourceName string) bool {
+	if forwarder.destinationType != logForwarderLambda {
+		return false
+	}
+	switch typedFunc := forwarder.destinationArn.Func.(type) {
+	case gocf.GetAttFunc:
+		return typedFunc.Resource == lambdaResourceName
+	case *gocf.GetAttFunc:
+		return typedFunc.Resource == lambdaResourceName
+	case gocf.RefFunc:
+		return typedFunc.Name == lambdaResourceName
+	case *gocf.RefFunc:
+		return typedFunc.Name == lambdaResourceName
+	}
+	return false
+}
+
+// servicePrincipalRole returns the role that the service principal assumes
+// to call the actions on the resource
+func servicePrincipalRole(principal string,
+	actions []string,
+	resources ...*gocf.StringExpr) *gocf.IAMRole {
+	statements := make([]spartaIAM.PolicyStatement, 0)
+	for _, eachResource := range resources {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: eachResource,
+		})
+	}
+	return &gocf.IAMRole{
+		AssumeRolePolicyDocument: sparta.ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []sparta.ArbitraryJSONObject{
+				{
+					"Effect": "Allow",
+					"Principal": sparta.ArbitraryJSONObject{
+						"Service": []string{principal},
+					},
+					"Action": []string{"sts:AssumeRole"},
+				},
+			},
+		},
+		Policies: &gocf.IAMRolePolicyList{
+			gocf.IAMRolePolicy{
+				PolicyDocument: sparta.ArbitraryJSONObject{
+					"Version":   "2012-10-17",
+					"Statement": statements,
+				},
+				PolicyName: gocf.String("LogForwarderPolicy"),
+			},
+		},
+	}
+}
+
+// exportOpenSearchDeliveryStream adds the Firehose stream and its role
+// for the OpenSearch destination
+func (forwarder *LogForwarder) exportOpenSearchDeliveryStream(serviceName string,
+	template *gocf.Template) {
+
+	openSearch := forwarder.openSearch
+	domainArn := openSearch.DomainArn.String()
+	backupBucketArn := openSearch.BackupBucketArn.String()
+	rotationPeriod := openSearch.IndexRotationPeriod
+	if rotationPeriod == "" {
+		rotationPeriod = "OneDay"
+	}
+	firehoseRoleResourceName := sparta.CloudFormationResourceName("LogForwarderFirehoseRole",
+		serviceName)
+	firehoseRole := servicePrincipalRole("firehose.amazonaws.com",
+		[]string{"es:DescribeDomain",
+			"es:DescribeDomains",
+			"es:DescribeDomainConfig",
+			"es:ESHttpPost",
+			"es:ESHttpPut"},
+		domainArn,
+		gocf.Join("", domainArn, gocf.String("/*")))
+	firehoseRolePolicies := *firehoseRole.Policies
+	firehoseRolePolicies = append(firehoseRolePolicies, gocf.IAMRolePolicy{
+		PolicyDocument: sparta.ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []spartaIAM.PolicyStatement{
+				{
+					Effect: "Allow",
+					Action: []string{"s3:AbortMultipartUpload",
+						"s3:GetBucketLocation",
+						"s3:GetObject",
+						"s3:ListBucket",
+						"s3:ListBucketMultipartUploads",
+						"s3:PutObject"},
+					Resource: backupBucketArn,
+				},
+				{
+					Effect: "Allow",
+					Action: []string{"s3:AbortMultipartUpload",
+						"s3:GetObject",
+						"s3:PutObject"},
+					Resource: gocf.Join("", backupBucketArn, gocf.String("/*")),
+				},
+			},
+		},
+		PolicyName: gocf.String("LogForwarderBackupPolicy"),
+	})
+	firehoseRole.Policies = &firehoseRolePolicies
+	template.AddResource(firehoseRoleResourceName, firehoseRole)
+
+	firehoseRoleArn := gocf.GetAtt(firehoseRoleResourceName, "Arn")
+	deliveryStream := &gocf.KinesisFirehoseDeliveryStream{
+		DeliveryStreamType: gocf.String("DirectPut"),
+		ElasticsearchDestinationConfiguration: &gocf.KinesisFirehoseDeliveryStreamElasticsearchDestinationConfiguration{
+			DomainARN:           domainArn,
+			IndexName:           gocf.String(openSearch.IndexName),
+			IndexRotationPeriod: gocf.String(rotationPeriod),
+			RoleARN:             firehoseRoleArn,
+			BufferingHints: &gocf.KinesisFirehoseDeliveryStreamElasticsearchBufferingHints{
+				IntervalInSeconds: gocf.Integer(60),
+				SizeInMBs:         gocf.Integer(5),
+			},
+			RetryOptions: &gocf.KinesisFirehoseDeliveryStreamElasticsearchRetryOptions{
+				DurationInSeconds: gocf.Integer(300),
+			},
+			S3BackupMode: gocf.String("FailedDocumentsOnly"),
+			S3Configuration: &gocf.KinesisFirehoseDeliveryStreamS3DestinationConfiguration{
+				BucketARN: backupBucketArn,
+				BufferingHints: &gocf.KinesisFirehoseDeliveryStreamBufferingHints{
+					IntervalInSeconds: gocf.Integer(300),
+					SizeInMBs:         gocf.Integer(5),
+				},
+				CompressionFormat: gocf.String("GZIP"),
+				Prefix:            gocf.String("LogForwarder/"),
+				RoleARN:           firehoseRoleArn,
+			},
+			// CloudWatch Logs publishes gzip compressed records that contain
+			// several log events
+			ProcessingConfiguration: &gocf.KinesisFirehoseDeliveryStreamProcessingConfiguration{
+				Enabled: gocf.Bool(true),
+				Processors: &gocf.KinesisFirehoseDeliveryStreamProcessorList{
+					gocf.KinesisFirehoseDeliveryStreamProcessor{
+						Type: gocf.String("Decompression"),
+						Parameters: &gocf.KinesisFirehoseDeliveryStreamProcessorParameterList{
+							gocf.KinesisFirehoseDeliveryStreamProcessorParameter{
+								ParameterName:  gocf.String("CompressionFormat"),
+								ParameterValue: gocf.String("GZIP"),
+							},
+						},
+					},
+					gocf.KinesisFirehoseDeliveryStreamProcessor{
+						Type: gocf.String("CloudWatchLogProcessing"),
+						Parameters: &gocf.KinesisFirehoseDeliveryStreamProcessorParameterList{
+							gocf.KinesisFirehoseDeliveryStreamProcessorParameter{
+								ParameterName:  gocf.String("DataMessageExtraction"),
+								ParameterValue: gocf.String("true"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	template.AddResource(forwarder.deliveryStreamResourceName(serviceName), deliveryStream)
+}
+
+// DecorateService adds the destination resources and permissions to the
+// template
+func (forwarder *LogForwarder) DecorateService(context *sparta.WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	validateErr := forwarder.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	switch forwarder.destinationType {
+	case logForwarderKinesis:
+		template.AddResource(forwarder.roleResourceName(serviceName),
+			servicePrincipalRole("logs.amazonaws.com",
+				[]string{"kinesis:PutRecord", "kinesis:PutRecords"},
+				forwarder.destinationArn))
+	case logForwarderFirehose, logForwarderOpenSearch:
+		if forwarder.destinationType == logForwarderOpenSearch {
+			forwarder.exportOpenSearchDeliveryStream(serviceName, template)
+		}
+		template.AddResource(forwarder.roleResourceName(serviceName),
+			servicePrincipalRole("logs.amazonaws.com",
+				[]string{"firehose:PutRecord", "firehose:PutRecordBatch"},
+				forwarder.destination(serviceName)))
+	case logForwarderLambda:
+		template.AddResource(forwarder.permissionResourceName(serviceName),
+			&gocf.LambdaPermission{
+				Action:        gocf.String("lambda:InvokeFunction"),
+				FunctionName:  forwarder.destinationArn,
+				Principal:     gocf.String("logs.amazonaws.com"),
+				SourceAccount: gocf.Ref("AWS::AccountId").String(),
+			})
+	}
+	return nil
+}
+
+// DecorateTemplate adds the function's log group subscription filter to
+// the template
+func (forwarder *LogForwarder) DecorateTemplate(serviceName string,
+	lambdaResourceName string,
+	lambdaResource gocf.LambdaFunction,
+	resourceMetadata map[string]interface{},
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	template *gocf.Template,
+	context *sparta.WorkflowHookContext,
+	logger *logrus.Logger) error {
+
+	validateErr := forwarder.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	if forwarder.isDestinationFunction(lambdaResourceName) {
+		logger.WithField("Resource", lambdaResourceName).
+			Debug("Skipping LogForwarder subscription for destination function")
+		return nil
+	}
+	// The function resource depends on the Sparta-managed log group
+	dependsOn := []string{lambdaResourceName}
+	logGroupName := gocf.Join("",
+		gocf.String("/aws/lambda/"),
+		gocf.Ref(lambdaResourceName))
+	var logGroup *sparta.LogGroup
+	if lambdaInfo, lambdaInfoOk := forwarder.lambdaFunctions[lambdaResourceName]; lambdaInfoOk &&
+		lambdaInfo.Options != nil {
+		logGroup = lambdaInfo.Options.LogGroup
+	}
+	if logGroup == nil {
+		// The log group must exist before the subscription filter
+		logGroupResourceName := sparta.CloudFormationResourceName("LogForwarderLogGroup",
+			lambdaResourceName)
+		template.AddResource(logGroupResourceName, &gocf.LogsLogGroup{
+			LogGroupName: logGroupName,
+		})
+		dependsOn = append(dependsOn, logGroupResourceName)
+	} else if logGroup.Name != "" {
+		logGroupName = gocf.String(logGroup.Name)
+	}
+
+	subscriptionFilter := &gocf.LogsSubscriptionFilter{
+		DestinationArn: forwarder.destination(serviceName),
+		FilterPattern:  gocf.String(forwarder.FilterPattern),
+		LogGroupName:   logGroupName,
+	}
+	if forwarder.destinationType == logForwarderLambda {
+		dependsOn = append(dependsOn, forwarder.permissionResourceName(serviceName))
+	} else {
+		subscriptionFilter.RoleArn = gocf.GetAtt(forwarder.roleResourceName(serviceName), "Arn")
+		dependsOn = append(dependsOn, forwarder.roleResourceName(serviceName))
+	}
+	subscriptionFilterResourceName := sparta.CloudFormationResourceName("LogForwarderSubscription",
+		lambdaResourceName)
+	cfResource := template.AddResource(subscriptionFilterResourceName, subscriptionFilter)
+	cfResource.DependsOn = dependsOn
+	return nil
+}
+
+// Ensure compliance
+var _ sparta.ServiceDecoratorHookHandler = (*LogForwarder)(nil)
+var _ sparta.TemplateDecoratorHandler = (*LogForwarder)(nil)
@@ -0,0 +1,152 @@
+package decorator
+
+import (
+	"reflect"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestLogForwarder(t *testing.T) {
+	lambdaFn, _ := sparta.NewAWSLambda("LogForwarder",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	lambdaResourceName := lambdaFn.LogicalResourceName()
+	subscriptionResourceName := sparta.CloudFormationResourceName("LogForwarderSubscription",
+		lambdaResourceName)
+	logGroupResourceName := sparta.CloudFormationResourceName("LogForwarderLogGroup",
+		lambdaResourceName)
+
+	decorate := func(forwarder *LogForwarder,
+		lambdaAWSInfo *sparta.LambdaAWSInfo) *spartaTesting.DecoratorHarness {
+		harness := spartaTesting.NewDecoratorHarness(t)
+		serviceErr := harness.RunServiceDecorator(forwarder)
+		if serviceErr != nil {
+			t.Fatalf("Failed to decorate service: %s", serviceErr)
+		}
+		templateErr := harness.RunTemplateDecorator(lambdaAWSInfo, forwarder)
+		if templateErr != nil {
+			t.Fatalf("Failed to decorate template: %s", templateErr)
+		}
+		return harness
+	}
+
+	// Kinesis destinations use a role and the function log group is
+	// created by the decorator
+	forwarder := NewKinesisLogForwarder(gocf.GetAtt("LogStream", "Arn"))
+	forwarder.FilterPattern = "ERROR"
+	forwarder.DecorateAll([]*sparta.LambdaAWSInfo{lambdaFn})
+	if len(lambdaFn.Decorators) != 1 {
+		t.Fatalf("Failed to add LogForwarder decorator")
+	}
+	harness := decorate(forwarder, lambdaFn)
+	roleResourceName := forwarder.roleResourceName(harness.ServiceName)
+	roleProperties := harness.ResourceProperties(t, roleResourceName, "AWS::IAM::Role")
+	spartaTesting.AssertTemplateValue(t, roleProperties,
+		[]string{"logs.amazonaws.com"},
+		"AssumeRolePolicyDocument", "Statement", 0, "Principal", "Service")
+	spartaTesting.AssertTemplateValue(t, roleProperties,
+		[]string{"kinesis:PutRecord", "kinesis:PutRecords"},
+		"Policies", 0, "PolicyDocument", "Statement", 0, "Action")
+	logGroupProperties := harness.ResourceProperties(t, logGroupResourceName, "AWS::Logs::LogGroup")
+	logGroupName := gocf.Join("", gocf.String("/aws/lambda/"), gocf.Ref(lambdaResourceName))
+	spartaTesting.AssertTemplateValue(t, logGroupProperties, logGroupName, "LogGroupName")
+	subscriptionProperties := harness.ResourceProperties(t,
+		subscriptionResourceName,
+		"AWS::Logs::SubscriptionFilter")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties, "ERROR", "FilterPattern")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties, logGroupName, "LogGroupName")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties,
+		gocf.GetAtt("LogStream", "Arn"),
+		"DestinationArn")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties,
+		gocf.GetAtt(roleResourceName, "Arn"),
+		"RoleArn")
+	expectedDependsOn := []string{lambdaResourceName, logGroupResourceName, roleResourceName}
+	dependsOn := harness.Template.Resources[subscriptionResourceName].DependsOn
+	if !reflect.DeepEqual(dependsOn, expectedDependsOn) {
+		t.Fatalf("Unexpected subscription DependsOn: %v", dependsOn)
+	}
+
+	// Sparta-managed log groups are used as-is
+	lambdaFn.Options.LogGroup = &sparta.LogGroup{Name: "/custom/orders"}
+	harness = decorate(forwarder, lambdaFn)
+	if len(harness.ResourceNames("AWS::Logs::LogGroup")) != 0 {
+		t.Fatalf("Unexpected LogForwarder log group for managed log group")
+	}
+	subscriptionProperties = harness.ResourceProperties(t,
+		subscriptionResourceName,
+		"AWS::Logs::SubscriptionFilter")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties, "/custom/orders", "LogGroupName")
+
+	// Lambda destinations use a permission and skip the destination
+	shipperFn, _ := sparta.NewAWSLambda("LogShipper",
+		func() (string, error) { return "", nil },
+		sparta.IAMRoleDefinition{})
+	forwarder = NewLambdaLogForwarder(gocf.GetAtt(shipperFn.LogicalResourceName(), "Arn"))
+	harness = decorate(forwarder, lambdaFn)
+	permissionProperties := harness.ResourceProperties(t,
+		forwarder.permissionResourceName(harness.ServiceName),
+		"AWS::Lambda::Permission")
+	spartaTesting.AssertTemplateValue(t, permissionProperties, "logs.amazonaws.com", "Principal")
+	subscriptionProperties = harness.ResourceProperties(t,
+		subscriptionResourceName,
+		"AWS::Logs::SubscriptionFilter")
+	if spartaTesting.TemplateValue(subscriptionProperties, "RoleArn") != nil {
+		t.Fatalf("Unexpected RoleArn for lambda destination: %#v", subscriptionProperties)
+	}
+	harness = decorate(forwarder, shipperFn)
+	if len(harness.ResourceNames("AWS::Logs::SubscriptionFilter")) != 0 {
+		t.Fatalf("Failed to skip the destination function subscription")
+	}
+
+	// OpenSearch destinations use a Firehose delivery stream
+	forwarder = NewOpenSearchLogForwarder(&OpenSearchLogDestination{
+		DomainArn:       gocf.String("arn:aws:es:us-west-2:000000000000:domain/logs"),
+		IndexName:       "lambda",
+		BackupBucketArn: gocf.String("arn:aws:s3:::log-backup"),
+	})
+	harness = decorate(forwarder, lambdaFn)
+	roleProperties = harness.ResourceProperties(t,
+		forwarder.roleResourceName(harness.ServiceName),
+		"AWS::IAM::Role")
+	spartaTesting.AssertTemplateValue(t, roleProperties,
+		[]string{"firehose:PutRecord", "firehose:PutRecordBatch"},
+		"Policies", 0, "PolicyDocument", "Statement", 0, "Action")
+	firehoseRoleProperties := harness.ResourceProperties(t,
+		sparta.CloudFormationResourceName("LogForwarderFirehoseRole", harness.ServiceName),
+		"AWS::IAM::Role")
+	spartaTesting.AssertTemplateValue(t, firehoseRoleProperties,
+		"es:ESHttpPost",
+		"Policies", 0, "PolicyDocument", "Statement", 0, "Action", 3)
+	deliveryStreamResourceName := forwarder.deliveryStreamResourceName(harness.ServiceName)
+	deliveryStreamProperties := harness.ResourceProperties(t,
+		deliveryStreamResourceName,
+		"AWS::KinesisFirehose::DeliveryStream")
+	spartaTesting.AssertTemplateValue(t, deliveryStreamProperties,
+		"Decompression",
+		"ElasticsearchDestinationConfiguration", "ProcessingConfiguration", "Processors", 0, "Type")
+	subscriptionProperties = harness.ResourceProperties(t,
+		subscriptionResourceName,
+		"AWS::Logs::SubscriptionFilter")
+	spartaTesting.AssertTemplateValue(t, subscriptionProperties,
+		gocf.GetAtt(deliveryStreamResourceName, "Arn"),
+		"DestinationArn")
+}
+
+func TestInvalidLogForwarder(t *testing.T) {
+	invalidForwarders := []*LogForwarder{
+		{},
+		NewOpenSearchLogForwarder(&OpenSearchLogDestination{
+			DomainArn: gocf.String("arn:aws:es:us-west-2:000000000000:domain/logs"),
+		}),
+	}
+	for _, eachForwarder := range invalidForwarders {
+		serviceErr := spartaTesting.NewDecoratorHarness(t).RunServiceDecorator(eachForwarder)
+		if serviceErr == nil {
+			t.Fatalf("Failed to reject invalid LogForwarder: %#v", eachForwarder)
+		}
+	}
+}
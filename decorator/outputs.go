@@ -20,7 +20,7 @@ func sanitizedKeyName(userValue string) string {
 // outputs associated with the given (cfResourceName, cfResource) pair.
 func PublishAllResourceOutputs(cfResourceName string,
 	cfResource gocf.ResourceProperties) sparta.ServiceDecoratorHookFunc {
-	return func(context map[string]interface{},
+	return func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		cfTemplate *gocf.Template,
 		S3Bucket string,
@@ -63,7 +63,7 @@ func PublishAttOutputDecorator(keyName string, description string, fieldName str
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		// Add the function ARN as a stack output
@@ -87,7 +87,7 @@ func PublishRefOutputDecorator(keyName string, description string) sparta.Templa
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		// Add the function ARN as a stack output
@@ -18,7 +18,7 @@ func S3ArtifactPublisherDecorator(bucket gocf.Stringable,
 	data map[string]interface{}) sparta.ServiceDecoratorHookHandler {
 
 	// Setup the CF distro
-	artifactDecorator := func(context map[string]interface{},
+	artifactDecorator := func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -22,7 +22,7 @@ func codeDeployLambdaUpdateDecorator(updateType string,
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		safeDeployResourceName := func(resType string) string {
@@ -79,6 +79,9 @@ func codeDeployLambdaUpdateDecorator(updateType string,
 // the CodeDeploy safe update to an upgrade operation.
 // Ref: https://github.com/awslabs/serverless-application-model/blob/master/docs/safe_lambda_deployments.rst
 //
+// Deprecated: Prefer the sparta.LambdaFunctionOptions AutoPublishAlias and
+// DeploymentPreference fields, which also support rollback alarms and
+// traffic hooks.
 func CodeDeployServiceUpdateDecorator(updateType string,
 	lambdaFuncs []*sparta.LambdaAWSInfo,
 	preHook *sparta.LambdaAWSInfo,
@@ -121,7 +124,7 @@ func CodeDeployServiceUpdateDecorator(updateType string,
 	}
 
 	// Return the service decorator...
-	return func(context map[string]interface{},
+	return func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
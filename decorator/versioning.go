@@ -20,7 +20,7 @@ func LambdaVersioningDecorator() sparta.TemplateDecoratorHookFunc {
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *sparta.WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		lambdaResName := sparta.CloudFormationResourceName("LambdaVersion",
@@ -0,0 +1,151 @@
+package decorator
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ec2TagFilters returns the DescribeSubnets/DescribeSecurityGroups filters
+// for the given VPC and tags
+func ec2TagFilters(vpcID string, tags map[string]string) []*ec2.Filter {
+	filters := make([]*ec2.Filter, 0)
+	if vpcID != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("vpc-id"),
+			Values: []*string{aws.String(vpcID)},
+		})
+	}
+	// Sort the keys so that the request is stable
+	tagKeys := make([]string, 0)
+	for eachKey := range tags {
+		tagKeys = append(tagKeys, eachKey)
+	}
+	sort.Strings(tagKeys)
+	for _, eachKey := range tagKeys {
+		if tags[eachKey] == "" {
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String(eachKey)},
+			})
+		} else {
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("tag:" + eachKey),
+				Values: []*string{aws.String(tags[eachKey])},
+			})
+		}
+	}
+	return filters
+}
+
+// discoverVPCConfig returns a new VPCConfig whose tag filters have been
+// resolved to subnet and security group IDs
+func discoverVPCConfig(ec2Svc ec2iface.EC2API,
+	vpcConfig *sparta.VPCConfig,
+	logger *logrus.Logger) (*sparta.VPCConfig, error) {
+
+	resolved := &sparta.VPCConfig{
+		SubnetIDs:        append([]gocf.Stringable{}, vpcConfig.SubnetIDs...),
+		SecurityGroupIDs: append([]gocf.Stringable{}, vpcConfig.SecurityGroupIDs...),
+		VpcID:            vpcConfig.VpcID,
+	}
+	vpcID := vpcConfig.VpcID
+	if len(vpcConfig.SubnetTags) != 0 {
+		subnetVPCs := make(map[string]bool)
+		pagesErr := ec2Svc.DescribeSubnetsPages(&ec2.DescribeSubnetsInput{
+			Filters: ec2TagFilters(vpcID, vpcConfig.SubnetTags),
+		}, func(output *ec2.DescribeSubnetsOutput, lastPage bool) bool {
+			for _, eachSubnet := range output.Subnets {
+				resolved.SubnetIDs = append(resolved.SubnetIDs,
+					gocf.String(aws.StringValue(eachSubnet.SubnetId)))
+				subnetVPCs[aws.StringValue(eachSubnet.VpcId)] = true
+			}
+			return true
+		})
+		if pagesErr != nil {
+			return nil, errors.Wrapf(pagesErr, "Failed to describe subnets")
+		}
+		if len(subnetVPCs) == 0 {
+			return nil, errors.Errorf("No subnets found for tags: %v", vpcConfig.SubnetTags)
+		}
+		if len(subnetVPCs) > 1 {
+			return nil, errors.Errorf("Subnets for tags %v belong to multiple VPCs. Set VPCDiscovery.VpcID to select one",
+				vpcConfig.SubnetTags)
+		}
+		// Security groups must belong to the same VPC as the subnets
+		for eachVPC := range subnetVPCs {
+			vpcID = eachVPC
+		}
+	}
+	if len(vpcConfig.SecurityGroupTags) != 0 {
+		pagesErr := ec2Svc.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{
+			Filters: ec2TagFilters(vpcID, vpcConfig.SecurityGroupTags),
+		}, func(output *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+			for _, eachGroup := range output.SecurityGroups {
+				resolved.SecurityGroupIDs = append(resolved.SecurityGroupIDs,
+					gocf.String(aws.StringValue(eachGroup.GroupId)))
+			}
+			return true
+		})
+		if pagesErr != nil {
+			return nil, errors.Wrapf(pagesErr, "Failed to describe security groups")
+		}
+		if len(resolved.SecurityGroupIDs) == len(vpcConfig.SecurityGroupIDs) {
+			return nil, errors.Errorf("No security groups found for tags: %v", vpcConfig.SecurityGroupTags)
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"VpcID":            vpcID,
+		"SubnetIDs":        len(resolved.SubnetIDs),
+		"SecurityGroupIDs": len(resolved.SecurityGroupIDs),
+	}).Info("Discovered VPC configuration")
+	return resolved, nil
+}
+
+// VPCConfigDiscoveryDecorator returns a WorkflowHookHandler that resolves the
+// sparta.VPCConfig SubnetTags and SecurityGroupTags of the given lambda
+// functions to subnet and security group IDs using the EC2 API. Add it
+// to the WorkflowHooks PreMarshalls slice so that it runs before the
+// CloudFormation template is created.
+func VPCConfigDiscoveryDecorator(lambdaFuncs []*sparta.LambdaAWSInfo) sparta.WorkflowHookFunc {
+	return func(context *sparta.WorkflowHookContext,
+		serviceName string,
+		S3Bucket string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+
+		ec2Svc := ec2.New(awsSession)
+		// Functions may share the same VPCConfig, so only look it up once
+		resolvedConfigs := make(map[*sparta.VPCConfig]*sparta.VPCConfig)
+		for _, eachLambda := range lambdaFuncs {
+			if eachLambda.Options == nil ||
+				eachLambda.Options.VPCDiscovery == nil ||
+				!eachLambda.Options.VPCDiscovery.RequiresDiscovery() {
+				continue
+			}
+			vpcConfig := eachLambda.Options.VPCDiscovery
+			resolved, resolvedExists := resolvedConfigs[vpcConfig]
+			if !resolvedExists {
+				discovered, discoveredErr := discoverVPCConfig(ec2Svc, vpcConfig, logger)
+				if discoveredErr != nil {
+					return errors.Wrapf(discoveredErr,
+						"Failed to discover VPC configuration for lambda %s",
+						eachLambda.LogicalResourceName())
+				}
+				resolved = discovered
+				resolvedConfigs[vpcConfig] = resolved
+			}
+			eachLambda.Options.VPCDiscovery = resolved
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package decorator
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+type mockEC2 struct {
+	ec2iface.EC2API
+	subnets        []*ec2.Subnet
+	securityGroups []*ec2.SecurityGroup
+	groupFilters   []*ec2.Filter
+}
+
+func (mock *mockEC2) DescribeSubnetsPages(input *ec2.DescribeSubnetsInput,
+	fn func(*ec2.DescribeSubnetsOutput, bool) bool) error {
+	fn(&ec2.DescribeSubnetsOutput{Subnets: mock.subnets}, true)
+	return nil
+}
+
+func (mock *mockEC2) DescribeSecurityGroupsPages(input *ec2.DescribeSecurityGroupsInput,
+	fn func(*ec2.DescribeSecurityGroupsOutput, bool) bool) error {
+	mock.groupFilters = input.Filters
+	fn(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: mock.securityGroups}, true)
+	return nil
+}
+
+func TestVPCConfigDiscovery(t *testing.T) {
+	logger, _ := sparta.NewLogger("info")
+	mock := &mockEC2{
+		subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-1"), VpcId: aws.String("vpc-1")},
+			{SubnetId: aws.String("subnet-2"), VpcId: aws.String("vpc-1")},
+		},
+		securityGroups: []*ec2.SecurityGroup{
+			{GroupId: aws.String("sg-1"), VpcId: aws.String("vpc-1")},
+		},
+	}
+	vpcConfig := &sparta.VPCConfig{
+		SubnetTags:        map[string]string{"Tier": "private"},
+		SecurityGroupTags: map[string]string{"Lambda": ""},
+	}
+	resolved, resolvedErr := discoverVPCConfig(mock, vpcConfig, logger)
+	if resolvedErr != nil {
+		t.Fatalf("Failed to discover VPCConfig: %s", resolvedErr)
+	}
+	if resolved.RequiresDiscovery() ||
+		len(resolved.SubnetIDs) != 2 ||
+		len(resolved.SecurityGroupIDs) != 1 {
+		t.Fatalf("Unexpected discovered VPCConfig: %#v", resolved)
+	}
+	// The security group lookup is scoped to the subnet VPC
+	if len(mock.groupFilters) != 2 ||
+		aws.StringValue(mock.groupFilters[0].Values[0]) != "vpc-1" ||
+		aws.StringValue(mock.groupFilters[1].Name) != "tag-key" {
+		t.Fatalf("Unexpected security group filters: %v", mock.groupFilters)
+	}
+}
+
+func TestVPCConfigDiscoveryErrors(t *testing.T) {
+	logger, _ := sparta.NewLogger("info")
+	multipleVPCs := &mockEC2{
+		subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-1"), VpcId: aws.String("vpc-1")},
+			{SubnetId: aws.String("subnet-2"), VpcId: aws.String("vpc-2")},
+		},
+	}
+	_, resolvedErr := discoverVPCConfig(multipleVPCs, &sparta.VPCConfig{
+		SubnetTags:       map[string]string{"Tier": "private"},
+		SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1")},
+	}, logger)
+	if resolvedErr == nil {
+		t.Fatalf("Failed to reject subnets in multiple VPCs")
+	}
+	_, resolvedErr = discoverVPCConfig(&mockEC2{}, &sparta.VPCConfig{
+		SubnetIDs:         []gocf.Stringable{gocf.String("subnet-1")},
+		SecurityGroupTags: map[string]string{"Tier": "lambda"},
+	}, logger)
+	if resolvedErr == nil {
+		t.Fatalf("Failed to reject missing security groups")
+	}
+}
@@ -12,14 +12,14 @@ import (
 	"time"
 
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// Describe produces a graphical representation of a service's Lambda and data sources.  Typically
-// automatically called as part of a compiled golang binary via the `describe` command
-// line option.
-func Describe(serviceName string,
+// describeService provisions the service in NOOP mode and returns the
+// service graph together with the JSON encoded CloudFormation template string
+func describeService(serviceName string,
 	serviceDescription string,
 	lambdaAWSInfos []*LambdaAWSInfo,
 	api APIGateway,
@@ -27,13 +27,12 @@ func Describe(serviceName string,
 	s3BucketName string,
 	buildTags string,
 	linkFlags string,
-	outputWriter io.Writer,
 	workflowHooks *WorkflowHooks,
-	logger *logrus.Logger) error {
+	logger *logrus.Logger) (*descriptionWriter, []byte, error) {
 
 	validationErr := validateSpartaPreconditions(lambdaAWSInfos, logger)
 	if validationErr != nil {
-		return validationErr
+		return nil, nil, validationErr
 	}
 	buildID, buildIDErr := provisionBuildID("none", logger)
 	if buildIDErr != nil {
@@ -57,16 +56,11 @@ func Describe(serviceName string,
 		workflowHooks,
 		logger)
 	if nil != err {
-		return err
-	}
-
-	tmpl, err := template.New("description").Parse(_escFSMustString(false, "/resources/describe/template.html"))
-	if err != nil {
-		return errors.New(err.Error())
+		return nil, nil, err
 	}
 
 	// Setup the describer
-	describer := descriptionWriter{
+	describer := &descriptionWriter{
 		nodes:  make([]*cytoscapeNode, 0),
 		logger: logger,
 	}
@@ -84,7 +78,7 @@ func Describe(serviceName string,
 		nodeColorService,
 		"AWSIcons/Management Tools/ManagementTools_AWSCloudFormation_stack.svg")
 	if writeErr != nil {
-		return writeErr
+		return nil, nil, writeErr
 	}
 	for _, eachLambda := range lambdaAWSInfos {
 		// Other cytoscape nodes
@@ -93,20 +87,20 @@ func Describe(serviceName string,
 			nodeColorLambda,
 			"AWSIcons/Compute/Compute_AWSLambda.svg")
 		if writeErr != nil {
-			return writeErr
+			return nil, nil, writeErr
 		}
 		writeErr = describer.writeEdge(eachLambda.lambdaFunctionName(),
 			serviceName,
 			"")
 		if writeErr != nil {
-			return writeErr
+			return nil, nil, writeErr
 		}
 		// Create permission & event mappings
 		// functions declared in this
 		for _, eachPermission := range eachLambda.Permissions {
 			nodes, err := eachPermission.descriptionInfo()
 			if nil != err {
-				return err
+				return nil, nil, err
 			}
 
 			for _, eachNode := range nodes {
@@ -122,37 +116,50 @@ func Describe(serviceName string,
 					nodeColor,
 					iconForAWSResource(eachNode.Name))
 				if writeErr != nil {
-					return writeErr
+					return nil, nil, writeErr
 				}
 				writeErr = describer.writeEdge(
 					name,
 					eachLambda.lambdaFunctionName(),
 					link)
 				if writeErr != nil {
-					return writeErr
+					return nil, nil, writeErr
 				}
 			}
 		}
 		for index, eachEventSourceMapping := range eachLambda.EventSourceMappings {
-			dynamicArn := spartaCF.DynamicValueToStringExpr(eachEventSourceMapping.EventSourceArn)
+			var dynamicArn gocf.Stringable
+			if eachEventSourceMapping.EventSourceArn != nil {
+				dynamicArn = spartaCF.DynamicValueToStringExpr(eachEventSourceMapping.EventSourceArn)
+			} else if eachEventSourceMapping.SelfManagedKafka != nil {
+				dynamicArn = gocf.String(strings.Join(eachEventSourceMapping.SelfManagedKafka.KafkaBootstrapServers, ","))
+			}
 			jsonBytes, jsonBytesErr := json.Marshal(dynamicArn)
-			if jsonBytesErr != nil {
+			if jsonBytesErr != nil || dynamicArn == nil {
 				jsonBytes = []byte(fmt.Sprintf("%s-EventSourceMapping[%d]",
 					eachLambda.lambdaFunctionName(),
 					index))
 			}
 			nodeName := string(jsonBytes)
+			// Use the logical name for template resources so that the node
+			// is shared with the template resource node
+			resourceRef, _ := resolveResourceRef(eachEventSourceMapping.EventSourceArn)
+			if resourceRef != nil &&
+				(resourceRef.RefType == resourceRefFunc ||
+					resourceRef.RefType == resourceGetAttrFunc) {
+				nodeName = resourceRef.ResourceName
+			}
 			writeErr = describer.writeNode(nodeName,
 				nodeColorEventSource,
 				iconForAWSResource(dynamicArn))
 			if writeErr != nil {
-				return writeErr
+				return nil, nil, writeErr
 			}
 			writeErr = describer.writeEdge(nodeName,
 				eachLambda.lambdaFunctionName(),
 				"")
 			if writeErr != nil {
-				return writeErr
+				return nil, nil, writeErr
 			}
 		}
 	}
@@ -163,11 +170,60 @@ func Describe(serviceName string,
 	// API?
 	if nil != api {
 		// TODO - delegate
-		writeErr := api.Describe(&describer)
+		writeErr := api.Describe(describer)
 		if writeErr != nil {
-			return writeErr
+			return nil, nil, writeErr
 		}
 	}
+
+	// Resources that are only in the template (eg, decorator resources and
+	// Step Functions state machines) and the downstream resources
+	var templateJSON string
+	unmarshalErr := json.Unmarshal(cloudFormationTemplate.Bytes(), &templateJSON)
+	if unmarshalErr != nil {
+		return nil, nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal CloudFormation template")
+	}
+	writeErr = describer.writeTemplateResources(serviceName,
+		lambdaAWSInfos,
+		[]byte(templateJSON))
+	if writeErr != nil {
+		return nil, nil, writeErr
+	}
+	return describer, cloudFormationTemplate.Bytes(), nil
+}
+
+// Describe produces a graphical representation of a service's Lambda and data sources.  Typically
+// automatically called as part of a compiled golang binary via the `describe` command
+// line option.
+func Describe(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	s3Site *S3Site,
+	s3BucketName string,
+	buildTags string,
+	linkFlags string,
+	outputWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	describer, cloudFormationTemplate, describeErr := describeService(serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		s3Site,
+		s3BucketName,
+		buildTags,
+		linkFlags,
+		workflowHooks,
+		logger)
+	if describeErr != nil {
+		return describeErr
+	}
+	tmpl, err := template.New("description").Parse(_escFSMustString(false, "/resources/describe/template.html"))
+	if err != nil {
+		return errors.New(err.Error())
+	}
 	cytoscapeBytes, cytoscapeBytesErr := json.MarshalIndent(describer.nodes, "", " ")
 	if cytoscapeBytesErr != nil {
 		return errors.Wrapf(cytoscapeBytesErr, "Failed to marshal cytoscape data")
@@ -185,7 +241,7 @@ func Describe(serviceName string,
 		SpartaGitHash[0:8],
 		serviceName,
 		serviceDescription,
-		cloudFormationTemplate.String(),
+		string(cloudFormationTemplate),
 		templateCSSFiles(logger),
 		templateJSFiles(logger),
 		templateImageMap(logger),
@@ -193,3 +249,26 @@ func Describe(serviceName string,
 	}
 	return tmpl.Execute(outputWriter, params)
 }
+
+// DescribeOpenAPI writes the OpenAPI 3.0 document for the service's
+// API Gateway REST API. See API.OpenAPI() for more information.
+func DescribeOpenAPI(serviceName string,
+	api APIGateway,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+
+	restAPI, restAPIOk := api.(*API)
+	if !restAPIOk || restAPI == nil {
+		return errors.Errorf("Service %s does not define a REST API (*sparta.API)",
+			serviceName)
+	}
+	openAPIBytes, openAPIBytesErr := restAPI.OpenAPI()
+	if openAPIBytesErr != nil {
+		return errors.Wrapf(openAPIBytesErr, "Failed to create OpenAPI document")
+	}
+	logger.WithFields(logrus.Fields{
+		"Resources": len(restAPI.resources),
+	}).Debug("Created OpenAPI document")
+	_, writeErr := outputWriter.Write(openAPIBytes)
+	return writeErr
+}
@@ -0,0 +1,395 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Diagram
+//
+
+// describeIgnoredResourceTypes are the CloudFormation resource type prefixes
+// that are Sparta implementation details or that are already part of the
+// graph via the LambdaAWSInfo and API data
+var describeIgnoredResourceTypes = []string{
+	"AWS::ApiGateway",
+	"AWS::CloudFormation::",
+	"AWS::CodeDeploy::",
+	"AWS::IAM::",
+	"AWS::Lambda::",
+	"AWS::Logs::",
+	"Custom::",
+}
+
+var reDescribeSubReference = regexp.MustCompile(`\$\{([^!][^}.]*)(\.[^}]*)?\}`)
+
+// describeTemplateResource is the subset of a CloudFormation resource
+// needed to find its references
+type describeTemplateResource struct {
+	Type       string
+	DependsOn  interface{}
+	Properties interface{}
+}
+
+// templateReferences returns the logical resource names referenced by
+// Ref, Fn::GetAtt and Fn::Sub expressions in the value
+func templateReferences(value interface{}, references map[string]bool) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for eachKey, eachValue := range typedValue {
+			switch eachKey {
+			case "Ref":
+				if refName, refNameOk := eachValue.(string); refNameOk {
+					references[refName] = true
+				}
+			case "Fn::GetAtt":
+				switch typedGetAtt := eachValue.(type) {
+				case string:
+					references[strings.SplitN(typedGetAtt, ".", 2)[0]] = true
+				case []interface{}:
+					if len(typedGetAtt) != 0 {
+						references[fmt.Sprintf("%v", typedGetAtt[0])] = true
+					}
+				}
+			case "Fn::Sub":
+				subString, _ := eachValue.(string)
+				if subArgs, subArgsOk := eachValue.([]interface{}); subArgsOk && len(subArgs) != 0 {
+					subString, _ = subArgs[0].(string)
+				}
+				for _, eachMatch := range reDescribeSubReference.FindAllStringSubmatch(subString, -1) {
+					references[eachMatch[1]] = true
+				}
+			}
+			templateReferences(eachValue, references)
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			templateReferences(eachValue, references)
+		}
+	}
+	for eachName := range references {
+		if strings.HasPrefix(eachName, "AWS::") {
+			delete(references, eachName)
+		}
+	}
+}
+
+// privilegeServices returns the AWS service prefixes of the privilege's
+// actions. The prefixes are used to label downstream resource edges.
+func privilegeServices(privilege IAMRolePrivilege) string {
+	services := make(map[string]bool)
+	for _, eachAction := range privilege.Actions {
+		services[strings.ToLower(strings.SplitN(eachAction, ":", 2)[0])] = true
+	}
+	serviceNames := make([]string, 0, len(services))
+	for eachService := range services {
+		serviceNames = append(serviceNames, eachService)
+	}
+	sort.Strings(serviceNames)
+	return strings.Join(serviceNames, ", ")
+}
+
+// writeTemplateResources writes the CloudFormation template resources
+// that aren't represented by the LambdaAWSInfo and API data, such as
+// decorator resources and Step Functions state machines, together with
+// the downstream resources that each Lambda function has privileges for
+func (dw *descriptionWriter) writeTemplateResources(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	templateJSON []byte) error {
+
+	var template struct {
+		Resources map[string]*describeTemplateResource
+	}
+	unmarshalErr := json.Unmarshal(templateJSON, &template)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal CloudFormation template")
+	}
+	lambdaNodeNames := make(map[string]string)
+	for _, eachLambda := range lambdaAWSInfos {
+		lambdaNodeNames[eachLambda.LogicalResourceName()] = eachLambda.lambdaFunctionName()
+	}
+	resourceNames := make([]string, 0)
+	diagramResources := make(map[string]bool)
+	for eachName, eachResource := range template.Resources {
+		ignored := false
+		for _, eachPrefix := range describeIgnoredResourceTypes {
+			ignored = ignored || strings.HasPrefix(eachResource.Type, eachPrefix)
+		}
+		if !ignored {
+			diagramResources[eachName] = true
+		}
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+
+	for _, eachName := range resourceNames {
+		if diagramResources[eachName] {
+			writeErr := dw.writeNode(eachName,
+				nodeColorResource,
+				iconForAWSResource(template.Resources[eachName].Type))
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+	}
+	// Edges between the resources and the Lambda functions
+	for _, eachName := range resourceNames {
+		resource := template.Resources[eachName]
+		references := make(map[string]bool)
+		templateReferences(resource.Properties, references)
+		referenceNames := make([]string, 0, len(references))
+		for eachReference := range references {
+			referenceNames = append(referenceNames, eachReference)
+		}
+		sort.Strings(referenceNames)
+
+		lambdaNodeName, isLambda := lambdaNodeNames[eachName]
+		switch {
+		case isLambda:
+			// Lambda functions reference their dependencies via the
+			// discovery information
+			var dependsOn []string
+			switch typedDependsOn := resource.DependsOn.(type) {
+			case string:
+				dependsOn = append(dependsOn, typedDependsOn)
+			case []interface{}:
+				for _, eachDependency := range typedDependsOn {
+					dependsOn = append(dependsOn, fmt.Sprintf("%v", eachDependency))
+				}
+			}
+			for _, eachReference := range append(referenceNames, dependsOn...) {
+				if diagramResources[eachReference] {
+					writeErr := dw.writeEdge(lambdaNodeName, eachReference, "")
+					if writeErr != nil {
+						return writeErr
+					}
+				}
+			}
+		case diagramResources[eachName]:
+			for _, eachReference := range referenceNames {
+				targetNodeName := ""
+				if referencedLambda, referencedLambdaExists := lambdaNodeNames[eachReference]; referencedLambdaExists {
+					targetNodeName = referencedLambda
+				} else if diagramResources[eachReference] {
+					targetNodeName = eachReference
+				}
+				if targetNodeName != "" {
+					writeErr := dw.writeEdge(eachName, targetNodeName, "")
+					if writeErr != nil {
+						return writeErr
+					}
+				}
+			}
+		}
+	}
+
+	// Downstream resources from the Lambda privileges
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.RoleDefinition == nil {
+			continue
+		}
+		for _, eachPrivilege := range eachLambda.RoleDefinition.Privileges {
+			var privilegeResources []interface{}
+			switch typedResource := eachPrivilege.Resource.(type) {
+			case []interface{}:
+				privilegeResources = typedResource
+			case []string:
+				for _, eachResource := range typedResource {
+					privilegeResources = append(privilegeResources, eachResource)
+				}
+			default:
+				privilegeResources = []interface{}{typedResource}
+			}
+			for _, eachResource := range privilegeResources {
+				resourceRef, resourceRefErr := resolveResourceRef(eachResource)
+				if resourceRefErr != nil || resourceRef == nil {
+					continue
+				}
+				nodeName := ""
+				switch resourceRef.RefType {
+				case resourceLiteral, resourceStringFunc:
+					if strings.HasPrefix(resourceRef.ResourceName, "arn:") {
+						// Same node name as literal event source ARNs
+						nodeNameBytes, _ := json.Marshal(resourceRef.ResourceName)
+						nodeName = string(nodeNameBytes)
+					}
+				case resourceRefFunc, resourceGetAttrFunc:
+					nodeName = resourceRef.ResourceName
+					if referencedLambda, referencedLambdaExists := lambdaNodeNames[nodeName]; referencedLambdaExists {
+						nodeName = referencedLambda
+					}
+				}
+				if nodeName == "" {
+					continue
+				}
+				writeErr := dw.writeNode(nodeName,
+					nodeColorResource,
+					iconForAWSResource(resourceRef.ResourceName))
+				if writeErr != nil {
+					return writeErr
+				}
+				writeErr = dw.writeEdge(eachLambda.lambdaFunctionName(),
+					nodeName,
+					privilegeServices(eachPrivilege))
+				if writeErr != nil {
+					return writeErr
+				}
+			}
+		}
+	}
+
+	// Connect the resources that aren't related to a function to the service
+	for _, eachName := range resourceNames {
+		if !diagramResources[eachName] {
+			continue
+		}
+		connected := false
+		for _, eachEdge := range dw.graphEdges {
+			connected = connected || eachEdge.from == eachName || eachEdge.to == eachName
+		}
+		if !connected {
+			writeErr := dw.writeEdge(eachName, serviceName, "")
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+	}
+	return nil
+}
+
+// diagramNodeIDs returns the diagram identifier for each node name
+func (dw *descriptionWriter) diagramNodeIDs() map[string]string {
+	nodeIDs := make(map[string]string)
+	for eachIndex, eachNode := range dw.graphNodes {
+		nodeIDs[eachNode.name] = fmt.Sprintf("n%d", eachIndex)
+	}
+	return nodeIDs
+}
+
+// writeMermaid writes the service graph as a Mermaid flowchart
+func (dw *descriptionWriter) writeMermaid(outputWriter io.Writer) error {
+	escape := func(value string) string {
+		return strings.Replace(value, `"`, "#quot;", -1)
+	}
+	nodeIDs := dw.diagramNodeIDs()
+	lines := []string{"flowchart LR"}
+	colorClasses := make(map[string][]string)
+	colors := make([]string, 0)
+	for _, eachNode := range dw.graphNodes {
+		nodeID := nodeIDs[eachNode.name]
+		lines = append(lines, fmt.Sprintf(`    %s["%s"]`, nodeID, escape(eachNode.label)))
+		if eachNode.color != "" {
+			if _, colorExists := colorClasses[eachNode.color]; !colorExists {
+				colors = append(colors, eachNode.color)
+			}
+			colorClasses[eachNode.color] = append(colorClasses[eachNode.color], nodeID)
+		}
+	}
+	for _, eachEdge := range dw.graphEdges {
+		fromID, fromIDExists := nodeIDs[eachEdge.from]
+		toID, toIDExists := nodeIDs[eachEdge.to]
+		if !fromIDExists || !toIDExists {
+			continue
+		}
+		if eachEdge.label != "" {
+			lines = append(lines, fmt.Sprintf(`    %s -->|"%s"| %s`, fromID, escape(eachEdge.label), toID))
+		} else {
+			lines = append(lines, fmt.Sprintf(`    %s --> %s`, fromID, toID))
+		}
+	}
+	for eachIndex, eachColor := range colors {
+		className := fmt.Sprintf("color%d", eachIndex)
+		lines = append(lines,
+			fmt.Sprintf("    classDef %s fill:%s,stroke:%s,color:#fff", className, eachColor, eachColor),
+			fmt.Sprintf("    class %s %s", strings.Join(colorClasses[eachColor], ","), className))
+	}
+	_, writeErr := io.WriteString(outputWriter, strings.Join(lines, "\n")+"\n")
+	return writeErr
+}
+
+// writeDOT writes the service graph as a Graphviz DOT digraph
+func (dw *descriptionWriter) writeDOT(serviceName string, outputWriter io.Writer) error {
+	escape := func(value string) string {
+		return strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1)
+	}
+	nodeIDs := dw.diagramNodeIDs()
+	lines := []string{fmt.Sprintf(`digraph "%s" {`, escape(serviceName)),
+		`    rankdir="LR";`,
+		`    node [shape="box", style="rounded,filled", fontcolor="white"];`,
+	}
+	for _, eachNode := range dw.graphNodes {
+		lines = append(lines, fmt.Sprintf(`    %s [label="%s", fillcolor="%s"];`,
+			nodeIDs[eachNode.name],
+			escape(eachNode.label),
+			eachNode.color))
+	}
+	for _, eachEdge := range dw.graphEdges {
+		fromID, fromIDExists := nodeIDs[eachEdge.from]
+		toID, toIDExists := nodeIDs[eachEdge.to]
+		if !fromIDExists || !toIDExists {
+			continue
+		}
+		if eachEdge.label != "" {
+			lines = append(lines, fmt.Sprintf(`    %s -> %s [label="%s"];`, fromID, toID, escape(eachEdge.label)))
+		} else {
+			lines = append(lines, fmt.Sprintf(`    %s -> %s;`, fromID, toID))
+		}
+	}
+	lines = append(lines, "}")
+	_, writeErr := io.WriteString(outputWriter, strings.Join(lines, "\n")+"\n")
+	return writeErr
+}
+
+// DescribeDiagram writes the service's event source, Lambda function,
+// API and downstream resource topology to outputWriter as a Mermaid
+// flowchart or Graphviz DOT digraph, depending on the diagramFormat. The
+// topology includes the resources added by decorators and
+// Step Functions state machines.
+func DescribeDiagram(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	s3Site *S3Site,
+	s3BucketName string,
+	buildTags string,
+	linkFlags string,
+	diagramFormat string,
+	outputWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	if diagramFormat != DescribeFormatMermaid && diagramFormat != DescribeFormatDOT {
+		return errors.Errorf("Unsupported diagram format: %s", diagramFormat)
+	}
+	describer, _, describeErr := describeService(serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		s3Site,
+		s3BucketName,
+		buildTags,
+		linkFlags,
+		workflowHooks,
+		logger)
+	if describeErr != nil {
+		return describeErr
+	}
+	if diagramFormat == DescribeFormatDOT {
+		return describer.writeDOT(serviceName, outputWriter)
+	}
+	return describer.writeMermaid(outputWriter)
+}
+
+//
+// END - Diagram
+////////////////////////////////////////////////////////////////////////////////
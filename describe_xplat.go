@@ -21,6 +21,7 @@ const (
 	nodeColorEventSource = "#BF2803"
 	nodeColorLambda      = "#F35B05"
 	nodeColorAPIGateway  = "#06B5F5"
+	nodeColorResource    = "#2E73B8"
 	nodeNameAPIGateway   = "API Gateway"
 )
 
@@ -37,6 +38,21 @@ type cytoscapeNode struct {
 	Data    cytoscapeData `json:"data"`
 	Classes string        `json:"classes,omitempty"`
 }
+
+// describeNode is a service graph node used by the diagram formats
+type describeNode struct {
+	name  string
+	label string
+	color string
+}
+
+// describeEdge is a service graph edge used by the diagram formats
+type describeEdge struct {
+	from  string
+	to    string
+	label string
+}
+
 type templateResource struct {
 	KeyName string
 	Data    string
@@ -58,12 +74,28 @@ func cytoscapeNodeID(rawData interface{}) (string, error) {
 type descriptionWriter struct {
 	nodes  []*cytoscapeNode
 	logger *logrus.Logger
+	// graphNodes and graphEdges are the unique nodes and edges
+	graphNodes []*describeNode
+	graphEdges []*describeEdge
+}
+
+// hasNode returns true if the node was already written
+func (dw *descriptionWriter) hasNode(nodeName string) bool {
+	for _, eachNode := range dw.graphNodes {
+		if eachNode.name == nodeName {
+			return true
+		}
+	}
+	return false
 }
 
 func (dw *descriptionWriter) writeNode(nodeName string,
 	nodeColor string,
 	nodeImage string) error {
 
+	if dw.hasNode(nodeName) {
+		return nil
+	}
 	nodeID, nodeErr := cytoscapeNodeID(nodeName)
 	if nodeErr != nil {
 		return errors.Wrapf(nodeErr,
@@ -84,6 +116,11 @@ func (dw *descriptionWriter) writeNode(nodeName string,
 		}
 	}
 	dw.nodes = append(dw.nodes, appendNode)
+	dw.graphNodes = append(dw.graphNodes, &describeNode{
+		name:  nodeName,
+		label: appendNode.Data.Label,
+		color: nodeColor,
+	})
 	return nil
 }
 
@@ -91,6 +128,13 @@ func (dw *descriptionWriter) writeEdge(fromNode string,
 	toNode string,
 	label string) error {
 
+	for _, eachEdge := range dw.graphEdges {
+		if eachEdge.from == fromNode &&
+			eachEdge.to == toNode &&
+			eachEdge.label == label {
+			return nil
+		}
+	}
 	nodeSource, nodeSourceErr := cytoscapeNodeID(fromNode)
 	if nodeSourceErr != nil {
 		return errors.Wrapf(nodeSourceErr,
@@ -112,6 +156,11 @@ func (dw *descriptionWriter) writeEdge(fromNode string,
 			Label:  label,
 		},
 	})
+	dw.graphEdges = append(dw.graphEdges, &describeEdge{
+		from:  fromNode,
+		to:    toNode,
+		label: label,
+	})
 	return nil
 }
 
@@ -0,0 +1,476 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	spartaCWLogs "github.com/mweagle/Sparta/aws/cloudwatch/logs"
+	"github.com/mweagle/Sparta/system"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// devMaxZipFileSize is the maximum size of the code archive that
+	// UpdateFunctionCode accepts without an S3 upload
+	devMaxZipFileSize = 50 * 1024 * 1024
+	// devWatchPollInterval is how often the source files are checked for
+	// changes in watch mode
+	devWatchPollInterval = 500 * time.Millisecond
+	// devWatchDebounce is how long the source files must be unchanged
+	// before the service is rebuilt
+	devWatchDebounce = 750 * time.Millisecond
+)
+
+// devFunctionTarget is a provisioned function updated by the dev command
+type devFunctionTarget struct {
+	logicalResourceID string
+	functionName      string
+}
+
+// devFunctionTargets returns the provisioned functions for the requested
+// names, which are either function names or logical resource IDs. All the
+// functions are returned if no names are requested.
+func devFunctionTargets(requestedNames []string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	provisionedFunctions map[string]string) ([]*devFunctionTarget, error) {
+
+	// Map of logical resource IDs to physical function names
+	physicalNames := make(map[string]string, len(provisionedFunctions))
+	for eachPhysicalName, eachLogicalResourceID := range provisionedFunctions {
+		physicalNames[eachLogicalResourceID] = eachPhysicalName
+	}
+	matchedNames := make(map[string]bool)
+	targets := []*devFunctionTarget{}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		functionName := eachLambdaInfo.lambdaFunctionName()
+		logicalResourceID := eachLambdaInfo.LogicalResourceName()
+		if len(requestedNames) != 0 &&
+			!stringInSlice(functionName, requestedNames) &&
+			!stringInSlice(logicalResourceID, requestedNames) {
+			continue
+		}
+		matchedNames[functionName] = true
+		matchedNames[logicalResourceID] = true
+		physicalName, physicalNameExists := physicalNames[logicalResourceID]
+		if !physicalNameExists {
+			return nil, errors.Errorf("Function %s isn't provisioned. Provision the service before using dev",
+				functionName)
+		}
+		targets = append(targets, &devFunctionTarget{
+			logicalResourceID: logicalResourceID,
+			functionName:      physicalName,
+		})
+	}
+	for _, eachRequestedName := range requestedNames {
+		if !matchedNames[eachRequestedName] {
+			return nil, errors.Errorf("Unknown function: %s", eachRequestedName)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("No functions to update")
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].logicalResourceID < targets[j].logicalResourceID
+	})
+	return targets, nil
+}
+
+// devArchiveHash returns the SHA256 hash of the code archive entries. The
+// hash includes each entry's name, mode and contents, but not the
+// modification times, so rebuilding unchanged inputs produces the same
+// hash.
+func devArchiveHash(archive []byte) (string, error) {
+	zipReader, zipReaderErr := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if zipReaderErr != nil {
+		return "", errors.Wrapf(zipReaderErr, "Failed to read code archive")
+	}
+	entries := make([]*zip.File, 0, len(zipReader.File))
+	entries = append(entries, zipReader.File...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	archiveHash := sha256.New()
+	for _, eachEntry := range entries {
+		fmt.Fprintf(archiveHash, "%s\x00%o\x00%d\x00",
+			eachEntry.Name,
+			eachEntry.Mode(),
+			eachEntry.UncompressedSize64)
+		entryReader, entryReaderErr := eachEntry.Open()
+		if entryReaderErr != nil {
+			return "", errors.Wrapf(entryReaderErr, "Failed to read archive entry: %s", eachEntry.Name)
+		}
+		_, copyErr := io.Copy(archiveHash, entryReader)
+		closeErr := entryReader.Close()
+		if copyErr == nil {
+			copyErr = closeErr
+		}
+		if copyErr != nil {
+			return "", errors.Wrapf(copyErr, "Failed to read archive entry: %s", eachEntry.Name)
+		}
+	}
+	return hex.EncodeToString(archiveHash.Sum(nil)), nil
+}
+
+// devCodeArchive builds the service binary and returns the code archive
+// and its devArchiveHash. The archive is created by the same builder as the
+// provision package step, so it includes the ArchiveHooks files.
+func devCodeArchive(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	workflowHooks *WorkflowHooks,
+	buildTags string,
+	linkFlags string,
+	awsSession *session.Session,
+	logger *logrus.Logger) ([]byte, string, error) {
+
+	buildID, buildIDErr := provisionBuildID("", logger)
+	if buildIDErr != nil {
+		return nil, "", buildIDErr
+	}
+	buildErr := system.BuildGoBinary(serviceName,
+		SpartaBinaryName,
+		false,
+		buildID,
+		buildTags,
+		linkFlags,
+		false,
+		logger)
+	if buildErr != nil {
+		return nil, "", buildErr
+	}
+	defer func() {
+		errRemove := os.Remove(SpartaBinaryName)
+		if nil != errRemove {
+			logger.WithFields(logrus.Fields{
+				"File":  SpartaBinaryName,
+				"Error": errRemove,
+			}).Warn("Failed to delete binary")
+		}
+	}()
+
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName:    serviceName,
+			buildID:        buildID,
+			lambdaAWSInfos: lambdaAWSInfos,
+			workflowHooks:  workflowHooks,
+		},
+		context: provisionContext{
+			binaryName:           SpartaBinaryName,
+			awsSession:           awsSession,
+			workflowHooksContext: NewWorkflowHookContext(nil),
+		},
+	}
+	if workflowHooks != nil {
+		ctx.context.workflowHooksContext = NewWorkflowHookContext(workflowHooks.Context)
+	}
+	var archive bytes.Buffer
+	lambdaArchive := zip.NewWriter(&archive)
+	archiveErr := writeCodeArchive(lambdaArchive, ctx)
+	if archiveErr != nil {
+		return nil, "", archiveErr
+	}
+	closeErr := lambdaArchive.Close()
+	if closeErr != nil {
+		return nil, "", closeErr
+	}
+	if archive.Len() > devMaxZipFileSize {
+		return nil, "", errors.Errorf("Code archive size (%d bytes) exceeds the %d byte direct upload limit. Use `provision --inplace` instead",
+			archive.Len(),
+			devMaxZipFileSize)
+	}
+	archiveHash, archiveHashErr := devArchiveHash(archive.Bytes())
+	if archiveHashErr != nil {
+		return nil, "", archiveHashErr
+	}
+	return archive.Bytes(), archiveHash, nil
+}
+
+// devUpdateFunctionCode updates the code of the target functions
+func devUpdateFunctionCode(targets []*devFunctionTarget,
+	zipFile []byte,
+	lambdaSvc lambdaiface.LambdaAPI,
+	logger *logrus.Logger) error {
+
+	updateTaskMaker := func(target *devFunctionTarget) taskFunc {
+		return func() workResult {
+			updateOutput, updateErr := lambdaSvc.UpdateFunctionCode(&lambda.UpdateFunctionCodeInput{
+				FunctionName: aws.String(target.functionName),
+				ZipFile:      zipFile,
+			})
+			if updateErr != nil {
+				return newTaskResult("", errors.Wrapf(updateErr,
+					"Failed to update function: %s",
+					target.logicalResourceID))
+			}
+			logger.WithFields(logrus.Fields{
+				"Function":     target.logicalResourceID,
+				"CodeSha256":   aws.StringValue(updateOutput.CodeSha256),
+				"LastModified": aws.StringValue(updateOutput.LastModified),
+			}).Info("Updated function code")
+			return newTaskResult(updateOutput, nil)
+		}
+	}
+	updateTasks := make([]*workTask, len(targets))
+	for eachIndex, eachTarget := range targets {
+		updateTasks[eachIndex] = newWorkTask(updateTaskMaker(eachTarget))
+	}
+	p := newWorkerPool(updateTasks, len(updateTasks))
+	_, asyncErrors := p.Run()
+	if len(asyncErrors) != 0 {
+		return fmt.Errorf("failed to update function code: %v", asyncErrors)
+	}
+	return nil
+}
+
+// devTailLogs logs the CloudWatch Logs events of the target functions until
+// closeChan is closed
+func devTailLogs(targets []*devFunctionTarget,
+	awsSession *session.Session,
+	closeChan chan bool,
+	logger *logrus.Logger) {
+
+	for _, eachTarget := range targets {
+		messages := spartaCWLogs.TailWithContext(context.Background(),
+			closeChan,
+			awsSession,
+			fmt.Sprintf("/aws/lambda/%s", eachTarget.functionName),
+			"",
+			logger)
+		go func(logicalResourceID string) {
+			for {
+				select {
+				case event := <-messages:
+					logger.WithField("Function", logicalResourceID).
+						Info(strings.TrimSpace(aws.StringValue(event.Message)))
+				case <-closeChan:
+					return
+				}
+			}
+		}(eachTarget.logicalResourceID)
+	}
+}
+
+// devSourceSnapshot returns the modification times of the Go source and
+// module files in the rootDir tree. Hidden and vendor directories are
+// skipped.
+func devSourceSnapshot(rootDir string) (map[string]time.Time, error) {
+	snapshot := make(map[string]time.Time)
+	walkErr := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may be deleted during the walk
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != rootDir &&
+				(strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum" {
+			snapshot[path] = info.ModTime()
+		}
+		return nil
+	})
+	return snapshot, walkErr
+}
+
+// devSourceChanges returns the sorted paths that were added, modified or
+// deleted between the snapshots
+func devSourceChanges(previous map[string]time.Time, current map[string]time.Time) []string {
+	changes := []string{}
+	for eachPath, eachModTime := range current {
+		previousModTime, previousExists := previous[eachPath]
+		if !previousExists || !previousModTime.Equal(eachModTime) {
+			changes = append(changes, eachPath)
+		}
+	}
+	for eachPath := range previous {
+		if _, currentExists := current[eachPath]; !currentExists {
+			changes = append(changes, eachPath)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// devWatch polls the rootDir source files and calls update after the files
+// are unchanged for the debounce interval. Update errors are logged rather
+// than returned so that the next change can fix them. It returns when a
+// signal is received.
+func devWatch(rootDir string,
+	update func() error,
+	signals <-chan os.Signal,
+	logger *logrus.Logger) error {
+
+	snapshot, snapshotErr := devSourceSnapshot(rootDir)
+	if snapshotErr != nil {
+		return snapshotErr
+	}
+	logger.WithFields(logrus.Fields{
+		"Directory": rootDir,
+		"FileCount": len(snapshot),
+	}).Info("Watching for source changes. Press Ctrl+C to exit.")
+
+	ticker := time.NewTicker(devWatchPollInterval)
+	defer ticker.Stop()
+	pendingChanges := []string{}
+	var lastChangeTime time.Time
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			currentSnapshot, currentSnapshotErr := devSourceSnapshot(rootDir)
+			if currentSnapshotErr != nil {
+				logger.WithField("Error", currentSnapshotErr).Warn("Failed to scan source files")
+				continue
+			}
+			changes := devSourceChanges(snapshot, currentSnapshot)
+			snapshot = currentSnapshot
+			if len(changes) != 0 {
+				for _, eachChange := range changes {
+					if !stringInSlice(eachChange, pendingChanges) {
+						pendingChanges = append(pendingChanges, eachChange)
+					}
+				}
+				lastChangeTime = time.Now()
+				continue
+			}
+			if len(pendingChanges) == 0 || time.Since(lastChangeTime) < devWatchDebounce {
+				continue
+			}
+			changedFiles := make([]string, len(pendingChanges))
+			for eachIndex, eachChange := range pendingChanges {
+				changedFiles[eachIndex] = relativePath(eachChange)
+			}
+			logger.WithField("Files", strings.Join(changedFiles, ", ")).Info("Source changed")
+			pendingChanges = []string{}
+			updateErr := update()
+			if updateErr != nil {
+				logger.WithField("Error", updateErr).Error("Dev update failed")
+			}
+		}
+	}
+}
+
+// Dev is the command that builds the service binary and updates the code of
+// the provisioned functions with the Lambda API. It skips the template, the
+// S3 upload and CloudFormation, so the stack no longer reflects the deployed
+// code. It's intended for development stacks. In watch mode, the functions
+// are rebuilt and updated when the source files change.
+func Dev(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	options *DevOptions,
+	buildTags string,
+	linkFlags string,
+	logger *logrus.Logger) error {
+
+	if options == nil {
+		options = &DevOptions{}
+	}
+	awsSession := newWorkflowSession(options.Localstack, logger)
+	var injectedClients *AWSClients
+	if options.WorkflowHooks != nil {
+		injectedClients = options.WorkflowHooks.AWSClients
+	}
+	awsClients := newAWSClients(awsSession, injectedClients)
+	provisionedFunctions := make(map[string]string)
+	functionsErr := stackLambdaFunctions(awsClients.CloudFormation,
+		serviceName,
+		provisionedFunctions)
+	if functionsErr != nil {
+		return functionsErr
+	}
+	targets, targetsErr := devFunctionTargets(options.Functions,
+		lambdaAWSInfos,
+		provisionedFunctions)
+	if targetsErr != nil {
+		return targetsErr
+	}
+	lambdaSvc := awsClients.Lambda
+	deployedArchiveHash := ""
+	update := func() error {
+		startTime := time.Now()
+		zipFile, archiveHash, zipFileErr := devCodeArchive(serviceName,
+			lambdaAWSInfos,
+			options.WorkflowHooks,
+			buildTags,
+			linkFlags,
+			awsSession,
+			logger)
+		if zipFileErr != nil {
+			return zipFileErr
+		}
+		if archiveHash == deployedArchiveHash {
+			logger.Info("Code archive is unchanged. Skipping update.")
+			return nil
+		}
+		logger.WithFields(logrus.Fields{
+			"FunctionCount": len(targets),
+			"CodeSize":      len(zipFile),
+		}).Info("Updating function code")
+		updateErr := devUpdateFunctionCode(targets,
+			zipFile,
+			lambdaSvc,
+			logger)
+		if updateErr != nil {
+			return updateErr
+		}
+		deployedArchiveHash = archiveHash
+		logger.WithFields(logrus.Fields{
+			"Duration": time.Since(startTime).String(),
+		}).Info("Dev update complete")
+		return nil
+	}
+	updateErr := update()
+	if updateErr != nil {
+		return updateErr
+	}
+	if !options.Tail && !options.Watch {
+		return nil
+	}
+	// Watch mode always streams the logs
+	closeChan := make(chan bool)
+	defer close(closeChan)
+	devTailLogs(targets, awsSession, closeChan, logger)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	if options.Watch {
+		workingDir, workingDirErr := os.Getwd()
+		if workingDirErr != nil {
+			return workingDirErr
+		}
+		return devWatch(workingDir, update, signals, logger)
+	}
+	logger.Info("Tailing function logs. Press Ctrl+C to exit.")
+	<-signals
+	return nil
+}
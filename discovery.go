@@ -1,11 +1,23 @@
 package sparta
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,6 +25,7 @@ import (
 var discoverImpl func() (*DiscoveryInfo, error)
 
 var cachedDiscoveryInfo *DiscoveryInfo
+var cachedDiscoveryInfoMutex sync.Mutex
 
 ////////////////////////////////////////////////////////////////////////////////
 // START - DiscoveryResource
@@ -69,6 +82,9 @@ func Discover() (*DiscoveryInfo, error) {
 func initializeDiscovery(logger *logrus.Logger) {
 	// Setup the discoveryImpl reference
 	discoverImpl = func() (*DiscoveryInfo, error) {
+		cachedDiscoveryInfoMutex.Lock()
+		defer cachedDiscoveryInfoMutex.Unlock()
+
 		// Cached info?
 		if cachedDiscoveryInfo != nil {
 			return cachedDiscoveryInfo, nil
@@ -98,3 +114,166 @@ func initializeDiscovery(logger *logrus.Logger) {
 		return cachedDiscoveryInfo, decodedErr
 	}
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// START - CrossStackDiscovery
+//
+
+// crossStackParameterPrefix is the SSM Parameter Store path prefix for
+// values published by decorator.CrossStackExportDecorator
+const crossStackParameterPrefix = "/sparta"
+
+// CrossStackExportName returns the CloudFormation export name for a value
+// that serviceName publishes for other Sparta services
+func CrossStackExportName(serviceName string, name string) string {
+	return fmt.Sprintf("%s-%s", serviceName, name)
+}
+
+// CrossStackParameterName returns the SSM parameter name for a value that
+// serviceName publishes for other Sparta services
+func CrossStackParameterName(serviceName string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", crossStackParameterPrefix, serviceName, name)
+}
+
+// CrossStackDiscoveryPrivileges returns the privileges a function requires
+// to resolve the values published by serviceName with
+// DiscoveryInfo.CrossStackResource. Add them to the function's
+// IAMRoleDefinition.
+func CrossStackDiscoveryPrivileges(serviceName string) []IAMRolePrivilege {
+	return []IAMRolePrivilege{
+		{
+			Actions: []string{"ssm:GetParameter"},
+			Resource: gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":ssm:"),
+				gocf.Ref("AWS::Region"),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId"),
+				gocf.String(":parameter"+CrossStackParameterName(serviceName, "*"))),
+		},
+		{
+			// ListExports doesn't support resource level permissions
+			Actions:  []string{"cloudformation:ListExports"},
+			Resource: wildcardArn,
+		},
+	}
+}
+
+// Cache of resolved cross stack values, keyed by export name, that is
+// shared by all invocations in the same execution environment
+var crossStackValues = make(map[string]string)
+var crossStackValuesMutex sync.Mutex
+
+// lookupCrossStackParameter returns the SSM parameter value, or the empty
+// string if the parameter doesn't exist
+func lookupCrossStackParameter(ctx context.Context,
+	ssmSvc ssmiface.SSMAPI,
+	parameterName string) (string, error) {
+	output, outputErr := ssmSvc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name: aws.String(parameterName),
+	})
+	if outputErr != nil {
+		if awsErr, awsErrOk := outputErr.(awserr.Error); awsErrOk &&
+			awsErr.Code() == ssm.ErrCodeParameterNotFound {
+			return "", nil
+		}
+		return "", errors.Wrapf(outputErr, "Failed to get parameter %s", parameterName)
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+// lookupCrossStackExport returns the CloudFormation export value, or the
+// empty string if the export doesn't exist
+func lookupCrossStackExport(ctx context.Context,
+	cfSvc cloudformationiface.CloudFormationAPI,
+	exportName string) (string, error) {
+	exportValue := ""
+	listErr := cfSvc.ListExportsPagesWithContext(ctx,
+		&cloudformation.ListExportsInput{},
+		func(page *cloudformation.ListExportsOutput, lastPage bool) bool {
+			for _, eachExport := range page.Exports {
+				if aws.StringValue(eachExport.Name) == exportName {
+					exportValue = aws.StringValue(eachExport.Value)
+					return false
+				}
+			}
+			return true
+		})
+	if listErr != nil {
+		return "", errors.Wrapf(listErr, "Failed to list CloudFormation exports")
+	}
+	return exportValue, nil
+}
+
+// resolveCrossStackResource returns the value that serviceName published
+// with the given name. SSM parameters are checked before CloudFormation
+// exports.
+func resolveCrossStackResource(ctx context.Context,
+	ssmSvc ssmiface.SSMAPI,
+	cfSvc cloudformationiface.CloudFormationAPI,
+	serviceName string,
+	name string) (string, error) {
+	exportName := CrossStackExportName(serviceName, name)
+	crossStackValuesMutex.Lock()
+	defer crossStackValuesMutex.Unlock()
+	if cachedValue, cachedValueExists := crossStackValues[exportName]; cachedValueExists {
+		return cachedValue, nil
+	}
+	value, lookupErr := lookupCrossStackParameter(ctx,
+		ssmSvc,
+		CrossStackParameterName(serviceName, name))
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+	if value == "" {
+		value, lookupErr = lookupCrossStackExport(ctx, cfSvc, exportName)
+		if lookupErr != nil {
+			return "", lookupErr
+		}
+	}
+	if value == "" {
+		return "", errors.Errorf("Service %s does not export %s (SSM parameter: %s, CloudFormation export: %s)",
+			serviceName,
+			name,
+			CrossStackParameterName(serviceName, name),
+			exportName)
+	}
+	crossStackValues[exportName] = value
+	return value, nil
+}
+
+// CrossStackResource returns the value that another Sparta service
+// published with decorator.CrossStackExportDecorator (eg, a queue URL or
+// table name). Values are resolved from SSM Parameter Store or
+// CloudFormation exports the first time they are requested and then cached
+// for the lifetime of the execution environment. The AWS session is read
+// from the ContextKeyAWSSession value, if available, and the
+// ContextKeyAWSClients value replaces the clients created from it. The
+// function requires the CrossStackDiscoveryPrivileges for the service.
+func (info *DiscoveryInfo) CrossStackResource(ctx context.Context,
+	serviceName string,
+	name string) (string, error) {
+	if strings.TrimSpace(serviceName) == "" || strings.TrimSpace(name) == "" {
+		return "", errors.Errorf("CrossStackResource requires a service name and a value name")
+	}
+	awsSession, awsSessionOk := ctx.Value(ContextKeyAWSSession).(*session.Session)
+	if !awsSessionOk || awsSession == nil {
+		newSession, newSessionErr := session.NewSession()
+		if newSessionErr != nil {
+			return "", errors.Wrapf(newSessionErr, "Failed to create AWS session")
+		}
+		awsSession = newSession
+	}
+	injectedClients, _ := ctx.Value(ContextKeyAWSClients).(*AWSClients)
+	awsClients := newAWSClients(awsSession, injectedClients)
+	return resolveCrossStackResource(ctx,
+		awsClients.SSM,
+		awsClients.CloudFormation,
+		serviceName,
+		name)
+}
+
+//
+// END - CrossStackDiscovery
+////////////////////////////////////////////////////////////////////////////////
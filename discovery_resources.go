@@ -0,0 +1,198 @@
+package sparta
+
+import (
+	"sort"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Typed DiscoveryResources
+//
+
+// DiscoveredS3Bucket is the typed discovery information for an
+// AWS::S3::Bucket dependency
+type DiscoveredS3Bucket struct {
+	// ResourceID is the CloudFormation logical resource ID
+	ResourceID string
+	// BucketName is the Ref value
+	BucketName          string
+	Arn                 string
+	DomainName          string
+	DualStackDomainName string
+	RegionalDomainName  string
+	WebsiteURL          string
+}
+
+// DiscoveredDynamoTable is the typed discovery information for an
+// AWS::DynamoDB::Table dependency
+type DiscoveredDynamoTable struct {
+	// ResourceID is the CloudFormation logical resource ID
+	ResourceID string
+	// TableName is the Ref value
+	TableName string
+	Arn       string
+	// StreamArn is empty if the table doesn't define a stream
+	StreamArn string
+}
+
+// DiscoveredSNSTopic is the typed discovery information for an
+// AWS::SNS::Topic dependency
+type DiscoveredSNSTopic struct {
+	// ResourceID is the CloudFormation logical resource ID
+	ResourceID string
+	// TopicArn is the Ref value
+	TopicArn  string
+	TopicName string
+}
+
+// DiscoveredSQSQueue is the typed discovery information for an
+// AWS::SQS::Queue dependency
+type DiscoveredSQSQueue struct {
+	// ResourceID is the CloudFormation logical resource ID
+	ResourceID string
+	// QueueURL is the Ref value
+	QueueURL  string
+	Arn       string
+	QueueName string
+}
+
+// typedResource returns the named dependency if it has the expected type
+func (info *DiscoveryInfo) typedResource(resourceID string,
+	resourceType string) (*DiscoveryResource, error) {
+	resource, resourceExists := info.Resources[resourceID]
+	if !resourceExists {
+		return nil, errors.Errorf("Resource %s is not a dependency of this function", resourceID)
+	}
+	if resource.ResourceType != resourceType {
+		return nil, errors.Errorf("Resource %s is a %s, not a %s",
+			resourceID,
+			resource.ResourceType,
+			resourceType)
+	}
+	return &resource, nil
+}
+
+// typedResourceIDs returns the sorted logical IDs of the dependencies with
+// the given type
+func (info *DiscoveryInfo) typedResourceIDs(resourceType string) []string {
+	resourceIDs := make([]string, 0)
+	for eachID, eachResource := range info.Resources {
+		if eachResource.ResourceType == resourceType {
+			resourceIDs = append(resourceIDs, eachID)
+		}
+	}
+	sort.Strings(resourceIDs)
+	return resourceIDs
+}
+
+// S3Bucket returns the typed discovery information for the S3 bucket
+// dependency with the given logical resource ID
+func (info *DiscoveryInfo) S3Bucket(resourceID string) (*DiscoveredS3Bucket, error) {
+	resource, resourceErr := info.typedResource(resourceID, gocf.S3Bucket{}.CfnResourceType())
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	return &DiscoveredS3Bucket{
+		ResourceID:          resource.ResourceID,
+		BucketName:          resource.ResourceRef,
+		Arn:                 resource.Properties["Arn"],
+		DomainName:          resource.Properties["DomainName"],
+		DualStackDomainName: resource.Properties["DualStackDomainName"],
+		RegionalDomainName:  resource.Properties["RegionalDomainName"],
+		WebsiteURL:          resource.Properties["WebsiteURL"],
+	}, nil
+}
+
+// S3Buckets returns the typed discovery information for every S3 bucket
+// dependency, ordered by logical resource ID
+func (info *DiscoveryInfo) S3Buckets() []*DiscoveredS3Bucket {
+	buckets := make([]*DiscoveredS3Bucket, 0)
+	for _, eachID := range info.typedResourceIDs(gocf.S3Bucket{}.CfnResourceType()) {
+		bucket, _ := info.S3Bucket(eachID)
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// DynamoTable returns the typed discovery information for the DynamoDB
+// table dependency with the given logical resource ID
+func (info *DiscoveryInfo) DynamoTable(resourceID string) (*DiscoveredDynamoTable, error) {
+	resource, resourceErr := info.typedResource(resourceID, gocf.DynamoDBTable{}.CfnResourceType())
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	return &DiscoveredDynamoTable{
+		ResourceID: resource.ResourceID,
+		TableName:  resource.ResourceRef,
+		Arn:        resource.Properties["Arn"],
+		StreamArn:  resource.Properties["StreamArn"],
+	}, nil
+}
+
+// DynamoTables returns the typed discovery information for every DynamoDB
+// table dependency, ordered by logical resource ID
+func (info *DiscoveryInfo) DynamoTables() []*DiscoveredDynamoTable {
+	tables := make([]*DiscoveredDynamoTable, 0)
+	for _, eachID := range info.typedResourceIDs(gocf.DynamoDBTable{}.CfnResourceType()) {
+		table, _ := info.DynamoTable(eachID)
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// SNSTopic returns the typed discovery information for the SNS topic
+// dependency with the given logical resource ID
+func (info *DiscoveryInfo) SNSTopic(resourceID string) (*DiscoveredSNSTopic, error) {
+	resource, resourceErr := info.typedResource(resourceID, gocf.SNSTopic{}.CfnResourceType())
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	return &DiscoveredSNSTopic{
+		ResourceID: resource.ResourceID,
+		TopicArn:   resource.ResourceRef,
+		TopicName:  resource.Properties["TopicName"],
+	}, nil
+}
+
+// SNSTopics returns the typed discovery information for every SNS topic
+// dependency, ordered by logical resource ID
+func (info *DiscoveryInfo) SNSTopics() []*DiscoveredSNSTopic {
+	topics := make([]*DiscoveredSNSTopic, 0)
+	for _, eachID := range info.typedResourceIDs(gocf.SNSTopic{}.CfnResourceType()) {
+		topic, _ := info.SNSTopic(eachID)
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// SQSQueue returns the typed discovery information for the SQS queue
+// dependency with the given logical resource ID
+func (info *DiscoveryInfo) SQSQueue(resourceID string) (*DiscoveredSQSQueue, error) {
+	resource, resourceErr := info.typedResource(resourceID, gocf.SQSQueue{}.CfnResourceType())
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	return &DiscoveredSQSQueue{
+		ResourceID: resource.ResourceID,
+		QueueURL:   resource.ResourceRef,
+		Arn:        resource.Properties["Arn"],
+		QueueName:  resource.Properties["QueueName"],
+	}, nil
+}
+
+// SQSQueues returns the typed discovery information for every SQS queue
+// dependency, ordered by logical resource ID
+func (info *DiscoveryInfo) SQSQueues() []*DiscoveredSQSQueue {
+	queues := make([]*DiscoveredSQSQueue, 0)
+	for _, eachID := range info.typedResourceIDs(gocf.SQSQueue{}.CfnResourceType()) {
+		queue, _ := info.SQSQueue(eachID)
+		queues = append(queues, queue)
+	}
+	return queues
+}
+
+//
+// END - Typed DiscoveryResources
+////////////////////////////////////////////////////////////////////////////////
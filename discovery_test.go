@@ -1,10 +1,19 @@
 package sparta
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"os"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 )
 
 var discoveryDataNoTags = `
@@ -78,3 +87,123 @@ func TestDiscoveryEmptyMetadata(t *testing.T) {
 	}
 	t.Logf("Discovery Info: %#v", info)
 }
+
+func TestDiscoveryTypedResources(t *testing.T) {
+	var info DiscoveryInfo
+	err := json.Unmarshal([]byte(discoveryDataNoTags), &info)
+	if nil != err {
+		t.Fatalf("Failed to unmarshal discovery data: %s", err)
+	}
+	resourceID := "DynamoDBad8db2fc80a1af0b5bacfbc66b5ae671301d5e96"
+	table, tableErr := info.DynamoTable(resourceID)
+	if tableErr != nil {
+		t.Fatalf("Failed to get typed DynamoDB table: %s", tableErr)
+	}
+	if table.TableName != "SpartaDDB-mweagle-DynamoDBad8db2fc80a1af0b5bacfbc66b5ae671301d5e96-1EU295I6O4XJH" ||
+		table.StreamArn == "" {
+		t.Fatalf("Unexpected typed DynamoDB table: %#v", table)
+	}
+	if len(info.DynamoTables()) != 1 || len(info.S3Buckets()) != 0 {
+		t.Fatalf("Unexpected typed resource counts")
+	}
+	if _, bucketErr := info.S3Bucket(resourceID); bucketErr == nil {
+		t.Fatalf("Failed to reject mismatched resource type")
+	}
+	if _, topicErr := info.SNSTopic("UndefinedTopic"); topicErr == nil {
+		t.Fatalf("Failed to reject undefined resource")
+	}
+}
+
+type mockCrossStackSSM struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (mock *mockCrossStackSSM) GetParameterWithContext(ctx aws.Context,
+	input *ssm.GetParameterInput,
+	opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	value, exists := mock.parameters[aws.StringValue(input.Name)]
+	if !exists {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Value: aws.String(value)},
+	}, nil
+}
+
+type mockCrossStackCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	exports   map[string]string
+	listCalls int
+}
+
+func (mock *mockCrossStackCloudFormation) ListExportsPagesWithContext(ctx aws.Context,
+	input *cloudformation.ListExportsInput,
+	fn func(*cloudformation.ListExportsOutput, bool) bool,
+	opts ...request.Option) error {
+	mock.listCalls++
+	page := &cloudformation.ListExportsOutput{}
+	for eachName, eachValue := range mock.exports {
+		page.Exports = append(page.Exports, &cloudformation.Export{
+			Name:  aws.String(eachName),
+			Value: aws.String(eachValue),
+		})
+	}
+	fn(page, true)
+	return nil
+}
+
+func TestCrossStackResource(t *testing.T) {
+	ssmSvc := &mockCrossStackSSM{
+		parameters: map[string]string{
+			CrossStackParameterName("OrdersService", "QueueURL"): "https://sqs.us-west-2.amazonaws.com/123412341234/orders",
+		},
+	}
+	cfSvc := &mockCrossStackCloudFormation{
+		exports: map[string]string{
+			CrossStackExportName("OrdersService", "TableName"): "OrdersTable-1234",
+		},
+	}
+	testCases := map[string]string{
+		"QueueURL":  "https://sqs.us-west-2.amazonaws.com/123412341234/orders",
+		"TableName": "OrdersTable-1234",
+	}
+	for eachName, eachExpected := range testCases {
+		value, valueErr := resolveCrossStackResource(context.Background(),
+			ssmSvc,
+			cfSvc,
+			"OrdersService",
+			eachName)
+		if valueErr != nil || value != eachExpected {
+			t.Fatalf("Failed to resolve %s: %s (%v)", eachName, value, valueErr)
+		}
+	}
+	// Resolved values are cached
+	_, valueErr := resolveCrossStackResource(context.Background(),
+		ssmSvc,
+		cfSvc,
+		"OrdersService",
+		"TableName")
+	if valueErr != nil || cfSvc.listCalls != 1 {
+		t.Fatalf("Failed to cache cross stack value: %d calls (%v)", cfSvc.listCalls, valueErr)
+	}
+	_, valueErr = resolveCrossStackResource(context.Background(),
+		ssmSvc,
+		cfSvc,
+		"OrdersService",
+		"Undefined")
+	if valueErr == nil {
+		t.Fatalf("Failed to reject undefined cross stack value")
+	}
+	// Clients in the context replace the session clients
+	ssmSvc.parameters[CrossStackParameterName("BillingService", "TopicArn")] = "arn:aws:sns:us-west-2:123412341234:billing"
+	ctx := context.WithValue(context.Background(), ContextKeyAWSClients, &AWSClients{
+		SSM:            ssmSvc,
+		CloudFormation: cfSvc,
+	})
+	info := &DiscoveryInfo{}
+	value, valueErr := info.CrossStackResource(ctx, "BillingService", "TopicArn")
+	if valueErr != nil || value != "arn:aws:sns:us-west-2:123412341234:billing" {
+		t.Fatalf("Failed to resolve cross stack value with context clients: %s (%v)", value, valueErr)
+	}
+}
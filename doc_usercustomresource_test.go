@@ -58,7 +58,7 @@ func ExampleLambdaAWSInfo_RequireCustomResource() {
 		S3Key string,
 		buildID string,
 		cfTemplate *gocf.Template,
-		context map[string]interface{},
+		context *WorkflowHookContext,
 		logger *logrus.Logger) error {
 
 		// Pass CustomResource outputs to the λ function
@@ -26,7 +26,7 @@ func helloZipLambda(ctx context.Context,
 	return "Event processed", nil
 }
 
-func archiveHook(context map[string]interface{},
+func archiveHook(context *WorkflowHookContext,
 	serviceName string,
 	zipWriter *zip.Writer,
 	awsSession *session.Session,
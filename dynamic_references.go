@@ -0,0 +1,293 @@
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - DynamicReferences
+//
+
+const (
+	// DynamicReferenceSSM is the {{resolve:ssm:name:version}} dynamic
+	// reference to an SSM String or StringList parameter
+	DynamicReferenceSSM = "ssm"
+	// DynamicReferenceSSMSecure is the {{resolve:ssm-secure:name:version}}
+	// dynamic reference to an SSM SecureString parameter
+	DynamicReferenceSSMSecure = "ssm-secure"
+	// DynamicReferenceSecretsManager is the
+	// {{resolve:secretsmanager:secret-id:SecretString:json-key:version-stage:version-id}}
+	// dynamic reference to a Secrets Manager secret
+	DynamicReferenceSecretsManager = "secretsmanager"
+)
+
+// reDynamicReference matches the CloudFormation dynamic references in a
+// string value
+var reDynamicReference = regexp.MustCompile(`\{\{resolve:([a-z-]+):([^{}]*)\}\}`)
+
+// DynamicReferences configures the CloudFormation dynamic references
+// (eg, {{resolve:ssm:/my/parameter}}) in the template resources, including
+// the function Environment values and the resources created by decorators.
+// The references are validated and passed through to CloudFormation, which
+// resolves them when the stack is provisioned. If Resolve is true, the SSM
+// and Secrets Manager values are resolved by the provision operation and
+// replace the references in the template. Each resolved reference is logged
+// without its value.
+//
+// Resolved values are included in the template uploaded to S3 and in the
+// stack's template. Prefer passing through references where
+// CloudFormation supports them and only resolve references for properties
+// that don't (eg, ssm-secure references in function Environment values).
+// References aren't resolved in offline builds.
+type DynamicReferences struct {
+	// Resolve replaces the references with their values at provision time
+	Resolve bool
+	// AuditFile is the optional JSON file that records each resolved
+	// reference, the resource that includes it and the resolved version
+	AuditFile string
+}
+
+// DynamicReferenceResolution is the audit record of a resolved dynamic
+// reference. The resolved value isn't recorded.
+type DynamicReferenceResolution struct {
+	// Reference is the dynamic reference string
+	Reference string `json:"reference"`
+	// Resource is the logical name of the template resource that includes
+	// the reference, if any
+	Resource string `json:"resource,omitempty"`
+	// Version is the SSM parameter version or Secrets Manager secret
+	// version ID that was resolved
+	Version string `json:"version,omitempty"`
+}
+
+// dynamicReference is a parsed dynamic reference
+type dynamicReference struct {
+	reference string
+	service   string
+	// SSM parameter name or Secrets Manager secret ID
+	name string
+	// SSM parameter version
+	version      string
+	jsonKey      string
+	versionStage string
+	versionID    string
+}
+
+// parseDynamicReference parses a single dynamic reference string
+func parseDynamicReference(reference string) (*dynamicReference, error) {
+	match := reDynamicReference.FindStringSubmatch(reference)
+	if match == nil || match[0] != reference {
+		return nil, errors.Errorf("Invalid dynamic reference: %s", reference)
+	}
+	dynamicRef := &dynamicReference{
+		reference: reference,
+		service:   match[1],
+	}
+	parts := strings.Split(match[2], ":")
+	switch dynamicRef.service {
+	case DynamicReferenceSSM, DynamicReferenceSSMSecure:
+		if len(parts) > 2 || parts[0] == "" {
+			return nil, errors.Errorf("Invalid %s dynamic reference. Expected {{resolve:%s:parameter-name:version}}. Found: %s",
+				dynamicRef.service,
+				dynamicRef.service,
+				reference)
+		}
+		dynamicRef.name = parts[0]
+		if len(parts) == 2 {
+			dynamicRef.version = parts[1]
+		}
+	case DynamicReferenceSecretsManager:
+		// The secret ID may be an ARN, which includes its own separators
+		secretIDParts := 1
+		if parts[0] == "arn" {
+			secretIDParts = 7
+		}
+		if len(parts) < secretIDParts || len(parts) > secretIDParts+4 {
+			return nil, errors.Errorf("Invalid secretsmanager dynamic reference. Expected {{resolve:secretsmanager:secret-id:SecretString:json-key:version-stage:version-id}}. Found: %s",
+				reference)
+		}
+		dynamicRef.name = strings.Join(parts[0:secretIDParts], ":")
+		optionalParts := append(parts[secretIDParts:], "", "", "", "")
+		if optionalParts[0] != "" && optionalParts[0] != "SecretString" {
+			return nil, errors.Errorf("Invalid secretsmanager dynamic reference. Only SecretString values are supported. Found: %s",
+				reference)
+		}
+		dynamicRef.jsonKey = optionalParts[1]
+		dynamicRef.versionStage = optionalParts[2]
+		dynamicRef.versionID = optionalParts[3]
+		if dynamicRef.name == "" {
+			return nil, errors.Errorf("Invalid secretsmanager dynamic reference. The secret-id is required. Found: %s",
+				reference)
+		}
+	default:
+		return nil, errors.Errorf("Unsupported dynamic reference service %s. Expected one of: %s, %s, %s. Found: %s",
+			dynamicRef.service,
+			DynamicReferenceSSM,
+			DynamicReferenceSSMSecure,
+			DynamicReferenceSecretsManager,
+			reference)
+	}
+	return dynamicRef, nil
+}
+
+// dynamicReferenceValue is a resolved value and its version
+type dynamicReferenceValue struct {
+	value   string
+	version string
+}
+
+// dynamicReferenceResolver resolves the SSM and Secrets Manager dynamic
+// references. Each reference is resolved once.
+type dynamicReferenceResolver struct {
+	ssmSvc     ssmiface.SSMAPI
+	secretsSvc secretsmanageriface.SecretsManagerAPI
+	cache      map[string]*dynamicReferenceValue
+}
+
+func newDynamicReferenceResolver(awsSession *session.Session) *dynamicReferenceResolver {
+	return &dynamicReferenceResolver{
+		ssmSvc:     ssm.New(awsSession),
+		secretsSvc: secretsmanager.New(awsSession),
+		cache:      make(map[string]*dynamicReferenceValue),
+	}
+}
+
+func (resolver *dynamicReferenceResolver) resolveReference(dynamicRef *dynamicReference) (*dynamicReferenceValue, error) {
+	cachedValue, cachedValueExists := resolver.cache[dynamicRef.reference]
+	if cachedValueExists {
+		return cachedValue, nil
+	}
+	resolved := &dynamicReferenceValue{}
+	switch dynamicRef.service {
+	case DynamicReferenceSSM, DynamicReferenceSSMSecure:
+		parameterName := dynamicRef.name
+		if dynamicRef.version != "" {
+			parameterName = fmt.Sprintf("%s:%s", dynamicRef.name, dynamicRef.version)
+		}
+		paramResp, paramErr := resolver.ssmSvc.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(parameterName),
+			WithDecryption: aws.Bool(dynamicRef.service == DynamicReferenceSSMSecure),
+		})
+		if paramErr != nil {
+			return nil, errors.Wrapf(paramErr, "Failed to resolve %s", dynamicRef.reference)
+		}
+		resolved.value = aws.StringValue(paramResp.Parameter.Value)
+		resolved.version = fmt.Sprintf("%d", aws.Int64Value(paramResp.Parameter.Version))
+	case DynamicReferenceSecretsManager:
+		secretInput := &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(dynamicRef.name),
+		}
+		if dynamicRef.versionStage != "" {
+			secretInput.VersionStage = aws.String(dynamicRef.versionStage)
+		}
+		if dynamicRef.versionID != "" {
+			secretInput.VersionId = aws.String(dynamicRef.versionID)
+		}
+		secretResp, secretErr := resolver.secretsSvc.GetSecretValue(secretInput)
+		if secretErr != nil {
+			return nil, errors.Wrapf(secretErr, "Failed to resolve %s", dynamicRef.reference)
+		}
+		resolved.value = aws.StringValue(secretResp.SecretString)
+		resolved.version = aws.StringValue(secretResp.VersionId)
+		if dynamicRef.jsonKey != "" {
+			var secretKeys map[string]interface{}
+			unmarshalErr := json.Unmarshal([]byte(resolved.value), &secretKeys)
+			if unmarshalErr != nil {
+				return nil, errors.Wrapf(unmarshalErr,
+					"Failed to resolve %s. Secret value isn't a JSON object",
+					dynamicRef.reference)
+			}
+			keyValue, keyValueExists := secretKeys[dynamicRef.jsonKey]
+			if !keyValueExists {
+				return nil, errors.Errorf("Failed to resolve %s. Secret doesn't include key: %s",
+					dynamicRef.reference,
+					dynamicRef.jsonKey)
+			}
+			switch typedValue := keyValue.(type) {
+			case string:
+				resolved.value = typedValue
+			default:
+				jsonValue, jsonValueErr := json.Marshal(typedValue)
+				if jsonValueErr != nil {
+					return nil, errors.Wrapf(jsonValueErr, "Failed to resolve %s", dynamicRef.reference)
+				}
+				resolved.value = string(jsonValue)
+			}
+		}
+	}
+	resolver.cache[dynamicRef.reference] = resolved
+	return resolved, nil
+}
+
+// resolveString replaces each dynamic reference in the value with its
+// resolved value. The audit records of the resolved references are returned.
+func (resolver *dynamicReferenceResolver) resolveString(value string,
+	resourceName string) (string, []*DynamicReferenceResolution, error) {
+	resolutions := []*DynamicReferenceResolution{}
+	var resolveErr error
+	resolvedValue := reDynamicReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if resolveErr != nil {
+			return reference
+		}
+		dynamicRef, dynamicRefErr := parseDynamicReference(reference)
+		if dynamicRefErr != nil {
+			resolveErr = dynamicRefErr
+			return reference
+		}
+		resolved, resolvedErr := resolver.resolveReference(dynamicRef)
+		if resolvedErr != nil {
+			resolveErr = resolvedErr
+			return reference
+		}
+		resolutions = append(resolutions, &DynamicReferenceResolution{
+			Reference: reference,
+			Resource:  resourceName,
+			Version:   resolved.version,
+		})
+		return resolved.value
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+	return resolvedValue, resolutions, nil
+}
+
+// ResolveDynamicReferences returns the value with each SSM and Secrets
+// Manager dynamic reference (eg, {{resolve:ssm:/my/parameter}}) replaced by
+// its value. Decorators can use it to resolve inputs that they need at
+// provision time. Each resolved reference is logged without its value.
+func ResolveDynamicReferences(value string,
+	awsSession *session.Session,
+	logger *logrus.Logger) (string, error) {
+	if !reDynamicReference.MatchString(value) {
+		return value, nil
+	}
+	resolver := newDynamicReferenceResolver(awsSession)
+	resolvedValue, resolutions, resolvedErr := resolver.resolveString(value, "")
+	if resolvedErr != nil {
+		return "", resolvedErr
+	}
+	for _, eachResolution := range resolutions {
+		logger.WithFields(logrus.Fields{
+			"Reference": eachResolution.Reference,
+			"Version":   eachResolution.Version,
+		}).Info("Resolved dynamic reference")
+	}
+	return resolvedValue, nil
+}
+
+//
+// END - DynamicReferences
+////////////////////////////////////////////////////////////////////////////////
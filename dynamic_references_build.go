@@ -0,0 +1,232 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ssmSecureResourceTypes are the resource types that have properties which
+// support ssm-secure dynamic references
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/dynamic-references.html#template-parameters-dynamic-patterns-resources
+var ssmSecureResourceTypes = map[string]bool{
+	"AWS::DirectoryService::MicrosoftAD": true,
+	"AWS::DirectoryService::SimpleAD":    true,
+	"AWS::ElastiCache::ReplicationGroup": true,
+	"AWS::IAM::User":                     true,
+	"AWS::OpsWorks::App":                 true,
+	"AWS::OpsWorks::Stack":               true,
+	"AWS::OpsWorks::Instance":            true,
+	"AWS::RDS::DBCluster":                true,
+	"AWS::RDS::DBInstance":               true,
+	"AWS::Redshift::Cluster":             true,
+}
+
+// replaceTemplateStrings returns the value with each string replaced by the
+// result of the replace function. Values that include a replaced string are
+// copied rather than updated so that the values shared with the
+// LambdaAWSInfo options aren't changed. The boolean result is true if a
+// string was replaced.
+func replaceTemplateStrings(value reflect.Value,
+	replace func(string) (string, error)) (reflect.Value, bool, error) {
+	switch value.Kind() {
+	case reflect.String:
+		replaced, replacedErr := replace(value.String())
+		if replacedErr != nil {
+			return value, false, replacedErr
+		}
+		if replaced == value.String() {
+			return value, false, nil
+		}
+		return reflect.ValueOf(replaced).Convert(value.Type()), true, nil
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value, false, nil
+		}
+		elem, changed, elemErr := replaceTemplateStrings(value.Elem(), replace)
+		if elemErr != nil || !changed {
+			return value, false, elemErr
+		}
+		ptrCopy := reflect.New(value.Type().Elem())
+		ptrCopy.Elem().Set(elem)
+		return ptrCopy, true, nil
+	case reflect.Interface:
+		if value.IsNil() {
+			return value, false, nil
+		}
+		elem, changed, elemErr := replaceTemplateStrings(value.Elem(), replace)
+		if elemErr != nil || !changed {
+			return value, false, elemErr
+		}
+		interfaceCopy := reflect.New(value.Type()).Elem()
+		interfaceCopy.Set(elem)
+		return interfaceCopy, true, nil
+	case reflect.Struct:
+		structCopy := reflect.New(value.Type()).Elem()
+		structCopy.Set(value)
+		anyChanged := false
+		for i := 0; i < structCopy.NumField(); i++ {
+			field := structCopy.Field(i)
+			// Unexported fields aren't marshaled
+			if !field.CanSet() {
+				continue
+			}
+			fieldValue, changed, fieldErr := replaceTemplateStrings(field, replace)
+			if fieldErr != nil {
+				return value, false, fieldErr
+			}
+			if changed {
+				field.Set(fieldValue)
+				anyChanged = true
+			}
+		}
+		if !anyChanged {
+			return value, false, nil
+		}
+		return structCopy, true, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return value, false, nil
+		}
+		mapCopy := reflect.MakeMapWithSize(value.Type(), value.Len())
+		anyChanged := false
+		for _, eachKey := range value.MapKeys() {
+			elem, changed, elemErr := replaceTemplateStrings(value.MapIndex(eachKey), replace)
+			if elemErr != nil {
+				return value, false, elemErr
+			}
+			anyChanged = anyChanged || changed
+			mapCopy.SetMapIndex(eachKey, elem)
+		}
+		if !anyChanged {
+			return value, false, nil
+		}
+		return mapCopy, true, nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return value, false, nil
+		}
+		var sliceCopy reflect.Value
+		if value.Kind() == reflect.Slice {
+			sliceCopy = reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		} else {
+			sliceCopy = reflect.New(value.Type()).Elem()
+		}
+		anyChanged := false
+		for i := 0; i < value.Len(); i++ {
+			elem, changed, elemErr := replaceTemplateStrings(value.Index(i), replace)
+			if elemErr != nil {
+				return value, false, elemErr
+			}
+			anyChanged = anyChanged || changed
+			sliceCopy.Index(i).Set(elem)
+		}
+		if !anyChanged {
+			return value, false, nil
+		}
+		return sliceCopy, true, nil
+	}
+	return value, false, nil
+}
+
+// applyDynamicReferences validates the dynamic references in the template
+// resources and, if enabled, replaces them with their resolved values
+func applyDynamicReferences(dynamicRefs *DynamicReferences,
+	template *gocf.Template,
+	resolver *dynamicReferenceResolver,
+	offline bool,
+	logger *logrus.Logger) error {
+
+	resolve := dynamicRefs.Resolve
+	if resolve && offline {
+		logger.Warn("Skipping dynamic reference resolution in offline build")
+		resolve = false
+	}
+	resourceNames := make([]string, 0, len(template.Resources))
+	for eachName := range template.Resources {
+		resourceNames = append(resourceNames, eachName)
+	}
+	sort.Strings(resourceNames)
+
+	passthroughCount := 0
+	resolutions := []*DynamicReferenceResolution{}
+	for _, eachName := range resourceNames {
+		resource := template.Resources[eachName]
+		if resource == nil || resource.Properties == nil {
+			continue
+		}
+		resourceType := resource.Properties.CfnResourceType()
+		replace := func(value string) (string, error) {
+			references := reDynamicReference.FindAllString(value, -1)
+			if len(references) == 0 {
+				return value, nil
+			}
+			if resolve {
+				resolvedValue, resolved, resolvedErr := resolver.resolveString(value, eachName)
+				if resolvedErr != nil {
+					return "", errors.Wrapf(resolvedErr, "Failed to resolve dynamic reference in resource %s", eachName)
+				}
+				resolutions = append(resolutions, resolved...)
+				return resolvedValue, nil
+			}
+			for _, eachReference := range references {
+				dynamicRef, dynamicRefErr := parseDynamicReference(eachReference)
+				if dynamicRefErr != nil {
+					return "", errors.Wrapf(dynamicRefErr, "Invalid dynamic reference in resource %s", eachName)
+				}
+				if dynamicRef.service == DynamicReferenceSSMSecure && !ssmSecureResourceTypes[resourceType] {
+					logger.WithFields(logrus.Fields{
+						"Reference": eachReference,
+						"Resource":  eachName,
+						"Type":      resourceType,
+					}).Warn("CloudFormation doesn't support ssm-secure dynamic references for this resource type. Set DynamicReferences.Resolve to resolve the reference at provision time.")
+				}
+				passthroughCount++
+			}
+			return value, nil
+		}
+		properties, changed, replaceErr := replaceTemplateStrings(reflect.ValueOf(&resource.Properties).Elem(),
+			replace)
+		if replaceErr != nil {
+			return replaceErr
+		}
+		if changed {
+			resourceCopy := *resource
+			resourceCopy.Properties = properties.Interface().(gocf.ResourceProperties)
+			template.Resources[eachName] = &resourceCopy
+		}
+	}
+	if passthroughCount != 0 {
+		logger.WithFields(logrus.Fields{
+			"Count": passthroughCount,
+		}).Info("Passing through dynamic references to CloudFormation")
+	}
+	for _, eachResolution := range resolutions {
+		logger.WithFields(logrus.Fields{
+			"Reference": eachResolution.Reference,
+			"Resource":  eachResolution.Resource,
+			"Version":   eachResolution.Version,
+		}).Info("Resolved dynamic reference")
+	}
+	if resolve && dynamicRefs.AuditFile != "" {
+		auditJSON, auditJSONErr := json.MarshalIndent(resolutions, "", " ")
+		if auditJSONErr != nil {
+			return errors.Wrapf(auditJSONErr, "Failed to marshal dynamic reference audit log")
+		}
+		writeErr := ioutil.WriteFile(dynamicRefs.AuditFile, auditJSON, 0644)
+		if writeErr != nil {
+			return errors.Wrapf(writeErr, "Failed to write dynamic reference audit log")
+		}
+		logger.WithFields(logrus.Fields{
+			"Path": dynamicRefs.AuditFile,
+		}).Info("Dynamic reference audit log")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package sparta
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 	"regexp"
 	"strings"
@@ -107,3 +108,72 @@ func ensureValidSignature(lambdaName string, handlerSymbol interface{}) error {
 	}
 	return nil
 }
+
+func takesContext(handler reflect.Type) bool {
+	handlerTakesContext := false
+	if handler.NumIn() > 0 {
+		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+		argumentType := handler.In(0)
+		handlerTakesContext = argumentType.Implements(contextType)
+	}
+	return handlerTakesContext
+}
+
+// reflectedLambdaHandler returns the LambdaHandler for the handler symbol.
+// It's shared by the AWS Lambda binary and the local invoke commands.
+func reflectedLambdaHandler(handlerSymbol interface{}) LambdaHandler {
+	// Typed handlers (see HandleLambda) are already normalized. Other
+	// handlers are adapted to a LambdaHandler using reflection.
+	lambdaHandler, lambdaHandlerOk := handlerSymbol.(LambdaHandler)
+	if !lambdaHandlerOk {
+		// Tap the call chain to inject the context params...
+		handler := reflect.ValueOf(handlerSymbol)
+		handlerType := reflect.TypeOf(handlerSymbol)
+		takesContext := takesContext(handlerType)
+		lambdaHandler = func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+			// construct arguments
+			var args []reflect.Value
+			if takesContext {
+				args = append(args, reflect.ValueOf(ctx))
+			}
+			if (handlerType.NumIn() == 1 && !takesContext) ||
+				handlerType.NumIn() == 2 {
+				eventType := handlerType.In(handlerType.NumIn() - 1)
+				event := reflect.New(eventType)
+				unmarshalErr := json.Unmarshal(msg, event.Interface())
+				if unmarshalErr != nil {
+					return nil, unmarshalErr
+				}
+				args = append(args, event.Elem())
+			}
+			response := handler.Call(args)
+
+			// convert return values into (interface{}, error)
+			var err error
+			if len(response) > 0 {
+				if errVal, ok := response[len(response)-1].Interface().(error); ok {
+					err = errVal
+				}
+			}
+			var val interface{}
+			if len(response) > 1 {
+				val = response[0].Interface()
+			}
+			return val, err
+		}
+	}
+	return lambdaHandler
+}
+
+// applyInterceptors is a utility function to apply the
+// specified interceptors as part of the lifecycle handler.
+// We can push the specific behaviors into the interceptors
+// and keep the handlers simple. 🎉
+func applyInterceptors(ctx context.Context,
+	msg json.RawMessage,
+	interceptors InterceptorList) context.Context {
+	for _, eachInterceptor := range interceptors {
+		ctx = eachInterceptor.Interceptor(ctx, msg)
+	}
+	return ctx
+}
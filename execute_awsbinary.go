@@ -7,11 +7,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"reflect"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	awsLambdaGo "github.com/aws/aws-lambda-go/lambda"
 	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-xray-sdk-go/xray"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	cloudformationResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
 	gocf "github.com/mweagle/go-cloudformation"
@@ -47,19 +49,95 @@ func awsLambdaFunctionName(internalFunctionName string) gocf.Stringable {
 		sanitizedName))
 }
 
-func takesContext(handler reflect.Type) bool {
-	handlerTakesContext := false
-	if handler.NumIn() > 0 {
-		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
-		argumentType := handler.In(0)
-		handlerTakesContext = argumentType.Implements(contextType)
+// invocation is the request scoped state shared by the lifecycle
+// stages of a single event
+type invocation struct {
+	msg            json.RawMessage
+	interceptors   *LambdaEventInterceptors
+	logrusEntry    *logrus.Entry
+	metricsLogger  *MetricsLogger
+	requestSegment *xray.Segment
+}
+
+// beginInvocation runs the lifecycle through the BeforeDispatch
+// interceptors and returns the context for the user handler
+func beginInvocation(ctx context.Context,
+	msg json.RawMessage,
+	serviceName string,
+	interceptors *LambdaEventInterceptors,
+	functionConfig *FunctionConfig,
+	logger *logrus.Logger) (context.Context, *invocation) {
+
+	// Open the X-Ray segment for traced requests so that
+	// subsegments have a parent
+	ctx, requestSegment := beginRequestSegment(ctx,
+		os.Getenv("AWS_LAMBDA_FUNCTION_NAME"))
+
+	awsSession := spartaAWS.NewSession(logger)
+	ctx = applyInterceptors(ctx, msg, interceptors.Begin)
+	ctx = context.WithValue(ctx, ContextKeyLogger, logger)
+	ctx = context.WithValue(ctx, ContextKeyAWSSession, awsSession)
+	ctx = context.WithValue(ctx, ContextKeyConfig, functionConfig)
+	ctx = applyInterceptors(ctx, msg, interceptors.BeforeSetup)
+
+	// Create the entry logger that has some context information
+	var logrusEntry *logrus.Entry
+	lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+	if lambdaContextOk {
+		logrusEntry = logrus.
+			NewEntry(logger).
+			WithFields(logrus.Fields{
+				LogFieldRequestID:  lambdaContext.AwsRequestID,
+				LogFieldARN:        lambdaContext.InvokedFunctionArn,
+				LogFieldBuildID:    StampedBuildID,
+				LogFieldInstanceID: InstanceID(),
+			})
+	} else {
+		logrusEntry = logrus.NewEntry(logger)
+	}
+	ctx = context.WithValue(ctx, ContextKeyRequestLogger, logrusEntry)
+
+	// Create the request scoped EMF metrics, which are flushed to stdout
+	// once the handler completes
+	metricsLogger := NewMetricsLogger(serviceName).
+		SetDimension(MetricDimensionServiceName, serviceName).
+		SetDimension(MetricDimensionFunctionName, os.Getenv("AWS_LAMBDA_FUNCTION_NAME"))
+	if lambdaContextOk {
+		metricsLogger.SetProperty(LogFieldRequestID, lambdaContext.AwsRequestID)
+	}
+	ctx = context.WithValue(ctx, ContextKeyMetrics, metricsLogger)
+	ctx = applyInterceptors(ctx, msg, interceptors.AfterSetup)
+	ctx = applyInterceptors(ctx, msg, interceptors.BeforeDispatch)
+	return ctx, &invocation{
+		msg:            msg,
+		interceptors:   interceptors,
+		logrusEntry:    logrusEntry,
+		metricsLogger:  metricsLogger,
+		requestSegment: requestSegment,
+	}
+}
+
+// complete runs the lifecycle from the AfterDispatch interceptors
+func (invoke *invocation) complete(ctx context.Context, val interface{}, err error) {
+	ctx = applyInterceptors(ctx, invoke.msg, invoke.interceptors.AfterDispatch)
+	flushErr := invoke.metricsLogger.Flush(os.Stdout)
+	if flushErr != nil {
+		invoke.logrusEntry.WithError(flushErr).Warn("Failed to flush EMF metrics")
+	}
+
+	ctx = context.WithValue(ctx, ContextKeyLambdaError, err)
+	ctx = context.WithValue(ctx, ContextKeyLambdaResponse, val)
+	applyInterceptors(ctx, invoke.msg, invoke.interceptors.Complete)
+	if invoke.requestSegment != nil {
+		invoke.requestSegment.Close(err)
 	}
-	return handlerTakesContext
 }
 
 // tappedHandler is the handler that represents this binary's mode
-func tappedHandler(handlerSymbol interface{},
+func tappedHandler(serviceName string,
+	handlerSymbol interface{},
 	interceptors *LambdaEventInterceptors,
+	functionConfig *FunctionConfig,
 	logger *logrus.Logger) interface{} {
 
 	// If there aren't any, make it a bit easier
@@ -68,23 +146,11 @@ func tappedHandler(handlerSymbol interface{},
 		interceptors = &LambdaEventInterceptors{}
 	}
 
-	// Tap the call chain to inject the context params...
-	handler := reflect.ValueOf(handlerSymbol)
-	handlerType := reflect.TypeOf(handlerSymbol)
-	takesContext := takesContext(handlerType)
-
-	// Apply interceptors is a utility function to apply the
-	// specified interceptors as part of the lifecycle handler.
-	// We can push the specific behaviors into the interceptors
-	// and keep this function simple. 🎉
-	applyInterceptors := func(ctx context.Context,
-		msg json.RawMessage,
-		interceptors InterceptorList) context.Context {
-		for _, eachInterceptor := range interceptors {
-			ctx = eachInterceptor.Interceptor(ctx, msg)
-		}
-		return ctx
-	}
+	lambdaHandler := reflectedLambdaHandler(handlerSymbol)
+
+	// dispatch is the normalized user function, wrapped by any
+	// HandlerMiddleware registered via sparta.Use
+	dispatch := applyHandlerMiddleware(lambdaHandler, registeredHandlerMiddleware())
 
 	// How to determine if this handler has tracing enabled? That would be a property
 	// of the function template associated with this function.
@@ -92,68 +158,78 @@ func tappedHandler(handlerSymbol interface{},
 	// TODO - add Context.Timeout handler to ensure orderly exit
 	return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
 
-		awsSession := spartaAWS.NewSession(logger)
-		ctx = applyInterceptors(ctx, msg, interceptors.Begin)
-		ctx = context.WithValue(ctx, ContextKeyLogger, logger)
-		ctx = context.WithValue(ctx, ContextKeyAWSSession, awsSession)
-		ctx = applyInterceptors(ctx, msg, interceptors.BeforeSetup)
-
-		// Create the entry logger that has some context information
-		var logrusEntry *logrus.Entry
-		lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
-		if lambdaContextOk {
-			logrusEntry = logrus.
-				NewEntry(logger).
-				WithFields(logrus.Fields{
-					LogFieldRequestID:  lambdaContext.AwsRequestID,
-					LogFieldARN:        lambdaContext.InvokedFunctionArn,
-					LogFieldBuildID:    StampedBuildID,
-					LogFieldInstanceID: InstanceID(),
-				})
-		} else {
-			logrusEntry = logrus.NewEntry(logger)
+		// Warmup events only exist to keep the execution environment
+		// alive, so skip the user handler and the request lifecycle
+		if isWarmupEvent(msg) {
+			logger.Debug("Sparta warmup event")
+			return nil, nil
 		}
-		ctx = context.WithValue(ctx, ContextKeyRequestLogger, logrusEntry)
-		ctx = applyInterceptors(ctx, msg, interceptors.AfterSetup)
+		ctx, invoke := beginInvocation(ctx,
+			msg,
+			serviceName,
+			interceptors,
+			functionConfig,
+			logger)
+		val, err := dispatch(ctx, msg)
+		invoke.complete(ctx, val, err)
+		return val, err
+	}
+}
 
-		// construct arguments
-		var args []reflect.Value
-		if takesContext {
-			args = append(args, reflect.ValueOf(ctx))
-		}
-		if (handlerType.NumIn() == 1 && !takesContext) ||
-			handlerType.NumIn() == 2 {
-			eventType := handlerType.In(handlerType.NumIn() - 1)
-			event := reflect.New(eventType)
-			unmarshalErr := json.Unmarshal(msg, event.Interface())
-			if unmarshalErr != nil {
-				return nil, unmarshalErr
-			}
-			args = append(args, event.Elem())
-		}
-		ctx = applyInterceptors(ctx, msg, interceptors.BeforeDispatch)
-		response := handler.Call(args)
-		ctx = applyInterceptors(ctx, msg, interceptors.AfterDispatch)
-
-		// If the user function
-		// convert return values into (interface{}, error)
-		var err error
-		if len(response) > 0 {
-			if errVal, ok := response[len(response)-1].Interface().(error); ok {
-				err = errVal
-			}
-		}
-		ctx = context.WithValue(ctx, ContextKeyLambdaError, err)
-		var val interface{}
-		if len(response) > 1 {
-			val = response[0].Interface()
+// streamingTappedHandler wraps a StreamingHandler with the same request
+// lifecycle as tappedHandler. HandlerMiddleware isn't applied since it
+// operates on buffered responses.
+func streamingTappedHandler(serviceName string,
+	handler StreamingHandler,
+	interceptors *LambdaEventInterceptors,
+	functionConfig *FunctionConfig,
+	logger *logrus.Logger) StreamingHandler {
+
+	if interceptors == nil {
+		interceptors = &LambdaEventInterceptors{}
+	}
+	return func(ctx context.Context, msg json.RawMessage, stream *ResponseStream) error {
+		if isWarmupEvent(msg) {
+			logger.Debug("Sparta warmup event")
+			return nil
 		}
-		ctx = context.WithValue(ctx, ContextKeyLambdaResponse, val)
-		applyInterceptors(ctx, msg, interceptors.Complete)
-		return val, err
+		ctx, invoke := beginInvocation(ctx,
+			msg,
+			serviceName,
+			interceptors,
+			functionConfig,
+			logger)
+		err := handler(ctx, msg, stream)
+		invoke.complete(ctx, nil, err)
+		return err
 	}
 }
 
+// installShutdownHandler runs the hooks registered with OnShutdown when
+// the process receives SIGTERM
+func installShutdownHandler(logger *logrus.Logger) {
+	hooks, drainTimeout := registeredShutdownHooks()
+	if len(hooks) == 0 {
+		return
+	}
+	registerErr := registerShutdownExtension(os.Getenv("AWS_LAMBDA_RUNTIME_API"), logger)
+	if registerErr != nil {
+		logger.WithError(registerErr).Warn("Failed to register shutdown extension. Shutdown hooks will not run.")
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		receivedSignal := <-signals
+		logger.WithFields(logrus.Fields{
+			"Signal":    receivedSignal.String(),
+			"HookCount": len(hooks),
+		}).Info("Running shutdown hooks")
+		runShutdownHooks(hooks, drainTimeout, logger)
+		os.Exit(0)
+	}()
+}
+
 // Execute creates an HTTP listener to dispatch execution. Typically
 // called via Main() via command line arguments.
 func Execute(serviceName string,
@@ -177,6 +253,7 @@ func Execute(serviceName string,
 
 	// So what if we have workflow hooks in here?
 	var interceptors *LambdaEventInterceptors
+	var declaredConfig map[string]*ConfigVariable
 
 	/*
 		There are three types of targets:
@@ -202,7 +279,9 @@ func Execute(serviceName string,
 		if requestedLambdaFunctionName == testAWSName {
 			handlerSymbol = eachLambdaInfo.handlerSymbol
 			interceptors = eachLambdaInfo.Interceptors
-
+			if eachLambdaInfo.Options != nil {
+				declaredConfig = eachLambdaInfo.Options.Config
+			}
 		}
 
 		// User defined custom resource handler?
@@ -259,8 +338,34 @@ func Execute(serviceName string,
 		return errorMessage
 	}
 
+	// Validate the declared configuration before handling any requests
+	functionConfig, functionConfigErr := loadFunctionConfig(declaredConfig, os.LookupEnv)
+	if functionConfigErr != nil {
+		logger.Error(functionConfigErr)
+		return functionConfigErr
+	}
+
+	// Run any shutdown hooks when the execution environment is terminated
+	installShutdownHandler(logger)
+
+	// Streaming handlers use Sparta's Runtime API client since the
+	// aws-lambda-go runtime only supports buffered responses
+	if streamingHandler, streamingHandlerOk := handlerSymbol.(StreamingHandler); streamingHandlerOk {
+		runtimeClient, runtimeClientErr := newStreamingRuntimeClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"),
+			logger)
+		if runtimeClientErr != nil {
+			logger.Error(runtimeClientErr)
+			return runtimeClientErr
+		}
+		return runtimeClient.start(streamingTappedHandler(serviceName,
+			streamingHandler,
+			interceptors,
+			functionConfig,
+			logger))
+	}
+
 	// Startup our version...
-	tappedHandler := tappedHandler(handlerSymbol, interceptors, logger)
+	tappedHandler := tappedHandler(serviceName, handlerSymbol, interceptors, functionConfig, logger)
 	awsLambdaGo.Start(tappedHandler)
 	return nil
 }
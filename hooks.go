@@ -29,7 +29,7 @@ type TemplateDecorator func(serviceName string,
 	S3Key string,
 	buildID string,
 	template *gocf.Template,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error
 
 // TemplateDecoratorHookFunc is the adapter to transform an existing
@@ -42,7 +42,7 @@ type TemplateDecoratorHookFunc func(serviceName string,
 	S3Key string,
 	buildID string,
 	template *gocf.Template,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error
 
 // DecorateTemplate calls tdhf(...) to satisfy TemplateDecoratorHandler
@@ -54,7 +54,7 @@ func (tdhf TemplateDecoratorHookFunc) DecorateTemplate(serviceName string,
 	S3Key string,
 	buildID string,
 	template *gocf.Template,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error {
 	return tdhf(serviceName,
 		lambdaResourceName,
@@ -79,7 +79,7 @@ type TemplateDecoratorHandler interface {
 		S3Key string,
 		buildID string,
 		template *gocf.Template,
-		context map[string]interface{},
+		context *WorkflowHookContext,
 		logger *logrus.Logger) error
 }
 
@@ -90,7 +90,7 @@ type TemplateDecoratorHandler interface {
 // point in the larger Sparta workflow. The first argument is a map that
 // is shared across all LifecycleHooks and which Sparta treats as an opaque
 // value.
-type WorkflowHook func(context map[string]interface{},
+type WorkflowHook func(context *WorkflowHookContext,
 	serviceName string,
 	S3Bucket string,
 	buildID string,
@@ -100,7 +100,7 @@ type WorkflowHook func(context map[string]interface{},
 
 // WorkflowHookFunc is the adapter to transform an existing
 // WorkflowHook into a WorkflowHookHandler satisfier
-type WorkflowHookFunc func(context map[string]interface{},
+type WorkflowHookFunc func(context *WorkflowHookContext,
 	serviceName string,
 	S3Bucket string,
 	buildID string,
@@ -109,7 +109,7 @@ type WorkflowHookFunc func(context map[string]interface{},
 	logger *logrus.Logger) error
 
 // DecorateWorkflow calls whf(...) to satisfy WorkflowHookHandler
-func (whf WorkflowHookFunc) DecorateWorkflow(context map[string]interface{},
+func (whf WorkflowHookFunc) DecorateWorkflow(context *WorkflowHookContext,
 	serviceName string,
 	S3Bucket string,
 	buildID string,
@@ -128,7 +128,7 @@ func (whf WorkflowHookFunc) DecorateWorkflow(context map[string]interface{},
 // WorkflowHookHandler is the interface type to indicate a workflow
 // hook
 type WorkflowHookHandler interface {
-	DecorateWorkflow(context map[string]interface{},
+	DecorateWorkflow(context *WorkflowHookContext,
 		serviceName string,
 		S3Bucket string,
 		buildID string,
@@ -144,7 +144,7 @@ type WorkflowHookHandler interface {
 
 // ArchiveHook provides callers an opportunity to insert additional
 // files into the ZIP archive deployed to S3
-type ArchiveHook func(context map[string]interface{},
+type ArchiveHook func(context *WorkflowHookContext,
 	serviceName string,
 	zipWriter *zip.Writer,
 	awsSession *session.Session,
@@ -153,7 +153,7 @@ type ArchiveHook func(context map[string]interface{},
 
 // ArchiveHookFunc is the adapter to transform an existing
 // ArchiveHook into a WorkflowHookHandler satisfier
-type ArchiveHookFunc func(context map[string]interface{},
+type ArchiveHookFunc func(context *WorkflowHookContext,
 	serviceName string,
 	zipWriter *zip.Writer,
 	awsSession *session.Session,
@@ -161,7 +161,7 @@ type ArchiveHookFunc func(context map[string]interface{},
 	logger *logrus.Logger) error
 
 // DecorateArchive calls whf(...) to satisfy ArchiveHookHandler
-func (ahf ArchiveHookFunc) DecorateArchive(context map[string]interface{},
+func (ahf ArchiveHookFunc) DecorateArchive(context *WorkflowHookContext,
 	serviceName string,
 	zipWriter *zip.Writer,
 	awsSession *session.Session,
@@ -178,7 +178,7 @@ func (ahf ArchiveHookFunc) DecorateArchive(context map[string]interface{},
 // ArchiveHookHandler is the interface type to indicate a workflow
 // hook
 type ArchiveHookHandler interface {
-	DecorateArchive(context map[string]interface{},
+	DecorateArchive(context *WorkflowHookContext,
 		serviceName string,
 		zipWriter *zip.Writer,
 		awsSession *session.Session,
@@ -191,7 +191,7 @@ type ArchiveHookHandler interface {
 
 // ServiceDecoratorHook defines a user function that is called a single
 // time in the marshall workflow.
-type ServiceDecoratorHook func(context map[string]interface{},
+type ServiceDecoratorHook func(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -203,7 +203,7 @@ type ServiceDecoratorHook func(context map[string]interface{},
 
 // ServiceDecoratorHookFunc is the adapter to transform an existing
 // ArchiveHook into a WorkflowHookHandler satisfier
-type ServiceDecoratorHookFunc func(context map[string]interface{},
+type ServiceDecoratorHookFunc func(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -214,7 +214,7 @@ type ServiceDecoratorHookFunc func(context map[string]interface{},
 	logger *logrus.Logger) error
 
 // DecorateService calls sdhf(...) to satisfy ServiceDecoratorHookHandler
-func (sdhf ServiceDecoratorHookFunc) DecorateService(context map[string]interface{},
+func (sdhf ServiceDecoratorHookFunc) DecorateService(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -237,7 +237,7 @@ func (sdhf ServiceDecoratorHookFunc) DecorateService(context map[string]interfac
 // ServiceDecoratorHookHandler is the interface type to indicate a workflow
 // hook
 type ServiceDecoratorHookHandler interface {
-	DecorateService(context map[string]interface{},
+	DecorateService(context *WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -254,7 +254,7 @@ type ServiceDecoratorHookHandler interface {
 // ServiceValidationHook defines a user function that is called a single
 // after all template annotations have been performed. It is where
 // policies should be applied
-type ServiceValidationHook func(context map[string]interface{},
+type ServiceValidationHook func(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -266,7 +266,7 @@ type ServiceValidationHook func(context map[string]interface{},
 
 // ServiceValidationHookFunc is the adapter to transform an existing
 // ArchiveHook into a WorkflowHookHandler satisfier
-type ServiceValidationHookFunc func(context map[string]interface{},
+type ServiceValidationHookFunc func(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -277,7 +277,7 @@ type ServiceValidationHookFunc func(context map[string]interface{},
 	logger *logrus.Logger) error
 
 // ValidateService calls sdhf(...) to satisfy ServiceValidationHookHandler
-func (sdhf ServiceValidationHookFunc) ValidateService(context map[string]interface{},
+func (sdhf ServiceValidationHookFunc) ValidateService(context *WorkflowHookContext,
 	serviceName string,
 	template *gocf.Template,
 	S3Bucket string,
@@ -300,7 +300,7 @@ func (sdhf ServiceValidationHookFunc) ValidateService(context map[string]interfa
 // ServiceValidationHookHandler is the interface type to indicate a workflow
 // hook
 type ServiceValidationHookHandler interface {
-	ValidateService(context map[string]interface{},
+	ValidateService(context *WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -316,7 +316,7 @@ type ServiceValidationHookHandler interface {
 
 // RollbackHook provides callers an opportunity to handle failures
 // associated with failing to perform the requested operation
-type RollbackHook func(context map[string]interface{},
+type RollbackHook func(context *WorkflowHookContext,
 	serviceName string,
 	awsSession *session.Session,
 	noop bool,
@@ -324,14 +324,14 @@ type RollbackHook func(context map[string]interface{},
 
 // RollbackHookFunc the adapter to transform an existing
 // RollbackHook into a RollbackHookHandler satisfier
-type RollbackHookFunc func(context map[string]interface{},
+type RollbackHookFunc func(context *WorkflowHookContext,
 	serviceName string,
 	awsSession *session.Session,
 	noop bool,
 	logger *logrus.Logger)
 
 // Rollback calls sdhf(...) to satisfy ArchiveHookHandler
-func (rhf RollbackHookFunc) Rollback(context map[string]interface{},
+func (rhf RollbackHookFunc) Rollback(context *WorkflowHookContext,
 	serviceName string,
 	awsSession *session.Session,
 	noop bool,
@@ -347,9 +347,63 @@ func (rhf RollbackHookFunc) Rollback(context map[string]interface{},
 // RollbackHookHandler is the interface type to indicate a workflow
 // hook
 type RollbackHookHandler interface {
-	Rollback(context map[string]interface{},
+	Rollback(context *WorkflowHookContext,
 		serviceName string,
 		awsSession *session.Session,
 		noop bool,
 		logger *logrus.Logger) error
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// PostDeployValidationHookHandler
+
+// PostDeployValidationHook defines a user function that is called after the
+// stack successfully converges. The stackOutputs map includes the
+// provisioned stack's Outputs, keyed by OutputKey. Returning an error fails
+// the provision and reverts the deployment.
+type PostDeployValidationHook func(context *WorkflowHookContext,
+	serviceName string,
+	stackOutputs map[string]string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error
+
+// PostDeployValidationHookFunc is the adapter to transform an existing
+// PostDeployValidationHook into a PostDeployValidationHookHandler satisfier
+type PostDeployValidationHookFunc func(context *WorkflowHookContext,
+	serviceName string,
+	stackOutputs map[string]string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error
+
+// ValidateDeployment calls pdvhf(...) to satisfy PostDeployValidationHookHandler
+func (pdvhf PostDeployValidationHookFunc) ValidateDeployment(context *WorkflowHookContext,
+	serviceName string,
+	stackOutputs map[string]string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+	return pdvhf(context,
+		serviceName,
+		stackOutputs,
+		buildID,
+		awsSession,
+		noop,
+		logger)
+}
+
+// PostDeployValidationHookHandler is the interface type to indicate a post
+// deploy validation hook
+type PostDeployValidationHookHandler interface {
+	ValidateDeployment(context *WorkflowHookContext,
+		serviceName string,
+		stackOutputs map[string]string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error
+}
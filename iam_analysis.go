@@ -0,0 +1,364 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - IAM privilege analysis
+//
+
+// iamPrivilegeAnalysis is the result of analyzing a single function's
+// execution role
+type iamPrivilegeAnalysis struct {
+	// The function that owns the role
+	functionName string
+	// statements is the minimal set of statements derived from the declared
+	// privileges, event source mappings, and discovery dependencies. The
+	// CommonIAMStatements are not included.
+	statements []spartaIAM.PolicyStatement
+	// broadActions are the declared Allow actions that grant every action
+	// for a service (eg, s3:*) or for every service
+	broadActions []string
+}
+
+// isBroadAction returns true if the action grants every action for
+// a service, or for every service
+func isBroadAction(action string) bool {
+	return action == "*" || strings.HasSuffix(action, ":*")
+}
+
+// statementActions returns the sorted set of actions for the given service
+// prefix included in the statements
+func statementActions(statements []spartaIAM.PolicyStatement, servicePrefix string) []string {
+	actionSet := make(map[string]bool)
+	for _, eachStatement := range statements {
+		for _, eachAction := range eachStatement.Action {
+			if servicePrefix == "*" ||
+				strings.HasPrefix(strings.ToLower(eachAction), servicePrefix+":") {
+				actionSet[eachAction] = true
+			}
+		}
+	}
+	actions := make([]string, 0)
+	for eachAction := range actionSet {
+		actions = append(actions, eachAction)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// discoveryIAMStatements returns the privileges a function typically
+// requires to use a resource that it depends on and discovers at runtime
+func discoveryIAMStatements(logicalResourceName string,
+	resource *gocf.Resource) []spartaIAM.PolicyStatement {
+	statements := []spartaIAM.PolicyStatement{}
+	switch resource.Properties.(type) {
+	case *gocf.DynamoDBTable, gocf.DynamoDBTable:
+		tableArn := gocf.GetAtt(logicalResourceName, "Arn")
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect: "Allow",
+			Action: []string{"dynamodb:BatchGetItem",
+				"dynamodb:BatchWriteItem",
+				"dynamodb:DeleteItem",
+				"dynamodb:GetItem",
+				"dynamodb:PutItem",
+				"dynamodb:Query",
+				"dynamodb:Scan",
+				"dynamodb:UpdateItem"},
+			Resource: tableArn,
+		}, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"dynamodb:Query", "dynamodb:Scan"},
+			Resource: gocf.Join("", tableArn, gocf.String("/index/*")),
+		})
+	case *gocf.S3Bucket, gocf.S3Bucket:
+		bucketArn := gocf.GetAtt(logicalResourceName, "Arn")
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"s3:ListBucket"},
+			Resource: bucketArn,
+		}, spartaIAM.PolicyStatement{
+			Effect: "Allow",
+			Action: []string{"s3:DeleteObject",
+				"s3:GetObject",
+				"s3:PutObject"},
+			Resource: gocf.Join("", bucketArn, gocf.String("/*")),
+		})
+	case *gocf.SNSTopic, gocf.SNSTopic:
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"sns:Publish"},
+			Resource: gocf.Ref(logicalResourceName).String(),
+		})
+	}
+	return statements
+}
+
+// analyzeLambdaIAMPrivileges derives the minimal privileges for the function's
+// Sparta-managed execution role
+func analyzeLambdaIAMPrivileges(lambdaAWSInfo *LambdaAWSInfo,
+	template *gocf.Template,
+	logger *logrus.Logger) (*iamPrivilegeAnalysis, error) {
+
+	analysis := &iamPrivilegeAnalysis{
+		functionName: lambdaAWSInfo.lambdaFunctionName(),
+		statements:   []spartaIAM.PolicyStatement{},
+		broadActions: []string{},
+	}
+	// Declared privileges, without the broad actions
+	for _, eachPrivilege := range lambdaAWSInfo.RoleDefinition.Privileges {
+		statement := eachPrivilege.policyStatement()
+		if statement.Effect == "Deny" {
+			analysis.statements = append(analysis.statements, statement)
+			continue
+		}
+		// Allow with NotAction grants everything else
+		for _, eachNotAction := range eachPrivilege.NotActions {
+			analysis.broadActions = append(analysis.broadActions,
+				"NotAction "+eachNotAction)
+		}
+		scopedActions := []string{}
+		for _, eachAction := range eachPrivilege.Actions {
+			if isBroadAction(eachAction) {
+				analysis.broadActions = append(analysis.broadActions, eachAction)
+			} else {
+				scopedActions = append(scopedActions, eachAction)
+			}
+		}
+		if len(scopedActions) != 0 {
+			statement.Action = scopedActions
+			analysis.statements = append(analysis.statements, statement)
+		}
+	}
+	// Event source mappings
+	for _, eachMapping := range lambdaAWSInfo.EventSourceMappings {
+		resourceRef, resourceRefErr := resolveResourceRef(eachMapping.EventSourceArn)
+		if resourceRefErr != nil {
+			return nil, errors.Wrapf(resourceRefErr,
+				"Failed to resolve EventSourceArn: %#v", eachMapping)
+		}
+		if resourceRef != nil {
+			mappingStatements, mappingStatementsErr := eventSourceMappingPoliciesForResource(resourceRef,
+				template,
+				logger)
+			if mappingStatementsErr != nil {
+				return nil, mappingStatementsErr
+			}
+			for _, eachStatement := range mappingStatements {
+				analysis.statements = append(analysis.statements, spartaIAM.PolicyStatement{
+					Effect:   "Allow",
+					Action:   eachStatement.Action,
+					Resource: spartaCF.DynamicValueToStringExpr(eachMapping.EventSourceArn).String(),
+				})
+			}
+		}
+		analysis.statements = append(analysis.statements, eachMapping.iamStatements()...)
+	}
+	// Resources that are referenced via discovery
+	for _, eachDependsOn := range lambdaAWSInfo.DependsOn {
+		resource, resourceExists := template.Resources[eachDependsOn]
+		if resourceExists {
+			analysis.statements = append(analysis.statements,
+				discoveryIAMStatements(eachDependsOn, resource)...)
+		}
+	}
+	return analysis, nil
+}
+
+// analyzeIAMPrivileges derives the minimal execution role privileges for
+// each function and warns about privileges that grant broad actions. If
+// strict is true, broad actions are an error.
+func analyzeIAMPrivileges(lambdaAWSInfos []*LambdaAWSInfo,
+	template *gocf.Template,
+	strict bool,
+	logger *logrus.Logger) error {
+
+	var errorText []string
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.RoleDefinition == nil {
+			continue
+		}
+		analysis, analysisErr := analyzeLambdaIAMPrivileges(eachLambda, template, logger)
+		if analysisErr != nil {
+			return errors.Wrapf(analysisErr,
+				"Failed to analyze IAM privileges for %s",
+				eachLambda.lambdaFunctionName())
+		}
+		if logger.IsLevelEnabled(logrus.DebugLevel) {
+			statementsJSON, statementsJSONErr := json.Marshal(analysis.statements)
+			if statementsJSONErr != nil {
+				return errors.Wrapf(statementsJSONErr, "Failed to marshal derived IAM statements")
+			}
+			logger.WithFields(logrus.Fields{
+				"Function":   analysis.functionName,
+				"Statements": string(statementsJSON),
+			}).Debug("Derived least-privilege IAM statements")
+		}
+		for _, eachAction := range analysis.broadActions {
+			servicePrefix := strings.ToLower(strings.SplitN(strings.TrimPrefix(eachAction, "NotAction "), ":", 2)[0])
+			logEntry := logger.WithFields(logrus.Fields{
+				"Function":  analysis.functionName,
+				"Action":    eachAction,
+				"Suggested": statementActions(analysis.statements, servicePrefix),
+			})
+			if strict {
+				logEntry.Error("IAM privilege grants broad actions")
+				errorText = append(errorText, analysis.functionName+": "+eachAction)
+			} else {
+				logEntry.Warn("IAM privilege grants broad actions. Use --strictIAM to reject.")
+			}
+		}
+	}
+	if len(errorText) != 0 {
+		return errors.Errorf("IAM privileges grant broad actions: %s",
+			strings.Join(errorText, ", "))
+	}
+	return nil
+}
+
+// resolvePolicyIntrinsics replaces the CloudFormation intrinsic functions in
+// an unmarshalled policy document with literal values. References to
+// resources and unknown values are replaced with a "*" wildcard.
+func resolvePolicyIntrinsics(value interface{}, pseudoParameters map[string]string) interface{} {
+	switch typedValue := value.(type) {
+	case []interface{}:
+		resolved := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			resolved[eachIndex] = resolvePolicyIntrinsics(eachValue, pseudoParameters)
+		}
+		return resolved
+	case map[string]interface{}:
+		if len(typedValue) == 1 {
+			for eachKey, eachValue := range typedValue {
+				if eachKey == "Ref" {
+					refName, _ := eachValue.(string)
+					if pseudoValue, pseudoValueExists := pseudoParameters[refName]; pseudoValueExists {
+						return pseudoValue
+					}
+					return "*"
+				}
+				if eachKey == "Fn::Join" {
+					joinArgs, _ := eachValue.([]interface{})
+					if len(joinArgs) == 2 {
+						delimiter, _ := joinArgs[0].(string)
+						joinValues, _ := joinArgs[1].([]interface{})
+						joinParts := make([]string, 0)
+						for _, eachJoinValue := range joinValues {
+							joinPart, joinPartOk := resolvePolicyIntrinsics(eachJoinValue, pseudoParameters).(string)
+							if !joinPartOk {
+								joinPart = "*"
+							}
+							joinParts = append(joinParts, joinPart)
+						}
+						return strings.Join(joinParts, delimiter)
+					}
+				}
+				if strings.HasPrefix(eachKey, "Fn::") {
+					return "*"
+				}
+			}
+		}
+		resolved := make(map[string]interface{})
+		for eachKey, eachValue := range typedValue {
+			resolved[eachKey] = resolvePolicyIntrinsics(eachValue, pseudoParameters)
+		}
+		return resolved
+	}
+	return value
+}
+
+// validateIAMRolePolicies validates the inline policies of the IAM roles
+// defined in the template with the IAM Access Analyzer ValidatePolicy API.
+// ERROR findings are returned as an error. SECURITY_WARNING findings are
+// logged as warnings.
+func validateIAMRolePolicies(roleResourceNames []string,
+	serviceName string,
+	template *gocf.Template,
+	awsSession *session.Session,
+	logger *logrus.Logger) error {
+
+	region := aws.StringValue(awsSession.Config.Region)
+	partition := "aws"
+	if regionPartition, regionPartitionOk := endpoints.PartitionForRegion(endpoints.DefaultPartitions(),
+		region); regionPartitionOk {
+		partition = regionPartition.ID()
+	}
+	pseudoParameters := map[string]string{
+		"AWS::Partition": partition,
+		"AWS::Region":    region,
+		"AWS::StackName": serviceName,
+	}
+
+	var errorText []string
+	for _, eachRoleName := range roleResourceNames {
+		roleResource, roleResourceExists := template.Resources[eachRoleName]
+		if !roleResourceExists {
+			continue
+		}
+		iamRole, iamRoleOk := templateIAMRole(roleResource)
+		if !iamRoleOk || iamRole.Policies == nil {
+			continue
+		}
+		for _, eachPolicy := range *iamRole.Policies {
+			policyJSON, policyJSONErr := json.Marshal(eachPolicy.PolicyDocument)
+			if policyJSONErr != nil {
+				return errors.Wrapf(policyJSONErr, "Failed to marshal IAM policy")
+			}
+			var policyDocument interface{}
+			unmarshalErr := json.Unmarshal(policyJSON, &policyDocument)
+			if unmarshalErr != nil {
+				return errors.Wrapf(unmarshalErr, "Failed to unmarshal IAM policy")
+			}
+			resolvedJSON, resolvedJSONErr := json.Marshal(resolvePolicyIntrinsics(policyDocument,
+				pseudoParameters))
+			if resolvedJSONErr != nil {
+				return errors.Wrapf(resolvedJSONErr, "Failed to marshal IAM policy")
+			}
+			findings, findingsErr := spartaIAM.ValidatePolicy(awsSession, string(resolvedJSON))
+			if findingsErr != nil {
+				return findingsErr
+			}
+			for _, eachFinding := range findings {
+				logEntry := logger.WithFields(logrus.Fields{
+					"Role":      eachRoleName,
+					"IssueCode": aws.StringValue(eachFinding.IssueCode),
+					"Details":   aws.StringValue(eachFinding.FindingDetails),
+					"Link":      aws.StringValue(eachFinding.LearnMoreLink),
+				})
+				switch aws.StringValue(eachFinding.FindingType) {
+				case spartaIAM.PolicyFindingTypeError:
+					logEntry.Error("IAM policy validation error")
+					errorText = append(errorText, eachRoleName+": "+aws.StringValue(eachFinding.IssueCode))
+				case spartaIAM.PolicyFindingTypeSecurityWarning:
+					logEntry.Warn("IAM policy validation security warning")
+				default:
+					logEntry.WithField("FindingType", aws.StringValue(eachFinding.FindingType)).
+						Info("IAM policy validation finding")
+				}
+			}
+		}
+	}
+	if len(errorText) != 0 {
+		return errors.Errorf("IAM policy validation failed: %s",
+			strings.Join(errorText, ", "))
+	}
+	return nil
+}
+
+//
+// END - IAM privilege analysis
+////////////////////////////////////////////////////////////////////////////////
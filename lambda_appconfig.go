@@ -0,0 +1,226 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AppConfig
+//
+
+const (
+	// appConfigExtensionDefaultPort is the default port of the AppConfig
+	// extension's local HTTP endpoint
+	appConfigExtensionDefaultPort = "2772"
+	// appConfigDefaultCacheTTL is the default number of seconds that
+	// FeatureFlag caches the configuration
+	appConfigDefaultCacheTTL = 10
+)
+
+// AppConfig identifiers are 7 lowercase alphanumeric characters
+var reAppConfigID = regexp.MustCompile(`^[a-z0-9]{7}$`)
+
+// AppConfig integrates the function with an AWS AppConfig feature flag
+// configuration profile. The AWS AppConfig Agent Lambda extension layer is
+// added to the function and the Sparta-managed execution role is granted
+// access to the configuration. At runtime, use FeatureFlag to read the
+// flags. The extension polls AppConfig for changes, so flags are updated
+// without redeploying the function. See
+// https://docs.aws.amazon.com/appconfig/latest/userguide/appconfig-integration-lambda-extensions.html
+// for more information.
+type AppConfig struct {
+	// LayerArn is the AWS AppConfig Agent Lambda extension layer version
+	// ARN for the region and architecture (Required)
+	LayerArn gocf.Stringable
+	// Application is the AppConfig application ID or name (Required)
+	Application gocf.Stringable
+	// Environment is the AppConfig environment ID or name (Required)
+	Environment gocf.Stringable
+	// Profile is the configuration profile ID or name (Required)
+	Profile gocf.Stringable
+	// PollIntervalSeconds is how often the extension checks for
+	// configuration changes. Defaults to the extension's 45 seconds.
+	PollIntervalSeconds int64
+	// CacheTTLSeconds is how long FeatureFlag caches the configuration in
+	// the execution environment. Defaults to 10 seconds.
+	CacheTTLSeconds int64
+}
+
+func (appConfig *AppConfig) validate() error {
+	if appConfig.LayerArn == nil {
+		return errors.Errorf("AppConfig must define LayerArn")
+	}
+	if appConfig.Application == nil ||
+		appConfig.Environment == nil ||
+		appConfig.Profile == nil {
+		return errors.Errorf("AppConfig must define Application, Environment and Profile")
+	}
+	if appConfig.PollIntervalSeconds < 0 || appConfig.CacheTTLSeconds < 0 {
+		return errors.Errorf("AppConfig PollIntervalSeconds and CacheTTLSeconds must not be negative")
+	}
+	return nil
+}
+
+// appConfigIAMResourceSegment returns the ARN segment for the identifier. The
+// configuration ARN uses IDs, so literal names match any identifier.
+func appConfigIAMResourceSegment(identifier gocf.Stringable) *gocf.StringExpr {
+	identifierExpr := identifier.String()
+	if identifierExpr.Func == nil && !reAppConfigID.MatchString(identifierExpr.Literal) {
+		return gocf.String("*")
+	}
+	return identifierExpr
+}
+
+// iamStatements returns the privileges the extension requires to retrieve
+// the configuration
+// Ref: https://docs.aws.amazon.com/service-authorization/latest/reference/list_awsappconfig.html
+func (appConfig *AppConfig) iamStatements() []spartaIAM.PolicyStatement {
+	return []spartaIAM.PolicyStatement{
+		{
+			Effect: "Allow",
+			Action: []string{"appconfig:StartConfigurationSession",
+				"appconfig:GetLatestConfiguration"},
+			Resource: gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":appconfig:"),
+				gocf.Ref("AWS::Region"),
+				gocf.String(":"),
+				gocf.Ref("AWS::AccountId"),
+				gocf.String(":application/"),
+				appConfigIAMResourceSegment(appConfig.Application),
+				gocf.String("/environment/"),
+				appConfigIAMResourceSegment(appConfig.Environment),
+				gocf.String("/configuration/"),
+				appConfigIAMResourceSegment(appConfig.Profile)),
+		},
+	}
+}
+
+// environment returns the environment variables that configure the
+// extension and FeatureFlag
+func (appConfig *AppConfig) environment() map[string]*gocf.StringExpr {
+	env := map[string]*gocf.StringExpr{
+		envVarAppConfigApplication: appConfig.Application.String(),
+		envVarAppConfigEnvironment: appConfig.Environment.String(),
+		envVarAppConfigProfile:     appConfig.Profile.String(),
+		// Retrieve the configuration when the execution environment starts
+		"AWS_APPCONFIG_EXTENSION_PREFETCH_LIST": gocf.Join("",
+			gocf.String("/applications/"),
+			appConfig.Application.String(),
+			gocf.String("/environments/"),
+			appConfig.Environment.String(),
+			gocf.String("/configurations/"),
+			appConfig.Profile.String()),
+	}
+	if appConfig.PollIntervalSeconds != 0 {
+		env["AWS_APPCONFIG_EXTENSION_POLL_INTERVAL_SECONDS"] =
+			gocf.String(strconv.FormatInt(appConfig.PollIntervalSeconds, 10))
+	}
+	if appConfig.CacheTTLSeconds != 0 {
+		env[envVarAppConfigCacheTTL] = gocf.String(strconv.FormatInt(appConfig.CacheTTLSeconds, 10))
+	}
+	return env
+}
+
+// Cache of the feature flag configuration that is shared by all invocations
+// in the same execution environment
+var appConfigFlags map[string]json.RawMessage
+var appConfigFlagsExpiry time.Time
+var appConfigFlagsMutex sync.Mutex
+
+// appConfigFeatureFlags returns the cached feature flag configuration,
+// retrieving it from the extension if the cache has expired
+func appConfigFeatureFlags(ctx context.Context) (map[string]json.RawMessage, error) {
+	application := os.Getenv(envVarAppConfigApplication)
+	if application == "" {
+		return nil, errors.Errorf("AppConfig is not enabled for this function")
+	}
+	appConfigFlagsMutex.Lock()
+	defer appConfigFlagsMutex.Unlock()
+	if appConfigFlags != nil && time.Now().Before(appConfigFlagsExpiry) {
+		return appConfigFlags, nil
+	}
+	port := os.Getenv("AWS_APPCONFIG_EXTENSION_HTTP_PORT")
+	if port == "" {
+		port = appConfigExtensionDefaultPort
+	}
+	configURL := fmt.Sprintf("http://localhost:%s/applications/%s/environments/%s/configurations/%s",
+		port,
+		url.PathEscape(application),
+		url.PathEscape(os.Getenv(envVarAppConfigEnvironment)),
+		url.PathEscape(os.Getenv(envVarAppConfigProfile)))
+	req, reqErr := http.NewRequest(http.MethodGet, configURL, nil)
+	if reqErr != nil {
+		return nil, errors.Wrapf(reqErr, "Failed to create AppConfig request")
+	}
+	resp, respErr := http.DefaultClient.Do(req.WithContext(ctx))
+	if respErr != nil {
+		return nil, errors.Wrapf(respErr, "Failed to get AppConfig configuration")
+	}
+	defer resp.Body.Close()
+	body, bodyErr := ioutil.ReadAll(resp.Body)
+	if bodyErr != nil {
+		return nil, errors.Wrapf(bodyErr, "Failed to read AppConfig configuration")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Failed to get AppConfig configuration. Status: %d, Body: %s",
+			resp.StatusCode,
+			string(body))
+	}
+	flags := make(map[string]json.RawMessage)
+	unmarshalErr := json.Unmarshal(body, &flags)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal AppConfig feature flags")
+	}
+	cacheTTL := int64(appConfigDefaultCacheTTL)
+	if ttlValue := os.Getenv(envVarAppConfigCacheTTL); ttlValue != "" {
+		parsedTTL, parsedTTLErr := strconv.ParseInt(ttlValue, 10, 64)
+		if parsedTTLErr == nil {
+			cacheTTL = parsedTTL
+		}
+	}
+	appConfigFlags = flags
+	appConfigFlagsExpiry = time.Now().Add(time.Duration(cacheTTL) * time.Second)
+	return flags, nil
+}
+
+// FeatureFlag returns true if the named LambdaFunctionOptions.AppConfig
+// feature flag is enabled. The configuration is read from the AppConfig
+// extension and cached for the AppConfig CacheTTLSeconds.
+func FeatureFlag(ctx context.Context, name string) (bool, error) {
+	flags, flagsErr := appConfigFeatureFlags(ctx)
+	if flagsErr != nil {
+		return false, flagsErr
+	}
+	flagValue, flagValueExists := flags[name]
+	if !flagValueExists {
+		return false, errors.Errorf("AppConfig feature flag %s is not defined", name)
+	}
+	flag := struct {
+		Enabled bool `json:"enabled"`
+	}{}
+	unmarshalErr := json.Unmarshal(flagValue, &flag)
+	if unmarshalErr != nil {
+		return false, errors.Wrapf(unmarshalErr, "Failed to unmarshal AppConfig feature flag %s", name)
+	}
+	return flag.Enabled, nil
+}
+
+//
+// END - AppConfig
+////////////////////////////////////////////////////////////////////////////////
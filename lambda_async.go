@@ -0,0 +1,283 @@
+package sparta
+
+import (
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - AsyncDestination
+//
+
+// AsyncDestinationType is the type of resource that receives
+// asynchronous invocation records
+type AsyncDestinationType string
+
+const (
+	// AsyncDestinationSQS is an SQS queue destination
+	AsyncDestinationSQS AsyncDestinationType = "sqs"
+	// AsyncDestinationSNS is an SNS topic destination
+	AsyncDestinationSNS AsyncDestinationType = "sns"
+	// AsyncDestinationLambda is a Lambda function destination
+	AsyncDestinationLambda AsyncDestinationType = "lambda"
+	// AsyncDestinationEventBridge is an EventBridge event bus destination
+	AsyncDestinationEventBridge AsyncDestinationType = "events"
+)
+
+// Bounds for the EventInvokeConfig values
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-lambda-eventinvokeconfig.html
+const (
+	minMaximumEventAgeInSeconds = 60
+	maxMaximumEventAgeInSeconds = 21600
+	maxMaximumRetryAttempts     = 2
+)
+
+// AsyncDestination is a resource that receives either dead letter events
+// or asynchronous invocation records. If Arn is nil, Sparta provisions
+// a new SQS queue or SNS topic and grants the lambda execution role
+// the privileges to use it.
+type AsyncDestination struct {
+	// Type of the destination resource
+	Type AsyncDestinationType
+	// Arn of an existing destination. If nil, a new resource of the given
+	// Type is provisioned. Only SQS and SNS destinations can be provisioned.
+	Arn gocf.Stringable
+}
+
+// action returns the IAM action required to publish to the destination
+func (destination *AsyncDestination) action() string {
+	switch destination.Type {
+	case AsyncDestinationSQS:
+		return "sqs:SendMessage"
+	case AsyncDestinationSNS:
+		return "sns:Publish"
+	case AsyncDestinationLambda:
+		return "lambda:InvokeFunction"
+	case AsyncDestinationEventBridge:
+		return "events:PutEvents"
+	}
+	return ""
+}
+
+func (destination *AsyncDestination) validate(name string) error {
+	if destination.action() == "" {
+		return errors.Errorf("%s has an unsupported destination type: %s",
+			name,
+			destination.Type)
+	}
+	if destination.Arn == nil &&
+		destination.Type != AsyncDestinationSQS &&
+		destination.Type != AsyncDestinationSNS {
+		return errors.Errorf("%s must define an Arn for %s destinations",
+			name,
+			destination.Type)
+	}
+	return nil
+}
+
+// export returns the destination ARN, provisioning a new resource
+// if necessary, and the IAM statement that grants access to it
+func (destination *AsyncDestination) export(lambdaLogicalResourceName string,
+	name string,
+	template *gocf.Template) (*gocf.StringExpr, spartaIAM.PolicyStatement) {
+
+	var destinationArn *gocf.StringExpr
+	if destination.Arn != nil {
+		destinationArn = destination.Arn.String()
+	} else {
+		resourceName := CloudFormationResourceName(name, lambdaLogicalResourceName)
+		switch destination.Type {
+		case AsyncDestinationSQS:
+			template.AddResource(resourceName, &gocf.SQSQueue{})
+			destinationArn = gocf.GetAtt(resourceName, "Arn")
+		case AsyncDestinationSNS:
+			template.AddResource(resourceName, &gocf.SNSTopic{})
+			destinationArn = gocf.Ref(resourceName).String()
+		}
+	}
+	return destinationArn, spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{destination.action()},
+		Resource: destinationArn,
+	}
+}
+
+// EventInvokeConfig configures the error handling and destinations for
+// asynchronous invocations. See
+// https://docs.aws.amazon.com/lambda/latest/dg/invocation-async.html
+// for more information.
+type EventInvokeConfig struct {
+	// OnSuccess is the optional destination for successful invocation records
+	OnSuccess *AsyncDestination
+	// OnFailure is the optional destination for failed invocation records
+	OnFailure *AsyncDestination
+	// MaximumEventAgeInSeconds is the maximum age of a request that Lambda
+	// sends to the function for processing. Zero uses the Lambda default.
+	MaximumEventAgeInSeconds int64
+	// MaximumRetryAttempts is the maximum number of times to retry when
+	// the function returns an error. Nil uses the Lambda default.
+	MaximumRetryAttempts *int64
+}
+
+func (invokeConfig *EventInvokeConfig) validate() error {
+	if invokeConfig.MaximumEventAgeInSeconds != 0 &&
+		(invokeConfig.MaximumEventAgeInSeconds < minMaximumEventAgeInSeconds ||
+			invokeConfig.MaximumEventAgeInSeconds > maxMaximumEventAgeInSeconds) {
+		return errors.Errorf("EventInvokeConfig MaximumEventAgeInSeconds must be in the range [%d, %d]. Found: %d",
+			minMaximumEventAgeInSeconds,
+			maxMaximumEventAgeInSeconds,
+			invokeConfig.MaximumEventAgeInSeconds)
+	}
+	if invokeConfig.MaximumRetryAttempts != nil &&
+		(*invokeConfig.MaximumRetryAttempts < 0 ||
+			*invokeConfig.MaximumRetryAttempts > maxMaximumRetryAttempts) {
+		return errors.Errorf("EventInvokeConfig MaximumRetryAttempts must be in the range [0, %d]. Found: %d",
+			maxMaximumRetryAttempts,
+			*invokeConfig.MaximumRetryAttempts)
+	}
+	if invokeConfig.OnSuccess != nil {
+		if validateErr := invokeConfig.OnSuccess.validate("EventInvokeConfig OnSuccess"); validateErr != nil {
+			return validateErr
+		}
+	}
+	if invokeConfig.OnFailure != nil {
+		if validateErr := invokeConfig.OnFailure.validate("EventInvokeConfig OnFailure"); validateErr != nil {
+			return validateErr
+		}
+	}
+	return nil
+}
+
+// validateAsyncOptions ensures the dead letter and async invocation
+// options are consistent
+func validateAsyncOptions(options *LambdaFunctionOptions) error {
+	if options == nil {
+		return nil
+	}
+	if options.DeadLetterConfig != nil {
+		if options.DeadLetterConfigArn != nil {
+			return errors.Errorf("Lambda options must not define both DeadLetterConfigArn and DeadLetterConfig")
+		}
+		if options.DeadLetterConfig.Type != AsyncDestinationSQS &&
+			options.DeadLetterConfig.Type != AsyncDestinationSNS {
+			return errors.Errorf("DeadLetterConfig must be an SQS queue or SNS topic. Found: %s",
+				options.DeadLetterConfig.Type)
+		}
+	}
+	if options.EventInvokeConfig != nil {
+		return options.EventInvokeConfig.validate()
+	}
+	return nil
+}
+
+// exportDeadLetterConfig returns the lambda DeadLetterConfig, provisioning
+// the target if needed, together with the IAM statements that grant
+// the execution role access to it
+func exportDeadLetterConfig(lambdaLogicalResourceName string,
+	options *LambdaFunctionOptions,
+	template *gocf.Template) (*gocf.LambdaFunctionDeadLetterConfig, []spartaIAM.PolicyStatement) {
+
+	if options.DeadLetterConfigArn != nil {
+		return &gocf.LambdaFunctionDeadLetterConfig{
+			TargetArn: options.DeadLetterConfigArn.String(),
+		}, nil
+	}
+	if options.DeadLetterConfig == nil {
+		return nil, nil
+	}
+	targetArn, statement := options.DeadLetterConfig.export(lambdaLogicalResourceName,
+		"DeadLetter",
+		template)
+	return &gocf.LambdaFunctionDeadLetterConfig{
+		TargetArn: targetArn,
+	}, []spartaIAM.PolicyStatement{statement}
+}
+
+// exportEventInvokeConfig adds the AWS::Lambda::EventInvokeConfig resource
+// and returns it together with the IAM statements that grant the execution
+// role access to the destinations. The configuration applies to the
+// published alias, or to $LATEST if the function doesn't publish one.
+func exportEventInvokeConfig(lambdaLogicalResourceName string,
+	invokeConfig *EventInvokeConfig,
+	aliasName string,
+	template *gocf.Template,
+	logger *logrus.Logger) (*gocf.Resource, []spartaIAM.PolicyStatement) {
+
+	if invokeConfig == nil {
+		return nil, nil
+	}
+	qualifier := aliasName
+	if qualifier == "" {
+		qualifier = "$LATEST"
+	}
+	statements := make([]spartaIAM.PolicyStatement, 0)
+	invokeConfigResource := lambdaEventInvokeConfig{
+		FunctionName: gocf.Ref(lambdaLogicalResourceName).String(),
+		Qualifier:    gocf.String(qualifier),
+	}
+	if invokeConfig.MaximumEventAgeInSeconds != 0 {
+		invokeConfigResource.MaximumEventAgeInSeconds = gocf.Integer(invokeConfig.MaximumEventAgeInSeconds)
+	}
+	if invokeConfig.MaximumRetryAttempts != nil {
+		invokeConfigResource.MaximumRetryAttempts = gocf.Integer(*invokeConfig.MaximumRetryAttempts)
+	}
+	if invokeConfig.OnSuccess != nil || invokeConfig.OnFailure != nil {
+		invokeConfigResource.DestinationConfig = &lambdaEventInvokeConfigDestinationConfig{}
+	}
+	if invokeConfig.OnSuccess != nil {
+		destinationArn, statement := invokeConfig.OnSuccess.export(lambdaLogicalResourceName,
+			"OnSuccessDestination",
+			template)
+		invokeConfigResource.DestinationConfig.OnSuccess = &lambdaEventInvokeConfigDestination{
+			Destination: destinationArn,
+		}
+		statements = append(statements, statement)
+	}
+	if invokeConfig.OnFailure != nil {
+		destinationArn, statement := invokeConfig.OnFailure.export(lambdaLogicalResourceName,
+			"OnFailureDestination",
+			template)
+		invokeConfigResource.DestinationConfig.OnFailure = &lambdaEventInvokeConfigDestination{
+			Destination: destinationArn,
+		}
+		statements = append(statements, statement)
+	}
+	invokeConfigResourceName := CloudFormationResourceName("EventInvokeConfig",
+		lambdaLogicalResourceName)
+	cfResource := template.AddResource(invokeConfigResourceName, invokeConfigResource)
+
+	logger.WithFields(logrus.Fields{
+		"Resource": invokeConfigResourceName,
+	}).Debug("Adding Lambda EventInvokeConfig")
+	return cfResource, statements
+}
+
+// exportAsyncPolicy adds an AWS::IAM::Policy resource that grants the
+// lambda execution role access to the dead letter and destination
+// resources. It returns the policy resource name, or an empty string
+// if no policy was created.
+func exportAsyncPolicy(lambdaLogicalResourceName string,
+	roleLogicalResourceName string,
+	statements []spartaIAM.PolicyStatement,
+	template *gocf.Template) string {
+	if len(statements) == 0 || roleLogicalResourceName == "" {
+		return ""
+	}
+	policyResourceName := CloudFormationResourceName("AsyncInvokePolicy",
+		lambdaLogicalResourceName)
+	template.AddResource(policyResourceName, &gocf.IAMPolicy{
+		PolicyDocument: ArbitraryJSONObject{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		},
+		PolicyName: gocf.String("AsyncInvokePolicy"),
+		Roles:      gocf.StringList(gocf.Ref(roleLogicalResourceName)),
+	})
+	return policyResourceName
+}
+
+//
+// END - AsyncDestination
+////////////////////////////////////////////////////////////////////////////////
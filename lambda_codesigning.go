@@ -0,0 +1,127 @@
+package sparta
+
+import (
+	"encoding/json"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - CodeSigningConfig
+//
+
+// Code signing policies for untrusted artifacts. See
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-codesigning.html
+// for more information.
+const (
+	// @enum UntrustedArtifactOnDeployment
+	UntrustedArtifactOnDeploymentWarn = "Warn"
+	// @enum UntrustedArtifactOnDeployment
+	UntrustedArtifactOnDeploymentEnforce = "Enforce"
+)
+
+// Lambda code signing configurations support up to 20 signing profiles
+const maxCodeSigningProfileVersionArns = 20
+
+// CodeSigningConfig attaches an AWS::Lambda::CodeSigningConfig to the
+// lambda function. Functions that share the same configuration share a
+// single CodeSigningConfig resource.
+type CodeSigningConfig struct {
+	// Arn is an existing CodeSigningConfig. If defined, Sparta does not
+	// create a new configuration.
+	Arn gocf.Stringable
+	// Description of the new configuration
+	Description string
+	// SigningProfileVersionArns are the AWS Signer profile versions that
+	// are trusted to sign the function's code
+	SigningProfileVersionArns []gocf.Stringable
+	// UntrustedArtifactOnDeployment is the policy for code that fails
+	// the signature validation. Defaults to UntrustedArtifactOnDeploymentWarn.
+	UntrustedArtifactOnDeployment string
+	// SigningProfileName is the optional AWS Signer profile that Sparta
+	// uses to sign the uploaded code archive before provisioning. Signing
+	// requires an S3 bucket with versioning enabled.
+	SigningProfileName string
+}
+
+func (signingConfig *CodeSigningConfig) validate() error {
+	if signingConfig.Arn != nil {
+		if len(signingConfig.SigningProfileVersionArns) != 0 {
+			return errors.Errorf("CodeSigningConfig must not define both Arn and SigningProfileVersionArns")
+		}
+		return nil
+	}
+	if len(signingConfig.SigningProfileVersionArns) == 0 ||
+		len(signingConfig.SigningProfileVersionArns) > maxCodeSigningProfileVersionArns {
+		return errors.Errorf("CodeSigningConfig must define between 1 and %d SigningProfileVersionArns. Found: %d",
+			maxCodeSigningProfileVersionArns,
+			len(signingConfig.SigningProfileVersionArns))
+	}
+	switch signingConfig.UntrustedArtifactOnDeployment {
+	case "", UntrustedArtifactOnDeploymentWarn, UntrustedArtifactOnDeploymentEnforce:
+	default:
+		return errors.Errorf("CodeSigningConfig has an unsupported UntrustedArtifactOnDeployment value: %s",
+			signingConfig.UntrustedArtifactOnDeployment)
+	}
+	return nil
+}
+
+// export returns the CodeSigningConfig ARN, creating the resource if needed
+func (signingConfig *CodeSigningConfig) export(template *gocf.Template) (*gocf.StringExpr, error) {
+	if signingConfig.Arn != nil {
+		return signingConfig.Arn.String(), nil
+	}
+	untrustedPolicy := signingConfig.UntrustedArtifactOnDeployment
+	if untrustedPolicy == "" {
+		untrustedPolicy = UntrustedArtifactOnDeploymentWarn
+	}
+	signingConfigResource := lambdaCodeSigningConfig{
+		AllowedPublishers: &lambdaCodeSigningConfigAllowedPublishers{
+			SigningProfileVersionArns: gocf.StringList(signingConfig.SigningProfileVersionArns...),
+		},
+		CodeSigningPolicies: &lambdaCodeSigningConfigCodeSigningPolicies{
+			UntrustedArtifactOnDeployment: gocf.String(untrustedPolicy),
+		},
+	}
+	if signingConfig.Description != "" {
+		signingConfigResource.Description = gocf.String(signingConfig.Description)
+	}
+	// Identical configurations share the same resource
+	resourceJSON, resourceJSONErr := json.Marshal(signingConfigResource)
+	if resourceJSONErr != nil {
+		return nil, errors.Wrapf(resourceJSONErr, "Failed to marshal CodeSigningConfig")
+	}
+	signingConfigResourceName := CloudFormationResourceName("CodeSigningConfig",
+		string(resourceJSON))
+	if _, exists := template.Resources[signingConfigResourceName]; !exists {
+		template.AddResource(signingConfigResourceName, signingConfigResource)
+	}
+	return gocf.GetAtt(signingConfigResourceName, "CodeSigningConfigArn"), nil
+}
+
+// codeSigningProfileName returns the AWS Signer profile name used to sign
+// the code archive, or an empty string if the archive isn't signed. All
+// functions share the same archive, so they must agree on the profile.
+func codeSigningProfileName(lambdaAWSInfos []*LambdaAWSInfo) (string, error) {
+	profileName := ""
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.Options == nil ||
+			eachLambda.Options.CodeSigningConfig == nil ||
+			eachLambda.Options.CodeSigningConfig.SigningProfileName == "" {
+			continue
+		}
+		lambdaProfileName := eachLambda.Options.CodeSigningConfig.SigningProfileName
+		if profileName != "" && profileName != lambdaProfileName {
+			return "", errors.Errorf("All CodeSigningConfig entries must use the same SigningProfileName. Found: %s and %s",
+				profileName,
+				lambdaProfileName)
+		}
+		profileName = lambdaProfileName
+	}
+	return profileName, nil
+}
+
+//
+// END - CodeSigningConfig
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,141 @@
+package sparta
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - ProvisionedConcurrency
+//
+
+// Default target tracking value for the LambdaProvisionedConcurrencyUtilization
+// metric. Ref: https://docs.aws.amazon.com/lambda/latest/dg/configuration-concurrency.html#managing-provisioned-concurrency
+const defaultProvisionedConcurrencyTargetUtilization = 0.7
+
+// ProvisionedConcurrencyAutoScaling defines an Application Auto Scaling
+// target tracking policy for the provisioned concurrency alias. See
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-concurrency.html#managing-provisioned-concurency-autoscaling
+// for more information.
+type ProvisionedConcurrencyAutoScaling struct {
+	// MinCapacity is the minimum number of provisioned concurrent executions
+	MinCapacity int64
+	// MaxCapacity is the maximum number of provisioned concurrent executions
+	MaxCapacity int64
+	// TargetUtilization is the target LambdaProvisionedConcurrencyUtilization
+	// value in the range (0, 1]. Defaults to 0.7.
+	TargetUtilization float64
+	// ScaleInCooldown is the optional number of seconds after a scale-in
+	// activity completes before another scale-in activity can start
+	ScaleInCooldown int64
+	// ScaleOutCooldown is the optional number of seconds after a scale-out
+	// activity completes before another scale-out activity can start
+	ScaleOutCooldown int64
+}
+
+// ProvisionedConcurrency configures provisioned concurrency for a published
+// version of the lambda function. Sparta publishes a new version for
+// each build and points the alias at it. See also
+// LambdaFunctionOptions.AutoPublishAlias.
+type ProvisionedConcurrency struct {
+	// AliasName is the alias that references the published version. Defaults
+	// to the LambdaFunctionOptions.AutoPublishAlias value, or DefaultAliasName
+	// if neither is defined.
+	AliasName string
+	// ProvisionedConcurrentExecutions is the number of provisioned
+	// concurrent executions for the alias
+	ProvisionedConcurrentExecutions int64
+	// AutoScaling optionally scales the provisioned concurrency
+	// between MinCapacity and MaxCapacity
+	AutoScaling *ProvisionedConcurrencyAutoScaling
+}
+
+func (provisioned *ProvisionedConcurrency) validate() error {
+	if provisioned.ProvisionedConcurrentExecutions <= 0 {
+		return errors.Errorf("ProvisionedConcurrentExecutions must be greater than zero. Found: %d",
+			provisioned.ProvisionedConcurrentExecutions)
+	}
+	autoScaling := provisioned.AutoScaling
+	if autoScaling == nil {
+		return nil
+	}
+	if autoScaling.MinCapacity <= 0 || autoScaling.MaxCapacity < autoScaling.MinCapacity {
+		return errors.Errorf("ProvisionedConcurrency AutoScaling requires 0 < MinCapacity <= MaxCapacity. Found: [%d, %d]",
+			autoScaling.MinCapacity,
+			autoScaling.MaxCapacity)
+	}
+	if provisioned.ProvisionedConcurrentExecutions < autoScaling.MinCapacity ||
+		provisioned.ProvisionedConcurrentExecutions > autoScaling.MaxCapacity {
+		return errors.Errorf("ProvisionedConcurrentExecutions must be in the AutoScaling range [%d, %d]. Found: %d",
+			autoScaling.MinCapacity,
+			autoScaling.MaxCapacity,
+			provisioned.ProvisionedConcurrentExecutions)
+	}
+	if autoScaling.TargetUtilization < 0 || autoScaling.TargetUtilization > 1 {
+		return errors.Errorf("ProvisionedConcurrency AutoScaling TargetUtilization must be in the range (0, 1]. Found: %f",
+			autoScaling.TargetUtilization)
+	}
+	return nil
+}
+
+// exportAutoScaling adds the optional Application Auto Scaling resources
+// for the provisioned concurrency alias to the template
+func (provisioned *ProvisionedConcurrency) exportAutoScaling(lambdaLogicalResourceName string,
+	aliasName string,
+	aliasResourceName string,
+	template *gocf.Template) {
+
+	autoScaling := provisioned.AutoScaling
+	if autoScaling == nil {
+		return
+	}
+	// Ref: https://docs.aws.amazon.com/autoscaling/application/APIReference/API_RegisterScalableTarget.html
+	scalableTargetResourceName := CloudFormationResourceName("LambdaScalableTarget",
+		lambdaLogicalResourceName,
+		aliasName)
+	scalableTarget := template.AddResource(scalableTargetResourceName,
+		&gocf.ApplicationAutoScalingScalableTarget{
+			MaxCapacity: gocf.Integer(autoScaling.MaxCapacity),
+			MinCapacity: gocf.Integer(autoScaling.MinCapacity),
+			ResourceID: gocf.Join("",
+				gocf.String("function:"),
+				gocf.Ref(lambdaLogicalResourceName),
+				gocf.String(":"),
+				gocf.String(aliasName)),
+			ScalableDimension: gocf.String("lambda:function:ProvisionedConcurrency"),
+			ServiceNamespace:  gocf.String("lambda"),
+		})
+	scalableTarget.DependsOn = append(scalableTarget.DependsOn, aliasResourceName)
+
+	targetUtilization := autoScaling.TargetUtilization
+	if targetUtilization == 0 {
+		targetUtilization = defaultProvisionedConcurrencyTargetUtilization
+	}
+	targetTracking := &applicationAutoScalingTargetTrackingConfiguration{
+		PredefinedMetricSpecification: &gocf.ApplicationAutoScalingScalingPolicyPredefinedMetricSpecification{
+			PredefinedMetricType: gocf.String("LambdaProvisionedConcurrencyUtilization"),
+		},
+		TargetValue: targetUtilization,
+	}
+	if autoScaling.ScaleInCooldown != 0 {
+		targetTracking.ScaleInCooldown = gocf.Integer(autoScaling.ScaleInCooldown)
+	}
+	if autoScaling.ScaleOutCooldown != 0 {
+		targetTracking.ScaleOutCooldown = gocf.Integer(autoScaling.ScaleOutCooldown)
+	}
+	scalingPolicyResourceName := CloudFormationResourceName("LambdaScalingPolicy",
+		lambdaLogicalResourceName,
+		aliasName)
+	template.AddResource(scalingPolicyResourceName, &applicationAutoScalingScalingPolicy{
+		ApplicationAutoScalingScalingPolicy: gocf.ApplicationAutoScalingScalingPolicy{
+			PolicyName:      gocf.String(scalingPolicyResourceName),
+			PolicyType:      gocf.String("TargetTrackingScaling"),
+			ScalingTargetID: gocf.Ref(scalableTargetResourceName).String(),
+		},
+		TargetTrackingScalingPolicyConfiguration: targetTracking,
+	})
+}
+
+//
+// END - ProvisionedConcurrency
+////////////////////////////////////////////////////////////////////////////////
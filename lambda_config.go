@@ -0,0 +1,255 @@
+package sparta
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - ConfigVariable
+//
+
+// ConfigValueType is the type that a ConfigVariable value is converted to
+type ConfigValueType string
+
+const (
+	// ConfigValueString is a string value
+	// @enum ConfigValueType
+	ConfigValueString ConfigValueType = "string"
+	// ConfigValueInt is a base 10 int64 value
+	// @enum ConfigValueType
+	ConfigValueInt ConfigValueType = "int"
+	// ConfigValueFloat is a float64 value
+	// @enum ConfigValueType
+	ConfigValueFloat ConfigValueType = "float"
+	// ConfigValueBool is a bool value parsed with strconv.ParseBool
+	// @enum ConfigValueType
+	ConfigValueBool ConfigValueType = "bool"
+	// ConfigValueDuration is a time.Duration value parsed with
+	// time.ParseDuration (eg, "250ms")
+	// @enum ConfigValueType
+	ConfigValueDuration ConfigValueType = "duration"
+)
+
+var reConfigName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ConfigVariable declares an environment variable that the function reads
+// with Config(ctx). Declared variables are converted and validated once,
+// when the execution environment starts, so that a misconfigured function
+// fails before it handles any requests.
+type ConfigVariable struct {
+	// Type is the value type. Defaults to ConfigValueString.
+	Type ConfigValueType
+	// Required variables must be defined in the environment. Required
+	// variables must not define a Default.
+	Required bool
+	// Default is the value used when the variable isn't defined
+	Default string
+	// Value is the optional value published into the function's
+	// environment. If empty, the variable must be defined by other means
+	// (eg, LambdaFunctionOptions.Environment).
+	Value gocf.Stringable
+}
+
+func (configVar *ConfigVariable) valueType() ConfigValueType {
+	if configVar.Type == "" {
+		return ConfigValueString
+	}
+	return configVar.Type
+}
+
+// parse converts the raw value to the declared type
+func (configVar *ConfigVariable) parse(rawValue string) (interface{}, error) {
+	switch configVar.valueType() {
+	case ConfigValueString:
+		return rawValue, nil
+	case ConfigValueInt:
+		return strconv.ParseInt(rawValue, 10, 64)
+	case ConfigValueFloat:
+		return strconv.ParseFloat(rawValue, 64)
+	case ConfigValueBool:
+		return strconv.ParseBool(rawValue)
+	case ConfigValueDuration:
+		return time.ParseDuration(rawValue)
+	default:
+		return nil, errors.Errorf("unsupported type: %s", configVar.Type)
+	}
+}
+
+func (configVar *ConfigVariable) validate(name string) error {
+	if !reConfigName.MatchString(name) {
+		return errors.Errorf("Config name must match %s. Found: %s",
+			reConfigName.String(),
+			name)
+	}
+	// Reserved by Sparta and AWS Lambda
+	if strings.HasPrefix(name, "SPARTA_") || strings.HasPrefix(name, "AWS_") {
+		return errors.Errorf("Config name %s must not use a reserved SPARTA_ or AWS_ prefix", name)
+	}
+	if configVar == nil {
+		return errors.Errorf("Config %s must not be nil", name)
+	}
+	switch configVar.valueType() {
+	case ConfigValueString,
+		ConfigValueInt,
+		ConfigValueFloat,
+		ConfigValueBool,
+		ConfigValueDuration:
+	default:
+		return errors.Errorf("Config %s has an unsupported type: %s",
+			name,
+			configVar.Type)
+	}
+	if configVar.Required && configVar.Default != "" {
+		return errors.Errorf("Config %s must not define both Required and Default", name)
+	}
+	if configVar.Default != "" {
+		_, parseErr := configVar.parse(configVar.Default)
+		if parseErr != nil {
+			return errors.Errorf("Config %s has an invalid %s Default: %s",
+				name,
+				configVar.valueType(),
+				parseErr)
+		}
+	}
+	return nil
+}
+
+// validateConfig ensures the config declarations are valid and don't
+// conflict with the user defined environment
+func validateConfig(options *LambdaFunctionOptions) error {
+	for eachName, eachVar := range options.Config {
+		if validateErr := eachVar.validate(eachName); validateErr != nil {
+			return validateErr
+		}
+		if _, exists := options.Environment[eachName]; exists && eachVar.Value != nil {
+			return errors.Errorf("Config %s Value conflicts with the Environment value", eachName)
+		}
+	}
+	return nil
+}
+
+//
+// END - ConfigVariable
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - FunctionConfig
+//
+
+// FunctionConfig is the set of converted ConfigVariable values for the
+// executing function. Use Config(ctx) to access it.
+type FunctionConfig struct {
+	values map[string]interface{}
+}
+
+// loadFunctionConfig converts and validates the declared variables using
+// the lookup function. All missing and invalid variables are reported in
+// a single error.
+func loadFunctionConfig(declared map[string]*ConfigVariable,
+	lookupEnv func(string) (string, bool)) (*FunctionConfig, error) {
+	config := &FunctionConfig{
+		values: make(map[string]interface{}, len(declared)),
+	}
+	names := make([]string, 0, len(declared))
+	for eachName := range declared {
+		names = append(names, eachName)
+	}
+	sort.Strings(names)
+
+	var missing []string
+	var invalid []string
+	for _, eachName := range names {
+		configVar := declared[eachName]
+		rawValue, rawValueExists := lookupEnv(eachName)
+		if !rawValueExists || rawValue == "" {
+			if configVar.Required {
+				missing = append(missing, eachName)
+				continue
+			}
+			if configVar.Default == "" {
+				continue
+			}
+			rawValue = configVar.Default
+		}
+		value, parseErr := configVar.parse(rawValue)
+		if parseErr != nil {
+			invalid = append(invalid, eachName+" ("+string(configVar.valueType())+")")
+			continue
+		}
+		config.values[eachName] = value
+	}
+	var errorText []string
+	if len(missing) != 0 {
+		errorText = append(errorText,
+			"missing required variables: "+strings.Join(missing, ", "))
+	}
+	if len(invalid) != 0 {
+		errorText = append(errorText,
+			"invalid variables: "+strings.Join(invalid, ", "))
+	}
+	if len(errorText) != 0 {
+		return nil, errors.Errorf("Invalid function configuration: %s",
+			strings.Join(errorText, "; "))
+	}
+	return config, nil
+}
+
+// Config returns the validated configuration for the executing function.
+// If the context doesn't include one (eg, outside of the AWS Lambda
+// binary), an empty FunctionConfig is returned.
+func Config(ctx context.Context) *FunctionConfig {
+	if config, configOk := ctx.Value(ContextKeyConfig).(*FunctionConfig); configOk && config != nil {
+		return config
+	}
+	return &FunctionConfig{
+		values: make(map[string]interface{}),
+	}
+}
+
+// Lookup returns the converted value and true if the variable is defined
+func (config *FunctionConfig) Lookup(name string) (interface{}, bool) {
+	value, exists := config.values[name]
+	return value, exists
+}
+
+// String returns the ConfigValueString value, or the empty string
+func (config *FunctionConfig) String(name string) string {
+	value, _ := config.values[name].(string)
+	return value
+}
+
+// Int returns the ConfigValueInt value, or zero
+func (config *FunctionConfig) Int(name string) int64 {
+	value, _ := config.values[name].(int64)
+	return value
+}
+
+// Float returns the ConfigValueFloat value, or zero
+func (config *FunctionConfig) Float(name string) float64 {
+	value, _ := config.values[name].(float64)
+	return value
+}
+
+// Bool returns the ConfigValueBool value, or false
+func (config *FunctionConfig) Bool(name string) bool {
+	value, _ := config.values[name].(bool)
+	return value
+}
+
+// Duration returns the ConfigValueDuration value, or zero
+func (config *FunctionConfig) Duration(name string) time.Duration {
+	value, _ := config.values[name].(time.Duration)
+	return value
+}
+
+//
+// END - FunctionConfig
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,368 @@
+package sparta
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Versions & Aliases
+//
+
+// DefaultAliasName is the alias name used for published versions if neither
+// LambdaFunctionOptions.AutoPublishAlias nor ProvisionedConcurrency.AliasName
+// is defined
+const DefaultAliasName = "live"
+
+// CodeDeploy predefined deployment configurations for Lambda functions. See
+// https://docs.aws.amazon.com/codedeploy/latest/userguide/deployment-configurations.html#deployment-configuration-lambda
+// for more information.
+const (
+	// @enum DeploymentType
+	DeploymentTypeCanary10Percent5Minutes = "CodeDeployDefault.LambdaCanary10Percent5Minutes"
+	// @enum DeploymentType
+	DeploymentTypeCanary10Percent10Minutes = "CodeDeployDefault.LambdaCanary10Percent10Minutes"
+	// @enum DeploymentType
+	DeploymentTypeCanary10Percent15Minutes = "CodeDeployDefault.LambdaCanary10Percent15Minutes"
+	// @enum DeploymentType
+	DeploymentTypeCanary10Percent30Minutes = "CodeDeployDefault.LambdaCanary10Percent30Minutes"
+	// @enum DeploymentType
+	DeploymentTypeLinear10PercentEvery1Minute = "CodeDeployDefault.LambdaLinear10PercentEvery1Minute"
+	// @enum DeploymentType
+	DeploymentTypeLinear10PercentEvery2Minutes = "CodeDeployDefault.LambdaLinear10PercentEvery2Minutes"
+	// @enum DeploymentType
+	DeploymentTypeLinear10PercentEvery3Minutes = "CodeDeployDefault.LambdaLinear10PercentEvery3Minutes"
+	// @enum DeploymentType
+	DeploymentTypeLinear10PercentEvery10Minutes = "CodeDeployDefault.LambdaLinear10PercentEvery10Minutes"
+	// @enum DeploymentType
+	DeploymentTypeAllAtOnce = "CodeDeployDefault.LambdaAllAtOnce"
+)
+
+// CodeDeployPrincipal is the principal that assumes the deployment role
+const CodeDeployPrincipal = "codedeploy.amazonaws.com"
+
+// CodeDeployLifecycleHookPrivilege is the privilege that DeploymentPreference
+// PreTraffic and PostTraffic hook functions require to report the validation
+// result to CodeDeploy. Add it to the hook function's IAMRoleDefinition.
+var CodeDeployLifecycleHookPrivilege = IAMRolePrivilege{
+	Actions: []string{"codedeploy:PutLifecycleEventHookExecutionStatus"},
+	Resource: gocf.Join("",
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":codedeploy:"),
+		gocf.Ref("AWS::Region"),
+		gocf.String(":"),
+		gocf.Ref("AWS::AccountId"),
+		gocf.String(":deploymentgroup:*")),
+}
+
+// DeploymentPreference defines how CodeDeploy shifts traffic from the
+// previous version to the newly published version of the lambda function. See
+// https://docs.aws.amazon.com/lambda/latest/dg/lambda-rolling-deployments.html
+// for more information.
+type DeploymentPreference struct {
+	// Type is the CodeDeploy deployment configuration (eg,
+	// DeploymentTypeCanary10Percent5Minutes)
+	Type string
+	// Alarms are the CloudWatch alarm names that, if triggered during the
+	// deployment, stop the deployment and roll back to the previous version
+	Alarms []gocf.Stringable
+	// PreTrafficHook is the optional lambda function that CodeDeploy invokes
+	// before traffic is shifted to the new version
+	PreTrafficHook *LambdaAWSInfo
+	// PostTrafficHook is the optional lambda function that CodeDeploy invokes
+	// after all traffic is shifted to the new version
+	PostTrafficHook *LambdaAWSInfo
+}
+
+// validate ensures the alias related options are consistent
+func validateAliasOptions(options *LambdaFunctionOptions) error {
+	if options == nil {
+		return nil
+	}
+	if options.ProvisionedConcurrency != nil {
+		validateErr := options.ProvisionedConcurrency.validate()
+		if validateErr != nil {
+			return validateErr
+		}
+		if options.ProvisionedConcurrency.AliasName != "" &&
+			options.AutoPublishAlias != "" &&
+			options.ProvisionedConcurrency.AliasName != options.AutoPublishAlias {
+			return errors.Errorf("ProvisionedConcurrency AliasName (%s) must match the AutoPublishAlias (%s)",
+				options.ProvisionedConcurrency.AliasName,
+				options.AutoPublishAlias)
+		}
+	}
+	if options.DeploymentPreference != nil && options.DeploymentPreference.Type == "" {
+		return errors.Errorf("DeploymentPreference requires a Type")
+	}
+	return nil
+}
+
+// publishedAliasName returns the name of the alias that references the
+// published version, or an empty string if no version should be published
+func publishedAliasName(options *LambdaFunctionOptions) string {
+	if options == nil {
+		return ""
+	}
+	if options.AutoPublishAlias != "" {
+		return options.AutoPublishAlias
+	}
+	if options.ProvisionedConcurrency != nil && options.ProvisionedConcurrency.AliasName != "" {
+		return options.ProvisionedConcurrency.AliasName
+	}
+	if options.ProvisionedConcurrency != nil || options.DeploymentPreference != nil {
+		return DefaultAliasName
+	}
+	return ""
+}
+
+// exportCodeDeployDeploymentGroup adds the CodeDeploy resources that shift
+// traffic to the published version and returns the alias UpdatePolicy
+func exportCodeDeployDeploymentGroup(serviceName string,
+	lambdaLogicalResourceName string,
+	preference *DeploymentPreference,
+	template *gocf.Template) (*gocf.UpdatePolicy, []string) {
+
+	// The CodeDeploy application and service role are shared by all
+	// functions in the stack
+	applicationResourceName := CloudFormationResourceName("CodeDeployApplication",
+		serviceName)
+	if _, exists := template.Resources[applicationResourceName]; !exists {
+		template.AddResource(applicationResourceName, &gocf.CodeDeployApplication{
+			ComputePlatform: gocf.String("Lambda"),
+		})
+	}
+	serviceRoleResourceName := CloudFormationResourceName("CodeDeployServiceRole",
+		serviceName)
+	if _, exists := template.Resources[serviceRoleResourceName]; !exists {
+		template.AddResource(serviceRoleResourceName, &gocf.IAMRole{
+			AssumeRolePolicyDocument: ArbitraryJSONObject{
+				"Version": "2012-10-17",
+				"Statement": []ArbitraryJSONObject{
+					{
+						"Effect": "Allow",
+						"Principal": ArbitraryJSONObject{
+							"Service": []string{CodeDeployPrincipal},
+						},
+						"Action": []string{"sts:AssumeRole"},
+					},
+				},
+			},
+			ManagedPolicyArns: gocf.StringList(gocf.Join("",
+				gocf.String("arn:"),
+				gocf.Ref("AWS::Partition"),
+				gocf.String(":iam::aws:policy/service-role/AWSCodeDeployRoleForLambda"))),
+		})
+	}
+	dependsOn := []string{applicationResourceName}
+
+	deploymentGroup := &gocf.CodeDeployDeploymentGroup{
+		ApplicationName: gocf.Ref(applicationResourceName).String(),
+		AutoRollbackConfiguration: &gocf.CodeDeployDeploymentGroupAutoRollbackConfiguration{
+			Enabled: gocf.Bool(true),
+			Events: gocf.StringList(gocf.String("DEPLOYMENT_FAILURE"),
+				gocf.String("DEPLOYMENT_STOP_ON_ALARM"),
+				gocf.String("DEPLOYMENT_STOP_ON_REQUEST")),
+		},
+		DeploymentConfigName: gocf.String(preference.Type),
+		DeploymentStyle: &gocf.CodeDeployDeploymentGroupDeploymentStyle{
+			DeploymentOption: gocf.String("WITH_TRAFFIC_CONTROL"),
+			DeploymentType:   gocf.String("BLUE_GREEN"),
+		},
+		ServiceRoleArn: gocf.GetAtt(serviceRoleResourceName, "Arn"),
+	}
+	if len(preference.Alarms) != 0 {
+		alarms := gocf.CodeDeployDeploymentGroupAlarmList{}
+		for _, eachAlarm := range preference.Alarms {
+			alarms = append(alarms, gocf.CodeDeployDeploymentGroupAlarm{
+				Name: eachAlarm.String(),
+			})
+		}
+		deploymentGroup.AlarmConfiguration = &gocf.CodeDeployDeploymentGroupAlarmConfiguration{
+			Alarms:  &alarms,
+			Enabled: gocf.Bool(true),
+		}
+	}
+	deploymentGroupResourceName := CloudFormationResourceName("CodeDeployDeploymentGroup",
+		lambdaLogicalResourceName)
+	template.AddResource(deploymentGroupResourceName, deploymentGroup)
+	dependsOn = append(dependsOn, deploymentGroupResourceName)
+
+	updatePolicy := &gocf.UpdatePolicy{
+		CodeDeployLambdaAliasUpdate: &gocf.UpdatePolicyCodeDeployLambdaAliasUpdate{
+			ApplicationName:     gocf.Ref(applicationResourceName).String(),
+			DeploymentGroupName: gocf.Ref(deploymentGroupResourceName).String(),
+		},
+	}
+	// The AWSCodeDeployRoleForLambda managed policy only allows invoking
+	// functions with a CodeDeployHook_ prefix, so grant access to the hooks
+	hookStatements := make([]spartaIAM.PolicyStatement, 0)
+	if preference.PreTrafficHook != nil {
+		updatePolicy.CodeDeployLambdaAliasUpdate.BeforeAllowTrafficHook =
+			gocf.Ref(preference.PreTrafficHook.LogicalResourceName()).String()
+		hookStatements = append(hookStatements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"lambda:InvokeFunction"},
+			Resource: gocf.GetAtt(preference.PreTrafficHook.LogicalResourceName(), "Arn"),
+		})
+	}
+	if preference.PostTrafficHook != nil {
+		updatePolicy.CodeDeployLambdaAliasUpdate.AfterAllowTrafficHook =
+			gocf.Ref(preference.PostTrafficHook.LogicalResourceName()).String()
+		hookStatements = append(hookStatements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"lambda:InvokeFunction"},
+			Resource: gocf.GetAtt(preference.PostTrafficHook.LogicalResourceName(), "Arn"),
+		})
+	}
+	if len(hookStatements) != 0 {
+		hookPolicyResourceName := CloudFormationResourceName("CodeDeployHookPolicy",
+			lambdaLogicalResourceName)
+		template.AddResource(hookPolicyResourceName, &gocf.IAMPolicy{
+			PolicyDocument: ArbitraryJSONObject{
+				"Version":   "2012-10-17",
+				"Statement": hookStatements,
+			},
+			PolicyName: gocf.String("CodeDeployHookPolicy"),
+			Roles:      gocf.StringList(gocf.Ref(serviceRoleResourceName)),
+		})
+		dependsOn = append(dependsOn, hookPolicyResourceName)
+	}
+	return updatePolicy, dependsOn
+}
+
+// lambdaInvocationArn returns the ARN that API Gateway integrations and
+// permissions invoke. This is the published alias if the function publishes
+// one, so that traffic shifting applies to those invocations.
+func lambdaInvocationArn(lambdaFn *LambdaAWSInfo) *gocf.StringExpr {
+	aliasName := publishedAliasName(lambdaFn.Options)
+	if aliasName == "" {
+		return gocf.GetAtt(lambdaFn.LogicalResourceName(), "Arn")
+	}
+	return gocf.Ref(CloudFormationResourceName("LambdaAlias",
+		lambdaFn.LogicalResourceName(),
+		aliasName)).String()
+}
+
+// publishedVersionHash returns the hash of the code archive and the function
+// configuration. CloudFormation only publishes a new version when the
+// version's logical resource name changes, so the name is keyed on what
+// the version snapshots rather than the buildID.
+func publishedVersionHash(lambdaLogicalResourceName string,
+	codeSHA256 string,
+	template *gocf.Template) (string, error) {
+
+	lambdaResource, lambdaResourceExists := template.Resources[lambdaLogicalResourceName]
+	if !lambdaResourceExists {
+		return "", errors.Errorf("Failed to find lambda resource %s", lambdaLogicalResourceName)
+	}
+	propertiesJSON, propertiesJSONErr := json.Marshal(lambdaResource.Properties)
+	if propertiesJSONErr != nil {
+		return "", errors.Wrapf(propertiesJSONErr, "Failed to marshal lambda resource")
+	}
+	var properties map[string]interface{}
+	unmarshalErr := json.Unmarshal(propertiesJSON, &properties)
+	if unmarshalErr != nil {
+		return "", errors.Wrapf(unmarshalErr, "Failed to unmarshal lambda resource")
+	}
+	// The S3 key may be unique per build, so use the archive hash
+	// instead
+	delete(properties, "Code")
+	configurationJSON, configurationJSONErr := json.Marshal(properties)
+	if configurationJSONErr != nil {
+		return "", errors.Wrapf(configurationJSONErr, "Failed to marshal lambda configuration")
+	}
+	hash := sha1.New()
+	_, writeErr := hash.Write([]byte(codeSHA256))
+	if writeErr == nil {
+		_, writeErr = hash.Write(configurationJSON)
+	}
+	if writeErr != nil {
+		return "", errors.Wrapf(writeErr, "Failed to update hash digest")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// exportPublishedAlias adds the AWS::Lambda::Version and AWS::Lambda::Alias
+// resources, together with any provisioned concurrency and CodeDeploy
+// resources, to the template. It returns the logical resource name of the
+// alias, or an empty string if no version is published. Versions are
+// retained on delete so that the previous version continues to serve
+// traffic until the alias is shifted to the new one.
+func exportPublishedAlias(serviceName string,
+	lambdaLogicalResourceName string,
+	options *LambdaFunctionOptions,
+	codeSHA256 string,
+	template *gocf.Template,
+	logger *logrus.Logger) (string, error) {
+
+	validationErr := validateAliasOptions(options)
+	if validationErr != nil {
+		return "", validationErr
+	}
+	aliasName := publishedAliasName(options)
+	if aliasName == "" {
+		return "", nil
+	}
+	versionHash, versionHashErr := publishedVersionHash(lambdaLogicalResourceName,
+		codeSHA256,
+		template)
+	if versionHashErr != nil {
+		return "", versionHashErr
+	}
+	versionResourceName := CloudFormationResourceName("LambdaVersion",
+		lambdaLogicalResourceName,
+		versionHash)
+	cfVersionResource := template.AddResource(versionResourceName, &gocf.LambdaVersion{
+		FunctionName: gocf.Ref(lambdaLogicalResourceName).String(),
+	})
+	cfVersionResource.DeletionPolicy = "Retain"
+
+	aliasResourceName := CloudFormationResourceName("LambdaAlias",
+		lambdaLogicalResourceName,
+		aliasName)
+	aliasResource := &lambdaAlias{
+		LambdaAlias: gocf.LambdaAlias{
+			FunctionName:    gocf.Ref(lambdaLogicalResourceName).String(),
+			FunctionVersion: gocf.GetAtt(versionResourceName, "Version"),
+			Name:            gocf.String(aliasName),
+		},
+	}
+	if options.ProvisionedConcurrency != nil {
+		aliasResource.ProvisionedConcurrencyConfig = &lambdaAliasProvisionedConcurrencyConfiguration{
+			ProvisionedConcurrentExecutions: gocf.Integer(options.ProvisionedConcurrency.ProvisionedConcurrentExecutions),
+		}
+	}
+	cfAliasResource := template.AddResource(aliasResourceName, aliasResource)
+	if options.DeploymentPreference != nil {
+		updatePolicy, dependsOn := exportCodeDeployDeploymentGroup(serviceName,
+			lambdaLogicalResourceName,
+			options.DeploymentPreference,
+			template)
+		cfAliasResource.UpdatePolicy = updatePolicy
+		cfAliasResource.DependsOn = append(cfAliasResource.DependsOn, dependsOn...)
+	}
+	if options.ProvisionedConcurrency != nil {
+		options.ProvisionedConcurrency.exportAutoScaling(lambdaLogicalResourceName,
+			aliasName,
+			aliasResourceName,
+			template)
+	}
+	logger.WithFields(logrus.Fields{
+		"Alias":                aliasName,
+		"Version":              versionResourceName,
+		"DeploymentPreference": options.DeploymentPreference != nil,
+	}).Debug("Adding published version alias")
+	return aliasResourceName, nil
+}
+
+//
+// END - Versions & Aliases
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,288 @@
+package sparta
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - DynamoDBResource
+//
+
+var reDynamoDBResourceName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// Ref: https://docs.aws.amazon.com/IAM/latest/UserGuide/list_amazondynamodb.html#amazondynamodb-resources-for-iam-policies
+var reDynamoDBTableArn = regexp.MustCompile(`^arn:[^:]+:dynamodb:[^:]+:[0-9]{12}:table/([a-zA-Z0-9_.-]{3,255})$`)
+
+// dynamoDBReadActions are the privileges granted for every table dependency
+var dynamoDBReadActions = []string{"dynamodb:BatchGetItem",
+	"dynamodb:ConditionCheckItem",
+	"dynamodb:DescribeTable",
+	"dynamodb:GetItem",
+	"dynamodb:Query",
+	"dynamodb:Scan",
+}
+
+// dynamoDBWriteActions are the additional privileges granted for table
+// dependencies that aren't ReadOnly
+var dynamoDBWriteActions = []string{"dynamodb:BatchWriteItem",
+	"dynamodb:DeleteItem",
+	"dynamodb:PutItem",
+	"dynamodb:UpdateItem",
+}
+
+// DynamoDBKey is a DynamoDB key schema attribute
+type DynamoDBKey struct {
+	// AttributeName is the name of the key attribute
+	AttributeName string
+	// AttributeType is the attribute type: S (string), N (number) or
+	// B (binary)
+	AttributeType string
+}
+
+func (key *DynamoDBKey) validate(keyName string) error {
+	if key.AttributeName == "" {
+		return errors.Errorf("DynamoDBResource %s AttributeName must not be empty", keyName)
+	}
+	switch key.AttributeType {
+	case "S", "N", "B":
+		return nil
+	}
+	return errors.Errorf("DynamoDBResource %s AttributeType must be one of S, N or B. Found: %s",
+		keyName,
+		key.AttributeType)
+}
+
+// DynamoDBResource is a DynamoDB table that a lambda function depends on.
+// Sparta creates the table from the PartitionKey and optional SortKey, or
+// references the existing table with the TableArn. The Sparta-managed
+// execution role is granted read and write privileges for the table and
+// its indexes, and the table is included in the function's discovery
+// information. Functions that declare a DynamoDBResource with the same Name
+// share the table.
+//
+// Use the Discover method at runtime to get the table name and ARN.
+type DynamoDBResource struct {
+	// Name is the alphanumeric name of the dependency. It determines the
+	// table's CloudFormation logical resource name. (Required)
+	Name string
+	// TableArn is the literal ARN of an existing table. Mutually exclusive
+	// with PartitionKey.
+	TableArn string
+	// TableName is the optional physical name of the table that Sparta
+	// creates. By default, CloudFormation generates a unique name.
+	TableName string
+	// PartitionKey is the partition key of the table that Sparta creates
+	PartitionKey *DynamoDBKey
+	// SortKey is the optional sort key of the table that Sparta creates
+	SortKey *DynamoDBKey
+	// StreamViewType optionally enables the table stream
+	// (eg, NEW_AND_OLD_IMAGES)
+	StreamViewType string
+	// TimeToLiveAttribute optionally enables the time to live for the
+	// named attribute
+	TimeToLiveAttribute string
+	// ReadOnly restricts the execution role to read-only access
+	ReadOnly bool
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the table, which is also its discovery ResourceID
+func (table *DynamoDBResource) LogicalResourceName() string {
+	return CloudFormationResourceName("DynamoDBTable", table.Name)
+}
+
+// Discover returns the typed discovery information for the table. It's
+// only available to the functions that declare the dependency.
+func (table *DynamoDBResource) Discover() (*DiscoveredDynamoTable, error) {
+	discoveryInfo, discoveryInfoErr := Discover()
+	if discoveryInfoErr != nil {
+		return nil, discoveryInfoErr
+	}
+	return discoveryInfo.DynamoTable(table.LogicalResourceName())
+}
+
+func (table *DynamoDBResource) validate() error {
+	if !reDynamoDBResourceName.MatchString(table.Name) {
+		return errors.Errorf("DynamoDBResource Name must match %s. Found: %s",
+			reDynamoDBResourceName.String(),
+			table.Name)
+	}
+	if (table.TableArn == "") == (table.PartitionKey == nil) {
+		return errors.Errorf("DynamoDBResource %s must define exactly one of TableArn or PartitionKey",
+			table.Name)
+	}
+	if table.TableArn != "" {
+		if !reDynamoDBTableArn.MatchString(table.TableArn) {
+			return errors.Errorf("DynamoDBResource %s TableArn must be a literal table ARN. Found: %s",
+				table.Name,
+				table.TableArn)
+		}
+		if table.TableName != "" ||
+			table.SortKey != nil ||
+			table.StreamViewType != "" ||
+			table.TimeToLiveAttribute != "" {
+			return errors.Errorf("DynamoDBResource %s TableName, SortKey, StreamViewType and TimeToLiveAttribute are only supported with PartitionKey",
+				table.Name)
+		}
+		return nil
+	}
+	if keyErr := table.PartitionKey.validate("PartitionKey"); keyErr != nil {
+		return keyErr
+	}
+	if table.SortKey != nil {
+		if keyErr := table.SortKey.validate("SortKey"); keyErr != nil {
+			return keyErr
+		}
+	}
+	switch table.StreamViewType {
+	case "", "KEYS_ONLY", "NEW_IMAGE", "OLD_IMAGE", "NEW_AND_OLD_IMAGES":
+		return nil
+	}
+	return errors.Errorf("DynamoDBResource %s StreamViewType must be one of KEYS_ONLY, NEW_IMAGE, OLD_IMAGE or NEW_AND_OLD_IMAGES. Found: %s",
+		table.Name,
+		table.StreamViewType)
+}
+
+// tableArn returns the ARN of the table
+func (table *DynamoDBResource) tableArn() *gocf.StringExpr {
+	if table.TableArn != "" {
+		return gocf.String(table.TableArn)
+	}
+	return gocf.GetAtt(table.LogicalResourceName(), "Arn")
+}
+
+// iamStatements returns the privileges the execution role requires to
+// access the table and its indexes
+func (table *DynamoDBResource) iamStatements() []spartaIAM.PolicyStatement {
+	actions := append([]string{}, dynamoDBReadActions...)
+	if !table.ReadOnly {
+		actions = append(actions, dynamoDBWriteActions...)
+	}
+	return []spartaIAM.PolicyStatement{
+		{
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: table.tableArn(),
+		},
+		{
+			Effect:   "Allow",
+			Action:   []string{"dynamodb:Query", "dynamodb:Scan"},
+			Resource: gocf.Join("", table.tableArn(), gocf.String("/index/*")),
+		},
+	}
+}
+
+// tableResource returns the AWS::DynamoDB::Table resource that Sparta
+// creates
+func (table *DynamoDBResource) tableResource() *gocf.DynamoDBTable {
+	keys := []*DynamoDBKey{table.PartitionKey}
+	if table.SortKey != nil {
+		keys = append(keys, table.SortKey)
+	}
+	attributeDefinitions := gocf.DynamoDBTableAttributeDefinitionList{}
+	keySchema := gocf.DynamoDBTableKeySchemaList{}
+	for eachIndex, eachKey := range keys {
+		keyType := "HASH"
+		if eachIndex != 0 {
+			keyType = "RANGE"
+		}
+		attributeDefinitions = append(attributeDefinitions, gocf.DynamoDBTableAttributeDefinition{
+			AttributeName: gocf.String(eachKey.AttributeName),
+			AttributeType: gocf.String(eachKey.AttributeType),
+		})
+		keySchema = append(keySchema, gocf.DynamoDBTableKeySchema{
+			AttributeName: gocf.String(eachKey.AttributeName),
+			KeyType:       gocf.String(keyType),
+		})
+	}
+	tableResource := &gocf.DynamoDBTable{
+		AttributeDefinitions: &attributeDefinitions,
+		KeySchema:            &keySchema,
+		BillingMode:          gocf.String("PAY_PER_REQUEST"),
+	}
+	if table.TableName != "" {
+		tableResource.TableName = gocf.String(table.TableName)
+	}
+	if table.StreamViewType != "" {
+		tableResource.StreamSpecification = &gocf.DynamoDBTableStreamSpecification{
+			StreamViewType: gocf.String(table.StreamViewType),
+		}
+	}
+	if table.TimeToLiveAttribute != "" {
+		tableResource.TimeToLiveSpecification = &gocf.DynamoDBTableTimeToLiveSpecification{
+			AttributeName: gocf.String(table.TimeToLiveAttribute),
+			Enabled:       gocf.Bool(true),
+		}
+	}
+	return tableResource
+}
+
+// export adds the table resource to the template if Sparta creates it and
+// returns the logical resource name that the function depends on. Existing
+// tables return an empty string.
+func (table *DynamoDBResource) export(template *gocf.Template) (string, error) {
+	if table.TableArn != "" {
+		return "", nil
+	}
+	resourceName := table.LogicalResourceName()
+	tableResource := table.tableResource()
+	existingResource, existingResourceExists := template.Resources[resourceName]
+	if existingResourceExists {
+		if !reflect.DeepEqual(existingResource.Properties, tableResource) {
+			return "", errors.Errorf("DynamoDBResource %s is declared with conflicting table definitions",
+				table.Name)
+		}
+		return resourceName, nil
+	}
+	template.AddResource(resourceName, tableResource)
+	return resourceName, nil
+}
+
+// discoveryInfo returns the discovery information of the table dependency
+func (table *DynamoDBResource) discoveryInfo(template *gocf.Template,
+	logger *logrus.Logger) ([]byte, error) {
+	if table.TableArn == "" {
+		return discoveryResourceInfoForDependency(template,
+			table.LogicalResourceName(),
+			logger)
+	}
+	// Existing tables aren't template resources, so the discovery
+	// information uses the literal values
+	return json.Marshal(DiscoveryResource{
+		ResourceID:   table.LogicalResourceName(),
+		ResourceRef:  reDynamoDBTableArn.FindStringSubmatch(table.TableArn)[1],
+		ResourceType: gocf.DynamoDBTable{}.CfnResourceType(),
+		Properties: map[string]string{
+			"Arn": table.TableArn,
+		},
+	})
+}
+
+// validateDynamoDBResources ensures the table dependencies are valid
+func validateDynamoDBResources(options *LambdaFunctionOptions) error {
+	names := make(map[string]bool)
+	for _, eachTable := range options.DynamoDBResources {
+		if eachTable == nil {
+			return errors.Errorf("DynamoDBResources must not contain nil entries")
+		}
+		if validateErr := eachTable.validate(); validateErr != nil {
+			return validateErr
+		}
+		if names[eachTable.Name] {
+			return errors.Errorf("DynamoDBResource %s is declared more than once", eachTable.Name)
+		}
+		names[eachTable.Name] = true
+	}
+	return nil
+}
+
+//
+// END - DynamoDBResource
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,197 @@
+package sparta
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - FileSystemConfig
+//
+
+// Lambda functions currently support a single file system
+// Ref: https://docs.aws.amazon.com/lambda/latest/dg/configuration-filesystem.html
+const maxLambdaFileSystemConfigs = 1
+
+// Default permissions for access point root directories that Sparta creates
+const defaultFileSystemRootDirectoryPermissions = "755"
+
+var reLocalMountPath = regexp.MustCompile(`^/mnt/[a-zA-Z0-9-_.]+$`)
+
+// FileSystemPosixUser is the POSIX identity that the lambda function uses
+// for all file system requests made through the access point
+type FileSystemPosixUser struct {
+	// UID is the POSIX user ID
+	UID int64
+	// GID is the POSIX group ID
+	GID int64
+	// SecondaryGIDs are the optional secondary POSIX group IDs
+	SecondaryGIDs []int64
+}
+
+// FileSystemConfig mounts an Amazon EFS file system in the lambda
+// function's execution environment. The function must also define
+// a VPC configuration whose subnets have mount targets for the file
+// system. See
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-filesystem.html
+// for more information.
+type FileSystemConfig struct {
+	// LocalMountPath is where the file system is mounted. It must
+	// start with /mnt/ (eg, /mnt/models)
+	LocalMountPath string
+	// AccessPointArn is the ARN of an existing EFS access point
+	AccessPointArn gocf.Stringable
+	// FileSystemID is the EFS file system for which Sparta creates a
+	// new access point. Mutually exclusive with AccessPointArn.
+	FileSystemID gocf.Stringable
+	// RootDirectory is the optional path in the file system that the
+	// access point exposes as the root directory (eg, /lambda). It's
+	// created with the PosixUser ownership if it doesn't exist.
+	RootDirectory string
+	// PosixUser is the optional POSIX identity for the access point
+	// that Sparta creates
+	PosixUser *FileSystemPosixUser
+	// ReadOnly restricts the execution role to read-only access
+	ReadOnly bool
+}
+
+func (fsConfig *FileSystemConfig) validate() error {
+	if !reLocalMountPath.MatchString(fsConfig.LocalMountPath) {
+		return errors.Errorf("FileSystemConfig LocalMountPath must match %s. Found: %s",
+			reLocalMountPath.String(),
+			fsConfig.LocalMountPath)
+	}
+	if (fsConfig.AccessPointArn == nil) == (fsConfig.FileSystemID == nil) {
+		return errors.Errorf("FileSystemConfig must define exactly one of AccessPointArn or FileSystemID")
+	}
+	if fsConfig.AccessPointArn != nil &&
+		(fsConfig.RootDirectory != "" || fsConfig.PosixUser != nil) {
+		return errors.Errorf("FileSystemConfig RootDirectory and PosixUser are only supported with FileSystemID")
+	}
+	if fsConfig.RootDirectory != "" && fsConfig.RootDirectory[0] != '/' {
+		return errors.Errorf("FileSystemConfig RootDirectory must be an absolute path. Found: %s",
+			fsConfig.RootDirectory)
+	}
+	return nil
+}
+
+// iamStatement returns the privileges the execution role requires to
+// mount the file system
+func (fsConfig *FileSystemConfig) iamStatement() spartaIAM.PolicyStatement {
+	actions := []string{"elasticfilesystem:ClientMount"}
+	if !fsConfig.ReadOnly {
+		actions = append(actions, "elasticfilesystem:ClientWrite")
+	}
+	// Access points are authorized via a condition since the
+	// file system ARN isn't known
+	if fsConfig.AccessPointArn != nil {
+		return spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: wildcardArn,
+			Condition: ArbitraryJSONObject{
+				"StringEquals": ArbitraryJSONObject{
+					"elasticfilesystem:AccessPointArn": fsConfig.AccessPointArn.String(),
+				},
+			},
+		}
+	}
+	return spartaIAM.PolicyStatement{
+		Effect: "Allow",
+		Action: actions,
+		Resource: gocf.Join("",
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":elasticfilesystem:"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(":"),
+			gocf.Ref("AWS::AccountId"),
+			gocf.String(":file-system/"),
+			fsConfig.FileSystemID.String()),
+	}
+}
+
+// export returns the FileSystemConfig property, creating the
+// access point resource if needed
+func (fsConfig *FileSystemConfig) export(lambdaLogicalResourceName string,
+	index int,
+	template *gocf.Template) lambdaFunctionFileSystemConfig {
+
+	if fsConfig.AccessPointArn != nil {
+		return lambdaFunctionFileSystemConfig{
+			Arn:            fsConfig.AccessPointArn.String(),
+			LocalMountPath: gocf.String(fsConfig.LocalMountPath),
+		}
+	}
+	accessPoint := efsAccessPoint{
+		FileSystemID: fsConfig.FileSystemID.String(),
+	}
+	if fsConfig.PosixUser != nil {
+		accessPoint.PosixUser = &efsAccessPointPosixUser{
+			Gid: gocf.String(strconv.FormatInt(fsConfig.PosixUser.GID, 10)),
+			UID: gocf.String(strconv.FormatInt(fsConfig.PosixUser.UID, 10)),
+		}
+		if len(fsConfig.PosixUser.SecondaryGIDs) != 0 {
+			secondaryGIDs := make([]gocf.Stringable, 0)
+			for _, eachGID := range fsConfig.PosixUser.SecondaryGIDs {
+				secondaryGIDs = append(secondaryGIDs, gocf.String(strconv.FormatInt(eachGID, 10)))
+			}
+			accessPoint.PosixUser.SecondaryGids = gocf.StringList(secondaryGIDs...)
+		}
+	}
+	if fsConfig.RootDirectory != "" {
+		accessPoint.RootDirectory = &efsAccessPointRootDirectory{
+			Path: gocf.String(fsConfig.RootDirectory),
+		}
+		// EFS only creates the directory if the ownership is known
+		if fsConfig.PosixUser != nil {
+			accessPoint.RootDirectory.CreationInfo = &efsAccessPointCreationInfo{
+				OwnerGid:    accessPoint.PosixUser.Gid,
+				OwnerUID:    accessPoint.PosixUser.UID,
+				Permissions: gocf.String(defaultFileSystemRootDirectoryPermissions),
+			}
+		}
+	}
+	accessPointResourceName := CloudFormationResourceName("AccessPoint",
+		lambdaLogicalResourceName,
+		fmt.Sprintf("%d", index))
+	template.AddResource(accessPointResourceName, accessPoint)
+	return lambdaFunctionFileSystemConfig{
+		Arn:            gocf.GetAtt(accessPointResourceName, "Arn"),
+		LocalMountPath: gocf.String(fsConfig.LocalMountPath),
+	}
+}
+
+// validateFileSystemConfigs ensures the file system configurations
+// are valid and that the function is attached to a VPC
+func validateFileSystemConfigs(options *LambdaFunctionOptions) error {
+	if len(options.FileSystemConfigs) == 0 {
+		return nil
+	}
+	if len(options.FileSystemConfigs) > maxLambdaFileSystemConfigs {
+		return errors.Errorf("Lambda functions support at most %d FileSystemConfigs. Found: %d",
+			maxLambdaFileSystemConfigs,
+			len(options.FileSystemConfigs))
+	}
+	if options.VpcConfig == nil && options.VPCDiscovery == nil {
+		return errors.Errorf("FileSystemConfigs require either VpcConfig or VPCDiscovery")
+	}
+	for _, eachConfig := range options.FileSystemConfigs {
+		if eachConfig == nil {
+			return errors.Errorf("FileSystemConfigs must not contain nil entries")
+		}
+		if validateErr := eachConfig.validate(); validateErr != nil {
+			return validateErr
+		}
+	}
+	return nil
+}
+
+//
+// END - FileSystemConfig
+////////////////////////////////////////////////////////////////////////////////
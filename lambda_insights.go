@@ -0,0 +1,114 @@
+package sparta
+
+import (
+	"reflect"
+
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - LambdaInsights
+//
+
+// lambdaInsightsMappingName is the template Mappings key for the
+// region's extension layer
+const lambdaInsightsMappingName = "LambdaInsightsLayers"
+
+// maxLambdaLayers is the maximum number of layers per function
+const maxLambdaLayers = 5
+
+// LambdaInsights enables CloudWatch Lambda Insights enhanced monitoring,
+// which publishes the function's memory, CPU, network and cold start
+// metrics. The Lambda Insights extension layer is added to the function and
+// the CloudWatchLambdaInsightsExecutionRolePolicy managed policy is
+// attached to the Sparta-managed IAM role. See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/Lambda-Insights.html
+// for more information.
+type LambdaInsights struct {
+	// LayerArn is the optional Lambda Insights extension layer version ARN.
+	// Defaults to the region's layer in the
+	// aws/cloudformation.LambdaInsightsMapping.
+	LayerArn gocf.Stringable
+}
+
+// layerArn returns the extension layer ARN, adding the region mapping to
+// the template if necessary
+func (insights *LambdaInsights) layerArn(template *gocf.Template) *gocf.StringExpr {
+	if insights.LayerArn != nil {
+		return insights.LayerArn.String()
+	}
+	if template.Mappings == nil {
+		template.Mappings = make(map[string]*gocf.Mapping)
+	}
+	template.Mappings[lambdaInsightsMappingName] = spartaCF.LambdaInsightsMapping
+	return gocf.FindInMap(lambdaInsightsMappingName,
+		gocf.Ref("AWS::Region"),
+		gocf.String(spartaCF.LayerArn))
+}
+
+// lambdaInsightsPolicyArn returns the ARN of the managed policy that
+// allows the extension to publish the metrics
+func lambdaInsightsPolicyArn() *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":iam::aws:policy/CloudWatchLambdaInsightsExecutionRolePolicy"))
+}
+
+// lambdaLayers returns the function layers, including the Lambda Insights
+// and AppConfig extension layers if they're enabled
+func lambdaLayers(info *LambdaAWSInfo, template *gocf.Template) ([]gocf.Stringable, error) {
+	layers := info.Layers
+	if info.Options != nil && info.Options.LambdaInsights != nil {
+		layers = append(append([]gocf.Stringable{}, info.Layers...),
+			info.Options.LambdaInsights.layerArn(template))
+	}
+	if info.Options != nil && info.Options.AppConfig != nil {
+		layers = append(append([]gocf.Stringable{}, layers...),
+			info.Options.AppConfig.LayerArn)
+	}
+	if len(layers) > maxLambdaLayers {
+		return nil, errors.Errorf("Lambda functions support at most %d layers. Found: %d",
+			maxLambdaLayers,
+			len(layers))
+	}
+	return layers, nil
+}
+
+// addLambdaInsightsPolicy attaches the Lambda Insights policy to an
+// existing Sparta-managed role that's shared by several functions
+func addLambdaInsightsPolicy(roleResource *gocf.Resource) {
+	iamRole, iamRoleOk := templateIAMRole(roleResource)
+	if !iamRoleOk {
+		return
+	}
+	insightsPolicyArn := lambdaInsightsPolicyArn()
+	if iamRole.ManagedPolicyArns == nil {
+		iamRole.ManagedPolicyArns = gocf.StringList()
+	}
+	for _, eachPolicyArn := range iamRole.ManagedPolicyArns.Literal {
+		if reflect.DeepEqual(eachPolicyArn, insightsPolicyArn) {
+			return
+		}
+	}
+	iamRole.ManagedPolicyArns.Literal = append(iamRole.ManagedPolicyArns.Literal,
+		insightsPolicyArn)
+	setTemplateIAMRole(roleResource, iamRole)
+}
+
+// applyDefaultLambdaInsights enables the service default LambdaInsights
+// for the function if it doesn't define one
+func applyDefaultLambdaInsights(info *LambdaAWSInfo, defaultInsights *LambdaInsights) {
+	if defaultInsights == nil || info.Options == nil {
+		return
+	}
+	if info.Options.LambdaInsights == nil {
+		info.Options.LambdaInsights = defaultInsights
+	}
+}
+
+//
+// END - LambdaInsights
+////////////////////////////////////////////////////////////////////////////////
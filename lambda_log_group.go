@@ -0,0 +1,143 @@
+package sparta
+
+import (
+	"regexp"
+	"sort"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - LogGroup
+//
+
+// logGroupRetentionDays are the RetentionInDays values supported by
+// CloudWatch Logs. See
+// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutRetentionPolicy.html
+// for more information.
+var logGroupRetentionDays = map[int64]bool{
+	1: true, 3: true, 5: true, 7: true, 14: true, 30: true, 60: true, 90: true,
+	120: true, 150: true, 180: true, 365: true, 400: true, 545: true, 731: true,
+	1096: true, 1827: true, 2192: true, 2557: true, 2922: true, 3288: true,
+	3653: true,
+}
+
+var reLogGroupName = regexp.MustCompile(`^[a-zA-Z0-9_\-/.#]{1,512}$`)
+
+// LogGroup provisions the CloudWatch Logs log group for a lambda function,
+// rather than letting AWS Lambda implicitly create a log group that never
+// expires. The log group is created before the function.
+//
+// If the log group already exists (eg, the function was previously
+// invoked), delete it or import it into the stack before provisioning.
+// Updates to existing stacks fail before the stack update begins if a
+// log group that the update adds already exists.
+type LogGroup struct {
+	// Name is the optional log group name. Defaults to
+	// /aws/lambda/<FunctionName>, which is the log group that AWS Lambda
+	// writes to. A custom name is configured as the function's
+	// LoggingConfig log group.
+	Name string
+	// RetentionInDays is the number of days to retain log events. Must be a
+	// value supported by CloudWatch Logs (eg, 1, 7, 14, 30, 90, 365).
+	// Zero retains log events indefinitely.
+	RetentionInDays int64
+	// KmsKeyArn is the optional KMS key used to encrypt the log data. The
+	// key policy must allow the CloudWatch Logs service principal to use
+	// the key.
+	KmsKeyArn gocf.Stringable
+	// DataProtectionPolicy is the optional data protection policy document
+	// that audits and masks sensitive log data. See
+	// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/mask-sensitive-log-data.html
+	// for more information.
+	DataProtectionPolicy ArbitraryJSONObject
+	// RetainOnDelete keeps the log group when the function is deleted
+	RetainOnDelete bool
+}
+
+func (logGroup *LogGroup) validate() error {
+	if logGroup.RetentionInDays != 0 && !logGroupRetentionDays[logGroup.RetentionInDays] {
+		supported := make([]int, 0, len(logGroupRetentionDays))
+		for eachDays := range logGroupRetentionDays {
+			supported = append(supported, int(eachDays))
+		}
+		sort.Ints(supported)
+		return errors.Errorf("LogGroup RetentionInDays must be one of %v. Found: %d",
+			supported,
+			logGroup.RetentionInDays)
+	}
+	if logGroup.Name != "" && !reLogGroupName.MatchString(logGroup.Name) {
+		return errors.Errorf("LogGroup Name must match %s. Found: %s",
+			reLogGroupName.String(),
+			logGroup.Name)
+	}
+	return nil
+}
+
+// logGroupName returns the name of the log group that the function writes
+// to
+func (logGroup *LogGroup) logGroupName(functionName gocf.Stringable) *gocf.StringExpr {
+	if logGroup.Name != "" {
+		return gocf.String(logGroup.Name)
+	}
+	return gocf.Join("", gocf.String("/aws/lambda/"), functionName)
+}
+
+// exportLogGroup adds the log group for the function to the template and
+// returns the logical resource name
+func exportLogGroup(lambdaLogicalResourceName string,
+	functionName gocf.Stringable,
+	logGroup *LogGroup,
+	template *gocf.Template) (string, error) {
+
+	validateErr := logGroup.validate()
+	if validateErr != nil {
+		return "", validateErr
+	}
+	logGroupResource := &logsLogGroup{
+		LogGroupName: logGroup.logGroupName(functionName),
+	}
+	if logGroup.RetentionInDays != 0 {
+		logGroupResource.RetentionInDays = gocf.Integer(logGroup.RetentionInDays)
+	}
+	if logGroup.KmsKeyArn != nil {
+		logGroupResource.KmsKeyID = logGroup.KmsKeyArn.String()
+	}
+	if len(logGroup.DataProtectionPolicy) != 0 {
+		logGroupResource.DataProtectionPolicy = logGroup.DataProtectionPolicy
+	}
+	logGroupResourceName := CloudFormationResourceName("LogGroup",
+		lambdaLogicalResourceName)
+	cfResource := template.AddResource(logGroupResourceName, logGroupResource)
+	if logGroup.RetainOnDelete {
+		cfResource.DeletionPolicy = "Retain"
+	}
+	return logGroupResourceName, nil
+}
+
+// applyDefaultLogGroup uses the service default log group for the
+// function and its custom resources if they don't define one
+func applyDefaultLogGroup(info *LambdaAWSInfo, defaultLogGroup *LogGroup) error {
+	if defaultLogGroup == nil {
+		return nil
+	}
+	// Each function requires a distinct log group
+	if defaultLogGroup.Name != "" {
+		return errors.Errorf("WorkflowHooks.LogGroup must not define a Name. Found: %s",
+			defaultLogGroup.Name)
+	}
+	if info.Options.LogGroup == nil {
+		info.Options.LogGroup = defaultLogGroup
+	}
+	for _, eachCustomResource := range info.customResources {
+		if eachCustomResource.options.LogGroup == nil {
+			eachCustomResource.options.LogGroup = defaultLogGroup
+		}
+	}
+	return nil
+}
+
+//
+// END - LogGroup
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,171 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// stackPhysicalResourceIDs adds the logical to physical resource ID mapping
+// of the stack and its nested stacks to the physicalIDs map
+func stackPhysicalResourceIDs(cfSvc cloudformationiface.CloudFormationAPI,
+	stackName string,
+	physicalIDs map[string]string) error {
+
+	nestedStacks := []string{}
+	input := &cloudformation.ListStackResourcesInput{
+		StackName: aws.String(stackName),
+	}
+	listErr := cfSvc.ListStackResourcesPages(input,
+		func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+			for _, eachSummary := range page.StackResourceSummaries {
+				if eachSummary.PhysicalResourceId == nil {
+					continue
+				}
+				physicalIDs[*eachSummary.LogicalResourceId] = *eachSummary.PhysicalResourceId
+				if *eachSummary.ResourceType == "AWS::CloudFormation::Stack" {
+					nestedStacks = append(nestedStacks, *eachSummary.PhysicalResourceId)
+				}
+			}
+			return true
+		})
+	if listErr != nil {
+		return listErr
+	}
+	for _, eachNestedStack := range nestedStacks {
+		nestedErr := stackPhysicalResourceIDs(cfSvc, eachNestedStack, physicalIDs)
+		if nestedErr != nil {
+			return nestedErr
+		}
+	}
+	return nil
+}
+
+// resolveStackString returns the value of a literal, Ref or Fn::Join
+// expression using the physical IDs of the existing stack resources and
+// pseudo parameters. The
+// boolean result is false if the value can't be resolved before the stack
+// is updated.
+func resolveStackString(expr *gocf.StringExpr, physicalIDs map[string]string) (string, bool) {
+	if expr == nil {
+		return "", false
+	}
+	if expr.Func == nil {
+		return expr.Literal, true
+	}
+	refName := ""
+	var joinFunc *gocf.JoinFunc
+	switch typedFunc := expr.Func.(type) {
+	case gocf.RefFunc:
+		refName = typedFunc.Name
+	case *gocf.RefFunc:
+		refName = typedFunc.Name
+	case gocf.JoinFunc:
+		joinFunc = &typedFunc
+	case *gocf.JoinFunc:
+		joinFunc = typedFunc
+	default:
+		return "", false
+	}
+	if joinFunc == nil {
+		physicalID, physicalIDExists := physicalIDs[refName]
+		return physicalID, physicalIDExists
+	}
+	if joinFunc.Items.Func != nil {
+		return "", false
+	}
+	items := make([]string, 0, len(joinFunc.Items.Literal))
+	for _, eachItem := range joinFunc.Items.Literal {
+		itemValue, itemValueOk := resolveStackString(eachItem, physicalIDs)
+		if !itemValueOk {
+			return "", false
+		}
+		items = append(items, itemValue)
+	}
+	return strings.Join(items, joinFunc.Separator), true
+}
+
+// verifyExistingLogGroups returns an error if the template adds a log group
+// to an existing stack and the log group already exists. This happens when
+// a LogGroup is added to a function that was previously deployed, since
+// AWS Lambda implicitly created /aws/lambda/<FunctionName> the first time
+// the function was invoked. CloudFormation would otherwise fail the stack
+// update with an AlreadyExists error.
+func verifyExistingLogGroups(serviceName string,
+	template *gocf.Template,
+	awsClients *AWSClients,
+	logger *logrus.Logger) error {
+
+	// Log groups that aren't in the template can't conflict
+	logGroupNames := make(map[string]*gocf.StringExpr)
+	for eachResourceName, eachResource := range template.Resources {
+		switch typedResource := eachResource.Properties.(type) {
+		case *logsLogGroup:
+			logGroupNames[eachResourceName] = typedResource.LogGroupName
+		case *gocf.LogsLogGroup:
+			logGroupNames[eachResourceName] = typedResource.LogGroupName
+		}
+	}
+	if len(logGroupNames) == 0 {
+		return nil
+	}
+	physicalIDs := make(map[string]string)
+	physicalIDsErr := stackPhysicalResourceIDs(awsClients.CloudFormation,
+		serviceName,
+		physicalIDs)
+	if physicalIDsErr != nil {
+		// New stacks don't have existing functions
+		if strings.Contains(physicalIDsErr.Error(), "does not exist") {
+			return nil
+		}
+		return errors.Wrapf(physicalIDsErr, "Failed to list resources for stack: %s", serviceName)
+	}
+	// Function names include the stack name
+	physicalIDs["AWS::StackName"] = serviceName
+
+	existingLogGroups := make([]string, 0)
+	for eachResourceName, eachLogGroupName := range logGroupNames {
+		// The stack already manages the log group
+		if _, managed := physicalIDs[eachResourceName]; managed {
+			continue
+		}
+		logGroupName, logGroupNameOk := resolveStackString(eachLogGroupName, physicalIDs)
+		if !logGroupNameOk || logGroupName == "" {
+			logger.WithField("Resource", eachResourceName).
+				Debug("Skipping existing log group check for unresolved log group name")
+			continue
+		}
+		describeOutput, describeErr := awsClients.CloudWatchLogs.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(logGroupName),
+		})
+		if describeErr != nil {
+			return errors.Wrapf(describeErr, "Failed to describe log group: %s", logGroupName)
+		}
+		for _, eachLogGroup := range describeOutput.LogGroups {
+			if aws.StringValue(eachLogGroup.LogGroupName) == logGroupName {
+				existingLogGroups = append(existingLogGroups,
+					eachResourceName+" ("+logGroupName+")")
+			}
+		}
+	}
+	if len(existingLogGroups) != 0 {
+		sort.Strings(existingLogGroups)
+		return errors.Errorf("The %s stack update adds log groups that already exist: %s. "+
+			"AWS Lambda creates the function log group when a previously deployed function is invoked. "+
+			"Import each log group into the stack with the logical resource ID, "+
+			"or delete the log group, before provisioning. "+
+			"See https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/resource-import.html",
+			serviceName,
+			strings.Join(existingLogGroups, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,559 @@
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum SQS message retention period, used for the dead-letter queues
+// that Sparta creates
+const sqsMaxMessageRetentionPeriod = 1209600
+
+// Default SQS queue visibility timeout in seconds
+const sqsDefaultVisibilityTimeout = 30
+
+var reMessagingResourceName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// Ref: https://docs.aws.amazon.com/IAM/latest/UserGuide/list_amazonsqs.html#amazonsqs-resources-for-iam-policies
+var reSQSQueueArn = regexp.MustCompile(`^arn:([^:]+):sqs:([^:]+):([0-9]{12}):([a-zA-Z0-9_.-]{1,80})$`)
+
+// Ref: https://docs.aws.amazon.com/IAM/latest/UserGuide/list_amazonsns.html#amazonsns-resources-for-iam-policies
+var reSNSTopicArn = regexp.MustCompile(`^arn:[^:]+:sns:[^:]+:[0-9]{12}:([a-zA-Z0-9_.-]{1,256})$`)
+
+// kmsViaServiceStatement returns the privileges to use a KMS key for
+// requests made through the service (eg, sqs)
+func kmsViaServiceStatement(service string) spartaIAM.PolicyStatement {
+	return spartaIAM.PolicyStatement{
+		Effect:   "Allow",
+		Action:   []string{"kms:Decrypt", "kms:GenerateDataKey"},
+		Resource: wildcardArn,
+		Condition: ArbitraryJSONObject{
+			"StringEquals": ArbitraryJSONObject{
+				"kms:ViaService": gocf.Join("",
+					gocf.String(service+"."),
+					gocf.Ref("AWS::Region"),
+					gocf.String(".amazonaws.com")),
+			},
+		},
+	}
+}
+
+// validateFifoName ensures that only the optional physical name of a FIFO
+// resource has the .fifo suffix
+func validateFifoName(resourceType string,
+	name string,
+	physicalNameField string,
+	physicalName string,
+	fifo bool) error {
+	if physicalName == "" {
+		return nil
+	}
+	if fifo != strings.HasSuffix(physicalName, ".fifo") {
+		return errors.Errorf("%s %s %s must have the .fifo suffix if and only if FIFO is true. Found: %s",
+			resourceType,
+			name,
+			physicalNameField,
+			physicalName)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - SQSResource
+//
+
+// SQSRedrivePolicy moves messages to a dead-letter queue after
+// MaxReceiveCount unsuccessful receives
+type SQSRedrivePolicy struct {
+	// MaxReceiveCount is the number of receives before a message is moved
+	// to the dead-letter queue
+	MaxReceiveCount int64
+	// DeadLetterTargetArn is the optional ARN of an existing dead-letter
+	// queue. By default, Sparta creates a dead-letter queue with the
+	// maximum message retention period.
+	DeadLetterTargetArn gocf.Stringable
+}
+
+// SQSEventSource subscribes the lambda function to the queue
+type SQSEventSource struct {
+	// BatchSize is the optional maximum number of messages in each batch
+	BatchSize int64
+}
+
+// SQSResource is an SQS queue that a lambda function depends on. Sparta
+// creates the queue, or references the existing queue with the QueueArn.
+// The Sparta-managed execution role is granted the privileges to send and
+// receive messages, and the queue is included in the function's discovery
+// information. Functions that declare an SQSResource with the same Name
+// share the queue.
+//
+// Use the Discover method at runtime to get the queue URL and ARN.
+type SQSResource struct {
+	// Name is the alphanumeric name of the dependency. It determines the
+	// queue's CloudFormation logical resource name. (Required)
+	Name string
+	// QueueArn is the literal ARN of an existing queue. Mutually exclusive
+	// with the queue properties.
+	QueueArn string
+	// QueueName is the optional physical name of the queue that Sparta
+	// creates. FIFO queue names must have the .fifo suffix.
+	QueueName string
+	// FIFO creates a first-in-first-out queue
+	FIFO bool
+	// ContentBasedDeduplication enables content-based deduplication for
+	// FIFO queues
+	ContentBasedDeduplication bool
+	// VisibilityTimeout is the optional visibility timeout in seconds. It
+	// must be at least the timeout of the functions that consume the queue.
+	VisibilityTimeout int64
+	// MessageRetentionPeriod is the optional message retention period in
+	// seconds
+	MessageRetentionPeriod int64
+	// KmsMasterKeyID optionally encrypts messages with the KMS key (eg,
+	// alias/aws/sqs). The execution role is granted the privileges to use
+	// the key through SQS. Set it for existing encrypted queues to grant
+	// the same privileges.
+	KmsMasterKeyID gocf.Stringable
+	// RedrivePolicy optionally moves messages that can't be processed to a
+	// dead-letter queue
+	RedrivePolicy *SQSRedrivePolicy
+	// EventSource optionally subscribes the function to the queue
+	EventSource *SQSEventSource
+	// SendOnly restricts the execution role to sending messages
+	SendOnly bool
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the queue, which is also its discovery ResourceID
+func (queue *SQSResource) LogicalResourceName() string {
+	return CloudFormationResourceName("SQSQueue", queue.Name)
+}
+
+// deadLetterLogicalResourceName returns the CloudFormation logical resource
+// name of the dead-letter queue that Sparta creates
+func (queue *SQSResource) deadLetterLogicalResourceName() string {
+	return CloudFormationResourceName("SQSQueue", queue.Name, "DeadLetter")
+}
+
+// Discover returns the typed discovery information for the queue. It's
+// only available to the functions that declare the dependency.
+func (queue *SQSResource) Discover() (*DiscoveredSQSQueue, error) {
+	discoveryInfo, discoveryInfoErr := Discover()
+	if discoveryInfoErr != nil {
+		return nil, discoveryInfoErr
+	}
+	return discoveryInfo.SQSQueue(queue.LogicalResourceName())
+}
+
+func (queue *SQSResource) validate() error {
+	if !reMessagingResourceName.MatchString(queue.Name) {
+		return errors.Errorf("SQSResource Name must match %s. Found: %s",
+			reMessagingResourceName.String(),
+			queue.Name)
+	}
+	if queue.EventSource != nil && queue.SendOnly {
+		return errors.Errorf("SQSResource %s EventSource requires the privileges to receive messages and can't be SendOnly",
+			queue.Name)
+	}
+	if queue.QueueArn != "" {
+		if !reSQSQueueArn.MatchString(queue.QueueArn) {
+			return errors.Errorf("SQSResource %s QueueArn must be a literal queue ARN. Found: %s",
+				queue.Name,
+				queue.QueueArn)
+		}
+		if queue.QueueName != "" ||
+			queue.FIFO ||
+			queue.ContentBasedDeduplication ||
+			queue.VisibilityTimeout != 0 ||
+			queue.MessageRetentionPeriod != 0 ||
+			queue.RedrivePolicy != nil {
+			return errors.Errorf("SQSResource %s queue properties are not supported with QueueArn",
+				queue.Name)
+		}
+		return nil
+	}
+	if nameErr := validateFifoName("SQSResource", queue.Name, "QueueName", queue.QueueName, queue.FIFO); nameErr != nil {
+		return nameErr
+	}
+	if queue.ContentBasedDeduplication && !queue.FIFO {
+		return errors.Errorf("SQSResource %s ContentBasedDeduplication is only supported for FIFO queues",
+			queue.Name)
+	}
+	if queue.RedrivePolicy != nil && queue.RedrivePolicy.MaxReceiveCount <= 0 {
+		return errors.Errorf("SQSResource %s RedrivePolicy MaxReceiveCount must be greater than 0",
+			queue.Name)
+	}
+	return nil
+}
+
+// queueArn returns the ARN of the queue
+func (queue *SQSResource) queueArn() *gocf.StringExpr {
+	if queue.QueueArn != "" {
+		return gocf.String(queue.QueueArn)
+	}
+	return gocf.GetAtt(queue.LogicalResourceName(), "Arn")
+}
+
+// iamStatements returns the privileges the execution role requires to
+// use the queue
+func (queue *SQSResource) iamStatements() []spartaIAM.PolicyStatement {
+	actions := []string{"sqs:GetQueueAttributes",
+		"sqs:GetQueueUrl",
+		"sqs:SendMessage",
+	}
+	if !queue.SendOnly {
+		actions = append(actions,
+			"sqs:ChangeMessageVisibility",
+			"sqs:DeleteMessage",
+			"sqs:ReceiveMessage")
+	}
+	statements := []spartaIAM.PolicyStatement{
+		{
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: queue.queueArn(),
+		},
+	}
+	if queue.KmsMasterKeyID != nil {
+		statements = append(statements, kmsViaServiceStatement("sqs"))
+	}
+	return statements
+}
+
+// queueResources returns the AWS::SQS::Queue resource that Sparta creates
+// and the optional dead-letter queue
+func (queue *SQSResource) queueResources() (*gocf.SQSQueue, *gocf.SQSQueue) {
+	queueResource := &gocf.SQSQueue{
+		QueueName:              marshalString(queue.QueueName),
+		VisibilityTimeout:      marshalInt(queue.VisibilityTimeout),
+		MessageRetentionPeriod: marshalInt(queue.MessageRetentionPeriod),
+		KmsMasterKeyID:         marshalStringExpr(queue.KmsMasterKeyID),
+	}
+	if queue.FIFO {
+		queueResource.FifoQueue = gocf.Bool(true)
+	}
+	if queue.ContentBasedDeduplication {
+		queueResource.ContentBasedDeduplication = gocf.Bool(true)
+	}
+	if queue.RedrivePolicy == nil {
+		return queueResource, nil
+	}
+	var deadLetterResource *gocf.SQSQueue
+	deadLetterTargetArn := marshalStringExpr(queue.RedrivePolicy.DeadLetterTargetArn)
+	if deadLetterTargetArn == nil {
+		// The dead-letter queue of a FIFO queue must also be a FIFO queue
+		deadLetterResource = &gocf.SQSQueue{
+			FifoQueue:              queueResource.FifoQueue,
+			MessageRetentionPeriod: gocf.Integer(sqsMaxMessageRetentionPeriod),
+			KmsMasterKeyID:         queueResource.KmsMasterKeyID,
+		}
+		deadLetterTargetArn = gocf.GetAtt(queue.deadLetterLogicalResourceName(), "Arn")
+	}
+	queueResource.RedrivePolicy = ArbitraryJSONObject{
+		"deadLetterTargetArn": deadLetterTargetArn,
+		"maxReceiveCount":     queue.RedrivePolicy.MaxReceiveCount,
+	}
+	return queueResource, deadLetterResource
+}
+
+// export adds the queue resources to the template if Sparta creates them
+// and returns the logical resource name that the function depends on.
+// Existing queues return an empty string.
+func (queue *SQSResource) export(template *gocf.Template) (string, error) {
+	if queue.QueueArn != "" {
+		return "", nil
+	}
+	resourceName := queue.LogicalResourceName()
+	queueResource, deadLetterResource := queue.queueResources()
+	existingResource, existingResourceExists := template.Resources[resourceName]
+	if existingResourceExists {
+		if !reflect.DeepEqual(existingResource.Properties, queueResource) {
+			return "", errors.Errorf("SQSResource %s is declared with conflicting queue definitions",
+				queue.Name)
+		}
+		return resourceName, nil
+	}
+	template.AddResource(resourceName, queueResource)
+	if deadLetterResource != nil {
+		template.AddResource(queue.deadLetterLogicalResourceName(), deadLetterResource)
+	}
+	return resourceName, nil
+}
+
+// exportEventSource adds the event source mapping that subscribes the
+// function to the queue
+func (queue *SQSResource) exportEventSource(lambdaLogicalResourceName string,
+	targetLambdaArn *gocf.StringExpr,
+	template *gocf.Template) {
+	if queue.EventSource == nil {
+		return
+	}
+	template.AddResource(CloudFormationResourceName("SQSEventSource", lambdaLogicalResourceName, queue.Name),
+		gocf.LambdaEventSourceMapping{
+			EventSourceArn: queue.queueArn(),
+			FunctionName:   targetLambdaArn,
+			BatchSize:      marshalInt(queue.EventSource.BatchSize),
+			Enabled:        gocf.Bool(true),
+		})
+}
+
+// discoveryInfo returns the discovery information of the queue dependency
+func (queue *SQSResource) discoveryInfo(template *gocf.Template,
+	logger *logrus.Logger) ([]byte, error) {
+	if queue.QueueArn == "" {
+		return discoveryResourceInfoForDependency(template,
+			queue.LogicalResourceName(),
+			logger)
+	}
+	// Existing queues aren't template resources, so the discovery
+	// information uses the literal values
+	arnParts := reSQSQueueArn.FindStringSubmatch(queue.QueueArn)
+	domain := "amazonaws.com"
+	if arnParts[1] == "aws-cn" {
+		domain = "amazonaws.com.cn"
+	}
+	return json.Marshal(DiscoveryResource{
+		ResourceID: queue.LogicalResourceName(),
+		ResourceRef: fmt.Sprintf("https://sqs.%s.%s/%s/%s",
+			arnParts[2],
+			domain,
+			arnParts[3],
+			arnParts[4]),
+		ResourceType: gocf.SQSQueue{}.CfnResourceType(),
+		Properties: map[string]string{
+			"Arn":       queue.QueueArn,
+			"QueueName": arnParts[4],
+		},
+	})
+}
+
+// validateSQSResources ensures the queue dependencies are valid
+func validateSQSResources(options *LambdaFunctionOptions) error {
+	names := make(map[string]bool)
+	for _, eachQueue := range options.SQSResources {
+		if eachQueue == nil {
+			return errors.Errorf("SQSResources must not contain nil entries")
+		}
+		if validateErr := eachQueue.validate(); validateErr != nil {
+			return validateErr
+		}
+		if names[eachQueue.Name] {
+			return errors.Errorf("SQSResource %s is declared more than once", eachQueue.Name)
+		}
+		names[eachQueue.Name] = true
+		// Ref: https://docs.aws.amazon.com/lambda/latest/dg/with-sqs.html#events-sqs-queueconfig
+		visibilityTimeout := eachQueue.VisibilityTimeout
+		if visibilityTimeout == 0 {
+			visibilityTimeout = sqsDefaultVisibilityTimeout
+		}
+		if eachQueue.EventSource != nil &&
+			eachQueue.QueueArn == "" &&
+			visibilityTimeout < options.Timeout {
+			return errors.Errorf("SQSResource %s VisibilityTimeout (%d) must be at least the function timeout (%d)",
+				eachQueue.Name,
+				visibilityTimeout,
+				options.Timeout)
+		}
+	}
+	return nil
+}
+
+//
+// END - SQSResource
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - SNSResource
+//
+
+// SNSResource is an SNS topic that a lambda function publishes to. Sparta
+// creates the topic, or references the existing topic with the TopicArn.
+// The Sparta-managed execution role is granted the privileges to publish
+// messages, and the topic is included in the function's discovery
+// information. Functions that declare an SNSResource with the same Name
+// share the topic.
+//
+// Use the Discover method at runtime to get the topic ARN.
+type SNSResource struct {
+	// Name is the alphanumeric name of the dependency. It determines the
+	// topic's CloudFormation logical resource name. (Required)
+	Name string
+	// TopicArn is the literal ARN of an existing topic. Mutually exclusive
+	// with the topic properties.
+	TopicArn string
+	// TopicName is the optional physical name of the topic that Sparta
+	// creates. FIFO topic names must have the .fifo suffix.
+	TopicName string
+	// DisplayName is the optional display name of the topic
+	DisplayName string
+	// FIFO creates a first-in-first-out topic
+	FIFO bool
+	// ContentBasedDeduplication enables content-based deduplication for
+	// FIFO topics
+	ContentBasedDeduplication bool
+	// KmsMasterKeyID optionally encrypts messages with the KMS key (eg,
+	// alias/aws/sns). The execution role is granted the privileges to use
+	// the key through SNS. Set it for existing encrypted topics to grant
+	// the same privileges.
+	KmsMasterKeyID gocf.Stringable
+}
+
+// LogicalResourceName returns the CloudFormation logical resource name of
+// the topic, which is also its discovery ResourceID
+func (topic *SNSResource) LogicalResourceName() string {
+	return CloudFormationResourceName("SNSTopic", topic.Name)
+}
+
+// Discover returns the typed discovery information for the topic. It's
+// only available to the functions that declare the dependency.
+func (topic *SNSResource) Discover() (*DiscoveredSNSTopic, error) {
+	discoveryInfo, discoveryInfoErr := Discover()
+	if discoveryInfoErr != nil {
+		return nil, discoveryInfoErr
+	}
+	return discoveryInfo.SNSTopic(topic.LogicalResourceName())
+}
+
+func (topic *SNSResource) validate() error {
+	if !reMessagingResourceName.MatchString(topic.Name) {
+		return errors.Errorf("SNSResource Name must match %s. Found: %s",
+			reMessagingResourceName.String(),
+			topic.Name)
+	}
+	if topic.TopicArn != "" {
+		if !reSNSTopicArn.MatchString(topic.TopicArn) {
+			return errors.Errorf("SNSResource %s TopicArn must be a literal topic ARN. Found: %s",
+				topic.Name,
+				topic.TopicArn)
+		}
+		if topic.TopicName != "" ||
+			topic.DisplayName != "" ||
+			topic.FIFO ||
+			topic.ContentBasedDeduplication {
+			return errors.Errorf("SNSResource %s topic properties are not supported with TopicArn",
+				topic.Name)
+		}
+		return nil
+	}
+	if nameErr := validateFifoName("SNSResource", topic.Name, "TopicName", topic.TopicName, topic.FIFO); nameErr != nil {
+		return nameErr
+	}
+	if topic.ContentBasedDeduplication && !topic.FIFO {
+		return errors.Errorf("SNSResource %s ContentBasedDeduplication is only supported for FIFO topics",
+			topic.Name)
+	}
+	return nil
+}
+
+// topicArn returns the ARN of the topic
+func (topic *SNSResource) topicArn() *gocf.StringExpr {
+	if topic.TopicArn != "" {
+		return gocf.String(topic.TopicArn)
+	}
+	return gocf.Ref(topic.LogicalResourceName()).String()
+}
+
+// iamStatements returns the privileges the execution role requires to
+// publish to the topic
+func (topic *SNSResource) iamStatements() []spartaIAM.PolicyStatement {
+	statements := []spartaIAM.PolicyStatement{
+		{
+			Effect:   "Allow",
+			Action:   []string{"sns:GetTopicAttributes", "sns:Publish"},
+			Resource: topic.topicArn(),
+		},
+	}
+	if topic.KmsMasterKeyID != nil {
+		statements = append(statements, kmsViaServiceStatement("sns"))
+	}
+	return statements
+}
+
+// topicResource returns the AWS::SNS::Topic resource that Sparta creates
+func (topic *SNSResource) topicResource() *snsTopicResource {
+	topicResource := &snsTopicResource{
+		SNSTopic: gocf.SNSTopic{
+			TopicName:      marshalString(topic.TopicName),
+			DisplayName:    marshalString(topic.DisplayName),
+			KmsMasterKeyID: marshalStringExpr(topic.KmsMasterKeyID),
+		},
+	}
+	if topic.FIFO {
+		topicResource.FifoTopic = gocf.Bool(true)
+	}
+	if topic.ContentBasedDeduplication {
+		topicResource.ContentBasedDeduplication = gocf.Bool(true)
+	}
+	return topicResource
+}
+
+// export adds the topic resource to the template if Sparta creates it and
+// returns the logical resource name that the function depends on.
+// Existing topics return an empty string.
+func (topic *SNSResource) export(template *gocf.Template) (string, error) {
+	if topic.TopicArn != "" {
+		return "", nil
+	}
+	resourceName := topic.LogicalResourceName()
+	topicResource := topic.topicResource()
+	existingResource, existingResourceExists := template.Resources[resourceName]
+	if existingResourceExists {
+		if !reflect.DeepEqual(existingResource.Properties, topicResource) {
+			return "", errors.Errorf("SNSResource %s is declared with conflicting topic definitions",
+				topic.Name)
+		}
+		return resourceName, nil
+	}
+	template.AddResource(resourceName, topicResource)
+	return resourceName, nil
+}
+
+// discoveryInfo returns the discovery information of the topic dependency
+func (topic *SNSResource) discoveryInfo(template *gocf.Template,
+	logger *logrus.Logger) ([]byte, error) {
+	if topic.TopicArn == "" {
+		return discoveryResourceInfoForDependency(template,
+			topic.LogicalResourceName(),
+			logger)
+	}
+	// Existing topics aren't template resources, so the discovery
+	// information uses the literal values
+	return json.Marshal(DiscoveryResource{
+		ResourceID:   topic.LogicalResourceName(),
+		ResourceRef:  topic.TopicArn,
+		ResourceType: gocf.SNSTopic{}.CfnResourceType(),
+		Properties: map[string]string{
+			"TopicName": reSNSTopicArn.FindStringSubmatch(topic.TopicArn)[1],
+		},
+	})
+}
+
+// validateSNSResources ensures the topic dependencies are valid
+func validateSNSResources(options *LambdaFunctionOptions) error {
+	names := make(map[string]bool)
+	for _, eachTopic := range options.SNSResources {
+		if eachTopic == nil {
+			return errors.Errorf("SNSResources must not contain nil entries")
+		}
+		if validateErr := eachTopic.validate(); validateErr != nil {
+			return validateErr
+		}
+		if names[eachTopic.Name] {
+			return errors.Errorf("SNSResource %s is declared more than once", eachTopic.Name)
+		}
+		names[eachTopic.Name] = true
+	}
+	return nil
+}
+
+//
+// END - SNSResource
+////////////////////////////////////////////////////////////////////////////////
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	cfCustomResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
@@ -25,12 +26,13 @@ type descriptionNode struct {
 // Permission entries that support specialization for additional resource generation.
 type LambdaPermissionExporter interface {
 	// Export the permission object to a set of CloudFormation resources
-	// in the provided resources param.  The targetLambdaFuncRef
-	// interface represents the Fn::GetAtt "Arn" JSON value
-	// of the parent Lambda target
+	// in the provided resources param.  The lambdaTargetArn
+	// represents the ARN of the parent Lambda target, which is the
+	// published alias if the function publishes one
 	export(serviceName string,
 		lambdaFunctionDisplayName string,
 		lambdaLogicalCFResourceName string,
+		lambdaTargetArn *gocf.StringExpr,
 		template *gocf.Template,
 		S3Bucket string,
 		S3Key string,
@@ -76,6 +78,7 @@ func (perm BasePermission) export(principal *gocf.StringExpr,
 	arnPrefixParts []gocf.Stringable,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -83,7 +86,7 @@ func (perm BasePermission) export(principal *gocf.StringExpr,
 
 	lambdaPermission := gocf.LambdaPermission{
 		Action:       gocf.String("lambda:InvokeFunction"),
-		FunctionName: gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
+		FunctionName: lambdaTargetArn,
 		Principal:    principal,
 	}
 	// If the Arn isn't the wildcard value, then include it.
@@ -140,20 +143,122 @@ type S3Permission struct {
 	// 		http://docs.aws.amazon.com/AmazonS3/latest/dev/NotificationHowTo.html
 	// for more information.
 	Filter s3.NotificationConfigurationFilter `json:"Filter,omitempty"`
+	// Notifications defines one or more notification configurations,
+	// each with its own events and optional key prefix/suffix filter.
+	// If non-empty, Events and Filter must be empty.
+	Notifications []S3Notification `json:"Notifications,omitempty"`
+}
+
+// S3Notification is a single bucket notification configuration that
+// forwards the Events for keys matching the optional Prefix and Suffix
+// to the lambda function. See
+// https://docs.aws.amazon.com/AmazonS3/latest/dev/NotificationHowTo.html#notification-how-to-filtering
+// for more information.
+type S3Notification struct {
+	// S3 events to register for (eg: `[]string{"s3:ObjectCreated:*"}`).
+	Events []string `json:"Events,omitempty"`
+	// Optional object key prefix (eg: `images/`)
+	Prefix string `json:"Prefix,omitempty"`
+	// Optional object key suffix (eg: `.jpg`)
+	Suffix string `json:"Suffix,omitempty"`
+}
+
+// filter returns the S3 filter representation for the notification
+func (notification S3Notification) filter() *s3.NotificationConfigurationFilter {
+	var filterRules []*s3.FilterRule
+	if notification.Prefix != "" {
+		filterRules = append(filterRules, &s3.FilterRule{
+			Name:  aws.String("prefix"),
+			Value: aws.String(notification.Prefix),
+		})
+	}
+	if notification.Suffix != "" {
+		filterRules = append(filterRules, &s3.FilterRule{
+			Name:  aws.String("suffix"),
+			Value: aws.String(notification.Suffix),
+		})
+	}
+	if len(filterRules) == 0 {
+		return nil
+	}
+	return &s3.NotificationConfigurationFilter{
+		Key: &s3.KeyFilter{
+			FilterRules: filterRules,
+		},
+	}
+}
+
+// overlaps returns true if both notifications could match the same event
+// for the same object key. S3 rejects overlapping configurations.
+// Ref: https://docs.aws.amazon.com/AmazonS3/latest/dev/notification-how-to-filtering.html#notification-how-to-filtering-examples-invalid
+func (notification S3Notification) overlaps(other S3Notification) bool {
+	// S3 event types are hierarchical (`s3:ObjectCreated:*` includes
+	// `s3:ObjectCreated:Put`)
+	eventTypeOverlaps := func(lhs string, rhs string) bool {
+		lhsPrefix := strings.TrimSuffix(lhs, "*")
+		rhsPrefix := strings.TrimSuffix(rhs, "*")
+		return strings.HasPrefix(lhsPrefix, rhsPrefix) ||
+			strings.HasPrefix(rhsPrefix, lhsPrefix)
+	}
+	eventsOverlap := false
+	for _, eachEvent := range notification.Events {
+		for _, eachOtherEvent := range other.Events {
+			eventsOverlap = eventsOverlap || eventTypeOverlaps(eachEvent, eachOtherEvent)
+		}
+	}
+	prefixOverlaps := strings.HasPrefix(notification.Prefix, other.Prefix) ||
+		strings.HasPrefix(other.Prefix, notification.Prefix)
+	suffixOverlaps := strings.HasSuffix(notification.Suffix, other.Suffix) ||
+		strings.HasSuffix(other.Suffix, notification.Suffix)
+	return eventsOverlap && prefixOverlaps && suffixOverlaps
+}
+
+// validateNotifications ensures the notifications are well formed
+// and that no two notifications overlap
+func (perm S3Permission) validateNotifications() error {
+	if len(perm.Notifications) == 0 {
+		return nil
+	}
+	if len(perm.Events) != 0 || perm.Filter.Key != nil {
+		return errors.Errorf("S3Permission for %s must not define Events or Filter together with Notifications",
+			describeInfoValue(perm.SourceArn))
+	}
+	for eachIndex, eachNotification := range perm.Notifications {
+		if len(eachNotification.Events) == 0 {
+			return errors.Errorf("S3Permission for %s Notifications[%d] must define at least one event",
+				describeInfoValue(perm.SourceArn),
+				eachIndex)
+		}
+		for otherIndex := eachIndex + 1; otherIndex < len(perm.Notifications); otherIndex++ {
+			if eachNotification.overlaps(perm.Notifications[otherIndex]) {
+				return errors.Errorf("S3Permission for %s Notifications[%d] and Notifications[%d] define overlapping prefixes, suffixes, and events",
+					describeInfoValue(perm.SourceArn),
+					eachIndex,
+					otherIndex)
+			}
+		}
+	}
+	return nil
 }
 
 func (perm S3Permission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
 	logger *logrus.Logger) (string, error) {
 
+	validationErr := perm.validateNotifications()
+	if validationErr != nil {
+		return "", validationErr
+	}
 	targetLambdaResourceName, err := perm.BasePermission.export(gocf.String("s3.amazonaws.com"),
 		s3SourceArnParts,
 		lambdaFunctionDisplayName,
 		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
 		template,
 		S3Bucket,
 		S3Key,
@@ -192,17 +297,27 @@ func (perm S3Permission) export(serviceName string,
 	}
 	s3Resource.ServiceToken = gocf.GetAtt(configuratorResName, "Arn")
 	s3Resource.BucketArn = sourceArnExpression
-	s3Resource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	s3Resource.LambdaTargetArn = lambdaTargetArn
 	s3Resource.Events = perm.Events
 	if nil != perm.Filter.Key {
 		s3Resource.Filter = &perm.Filter
 	}
+	resourceNameParts := []string{lambdaLogicalCFResourceName,
+		perm.BasePermission.SourceAccount,
+		fmt.Sprintf("%#v", s3Resource.Filter)}
+	for _, eachNotification := range perm.Notifications {
+		s3Resource.Notifications = append(s3Resource.Notifications,
+			&cfCustomResources.S3LambdaEventSourceNotification{
+				Events: eachNotification.Events,
+				Filter: eachNotification.filter(),
+			})
+		resourceNameParts = append(resourceNameParts,
+			fmt.Sprintf("%#v", eachNotification))
+	}
 
 	// Name?
 	resourceInvokerName := CloudFormationResourceName("ConfigS3",
-		lambdaLogicalCFResourceName,
-		perm.BasePermission.SourceAccount,
-		fmt.Sprintf("%#v", s3Resource.Filter))
+		resourceNameParts...)
 
 	// Add it
 	cfResource := template.AddResource(resourceInvokerName, s3Resource)
@@ -218,6 +333,18 @@ func (perm S3Permission) descriptionInfo() ([]descriptionNode, error) {
 		s3Events = fmt.Sprintf("%s\n%s", eachEvent, s3Events)
 	}
 	nodes := make([]descriptionNode, 0)
+	if len(perm.Notifications) != 0 {
+		for _, eachNotification := range perm.Notifications {
+			nodes = append(nodes, descriptionNode{
+				Name: describeInfoValue(perm.SourceArn),
+				Relation: fmt.Sprintf("%s (prefix = %s, suffix = %s)",
+					strings.Join(eachNotification.Events, "\n"),
+					eachNotification.Prefix,
+					eachNotification.Suffix),
+			})
+		}
+		return nodes, nil
+	}
 	if perm.Filter.Key == nil || len(perm.Filter.Key.FilterRules) == 0 {
 		nodes = append(nodes, descriptionNode{
 			Name:     describeInfoValue(perm.SourceArn),
@@ -257,6 +384,7 @@ type SNSPermission struct {
 func (perm SNSPermission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -267,6 +395,7 @@ func (perm SNSPermission) export(serviceName string,
 		snsSourceArnParts,
 		lambdaFunctionDisplayName,
 		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
 		template,
 		S3Bucket,
 		S3Key,
@@ -298,7 +427,7 @@ func (perm SNSPermission) export(serviceName string,
 	}
 	customResource := newResource.(*cfCustomResources.SNSLambdaEventSourceResource)
 	customResource.ServiceToken = gocf.GetAtt(configuratorResName, "Arn")
-	customResource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	customResource.LambdaTargetArn = lambdaTargetArn
 	customResource.SNSTopicArn = sourceArnExpression
 
 	// Name?
@@ -365,6 +494,12 @@ type MessageBodyStorage struct {
 	cloudFormationS3BucketResourceName string
 }
 
+// BucketName returns the name of the S3 bucket used to store
+// message bodies
+func (storage *MessageBodyStorage) BucketName() *gocf.StringExpr {
+	return storage.bucketNameExpr
+}
+
 // BucketArn returns an Arn value that can be used as an
 // lambdaFn.RoleDefinition.Privileges `Resource` value.
 func (storage *MessageBodyStorage) BucketArn() *gocf.StringExpr {
@@ -386,6 +521,7 @@ func (storage *MessageBodyStorage) BucketArnAllKeys() *gocf.StringExpr {
 func (storage *MessageBodyStorage) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -584,6 +720,7 @@ func (perm *SESPermission) NewMessageBodyStorageReference(prexistingBucketName s
 func (perm SESPermission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -595,6 +732,7 @@ func (perm SESPermission) export(serviceName string,
 		sesSourcePartArn,
 		lambdaFunctionDisplayName,
 		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
 		template,
 		S3Bucket,
 		S3Key,
@@ -609,6 +747,7 @@ func (perm SESPermission) export(serviceName string,
 		s3Policy, s3PolicyErr := perm.MessageBodyStorage.export(serviceName,
 			lambdaFunctionDisplayName,
 			lambdaLogicalCFResourceName,
+			lambdaTargetArn,
 			template,
 			S3Bucket,
 			S3Key,
@@ -670,7 +809,7 @@ func (perm SESPermission) export(serviceName string,
 		for eachIndex, eachReceiptRule := range perm.ReceiptRules {
 			sesRules[eachIndex] = eachReceiptRule.toResourceRule(
 				serviceName,
-				gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
+				lambdaTargetArn,
 				perm.MessageBodyStorage)
 		}
 	}
@@ -786,6 +925,7 @@ type CloudWatchEventsPermission struct {
 func (perm CloudWatchEventsPermission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -830,6 +970,7 @@ func (perm CloudWatchEventsPermission) export(serviceName string,
 			cloudformationEventsSourceArnParts,
 			lambdaFunctionDisplayName,
 			lambdaLogicalCFResourceName,
+			lambdaTargetArn,
 			template,
 			S3Bucket,
 			S3Key,
@@ -839,13 +980,20 @@ func (perm CloudWatchEventsPermission) export(serviceName string,
 			return "", exportErr
 		}
 
+		cwEventsRuleTarget := gocf.EventsRuleTarget{
+			Arn: lambdaTargetArn,
+			ID:  gocf.String(uniqueRuleName),
+		}
+		if nil != eachRuleDefinition.RuleTarget {
+			if eachRuleDefinition.RuleTarget.Input != "" {
+				cwEventsRuleTarget.Input = gocf.String(eachRuleDefinition.RuleTarget.Input)
+			}
+			if eachRuleDefinition.RuleTarget.InputPath != "" {
+				cwEventsRuleTarget.InputPath = gocf.String(eachRuleDefinition.RuleTarget.InputPath)
+			}
+		}
 		cwEventsRuleTargetList := gocf.EventsRuleTargetList{}
-		cwEventsRuleTargetList = append(cwEventsRuleTargetList,
-			gocf.EventsRuleTarget{
-				Arn: gocf.GetAtt(lambdaLogicalCFResourceName, "Arn"),
-				ID:  gocf.String(uniqueRuleName),
-			},
-		)
+		cwEventsRuleTargetList = append(cwEventsRuleTargetList, cwEventsRuleTarget)
 
 		// Add the rule
 		eventsRule := &gocf.EventsRule{
@@ -928,6 +1076,7 @@ type CloudWatchLogsPermission struct {
 func (perm CloudWatchLogsPermission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -958,6 +1107,7 @@ func (perm CloudWatchLogsPermission) export(serviceName string,
 		cloudformationLogsSourceArnParts,
 		lambdaFunctionDisplayName,
 		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
 		template,
 		S3Bucket,
 		S3Key,
@@ -1019,7 +1169,7 @@ func (perm CloudWatchLogsPermission) export(serviceName string,
 	}
 	customResource := newResource.(*cfCustomResources.CloudWatchLogsLambdaEventSourceResource)
 	customResource.ServiceToken = gocf.GetAtt(configurationResourceName, "Arn")
-	customResource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	customResource.LambdaTargetArn = lambdaTargetArn
 	// Build up the filters...
 	customResource.Filters = make([]*cfCustomResources.CloudWatchLogsLambdaEventSourceFilter, 0)
 	for eachName, eachFilter := range globallyUniqueFilters {
@@ -1106,6 +1256,7 @@ type CodeCommitPermission struct {
 func (perm CodeCommitPermission) export(serviceName string,
 	lambdaFunctionDisplayName string,
 	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
 	template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
@@ -1122,6 +1273,7 @@ func (perm CodeCommitPermission) export(serviceName string,
 		codeCommitSourceArnParts,
 		lambdaFunctionDisplayName,
 		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
 		template,
 		S3Bucket,
 		S3Key,
@@ -1158,7 +1310,7 @@ func (perm CodeCommitPermission) export(serviceName string,
 	}
 	customResource := newResource.(*cfCustomResources.CodeCommitLambdaEventSourceResource)
 	customResource.ServiceToken = gocf.GetAtt(configuratorResName, "Arn")
-	customResource.LambdaTargetArn = gocf.GetAtt(lambdaLogicalCFResourceName, "Arn")
+	customResource.LambdaTargetArn = lambdaTargetArn
 	customResource.TriggerName = gocf.Ref(lambdaLogicalCFResourceName).String()
 	customResource.RepositoryName = perm.RepositoryName
 	customResource.Events = repoEvents
@@ -1200,3 +1352,162 @@ func (perm CodeCommitPermission) descriptionInfo() ([]descriptionNode, error) {
 
 // END - CodeCommitPermission
 ///////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - KinesisFirehosePermission
+//
+var kinesisFirehoseSourceArnParts = []gocf.Stringable{}
+
+// KinesisFirehosePermission struct grants the Kinesis Firehose service
+// principal permission to invoke the lambda function as a data
+// transformation function. If BasePermission.SourceArn is empty, any
+// delivery stream in the account may invoke the function.
+// See https://docs.aws.amazon.com/firehose/latest/dev/data-transformation.html
+// for more information.
+type KinesisFirehosePermission struct {
+	BasePermission
+}
+
+func (perm KinesisFirehosePermission) export(serviceName string,
+	lambdaFunctionDisplayName string,
+	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	logger *logrus.Logger) (string, error) {
+
+	targetLambdaResourceName, err := perm.BasePermission.export(gocf.String(KinesisFirehosePrincipal),
+		kinesisFirehoseSourceArnParts,
+		lambdaFunctionDisplayName,
+		lambdaLogicalCFResourceName,
+		lambdaTargetArn,
+		template,
+		S3Bucket,
+		S3Key,
+		logger)
+	if nil != err {
+		return "", errors.Wrap(err, "Failed to export Kinesis Firehose permission")
+	}
+	return targetLambdaResourceName, nil
+}
+
+func (perm KinesisFirehosePermission) descriptionInfo() ([]descriptionNode, error) {
+	sourceArn := perm.SourceArn
+	if sourceArn == nil {
+		sourceArn = "firehose:*"
+	}
+	nodes := []descriptionNode{
+		{
+			Name:     describeInfoValue(sourceArn),
+			Relation: "transform",
+		},
+	}
+	return nodes, nil
+}
+
+//
+// END - KinesisFirehosePermission
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - CloudWatchLogsSubscriptionPermission
+//
+
+// CloudWatchLogsSubscriptionPermission struct implies that the corresponding
+// CloudWatchLogsSubscriptionFilter definitions should be provisioned as
+// native AWS::Logs::SubscriptionFilter resources that target the lambda
+// function. Unlike CloudWatchLogsPermission, no CustomResource is required.
+// The BasePermission.SourceArn isn't considered for this configuration.
+// See https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/SubscriptionFilters.html#LambdaFunctionExample
+// for more information.
+type CloudWatchLogsSubscriptionPermission struct {
+	BasePermission
+	// Map of filter names to the CloudWatchLogsSubscriptionFilter settings
+	Filters map[string]CloudWatchLogsSubscriptionFilter
+}
+
+func (perm CloudWatchLogsSubscriptionPermission) export(serviceName string,
+	lambdaFunctionDisplayName string,
+	lambdaLogicalCFResourceName string,
+	lambdaTargetArn *gocf.StringExpr,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	logger *logrus.Logger) (string, error) {
+
+	if len(perm.Filters) <= 0 {
+		return "", fmt.Errorf("function %s CloudWatchLogsSubscriptionPermission does not specify any filters", lambdaFunctionDisplayName)
+	}
+
+	// The principal is region specific, so build that up...
+	regionalPrincipal := gocf.Join(".",
+		gocf.String("logs"),
+		gocf.Ref("AWS::Region"),
+		gocf.Ref("AWS::URLSuffix"))
+
+	for eachFilterName, eachFilter := range perm.Filters {
+		if eachFilter.LogGroupName == "" {
+			return "", fmt.Errorf("function %s CloudWatchLogsSubscriptionPermission filter %s does not specify a LogGroupName",
+				lambdaFunctionDisplayName,
+				eachFilterName)
+		}
+		logGroupArn := gocf.Join("",
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":logs:"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(":"),
+			gocf.Ref("AWS::AccountId"),
+			gocf.String(":log-group:"),
+			gocf.String(eachFilter.LogGroupName),
+			gocf.String(":*"))
+
+		// Each log group needs its own invoke permission, which must exist
+		// before the subscription filter is created
+		lambdaPermission := gocf.LambdaPermission{
+			Action:       gocf.String("lambda:InvokeFunction"),
+			FunctionName: lambdaTargetArn,
+			Principal:    regionalPrincipal,
+			SourceArn:    logGroupArn,
+		}
+		if perm.SourceAccount != "" {
+			lambdaPermission.SourceAccount = gocf.String(perm.SourceAccount)
+		}
+		permissionResourceName := CloudFormationResourceName("LambdaPermLogs",
+			lambdaLogicalCFResourceName,
+			eachFilterName,
+			eachFilter.LogGroupName)
+		template.AddResource(permissionResourceName, lambdaPermission)
+
+		subscriptionFilter := gocf.LogsSubscriptionFilter{
+			DestinationArn: lambdaTargetArn,
+			FilterPattern:  gocf.String(eachFilter.FilterPattern),
+			LogGroupName:   gocf.String(eachFilter.LogGroupName),
+		}
+		subscriptionResourceName := CloudFormationResourceName("LogsSubscription",
+			lambdaLogicalCFResourceName,
+			eachFilterName,
+			eachFilter.LogGroupName)
+		cfResource := template.AddResource(subscriptionResourceName, subscriptionFilter)
+		cfResource.DependsOn = append(cfResource.DependsOn,
+			permissionResourceName,
+			lambdaLogicalCFResourceName)
+	}
+	return "", nil
+}
+
+func (perm CloudWatchLogsSubscriptionPermission) descriptionInfo() ([]descriptionNode, error) {
+	nodes := make([]descriptionNode, 0, len(perm.Filters))
+	for eachFilterName, eachFilterDef := range perm.Filters {
+		nodes = append(nodes, descriptionNode{
+			Name:     describeInfoValue(eachFilterDef.LogGroupName),
+			Relation: fmt.Sprintf("%s (%s)", eachFilterName, eachFilterDef.FilterPattern),
+		})
+	}
+	return nodes, nil
+}
+
+//
+// END - CloudWatchLogsSubscriptionPermission
+////////////////////////////////////////////////////////////////////////////////
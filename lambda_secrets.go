@@ -0,0 +1,254 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - SecretReference
+//
+
+// SecretSourceType is the service that stores a secret value
+type SecretSourceType string
+
+const (
+	// SecretSourceSecretsManager is an AWS Secrets Manager secret
+	SecretSourceSecretsManager SecretSourceType = "secretsmanager"
+	// SecretSourceSSM is an SSM Parameter Store (SecureString) parameter
+	SecretSourceSSM SecretSourceType = "ssm"
+)
+
+var reSecretName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SecretReference is a reference to a Secrets Manager secret or SSM
+// parameter that is resolved at runtime with ResolveSecret. Only the
+// reference is stored in the function's environment, never the
+// plaintext value. The Sparta-managed execution role is granted the
+// privileges to read (and optionally decrypt) the value.
+type SecretReference struct {
+	// Source is the service that stores the secret
+	Source SecretSourceType
+	// ID is the Secrets Manager secret name or ARN, or the SSM
+	// parameter name. SSM parameter names must be literal values.
+	ID gocf.Stringable
+	// JSONKey optionally selects a single key from a Secrets Manager
+	// secret whose value is a JSON object
+	JSONKey string
+	// KmsKeyArn is the optional customer managed KMS key that encrypts
+	// the secret. The execution role is granted kms:Decrypt for it.
+	KmsKeyArn gocf.Stringable
+}
+
+func (secretRef *SecretReference) validate(name string) error {
+	if !reSecretName.MatchString(name) {
+		return errors.Errorf("Secret name must match %s. Found: %s",
+			reSecretName.String(),
+			name)
+	}
+	if secretRef == nil || secretRef.ID == nil {
+		return errors.Errorf("Secret %s must define an ID", name)
+	}
+	switch secretRef.Source {
+	case SecretSourceSecretsManager:
+	case SecretSourceSSM:
+		if secretRef.ID.String().Func != nil {
+			return errors.Errorf("Secret %s SSM parameter name must be a literal value", name)
+		}
+		if secretRef.JSONKey != "" {
+			return errors.Errorf("Secret %s JSONKey is only supported for Secrets Manager secrets", name)
+		}
+	default:
+		return errors.Errorf("Secret %s has an unsupported source: %s",
+			name,
+			secretRef.Source)
+	}
+	return nil
+}
+
+// secretEnvReference is the JSON encoded reference that's published into
+// the environment. JSON is used so that neither the key nor the ID can
+// collide with a delimiter.
+type secretEnvReference struct {
+	Source  SecretSourceType `json:"source"`
+	JSONKey string           `json:"jsonKey,omitempty"`
+	ID      string           `json:"id"`
+}
+
+// envValue returns the reference that's published into the environment
+func (secretRef *SecretReference) envValue() *gocf.StringExpr {
+	envRef := secretEnvReference{
+		Source:  secretRef.Source,
+		JSONKey: secretRef.JSONKey,
+	}
+	idExpr := secretRef.ID.String()
+	if idExpr.Func == nil {
+		envRef.ID = idExpr.Literal
+		envJSON, _ := json.Marshal(envRef)
+		return gocf.String(string(envJSON))
+	}
+	// The ID is a CloudFormation reference, so it's joined into the document
+	// in place of the empty (trailing) id value. Secrets Manager names and
+	// ARNs don't include characters that need to be escaped.
+	envJSON, _ := json.Marshal(envRef)
+	idPrefix := strings.TrimSuffix(string(envJSON), `"}`)
+	return gocf.Join("",
+		gocf.String(idPrefix),
+		idExpr,
+		gocf.String(`"}`))
+}
+
+// iamStatements returns the privileges required to read the secret
+func (secretRef *SecretReference) iamStatements() []spartaIAM.PolicyStatement {
+	arnPrefix := func(service string) []gocf.Stringable {
+		return []gocf.Stringable{
+			gocf.String("arn:"),
+			gocf.Ref("AWS::Partition"),
+			gocf.String(":" + service + ":"),
+			gocf.Ref("AWS::Region"),
+			gocf.String(":"),
+			gocf.Ref("AWS::AccountId"),
+		}
+	}
+	idExpr := secretRef.ID.String()
+	var statement spartaIAM.PolicyStatement
+	switch secretRef.Source {
+	case SecretSourceSecretsManager:
+		// Secret names are suffixed with random characters in the ARN
+		resource := idExpr
+		if idExpr.Func == nil && !strings.HasPrefix(idExpr.Literal, "arn:") {
+			resource = gocf.Join("", append(arnPrefix("secretsmanager"),
+				gocf.String(":secret:"+idExpr.Literal+"-*"))...)
+		}
+		statement = spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: resource,
+		}
+	case SecretSourceSSM:
+		parameterName := strings.TrimPrefix(idExpr.Literal, "/")
+		statement = spartaIAM.PolicyStatement{
+			Effect: "Allow",
+			Action: []string{"ssm:GetParameter"},
+			Resource: gocf.Join("", append(arnPrefix("ssm"),
+				gocf.String(":parameter/"+parameterName))...),
+		}
+	}
+	statements := []spartaIAM.PolicyStatement{statement}
+	if secretRef.KmsKeyArn != nil {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"kms:Decrypt"},
+			Resource: secretRef.KmsKeyArn.String(),
+		})
+	}
+	return statements
+}
+
+// validateSecrets ensures the secret references and KMS options are valid
+func validateSecrets(options *LambdaFunctionOptions) error {
+	if options.KmsKeyArn != "" && options.KmsKey != nil {
+		return errors.Errorf("Lambda options must not define both KmsKeyArn and KmsKey")
+	}
+	for eachName, eachRef := range options.Secrets {
+		if validateErr := eachRef.validate(eachName); validateErr != nil {
+			return validateErr
+		}
+	}
+	return nil
+}
+
+// Cache of resolved secret values, keyed by environment reference, that
+// is shared by all invocations in the same execution environment
+var resolvedSecrets = make(map[string]string)
+var resolvedSecretsMutex sync.Mutex
+
+// ResolveSecret returns the value of the named LambdaFunctionOptions.Secrets
+// entry. Values are fetched the first time they are requested and then
+// cached for the lifetime of the execution environment. The AWS session is
+// read from the ContextKeyAWSSession value, if available.
+func ResolveSecret(ctx context.Context, name string) (string, error) {
+	envValue := os.Getenv(envVarSecretPrefix + name)
+	if envValue == "" {
+		return "", errors.Errorf("Secret %s is not defined for this function", name)
+	}
+	resolvedSecretsMutex.Lock()
+	cachedValue, cachedValueExists := resolvedSecrets[envValue]
+	resolvedSecretsMutex.Unlock()
+	if cachedValueExists {
+		return cachedValue, nil
+	}
+	envRef := secretEnvReference{}
+	unmarshalErr := json.Unmarshal([]byte(envValue), &envRef)
+	if unmarshalErr != nil || envRef.ID == "" {
+		return "", errors.Errorf("Secret %s has an invalid reference: %s", name, envValue)
+	}
+	awsSession, awsSessionOk := ctx.Value(ContextKeyAWSSession).(*session.Session)
+	if !awsSessionOk || awsSession == nil {
+		newSession, newSessionErr := session.NewSession()
+		if newSessionErr != nil {
+			return "", errors.Wrapf(newSessionErr, "Failed to create AWS session")
+		}
+		awsSession = newSession
+	}
+	secretValue := ""
+	switch envRef.Source {
+	case SecretSourceSecretsManager:
+		secretsSvc := secretsmanager.New(awsSession)
+		output, outputErr := secretsSvc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(envRef.ID),
+		})
+		if outputErr != nil {
+			return "", errors.Wrapf(outputErr, "Failed to get secret %s", name)
+		}
+		secretValue = aws.StringValue(output.SecretString)
+		if envRef.JSONKey != "" {
+			jsonValues := make(map[string]interface{})
+			unmarshalErr := json.Unmarshal([]byte(secretValue), &jsonValues)
+			if unmarshalErr != nil {
+				return "", errors.Wrapf(unmarshalErr, "Failed to unmarshal secret %s", name)
+			}
+			jsonValue, jsonValueExists := jsonValues[envRef.JSONKey].(string)
+			if !jsonValueExists {
+				return "", errors.Errorf("Secret %s does not have a string value for key %s",
+					name,
+					envRef.JSONKey)
+			}
+			secretValue = jsonValue
+		}
+	case SecretSourceSSM:
+		ssmSvc := ssm.New(awsSession)
+		output, outputErr := ssmSvc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(envRef.ID),
+			WithDecryption: aws.Bool(true),
+		})
+		if outputErr != nil {
+			return "", errors.Wrapf(outputErr, "Failed to get parameter for secret %s", name)
+		}
+		secretValue = aws.StringValue(output.Parameter.Value)
+	default:
+		return "", errors.Errorf("Secret %s has an unsupported source: %s", name, envRef.Source)
+	}
+	// Concurrent lookups for the same secret may both fetch it, but the
+	// lock is only held to access the cache
+	resolvedSecretsMutex.Lock()
+	resolvedSecrets[envValue] = secretValue
+	resolvedSecretsMutex.Unlock()
+	return secretValue, nil
+}
+
+//
+// END - SecretReference
+////////////////////////////////////////////////////////////////////////////////
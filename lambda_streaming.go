@@ -0,0 +1,394 @@
+package sparta
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// StreamingLambdaRuntime is the AWS Lambda runtime used for functions
+	// created with NewStreamingAWSLambda. The aws-lambda-go runtime doesn't
+	// support response streaming, so Sparta implements the Lambda Runtime
+	// API for these functions.
+	StreamingLambdaRuntime = "provided.al2"
+	// streamingBootstrapName is the executable that the custom runtime
+	// launches. It execs the Sparta binary.
+	streamingBootstrapName = "bootstrap"
+	// runtimeAPIVersion is the Lambda Runtime API version
+	runtimeAPIVersion = "2018-06-01"
+	// streamingContentTypeDefault is the response content type if the
+	// handler doesn't provide one
+	streamingContentTypeDefault = "application/octet-stream"
+	// streamingContentTypeHTTP is the content type of a Function URL
+	// response that includes the HTTP status code and headers
+	streamingContentTypeHTTP = "application/vnd.awslambda.http-integration-response"
+	// streamingErrorTypeTrailer and streamingErrorBodyTrailer report an
+	// error that occurs after the response starts streaming
+	streamingErrorTypeTrailer = "Lambda-Runtime-Function-Error-Type"
+	streamingErrorBodyTrailer = "Lambda-Runtime-Function-Error-Body"
+)
+
+// streamingBootstrapScript is the custom runtime bootstrap executable
+var streamingBootstrapScript = fmt.Sprintf("#!/bin/sh\nexec \"${LAMBDA_TASK_ROOT}/%s\"\n",
+	SpartaBinaryName)
+
+// StreamingHandler is a lambda function that writes its response to the
+// ResponseStream as it's produced, rather than returning it. The event is
+// provided as the raw JSON message. Use NewStreamingAWSLambda to register
+// a StreamingHandler.
+type StreamingHandler func(ctx context.Context,
+	msg json.RawMessage,
+	stream *ResponseStream) error
+
+// ResponseStream is the io.Writer that a StreamingHandler uses to stream
+// its response. Data is sent to the caller as it's written. The content
+// type must be set before the first write.
+type ResponseStream struct {
+	mutex       sync.Mutex
+	contentType string
+	writer      io.WriteCloser
+	start       func(contentType string) (io.WriteCloser, error)
+	startErr    error
+}
+
+// newResponseStream returns a ResponseStream that calls start to open the
+// response when the first byte is written
+func newResponseStream(start func(contentType string) (io.WriteCloser, error)) *ResponseStream {
+	return &ResponseStream{
+		contentType: streamingContentTypeDefault,
+		start:       start,
+	}
+}
+
+// started returns true if the response has been opened
+func (stream *ResponseStream) started() bool {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return stream.writer != nil || stream.startErr != nil
+}
+
+// open starts the response, if it hasn't already been started. The caller
+// must hold the mutex.
+func (stream *ResponseStream) open() (io.WriteCloser, error) {
+	if stream.writer == nil && stream.startErr == nil {
+		stream.writer, stream.startErr = stream.start(stream.contentType)
+	}
+	return stream.writer, stream.startErr
+}
+
+// ensureStarted starts the response so that empty responses are completed
+func (stream *ResponseStream) ensureStarted() error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	_, openErr := stream.open()
+	return openErr
+}
+
+// SetContentType sets the Content-Type of the response. It must be called
+// before the first write.
+func (stream *ResponseStream) SetContentType(contentType string) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.writer != nil || stream.startErr != nil {
+		return errors.Errorf("ResponseStream content type must be set before the first write")
+	}
+	stream.contentType = contentType
+	return nil
+}
+
+// WriteHTTPResponse writes the HTTP status code, headers and cookies for a
+// Function URL response. It must be called before the first write. The
+// data written afterwards is the HTTP response body.
+func (stream *ResponseStream) WriteHTTPResponse(statusCode int,
+	headers map[string]string,
+	cookies []string) error {
+	prelude := map[string]interface{}{
+		"statusCode": statusCode,
+	}
+	if len(headers) != 0 {
+		prelude["headers"] = headers
+	}
+	if len(cookies) != 0 {
+		prelude["cookies"] = cookies
+	}
+	preludeBytes, preludeBytesErr := json.Marshal(prelude)
+	if preludeBytesErr != nil {
+		return errors.Wrapf(preludeBytesErr, "Failed to marshal HTTP response prelude")
+	}
+	contentTypeErr := stream.SetContentType(streamingContentTypeHTTP)
+	if contentTypeErr != nil {
+		return contentTypeErr
+	}
+	// The prelude is separated from the body by 8 NUL bytes
+	_, writeErr := stream.Write(append(preludeBytes, make([]byte, 8)...))
+	return writeErr
+}
+
+// Write sends p to the caller
+func (stream *ResponseStream) Write(p []byte) (int, error) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	writer, writerErr := stream.open()
+	if writerErr != nil {
+		return 0, writerErr
+	}
+	return writer.Write(p)
+}
+
+// NewStreamingAWSLambda returns a *LambdaAWSInfo for a StreamingHandler.
+// Streaming functions use the StreamingLambdaRuntime custom runtime. To
+// stream the response to HTTP clients, add a FunctionURL with the
+// FunctionURLInvokeModeResponseStream invoke mode to the function Options.
+func NewStreamingAWSLambda(functionName string,
+	handler StreamingHandler,
+	roleNameOrIAMRoleDefinition interface{}) (*LambdaAWSInfo, error) {
+	if handler == nil {
+		return nil, errors.Errorf("AWS Lambda streaming handler must not be nil")
+	}
+	return NewAWSLambda(functionName, handler, roleNameOrIAMRoleDefinition)
+}
+
+// isStreamingLambda returns true if the function uses a StreamingHandler
+func isStreamingLambda(info *LambdaAWSInfo) bool {
+	_, isStreaming := info.handlerSymbol.(StreamingHandler)
+	return isStreaming
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - streamingRuntimeClient
+//
+
+// streamingRuntimeClient implements the subset of the Lambda Runtime API
+// required to dispatch events to a StreamingHandler.
+// Ref: https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html
+type streamingRuntimeClient struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+func newStreamingRuntimeClient(runtimeAPI string,
+	logger *logrus.Logger) (*streamingRuntimeClient, error) {
+	if runtimeAPI == "" {
+		return nil, errors.New("AWS_LAMBDA_RUNTIME_API is not defined")
+	}
+	return &streamingRuntimeClient{
+		baseURL:    fmt.Sprintf("http://%s/%s/runtime", runtimeAPI, runtimeAPIVersion),
+		httpClient: &http.Client{},
+		logger:     logger,
+	}, nil
+}
+
+// runtimeErrorBody returns the JSON error document used by the Runtime API
+func runtimeErrorBody(err error) ([]byte, string) {
+	errorType := fmt.Sprintf("%T", errors.Cause(err))
+	errorBody, _ := json.Marshal(map[string]string{
+		"errorMessage": err.Error(),
+		"errorType":    errorType,
+	})
+	return errorBody, errorType
+}
+
+// postError reports an error that occurs before the response is started
+func (client *streamingRuntimeClient) postError(requestID string, err error) error {
+	errorBody, errorType := runtimeErrorBody(err)
+	request, requestErr := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/invocation/%s/error", client.baseURL, requestID),
+		bytes.NewReader(errorBody))
+	if requestErr != nil {
+		return errors.Wrapf(requestErr, "Failed to create error request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Lambda-Runtime-Function-Error-Type", errorType)
+	response, responseErr := client.httpClient.Do(request)
+	if responseErr != nil {
+		return errors.Wrapf(responseErr, "Failed to post invocation error")
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	return nil
+}
+
+// streamingResponse is the chunked response request body
+type streamingResponse struct {
+	pipeWriter *io.PipeWriter
+	request    *http.Request
+	completed  chan error
+}
+
+func (response *streamingResponse) Write(p []byte) (int, error) {
+	return response.pipeWriter.Write(p)
+}
+
+func (response *streamingResponse) Close() error {
+	closeErr := response.pipeWriter.Close()
+	if closeErr != nil {
+		return closeErr
+	}
+	return <-response.completed
+}
+
+// closeWithError reports a mid-stream error using the HTTP trailers
+func (response *streamingResponse) closeWithError(err error) error {
+	errorBody, errorType := runtimeErrorBody(err)
+	response.request.Trailer.Set(streamingErrorTypeTrailer, errorType)
+	response.request.Trailer.Set(streamingErrorBodyTrailer,
+		base64.StdEncoding.EncodeToString(errorBody))
+	return response.Close()
+}
+
+// startResponse opens the chunked streaming response for the invocation
+func (client *streamingRuntimeClient) startResponse(requestID string,
+	contentType string) (*streamingResponse, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	request, requestErr := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/invocation/%s/response", client.baseURL, requestID),
+		pipeReader)
+	if requestErr != nil {
+		return nil, errors.Wrapf(requestErr, "Failed to create response request")
+	}
+	request.ContentLength = -1
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Lambda-Runtime-Function-Response-Mode", "streaming")
+	request.Trailer = http.Header{
+		streamingErrorTypeTrailer: nil,
+		streamingErrorBodyTrailer: nil,
+	}
+	response := &streamingResponse{
+		pipeWriter: pipeWriter,
+		request:    request,
+		completed:  make(chan error, 1),
+	}
+	go func() {
+		httpResponse, httpResponseErr := client.httpClient.Do(request)
+		if httpResponseErr != nil {
+			pipeReader.CloseWithError(httpResponseErr)
+			response.completed <- errors.Wrapf(httpResponseErr, "Failed to post streaming response")
+			return
+		}
+		defer httpResponse.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, httpResponse.Body)
+		// Unblock any pending writes if the runtime closed the request
+		pipeReader.Close()
+		if httpResponse.StatusCode != http.StatusAccepted {
+			response.completed <- errors.Errorf("Failed to post streaming response: %s",
+				httpResponse.Status)
+			return
+		}
+		response.completed <- nil
+	}()
+	return response, nil
+}
+
+// callStreamingHandler calls the handler and converts a panic into an error
+func callStreamingHandler(ctx context.Context,
+	handler StreamingHandler,
+	msg json.RawMessage,
+	stream *ResponseStream) (handlerErr error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			handlerErr = errors.Errorf("Streaming handler panic: %v", recovered)
+		}
+	}()
+	return handler(ctx, msg, stream)
+}
+
+// invokeNext waits for the next event and dispatches it to the handler.
+// Handler errors are reported to the Runtime API. The returned error is
+// only non-nil if the Runtime API request failed.
+func (client *streamingRuntimeClient) invokeNext(handler StreamingHandler) error {
+	nextResponse, nextResponseErr := client.httpClient.Get(client.baseURL + "/invocation/next")
+	if nextResponseErr != nil {
+		return errors.Wrapf(nextResponseErr, "Failed to get next invocation")
+	}
+	msg, msgErr := ioutil.ReadAll(nextResponse.Body)
+	nextResponse.Body.Close()
+	if msgErr != nil {
+		return errors.Wrapf(msgErr, "Failed to read next invocation")
+	}
+	if nextResponse.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to get next invocation: %s", nextResponse.Status)
+	}
+	requestID := nextResponse.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+	// Build the same context values as the aws-lambda-go runtime
+	ctx := context.Background()
+	deadlineMS, deadlineMSErr := strconv.ParseInt(nextResponse.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64)
+	if deadlineMSErr == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, deadlineMS*int64(time.Millisecond)))
+		defer cancel()
+	}
+	lambdaContext := &awsLambdaContext.LambdaContext{
+		AwsRequestID:       requestID,
+		InvokedFunctionArn: nextResponse.Header.Get("Lambda-Runtime-Invoked-Function-Arn"),
+	}
+	if clientContext := nextResponse.Header.Get("Lambda-Runtime-Client-Context"); clientContext != "" {
+		_ = json.Unmarshal([]byte(clientContext), &lambdaContext.ClientContext)
+	}
+	if cognitoIdentity := nextResponse.Header.Get("Lambda-Runtime-Cognito-Identity"); cognitoIdentity != "" {
+		_ = json.Unmarshal([]byte(cognitoIdentity), &lambdaContext.Identity)
+	}
+	ctx = awsLambdaContext.NewContext(ctx, lambdaContext)
+	if traceID := nextResponse.Header.Get("Lambda-Runtime-Trace-Id"); traceID != "" {
+		ctx = context.WithValue(ctx, lambdaTraceIDContextKey, traceID)
+		os.Setenv("_X_AMZN_TRACE_ID", traceID)
+	}
+
+	var response *streamingResponse
+	stream := newResponseStream(func(contentType string) (io.WriteCloser, error) {
+		var startErr error
+		response, startErr = client.startResponse(requestID, contentType)
+		if startErr != nil {
+			return nil, startErr
+		}
+		return response, nil
+	})
+	handlerErr := callStreamingHandler(ctx, handler, json.RawMessage(msg), stream)
+	if !stream.started() {
+		if handlerErr != nil {
+			return client.postError(requestID, handlerErr)
+		}
+		// Empty responses still need to be completed
+		if openErr := stream.ensureStarted(); openErr != nil {
+			return openErr
+		}
+	}
+	if response == nil {
+		return errors.Errorf("Failed to start streaming response for request %s", requestID)
+	}
+	if handlerErr != nil {
+		return response.closeWithError(handlerErr)
+	}
+	return response.Close()
+}
+
+// start dispatches events to the handler until a Runtime API request
+// fails
+func (client *streamingRuntimeClient) start(handler StreamingHandler) error {
+	for {
+		invokeErr := client.invokeNext(handler)
+		if invokeErr != nil {
+			client.logger.WithError(invokeErr).Error("Lambda Runtime API request failed")
+			return invokeErr
+		}
+	}
+}
+
+//
+// END - streamingRuntimeClient
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,161 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mockRuntimeAPI is a single event Lambda Runtime API
+type mockRuntimeAPI struct {
+	mutex        sync.Mutex
+	event        string
+	path         string
+	contentType  string
+	responseMode string
+	body         string
+	errorType    string
+}
+
+func (runtimeAPI *mockRuntimeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Lambda-Runtime-Aws-Request-Id", "request1")
+		w.Header().Set("Lambda-Runtime-Deadline-Ms", "4102444800000")
+		w.Header().Set("Lambda-Runtime-Invoked-Function-Arn",
+			"arn:aws:lambda:us-west-2:000000000000:function:Streaming")
+		_, _ = w.Write([]byte(runtimeAPI.event))
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	runtimeAPI.mutex.Lock()
+	defer runtimeAPI.mutex.Unlock()
+	runtimeAPI.path = r.URL.Path
+	runtimeAPI.contentType = r.Header.Get("Content-Type")
+	runtimeAPI.responseMode = r.Header.Get("Lambda-Runtime-Function-Response-Mode")
+	runtimeAPI.body = string(body)
+	runtimeAPI.errorType = r.Trailer.Get(streamingErrorTypeTrailer)
+	if runtimeAPI.errorType == "" {
+		runtimeAPI.errorType = r.Header.Get("Lambda-Runtime-Function-Error-Type")
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func invokeMockRuntimeAPI(t *testing.T, handler StreamingHandler) *mockRuntimeAPI {
+	runtimeAPI := &mockRuntimeAPI{
+		event: `{"name":"World"}`,
+	}
+	server := httptest.NewServer(runtimeAPI)
+	defer server.Close()
+
+	logger, _ := NewLogger("info")
+	client, clientErr := newStreamingRuntimeClient(strings.TrimPrefix(server.URL, "http://"),
+		logger)
+	if clientErr != nil {
+		t.Fatalf("Failed to create runtime client: %s", clientErr)
+	}
+	invokeErr := client.invokeNext(handler)
+	if invokeErr != nil {
+		t.Fatalf("Failed to invoke streaming handler: %s", invokeErr)
+	}
+	return runtimeAPI
+}
+
+func TestStreamingResponse(t *testing.T) {
+	runtimeAPI := invokeMockRuntimeAPI(t, func(ctx context.Context,
+		msg json.RawMessage,
+		stream *ResponseStream) error {
+		event := map[string]string{}
+		unmarshalErr := json.Unmarshal(msg, &event)
+		if unmarshalErr != nil {
+			return unmarshalErr
+		}
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			return errors.New("Missing context deadline")
+		}
+		contentTypeErr := stream.SetContentType("text/plain")
+		if contentTypeErr != nil {
+			return contentTypeErr
+		}
+		for _, eachChunk := range []string{"Hello ", event["name"]} {
+			_, writeErr := stream.Write([]byte(eachChunk))
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+		return nil
+	})
+	if runtimeAPI.path != "/2018-06-01/runtime/invocation/request1/response" {
+		t.Fatalf("Unexpected response path: %s", runtimeAPI.path)
+	}
+	if runtimeAPI.responseMode != "streaming" ||
+		runtimeAPI.contentType != "text/plain" ||
+		runtimeAPI.body != "Hello World" {
+		t.Fatalf("Unexpected streaming response: %#v", runtimeAPI)
+	}
+}
+
+func TestStreamingHTTPResponse(t *testing.T) {
+	runtimeAPI := invokeMockRuntimeAPI(t, func(ctx context.Context,
+		msg json.RawMessage,
+		stream *ResponseStream) error {
+		preludeErr := stream.WriteHTTPResponse(http.StatusCreated,
+			map[string]string{"Content-Type": "text/plain"},
+			nil)
+		if preludeErr != nil {
+			return preludeErr
+		}
+		_, writeErr := stream.Write([]byte("Created"))
+		return writeErr
+	})
+	expectedBody := `{"headers":{"Content-Type":"text/plain"},"statusCode":201}` +
+		strings.Repeat("\x00", 8) +
+		"Created"
+	if runtimeAPI.contentType != streamingContentTypeHTTP ||
+		runtimeAPI.body != expectedBody {
+		t.Fatalf("Unexpected HTTP streaming response: %#v", runtimeAPI)
+	}
+}
+
+func TestStreamingErrors(t *testing.T) {
+	// Errors before the first write use the error endpoint
+	runtimeAPI := invokeMockRuntimeAPI(t, func(ctx context.Context,
+		msg json.RawMessage,
+		stream *ResponseStream) error {
+		return errors.New("Failed before writing")
+	})
+	if runtimeAPI.path != "/2018-06-01/runtime/invocation/request1/error" ||
+		!strings.Contains(runtimeAPI.body, "Failed before writing") {
+		t.Fatalf("Unexpected error response: %#v", runtimeAPI)
+	}
+
+	// Errors after the first write use the response trailers
+	runtimeAPI = invokeMockRuntimeAPI(t, func(ctx context.Context,
+		msg json.RawMessage,
+		stream *ResponseStream) error {
+		_, _ = stream.Write([]byte("partial"))
+		panic("Failed while writing")
+	})
+	if runtimeAPI.path != "/2018-06-01/runtime/invocation/request1/response" ||
+		runtimeAPI.body != "partial" ||
+		runtimeAPI.errorType == "" {
+		t.Fatalf("Unexpected mid-stream error response: %#v", runtimeAPI)
+	}
+
+	// The content type can't change once the response starts
+	invokeMockRuntimeAPI(t, func(ctx context.Context,
+		msg json.RawMessage,
+		stream *ResponseStream) error {
+		_, _ = stream.Write([]byte("started"))
+		if stream.SetContentType("text/plain") == nil {
+			t.Fatalf("Failed to reject content type after the first write")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,188 @@
+package sparta
+
+import (
+	"fmt"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - FunctionURL
+//
+
+// Function URL authorization types. See
+// https://docs.aws.amazon.com/lambda/latest/dg/urls-auth.html
+// for more information.
+const (
+	// FunctionURLAuthTypeNone allows unauthenticated requests
+	// @enum FunctionURLAuthType
+	FunctionURLAuthTypeNone = "NONE"
+	// FunctionURLAuthTypeIAM requires SigV4 signed requests
+	// @enum FunctionURLAuthType
+	FunctionURLAuthTypeIAM = "AWS_IAM"
+)
+
+// Function URL invoke modes. See
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-response-streaming.html
+// for more information.
+const (
+	// FunctionURLInvokeModeBuffered returns the response once the
+	// function completes
+	// @enum FunctionURLInvokeMode
+	FunctionURLInvokeModeBuffered = "BUFFERED"
+	// FunctionURLInvokeModeResponseStream streams the response as the
+	// function writes it. Requires a StreamingHandler.
+	// @enum FunctionURLInvokeMode
+	FunctionURLInvokeModeResponseStream = "RESPONSE_STREAM"
+)
+
+// FunctionURLCors is the CORS configuration for a FunctionURL
+type FunctionURLCors struct {
+	AllowCredentials bool
+	AllowHeaders     []string
+	AllowMethods     []string
+	AllowOrigins     []string
+	ExposeHeaders    []string
+	// MaxAge is the number of seconds that browsers may cache the
+	// preflight response
+	MaxAge int64
+}
+
+// FunctionURL provisions a dedicated HTTPS endpoint for the lambda
+// function. If the function publishes an alias (see AutoPublishAlias), the
+// URL invokes the alias. The URL is published as a stack output.
+type FunctionURL struct {
+	// AuthType is the authorization type. Defaults to
+	// FunctionURLAuthTypeIAM. FunctionURLAuthTypeNone also grants public
+	// invoke privileges.
+	AuthType string
+	// InvokeMode is the invoke mode. Defaults to
+	// FunctionURLInvokeModeBuffered.
+	InvokeMode string
+	// Cors is the optional CORS configuration
+	Cors *FunctionURLCors
+}
+
+func (functionURL *FunctionURL) authType() string {
+	if functionURL.AuthType == "" {
+		return FunctionURLAuthTypeIAM
+	}
+	return functionURL.AuthType
+}
+
+func (functionURL *FunctionURL) invokeMode() string {
+	if functionURL.InvokeMode == "" {
+		return FunctionURLInvokeModeBuffered
+	}
+	return functionURL.InvokeMode
+}
+
+func (functionURL *FunctionURL) validate() error {
+	switch functionURL.authType() {
+	case FunctionURLAuthTypeNone, FunctionURLAuthTypeIAM:
+	default:
+		return errors.Errorf("FunctionURL has an unsupported AuthType: %s",
+			functionURL.AuthType)
+	}
+	switch functionURL.invokeMode() {
+	case FunctionURLInvokeModeBuffered, FunctionURLInvokeModeResponseStream:
+	default:
+		return errors.Errorf("FunctionURL has an unsupported InvokeMode: %s",
+			functionURL.InvokeMode)
+	}
+	if functionURL.Cors != nil && functionURL.Cors.MaxAge < 0 {
+		return errors.Errorf("FunctionURL Cors MaxAge must not be negative. Found: %d",
+			functionURL.Cors.MaxAge)
+	}
+	return nil
+}
+
+// functionURLOutputName returns the stack output that stores the URL
+func functionURLOutputName(lambdaLogicalResourceName string) string {
+	return fmt.Sprintf("%sFunctionURL", lambdaLogicalResourceName)
+}
+
+// exportFunctionURL adds the AWS::Lambda::Url resource and, for public
+// URLs, the invoke permission to the template
+func exportFunctionURL(lambdaLogicalResourceName string,
+	options *LambdaFunctionOptions,
+	aliasResourceName string,
+	template *gocf.Template) error {
+
+	functionURL := options.FunctionURL
+	if functionURL == nil {
+		return nil
+	}
+	validateErr := functionURL.validate()
+	if validateErr != nil {
+		return validateErr
+	}
+	urlResource := &lambdaURL{
+		AuthType:          gocf.String(functionURL.authType()),
+		InvokeMode:        gocf.String(functionURL.invokeMode()),
+		TargetFunctionArn: gocf.GetAtt(lambdaLogicalResourceName, "Arn"),
+	}
+	if functionURL.Cors != nil {
+		stringList := func(values []string) *gocf.StringListExpr {
+			if len(values) == 0 {
+				return nil
+			}
+			stringables := make([]gocf.Stringable, len(values))
+			for eachIndex, eachValue := range values {
+				stringables[eachIndex] = gocf.String(eachValue)
+			}
+			return gocf.StringList(stringables...)
+		}
+		urlResource.Cors = &lambdaURLCors{
+			AllowHeaders:  stringList(functionURL.Cors.AllowHeaders),
+			AllowMethods:  stringList(functionURL.Cors.AllowMethods),
+			AllowOrigins:  stringList(functionURL.Cors.AllowOrigins),
+			ExposeHeaders: stringList(functionURL.Cors.ExposeHeaders),
+		}
+		if functionURL.Cors.AllowCredentials {
+			urlResource.Cors.AllowCredentials = gocf.Bool(true)
+		}
+		if functionURL.Cors.MaxAge != 0 {
+			urlResource.Cors.MaxAge = gocf.Integer(functionURL.Cors.MaxAge)
+		}
+	}
+	var dependsOn []string
+	if aliasResourceName != "" {
+		urlResource.Qualifier = gocf.String(publishedAliasName(options))
+		dependsOn = append(dependsOn, aliasResourceName)
+	}
+	urlResourceName := CloudFormationResourceName("FunctionURL",
+		lambdaLogicalResourceName)
+	cfResource := template.AddResource(urlResourceName, urlResource)
+	cfResource.DependsOn = dependsOn
+
+	// Public URLs require a resource policy that allows anyone to invoke
+	// the function through the URL
+	if functionURL.authType() == FunctionURLAuthTypeNone {
+		functionName := gocf.Ref(lambdaLogicalResourceName).String()
+		if aliasResourceName != "" {
+			functionName = gocf.Ref(aliasResourceName).String()
+		}
+		permissionResourceName := CloudFormationResourceName("FunctionURLPermission",
+			lambdaLogicalResourceName)
+		permissionResource := template.AddResource(permissionResourceName, &lambdaPermission{
+			LambdaPermission: gocf.LambdaPermission{
+				Action:       gocf.String("lambda:InvokeFunctionUrl"),
+				FunctionName: functionName,
+				Principal:    gocf.String("*"),
+			},
+			FunctionURLAuthType: gocf.String(FunctionURLAuthTypeNone),
+		})
+		permissionResource.DependsOn = dependsOn
+	}
+	template.Outputs[functionURLOutputName(lambdaLogicalResourceName)] = &gocf.Output{
+		Description: "Lambda function URL",
+		Value:       gocf.GetAtt(urlResourceName, "FunctionUrl"),
+	}
+	return nil
+}
+
+//
+// END - FunctionURL
+////////////////////////////////////////////////////////////////////////////////
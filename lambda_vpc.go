@@ -0,0 +1,65 @@
+package sparta
+
+import (
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - VPCConfig
+//
+
+// VPCConfig is the typed VPC configuration for a lambda function, assigned
+// to LambdaFunctionOptions.VPCDiscovery. Subnets and security groups are
+// either listed explicitly or discovered by tag at provision time. Tag
+// discovery requires the decorator.VPCConfigDiscoveryDecorator PreMarshall
+// hook. Sparta-managed
+// execution roles are automatically granted the network interface
+// privileges required to attach to the VPC.
+type VPCConfig struct {
+	// SubnetIDs are the subnets the function is attached to
+	SubnetIDs []gocf.Stringable
+	// SecurityGroupIDs are the security groups applied to the function's
+	// network interfaces
+	SecurityGroupIDs []gocf.Stringable
+	// SubnetTags are the tag key/value pairs that discovered subnets must
+	// have. An empty value matches any subnet with the tag key.
+	SubnetTags map[string]string
+	// SecurityGroupTags are the tag key/value pairs that discovered security
+	// groups must have. An empty value matches any security group with the
+	// tag key.
+	SecurityGroupTags map[string]string
+	// VpcID optionally restricts tag discovery to a single VPC
+	VpcID string
+}
+
+// RequiresDiscovery returns true if either subnets or security groups
+// must be discovered by tag before the function can be provisioned
+func (vpcConfig *VPCConfig) RequiresDiscovery() bool {
+	return len(vpcConfig.SubnetTags) != 0 || len(vpcConfig.SecurityGroupTags) != 0
+}
+
+func (vpcConfig *VPCConfig) validate() error {
+	if len(vpcConfig.SubnetIDs) == 0 && len(vpcConfig.SubnetTags) == 0 {
+		return errors.Errorf("VPCDiscovery must define either SubnetIDs or SubnetTags")
+	}
+	if len(vpcConfig.SecurityGroupIDs) == 0 && len(vpcConfig.SecurityGroupTags) == 0 {
+		return errors.Errorf("VPCDiscovery must define either SecurityGroupIDs or SecurityGroupTags")
+	}
+	return nil
+}
+
+// lambdaVPCConfig returns the AWS::Lambda::Function VpcConfig property
+func (vpcConfig *VPCConfig) lambdaVPCConfig() (*gocf.LambdaFunctionVPCConfig, error) {
+	if vpcConfig.RequiresDiscovery() {
+		return nil, errors.Errorf("VPCDiscovery tags were not resolved. Add decorator.VPCConfigDiscoveryDecorator to the WorkflowHooks PreMarshalls slice")
+	}
+	return &gocf.LambdaFunctionVPCConfig{
+		SecurityGroupIDs: gocf.StringList(vpcConfig.SecurityGroupIDs...),
+		SubnetIDs:        gocf.StringList(vpcConfig.SubnetIDs...),
+	}, nil
+}
+
+//
+// END - VPCConfig
+////////////////////////////////////////////////////////////////////////////////
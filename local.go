@@ -0,0 +1,230 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// localAccountID is the account ID in the faked function ARN
+	localAccountID = "123412341234"
+	// localDefaultRegion is the faked function ARN region if the session
+	// doesn't have one
+	localDefaultRegion = "us-east-1"
+)
+
+// nopWriteCloser adapts an io.Writer to the io.WriteCloser returned to a
+// local ResponseStream
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// localLambdaAWSInfo returns the function with the function name or logical
+// resource ID
+func localLambdaAWSInfo(name string, lambdaAWSInfos []*LambdaAWSInfo) (*LambdaAWSInfo, error) {
+	knownNames := []string{}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		if eachLambdaInfo.lambdaFunctionName() == name ||
+			eachLambdaInfo.LogicalResourceName() == name {
+			return eachLambdaInfo, nil
+		}
+		knownNames = append(knownNames, eachLambdaInfo.lambdaFunctionName())
+	}
+	return nil, errors.Errorf("Unknown function: %s. Known functions: %v", name, knownNames)
+}
+
+// localInvokeEvent returns the event from the file (or stdin for "-") or
+// the mock event for the event source
+func localInvokeEvent(eventPath string, eventSource string) (json.RawMessage, error) {
+	if eventPath != "" && eventSource != "" {
+		return nil, errors.New("Only one of the event file and event source may be provided")
+	}
+	if eventSource != "" {
+		mockEvent, mockEventErr := spartaAWSEvents.NewMockEvent(eventSource)
+		if mockEventErr != nil {
+			return nil, mockEventErr
+		}
+		return json.Marshal(mockEvent)
+	}
+	if eventPath == "" {
+		return json.RawMessage("{}"), nil
+	}
+	var eventData []byte
+	var eventDataErr error
+	if eventPath == "-" {
+		eventData, eventDataErr = ioutil.ReadAll(os.Stdin)
+	} else {
+		eventData, eventDataErr = ioutil.ReadFile(eventPath)
+	}
+	if eventDataErr != nil {
+		return nil, errors.Wrapf(eventDataErr, "Failed to read event: %s", eventPath)
+	}
+	if !json.Valid(eventData) {
+		return nil, errors.Errorf("Event isn't valid JSON: %s", eventPath)
+	}
+	return json.RawMessage(eventData), nil
+}
+
+// invokeLocal invokes the function in-process with the same request
+// lifecycle as the AWS Lambda binary: interceptors, context values and
+// HandlerMiddleware. The lambda context is faked and the context deadline
+// is the function's timeout. Streaming functions write their response to
+// streamWriter.
+func invokeLocal(ctx context.Context,
+	serviceName string,
+	lambdaAWSInfo *LambdaAWSInfo,
+	msg json.RawMessage,
+	streamWriter io.Writer,
+	logger *logrus.Logger) (interface{}, error) {
+
+	var declaredConfig map[string]*ConfigVariable
+	timeout := int64(3)
+	if lambdaAWSInfo.Options != nil {
+		declaredConfig = lambdaAWSInfo.Options.Config
+		if lambdaAWSInfo.Options.Timeout > 0 {
+			timeout = lambdaAWSInfo.Options.Timeout
+		}
+	}
+	functionConfig, functionConfigErr := loadFunctionConfig(declaredConfig, os.LookupEnv)
+	if functionConfigErr != nil {
+		return nil, functionConfigErr
+	}
+	interceptors := lambdaAWSInfo.Interceptors
+	if interceptors == nil {
+		interceptors = &LambdaEventInterceptors{}
+	}
+	awsSession := spartaAWS.NewSession(logger)
+	region := aws.StringValue(awsSession.Config.Region)
+	if region == "" {
+		region = localDefaultRegion
+	}
+	functionName := awsLambdaInternalName(lambdaAWSInfo.lambdaFunctionName())
+	requestID := fmt.Sprintf("local-%d", time.Now().UnixNano())
+	lambdaContext := &awsLambdaContext.LambdaContext{
+		AwsRequestID: requestID,
+		InvokedFunctionArn: fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s%s%s",
+			region,
+			localAccountID,
+			serviceName,
+			functionNameDelimiter,
+			functionName),
+	}
+	ctx, cancel := context.WithTimeout(awsLambdaContext.NewContext(ctx, lambdaContext),
+		time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	ctx = applyInterceptors(ctx, msg, interceptors.Begin)
+	ctx = context.WithValue(ctx, ContextKeyLogger, logger)
+	ctx = context.WithValue(ctx, ContextKeyAWSSession, awsSession)
+	ctx = context.WithValue(ctx, ContextKeyConfig, functionConfig)
+	ctx = applyInterceptors(ctx, msg, interceptors.BeforeSetup)
+	logrusEntry := logrus.NewEntry(logger).WithFields(logrus.Fields{
+		LogFieldRequestID:  requestID,
+		LogFieldARN:        lambdaContext.InvokedFunctionArn,
+		LogFieldBuildID:    StampedBuildID,
+		LogFieldInstanceID: InstanceID(),
+	})
+	ctx = context.WithValue(ctx, ContextKeyRequestLogger, logrusEntry)
+	metricsLogger := NewMetricsLogger(serviceName).
+		SetDimension(MetricDimensionServiceName, serviceName).
+		SetDimension(MetricDimensionFunctionName, functionName).
+		SetProperty(LogFieldRequestID, requestID)
+	ctx = context.WithValue(ctx, ContextKeyMetrics, metricsLogger)
+	ctx = applyInterceptors(ctx, msg, interceptors.AfterSetup)
+	ctx = applyInterceptors(ctx, msg, interceptors.BeforeDispatch)
+
+	var val interface{}
+	var err error
+	if streamingHandler, isStreaming := lambdaAWSInfo.handlerSymbol.(StreamingHandler); isStreaming {
+		stream := newResponseStream(func(contentType string) (io.WriteCloser, error) {
+			return nopWriteCloser{streamWriter}, nil
+		})
+		err = streamingHandler(ctx, msg, stream)
+	} else {
+		dispatch := applyHandlerMiddleware(reflectedLambdaHandler(lambdaAWSInfo.handlerSymbol),
+			registeredHandlerMiddleware())
+		val, err = dispatch(ctx, msg)
+	}
+
+	ctx = applyInterceptors(ctx, msg, interceptors.AfterDispatch)
+	// EMF metrics are written to the log rather than the response output
+	flushErr := metricsLogger.Flush(logger.Out)
+	if flushErr != nil {
+		logrusEntry.WithError(flushErr).Warn("Failed to flush EMF metrics")
+	}
+	ctx = context.WithValue(ctx, ContextKeyLambdaError, err)
+	ctx = context.WithValue(ctx, ContextKeyLambdaResponse, val)
+	applyInterceptors(ctx, msg, interceptors.Complete)
+	return val, err
+}
+
+// LocalInvoke is the command that invokes a function in-process with an
+// event, without Docker or a deployment, and writes the JSON response to
+// the options' Output writer
+func LocalInvoke(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	options *LocalInvokeOptions,
+	logger *logrus.Logger) error {
+
+	if options == nil {
+		return errors.New("LocalInvoke requires options")
+	}
+	output := options.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	lambdaAWSInfo, lambdaAWSInfoErr := localLambdaAWSInfo(options.FunctionName, lambdaAWSInfos)
+	if lambdaAWSInfoErr != nil {
+		return lambdaAWSInfoErr
+	}
+	msg, msgErr := localInvokeEvent(options.EventPath, options.EventSource)
+	if msgErr != nil {
+		return msgErr
+	}
+	logger.WithFields(logrus.Fields{
+		"Function":  lambdaAWSInfo.lambdaFunctionName(),
+		"EventSize": len(msg),
+	}).Info("Invoking function locally")
+
+	startTime := time.Now()
+	val, invokeErr := invokeLocal(context.Background(),
+		serviceName,
+		lambdaAWSInfo,
+		msg,
+		output,
+		logger)
+	logger.WithFields(logrus.Fields{
+		"Duration": time.Since(startTime).String(),
+	}).Info("Local invocation complete")
+	if invokeErr != nil {
+		return errors.Wrapf(invokeErr, "Function %s returned an error",
+			lambdaAWSInfo.lambdaFunctionName())
+	}
+	if isStreamingLambda(lambdaAWSInfo) {
+		return nil
+	}
+	response, responseErr := json.MarshalIndent(val, "", "  ")
+	if responseErr != nil {
+		return errors.Wrapf(responseErr, "Failed to marshal response")
+	}
+	_, writeErr := fmt.Fprintf(output, "%s\n", response)
+	return writeErr
+}
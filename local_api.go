@@ -0,0 +1,649 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// localAPIShutdownTimeout is how long in-flight requests have to complete
+// once the server is interrupted
+const localAPIShutdownTimeout = 5 * time.Second
+
+// localAPITemplate is the Sparta request mapping template selected
+// for a request
+type localAPITemplate int
+
+const (
+	localAPITemplateJSON localAPITemplate = iota
+	localAPITemplateDefault
+	localAPITemplateFormEncoded
+	localAPITemplateBinary
+	localAPITemplatePassthrough
+	localAPITemplateCustom
+)
+
+// localAPIGatewayEvent is the lambda event produced by the request
+// mapping templates
+type localAPIGatewayEvent struct {
+	APIGatewayLambdaJSONEvent
+	IsBase64Encoded bool              `json:"isBase64Encoded,omitempty"`
+	Authorizer      map[string]string `json:"authorizer"`
+}
+
+// localAPIError is the error payload returned by AWS Lambda for a
+// failed invocation
+type localAPIError struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// localAPIRoute is a resource method served by the local API
+type localAPIRoute struct {
+	pathPart   string
+	segments   []string
+	httpMethod string
+	resource   *Resource
+	method     *Method
+}
+
+// match returns the path parameters if the request path segments match
+// the route
+func (route *localAPIRoute) match(requestSegments []string) (map[string]string, bool) {
+	pathParams := make(map[string]string)
+	for index, eachSegment := range route.segments {
+		// Greedy path variables match the remaining segments
+		if strings.HasPrefix(eachSegment, "{") && strings.HasSuffix(eachSegment, "+}") {
+			if index >= len(requestSegments) {
+				return nil, false
+			}
+			paramName := strings.TrimSuffix(strings.TrimPrefix(eachSegment, "{"), "+}")
+			pathParams[paramName] = strings.Join(requestSegments[index:], "/")
+			return pathParams, true
+		}
+		if index >= len(requestSegments) {
+			return nil, false
+		}
+		if strings.HasPrefix(eachSegment, "{") && strings.HasSuffix(eachSegment, "}") {
+			if requestSegments[index] == "" {
+				return nil, false
+			}
+			pathParams[strings.Trim(eachSegment, "{}")] = requestSegments[index]
+		} else if eachSegment != requestSegments[index] {
+			return nil, false
+		}
+	}
+	return pathParams, len(route.segments) == len(requestSegments)
+}
+
+// localAPISegmentRank orders literal segments before path variables,
+// which are before greedy path variables
+func localAPISegmentRank(segment string) int {
+	switch {
+	case strings.HasSuffix(segment, "+}"):
+		return 2
+	case strings.HasPrefix(segment, "{"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// localAPIPathSegments returns the segments of the URL path
+func localAPIPathSegments(urlPath string) []string {
+	trimmedPath := strings.Trim(urlPath, "/")
+	if trimmedPath == "" {
+		return []string{}
+	}
+	return strings.Split(trimmedPath, "/")
+}
+
+// localAPIHandler is the http.Handler that dispatches API Gateway
+// requests to the in-process lambda functions
+type localAPIHandler struct {
+	serviceName string
+	api         *API
+	stageName   string
+	routes      []*localAPIRoute
+	corsPaths   map[string]*corsPath
+	logger      *logrus.Logger
+}
+
+// newLocalAPIHandler returns the handler for the API resources
+func newLocalAPIHandler(serviceName string, api *API, logger *logrus.Logger) (*localAPIHandler, error) {
+	handler := &localAPIHandler{
+		serviceName: serviceName,
+		api:         api,
+		stageName:   "local",
+		corsPaths:   api.corsPaths(),
+		logger:      logger,
+	}
+	if api.stage != nil {
+		handler.stageName = api.stage.name
+	}
+	for _, eachResource := range api.resources {
+		for eachMethodName, eachMethod := range eachResource.Methods {
+			handler.routes = append(handler.routes, &localAPIRoute{
+				pathPart:   eachResource.pathPart,
+				segments:   localAPIPathSegments(eachResource.pathPart),
+				httpMethod: eachMethodName,
+				resource:   eachResource,
+				method:     eachMethod,
+			})
+		}
+	}
+	if len(handler.routes) == 0 {
+		return nil, errors.Errorf("API %s doesn't define any resource methods", api.name)
+	}
+	// Most specific routes first, so that /pets/dog is matched before
+	// /pets/{name} and /{proxy+}
+	sort.SliceStable(handler.routes, func(i, j int) bool {
+		lhs, rhs := handler.routes[i], handler.routes[j]
+		for index := 0; index < len(lhs.segments) && index < len(rhs.segments); index++ {
+			lhsRank := localAPISegmentRank(lhs.segments[index])
+			rhsRank := localAPISegmentRank(rhs.segments[index])
+			if lhsRank != rhsRank {
+				return lhsRank < rhsRank
+			}
+		}
+		if len(lhs.segments) != len(rhs.segments) {
+			return len(lhs.segments) > len(rhs.segments)
+		}
+		if lhs.pathPart != rhs.pathPart {
+			return lhs.pathPart < rhs.pathPart
+		}
+		return lhs.httpMethod < rhs.httpMethod
+	})
+	return handler, nil
+}
+
+// route returns the route and path parameters for the request
+func (handler *localAPIHandler) route(httpMethod string, urlPath string) (*localAPIRoute, map[string]string) {
+	requestSegments := localAPIPathSegments(urlPath)
+	for _, eachRoute := range handler.routes {
+		if eachRoute.httpMethod != httpMethod && eachRoute.httpMethod != "ANY" {
+			continue
+		}
+		pathParams, matched := eachRoute.match(requestSegments)
+		if matched {
+			return eachRoute, pathParams
+		}
+	}
+	return nil, nil
+}
+
+// preflightPath returns the CORS preflight information for the request path
+func (handler *localAPIHandler) preflightPath(urlPath string) *corsPath {
+	requestSegments := localAPIPathSegments(urlPath)
+	for _, eachRoute := range handler.routes {
+		if _, matched := eachRoute.match(requestSegments); matched {
+			return handler.corsPaths[eachRoute.pathPart]
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the JSON encoded value with the status code
+func (handler *localAPIHandler) writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encodeErr := json.NewEncoder(w).Encode(value)
+	if encodeErr != nil {
+		handler.logger.WithError(encodeErr).Warn("Failed to write response")
+	}
+}
+
+// writeMessage writes an API Gateway style {"message": ...} response
+func (handler *localAPIHandler) writeMessage(w http.ResponseWriter, statusCode int, message string) {
+	handler.writeJSON(w, statusCode, map[string]string{
+		"message": message,
+	})
+}
+
+// setCORSHeaders adds the CORS headers to the response. If there are
+// multiple allowed origins the request Origin is returned iff it's allowed.
+func (handler *localAPIHandler) setCORSHeaders(w http.ResponseWriter,
+	req *http.Request,
+	options *CORSOptions,
+	methods []string) error {
+	config, configErr := newCORSConfig(options, methods)
+	if configErr != nil || config == nil {
+		return configErr
+	}
+	for eachKey, eachValue := range config.headers {
+		w.Header().Set(eachKey, fmt.Sprintf("%v", eachValue))
+	}
+	requestOrigin := req.Header.Get("Origin")
+	if config.originTemplate != "" &&
+		requestOrigin != "" &&
+		stringInSlice(requestOrigin, options.AllowedOrigins) {
+		w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+	}
+	return nil
+}
+
+// requestTemplate returns the Sparta request mapping template for the
+// request Content-Type
+func (handler *localAPIHandler) requestTemplate(method *Method, contentType string) (localAPITemplate, error) {
+	templates, templatesErr := methodRequestTemplates(handler.api, method)
+	if templatesErr != nil {
+		return localAPITemplateCustom, templatesErr
+	}
+	// API Gateway assumes application/json if there isn't a Content-Type
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	template, templateExists := templates[contentType]
+	if !templateExists {
+		// The default passthrough behavior sends unmapped content types
+		// to the integration unchanged
+		return localAPITemplatePassthrough, nil
+	}
+	switch template {
+	case _escFSMustString(false, "/resources/provision/apigateway/inputmapping_json.vtl"):
+		return localAPITemplateJSON, nil
+	case _escFSMustString(false, "/resources/provision/apigateway/inputmapping_default.vtl"):
+		return localAPITemplateDefault, nil
+	case _escFSMustString(false, "/resources/provision/apigateway/inputmapping_formencoded.vtl"):
+		return localAPITemplateFormEncoded, nil
+	case binaryRequestTemplate():
+		return localAPITemplateBinary, nil
+	default:
+		return localAPITemplateCustom, nil
+	}
+}
+
+// isBinaryMediaType returns true if the content type matches one of the
+// API BinaryMediaTypes, which may include wildcards (eg: image/*)
+func (handler *localAPIHandler) isBinaryMediaType(contentType string) bool {
+	for _, eachMediaType := range handler.api.BinaryMediaTypes {
+		if eachMediaType == contentType || eachMediaType == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(eachMediaType, "/*") &&
+			strings.HasPrefix(contentType, strings.TrimSuffix(eachMediaType, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestEvent returns the lambda event for the request. The returned
+// status code is non-zero if API Gateway would reject the request.
+func (handler *localAPIHandler) requestEvent(req *http.Request,
+	route *localAPIRoute,
+	pathParams map[string]string,
+	requestID string) (json.RawMessage, int, error) {
+
+	body, bodyErr := ioutil.ReadAll(req.Body)
+	if bodyErr != nil {
+		return nil, http.StatusBadRequest, errors.Wrapf(bodyErr, "Failed to read request body")
+	}
+	contentType := ""
+	if req.Header.Get("Content-Type") != "" {
+		mediaType, _, mediaTypeErr := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaTypeErr != nil {
+			return nil, http.StatusUnsupportedMediaType, errors.Wrapf(mediaTypeErr, "Invalid Content-Type")
+		}
+		contentType = mediaType
+	}
+	mappingTemplate := localAPITemplateBinary
+	if !handler.isBinaryMediaType(contentType) {
+		var mappingTemplateErr error
+		mappingTemplate, mappingTemplateErr = handler.requestTemplate(route.method, contentType)
+		if mappingTemplateErr != nil {
+			return nil, http.StatusInternalServerError, mappingTemplateErr
+		}
+	}
+	switch mappingTemplate {
+	case localAPITemplatePassthrough:
+		return json.RawMessage(body), 0, nil
+	case localAPITemplateCustom:
+		return nil, http.StatusNotImplemented,
+			errors.Errorf("Custom request mapping templates aren't supported locally (Content-Type: %s)",
+				contentType)
+	}
+
+	event := &localAPIGatewayEvent{
+		APIGatewayLambdaJSONEvent: APIGatewayLambdaJSONEvent{
+			Method:      req.Method,
+			Headers:     make(map[string]string),
+			QueryParams: make(map[string]string),
+			PathParams:  pathParams,
+		},
+		Authorizer: make(map[string]string),
+	}
+	for eachHeader := range req.Header {
+		event.Headers[eachHeader] = req.Header.Get(eachHeader)
+	}
+	queryParams := req.URL.Query()
+	for eachParam := range queryParams {
+		event.QueryParams[eachParam] = queryParams.Get(eachParam)
+	}
+
+	var eventBody interface{}
+	switch mappingTemplate {
+	case localAPITemplateJSON:
+		event.Context = APIGatewayContext{
+			APIID:        "local",
+			Method:       req.Method,
+			RequestID:    requestID,
+			ResourceID:   route.pathPart,
+			ResourcePath: route.pathPart,
+			Stage:        handler.stageName,
+			Identity: APIGatewayIdentity{
+				AccountID: localAccountID,
+				SourceIP:  localAPISourceIP(req),
+				UserAgent: req.UserAgent(),
+			},
+		}
+		if len(strings.TrimSpace(string(body))) == 0 {
+			body = []byte("{}")
+		}
+		if !json.Valid(body) {
+			return nil, http.StatusBadRequest, errors.New("Could not parse request body into json")
+		}
+		eventBody = json.RawMessage(body)
+	case localAPITemplateDefault:
+		eventBody = string(body)
+	case localAPITemplateBinary:
+		eventBody = base64.StdEncoding.EncodeToString(body)
+		event.IsBase64Encoded = true
+	case localAPITemplateFormEncoded:
+		var formData string
+		switch req.Method {
+		case http.MethodPost:
+			formData = string(body)
+		case http.MethodGet:
+			formData = req.URL.RawQuery
+		}
+		formValues, _ := url.ParseQuery(formData)
+		formBody := make(map[string]string)
+		for eachKey := range formValues {
+			// Pairs without a value are ignored
+			if formValues.Get(eachKey) != "" {
+				formBody[eachKey] = formValues.Get(eachKey)
+			}
+		}
+		eventBody = formBody
+	}
+	bodyJSON, bodyJSONErr := json.Marshal(eventBody)
+	if bodyJSONErr != nil {
+		return nil, http.StatusInternalServerError, bodyJSONErr
+	}
+	event.Body = bodyJSON
+	eventJSON, eventJSONErr := json.Marshal(event)
+	if eventJSONErr != nil {
+		return nil, http.StatusInternalServerError, eventJSONErr
+	}
+	return eventJSON, 0, nil
+}
+
+// localAPISourceIP returns the client IP address of the request
+func localAPISourceIP(req *http.Request) string {
+	host, _, splitErr := net.SplitHostPort(req.RemoteAddr)
+	if splitErr != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// localAPIErrorType returns the errorType AWS Lambda reports for err
+func localAPIErrorType(err error) string {
+	errorType := reflect.TypeOf(err)
+	if errorType.Kind() == reflect.Ptr {
+		return errorType.Elem().Name()
+	}
+	return errorType.Name()
+}
+
+// selectIntegrationResponse returns the status code and integration
+// response for the lambda result. Errors are matched against the
+// integration response selection patterns. Successful responses and
+// unmatched errors use the default integration response.
+func (handler *localAPIHandler) selectIntegrationResponse(method *Method, lambdaErr error) (int, *IntegrationResponse) {
+	if lambdaErr != nil {
+		var statusCodes []int
+		for eachStatusCode, eachResponse := range method.Integration.Responses {
+			if eachResponse.SelectionPattern != "" {
+				statusCodes = append(statusCodes, eachStatusCode)
+			}
+		}
+		sort.Ints(statusCodes)
+		for _, eachStatusCode := range statusCodes {
+			integrationResponse := method.Integration.Responses[eachStatusCode]
+			// Selection patterns must match the entire error message
+			reSelection, reSelectionErr := regexp.Compile(fmt.Sprintf("^(?s:%s)$",
+				integrationResponse.SelectionPattern))
+			if reSelectionErr == nil && reSelection.MatchString(lambdaErr.Error()) {
+				return eachStatusCode, integrationResponse
+			}
+		}
+	}
+	return method.defaultHTTPResponseCode,
+		method.Integration.Responses[method.defaultHTTPResponseCode]
+}
+
+// writeLambdaResponse applies the integration response mapping to the
+// lambda result and writes the HTTP response
+func (handler *localAPIHandler) writeLambdaResponse(w http.ResponseWriter,
+	route *localAPIRoute,
+	val interface{},
+	lambdaErr error,
+	logger *logrus.Entry) {
+
+	statusCode, integrationResponse := handler.selectIntegrationResponse(route.method, lambdaErr)
+	var payload interface{} = val
+	if lambdaErr != nil {
+		payload = &localAPIError{
+			ErrorMessage: lambdaErr.Error(),
+			ErrorType:    localAPIErrorType(lambdaErr),
+		}
+	}
+	payloadJSON, payloadJSONErr := json.Marshal(payload)
+	if payloadJSONErr != nil {
+		handler.writeMessage(w, http.StatusInternalServerError, "Internal server error")
+		logger.WithError(payloadJSONErr).Error("Failed to marshal lambda response")
+		return
+	}
+
+	template := ""
+	if integrationResponse != nil {
+		template = integrationResponse.Templates["application/json"]
+	}
+	outputTemplate, _ := _escFSString(false, "/resources/provision/apigateway/outputmapping_json.vtl")
+	if template != outputTemplate {
+		// Integration responses without a template pass the payload through
+		if template != "" {
+			logger.Warn("Custom response mapping templates aren't supported locally. Returning the lambda response.")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write(payloadJSON)
+		return
+	}
+
+	// Apply the Sparta output mapping template: the body is the `body`
+	// field, and the `code` and `headers` fields override the defaults
+	var response struct {
+		Code    json.RawMessage   `json:"code"`
+		Body    json.RawMessage   `json:"body"`
+		Headers map[string]string `json:"headers"`
+	}
+	unmarshalErr := json.Unmarshal(payloadJSON, &response)
+	if unmarshalErr != nil {
+		// Non-object responses don't have any fields to map
+		logger.WithField("Response", string(payloadJSON)).
+			Warn("Lambda response isn't a JSON object. Use apigateway.NewResponse to return a body.")
+	} else if lambdaErr == nil && response.Body == nil {
+		logger.Warn("Lambda response doesn't include a body field. Use apigateway.NewResponse to return a body.")
+	}
+	if len(response.Code) != 0 {
+		var overrideCode interface{}
+		json.Unmarshal(response.Code, &overrideCode)
+		switch typedCode := overrideCode.(type) {
+		case float64:
+			statusCode = int(typedCode)
+		case string:
+			if parsedCode, parsedCodeErr := strconv.Atoi(typedCode); parsedCodeErr == nil {
+				statusCode = parsedCode
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	for eachKey, eachValue := range response.Headers {
+		w.Header().Set(eachKey, eachValue)
+	}
+	responseBody := []byte(response.Body)
+	if integrationResponse.ContentHandling == APIGatewayContentHandlingConvertToBinary {
+		var encodedBody string
+		if json.Unmarshal(response.Body, &encodedBody) == nil {
+			decodedBody, decodedBodyErr := base64.StdEncoding.DecodeString(encodedBody)
+			if decodedBodyErr == nil {
+				responseBody = decodedBody
+			}
+		}
+	}
+	w.WriteHeader(statusCode)
+	w.Write(responseBody)
+}
+
+// ServeHTTP dispatches the request to the lambda function for the
+// resource method
+func (handler *localAPIHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	startTime := time.Now()
+	requestID := fmt.Sprintf("local-%d", startTime.UnixNano())
+	logger := handler.logger.WithFields(logrus.Fields{
+		"Method": req.Method,
+		"Path":   req.URL.Path,
+	})
+
+	route, pathParams := handler.route(req.Method, req.URL.Path)
+	if route == nil && req.Method == http.MethodOptions {
+		preflight := handler.preflightPath(req.URL.Path)
+		if preflight != nil && preflight.preflight != nil {
+			corsErr := handler.setCORSHeaders(w, req, preflight.preflight, preflight.methods)
+			if corsErr != nil {
+				logger.WithError(corsErr).Warn("Failed to create CORS headers")
+			}
+			handler.writeJSON(w, http.StatusOK, map[string]interface{}{})
+			return
+		}
+	}
+	if route == nil {
+		// API Gateway's response for undefined resource methods
+		handler.writeMessage(w, http.StatusForbidden, "Missing Authentication Token")
+		logger.WithField("Status", http.StatusForbidden).Warn("No matching resource method")
+		return
+	}
+	logger = logger.WithField("Resource", route.pathPart)
+	if route.method.serviceIntegration != nil || route.resource.parentLambda == nil {
+		handler.writeMessage(w, http.StatusNotImplemented,
+			"Service integrations aren't supported locally")
+		logger.WithField("Status", http.StatusNotImplemented).Warn("Service integrations aren't supported locally")
+		return
+	}
+	var corsMethods []string
+	if corsPath, corsPathExists := handler.corsPaths[route.pathPart]; corsPathExists {
+		corsMethods = corsPath.methods
+	}
+	corsErr := handler.setCORSHeaders(w,
+		req,
+		handler.api.methodCORSOptions(route.resource, route.method),
+		corsMethods)
+	if corsErr != nil {
+		logger.WithError(corsErr).Warn("Failed to create CORS headers")
+	}
+
+	msg, rejectStatus, msgErr := handler.requestEvent(req, route, pathParams, requestID)
+	if msgErr != nil {
+		handler.writeMessage(w, rejectStatus, msgErr.Error())
+		logger.WithError(msgErr).WithField("Status", rejectStatus).Warn("Request rejected")
+		return
+	}
+	val, lambdaErr := invokeLocal(req.Context(),
+		handler.serviceName,
+		route.resource.parentLambda,
+		msg,
+		ioutil.Discard,
+		handler.logger)
+	if lambdaErr != nil {
+		logger = logger.WithField("Error", lambdaErr.Error())
+	}
+	handler.writeLambdaResponse(w, route, val, lambdaErr, logger)
+	logger.WithFields(logrus.Fields{
+		"Function": route.resource.parentLambda.lambdaFunctionName(),
+		"Duration": time.Since(startTime).String(),
+	}).Info("Request complete")
+}
+
+// LocalStartAPI is the command that serves the API Gateway resources on
+// localhost. Requests are mapped to in-process lambda invocations with the
+// Sparta request and response mapping templates.
+func LocalStartAPI(serviceName string,
+	api APIGateway,
+	options *LocalStartAPIOptions,
+	logger *logrus.Logger) error {
+
+	if options == nil {
+		return errors.New("LocalStartAPI requires options")
+	}
+	restAPI, restAPIOk := api.(*API)
+	if !restAPIOk || restAPI == nil {
+		return errors.Errorf("Local API emulation requires a REST API created by NewAPIGateway. Found: %T", api)
+	}
+	handler, handlerErr := newLocalAPIHandler(serviceName, restAPI, logger)
+	if handlerErr != nil {
+		return handlerErr
+	}
+	address := net.JoinHostPort(options.Host, strconv.Itoa(options.Port))
+	listener, listenerErr := net.Listen("tcp", address)
+	if listenerErr != nil {
+		return errors.Wrapf(listenerErr, "Failed to listen on: %s", address)
+	}
+	for _, eachRoute := range handler.routes {
+		logger.WithFields(logrus.Fields{
+			"Method": eachRoute.httpMethod,
+			"URL":    fmt.Sprintf("http://%s%s", listener.Addr().String(), eachRoute.pathPart),
+		}).Info("Mounted resource")
+	}
+	server := &http.Server{
+		Handler: handler,
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		logger.Info("Stopping local API")
+		ctx, cancel := context.WithTimeout(context.Background(), localAPIShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	logger.WithField("Address", listener.Addr().String()).Info("Serving local API. Press Ctrl+C to stop.")
+	serveErr := server.Serve(listener)
+	if serveErr == http.ErrServerClosed {
+		return nil
+	}
+	return serveErr
+}
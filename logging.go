@@ -0,0 +1,141 @@
+package sparta
+
+import (
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogEntry is a single structured log entry emitted by Sparta
+type LogEntry struct {
+	// Time is the time the entry was created
+	Time time.Time
+	// Level is the entry severity. One of: trace, debug, info, warning,
+	// error, fatal, panic.
+	Level string
+	// Message is the log message
+	Message string
+	// Fields are the structured key-value pairs associated with the entry
+	Fields map[string]interface{}
+}
+
+// LogBackend is a structured logging destination. When a LogBackend is
+// registered with SetLogBackend, the provisioning and runtime loggers
+// forward every entry to it rather than writing logrus formatted output.
+// The loggers passed to hooks and decorators remain *logrus.Logger values.
+type LogBackend interface {
+	Log(entry *LogEntry)
+}
+
+// LogBackendFunc is an adapter that allows an ordinary function to be
+// used as a LogBackend
+type LogBackendFunc func(entry *LogEntry)
+
+// Log calls the underlying function
+func (backendFunc LogBackendFunc) Log(entry *LogEntry) {
+	backendFunc(entry)
+}
+
+var (
+	logBackendMutex sync.Mutex
+	logBackend      LogBackend
+)
+
+// SetLogBackend registers the LogBackend that receives all entries written
+// by loggers created with NewLogger or NewLoggerWithFormatter, including
+// the request scoped loggers in the AWS Lambda binary. It must be called
+// before sparta.Main. The logger level continues to filter entries.
+func SetLogBackend(backend LogBackend) {
+	logBackendMutex.Lock()
+	defer logBackendMutex.Unlock()
+	logBackend = backend
+}
+
+// registeredLogBackend returns the LogBackend registered via SetLogBackend
+func registeredLogBackend() LogBackend {
+	logBackendMutex.Lock()
+	defer logBackendMutex.Unlock()
+	return logBackend
+}
+
+// sortedLogFieldKeys returns the field names in a stable order
+func sortedLogFieldKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for eachKey := range fields {
+		keys = append(keys, eachKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logBackendHook is the logrus.Hook that forwards entries to a LogBackend
+type logBackendHook struct {
+	backend LogBackend
+}
+
+func (hook *logBackendHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *logBackendHook) Fire(entry *logrus.Entry) error {
+	fields := make(map[string]interface{}, len(entry.Data))
+	for eachKey, eachValue := range entry.Data {
+		fields[eachKey] = eachValue
+	}
+	hook.backend.Log(&LogEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  fields,
+	})
+	return nil
+}
+
+// applyLogBackend routes the logger output to the registered LogBackend,
+// if one exists
+func applyLogBackend(logger *logrus.Logger) *logrus.Logger {
+	backend := registeredLogBackend()
+	if backend == nil {
+		return logger
+	}
+	logger.AddHook(&logBackendHook{backend: backend})
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+// SugaredLogger is the subset of the go.uber.org/zap SugaredLogger
+// methods used by NewSugaredLogBackend. *zap.SugaredLogger satisfies the
+// interface, so Sparta doesn't depend on zap.
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewSugaredLogBackend returns a LogBackend that writes to a zap
+// SugaredLogger (eg, zap.NewProduction().Sugar()). Trace entries are
+// written at the debug level. Fatal and panic entries are written at the
+// error level so that the zap logger doesn't exit or panic; logrus
+// continues to handle those levels.
+func NewSugaredLogBackend(logger SugaredLogger) LogBackend {
+	return LogBackendFunc(func(entry *LogEntry) {
+		keysAndValues := make([]interface{}, 0, 2*len(entry.Fields))
+		for _, eachKey := range sortedLogFieldKeys(entry.Fields) {
+			keysAndValues = append(keysAndValues, eachKey, entry.Fields[eachKey])
+		}
+		switch entry.Level {
+		case logrus.TraceLevel.String(), logrus.DebugLevel.String():
+			logger.Debugw(entry.Message, keysAndValues...)
+		case logrus.InfoLevel.String():
+			logger.Infow(entry.Message, keysAndValues...)
+		case logrus.WarnLevel.String():
+			logger.Warnw(entry.Message, keysAndValues...)
+		default:
+			logger.Errorw(entry.Message, keysAndValues...)
+		}
+	})
+}
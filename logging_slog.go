@@ -0,0 +1,134 @@
+//go:build go1.21
+// +build go1.21
+
+package sparta
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slogLevel returns the slog.Level for a LogEntry level
+func slogLevel(level string) slog.Level {
+	switch level {
+	case logrus.TraceLevel.String():
+		return slog.LevelDebug - 4
+	case logrus.DebugLevel.String():
+		return slog.LevelDebug
+	case logrus.InfoLevel.String():
+		return slog.LevelInfo
+	case logrus.WarnLevel.String():
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// logrusLevel returns the logrus.Level for a slog.Level
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return logrus.TraceLevel
+	case level < slog.LevelInfo:
+		return logrus.DebugLevel
+	case level < slog.LevelWarn:
+		return logrus.InfoLevel
+	case level < slog.LevelError:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
+
+// NewSlogBackend returns a LogBackend that writes to a log/slog Handler
+// (eg, slog.NewJSONHandler(os.Stdout, nil))
+func NewSlogBackend(handler slog.Handler) LogBackend {
+	return LogBackendFunc(func(entry *LogEntry) {
+		level := slogLevel(entry.Level)
+		if !handler.Enabled(context.Background(), level) {
+			return
+		}
+		record := slog.NewRecord(entry.Time, level, entry.Message, 0)
+		for _, eachKey := range sortedLogFieldKeys(entry.Fields) {
+			fieldValue := entry.Fields[eachKey]
+			if fieldErr, fieldErrOk := fieldValue.(error); fieldErrOk {
+				fieldValue = fieldErr.Error()
+			}
+			record.AddAttrs(slog.Any(eachKey, fieldValue))
+		}
+		_ = handler.Handle(context.Background(), record)
+	})
+}
+
+// logrusSlogHandler is a slog.Handler that writes to a logrus.Entry so
+// that slog output shares the destination and request fields of the
+// Sparta logger
+type logrusSlogHandler struct {
+	entry  *logrus.Entry
+	prefix string
+}
+
+func (handler *logrusSlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.entry.Logger.IsLevelEnabled(logrusLevel(level))
+}
+
+func (handler *logrusSlogHandler) fields(attrs []slog.Attr, prefix string, fields logrus.Fields) {
+	for _, eachAttr := range attrs {
+		value := eachAttr.Value.Resolve()
+		if value.Kind() == slog.KindGroup {
+			groupPrefix := prefix
+			if eachAttr.Key != "" {
+				groupPrefix = prefix + eachAttr.Key + "."
+			}
+			handler.fields(value.Group(), groupPrefix, fields)
+			continue
+		}
+		fields[prefix+eachAttr.Key] = value.Any()
+	}
+}
+
+func (handler *logrusSlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(eachAttr slog.Attr) bool {
+		attrs = append(attrs, eachAttr)
+		return true
+	})
+	fields := logrus.Fields{}
+	handler.fields(attrs, handler.prefix, fields)
+	handler.entry.
+		WithTime(record.Time).
+		WithFields(fields).
+		Log(logrusLevel(record.Level), record.Message)
+	return nil
+}
+
+func (handler *logrusSlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := logrus.Fields{}
+	handler.fields(attrs, handler.prefix, fields)
+	return &logrusSlogHandler{
+		entry:  handler.entry.WithFields(fields),
+		prefix: handler.prefix,
+	}
+}
+
+func (handler *logrusSlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	return &logrusSlogHandler{
+		entry:  handler.entry,
+		prefix: handler.prefix + name + ".",
+	}
+}
+
+// Slog returns a *slog.Logger for the request scoped Sparta logger in the
+// context. Entries include the request fields (eg, the AWS request ID)
+// and are written to the same destination, including any LogBackend
+// registered with SetLogBackend.
+func Slog(ctx context.Context) *slog.Logger {
+	return slog.New(&logrusSlogHandler{
+		entry: middlewareLogger(ctx),
+	})
+}
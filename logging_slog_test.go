@@ -0,0 +1,57 @@
+//go:build go1.21
+// +build go1.21
+
+package sparta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSlogBackend(t *testing.T) {
+	output := &bytes.Buffer{}
+	SetLogBackend(NewSlogBackend(slog.NewJSONHandler(output, nil)))
+	defer SetLogBackend(nil)
+
+	logger, _ := NewLogger("info")
+	logger.WithField(LogFieldRequestID, "1234").Error("Failed")
+	var record map[string]interface{}
+	unmarshalErr := json.Unmarshal(output.Bytes(), &record)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal slog output: %s\n%s", unmarshalErr, output.String())
+	}
+	if record["level"] != "ERROR" ||
+		record["msg"] != "Failed" ||
+		record[LogFieldRequestID] != "1234" {
+		t.Fatalf("Unexpected slog record: %s", output.String())
+	}
+}
+
+func TestSlogContextLogger(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = output
+	logger.Formatter = &logrus.JSONFormatter{}
+	ctx := context.WithValue(context.Background(),
+		ContextKeyRequestLogger,
+		logger.WithField(LogFieldRequestID, "1234"))
+
+	Slog(ctx).WithGroup("order").Info("Created", slog.Int("id", 42))
+	Slog(ctx).Debug("Filtered by level")
+	for _, eachExpected := range []string{`"msg":"Created"`,
+		`"order.id":42`,
+		`"reqID":"1234"`} {
+		if !strings.Contains(output.String(), eachExpected) {
+			t.Fatalf("Failed to find %s in slog output: %s", eachExpected, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "Filtered") {
+		t.Fatalf("Expected debug entry to be filtered: %s", output.String())
+	}
+}
@@ -0,0 +1,63 @@
+package sparta
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testSugaredLogger struct {
+	lines []string
+}
+
+func (logger *testSugaredLogger) log(level string, msg string, keysAndValues ...interface{}) {
+	logger.lines = append(logger.lines, fmt.Sprintf("%s %s %v", level, msg, keysAndValues))
+}
+func (logger *testSugaredLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	logger.log("debug", msg, keysAndValues...)
+}
+func (logger *testSugaredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	logger.log("info", msg, keysAndValues...)
+}
+func (logger *testSugaredLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	logger.log("warn", msg, keysAndValues...)
+}
+func (logger *testSugaredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	logger.log("error", msg, keysAndValues...)
+}
+
+func TestLogBackend(t *testing.T) {
+	entries := []*LogEntry{}
+	SetLogBackend(LogBackendFunc(func(entry *LogEntry) {
+		entries = append(entries, entry)
+	}))
+	defer SetLogBackend(nil)
+
+	logger, loggerErr := NewLogger("info")
+	if loggerErr != nil {
+		t.Fatalf("Failed to create logger: %s", loggerErr)
+	}
+	logger.WithField("key", "value").Info("Hello")
+	logger.Debug("Filtered by level")
+	if len(entries) != 1 {
+		t.Fatalf("Expected a single log entry, got: %d", len(entries))
+	}
+	if entries[0].Level != "info" ||
+		entries[0].Message != "Hello" ||
+		entries[0].Fields["key"] != "value" {
+		t.Fatalf("Unexpected log entry: %#v", entries[0])
+	}
+}
+
+func TestSugaredLogBackend(t *testing.T) {
+	sugaredLogger := &testSugaredLogger{}
+	SetLogBackend(NewSugaredLogBackend(sugaredLogger))
+	defer SetLogBackend(nil)
+
+	logger, _ := NewLogger("info")
+	logger.WithField("b", 2).WithField("a", 1).Warn("Careful")
+	if len(sugaredLogger.lines) != 1 ||
+		!strings.HasPrefix(sugaredLogger.lines[0], "warn Careful [a 1 b 2]") {
+		t.Fatalf("Unexpected sugared log output: %#v", sugaredLogger.lines)
+	}
+}
@@ -0,0 +1,268 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetricUnit is the CloudWatch unit of a metric published with the
+// Embedded Metric Format.
+// Ref: https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_MetricDatum.html
+type MetricUnit string
+
+const (
+	// MetricUnitNone is a unitless metric
+	// @enum MetricUnit
+	MetricUnitNone MetricUnit = "None"
+	// MetricUnitCount is a count
+	// @enum MetricUnit
+	MetricUnitCount MetricUnit = "Count"
+	// MetricUnitPercent is a percentage
+	// @enum MetricUnit
+	MetricUnitPercent MetricUnit = "Percent"
+	// MetricUnitSeconds is a duration in seconds
+	// @enum MetricUnit
+	MetricUnitSeconds MetricUnit = "Seconds"
+	// MetricUnitMilliseconds is a duration in milliseconds
+	// @enum MetricUnit
+	MetricUnitMilliseconds MetricUnit = "Milliseconds"
+	// MetricUnitMicroseconds is a duration in microseconds
+	// @enum MetricUnit
+	MetricUnitMicroseconds MetricUnit = "Microseconds"
+	// MetricUnitBytes is a size in bytes
+	// @enum MetricUnit
+	MetricUnitBytes MetricUnit = "Bytes"
+	// MetricUnitKilobytes is a size in kilobytes
+	// @enum MetricUnit
+	MetricUnitKilobytes MetricUnit = "Kilobytes"
+	// MetricUnitMegabytes is a size in megabytes
+	// @enum MetricUnit
+	MetricUnitMegabytes MetricUnit = "Megabytes"
+)
+
+const (
+	// MetricDimensionServiceName is the default EMF dimension that
+	// stores the Sparta service name
+	MetricDimensionServiceName = "ServiceName"
+	// MetricDimensionFunctionName is the default EMF dimension that
+	// stores the AWS Lambda function name
+	MetricDimensionFunctionName = "FunctionName"
+)
+
+const (
+	// emfMaxMetricsPerDocument is the maximum number of metric definitions
+	// in a single EMF directive
+	emfMaxMetricsPerDocument = 100
+	// emfMaxValuesPerMetric is the maximum number of values for a single
+	// metric in an EMF document
+	emfMaxValuesPerMetric = 100
+)
+
+type emfMetric struct {
+	unit   MetricUnit
+	values []float64
+}
+
+// MetricsLogger buffers CloudWatch metrics for a single request and writes
+// them as CloudWatch Embedded Metric Format (EMF) JSON when flushed. In the
+// AWS Lambda binary a MetricsLogger is created for each request and is
+// flushed to stdout when the handler completes.
+// Ref: https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type MetricsLogger struct {
+	mutex       sync.Mutex
+	namespace   string
+	dimensions  map[string]string
+	properties  map[string]interface{}
+	metricNames []string
+	metrics     map[string]*emfMetric
+}
+
+// NewMetricsLogger returns a MetricsLogger that publishes to the given
+// CloudWatch namespace
+func NewMetricsLogger(namespace string) *MetricsLogger {
+	return &MetricsLogger{
+		namespace:  namespace,
+		dimensions: make(map[string]string),
+		properties: make(map[string]interface{}),
+		metrics:    make(map[string]*emfMetric),
+	}
+}
+
+// Metrics returns the request scoped MetricsLogger from the context. If the
+// context doesn't include one (eg, outside of the AWS Lambda binary), a new
+// detached MetricsLogger is returned. Detached metrics are discarded
+// unless they're explicitly flushed.
+func Metrics(ctx context.Context) *MetricsLogger {
+	if metricsLogger, metricsLoggerOk := ctx.Value(ContextKeyMetrics).(*MetricsLogger); metricsLoggerOk {
+		return metricsLogger
+	}
+	return NewMetricsLogger("")
+}
+
+// SetNamespace replaces the CloudWatch namespace for all buffered metrics
+func (ml *MetricsLogger) SetNamespace(namespace string) *MetricsLogger {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.namespace = namespace
+	return ml
+}
+
+// SetDimension adds or updates a dimension that is applied to all buffered
+// metrics
+func (ml *MetricsLogger) SetDimension(key string, value string) *MetricsLogger {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.dimensions[key] = value
+	return ml
+}
+
+// SetProperty adds a property to the EMF document. Properties are
+// searchable in CloudWatch Logs Insights, but aren't published as metrics
+// or dimensions.
+func (ml *MetricsLogger) SetProperty(key string, value interface{}) *MetricsLogger {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	ml.properties[key] = value
+	return ml
+}
+
+// Count records a MetricUnitCount value for the named metric
+func (ml *MetricsLogger) Count(name string, value float64) *MetricsLogger {
+	return ml.Put(name, value, MetricUnitCount)
+}
+
+// Duration records a MetricUnitMilliseconds value for the named metric
+func (ml *MetricsLogger) Duration(name string, value time.Duration) *MetricsLogger {
+	return ml.Put(name,
+		float64(value)/float64(time.Millisecond),
+		MetricUnitMilliseconds)
+}
+
+// Put records a value for the named metric. Multiple values for the same
+// metric are published as separate data points. The unit of the first
+// value is used for the metric.
+func (ml *MetricsLogger) Put(name string, value float64, unit MetricUnit) *MetricsLogger {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	metric, exists := ml.metrics[name]
+	if !exists {
+		metric = &emfMetric{
+			unit: unit,
+		}
+		ml.metrics[name] = metric
+		ml.metricNames = append(ml.metricNames, name)
+	}
+	metric.values = append(metric.values, value)
+	return ml
+}
+
+// documents returns the EMF documents for the buffered metrics. Metrics
+// that exceed the EMF per-document limits are split across documents.
+func (ml *MetricsLogger) documents(timestamp time.Time) []map[string]interface{} {
+	type pendingMetric struct {
+		name   string
+		unit   MetricUnit
+		values []float64
+	}
+	pending := make([]*pendingMetric, 0, len(ml.metricNames))
+	for _, eachName := range ml.metricNames {
+		metric := ml.metrics[eachName]
+		pending = append(pending, &pendingMetric{
+			name:   eachName,
+			unit:   metric.unit,
+			values: metric.values,
+		})
+	}
+
+	documents := make([]map[string]interface{}, 0)
+	for len(pending) != 0 {
+		document := make(map[string]interface{})
+		for eachKey, eachValue := range ml.properties {
+			document[eachKey] = eachValue
+		}
+		for eachKey, eachValue := range ml.dimensions {
+			document[eachKey] = eachValue
+		}
+		metricDefinitions := make([]map[string]interface{}, 0)
+		remaining := make([]*pendingMetric, 0)
+		for _, eachMetric := range pending {
+			if len(metricDefinitions) >= emfMaxMetricsPerDocument {
+				remaining = append(remaining, eachMetric)
+				continue
+			}
+			metricDefinitions = append(metricDefinitions, map[string]interface{}{
+				"Name": eachMetric.name,
+				"Unit": eachMetric.unit,
+			})
+			values := eachMetric.values
+			if len(values) > emfMaxValuesPerMetric {
+				remaining = append(remaining, &pendingMetric{
+					name:   eachMetric.name,
+					unit:   eachMetric.unit,
+					values: values[emfMaxValuesPerMetric:],
+				})
+				values = values[:emfMaxValuesPerMetric]
+			}
+			if len(values) == 1 {
+				document[eachMetric.name] = values[0]
+			} else {
+				document[eachMetric.name] = values
+			}
+		}
+		dimensionKeys := make([]string, 0, len(ml.dimensions))
+		for eachKey := range ml.dimensions {
+			dimensionKeys = append(dimensionKeys, eachKey)
+		}
+		sort.Strings(dimensionKeys)
+		document["_aws"] = map[string]interface{}{
+			"Timestamp": timestamp.UnixNano() / int64(time.Millisecond),
+			"CloudWatchMetrics": []map[string]interface{}{
+				{
+					"Namespace":  ml.namespace,
+					"Dimensions": [][]string{dimensionKeys},
+					"Metrics":    metricDefinitions,
+				},
+			},
+		}
+		documents = append(documents, document)
+		pending = remaining
+	}
+	return documents
+}
+
+// Flush writes the buffered metrics to the writer as newline delimited EMF
+// JSON documents and resets the metric buffer. Dimensions, properties and
+// the namespace are retained.
+func (ml *MetricsLogger) Flush(writer io.Writer) error {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	if len(ml.metricNames) == 0 {
+		return nil
+	}
+	if ml.namespace == "" {
+		return errors.Errorf("MetricsLogger namespace must not be empty")
+	}
+	documents := ml.documents(time.Now())
+	ml.metricNames = nil
+	ml.metrics = make(map[string]*emfMetric)
+
+	for _, eachDocument := range documents {
+		jsonBytes, jsonBytesErr := json.Marshal(eachDocument)
+		if jsonBytesErr != nil {
+			return errors.Wrapf(jsonBytesErr, "Failed to marshal EMF document")
+		}
+		_, writeErr := fmt.Fprintln(writer, string(jsonBytes))
+		if writeErr != nil {
+			return errors.Wrapf(writeErr, "Failed to write EMF document")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxMetricDataQueries is the maximum number of queries per
+// GetMetricData request
+const maxMetricDataQueries = 500
+
+// functionMetricStat is a Lambda metric statistic included in the report
+type functionMetricStat struct {
+	id         string
+	metricName string
+	stat       string
+}
+
+var functionMetricStats = []functionMetricStat{
+	{"invocations", "Invocations", "Sum"},
+	{"errors", "Errors", "Sum"},
+	{"throttles", "Throttles", "Sum"},
+	{"p50", "Duration", "p50"},
+	{"p90", "Duration", "p90"},
+	{"p99", "Duration", "p99"},
+	{"concurrency", "ConcurrentExecutions", "Maximum"},
+}
+
+// FunctionMetrics is the performance summary of a provisioned Lambda
+// function over the report window
+type FunctionMetrics struct {
+	LogicalResourceID       string  `json:"logicalResourceId"`
+	FunctionName            string  `json:"functionName"`
+	Invocations             float64 `json:"invocations"`
+	Errors                  float64 `json:"errors"`
+	Throttles               float64 `json:"throttles"`
+	ErrorRate               float64 `json:"errorRate"`
+	DurationP50             float64 `json:"durationP50"`
+	DurationP90             float64 `json:"durationP90"`
+	DurationP99             float64 `json:"durationP99"`
+	MaxConcurrentExecutions float64 `json:"maxConcurrentExecutions"`
+}
+
+// stackLambdaFunctions returns the map of physical function names to
+// logical resource IDs in the stack and its nested stacks
+func stackLambdaFunctions(cfSvc cloudformationiface.CloudFormationAPI,
+	stackName string,
+	functions map[string]string) error {
+
+	nestedStacks := []string{}
+	input := &cloudformation.ListStackResourcesInput{
+		StackName: aws.String(stackName),
+	}
+	listErr := cfSvc.ListStackResourcesPages(input,
+		func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+			for _, eachSummary := range page.StackResourceSummaries {
+				if eachSummary.PhysicalResourceId == nil {
+					continue
+				}
+				switch *eachSummary.ResourceType {
+				case "AWS::Lambda::Function":
+					functions[*eachSummary.PhysicalResourceId] = *eachSummary.LogicalResourceId
+				case "AWS::CloudFormation::Stack":
+					nestedStacks = append(nestedStacks, *eachSummary.PhysicalResourceId)
+				}
+			}
+			return true
+		})
+	if listErr != nil {
+		return errors.Wrapf(listErr, "Failed to list resources for stack: %s", stackName)
+	}
+	for _, eachNestedStack := range nestedStacks {
+		nestedErr := stackLambdaFunctions(cfSvc, eachNestedStack, functions)
+		if nestedErr != nil {
+			return nestedErr
+		}
+	}
+	return nil
+}
+
+// functionMetricQueries returns the GetMetricData queries for the functions.
+// The query IDs are of the form `f<functionIndex>_<statID>`
+func functionMetricQueries(functionNames []string, window time.Duration) []*cloudwatch.MetricDataQuery {
+	// The period must be a multiple of 60
+	period := int64(math.Ceil(window.Minutes())) * 60
+	queries := make([]*cloudwatch.MetricDataQuery, 0, len(functionNames)*len(functionMetricStats))
+	for eachIndex, eachFunctionName := range functionNames {
+		for _, eachStat := range functionMetricStats {
+			queries = append(queries, &cloudwatch.MetricDataQuery{
+				Id: aws.String(fmt.Sprintf("f%d_%s", eachIndex, eachStat.id)),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String("AWS/Lambda"),
+						MetricName: aws.String(eachStat.metricName),
+						Dimensions: []*cloudwatch.Dimension{
+							{
+								Name:  aws.String("FunctionName"),
+								Value: aws.String(eachFunctionName),
+							},
+						},
+					},
+					Period: aws.Int64(period),
+					Stat:   aws.String(eachStat.stat),
+				},
+				ReturnData: aws.Bool(true),
+			})
+		}
+	}
+	return queries
+}
+
+// summarizeFunctionMetrics returns the FunctionMetrics for the query results.
+// The window may span more than one period, so Sum statistics are totaled and
+// the remaining statistics use the largest value.
+func summarizeFunctionMetrics(functionNames []string,
+	functions map[string]string,
+	results []*cloudwatch.MetricDataResult) []*FunctionMetrics {
+
+	sumStats := make(map[string]bool)
+	for _, eachStat := range functionMetricStats {
+		sumStats[eachStat.id] = eachStat.stat == "Sum"
+	}
+	values := make(map[string]float64)
+	for _, eachResult := range results {
+		resultID := *eachResult.Id
+		statID := resultID[strings.Index(resultID, "_")+1:]
+		for _, eachValue := range eachResult.Values {
+			if sumStats[statID] {
+				values[resultID] += *eachValue
+			} else {
+				values[resultID] = math.Max(values[resultID], *eachValue)
+			}
+		}
+	}
+	summaries := make([]*FunctionMetrics, 0, len(functionNames))
+	for eachIndex, eachFunctionName := range functionNames {
+		value := func(statID string) float64 {
+			return values[fmt.Sprintf("f%d_%s", eachIndex, statID)]
+		}
+		summary := &FunctionMetrics{
+			LogicalResourceID:       functions[eachFunctionName],
+			FunctionName:            eachFunctionName,
+			Invocations:             value("invocations"),
+			Errors:                  value("errors"),
+			Throttles:               value("throttles"),
+			DurationP50:             value("p50"),
+			DurationP90:             value("p90"),
+			DurationP99:             value("p99"),
+			MaxConcurrentExecutions: value("concurrency"),
+		}
+		if summary.Invocations != 0 {
+			summary.ErrorRate = summary.Errors / summary.Invocations
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// writeFunctionMetrics writes the summaries in the given format
+func writeFunctionMetrics(summaries []*FunctionMetrics,
+	outputFormat string,
+	writer io.Writer) error {
+
+	switch outputFormat {
+	case MetricsFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", " ")
+		return encoder.Encode(summaries)
+	case MetricsFormatTable, "":
+		tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tableWriter, "Function\tInvocations\tErrors\tError %\tThrottles\tp50 (ms)\tp90 (ms)\tp99 (ms)\tMax Concurrency\t")
+		for _, eachSummary := range summaries {
+			fmt.Fprintf(tableWriter, "%s\t%.0f\t%.0f\t%.2f\t%.0f\t%.1f\t%.1f\t%.1f\t%.0f\t\n",
+				eachSummary.LogicalResourceID,
+				eachSummary.Invocations,
+				eachSummary.Errors,
+				eachSummary.ErrorRate*100,
+				eachSummary.Throttles,
+				eachSummary.DurationP50,
+				eachSummary.DurationP90,
+				eachSummary.DurationP99,
+				eachSummary.MaxConcurrentExecutions)
+		}
+		return tableWriter.Flush()
+	default:
+		return errors.Errorf("Unsupported metrics format: %s", outputFormat)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Public
+//
+
+// MetricsReport queries CloudWatch for the invocation, error, throttle,
+// duration and concurrency metrics of each Lambda function in the
+// provisioned stack over the given window and writes the summary to stdout
+// as either a table or JSON.
+func MetricsReport(serviceName string,
+	serviceDescription string,
+	window time.Duration,
+	outputFormat string,
+	logger *logrus.Logger) error {
+
+	if window < time.Minute {
+		return errors.Errorf("Metrics window must be at least 1 minute. Found: %s", window)
+	}
+	awsSession := newWorkflowSession("", logger)
+	awsClients := newAWSClients(awsSession, nil)
+	functions := make(map[string]string)
+	functionsErr := stackLambdaFunctions(awsClients.CloudFormation,
+		serviceName,
+		functions)
+	if functionsErr != nil {
+		return functionsErr
+	}
+	functionNames := make([]string, 0, len(functions))
+	for eachFunctionName := range functions {
+		functionNames = append(functionNames, eachFunctionName)
+	}
+	sort.Slice(functionNames, func(i, j int) bool {
+		return functions[functionNames[i]] < functions[functionNames[j]]
+	})
+	logger.WithFields(logrus.Fields{
+		"FunctionCount": len(functionNames),
+		"Window":        window.String(),
+	}).Info("Querying function metrics")
+
+	endTime := time.Now().UTC().Truncate(time.Minute)
+	startTime := endTime.Add(-window)
+	cwSvc := cloudwatch.New(awsSession)
+	queries := functionMetricQueries(functionNames, window)
+	results := []*cloudwatch.MetricDataResult{}
+	for len(queries) != 0 {
+		batchSize := len(queries)
+		if batchSize > maxMetricDataQueries {
+			batchSize = maxMetricDataQueries
+		}
+		input := &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries[0:batchSize],
+			StartTime:         aws.Time(startTime),
+			EndTime:           aws.Time(endTime),
+		}
+		pagesErr := cwSvc.GetMetricDataPages(input,
+			func(page *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+				results = append(results, page.MetricDataResults...)
+				return true
+			})
+		if pagesErr != nil {
+			return errors.Wrapf(pagesErr, "Failed to query function metrics")
+		}
+		queries = queries[batchSize:]
+	}
+	return writeFunctionMetrics(summarizeFunctionMetrics(functionNames, functions, results),
+		outputFormat,
+		os.Stdout)
+}
@@ -0,0 +1,63 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+func TestMetricsReport(t *testing.T) {
+	functionNames := []string{"MyService-HelloWorld", "MyService-Goodbye"}
+	functions := map[string]string{
+		"MyService-HelloWorld": "HelloWorldLambda",
+		"MyService-Goodbye":    "GoodbyeLambda",
+	}
+	queries := functionMetricQueries(functionNames, 90*time.Second)
+	if len(queries) != len(functionNames)*len(functionMetricStats) {
+		t.Fatalf("Unexpected query count: %d", len(queries))
+	}
+	if *queries[0].MetricStat.Period != 120 {
+		t.Fatalf("Failed to round period to multiple of 60: %d", *queries[0].MetricStat.Period)
+	}
+
+	// Sum statistics are totaled across periods, others use the maximum
+	results := []*cloudwatch.MetricDataResult{
+		{Id: aws.String("f0_invocations"), Values: aws.Float64Slice([]float64{10, 30})},
+		{Id: aws.String("f0_errors"), Values: aws.Float64Slice([]float64{1, 1})},
+		{Id: aws.String("f0_p99"), Values: aws.Float64Slice([]float64{250, 100})},
+		{Id: aws.String("f1_concurrency"), Values: aws.Float64Slice([]float64{2, 5})},
+	}
+	summaries := summarizeFunctionMetrics(functionNames, functions, results)
+	if summaries[0].Invocations != 40 ||
+		summaries[0].ErrorRate != 0.05 ||
+		summaries[0].DurationP99 != 250 ||
+		summaries[1].MaxConcurrentExecutions != 5 ||
+		summaries[1].LogicalResourceID != "GoodbyeLambda" {
+		t.Fatalf("Unexpected metrics summary: %#v", summaries)
+	}
+
+	var tableOutput bytes.Buffer
+	writeErr := writeFunctionMetrics(summaries, MetricsFormatTable, &tableOutput)
+	if writeErr != nil || !strings.Contains(tableOutput.String(), "HelloWorldLambda") {
+		t.Fatalf("Failed to write metrics table: %v", writeErr)
+	}
+	var jsonOutput bytes.Buffer
+	writeErr = writeFunctionMetrics(summaries, MetricsFormatJSON, &jsonOutput)
+	if writeErr != nil {
+		t.Fatalf("Failed to write metrics JSON: %s", writeErr)
+	}
+	var decoded []*FunctionMetrics
+	if json.Unmarshal(jsonOutput.Bytes(), &decoded) != nil || len(decoded) != 2 {
+		t.Fatalf("Failed to decode metrics JSON: %s", jsonOutput.String())
+	}
+	if writeFunctionMetrics(summaries, "csv", &jsonOutput) == nil {
+		t.Fatalf("Failed to reject unsupported metrics format")
+	}
+}
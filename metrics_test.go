@@ -0,0 +1,80 @@
+package sparta
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestMetricsLoggerFlush(t *testing.T) {
+	metricsLogger := NewMetricsLogger("MyService").
+		SetDimension(MetricDimensionServiceName, "MyService").
+		SetDimension(MetricDimensionFunctionName, "MyService_Hello").
+		SetProperty(LogFieldRequestID, "1234")
+	ctx := context.WithValue(context.Background(), ContextKeyMetrics, metricsLogger)
+	Metrics(ctx).Count("orders", 1)
+	Metrics(ctx).Count("orders", 2)
+	Metrics(ctx).Put("payload", 128, MetricUnitBytes)
+
+	output := &bytes.Buffer{}
+	flushErr := metricsLogger.Flush(output)
+	if flushErr != nil {
+		t.Fatalf("Failed to flush metrics: %s", flushErr)
+	}
+	var document map[string]interface{}
+	unmarshalErr := json.Unmarshal(output.Bytes(), &document)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal EMF document: %s\n%s", unmarshalErr, output.String())
+	}
+	if document[MetricDimensionFunctionName] != "MyService_Hello" ||
+		document[LogFieldRequestID] != "1234" ||
+		document["payload"] != float64(128) {
+		t.Fatalf("Unexpected EMF document: %s", output.String())
+	}
+	orders, ordersOk := document["orders"].([]interface{})
+	if !ordersOk || len(orders) != 2 {
+		t.Fatalf("Expected two orders values: %s", output.String())
+	}
+	directive := document["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	if directive["Namespace"] != "MyService" ||
+		len(directive["Metrics"].([]interface{})) != 2 ||
+		len(directive["Dimensions"].([]interface{})[0].([]interface{})) != 2 {
+		t.Fatalf("Unexpected EMF directive: %#v", directive)
+	}
+
+	// Metrics are reset after a flush
+	output.Reset()
+	flushErr = metricsLogger.Flush(output)
+	if flushErr != nil || output.Len() != 0 {
+		t.Fatalf("Expected empty flush, got: %s (%v)", output.String(), flushErr)
+	}
+}
+
+func TestMetricsLoggerLimits(t *testing.T) {
+	metricsLogger := NewMetricsLogger("MyService")
+	for i := 0; i != emfMaxValuesPerMetric+1; i++ {
+		metricsLogger.Count("requests", 1)
+	}
+	output := &bytes.Buffer{}
+	flushErr := metricsLogger.Flush(output)
+	if flushErr != nil {
+		t.Fatalf("Failed to flush metrics: %s", flushErr)
+	}
+	documentCount := 0
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		documentCount++
+	}
+	if documentCount != 2 {
+		t.Fatalf("Expected 2 EMF documents, got: %d", documentCount)
+	}
+}
+
+func TestMetricsDetached(t *testing.T) {
+	metricsLogger := Metrics(context.Background()).Count("orders", 1)
+	if metricsLogger.Flush(&bytes.Buffer{}) == nil {
+		t.Fatalf("Expected error flushing metrics without a namespace")
+	}
+}
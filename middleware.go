@@ -0,0 +1,142 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LambdaHandler is the normalized signature of a dispatched lambda handler.
+// Every user function, regardless of its declared signature, is adapted
+// to this type before the middleware chain is applied.
+type LambdaHandler func(ctx context.Context, msg json.RawMessage) (interface{}, error)
+
+// HandlerMiddleware wraps a LambdaHandler with cross-cutting behavior. The
+// middleware is responsible for calling next (or not) and may inspect or
+// replace both the response and error.
+type HandlerMiddleware func(next LambdaHandler) LambdaHandler
+
+var (
+	handlerMiddlewareMutex sync.Mutex
+	handlerMiddlewareChain []HandlerMiddleware
+)
+
+// Use registers one or more HandlerMiddleware functions that are applied
+// around every dispatched lambda handler in the lambdabinary execution path.
+// Middleware is applied in registration order: the first registered middleware
+// is the outermost and observes the final response and error. Use should be
+// called before sparta.Main.
+func Use(middleware ...HandlerMiddleware) {
+	handlerMiddlewareMutex.Lock()
+	defer handlerMiddlewareMutex.Unlock()
+	for _, eachMiddleware := range middleware {
+		if eachMiddleware != nil {
+			handlerMiddlewareChain = append(handlerMiddlewareChain, eachMiddleware)
+		}
+	}
+}
+
+// registeredHandlerMiddleware returns a snapshot of the middleware registered
+// via Use
+func registeredHandlerMiddleware() []HandlerMiddleware {
+	handlerMiddlewareMutex.Lock()
+	defer handlerMiddlewareMutex.Unlock()
+	snapshot := make([]HandlerMiddleware, len(handlerMiddlewareChain))
+	copy(snapshot, handlerMiddlewareChain)
+	return snapshot
+}
+
+// applyHandlerMiddleware wraps the handler so that middleware[0] is the
+// outermost call
+func applyHandlerMiddleware(handler LambdaHandler,
+	middleware []HandlerMiddleware) LambdaHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// middlewareLogger returns the request scoped logger if one is available
+func middlewareLogger(ctx context.Context) *logrus.Entry {
+	if entry, entryOk := ctx.Value(ContextKeyRequestLogger).(*logrus.Entry); entryOk {
+		return entry
+	}
+	if logger, loggerOk := ctx.Value(ContextKeyLogger).(*logrus.Logger); loggerOk {
+		return logrus.NewEntry(logger)
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// RecoveryMiddleware returns a HandlerMiddleware that recovers from a panic
+// in the downstream handler, logs the stack trace, and returns the panic
+// value as an error so that the invocation fails rather than the process.
+func RecoveryMiddleware() HandlerMiddleware {
+	return func(next LambdaHandler) LambdaHandler {
+		return func(ctx context.Context, msg json.RawMessage) (response interface{}, err error) {
+			defer func() {
+				if panicValue := recover(); panicValue != nil {
+					middlewareLogger(ctx).WithFields(logrus.Fields{
+						"panic": panicValue,
+						"stack": string(debug.Stack()),
+					}).Error("Recovered from lambda handler panic")
+					response = nil
+					err = errors.Errorf("lambda handler panic: %v", panicValue)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// RequestLoggingMiddleware returns a HandlerMiddleware that logs the start
+// and completion of every request at the given level, including the
+// request duration and any returned error.
+func RequestLoggingMiddleware(level logrus.Level) HandlerMiddleware {
+	return func(next LambdaHandler) LambdaHandler {
+		return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+			logger := middlewareLogger(ctx)
+			logger.WithField("size", len(msg)).Log(level, "Request started")
+			startTime := time.Now()
+			response, err := next(ctx, msg)
+			completeEntry := logger.WithField("duration", time.Since(startTime).String())
+			if err != nil {
+				completeEntry.WithError(err).Log(level, "Request failed")
+			} else {
+				completeEntry.Log(level, "Request completed")
+			}
+			return response, err
+		}
+	}
+}
+
+// TimeoutWarningMiddleware returns a HandlerMiddleware that logs a warning
+// if the handler is still running when less than threshold time remains
+// before the invocation deadline. Requests without a context deadline
+// are not monitored.
+func TimeoutWarningMiddleware(threshold time.Duration) HandlerMiddleware {
+	return func(next LambdaHandler) LambdaHandler {
+		return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+			deadline, deadlineOk := ctx.Deadline()
+			if !deadlineOk {
+				return next(ctx, msg)
+			}
+			warningDelay := time.Until(deadline) - threshold
+			if warningDelay < 0 {
+				warningDelay = 0
+			}
+			timer := time.AfterFunc(warningDelay, func() {
+				middlewareLogger(ctx).WithFields(logrus.Fields{
+					"remaining": time.Until(deadline).String(),
+					"threshold": threshold.String(),
+				}).Warn("Lambda handler is approaching its timeout")
+			})
+			defer timer.Stop()
+			return next(ctx, msg)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sparta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandlerMiddlewareOrder(t *testing.T) {
+	calls := []string{}
+	tracingMiddleware := func(name string) HandlerMiddleware {
+		return func(next LambdaHandler) LambdaHandler {
+			return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+				calls = append(calls, name+":before")
+				response, err := next(ctx, msg)
+				calls = append(calls, name+":after")
+				return response, err
+			}
+		}
+	}
+	handler := applyHandlerMiddleware(func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		calls = append(calls, "handler")
+		return "ok", nil
+	}, []HandlerMiddleware{tracingMiddleware("outer"), tracingMiddleware("inner")})
+
+	response, err := handler(context.Background(), json.RawMessage(`{}`))
+	if err != nil || response != "ok" {
+		t.Fatalf("Unexpected result: %v, %v", response, err)
+	}
+	expected := "outer:before,inner:before,handler,inner:after,outer:after"
+	if strings.Join(calls, ",") != expected {
+		t.Fatalf("Unexpected middleware order: %#v", calls)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	logger, _ := NewLogger("panic")
+	ctx := context.WithValue(context.Background(), ContextKeyLogger, logger)
+	handler := applyHandlerMiddleware(func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		panic("boom")
+	}, []HandlerMiddleware{RecoveryMiddleware()})
+
+	response, err := handler(ctx, json.RawMessage(`{}`))
+	if response != nil {
+		t.Fatalf("Expected nil response after panic, got: %v", response)
+	}
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Expected panic to be returned as an error, got: %v", err)
+	}
+}
+
+func TestTimeoutWarningMiddleware(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = output
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx = context.WithValue(ctx, ContextKeyRequestLogger, logrus.NewEntry(logger))
+
+	handler := applyHandlerMiddleware(func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		time.Sleep(75 * time.Millisecond)
+		return nil, nil
+	}, []HandlerMiddleware{TimeoutWarningMiddleware(50 * time.Millisecond)})
+	_, err := handler(ctx, json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(output.String(), "approaching its timeout") {
+		t.Fatalf("Expected timeout warning, got: %s", output.String())
+	}
+}
@@ -0,0 +1,505 @@
+package sparta
+
+import (
+	"bytes"
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-xray-sdk-go/header"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OpenTelemetryDefaultEndpoint is the OTLP/HTTP endpoint exposed by the
+	// AWS Distro for OpenTelemetry (ADOT) collector Lambda layer
+	OpenTelemetryDefaultEndpoint = "http://localhost:4318"
+	// OpenTelemetryScopeName is the instrumentation scope of Sparta
+	// emitted spans and metrics
+	OpenTelemetryScopeName = "github.com/mweagle/Sparta"
+)
+
+// OpenTelemetry span kinds and status codes
+// Ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	otelSpanKindInternal = 1
+	otelSpanKindServer   = 2
+	otelStatusCodeOK     = 1
+	otelStatusCodeError  = 2
+	// otelTemporalityDelta is the AGGREGATION_TEMPORALITY_DELTA value
+	otelTemporalityDelta = 1
+)
+
+// OpenTelemetryOptions configures the OTLP/HTTP export of spans and metrics
+type OpenTelemetryOptions struct {
+	// Endpoint is the OTLP/HTTP base URL. Defaults to the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable, then to
+	// OpenTelemetryDefaultEndpoint.
+	Endpoint string
+	// Headers are additional HTTP headers (eg, API keys) sent with
+	// each export request
+	Headers map[string]string
+	// ServiceName is the service.name resource attribute. Defaults to the
+	// OTEL_SERVICE_NAME environment variable, then to the function name.
+	ServiceName string
+	// ResourceAttributes are additional resource attributes
+	ResourceAttributes map[string]string
+	// Timeout is the maximum duration of an export request. Defaults
+	// to 2 seconds.
+	Timeout time.Duration
+	// DisableMetrics disables the invocation metrics
+	DisableMetrics bool
+}
+
+func (options *OpenTelemetryOptions) endpoint() string {
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = OpenTelemetryDefaultEndpoint
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// ADOTCollectorLayerArn returns the ARN of the AWS Distro for OpenTelemetry
+// collector layer for the stack's region. The version is the layer name
+// suffix and version (eg, "ver-0-90-1:1").
+// Ref: https://aws-otel.github.io/docs/getting-started/lambda/lambda-go
+func ADOTCollectorLayerArn(version string) gocf.Stringable {
+	return gocf.Join("",
+		gocf.String("arn:aws:lambda:"),
+		gocf.Ref("AWS::Region"),
+		gocf.String(":901920570463:layer:aws-otel-collector-amd64-"),
+		gocf.String(version))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START - otelSpan
+//
+
+// otelSpan is a completed span that's exported using OTLP
+type otelSpan struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+	name         string
+	kind         int
+	start        time.Time
+	end          time.Time
+	attributes   map[string]interface{}
+	err          error
+}
+
+func (span *otelSpan) otlp() map[string]interface{} {
+	status := map[string]interface{}{
+		"code": otelStatusCodeOK,
+	}
+	if span.err != nil {
+		status = map[string]interface{}{
+			"code":    otelStatusCodeError,
+			"message": span.err.Error(),
+		}
+	}
+	otlpSpan := map[string]interface{}{
+		"traceId":           span.traceID,
+		"spanId":            span.spanID,
+		"name":              span.name,
+		"kind":              span.kind,
+		"startTimeUnixNano": fmt.Sprintf("%d", span.start.UnixNano()),
+		"endTimeUnixNano":   fmt.Sprintf("%d", span.end.UnixNano()),
+		"attributes":        otlpAttributes(span.attributes),
+		"status":            status,
+	}
+	if span.parentSpanID != "" {
+		otlpSpan["parentSpanId"] = span.parentSpanID
+	}
+	return otlpSpan
+}
+
+// otelRandomID returns a random hex encoded ID of the given byte length
+func otelRandomID(byteLength int) string {
+	randomBytes := make([]byte, byteLength)
+	_, readErr := cryptoRand.Read(randomBytes)
+	if readErr != nil {
+		// Fallback to a time based value, which is still unique
+		// enough for tracing
+		return fmt.Sprintf("%0*x", byteLength*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(randomBytes)
+}
+
+// otelTraceContext returns the trace and parent span IDs from an X-Ray
+// trace header. X-Ray trace IDs are valid W3C trace IDs once the version
+// and delimiters are removed, which correlates OTel spans with X-Ray.
+func otelTraceContext(traceHeader string) (string, string) {
+	if traceHeader == "" {
+		return otelRandomID(16), ""
+	}
+	xrayHeader := header.FromString(traceHeader)
+	traceID := strings.Replace(strings.TrimPrefix(xrayHeader.TraceID, "1-"), "-", "", -1)
+	if len(traceID) != 32 {
+		return otelRandomID(16), ""
+	}
+	return traceID, xrayHeader.ParentID
+}
+
+// otlpAttributes converts the attributes to a sorted list of OTLP KeyValue
+// entries
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attributes))
+	for eachKey := range attributes {
+		keys = append(keys, eachKey)
+	}
+	sort.Strings(keys)
+	otlpValues := make([]map[string]interface{}, 0, len(keys))
+	for _, eachKey := range keys {
+		var value map[string]interface{}
+		switch typedValue := attributes[eachKey].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": typedValue}
+		case int:
+			value = map[string]interface{}{"intValue": fmt.Sprintf("%d", typedValue)}
+		case int64:
+			value = map[string]interface{}{"intValue": fmt.Sprintf("%d", typedValue)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": typedValue}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprintf("%v", typedValue)}
+		}
+		otlpValues = append(otlpValues, map[string]interface{}{
+			"key":   eachKey,
+			"value": value,
+		})
+	}
+	return otlpValues
+}
+
+//
+// END - otelSpan
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - otlpExporter
+//
+
+// otlpExporter publishes spans and metrics to an OTLP/HTTP endpoint
+// using the JSON protobuf encoding
+type otlpExporter struct {
+	endpoint   string
+	headers    map[string]string
+	resource   map[string]interface{}
+	httpClient *http.Client
+}
+
+func newOTLPExporter(options *OpenTelemetryOptions,
+	serviceName string) *otlpExporter {
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	resourceAttributes := map[string]interface{}{
+		"service.name":           serviceName,
+		"telemetry.sdk.name":     ProperName,
+		"telemetry.sdk.language": "go",
+		"telemetry.sdk.version":  SpartaVersion,
+	}
+	for eachKey, eachValue := range options.ResourceAttributes {
+		resourceAttributes[eachKey] = eachValue
+	}
+	return &otlpExporter{
+		endpoint: options.endpoint(),
+		headers:  options.Headers,
+		resource: map[string]interface{}{
+			"attributes": otlpAttributes(resourceAttributes),
+		},
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (exporter *otlpExporter) post(ctx context.Context,
+	path string,
+	payload interface{}) error {
+	body, bodyErr := json.Marshal(payload)
+	if bodyErr != nil {
+		return errors.Wrapf(bodyErr, "Failed to marshal OTLP payload")
+	}
+	request, requestErr := http.NewRequest(http.MethodPost,
+		exporter.endpoint+path,
+		bytes.NewReader(body))
+	if requestErr != nil {
+		return errors.Wrapf(requestErr, "Failed to create OTLP request")
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	for eachKey, eachValue := range exporter.headers {
+		request.Header.Set(eachKey, eachValue)
+	}
+	response, responseErr := exporter.httpClient.Do(request)
+	if responseErr != nil {
+		return errors.Wrapf(responseErr, "Failed to export OTLP data to %s", exporter.endpoint+path)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.Errorf("OTLP export to %s failed with status: %s",
+			exporter.endpoint+path,
+			response.Status)
+	}
+	return nil
+}
+
+// exportSpans publishes the spans to the /v1/traces endpoint
+func (exporter *otlpExporter) exportSpans(ctx context.Context, spans []*otelSpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, eachSpan := range spans {
+		otlpSpans = append(otlpSpans, eachSpan.otlp())
+	}
+	return exporter.post(ctx, "/v1/traces", map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{
+			{
+				"resource": exporter.resource,
+				"scopeSpans": []map[string]interface{}{
+					{
+						"scope": map[string]interface{}{
+							"name":    OpenTelemetryScopeName,
+							"version": SpartaVersion,
+						},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	})
+}
+
+// exportMetrics publishes the OTLP metric definitions to the
+// /v1/metrics endpoint
+func (exporter *otlpExporter) exportMetrics(ctx context.Context, metrics []map[string]interface{}) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return exporter.post(ctx, "/v1/metrics", map[string]interface{}{
+		"resourceMetrics": []map[string]interface{}{
+			{
+				"resource": exporter.resource,
+				"scopeMetrics": []map[string]interface{}{
+					{
+						"scope": map[string]interface{}{
+							"name":    OpenTelemetryScopeName,
+							"version": SpartaVersion,
+						},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	})
+}
+
+//
+// END - otlpExporter
+////////////////////////////////////////////////////////////////////////////////
+
+////////////////////////////////////////////////////////////////////////////////
+// START - OpenTelemetryMiddleware
+//
+
+type otelContextKey int
+
+const (
+	otelContextKeySpan otelContextKey = iota
+	otelContextKeyRecorder
+)
+
+// otelRecorder collects the spans completed during a single invocation
+type otelRecorder struct {
+	mutex sync.Mutex
+	spans []*otelSpan
+}
+
+func (recorder *otelRecorder) record(span *otelSpan) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.spans = append(recorder.spans, span)
+}
+
+// otelColdStart is nonzero after the first invocation
+var otelColdStart int32
+
+// OpenTelemetrySpan runs fn inside a new OpenTelemetry span that is a child
+// of the invocation span created by OpenTelemetryMiddleware. The span
+// records the error returned by fn. If the context doesn't include an
+// invocation span, fn is called directly.
+func OpenTelemetrySpan(ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error) error {
+	parentSpan, parentSpanOk := ctx.Value(otelContextKeySpan).(*otelSpan)
+	recorder, recorderOk := ctx.Value(otelContextKeyRecorder).(*otelRecorder)
+	if !parentSpanOk || !recorderOk {
+		return fn(ctx)
+	}
+	span := &otelSpan{
+		traceID:      parentSpan.traceID,
+		spanID:       otelRandomID(8),
+		parentSpanID: parentSpan.spanID,
+		name:         name,
+		kind:         otelSpanKindInternal,
+		start:        time.Now(),
+		attributes:   map[string]interface{}{},
+	}
+	defer recorder.record(span)
+	span.err = fn(context.WithValue(ctx, otelContextKeySpan, span))
+	span.end = time.Now()
+	return span.err
+}
+
+// otelInvocationMetrics returns the OTLP metrics for a single invocation
+func otelInvocationMetrics(span *otelSpan) []map[string]interface{} {
+	startTime := fmt.Sprintf("%d", span.start.UnixNano())
+	endTime := fmt.Sprintf("%d", span.end.UnixNano())
+	attributes := otlpAttributes(map[string]interface{}{
+		"faas.name": span.attributes["faas.name"],
+	})
+	counter := func(name string, value int) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name,
+			"unit": "{invocation}",
+			"sum": map[string]interface{}{
+				"aggregationTemporality": otelTemporalityDelta,
+				"isMonotonic":            true,
+				"dataPoints": []map[string]interface{}{
+					{
+						"startTimeUnixNano": startTime,
+						"timeUnixNano":      endTime,
+						"asInt":             fmt.Sprintf("%d", value),
+						"attributes":        attributes,
+					},
+				},
+			},
+		}
+	}
+	errorCount := 0
+	if span.err != nil {
+		errorCount = 1
+	}
+	durationMS := float64(span.end.Sub(span.start)) / float64(time.Millisecond)
+	return []map[string]interface{}{
+		counter("faas.invocations", 1),
+		counter("faas.errors", errorCount),
+		{
+			"name": "faas.invoke_duration",
+			"unit": "ms",
+			"histogram": map[string]interface{}{
+				"aggregationTemporality": otelTemporalityDelta,
+				"dataPoints": []map[string]interface{}{
+					{
+						"startTimeUnixNano": startTime,
+						"timeUnixNano":      endTime,
+						"count":             "1",
+						"sum":               durationMS,
+						"bucketCounts":      []string{"1"},
+						"explicitBounds":    []float64{},
+						"attributes":        attributes,
+					},
+				},
+			},
+		},
+	}
+}
+
+// OpenTelemetryMiddleware returns a HandlerMiddleware that records each
+// invocation as an OpenTelemetry server span, together with invocation
+// count, error and duration metrics, and exports them using OTLP/HTTP
+// before the handler returns. Use ADOTCollectorLayerArn to add the ADOT
+// collector layer that receives the data at OpenTelemetryDefaultEndpoint.
+// The trace ID is derived from the X-Ray trace header, if available.
+func OpenTelemetryMiddleware(options *OpenTelemetryOptions) HandlerMiddleware {
+	if options == nil {
+		options = &OpenTelemetryOptions{}
+	}
+	var exporter *otlpExporter
+	var exporterOnce sync.Once
+
+	return func(next LambdaHandler) LambdaHandler {
+		return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+			functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+			exporterOnce.Do(func() {
+				serviceName := options.ServiceName
+				if serviceName == "" {
+					serviceName = os.Getenv("OTEL_SERVICE_NAME")
+				}
+				if serviceName == "" {
+					serviceName = functionName
+				}
+				exporter = newOTLPExporter(options, serviceName)
+			})
+			traceHeader, _ := ctx.Value(lambdaTraceIDContextKey).(string)
+			traceID, parentSpanID := otelTraceContext(traceHeader)
+
+			span := &otelSpan{
+				traceID:      traceID,
+				spanID:       otelRandomID(8),
+				parentSpanID: parentSpanID,
+				name:         functionName,
+				kind:         otelSpanKindServer,
+				start:        time.Now(),
+				attributes: map[string]interface{}{
+					"cloud.provider":  "aws",
+					"cloud.region":    os.Getenv("AWS_REGION"),
+					"faas.name":       functionName,
+					"faas.version":    os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+					"faas.coldstart":  atomic.CompareAndSwapInt32(&otelColdStart, 0, 1),
+					"sparta.build_id": StampedBuildID,
+				},
+			}
+			if lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx); lambdaContextOk {
+				span.attributes["faas.invocation_id"] = lambdaContext.AwsRequestID
+				span.attributes["cloud.resource_id"] = lambdaContext.InvokedFunctionArn
+			}
+			recorder := &otelRecorder{}
+			spanCtx := context.WithValue(ctx, otelContextKeySpan, span)
+			spanCtx = context.WithValue(spanCtx, otelContextKeyRecorder, recorder)
+
+			response, err := next(spanCtx, msg)
+			span.end = time.Now()
+			span.err = err
+			recorder.record(span)
+
+			// Lambda may freeze the container once the handler returns,
+			// so export synchronously
+			logger := middlewareLogger(ctx)
+			exportErr := exporter.exportSpans(ctx, recorder.spans)
+			if exportErr != nil {
+				logger.WithError(exportErr).Warn("Failed to export OpenTelemetry spans")
+			}
+			if !options.DisableMetrics {
+				exportErr = exporter.exportMetrics(ctx, otelInvocationMetrics(span))
+				if exportErr != nil {
+					logger.WithError(exportErr).Warn("Failed to export OpenTelemetry metrics")
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+//
+// END - OpenTelemetryMiddleware
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,38 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportProvisionSpans(t *testing.T) {
+	server, receiver := newOTLPTestServer()
+	defer server.Close()
+
+	logger, _ := NewLogger("warning")
+	startTime := time.Now()
+	exportProvisionSpans(server.URL,
+		"ProvisionService",
+		"testBuildID",
+		startTime,
+		[]*workflowStepDuration{
+			{name: "Verifying IAM roles", start: startTime, duration: time.Second},
+			{name: "Uploading code", start: startTime.Add(time.Second), duration: time.Second},
+		},
+		nil,
+		logger)
+	traces := receiver.payloads["/v1/traces"]
+	if len(traces) != 1 {
+		t.Fatalf("Expected a single trace export, got: %d", len(traces))
+	}
+	for _, eachExpected := range []string{"provision ProvisionService",
+		"Verifying IAM roles",
+		"Uploading code"} {
+		if !strings.Contains(traces[0], eachExpected) {
+			t.Fatalf("Failed to find %s in provisioning spans: %s", eachExpected, traces[0])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type otlpTestReceiver struct {
+	mutex    sync.Mutex
+	payloads map[string][]string
+}
+
+func (receiver *otlpTestReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	receiver.payloads[r.URL.Path] = append(receiver.payloads[r.URL.Path], string(body))
+	w.WriteHeader(http.StatusOK)
+}
+
+func newOTLPTestServer() (*httptest.Server, *otlpTestReceiver) {
+	receiver := &otlpTestReceiver{
+		payloads: make(map[string][]string),
+	}
+	return httptest.NewServer(receiver), receiver
+}
+
+func TestOpenTelemetryMiddleware(t *testing.T) {
+	server, receiver := newOTLPTestServer()
+	defer server.Close()
+
+	middleware := OpenTelemetryMiddleware(&OpenTelemetryOptions{
+		Endpoint:    server.URL,
+		ServiceName: "OTelService",
+	})
+	handler := applyHandlerMiddleware(func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		childErr := OpenTelemetrySpan(ctx, "child", func(ctx context.Context) error {
+			return errors.New("child failed")
+		})
+		return nil, childErr
+	}, []HandlerMiddleware{middleware})
+
+	traceHeader := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	ctx := context.WithValue(context.Background(), lambdaTraceIDContextKey, traceHeader)
+	_, err := handler(ctx, json.RawMessage(`{}`))
+	if err == nil {
+		t.Fatalf("Expected handler error to be returned")
+	}
+
+	traces := receiver.payloads["/v1/traces"]
+	if len(traces) != 1 {
+		t.Fatalf("Expected a single trace export, got: %d", len(traces))
+	}
+	for _, eachExpected := range []string{`"traceId":"5759e988bd862e3fe1be46a994272793"`,
+		`"parentSpanId":"53995c3f42cd8ad8"`,
+		`"name":"child"`,
+		`"stringValue":"OTelService"`,
+		`"message":"child failed"`} {
+		if !strings.Contains(traces[0], eachExpected) {
+			t.Fatalf("Failed to find %s in OTLP traces: %s", eachExpected, traces[0])
+		}
+	}
+	metrics := receiver.payloads["/v1/metrics"]
+	if len(metrics) != 1 || !strings.Contains(metrics[0], "faas.invocations") {
+		t.Fatalf("Failed to find OTLP invocation metrics: %#v", metrics)
+	}
+}
+
+func TestOpenTelemetrySpanUntraced(t *testing.T) {
+	called := false
+	spanErr := OpenTelemetrySpan(context.Background(), "untraced", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if spanErr != nil || !called {
+		t.Fatalf("Failed to call untraced function: %v", spanErr)
+	}
+}
@@ -0,0 +1,429 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Package
+//
+
+// packageManifestName is the name of the artifact manifest written
+// to the package output directory
+const packageManifestName = "manifest.json"
+
+// terraformConfigName is the name of the Terraform configuration written
+// to the export output directory
+const terraformConfigName = "main.tf"
+
+// samConfigName is the name of the `sam deploy` configuration written
+// to the package output directory for SAM templates
+const samConfigName = "samconfig.toml"
+
+// packageArtifact is a build artifact referenced by the packaged template
+type packageArtifact struct {
+	// Path is the artifact's path relative to the output directory
+	Path string
+	// S3Bucket is the bucket referenced by the template
+	S3Bucket string
+	// S3Key is the key referenced by the template. Artifacts that
+	// were not uploaded must be published to this key before the
+	// template is deployed.
+	S3Key string
+	// S3ObjectVersion is the object version if the artifact was uploaded
+	// to a bucket with versioning enabled
+	S3ObjectVersion string `json:",omitempty"`
+	// Uploaded is true if the artifact was uploaded to S3
+	Uploaded bool
+}
+
+// packageManifest describes the contents of the package output directory
+type packageManifest struct {
+	ServiceName string
+	BuildID     string
+	// Template is the template path relative to the output directory
+	Template  string
+	StackTags map[string]string
+	Artifacts []*packageArtifact
+}
+
+// packageContext is the state for a workflow that builds the service
+// artifacts and template without deploying them
+type packageContext struct {
+	outputDirectory string
+	upload          bool
+	templateFormat  string
+	artifactsMutex  sync.Mutex
+	artifacts       []*packageArtifact
+}
+
+// addArtifact copies the local file to the output directory and optionally
+// uploads it. Returns the S3 URL that the template should reference.
+func (pkg *packageContext) addArtifact(localPath string,
+	s3ObjectKey string,
+	ctx *workflowContext) (string, error) {
+
+	artifactName := filepath.Base(localPath)
+	copyErr := copyFile(localPath, filepath.Join(pkg.outputDirectory, artifactName))
+	if copyErr != nil {
+		return "", errors.Wrapf(copyErr, "Failed to copy artifact: %s", artifactName)
+	}
+	artifact := &packageArtifact{
+		Path:     artifactName,
+		S3Bucket: ctx.userdata.s3Bucket,
+		S3Key:    s3ObjectKey,
+		Uploaded: pkg.upload,
+	}
+	s3URL := fmt.Sprintf("https://%s-s3.amazonaws.com/%s",
+		ctx.userdata.s3Bucket,
+		s3ObjectKey)
+	if pkg.upload {
+		uploadLocation, uploadErr := ctx.context.artifactStore.Upload(localPath,
+			ctx.userdata.s3Bucket,
+			s3ObjectKey,
+			nil,
+			ctx.logger)
+		if uploadErr != nil {
+			return "", errors.Wrapf(uploadErr, "Failed to upload local file to S3")
+		}
+		ctx.registerRollback(artifactRollbackFunc(ctx.context.artifactStore,
+			ctx.userdata.s3Bucket,
+			uploadLocation))
+		s3URL = uploadLocation
+		if uploadURL := newS3UploadURL(ctx.userdata.s3Bucket, uploadLocation); uploadURL != nil {
+			artifact.S3ObjectVersion = uploadURL.version
+		}
+	}
+	ctx.registerFileCleanupFinalizer(localPath)
+	ctx.logger.WithFields(logrus.Fields{
+		"Path":     artifactName,
+		"Key":      s3ObjectKey,
+		"Uploaded": pkg.upload,
+	}).Info("Packaged artifact")
+
+	pkg.artifactsMutex.Lock()
+	pkg.artifacts = append(pkg.artifacts, artifact)
+	pkg.artifactsMutex.Unlock()
+	return s3URL, nil
+}
+
+// writeManifest writes the template and artifact manifest to the
+// output directory
+func (pkg *packageContext) writeManifest(cfTemplate []byte,
+	stackTags map[string]string,
+	ctx *workflowContext) error {
+
+	templateFormat := pkg.templateFormat
+	if templateFormat == "" {
+		templateFormat = TemplateFormatJSON
+	}
+	if templateFormat == TemplateFormatSAM {
+		samTemplate, samTemplateErr := pkg.writeSAMConfig(cfTemplate, stackTags, ctx)
+		if samTemplateErr != nil {
+			return samTemplateErr
+		}
+		cfTemplate = samTemplate
+		templateFormat = TemplateFormatYAML
+	}
+	templateName := fmt.Sprintf("template.%s", templateFormat)
+	if templateFormat == ExportFormatTerraform {
+		templateName = terraformConfigName
+		writeErr := pkg.writeTerraform(cfTemplate, stackTags, ctx)
+		if writeErr != nil {
+			return writeErr
+		}
+	} else {
+		templateFile, templateFileErr := os.Create(filepath.Join(pkg.outputDirectory, templateName))
+		if templateFileErr != nil {
+			return errors.Wrapf(templateFileErr, "Failed to create template")
+		}
+		writeErr := writeTemplate(templateFile, templateFormat, cfTemplate, nil)
+		closeErr := templateFile.Close()
+		if writeErr != nil {
+			return errors.Wrapf(writeErr, "Failed to write template")
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+
+	manifest := &packageManifest{
+		ServiceName: ctx.userdata.serviceName,
+		BuildID:     ctx.userdata.buildID,
+		Template:    templateName,
+		StackTags:   stackTags,
+		Artifacts:   pkg.artifacts,
+	}
+	manifestJSON, manifestJSONErr := json.MarshalIndent(manifest, "", "  ")
+	if manifestJSONErr != nil {
+		return errors.Wrapf(manifestJSONErr, "Failed to marshal package manifest")
+	}
+	manifestPath := filepath.Join(pkg.outputDirectory, packageManifestName)
+	manifestErr := ioutil.WriteFile(manifestPath, manifestJSON, 0644)
+	if manifestErr != nil {
+		return errors.Wrapf(manifestErr, "Failed to write package manifest")
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Directory": pkg.outputDirectory,
+		"Template":  templateName,
+		"Artifacts": len(pkg.artifacts),
+	}).Info("Service packaged")
+	return nil
+}
+
+// writeSAMConfig writes the samconfig.toml file and returns the SAM
+// version of the template. Functions use the packaged code archives
+// as their CodeUri so that they can be tested with `sam local`.
+func (pkg *packageContext) writeSAMConfig(cfTemplate []byte,
+	stackTags map[string]string,
+	ctx *workflowContext) ([]byte, error) {
+
+	codeURIs := make(map[string]string)
+	for _, eachArtifact := range pkg.artifacts {
+		codeURIs[eachArtifact.S3Key] = eachArtifact.Path
+	}
+	samTemplate, samTemplateErr := spartaCF.ExportSAMTemplate(cfTemplate, codeURIs, ctx.logger)
+	if samTemplateErr != nil {
+		return nil, errors.Wrapf(samTemplateErr, "Failed to export SAM template")
+	}
+	samConfig := &spartaCF.SAMConfig{
+		StackName: ctx.userdata.serviceName,
+		S3Bucket:  ctx.userdata.s3Bucket,
+		S3Prefix:  ctx.userdata.serviceName,
+		Capabilities: []string{cloudformation.CapabilityCapabilityIam,
+			cloudformation.CapabilityCapabilityNamedIam,
+			cloudformation.CapabilityCapabilityAutoExpand},
+		Tags: stackTags,
+	}
+	if ctx.context.awsSession != nil {
+		samConfig.Region = aws.StringValue(ctx.context.awsSession.Config.Region)
+	}
+	samConfigTOML, samConfigTOMLErr := samConfig.MarshalTOML()
+	if samConfigTOMLErr != nil {
+		return nil, errors.Wrapf(samConfigTOMLErr, "Failed to marshal SAM config")
+	}
+	samConfigErr := ioutil.WriteFile(filepath.Join(pkg.outputDirectory, samConfigName),
+		samConfigTOML,
+		0644)
+	if samConfigErr != nil {
+		return nil, errors.Wrapf(samConfigErr, "Failed to write SAM config")
+	}
+	return samTemplate, nil
+}
+
+// writeTerraform writes the Terraform configuration equivalent to the
+// template. Archives that weren't uploaded are deployed directly from
+// the output directory.
+func (pkg *packageContext) writeTerraform(cfTemplate []byte,
+	stackTags map[string]string,
+	ctx *workflowContext) error {
+
+	codePaths := make(map[string]string)
+	for _, eachArtifact := range pkg.artifacts {
+		if !eachArtifact.Uploaded {
+			codePaths[eachArtifact.S3Key] = eachArtifact.Path
+		}
+	}
+	terraformConfig, terraformConfigErr := spartaCF.ExportTerraform(cfTemplate,
+		ctx.userdata.serviceName,
+		stackTags,
+		codePaths,
+		ctx.logger)
+	if terraformConfigErr != nil {
+		return errors.Wrapf(terraformConfigErr, "Failed to export Terraform configuration")
+	}
+	writeErr := ioutil.WriteFile(filepath.Join(pkg.outputDirectory, terraformConfigName),
+		append(terraformConfig, '\n'),
+		0644)
+	if writeErr != nil {
+		return errors.Wrapf(writeErr, "Failed to write Terraform configuration")
+	}
+	return nil
+}
+
+// copyFile copies the source file to the destination path
+func copyFile(sourcePath string, destPath string) error {
+	/* #nosec */
+	source, sourceErr := os.Open(sourcePath)
+	if sourceErr != nil {
+		return sourceErr
+	}
+	defer source.Close()
+	dest, destErr := os.Create(destPath)
+	if destErr != nil {
+		return destErr
+	}
+	_, copyErr := io.Copy(dest, source)
+	closeErr := dest.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
+
+// Package builds the service binary, creates the code archives and
+// generates the CloudFormation template without creating or updating the
+// CloudFormation stack. The template, archives and a manifest.json file
+// that describes the S3 location each archive is referenced by are written
+// to outputDirectory. If upload is false, the archives must be
+// published to their manifest S3 keys before the template is deployed.
+func Package(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	outputDirectory string,
+	upload bool,
+	templateFormat string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	switch templateFormat {
+	case "", TemplateFormatJSON, TemplateFormatYAML, TemplateFormatSAM:
+	default:
+		return errors.Errorf("Unsupported template format: %s", templateFormat)
+	}
+	return packageService(serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		buildID,
+		outputDirectory,
+		upload,
+		templateFormat,
+		buildTags,
+		linkerFlags,
+		workflowHooks,
+		logger)
+}
+
+// Export builds the service binary and code archives and writes the
+// service in the exportFormat to outputDirectory, together with the
+// archives and a manifest.json file. Resources that can't be represented
+// in the exportFormat are logged and written as comments. If upload is
+// false, the exported configuration deploys the archives from
+// outputDirectory.
+func Export(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	outputDirectory string,
+	upload bool,
+	exportFormat string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	if exportFormat != ExportFormatTerraform {
+		return errors.Errorf("Unsupported export format: %s", exportFormat)
+	}
+	return packageService(serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		buildID,
+		outputDirectory,
+		upload,
+		exportFormat,
+		buildTags,
+		linkerFlags,
+		workflowHooks,
+		logger)
+}
+
+// packageService runs the provision workflow without creating or updating
+// the CloudFormation stack
+func packageService(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	outputDirectory string,
+	upload bool,
+	templateFormat string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+
+	if outputDirectory == "" {
+		return errors.New("Package requires an output directory")
+	}
+	// Signing operates on the uploaded archive
+	if !upload {
+		signingProfileName, signingProfileErr := codeSigningProfileName(lambdaAWSInfos)
+		if signingProfileErr != nil {
+			return signingProfileErr
+		}
+		if signingProfileName != "" {
+			return errors.Errorf("Code signing profile %s requires packaged artifacts to be uploaded",
+				signingProfileName)
+		}
+	}
+	mkdirErr := os.MkdirAll(outputDirectory, os.ModePerm)
+	if mkdirErr != nil {
+		return errors.Wrapf(mkdirErr, "Failed to create output directory")
+	}
+	pkg := &packageContext{
+		outputDirectory: outputDirectory,
+		upload:          upload,
+		templateFormat:  templateFormat,
+		artifacts:       make([]*packageArtifact, 0),
+	}
+	return provision(false,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		false,
+		buildID,
+		"",
+		buildTags,
+		linkerFlags,
+		nil,
+		workflowHooks,
+		nil,
+		logger,
+		pkg,
+		false)
+}
+
+//
+// END - Package
+////////////////////////////////////////////////////////////////////////////////
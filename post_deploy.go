@@ -0,0 +1,235 @@
+package sparta
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - PostDeployValidations
+//
+
+// defaultValidationAttempts is the number of times a validation is attempted
+// before it fails
+const defaultValidationAttempts = 3
+
+// validationRetryDelay is the delay between validation attempts
+const validationRetryDelay = 5 * time.Second
+
+// retryValidation calls the validation function until it succeeds or
+// the attempts are exhausted
+func retryValidation(attempts int,
+	validationName string,
+	logger *logrus.Logger,
+	validation func() error) error {
+	if attempts <= 0 {
+		attempts = defaultValidationAttempts
+	}
+	var validationErr error
+	for eachAttempt := 1; eachAttempt <= attempts; eachAttempt++ {
+		validationErr = validation()
+		if validationErr == nil {
+			logger.WithField("Validation", validationName).Info("Post deploy validation succeeded")
+			return nil
+		}
+		logger.WithFields(logrus.Fields{
+			"Validation": validationName,
+			"Attempt":    eachAttempt,
+			"Error":      validationErr,
+		}).Warn("Post deploy validation failed")
+		if eachAttempt != attempts {
+			time.Sleep(validationRetryDelay)
+		}
+	}
+	return errors.Wrapf(validationErr, "Validation %s failed", validationName)
+}
+
+// HTTPValidation is a PostDeployValidationHookHandler that issues an HTTP
+// request to the provisioned service and verifies the response.
+type HTTPValidation struct {
+	// URL is the absolute URL to request. Either URL or OutputKey is
+	// required.
+	URL string
+	// OutputKey is the name of the stack Output whose value is the base URL
+	// to request (eg: OutputAPIGatewayURL)
+	OutputKey string
+	// Path is the optional path appended to the OutputKey value
+	Path string
+	// Method is the HTTP method. Defaults to GET.
+	Method string
+	// Headers are the optional request headers
+	Headers map[string]string
+	// Body is the optional request body
+	Body string
+	// ExpectedStatusCodes are the acceptable response status codes.
+	// Defaults to any 2XX status code.
+	ExpectedStatusCodes []int
+	// BodyContains is an optional value the response body must include
+	BodyContains string
+	// Attempts is the number of requests made before the validation fails.
+	// Defaults to 3.
+	Attempts int
+	// Timeout is the timeout for each request. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// requestURL returns the URL to validate
+func (validation *HTTPValidation) requestURL(stackOutputs map[string]string) (string, error) {
+	if validation.URL != "" {
+		return validation.URL, nil
+	}
+	if validation.OutputKey == "" {
+		return "", errors.Errorf("HTTPValidation requires either a URL or an OutputKey")
+	}
+	baseURL, baseURLExists := stackOutputs[validation.OutputKey]
+	if !baseURLExists {
+		return "", errors.Errorf("HTTPValidation stack Output not found: %s", validation.OutputKey)
+	}
+	if validation.Path == "" {
+		return baseURL, nil
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(validation.Path, "/"), nil
+}
+
+// validateResponse verifies the response status code and body
+func (validation *HTTPValidation) validateResponse(statusCode int, body string) error {
+	statusCodeValid := statusCode >= 200 && statusCode < 300
+	if len(validation.ExpectedStatusCodes) != 0 {
+		statusCodeValid = false
+		for _, eachStatusCode := range validation.ExpectedStatusCodes {
+			statusCodeValid = statusCodeValid || eachStatusCode == statusCode
+		}
+	}
+	if !statusCodeValid {
+		return errors.Errorf("Unexpected HTTP status code: %d", statusCode)
+	}
+	if validation.BodyContains != "" && !strings.Contains(body, validation.BodyContains) {
+		return errors.Errorf("HTTP response body doesn't contain: %s", validation.BodyContains)
+	}
+	return nil
+}
+
+// ValidateDeployment satisfies the PostDeployValidationHookHandler interface
+func (validation *HTTPValidation) ValidateDeployment(context *WorkflowHookContext,
+	serviceName string,
+	stackOutputs map[string]string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	requestURL, requestURLErr := validation.requestURL(stackOutputs)
+	if requestURLErr != nil {
+		return requestURLErr
+	}
+	method := validation.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := validation.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	validationName := method + " " + requestURL
+	return retryValidation(validation.Attempts, validationName, logger, func() error {
+		request, requestErr := http.NewRequest(method,
+			requestURL,
+			strings.NewReader(validation.Body))
+		if requestErr != nil {
+			return requestErr
+		}
+		for eachKey, eachValue := range validation.Headers {
+			request.Header.Set(eachKey, eachValue)
+		}
+		response, responseErr := httpClient.Do(request)
+		if responseErr != nil {
+			return responseErr
+		}
+		defer response.Body.Close()
+		body, bodyErr := ioutil.ReadAll(response.Body)
+		if bodyErr != nil {
+			return bodyErr
+		}
+		return validation.validateResponse(response.StatusCode, string(body))
+	})
+}
+
+// LambdaInvokeValidation is a PostDeployValidationHookHandler that
+// synchronously invokes a provisioned Lambda function and verifies the
+// function didn't return an error.
+type LambdaInvokeValidation struct {
+	// Function is the provisioned Lambda function to invoke
+	Function *LambdaAWSInfo
+	// Qualifier is the optional version or alias to invoke
+	Qualifier string
+	// Payload is the JSON event to send
+	Payload []byte
+	// ResponseContains is an optional value the function response must
+	// include
+	ResponseContains string
+	// Attempts is the number of invocations made before the validation
+	// fails. Defaults to 3.
+	Attempts int
+}
+
+// ValidateDeployment satisfies the PostDeployValidationHookHandler interface
+func (validation *LambdaInvokeValidation) ValidateDeployment(context *WorkflowHookContext,
+	serviceName string,
+	stackOutputs map[string]string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+
+	if validation.Function == nil {
+		return errors.Errorf("LambdaInvokeValidation requires a Function")
+	}
+	awsClients := workflowHookAWSClients(context, awsSession)
+	resourceOutput, resourceErr := awsClients.CloudFormation.DescribeStackResource(&cloudformation.DescribeStackResourceInput{
+		StackName:         aws.String(serviceName),
+		LogicalResourceId: aws.String(validation.Function.LogicalResourceName()),
+	})
+	if resourceErr != nil {
+		return errors.Wrapf(resourceErr, "Failed to find function: %s",
+			validation.Function.LogicalResourceName())
+	}
+	functionName := aws.StringValue(resourceOutput.StackResourceDetail.PhysicalResourceId)
+	invokeInput := &lambda.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		InvocationType: aws.String(lambda.InvocationTypeRequestResponse),
+		Payload:        validation.Payload,
+	}
+	if validation.Qualifier != "" {
+		invokeInput.Qualifier = aws.String(validation.Qualifier)
+	}
+	return retryValidation(validation.Attempts, "Invoke "+functionName, logger, func() error {
+		invokeOutput, invokeErr := awsClients.Lambda.Invoke(invokeInput)
+		if invokeErr != nil {
+			return invokeErr
+		}
+		if invokeOutput.FunctionError != nil {
+			return errors.Errorf("Function returned an error (%s): %s",
+				*invokeOutput.FunctionError,
+				string(invokeOutput.Payload))
+		}
+		if validation.ResponseContains != "" &&
+			!strings.Contains(string(invokeOutput.Payload), validation.ResponseContains) {
+			return errors.Errorf("Function response doesn't contain: %s", validation.ResponseContains)
+		}
+		return nil
+	})
+}
+
+//
+// END - PostDeployValidations
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,335 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// aliasVersion is the version an alias referenced before the deployment
+type aliasVersion struct {
+	functionName string
+	aliasName    string
+	version      string
+}
+
+// deploymentSnapshot is the state of the stack before the deployment, used to
+// revert the deployment if a post deploy validation fails
+type deploymentSnapshot struct {
+	templateBody  string
+	parameters    []*cloudformation.Parameter
+	capabilities  []*string
+	tags          []*cloudformation.Tag
+	aliasVersions []*aliasVersion
+	// inPlaceChanges are the function updates applied without CloudFormation.
+	// They're reverted to the function definitions in the stack's template.
+	inPlaceChanges []*inPlaceFunctionChange
+}
+
+// postDeployValidations returns the PostDeployValidations hooks
+func postDeployValidations(ctx *workflowContext) []PostDeployValidationHookHandler {
+	if ctx.userdata.workflowHooks == nil {
+		return nil
+	}
+	return ctx.userdata.workflowHooks.PostDeployValidations
+}
+
+// newDeploymentSnapshot returns the current state of the stack. Functions with
+// a DeploymentPreference are reverted by updating their alias to the
+// previous version, which takes effect before the stack is reverted to the
+// previous template. The snapshot is nil if the stack doesn't exist.
+func newDeploymentSnapshot(ctx *workflowContext) (*deploymentSnapshot, error) {
+	cfSvc := ctx.context.awsClients.CloudFormation
+	describeOutput, describeErr := cfSvc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(ctx.userdata.serviceName),
+	})
+	if describeErr != nil {
+		if strings.Contains(describeErr.Error(), "does not exist") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(describeErr, "Failed to describe stack: %s", ctx.userdata.serviceName)
+	}
+	if len(describeOutput.Stacks) == 0 {
+		return nil, nil
+	}
+	stackInfo := describeOutput.Stacks[0]
+	snapshot := &deploymentSnapshot{
+		capabilities: stackInfo.Capabilities,
+		tags:         stackInfo.Tags,
+	}
+	for _, eachParam := range stackInfo.Parameters {
+		snapshot.parameters = append(snapshot.parameters, &cloudformation.Parameter{
+			ParameterKey:     eachParam.ParameterKey,
+			UsePreviousValue: aws.Bool(true),
+		})
+	}
+
+	// Traffic shifted functions?
+	lambdaSvc := ctx.context.awsClients.Lambda
+	for _, eachLambdaInfo := range ctx.userdata.lambdaAWSInfos {
+		if eachLambdaInfo.Options == nil || eachLambdaInfo.Options.DeploymentPreference == nil {
+			continue
+		}
+		resourceOutput, resourceErr := cfSvc.DescribeStackResource(&cloudformation.DescribeStackResourceInput{
+			StackName:         aws.String(ctx.userdata.serviceName),
+			LogicalResourceId: aws.String(eachLambdaInfo.LogicalResourceName()),
+		})
+		// New functions don't have a previous version
+		if resourceErr != nil {
+			continue
+		}
+		functionName := aws.StringValue(resourceOutput.StackResourceDetail.PhysicalResourceId)
+		aliasName := publishedAliasName(eachLambdaInfo.Options)
+		aliasOutput, aliasErr := lambdaSvc.GetAlias(&lambda.GetAliasInput{
+			FunctionName: aws.String(functionName),
+			Name:         aws.String(aliasName),
+		})
+		if aliasErr != nil {
+			continue
+		}
+		snapshot.aliasVersions = append(snapshot.aliasVersions, &aliasVersion{
+			functionName: functionName,
+			aliasName:    aliasName,
+			version:      aws.StringValue(aliasOutput.FunctionVersion),
+		})
+	}
+	templateOutput, templateErr := cfSvc.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(ctx.userdata.serviceName),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+	if templateErr != nil {
+		return nil, errors.Wrapf(templateErr, "Failed to get template for stack: %s", ctx.userdata.serviceName)
+	}
+	snapshot.templateBody = aws.StringValue(templateOutput.TemplateBody)
+	return snapshot, nil
+}
+
+// revertAliases updates each alias to reference the previous version
+func (snapshot *deploymentSnapshot) revertAliases(lambdaSvc lambdaiface.LambdaAPI,
+	logger *logrus.Logger) error {
+	for _, eachAlias := range snapshot.aliasVersions {
+		logger.WithFields(logrus.Fields{
+			"Function": eachAlias.functionName,
+			"Alias":    eachAlias.aliasName,
+			"Version":  eachAlias.version,
+		}).Warn("Reverting alias to previous version")
+		_, updateErr := lambdaSvc.UpdateAlias(&lambda.UpdateAliasInput{
+			FunctionName:    aws.String(eachAlias.functionName),
+			Name:            aws.String(eachAlias.aliasName),
+			FunctionVersion: aws.String(eachAlias.version),
+			RoutingConfig: &lambda.AliasRoutingConfiguration{
+				AdditionalVersionWeights: map[string]*float64{},
+			},
+		})
+		if updateErr != nil {
+			return errors.Wrapf(updateErr, "Failed to revert alias %s:%s",
+				eachAlias.functionName,
+				eachAlias.aliasName)
+		}
+	}
+	return nil
+}
+
+// templateFunction returns the function properties for the logical resource
+// ID in the snapshot template. Only the function resource is unmarshalled,
+// since the template may include custom resource types.
+func (snapshot *deploymentSnapshot) templateFunction(logicalResourceID string) (*gocf.LambdaFunction, error) {
+	var template struct {
+		Resources map[string]struct {
+			Properties json.RawMessage
+		}
+	}
+	unmarshalErr := json.Unmarshal([]byte(snapshot.templateBody), &template)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal previous template")
+	}
+	resource, resourceExists := template.Resources[logicalResourceID]
+	if !resourceExists {
+		return nil, errors.Errorf("Unable to locate lambda function in previous template: %s",
+			logicalResourceID)
+	}
+	lambdaFunction := &gocf.LambdaFunction{}
+	unmarshalErr = json.Unmarshal(resource.Properties, lambdaFunction)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal function: %s", logicalResourceID)
+	}
+	return lambdaFunction, nil
+}
+
+// revertInPlaceChanges applies the previous template's code and
+// configuration to each function updated in-place
+func (snapshot *deploymentSnapshot) revertInPlaceChanges(lambdaSvc lambdaiface.LambdaAPI,
+	logger *logrus.Logger) error {
+	for _, eachChange := range snapshot.inPlaceChanges {
+		lambdaFunction, lambdaFunctionErr := snapshot.templateFunction(eachChange.logicalResourceID)
+		if lambdaFunctionErr != nil {
+			return lambdaFunctionErr
+		}
+		template := gocf.NewTemplate()
+		template.AddResource(eachChange.logicalResourceID, lambdaFunction)
+		configurationRequest, configurationRequestErr := inPlaceFunctionConfiguration(eachChange,
+			template,
+			lambdaSvc)
+		if configurationRequestErr != nil {
+			return errors.Wrapf(configurationRequestErr,
+				"Failed to revert configuration for %s",
+				eachChange.logicalResourceID)
+		}
+		var codeRequest *lambda.UpdateFunctionCodeInput
+		if eachChange.codeChanged {
+			if lambdaFunction.Code == nil {
+				return errors.Errorf("Previous template doesn't define code for %s",
+					eachChange.logicalResourceID)
+			}
+			s3Bucket, s3BucketOk := literalStringExpr(lambdaFunction.Code.S3Bucket)
+			s3Key, s3KeyOk := literalStringExpr(lambdaFunction.Code.S3Key)
+			if !s3BucketOk || !s3KeyOk {
+				return errors.Errorf("Previous code location for %s isn't a literal value",
+					eachChange.logicalResourceID)
+			}
+			codeRequest = &lambda.UpdateFunctionCodeInput{
+				FunctionName: aws.String(eachChange.functionName),
+				S3Bucket:     aws.String(s3Bucket),
+				S3Key:        aws.String(s3Key),
+			}
+			s3ObjectVersion, s3ObjectVersionOk := literalStringExpr(lambdaFunction.Code.S3ObjectVersion)
+			if s3ObjectVersionOk && s3ObjectVersion != "" {
+				codeRequest.S3ObjectVersion = aws.String(s3ObjectVersion)
+			}
+		}
+		logger.WithFields(logrus.Fields{
+			"Function": eachChange.functionName,
+		}).Warn("Reverting in-place function update")
+		revertResult := inPlaceUpdateTask(lambdaSvc, configurationRequest, codeRequest)()
+		if revertResult.Error() != nil {
+			return errors.Wrapf(revertResult.Error(),
+				"Failed to revert function: %s",
+				eachChange.functionName)
+		}
+	}
+	return nil
+}
+
+// revertTemplate updates the stack to the previous template with a change
+// set. The template is uploaded with the workflow's ArtifactStore.
+func (snapshot *deploymentSnapshot) revertTemplate(ctx *workflowContext,
+	logger *logrus.Logger) error {
+	serviceName := ctx.userdata.serviceName
+	templateFile, templateFileErr := ioutil.TempFile("", "sparta-revert-template")
+	if templateFileErr != nil {
+		return errors.Wrapf(templateFileErr, "Failed to create previous template file")
+	}
+	defer os.Remove(templateFile.Name())
+	_, writeErr := templateFile.WriteString(snapshot.templateBody)
+	closeErr := templateFile.Close()
+	if writeErr != nil || closeErr != nil {
+		return errors.Errorf("Failed to write previous template: %v, %v", writeErr, closeErr)
+	}
+	templateURL, uploadErr := ctx.context.artifactStore.Upload(templateFile.Name(),
+		ctx.userdata.s3Bucket,
+		fmt.Sprintf("%s/%s-revert-cftemplate.json", serviceName, ctx.userdata.buildID),
+		nil,
+		logger)
+	if uploadErr != nil {
+		return errors.Wrapf(uploadErr, "Failed to upload previous template")
+	}
+	stackTags := make(map[string]string)
+	for _, eachTag := range snapshot.tags {
+		stackTags[aws.StringValue(eachTag.Key)] = aws.StringValue(eachTag.Value)
+	}
+	// The previous template isn't unmarshalled, so the capabilities are
+	// the stack's existing capabilities rather than inferred
+	changeSetOptions := &spartaCF.ChangeSetOptions{
+		Parameters:   snapshot.parameters,
+		Capabilities: aws.StringValueSlice(snapshot.capabilities),
+	}
+	if ctx.userdata.changeSetOptions != nil {
+		changeSetOptions.RetryPolicy = ctx.userdata.changeSetOptions.RetryPolicy
+	}
+	logger.WithField("StackName", serviceName).Warn("Reverting stack to previous template")
+	_, convergeErr := spartaCF.ConvergeStackStateWithClient(serviceName,
+		gocf.NewTemplate(),
+		templateURL,
+		stackTags,
+		time.Now(),
+		maximumStackOperationTimeout(ctx.context.cfTemplate, logger),
+		ctx.context.awsClients.CloudFormation,
+		changeSetOptions,
+		"▬",
+		dividerLength,
+		logger)
+	if convergeErr != nil {
+		return errors.Wrapf(convergeErr, "Failed to revert stack: %s", serviceName)
+	}
+	logger.WithField("StackName", serviceName).Info("Stack reverted to previous template")
+	return nil
+}
+
+// rollbackFunc returns the RollbackFunction that reverts the deployment.
+// Aliases are reverted first so that traffic shifts back immediately, then
+// the in-place function updates and the stack's template are reverted.
+func (snapshot *deploymentSnapshot) rollbackFunc(ctx *workflowContext) spartaS3.RollbackFunction {
+	return func(logger *logrus.Logger) error {
+		aliasErr := snapshot.revertAliases(ctx.context.awsClients.Lambda, logger)
+		if aliasErr != nil {
+			return aliasErr
+		}
+		if len(snapshot.inPlaceChanges) != 0 {
+			return snapshot.revertInPlaceChanges(ctx.context.awsClients.Lambda, logger)
+		}
+		return snapshot.revertTemplate(ctx, logger)
+	}
+}
+
+// validatePostDeployment returns the workflow step that calls the
+// PostDeployValidations hooks with the converged stack's outputs. If a hook
+// fails the deployment is reverted to the snapshot.
+func validatePostDeployment(stack *cloudformation.Stack,
+	snapshot *deploymentSnapshot,
+	next workflowStep) workflowStep {
+	return func(ctx *workflowContext) (workflowStep, error) {
+		defer recordDuration(time.Now(), "Post deploy validation", ctx)
+
+		stackOutputs := make(map[string]string)
+		for _, eachOutput := range stack.Outputs {
+			stackOutputs[aws.StringValue(eachOutput.OutputKey)] = aws.StringValue(eachOutput.OutputValue)
+		}
+		for _, eachHook := range postDeployValidations(ctx) {
+			ctx.logger.WithFields(logrus.Fields{
+				"WorkflowHookContext": ctx.context.workflowHooksContext,
+			}).Info("Calling PostDeployValidationHook")
+
+			hookErr := eachHook.ValidateDeployment(ctx.context.workflowHooksContext,
+				ctx.userdata.serviceName,
+				stackOutputs,
+				ctx.userdata.buildID,
+				ctx.context.awsSession,
+				ctx.userdata.noop,
+				ctx.logger)
+			if hookErr != nil {
+				if snapshot != nil {
+					ctx.registerRollback(snapshot.rollbackFunc(ctx))
+				} else {
+					ctx.logger.Warn("No previous deployment to revert to")
+				}
+				return nil, errors.Wrapf(hookErr, "Post deploy validation failed")
+			}
+		}
+		return next, nil
+	}
+}
@@ -0,0 +1,81 @@
+package sparta
+
+////////////////////////////////////////////////////////////////////////////////
+// START - PowerTuning
+//
+
+const (
+	// PowerTuningStrategyCost recommends the memory size with the lowest
+	// average invocation cost
+	PowerTuningStrategyCost = "cost"
+	// PowerTuningStrategySpeed recommends the memory size with the lowest
+	// average invocation duration
+	PowerTuningStrategySpeed = "speed"
+	// PowerTuningStrategyBalanced recommends the memory size with the best
+	// combination of cost and duration, relative to the cheapest and
+	// fastest memory sizes
+	PowerTuningStrategyBalanced = "balanced"
+)
+
+// PowerTuning enables a post deploy sweep that invokes each function with
+// the Payload at several memory sizes and reports the cost and latency sweet
+// spot. Each function's memory size is restored when the sweep is complete.
+// The sweep is skipped for noop provisions.
+//
+// The sweep changes the memory size of the unqualified ($LATEST) function,
+// down to the smallest MemorySizes value. Invocations that target $LATEST
+// during the sweep, including event sources and API Gateway integrations
+// for functions without an AutoPublishAlias, run with the tuned memory size
+// and may time out or run out of memory. Tune functions that publish an
+// alias, or tune a non-production stack.
+//
+// If RecommendationsFile is set, the recommended memory sizes are written to
+// the file. The next provision operation uses the recommendations as the
+// function MemorySize values. Commit the file to apply the recommendations
+// to every deployment.
+type PowerTuning struct {
+	// Functions are the provisioned Lambda functions to tune
+	Functions []*LambdaAWSInfo
+	// Payload is the JSON event sent with each invocation
+	Payload []byte
+	// MemorySizes are the memory sizes (MB) to test. Defaults to
+	// 128, 256, 512, 1024, 1536 and 3008.
+	MemorySizes []int64
+	// Invocations is the number of invocations at each memory size. An
+	// additional warm-up invocation isn't included in the results.
+	// Defaults to 5.
+	Invocations int
+	// Strategy is the PowerTuningStrategy* value used to select the
+	// recommended memory size. Defaults to PowerTuningStrategyCost.
+	Strategy string
+	// RecommendationsFile is the optional JSON file the recommendations are
+	// written to and read from
+	RecommendationsFile string
+}
+
+// PowerTuningResult is the average duration and cost of the function
+// invocations at a memory size
+type PowerTuningResult struct {
+	MemorySize int64 `json:"memorySize"`
+	// AverageDurationMillis is the average duration reported by AWS Lambda
+	AverageDurationMillis float64 `json:"averageDurationMillis"`
+	// AverageBilledDurationMillis is the average billed duration reported
+	// by AWS Lambda
+	AverageBilledDurationMillis float64 `json:"averageBilledDurationMillis"`
+	// AverageCostUSD is the average request and duration cost of an
+	// invocation
+	AverageCostUSD float64 `json:"averageCostUSD"`
+}
+
+// PowerTuningRecommendation is the recommended memory size for a function
+// and the results of the sweep
+type PowerTuningRecommendation struct {
+	FunctionName string               `json:"functionName"`
+	Strategy     string               `json:"strategy"`
+	MemorySize   int64                `json:"memorySize"`
+	Results      []*PowerTuningResult `json:"results"`
+}
+
+//
+// END - PowerTuning
+////////////////////////////////////////////////////////////////////////////////
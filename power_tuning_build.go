@@ -0,0 +1,418 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultPowerTuningMemorySizes are the memory sizes tested if the
+// PowerTuning doesn't provide them
+var defaultPowerTuningMemorySizes = []int64{128, 256, 512, 1024, 1536, 3008}
+
+// defaultPowerTuningInvocations is the number of invocations at each memory
+// size if the PowerTuning doesn't provide it
+const defaultPowerTuningInvocations = 5
+
+// powerTuningReportRegexp matches the durations in the REPORT log line
+var powerTuningReportRegexp = regexp.MustCompile(`\bDuration: ([0-9.]+) ms\s+Billed Duration: ([0-9.]+) ms`)
+
+// validate returns an error if the PowerTuning values are invalid
+func (tuning *PowerTuning) validate() error {
+	if len(tuning.Functions) == 0 {
+		return errors.New("PowerTuning requires at least one Function")
+	}
+	switch tuning.Strategy {
+	case "", PowerTuningStrategyCost, PowerTuningStrategySpeed, PowerTuningStrategyBalanced:
+		// NOP
+	default:
+		return errors.Errorf("Unsupported PowerTuning Strategy: %s", tuning.Strategy)
+	}
+	if tuning.Invocations < 0 {
+		return errors.Errorf("Invalid PowerTuning Invocations: %d", tuning.Invocations)
+	}
+	for _, eachMemorySize := range tuning.MemorySizes {
+		if eachMemorySize < minLambdaMemorySize || eachMemorySize > maxLambdaMemorySize {
+			return errors.Errorf("PowerTuning MemorySizes must be in the range [%d, %d] MB. Found: %d",
+				minLambdaMemorySize,
+				maxLambdaMemorySize,
+				eachMemorySize)
+		}
+	}
+	return nil
+}
+
+// strategy returns the strategy or the default value
+func (tuning *PowerTuning) strategy() string {
+	if tuning.Strategy == "" {
+		return PowerTuningStrategyCost
+	}
+	return tuning.Strategy
+}
+
+// memorySizes returns the memory sizes or the default values
+func (tuning *PowerTuning) memorySizes() []int64 {
+	if len(tuning.MemorySizes) == 0 {
+		return defaultPowerTuningMemorySizes
+	}
+	return tuning.MemorySizes
+}
+
+// invocations returns the invocation count or the default value
+func (tuning *PowerTuning) invocations() int {
+	if tuning.Invocations <= 0 {
+		return defaultPowerTuningInvocations
+	}
+	return tuning.Invocations
+}
+
+// powerTuningDurations returns the duration and billed duration from the
+// base64 encoded log tail of an invocation
+func powerTuningDurations(logResult string) (float64, float64, error) {
+	logTail, logTailErr := base64.StdEncoding.DecodeString(logResult)
+	if logTailErr != nil {
+		return 0, 0, errors.Wrapf(logTailErr, "Failed to decode invocation log")
+	}
+	matches := powerTuningReportRegexp.FindStringSubmatch(string(logTail))
+	if len(matches) != 3 {
+		return 0, 0, errors.Errorf("Invocation log doesn't include a REPORT line")
+	}
+	duration, durationErr := strconv.ParseFloat(matches[1], 64)
+	if durationErr != nil {
+		return 0, 0, durationErr
+	}
+	billedDuration, billedDurationErr := strconv.ParseFloat(matches[2], 64)
+	if billedDurationErr != nil {
+		return 0, 0, billedDurationErr
+	}
+	return duration, billedDuration, nil
+}
+
+// powerTuningInvoke invokes the function and returns the duration and
+// billed duration
+func powerTuningInvoke(functionName string,
+	payload []byte,
+	lambdaSvc lambdaiface.LambdaAPI) (float64, float64, error) {
+	invokeOutput, invokeErr := lambdaSvc.Invoke(&lambda.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		InvocationType: aws.String(lambda.InvocationTypeRequestResponse),
+		LogType:        aws.String(lambda.LogTypeTail),
+		Payload:        payload,
+	})
+	if invokeErr != nil {
+		return 0, 0, invokeErr
+	}
+	if invokeOutput.FunctionError != nil {
+		return 0, 0, errors.Errorf("Function returned an error (%s): %s",
+			*invokeOutput.FunctionError,
+			string(invokeOutput.Payload))
+	}
+	return powerTuningDurations(aws.StringValue(invokeOutput.LogResult))
+}
+
+// updatePowerTuningMemorySize updates the function's memory size and waits
+// for the update to complete, so that the invocations use the new size
+func updatePowerTuningMemorySize(functionName string,
+	memorySize int64,
+	lambdaSvc lambdaiface.LambdaAPI) error {
+	_, updateErr := lambdaSvc.UpdateFunctionConfiguration(&lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+		MemorySize:   aws.Int64(memorySize),
+	})
+	if updateErr != nil {
+		return errors.Wrapf(updateErr, "Failed to update %s MemorySize to %d MB",
+			functionName,
+			memorySize)
+	}
+	return waitForFunctionUpdate(newLambdaUpdateStatusReader(lambdaSvc), functionName, lambdaUpdateStatusTimeout)
+}
+
+// powerTuningSweep invokes the function at each memory size and returns the
+// results. The sweep updates the unqualified ($LATEST) function, which serves
+// any traffic that doesn't target a published alias. The function's memory
+// size is restored when the sweep completes.
+func powerTuningSweep(functionName string,
+	tuning *PowerTuning,
+	lambdaSvc lambdaiface.LambdaAPI,
+	priceFunc costPriceFunc,
+	logger *logrus.Logger) (results []*PowerTuningResult, sweepErr error) {
+
+	configOutput, configErr := lambdaSvc.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if configErr != nil {
+		return nil, errors.Wrapf(configErr, "Failed to get function configuration: %s", functionName)
+	}
+	originalMemorySize := aws.Int64Value(configOutput.MemorySize)
+	defer func() {
+		restoreErr := updatePowerTuningMemorySize(functionName, originalMemorySize, lambdaSvc)
+		if restoreErr != nil && sweepErr == nil {
+			sweepErr = restoreErr
+		}
+	}()
+
+	requestUSD := priceFunc(costPriceLambdaRequest)
+	gbSecondUSD := priceFunc(costPriceLambdaGBSecond)
+	invocations := tuning.invocations()
+	for _, eachMemorySize := range tuning.memorySizes() {
+		logger.WithFields(logrus.Fields{
+			"Function":    functionName,
+			"MemorySize":  eachMemorySize,
+			"Invocations": invocations,
+		}).Info("Power tuning function")
+
+		updateErr := updatePowerTuningMemorySize(functionName, eachMemorySize, lambdaSvc)
+		if updateErr != nil {
+			return nil, updateErr
+		}
+		// The first invocation at each memory size is a cold start
+		_, _, warmupErr := powerTuningInvoke(functionName, tuning.Payload, lambdaSvc)
+		if warmupErr != nil {
+			return nil, warmupErr
+		}
+		totalDuration := 0.0
+		totalBilledDuration := 0.0
+		for i := 0; i != invocations; i++ {
+			duration, billedDuration, invokeErr := powerTuningInvoke(functionName,
+				tuning.Payload,
+				lambdaSvc)
+			if invokeErr != nil {
+				return nil, invokeErr
+			}
+			totalDuration += duration
+			totalBilledDuration += billedDuration
+		}
+		averageBilledDuration := totalBilledDuration / float64(invocations)
+		results = append(results, &PowerTuningResult{
+			MemorySize:                  eachMemorySize,
+			AverageDurationMillis:       totalDuration / float64(invocations),
+			AverageBilledDurationMillis: averageBilledDuration,
+			AverageCostUSD: requestUSD +
+				(averageBilledDuration/1000)*(float64(eachMemorySize)/1024)*gbSecondUSD,
+		})
+	}
+	return results, nil
+}
+
+// recommendedPowerTuningResult returns the result selected by the strategy.
+// Ties are broken by the other measure.
+func recommendedPowerTuningResult(results []*PowerTuningResult, strategy string) *PowerTuningResult {
+	if len(results) == 0 {
+		return nil
+	}
+	minCost := math.MaxFloat64
+	minDuration := math.MaxFloat64
+	for _, eachResult := range results {
+		minCost = math.Min(minCost, eachResult.AverageCostUSD)
+		minDuration = math.Min(minDuration, eachResult.AverageDurationMillis)
+	}
+	score := func(result *PowerTuningResult) (float64, float64) {
+		switch strategy {
+		case PowerTuningStrategySpeed:
+			return result.AverageDurationMillis, result.AverageCostUSD
+		case PowerTuningStrategyBalanced:
+			relativeCost := result.AverageCostUSD / math.Max(minCost, math.SmallestNonzeroFloat64)
+			relativeDuration := result.AverageDurationMillis / math.Max(minDuration, math.SmallestNonzeroFloat64)
+			return relativeCost + relativeDuration, result.AverageCostUSD
+		default:
+			return result.AverageCostUSD, result.AverageDurationMillis
+		}
+	}
+	recommended := results[0]
+	for _, eachResult := range results[1:] {
+		eachPrimary, eachSecondary := score(eachResult)
+		recommendedPrimary, recommendedSecondary := score(recommended)
+		if eachPrimary < recommendedPrimary ||
+			(eachPrimary == recommendedPrimary && eachSecondary < recommendedSecondary) {
+			recommended = eachResult
+		}
+	}
+	return recommended
+}
+
+// logPowerTuningRecommendation logs the sweep results for the function
+func logPowerTuningRecommendation(recommendation *PowerTuningRecommendation,
+	logger *logrus.Logger) {
+	logger.Info(headerDivider)
+	logger.WithField("Strategy", recommendation.Strategy).
+		Info(fmt.Sprintf("Power Tuning: %s", recommendation.FunctionName))
+	logger.Info(headerDivider)
+	for _, eachResult := range recommendation.Results {
+		marker := ""
+		if eachResult.MemorySize == recommendation.MemorySize {
+			marker = "✓"
+		}
+		logger.WithFields(logrus.Fields{
+			"Duration (ms)":        fmt.Sprintf("%.2f", eachResult.AverageDurationMillis),
+			"Billed Duration (ms)": fmt.Sprintf("%.f", eachResult.AverageBilledDurationMillis),
+			"USD/1M invocations":   fmt.Sprintf("%.2f", eachResult.AverageCostUSD*1000000),
+		}).Info(fmt.Sprintf("%d MB %s", eachResult.MemorySize, marker))
+	}
+	logger.WithField("MemorySize", recommendation.MemorySize).Info("Recommended memory size")
+}
+
+// readPowerTuningRecommendations returns the recommendations in the file,
+// keyed by the function's logical resource name. A file that doesn't exist
+// has no recommendations.
+func readPowerTuningRecommendations(recommendationsFile string) (map[string]*PowerTuningRecommendation, error) {
+	recommendations := make(map[string]*PowerTuningRecommendation)
+	fileContents, fileContentsErr := ioutil.ReadFile(recommendationsFile)
+	if os.IsNotExist(fileContentsErr) {
+		return recommendations, nil
+	} else if fileContentsErr != nil {
+		return nil, errors.Wrapf(fileContentsErr, "Failed to read PowerTuning recommendations")
+	}
+	unmarshalErr := json.Unmarshal(fileContents, &recommendations)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr,
+			"Failed to unmarshal PowerTuning recommendations: %s",
+			recommendationsFile)
+	}
+	return recommendations, nil
+}
+
+// applyPowerTuningRecommendations sets the MemorySize of the functions with
+// a recommendation in the PowerTuning RecommendationsFile
+func applyPowerTuningRecommendations(tuning *PowerTuning,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	logger *logrus.Logger) error {
+	if tuning == nil || tuning.RecommendationsFile == "" {
+		return nil
+	}
+	recommendations, recommendationsErr := readPowerTuningRecommendations(tuning.RecommendationsFile)
+	if recommendationsErr != nil {
+		return recommendationsErr
+	}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		recommendation, recommendationExists := recommendations[eachLambdaInfo.LogicalResourceName()]
+		if !recommendationExists {
+			continue
+		}
+		if eachLambdaInfo.Options == nil {
+			eachLambdaInfo.Options = defaultLambdaFunctionOptions()
+		}
+		if eachLambdaInfo.Options.MemorySizeParameter != "" {
+			logger.WithFields(logrus.Fields{
+				"Function":  eachLambdaInfo.lambdaFunctionName(),
+				"Parameter": eachLambdaInfo.Options.MemorySizeParameter,
+			}).Warn("Ignoring PowerTuning recommendation for function with a MemorySizeParameter")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"Function":   eachLambdaInfo.lambdaFunctionName(),
+			"MemorySize": recommendation.MemorySize,
+			"Previous":   eachLambdaInfo.Options.MemorySize,
+		}).Info("Applying PowerTuning recommendation")
+		eachLambdaInfo.Options.MemorySize = recommendation.MemorySize
+	}
+	return nil
+}
+
+// writePowerTuningRecommendations updates the recommendations in the file
+func writePowerTuningRecommendations(recommendationsFile string,
+	updated map[string]*PowerTuningRecommendation) error {
+	recommendations, recommendationsErr := readPowerTuningRecommendations(recommendationsFile)
+	if recommendationsErr != nil {
+		return recommendationsErr
+	}
+	for eachKey, eachRecommendation := range updated {
+		recommendations[eachKey] = eachRecommendation
+	}
+	fileContents, fileContentsErr := json.MarshalIndent(recommendations, "", "  ")
+	if fileContentsErr != nil {
+		return errors.Wrapf(fileContentsErr, "Failed to marshal PowerTuning recommendations")
+	}
+	return ioutil.WriteFile(recommendationsFile, append(fileContents, '\n'), 0644)
+}
+
+// powerTuneFunctions runs the PowerTuning sweep for each function. Since
+// the stack has converged, sweep errors are logged rather than returned.
+func powerTuneFunctions(tuning *PowerTuning,
+	serviceName string,
+	cfSvc cloudformationiface.CloudFormationAPI,
+	lambdaSvc lambdaiface.LambdaAPI,
+	priceFunc costPriceFunc,
+	logger *logrus.Logger) map[string]*PowerTuningRecommendation {
+
+	recommendations := make(map[string]*PowerTuningRecommendation)
+	for _, eachLambdaInfo := range tuning.Functions {
+		logicalResourceName := eachLambdaInfo.LogicalResourceName()
+		resourceOutput, resourceErr := cfSvc.DescribeStackResource(&cloudformation.DescribeStackResourceInput{
+			StackName:         aws.String(serviceName),
+			LogicalResourceId: aws.String(logicalResourceName),
+		})
+		if resourceErr != nil {
+			logger.WithFields(logrus.Fields{
+				"Function": eachLambdaInfo.lambdaFunctionName(),
+				"Error":    resourceErr,
+			}).Warn("Failed to find function for power tuning")
+			continue
+		}
+		functionName := aws.StringValue(resourceOutput.StackResourceDetail.PhysicalResourceId)
+		results, resultsErr := powerTuningSweep(functionName,
+			tuning,
+			lambdaSvc,
+			priceFunc,
+			logger)
+		if resultsErr != nil {
+			logger.WithFields(logrus.Fields{
+				"Function": functionName,
+				"Error":    resultsErr,
+			}).Warn("Power tuning failed")
+			continue
+		}
+		recommendation := &PowerTuningRecommendation{
+			FunctionName: eachLambdaInfo.lambdaFunctionName(),
+			Strategy:     tuning.strategy(),
+			MemorySize:   recommendedPowerTuningResult(results, tuning.strategy()).MemorySize,
+			Results:      results,
+		}
+		logPowerTuningRecommendation(recommendation, logger)
+		recommendations[logicalResourceName] = recommendation
+	}
+	return recommendations
+}
+
+// powerTuningStep returns the workflow step that runs the
+// WorkflowHooks.PowerTuning sweep and optionally writes the recommendations
+func powerTuningStep(next workflowStep) workflowStep {
+	return func(ctx *workflowContext) (workflowStep, error) {
+		defer recordDuration(time.Now(), "Power tuning", ctx)
+
+		tuning := ctx.userdata.workflowHooks.PowerTuning
+		priceFunc, priceSource := newPriceListCostPrice(ctx.context.awsSession, ctx.logger)
+		ctx.logger.WithField("Prices", priceSource).Info("Running power tuning sweep")
+		recommendations := powerTuneFunctions(tuning,
+			ctx.userdata.serviceName,
+			ctx.context.awsClients.CloudFormation,
+			ctx.context.awsClients.Lambda,
+			priceFunc,
+			ctx.logger)
+		if tuning.RecommendationsFile != "" && len(recommendations) != 0 {
+			writeErr := writePowerTuningRecommendations(tuning.RecommendationsFile, recommendations)
+			if writeErr != nil {
+				ctx.logger.WithField("Error", writeErr).Warn("Failed to write PowerTuning recommendations")
+			} else {
+				ctx.logger.WithField("Path", tuning.RecommendationsFile).
+					Info("PowerTuning recommendations written. They're applied by the next provision operation.")
+			}
+		}
+		return next, nil
+	}
+}
@@ -260,7 +260,11 @@ func ensureIAMRoleForCustomResource(command cfCustomResources.CustomResourceComm
 			"RoleName": stableRoleName,
 		}).Debug("Inserting IAM Role")
 	} else {
-		existingIAMRole = existingResource.Properties.(*gocf.IAMRole)
+		typedIAMRole, typedIAMRoleOk := templateIAMRole(existingResource)
+		if !typedIAMRoleOk {
+			return "", errors.Errorf("Resource %s isn't an IAM role", stableRoleName)
+		}
+		existingIAMRole = &typedIAMRole
 	}
 
 	// ARNs are only required if there are non-empty privileges associated
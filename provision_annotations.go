@@ -78,6 +78,27 @@ func annotateDiscoveryInfo(lambdaAWSInfo *LambdaAWSInfo,
 	if lambdaEnvironment == nil {
 		lambdaAWSInfo.Options.Environment = make(map[string]*gocf.StringExpr)
 	}
+	for _, eachTable := range lambdaAWSInfo.Options.DynamoDBResources {
+		dependencyText, dependencyTextErr := eachTable.discoveryInfo(template, logger)
+		if dependencyTextErr != nil {
+			return nil, errors.Wrapf(dependencyTextErr, "Failed to determine discovery info for DynamoDB table")
+		}
+		depMap[eachTable.LogicalResourceName()] = string(dependencyText)
+	}
+	for _, eachQueue := range lambdaAWSInfo.Options.SQSResources {
+		dependencyText, dependencyTextErr := eachQueue.discoveryInfo(template, logger)
+		if dependencyTextErr != nil {
+			return nil, errors.Wrapf(dependencyTextErr, "Failed to determine discovery info for SQS queue")
+		}
+		depMap[eachQueue.LogicalResourceName()] = string(dependencyText)
+	}
+	for _, eachTopic := range lambdaAWSInfo.Options.SNSResources {
+		dependencyText, dependencyTextErr := eachTopic.discoveryInfo(template, logger)
+		if dependencyTextErr != nil {
+			return nil, errors.Wrapf(dependencyTextErr, "Failed to determine discovery info for SNS topic")
+		}
+		depMap[eachTopic.LogicalResourceName()] = string(dependencyText)
+	}
 
 	discoveryInfo, discoveryInfoErr := discoveryInfoForResource(lambdaAWSInfo.LogicalResourceName(),
 		depMap)
@@ -156,6 +177,9 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 			return errors.Errorf("Unable to locate lambda function for annotation")
 		}
 		lambdaResource, lambdaResourceOk := cfResource.Properties.(gocf.LambdaFunction)
+		if extendedLambdaResource, extendedLambdaResourceOk := cfResource.Properties.(lambdaFunction); extendedLambdaResourceOk {
+			lambdaResource, lambdaResourceOk = extendedLambdaResource.LambdaFunction, true
+		}
 		if !lambdaResourceOk {
 			return errors.Errorf("CloudFormation resource exists, but is incorrect type: %s (%v)",
 				cfResource.Properties.CfnResourceType(),
@@ -178,7 +202,7 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 				return errors.Errorf("IAM role not found: %s", resourceRef.ResourceName)
 			}
 			// Coerce to the IAMRole and update the statements
-			typedIAMRole, typedIAMRoleOk := iamRole.Properties.(gocf.IAMRole)
+			typedIAMRole, typedIAMRoleOk := templateIAMRole(iamRole)
 			if !typedIAMRoleOk {
 				return errors.Errorf("Failed to type convert iamRole to proper IAMRole resource")
 			}
@@ -195,6 +219,7 @@ func annotateEventSourceMappings(lambdaAWSInfos []*LambdaAWSInfo,
 					PolicyName: gocf.String("LambdaEventSourceMappingPolicy"),
 				})
 			typedIAMRole.Policies = policyList
+			setTemplateIAMRole(iamRole, typedIAMRole)
 		}
 		return nil
 	}
@@ -5,7 +5,9 @@ package sparta
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -16,8 +18,10 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -26,6 +30,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/signer"
 	humanize "github.com/dustin/go-humanize"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
@@ -72,11 +79,15 @@ func (s3URL *s3UploadURL) keyName() string {
 	return s3URL.path
 }
 
-func newS3UploadURL(s3URL string) *s3UploadURL {
+func newS3UploadURL(s3Bucket string, s3URL string) *s3UploadURL {
 	urlParts, urlPartsErr := url.Parse(s3URL)
 	if nil != urlPartsErr {
 		return nil
 	}
+	objectKey, objectKeyErr := spartaS3.ObjectKey(s3Bucket, s3URL)
+	if nil != objectKeyErr {
+		return nil
+	}
 	queryParams, queryParamsErr := url.ParseQuery(urlParts.RawQuery)
 	if nil != queryParamsErr {
 		return nil
@@ -87,7 +98,7 @@ func newS3UploadURL(s3URL string) *s3UploadURL {
 		version = versionIDValues[0]
 	}
 	return &s3UploadURL{location: s3URL,
-		path:    strings.TrimPrefix(urlParts.Path, "/"),
+		path:    objectKey,
 		version: version}
 }
 
@@ -122,6 +133,7 @@ type workflowStep func(ctx *workflowContext) (workflowStep, error)
 // workflow.
 type workflowStepDuration struct {
 	name     string
+	start    time.Time
 	duration time.Duration
 }
 
@@ -129,6 +141,9 @@ type workflowStepDuration struct {
 type userdata struct {
 	// Is this is a -dry-run?
 	noop bool
+	// Is this a dry run without AWS credentials? Offline builds skip the
+	// AWS API calls and use placeholder values in the template.
+	offline bool
 	// Is this a CGO enabled build?
 	useCGO bool
 	// Are in-place updates enabled?
@@ -156,6 +171,22 @@ type userdata struct {
 	s3SiteContext *s3SiteContext
 	// The user-supplied S3 bucket where service artifacts should be posted.
 	s3Bucket string
+	// Should broad IAM privileges be rejected?
+	strictIAM bool
+	// Should an existing provision lock be released?
+	forceUnlock bool
+	// Should IAM role policies be validated with IAM Access Analyzer?
+	validateIAMPolicies bool
+	// Optional StackSet deployment that replaces the service stack
+	stackSetDeployment *spartaCF.StackSetDeployment
+	// Parameter and capabilities overrides for the stack operations
+	changeSetOptions *spartaCF.ChangeSetOptions
+	// Format of the templateWriter output. Empty values write the template
+	// as a JSON encoded string.
+	templateFormat string
+	// Optional package state. If non-nil, the workflow writes the artifacts
+	// and template to a local directory rather than deploying them.
+	pkg *packageContext
 }
 
 // context is data that is mutated during the provisioning workflow
@@ -165,6 +196,10 @@ type provisionContext struct {
 	// AWS Session to be used for all API calls made in the process of provisioning
 	// this service.
 	awsSession *session.Session
+	// AWS service clients, which may be injected by the WorkflowHooks
+	awsClients *AWSClients
+	// Store that uploads the service artifacts
+	artifactStore ArtifactStore
 	// Cached IAM role name map.  Used to support dynamic and static IAM role
 	// names.  Static ARN role names are checked for existence via AWS APIs
 	// prior to CloudFormation provisioning.
@@ -178,7 +213,9 @@ type provisionContext struct {
 	// name of the binary inside the ZIP archive
 	binaryName string
 	// Context to pass between workflow operations
-	workflowHooksContext map[string]interface{}
+	workflowHooksContext *WorkflowHookContext
+	// Optional interactive progress view
+	progress *provisionProgressView
 }
 
 // similar to context, transaction scopes values that span the entire
@@ -188,9 +225,12 @@ type transaction struct {
 	// Optional rollback functions that workflow steps may append to if they
 	// have made mutations during provisioning.
 	rollbackFunctions []spartaS3.RollbackFunction
-	// Optional finalizer functions that are unconditionally executed following
-	// workflow completion, success or failure
+	// Optional finalizer functions that are executed following
+	// successful workflow completion
 	finalizerFunctions []finalizerFunction
+	// Optional function that releases the provision lock following
+	// workflow completion, success or failure
+	releaseLockFunction finalizerFunction
 	// Timings that measure how long things actually took
 	stepDurations []*workflowStepDuration
 }
@@ -213,12 +253,15 @@ type workflowContext struct {
 
 // recordDuration is a utility function to record how long
 func recordDuration(start time.Time, name string, ctx *workflowContext) {
-	elapsed := time.Since(start)
-	ctx.transaction.stepDurations = append(ctx.transaction.stepDurations,
-		&workflowStepDuration{
-			name:     name,
-			duration: elapsed,
-		})
+	stepDuration := &workflowStepDuration{
+		name:     name,
+		start:    start,
+		duration: time.Since(start),
+	}
+	ctx.transaction.stepDurations = append(ctx.transaction.stepDurations, stepDuration)
+	if ctx.context.progress != nil {
+		ctx.context.progress.stepCompleted(stepDuration)
+	}
 }
 
 // Register a rollback function in the event that the provisioning
@@ -317,7 +360,7 @@ func callRollbackHook(ctx *workflowContext, wg *sync.WaitGroup) error {
 	}
 	for _, eachRollbackHook := range rollbackHooks {
 		wg.Add(1)
-		go func(handler RollbackHookHandler, context map[string]interface{},
+		go func(handler RollbackHookHandler, context *WorkflowHookContext,
 			serviceName string,
 			awsSession *session.Session,
 			noop bool,
@@ -353,34 +396,70 @@ func callServiceDecoratorHook(ctx *workflowContext) error {
 		serviceHooks = append(serviceHooks,
 			ServiceDecoratorHookFunc(ctx.userdata.workflowHooks.ServiceDecorator))
 	}
-	// If there's an API gateway definition, include the resources that provision it.
-	// Since this export will likely
-	// generate outputs that the s3 site needs, we'll use a temporary outputs accumulator,
-	// pass that to the S3Site
-	// if it's defined, and then merge it with the normal output map.-
-	for _, eachServiceHook := range serviceHooks {
-		hookName := runtime.FuncForPC(reflect.ValueOf(eachServiceHook).Pointer()).Name()
-		ctx.logger.WithFields(logrus.Fields{
-			"ServiceDecoratorHook": hookName,
-			"WorkflowHookContext":  ctx.context.workflowHooksContext,
-		}).Info("Calling WorkflowHook")
-
-		serviceTemplate := gocf.NewTemplate()
-		decoratorError := eachServiceHook.DecorateService(ctx.context.workflowHooksContext,
-			ctx.userdata.serviceName,
-			serviceTemplate,
-			ctx.userdata.s3Bucket,
-			codeZipKey(ctx.context.s3CodeZipURL),
-			ctx.userdata.buildID,
-			ctx.context.awsSession,
-			ctx.userdata.noop,
-			ctx.logger)
-		if nil != decoratorError {
-			return decoratorError
-		}
-		safeMergeErrs := gocc.SafeMerge(serviceTemplate, ctx.context.cfTemplate)
-		if len(safeMergeErrs) != 0 {
-			return errors.Errorf("Failed to merge templates: %#v", safeMergeErrs)
+	// Decorators that don't depend on each other may run concurrently. Each
+	// decorator populates its own template, which are merged in
+	// declaration order. The decorators in a layer take turns with the
+	// shared template returned by WorkflowHookContext.Template().
+	decoratorLayers, decoratorLayersErr := serviceDecoratorLayers(serviceHooks)
+	if decoratorLayersErr != nil {
+		return decoratorLayersErr
+	}
+	concurrency := ctx.userdata.workflowHooks.ServiceDecoratorConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	// Decorators that haven't started are skipped after a failure
+	var decoratorFailed int32
+	for _, eachLayer := range decoratorLayers {
+		decoratorTasks := make([]*workTask, 0, len(eachLayer))
+		var templateMutex sync.Mutex
+		for _, eachIndex := range eachLayer {
+			serviceHook := serviceHooks[eachIndex]
+			decoratorTask := func() workResult {
+				serviceTemplate := gocf.NewTemplate()
+				if atomic.LoadInt32(&decoratorFailed) != 0 {
+					return newTaskResult(serviceTemplate, nil)
+				}
+				ctx.logger.WithFields(logrus.Fields{
+					"ServiceDecoratorHook": serviceDecoratorName(serviceHook),
+					"WorkflowHookContext":  ctx.context.workflowHooksContext,
+				}).Info("Calling WorkflowHook")
+
+				decoratorContext := ctx.context.workflowHooksContext.decoratorScope(&templateMutex)
+				defer decoratorContext.releaseTemplate()
+				decoratorError := serviceHook.DecorateService(decoratorContext,
+					ctx.userdata.serviceName,
+					serviceTemplate,
+					ctx.userdata.s3Bucket,
+					codeZipKey(ctx.context.s3CodeZipURL),
+					ctx.userdata.buildID,
+					ctx.context.awsSession,
+					ctx.userdata.noop,
+					ctx.logger)
+				if decoratorError != nil {
+					atomic.StoreInt32(&decoratorFailed, 1)
+				}
+				return newTaskResult(serviceTemplate, decoratorError)
+			}
+			decoratorTasks = append(decoratorTasks, newWorkTask(decoratorTask))
+		}
+		layerConcurrency := concurrency
+		if layerConcurrency > len(decoratorTasks) {
+			layerConcurrency = len(decoratorTasks)
+		}
+		p := newWorkerPool(decoratorTasks, layerConcurrency)
+		_, decoratorErrors := p.Run()
+		if len(decoratorErrors) == 1 {
+			return decoratorErrors[0]
+		} else if len(decoratorErrors) > 1 {
+			return errors.Errorf("Encountered multiple errors during service decoration: %#v", decoratorErrors)
+		}
+		for _, eachTask := range p.Tasks {
+			serviceTemplate := eachTask.Result.Result().(*gocf.Template)
+			safeMergeErrs := gocc.SafeMerge(serviceTemplate, ctx.context.cfTemplate)
+			if len(safeMergeErrs) != 0 {
+				return errors.Errorf("Failed to merge templates: %#v", safeMergeErrs)
+			}
 		}
 	}
 	return nil
@@ -524,6 +603,22 @@ func versionAwareS3KeyName(s3DefaultKey string, s3VersioningEnabled bool, logger
 	return versionKeyName, nil
 }
 
+// fileSHA256 returns the hex encoded SHA-256 hash of the file contents
+func fileSHA256(localPath string) (string, error) {
+	/* #nosec */
+	fileReader, fileReaderErr := os.Open(localPath)
+	if nil != fileReaderErr {
+		return "", errors.Wrapf(fileReaderErr, "Failed to open file: %s", localPath)
+	}
+	defer fileReader.Close()
+	hash := sha256.New()
+	_, copyErr := io.Copy(hash, fileReader)
+	if nil != copyErr {
+		return "", errors.Wrapf(copyErr, "Failed to hash file: %s", localPath)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // Upload a local file to S3.  Returns the full S3 URL to the file that was
 // uploaded. If the target bucket does not have versioning enabled,
 // this function will automatically make a new key to ensure uniqueness
@@ -543,6 +638,10 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 		s3ObjectKey = s3KeyName
 	}
 
+	// Packaged artifacts are only optionally uploaded
+	if ctx.userdata.pkg != nil {
+		return ctx.userdata.pkg.addArtifact(localPath, s3ObjectKey, ctx)
+	}
 	s3URL := ""
 	if ctx.userdata.noop {
 
@@ -565,20 +664,130 @@ func uploadLocalFileToS3(localPath string, s3ObjectKey string, ctx *workflowCont
 		// Make sure we mark things for cleanup in case there's a problem
 		ctx.registerFileCleanupFinalizer(localPath)
 		// Then upload it
-		uploadLocation, uploadURLErr := spartaS3.UploadLocalFileToS3(localPath,
-			ctx.context.awsSession,
+		var uploadProgress spartaS3.UploadProgressFunc
+		if ctx.context.progress != nil {
+			uploadProgress = ctx.context.progress.uploadProgress(filepath.Base(localPath))
+		}
+		uploadLocation, uploadURLErr := ctx.context.artifactStore.Upload(localPath,
 			ctx.userdata.s3Bucket,
 			s3ObjectKey,
+			uploadProgress,
 			ctx.logger)
 		if nil != uploadURLErr {
 			return "", errors.Wrapf(uploadURLErr, "Failed to upload local file to S3")
 		}
 		s3URL = uploadLocation
-		ctx.registerRollback(spartaS3.CreateS3RollbackFunc(ctx.context.awsSession, uploadLocation))
+		ctx.registerRollback(artifactRollbackFunc(ctx.context.artifactStore,
+			ctx.userdata.s3Bucket,
+			uploadLocation))
 	}
 	return s3URL, nil
 }
 
+// signCodeArchive signs the uploaded code archive with the AWS Signer
+// profile and updates the workflow context to reference the signed archive
+func signCodeArchive(profileName string, ctx *workflowContext) error {
+	codeZipURL := ctx.context.s3CodeZipURL
+	if ctx.userdata.noop {
+		ctx.logger.WithFields(logrus.Fields{
+			"Bucket":      ctx.userdata.s3Bucket,
+			"Key":         codeZipKey(codeZipURL),
+			"ProfileName": profileName,
+		}).Info(noopMessage("Code signing"))
+		return nil
+	}
+	if codeZipVersion(codeZipURL) == "" {
+		return errors.Errorf("Code signing requires an S3 bucket with versioning enabled: %s",
+			ctx.userdata.s3Bucket)
+	}
+	signerSvc := signer.New(ctx.context.awsSession)
+	startJobResponse, startJobErr := signerSvc.StartSigningJob(&signer.StartSigningJobInput{
+		ProfileName: aws.String(profileName),
+		Source: &signer.Source{
+			S3: &signer.S3Source{
+				BucketName: aws.String(ctx.userdata.s3Bucket),
+				Key:        aws.String(codeZipURL.keyName()),
+				Version:    aws.String(codeZipURL.version),
+			},
+		},
+		Destination: &signer.Destination{
+			S3: &signer.S3Destination{
+				BucketName: aws.String(ctx.userdata.s3Bucket),
+				Prefix:     aws.String(fmt.Sprintf("%s/signed-", ctx.userdata.serviceName)),
+			},
+		},
+	})
+	if startJobErr != nil {
+		return errors.Wrapf(startJobErr, "Failed to start signing job")
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"JobID":       aws.StringValue(startJobResponse.JobId),
+		"ProfileName": profileName,
+	}).Info("Signing code archive")
+
+	describeInput := &signer.DescribeSigningJobInput{
+		JobId: startJobResponse.JobId,
+	}
+	waitErr := signerSvc.WaitUntilSuccessfulSigningJob(describeInput)
+	if waitErr != nil {
+		return errors.Wrapf(waitErr, "Signing job %s failed", aws.StringValue(startJobResponse.JobId))
+	}
+	describeResponse, describeErr := signerSvc.DescribeSigningJob(describeInput)
+	if describeErr != nil {
+		return errors.Wrapf(describeErr, "Failed to describe signing job")
+	}
+	if describeResponse.SignedObject == nil || describeResponse.SignedObject.S3 == nil {
+		return errors.Errorf("Signing job %s did not produce a signed object",
+			aws.StringValue(startJobResponse.JobId))
+	}
+	// The function Code references the signed object, so use the bucket, key
+	// and version that the signing job actually wrote
+	signedBucket := aws.StringValue(describeResponse.SignedObject.S3.BucketName)
+	signedKey := aws.StringValue(describeResponse.SignedObject.S3.Key)
+	if signedBucket != ctx.userdata.s3Bucket {
+		return errors.Errorf("Signing job %s wrote the signed object to an unexpected bucket: %s",
+			aws.StringValue(startJobResponse.JobId),
+			signedBucket)
+	}
+	s3Svc := ctx.context.awsClients.S3
+	headResponse, headErr := s3Svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(signedBucket),
+		Key:    aws.String(signedKey),
+	})
+	if headErr != nil {
+		return errors.Wrapf(headErr, "Failed to read signed object version: %s", signedKey)
+	}
+	signedVersion := aws.StringValue(headResponse.VersionId)
+	if signedVersion == "" {
+		return errors.Errorf("Signed object %s doesn't have a version", signedKey)
+	}
+	// Let the client resolve the object URL, rather than assuming the
+	// endpoint format
+	signedRequest, _ := s3Svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:    aws.String(signedBucket),
+		Key:       aws.String(signedKey),
+		VersionId: aws.String(signedVersion),
+	})
+	buildErr := signedRequest.Build()
+	if buildErr != nil {
+		return errors.Wrapf(buildErr, "Failed to build signed object URL: %s", signedKey)
+	}
+	signedURL := signedRequest.HTTPRequest.URL.String()
+	ctx.registerRollback(artifactRollbackFunc(ctx.context.artifactStore,
+		signedBucket,
+		signedURL))
+	ctx.context.s3CodeZipURL = &s3UploadURL{
+		location: signedURL,
+		path:     signedKey,
+		version:  signedVersion,
+	}
+	ctx.logger.WithFields(logrus.Fields{
+		"Key":     signedKey,
+		"Version": signedVersion,
+	}).Info("Signed code archive")
+	return nil
+}
+
 // Private - END
 ////////////////////////////////////////////////////////////////////////////////
 
@@ -601,6 +810,109 @@ func showOptionalAWSUsageInfo(err error, logger *logrus.Logger) {
 	}
 }
 
+// splitNestedStacks moves the template resources into nested stacks
+// according to the user supplied grouping and uploads the nested
+// stack templates
+func splitNestedStacks(groupFunc spartaCF.NestedStackGroupFunc, ctx *workflowContext) error {
+	// Lambda functions and their discovery dependencies remain in the
+	// service stack so that sparta.Discover() can find them
+	pinnedResources := make(map[string]bool)
+	for _, eachLambda := range ctx.userdata.lambdaAWSInfos {
+		pinnedResources[eachLambda.LogicalResourceName()] = true
+		for _, eachDependsOn := range eachLambda.DependsOn {
+			pinnedResources[eachDependsOn] = true
+		}
+	}
+	pinnedGroupFunc := func(logicalResourceName string, resource *gocf.Resource) string {
+		if pinnedResources[logicalResourceName] {
+			return ""
+		}
+		return groupFunc(logicalResourceName, resource)
+	}
+	sanitizedServiceName := sanitizedName(ctx.userdata.serviceName)
+	templateURLFunc := func(stackResourceName string, template *gocf.Template) (string, error) {
+		templateJSON, templateJSONErr := json.Marshal(template)
+		if templateJSONErr != nil {
+			return "", errors.Wrapf(templateJSONErr, "Failed to marshal nested stack template")
+		}
+		limitsErr := validateTemplateLimits(nil, template, templateJSON, ctx.logger)
+		if limitsErr != nil {
+			return "", errors.Wrapf(limitsErr, "Nested stack %s exceeds limits", stackResourceName)
+		}
+		templateName := fmt.Sprintf("%s-%s-cftemplate.json", sanitizedServiceName, stackResourceName)
+		templateFile, templateFileErr := system.TemporaryFile(ScratchDirectory, templateName)
+		if templateFileErr != nil {
+			return "", templateFileErr
+		}
+		_, writeErr := templateFile.Write(templateJSON)
+		closeErr := templateFile.Close()
+		if writeErr != nil {
+			return "", writeErr
+		}
+		if closeErr != nil {
+			return "", closeErr
+		}
+		ctx.logger.WithFields(logrus.Fields{
+			"NestedStack": stackResourceName,
+			"Resources":   len(template.Resources),
+		}).Info("Creating nested stack")
+		return uploadLocalFileToS3(templateFile.Name(), "", ctx)
+	}
+	return spartaCF.SplitNestedStacks(ctx.context.cfTemplate,
+		pinnedGroupFunc,
+		templateURLFunc)
+}
+
+// provisionChangeSetOptions returns the WorkflowHooks ChangeSetOptions
+// with the --parameter overrides applied
+func provisionChangeSetOptions(workflowHooks *WorkflowHooks,
+	parameterOverrides []string) (*spartaCF.ChangeSetOptions, error) {
+	changeSetOptions := &spartaCF.ChangeSetOptions{}
+	if workflowHooks != nil && workflowHooks.ChangeSetOptions != nil {
+		changeSetOptions.Capabilities = workflowHooks.ChangeSetOptions.Capabilities
+		changeSetOptions.Parameters = append(changeSetOptions.Parameters,
+			workflowHooks.ChangeSetOptions.Parameters...)
+	}
+	overrides, overridesErr := spartaCF.ParseParameterOverrides(parameterOverrides)
+	if overridesErr != nil {
+		return nil, overridesErr
+	}
+	for _, eachOverride := range overrides {
+		replaced := false
+		for eachIndex, eachParameter := range changeSetOptions.Parameters {
+			if aws.StringValue(eachParameter.ParameterKey) == aws.StringValue(eachOverride.ParameterKey) {
+				changeSetOptions.Parameters[eachIndex] = eachOverride
+				replaced = true
+			}
+		}
+		if !replaced {
+			changeSetOptions.Parameters = append(changeSetOptions.Parameters, eachOverride)
+		}
+	}
+	return changeSetOptions, nil
+}
+
+// offlineIAMRoleArn returns the placeholder Arn for an existing IAM role
+// in offline builds. The Arn assumes the role doesn't have a path.
+func offlineIAMRoleArn(roleName string) *gocf.StringExpr {
+	return gocf.Join("",
+		gocf.String("arn:"),
+		gocf.Ref("AWS::Partition"),
+		gocf.String(":iam::"),
+		gocf.Ref("AWS::AccountId"),
+		gocf.String(fmt.Sprintf(":role/%s", roleName)))
+}
+
+// awsCredentialsAvailable returns nil if the session can resolve AWS
+// credentials
+func awsCredentialsAvailable(awsSession *session.Session) error {
+	if awsSession == nil {
+		return errors.New("AWS session unavailable")
+	}
+	_, credentialsErr := awsSession.Config.Credentials.Get()
+	return credentialsErr
+}
+
 // Verify & cache the IAM rolename to ARN mapping
 func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 	defer recordDuration(time.Now(), "Verifying IAM roles", ctx)
@@ -610,7 +922,7 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 	// Don't verify them, just create them...
 	ctx.logger.Info("Verifying IAM Lambda execution roles")
 	ctx.context.lambdaIAMRoleNameMap = make(map[string]*gocf.StringExpr)
-	iamSvc := iam.New(ctx.context.awsSession)
+	iamSvc := ctx.context.awsClients.IAM
 
 	// Assemble all the RoleNames and validate the inline IAMRoleDefinitions
 	var allRoleNames []string
@@ -635,6 +947,12 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 			}
 		}
 
+		// The role must include the Lambda Insights policy
+		if ctx.userdata.workflowHooks != nil {
+			applyDefaultLambdaInsights(eachLambdaInfo, ctx.userdata.workflowHooks.LambdaInsights)
+		}
+		lambdaInsights := eachLambdaInfo.Options != nil && eachLambdaInfo.Options.LambdaInsights != nil
+
 		// Validate the IAMRoleDefinitions associated
 		if nil != eachLambdaInfo.RoleDefinition {
 			logicalName := eachLambdaInfo.RoleDefinition.logicalName(ctx.userdata.serviceName, eachLambdaInfo.lambdaFunctionName())
@@ -648,7 +966,23 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 						ctx.logger))
 
 				ctx.context.lambdaIAMRoleNameMap[logicalName] = gocf.GetAtt(logicalName, "Arn")
+			} else {
+				// Shared roles include the privileges that each function
+				// requires, and the policy if any function enables Lambda
+				// Insights
+				roleResource := ctx.context.cfTemplate.Resources[logicalName]
+				addSharedRoleStatements(roleResource,
+					lambdaRoleStatements(eachLambdaInfo.EventSourceMappings,
+						eachLambdaInfo.Options))
+				if lambdaInsights {
+					addLambdaInsightsPolicy(roleResource)
+				}
 			}
+		} else if lambdaInsights {
+			ctx.logger.WithFields(logrus.Fields{
+				"Function": eachLambdaInfo.lambdaFunctionName(),
+				"RoleName": eachLambdaInfo.RoleName,
+			}).Warn("Lambda Insights requires the CloudWatchLambdaInsightsExecutionRolePolicy managed policy to be attached to the execution role")
 		}
 
 		// And the custom resource IAMRoles as well...
@@ -669,10 +1003,39 @@ func verifyIAMRoles(ctx *workflowContext) (workflowStep, error) {
 		}
 	}
 
+	// Validate the Sparta-managed role policies
+	if ctx.userdata.validateIAMPolicies && ctx.userdata.offline {
+		ctx.logger.Warn("Skipping IAM Access Analyzer policy validation in offline build")
+	} else if ctx.userdata.validateIAMPolicies {
+		roleResourceNames := make([]string, 0)
+		for eachRoleName := range ctx.context.lambdaIAMRoleNameMap {
+			roleResourceNames = append(roleResourceNames, eachRoleName)
+		}
+		sort.Strings(roleResourceNames)
+		ctx.logger.WithFields(logrus.Fields{
+			"Count": len(roleResourceNames),
+		}).Info("Validating IAM role policies with IAM Access Analyzer")
+		validationErr := validateIAMRolePolicies(roleResourceNames,
+			ctx.userdata.serviceName,
+			ctx.context.cfTemplate,
+			ctx.context.awsSession,
+			ctx.logger)
+		if validationErr != nil {
+			return nil, validationErr
+		}
+	}
 	// Then check all the RoleName literals
 	for _, eachRoleName := range allRoleNames {
 		_, exists := ctx.context.lambdaIAMRoleNameMap[eachRoleName]
 		if !exists {
+			// Offline builds can't resolve the Arn
+			if ctx.userdata.offline {
+				ctx.logger.WithFields(logrus.Fields{
+					"RoleName": eachRoleName,
+				}).Warn("Using placeholder Arn for IAM role in offline build")
+				ctx.context.lambdaIAMRoleNameMap[eachRoleName] = offlineIAMRoleArn(eachRoleName)
+				continue
+			}
 			// Check the role
 			params := &iam.GetRoleInput{
 				RoleName: aws.String(eachRoleName),
@@ -703,14 +1066,20 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 		ctx.logger.WithFields(logrus.Fields{
 			"VersioningEnabled": false,
 			"Bucket":            ctx.userdata.s3Bucket,
-			"Region":            *ctx.context.awsSession.Config.Region,
+			"Region":            aws.StringValue(ctx.context.awsSession.Config.Region),
 		}).Info(noopMessage("S3 preconditions check"))
+	} else if ctx.userdata.pkg != nil && !ctx.userdata.pkg.upload {
+		// Artifacts that aren't uploaded use unique keys since
+		// the bucket's versioning policy is unknown
+		ctx.logger.WithFields(logrus.Fields{
+			"Bucket": ctx.userdata.s3Bucket,
+		}).Info("Bypassing S3 preconditions check for local package")
 	} else if len(ctx.userdata.lambdaAWSInfos) != 0 {
 		// We only need to check this if we're going to upload a ZIP, which
 		// isn't always true in the case of a Step function...
 		// Bucket versioning
 		// Get the S3 bucket and see if it has versioning enabled
-		isEnabled, versioningPolicyErr := spartaS3.BucketVersioningEnabled(ctx.context.awsSession,
+		isEnabled, versioningPolicyErr := spartaS3.BucketVersioningEnabledWithClient(ctx.context.awsClients.S3,
 			ctx.userdata.s3Bucket,
 			ctx.logger)
 		if nil != versioningPolicyErr {
@@ -730,7 +1099,7 @@ func verifyAWSPreconditions(ctx *workflowContext) (workflowStep, error) {
 			The name of the Amazon S3 bucket where the .zip file that contains your deployment package is stored. This bucket must reside in the same AWS Region that you're creating the Lambda function in. You can specify a bucket from another AWS account as long as the Lambda function and the bucket are in the same region.
 		*/
 
-		bucketRegion, bucketRegionErr := spartaS3.BucketRegion(ctx.context.awsSession,
+		bucketRegion, bucketRegionErr := spartaS3.BucketRegionWithClient(ctx.context.awsClients.S3,
 			ctx.userdata.s3Bucket,
 			ctx.logger)
 
@@ -857,33 +1226,10 @@ func createPackageStep() workflowStep {
 			"TempName": relativePath(tmpFile.Name()),
 		}).Info("Creating code ZIP archive for upload")
 		lambdaArchive := zip.NewWriter(tmpFile)
-
-		// Archive Hook
-		archiveErr := callArchiveHook(lambdaArchive, ctx)
+		archiveErr := writeCodeArchive(lambdaArchive, ctx)
 		if nil != archiveErr {
 			return nil, archiveErr
 		}
-		// Issue: https://github.com/mweagle/Sparta/issues/103. If the executable
-		// bit isn't set, then AWS Lambda won't be able to fork the binary
-		var fileHeaderAnnotator spartaZip.FileHeaderAnnotator
-		if runtime.GOOS == "windows" || runtime.GOOS == "android" {
-			fileHeaderAnnotator = func(header *zip.FileHeader) (*zip.FileHeader, error) {
-				// Make the binary executable
-				// Ref: https://github.com/aws/aws-lambda-go/blob/master/cmd/build-lambda-zip/main.go#L51
-				header.CreatorVersion = 3 << 8
-				header.ExternalAttrs = 0777 << 16
-				return header, nil
-			}
-		}
-		// File info for the binary executable
-		readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
-			ctx.context.binaryName,
-			"",
-			fileHeaderAnnotator,
-			ctx.logger)
-		if nil != readerErr {
-			return nil, readerErr
-		}
 		archiveCloseErr := lambdaArchive.Close()
 		if nil != archiveCloseErr {
 			return nil, archiveCloseErr
@@ -896,6 +1242,51 @@ func createPackageStep() workflowStep {
 	}
 }
 
+// writeCodeArchive adds the ArchiveHooks files, the service binary and the
+// optional streaming bootstrap to the code archive
+func writeCodeArchive(lambdaArchive *zip.Writer, ctx *workflowContext) error {
+	// Archive Hook
+	archiveErr := callArchiveHook(lambdaArchive, ctx)
+	if nil != archiveErr {
+		return archiveErr
+	}
+	// File info for the binary executable
+	readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
+		ctx.context.binaryName,
+		"",
+		binaryFileHeaderAnnotator(),
+		ctx.logger)
+	if nil != readerErr {
+		return readerErr
+	}
+	// Streaming functions use a custom runtime that launches the
+	// bootstrap executable
+	for _, eachLambda := range ctx.userdata.lambdaAWSInfos {
+		if !isStreamingLambda(eachLambda) {
+			continue
+		}
+		return addStreamingBootstrap(lambdaArchive)
+	}
+	return nil
+}
+
+// binaryFileHeaderAnnotator returns the annotator that marks the binary
+// as executable in the code archive.
+// Issue: https://github.com/mweagle/Sparta/issues/103. If the executable
+// bit isn't set, then AWS Lambda won't be able to fork the binary
+func binaryFileHeaderAnnotator() spartaZip.FileHeaderAnnotator {
+	if runtime.GOOS != "windows" && runtime.GOOS != "android" {
+		return nil
+	}
+	return func(header *zip.FileHeader) (*zip.FileHeader, error) {
+		// Make the binary executable
+		// Ref: https://github.com/aws/aws-lambda-go/blob/master/cmd/build-lambda-zip/main.go#L51
+		header.CreatorVersion = 3 << 8
+		header.ExternalAttrs = 0777 << 16
+		return header, nil
+	}
+}
+
 // Given the zipped binary in packagePath, upload the primary code bundle
 // and optional S3 site resources iff they're defined.
 func createUploadStep(packagePath string) workflowStep {
@@ -908,12 +1299,34 @@ func createUploadStep(packagePath string) workflowStep {
 			uploadBinaryTask := func() workResult {
 				logFilesize("Lambda code archive size", packagePath, ctx.logger)
 
+				// The archive hash determines whether a new version is published
+				codeArchiveSHA256, codeArchiveSHA256Err := fileSHA256(packagePath)
+				if nil != codeArchiveSHA256Err {
+					return newTaskResult(nil, codeArchiveSHA256Err)
+				}
+				ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyCodeArchiveSHA256,
+					codeArchiveSHA256)
+
 				// Create the S3 key...
 				zipS3URL, zipS3URLErr := uploadLocalFileToS3(packagePath, "", ctx)
 				if nil != zipS3URLErr {
 					return newTaskResult(nil, zipS3URLErr)
 				}
-				ctx.context.s3CodeZipURL = newS3UploadURL(zipS3URL)
+				ctx.context.s3CodeZipURL = newS3UploadURL(ctx.userdata.s3Bucket, zipS3URL)
+
+				// Optionally sign the archive
+				signingProfileName, signingProfileErr := codeSigningProfileName(ctx.userdata.lambdaAWSInfos)
+				if signingProfileErr != nil {
+					return newTaskResult(nil, signingProfileErr)
+				}
+				if signingProfileName != "" {
+					signErr := signCodeArchive(signingProfileName, ctx)
+					if signErr != nil {
+						return newTaskResult(nil, signErr)
+					}
+				}
+				ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyCodeArchiveURL,
+					ctx.context.s3CodeZipURL.location)
 				return newTaskResult(ctx.context.s3CodeZipURL, nil)
 			}
 			uploadTasks = append(uploadTasks, newWorkTask(uploadBinaryTask))
@@ -924,6 +1337,14 @@ func createUploadStep(packagePath string) workflowStep {
 		// We might need to upload some other things...
 		if nil != ctx.userdata.s3SiteContext.s3Site {
 			uploadSiteTask := func() workResult {
+				// Build the resources before they're archived
+				buildHook := ctx.userdata.s3SiteContext.s3Site.BuildHook
+				if buildHook != nil {
+					buildErr := buildHook.run(ctx.logger)
+					if buildErr != nil {
+						return newTaskResult(nil, buildErr)
+					}
+				}
 				tempName := fmt.Sprintf("%s-S3Site.zip", ctx.userdata.serviceName)
 				tmpFile, err := system.TemporaryFile(ScratchDirectory, tempName)
 				if err != nil {
@@ -966,7 +1387,8 @@ func createUploadStep(packagePath string) workflowStep {
 					return newTaskResult(nil,
 						errors.Wrapf(s3SiteLambdaZipURLErr, "Failed to upload local file to S3"))
 				}
-				ctx.userdata.s3SiteContext.s3UploadURL = newS3UploadURL(s3SiteLambdaZipURL)
+				ctx.userdata.s3SiteContext.s3UploadURL = newS3UploadURL(ctx.userdata.s3Bucket,
+					s3SiteLambdaZipURL)
 				return newTaskResult(ctx.userdata.s3SiteContext.s3UploadURL, nil)
 			}
 			uploadTasks = append(uploadTasks, newWorkTask(uploadSiteTask))
@@ -1079,40 +1501,81 @@ func createCodePipelineTriggerPackage(cfTemplateJSON []byte, ctx *workflowContex
 	return tmpFile.Name(), nil
 }
 
-// If the only detected changes to a stack are Lambda code updates,
-// then update use the LAmbda API to update the code directly
-// rather than waiting for CloudFormation
-func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*cloudformation.Stack, error) {
+// inPlaceUpdateTask returns the task that applies the function's
+// configuration update and then the code update, waiting for each update to
+// complete. Either request may be nil.
+func inPlaceUpdateTask(lambdaSvc lambdaiface.LambdaAPI,
+	configurationRequest *lambda.UpdateFunctionConfigurationInput,
+	codeRequest *lambda.UpdateFunctionCodeInput) taskFunc {
+	return func() workResult {
+		if configurationRequest != nil {
+			_, updateConfigurationErr := lambdaSvc.UpdateFunctionConfiguration(configurationRequest)
+			if updateConfigurationErr != nil {
+				return newTaskResult("", updateConfigurationErr)
+			}
+			// The code can't be updated until the configuration update completes
+			waitErr := waitForFunctionUpdate(newLambdaUpdateStatusReader(lambdaSvc),
+				aws.StringValue(configurationRequest.FunctionName),
+				lambdaUpdateStatusTimeout)
+			if waitErr != nil {
+				return newTaskResult("", waitErr)
+			}
+		}
+		if codeRequest != nil {
+			_, updateCodeErr := lambdaSvc.UpdateFunctionCode(codeRequest)
+			if updateCodeErr != nil {
+				return newTaskResult("", updateCodeErr)
+			}
+			waitErr := waitForFunctionUpdate(newLambdaUpdateStatusReader(lambdaSvc),
+				aws.StringValue(codeRequest.FunctionName),
+				lambdaUpdateStatusTimeout)
+			if waitErr != nil {
+				return newTaskResult("", waitErr)
+			}
+		}
+		return newTaskResult("", nil)
+	}
+}
+
+// If the only detected changes to a stack are Lambda code and
+// configuration (Environment, MemorySize, Timeout, Layers) updates,
+// then use the Lambda API to update the functions directly
+// rather than waiting for CloudFormation. The applied function changes
+// are returned so that they can be reverted.
+func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*cloudformation.Stack, []*inPlaceFunctionChange, error) {
 	// Get the updates...
-	awsCloudFormation := cloudformation.New(ctx.context.awsSession)
+	awsCloudFormation := ctx.context.awsClients.CloudFormation
 	changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sInPlaceChangeSet", ctx.userdata.serviceName))
-	changes, changesErr := spartaCF.CreateStackChangeSet(changeSetRequestName,
+	changes, changesErr := spartaCF.CreateStackChangeSetWithOptions(changeSetRequestName,
 		ctx.userdata.serviceName,
 		ctx.context.cfTemplate,
 		templateURL,
 		nil,
+		cloudformation.ChangeSetTypeUpdate,
+		ctx.userdata.changeSetOptions,
 		awsCloudFormation,
 		ctx.logger)
 	if nil != changesErr {
-		return nil, changesErr
+		return nil, nil, changesErr
 	}
 	if nil == changes || len(changes.Changes) <= 0 {
-		return nil, fmt.Errorf("no changes detected")
+		return nil, nil, fmt.Errorf("no changes detected")
 	}
-	updateCodeRequests := []*lambda.UpdateFunctionCodeInput{}
+	functionChanges := []*inPlaceFunctionChange{}
 	invalidInPlaceRequests := []string{}
 	for _, eachChange := range changes.Changes {
 		resourceChange := eachChange.ResourceChange
 		if *resourceChange.Action == "Modify" && *resourceChange.ResourceType == "AWS::Lambda::Function" {
-			updateCodeRequest := &lambda.UpdateFunctionCodeInput{
-				FunctionName: resourceChange.PhysicalResourceId,
-				S3Bucket:     aws.String(ctx.userdata.s3Bucket),
-				S3Key:        aws.String(ctx.context.s3CodeZipURL.keyName()),
-			}
-			if ctx.context.s3CodeZipURL != nil && ctx.context.s3CodeZipURL.version != "" {
-				updateCodeRequest.S3ObjectVersion = aws.String(ctx.context.s3CodeZipURL.version)
+			functionChange, unsupportedChanges := newInPlaceFunctionChange(resourceChange)
+			for _, eachUnsupportedChange := range unsupportedChanges {
+				invalidInPlaceRequests = append(invalidInPlaceRequests,
+					fmt.Sprintf("%s for %s (ResourceType: %s, Property: %s)",
+						*resourceChange.Action,
+						*resourceChange.LogicalResourceId,
+						*resourceChange.ResourceType,
+						eachUnsupportedChange))
 			}
-			updateCodeRequests = append(updateCodeRequests, updateCodeRequest)
+			functionChanges = append(functionChanges, functionChange)
 		} else {
 			invalidInPlaceRequests = append(invalidInPlaceRequests,
 				fmt.Sprintf("%s for %s (ResourceType: %s)",
@@ -1122,30 +1585,52 @@ func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*clo
 		}
 	}
 	if len(invalidInPlaceRequests) != 0 {
-		return nil, fmt.Errorf("unsupported in-place operations detected:\n\t%s", strings.Join(invalidInPlaceRequests, ",\n\t"))
+		return nil, nil, fmt.Errorf("unsupported in-place operations detected:\n\t%s", strings.Join(invalidInPlaceRequests, ",\n\t"))
+	}
+
+	// Each function's configuration and code are updated serially, since
+	// Lambda rejects concurrent updates to the same function
+	awsLambda := ctx.context.awsClients.Lambda
+	updateCodeRequests := []*lambda.UpdateFunctionCodeInput{}
+	updateConfigurationRequests := []*lambda.UpdateFunctionConfigurationInput{}
+	inPlaceUpdateTasks := []*workTask{}
+	for _, eachFunctionChange := range functionChanges {
+		updateConfigurationRequest, updateConfigurationRequestErr := inPlaceFunctionConfiguration(eachFunctionChange,
+			ctx.context.cfTemplate,
+			awsLambda)
+		if updateConfigurationRequestErr != nil {
+			return nil, nil, errors.Wrapf(updateConfigurationRequestErr,
+				"unsupported in-place configuration update for %s",
+				eachFunctionChange.logicalResourceID)
+		}
+		var updateCodeRequest *lambda.UpdateFunctionCodeInput
+		if eachFunctionChange.codeChanged {
+			updateCodeRequest = &lambda.UpdateFunctionCodeInput{
+				FunctionName: aws.String(eachFunctionChange.functionName),
+				S3Bucket:     aws.String(ctx.userdata.s3Bucket),
+				S3Key:        aws.String(ctx.context.s3CodeZipURL.keyName()),
+			}
+			if ctx.context.s3CodeZipURL != nil && ctx.context.s3CodeZipURL.version != "" {
+				updateCodeRequest.S3ObjectVersion = aws.String(ctx.context.s3CodeZipURL.version)
+			}
+			updateCodeRequests = append(updateCodeRequests, updateCodeRequest)
+		}
+		if updateConfigurationRequest != nil {
+			updateConfigurationRequests = append(updateConfigurationRequests, updateConfigurationRequest)
+		}
+		inPlaceUpdateTasks = append(inPlaceUpdateTasks,
+			newWorkTask(inPlaceUpdateTask(awsLambda, updateConfigurationRequest, updateCodeRequest)))
 	}
 
 	ctx.logger.WithFields(logrus.Fields{
-		"FunctionCount": len(updateCodeRequests),
-	}).Info("Updating Lambda function code")
+		"FunctionCount":      len(updateCodeRequests),
+		"ConfigurationCount": len(updateConfigurationRequests),
+	}).Info("Updating Lambda functions")
 	ctx.logger.WithFields(logrus.Fields{
-		"Updates": updateCodeRequests,
+		"Updates":              updateCodeRequests,
+		"ConfigurationUpdates": updateConfigurationRequests,
 	}).Debug("Update requests")
 
-	updateTaskMaker := func(lambdaSvc *lambda.Lambda, request *lambda.UpdateFunctionCodeInput) taskFunc {
-		return func() workResult {
-			_, updateResultErr := lambdaSvc.UpdateFunctionCode(request)
-			return newTaskResult("", updateResultErr)
-		}
-	}
-	inPlaceUpdateTasks := make([]*workTask,
-		len(updateCodeRequests))
-	awsLambda := lambda.New(ctx.context.awsSession)
-	for eachIndex, eachUpdateCodeRequest := range updateCodeRequests {
-		updateTask := updateTaskMaker(awsLambda, eachUpdateCodeRequest)
-		inPlaceUpdateTasks[eachIndex] = newWorkTask(updateTask)
-	}
-
 	// Add the request to delete the change set...
 	// TODO: add some retry logic in here to handle failures.
 	deleteChangeSetTask := func() workResult {
@@ -1158,7 +1643,7 @@ func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*clo
 	p := newWorkerPool(inPlaceUpdateTasks, len(inPlaceUpdateTasks))
 	_, asyncErrors := p.Run()
 	if len(asyncErrors) != 0 {
-		return nil, fmt.Errorf("failed to update function code: %v", asyncErrors)
+		return nil, nil, fmt.Errorf("failed to update functions: %v", asyncErrors)
 	}
 	// Describe the stack so that we can satisfy the contract with the
 	// normal path using CloudFormation
@@ -1167,9 +1652,41 @@ func applyInPlaceFunctionUpdates(ctx *workflowContext, templateURL string) (*clo
 	}
 	describeStackOutput, describeStackOutputErr := awsCloudFormation.DescribeStacks(describeStacksInput)
 	if nil != describeStackOutputErr {
-		return nil, describeStackOutputErr
+		return nil, nil, describeStackOutputErr
 	}
-	return describeStackOutput.Stacks[0], nil
+	return describeStackOutput.Stacks[0], functionChanges, nil
+}
+
+// writeTemplate writes the template to the templateWriter in the requested
+// format. The legacyTemplate is the JSON encoded template string.
+func writeTemplate(templateWriter io.Writer,
+	templateFormat string,
+	cfTemplate []byte,
+	legacyTemplate []byte) error {
+
+	var output []byte
+	switch templateFormat {
+	case TemplateFormatYAML:
+		yamlTemplate, yamlTemplateErr := spartaCF.JSONToYAML(cfTemplate)
+		if yamlTemplateErr != nil {
+			return yamlTemplateErr
+		}
+		output = yamlTemplate
+	case TemplateFormatJSON:
+		var indented bytes.Buffer
+		indentErr := json.Indent(&indented, cfTemplate, "", "  ")
+		if indentErr != nil {
+			return indentErr
+		}
+		indented.WriteString("\n")
+		output = indented.Bytes()
+	case "":
+		output = legacyTemplate
+	default:
+		return errors.Errorf("Unsupported template format: %s", templateFormat)
+	}
+	_, writeErr := templateWriter.Write(output)
+	return writeErr
 }
 
 // applyCloudFormationOperation is responsible for taking the current template
@@ -1183,6 +1700,29 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 	if len(ctx.userdata.buildTags) != 0 {
 		stackTags[SpartaTagBuildTagsKey] = ctx.userdata.buildTags
 	}
+	if ctx.userdata.workflowHooks != nil {
+		for eachKey, eachValue := range ctx.userdata.workflowHooks.Tags {
+			stackTags[eachKey] = eachValue
+		}
+	}
+
+	// Regular stack updates record the deployment so that it can be
+	// rolled back. The template is uploaded to a unique key.
+	templateKey := ""
+	recordDeployment := ctx.userdata.pkg == nil &&
+		ctx.userdata.codePipelineTrigger == "" &&
+		ctx.userdata.stackSetDeployment == nil &&
+		!ctx.userdata.inPlace &&
+		!ctx.userdata.noop
+	if recordDeployment {
+		recordKey, recordKeyErr := deploymentTemplateKey(ctx)
+		if recordKeyErr != nil {
+			return nil, recordKeyErr
+		}
+		templateKey = recordKey
+		stackTags[SpartaTagDeploymentHistoryKey] = deploymentHistoryTagValue(ctx.userdata.s3Bucket,
+			ctx.userdata.serviceName)
+	}
 
 	// Generate the CF template...
 	cfTemplate, err := json.Marshal(ctx.context.cfTemplate)
@@ -1190,6 +1730,14 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 		ctx.logger.Error("Failed to Marshal CloudFormation template: ", err.Error())
 		return nil, err
 	}
+	// Catch quota errors before the template is uploaded
+	limitsErr := validateTemplateLimits(ctx.userdata.lambdaAWSInfos,
+		ctx.context.cfTemplate,
+		cfTemplate,
+		ctx.logger)
+	if limitsErr != nil {
+		return nil, limitsErr
+	}
 
 	// Consistent naming of template
 	sanitizedServiceName := sanitizedName(ctx.userdata.serviceName)
@@ -1217,14 +1765,21 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 			"Body": string(formatted),
 		}).Debug("CloudFormation template body")
 		if nil != ctx.context.templateWriter {
-			_, writeErr := io.WriteString(ctx.context.templateWriter,
-				string(formatted))
+			writeErr := writeTemplate(ctx.context.templateWriter,
+				ctx.userdata.templateFormat,
+				cfTemplate,
+				formatted)
 			if writeErr != nil {
 				return nil, errors.Wrapf(writeErr, "Failed to write template")
 			}
 		}
 	}
 
+	// Packages are deployed by the caller
+	if ctx.userdata.pkg != nil {
+		ctx.registerFileCleanupFinalizer(templateFile.Name())
+		return nil, ctx.userdata.pkg.writeManifest(cfTemplate, stackTags, ctx)
+	}
 	// If this isn't a codePipelineTrigger, then do that
 	if ctx.userdata.codePipelineTrigger == "" {
 		if ctx.userdata.noop {
@@ -1234,38 +1789,107 @@ func applyCloudFormationOperation(ctx *workflowContext) (workflowStep, error) {
 			}).Info(noopMessage("Stack creation"))
 		} else {
 			// Dump the template to a file, then upload it...
-			uploadURL, uploadURLErr := uploadLocalFileToS3(templateFile.Name(), "", ctx)
+			uploadURL, uploadURLErr := uploadLocalFileToS3(templateFile.Name(), templateKey, ctx)
 			if nil != uploadURLErr {
 				return nil, uploadURLErr
 			}
+			if recordDeployment {
+				recordErr := registerDeploymentRecord(ctx, templateKey, uploadURL)
+				if recordErr != nil {
+					return nil, recordErr
+				}
+			}
 
-			// If we're supposed to be inplace, then go ahead and try that
 			var stack *cloudformation.Stack
-			var stackErr error
-			if ctx.userdata.inPlace {
-				stack, stackErr = applyInPlaceFunctionUpdates(ctx, uploadURL)
-			} else {
-				operationTimeout := maximumStackOperationTimeout(ctx.context.cfTemplate, ctx.logger)
-				// Regular update, go ahead with the CloudFormation changes
-				stack, stackErr = spartaCF.ConvergeStackState(ctx.userdata.serviceName,
+			// Failed validations revert to the current deployment
+			var snapshot *deploymentSnapshot
+			if ctx.userdata.stackSetDeployment != nil {
+				// StackSets are converged across the target accounts
+				stackSetErr := spartaCF.ConvergeStackSetStateWithClients(ctx.userdata.serviceName,
 					ctx.context.cfTemplate,
+					ctx.userdata.s3Bucket,
 					uploadURL,
 					stackTags,
-					ctx.transaction.startTime,
-					operationTimeout,
+					ctx.userdata.stackSetDeployment,
+					ctx.userdata.changeSetOptions,
 					ctx.context.awsSession,
-					"▬",
-					dividerLength,
+					ctx.context.awsClients.CloudFormation,
+					ctx.context.awsClients.S3,
 					ctx.logger)
+				if stackSetErr != nil {
+					return nil, stackSetErr
+				}
+			} else {
+				// If we're supposed to be inplace, then go ahead and try that
+				var stackErr error
+				if len(postDeployValidations(ctx)) != 0 {
+					snapshot, stackErr = newDeploymentSnapshot(ctx)
+					if stackErr != nil {
+						return nil, stackErr
+					}
+				}
+				if ctx.userdata.inPlace {
+					var functionChanges []*inPlaceFunctionChange
+					stack, functionChanges, stackErr = applyInPlaceFunctionUpdates(ctx, uploadURL)
+					if snapshot != nil {
+						snapshot.inPlaceChanges = functionChanges
+					}
+				} else {
+					// A failed update rolls back the site content, which the
+					// distribution may have already cached
+					if ctx.userdata.s3SiteContext.s3Site != nil &&
+						ctx.userdata.s3SiteContext.s3Site.CloudFront != nil {
+						ctx.registerRollback(s3SiteInvalidationRollback(ctx.userdata.serviceName,
+							ctx.userdata.buildID,
+							ctx.context.awsClients.CloudFormation,
+							ctx.context.awsSession))
+					}
+					operationTimeout := maximumStackOperationTimeout(ctx.context.cfTemplate, ctx.logger)
+					var stopWatchingStack func()
+					if ctx.context.progress != nil {
+						stopWatchingStack = ctx.context.progress.watchStack(ctx.userdata.serviceName,
+							ctx.transaction.startTime,
+							ctx.context.awsSession)
+					}
+					// Regular update, go ahead with the CloudFormation changes
+					stack, stackErr = spartaCF.ConvergeStackStateWithClient(ctx.userdata.serviceName,
+						ctx.context.cfTemplate,
+						uploadURL,
+						stackTags,
+						ctx.transaction.startTime,
+						operationTimeout,
+						ctx.context.awsClients.CloudFormation,
+						ctx.userdata.changeSetOptions,
+						"▬",
+						dividerLength,
+						ctx.logger)
+					if stopWatchingStack != nil {
+						stopWatchingStack()
+					}
+				}
+				if nil != stackErr {
+					return nil, stackErr
+				}
+				ctx.logger.WithFields(logrus.Fields{
+					"StackName":    *stack.StackName,
+					"StackId":      *stack.StackId,
+					"CreationTime": *stack.CreationTime,
+				}).Info("Stack provisioned")
 			}
-			if nil != stackErr {
-				return nil, stackErr
+			// In-place updates don't update the site content
+			var next workflowStep
+			if !ctx.userdata.inPlace &&
+				ctx.userdata.s3SiteContext.s3Site != nil &&
+				ctx.userdata.s3SiteContext.s3Site.CloudFront != nil {
+				next = invalidateS3SiteDistribution(stack)
 			}
-			ctx.logger.WithFields(logrus.Fields{
-				"StackName":    *stack.StackName,
-				"StackId":      *stack.StackId,
-				"CreationTime": *stack.CreationTime,
-			}).Info("Stack provisioned")
+			if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.PowerTuning != nil {
+				next = powerTuningStep(next)
+			}
+			if len(postDeployValidations(ctx)) != 0 {
+				return validatePostDeployment(stack, snapshot, next), nil
+			}
+			return next, nil
 		}
 	} else {
 		ctx.logger.Info("Creating pipeline package")
@@ -1332,6 +1956,8 @@ func ensureCloudFormationStack() workflowStep {
 		msg := "Ensuring CloudFormation stack"
 		if ctx.userdata.inPlace {
 			msg = "Updating Lambda function code "
+		} else if ctx.userdata.pkg != nil {
+			msg = "Generating CloudFormation template"
 		}
 		defer recordDuration(time.Now(), msg, ctx)
 
@@ -1358,12 +1984,41 @@ func ensureCloudFormationStack() workflowStep {
 				}
 			}
 		}
+		// User defined Parameters & Conditions
+		if ctx.userdata.workflowHooks != nil {
+			parametersErr := exportTemplateParameters(ctx.userdata.workflowHooks.Parameters,
+				ctx.userdata.workflowHooks.Conditions,
+				ctx.context.cfTemplate)
+			if parametersErr != nil {
+				return nil, parametersErr
+			}
+		}
+		// PowerTuning recommendations from a previous sweep
+		if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.PowerTuning != nil {
+			powerTuningErr := ctx.userdata.workflowHooks.PowerTuning.validate()
+			if powerTuningErr != nil {
+				return nil, powerTuningErr
+			}
+			powerTuningErr = applyPowerTuningRecommendations(ctx.userdata.workflowHooks.PowerTuning,
+				ctx.userdata.lambdaAWSInfos,
+				ctx.logger)
+			if powerTuningErr != nil {
+				return nil, powerTuningErr
+			}
+		}
 		for _, eachEntry := range ctx.userdata.lambdaAWSInfos {
 			verifyErr := verifyLambdaPreconditions(eachEntry, ctx.logger)
 			if verifyErr != nil {
 				return nil, verifyErr
 			}
 			annotateCodePipelineEnvironments(eachEntry, ctx.logger)
+			if ctx.userdata.workflowHooks != nil {
+				logGroupErr := applyDefaultLogGroup(eachEntry,
+					ctx.userdata.workflowHooks.LogGroup)
+				if logGroupErr != nil {
+					return nil, logGroupErr
+				}
+			}
 
 			err := eachEntry.export(ctx.userdata.serviceName,
 				ctx.userdata.s3Bucket,
@@ -1413,6 +2068,16 @@ func ensureCloudFormationStack() workflowStep {
 		if serviceDecoratorErr != nil {
 			return nil, serviceDecoratorErr
 		}
+		// The service dashboard includes the decorator resources
+		if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.Dashboard != nil {
+			dashboardErr := exportServiceDashboard(ctx.userdata.serviceName,
+				ctx.userdata.workflowHooks.Dashboard,
+				ctx.context.cfTemplate,
+				ctx.logger)
+			if dashboardErr != nil {
+				return nil, dashboardErr
+			}
+		}
 
 		// Discovery info on a per-function basis
 		for _, eachEntry := range ctx.userdata.lambdaAWSInfos {
@@ -1480,6 +2145,14 @@ func ensureCloudFormationStack() workflowStep {
 			return nil, errors.Wrapf(annotateErr,
 				"Failed to perform final template annotations")
 		}
+		// Least-privilege analysis
+		analysisErr := analyzeIAMPrivileges(ctx.userdata.lambdaAWSInfos,
+			ctx.context.cfTemplate,
+			ctx.userdata.strictIAM,
+			ctx.logger)
+		if analysisErr != nil {
+			return nil, analysisErr
+		}
 
 		// validations?
 		if ctx.userdata.workflowHooks != nil {
@@ -1491,6 +2164,72 @@ func ensureCloudFormationStack() workflowStep {
 			}
 		}
 
+		// Cost estimate?
+		if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.CostEstimate != nil {
+			costEstimateErr := logCostEstimate(ctx.userdata.workflowHooks.CostEstimate,
+				ctx.userdata.lambdaAWSInfos,
+				ctx.context.cfTemplate,
+				ctx.context.awsSession,
+				ctx.logger)
+			if costEstimateErr != nil {
+				return nil, costEstimateErr
+			}
+		}
+
+		// Dynamic references?
+		if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.DynamicReferences != nil {
+			var resolver *dynamicReferenceResolver
+			if !ctx.userdata.offline {
+				resolver = newDynamicReferenceResolver(ctx.context.awsSession)
+			}
+			dynamicRefsErr := applyDynamicReferences(ctx.userdata.workflowHooks.DynamicReferences,
+				ctx.context.cfTemplate,
+				resolver,
+				ctx.userdata.offline,
+				ctx.logger)
+			if dynamicRefsErr != nil {
+				return nil, dynamicRefsErr
+			}
+		}
+
+		// Service tags. Tagging replaces the IAM role and log group
+		// resources with the tagged schema types, so it's the final
+		// change before the resources are split into nested stacks.
+		var serviceTags map[string]string
+		if ctx.userdata.workflowHooks != nil {
+			serviceTags = ctx.userdata.workflowHooks.Tags
+		}
+		tagsErr := applyResourceTags(ctx.userdata.serviceName,
+			ctx.userdata.lambdaAWSInfos,
+			serviceTags,
+			ctx.context.cfTemplate,
+			ctx.logger)
+		if tagsErr != nil {
+			return nil, tagsErr
+		}
+
+		// Log groups added to functions that were previously deployed
+		// already exist
+		if !ctx.userdata.noop &&
+			ctx.userdata.pkg == nil &&
+			ctx.userdata.stackSetDeployment == nil {
+			logGroupsErr := verifyExistingLogGroups(ctx.userdata.serviceName,
+				ctx.context.cfTemplate,
+				ctx.context.awsClients,
+				ctx.logger)
+			if logGroupsErr != nil {
+				return nil, logGroupsErr
+			}
+		}
+
+		// Nested stacks?
+		if ctx.userdata.workflowHooks != nil && ctx.userdata.workflowHooks.NestedStacks != nil {
+			nestedStacksErr := splitNestedStacks(ctx.userdata.workflowHooks.NestedStacks, ctx)
+			if nestedStacksErr != nil {
+				return nil, nestedStacksErr
+			}
+		}
+
 		// Do the operation!
 		return applyCloudFormationOperation(ctx)
 	}
@@ -1526,6 +2265,147 @@ func Provision(noop bool,
 	templateWriter io.Writer,
 	workflowHooks *WorkflowHooks,
 	logger *logrus.Logger) error {
+	return ProvisionEx(noop,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		inPlaceUpdates,
+		buildID,
+		codePipelineTrigger,
+		buildTags,
+		linkerFlags,
+		templateWriter,
+		workflowHooks,
+		nil,
+		logger)
+}
+
+// ProvisionEx provisions a Sparta application like Provision, with the
+// additional options that the provision command sets from its flags. A nil
+// options value uses the defaults.
+func ProvisionEx(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	inPlaceUpdates bool,
+	buildID string,
+	codePipelineTrigger string,
+	buildTags string,
+	linkerFlags string,
+	templateWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	options *ProvisionOptions,
+	logger *logrus.Logger) error {
+	return provision(noop,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		useCGO,
+		inPlaceUpdates,
+		buildID,
+		codePipelineTrigger,
+		buildTags,
+		linkerFlags,
+		templateWriter,
+		workflowHooks,
+		options,
+		logger,
+		nil,
+		false)
+}
+
+// MarshalTemplate runs the noop provisioning workflow offline and writes the
+// indented JSON CloudFormation template to templateWriter. The service binary
+// is built and archived so that the workflow hooks are called, but no AWS APIs
+// are called, even if credentials are available. Existing IAM roles and the S3
+// code archive use placeholder values.
+func MarshalTemplate(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	buildID string,
+	buildTags string,
+	templateWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	if templateWriter == nil {
+		return errors.New("MarshalTemplate requires a template writer")
+	}
+	var legacyTemplate bytes.Buffer
+	provisionErr := provision(true,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		s3Bucket,
+		false,
+		false,
+		buildID,
+		"",
+		buildTags,
+		"",
+		&legacyTemplate,
+		workflowHooks,
+		nil,
+		logger,
+		nil,
+		true)
+	if provisionErr != nil {
+		return provisionErr
+	}
+	// The noop workflow writes the template as a JSON encoded string
+	var templateBody string
+	unmarshalErr := json.Unmarshal(legacyTemplate.Bytes(), &templateBody)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal template")
+	}
+	return writeTemplate(templateWriter,
+		TemplateFormatJSON,
+		[]byte(templateBody),
+		nil)
+}
+
+// provision runs the provisioning workflow. If pkg is non-nil, the
+// workflow writes the artifacts and template to the package output
+// directory rather than deploying them. Offline noop workflows don't
+// make AWS API calls.
+func provision(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	inPlaceUpdates bool,
+	buildID string,
+	codePipelineTrigger string,
+	buildTags string,
+	linkerFlags string,
+	templateWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	options *ProvisionOptions,
+	logger *logrus.Logger,
+	pkg *packageContext,
+	offline bool) (provisionErr error) {
+
+	if options == nil {
+		options = &ProvisionOptions{}
+	}
 
 	err := validateSpartaPreconditions(lambdaAWSInfos, logger)
 	if nil != err {
@@ -1533,6 +2413,29 @@ func Provision(noop bool,
 	}
 	startTime := time.Now()
 
+	// Localstack replaces the AWS endpoints and credentials
+	awsSession := newWorkflowSession(options.Localstack, logger)
+	// Throttled requests are retried with the policy's backoff. The policy
+	// is also passed to the CloudFormation status polling with the
+	// ChangeSetOptions.
+	retryPolicy := spartaAWS.DefaultRetryPolicy()
+	var injectedClients *AWSClients
+	var artifactStore ArtifactStore
+	if workflowHooks != nil {
+		injectedClients = workflowHooks.AWSClients
+		artifactStore = workflowHooks.ArtifactStore
+		if workflowHooks.RetryPolicy != nil {
+			policyCopy := *workflowHooks.RetryPolicy
+			retryPolicy = &policyCopy
+		}
+	}
+	if options.MaxRetries > 0 {
+		retryPolicy.MaxRetries = options.MaxRetries
+	}
+	if awsSession != nil {
+		retryPolicy.Apply(awsSession.Config)
+	}
+
 	ctx := &workflowContext{
 		logger: logger,
 		userdata: userdata{
@@ -1552,12 +2455,17 @@ func Provision(noop bool,
 			},
 			codePipelineTrigger: codePipelineTrigger,
 			workflowHooks:       workflowHooks,
+			strictIAM:           options.StrictIAM,
+			forceUnlock:         options.ForceUnlock,
+			validateIAMPolicies: options.ValidateIAM,
+			pkg:                 pkg,
 		},
 		context: provisionContext{
 			cfTemplate:                gocf.NewTemplate(),
 			s3BucketVersioningEnabled: false,
-			awsSession:                spartaAWS.NewSession(logger),
-			workflowHooksContext:      make(map[string]interface{}),
+			awsSession:                awsSession,
+			awsClients:                newAWSClients(awsSession, injectedClients),
+			workflowHooksContext:      NewWorkflowHookContext(nil),
 			templateWriter:            templateWriter,
 			binaryName:                SpartaBinaryName,
 		},
@@ -1566,21 +2474,131 @@ func Provision(noop bool,
 		},
 	}
 	ctx.context.cfTemplate.Description = serviceDescription
+	ctx.context.artifactStore = artifactStore
+	if ctx.context.artifactStore == nil {
+		ctx.context.artifactStore = &S3ArtifactStore{
+			S3: ctx.context.awsClients.S3,
+		}
+	}
+	if options.OTLPEndpoint != "" && pkg == nil {
+		defer func() {
+			exportProvisionSpans(options.OTLPEndpoint,
+				serviceName,
+				buildID,
+				startTime,
+				ctx.transaction.stepDurations,
+				provisionErr,
+				logger)
+		}()
+	}
+	// Interactive progress falls back to the log output if there's no
+	// terminal
+	if options.Interactive && pkg == nil {
+		progressErr := provisionProgressAvailable()
+		if progressErr == nil {
+			progressView := newProvisionProgressView(serviceName, nil, logger)
+			progressErr = progressView.start()
+			if progressErr == nil {
+				ctx.context.progress = progressView
+				defer progressView.stop()
+			}
+		}
+		if progressErr != nil {
+			logger.WithField("Reason", progressErr).
+				Warn("Interactive progress unavailable, using log output")
+		}
+	}
+	// Packages write the template in the package format
+	if pkg == nil {
+		switch options.TemplateFormat {
+		case "", TemplateFormatJSON, TemplateFormatYAML:
+			ctx.userdata.templateFormat = options.TemplateFormat
+		default:
+			return errors.Errorf("Unsupported template format: %s", options.TemplateFormat)
+		}
+	}
+
+	// Stack parameter overrides
+	changeSetOptions, changeSetOptionsErr := provisionChangeSetOptions(workflowHooks,
+		options.Parameters)
+	if changeSetOptionsErr != nil {
+		return changeSetOptionsErr
+	}
+	changeSetOptions.RetryPolicy = retryPolicy
+	ctx.userdata.changeSetOptions = changeSetOptions
+
+	// StackSet deployment?
+	if options.StackSet != "" && pkg == nil {
+		if inPlaceUpdates || codePipelineTrigger != "" {
+			return errors.Errorf("StackSet deployments don't support in-place updates or CodePipeline packages")
+		}
+		// The post-provision steps operate on the service stack in this
+		// account, which a StackSet doesn't create
+		if site != nil && site.CloudFront != nil {
+			return errors.Errorf("StackSet deployments don't support S3Site CloudFront invalidation")
+		}
+		if workflowHooks != nil &&
+			(workflowHooks.PowerTuning != nil || len(workflowHooks.PostDeployValidations) != 0) {
+			return errors.Errorf("StackSet deployments don't support PowerTuning or PostDeployValidations")
+		}
+		stackSetFile, stackSetFileErr := os.Open(options.StackSet)
+		if stackSetFileErr != nil {
+			return errors.Wrapf(stackSetFileErr, "Failed to open StackSet deployment")
+		}
+		defer stackSetFile.Close()
+		stackSetDeployment, stackSetDeploymentErr := spartaCF.NewStackSetDeployment(stackSetFile)
+		if stackSetDeploymentErr != nil {
+			return stackSetDeploymentErr
+		}
+		// Lambda requires the code bucket to be in the function's region
+		provisionRegion := aws.StringValue(ctx.context.awsSession.Config.Region)
+		for _, eachTarget := range stackSetDeployment.Targets {
+			for _, eachRegion := range eachTarget.Regions {
+				if eachRegion != provisionRegion {
+					ctx.logger.WithFields(logrus.Fields{
+						"Region":   eachRegion,
+						"S3Bucket": s3Bucket,
+					}).Warn("StackSet region differs from the S3 bucket region. Lambda functions require code in the same region.")
+				}
+			}
+		}
+		ctx.userdata.stackSetDeployment = stackSetDeployment
+	}
 
 	// Update the context iff it exists
 	if nil != workflowHooks && nil != workflowHooks.Context {
-		for eachKey, eachValue := range workflowHooks.Context {
-			ctx.context.workflowHooksContext[eachKey] = eachValue
-		}
+		ctx.context.workflowHooksContext = NewWorkflowHookContext(workflowHooks.Context)
+	}
+	ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyServiceName, serviceName)
+	ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyBuildID, buildID)
+	ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyS3Bucket, s3Bucket)
+	ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyTemplate, ctx.context.cfTemplate)
+	ctx.context.workflowHooksContext.Set(WorkflowHookContextKeyAWSClients, ctx.context.awsClients)
+
+	// Dry runs and local packages without credentials generate the
+	// template offline
+	if noop && offline {
+		ctx.userdata.offline = true
+		ctx.logger.Info("Generating template offline with placeholder values")
+	} else if noop || (pkg != nil && !pkg.upload) {
+		credentialsErr := awsCredentialsAvailable(ctx.context.awsSession)
+		if credentialsErr != nil {
+			ctx.userdata.offline = true
+			ctx.logger.WithField("Error", credentialsErr).Debug("Failed to resolve AWS credentials")
+			ctx.logger.Warn("AWS credentials unavailable. Generating template offline with placeholder values.")
+		}
+	}
+	workflowMessage := "Provisioning service"
+	if pkg != nil {
+		workflowMessage = "Packaging service"
 	}
-
 	ctx.logger.WithFields(logrus.Fields{
 		"BuildID":             buildID,
 		"NOOP":                noop,
 		"Tags":                ctx.userdata.buildTags,
 		"CodePipelineTrigger": ctx.userdata.codePipelineTrigger,
 		"InPlaceUpdates":      ctx.userdata.inPlace,
-	}).Info("Provisioning service")
+	}).Info(workflowMessage)
 
 	if len(lambdaAWSInfos) <= 0 {
 		// Warning? Maybe it's just decorators?
@@ -1590,8 +2608,21 @@ func Provision(noop bool,
 		ctx.logger.Warn("No lambda functions provided to Sparta.Provision()")
 	}
 
+	// Overlapping provision operations for the same stack fail, so
+	// mutating operations hold a lock for the duration of the workflow.
+	// The lock is released after any rollback functions.
+	defer func() {
+		if nil != ctx.transaction.releaseLockFunction {
+			ctx.transaction.releaseLockFunction(ctx.logger)
+		}
+	}()
+	firstStep := verifyIAMRoles
+	if !noop && pkg == nil && codePipelineTrigger == "" {
+		firstStep = lockProvisioning(verifyIAMRoles)
+	}
+
 	// Start the workflow
-	for step := verifyIAMRoles; step != nil; {
+	for step := firstStep; step != nil; {
 		next, err := step(ctx)
 		if err != nil {
 			showOptionalAWSUsageInfo(err, ctx.logger)
@@ -1631,3 +2662,70 @@ func Provision(noop bool,
 	}
 	return nil
 }
+
+// exportProvisionSpans publishes a span for the provisioning operation
+// with a child span for each workflow step
+func exportProvisionSpans(endpoint string,
+	serviceName string,
+	buildID string,
+	startTime time.Time,
+	stepDurations []*workflowStepDuration,
+	provisionErr error,
+	logger *logrus.Logger) {
+	exporter := newOTLPExporter(&OpenTelemetryOptions{
+		Endpoint: endpoint,
+		Timeout:  10 * time.Second,
+	}, serviceName)
+
+	rootSpan := &otelSpan{
+		traceID: otelRandomID(16),
+		spanID:  otelRandomID(8),
+		name:    "provision " + serviceName,
+		kind:    otelSpanKindInternal,
+		start:   startTime,
+		end:     time.Now(),
+		attributes: map[string]interface{}{
+			"sparta.build_id": buildID,
+		},
+		err: provisionErr,
+	}
+	spans := []*otelSpan{rootSpan}
+	for _, eachStep := range stepDurations {
+		spans = append(spans, &otelSpan{
+			traceID:      rootSpan.traceID,
+			spanID:       otelRandomID(8),
+			parentSpanID: rootSpan.spanID,
+			name:         eachStep.name,
+			kind:         otelSpanKindInternal,
+			start:        eachStep.start,
+			end:          eachStep.start.Add(eachStep.duration),
+			attributes:   map[string]interface{}{},
+		})
+	}
+	exportErr := exporter.exportSpans(context.Background(), spans)
+	if exportErr != nil {
+		logger.WithError(exportErr).Warn("Failed to export provisioning spans")
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"Endpoint": exporter.endpoint,
+		"TraceID":  rootSpan.traceID,
+		"Spans":    len(spans),
+	}).Info("Exported provisioning spans")
+}
+
+// addStreamingBootstrap adds the executable custom runtime bootstrap that
+// launches the Sparta binary
+func addStreamingBootstrap(lambdaArchive *zip.Writer) error {
+	bootstrapHeader := &zip.FileHeader{
+		Name:   streamingBootstrapName,
+		Method: zip.Deflate,
+	}
+	bootstrapHeader.SetMode(0755)
+	bootstrapWriter, bootstrapWriterErr := lambdaArchive.CreateHeader(bootstrapHeader)
+	if nil != bootstrapWriterErr {
+		return errors.Wrapf(bootstrapWriterErr, "Failed to create custom runtime bootstrap")
+	}
+	_, writeErr := io.WriteString(bootstrapWriter, streamingBootstrapScript)
+	return writeErr
+}
@@ -0,0 +1,342 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// inPlaceConfigurationProperties are the AWS::Lambda::Function properties
+// that are updated in-place with UpdateFunctionConfiguration
+var inPlaceConfigurationProperties = map[string]bool{
+	"Environment": true,
+	"Layers":      true,
+	"MemorySize":  true,
+	"Timeout":     true,
+}
+
+// inPlaceFunctionChange is the set of property changes for a function that
+// can be applied without CloudFormation
+type inPlaceFunctionChange struct {
+	logicalResourceID       string
+	functionName            string
+	codeChanged             bool
+	configurationProperties []string
+}
+
+// newInPlaceFunctionChange returns the in-place change for the function
+// resource change and the property changes that can't be applied in-place
+func newInPlaceFunctionChange(resourceChange *cloudformation.ResourceChange) (*inPlaceFunctionChange, []string) {
+	functionChange := &inPlaceFunctionChange{
+		logicalResourceID: aws.StringValue(resourceChange.LogicalResourceId),
+		functionName:      aws.StringValue(resourceChange.PhysicalResourceId),
+	}
+	// Without the property details, assume it's a code update
+	if len(resourceChange.Details) == 0 {
+		functionChange.codeChanged = true
+		return functionChange, nil
+	}
+	unsupportedChanges := []string{}
+	for _, eachDetail := range resourceChange.Details {
+		if eachDetail.Target == nil {
+			continue
+		}
+		attribute := aws.StringValue(eachDetail.Target.Attribute)
+		propertyName := aws.StringValue(eachDetail.Target.Name)
+		switch {
+		case attribute == cloudformation.ResourceAttributeMetadata:
+			// Metadata doesn't change the function
+		case attribute == cloudformation.ResourceAttributeProperties && propertyName == "Code":
+			functionChange.codeChanged = true
+		case attribute == cloudformation.ResourceAttributeProperties &&
+			inPlaceConfigurationProperties[propertyName]:
+			if !stringInSlice(propertyName, functionChange.configurationProperties) {
+				functionChange.configurationProperties = append(functionChange.configurationProperties,
+					propertyName)
+			}
+		default:
+			unsupportedChange := attribute
+			if propertyName != "" {
+				unsupportedChange = fmt.Sprintf("%s.%s", attribute, propertyName)
+			}
+			if !stringInSlice(unsupportedChange, unsupportedChanges) {
+				unsupportedChanges = append(unsupportedChanges, unsupportedChange)
+			}
+		}
+	}
+	return functionChange, unsupportedChanges
+}
+
+// stringInSlice returns true if the value is in the slice
+func stringInSlice(value string, values []string) bool {
+	for _, eachValue := range values {
+		if eachValue == value {
+			return true
+		}
+	}
+	return false
+}
+
+// templateLambdaFunction returns the function properties for the
+// logical resource ID
+func templateLambdaFunction(template *gocf.Template, logicalResourceID string) (*gocf.LambdaFunction, error) {
+	cfResource, cfResourceOk := template.Resources[logicalResourceID]
+	if !cfResourceOk {
+		return nil, errors.Errorf("Unable to locate lambda function: %s", logicalResourceID)
+	}
+	switch typedProperties := cfResource.Properties.(type) {
+	case gocf.LambdaFunction:
+		return &typedProperties, nil
+	case *gocf.LambdaFunction:
+		return typedProperties, nil
+	case lambdaFunction:
+		return &typedProperties.LambdaFunction, nil
+	case *lambdaFunction:
+		return &typedProperties.LambdaFunction, nil
+	default:
+		return nil, errors.Errorf("CloudFormation resource exists, but is incorrect type: %s",
+			cfResource.Properties.CfnResourceType())
+	}
+}
+
+// literalStringExpr returns the value of a literal string expression
+func literalStringExpr(value interface{}) (string, bool) {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, true
+	case *gocf.StringExpr:
+		if typedValue != nil && typedValue.Func == nil {
+			return typedValue.Literal, true
+		}
+	case gocf.StringExpr:
+		if typedValue.Func == nil {
+			return typedValue.Literal, true
+		}
+	}
+	return "", false
+}
+
+// literalIntegerExpr returns the value of a literal integer property
+func literalIntegerExpr(propertyName string, value *gocf.IntegerExpr) (int64, error) {
+	if value == nil || value.Func != nil {
+		return 0, errors.Errorf("%s isn't a literal value", propertyName)
+	}
+	return value.Literal, nil
+}
+
+// inPlaceEnvironment returns the function environment. Variables with
+// non-literal values (eg, the discovery information) keep their deployed
+// value.
+func inPlaceEnvironment(environment *gocf.LambdaFunctionEnvironment,
+	deployedEnvironment *lambda.EnvironmentResponse) (*lambda.Environment, error) {
+	variables := map[string]interface{}{}
+	if environment != nil {
+		switch typedVariables := environment.Variables.(type) {
+		case nil:
+			// NOP
+		case map[string]interface{}:
+			variables = typedVariables
+		case map[string]*gocf.StringExpr:
+			for eachKey, eachValue := range typedVariables {
+				variables[eachKey] = eachValue
+			}
+		case map[string]string:
+			for eachKey, eachValue := range typedVariables {
+				variables[eachKey] = eachValue
+			}
+		default:
+			return nil, errors.Errorf("Unsupported Environment variables type: %T", environment.Variables)
+		}
+	}
+	deployedVariables := map[string]*string{}
+	if deployedEnvironment != nil && deployedEnvironment.Variables != nil {
+		deployedVariables = deployedEnvironment.Variables
+	}
+	resolvedVariables := make(map[string]*string, len(variables))
+	for eachKey, eachValue := range variables {
+		literalValue, literalValueOk := literalStringExpr(eachValue)
+		if literalValueOk {
+			resolvedVariables[eachKey] = aws.String(literalValue)
+			continue
+		}
+		deployedValue, deployedValueOk := deployedVariables[eachKey]
+		if !deployedValueOk {
+			return nil, errors.Errorf("Environment variable %s isn't a literal value", eachKey)
+		}
+		resolvedVariables[eachKey] = deployedValue
+	}
+	return &lambda.Environment{
+		Variables: resolvedVariables,
+	}, nil
+}
+
+// inPlaceFunctionConfiguration returns the UpdateFunctionConfiguration
+// request for the changed configuration properties, or nil if the
+// configuration didn't change
+func inPlaceFunctionConfiguration(functionChange *inPlaceFunctionChange,
+	template *gocf.Template,
+	awsLambda lambdaiface.LambdaAPI) (*lambda.UpdateFunctionConfigurationInput, error) {
+	if len(functionChange.configurationProperties) == 0 {
+		return nil, nil
+	}
+	lambdaResource, lambdaResourceErr := templateLambdaFunction(template,
+		functionChange.logicalResourceID)
+	if lambdaResourceErr != nil {
+		return nil, lambdaResourceErr
+	}
+	updateRequest := &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(functionChange.functionName),
+	}
+	for _, eachProperty := range functionChange.configurationProperties {
+		switch eachProperty {
+		case "MemorySize":
+			memorySize, memorySizeErr := literalIntegerExpr(eachProperty, lambdaResource.MemorySize)
+			if memorySizeErr != nil {
+				return nil, memorySizeErr
+			}
+			updateRequest.MemorySize = aws.Int64(memorySize)
+		case "Timeout":
+			timeout, timeoutErr := literalIntegerExpr(eachProperty, lambdaResource.Timeout)
+			if timeoutErr != nil {
+				return nil, timeoutErr
+			}
+			updateRequest.Timeout = aws.Int64(timeout)
+		case "Layers":
+			// An empty slice removes the layers
+			layers := []*string{}
+			if lambdaResource.Layers != nil {
+				if lambdaResource.Layers.Func != nil {
+					return nil, errors.Errorf("Layers isn't a literal value")
+				}
+				for _, eachLayer := range lambdaResource.Layers.Literal {
+					layerArn, layerArnOk := literalStringExpr(eachLayer)
+					if !layerArnOk {
+						return nil, errors.Errorf("Layers includes a non-literal value")
+					}
+					layers = append(layers, aws.String(layerArn))
+				}
+			}
+			updateRequest.Layers = layers
+		case "Environment":
+			deployedConfig, deployedConfigErr := awsLambda.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+				FunctionName: aws.String(functionChange.functionName),
+			})
+			if deployedConfigErr != nil {
+				return nil, errors.Wrapf(deployedConfigErr,
+					"Failed to get function configuration: %s",
+					functionChange.functionName)
+			}
+			environment, environmentErr := inPlaceEnvironment(lambdaResource.Environment,
+				deployedConfig.Environment)
+			if environmentErr != nil {
+				return nil, environmentErr
+			}
+			updateRequest.Environment = environment
+		}
+	}
+	return updateRequest, nil
+}
+
+// lambdaUpdateStatusPollInterval is the delay between the requests that
+// poll the function's last update status
+var lambdaUpdateStatusPollInterval = 2 * time.Second
+
+// lambdaUpdateStatusTimeout is the maximum time to wait for a function
+// update to complete
+const lambdaUpdateStatusTimeout = 5 * time.Minute
+
+// lambdaUpdateStatus is the status of the function's last update. The
+// aws-sdk-go version doesn't model the LastUpdateStatus fields, so they're
+// read from the GetFunctionConfiguration response body.
+type lambdaUpdateStatus struct {
+	LastUpdateStatus       string `json:"LastUpdateStatus"`
+	LastUpdateStatusReason string `json:"LastUpdateStatusReason"`
+}
+
+// lambdaUpdateStatusReader returns the status of the function's last update
+type lambdaUpdateStatusReader interface {
+	FunctionUpdateStatus(functionName string) (*lambdaUpdateStatus, error)
+}
+
+// newLambdaUpdateStatusReader returns the lambdaUpdateStatusReader for the
+// client. Clients that implement lambdaUpdateStatusReader are used directly,
+// otherwise the status is read from the GetFunctionConfiguration response.
+func newLambdaUpdateStatusReader(lambdaSvc lambdaiface.LambdaAPI) lambdaUpdateStatusReader {
+	if statusReader, statusReaderOk := lambdaSvc.(lambdaUpdateStatusReader); statusReaderOk {
+		return statusReader
+	}
+	return &lambdaConfigurationStatusReader{lambdaSvc: lambdaSvc}
+}
+
+// lambdaConfigurationStatusReader reads the function's last update status
+// from the GetFunctionConfiguration response body
+type lambdaConfigurationStatusReader struct {
+	lambdaSvc lambdaiface.LambdaAPI
+}
+
+// FunctionUpdateStatus returns the status of the function's last update
+func (reader *lambdaConfigurationStatusReader) FunctionUpdateStatus(functionName string) (*lambdaUpdateStatus, error) {
+	updateStatus := &lambdaUpdateStatus{}
+	statusRequest, _ := reader.lambdaSvc.GetFunctionConfigurationRequest(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	statusRequest.Handlers.Unmarshal.PushFront(func(r *request.Request) {
+		body, bodyErr := ioutil.ReadAll(r.HTTPResponse.Body)
+		if bodyErr != nil {
+			r.Error = bodyErr
+			return
+		}
+		r.HTTPResponse.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if unmarshalErr := json.Unmarshal(body, updateStatus); unmarshalErr != nil {
+			r.Error = unmarshalErr
+		}
+	})
+	sendErr := statusRequest.Send()
+	if sendErr != nil {
+		return nil, errors.Wrapf(sendErr, "Failed to get function configuration: %s", functionName)
+	}
+	return updateStatus, nil
+}
+
+// waitForFunctionUpdate polls the function until its last update is no
+// longer InProgress. Lambda rejects updates to a function while a
+// previous update is in progress. It returns an error if the update
+// failed or didn't complete before the timeout.
+func waitForFunctionUpdate(statusReader lambdaUpdateStatusReader,
+	functionName string,
+	timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		updateStatus, updateStatusErr := statusReader.FunctionUpdateStatus(functionName)
+		if updateStatusErr != nil {
+			return updateStatusErr
+		}
+		switch updateStatus.LastUpdateStatus {
+		case "InProgress":
+			if time.Now().After(deadline) {
+				return errors.Errorf("Timed out waiting for function %s update to complete after %s",
+					functionName,
+					timeout)
+			}
+			time.Sleep(lambdaUpdateStatusPollInterval)
+		case "Failed":
+			return errors.Errorf("Function %s update failed: %s",
+				functionName,
+				updateStatus.LastUpdateStatusReason)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// provisionLockKeyName is the name of the lock object in the service's
+// S3 key prefix
+const provisionLockKeyName = "sparta-provision.lock"
+
+// provisionLock is the content of the S3 lock object that prevents
+// overlapping provision operations for the same stack
+type provisionLock struct {
+	LockID    string    `json:"lockId"`
+	StackName string    `json:"stackName"`
+	BuildID   string    `json:"buildId"`
+	Owner     string    `json:"owner"`
+	Acquired  time.Time `json:"acquired"`
+}
+
+// provisionLockKey returns the S3 key of the service's lock object
+func provisionLockKey(serviceName string) string {
+	return fmt.Sprintf("%s/%s", serviceName, provisionLockKeyName)
+}
+
+// provisionLockOwner returns the user and host that's provisioning
+func provisionLockOwner() string {
+	userName := "unknown"
+	currentUser, currentUserErr := user.Current()
+	if currentUserErr == nil {
+		userName = currentUser.Username
+	}
+	hostName, hostNameErr := os.Hostname()
+	if hostNameErr != nil {
+		hostName = "unknown"
+	}
+	return fmt.Sprintf("%s@%s (pid: %d)", userName, hostName, os.Getpid())
+}
+
+// isAWSErrorCode returns true if the error is an AWS error with one of the
+// given codes
+func isAWSErrorCode(err error, codes ...string) bool {
+	awsErr, isAWSErr := err.(awserr.Error)
+	if !isAWSErr {
+		return false
+	}
+	for _, eachCode := range codes {
+		if awsErr.Code() == eachCode {
+			return true
+		}
+	}
+	return false
+}
+
+// readProvisionLock returns the current lock, or nil if the stack isn't
+// locked
+func readProvisionLock(s3Svc s3iface.S3API,
+	s3Bucket string,
+	serviceName string) (*provisionLock, error) {
+
+	getOutput, getErr := s3Svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(provisionLockKey(serviceName)),
+	})
+	if getErr != nil {
+		if isAWSErrorCode(getErr, s3.ErrCodeNoSuchKey) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(getErr, "Failed to read provision lock")
+	}
+	defer getOutput.Body.Close()
+	lockData, lockDataErr := ioutil.ReadAll(getOutput.Body)
+	if lockDataErr != nil {
+		return nil, errors.Wrapf(lockDataErr, "Failed to read provision lock")
+	}
+	var lock provisionLock
+	unmarshalErr := json.Unmarshal(lockData, &lock)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse provision lock")
+	}
+	return &lock, nil
+}
+
+// deleteProvisionLock unconditionally deletes the lock object
+func deleteProvisionLock(s3Svc s3iface.S3API,
+	s3Bucket string,
+	serviceName string) error {
+	_, deleteErr := s3Svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(provisionLockKey(serviceName)),
+	})
+	if deleteErr != nil {
+		return errors.Wrapf(deleteErr, "Failed to delete provision lock")
+	}
+	return nil
+}
+
+// acquireProvisionLock creates the lock object iff it doesn't exist. If
+// forceUnlock is true, an existing lock is deleted first.
+func acquireProvisionLock(s3Svc s3iface.S3API,
+	s3Bucket string,
+	serviceName string,
+	buildID string,
+	forceUnlock bool,
+	logger *logrus.Logger) (*provisionLock, error) {
+
+	if forceUnlock {
+		existingLock, existingLockErr := readProvisionLock(s3Svc, s3Bucket, serviceName)
+		if existingLockErr != nil {
+			logger.WithField("Error", existingLockErr).Warn("Failed to read existing provision lock")
+		} else if existingLock != nil {
+			logger.WithFields(logrus.Fields{
+				"Owner":    existingLock.Owner,
+				"BuildID":  existingLock.BuildID,
+				"Acquired": existingLock.Acquired,
+			}).Warn("Forcibly releasing provision lock")
+		}
+		deleteErr := deleteProvisionLock(s3Svc, s3Bucket, serviceName)
+		if deleteErr != nil {
+			return nil, deleteErr
+		}
+	}
+	lock := &provisionLock{
+		LockID:    otelRandomID(16),
+		StackName: serviceName,
+		BuildID:   buildID,
+		Owner:     provisionLockOwner(),
+		Acquired:  time.Now().UTC(),
+	}
+	lockData, lockDataErr := json.Marshal(lock)
+	if lockDataErr != nil {
+		return nil, errors.Wrapf(lockDataErr, "Failed to marshal provision lock")
+	}
+	putRequest, _ := s3Svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s3Bucket),
+		Key:         aws.String(provisionLockKey(serviceName)),
+		ContentType: aws.String("application/json"),
+		Body:        bytes.NewReader(lockData),
+	})
+	// Conditional write that fails if the object exists. This version of the
+	// SDK doesn't expose the header as a PutObjectInput field.
+	putRequest.HTTPRequest.Header.Set("If-None-Match", "*")
+	putErr := putRequest.Send()
+	if putErr == nil {
+		return lock, nil
+	}
+	if !isAWSErrorCode(putErr, "PreconditionFailed", "ConditionalRequestConflict") {
+		return nil, errors.Wrapf(putErr, "Failed to create provision lock")
+	}
+	existingLock, existingLockErr := readProvisionLock(s3Svc, s3Bucket, serviceName)
+	if existingLockErr != nil || existingLock == nil {
+		return nil, errors.Errorf("Stack %s is being provisioned by another process. Use --forceUnlock to release the lock",
+			serviceName)
+	}
+	return nil, errors.Errorf("Stack %s is locked by %s (BuildID: %s) since %s. Use --forceUnlock to release the lock",
+		serviceName,
+		existingLock.Owner,
+		existingLock.BuildID,
+		existingLock.Acquired.Format(time.RFC3339))
+}
+
+// releaseProvisionLock deletes the lock object iff it's still owned by
+// the given lock
+func releaseProvisionLock(s3Svc s3iface.S3API,
+	s3Bucket string,
+	lock *provisionLock,
+	logger *logrus.Logger) error {
+
+	currentLock, currentLockErr := readProvisionLock(s3Svc, s3Bucket, lock.StackName)
+	if currentLockErr != nil {
+		return currentLockErr
+	}
+	if currentLock == nil || currentLock.LockID != lock.LockID {
+		logger.WithField("StackName", lock.StackName).
+			Warn("Provision lock was released by another process")
+		return nil
+	}
+	return deleteProvisionLock(s3Svc, s3Bucket, lock.StackName)
+}
+
+// lockProvisioning returns the workflow step that acquires the stack's
+// provision lock. The lock is released when the workflow completes, whether
+// or not it succeeds.
+func lockProvisioning(next workflowStep) workflowStep {
+	return func(ctx *workflowContext) (workflowStep, error) {
+		defer recordDuration(time.Now(), "Acquiring provision lock", ctx)
+
+		s3Svc := ctx.context.awsClients.S3
+		lock, lockErr := acquireProvisionLock(s3Svc,
+			ctx.userdata.s3Bucket,
+			ctx.userdata.serviceName,
+			ctx.userdata.buildID,
+			ctx.userdata.forceUnlock,
+			ctx.logger)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		ctx.logger.WithFields(logrus.Fields{
+			"Bucket": ctx.userdata.s3Bucket,
+			"Key":    provisionLockKey(ctx.userdata.serviceName),
+		}).Info("Acquired provision lock")
+		ctx.transaction.releaseLockFunction = func(logger *logrus.Logger) {
+			releaseErr := releaseProvisionLock(s3Svc, ctx.userdata.s3Bucket, lock, logger)
+			if releaseErr != nil {
+				logger.WithFields(logrus.Fields{
+					"Bucket": ctx.userdata.s3Bucket,
+					"Key":    provisionLockKey(ctx.userdata.serviceName),
+					"Error":  releaseErr,
+				}).Warn("Failed to release provision lock")
+			} else {
+				logger.Debug("Released provision lock")
+			}
+		}
+		return next, nil
+	}
+}
@@ -0,0 +1,400 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	"github.com/pkg/errors"
+	"github.com/rivo/tview"
+	"github.com/sirupsen/logrus"
+)
+
+// progressRefreshInterval is how often the progress view is redrawn
+const progressRefreshInterval = 250 * time.Millisecond
+
+// progressStackEventsInterval is how often the stack events are polled
+const progressStackEventsInterval = 3 * time.Second
+
+// progressBarWidth is the number of characters in an upload progress bar
+const progressBarWidth = 20
+
+// stackResourceProgress is the most recent status of a stack resource
+type stackResourceProgress struct {
+	logicalResourceID string
+	resourceType      string
+	status            string
+	reason            string
+	firstEvent        time.Time
+	lastEvent         time.Time
+}
+
+// uploadProgress is the state of an S3 upload
+type uploadProgress struct {
+	name       string
+	bytesRead  int64
+	totalBytes int64
+	start      time.Time
+	end        time.Time
+}
+
+// provisionProgressView is the interactive terminal view of the provisioning
+// workflow. It displays the completed workflow steps, S3 upload progress,
+// the status of each stack resource and the log output.
+type provisionProgressView struct {
+	sync.Mutex
+	serviceName    string
+	startTime      time.Time
+	app            *tview.Application
+	screen         tcell.Screen
+	headerView     *tview.TextView
+	stepsTable     *tview.Table
+	uploadsTable   *tview.Table
+	resourcesTable *tview.Table
+	logView        *tview.TextView
+	logWriter      io.Writer
+	logBuffer      bytes.Buffer
+	logger         *logrus.Logger
+	loggerOut      io.Writer
+	running        bool
+	done           chan struct{}
+	stepDurations  []*workflowStepDuration
+	uploads        []*uploadProgress
+	resources      map[string]*stackResourceProgress
+	seenEvents     map[string]bool
+}
+
+// provisionProgressAvailable returns an error if the interactive view
+// can't be used. CI environments and redirected output use the regular
+// log output.
+func provisionProgressAvailable() error {
+	for _, eachEnvVar := range []string{"CI", "CODEBUILD_BUILD_ID"} {
+		if os.Getenv(eachEnvVar) != "" {
+			return errors.Errorf("%s environment variable is set", eachEnvVar)
+		}
+	}
+	stdoutInfo, stdoutInfoErr := os.Stdout.Stat()
+	if stdoutInfoErr != nil || (stdoutInfo.Mode()&os.ModeCharDevice) == 0 {
+		return errors.New("stdout is not a terminal")
+	}
+	return nil
+}
+
+// newProvisionProgressView returns a progress view that renders to the
+// given screen, or to the terminal if the screen is nil
+func newProvisionProgressView(serviceName string,
+	screen tcell.Screen,
+	logger *logrus.Logger) *provisionProgressView {
+
+	view := &provisionProgressView{
+		serviceName: serviceName,
+		startTime:   time.Now(),
+		app:         tview.NewApplication(),
+		screen:      screen,
+		logger:      logger,
+		done:        make(chan struct{}),
+		resources:   make(map[string]*stackResourceProgress),
+		seenEvents:  make(map[string]bool),
+	}
+	view.headerView = tview.NewTextView().SetDynamicColors(true)
+	view.stepsTable = tview.NewTable()
+	view.stepsTable.SetBorder(true).SetTitle("Workflow")
+	view.uploadsTable = tview.NewTable()
+	view.uploadsTable.SetBorder(true).SetTitle("Uploads")
+	view.resourcesTable = tview.NewTable().SetFixed(1, 0)
+	view.resourcesTable.SetBorder(true).SetTitle("Stack Resources")
+	view.logView = tview.NewTextView().
+		SetScrollable(true).
+		SetDynamicColors(true)
+	view.logView.SetChangedFunc(func() {
+		view.logView.ScrollToEnd()
+	})
+	view.logView.SetBorder(true).SetTitle("Output")
+	view.logWriter = tview.ANSIWriter(view.logView)
+
+	summaryLayout := tview.NewFlex().
+		SetDirection(tview.FlexColumn).
+		AddItem(view.stepsTable, 0, 1, false).
+		AddItem(view.uploadsTable, 0, 1, false)
+	layout := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(view.headerView, 1, 0, false).
+		AddItem(summaryLayout, 0, 1, false).
+		AddItem(view.resourcesTable, 0, 2, false).
+		AddItem(view.logView, 0, 1, true)
+	view.app.SetRoot(layout, true)
+	return view
+}
+
+// Write satisfies io.Writer for the logger output. The output is written
+// to the log pane and replayed to the original output when the view stops.
+func (view *provisionProgressView) Write(p []byte) (int, error) {
+	view.Lock()
+	defer view.Unlock()
+	if !view.running {
+		return view.loggerOut.Write(p)
+	}
+	view.logBuffer.Write(p)
+	return view.logWriter.Write(p)
+}
+
+// detach restores the terminal output and replays the buffered log
+func (view *provisionProgressView) detach() {
+	view.Lock()
+	defer view.Unlock()
+	if !view.running {
+		return
+	}
+	view.running = false
+	/* #nosec */
+	view.logBuffer.WriteTo(view.loggerOut)
+}
+
+// start displays the view. Ctrl-C closes the view, but doesn't cancel
+// provisioning.
+func (view *provisionProgressView) start() error {
+	screen := view.screen
+	if screen == nil {
+		var screenErr error
+		screen, screenErr = tcell.NewScreen()
+		if screenErr != nil {
+			return errors.Wrapf(screenErr, "Failed to create terminal screen")
+		}
+	}
+	// This version of tview doesn't initialize user supplied screens
+	initErr := screen.Init()
+	if initErr != nil {
+		return errors.Wrapf(initErr, "Failed to initialize terminal screen")
+	}
+	view.app.SetScreen(screen)
+	view.loggerOut = view.logger.Out
+	view.running = true
+	view.logger.SetOutput(view)
+
+	go func() {
+		runErr := view.app.Run()
+		view.detach()
+		if runErr != nil {
+			view.logger.WithField("Error", runErr).Warn("Interactive progress view failed")
+		}
+		close(view.done)
+	}()
+	go func() {
+		ticker := time.NewTicker(progressRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-view.done:
+				return
+			case <-ticker.C:
+				view.app.QueueUpdateDraw(view.render)
+			}
+		}
+	}()
+	return nil
+}
+
+// stop closes the view, restores the logger output and replays the log
+func (view *provisionProgressView) stop() {
+	view.app.Stop()
+	<-view.done
+	view.logger.SetOutput(view.loggerOut)
+}
+
+// stepCompleted adds the workflow step to the view
+func (view *provisionProgressView) stepCompleted(stepDuration *workflowStepDuration) {
+	view.Lock()
+	defer view.Unlock()
+	view.stepDurations = append(view.stepDurations, stepDuration)
+}
+
+// uploadProgress returns the function that updates the named upload's
+// progress bar
+func (view *provisionProgressView) uploadProgress(name string) spartaS3.UploadProgressFunc {
+	view.Lock()
+	defer view.Unlock()
+	upload := &uploadProgress{
+		name:  name,
+		start: time.Now(),
+	}
+	view.uploads = append(view.uploads, upload)
+	return func(bytesRead int64, totalBytes int64) {
+		view.Lock()
+		defer view.Unlock()
+		upload.bytesRead = bytesRead
+		upload.totalBytes = totalBytes
+		if bytesRead >= totalBytes && upload.end.IsZero() {
+			upload.end = time.Now()
+		}
+	}
+}
+
+// updateStackEvents applies the stack events to the resource statuses.
+// Events that were already applied are ignored.
+func (view *provisionProgressView) updateStackEvents(events []*cloudformation.StackEvent) {
+	view.Lock()
+	defer view.Unlock()
+
+	for _, eachEvent := range events {
+		eventID := aws.StringValue(eachEvent.EventId)
+		if view.seenEvents[eventID] || eachEvent.Timestamp == nil {
+			continue
+		}
+		view.seenEvents[eventID] = true
+		logicalResourceID := aws.StringValue(eachEvent.LogicalResourceId)
+		resource, resourceExists := view.resources[logicalResourceID]
+		if !resourceExists {
+			resource = &stackResourceProgress{
+				logicalResourceID: logicalResourceID,
+				resourceType:      aws.StringValue(eachEvent.ResourceType),
+				firstEvent:        *eachEvent.Timestamp,
+			}
+			view.resources[logicalResourceID] = resource
+		}
+		if eachEvent.Timestamp.Before(resource.firstEvent) {
+			resource.firstEvent = *eachEvent.Timestamp
+		}
+		if !eachEvent.Timestamp.Before(resource.lastEvent) {
+			resource.lastEvent = *eachEvent.Timestamp
+			resource.status = aws.StringValue(eachEvent.ResourceStatus)
+			resource.reason = aws.StringValue(eachEvent.ResourceStatusReason)
+		}
+	}
+}
+
+// watchStack polls the stack events until the returned function is called
+func (view *provisionProgressView) watchStack(stackName string,
+	startTime time.Time,
+	awsSession *session.Session) func() {
+
+	stopWatching := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(progressStackEventsInterval)
+		defer ticker.Stop()
+		for {
+			// The stack may not exist yet
+			events, eventsErr := spartaCF.StackEvents(stackName, startTime, awsSession)
+			if eventsErr == nil {
+				view.updateStackEvents(events)
+			}
+			select {
+			case <-stopWatching:
+				return
+			case <-view.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(stopWatching)
+		<-stopped
+	}
+}
+
+// resourceStatusColor returns the tview color for the resource status
+func resourceStatusColor(status string) tcell.Color {
+	switch {
+	case strings.HasSuffix(status, "_FAILED") ||
+		strings.Contains(status, "ROLLBACK"):
+		return tcell.ColorRed
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return tcell.ColorYellow
+	case strings.HasSuffix(status, "_COMPLETE"):
+		return tcell.ColorGreen
+	default:
+		return tcell.ColorWhite
+	}
+}
+
+// uploadProgressBar returns the text progress bar for the upload
+func uploadProgressBar(upload *uploadProgress) string {
+	percent := 0.0
+	if upload.totalBytes > 0 {
+		percent = float64(upload.bytesRead) / float64(upload.totalBytes)
+	}
+	filled := int(percent * progressBarWidth)
+	return fmt.Sprintf("[%s%s] %3.0f%% %s/%s",
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		percent*100,
+		humanize.Bytes(uint64(upload.bytesRead)),
+		humanize.Bytes(uint64(upload.totalBytes)))
+}
+
+// render updates the view's primitives. It must be called from the
+// application's event loop.
+func (view *provisionProgressView) render() {
+	view.Lock()
+	defer view.Unlock()
+
+	view.headerView.SetText(fmt.Sprintf("[::b]Provisioning %s[::-] (elapsed: %s)",
+		view.serviceName,
+		time.Since(view.startTime).Truncate(time.Second)))
+
+	view.stepsTable.Clear()
+	for eachIndex, eachStep := range view.stepDurations {
+		view.stepsTable.SetCell(eachIndex, 0, tview.NewTableCell("✔ "+eachStep.name).
+			SetTextColor(tcell.ColorGreen).
+			SetExpansion(1))
+		view.stepsTable.SetCellSimple(eachIndex, 1, eachStep.duration.Truncate(time.Millisecond).String())
+	}
+	view.stepsTable.ScrollToEnd()
+
+	view.uploadsTable.Clear()
+	for eachIndex, eachUpload := range view.uploads {
+		elapsed := time.Since(eachUpload.start)
+		if !eachUpload.end.IsZero() {
+			elapsed = eachUpload.end.Sub(eachUpload.start)
+		}
+		view.uploadsTable.SetCell(eachIndex, 0, tview.NewTableCell(eachUpload.name).SetExpansion(1))
+		view.uploadsTable.SetCellSimple(eachIndex, 1, uploadProgressBar(eachUpload))
+		view.uploadsTable.SetCellSimple(eachIndex, 2, elapsed.Truncate(time.Second).String())
+	}
+
+	view.resourcesTable.Clear()
+	for eachIndex, eachHeader := range []string{"Resource", "Type", "Status", "Time", "Reason"} {
+		view.resourcesTable.SetCell(0, eachIndex, tview.NewTableCell(eachHeader).
+			SetSelectable(false).
+			SetAttributes(tcell.AttrBold))
+	}
+	resources := make([]*stackResourceProgress, 0, len(view.resources))
+	for _, eachResource := range view.resources {
+		resources = append(resources, eachResource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].firstEvent.Equal(resources[j].firstEvent) {
+			return resources[i].logicalResourceID < resources[j].logicalResourceID
+		}
+		return resources[i].firstEvent.Before(resources[j].firstEvent)
+	})
+	for eachIndex, eachResource := range resources {
+		elapsed := eachResource.lastEvent.Sub(eachResource.firstEvent)
+		if strings.HasSuffix(eachResource.status, "_IN_PROGRESS") {
+			elapsed = time.Since(eachResource.firstEvent)
+		}
+		row := eachIndex + 1
+		view.resourcesTable.SetCellSimple(row, 0, eachResource.logicalResourceID)
+		view.resourcesTable.SetCellSimple(row, 1, eachResource.resourceType)
+		view.resourcesTable.SetCell(row, 2, tview.NewTableCell(eachResource.status).
+			SetTextColor(resourceStatusColor(eachResource.status)))
+		view.resourcesTable.SetCellSimple(row, 3, elapsed.Truncate(time.Second).String())
+		view.resourcesTable.SetCell(row, 4, tview.NewTableCell(eachResource.reason).SetExpansion(1))
+	}
+}
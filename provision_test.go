@@ -1,8 +1,11 @@
 package sparta
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/session"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -41,7 +44,7 @@ func templateDecorator(serviceName string,
 	S3Key string,
 	buildID string,
 	cfTemplate *gocf.Template,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error {
 
 	// Add an empty resource
@@ -68,3 +71,77 @@ func TestDecorateProvision(t *testing.T) {
 	lambdas[0].Decorator = templateDecorator
 	testProvision(t, lambdas, nil)
 }
+
+func TestWorkflowHookContext(t *testing.T) {
+	hookContext := NewWorkflowHookContext(map[string]interface{}{
+		"userKey": "userValue",
+	})
+	template := gocf.NewTemplate()
+	hookContext.Set(WorkflowHookContextKeyTemplate, template)
+
+	// Hooks may publish values concurrently
+	var wg sync.WaitGroup
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			hookContext.Set(WorkflowHookContextKey(fmt.Sprintf("hook%d", index)), index)
+			hookContext.Get(WorkflowHookContextKeyTemplate)
+		}(i)
+	}
+	wg.Wait()
+
+	if userValue, _ := hookContext.GetString("userKey"); userValue != "userValue" {
+		t.Fatalf("Failed to initialize hook context: %s", hookContext)
+	}
+	if hookContext.Template() != template || hookContext.CodeArchiveURL() != "" {
+		t.Fatalf("Unexpected well-known hook context values")
+	}
+	if _, boolOk := hookContext.GetBool("userKey"); boolOk {
+		t.Fatalf("GetBool returned a string value")
+	}
+	if len(hookContext.Keys()) != 12 {
+		t.Fatalf("Unexpected hook context keys: %s", hookContext)
+	}
+	hookContext.Delete("userKey")
+	if _, exists := hookContext.Get("userKey"); exists {
+		t.Fatalf("Failed to delete hook context value")
+	}
+}
+
+func TestServiceDecoratorLayers(t *testing.T) {
+	noopDecorator := ServiceDecoratorHookFunc(func(context *WorkflowHookContext,
+		serviceName string,
+		template *gocf.Template,
+		S3Bucket string,
+		S3Key string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+		return nil
+	})
+	decorators := []ServiceDecoratorHookHandler{
+		&NamedServiceDecorator{Name: "Alarms", DependsOn: []string{"Dashboard", "VPC"}, Decorator: noopDecorator},
+		&NamedServiceDecorator{Name: "VPC", Decorator: noopDecorator},
+		&NamedServiceDecorator{Name: "Dashboard", DependsOn: []string{"VPC"}, Decorator: noopDecorator},
+		noopDecorator,
+	}
+	layers, layersErr := serviceDecoratorLayers(decorators)
+	if layersErr != nil {
+		t.Fatalf("Failed to order ServiceDecorators: %s", layersErr)
+	}
+	if fmt.Sprintf("%v", layers) != "[[1 3] [2] [0]]" {
+		t.Fatalf("Unexpected ServiceDecorator layers: %v", layers)
+	}
+	invalidDecorators := [][]ServiceDecoratorHookHandler{
+		{&NamedServiceDecorator{Name: "VPC", DependsOn: []string{"Missing"}, Decorator: noopDecorator}},
+		{&NamedServiceDecorator{Name: "VPC"}, &NamedServiceDecorator{Name: "VPC"}},
+		{&NamedServiceDecorator{DependsOn: []string{"VPC"}}},
+	}
+	for _, eachDecorators := range invalidDecorators {
+		if _, layersErr := serviceDecoratorLayers(eachDecorators); layersErr == nil {
+			t.Fatalf("Failed to reject invalid ServiceDecorators: %#v", eachDecorators)
+		}
+	}
+}
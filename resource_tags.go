@@ -0,0 +1,185 @@
+package sparta
+
+import (
+	"sort"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Resource tags
+//
+
+// validateTags ensures the tags are within the AWS tagging quotas
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxResourceTags {
+		return errors.Errorf("Resources support at most %d tags. Found: %d",
+			maxResourceTags,
+			len(tags))
+	}
+	for eachKey, eachValue := range tags {
+		if eachKey == "" || len(eachKey) > maxResourceTagKeyLength {
+			return errors.Errorf("Tag keys must be between 1 and %d characters. Found: %s",
+				maxResourceTagKeyLength,
+				eachKey)
+		}
+		if len(eachValue) > maxResourceTagValueLength {
+			return errors.Errorf("Tag %s value must not exceed %d characters",
+				eachKey,
+				maxResourceTagValueLength)
+		}
+		lowerKey := strings.ToLower(eachKey)
+		if strings.HasPrefix(lowerKey, "aws:") ||
+			strings.HasPrefix(lowerKey, "io:gosparta:") {
+			return errors.Errorf("Tag key %s uses a reserved prefix", eachKey)
+		}
+	}
+	return nil
+}
+
+// mergeTagList returns the tags as a sorted TagList. Existing tags take
+// precedence over the default values.
+func mergeTagList(existing *gocf.TagList, defaults map[string]string) *gocf.TagList {
+	merged := make(map[string]*gocf.StringExpr)
+	for eachKey, eachValue := range defaults {
+		merged[eachKey] = gocf.String(eachValue)
+	}
+	if existing != nil {
+		for _, eachTag := range *existing {
+			if eachTag.Key != nil && eachTag.Key.Func == nil {
+				merged[eachTag.Key.Literal] = eachTag.Value
+			}
+		}
+	}
+	keys := make([]string, 0, len(merged))
+	for eachKey := range merged {
+		keys = append(keys, eachKey)
+	}
+	sort.Strings(keys)
+	tagList := gocf.TagList{}
+	for _, eachKey := range keys {
+		tagList = append(tagList, gocf.Tag{
+			Key:   gocf.String(eachKey),
+			Value: merged[eachKey],
+		})
+	}
+	return &tagList
+}
+
+// mergedTags returns the union of the service and function tags. Function
+// tags take precedence.
+func mergedTags(serviceTags map[string]string, functionTags map[string]string) map[string]string {
+	tags := make(map[string]string)
+	for eachKey, eachValue := range serviceTags {
+		tags[eachKey] = eachValue
+	}
+	for eachKey, eachValue := range functionTags {
+		tags[eachKey] = eachValue
+	}
+	return tags
+}
+
+// applyResourceTags adds the service tags to the Sparta-managed Lambda
+// functions, IAM roles and log groups in the template. IAM roles and log
+// groups are also tagged with the Tags of the functions that use them. If
+// functions that share a role have conflicting tag values, the tag is
+// omitted from the role.
+func applyResourceTags(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	serviceTags map[string]string,
+	template *gocf.Template,
+	logger *logrus.Logger) error {
+
+	if tagsErr := validateTags(serviceTags); tagsErr != nil {
+		return errors.Wrapf(tagsErr, "Invalid service Tags")
+	}
+	// Tags for each Sparta-managed role
+	roleTags := make(map[string]map[string]string)
+	conflictingRoleTags := make(map[string]map[string]bool)
+	// Tags for each function log group
+	logGroupTags := make(map[string]map[string]string)
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.Options != nil && len(eachLambda.Options.Tags) != 0 {
+			logGroupName := CloudFormationResourceName("LogGroup",
+				eachLambda.LogicalResourceName())
+			logGroupTags[logGroupName] = eachLambda.Options.Tags
+		}
+		if eachLambda.RoleDefinition == nil {
+			continue
+		}
+		roleName := eachLambda.RoleDefinition.logicalName(serviceName, eachLambda.lambdaFunctionName())
+		if _, exists := roleTags[roleName]; !exists {
+			roleTags[roleName] = make(map[string]string)
+			conflictingRoleTags[roleName] = make(map[string]bool)
+		}
+		if eachLambda.Options == nil {
+			continue
+		}
+		for eachKey, eachValue := range eachLambda.Options.Tags {
+			existingValue, existingValueExists := roleTags[roleName][eachKey]
+			if existingValueExists && existingValue != eachValue {
+				conflictingRoleTags[roleName][eachKey] = true
+			}
+			roleTags[roleName][eachKey] = eachValue
+		}
+	}
+	for eachRoleName, eachConflicts := range conflictingRoleTags {
+		for eachKey := range eachConflicts {
+			logger.WithFields(logrus.Fields{
+				"Role": eachRoleName,
+				"Tag":  eachKey,
+			}).Warn("Functions that share an IAM role have conflicting tag values. Tag not applied to role.")
+			delete(roleTags[eachRoleName], eachKey)
+		}
+	}
+
+	for eachResourceName, eachResource := range template.Resources {
+		switch typedResource := eachResource.Properties.(type) {
+		case gocf.LambdaFunction:
+			if len(serviceTags) == 0 {
+				continue
+			}
+			typedResource.Tags = mergeTagList(typedResource.Tags, serviceTags)
+			eachResource.Properties = typedResource
+		case lambdaFunction:
+			if len(serviceTags) == 0 {
+				continue
+			}
+			typedResource.Tags = mergeTagList(typedResource.Tags, serviceTags)
+			eachResource.Properties = typedResource
+		case *logsLogGroup:
+			tags := mergedTags(serviceTags, logGroupTags[eachResourceName])
+			if len(tags) != 0 {
+				typedResource.Tags = mergeTagList(typedResource.Tags, tags)
+			}
+		case *gocf.LogsLogGroup:
+			if len(serviceTags) != 0 {
+				eachResource.Properties = &logsLogGroup{
+					LogGroupName:    typedResource.LogGroupName,
+					RetentionInDays: typedResource.RetentionInDays,
+					Tags:            mergeTagList(nil, serviceTags),
+				}
+			}
+		case gocf.IAMRole:
+			functionTags, functionTagsExist := roleTags[eachResourceName]
+			if !functionTagsExist {
+				continue
+			}
+			tags := mergedTags(serviceTags, functionTags)
+			if len(tags) != 0 {
+				eachResource.Properties = iamRole{
+					IAMRole: typedResource,
+					Tags:    mergeTagList(nil, tags),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//
+// END - Resource tags
+////////////////////////////////////////////////////////////////////////////////
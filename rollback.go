@@ -0,0 +1,383 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// deploymentHistoryKeyName is the name of the deployment history object in
+// the service's S3 key prefix
+const deploymentHistoryKeyName = "sparta-deployment-history.json"
+
+// maxDeploymentHistory is the number of deployments retained in the history
+const maxDeploymentHistory = 10
+
+var (
+	// SpartaTagDeploymentHistoryKey is the keyname used in the CloudFormation
+	// stack tag that stores the S3 location of the deployment history. The
+	// `rollback` command uses the history to revert the stack to the
+	// previous deployment.
+	SpartaTagDeploymentHistoryKey = spartaTagName("deploymentHistory")
+)
+
+// deploymentArtifact is an S3 code artifact referenced by a deployment
+type deploymentArtifact struct {
+	Key     string `json:"key"`
+	Version string `json:"version,omitempty"`
+}
+
+// deploymentRecord is the location of the template and code artifacts of a
+// deployment
+type deploymentRecord struct {
+	BuildID       string                `json:"buildId"`
+	S3Bucket      string                `json:"s3Bucket"`
+	TemplateKey   string                `json:"templateKey"`
+	TemplateURL   string                `json:"templateURL"`
+	CodeArtifacts []*deploymentArtifact `json:"codeArtifacts,omitempty"`
+}
+
+// deploymentHistory is the content of the S3 object that records the
+// service's deployments, most recent first. It's stored outside the
+// template so that the template doesn't change with every build.
+type deploymentHistory struct {
+	Deployments []*deploymentRecord `json:"deployments"`
+}
+
+// deploymentHistoryKey returns the S3 key of the service's deployment
+// history object
+func deploymentHistoryKey(serviceName string) string {
+	return fmt.Sprintf("%s/%s", serviceName, deploymentHistoryKeyName)
+}
+
+// deploymentHistoryTagValue returns the stack tag value for the service's
+// deployment history object
+func deploymentHistoryTagValue(s3Bucket string, serviceName string) string {
+	return fmt.Sprintf("s3://%s/%s", s3Bucket, deploymentHistoryKey(serviceName))
+}
+
+// stackDeploymentHistoryLocation returns the S3 bucket and key of the
+// deployment history from the stack's tags, or empty strings if the stack
+// doesn't define one
+func stackDeploymentHistoryLocation(stack *cloudformation.Stack) (string, string) {
+	for _, eachTag := range stack.Tags {
+		if aws.StringValue(eachTag.Key) != SpartaTagDeploymentHistoryKey {
+			continue
+		}
+		location := strings.SplitN(strings.TrimPrefix(aws.StringValue(eachTag.Value), "s3://"), "/", 2)
+		if len(location) == 2 && location[0] != "" && location[1] != "" {
+			return location[0], location[1]
+		}
+	}
+	return "", ""
+}
+
+// readDeploymentHistory returns the deployment history, which is empty if
+// the object doesn't exist
+func readDeploymentHistory(s3Svc s3iface.S3API,
+	s3Bucket string,
+	keyName string) (*deploymentHistory, error) {
+
+	history := &deploymentHistory{}
+	getOutput, getErr := s3Svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(keyName),
+	})
+	if getErr != nil {
+		if isAWSErrorCode(getErr, s3.ErrCodeNoSuchKey) {
+			return history, nil
+		}
+		return nil, errors.Wrapf(getErr, "Failed to read deployment history")
+	}
+	defer getOutput.Body.Close()
+	historyData, historyDataErr := ioutil.ReadAll(getOutput.Body)
+	if historyDataErr != nil {
+		return nil, errors.Wrapf(historyDataErr, "Failed to read deployment history")
+	}
+	unmarshalErr := json.Unmarshal(historyData, history)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse deployment history")
+	}
+	return history, nil
+}
+
+// writeDeploymentHistory replaces the deployment history object
+func writeDeploymentHistory(s3Svc s3iface.S3API,
+	s3Bucket string,
+	keyName string,
+	history *deploymentHistory) error {
+
+	if len(history.Deployments) > maxDeploymentHistory {
+		history.Deployments = history.Deployments[:maxDeploymentHistory]
+	}
+	historyData, historyDataErr := json.Marshal(history)
+	if historyDataErr != nil {
+		return errors.Wrapf(historyDataErr, "Failed to marshal deployment history")
+	}
+	_, putErr := s3Svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s3Bucket),
+		Key:         aws.String(keyName),
+		ContentType: aws.String("application/json"),
+		Body:        bytes.NewReader(historyData),
+	})
+	if putErr != nil {
+		return errors.Wrapf(putErr, "Failed to write deployment history")
+	}
+	return nil
+}
+
+// deploymentTemplateKey returns the unique S3 key for the template, so
+// that each deployment's template remains available for a rollback
+func deploymentTemplateKey(ctx *workflowContext) (string, error) {
+	return versionAwareS3KeyName(fmt.Sprintf("%s/%s-cftemplate.json",
+		ctx.userdata.serviceName,
+		sanitizedName(ctx.userdata.serviceName)),
+		false,
+		ctx.logger)
+}
+
+// registerDeploymentRecord registers the finalizer that adds the deployment
+// to the history once provisioning succeeds. The existing history is read
+// from the location in the current stack's tags, in case the service was
+// previously provisioned to a different bucket.
+func registerDeploymentRecord(ctx *workflowContext,
+	templateKey string,
+	templateURL string) error {
+	record := &deploymentRecord{
+		BuildID:     ctx.userdata.buildID,
+		S3Bucket:    ctx.userdata.s3Bucket,
+		TemplateKey: templateKey,
+		TemplateURL: templateURL,
+	}
+	for _, eachURL := range []*s3UploadURL{ctx.context.s3CodeZipURL,
+		ctx.userdata.s3SiteContext.s3UploadURL} {
+		if eachURL != nil {
+			record.CodeArtifacts = append(record.CodeArtifacts, &deploymentArtifact{
+				Key:     eachURL.keyName(),
+				Version: eachURL.version,
+			})
+		}
+	}
+	historyBucket := ctx.userdata.s3Bucket
+	historyKey := deploymentHistoryKey(ctx.userdata.serviceName)
+	describeOutput, describeErr := ctx.context.awsClients.CloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(ctx.userdata.serviceName),
+	})
+	if describeErr == nil && len(describeOutput.Stacks) != 0 {
+		stackBucket, stackKey := stackDeploymentHistoryLocation(describeOutput.Stacks[0])
+		if stackBucket != "" {
+			historyBucket = stackBucket
+			historyKey = stackKey
+		}
+	}
+	history, historyErr := readDeploymentHistory(ctx.context.awsClients.S3, historyBucket, historyKey)
+	if historyErr != nil {
+		return historyErr
+	}
+	ctx.registerFinalizer(func(logger *logrus.Logger) {
+		history.Deployments = append([]*deploymentRecord{record}, history.Deployments...)
+		writeErr := writeDeploymentHistory(ctx.context.awsClients.S3,
+			ctx.userdata.s3Bucket,
+			deploymentHistoryKey(ctx.userdata.serviceName),
+			history)
+		if writeErr != nil {
+			logger.WithField("Error", writeErr).Warn("Failed to record deployment. The rollback command won't revert to it.")
+		}
+	})
+	return nil
+}
+
+// verifyDeploymentArtifacts ensures the deployment's code artifacts still
+// exist
+func verifyDeploymentArtifacts(record *deploymentRecord, s3Svc s3iface.S3API) error {
+	for _, eachArtifact := range record.CodeArtifacts {
+		headInput := &s3.HeadObjectInput{
+			Bucket: aws.String(record.S3Bucket),
+			Key:    aws.String(eachArtifact.Key),
+		}
+		if eachArtifact.Version != "" {
+			headInput.VersionId = aws.String(eachArtifact.Version)
+		}
+		_, headErr := s3Svc.HeadObject(headInput)
+		if headErr != nil {
+			return errors.Wrapf(headErr, "Code artifact s3://%s/%s (version: %s) is unavailable",
+				record.S3Bucket,
+				eachArtifact.Key,
+				eachArtifact.Version)
+		}
+	}
+	return nil
+}
+
+// rollbackStackInput returns the UpdateStack request that reverts the
+// stack to the previous template. Parameters that the previous template
+// shares with the current stack keep their current values.
+func rollbackStackInput(stack *cloudformation.Stack,
+	previous *deploymentRecord,
+	templateURL string,
+	templateSummary *cloudformation.ValidateTemplateOutput) *cloudformation.UpdateStackInput {
+
+	updateInput := &cloudformation.UpdateStackInput{
+		StackName:    stack.StackId,
+		TemplateURL:  aws.String(templateURL),
+		Capabilities: append([]*string{}, stack.Capabilities...),
+	}
+	currentParams := make(map[string]bool)
+	for _, eachParam := range stack.Parameters {
+		currentParams[aws.StringValue(eachParam.ParameterKey)] = true
+	}
+	for _, eachParam := range templateSummary.Parameters {
+		if currentParams[aws.StringValue(eachParam.ParameterKey)] {
+			updateInput.Parameters = append(updateInput.Parameters, &cloudformation.Parameter{
+				ParameterKey:     eachParam.ParameterKey,
+				UsePreviousValue: aws.Bool(true),
+			})
+		}
+	}
+	capabilities := make(map[string]bool)
+	for _, eachCapability := range stack.Capabilities {
+		capabilities[aws.StringValue(eachCapability)] = true
+	}
+	for _, eachCapability := range templateSummary.Capabilities {
+		if !capabilities[aws.StringValue(eachCapability)] {
+			capabilities[aws.StringValue(eachCapability)] = true
+			updateInput.Capabilities = append(updateInput.Capabilities, eachCapability)
+		}
+	}
+	for _, eachTag := range stack.Tags {
+		tag := &cloudformation.Tag{
+			Key:   eachTag.Key,
+			Value: eachTag.Value,
+		}
+		if aws.StringValue(eachTag.Key) == SpartaTagBuildIDKey {
+			tag.Value = aws.String(previous.BuildID)
+		}
+		updateInput.Tags = append(updateInput.Tags, tag)
+	}
+	return updateInput
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Public
+//
+
+// Rollback reverts the provisioned stack to the template and code
+// artifacts of the previous deployment
+func Rollback(serviceName string,
+	serviceDescription string,
+	noop bool,
+	logger *logrus.Logger) error {
+	return RollbackEx(serviceName,
+		serviceDescription,
+		&RollbackOptions{
+			Noop: noop,
+		},
+		logger)
+}
+
+// RollbackEx reverts the provisioned stack to the template and code
+// artifacts of the previous deployment. The deployments are read from the
+// history object referenced by the stack's SpartaTagDeploymentHistoryKey
+// tag. Calling RollbackEx again reverts to the deployment that preceded it.
+func RollbackEx(serviceName string,
+	serviceDescription string,
+	options *RollbackOptions,
+	logger *logrus.Logger) error {
+
+	if options == nil {
+		options = &RollbackOptions{}
+	}
+	awsSession := newWorkflowSession(options.Localstack, logger)
+	awsClients := newAWSClients(awsSession, options.AWSClients)
+	cfSvc := awsClients.CloudFormation
+	describeOutput, describeErr := cfSvc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if describeErr != nil {
+		return errors.Wrapf(describeErr, "Failed to describe stack: %s", serviceName)
+	}
+	if len(describeOutput.Stacks) == 0 {
+		return errors.Errorf("Stack not found: %s", serviceName)
+	}
+	stack := describeOutput.Stacks[0]
+	historyBucket, historyKey := stackDeploymentHistoryLocation(stack)
+	if historyBucket == "" {
+		return errors.Errorf("Stack %s doesn't have a deployment history", serviceName)
+	}
+	history, historyErr := readDeploymentHistory(awsClients.S3, historyBucket, historyKey)
+	if historyErr != nil {
+		return historyErr
+	}
+	if len(history.Deployments) < 2 {
+		return errors.Errorf("Stack %s doesn't have a previous deployment record", serviceName)
+	}
+	current := history.Deployments[0]
+	previous := history.Deployments[1]
+	logger.WithFields(logrus.Fields{
+		"CurrentBuildID":  current.BuildID,
+		"PreviousBuildID": previous.BuildID,
+		"TemplateURL":     previous.TemplateURL,
+	}).Info("Rolling back to previous deployment")
+
+	// Make sure everything is still there
+	artifactsErr := verifyDeploymentArtifacts(previous, awsClients.S3)
+	if artifactsErr != nil {
+		return artifactsErr
+	}
+	templateSummary, templateSummaryErr := cfSvc.ValidateTemplate(&cloudformation.ValidateTemplateInput{
+		TemplateURL: aws.String(previous.TemplateURL),
+	})
+	if templateSummaryErr != nil {
+		return errors.Wrapf(templateSummaryErr, "Previous template is unavailable: %s", previous.TemplateURL)
+	}
+	updateInput := rollbackStackInput(stack, previous, previous.TemplateURL, templateSummary)
+	if options.Noop {
+		logger.WithField("StackName", serviceName).Info(noopMessage("Stack rollback"))
+		return nil
+	}
+	updateOutput, updateErr := cfSvc.UpdateStack(updateInput)
+	if updateErr != nil {
+		return errors.Wrapf(updateErr, "Failed to roll back stack: %s", serviceName)
+	}
+	_, waitErr := spartaCF.WaitForStackOperationComplete(*updateOutput.StackId,
+		"Waiting for stack rollback to complete",
+		cfSvc,
+		logger)
+	if waitErr != nil {
+		return waitErr
+	}
+	describeOutput, describeErr = cfSvc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: updateOutput.StackId,
+	})
+	if describeErr != nil {
+		return describeErr
+	}
+	if len(describeOutput.Stacks) == 0 ||
+		*describeOutput.Stacks[0].StackStatus != cloudformation.StackStatusUpdateComplete {
+		return errors.Errorf("Failed to roll back stack: %s", serviceName)
+	}
+	// The previous deployment is now the current one
+	history.Deployments = history.Deployments[1:]
+	writeErr := writeDeploymentHistory(awsClients.S3, historyBucket, historyKey, history)
+	if writeErr != nil {
+		return writeErr
+	}
+	logger.WithFields(logrus.Fields{
+		"StackName": serviceName,
+		"BuildID":   previous.BuildID,
+	}).Info("Stack rolled back")
+	return nil
+}
@@ -0,0 +1,364 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	cfCustomResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+func TestS3SiteCloudFront(t *testing.T) {
+	s3Site, _ := NewSecureS3Site("./site")
+	if s3Site.CloudFront == nil {
+		t.Fatalf("Expected NewSecureS3Site to define a CloudFront distribution")
+	}
+	s3Site.CloudFront.DomainName = "www.example.com"
+	s3Site.CloudFront.HostedZoneID = "Z1234567890"
+	template := gocf.NewTemplate()
+	exportErr := s3Site.export("S3SiteCloudFrontService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{},
+		map[string]*gocf.StringExpr{},
+		template,
+		logrus.New())
+	if exportErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", exportErr)
+	}
+	resourceTypeCounts := make(map[string]int)
+	for _, eachResource := range template.Resources {
+		resourceTypeCounts[eachResource.Properties.CfnResourceType()]++
+	}
+	expectedCounts := map[string]int{
+		"AWS::CloudFront::OriginAccessControl": 1,
+		"AWS::CloudFront::Distribution":        1,
+		"AWS::CertificateManager::Certificate": 1,
+		"AWS::Route53::RecordSet":              2,
+		"AWS::S3::BucketPolicy":                1,
+	}
+	for eachType, eachCount := range expectedCounts {
+		if resourceTypeCounts[eachType] != eachCount {
+			t.Fatalf("Expected %d %s resources, found %d", eachCount, eachType, resourceTypeCounts[eachType])
+		}
+	}
+	for _, eachOutput := range []string{OutputS3SiteURL,
+		OutputS3SiteCloudFrontDomainName,
+		OutputS3SiteCloudFrontDistributionID} {
+		if _, exists := template.Outputs[eachOutput]; !exists {
+			t.Fatalf("Expected %s output", eachOutput)
+		}
+	}
+	jsonBytes, jsonErr := json.Marshal(template)
+	if jsonErr != nil {
+		t.Fatalf("Failed to marshal template: %s", jsonErr)
+	}
+	templateJSON := string(jsonBytes)
+	for _, eachExpected := range []string{`"OriginAccessControlId":{"Fn::GetAtt":`,
+		`"Service":"cloudfront.amazonaws.com"`,
+		`"AWS:SourceArn"`,
+		`"Aliases":["www.example.com"]`,
+		`"SslSupportMethod":"sni-only"`,
+		`"HostedZoneId":"Z2FDTNDATAQYW2"`,
+		`"RestrictPublicBuckets":true`,
+		`"ObjectOwnership":"BucketOwnerEnforced"`,
+		`"SSEAlgorithm":"AES256"`,
+		`"aws:SecureTransport":"false"`,
+		`"ResponsePagePath":"/error.html"`} {
+		if !strings.Contains(templateJSON, eachExpected) {
+			t.Fatalf("Expected %s in template: %s", eachExpected, templateJSON)
+		}
+	}
+	if _, exists := template.Outputs[OutputS3SiteChangedPaths]; !exists {
+		t.Fatalf("Expected %s output", OutputS3SiteChangedPaths)
+	}
+	if strings.Contains(templateJSON, "PublicRead") {
+		t.Fatalf("CloudFront S3Site bucket must not be public: %s", templateJSON)
+	}
+
+	// Certificates require a domain name
+	invalidSite, _ := NewS3Site("./site")
+	invalidSite.CloudFront = &S3SiteCloudFront{
+		HostedZoneID: "Z1234567890",
+	}
+	exportErr = invalidSite.export("S3SiteCloudFrontService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{},
+		map[string]*gocf.StringExpr{},
+		gocf.NewTemplate(),
+		logrus.New())
+	if exportErr == nil {
+		t.Fatalf("Expected error for CloudFront HostedZoneID without DomainName")
+	}
+}
+
+func TestS3SiteSync(t *testing.T) {
+	s3Site, _ := NewS3Site("./site")
+	s3Site.Sync = &S3SiteSync{
+		DeleteRemoved: true,
+		ObjectHeaders: []*S3SiteObjectHeaders{
+			{
+				Pattern:      "*.html",
+				CacheControl: "no-cache",
+			},
+		},
+	}
+	template := gocf.NewTemplate()
+	exportErr := s3Site.export("S3SiteSyncService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{},
+		map[string]*gocf.StringExpr{},
+		template,
+		logrus.New())
+	if exportErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", exportErr)
+	}
+	jsonBytes, jsonErr := json.Marshal(template)
+	if jsonErr != nil {
+		t.Fatalf("Failed to marshal template: %s", jsonErr)
+	}
+	templateJSON := string(jsonBytes)
+	for _, eachExpected := range []string{`"Incremental":true`,
+		`"DeleteRemoved":true`,
+		`"ObjectHeaders":[{"Pattern":"*.html","CacheControl":"no-cache"}]`} {
+		if !strings.Contains(templateJSON, eachExpected) {
+			t.Fatalf("Expected %s in template: %s", eachExpected, templateJSON)
+		}
+	}
+
+	// Invalid patterns are rejected
+	s3Site.Sync.ObjectHeaders[0].Pattern = "[*.html"
+	exportErr = s3Site.export("S3SiteSyncService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{},
+		map[string]*gocf.StringExpr{},
+		gocf.NewTemplate(),
+		logrus.New())
+	if exportErr == nil {
+		t.Fatalf("Expected error for invalid ObjectHeaders pattern")
+	}
+}
+
+func TestS3SiteWebsiteConfiguration(t *testing.T) {
+	exportSite := func(s3Site *S3Site) (string, error) {
+		template := gocf.NewTemplate()
+		exportErr := s3Site.export("S3SiteWebsiteService",
+			"bootstrap",
+			"testBucket",
+			"testKey",
+			"testResourcesKey",
+			map[string]*gocf.Output{},
+			map[string]*gocf.StringExpr{},
+			template,
+			logrus.New())
+		if exportErr != nil {
+			return "", exportErr
+		}
+		jsonBytes, jsonErr := json.Marshal(template)
+		return string(jsonBytes), jsonErr
+	}
+	// SPA with routing rules
+	s3Site, _ := NewS3Site("./site")
+	s3Site.SPA = true
+	s3Site.WebsiteConfiguration = &s3.WebsiteConfiguration{
+		RoutingRules: []*s3.RoutingRule{
+			{
+				Condition: &s3.Condition{
+					KeyPrefixEquals: aws.String("docs/"),
+				},
+				Redirect: &s3.Redirect{
+					ReplaceKeyPrefixWith: aws.String("documents/"),
+				},
+			},
+		},
+	}
+	templateJSON, templateErr := exportSite(s3Site)
+	if templateErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", templateErr)
+	}
+	for _, eachExpected := range []string{`"ErrorDocument":"index.html"`,
+		`"RoutingRules":[{"RedirectRule":{"ReplaceKeyPrefixWith":"documents/"},"RoutingRuleCondition":{"KeyPrefixEquals":"docs/"}}]`} {
+		if !strings.Contains(templateJSON, eachExpected) {
+			t.Fatalf("Expected %s in template: %s", eachExpected, templateJSON)
+		}
+	}
+
+	// SPA with CloudFront
+	s3Site, _ = NewS3Site("./site")
+	s3Site.SPA = true
+	s3Site.CloudFront = &S3SiteCloudFront{}
+	templateJSON, templateErr = exportSite(s3Site)
+	if templateErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", templateErr)
+	}
+	expectedErrorResponse := `{"ErrorCode":404,"ResponseCode":200,"ResponsePagePath":"/index.html"}`
+	if !strings.Contains(templateJSON, expectedErrorResponse) {
+		t.Fatalf("Expected %s in template: %s", expectedErrorResponse, templateJSON)
+	}
+
+	// Redirects
+	s3Site, _ = NewS3Site("./site")
+	s3Site.WebsiteConfiguration = &s3.WebsiteConfiguration{
+		RedirectAllRequestsTo: &s3.RedirectAllRequestsTo{
+			HostName: aws.String("www.example.com"),
+			Protocol: aws.String("https"),
+		},
+	}
+	templateJSON, templateErr = exportSite(s3Site)
+	if templateErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", templateErr)
+	}
+	expectedRedirect := `"WebsiteConfiguration":{"RedirectAllRequestsTo":{"HostName":"www.example.com","Protocol":"https"}}`
+	if !strings.Contains(templateJSON, expectedRedirect) {
+		t.Fatalf("Expected %s in template: %s", expectedRedirect, templateJSON)
+	}
+	s3Site.WebsiteConfiguration.RoutingRules = []*s3.RoutingRule{{}}
+	if _, templateErr = exportSite(s3Site); templateErr == nil {
+		t.Fatalf("Expected error for RedirectAllRequestsTo with RoutingRules")
+	}
+}
+
+func TestS3SiteConfig(t *testing.T) {
+	s3Site, _ := NewS3Site("./site")
+	s3Site.Config = &S3SiteConfig{
+		ConfigFile:    "config.json",
+		TemplateFiles: []string{"*.html"},
+		Values: map[string]gocf.Stringable{
+			"UserPoolID": gocf.Ref("UserPool"),
+		},
+	}
+	template := gocf.NewTemplate()
+	exportErr := s3Site.export("S3SiteConfigService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{
+			"APIGatewayURL": {
+				Description: "API Gateway URL",
+				Value:       gocf.String("https://api.example.com"),
+			},
+		},
+		map[string]*gocf.StringExpr{},
+		template,
+		logrus.New())
+	if exportErr != nil {
+		t.Fatalf("Failed to export S3Site: %s", exportErr)
+	}
+	jsonBytes, jsonErr := json.Marshal(template)
+	if jsonErr != nil {
+		t.Fatalf("Failed to marshal template: %s", jsonErr)
+	}
+	templateJSON := string(jsonBytes)
+	for _, eachExpected := range []string{`"ConfigFile":"config.json"`,
+		`"TemplateFiles":["*.html"]`,
+		`"UserPoolID":{"Value":{"Ref":"UserPool"}}`,
+		`"APIGatewayURL":{"Description":"API Gateway URL","Value":"https://api.example.com"}`} {
+		if !strings.Contains(templateJSON, eachExpected) {
+			t.Fatalf("Expected %s in template: %s", eachExpected, templateJSON)
+		}
+	}
+
+	// Values can't replace the outputs
+	s3Site.Config.Values["APIGatewayURL"] = gocf.String("https://other.example.com")
+	exportErr = s3Site.export("S3SiteConfigService",
+		"bootstrap",
+		"testBucket",
+		"testKey",
+		"testResourcesKey",
+		map[string]*gocf.Output{
+			"APIGatewayURL": {
+				Value: gocf.String("https://api.example.com"),
+			},
+		},
+		map[string]*gocf.StringExpr{},
+		gocf.NewTemplate(),
+		logrus.New())
+	if exportErr == nil {
+		t.Fatalf("Expected error for conflicting S3Site Config value")
+	}
+}
+
+func TestS3SiteInvalidationPaths(t *testing.T) {
+	newStack := func(changedPaths string) *cloudformation.Stack {
+		return &cloudformation.Stack{
+			Outputs: []*cloudformation.Output{
+				{
+					OutputKey:   aws.String(OutputS3SiteCloudFrontDistributionID),
+					OutputValue: aws.String("E1234567890"),
+				},
+				{
+					OutputKey:   aws.String(OutputS3SiteChangedPaths),
+					OutputValue: aws.String(changedPaths),
+				},
+			},
+		}
+	}
+	distributionID, paths := s3SiteInvalidationPaths(newStack("/,/index.html"))
+	if distributionID != "E1234567890" || len(paths) != 2 || paths[1] != "/index.html" {
+		t.Fatalf("Unexpected invalidation: %s %v", distributionID, paths)
+	}
+	_, paths = s3SiteInvalidationPaths(newStack(cfCustomResources.ZipToS3BucketNoChangedPaths))
+	if len(paths) != 0 {
+		t.Fatalf("Expected no invalidation paths for unchanged content: %v", paths)
+	}
+	distributionID, _ = s3SiteInvalidationPaths(&cloudformation.Stack{})
+	if distributionID != "" {
+		t.Fatalf("Expected empty distribution ID for stack without outputs")
+	}
+}
+
+func TestS3SiteBuildHook(t *testing.T) {
+	outputDir, outputDirErr := ioutil.TempDir("", "s3sitebuild")
+	if outputDirErr != nil {
+		t.Fatalf("Failed to create temporary directory: %s", outputDirErr)
+	}
+	defer os.RemoveAll(outputDir)
+
+	hook := &SiteBuildHook{
+		Command:    []string{"sh", "-c", "echo $SITE_TITLE > index.html"},
+		WorkingDir: outputDir,
+		Env: map[string]string{
+			"SITE_TITLE": "Sparta",
+		},
+	}
+	runErr := hook.run(logrus.New())
+	if runErr != nil {
+		t.Fatalf("Failed to run S3Site build hook: %s", runErr)
+	}
+	indexContents, indexErr := ioutil.ReadFile(filepath.Join(outputDir, "index.html"))
+	if indexErr != nil || strings.TrimSpace(string(indexContents)) != "Sparta" {
+		t.Fatalf("Unexpected build hook output: %s (%v)", string(indexContents), indexErr)
+	}
+
+	// Non-zero exit codes are errors
+	hook.Command = []string{"sh", "-c", "exit 1"}
+	if hook.run(logrus.New()) == nil {
+		t.Fatalf("Expected error for failed S3Site build hook")
+	}
+	hook.Command = nil
+	if hook.run(logrus.New()) == nil {
+		t.Fatalf("Expected error for empty S3Site build hook command")
+	}
+}
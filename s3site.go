@@ -9,15 +9,101 @@ func stableCloudformationResourceName(prefix string) string {
 	return CloudFormationResourceName(prefix, prefix)
 }
 
+// S3SiteCloudFront represents the CloudFront distribution that fronts an
+// S3Site bucket. The distribution uses Origin Access Control so that the
+// bucket itself isn't publicly accessible. See
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/private-content-restricting-access-to-s3.html
+type S3SiteCloudFront struct {
+	// Optional custom domain name for the site (eg: www.example.com)
+	DomainName string
+	// Optional existing ACM certificate ARN for the DomainName. If nil, a
+	// DNS validated certificate is created in the stack's region. CloudFront
+	// requires a certificate in us-east-1.
+	CertificateArn gocf.Stringable
+	// Optional Route53 hosted zone ID for the DomainName. If defined, the
+	// created certificate's DNS validation records and the alias records
+	// for the domain name are created in the hosted zone.
+	HostedZoneID string
+	// Optional distribution price class. Defaults to PriceClass_100.
+	PriceClass string
+}
+
+// S3SiteObjectHeaders are the HTTP headers applied to the S3Site objects
+// whose keys match the Pattern
+type S3SiteObjectHeaders struct {
+	// Pattern is a path.Match pattern relative to the site root (eg: *.html,
+	// assets/*). Patterns without a "/" also match the key's base name.
+	Pattern string
+	// Optional Content-Type. Defaults to the type associated with the
+	// file extension.
+	ContentType string
+	// Optional Cache-Control value (eg: public, max-age=31536000, immutable)
+	CacheControl string
+}
+
+// S3SiteSync represents the incremental synchronization of the S3Site
+// resources with the bucket. Only the files whose content changed are
+// uploaded. Content changes are detected by comparing the file's MD5 digest
+// to the object's ETag, so the bucket must not use SSE-KMS encryption.
+type S3SiteSync struct {
+	// DeleteRemoved deletes the bucket objects that are no longer
+	// part of the resources
+	DeleteRemoved bool
+	// ObjectHeaders are applied in order, with the values of later
+	// matching entries taking precedence. Changing the ObjectHeaders
+	// uploads all files.
+	ObjectHeaders []*S3SiteObjectHeaders
+}
+
+// SiteBuildHook is a command (eg: npm run build) that builds the S3Site
+// resources before they're archived. Provisioning fails if the command
+// exits with a non-zero status.
+type SiteBuildHook struct {
+	// Command is the executable and its arguments
+	// (eg: []string{"npm", "run", "build"})
+	Command []string
+	// Optional working directory. Defaults to the current directory.
+	WorkingDir string
+	// Optional environment variables added to the current environment
+	Env map[string]string
+}
+
+// S3SiteConfig renders deploy time values, such as the API Gateway URL,
+// into the site content. The values are the API Gateway stack outputs
+// (eg: APIGatewayURL), the Values entries, and the UserManifestData as
+// the "userdata" value.
+type S3SiteConfig struct {
+	// ConfigFile is the optional site relative path of a JSON file
+	// (eg: config.json) that is written with the values
+	ConfigFile string
+	// TemplateFiles are path.Match patterns of site files that are rendered
+	// as text/template templates with the values (eg: {{ .APIGatewayURL }}).
+	// Patterns without a "/" also match the file's base name.
+	TemplateFiles []string
+	// Optional template delimiters. Default to "{{" and "}}".
+	LeftDelim  string
+	RightDelim string
+	// Values are additional values, such as gocf.GetAtt expressions,
+	// keyed by name
+	Values map[string]gocf.Stringable
+}
+
 // S3Site provisions a new, publicly available S3Bucket populated by the
-// contents of the resources directory.
+// contents of the resources directory. If CloudFront is defined, the bucket
+// is private and the content is served by a CloudFront distribution.
 // http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/quickref-s3.html#scenario-s3-bucket-website-customdomain
 type S3Site struct {
 	// Directory or filepath (uncompressed) of contents to use to initialize
 	// S3 bucket hosting site.
 	resources string
-	// If nil, defaults to ErrorDocument: error.html and IndexDocument: index.html
+	// If nil, defaults to ErrorDocument: error.html and IndexDocument: index.html.
+	// The RoutingRules and RedirectAllRequestsTo values are applied to the
+	// bucket website configuration.
 	WebsiteConfiguration *s3.WebsiteConfiguration
+	// SPA enables single page application routing. Requests for keys that
+	// don't exist return the IndexDocument so that the client side router
+	// can handle the path.
+	SPA bool
 	// BucketName is the name of the bucket to create. Required
 	// to specify a CloudFront Distribution
 	BucketName *gocf.StringExpr
@@ -26,6 +112,18 @@ type S3Site struct {
 	// values will be scoped to a `userdata` key in the MANIFEST.json
 	// object
 	UserManifestData map[string]interface{}
+	// CloudFront is the optional CloudFront distribution that serves
+	// the site content
+	CloudFront *S3SiteCloudFront
+	// Sync is the optional incremental synchronization configuration. If
+	// nil, every file is uploaded each time the site content changes.
+	Sync *S3SiteSync
+	// BuildHook is the optional command that builds the resources
+	// before they're archived
+	BuildHook *SiteBuildHook
+	// Config is the optional configuration that renders deploy time
+	// values into the site content
+	Config *S3SiteConfig
 }
 
 // CloudFormationS3ResourceName returns the stable CloudformationResource name that
@@ -9,3 +9,11 @@ package sparta
 func NewS3Site(resources string) (*S3Site, error) {
 	return &S3Site{}, nil
 }
+
+// NewSecureS3Site returns a new S3Site pointer initialized with the static
+// resources at the supplied path. The site bucket blocks all public access
+// and the content is served by a CloudFront distribution that is the only
+// principal allowed to read objects.
+func NewSecureS3Site(resources string) (*S3Site, error) {
+	return &S3Site{}, nil
+}
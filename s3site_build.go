@@ -3,10 +3,19 @@
 package sparta
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	cfCustomResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
 	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	"github.com/mweagle/Sparta/system"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -19,6 +28,108 @@ const (
 	OutputS3SiteURL = "S3SiteURL"
 )
 
+// bucketWebsiteConfiguration returns the bucket website configuration for
+// the site's WebsiteConfiguration
+func (s3Site *S3Site) bucketWebsiteConfiguration() (*gocf.S3BucketWebsiteConfiguration, error) {
+	websiteConfig := s3Site.WebsiteConfiguration
+	indexDocument := aws.StringValue(websiteConfig.IndexDocument.Suffix)
+	errorDocument := aws.StringValue(websiteConfig.ErrorDocument.Key)
+	if indexDocument == "" || errorDocument == "" {
+		return nil, errors.Errorf("S3Site IndexDocument and ErrorDocument values must not be empty")
+	}
+	// Missing keys are handled by the client side router
+	if s3Site.SPA {
+		errorDocument = indexDocument
+	}
+	// Redirecting every request excludes the other properties
+	if websiteConfig.RedirectAllRequestsTo != nil {
+		if aws.StringValue(websiteConfig.RedirectAllRequestsTo.HostName) == "" {
+			return nil, errors.Errorf("S3Site RedirectAllRequestsTo HostName must not be empty")
+		}
+		if len(websiteConfig.RoutingRules) != 0 {
+			return nil, errors.Errorf("S3Site RedirectAllRequestsTo and RoutingRules are mutually exclusive")
+		}
+		return &gocf.S3BucketWebsiteConfiguration{
+			RedirectAllRequestsTo: &gocf.S3BucketRedirectAllRequestsTo{
+				HostName: gocf.String(aws.StringValue(websiteConfig.RedirectAllRequestsTo.HostName)),
+				Protocol: optionalStringExpr(websiteConfig.RedirectAllRequestsTo.Protocol),
+			},
+		}, nil
+	}
+	bucketWebsiteConfig := &gocf.S3BucketWebsiteConfiguration{
+		ErrorDocument: gocf.String(errorDocument),
+		IndexDocument: gocf.String(indexDocument),
+	}
+	if len(websiteConfig.RoutingRules) != 0 {
+		routingRules := gocf.S3BucketRoutingRuleList{}
+		for eachIndex, eachRule := range websiteConfig.RoutingRules {
+			if eachRule == nil || eachRule.Redirect == nil {
+				return nil, errors.Errorf("S3Site RoutingRules[%d] must define a Redirect", eachIndex)
+			}
+			routingRule := gocf.S3BucketRoutingRule{
+				RedirectRule: &gocf.S3BucketRedirectRule{
+					HostName:             optionalStringExpr(eachRule.Redirect.HostName),
+					HTTPRedirectCode:     optionalStringExpr(eachRule.Redirect.HttpRedirectCode),
+					Protocol:             optionalStringExpr(eachRule.Redirect.Protocol),
+					ReplaceKeyPrefixWith: optionalStringExpr(eachRule.Redirect.ReplaceKeyPrefixWith),
+					ReplaceKeyWith:       optionalStringExpr(eachRule.Redirect.ReplaceKeyWith),
+				},
+			}
+			if eachRule.Condition != nil {
+				routingRule.RoutingRuleCondition = &gocf.S3BucketRoutingRuleCondition{
+					HTTPErrorCodeReturnedEquals: optionalStringExpr(eachRule.Condition.HttpErrorCodeReturnedEquals),
+					KeyPrefixEquals:             optionalStringExpr(eachRule.Condition.KeyPrefixEquals),
+				}
+			}
+			routingRules = append(routingRules, routingRule)
+		}
+		bucketWebsiteConfig.RoutingRules = &routingRules
+	}
+	return bucketWebsiteConfig, nil
+}
+
+// privateBucket returns the bucket for CloudFront sites. The bucket blocks
+// all public access, disables ACLs, and encrypts objects. Objects are
+// only readable by the distribution.
+func (s3Site *S3Site) privateBucket() *s3BucketResource {
+	return &s3BucketResource{
+		S3Bucket: gocf.S3Bucket{
+			BucketEncryption: &gocf.S3BucketBucketEncryption{
+				ServerSideEncryptionConfiguration: &gocf.S3BucketServerSideEncryptionRuleList{
+					gocf.S3BucketServerSideEncryptionRule{
+						ServerSideEncryptionByDefault: &gocf.S3BucketServerSideEncryptionByDefault{
+							SSEAlgorithm: gocf.String("AES256"),
+						},
+					},
+				},
+			},
+			BucketName: s3Site.BucketName,
+			PublicAccessBlockConfiguration: &gocf.S3BucketPublicAccessBlockConfiguration{
+				BlockPublicACLs:       gocf.Bool(true),
+				BlockPublicPolicy:     gocf.Bool(true),
+				IgnorePublicACLs:      gocf.Bool(true),
+				RestrictPublicBuckets: gocf.Bool(true),
+			},
+		},
+		OwnershipControls: &s3BucketOwnershipControls{
+			Rules: []s3BucketOwnershipControlsRule{
+				{
+					ObjectOwnership: gocf.String("BucketOwnerEnforced"),
+				},
+			},
+		},
+	}
+}
+
+// optionalStringExpr returns a StringExpr for the value, or nil if the
+// value is empty
+func optionalStringExpr(value *string) *gocf.StringExpr {
+	if aws.StringValue(value) == "" {
+		return nil
+	}
+	return gocf.String(aws.StringValue(value))
+}
+
 // Create the resource, which will be part of the stack definition and use a CustomResource
 // to copy the content.  Which means we need PutItem access to the target Bucket.  Use
 // Cloudformation to create a random bucketname:
@@ -64,25 +175,28 @@ func (s3Site *S3Site) export(serviceName string,
 	// 1 - Create the S3 bucket.  The "BucketName" property is empty s.t.
 	// AWS will assign a unique one.
 
-	s3WebsiteConfig := &gocf.S3BucketWebsiteConfiguration{
-		ErrorDocument: gocf.String(aws.StringValue(s3Site.WebsiteConfiguration.ErrorDocument.Key)),
-		IndexDocument: gocf.String(aws.StringValue(s3Site.WebsiteConfiguration.IndexDocument.Suffix)),
+	s3WebsiteConfig, s3WebsiteConfigErr := s3Site.bucketWebsiteConfiguration()
+	if s3WebsiteConfigErr != nil {
+		return s3WebsiteConfigErr
 	}
-	s3Bucket := &gocf.S3Bucket{
-		AccessControl:        gocf.String("PublicRead"),
-		WebsiteConfiguration: s3WebsiteConfig,
-	}
-	if s3Site.BucketName != nil {
-		s3Bucket.BucketName = s3Site.BucketName
+	if s3Site.CloudFront != nil &&
+		(s3WebsiteConfig.RoutingRules != nil || s3WebsiteConfig.RedirectAllRequestsTo != nil) {
+		logger.Warn("S3Site RoutingRules and RedirectAllRequestsTo are not applied to CloudFront distributions")
 	}
 	s3BucketResourceName := s3Site.CloudFormationS3ResourceName()
-	cfResource := template.AddResource(s3BucketResourceName, s3Bucket)
-	cfResource.DeletionPolicy = "Delete"
-
-	template.Outputs[OutputS3SiteURL] = &gocf.Output{
-		Description: "S3 Website URL",
-		Value:       gocf.GetAtt(s3BucketResourceName, "WebsiteURL"),
+	var cfResource *gocf.Resource
+	if s3Site.CloudFront != nil {
+		cfResource = template.AddResource(s3BucketResourceName, s3Site.privateBucket())
+	} else {
+		logger.Info("S3Site bucket is publicly readable. Set S3Site.CloudFront to serve the site from a private bucket.")
+		publicBucket := &gocf.S3Bucket{
+			AccessControl:        gocf.String("PublicRead"),
+			BucketName:           s3Site.BucketName,
+			WebsiteConfiguration: s3WebsiteConfig,
+		}
+		cfResource = template.AddResource(s3BucketResourceName, publicBucket)
 	}
+	cfResource.DeletionPolicy = "Delete"
 
 	// Represents the S3 ARN that is provisioned
 	s3SiteBucketResourceValue := gocf.Join("",
@@ -97,25 +211,46 @@ func (s3Site *S3Site) export(serviceName string,
 	// 2 - Add a bucket policy to enable anonymous access, as the PublicRead
 	// canned ACL doesn't seem to do what is implied.
 	// TODO - determine if this is needed or if PublicRead is being misued
-	s3SiteBucketPolicy := &gocf.S3BucketPolicy{
-		Bucket: gocf.Ref(s3BucketResourceName).String(),
-		PolicyDocument: ArbitraryJSONObject{
-			"Version": "2012-10-17",
-			"Statement": []ArbitraryJSONObject{
-				{
-					"Sid":    "PublicReadGetObject",
-					"Effect": "Allow",
-					"Principal": ArbitraryJSONObject{
-						"AWS": "*",
+	// CloudFront sites instead grant read access to the distribution.
+	siteURL := gocf.GetAtt(s3BucketResourceName, "WebsiteURL")
+	siteURLDescription := "S3 Website URL"
+	if s3Site.CloudFront != nil {
+		cloudFrontURL, cloudFrontErr := s3Site.CloudFront.export(serviceName,
+			s3BucketResourceName,
+			aws.StringValue(s3Site.WebsiteConfiguration.IndexDocument.Suffix),
+			aws.StringValue(s3Site.WebsiteConfiguration.ErrorDocument.Key),
+			s3Site.SPA,
+			template)
+		if cloudFrontErr != nil {
+			return errors.Wrapf(cloudFrontErr, "Failed to create S3 site CloudFront distribution")
+		}
+		siteURL = cloudFrontURL
+		siteURLDescription = "S3 Site CloudFront URL"
+	} else {
+		s3SiteBucketPolicy := &gocf.S3BucketPolicy{
+			Bucket: gocf.Ref(s3BucketResourceName).String(),
+			PolicyDocument: ArbitraryJSONObject{
+				"Version": "2012-10-17",
+				"Statement": []ArbitraryJSONObject{
+					{
+						"Sid":    "PublicReadGetObject",
+						"Effect": "Allow",
+						"Principal": ArbitraryJSONObject{
+							"AWS": "*",
+						},
+						"Action":   "s3:GetObject",
+						"Resource": s3SiteBucketAllKeysResourceValue,
 					},
-					"Action":   "s3:GetObject",
-					"Resource": s3SiteBucketAllKeysResourceValue,
 				},
 			},
-		},
+		}
+		s3BucketPolicyResourceName := stableCloudformationResourceName("S3SiteBucketPolicy")
+		template.AddResource(s3BucketPolicyResourceName, s3SiteBucketPolicy)
+	}
+	template.Outputs[OutputS3SiteURL] = &gocf.Output{
+		Description: siteURLDescription,
+		Value:       siteURL,
 	}
-	s3BucketPolicyResourceName := stableCloudformationResourceName("S3SiteBucketPolicy")
-	template.AddResource(s3BucketPolicyResourceName, s3SiteBucketPolicy)
 
 	//////////////////////////////////////////////////////////////////////////////
 	// 3 - Create the IAM role for the lambda function
@@ -229,6 +364,28 @@ func (s3Site *S3Site) export(serviceName string,
 	zipResource.SrcKeyName = gocf.String(S3ResourcesKey)
 	zipResource.SrcBucket = gocf.String(S3Bucket)
 	zipResource.DestBucket = gocf.Ref(s3BucketResourceName).String()
+	if s3Site.Sync != nil {
+		zipResource.Incremental = gocf.Bool(true)
+		zipResource.DeleteRemoved = gocf.Bool(s3Site.Sync.DeleteRemoved)
+		for _, eachHeaders := range s3Site.Sync.ObjectHeaders {
+			if eachHeaders == nil {
+				continue
+			}
+			if _, matchErr := path.Match(eachHeaders.Pattern, ""); matchErr != nil {
+				return errors.Wrapf(matchErr, "Invalid S3Site ObjectHeaders pattern: %s", eachHeaders.Pattern)
+			}
+			objectHeaders := &cfCustomResources.ZipToS3BucketObjectHeaders{
+				Pattern: gocf.String(eachHeaders.Pattern),
+			}
+			if eachHeaders.ContentType != "" {
+				objectHeaders.ContentType = gocf.String(eachHeaders.ContentType)
+			}
+			if eachHeaders.CacheControl != "" {
+				objectHeaders.CacheControl = gocf.String(eachHeaders.CacheControl)
+			}
+			zipResource.ObjectHeaders = append(zipResource.ObjectHeaders, objectHeaders)
+		}
+	}
 
 	// Build the manifest data with any output info...
 	manifestData := make(map[string]interface{})
@@ -241,8 +398,22 @@ func (s3Site *S3Site) export(serviceName string,
 	if len(s3Site.UserManifestData) != 0 {
 		manifestData["userdata"] = s3Site.UserManifestData
 	}
+	if s3Site.Config != nil {
+		configErr := s3Site.Config.export(manifestData, zipResource)
+		if configErr != nil {
+			return errors.Wrapf(configErr, "Failed to create S3 site config")
+		}
+	}
 
 	zipResource.Manifest = manifestData
+	// Report the changed paths so that they can be invalidated
+	if s3Site.CloudFront != nil {
+		zipResource.RootObject = aws.StringValue(s3Site.WebsiteConfiguration.IndexDocument.Suffix)
+		template.Outputs[OutputS3SiteChangedPaths] = &gocf.Output{
+			Description: "S3 Site paths changed by the most recent provision",
+			Value:       gocf.GetAtt(customResourceName, cfCustomResources.ZipToS3BucketChangedPaths),
+		}
+	}
 	cfResource = template.AddResource(customResourceName, zipResource)
 	cfResource.DependsOn = append(cfResource.DependsOn,
 		lambdaResourceName,
@@ -251,6 +422,72 @@ func (s3Site *S3Site) export(serviceName string,
 	return nil
 }
 
+// export adds the config values to the manifest and the
+// rendering options to the resource
+func (config *S3SiteConfig) export(manifestData map[string]interface{},
+	zipResource *cfCustomResources.ZipToS3BucketResource) error {
+	for eachKey, eachValue := range config.Values {
+		if _, exists := manifestData[eachKey]; exists {
+			return errors.Errorf("S3Site Config value %s conflicts with an existing value", eachKey)
+		}
+		if eachValue == nil {
+			return errors.Errorf("S3Site Config value %s must not be nil", eachKey)
+		}
+		manifestData[eachKey] = map[string]interface{}{
+			"Value": eachValue.String(),
+		}
+	}
+	for _, eachPattern := range config.TemplateFiles {
+		if _, matchErr := path.Match(eachPattern, ""); matchErr != nil {
+			return errors.Wrapf(matchErr, "Invalid S3Site TemplateFiles pattern: %s", eachPattern)
+		}
+	}
+	if (config.LeftDelim == "") != (config.RightDelim == "") {
+		return errors.Errorf("S3Site Config LeftDelim and RightDelim must both be defined")
+	}
+	zipResource.ConfigFile = config.ConfigFile
+	zipResource.TemplateFiles = config.TemplateFiles
+	zipResource.TemplateLeftDelim = config.LeftDelim
+	zipResource.TemplateRightDelim = config.RightDelim
+	return nil
+}
+
+// run executes the build command, logs its output, and returns an error
+// if the command fails
+func (hook *SiteBuildHook) run(logger *logrus.Logger) error {
+	if len(hook.Command) == 0 || hook.Command[0] == "" {
+		return errors.Errorf("S3Site BuildHook Command must not be empty")
+	}
+	cmd := exec.Command(hook.Command[0], hook.Command[1:]...)
+	cmd.Dir = hook.WorkingDir
+	cmd.Env = os.Environ()
+	envKeys := make([]string, 0, len(hook.Env))
+	for eachKey := range hook.Env {
+		envKeys = append(envKeys, eachKey)
+	}
+	sort.Strings(envKeys)
+	for _, eachKey := range envKeys {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", eachKey, hook.Env[eachKey]))
+	}
+	logger.WithFields(logrus.Fields{
+		"Command":    strings.Join(hook.Command, " "),
+		"WorkingDir": hook.WorkingDir,
+	}).Info("Running S3Site build hook")
+
+	var output bytes.Buffer
+	runErr := system.RunAndCaptureOSCommand(cmd, &output, &output, logger)
+	for _, eachLine := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if eachLine != "" {
+			logger.WithField("Command", hook.Command[0]).Info(eachLine)
+		}
+	}
+	if runErr != nil {
+		return errors.Wrapf(runErr, "S3Site build hook `%s` failed",
+			strings.Join(hook.Command, " "))
+	}
+	return nil
+}
+
 // NewS3Site returns a new S3Site pointer initialized with the
 // static resources at the supplied path.  If resources is a directory,
 // the contents will be recursively archived and used to populate
@@ -265,3 +502,16 @@ func NewS3Site(resources string) (*S3Site, error) {
 	}
 	return site, nil
 }
+
+// NewSecureS3Site returns a new S3Site pointer initialized with the static
+// resources at the supplied path. The site bucket blocks all public access
+// and the content is served by a CloudFront distribution that is the only
+// principal allowed to read objects.
+func NewSecureS3Site(resources string) (*S3Site, error) {
+	site, siteErr := NewS3Site(resources)
+	if siteErr != nil {
+		return nil, siteErr
+	}
+	site.CloudFront = &S3SiteCloudFront{}
+	return site, nil
+}
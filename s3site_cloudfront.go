@@ -0,0 +1,422 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	cfCustomResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OutputS3SiteCloudFrontDomainName is the keyname used in the CloudFormation
+	// Output that stores the CloudFront distribution domain name of the S3Site
+	// @enum OutputKey
+	OutputS3SiteCloudFrontDomainName = "S3SiteCloudFrontDomainName"
+	// OutputS3SiteCloudFrontDistributionID is the keyname used in the CloudFormation
+	// Output that stores the CloudFront distribution ID of the S3Site
+	// @enum OutputKey
+	OutputS3SiteCloudFrontDistributionID = "S3SiteCloudFrontDistributionID"
+	// OutputS3SiteChangedPaths is the keyname used in the CloudFormation
+	// Output that stores the comma separated S3Site paths changed by the
+	// most recent provision
+	// @enum OutputKey
+	OutputS3SiteChangedPaths = "S3SiteChangedPaths"
+)
+
+const (
+	// cloudFrontHostedZoneID is the fixed Route53 hosted zone ID used for
+	// alias records that target CloudFront distributions
+	cloudFrontHostedZoneID = "Z2FDTNDATAQYW2"
+	// cloudFrontOACMaxNameLength is the maximum length of the
+	// OriginAccessControl name
+	cloudFrontOACMaxNameLength = 64
+)
+
+// s3SiteCloudFrontPriceClasses are the valid PriceClass values
+var s3SiteCloudFrontPriceClasses = map[string]bool{
+	"PriceClass_100": true,
+	"PriceClass_200": true,
+	"PriceClass_All": true,
+}
+
+// export adds the OriginAccessControl, the CloudFront distribution, the
+// bucket policy that grants the distribution read access, and the
+// optional certificate and alias records. The return value is the URL
+// of the site.
+func (cloudFront *S3SiteCloudFront) export(serviceName string,
+	s3BucketResourceName string,
+	indexDocument string,
+	errorDocument string,
+	spa bool,
+	template *gocf.Template) (*gocf.StringExpr, error) {
+
+	if cloudFront.DomainName == "" &&
+		(cloudFront.CertificateArn != nil || cloudFront.HostedZoneID != "") {
+		return nil, errors.Errorf("S3Site CloudFront CertificateArn and HostedZoneID require a DomainName")
+	}
+	priceClass := cloudFront.PriceClass
+	if priceClass == "" {
+		priceClass = "PriceClass_100"
+	}
+	if !s3SiteCloudFrontPriceClasses[priceClass] {
+		return nil, errors.Errorf("Invalid S3Site CloudFront PriceClass: %s", cloudFront.PriceClass)
+	}
+
+	//////////////////////////////////////////////////////////////////////////////
+	// 1 - The OriginAccessControl. Names are unique per account, so
+	// scope it to the region as well.
+	oacNamePrefix := fmt.Sprintf("%s-S3Site", serviceName)
+	// Leave room for the "-<region>" suffix
+	maxPrefixLength := cloudFrontOACMaxNameLength - 16
+	if len(oacNamePrefix) > maxPrefixLength {
+		oacNamePrefix = oacNamePrefix[0:maxPrefixLength]
+	}
+	oacResourceName := stableCloudformationResourceName("S3SiteOAC")
+	template.AddResource(oacResourceName, &cloudFrontOriginAccessControl{
+		OriginAccessControlConfig: &cloudFrontOriginAccessControlConfig{
+			Description: gocf.String(fmt.Sprintf("%s S3Site", serviceName)),
+			Name: gocf.Join("-",
+				gocf.String(oacNamePrefix),
+				gocf.Ref("AWS::Region")),
+			OriginAccessControlOriginType: gocf.String("s3"),
+			SigningBehavior:               gocf.String("always"),
+			SigningProtocol:               gocf.String("sigv4"),
+		},
+	})
+
+	//////////////////////////////////////////////////////////////////////////////
+	// 2 - The optional certificate
+	var certificateArn *gocf.StringExpr
+	if cloudFront.DomainName != "" {
+		if cloudFront.CertificateArn != nil {
+			certificateArn = cloudFront.CertificateArn.String()
+		} else {
+			certificate := &certificateManagerCertificate{
+				CertificateManagerCertificate: gocf.CertificateManagerCertificate{
+					DomainName:       gocf.String(cloudFront.DomainName),
+					ValidationMethod: gocf.String("DNS"),
+				},
+			}
+			if cloudFront.HostedZoneID != "" {
+				certificate.DomainValidationOptions = []certificateManagerCertificateDomainValidationOption{
+					{
+						DomainName:   gocf.String(cloudFront.DomainName),
+						HostedZoneID: gocf.String(cloudFront.HostedZoneID),
+					},
+				}
+			}
+			certificateResName := CloudFormationResourceName("S3SiteCertificate",
+				cloudFront.DomainName)
+			template.AddResource(certificateResName, certificate)
+			certificateArn = gocf.Ref(certificateResName).String()
+		}
+	}
+
+	//////////////////////////////////////////////////////////////////////////////
+	// 3 - The distribution. The origin is the bucket's REST endpoint, not
+	// the website endpoint, so that requests are signed with the OAC.
+	errorPagePath := fmt.Sprintf("/%s", errorDocument)
+	errorResponseCode := int64(404)
+	// SPA paths are handled by the client side router
+	if spa {
+		errorPagePath = fmt.Sprintf("/%s", indexDocument)
+		errorResponseCode = 200
+	}
+	distroConfig := &cloudFrontDistributionConfig{
+		CloudFrontDistributionDistributionConfig: gocf.CloudFrontDistributionDistributionConfig{
+			Comment: gocf.String(fmt.Sprintf("%s S3Site", serviceName)),
+			// Without s3:ListBucket, missing keys are reported as 403s
+			CustomErrorResponses: &gocf.CloudFrontDistributionCustomErrorResponseList{
+				gocf.CloudFrontDistributionCustomErrorResponse{
+					ErrorCode:        gocf.Integer(403),
+					ResponseCode:     gocf.Integer(errorResponseCode),
+					ResponsePagePath: gocf.String(errorPagePath),
+				},
+				gocf.CloudFrontDistributionCustomErrorResponse{
+					ErrorCode:        gocf.Integer(404),
+					ResponseCode:     gocf.Integer(errorResponseCode),
+					ResponsePagePath: gocf.String(errorPagePath),
+				},
+			},
+			DefaultCacheBehavior: &gocf.CloudFrontDistributionDefaultCacheBehavior{
+				Compress: gocf.Bool(true),
+				ForwardedValues: &gocf.CloudFrontDistributionForwardedValues{
+					QueryString: gocf.Bool(false),
+				},
+				TargetOriginID:       gocf.String("S3Origin"),
+				ViewerProtocolPolicy: gocf.String("redirect-to-https"),
+			},
+			DefaultRootObject: gocf.String(indexDocument),
+			Enabled:           gocf.Bool(true),
+			HTTPVersion:       gocf.String("http2"),
+			IPV6Enabled:       gocf.Bool(true),
+			PriceClass:        gocf.String(priceClass),
+		},
+		Origins: []cloudFrontDistributionOrigin{
+			{
+				CloudFrontDistributionOrigin: gocf.CloudFrontDistributionOrigin{
+					DomainName: gocf.GetAtt(s3BucketResourceName, "RegionalDomainName"),
+					ID:         gocf.String("S3Origin"),
+					// OAC origins require an empty OriginAccessIdentity
+					S3OriginConfig: &gocf.CloudFrontDistributionS3OriginConfig{
+						OriginAccessIdentity: gocf.String(""),
+					},
+				},
+				OriginAccessControlID: gocf.GetAtt(oacResourceName, "Id"),
+			},
+		},
+	}
+	if certificateArn != nil {
+		distroConfig.Aliases = gocf.StringList(gocf.String(cloudFront.DomainName))
+		distroConfig.ViewerCertificate = &gocf.CloudFrontDistributionViewerCertificate{
+			AcmCertificateArn:      certificateArn,
+			MinimumProtocolVersion: gocf.String("TLSv1.2_2021"),
+			SslSupportMethod:       gocf.String("sni-only"),
+		}
+	}
+	distroResourceName := stableCloudformationResourceName("S3SiteDistribution")
+	template.AddResource(distroResourceName, &cloudFrontDistribution{
+		DistributionConfig: distroConfig,
+	})
+
+	//////////////////////////////////////////////////////////////////////////////
+	// 4 - The bucket policy that limits read access to the distribution
+	// and requires TLS
+	s3SiteBucketPolicy := &gocf.S3BucketPolicy{
+		Bucket: gocf.Ref(s3BucketResourceName).String(),
+		PolicyDocument: ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []ArbitraryJSONObject{
+				{
+					"Sid":    "CloudFrontReadGetObject",
+					"Effect": "Allow",
+					"Principal": ArbitraryJSONObject{
+						"Service": "cloudfront.amazonaws.com",
+					},
+					"Action": "s3:GetObject",
+					"Resource": gocf.Join("",
+						gocf.String("arn:aws:s3:::"),
+						gocf.Ref(s3BucketResourceName),
+						gocf.String("/*")),
+					"Condition": ArbitraryJSONObject{
+						"StringEquals": ArbitraryJSONObject{
+							"AWS:SourceArn": gocf.Join("",
+								gocf.String("arn:"),
+								gocf.Ref("AWS::Partition"),
+								gocf.String(":cloudfront::"),
+								gocf.Ref("AWS::AccountId"),
+								gocf.String(":distribution/"),
+								gocf.Ref(distroResourceName)),
+						},
+					},
+				},
+				{
+					"Sid":       "DenyInsecureTransport",
+					"Effect":    "Deny",
+					"Principal": "*",
+					"Action":    "s3:*",
+					"Resource": []*gocf.StringExpr{
+						gocf.Join("",
+							gocf.String("arn:aws:s3:::"),
+							gocf.Ref(s3BucketResourceName)),
+						gocf.Join("",
+							gocf.String("arn:aws:s3:::"),
+							gocf.Ref(s3BucketResourceName),
+							gocf.String("/*")),
+					},
+					"Condition": ArbitraryJSONObject{
+						"Bool": ArbitraryJSONObject{
+							"aws:SecureTransport": "false",
+						},
+					},
+				},
+			},
+		},
+	}
+	template.AddResource(stableCloudformationResourceName("S3SiteBucketPolicy"),
+		s3SiteBucketPolicy)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// 5 - The alias records
+	siteURL := gocf.Join("",
+		gocf.String("https://"),
+		gocf.GetAtt(distroResourceName, "DomainName"))
+	if cloudFront.DomainName != "" {
+		if cloudFront.HostedZoneID != "" {
+			for _, eachRecordType := range []string{"A", "AAAA"} {
+				template.AddResource(CloudFormationResourceName("S3SiteDomainRecord",
+					cloudFront.DomainName,
+					eachRecordType),
+					&gocf.Route53RecordSet{
+						AliasTarget: &gocf.Route53RecordSetAliasTarget{
+							DNSName:      gocf.GetAtt(distroResourceName, "DomainName"),
+							HostedZoneID: gocf.String(cloudFrontHostedZoneID),
+						},
+						HostedZoneID: gocf.String(cloudFront.HostedZoneID),
+						Name:         gocf.String(cloudFront.DomainName),
+						Type:         gocf.String(eachRecordType),
+					})
+			}
+		}
+		siteURL = gocf.String(fmt.Sprintf("https://%s", cloudFront.DomainName))
+	}
+	template.Outputs[OutputS3SiteCloudFrontDomainName] = &gocf.Output{
+		Description: "S3 Site CloudFront distribution domain name",
+		Value:       gocf.GetAtt(distroResourceName, "DomainName"),
+	}
+	template.Outputs[OutputS3SiteCloudFrontDistributionID] = &gocf.Output{
+		Description: "S3 Site CloudFront distribution ID",
+		Value:       gocf.Ref(distroResourceName),
+	}
+	return siteURL, nil
+}
+
+// s3SiteStackOutput returns the value of the named output, or an empty
+// string if it isn't defined
+func s3SiteStackOutput(stack *cloudformation.Stack, outputKey string) string {
+	for _, eachOutput := range stack.Outputs {
+		if aws.StringValue(eachOutput.OutputKey) == outputKey {
+			return aws.StringValue(eachOutput.OutputValue)
+		}
+	}
+	return ""
+}
+
+// s3SiteInvalidationPaths returns the CloudFront distribution ID and the
+// paths to invalidate following a provision. The paths are empty if
+// the site content didn't change.
+func s3SiteInvalidationPaths(stack *cloudformation.Stack) (string, []string) {
+	distributionID := s3SiteStackOutput(stack, OutputS3SiteCloudFrontDistributionID)
+	changedPaths := s3SiteStackOutput(stack, OutputS3SiteChangedPaths)
+	if distributionID == "" ||
+		changedPaths == "" ||
+		changedPaths == cfCustomResources.ZipToS3BucketNoChangedPaths {
+		return distributionID, nil
+	}
+	return distributionID, strings.Split(changedPaths, ",")
+}
+
+// createS3SiteInvalidation creates a CloudFront invalidation for the paths
+// and returns the invalidation ID
+func createS3SiteInvalidation(distributionID string,
+	paths []string,
+	callerReference string,
+	awsSession *session.Session,
+	logger *logrus.Logger) (string, error) {
+
+	cloudFrontSvc := cloudfront.New(awsSession)
+	invalidationOutput, invalidationErr := cloudFrontSvc.CreateInvalidation(&cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(distributionID),
+		InvalidationBatch: &cloudfront.InvalidationBatch{
+			CallerReference: aws.String(callerReference),
+			Paths: &cloudfront.Paths{
+				Items:    aws.StringSlice(paths),
+				Quantity: aws.Int64(int64(len(paths))),
+			},
+		},
+	})
+	if invalidationErr != nil {
+		return "", errors.Wrapf(invalidationErr,
+			"Failed to create CloudFront invalidation for distribution %s",
+			distributionID)
+	}
+	invalidationID := aws.StringValue(invalidationOutput.Invalidation.Id)
+	logger.WithFields(logrus.Fields{
+		"DistributionID": distributionID,
+		"InvalidationID": invalidationID,
+		"Paths":          paths,
+	}).Info("Created S3Site CloudFront invalidation")
+	return invalidationID, nil
+}
+
+// s3SiteInvalidationStatusFinalizer returns a finalizer that logs the
+// status of the invalidation
+func s3SiteInvalidationStatusFinalizer(distributionID string,
+	invalidationID string,
+	awsSession *session.Session) finalizerFunction {
+	return func(logger *logrus.Logger) {
+		cloudFrontSvc := cloudfront.New(awsSession)
+		invalidationOutput, invalidationErr := cloudFrontSvc.GetInvalidation(&cloudfront.GetInvalidationInput{
+			DistributionId: aws.String(distributionID),
+			Id:             aws.String(invalidationID),
+		})
+		if invalidationErr != nil {
+			logger.WithFields(logrus.Fields{
+				"InvalidationID": invalidationID,
+				"Error":          invalidationErr,
+			}).Warn("Failed to get S3Site CloudFront invalidation status")
+			return
+		}
+		logger.WithFields(logrus.Fields{
+			"DistributionID": distributionID,
+			"InvalidationID": invalidationID,
+			"Status":         aws.StringValue(invalidationOutput.Invalidation.Status),
+		}).Info("S3Site CloudFront invalidation status")
+	}
+}
+
+// s3SiteInvalidationRollback returns a rollback function that invalidates
+// all the distribution paths. A failed stack update rolls back the site
+// content, which may have already been cached.
+func s3SiteInvalidationRollback(serviceName string,
+	buildID string,
+	awsCloudFormation cloudformationiface.CloudFormationAPI,
+	awsSession *session.Session) func(logger *logrus.Logger) error {
+	return func(logger *logrus.Logger) error {
+		describeOutput, describeErr := awsCloudFormation.DescribeStacks(&cloudformation.DescribeStacksInput{
+			StackName: aws.String(serviceName),
+		})
+		// There's nothing to invalidate if the stack doesn't exist
+		if describeErr != nil || len(describeOutput.Stacks) == 0 {
+			return nil
+		}
+		distributionID := s3SiteStackOutput(describeOutput.Stacks[0],
+			OutputS3SiteCloudFrontDistributionID)
+		if distributionID == "" {
+			return nil
+		}
+		_, invalidationErr := createS3SiteInvalidation(distributionID,
+			[]string{cfCustomResources.ZipToS3BucketAllPaths},
+			fmt.Sprintf("%s-rollback-%d", buildID, time.Now().UnixNano()),
+			awsSession,
+			logger)
+		return invalidationErr
+	}
+}
+
+// invalidateS3SiteDistribution returns the workflow step that invalidates
+// the changed S3Site paths in the CloudFront distribution
+func invalidateS3SiteDistribution(stack *cloudformation.Stack) workflowStep {
+	return func(ctx *workflowContext) (workflowStep, error) {
+		defer recordDuration(time.Now(), "S3Site CloudFront invalidation", ctx)
+
+		distributionID, paths := s3SiteInvalidationPaths(stack)
+		if distributionID == "" || len(paths) == 0 {
+			ctx.logger.Info("S3Site content unchanged. Bypassing CloudFront invalidation")
+			return nil, nil
+		}
+		invalidationID, invalidationErr := createS3SiteInvalidation(distributionID,
+			paths,
+			fmt.Sprintf("%s-%d", ctx.userdata.buildID, time.Now().UnixNano()),
+			ctx.context.awsSession,
+			ctx.logger)
+		if invalidationErr != nil {
+			return nil, invalidationErr
+		}
+		ctx.registerFinalizer(s3SiteInvalidationStatusFinalizer(distributionID,
+			invalidationID,
+			ctx.context.awsSession))
+		return nil, nil
+	}
+}
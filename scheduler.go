@@ -0,0 +1,363 @@
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Schedule
+//
+
+// Maximum flexible time window supported by EventBridge Scheduler
+// Ref: https://docs.aws.amazon.com/scheduler/latest/UserGuide/managing-schedule-flexible-time-windows.html
+const maxScheduleFlexibleTimeWindowMinutes = 1440
+
+// Layout of the one-time `at(...)` schedule expression
+const scheduleAtExpressionLayout = "2006-01-02T15:04:05"
+
+var (
+	reScheduleExpression = regexp.MustCompile(`^(at|rate|cron)\((.+)\)$`)
+	reScheduleRate       = regexp.MustCompile(`^(\d+) (minutes?|hours?|days?)$`)
+	reCronRangeStep      = regexp.MustCompile(`^([0-9A-Z]+|\*)(-([0-9A-Z]+))?(/(\d+))?$`)
+	reCronDayOfMonthLast = regexp.MustCompile(`^(L|LW|\d{1,2}W)$`)
+	reCronDayOfWeekLast  = regexp.MustCompile(`^(L|[0-9A-Z]+L|[0-9A-Z]+#[1-5])$`)
+)
+
+// cronField describes the legal values for a single cron expression field
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+// EventBridge cron fields. Month and day of week names are 1-based
+// Ref: https://docs.aws.amazon.com/scheduler/latest/UserGuide/schedule-types.html#cron-based
+var cronFields = []cronField{
+	{name: "minutes", min: 0, max: 59},
+	{name: "hours", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR",
+		"MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day-of-week", min: 1, max: 7, names: []string{"SUN", "MON", "TUE",
+		"WED", "THU", "FRI", "SAT"}},
+	{name: "year", min: 1970, max: 2199},
+}
+
+// value returns the numeric value of the token, resolving any
+// month or weekday names
+func (field cronField) value(token string) (int, error) {
+	for eachIndex, eachName := range field.names {
+		if token == eachName {
+			return field.min + eachIndex, nil
+		}
+	}
+	intValue, intValueErr := strconv.Atoi(token)
+	if intValueErr != nil {
+		return 0, errors.Errorf("invalid %s value: %s", field.name, token)
+	}
+	if intValue < field.min || intValue > field.max {
+		return 0, errors.Errorf("%s value %d must be in the range [%d, %d]",
+			field.name,
+			intValue,
+			field.min,
+			field.max)
+	}
+	return intValue, nil
+}
+
+// validate ensures that the comma separated list of values is legal for
+// this field
+func (field cronField) validate(fieldValue string) error {
+	for _, eachValue := range strings.Split(fieldValue, ",") {
+		switch {
+		case eachValue == "*":
+			continue
+		case eachValue == "?":
+			if field.name != "day-of-month" && field.name != "day-of-week" {
+				return errors.Errorf("`?` is only valid for the day-of-month and day-of-week fields")
+			}
+			continue
+		case field.name == "day-of-month" && reCronDayOfMonthLast.MatchString(eachValue):
+			continue
+		case field.name == "day-of-week" && reCronDayOfWeekLast.MatchString(eachValue):
+			continue
+		}
+		matches := reCronRangeStep.FindStringSubmatch(eachValue)
+		if matches == nil {
+			return errors.Errorf("invalid %s value: %s", field.name, eachValue)
+		}
+		if matches[1] != "*" {
+			if _, valueErr := field.value(matches[1]); valueErr != nil {
+				return valueErr
+			}
+		}
+		if matches[3] != "" {
+			if _, valueErr := field.value(matches[3]); valueErr != nil {
+				return valueErr
+			}
+		}
+		if matches[5] != "" {
+			step, _ := strconv.Atoi(matches[5])
+			if step <= 0 {
+				return errors.Errorf("%s increment must be positive: %s", field.name, eachValue)
+			}
+		}
+	}
+	return nil
+}
+
+// validateScheduleExpression ensures the at(...), rate(...) or cron(...)
+// expression is well formed
+func validateScheduleExpression(expression string) error {
+	matches := reScheduleExpression.FindStringSubmatch(strings.TrimSpace(expression))
+	if matches == nil {
+		return errors.Errorf("schedule expression must be one of at(...), rate(...) or cron(...). Found: %s",
+			expression)
+	}
+	switch matches[1] {
+	case "at":
+		if _, parseErr := time.Parse(scheduleAtExpressionLayout, matches[2]); parseErr != nil {
+			return errors.Errorf("invalid at expression %s. Expected format: at(yyyy-mm-ddThh:mm:ss)",
+				expression)
+		}
+	case "rate":
+		rateMatches := reScheduleRate.FindStringSubmatch(matches[2])
+		if rateMatches == nil {
+			return errors.Errorf("invalid rate expression %s. Expected format: rate(value unit)",
+				expression)
+		}
+		rateValue, _ := strconv.Atoi(rateMatches[1])
+		isPlural := strings.HasSuffix(rateMatches[2], "s")
+		if rateValue <= 0 {
+			return errors.Errorf("rate expression %s value must be positive", expression)
+		}
+		if (rateValue == 1) == isPlural {
+			return errors.Errorf("rate expression %s must use a singular unit for a value of 1 and a plural unit otherwise",
+				expression)
+		}
+	case "cron":
+		fields := strings.Fields(matches[2])
+		if len(fields) != len(cronFields) {
+			return errors.Errorf("cron expression %s must have %d fields. Found: %d",
+				expression,
+				len(cronFields),
+				len(fields))
+		}
+		for eachIndex, eachField := range cronFields {
+			if fieldErr := eachField.validate(fields[eachIndex]); fieldErr != nil {
+				return errors.Wrapf(fieldErr, "invalid cron expression %s", expression)
+			}
+		}
+		// Ref: https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-cron-expressions.html
+		if (fields[2] == "?") == (fields[4] == "?") {
+			return errors.Errorf("cron expression %s must use `?` in exactly one of the day-of-month or day-of-week fields",
+				expression)
+		}
+	}
+	return nil
+}
+
+// Schedule represents an EventBridge Scheduler schedule that invokes
+// a lambda function. See
+// https://docs.aws.amazon.com/scheduler/latest/UserGuide/schedule-types.html
+// for the supported expression formats. Example:
+//
+//	lambdaFn.Schedules = []*sparta.Schedule{
+//		{
+//			Expression: "cron(0 8 ? * MON-FRI *)",
+//			Timezone:   "America/New_York",
+//		},
+//	}
+type Schedule struct {
+	// Description of the schedule
+	Description string
+	// Expression is the at(...), rate(...) or cron(...) schedule expression
+	Expression string
+	// Timezone is the optional IANA timezone name (eg, "America/New_York")
+	// in which the Expression is evaluated. Defaults to UTC.
+	Timezone string
+	// FlexibleTimeWindowMinutes is the maximum number of minutes after the
+	// scheduled time during which the lambda may be invoked. Zero
+	// disables the flexible time window.
+	FlexibleTimeWindowMinutes int64
+	// StartDate is the optional date after which the schedule becomes active
+	StartDate time.Time
+	// EndDate is the optional date after which the schedule is inactive
+	EndDate time.Time
+	// Disabled creates the schedule in the DISABLED state
+	Disabled bool
+	// Input is the optional value that is JSON-marshaled and supplied
+	// to the lambda function as the event
+	Input interface{}
+}
+
+func (schedule *Schedule) validate() error {
+	if expressionErr := validateScheduleExpression(schedule.Expression); expressionErr != nil {
+		return expressionErr
+	}
+	if schedule.Timezone != "" {
+		if _, locationErr := time.LoadLocation(schedule.Timezone); locationErr != nil ||
+			schedule.Timezone == "Local" {
+			return errors.Errorf("schedule %s specifies an invalid timezone: %s",
+				schedule.Expression,
+				schedule.Timezone)
+		}
+	}
+	if schedule.FlexibleTimeWindowMinutes < 0 ||
+		schedule.FlexibleTimeWindowMinutes > maxScheduleFlexibleTimeWindowMinutes {
+		return errors.Errorf("schedule %s FlexibleTimeWindowMinutes must be in the range [0, %d]. Found: %d",
+			schedule.Expression,
+			maxScheduleFlexibleTimeWindowMinutes,
+			schedule.FlexibleTimeWindowMinutes)
+	}
+	if !schedule.StartDate.IsZero() &&
+		!schedule.EndDate.IsZero() &&
+		!schedule.EndDate.After(schedule.StartDate) {
+		return errors.Errorf("schedule %s EndDate must be after the StartDate",
+			schedule.Expression)
+	}
+	return nil
+}
+
+func (schedule *Schedule) export(serviceName string,
+	lambdaLogicalResourceName string,
+	targetArn *gocf.StringExpr,
+	scheduleIndex int,
+	roleArn *gocf.StringExpr,
+	template *gocf.Template,
+	logger *logrus.Logger) error {
+
+	validationErr := schedule.validate()
+	if validationErr != nil {
+		return validationErr
+	}
+	scheduleDescription := schedule.Description
+	if scheduleDescription == "" {
+		scheduleDescription = fmt.Sprintf("%s: %s", serviceName, schedule.Expression)
+	}
+	scheduleResource := schedulerSchedule{
+		Description:        gocf.String(scheduleDescription),
+		ScheduleExpression: gocf.String(strings.TrimSpace(schedule.Expression)),
+		FlexibleTimeWindow: &schedulerScheduleFlexibleTimeWindow{
+			Mode: gocf.String("OFF"),
+		},
+		Target: &schedulerScheduleTarget{
+			Arn:     targetArn,
+			RoleArn: roleArn,
+		},
+	}
+	if schedule.Timezone != "" {
+		scheduleResource.ScheduleExpressionTimezone = gocf.String(schedule.Timezone)
+	}
+	if schedule.FlexibleTimeWindowMinutes != 0 {
+		scheduleResource.FlexibleTimeWindow = &schedulerScheduleFlexibleTimeWindow{
+			Mode:                   gocf.String("FLEXIBLE"),
+			MaximumWindowInMinutes: gocf.Integer(schedule.FlexibleTimeWindowMinutes),
+		}
+	}
+	if !schedule.StartDate.IsZero() {
+		scheduleResource.StartDate = gocf.String(schedule.StartDate.UTC().Format(time.RFC3339))
+	}
+	if !schedule.EndDate.IsZero() {
+		scheduleResource.EndDate = gocf.String(schedule.EndDate.UTC().Format(time.RFC3339))
+	}
+	if schedule.Disabled {
+		scheduleResource.State = gocf.String("DISABLED")
+	}
+	if schedule.Input != nil {
+		inputBytes, inputBytesErr := json.Marshal(schedule.Input)
+		if inputBytesErr != nil {
+			return errors.Wrapf(inputBytesErr,
+				"Failed to marshal schedule %s Input",
+				schedule.Expression)
+		}
+		scheduleResource.Target.Input = gocf.String(string(inputBytes))
+	}
+	scheduleResourceName := CloudFormationResourceName("LambdaSchedule",
+		lambdaLogicalResourceName,
+		strconv.Itoa(scheduleIndex))
+	template.AddResource(scheduleResourceName, scheduleResource)
+
+	logger.WithFields(logrus.Fields{
+		"Expression": schedule.Expression,
+		"Timezone":   schedule.Timezone,
+	}).Debug("Adding EventBridge Scheduler schedule")
+	return nil
+}
+
+// exportSchedules creates the IAM role that EventBridge Scheduler assumes
+// to invoke the lambda function, together with an AWS::Scheduler::Schedule
+// resource for each Schedule. The targetArn is either the function
+// or published alias ARN.
+func exportSchedules(serviceName string,
+	lambdaLogicalResourceName string,
+	targetArn *gocf.StringExpr,
+	schedules []*Schedule,
+	template *gocf.Template,
+	logger *logrus.Logger) error {
+	if len(schedules) == 0 {
+		return nil
+	}
+	schedulerRole := &gocf.IAMRole{
+		AssumeRolePolicyDocument: ArbitraryJSONObject{
+			"Version": "2012-10-17",
+			"Statement": []ArbitraryJSONObject{
+				{
+					"Effect": "Allow",
+					"Principal": ArbitraryJSONObject{
+						"Service": []string{SchedulerPrincipal},
+					},
+					"Action": []string{"sts:AssumeRole"},
+				},
+			},
+		},
+		Policies: &gocf.IAMRolePolicyList{
+			gocf.IAMRolePolicy{
+				PolicyDocument: ArbitraryJSONObject{
+					"Version": "2012-10-17",
+					"Statement": []spartaIAM.PolicyStatement{
+						{
+							Effect:   "Allow",
+							Action:   []string{"lambda:InvokeFunction"},
+							Resource: targetArn,
+						},
+					},
+				},
+				PolicyName: gocf.String("SchedulerInvokePolicy"),
+			},
+		},
+	}
+	schedulerRoleResourceName := CloudFormationResourceName("LambdaSchedulerRole",
+		lambdaLogicalResourceName)
+	template.AddResource(schedulerRoleResourceName, schedulerRole)
+	schedulerRoleArn := gocf.GetAtt(schedulerRoleResourceName, "Arn")
+
+	for eachIndex, eachSchedule := range schedules {
+		exportErr := eachSchedule.export(serviceName,
+			lambdaLogicalResourceName,
+			targetArn,
+			eachIndex,
+			schedulerRoleArn,
+			template,
+			logger)
+		if exportErr != nil {
+			return errors.Wrapf(exportErr, "Failed to export lambda schedule")
+		}
+	}
+	return nil
+}
+
+//
+// END - Schedule
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,138 @@
+package sparta
+
+import (
+	"reflect"
+	"runtime"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - NamedServiceDecorator
+//
+
+// NamedServiceDecorator is a ServiceDecoratorHookHandler with a name that
+// other decorators can depend on. A decorator is called after the
+// decorators it depends on, so it can read the values they published to
+// the WorkflowHookContext. Decorators that don't depend on each other run
+// concurrently if WorkflowHooks.ServiceDecoratorConcurrency is greater than 1.
+type NamedServiceDecorator struct {
+	// Name is the unique name of the decorator
+	Name string
+	// DependsOn are the names of the decorators that must complete before
+	// this decorator is called
+	DependsOn []string
+	// Decorator is the decorator to call
+	Decorator ServiceDecoratorHookHandler
+}
+
+// DecorateService satisfies the ServiceDecoratorHookHandler interface
+func (decorator *NamedServiceDecorator) DecorateService(context *WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+	if decorator.Decorator == nil {
+		return errors.Errorf("NamedServiceDecorator %s doesn't define a Decorator", decorator.Name)
+	}
+	return decorator.Decorator.DecorateService(context,
+		serviceName,
+		template,
+		S3Bucket,
+		S3Key,
+		buildID,
+		awsSession,
+		noop,
+		logger)
+}
+
+// serviceDecoratorName returns the name to log for the decorator
+func serviceDecoratorName(decorator ServiceDecoratorHookHandler) string {
+	if namedDecorator, isNamed := decorator.(*NamedServiceDecorator); isNamed {
+		return namedDecorator.Name
+	}
+	decoratorValue := reflect.ValueOf(decorator)
+	if decoratorValue.Kind() != reflect.Func && decoratorValue.Kind() != reflect.Ptr {
+		return decoratorValue.Type().String()
+	}
+	decoratorFunc := runtime.FuncForPC(decoratorValue.Pointer())
+	if decoratorFunc == nil {
+		return decoratorValue.Type().String()
+	}
+	return decoratorFunc.Name()
+}
+
+// serviceDecoratorLayers groups the decorators into layers such that each
+// decorator's dependencies are in an earlier layer. The layers contain
+// decorator indices in declaration order. Decorators that aren't
+// NamedServiceDecorators don't have any dependencies.
+func serviceDecoratorLayers(decorators []ServiceDecoratorHookHandler) ([][]int, error) {
+	nameIndices := make(map[string]int)
+	for eachIndex, eachDecorator := range decorators {
+		namedDecorator, isNamed := eachDecorator.(*NamedServiceDecorator)
+		if !isNamed {
+			continue
+		}
+		if namedDecorator.Name == "" {
+			return nil, errors.Errorf("NamedServiceDecorator at index %d doesn't define a Name", eachIndex)
+		}
+		if _, exists := nameIndices[namedDecorator.Name]; exists {
+			return nil, errors.Errorf("Duplicate NamedServiceDecorator name: %s", namedDecorator.Name)
+		}
+		nameIndices[namedDecorator.Name] = eachIndex
+	}
+	dependencies := make([][]int, len(decorators))
+	for eachIndex, eachDecorator := range decorators {
+		namedDecorator, isNamed := eachDecorator.(*NamedServiceDecorator)
+		if !isNamed {
+			continue
+		}
+		for _, eachDependency := range namedDecorator.DependsOn {
+			dependencyIndex, exists := nameIndices[eachDependency]
+			if !exists {
+				return nil, errors.Errorf("NamedServiceDecorator %s depends on unknown decorator: %s",
+					namedDecorator.Name,
+					eachDependency)
+			}
+			dependencies[eachIndex] = append(dependencies[eachIndex], dependencyIndex)
+		}
+	}
+
+	layers := [][]int{}
+	layerIndices := make(map[int]int)
+	for len(layerIndices) != len(decorators) {
+		layer := []int{}
+		for eachIndex := range decorators {
+			if _, scheduled := layerIndices[eachIndex]; scheduled {
+				continue
+			}
+			ready := true
+			for _, eachDependency := range dependencies[eachIndex] {
+				dependencyLayer, dependencyScheduled := layerIndices[eachDependency]
+				ready = ready && dependencyScheduled && dependencyLayer < len(layers)
+			}
+			if ready {
+				layer = append(layer, eachIndex)
+			}
+		}
+		if len(layer) == 0 {
+			return nil, errors.Errorf("ServiceDecorators have circular dependencies")
+		}
+		for _, eachIndex := range layer {
+			layerIndices[eachIndex] = len(layers)
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+//
+// END - NamedServiceDecorator
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,170 @@
+package sparta
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultShutdownDrainTimeout is the default maximum duration for all
+	// shutdown hooks. AWS Lambda allows 300ms for the shutdown phase of a
+	// function with only internal extensions.
+	// Ref: https://docs.aws.amazon.com/lambda/latest/dg/lambda-runtime-environment.html#runtimes-lifecycle-shutdown
+	DefaultShutdownDrainTimeout = 250 * time.Millisecond
+
+	// shutdownExtensionName is the name of the internal extension that
+	// Sparta registers so that the runtime receives SIGTERM
+	shutdownExtensionName = "sparta-shutdown"
+	// extensionAPIVersion is the Lambda Extensions API version
+	extensionAPIVersion = "2020-01-01"
+)
+
+// ShutdownHook is a function that is called when the AWS Lambda execution
+// environment is shut down. Hooks should release resources (eg, flush
+// buffers, close connection pools) and return before the context
+// deadline.
+type ShutdownHook func(ctx context.Context, logger *logrus.Logger) error
+
+var (
+	shutdownMutex        sync.Mutex
+	shutdownHooks        []ShutdownHook
+	shutdownDrainTimeout = DefaultShutdownDrainTimeout
+)
+
+// OnShutdown registers one or more ShutdownHook functions that run when the
+// AWS Lambda execution environment receives SIGTERM. Hooks run in reverse
+// registration order, like deferred functions. Registering a hook causes
+// the runtime to register an internal Lambda extension, which is required
+// for the runtime to receive the signal. OnShutdown should be called
+// before sparta.Main.
+func OnShutdown(hooks ...ShutdownHook) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	for _, eachHook := range hooks {
+		if eachHook != nil {
+			shutdownHooks = append(shutdownHooks, eachHook)
+		}
+	}
+}
+
+// SetShutdownDrainTimeout sets the maximum duration for all shutdown hooks.
+// Values greater than the Lambda shutdown phase limit are cut short when
+// the execution environment is terminated.
+func SetShutdownDrainTimeout(timeout time.Duration) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	if timeout <= 0 {
+		timeout = DefaultShutdownDrainTimeout
+	}
+	shutdownDrainTimeout = timeout
+}
+
+// registeredShutdownHooks returns a snapshot of the registered hooks and
+// the drain timeout
+func registeredShutdownHooks() ([]ShutdownHook, time.Duration) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	snapshot := make([]ShutdownHook, len(shutdownHooks))
+	copy(snapshot, shutdownHooks)
+	return snapshot, shutdownDrainTimeout
+}
+
+// runShutdownHooks calls each hook in reverse registration order until
+// they're all complete or the drain timeout expires. It returns true
+// if every hook completed.
+func runShutdownHooks(hooks []ShutdownHook,
+	drainTimeout time.Duration,
+	logger *logrus.Logger) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	completed := make(chan bool, 1)
+	go func() {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if ctx.Err() != nil {
+				completed <- false
+				return
+			}
+			hookErr := hooks[i](ctx, logger)
+			if hookErr != nil {
+				logger.WithError(hookErr).Warn("Shutdown hook failed")
+			}
+		}
+		completed <- true
+	}()
+
+	select {
+	case allCompleted := <-completed:
+		return allCompleted
+	case <-ctx.Done():
+		logger.WithFields(logrus.Fields{
+			"DrainTimeout": drainTimeout.String(),
+			"HookCount":    len(hooks),
+		}).Warn("Shutdown hooks didn't complete before the drain timeout")
+		return false
+	}
+}
+
+// registerShutdownExtension registers a no-op internal extension with the
+// Lambda Extensions API. AWS Lambda only sends SIGTERM to the runtime
+// process if at least one extension is registered. The extension must keep
+// polling for events, so this starts a background poller.
+// Ref: https://docs.aws.amazon.com/lambda/latest/dg/runtimes-extensions-api.html
+func registerShutdownExtension(runtimeAPI string, logger *logrus.Logger) error {
+	if runtimeAPI == "" {
+		return errors.New("AWS_LAMBDA_RUNTIME_API is not defined")
+	}
+	baseURL := fmt.Sprintf("http://%s/%s/extension", runtimeAPI, extensionAPIVersion)
+	request, requestErr := http.NewRequest(http.MethodPost,
+		baseURL+"/register",
+		bytes.NewBufferString(`{"events":[]}`))
+	if requestErr != nil {
+		return errors.Wrapf(requestErr, "Failed to create extension registration request")
+	}
+	request.Header.Set("Lambda-Extension-Name", shutdownExtensionName)
+	response, responseErr := http.DefaultClient.Do(request)
+	if responseErr != nil {
+		return errors.Wrapf(responseErr, "Failed to register shutdown extension")
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to register shutdown extension: %s", response.Status)
+	}
+	extensionID := response.Header.Get("Lambda-Extension-Identifier")
+
+	go func() {
+		for {
+			nextRequest, nextRequestErr := http.NewRequest(http.MethodGet,
+				baseURL+"/event/next",
+				nil)
+			if nextRequestErr != nil {
+				logger.WithError(nextRequestErr).Warn("Failed to create extension event request")
+				return
+			}
+			nextRequest.Header.Set("Lambda-Extension-Identifier", extensionID)
+			nextResponse, nextResponseErr := http.DefaultClient.Do(nextRequest)
+			if nextResponseErr != nil {
+				logger.WithError(nextResponseErr).Debug("Shutdown extension event polling stopped")
+				return
+			}
+			_, _ = io.Copy(ioutil.Discard, nextResponse.Body)
+			nextResponse.Body.Close()
+			if nextResponse.StatusCode != http.StatusOK {
+				logger.WithField("Status", nextResponse.Status).
+					Debug("Shutdown extension event polling stopped")
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,84 @@
+package sparta
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestShutdownHooks(t *testing.T) {
+	logger, _ := NewLogger("panic")
+	calls := []string{}
+	hookNamed := func(name string) ShutdownHook {
+		return func(ctx context.Context, logger *logrus.Logger) error {
+			calls = append(calls, name)
+			return errors.Errorf("%s failed", name)
+		}
+	}
+	OnShutdown(hookNamed("first"), hookNamed("second"))
+	hooks, drainTimeout := registeredShutdownHooks()
+	shutdownHooks = nil
+	if drainTimeout != DefaultShutdownDrainTimeout {
+		t.Fatalf("Unexpected drain timeout: %s", drainTimeout)
+	}
+	if !runShutdownHooks(hooks, drainTimeout, logger) {
+		t.Fatalf("Expected all shutdown hooks to complete")
+	}
+	if strings.Join(calls, ",") != "second,first" {
+		t.Fatalf("Unexpected shutdown hook order: %#v", calls)
+	}
+}
+
+func TestShutdownHooksDrainTimeout(t *testing.T) {
+	logger, _ := NewLogger("panic")
+	slowHook := func(ctx context.Context, logger *logrus.Logger) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	if runShutdownHooks([]ShutdownHook{slowHook}, 10*time.Millisecond, logger) {
+		t.Fatalf("Expected shutdown hooks to exceed the drain timeout")
+	}
+}
+
+func TestRegisterShutdownExtension(t *testing.T) {
+	logger, _ := NewLogger("panic")
+	var nextCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			if r.Header.Get("Lambda-Extension-Name") != shutdownExtensionName {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Lambda-Extension-Identifier", "extension-id")
+			w.WriteHeader(http.StatusOK)
+		case "/2020-01-01/extension/event/next":
+			atomic.AddInt32(&nextCount, 1)
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registerErr := registerShutdownExtension(strings.TrimPrefix(server.URL, "http://"), logger)
+	if registerErr != nil {
+		t.Fatalf("Failed to register shutdown extension: %s", registerErr)
+	}
+	for i := 0; i != 100 && atomic.LoadInt32(&nextCount) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&nextCount) == 0 {
+		t.Fatalf("Expected shutdown extension to poll for events")
+	}
+	if registerShutdownExtension("", logger) == nil {
+		t.Fatalf("Expected error without a runtime API")
+	}
+}
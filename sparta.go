@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	spartaIAM "github.com/mweagle/Sparta/aws/iam"
 	gocc "github.com/mweagle/go-cloudcondenser"
@@ -93,6 +94,8 @@ var CommonIAMStatements = struct {
 	DynamoDB []spartaIAM.PolicyStatement
 	Kinesis  []spartaIAM.PolicyStatement
 	SQS      []spartaIAM.PolicyStatement
+	MSK      []spartaIAM.PolicyStatement
+	KafkaVPC []spartaIAM.PolicyStatement
 }{
 	Core: []spartaIAM.PolicyStatement{
 		{
@@ -126,7 +129,9 @@ var CommonIAMStatements = struct {
 		{
 			Action: []string{"ec2:CreateNetworkInterface",
 				"ec2:DescribeNetworkInterfaces",
-				"ec2:DeleteNetworkInterface"},
+				"ec2:DeleteNetworkInterface",
+				"ec2:AssignPrivateIpAddresses",
+				"ec2:UnassignPrivateIpAddresses"},
 			Effect:   "Allow",
 			Resource: wildcardArn,
 		},
@@ -162,6 +167,29 @@ var CommonIAMStatements = struct {
 			},
 		},
 	},
+	// https://docs.aws.amazon.com/lambda/latest/dg/with-msk.html
+	MSK: []spartaIAM.PolicyStatement{
+		{
+			Effect: "Allow",
+			Action: []string{"kafka:DescribeCluster",
+				"kafka:DescribeClusterV2",
+				"kafka:GetBootstrapBrokers",
+			},
+		},
+	},
+	// https://docs.aws.amazon.com/lambda/latest/dg/with-kafka.html
+	KafkaVPC: []spartaIAM.PolicyStatement{
+		{
+			Action: []string{"ec2:CreateNetworkInterface",
+				"ec2:DescribeNetworkInterfaces",
+				"ec2:DescribeVpcs",
+				"ec2:DeleteNetworkInterface",
+				"ec2:DescribeSubnets",
+				"ec2:DescribeSecurityGroups"},
+			Effect:   "Allow",
+			Resource: wildcardArn,
+		},
+	},
 }
 
 // RE for sanitizing names
@@ -222,23 +250,105 @@ type LambdaFunctionOptions struct {
 	MemorySize int64
 	// Timeout (seconds)
 	Timeout int64
+	// MemorySizeParameter is the optional name of a Number TemplateParameter
+	// that supplies the MemorySize value
+	MemorySizeParameter string
+	// TimeoutParameter is the optional name of a Number TemplateParameter
+	// that supplies the Timeout value
+	TimeoutParameter string
 	// VPC Settings
 	VpcConfig *gocf.LambdaFunctionVPCConfig
+	// VPCDiscovery is an alternative to VpcConfig that supports discovering
+	// the subnets and security groups by tag
+	VPCDiscovery *VPCConfig
 	// Environment Variables
 	Environment map[string]*gocf.StringExpr
 	// KMS Key Arn used to encrypt environment variables
 	KmsKeyArn string
+	// KmsKey is an alternative to KmsKeyArn that supports CloudFormation
+	// references (eg, a key defined in the same template)
+	KmsKey gocf.Stringable
+	// Secrets are the Secrets Manager and SSM Parameter Store values,
+	// keyed by name, that the function resolves at runtime with
+	// ResolveSecret. Only the references are stored in the template.
+	Secrets map[string]*SecretReference
+	// Config declares the environment variables, keyed by name, that the
+	// function reads with Config(ctx). Values are converted and validated
+	// when the execution environment starts.
+	Config map[string]*ConfigVariable
 	// The maximum of concurrent executions you want reserved for the function
 	ReservedConcurrentExecutions int64
+	// EphemeralStorage is the size (MB) of the function's /tmp directory.
+	// Zero uses the Lambda default of 512 MB.
+	EphemeralStorage int64
+	// CodeSigningConfig restricts the function to code signed by trusted
+	// AWS Signer profiles
+	CodeSigningConfig *CodeSigningConfig
+	// FileSystemConfigs mount Amazon EFS file systems. Requires either
+	// VpcConfig or VPCDiscovery.
+	FileSystemConfigs []*FileSystemConfig
+	// DynamoDBResources are the DynamoDB tables the function depends on.
+	// Sparta creates or references each table, grants the execution role
+	// access to it and includes it in the function's discovery information.
+	DynamoDBResources []*DynamoDBResource
+	// SQSResources are the SQS queues the function depends on. Sparta
+	// creates or references each queue, grants the execution role access
+	// to it and includes it in the function's discovery information.
+	SQSResources []*SQSResource
+	// SNSResources are the SNS topics the function publishes to. Sparta
+	// creates or references each topic, grants the execution role access
+	// to it and includes it in the function's discovery information.
+	SNSResources []*SNSResource
+	// AppConfig adds the AWS AppConfig extension layer so that the
+	// function can read feature flags with FeatureFlag
+	AppConfig *AppConfig
+	// AutoPublishAlias publishes a new version of the function when the
+	// code archive or function configuration changes and updates the named
+	// alias to reference it. EventSourceMappings, Schedules, Permissions
+	// and API Gateway integrations invoke the alias. Published versions
+	// are retained when the stack is updated or deleted.
+	AutoPublishAlias string
+	// ProvisionedConcurrency publishes a version and alias for the
+	// function with the given provisioned concurrency
+	ProvisionedConcurrency *ProvisionedConcurrency
+	// DeploymentPreference uses CodeDeploy to gradually shift alias traffic
+	// to the newly published version. Hook functions must also be included
+	// in the set of provisioned lambda functions.
+	DeploymentPreference *DeploymentPreference
 	// DeadLetterConfigArn is how Lambda handles events that it can't process.If
 	// you don't specify a Dead Letter Queue (DLQ) configuration, Lambda
 	// discards events after the maximum number of retries. For more information,
 	// see Dead Letter Queues in the AWS Lambda Developer Guide.
 	DeadLetterConfigArn gocf.Stringable
-	// Tags to associate with the Lambda function
+	// DeadLetterConfig is an alternative to DeadLetterConfigArn that
+	// optionally provisions the SQS queue or SNS topic and grants the
+	// execution role the privileges to publish to it.
+	DeadLetterConfig *AsyncDestination
+	// EventInvokeConfig defines the retry behavior and destinations for
+	// asynchronous invocations
+	EventInvokeConfig *EventInvokeConfig
+	// Tags to associate with the Lambda function and its Sparta-managed
+	// IAM role
 	Tags map[string]string
+	// FunctionURL provisions a dedicated HTTPS endpoint for the function
+	FunctionURL *FunctionURL
+	// LogGroup provisions the function's CloudWatch Logs log group with
+	// the given retention and encryption settings. Defaults to the
+	// WorkflowHooks.LogGroup value.
+	LogGroup *LogGroup
+	// LambdaInsights enables CloudWatch Lambda Insights enhanced
+	// monitoring for the function. Defaults to the
+	// WorkflowHooks.LambdaInsights value.
+	LambdaInsights *LambdaInsights
+	// CostHints are the expected usage values used by
+	// WorkflowHooks.CostEstimate
+	CostHints *LambdaCostHints
 	// Tracing options for XRay
 	TracingConfig *gocf.LambdaFunctionTracingConfig
+	// ActiveTracing is a shortcut for a TracingConfig with an Active
+	// mode. The required X-Ray privileges are included in the
+	// Sparta-managed IAM role.
+	ActiveTracing bool
 	// Additional params
 	SpartaOptions *SpartaOptions
 }
@@ -255,6 +365,111 @@ func defaultLambdaFunctionOptions() *LambdaFunctionOptions {
 	}
 }
 
+// validate ensures that the function options are within the Lambda
+// service quotas. See
+// https://docs.aws.amazon.com/lambda/latest/dg/gettingstarted-limits.html
+// for more information.
+func (options *LambdaFunctionOptions) validate() []string {
+	var errorText []string
+	// Zero values use the Lambda service defaults
+	if options.MemorySize != 0 &&
+		(options.MemorySize < minLambdaMemorySize || options.MemorySize > maxLambdaMemorySize) {
+		errorText = append(errorText,
+			fmt.Sprintf("MemorySize must be in the range [%d, %d] MB. Found: %d",
+				minLambdaMemorySize,
+				maxLambdaMemorySize,
+				options.MemorySize))
+	}
+	if options.Timeout < 0 || options.Timeout > maxLambdaTimeout {
+		errorText = append(errorText,
+			fmt.Sprintf("Timeout must be in the range [1, %d] seconds. Found: %d",
+				maxLambdaTimeout,
+				options.Timeout))
+	}
+	if options.EphemeralStorage != 0 &&
+		(options.EphemeralStorage < minLambdaEphemeralStorage ||
+			options.EphemeralStorage > maxLambdaEphemeralStorage) {
+		errorText = append(errorText,
+			fmt.Sprintf("EphemeralStorage must be in the range [%d, %d] MB. Found: %d",
+				minLambdaEphemeralStorage,
+				maxLambdaEphemeralStorage,
+				options.EphemeralStorage))
+	}
+	if options.VPCDiscovery != nil {
+		if options.VpcConfig != nil {
+			errorText = append(errorText,
+				"Lambda options must not define both VpcConfig and VPCDiscovery")
+		}
+		if vpcErr := options.VPCDiscovery.validate(); vpcErr != nil {
+			errorText = append(errorText, vpcErr.Error())
+		}
+	}
+	if options.CodeSigningConfig != nil {
+		if signingErr := options.CodeSigningConfig.validate(); signingErr != nil {
+			errorText = append(errorText, signingErr.Error())
+		}
+	}
+	if tagsErr := validateTags(options.Tags); tagsErr != nil {
+		errorText = append(errorText, tagsErr.Error())
+	}
+	if secretsErr := validateSecrets(options); secretsErr != nil {
+		errorText = append(errorText, secretsErr.Error())
+	}
+	if configErr := validateConfig(options); configErr != nil {
+		errorText = append(errorText, configErr.Error())
+	}
+	if fsErr := validateFileSystemConfigs(options); fsErr != nil {
+		errorText = append(errorText, fsErr.Error())
+	}
+	if tablesErr := validateDynamoDBResources(options); tablesErr != nil {
+		errorText = append(errorText, tablesErr.Error())
+	}
+	if queuesErr := validateSQSResources(options); queuesErr != nil {
+		errorText = append(errorText, queuesErr.Error())
+	}
+	if topicsErr := validateSNSResources(options); topicsErr != nil {
+		errorText = append(errorText, topicsErr.Error())
+	}
+	if options.AppConfig != nil {
+		if appConfigErr := options.AppConfig.validate(); appConfigErr != nil {
+			errorText = append(errorText, appConfigErr.Error())
+		}
+	}
+	if options.FunctionURL != nil {
+		if urlErr := options.FunctionURL.validate(); urlErr != nil {
+			errorText = append(errorText, urlErr.Error())
+		}
+	}
+	if options.LogGroup != nil {
+		if logGroupErr := options.LogGroup.validate(); logGroupErr != nil {
+			errorText = append(errorText, logGroupErr.Error())
+		}
+	}
+	if tracingErr := validateTracing(options); tracingErr != nil {
+		errorText = append(errorText, tracingErr.Error())
+	}
+	if options.ReservedConcurrentExecutions < 0 {
+		errorText = append(errorText,
+			fmt.Sprintf("ReservedConcurrentExecutions must not be negative. Found: %d",
+				options.ReservedConcurrentExecutions))
+	}
+	// Only literal values can be measured before the stack is provisioned
+	environmentSize := 0
+	for eachKey, eachValue := range options.Environment {
+		environmentSize += len(eachKey)
+		if eachValue != nil && eachValue.Func == nil {
+			environmentSize += len(eachValue.Literal)
+		}
+	}
+	if environmentSize > maxLambdaEnvironmentSize {
+		errorText = append(errorText,
+			fmt.Sprintf("Environment variables must not exceed %d bytes. Found: %d bytes. Consider storing large values in SSM Parameter Store or S3",
+				maxLambdaEnvironmentSize,
+				environmentSize))
+	}
+	return errorText
+}
+
 // SpartaOptions allow the passing in of additional options during the creation of a Lambda Function
 type SpartaOptions struct {
 	// User supplied function name to use for
@@ -268,7 +483,7 @@ type SpartaOptions struct {
 // pipeline to add contents the Lambda archive or perform other workflow operations.
 // TODO: remove single-valued fields
 type WorkflowHooks struct {
-	// Initial hook context. May be empty
+	// Initial WorkflowHookContext values. May be empty
 	Context map[string]interface{}
 	// PreBuild is called before the current Sparta-binary is compiled
 	PreBuild WorkflowHook
@@ -295,6 +510,10 @@ type WorkflowHooks struct {
 	ServiceDecorator ServiceDecoratorHook
 	// ServiceDecorators are called before Sparta marshalls the CloudFormation template
 	ServiceDecorators []ServiceDecoratorHookHandler
+	// ServiceDecoratorConcurrency is the maximum number of ServiceDecorators
+	// that run concurrently. Use NamedServiceDecorator to declare the
+	// decorators that must complete first. Defaults to 1.
+	ServiceDecoratorConcurrency int
 	// PostMarshall is called after Sparta marshalls the application contents to a CloudFormation template
 	PostMarshall WorkflowHook
 	// PostMarshalls are called after Sparta marshalls the application contents to a CloudFormation
@@ -305,6 +524,68 @@ type WorkflowHooks struct {
 	// is complete. Each hook receives a complete read-only
 	// copy of the materialized template.
 	Validators []ServiceValidationHookHandler
+	// PostDeployValidations are hooks that are called after the stack
+	// converges. If a hook returns an error the deployment is reverted and
+	// the Rollbacks hooks are called. See HTTPValidation and
+	// LambdaInvokeValidation for built-in smoke tests.
+	PostDeployValidations []PostDeployValidationHookHandler
+	// Parameters are the template Parameters, keyed by name. Reference
+	// them with ParameterRef.
+	Parameters map[string]*TemplateParameter
+	// Tags are applied to the CloudFormation stack and the Sparta-managed
+	// Lambda functions and IAM roles. Function-specific
+	// LambdaFunctionOptions.Tags values take precedence.
+	Tags map[string]string
+	// Conditions are the template Conditions, keyed by name. Use gocf.If
+	// to select a value, or set the Condition of resources created by
+	// decorators.
+	Conditions map[string]*TemplateCondition
+	// LogGroup is the default log group configuration for the
+	// Sparta-managed Lambda functions that don't define a
+	// LambdaFunctionOptions.LogGroup value.
+	LogGroup *LogGroup
+	// Dashboard optionally creates a CloudWatch dashboard for the
+	// service's resources
+	Dashboard *ServiceDashboard
+	// LambdaInsights optionally enables CloudWatch Lambda Insights for the
+	// service's Lambda functions that don't define a
+	// LambdaFunctionOptions.LambdaInsights value
+	LambdaInsights *LambdaInsights
+	// CostEstimate optionally logs the estimated monthly cost of the
+	// service before the stack is provisioned
+	CostEstimate *CostEstimate
+	// PowerTuning optionally runs a post deploy sweep that invokes
+	// functions at several memory sizes and reports the recommended
+	// memory size for each function
+	PowerTuning *PowerTuning
+	// DynamicReferences optionally validates the CloudFormation dynamic
+	// references (eg, {{resolve:ssm:/my/parameter}}) in the template and
+	// resolves them at provision time
+	DynamicReferences *DynamicReferences
+
+	// NestedStacks optionally moves the template resources into nested
+	// AWS::CloudFormation::Stack resources so that large services stay within
+	// the CloudFormation resource limit. The function returns the nested stack
+	// name for each resource. Lambda functions and the resources they discover
+	// at runtime remain in the service's stack. See
+	// spartaCF.NestedStackGroupByAPI and spartaCF.NestedStackGroupByEventSource
+	// for built-in groupings.
+	NestedStacks spartaCF.NestedStackGroupFunc
+
+	// AWSClients optionally replaces the AWS service clients used by the
+	// provision workflow (eg, with mocks in tests)
+	AWSClients *AWSClients
+	// RetryPolicy optionally replaces the retry and backoff policy for the
+	// AWS API requests made by the provision workflow. Defaults to
+	// spartaAWS.DefaultRetryPolicy().
+	RetryPolicy *spartaAWS.RetryPolicy
+	// ArtifactStore optionally replaces the S3 upload of the service
+	// artifacts. Defaults to an S3ArtifactStore.
+	ArtifactStore ArtifactStore
+	// ChangeSetOptions optionally provides the stack parameter values and
+	// capabilities for the stack operations. Values provided by the
+	// provision --parameter flag take precedence.
+	ChangeSetOptions *spartaCF.ChangeSetOptions
 
 	// Rollback is called if there is an error performing the requested operation
 	Rollback RollbackHook
@@ -322,32 +603,88 @@ type WorkflowHooks struct {
 // for more information
 // Deprecated: Prefer github.com/aws/iam/PolicyStatement instead.
 type IAMRolePrivilege struct {
+	// Effect is either "Allow" or "Deny". Defaults to "Allow".
+	Effect string `json:",omitempty"`
 	// What actions you will allow.
 	// Each AWS service has its own set of actions.
 	// For example, you might allow a user to use the Amazon S3 ListBucket action,
 	// which returns information about the items in a bucket.
 	// Any actions that you don't explicitly allow are denied.
-	Actions []string
+	Actions []string `json:",omitempty"`
+	// NotActions are the actions that the privilege does not apply to.
+	// Mutually exclusive with Actions.
+	NotActions []string `json:",omitempty"`
 	// Which resources you allow the action on. For example, what specific Amazon
 	// S3 buckets will you allow the user to perform the ListBucket action on?
 	// Users cannot access any resources that you have not explicitly granted
 	// permissions to.
 	Resource interface{} `json:",omitempty"`
+	// NotResource is the resource that the privilege does not apply to.
+	// Mutually exclusive with Resource.
+	NotResource interface{} `json:",omitempty"`
 	// Service that requires the action
 	Principal interface{} `json:",omitempty"`
 	// Optional condition for the privilege
 	Condition interface{} `json:",omitempty"`
 }
 
-func (rolePrivilege *IAMRolePrivilege) resourceExpr() *gocf.StringExpr {
-	switch typedPrivilege := rolePrivilege.Resource.(type) {
+// privilegeResourceExpr returns the StringExpr for a Resource or
+// NotResource value
+func privilegeResourceExpr(resource interface{}) *gocf.StringExpr {
+	switch typedResource := resource.(type) {
+	case nil:
+		return nil
 	case string:
-		return gocf.String(typedPrivilege)
+		return gocf.String(typedResource)
 	case gocf.RefFunc:
-		return typedPrivilege.String()
+		return typedResource.String()
+	case gocf.Stringable:
+		return typedResource.String()
+	default:
+		return typedResource.(*gocf.StringExpr)
+	}
+}
+
+func (rolePrivilege *IAMRolePrivilege) resourceExpr() *gocf.StringExpr {
+	return privilegeResourceExpr(rolePrivilege.Resource)
+}
+
+// policyStatement returns the IAM policy statement for this privilege
+func (rolePrivilege *IAMRolePrivilege) policyStatement() spartaIAM.PolicyStatement {
+	effect := rolePrivilege.Effect
+	if effect == "" {
+		effect = "Allow"
+	}
+	return spartaIAM.PolicyStatement{
+		Effect:      effect,
+		Action:      rolePrivilege.Actions,
+		NotAction:   rolePrivilege.NotActions,
+		Resource:    rolePrivilege.resourceExpr(),
+		NotResource: privilegeResourceExpr(rolePrivilege.NotResource),
+		Condition:   rolePrivilege.Condition,
+	}
+}
+
+// validate ensures the privilege is a well formed policy statement
+func (rolePrivilege *IAMRolePrivilege) validate() error {
+	switch rolePrivilege.Effect {
+	case "", "Allow", "Deny":
 	default:
-		return typedPrivilege.(*gocf.StringExpr)
+		return errors.Errorf("IAMRolePrivilege Effect must be either Allow or Deny. Found: %s",
+			rolePrivilege.Effect)
+	}
+	if (len(rolePrivilege.Actions) == 0) == (len(rolePrivilege.NotActions) == 0) {
+		return errors.Errorf("IAMRolePrivilege must define exactly one of Actions or NotActions")
 	}
+	if (rolePrivilege.Resource == nil) == (rolePrivilege.NotResource == nil) {
+		return errors.Errorf("IAMRolePrivilege must define exactly one of Resource or NotResource")
+	}
+	for _, eachAction := range append(rolePrivilege.Actions, rolePrivilege.NotActions...) {
+		if actionErr := spartaIAM.ValidateAction(eachAction); actionErr != nil {
+			return actionErr
+		}
+	}
+	return nil
 }
 
 // IAMRoleDefinition stores a slice of IAMRolePrivilege values
@@ -357,6 +694,18 @@ func (rolePrivilege *IAMRolePrivilege) resourceExpr() *gocf.StringExpr {
 type IAMRoleDefinition struct {
 	// Slice of IAMRolePrivilege entries
 	Privileges []IAMRolePrivilege
+	// PermissionsBoundary is the optional ARN of the managed policy that
+	// sets the maximum permissions for the role
+	PermissionsBoundary gocf.Stringable
+	// Path is the optional IAM path for the role (eg, /sparta/)
+	Path string
+	// RoleName is the optional explicit name of the role. Named roles
+	// require the CAPABILITY_NAMED_IAM capability, which Sparta adds
+	// automatically.
+	RoleName string
+	// ManagedPolicyArns are the optional managed policies attached
+	// to the role
+	ManagedPolicyArns []gocf.Stringable
 	// Cached logical resource name
 	cachedLogicalName string
 }
@@ -365,20 +714,11 @@ func (roleDefinition *IAMRoleDefinition) toResource(eventSourceMappings []*Event
 	options *LambdaFunctionOptions,
 	logger *logrus.Logger) gocf.IAMRole {
 
-	statements := CommonIAMStatements.Core
+	statements := append([]spartaIAM.PolicyStatement{}, CommonIAMStatements.Core...)
 	for _, eachPrivilege := range roleDefinition.Privileges {
-		policyStatement := spartaIAM.PolicyStatement{
-			Effect:   "Allow",
-			Action:   eachPrivilege.Actions,
-			Resource: eachPrivilege.resourceExpr(),
-		}
-		statements = append(statements, policyStatement)
-	}
-
-	// Add VPC permissions iff needed
-	if options != nil && options.VpcConfig != nil {
-		statements = append(statements, CommonIAMStatements.VPC...)
+		statements = append(statements, eachPrivilege.policyStatement())
 	}
+	statements = append(statements, lambdaRoleStatements(eventSourceMappings, options)...)
 	// In the past Sparta used to attach EventSourceMapping policies here.
 	// However, moving everything to dynamic references means that we can't
 	// fully populate the PolicyDocument statement slice until all of
@@ -396,10 +736,127 @@ func (roleDefinition *IAMRoleDefinition) toResource(eventSourceMappings []*Event
 		},
 		PolicyName: gocf.String("LambdaPolicy"),
 	})
-	return gocf.IAMRole{
+	iamRole := gocf.IAMRole{
 		AssumeRolePolicyDocument: AssumePolicyDocument,
 		Policies:                 &iamPolicies,
 	}
+	if roleDefinition.PermissionsBoundary != nil {
+		iamRole.PermissionsBoundary = roleDefinition.PermissionsBoundary.String()
+	}
+	if roleDefinition.Path != "" {
+		iamRole.Path = gocf.String(roleDefinition.Path)
+	}
+	if roleDefinition.RoleName != "" {
+		iamRole.RoleName = gocf.String(roleDefinition.RoleName)
+	}
+	managedPolicyArns := roleDefinition.ManagedPolicyArns
+	if options != nil && options.LambdaInsights != nil {
+		managedPolicyArns = append(append([]gocf.Stringable{}, managedPolicyArns...),
+			lambdaInsightsPolicyArn())
+	}
+	if len(managedPolicyArns) != 0 {
+		iamRole.ManagedPolicyArns = gocf.StringList(managedPolicyArns...)
+	}
+	return iamRole
+}
+
+// lambdaRoleStatements returns the privileges that a function's options and
+// event source mappings require of its execution role
+func lambdaRoleStatements(eventSourceMappings []*EventSourceMapping,
+	options *LambdaFunctionOptions) []spartaIAM.PolicyStatement {
+
+	statements := []spartaIAM.PolicyStatement{}
+	// Add VPC permissions iff needed
+	if options != nil && (options.VpcConfig != nil || options.VPCDiscovery != nil) {
+		statements = append(statements, CommonIAMStatements.VPC...)
+	}
+	if options != nil {
+		for _, eachConfig := range options.FileSystemConfigs {
+			statements = append(statements, eachConfig.iamStatement())
+		}
+		for _, eachTable := range options.DynamoDBResources {
+			statements = append(statements, eachTable.iamStatements()...)
+		}
+		for _, eachQueue := range options.SQSResources {
+			statements = append(statements, eachQueue.iamStatements()...)
+		}
+		for _, eachTopic := range options.SNSResources {
+			statements = append(statements, eachTopic.iamStatements()...)
+		}
+		if options.AppConfig != nil {
+			statements = append(statements, options.AppConfig.iamStatements()...)
+		}
+		for _, eachRef := range options.Secrets {
+			if eachRef != nil && eachRef.ID != nil {
+				statements = append(statements, eachRef.iamStatements()...)
+			}
+		}
+	}
+	// Kafka event sources require privileges that don't depend on
+	// the type of the EventSourceArn resource
+	for _, eachMapping := range eventSourceMappings {
+		statements = append(statements, eachMapping.iamStatements()...)
+	}
+	return statements
+}
+
+// addSharedRoleStatements adds the privileges that a function requires to an
+// existing Sparta-managed role that's shared by several functions. Statements
+// that the role already includes aren't duplicated.
+func addSharedRoleStatements(roleResource *gocf.Resource,
+	statements []spartaIAM.PolicyStatement) {
+	iamRole, iamRoleOk := templateIAMRole(roleResource)
+	if !iamRoleOk || iamRole.Policies == nil || len(*iamRole.Policies) == 0 {
+		return
+	}
+	policyDoc, policyDocOk := (*iamRole.Policies)[0].PolicyDocument.(ArbitraryJSONObject)
+	if !policyDocOk {
+		return
+	}
+	existingStatements, _ := policyDoc["Statement"].([]spartaIAM.PolicyStatement)
+	mergedStatements := append([]spartaIAM.PolicyStatement{}, existingStatements...)
+	for _, eachStatement := range statements {
+		statementExists := false
+		for _, eachExisting := range mergedStatements {
+			if reflect.DeepEqual(eachStatement, eachExisting) {
+				statementExists = true
+				break
+			}
+		}
+		if !statementExists {
+			mergedStatements = append(mergedStatements, eachStatement)
+		}
+	}
+	policyDoc["Statement"] = mergedStatements
+}
+
+// validate ensures the optional role properties satisfy the IAM
+// constraints. Ref: https://docs.aws.amazon.com/IAM/latest/APIReference/API_CreateRole.html
+func (roleDefinition *IAMRoleDefinition) validate() []string {
+	var errorText []string
+	for _, eachPrivilege := range roleDefinition.Privileges {
+		if privilegeErr := eachPrivilege.validate(); privilegeErr != nil {
+			errorText = append(errorText, privilegeErr.Error())
+		}
+	}
+	if roleDefinition.Path != "" && !reIAMPath.MatchString(roleDefinition.Path) {
+		errorText = append(errorText,
+			fmt.Sprintf("IAMRoleDefinition Path must begin and end with '/'. Found: %s",
+				roleDefinition.Path))
+	}
+	if roleDefinition.RoleName != "" && !reIAMRoleName.MatchString(roleDefinition.RoleName) {
+		errorText = append(errorText,
+			fmt.Sprintf("IAMRoleDefinition RoleName must match %s. Found: %s",
+				reIAMRoleName.String(),
+				roleDefinition.RoleName))
+	}
+	if len(roleDefinition.ManagedPolicyArns) > maxIAMRoleManagedPolicies {
+		errorText = append(errorText,
+			fmt.Sprintf("IAMRoleDefinition supports at most %d ManagedPolicyArns. Found: %d",
+				maxIAMRoleManagedPolicies,
+				len(roleDefinition.ManagedPolicyArns)))
+	}
+	return errorText
 }
 
 // Returns the stable logical name for this IAMRoleDefinition, which depends on the serviceName
@@ -428,6 +885,140 @@ type EventSourceMapping struct {
 	EventSourceArn   interface{}
 	Disabled         bool
 	BatchSize        int64
+	// Topics is the Kafka topic to consume. Required for Amazon MSK
+	// and self-managed Apache Kafka event sources.
+	Topics []string
+	// ConsumerGroupID is the optional Kafka consumer group ID
+	ConsumerGroupID string
+	// SelfManagedKafka defines the bootstrap servers for a self-managed
+	// Apache Kafka cluster. If defined, EventSourceArn must be empty.
+	SelfManagedKafka *SelfManagedKafkaEventSource
+	// SourceAccessConfigurations define the authentication and network
+	// settings used to access a Kafka cluster
+	SourceAccessConfigurations []*SourceAccessConfiguration
+}
+
+// SelfManagedKafkaEventSource represents a self-managed Apache Kafka cluster
+// used as an EventSourceMapping source. See
+// https://docs.aws.amazon.com/lambda/latest/dg/with-kafka.html
+type SelfManagedKafkaEventSource struct {
+	// KafkaBootstrapServers is the list of bootstrap servers
+	// (eg: "abc.xyz.com:9092")
+	KafkaBootstrapServers []string
+}
+
+// SourceAccessConfiguration represents an authentication protocol, VPC
+// component, or virtual host used to secure and access an event source.
+// See https://docs.aws.amazon.com/lambda/latest/dg/API_SourceAccessConfiguration.html
+type SourceAccessConfiguration struct {
+	// Type is one of the SourceAccessType* constants
+	Type string
+	// URI is the value for the configuration Type. For authentication types this
+	// is the Secrets Manager secret ARN, for VPC types the subnet or security
+	// group ID. It may be either a string or a gocf.Stringable value.
+	URI interface{}
+}
+
+// isKafka returns true if this mapping consumes from either an Amazon MSK
+// or self-managed Apache Kafka cluster
+func (mapping *EventSourceMapping) isKafka() bool {
+	return mapping.SelfManagedKafka != nil || len(mapping.Topics) != 0
+}
+
+// secretArns returns the Secrets Manager secret ARNs referenced by
+// this mapping's SourceAccessConfigurations
+func (mapping *EventSourceMapping) secretArns() []*gocf.StringExpr {
+	secretArns := []*gocf.StringExpr{}
+	for _, eachConfig := range mapping.SourceAccessConfigurations {
+		switch eachConfig.Type {
+		case SourceAccessTypeVPCSubnet,
+			SourceAccessTypeVPCSecurityGroup,
+			SourceAccessTypeVirtualHost:
+			continue
+		default:
+			if eachConfig.URI != nil {
+				secretArns = append(secretArns,
+					spartaCF.DynamicValueToStringExpr(eachConfig.URI).String())
+			}
+		}
+	}
+	return secretArns
+}
+
+// requiresVPCAccess returns true if the Lambda service needs to create
+// network interfaces on behalf of this mapping
+func (mapping *EventSourceMapping) requiresVPCAccess() bool {
+	if mapping.SelfManagedKafka == nil {
+		// Amazon MSK clusters are always VPC resources
+		return mapping.isKafka()
+	}
+	for _, eachConfig := range mapping.SourceAccessConfigurations {
+		if eachConfig.Type == SourceAccessTypeVPCSubnet ||
+			eachConfig.Type == SourceAccessTypeVPCSecurityGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// iamStatements returns the IAM statements required by the Lambda execution
+// role to consume from the mapping's event source, for statements that can be
+// determined without resolving the EventSourceArn to a template resource.
+func (mapping *EventSourceMapping) iamStatements() []spartaIAM.PolicyStatement {
+	statements := []spartaIAM.PolicyStatement{}
+	if !mapping.isKafka() {
+		return statements
+	}
+	if mapping.SelfManagedKafka == nil && mapping.EventSourceArn != nil {
+		for _, eachStatement := range CommonIAMStatements.MSK {
+			statements = append(statements, spartaIAM.PolicyStatement{
+				Effect:   eachStatement.Effect,
+				Action:   eachStatement.Action,
+				Resource: spartaCF.DynamicValueToStringExpr(mapping.EventSourceArn).String(),
+			})
+		}
+	}
+	for _, eachSecretArn := range mapping.secretArns() {
+		statements = append(statements, spartaIAM.PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: eachSecretArn,
+		})
+	}
+	if mapping.requiresVPCAccess() {
+		statements = append(statements, CommonIAMStatements.KafkaVPC...)
+	}
+	return statements
+}
+
+func (mapping *EventSourceMapping) validate() error {
+	if !mapping.isKafka() {
+		if mapping.EventSourceArn == nil {
+			return errors.Errorf("EventSourceMapping requires an EventSourceArn")
+		}
+		return nil
+	}
+	if len(mapping.Topics) != 1 {
+		return errors.Errorf("Kafka EventSourceMapping requires exactly one topic. Found: %v",
+			mapping.Topics)
+	}
+	if mapping.SelfManagedKafka != nil {
+		if mapping.EventSourceArn != nil {
+			return errors.Errorf("Self-managed Kafka EventSourceMapping must not define an EventSourceArn")
+		}
+		if len(mapping.SelfManagedKafka.KafkaBootstrapServers) == 0 {
+			return errors.Errorf("Self-managed Kafka EventSourceMapping requires at least one bootstrap server")
+		}
+	} else if mapping.EventSourceArn == nil {
+		return errors.Errorf("Amazon MSK EventSourceMapping requires the cluster ARN as the EventSourceArn")
+	}
+	for _, eachConfig := range mapping.SourceAccessConfigurations {
+		if eachConfig.Type == "" || eachConfig.URI == nil {
+			return errors.Errorf("SourceAccessConfiguration requires both Type and URI: %#v",
+				eachConfig)
+		}
+	}
+	return nil
 }
 
 func (mapping *EventSourceMapping) export(serviceName string,
@@ -438,12 +1029,20 @@ func (mapping *EventSourceMapping) export(serviceName string,
 	template *gocf.Template,
 	logger *logrus.Logger) error {
 
-	dynamicArn := spartaCF.DynamicValueToStringExpr(mapping.EventSourceArn)
+	validateErr := mapping.validate()
+	if validateErr != nil {
+		return errors.Wrapf(validateErr, "Invalid EventSourceMapping for %s", targetLambdaName)
+	}
 	eventSourceMappingResource := gocf.LambdaEventSourceMapping{
-		EventSourceArn: dynamicArn.String(),
-		FunctionName:   targetLambdaArn,
-		BatchSize:      gocf.Integer(mapping.BatchSize),
-		Enabled:        gocf.Bool(!mapping.Disabled),
+		FunctionName: targetLambdaArn,
+		BatchSize:    marshalInt(mapping.BatchSize),
+		Enabled:      gocf.Bool(!mapping.Disabled),
+	}
+	eventSourceArnLiteral := ""
+	if mapping.EventSourceArn != nil {
+		dynamicArn := spartaCF.DynamicValueToStringExpr(mapping.EventSourceArn)
+		eventSourceMappingResource.EventSourceArn = dynamicArn.String()
+		eventSourceArnLiteral = dynamicArn.String().Literal
 	}
 	if mapping.StartingPosition != "" {
 		eventSourceMappingResource.StartingPosition = gocf.String(mapping.StartingPosition)
@@ -453,11 +1052,45 @@ func (mapping *EventSourceMapping) export(serviceName string,
 	// resource name
 	hashParts := []string{
 		targetLambdaName,
-		dynamicArn.String().Literal,
+		eventSourceArnLiteral,
 		targetLambdaArn.Literal,
 		fmt.Sprintf("%d", mapping.BatchSize),
 		mapping.StartingPosition,
 	}
+	var resourceProperties gocf.ResourceProperties = eventSourceMappingResource
+	if mapping.isKafka() {
+		kafkaResource := lambdaEventSourceMapping{
+			LambdaEventSourceMapping: eventSourceMappingResource,
+			Topics:                   marshalStringList(mapping.Topics),
+		}
+		var consumerGroupConfig *lambdaEventSourceMappingKafkaConfig
+		if mapping.ConsumerGroupID != "" {
+			consumerGroupConfig = &lambdaEventSourceMappingKafkaConfig{
+				ConsumerGroupID: gocf.String(mapping.ConsumerGroupID),
+			}
+		}
+		if mapping.SelfManagedKafka != nil {
+			kafkaResource.SelfManagedEventSource = &lambdaEventSourceMappingSelfManagedEventSource{
+				Endpoints: &lambdaEventSourceMappingEndpoints{
+					KafkaBootstrapServers: marshalStringList(mapping.SelfManagedKafka.KafkaBootstrapServers),
+				},
+			}
+			kafkaResource.SelfManagedKafkaEventSourceConfig = consumerGroupConfig
+			hashParts = append(hashParts, mapping.SelfManagedKafka.KafkaBootstrapServers...)
+		} else {
+			kafkaResource.AmazonManagedKafkaEventSourceConfig = consumerGroupConfig
+		}
+		for _, eachConfig := range mapping.SourceAccessConfigurations {
+			kafkaResource.SourceAccessConfigurations = append(kafkaResource.SourceAccessConfigurations,
+				lambdaEventSourceMappingSourceAccessConfiguration{
+					Type: gocf.String(eachConfig.Type),
+					URI:  spartaCF.DynamicValueToStringExpr(eachConfig.URI).String(),
+				})
+		}
+		hashParts = append(hashParts, mapping.Topics...)
+		hashParts = append(hashParts, mapping.ConsumerGroupID)
+		resourceProperties = kafkaResource
+	}
 	hash := sha1.New()
 	for _, eachHashPart := range hashParts {
 		_, writeErr := hash.Write([]byte(eachHashPart))
@@ -467,7 +1100,7 @@ func (mapping *EventSourceMapping) export(serviceName string,
 		}
 	}
 	resourceName := fmt.Sprintf("LambdaES%s", hex.EncodeToString(hash.Sum(nil)))
-	template.AddResource(resourceName, eventSourceMappingResource)
+	template.AddResource(resourceName, resourceProperties)
 	return nil
 }
 
@@ -573,6 +1206,19 @@ func (resourceInfo *customResourceInfo) export(serviceName string,
 	cfResource := template.AddResource(lambdaFunctionCFName, lambdaResource)
 	safeMetadataInsert(cfResource, "golangFunc", resourceInfo.userFunctionName)
 
+	if resourceInfo.options.LogGroup != nil {
+		logGroupResourceName, logGroupErr := exportLogGroup(lambdaFunctionCFName,
+			lambdaFunctionName,
+			resourceInfo.options.LogGroup,
+			template)
+		if nil != logGroupErr {
+			return errors.Wrapf(logGroupErr,
+				"Failed to export log group for custom resource %s",
+				resourceInfo.userFunctionName)
+		}
+		cfResource.DependsOn = append(cfResource.DependsOn, logGroupResourceName)
+	}
+
 	// And create the CustomResource that actually invokes it...
 	newResource, newResourceError := newCloudFormationResource(cloudFormationLambda, logger)
 	if nil != newResourceError {
@@ -695,6 +1341,10 @@ type LambdaAWSInfo struct {
 	// Event Source docs (http://docs.aws.amazon.com/lambda/latest/dg/intro-core-components.html)
 	// for more information
 	EventSourceMappings []*EventSourceMapping
+	// EventBridge Scheduler schedules that invoke this lambda function. See
+	// https://docs.aws.amazon.com/scheduler/latest/UserGuide/what-is-scheduler.html
+	// for more information
+	Schedules []*Schedule
 	// Template decorators. If non empty, the decorators will be called,
 	// in order, to annotate the template
 	Decorators []TemplateDecoratorHandler
@@ -850,7 +1500,7 @@ func (info *LambdaAWSInfo) applyDecorators(template *gocf.Template,
 	S3Bucket string,
 	S3Key string,
 	buildID string,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error {
 
 	decorators := info.Decorators
@@ -910,7 +1560,7 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	buildID string,
 	roleNameMap map[string]*gocf.StringExpr,
 	template *gocf.Template,
-	context map[string]interface{},
+	context *WorkflowHookContext,
 	logger *logrus.Logger) error {
 
 	// Let's make sure the handler has the proper signature...This is basically
@@ -944,33 +1594,98 @@ func (info *LambdaAWSInfo) export(serviceName string,
 		},
 		Description: gocf.String(lambdaDescription),
 		Handler:     gocf.String(SpartaBinaryName),
-		MemorySize:  gocf.Integer(info.Options.MemorySize),
 		Role:        roleNameMap[iamRoleArnName],
 		Runtime:     gocf.String(GoLambdaVersion),
-		Timeout:     gocf.Integer(info.Options.Timeout),
 		VPCConfig:   info.Options.VpcConfig,
 	}
+	if isStreamingLambda(info) {
+		lambdaResource.Runtime = gocf.String(StreamingLambdaRuntime)
+	}
+	if info.Options.MemorySize != 0 {
+		lambdaResource.MemorySize = gocf.Integer(info.Options.MemorySize)
+	}
+	if info.Options.Timeout != 0 {
+		lambdaResource.Timeout = gocf.Integer(info.Options.Timeout)
+	}
+	if info.Options.MemorySizeParameter != "" {
+		memorySize, memorySizeErr := templateParameterInteger(info.Options.MemorySizeParameter, template)
+		if memorySizeErr != nil {
+			return errors.Wrapf(memorySizeErr, "Invalid MemorySizeParameter for lambda %s", info.lambdaFunctionName())
+		}
+		lambdaResource.MemorySize = memorySize
+	}
+	if info.Options.TimeoutParameter != "" {
+		timeout, timeoutErr := templateParameterInteger(info.Options.TimeoutParameter, template)
+		if timeoutErr != nil {
+			return errors.Wrapf(timeoutErr, "Invalid TimeoutParameter for lambda %s", info.lambdaFunctionName())
+		}
+		lambdaResource.Timeout = timeout
+	}
 	// Layers?
-	if nil != info.Layers {
-		lambdaResource.Layers = gocf.StringList(info.Layers...)
+	layers, layersErr := lambdaLayers(info, template)
+	if layersErr != nil {
+		return errors.Wrapf(layersErr, "Invalid layers for lambda %s", info.lambdaFunctionName())
+	}
+	if nil != layers {
+		lambdaResource.Layers = gocf.StringList(layers...)
 	}
 
 	if S3Version != "" {
 		lambdaResource.Code.S3ObjectVersion = gocf.String(S3Version)
 	}
+	if info.Options.VPCDiscovery != nil {
+		vpcConfig, vpcConfigErr := info.Options.VPCDiscovery.lambdaVPCConfig()
+		if vpcConfigErr != nil {
+			return errors.Wrapf(vpcConfigErr, "Invalid options for lambda %s", info.lambdaFunctionName())
+		}
+		lambdaResource.VPCConfig = vpcConfig
+	}
 	if info.Options.ReservedConcurrentExecutions != 0 {
 		lambdaResource.ReservedConcurrentExecutions = gocf.Integer(info.Options.ReservedConcurrentExecutions)
 	}
-	if info.Options.DeadLetterConfigArn != nil {
-		lambdaResource.DeadLetterConfig = &gocf.LambdaFunctionDeadLetterConfig{
-			TargetArn: info.Options.DeadLetterConfigArn.String(),
+	// Dead letter and async invocation destinations. The execution role
+	// must be able to publish to these before the function is created.
+	asyncErr := validateAsyncOptions(info.Options)
+	if asyncErr != nil {
+		return errors.Wrapf(asyncErr, "Invalid options for lambda %s", info.lambdaFunctionName())
+	}
+	deadLetterConfig, asyncStatements := exportDeadLetterConfig(info.LogicalResourceName(),
+		info.Options,
+		template)
+	lambdaResource.DeadLetterConfig = deadLetterConfig
+	invokeConfigResource, invokeConfigStatements := exportEventInvokeConfig(info.LogicalResourceName(),
+		info.Options.EventInvokeConfig,
+		publishedAliasName(info.Options),
+		template,
+		logger)
+	asyncStatements = append(asyncStatements, invokeConfigStatements...)
+	asyncRoleName := ""
+	if info.RoleName == "" && info.RoleDefinition != nil {
+		asyncRoleName = info.RoleDefinition.logicalName(serviceName, info.lambdaFunctionName())
+	}
+	asyncPolicyName := exportAsyncPolicy(info.LogicalResourceName(),
+		asyncRoleName,
+		asyncStatements,
+		template)
+	if asyncPolicyName != "" {
+		dependsOn = append(dependsOn, asyncPolicyName)
+		if invokeConfigResource != nil {
+			invokeConfigResource.DependsOn = append(invokeConfigResource.DependsOn, asyncPolicyName)
 		}
 	}
-	if nil != info.Options.TracingConfig {
-		lambdaResource.TracingConfig = info.Options.TracingConfig
+	if tracingConfig := info.Options.tracingConfig(); tracingConfig != nil {
+		lambdaResource.TracingConfig = tracingConfig
+		if info.RoleName != "" {
+			logger.WithFields(logrus.Fields{
+				"Function": info.lambdaFunctionName(),
+				"RoleName": info.RoleName,
+			}).Warn("Ensure the IAM role includes the xray:PutTraceSegments and xray:PutTelemetryRecords privileges")
+		}
 	}
 	if info.Options.KmsKeyArn != "" {
 		lambdaResource.KmsKeyArn = gocf.String(info.Options.KmsKeyArn)
+	} else if info.Options.KmsKey != nil {
+		lambdaResource.KmsKeyArn = info.Options.KmsKey.String()
 	}
 	if nil != info.Options.Tags {
 		tagList := gocf.TagList{}
@@ -992,6 +1707,19 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	}
 	info.Options.Environment[envVarLogLevel] =
 		gocf.String(logger.Level.String())
+	for eachName, eachRef := range info.Options.Secrets {
+		info.Options.Environment[envVarSecretPrefix+eachName] = eachRef.envValue()
+	}
+	for eachName, eachVar := range info.Options.Config {
+		if eachVar.Value != nil {
+			info.Options.Environment[eachName] = eachVar.Value.String()
+		}
+	}
+	if info.Options.AppConfig != nil {
+		for eachName, eachValue := range info.Options.AppConfig.environment() {
+			info.Options.Environment[eachName] = eachValue
+		}
+	}
 
 	lambdaResource.Environment = &gocf.LambdaFunctionEnvironment{
 		Variables: info.Options.Environment,
@@ -1004,18 +1732,132 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	lambdaFunctionName := awsLambdaFunctionName(info.lambdaFunctionName())
 	lambdaResource.FunctionName = lambdaFunctionName.String()
 
-	cfResource := template.AddResource(info.LogicalResourceName(), lambdaResource)
+	// Create the log group before the function so that AWS Lambda
+	// doesn't implicitly create it
+	logGroup := info.Options.LogGroup
+	if logGroup != nil {
+		logGroupResourceName, logGroupErr := exportLogGroup(info.LogicalResourceName(),
+			lambdaFunctionName,
+			logGroup,
+			template)
+		if nil != logGroupErr {
+			return errors.Wrapf(logGroupErr,
+				"Failed to export log group for lambda %s",
+				info.lambdaFunctionName())
+		}
+		dependsOn = append(dependsOn, logGroupResourceName)
+	}
+
+	// DynamoDB table, SQS queue and SNS topic dependencies
+	for _, eachTable := range info.Options.DynamoDBResources {
+		tableResourceName, tableErr := eachTable.export(template)
+		if tableErr != nil {
+			return tableErr
+		}
+		if tableResourceName != "" {
+			dependsOn = append(dependsOn, tableResourceName)
+		}
+	}
+	for _, eachQueue := range info.Options.SQSResources {
+		queueResourceName, queueErr := eachQueue.export(template)
+		if queueErr != nil {
+			return queueErr
+		}
+		if queueResourceName != "" {
+			dependsOn = append(dependsOn, queueResourceName)
+		}
+	}
+	for _, eachTopic := range info.Options.SNSResources {
+		topicResourceName, topicErr := eachTopic.export(template)
+		if topicErr != nil {
+			return topicErr
+		}
+		if topicResourceName != "" {
+			dependsOn = append(dependsOn, topicResourceName)
+		}
+	}
+
+	var cfResourceProperties gocf.ResourceProperties = lambdaResource
+	if info.Options.EphemeralStorage != 0 ||
+		len(info.Options.FileSystemConfigs) != 0 ||
+		info.Options.CodeSigningConfig != nil ||
+		(logGroup != nil && logGroup.Name != "") {
+		extendedLambdaResource := lambdaFunction{
+			LambdaFunction: lambdaResource,
+		}
+		if logGroup != nil && logGroup.Name != "" {
+			extendedLambdaResource.LoggingConfig = &lambdaFunctionLoggingConfig{
+				LogGroup: logGroup.logGroupName(lambdaFunctionName),
+			}
+		}
+		if info.Options.CodeSigningConfig != nil {
+			signingConfigArn, signingConfigErr := info.Options.CodeSigningConfig.export(template)
+			if signingConfigErr != nil {
+				return signingConfigErr
+			}
+			extendedLambdaResource.CodeSigningConfigArn = signingConfigArn
+		}
+		if info.Options.EphemeralStorage != 0 {
+			extendedLambdaResource.EphemeralStorage = &lambdaFunctionEphemeralStorage{
+				Size: gocf.Integer(info.Options.EphemeralStorage),
+			}
+		}
+		for eachIndex, eachConfig := range info.Options.FileSystemConfigs {
+			extendedLambdaResource.FileSystemConfigs = append(extendedLambdaResource.FileSystemConfigs,
+				eachConfig.export(info.LogicalResourceName(), eachIndex, template))
+		}
+		cfResourceProperties = extendedLambdaResource
+	}
+	cfResource := template.AddResource(info.LogicalResourceName(), cfResourceProperties)
 	cfResource.DependsOn = append(cfResource.DependsOn, dependsOn...)
 	safeMetadataInsert(cfResource, "golangFunc", info.lambdaFunctionName())
 
 	// Create the lambda Ref in case we need a permission or event mapping
 	functionAttr := gocf.GetAtt(info.LogicalResourceName(), "Arn")
 
+	// Published version alias. Push-based, pull-based and scheduled
+	// invocations target the alias so that traffic shifting applies to them.
+	codeSHA256 := ""
+	if context != nil {
+		codeSHA256 = context.CodeArchiveSHA256()
+	}
+	aliasResourceName, aliasErr := exportPublishedAlias(serviceName,
+		info.LogicalResourceName(),
+		info.Options,
+		codeSHA256,
+		template,
+		logger)
+	if nil != aliasErr {
+		return errors.Wrapf(aliasErr,
+			"Failed to export published alias for lambda %s",
+			info.lambdaFunctionName())
+	}
+	invocationTargetArn := functionAttr
+	if aliasResourceName != "" {
+		invocationTargetArn = gocf.Ref(aliasResourceName).String()
+		// The EventInvokeConfig qualifier is the alias name
+		if invokeConfigResource != nil {
+			invokeConfigResource.DependsOn = append(invokeConfigResource.DependsOn, aliasResourceName)
+		}
+	}
+
+	// Function URL
+	urlErr := exportFunctionURL(info.LogicalResourceName(),
+		info.Options,
+		aliasResourceName,
+		template)
+	if nil != urlErr {
+		return errors.Wrapf(urlErr,
+			"Failed to export function URL for lambda %s",
+			info.lambdaFunctionName())
+	}
+
 	// Permissions
 	for _, eachPermission := range info.Permissions {
 		_, err := eachPermission.export(serviceName,
 			info.lambdaFunctionName(),
 			info.LogicalResourceName(),
+			invocationTargetArn,
 			template,
 			S3Bucket,
 			S3Key,
@@ -1029,7 +1871,7 @@ func (info *LambdaAWSInfo) export(serviceName string,
 	for _, eachEventSourceMapping := range info.EventSourceMappings {
 		mappingErr := eachEventSourceMapping.export(serviceName,
 			info.lambdaFunctionName(),
-			functionAttr,
+			invocationTargetArn,
 			S3Bucket,
 			S3Key,
 			template,
@@ -1039,6 +1881,24 @@ func (info *LambdaAWSInfo) export(serviceName string,
 		}
 	}
 
+	// SQS queue event sources
+	for _, eachQueue := range info.Options.SQSResources {
+		eachQueue.exportEventSource(info.LogicalResourceName(),
+			invocationTargetArn,
+			template)
+	}
+
+	// Schedules
+	schedulesErr := exportSchedules(serviceName,
+		info.LogicalResourceName(),
+		invocationTargetArn,
+		info.Schedules,
+		template,
+		logger)
+	if nil != schedulesErr {
+		return schedulesErr
+	}
+
 	// CustomResource
 	for _, eachCustomResource := range info.customResources {
 
@@ -1098,8 +1958,15 @@ func validateSpartaPreconditions(lambdaAWSInfos []*LambdaAWSInfo,
 			collisionMemo[keyName] = collisionMemo[keyName] + 1
 		}
 	}
-	// 0 - check for invalid signatures
+	// 0 - check for invalid signatures. Typed handlers (see HandleLambda)
+	// and streaming handlers are validated by the compiler.
 	for _, eachLambda := range lambdaAWSInfos {
+		if _, isLambdaHandler := eachLambda.handlerSymbol.(LambdaHandler); isLambdaHandler {
+			continue
+		}
+		if isStreamingLambda(eachLambda) {
+			continue
+		}
 		validationErr := ensureValidSignature(eachLambda.userSuppliedFunctionName,
 			eachLambda.handlerSymbol)
 		if validationErr != nil {
@@ -1107,7 +1974,57 @@ func validateSpartaPreconditions(lambdaAWSInfos []*LambdaAWSInfo,
 		}
 	}
 
-	// 1 - check for duplicate golang function references.
+	// 1 - check for invalid function options, role definitions and
+	// schedule expressions
+	roleNames := make(map[string]*IAMRoleDefinition)
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.Options != nil {
+			for _, eachError := range eachLambda.Options.validate() {
+				errorText = append(errorText,
+					fmt.Sprintf("Lambda %s: %s", eachLambda.lambdaFunctionName(), eachError))
+			}
+			if eachLambda.Options.FunctionURL != nil &&
+				eachLambda.Options.FunctionURL.invokeMode() == FunctionURLInvokeModeResponseStream &&
+				!isStreamingLambda(eachLambda) {
+				errorText = append(errorText,
+					fmt.Sprintf("Lambda %s: FunctionURL InvokeMode %s requires a StreamingHandler",
+						eachLambda.lambdaFunctionName(),
+						FunctionURLInvokeModeResponseStream))
+			}
+		}
+		if eachLambda.RoleDefinition != nil {
+			for _, eachError := range eachLambda.RoleDefinition.validate() {
+				errorText = append(errorText,
+					fmt.Sprintf("Lambda %s: %s", eachLambda.lambdaFunctionName(), eachError))
+			}
+			// Distinct role definitions can't share the same explicit name
+			roleName := eachLambda.RoleDefinition.RoleName
+			if existingDefinition, exists := roleNames[roleName]; roleName != "" && exists &&
+				existingDefinition != eachLambda.RoleDefinition {
+				errorText = append(errorText,
+					fmt.Sprintf("Lambda %s: IAMRoleDefinition RoleName %s is already used by another IAMRoleDefinition",
+						eachLambda.lambdaFunctionName(),
+						roleName))
+			}
+			roleNames[roleName] = eachLambda.RoleDefinition
+		}
+		for _, eachSchedule := range eachLambda.Schedules {
+			scheduleErr := eachSchedule.validate()
+			if scheduleErr != nil {
+				errorText = append(errorText,
+					fmt.Sprintf("Lambda %s: %s", eachLambda.lambdaFunctionName(), scheduleErr.Error()))
+			}
+		}
+	}
+
+	// All functions share the same code archive, so there can be
+	// at most one signing profile
+	_, signingProfileErr := codeSigningProfileName(lambdaAWSInfos)
+	if signingProfileErr != nil {
+		errorText = append(errorText, signingProfileErr.Error())
+	}
+
+	// 2 - check for duplicate golang function references.
 	for _, eachLambda := range lambdaAWSInfos {
 		incrementCounter(eachLambda.lambdaFunctionName())
 		for _, eachCustom := range eachLambda.customResources {
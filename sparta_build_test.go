@@ -0,0 +1,2840 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/gdamore/tcell"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
+	spartaS3 "github.com/mweagle/Sparta/aws/s3"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIAMPrivilegeAnalysis(t *testing.T) {
+	template := gocf.NewTemplate()
+	template.AddResource("MyTable", &gocf.DynamoDBTable{})
+	lambdaFn, _ := NewAWSLambda("IAMPrivilegeAnalysis",
+		mockLambda1,
+		IAMRoleDefinition{
+			Privileges: []IAMRolePrivilege{
+				{
+					Actions:  []string{"dynamodb:*", "s3:GetObject"},
+					Resource: wildcardArn,
+				},
+			},
+		})
+	lambdaFn.DependsOn = []string{"MyTable"}
+
+	logger, _ := NewLogger("info")
+	analysis, analysisErr := analyzeLambdaIAMPrivileges(lambdaFn, template, logger)
+	if analysisErr != nil {
+		t.Fatalf("Failed to analyze IAM privileges: %s", analysisErr)
+	}
+	if len(analysis.broadActions) != 1 || analysis.broadActions[0] != "dynamodb:*" {
+		t.Fatalf("Unexpected broad actions: %v", analysis.broadActions)
+	}
+	suggested := statementActions(analysis.statements, "dynamodb")
+	if len(suggested) == 0 || !strings.Contains(strings.Join(suggested, ","), "dynamodb:GetItem") {
+		t.Fatalf("Failed to derive DynamoDB actions: %v", suggested)
+	}
+	if len(statementActions(analysis.statements, "s3")) != 1 {
+		t.Fatalf("Failed to preserve scoped actions")
+	}
+	lambdaFns := []*LambdaAWSInfo{lambdaFn}
+	if analyzeErr := analyzeIAMPrivileges(lambdaFns, template, false, logger); analyzeErr != nil {
+		t.Fatalf("Failed to warn about broad IAM actions: %s", analyzeErr)
+	}
+	if analyzeErr := analyzeIAMPrivileges(lambdaFns, template, true, logger); analyzeErr == nil {
+		t.Fatalf("Failed to reject broad IAM actions in strict mode")
+	}
+}
+
+func TestResolvePolicyIntrinsics(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ResolvePolicyIntrinsics",
+		mockLambda1,
+		IAMRoleDefinition{
+			Privileges: []IAMRolePrivilege{
+				{
+					Actions:  []string{"s3:GetObject"},
+					Resource: spartaIAM.GlobalARN("s3", gocf.Ref("MyBucket"), gocf.String("/*")),
+				},
+			},
+		})
+	logger, _ := NewLogger("info")
+	iamRole := lambdaFn.RoleDefinition.toResource(nil, lambdaFn.Options, logger)
+	policyJSON, _ := json.Marshal((*iamRole.Policies)[0].PolicyDocument)
+	var policyDocument interface{}
+	if unmarshalErr := json.Unmarshal(policyJSON, &policyDocument); unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal policy: %s", unmarshalErr)
+	}
+	resolvedJSON, _ := json.Marshal(resolvePolicyIntrinsics(policyDocument,
+		map[string]string{
+			"AWS::Partition": "aws",
+			"AWS::Region":    "us-west-2",
+		}))
+	for _, eachExpected := range []string{`"arn:aws:s3:::*/*"`,
+		"arn:aws:logs:us-west-2:*:*"} {
+		if !strings.Contains(string(resolvedJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in resolved policy: %s", eachExpected, resolvedJSON)
+		}
+	}
+	if strings.Contains(string(resolvedJSON), "Fn::") ||
+		strings.Contains(string(resolvedJSON), `"Ref"`) {
+		t.Fatalf("Failed to resolve policy intrinsics: %s", resolvedJSON)
+	}
+}
+
+func TestTemplateLimits(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("TemplateLimits",
+		mockLambda1,
+		IAMRoleDefinition{})
+	template := gocf.NewTemplate()
+	template.AddResource(lambdaFn.LogicalResourceName(), &gocf.LambdaFunction{})
+	for i := 0; i != maxTemplateResources; i++ {
+		template.AddResource(fmt.Sprintf("Permission%d", i), &gocf.LambdaPermission{
+			FunctionName: gocf.GetAtt(lambdaFn.LogicalResourceName(), "Arn"),
+		})
+	}
+	logger, _ := NewLogger("info")
+	limitsErr := validateTemplateLimits([]*LambdaAWSInfo{lambdaFn},
+		template,
+		[]byte("{}"),
+		logger)
+	if limitsErr == nil {
+		t.Fatalf("Failed to reject template with too many resources")
+	}
+	contributions, _ := templateContributions([]*LambdaAWSInfo{lambdaFn}, template)
+	if len(contributions) != 1 || contributions[0].count != maxTemplateResources+1 {
+		t.Fatalf("Failed to attribute resources to lambda function: %#v", contributions)
+	}
+	delete(template.Resources, "Permission0")
+	limitsErr = validateTemplateLimits([]*LambdaAWSInfo{lambdaFn},
+		template,
+		[]byte("{}"),
+		logger)
+	if limitsErr != nil {
+		t.Fatalf("Failed to accept template at the resource limit: %s", limitsErr)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	cfTemplate := []byte(`{"Resources":{"MyTopic":{"Type":"AWS::SNS::Topic","Properties":{"TopicName":{"Ref":"AWS::StackName"}}}}}`)
+	legacyTemplate, _ := json.Marshal(string(cfTemplate))
+
+	expected := map[string]string{
+		"": string(legacyTemplate),
+		TemplateFormatYAML: `Resources:
+  MyTopic:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !Ref AWS::StackName
+`,
+	}
+	for eachFormat, eachExpected := range expected {
+		var output bytes.Buffer
+		writeErr := writeTemplate(&output, eachFormat, cfTemplate, legacyTemplate)
+		if writeErr != nil {
+			t.Fatalf("Failed to write %s template: %s", eachFormat, writeErr)
+		}
+		if output.String() != eachExpected {
+			t.Fatalf("Unexpected %s template. Found:\n%s", eachFormat, output.String())
+		}
+	}
+	var jsonOutput bytes.Buffer
+	writeErr := writeTemplate(&jsonOutput, TemplateFormatJSON, cfTemplate, legacyTemplate)
+	if writeErr != nil || !json.Valid(jsonOutput.Bytes()) {
+		t.Fatalf("Failed to write JSON template: %s", writeErr)
+	}
+	if writeTemplate(&jsonOutput, "toml", cfTemplate, legacyTemplate) == nil {
+		t.Fatalf("Failed to reject unsupported template format")
+	}
+}
+
+func TestPackageManifest(t *testing.T) {
+	outputDirectory, outputDirectoryErr := ioutil.TempDir("", "sparta-package")
+	if outputDirectoryErr != nil {
+		t.Fatalf("Failed to create output directory: %s", outputDirectoryErr)
+	}
+	defer os.RemoveAll(outputDirectory)
+	artifactFile, artifactFileErr := ioutil.TempFile("", "sparta-code.zip")
+	if artifactFileErr != nil {
+		t.Fatalf("Failed to create artifact: %s", artifactFileErr)
+	}
+	defer os.Remove(artifactFile.Name())
+	artifactFile.Close()
+
+	logger, _ := NewLogger("info")
+	pkg := &packageContext{
+		outputDirectory: outputDirectory,
+		templateFormat:  TemplateFormatYAML,
+	}
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "PackageManifest",
+			buildID:     "abc123",
+			s3Bucket:    "my-bucket",
+			pkg:         pkg,
+		},
+	}
+	s3URL, s3URLErr := uploadLocalFileToS3(artifactFile.Name(), "", ctx)
+	if s3URLErr != nil {
+		t.Fatalf("Failed to package artifact: %s", s3URLErr)
+	}
+	artifactKey := newS3UploadURL(ctx.userdata.s3Bucket, s3URL).keyName()
+	if !strings.HasPrefix(artifactKey, "PackageManifest/") {
+		t.Fatalf("Unexpected artifact key: %s", artifactKey)
+	}
+	writeErr := pkg.writeManifest([]byte(`{"Resources":{}}`),
+		map[string]string{SpartaTagBuildIDKey: "abc123"},
+		ctx)
+	if writeErr != nil {
+		t.Fatalf("Failed to write manifest: %s", writeErr)
+	}
+	manifestJSON, manifestJSONErr := ioutil.ReadFile(filepath.Join(outputDirectory, packageManifestName))
+	if manifestJSONErr != nil {
+		t.Fatalf("Failed to read manifest: %s", manifestJSONErr)
+	}
+	var manifest packageManifest
+	unmarshalErr := json.Unmarshal(manifestJSON, &manifest)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal manifest: %s", unmarshalErr)
+	}
+	if manifest.Template != "template.yaml" ||
+		len(manifest.Artifacts) != 1 ||
+		manifest.Artifacts[0].S3Key != artifactKey ||
+		manifest.Artifacts[0].Uploaded {
+		t.Fatalf("Unexpected manifest: %s", string(manifestJSON))
+	}
+	for _, eachPath := range []string{manifest.Template, manifest.Artifacts[0].Path} {
+		if _, statErr := os.Stat(filepath.Join(outputDirectory, eachPath)); statErr != nil {
+			t.Fatalf("Failed to find packaged file %s: %s", eachPath, statErr)
+		}
+	}
+}
+
+func TestPackageSAMTemplate(t *testing.T) {
+	outputDirectory, outputDirectoryErr := ioutil.TempDir("", "sparta-package")
+	if outputDirectoryErr != nil {
+		t.Fatalf("Failed to create output directory: %s", outputDirectoryErr)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	logger, _ := NewLogger("info")
+	pkg := &packageContext{
+		outputDirectory: outputDirectory,
+		templateFormat:  TemplateFormatSAM,
+		artifacts: []*packageArtifact{
+			{
+				Path:     "PackageSAM-code.zip",
+				S3Bucket: "my-bucket",
+				S3Key:    "PackageSAM/PackageSAM-code.zip",
+			},
+		},
+	}
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "PackageSAM",
+			s3Bucket:    "my-bucket",
+			pkg:         pkg,
+		},
+	}
+	cfTemplate := []byte(`{"Resources":{"MyFunction":{"Type":"AWS::Lambda::Function","Properties":{"Code":{"S3Bucket":"my-bucket","S3Key":"PackageSAM/PackageSAM-code.zip"},"Handler":"PackageSAM"}}}}`)
+	writeErr := pkg.writeManifest(cfTemplate, map[string]string{"team": "core"}, ctx)
+	if writeErr != nil {
+		t.Fatalf("Failed to write SAM package: %s", writeErr)
+	}
+	samTemplate, samTemplateErr := ioutil.ReadFile(filepath.Join(outputDirectory, "template.yaml"))
+	if samTemplateErr != nil {
+		t.Fatalf("Failed to read SAM template: %s", samTemplateErr)
+	}
+	for _, eachExpected := range []string{"Transform: AWS::Serverless-2016-10-31",
+		"Type: AWS::Serverless::Function",
+		"CodeUri: PackageSAM-code.zip"} {
+		if !strings.Contains(string(samTemplate), eachExpected) {
+			t.Fatalf("SAM template does not include %s:\n%s", eachExpected, string(samTemplate))
+		}
+	}
+	samConfig, samConfigErr := ioutil.ReadFile(filepath.Join(outputDirectory, samConfigName))
+	if samConfigErr != nil || !strings.Contains(string(samConfig), `stack_name = "PackageSAM"`) {
+		t.Fatalf("Unexpected SAM config (%v): %s", samConfigErr, string(samConfig))
+	}
+}
+
+func TestExportTerraformPackage(t *testing.T) {
+	outputDirectory, outputDirectoryErr := ioutil.TempDir("", "sparta-export")
+	if outputDirectoryErr != nil {
+		t.Fatalf("Failed to create output directory: %s", outputDirectoryErr)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	logger, _ := NewLogger("info")
+	pkg := &packageContext{
+		outputDirectory: outputDirectory,
+		templateFormat:  ExportFormatTerraform,
+		artifacts: []*packageArtifact{
+			{
+				Path:     "ExportTerraform-code.zip",
+				S3Bucket: "my-bucket",
+				S3Key:    "ExportTerraform/ExportTerraform-code.zip",
+			},
+		},
+	}
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "ExportTerraform",
+			s3Bucket:    "my-bucket",
+			pkg:         pkg,
+		},
+	}
+	cfTemplate := []byte(`{"Resources":{"MyFunction":{"Type":"AWS::Lambda::Function","Properties":{"Code":{"S3Bucket":"my-bucket","S3Key":"ExportTerraform/ExportTerraform-code.zip"},"Handler":"ExportTerraform"}}}}`)
+	writeErr := pkg.writeManifest(cfTemplate, map[string]string{"team": "core"}, ctx)
+	if writeErr != nil {
+		t.Fatalf("Failed to write Terraform export: %s", writeErr)
+	}
+	terraformConfig, terraformConfigErr := ioutil.ReadFile(filepath.Join(outputDirectory, terraformConfigName))
+	if terraformConfigErr != nil {
+		t.Fatalf("Failed to read Terraform configuration: %s", terraformConfigErr)
+	}
+	for _, eachExpected := range []string{`resource "aws_lambda_function" "MyFunction" {`,
+		`filename         = "ExportTerraform-code.zip"`,
+		`default = "ExportTerraform"`} {
+		if !strings.Contains(string(terraformConfig), eachExpected) {
+			t.Fatalf("Terraform configuration does not include %s:\n%s", eachExpected, string(terraformConfig))
+		}
+	}
+	manifestJSON, manifestJSONErr := ioutil.ReadFile(filepath.Join(outputDirectory, packageManifestName))
+	if manifestJSONErr != nil || !strings.Contains(string(manifestJSON), `"Template": "main.tf"`) {
+		t.Fatalf("Unexpected manifest (%v): %s", manifestJSONErr, string(manifestJSON))
+	}
+}
+
+func TestDescribeDiagram(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("DescribeDiagram",
+		mockLambda1,
+		IAMRoleDefinition{
+			Privileges: []IAMRolePrivilege{
+				{
+					Actions:  []string{"s3:GetObject"},
+					Resource: "arn:aws:s3:::my-bucket/*",
+				},
+				{
+					Actions:  []string{"dynamodb:GetItem", "dynamodb:PutItem"},
+					Resource: gocf.GetAtt("Table", "Arn"),
+				},
+			},
+		})
+	lambdaResourceName := lambdaFn.LogicalResourceName()
+	templateJSON := fmt.Sprintf(`{"Resources":{
+		"%s": {"Type": "AWS::Lambda::Function", "DependsOn": ["Queue"], "Properties": {"Role": {"Fn::GetAtt": ["Role", "Arn"]}}},
+		"Role": {"Type": "AWS::IAM::Role"},
+		"Table": {"Type": "AWS::DynamoDB::Table"},
+		"Queue": {"Type": "AWS::SQS::Queue"},
+		"Topic": {"Type": "AWS::SNS::Topic"},
+		"StateMachine": {"Type": "AWS::StepFunctions::StateMachine",
+			"Properties": {"DefinitionString": {"Fn::Sub": "{\"Resource\": \"${%s.Arn}\"}"}}}
+	}}`, lambdaResourceName, lambdaResourceName)
+
+	logger, _ := NewLogger("info")
+	describer := &descriptionWriter{logger: logger}
+	for _, eachNode := range []string{"DescribeService", lambdaFn.lambdaFunctionName()} {
+		if writeErr := describer.writeNode(eachNode, nodeColorLambda, ""); writeErr != nil {
+			t.Fatalf("Failed to write node: %s", writeErr)
+		}
+	}
+	writeErr := describer.writeTemplateResources("DescribeService",
+		[]*LambdaAWSInfo{lambdaFn},
+		[]byte(templateJSON))
+	if writeErr != nil {
+		t.Fatalf("Failed to write template resources: %s", writeErr)
+	}
+	if describer.hasNode("Role") {
+		t.Fatalf("Unexpected IAM role node")
+	}
+	var mermaid bytes.Buffer
+	writeErr = describer.writeMermaid(&mermaid)
+	if writeErr != nil {
+		t.Fatalf("Failed to write Mermaid diagram: %s", writeErr)
+	}
+	// n0: service, n1: lambda, n2: Queue, n3: StateMachine, n4: Table, n5: Topic, n6: S3 ARN
+	for _, eachExpected := range []string{"flowchart LR",
+		`    n3["StateMachine"]`,
+		`    n6["arn:aws:s3:::my-bucket/*"]`,
+		`    n1 --> n2`,
+		`    n3 --> n1`,
+		`    n1 -->|"s3"| n6`,
+		`    n1 -->|"dynamodb"| n4`,
+		`    n5 --> n0`,
+		`    class n2,n3,n4,n5,n6 color1`} {
+		if !strings.Contains(mermaid.String(), eachExpected) {
+			t.Fatalf("Mermaid diagram does not include %s:\n%s", eachExpected, mermaid.String())
+		}
+	}
+	var dot bytes.Buffer
+	writeErr = describer.writeDOT("DescribeService", &dot)
+	if writeErr != nil {
+		t.Fatalf("Failed to write DOT diagram: %s", writeErr)
+	}
+	for _, eachExpected := range []string{`digraph "DescribeService" {`,
+		`    n4 [label="Table", fillcolor="#2E73B8"];`,
+		`    n1 -> n4 [label="dynamodb"];`,
+		`    n3 -> n1;`} {
+		if !strings.Contains(dot.String(), eachExpected) {
+			t.Fatalf("DOT diagram does not include %s:\n%s", eachExpected, dot.String())
+		}
+	}
+}
+
+func TestPostDeployValidation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer server.Close()
+
+	logger, _ := NewLogger("info")
+	stackOutputs := map[string]string{OutputAPIGatewayURL: server.URL + "/"}
+	healthCheck := &HTTPValidation{
+		OutputKey:    OutputAPIGatewayURL,
+		Path:         "/health",
+		BodyContains: `"ok"`,
+	}
+	validationErr := healthCheck.ValidateDeployment(nil, "PostDeploy", stackOutputs, "", nil, false, logger)
+	if validationErr != nil {
+		t.Fatalf("Failed to validate HTTP health check: %s", validationErr)
+	}
+	invalidChecks := []*HTTPValidation{
+		{URL: server.URL + "/missing", Attempts: 1},
+		{URL: server.URL + "/health", ExpectedStatusCodes: []int{http.StatusAccepted}, Attempts: 1},
+		{OutputKey: "MissingOutput"},
+	}
+	for _, eachCheck := range invalidChecks {
+		if eachCheck.ValidateDeployment(nil, "PostDeploy", stackOutputs, "", nil, false, logger) == nil {
+			t.Fatalf("Failed to reject invalid HTTP response: %#v", eachCheck)
+		}
+	}
+
+	// Failed validations register the revert rollback function
+	failingHook := PostDeployValidationHookFunc(func(context *WorkflowHookContext,
+		serviceName string,
+		stackOutputs map[string]string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+		return fmt.Errorf("validation failed")
+	})
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "PostDeploy",
+			workflowHooks: &WorkflowHooks{
+				PostDeployValidations: []PostDeployValidationHookHandler{failingHook},
+			},
+		},
+	}
+	step := validatePostDeployment(&cloudformation.Stack{}, &deploymentSnapshot{}, nil)
+	_, stepErr := step(ctx)
+	if stepErr == nil || len(ctx.transaction.rollbackFunctions) != 1 {
+		t.Fatalf("Failed to register post deploy rollback: %v", stepErr)
+	}
+}
+
+// mockHistoryS3 is an S3 API that stores the objects in memory
+type mockHistoryS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (mockS3 *mockHistoryS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	object, objectExists := mockS3.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)]
+	if !objectExists {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "NoSuchKey", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(object)),
+	}, nil
+}
+
+func (mockS3 *mockHistoryS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	object, _ := ioutil.ReadAll(input.Body)
+	mockS3.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = object
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestDeploymentHistory(t *testing.T) {
+	mockS3 := &mockHistoryS3{objects: make(map[string][]byte)}
+	historyKey := deploymentHistoryKey("Rollback")
+	history, historyErr := readDeploymentHistory(mockS3, "my-bucket", historyKey)
+	if historyErr != nil || len(history.Deployments) != 0 {
+		t.Fatalf("Unexpected missing deployment history: %v", historyErr)
+	}
+	for i := 0; i != maxDeploymentHistory+2; i++ {
+		history.Deployments = append([]*deploymentRecord{
+			{BuildID: fmt.Sprintf("build%d", i)},
+		}, history.Deployments...)
+		writeErr := writeDeploymentHistory(mockS3, "my-bucket", historyKey, history)
+		if writeErr != nil {
+			t.Fatalf("Failed to write deployment history: %s", writeErr)
+		}
+	}
+	history, historyErr = readDeploymentHistory(mockS3, "my-bucket", historyKey)
+	if historyErr != nil ||
+		len(history.Deployments) != maxDeploymentHistory ||
+		history.Deployments[0].BuildID != fmt.Sprintf("build%d", maxDeploymentHistory+1) {
+		t.Fatalf("Unexpected deployment history: %v", historyErr)
+	}
+	stack := &cloudformation.Stack{
+		Tags: []*cloudformation.Tag{
+			{
+				Key:   aws.String(SpartaTagDeploymentHistoryKey),
+				Value: aws.String(deploymentHistoryTagValue("my-bucket", "Rollback")),
+			},
+		},
+	}
+	historyBucket, stackHistoryKey := stackDeploymentHistoryLocation(stack)
+	if historyBucket != "my-bucket" || stackHistoryKey != historyKey {
+		t.Fatalf("Unexpected deployment history location: %s/%s", historyBucket, stackHistoryKey)
+	}
+	historyBucket, _ = stackDeploymentHistoryLocation(&cloudformation.Stack{})
+	if historyBucket != "" {
+		t.Fatalf("Unexpected deployment history location for untagged stack")
+	}
+}
+
+func TestRollbackStackInput(t *testing.T) {
+	previous := &deploymentRecord{
+		BuildID:     "abc123",
+		S3Bucket:    "my-bucket",
+		TemplateKey: "Rollback/Rollback-cftemplate-1.json",
+		TemplateURL: "https://s3.us-west-2.amazonaws.com/my-bucket/Rollback/Rollback-cftemplate-1.json",
+		CodeArtifacts: []*deploymentArtifact{
+			{Key: "Rollback/Rollback-code.zip", Version: "v1"},
+		},
+	}
+	stack := &cloudformation.Stack{
+		StackId:      aws.String("arn:aws:cloudformation:us-west-2:123412341234:stack/Rollback/1234"),
+		Capabilities: aws.StringSlice([]string{cloudformation.CapabilityCapabilityIam}),
+		Parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("Stage"), ParameterValue: aws.String("prod")},
+		},
+		Tags: []*cloudformation.Tag{
+			{Key: aws.String(SpartaTagBuildIDKey), Value: aws.String("def456")},
+			{Key: aws.String("team"), Value: aws.String("core")},
+		},
+	}
+	templateSummary := &cloudformation.ValidateTemplateOutput{
+		Capabilities: aws.StringSlice([]string{cloudformation.CapabilityCapabilityIam,
+			cloudformation.CapabilityCapabilityAutoExpand}),
+		Parameters: []*cloudformation.TemplateParameter{
+			{ParameterKey: aws.String("Stage")},
+			{ParameterKey: aws.String("NewParameter")},
+		},
+	}
+	updateInput := rollbackStackInput(stack, previous, previous.TemplateURL, templateSummary)
+	if len(updateInput.Capabilities) != 2 ||
+		len(updateInput.Parameters) != 1 ||
+		!aws.BoolValue(updateInput.Parameters[0].UsePreviousValue) {
+		t.Fatalf("Unexpected rollback request: %#v", updateInput)
+	}
+	for _, eachTag := range updateInput.Tags {
+		if *eachTag.Key == SpartaTagBuildIDKey && *eachTag.Value != "abc123" {
+			t.Fatalf("Failed to restore previous BuildID tag: %s", *eachTag.Value)
+		}
+	}
+}
+
+func TestProvisionProgressView(t *testing.T) {
+	logOutput := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = logOutput
+	view := newProvisionProgressView("ProgressView",
+		tcell.NewSimulationScreen("UTF-8"),
+		logger)
+	startErr := view.start()
+	if startErr != nil {
+		t.Fatalf("Failed to start progress view: %s", startErr)
+	}
+	logger.Info("Provisioning in progress")
+	view.stepCompleted(&workflowStepDuration{
+		name:     "Verify IAM roles",
+		start:    time.Now(),
+		duration: time.Second,
+	})
+	view.uploadProgress("ProgressView-code.zip")(512, 1024)
+
+	now := time.Now()
+	newEvent := func(eventID string, status string, timestamp time.Time) *cloudformation.StackEvent {
+		return &cloudformation.StackEvent{
+			EventId:           aws.String(eventID),
+			LogicalResourceId: aws.String("HelloWorldLambda"),
+			ResourceType:      aws.String("AWS::Lambda::Function"),
+			ResourceStatus:    aws.String(status),
+			Timestamp:         aws.Time(timestamp),
+		}
+	}
+	// Events are returned newest first and include previously seen events
+	view.updateStackEvents([]*cloudformation.StackEvent{
+		newEvent("2", cloudformation.ResourceStatusCreateComplete, now.Add(30*time.Second)),
+		newEvent("1", cloudformation.ResourceStatusCreateInProgress, now),
+	})
+	view.updateStackEvents([]*cloudformation.StackEvent{
+		newEvent("1", cloudformation.ResourceStatusCreateInProgress, now),
+	})
+	view.stop()
+
+	if !strings.Contains(logOutput.String(), "Provisioning in progress") {
+		t.Fatalf("Failed to replay log output: %s", logOutput.String())
+	}
+	view.render()
+	if view.resourcesTable.GetRowCount() != 2 ||
+		view.resourcesTable.GetCell(1, 2).Text != cloudformation.ResourceStatusCreateComplete ||
+		view.resourcesTable.GetCell(1, 3).Text != "30s" {
+		t.Fatalf("Unexpected stack resource status")
+	}
+	if !strings.Contains(view.uploadsTable.GetCell(0, 1).Text, "50%") ||
+		view.stepsTable.GetRowCount() != 1 {
+		t.Fatalf("Unexpected workflow progress")
+	}
+}
+
+func TestProvisionLock(t *testing.T) {
+	// Minimal S3 API that supports conditional writes
+	var objectsMutex sync.Mutex
+	objects := make(map[string][]byte)
+	s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objectsMutex.Lock()
+		defer objectsMutex.Unlock()
+		writeError := func(statusCode int, code string) {
+			w.WriteHeader(statusCode)
+			fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			if _, exists := objects[r.URL.Path]; exists && r.Header.Get("If-None-Match") == "*" {
+				writeError(http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case http.MethodGet:
+			object, exists := objects[r.URL.Path]
+			if !exists {
+				writeError(http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			w.Write(object)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer s3Server.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(s3Server.URL),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	s3Svc := s3.New(awsSession)
+	logger, _ := NewLogger("info")
+
+	firstLock, firstLockErr := acquireProvisionLock(s3Svc, "my-bucket", "LockTest", "abc123", false, logger)
+	if firstLockErr != nil {
+		t.Fatalf("Failed to acquire provision lock: %s", firstLockErr)
+	}
+	_, lockedErr := acquireProvisionLock(s3Svc, "my-bucket", "LockTest", "def456", false, logger)
+	if lockedErr == nil || !strings.Contains(lockedErr.Error(), "BuildID: abc123") {
+		t.Fatalf("Failed to reject overlapping provision: %v", lockedErr)
+	}
+	forcedLock, forcedLockErr := acquireProvisionLock(s3Svc, "my-bucket", "LockTest", "def456", true, logger)
+	if forcedLockErr != nil {
+		t.Fatalf("Failed to force unlock: %s", forcedLockErr)
+	}
+	// The original holder mustn't release the forced lock
+	releaseErr := releaseProvisionLock(s3Svc, "my-bucket", firstLock, logger)
+	if releaseErr != nil {
+		t.Fatalf("Failed to release provision lock: %s", releaseErr)
+	}
+	currentLock, _ := readProvisionLock(s3Svc, "my-bucket", "LockTest")
+	if currentLock == nil || currentLock.LockID != forcedLock.LockID {
+		t.Fatalf("Released lock owned by another process")
+	}
+	releaseErr = releaseProvisionLock(s3Svc, "my-bucket", forcedLock, logger)
+	if releaseErr != nil {
+		t.Fatalf("Failed to release provision lock: %s", releaseErr)
+	}
+	currentLock, _ = readProvisionLock(s3Svc, "my-bucket", "LockTest")
+	if currentLock != nil {
+		t.Fatalf("Failed to release provision lock")
+	}
+}
+
+func TestParallelServiceDecorators(t *testing.T) {
+	const subnetKey WorkflowHookContextKey = "test.subnetID"
+	var activeMutex sync.Mutex
+	activeDecorators := 0
+	maxActiveDecorators := 0
+
+	resourceDecorator := func(resourceName string, requiresSubnet bool) ServiceDecoratorHookHandler {
+		return ServiceDecoratorHookFunc(func(context *WorkflowHookContext,
+			serviceName string,
+			template *gocf.Template,
+			S3Bucket string,
+			S3Key string,
+			buildID string,
+			awsSession *session.Session,
+			noop bool,
+			logger *logrus.Logger) error {
+			activeMutex.Lock()
+			activeDecorators++
+			if activeDecorators > maxActiveDecorators {
+				maxActiveDecorators = activeDecorators
+			}
+			activeMutex.Unlock()
+			defer func() {
+				activeMutex.Lock()
+				activeDecorators--
+				activeMutex.Unlock()
+			}()
+			// Simulate an AWS lookup
+			time.Sleep(50 * time.Millisecond)
+			if requiresSubnet {
+				if _, subnetExists := context.GetString(subnetKey); !subnetExists {
+					return fmt.Errorf("%s called before its dependency", resourceName)
+				}
+			} else {
+				context.Set(subnetKey, "subnet-1234")
+			}
+			template.AddResource(resourceName, &gocf.SNSTopic{})
+			return nil
+		})
+	}
+	logger, _ := NewLogger("info")
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "ParallelDecorators",
+			workflowHooks: &WorkflowHooks{
+				ServiceDecorators: []ServiceDecoratorHookHandler{
+					&NamedServiceDecorator{
+						Name:      "Consumer",
+						DependsOn: []string{"Lookup"},
+						Decorator: resourceDecorator("ConsumerTopic", true),
+					},
+					&NamedServiceDecorator{
+						Name:      "Lookup",
+						Decorator: resourceDecorator("LookupTopic", false),
+					},
+					resourceDecorator("IndependentTopic1", false),
+					resourceDecorator("IndependentTopic2", false),
+				},
+				ServiceDecoratorConcurrency: 4,
+			},
+		},
+		context: provisionContext{
+			cfTemplate:           gocf.NewTemplate(),
+			workflowHooksContext: NewWorkflowHookContext(nil),
+		},
+	}
+	decorateErr := callServiceDecoratorHook(ctx)
+	if decorateErr != nil {
+		t.Fatalf("Failed to call ServiceDecorators: %s", decorateErr)
+	}
+	if len(ctx.context.cfTemplate.Resources) != 4 {
+		t.Fatalf("Failed to merge decorator templates: %d resources", len(ctx.context.cfTemplate.Resources))
+	}
+	if maxActiveDecorators < 2 {
+		t.Fatalf("ServiceDecorators weren't called concurrently")
+	}
+
+	// Cycles are rejected
+	ctx.userdata.workflowHooks.ServiceDecorators[1].(*NamedServiceDecorator).DependsOn = []string{"Consumer"}
+	decorateErr = callServiceDecoratorHook(ctx)
+	if decorateErr == nil {
+		t.Fatalf("Failed to reject circular ServiceDecorator dependencies")
+	}
+}
+
+// TestParallelServiceDecoratorTemplate runs with -race to verify that the
+// decorators in the same layer don't race on the shared template
+func TestParallelServiceDecoratorTemplate(t *testing.T) {
+	var activeMutex sync.Mutex
+	activeDecorators := 0
+	maxActiveDecorators := 0
+	templateHolders := 0
+	maxTemplateHolders := 0
+
+	templateDecorator := func(resourceName string) ServiceDecoratorHookHandler {
+		return ServiceDecoratorHookFunc(func(context *WorkflowHookContext,
+			serviceName string,
+			template *gocf.Template,
+			S3Bucket string,
+			S3Key string,
+			buildID string,
+			awsSession *session.Session,
+			noop bool,
+			logger *logrus.Logger) error {
+			activeMutex.Lock()
+			activeDecorators++
+			if activeDecorators > maxActiveDecorators {
+				maxActiveDecorators = activeDecorators
+			}
+			activeMutex.Unlock()
+			// Simulate an AWS lookup
+			time.Sleep(50 * time.Millisecond)
+
+			serviceTemplate := context.Template()
+			activeMutex.Lock()
+			templateHolders++
+			if templateHolders > maxTemplateHolders {
+				maxTemplateHolders = templateHolders
+			}
+			activeMutex.Unlock()
+			defer func() {
+				activeMutex.Lock()
+				templateHolders--
+				activeDecorators--
+				activeMutex.Unlock()
+			}()
+			// Read and update the shared template
+			for eachResourceName := range serviceTemplate.Resources {
+				if eachResourceName == resourceName {
+					return fmt.Errorf("Duplicate resource: %s", resourceName)
+				}
+			}
+			serviceTemplate.AddResource(resourceName+"Shared", &gocf.SNSTopic{})
+			time.Sleep(10 * time.Millisecond)
+			template.AddResource(resourceName, &gocf.SNSTopic{})
+			return nil
+		})
+	}
+	logger, _ := NewLogger("info")
+	cfTemplate := gocf.NewTemplate()
+	hookContext := NewWorkflowHookContext(nil)
+	hookContext.Set(WorkflowHookContextKeyTemplate, cfTemplate)
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "ParallelDecoratorTemplate",
+			workflowHooks: &WorkflowHooks{
+				ServiceDecorators: []ServiceDecoratorHookHandler{
+					templateDecorator("Topic1"),
+					templateDecorator("Topic2"),
+				},
+				ServiceDecoratorConcurrency: 2,
+			},
+		},
+		context: provisionContext{
+			cfTemplate:           cfTemplate,
+			workflowHooksContext: hookContext,
+		},
+	}
+	decorateErr := callServiceDecoratorHook(ctx)
+	if decorateErr != nil {
+		t.Fatalf("Failed to call ServiceDecorators: %s", decorateErr)
+	}
+	if maxActiveDecorators != 2 {
+		t.Fatalf("ServiceDecorators weren't called concurrently")
+	}
+	if maxTemplateHolders != 1 {
+		t.Fatalf("ServiceDecorators accessed the template concurrently: %d", maxTemplateHolders)
+	}
+	if len(cfTemplate.Resources) != 4 {
+		t.Fatalf("Unexpected template resources: %d", len(cfTemplate.Resources))
+	}
+}
+
+type mockBucketVersioningS3 struct {
+	s3iface.S3API
+	versioningRequests int
+}
+
+func (mockS3 *mockBucketVersioningS3) GetBucketVersioning(input *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
+	mockS3.versioningRequests++
+	return &s3.GetBucketVersioningOutput{
+		Status: aws.String(s3.BucketVersioningStatusEnabled),
+	}, nil
+}
+
+func TestAWSClients(t *testing.T) {
+	logger, _ := NewLogger("info")
+	mockS3 := &mockBucketVersioningS3{}
+	clients := newAWSClients(spartaAWS.NewLocalstackSession("", logger),
+		&AWSClients{S3: mockS3})
+	if clients.S3 != mockS3 {
+		t.Fatalf("Failed to use injected S3 client")
+	}
+	if clients.IAM == nil || clients.CloudFormation == nil || clients.Lambda == nil {
+		t.Fatalf("Failed to create default AWS clients")
+	}
+	isEnabled, isEnabledErr := spartaS3.BucketVersioningEnabledWithClient(clients.S3, "my-bucket", logger)
+	if isEnabledErr != nil || !isEnabled || mockS3.versioningRequests != 1 {
+		t.Fatalf("Failed to call injected S3 client: %v", isEnabledErr)
+	}
+}
+
+func TestLocalstackUpload(t *testing.T) {
+	// Localstack uses path-style S3 URLs
+	var objectsMutex sync.Mutex
+	objects := make(map[string][]byte)
+	s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objectsMutex.Lock()
+		defer objectsMutex.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer s3Server.Close()
+
+	artifactFile, artifactFileErr := ioutil.TempFile("", "localstack*.zip")
+	if artifactFileErr != nil {
+		t.Fatalf("Failed to create artifact: %s", artifactFileErr)
+	}
+	defer os.Remove(artifactFile.Name())
+	artifactFile.WriteString("artifact")
+	artifactFile.Close()
+
+	logger, _ := NewLogger("info")
+	awsSession := spartaAWS.NewLocalstackSession(s3Server.URL, logger)
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "LocalstackUpload",
+			s3Bucket:    "my-bucket",
+		},
+		context: provisionContext{
+			awsSession: awsSession,
+			awsClients: newAWSClients(awsSession, nil),
+		},
+	}
+	ctx.context.artifactStore = &S3ArtifactStore{S3: ctx.context.awsClients.S3}
+	s3URL, s3URLErr := uploadLocalFileToS3(artifactFile.Name(), "LocalstackUpload/code.zip", ctx)
+	if s3URLErr != nil {
+		t.Fatalf("Failed to upload artifact: %s", s3URLErr)
+	}
+	if _, exists := objects["/my-bucket/LocalstackUpload/code.zip"]; !exists {
+		t.Fatalf("Failed to upload artifact with path-style URL: %s", s3URL)
+	}
+	artifactKey := newS3UploadURL(ctx.userdata.s3Bucket, s3URL).keyName()
+	if artifactKey != "LocalstackUpload/code.zip" {
+		t.Fatalf("Unexpected artifact key: %s", artifactKey)
+	}
+	for _, eachRollback := range ctx.transaction.rollbackFunctions {
+		eachRollback(logger)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("Failed to delete artifact during rollback")
+	}
+}
+
+func TestOfflineIAMRoles(t *testing.T) {
+	logger, _ := NewLogger("info")
+	lambdaFn, _ := NewAWSLambda("OfflineIAMRoles",
+		mockLambda1,
+		"ExistingRole")
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			noop:           true,
+			offline:        true,
+			serviceName:    "OfflineIAMRoles",
+			lambdaAWSInfos: []*LambdaAWSInfo{lambdaFn},
+		},
+		context: provisionContext{
+			cfTemplate: gocf.NewTemplate(),
+			awsClients: &AWSClients{},
+		},
+	}
+	_, verifyErr := verifyIAMRoles(ctx)
+	if verifyErr != nil {
+		t.Fatalf("Failed to verify IAM roles offline: %s", verifyErr)
+	}
+	roleArn, roleArnExists := ctx.context.lambdaIAMRoleNameMap["ExistingRole"]
+	if !roleArnExists {
+		t.Fatalf("Failed to create placeholder Arn for existing IAM role")
+	}
+	roleArnJSON, _ := json.Marshal(roleArn)
+	if !strings.Contains(string(roleArnJSON), ":role/ExistingRole") {
+		t.Fatalf("Unexpected placeholder Arn: %s", string(roleArnJSON))
+	}
+}
+
+func TestSharedIAMRoleStatements(t *testing.T) {
+	logger, _ := NewLogger("info")
+	clusterArn := "arn:aws:kafka:us-west-2:123456789012:cluster/SharedRole/abc"
+	secretArn := "arn:aws:secretsmanager:us-west-2:123456789012:secret:SharedRole"
+	lambdaFn1, _ := NewAWSLambda("SharedIAMRole1",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn1.EventSourceMappings = []*EventSourceMapping{
+		{
+			EventSourceArn: clusterArn,
+			Topics:         []string{"orders"},
+		},
+	}
+	lambdaFn2, _ := NewAWSLambda("SharedIAMRole2",
+		mockLambda2,
+		IAMRoleDefinition{})
+	// Share the role
+	lambdaFn2.RoleDefinition = lambdaFn1.RoleDefinition
+	lambdaFn2.EventSourceMappings = []*EventSourceMapping{
+		{
+			Topics: []string{"payments"},
+			SelfManagedKafka: &SelfManagedKafkaEventSource{
+				KafkaBootstrapServers: []string{"kafka.example.com:9092"},
+			},
+			SourceAccessConfigurations: []*SourceAccessConfiguration{
+				{
+					Type: SourceAccessTypeSASLSCRAM512Auth,
+					URI:  secretArn,
+				},
+			},
+		},
+	}
+	lambdaFn2.Options.SQSResources = []*SQSResource{
+		{Name: "SharedRoleQueue"},
+	}
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			noop:           true,
+			offline:        true,
+			serviceName:    "SharedIAMRole",
+			lambdaAWSInfos: []*LambdaAWSInfo{lambdaFn1, lambdaFn2},
+		},
+		context: provisionContext{
+			cfTemplate: gocf.NewTemplate(),
+			awsClients: &AWSClients{},
+		},
+	}
+	_, verifyErr := verifyIAMRoles(ctx)
+	if verifyErr != nil {
+		t.Fatalf("Failed to verify IAM roles: %s", verifyErr)
+	}
+	if len(ctx.context.lambdaIAMRoleNameMap) != 1 {
+		t.Fatalf("Failed to share IAM role: %#v", ctx.context.lambdaIAMRoleNameMap)
+	}
+	roleName := lambdaFn1.RoleDefinition.logicalName("SharedIAMRole",
+		lambdaFn1.lambdaFunctionName())
+	iamRole, iamRoleOk := templateIAMRole(ctx.context.cfTemplate.Resources[roleName])
+	if !iamRoleOk {
+		t.Fatalf("Failed to find shared IAM role: %s", roleName)
+	}
+	statements := (*iamRole.Policies)[0].PolicyDocument.(ArbitraryJSONObject)["Statement"].([]spartaIAM.PolicyStatement)
+	statementResources := func(action string) []string {
+		resources := []string{}
+		for _, eachStatement := range statements {
+			for _, eachAction := range eachStatement.Action {
+				if eachAction == action {
+					resourceJSON, _ := json.Marshal(eachStatement.Resource)
+					resources = append(resources, string(resourceJSON))
+				}
+			}
+		}
+		return resources
+	}
+	// Both functions' mappings and options are included
+	if resources := statementResources("kafka:DescribeCluster"); len(resources) != 1 ||
+		!strings.Contains(resources[0], clusterArn) {
+		t.Fatalf("Failed to include the first function's MSK privileges: %v", resources)
+	}
+	if resources := statementResources("secretsmanager:GetSecretValue"); len(resources) != 1 ||
+		!strings.Contains(resources[0], secretArn) {
+		t.Fatalf("Failed to include the second function's Kafka secret privileges: %v", resources)
+	}
+	if resources := statementResources("sqs:ReceiveMessage"); len(resources) != 1 ||
+		!strings.Contains(resources[0], lambdaFn2.Options.SQSResources[0].LogicalResourceName()) {
+		t.Fatalf("Failed to include the second function's queue privileges: %v", resources)
+	}
+	// Shared statements aren't duplicated
+	if resources := statementResources("logs:CreateLogGroup"); len(resources) != 1 {
+		t.Fatalf("Failed to deduplicate shared role statements: %v", resources)
+	}
+}
+
+type recordingArtifactStore struct {
+	uploads map[string]string
+}
+
+func (store *recordingArtifactStore) Upload(localPath string,
+	s3Bucket string,
+	keyName string,
+	progress spartaS3.UploadProgressFunc,
+	logger *logrus.Logger) (string, error) {
+	artifactURL := fmt.Sprintf("https://%s.s3.amazonaws.com/%s?versionId=v1", s3Bucket, keyName)
+	store.uploads[artifactURL] = localPath
+	return artifactURL, nil
+}
+
+func (store *recordingArtifactStore) Delete(s3Bucket string,
+	artifactURL string,
+	logger *logrus.Logger) error {
+	delete(store.uploads, artifactURL)
+	return nil
+}
+
+func TestArtifactStore(t *testing.T) {
+	logger, _ := NewLogger("info")
+	store := &recordingArtifactStore{
+		uploads: make(map[string]string),
+	}
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "ArtifactStore",
+			s3Bucket:    "my-bucket",
+		},
+		context: provisionContext{
+			artifactStore: store,
+		},
+	}
+	s3URL, s3URLErr := uploadLocalFileToS3("code.zip", "ArtifactStore/code.zip", ctx)
+	if s3URLErr != nil {
+		t.Fatalf("Failed to upload artifact: %s", s3URLErr)
+	}
+	if store.uploads[s3URL] != "code.zip" {
+		t.Fatalf("Failed to upload artifact with ArtifactStore: %s", s3URL)
+	}
+	uploadURL := newS3UploadURL(ctx.userdata.s3Bucket, s3URL)
+	if uploadURL.keyName() != "ArtifactStore/code.zip" || uploadURL.version != "v1" {
+		t.Fatalf("Unexpected artifact URL: %s", s3URL)
+	}
+	for _, eachRollback := range ctx.transaction.rollbackFunctions {
+		eachRollback(logger)
+	}
+	if len(store.uploads) != 0 {
+		t.Fatalf("Failed to delete artifact with ArtifactStore during rollback")
+	}
+}
+
+type mockInPlaceLambda struct {
+	lambdaiface.LambdaAPI
+	deployedEnvironment map[string]*string
+}
+
+func (mockLambda *mockInPlaceLambda) GetFunctionConfiguration(input *lambda.GetFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	return &lambda.FunctionConfiguration{
+		FunctionName: input.FunctionName,
+		Environment: &lambda.EnvironmentResponse{
+			Variables: mockLambda.deployedEnvironment,
+		},
+	}, nil
+}
+
+func TestInPlaceFunctionConfiguration(t *testing.T) {
+	propertyDetail := func(attribute string, name string) *cloudformation.ResourceChangeDetail {
+		return &cloudformation.ResourceChangeDetail{
+			Target: &cloudformation.ResourceTargetDefinition{
+				Attribute: aws.String(attribute),
+				Name:      aws.String(name),
+			},
+		}
+	}
+	resourceChange := &cloudformation.ResourceChange{
+		LogicalResourceId:  aws.String("MyFunction"),
+		PhysicalResourceId: aws.String("MyService-MyFunction-1234"),
+		Details: []*cloudformation.ResourceChangeDetail{
+			propertyDetail(cloudformation.ResourceAttributeProperties, "Code"),
+			propertyDetail(cloudformation.ResourceAttributeProperties, "Environment"),
+			propertyDetail(cloudformation.ResourceAttributeProperties, "Environment"),
+			propertyDetail(cloudformation.ResourceAttributeProperties, "MemorySize"),
+			propertyDetail(cloudformation.ResourceAttributeMetadata, ""),
+		},
+	}
+	functionChange, unsupportedChanges := newInPlaceFunctionChange(resourceChange)
+	if len(unsupportedChanges) != 0 ||
+		!functionChange.codeChanged ||
+		len(functionChange.configurationProperties) != 2 {
+		t.Fatalf("Unexpected in-place change: %#v (%v)", functionChange, unsupportedChanges)
+	}
+
+	template := gocf.NewTemplate()
+	template.AddResource("MyFunction", lambdaFunction{
+		LambdaFunction: gocf.LambdaFunction{
+			MemorySize: gocf.Integer(512),
+			Environment: &gocf.LambdaFunctionEnvironment{
+				Variables: map[string]interface{}{
+					"STAGE":          gocf.String("prod"),
+					"DISCOVERY_INFO": gocf.Join("", gocf.Ref("AWS::StackName")),
+				},
+			},
+		},
+	})
+	mockLambda := &mockInPlaceLambda{
+		deployedEnvironment: map[string]*string{
+			"STAGE":          aws.String("test"),
+			"DISCOVERY_INFO": aws.String("deployed"),
+		},
+	}
+	updateRequest, updateRequestErr := inPlaceFunctionConfiguration(functionChange, template, mockLambda)
+	if updateRequestErr != nil {
+		t.Fatalf("Failed to create configuration update: %s", updateRequestErr)
+	}
+	if aws.Int64Value(updateRequest.MemorySize) != 512 ||
+		updateRequest.Timeout != nil ||
+		aws.StringValue(updateRequest.Environment.Variables["STAGE"]) != "prod" ||
+		aws.StringValue(updateRequest.Environment.Variables["DISCOVERY_INFO"]) != "deployed" {
+		t.Fatalf("Unexpected configuration update: %s", updateRequest.String())
+	}
+
+	// Non-literal values that aren't deployed can't be applied in-place
+	delete(mockLambda.deployedEnvironment, "DISCOVERY_INFO")
+	_, updateRequestErr = inPlaceFunctionConfiguration(functionChange, template, mockLambda)
+	if updateRequestErr == nil {
+		t.Fatalf("Failed to reject non-literal environment variable")
+	}
+
+	// Other property changes require CloudFormation
+	resourceChange.Details = append(resourceChange.Details,
+		propertyDetail(cloudformation.ResourceAttributeProperties, "Role"))
+	_, unsupportedChanges = newInPlaceFunctionChange(resourceChange)
+	if len(unsupportedChanges) != 1 || unsupportedChanges[0] != "Properties.Role" {
+		t.Fatalf("Unexpected unsupported changes: %v", unsupportedChanges)
+	}
+}
+
+// mockUpdateStatusLambda returns the next LastUpdateStatus for each
+// FunctionUpdateStatus request and records the update requests
+type mockUpdateStatusLambda struct {
+	lambdaiface.LambdaAPI
+	statuses []string
+	calls    []string
+}
+
+func (mockLambda *mockUpdateStatusLambda) FunctionUpdateStatus(functionName string) (*lambdaUpdateStatus, error) {
+	status := "Successful"
+	if len(mockLambda.statuses) != 0 {
+		status = mockLambda.statuses[0]
+		mockLambda.statuses = mockLambda.statuses[1:]
+	}
+	mockLambda.calls = append(mockLambda.calls, "GetFunctionConfiguration:"+status)
+	return &lambdaUpdateStatus{
+		LastUpdateStatus:       status,
+		LastUpdateStatusReason: "reason",
+	}, nil
+}
+
+func (mockLambda *mockUpdateStatusLambda) UpdateFunctionConfiguration(input *lambda.UpdateFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	mockLambda.calls = append(mockLambda.calls, "UpdateFunctionConfiguration")
+	return &lambda.FunctionConfiguration{}, nil
+}
+
+func (mockLambda *mockUpdateStatusLambda) UpdateFunctionCode(input *lambda.UpdateFunctionCodeInput) (*lambda.FunctionConfiguration, error) {
+	mockLambda.calls = append(mockLambda.calls, "UpdateFunctionCode")
+	return &lambda.FunctionConfiguration{}, nil
+}
+
+func TestWaitForFunctionUpdate(t *testing.T) {
+	defaultInterval := lambdaUpdateStatusPollInterval
+	lambdaUpdateStatusPollInterval = time.Millisecond
+	defer func() {
+		lambdaUpdateStatusPollInterval = defaultInterval
+	}()
+
+	// The code update waits for the configuration update
+	mockLambda := &mockUpdateStatusLambda{
+		statuses: []string{"InProgress", "InProgress", "Successful"},
+	}
+	result := inPlaceUpdateTask(mockLambda,
+		&lambda.UpdateFunctionConfigurationInput{FunctionName: aws.String("MyFunction")},
+		&lambda.UpdateFunctionCodeInput{FunctionName: aws.String("MyFunction")})()
+	if result.Error() != nil {
+		t.Fatalf("Failed to apply in-place update: %s", result.Error())
+	}
+	expectedCalls := []string{"UpdateFunctionConfiguration",
+		"GetFunctionConfiguration:InProgress",
+		"GetFunctionConfiguration:InProgress",
+		"GetFunctionConfiguration:Successful",
+		"UpdateFunctionCode",
+		"GetFunctionConfiguration:Successful"}
+	if !reflect.DeepEqual(mockLambda.calls, expectedCalls) {
+		t.Fatalf("Unexpected in-place update calls: %v", mockLambda.calls)
+	}
+
+	failedLambda := &mockUpdateStatusLambda{
+		statuses: []string{"InProgress", "Failed"},
+	}
+	if waitForFunctionUpdate(failedLambda, "MyFunction", time.Minute) == nil {
+		t.Fatalf("Failed to report failed function update")
+	}
+	inProgressLambda := &mockUpdateStatusLambda{
+		statuses: []string{"InProgress", "InProgress", "InProgress"},
+	}
+	if waitForFunctionUpdate(inProgressLambda, "MyFunction", 0) == nil {
+		t.Fatalf("Failed to time out waiting for function update")
+	}
+}
+
+func TestLambdaConfigurationStatusReader(t *testing.T) {
+	statusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/functions/MyFunction/configuration") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"FunctionName":"MyFunction","LastUpdateStatus":"Failed","LastUpdateStatusReason":"reason"}`)
+	}))
+	defer statusServer.Close()
+
+	awsSession := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(statusServer.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	statusReader := newLambdaUpdateStatusReader(lambda.New(awsSession))
+	updateStatus, updateStatusErr := statusReader.FunctionUpdateStatus("MyFunction")
+	if updateStatusErr != nil {
+		t.Fatalf("Failed to read function update status: %s", updateStatusErr)
+	}
+	if updateStatus.LastUpdateStatus != "Failed" ||
+		updateStatus.LastUpdateStatusReason != "reason" {
+		t.Fatalf("Unexpected function update status: %#v", updateStatus)
+	}
+}
+
+func TestRevertInPlaceChanges(t *testing.T) {
+	previousTemplate := map[string]interface{}{
+		"Resources": map[string]interface{}{
+			"MyFunction": map[string]interface{}{
+				"Type": "AWS::Lambda::Function",
+				"Properties": map[string]interface{}{
+					"Code": map[string]interface{}{
+						"S3Bucket":        "my-bucket",
+						"S3Key":           "MyService/code.zip",
+						"S3ObjectVersion": "v1",
+					},
+					"MemorySize": 128,
+				},
+			},
+			"MyCustomResource": map[string]interface{}{
+				"Type": "Custom::Unregistered",
+			},
+		},
+	}
+	templateBody, _ := json.Marshal(previousTemplate)
+	snapshot := &deploymentSnapshot{
+		templateBody: string(templateBody),
+		inPlaceChanges: []*inPlaceFunctionChange{
+			{
+				logicalResourceID:       "MyFunction",
+				functionName:            "MyService-MyFunction",
+				codeChanged:             true,
+				configurationProperties: []string{"MemorySize"},
+			},
+		},
+	}
+	lambdaFunction, lambdaFunctionErr := snapshot.templateFunction("MyFunction")
+	if lambdaFunctionErr != nil {
+		t.Fatalf("Failed to read previous function: %s", lambdaFunctionErr)
+	}
+	if lambdaFunction.MemorySize.Literal != 128 ||
+		lambdaFunction.Code.S3ObjectVersion.Literal != "v1" {
+		t.Fatalf("Unexpected previous function: %#v", lambdaFunction)
+	}
+	logger, _ := NewLogger("info")
+	mockLambda := &mockUpdateStatusLambda{}
+	revertErr := snapshot.revertInPlaceChanges(mockLambda, logger)
+	if revertErr != nil {
+		t.Fatalf("Failed to revert in-place changes: %s", revertErr)
+	}
+	expectedCalls := []string{"UpdateFunctionConfiguration",
+		"GetFunctionConfiguration:Successful",
+		"UpdateFunctionCode",
+		"GetFunctionConfiguration:Successful"}
+	if !reflect.DeepEqual(mockLambda.calls, expectedCalls) {
+		t.Fatalf("Unexpected in-place revert calls: %v", mockLambda.calls)
+	}
+	snapshot.inPlaceChanges[0].logicalResourceID = "MissingFunction"
+	if snapshot.revertInPlaceChanges(mockLambda, logger) == nil {
+		t.Fatalf("Failed to reject missing previous function")
+	}
+}
+
+type mockDevLambda struct {
+	lambdaiface.LambdaAPI
+	updatedFunctions sync.Map
+}
+
+func (mockLambda *mockDevLambda) UpdateFunctionCode(input *lambda.UpdateFunctionCodeInput) (*lambda.FunctionConfiguration, error) {
+	mockLambda.updatedFunctions.Store(aws.StringValue(input.FunctionName), len(input.ZipFile))
+	return &lambda.FunctionConfiguration{
+		FunctionName: input.FunctionName,
+		CodeSha256:   aws.String("sha"),
+	}, nil
+}
+
+func TestWriteCodeArchive(t *testing.T) {
+	binaryDir, binaryDirErr := ioutil.TempDir("", "sparta-archive")
+	if binaryDirErr != nil {
+		t.Fatalf("Failed to create temp directory: %s", binaryDirErr)
+	}
+	defer os.RemoveAll(binaryDir)
+	binaryName := filepath.Join(binaryDir, SpartaBinaryName)
+	writeErr := ioutil.WriteFile(binaryName, []byte("binary"), 0755)
+	if writeErr != nil {
+		t.Fatalf("Failed to write binary: %s", writeErr)
+	}
+	archiveHook := ArchiveHookFunc(func(context *WorkflowHookContext,
+		serviceName string,
+		zipWriter *zip.Writer,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+		extraFile, extraFileErr := zipWriter.Create("extra.txt")
+		if extraFileErr != nil {
+			return extraFileErr
+		}
+		_, extraFileErr = extraFile.Write([]byte(serviceName))
+		return extraFileErr
+	})
+	logger, _ := NewLogger("info")
+	ctx := &workflowContext{
+		logger: logger,
+		userdata: userdata{
+			serviceName: "ArchiveService",
+			workflowHooks: &WorkflowHooks{
+				Archives: []ArchiveHookHandler{archiveHook},
+			},
+		},
+		context: provisionContext{
+			binaryName:           binaryName,
+			workflowHooksContext: NewWorkflowHookContext(nil),
+		},
+	}
+	var archive bytes.Buffer
+	lambdaArchive := zip.NewWriter(&archive)
+	archiveErr := writeCodeArchive(lambdaArchive, ctx)
+	if archiveErr != nil {
+		t.Fatalf("Failed to write code archive: %s", archiveErr)
+	}
+	lambdaArchive.Close()
+	archiveReader, archiveReaderErr := zip.NewReader(bytes.NewReader(archive.Bytes()),
+		int64(archive.Len()))
+	if archiveReaderErr != nil {
+		t.Fatalf("Failed to read code archive: %s", archiveReaderErr)
+	}
+	archiveFiles := []string{}
+	for _, eachFile := range archiveReader.File {
+		archiveFiles = append(archiveFiles, eachFile.Name)
+	}
+	sort.Strings(archiveFiles)
+	if !reflect.DeepEqual(archiveFiles, []string{binaryName, "extra.txt"}) {
+		t.Fatalf("Unexpected code archive files: %v", archiveFiles)
+	}
+}
+
+func TestDevFunctionTargets(t *testing.T) {
+	lambdaFn1, _ := NewAWSLambda("DevFunction1", mockLambda1, IAMRoleDefinition{})
+	lambdaFn2, _ := NewAWSLambda("DevFunction2", mockLambda1, IAMRoleDefinition{})
+	lambdaAWSInfos := []*LambdaAWSInfo{lambdaFn1, lambdaFn2}
+	provisionedFunctions := map[string]string{
+		"MyService-Function1-1234": lambdaFn1.LogicalResourceName(),
+		"MyService-Function2-5678": lambdaFn2.LogicalResourceName(),
+	}
+	targets, targetsErr := devFunctionTargets(nil, lambdaAWSInfos, provisionedFunctions)
+	if targetsErr != nil || len(targets) != 2 {
+		t.Fatalf("Unexpected targets: %v (%v)", targets, targetsErr)
+	}
+	targets, targetsErr = devFunctionTargets([]string{"DevFunction2"}, lambdaAWSInfos, provisionedFunctions)
+	if targetsErr != nil ||
+		len(targets) != 1 ||
+		targets[0].functionName != "MyService-Function2-5678" {
+		t.Fatalf("Unexpected targets: %v (%v)", targets, targetsErr)
+	}
+	_, targetsErr = devFunctionTargets([]string{"Unknown"}, lambdaAWSInfos, provisionedFunctions)
+	if targetsErr == nil {
+		t.Fatalf("Failed to reject unknown function")
+	}
+	delete(provisionedFunctions, "MyService-Function1-1234")
+	_, targetsErr = devFunctionTargets([]string{lambdaFn1.LogicalResourceName()}, lambdaAWSInfos, provisionedFunctions)
+	if targetsErr == nil {
+		t.Fatalf("Failed to reject unprovisioned function")
+	}
+
+	mockLambda := &mockDevLambda{}
+	updateErr := devUpdateFunctionCode(targets, []byte("code"), mockLambda, logrus.New())
+	if updateErr != nil {
+		t.Fatalf("Failed to update function code: %s", updateErr)
+	}
+	codeSize, codeSizeOk := mockLambda.updatedFunctions.Load("MyService-Function2-5678")
+	if !codeSizeOk || codeSize.(int) != 4 {
+		t.Fatalf("Function code wasn't updated: %v", codeSize)
+	}
+}
+
+func TestDevSourceChanges(t *testing.T) {
+	rootDir, rootDirErr := ioutil.TempDir("", "sparta-dev")
+	if rootDirErr != nil {
+		t.Fatalf("Failed to create temp dir: %s", rootDirErr)
+	}
+	defer os.RemoveAll(rootDir)
+	writeFile := func(relativePath string, contents string) {
+		filePath := filepath.Join(rootDir, relativePath)
+		mkdirErr := os.MkdirAll(filepath.Dir(filePath), 0755)
+		if mkdirErr == nil {
+			mkdirErr = ioutil.WriteFile(filePath, []byte(contents), 0644)
+		}
+		if mkdirErr != nil {
+			t.Fatalf("Failed to write file: %s", mkdirErr)
+		}
+	}
+	writeFile("main.go", "package main")
+	writeFile("go.mod", "module example")
+	writeFile("README.md", "readme")
+	writeFile(".sparta/generated.go", "package main")
+	writeFile("vendor/dep/dep.go", "package dep")
+	snapshot, snapshotErr := devSourceSnapshot(rootDir)
+	if snapshotErr != nil || len(snapshot) != 2 {
+		t.Fatalf("Unexpected snapshot: %v (%v)", snapshot, snapshotErr)
+	}
+
+	writeFile("handler/handler.go", "package handler")
+	mainPath := filepath.Join(rootDir, "main.go")
+	chtimesErr := os.Chtimes(mainPath, time.Now(), time.Now().Add(time.Minute))
+	if chtimesErr != nil {
+		t.Fatalf("Failed to update mod time: %s", chtimesErr)
+	}
+	os.Remove(filepath.Join(rootDir, "go.mod"))
+	currentSnapshot, _ := devSourceSnapshot(rootDir)
+	changes := devSourceChanges(snapshot, currentSnapshot)
+	if len(changes) != 3 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	if len(devSourceChanges(currentSnapshot, currentSnapshot)) != 0 {
+		t.Fatalf("Unexpected changes for identical snapshots")
+	}
+}
+
+func TestDevArchiveHash(t *testing.T) {
+	type archiveEntry struct {
+		name     string
+		contents string
+	}
+	archiveHash := func(modified time.Time, entries ...archiveEntry) string {
+		var archive bytes.Buffer
+		zipWriter := zip.NewWriter(&archive)
+		for _, eachEntry := range entries {
+			entryWriter, entryWriterErr := zipWriter.CreateHeader(&zip.FileHeader{
+				Name:     eachEntry.name,
+				Method:   zip.Deflate,
+				Modified: modified,
+			})
+			if entryWriterErr != nil {
+				t.Fatalf("Failed to create archive entry: %s", entryWriterErr)
+			}
+			_, writeErr := entryWriter.Write([]byte(eachEntry.contents))
+			if writeErr != nil {
+				t.Fatalf("Failed to write archive entry: %s", writeErr)
+			}
+		}
+		closeErr := zipWriter.Close()
+		if closeErr != nil {
+			t.Fatalf("Failed to close archive: %s", closeErr)
+		}
+		hash, hashErr := devArchiveHash(archive.Bytes())
+		if hashErr != nil {
+			t.Fatalf("Failed to hash archive: %s", hashErr)
+		}
+		return hash
+	}
+	binary := archiveEntry{name: SpartaBinaryName, contents: "binary"}
+	asset := archiveEntry{name: "resources/index.html", contents: "<html/>"}
+	deployedHash := archiveHash(time.Now(), binary, asset)
+
+	// Rebuilds of the same inputs only differ in the entry timestamps
+	if archiveHash(time.Now().Add(time.Hour), asset, binary) != deployedHash {
+		t.Fatalf("Archive hash includes the entry timestamps or order")
+	}
+	// Archive hook files are included even if the binary is unchanged
+	changedAsset := archiveEntry{name: asset.name, contents: "<html>updated</html>"}
+	if archiveHash(time.Now(), binary, changedAsset) == deployedHash {
+		t.Fatalf("Failed to detect changed archive hook file")
+	}
+	addedAsset := archiveEntry{name: "resources/app.js", contents: ""}
+	if archiveHash(time.Now(), binary, asset, addedAsset) == deployedHash {
+		t.Fatalf("Failed to detect added archive hook file")
+	}
+	if _, hashErr := devArchiveHash([]byte("not an archive")); hashErr == nil {
+		t.Fatalf("Failed to reject invalid archive")
+	}
+}
+
+func TestLocalInvoke(t *testing.T) {
+	type mockEvent struct {
+		Name string `json:"name"`
+	}
+	type mockResponse struct {
+		Greeting string `json:"greeting"`
+		HasArn   bool   `json:"hasArn"`
+	}
+	lambdaFn, _ := NewAWSLambda("LocalInvoke",
+		func(ctx context.Context, event mockEvent) (*mockResponse, error) {
+			if event.Name == "" {
+				return nil, fmt.Errorf("name is required")
+			}
+			lambdaContext, _ := awsLambdaContext.FromContext(ctx)
+			return &mockResponse{
+				Greeting: fmt.Sprintf("Hello %s", event.Name),
+				HasArn:   lambdaContext != nil && lambdaContext.InvokedFunctionArn != "",
+			}, nil
+		},
+		IAMRoleDefinition{})
+	eventFile, eventFileErr := ioutil.TempFile("", "event")
+	if eventFileErr != nil {
+		t.Fatalf("Failed to create event file: %s", eventFileErr)
+	}
+	defer os.Remove(eventFile.Name())
+	eventFile.WriteString(`{"name":"Sparta"}`)
+	eventFile.Close()
+
+	var output bytes.Buffer
+	invokeErr := LocalInvoke("LocalInvokeService",
+		[]*LambdaAWSInfo{lambdaFn},
+		&LocalInvokeOptions{
+			FunctionName: lambdaFn.LogicalResourceName(),
+			EventPath:    eventFile.Name(),
+			Output:       &output,
+		},
+		logrus.New())
+	if invokeErr != nil {
+		t.Fatalf("Failed to invoke function: %s", invokeErr)
+	}
+	var response mockResponse
+	unmarshalErr := json.Unmarshal(output.Bytes(), &response)
+	if unmarshalErr != nil ||
+		response.Greeting != "Hello Sparta" ||
+		!response.HasArn {
+		t.Fatalf("Unexpected response: %s (%v)", output.String(), unmarshalErr)
+	}
+	// The default event is empty, so the handler returns an error
+	invokeErr = LocalInvoke("LocalInvokeService",
+		[]*LambdaAWSInfo{lambdaFn},
+		&LocalInvokeOptions{
+			FunctionName: lambdaFn.LogicalResourceName(),
+			Output:       ioutil.Discard,
+		},
+		logrus.New())
+	if invokeErr == nil || !strings.Contains(invokeErr.Error(), "name is required") {
+		t.Fatalf("Expected handler error, got: %v", invokeErr)
+	}
+	_, unknownErr := localLambdaAWSInfo("Unknown", []*LambdaAWSInfo{lambdaFn})
+	if unknownErr == nil {
+		t.Fatalf("Expected error for unknown function")
+	}
+	for _, eachSource := range spartaAWSEvents.MockEventSources() {
+		msg, msgErr := localInvokeEvent("", eachSource)
+		if msgErr != nil || !json.Valid(msg) {
+			t.Fatalf("Failed to create mock %s event: %v", eachSource, msgErr)
+		}
+	}
+	_, bothErr := localInvokeEvent(eventFile.Name(), "s3")
+	if bothErr == nil {
+		t.Fatalf("Expected error for event file and event source")
+	}
+}
+
+func TestLocalStartAPI(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("LocalStartAPI",
+		func(ctx context.Context, event APIGatewayLambdaJSONEvent) (*spartaAPIGateway.Response, error) {
+			name := event.PathParams["name"]
+			if name == "missing" {
+				return nil, fmt.Errorf("NotFound: %s", name)
+			}
+			return spartaAPIGateway.NewResponse(http.StatusCreated,
+				map[string]interface{}{
+					"name":   name,
+					"method": event.Method,
+					"query":  event.QueryParams["q"],
+					"body":   event.Body,
+				},
+				map[string]string{"X-Local": "true"}), nil
+		},
+		IAMRoleDefinition{})
+	api := NewAPIGateway("LocalStartAPI", nil)
+	api.CORSEnabled = true
+	resource, _ := api.NewResource("/hello/{name}", lambdaFn)
+	getMethod, _ := resource.NewMethod("GET", http.StatusOK)
+	getMethod.NewIntegrationResponse(http.StatusNotFound, "NotFound.*")
+	resource.NewMethod("POST", http.StatusOK)
+	handler, handlerErr := newLocalAPIHandler("LocalStartAPIService", api, logrus.New())
+	if handlerErr != nil {
+		t.Fatalf("Failed to create handler: %s", handlerErr)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	request := func(method string, path string, body string) (*http.Response, map[string]interface{}) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, respErr := http.DefaultClient.Do(req)
+		if respErr != nil {
+			t.Fatalf("Failed to request %s %s: %s", method, path, respErr)
+		}
+		defer resp.Body.Close()
+		var respBody map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&respBody)
+		return resp, respBody
+	}
+	resp, respBody := request("GET", "/hello/sparta?q=search", "")
+	if resp.StatusCode != http.StatusCreated ||
+		resp.Header.Get("X-Local") != "true" ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "*" ||
+		respBody["name"] != "sparta" ||
+		respBody["query"] != "search" {
+		t.Fatalf("Unexpected GET response: %d %v %v", resp.StatusCode, resp.Header, respBody)
+	}
+	resp, respBody = request("POST", "/hello/sparta", `{"greeting":"hello"}`)
+	postBody, _ := respBody["body"].(map[string]interface{})
+	if resp.StatusCode != http.StatusCreated ||
+		respBody["method"] != "POST" ||
+		postBody["greeting"] != "hello" {
+		t.Fatalf("Unexpected POST response: %d %v", resp.StatusCode, respBody)
+	}
+	resp, _ = request("POST", "/hello/sparta", `{invalid`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Unexpected status for invalid JSON: %d", resp.StatusCode)
+	}
+	resp, respBody = request("GET", "/hello/missing", "")
+	if resp.StatusCode != http.StatusNotFound || respBody["errorMessage"] != "NotFound: missing" {
+		t.Fatalf("Unexpected error response: %d %v", resp.StatusCode, respBody)
+	}
+	resp, _ = request("DELETE", "/hello/sparta", "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Unexpected status for undefined method: %d", resp.StatusCode)
+	}
+	resp, _ = request("OPTIONS", "/hello/sparta", "")
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("Unexpected preflight response: %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+type mockPowerTuningCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+}
+
+func (mockCF *mockPowerTuningCloudFormation) DescribeStackResource(input *cloudformation.DescribeStackResourceInput) (*cloudformation.DescribeStackResourceOutput, error) {
+	return &cloudformation.DescribeStackResourceOutput{
+		StackResourceDetail: &cloudformation.StackResourceDetail{
+			LogicalResourceId:  input.LogicalResourceId,
+			PhysicalResourceId: aws.String("MyService-PowerTuning-1234"),
+		},
+	}, nil
+}
+
+// mockPowerTuningLambda is a function with a 50 ms downstream call and
+// compute time that halves as the memory size doubles. Each memory size
+// update is InProgress for one status request.
+type mockPowerTuningLambda struct {
+	*mockUpdateStatusLambda
+	memorySize          int64
+	invocations         int
+	invokedDuringUpdate bool
+}
+
+func (mockLambda *mockPowerTuningLambda) GetFunctionConfiguration(input *lambda.GetFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	return &lambda.FunctionConfiguration{
+		FunctionName: input.FunctionName,
+		MemorySize:   aws.Int64(mockLambda.memorySize),
+	}, nil
+}
+
+func (mockLambda *mockPowerTuningLambda) UpdateFunctionConfiguration(input *lambda.UpdateFunctionConfigurationInput) (*lambda.FunctionConfiguration, error) {
+	mockLambda.memorySize = aws.Int64Value(input.MemorySize)
+	mockLambda.statuses = append(mockLambda.statuses, "InProgress")
+	return &lambda.FunctionConfiguration{
+		FunctionName: input.FunctionName,
+		MemorySize:   input.MemorySize,
+	}, nil
+}
+
+func (mockLambda *mockPowerTuningLambda) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	mockLambda.invocations++
+	if len(mockLambda.statuses) != 0 {
+		mockLambda.invokedDuringUpdate = true
+	}
+	duration := 50 + 12800/float64(mockLambda.memorySize)
+	logTail := fmt.Sprintf("START RequestId: 1234\nREPORT RequestId: 1234\tDuration: %.2f ms\tBilled Duration: %.f ms\tMemory Size: %d MB\n",
+		duration,
+		duration,
+		mockLambda.memorySize)
+	return &lambda.InvokeOutput{
+		LogResult: aws.String(base64.StdEncoding.EncodeToString([]byte(logTail))),
+		Payload:   []byte(`"ok"`),
+	}, nil
+}
+
+func TestPowerTuning(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("PowerTuning", mockLambda1, IAMRoleDefinition{})
+	tuning := &PowerTuning{
+		Functions:   []*LambdaAWSInfo{lambdaFn},
+		Payload:     []byte(`{}`),
+		MemorySizes: []int64{128, 512, 1024, 2048},
+		Invocations: 2,
+	}
+	if validateErr := tuning.validate(); validateErr != nil {
+		t.Fatalf("Failed to validate PowerTuning: %s", validateErr)
+	}
+	invalidTuning := &PowerTuning{
+		Functions:   tuning.Functions,
+		MemorySizes: []int64{64},
+	}
+	if invalidTuning.validate() == nil {
+		t.Fatalf("Failed to reject invalid MemorySizes")
+	}
+
+	defaultInterval := lambdaUpdateStatusPollInterval
+	lambdaUpdateStatusPollInterval = time.Millisecond
+	defer func() {
+		lambdaUpdateStatusPollInterval = defaultInterval
+	}()
+	mockLambda := &mockPowerTuningLambda{
+		mockUpdateStatusLambda: &mockUpdateStatusLambda{},
+		memorySize:             256,
+	}
+	logger, _ := NewLogger("warning")
+	recommendations := powerTuneFunctions(tuning,
+		"MyService",
+		&mockPowerTuningCloudFormation{},
+		mockLambda,
+		defaultCostPrice,
+		logger)
+	recommendation, recommendationExists := recommendations[lambdaFn.LogicalResourceName()]
+	if !recommendationExists || len(recommendation.Results) != 4 {
+		t.Fatalf("Unexpected recommendations: %#v", recommendations)
+	}
+	// The warm-up invocation isn't included in the results
+	if mockLambda.invocations != 12 {
+		t.Fatalf("Unexpected invocation count: %d", mockLambda.invocations)
+	}
+	if mockLambda.invokedDuringUpdate {
+		t.Fatalf("Invoked the function before the MemorySize update completed")
+	}
+	if mockLambda.memorySize != 256 || len(mockLambda.statuses) != 0 {
+		t.Fatalf("Failed to restore MemorySize: %d", mockLambda.memorySize)
+	}
+	if recommendation.MemorySize != 128 {
+		t.Fatalf("Unexpected cost recommendation: %d", recommendation.MemorySize)
+	}
+	speedResult := recommendedPowerTuningResult(recommendation.Results, PowerTuningStrategySpeed)
+	if speedResult.MemorySize != 2048 {
+		t.Fatalf("Unexpected speed recommendation: %d", speedResult.MemorySize)
+	}
+	balancedResult := recommendedPowerTuningResult(recommendation.Results, PowerTuningStrategyBalanced)
+	if balancedResult.MemorySize != 512 {
+		t.Fatalf("Unexpected balanced recommendation: %d", balancedResult.MemorySize)
+	}
+
+	// Recommendations are applied by the next provision
+	tempDir, tempDirErr := ioutil.TempDir("", "PowerTuning")
+	if tempDirErr != nil {
+		t.Fatalf("Failed to create temp directory: %s", tempDirErr)
+	}
+	defer os.RemoveAll(tempDir)
+	tuning.RecommendationsFile = filepath.Join(tempDir, "recommendations.json")
+	recommendation.MemorySize = balancedResult.MemorySize
+	writeErr := writePowerTuningRecommendations(tuning.RecommendationsFile, recommendations)
+	if writeErr != nil {
+		t.Fatalf("Failed to write recommendations: %s", writeErr)
+	}
+	applyErr := applyPowerTuningRecommendations(tuning, []*LambdaAWSInfo{lambdaFn}, logger)
+	if applyErr != nil {
+		t.Fatalf("Failed to apply recommendations: %s", applyErr)
+	}
+	if lambdaFn.Options.MemorySize != 512 {
+		t.Fatalf("Recommendation wasn't applied: %d", lambdaFn.Options.MemorySize)
+	}
+}
+
+type mockDynamicReferenceSSM struct {
+	ssmiface.SSMAPI
+	requests int
+}
+
+func (mockSSM *mockDynamicReferenceSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	mockSSM.requests++
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{
+			Name:    input.Name,
+			Value:   aws.String(fmt.Sprintf("%s-%t", aws.StringValue(input.Name), aws.BoolValue(input.WithDecryption))),
+			Version: aws.Int64(3),
+		},
+	}, nil
+}
+
+type mockDynamicReferenceSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+}
+
+func (mockSecrets *mockDynamicReferenceSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"username":"admin","port":5432}`),
+		VersionId:    aws.String("v1234"),
+	}, nil
+}
+
+func TestDynamicReferences(t *testing.T) {
+	for _, eachInvalid := range []string{
+		"{{resolve:ssm:}}",
+		"{{resolve:ssm:name:1:2}}",
+		"{{resolve:secretsmanager:MySecret:SecretBinary}}",
+		"{{resolve:s3:MyBucket}}",
+	} {
+		if _, parseErr := parseDynamicReference(eachInvalid); parseErr == nil {
+			t.Fatalf("Failed to reject invalid dynamic reference: %s", eachInvalid)
+		}
+	}
+	arnRef, arnRefErr := parseDynamicReference("{{resolve:secretsmanager:arn:aws:secretsmanager:us-west-2:123412341234:secret:MySecret-a1b2c3:SecretString:password::v1234}}")
+	if arnRefErr != nil {
+		t.Fatalf("Failed to parse secretsmanager ARN reference: %s", arnRefErr)
+	}
+	if arnRef.name != "arn:aws:secretsmanager:us-west-2:123412341234:secret:MySecret-a1b2c3" ||
+		arnRef.jsonKey != "password" ||
+		arnRef.versionStage != "" ||
+		arnRef.versionID != "v1234" {
+		t.Fatalf("Unexpected secretsmanager ARN reference: %#v", arnRef)
+	}
+
+	logger, _ := NewLogger("info")
+	newTemplate := func(lambdaFn *LambdaAWSInfo) *gocf.Template {
+		template := gocf.NewTemplate()
+		exportErr := lambdaFn.export("DynamicReferencesService",
+			"testBucket",
+			"testKey",
+			"",
+			"testBuildID",
+			map[string]*gocf.StringExpr{},
+			template,
+			NewWorkflowHookContext(nil),
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export function: %s", exportErr)
+		}
+		return template
+	}
+	lambdaFn, _ := NewAWSLambda("DynamicReferences", mockLambda1, IAMRoleDefinition{})
+	lambdaFn.Options.Environment = map[string]*gocf.StringExpr{
+		"API_URL":  gocf.String("https://{{resolve:ssm:/prod/api/host}}/v1"),
+		"API_KEY":  gocf.String("{{resolve:ssm-secure:/prod/api/key:2}}"),
+		"DB_PORT":  gocf.String("{{resolve:secretsmanager:prod/db:SecretString:port}}"),
+		"DB_USER":  gocf.String("{{resolve:secretsmanager:prod/db:SecretString:username}}"),
+		"API_HOST": gocf.String("{{resolve:ssm:/prod/api/host}}"),
+	}
+
+	// Pass through
+	template := newTemplate(lambdaFn)
+	passthroughErr := applyDynamicReferences(&DynamicReferences{},
+		template,
+		nil,
+		false,
+		logger)
+	if passthroughErr != nil {
+		t.Fatalf("Failed to pass through dynamic references: %s", passthroughErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	if !strings.Contains(string(templateJSON), "{{resolve:ssm-secure:/prod/api/key:2}}") {
+		t.Fatalf("Failed to pass through dynamic reference: %s", templateJSON)
+	}
+
+	// Resolve
+	mockSSM := &mockDynamicReferenceSSM{}
+	resolver := &dynamicReferenceResolver{
+		ssmSvc:     mockSSM,
+		secretsSvc: &mockDynamicReferenceSecretsManager{},
+		cache:      make(map[string]*dynamicReferenceValue),
+	}
+	auditDir, _ := ioutil.TempDir("", "sparta")
+	defer os.RemoveAll(auditDir)
+	auditFile := filepath.Join(auditDir, "audit.json")
+	resolveErr := applyDynamicReferences(&DynamicReferences{
+		Resolve:   true,
+		AuditFile: auditFile,
+	},
+		template,
+		resolver,
+		false,
+		logger)
+	if resolveErr != nil {
+		t.Fatalf("Failed to resolve dynamic references: %s", resolveErr)
+	}
+	templateJSON, _ = json.Marshal(template)
+	for _, eachExpected := range []string{
+		`"https:///prod/api/host-false/v1"`,
+		`"/prod/api/key:2-true"`,
+		`"5432"`,
+		`"admin"`,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find resolved value %s in template: %s", eachExpected, templateJSON)
+		}
+	}
+	if strings.Contains(string(templateJSON), "{{resolve:") {
+		t.Fatalf("Failed to resolve all dynamic references: %s", templateJSON)
+	}
+	if mockSSM.requests != 2 {
+		t.Fatalf("Expected 2 SSM requests. Found: %d", mockSSM.requests)
+	}
+	if lambdaFn.Options.Environment["API_KEY"].Literal != "{{resolve:ssm-secure:/prod/api/key:2}}" {
+		t.Fatalf("Resolution changed the function options: %s", lambdaFn.Options.Environment["API_KEY"].Literal)
+	}
+	auditJSON, auditJSONErr := ioutil.ReadFile(auditFile)
+	if auditJSONErr != nil {
+		t.Fatalf("Failed to read audit log: %s", auditJSONErr)
+	}
+	var resolutions []*DynamicReferenceResolution
+	unmarshalErr := json.Unmarshal(auditJSON, &resolutions)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal audit log: %s", unmarshalErr)
+	}
+	if len(resolutions) != 5 ||
+		resolutions[0].Resource != lambdaFn.LogicalResourceName() {
+		t.Fatalf("Unexpected audit log: %s", auditJSON)
+	}
+	if strings.Contains(string(auditJSON), "admin") {
+		t.Fatalf("Audit log includes a resolved value: %s", auditJSON)
+	}
+
+	// Invalid references are rejected
+	lambdaFn.Options.Environment["INVALID"] = gocf.String("{{resolve:ssm:}}")
+	invalidErr := applyDynamicReferences(&DynamicReferences{},
+		newTemplate(lambdaFn),
+		nil,
+		false,
+		logger)
+	if invalidErr == nil {
+		t.Fatalf("Failed to reject invalid dynamic reference")
+	}
+}
+
+func TestDynamoDBResources(t *testing.T) {
+	orders := &DynamoDBResource{
+		Name:           "Orders",
+		PartitionKey:   &DynamoDBKey{AttributeName: "id", AttributeType: "S"},
+		SortKey:        &DynamoDBKey{AttributeName: "created", AttributeType: "N"},
+		StreamViewType: "NEW_AND_OLD_IMAGES",
+	}
+	customers := &DynamoDBResource{
+		Name:     "Customers",
+		TableArn: "arn:aws:dynamodb:us-west-2:123412341234:table/Customers",
+		ReadOnly: true,
+	}
+	writerFn, _ := NewAWSLambda("DynamoDBWriter", mockLambda1, IAMRoleDefinition{})
+	writerFn.Options.DynamoDBResources = []*DynamoDBResource{orders, customers}
+	readerFn, _ := NewAWSLambda("DynamoDBReader", mockLambda2, IAMRoleDefinition{})
+	readerFn.Options.DynamoDBResources = []*DynamoDBResource{orders}
+
+	logger, _ := NewLogger("info")
+	var templateJSON bytes.Buffer
+	marshalErr := MarshalTemplate("DynamoDBService",
+		"",
+		[]*LambdaAWSInfo{writerFn, readerFn},
+		nil,
+		nil,
+		"testBucket",
+		"testBuildID",
+		"",
+		&templateJSON,
+		nil,
+		logger)
+	if marshalErr != nil {
+		t.Fatalf("Failed to marshal template: %s", marshalErr)
+	}
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			DependsOn  []string
+			Properties map[string]interface{}
+		}
+	}
+	unmarshalErr := json.Unmarshal(templateJSON.Bytes(), &template)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal template: %s", unmarshalErr)
+	}
+	tableCount := 0
+	for _, eachResource := range template.Resources {
+		if eachResource.Type == "AWS::DynamoDB::Table" {
+			tableCount++
+		}
+	}
+	if tableCount != 1 {
+		t.Fatalf("Expected a single shared DynamoDB table. Found: %d", tableCount)
+	}
+	table, tableExists := template.Resources[orders.LogicalResourceName()]
+	if !tableExists || table.Properties["BillingMode"] != "PAY_PER_REQUEST" {
+		t.Fatalf("Failed to find DynamoDB table %s", orders.LogicalResourceName())
+	}
+	for _, eachFn := range []*LambdaAWSInfo{writerFn, readerFn} {
+		fnResource := template.Resources[eachFn.LogicalResourceName()]
+		dependsOnTable := false
+		for _, eachDependency := range fnResource.DependsOn {
+			dependsOnTable = dependsOnTable || eachDependency == orders.LogicalResourceName()
+		}
+		if !dependsOnTable {
+			t.Fatalf("Function %s doesn't depend on the DynamoDB table", eachFn.LogicalResourceName())
+		}
+	}
+	for _, eachExpected := range []string{
+		"dynamodb:PutItem",
+		"/index/*",
+		customers.TableArn,
+		// Discovery information
+		`\"ResourceRef\":\"Customers\"`,
+		`"StreamArn"`,
+	} {
+		if !strings.Contains(templateJSON.String(), eachExpected) {
+			t.Fatalf("Failed to find %s in template", eachExpected)
+		}
+	}
+
+	// Conflicting table definitions are rejected
+	conflictFn, _ := NewAWSLambda("DynamoDBConflict", mockLambda3, IAMRoleDefinition{})
+	conflictFn.Options.DynamoDBResources = []*DynamoDBResource{{
+		Name:         "Orders",
+		PartitionKey: &DynamoDBKey{AttributeName: "orderID", AttributeType: "S"},
+	}}
+	conflictErr := MarshalTemplate("DynamoDBService",
+		"",
+		[]*LambdaAWSInfo{writerFn, conflictFn},
+		nil,
+		nil,
+		"testBucket",
+		"testBuildID",
+		"",
+		ioutil.Discard,
+		nil,
+		logger)
+	if conflictErr == nil {
+		t.Fatalf("Failed to reject conflicting DynamoDB table definitions")
+	}
+}
+
+func TestMessagingResources(t *testing.T) {
+	orders := &SQSResource{
+		Name:                      "Orders",
+		FIFO:                      true,
+		ContentBasedDeduplication: true,
+		VisibilityTimeout:         60,
+		KmsMasterKeyID:            gocf.String("alias/aws/sqs"),
+		RedrivePolicy:             &SQSRedrivePolicy{MaxReceiveCount: 5},
+		EventSource:               &SQSEventSource{BatchSize: 5},
+	}
+	auditQueue := &SQSResource{
+		Name:     "Audit",
+		QueueArn: "arn:aws:sqs:us-west-2:123412341234:audit",
+		SendOnly: true,
+	}
+	notifications := &SNSResource{
+		Name:      "Notifications",
+		TopicName: "notifications.fifo",
+		FIFO:      true,
+	}
+	lambdaFn, _ := NewAWSLambda("MessagingConsumer", mockLambda1, IAMRoleDefinition{})
+	lambdaFn.Options.Timeout = 30
+	lambdaFn.Options.SQSResources = []*SQSResource{orders, auditQueue}
+	lambdaFn.Options.SNSResources = []*SNSResource{notifications}
+
+	logger, _ := NewLogger("info")
+	var templateJSON bytes.Buffer
+	marshalErr := MarshalTemplate("MessagingService",
+		"",
+		[]*LambdaAWSInfo{lambdaFn},
+		nil,
+		nil,
+		"testBucket",
+		"testBuildID",
+		"",
+		&templateJSON,
+		nil,
+		logger)
+	if marshalErr != nil {
+		t.Fatalf("Failed to marshal template: %s", marshalErr)
+	}
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	unmarshalErr := json.Unmarshal(templateJSON.Bytes(), &template)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal template: %s", unmarshalErr)
+	}
+	resourceTypes := make(map[string]int)
+	for _, eachResource := range template.Resources {
+		resourceTypes[eachResource.Type]++
+	}
+	// The queue, its dead-letter queue and the topic
+	if resourceTypes["AWS::SQS::Queue"] != 2 ||
+		resourceTypes["AWS::SNS::Topic"] != 1 ||
+		resourceTypes["AWS::Lambda::EventSourceMapping"] != 1 {
+		t.Fatalf("Unexpected resource types: %v", resourceTypes)
+	}
+	queue := template.Resources[orders.LogicalResourceName()]
+	if queue.Properties["FifoQueue"] != true || queue.Properties["RedrivePolicy"] == nil {
+		t.Fatalf("Unexpected queue properties: %v", queue.Properties)
+	}
+	topic := template.Resources[notifications.LogicalResourceName()]
+	if topic.Properties["FifoTopic"] != true || topic.Properties["TopicName"] != "notifications.fifo" {
+		t.Fatalf("Unexpected topic properties: %v", topic.Properties)
+	}
+	for _, eachExpected := range []string{
+		"sqs:ReceiveMessage",
+		"sns:Publish",
+		"kms:ViaService",
+		auditQueue.QueueArn,
+		// Discovery information
+		`https://sqs.us-west-2.amazonaws.com/123412341234/audit`,
+		`\"QueueName\"`,
+		`\"TopicName\"`,
+	} {
+		if !strings.Contains(templateJSON.String(), eachExpected) {
+			t.Fatalf("Failed to find %s in template", eachExpected)
+		}
+	}
+}
+
+func TestAppConfig(t *testing.T) {
+	invalidOptions := []*LambdaFunctionOptions{
+		{AppConfig: &AppConfig{Application: gocf.String("app")}},
+		{AppConfig: &AppConfig{LayerArn: gocf.String("arn:aws:lambda:us-west-2:123412341234:layer:AppConfig:1")}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid AppConfig: %#v", eachOptions.AppConfig)
+		}
+	}
+
+	lambdaFn, _ := NewAWSLambda("FeatureFlags", mockLambda1, IAMRoleDefinition{})
+	lambdaFn.Options.AppConfig = &AppConfig{
+		LayerArn:            gocf.String("arn:aws:lambda:us-west-2:123412341234:layer:AppConfig:1"),
+		Application:         gocf.String("abc1234"),
+		Environment:         gocf.String("production"),
+		Profile:             gocf.Ref("FlagsProfile"),
+		PollIntervalSeconds: 30,
+	}
+	logger, _ := NewLogger("info")
+	var templateJSON bytes.Buffer
+	marshalErr := MarshalTemplate("AppConfigService",
+		"",
+		[]*LambdaAWSInfo{lambdaFn},
+		nil,
+		nil,
+		"testBucket",
+		"testBuildID",
+		"",
+		&templateJSON,
+		nil,
+		logger)
+	if marshalErr != nil {
+		t.Fatalf("Failed to marshal template: %s", marshalErr)
+	}
+	var compactJSON bytes.Buffer
+	compactErr := json.Compact(&compactJSON, templateJSON.Bytes())
+	if compactErr != nil {
+		t.Fatalf("Failed to compact template: %s", compactErr)
+	}
+	for _, eachExpected := range []string{
+		`"Layers":["arn:aws:lambda:us-west-2:123412341234:layer:AppConfig:1"]`,
+		`"appconfig:GetLatestConfiguration"`,
+		`":application/","abc1234","/environment/","*","/configuration/",{"Ref":"FlagsProfile"}`,
+		`"AWS_APPCONFIG_EXTENSION_POLL_INTERVAL_SECONDS":"30"`,
+		`"AWS_APPCONFIG_EXTENSION_PREFETCH_LIST"`,
+		`"SPARTA_APPCONFIG_ENVIRONMENT":"production"`,
+	} {
+		if !strings.Contains(compactJSON.String(), eachExpected) {
+			t.Fatalf("Failed to find %s in template", eachExpected)
+		}
+	}
+}
+
+func TestResourceTags(t *testing.T) {
+	lambdaFn1, _ := NewAWSLambda("ResourceTags1",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn1.Options.Tags = map[string]string{
+		"owner": "team-a",
+		"tier":  "gold",
+	}
+	lambdaFn1.Options.LogGroup = &LogGroup{
+		RetentionInDays: 7,
+	}
+	lambdaFn2, _ := NewAWSLambda("ResourceTags2",
+		mockLambda2,
+		IAMRoleDefinition{})
+	// Share the role
+	sharedRole := lambdaFn1.RoleDefinition
+	lambdaFn2.RoleDefinition = sharedRole
+	lambdaFn2.Options.Tags = map[string]string{
+		"owner": "team-b",
+	}
+	lambdaFns := []*LambdaAWSInfo{lambdaFn1, lambdaFn2}
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	roleName := sharedRole.logicalName("ResourceTagsService", lambdaFn1.lambdaFunctionName())
+	roleMap := map[string]*gocf.StringExpr{
+		roleName: gocf.GetAtt(roleName, "Arn"),
+	}
+	template.AddResource(roleName, sharedRole.toResource(nil, lambdaFn1.Options, logger))
+	for _, eachLambda := range lambdaFns {
+		exportErr := eachLambda.export("ResourceTagsService",
+			"testBucket",
+			"testKey",
+			"",
+			"testBuildID",
+			roleMap,
+			template,
+			NewWorkflowHookContext(nil),
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export lambda: %s", exportErr)
+		}
+	}
+	serviceTags := map[string]string{
+		"cost-center": "1234",
+		"owner":       "platform",
+	}
+	tagsErr := applyResourceTags("ResourceTagsService",
+		lambdaFns,
+		serviceTags,
+		template,
+		logger)
+	if tagsErr != nil {
+		t.Fatalf("Failed to apply resource tags: %s", tagsErr)
+	}
+	tagJSON := func(resourceName string) string {
+		resourceJSON, _ := json.Marshal(template.Resources[resourceName])
+		return string(resourceJSON)
+	}
+	// Function tags take precedence
+	lambdaJSON := tagJSON(lambdaFn1.LogicalResourceName())
+	for _, eachExpected := range []string{
+		`{"Key":"cost-center","Value":"1234"}`,
+		`{"Key":"owner","Value":"team-a"}`,
+		`{"Key":"tier","Value":"gold"}`,
+	} {
+		if !strings.Contains(lambdaJSON, eachExpected) {
+			t.Fatalf("Failed to find %s in lambda: %s", eachExpected, lambdaJSON)
+		}
+	}
+	// Conflicting function tags fall back to the service value
+	roleJSON := tagJSON(roleName)
+	for _, eachExpected := range []string{
+		`{"Key":"owner","Value":"platform"}`,
+		`{"Key":"tier","Value":"gold"}`,
+	} {
+		if !strings.Contains(roleJSON, eachExpected) {
+			t.Fatalf("Failed to find %s in role: %s", eachExpected, roleJSON)
+		}
+	}
+	// Function log groups include the function tags
+	logGroupJSON := tagJSON(CloudFormationResourceName("LogGroup",
+		lambdaFn1.LogicalResourceName()))
+	for _, eachExpected := range []string{
+		`{"Key":"cost-center","Value":"1234"}`,
+		`{"Key":"owner","Value":"team-a"}`,
+		`{"Key":"tier","Value":"gold"}`,
+	} {
+		if !strings.Contains(logGroupJSON, eachExpected) {
+			t.Fatalf("Failed to find %s in log group: %s", eachExpected, logGroupJSON)
+		}
+	}
+
+	invalidTags := []map[string]string{
+		{"": "empty"},
+		{"aws:reserved": "value"},
+		{spartaTagName("buildId"): "value"},
+		{"key": strings.Repeat("x", maxResourceTagValueLength+1)},
+	}
+	for _, eachTags := range invalidTags {
+		if validateTags(eachTags) == nil {
+			t.Fatalf("Failed to reject invalid tags: %#v", eachTags)
+		}
+	}
+}
+
+func TestResourceTagsWithInsightsAndIAMAnalysis(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ResourceTagsInsights",
+		mockLambda1,
+		IAMRoleDefinition{
+			Privileges: []IAMRolePrivilege{
+				{
+					Actions:  []string{"dynamodb:*"},
+					Resource: wildcardArn,
+				},
+			},
+		})
+	lambdaFn.Options.Tags = map[string]string{
+		"owner": "team-a",
+	}
+	lambdaFn.Options.LambdaInsights = &LambdaInsights{}
+	lambdaFns := []*LambdaAWSInfo{lambdaFn}
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	roleName := lambdaFn.RoleDefinition.logicalName("ResourceTagsService",
+		lambdaFn.lambdaFunctionName())
+	template.AddResource(roleName,
+		lambdaFn.RoleDefinition.toResource(nil, &LambdaFunctionOptions{}, logger))
+	tagsErr := applyResourceTags("ResourceTagsService",
+		lambdaFns,
+		map[string]string{"cost-center": "1234"},
+		template,
+		logger)
+	if tagsErr != nil {
+		t.Fatalf("Failed to apply resource tags: %s", tagsErr)
+	}
+	roleResource := template.Resources[roleName]
+	if _, taggedRoleOk := roleResource.Properties.(iamRole); !taggedRoleOk {
+		t.Fatalf("Failed to tag IAM role: %T", roleResource.Properties)
+	}
+	// Lambda Insights updates the tagged role
+	addLambdaInsightsPolicy(roleResource)
+	taggedRole, taggedRoleOk := roleResource.Properties.(iamRole)
+	if !taggedRoleOk || taggedRole.Tags == nil || len(*taggedRole.Tags) != 2 {
+		t.Fatalf("Failed to preserve IAM role tags: %#v", roleResource.Properties)
+	}
+	if taggedRole.ManagedPolicyArns == nil ||
+		len(taggedRole.ManagedPolicyArns.Literal) != 1 ||
+		!reflect.DeepEqual(taggedRole.ManagedPolicyArns.Literal[0], lambdaInsightsPolicyArn()) {
+		t.Fatalf("Failed to add Lambda Insights policy to tagged IAM role")
+	}
+	// The policy validation reads the tagged role policies
+	typedRole, typedRoleOk := templateIAMRole(roleResource)
+	if !typedRoleOk || typedRole.Policies == nil || len(*typedRole.Policies) == 0 {
+		t.Fatalf("Failed to read tagged IAM role policies")
+	}
+	if analyzeErr := analyzeIAMPrivileges(lambdaFns, template, true, logger); analyzeErr == nil {
+		t.Fatalf("Failed to reject broad IAM actions for tagged role")
+	}
+	// Updates preserve the tagged role
+	setTemplateIAMRole(roleResource, typedRole)
+	if _, taggedRoleOk := roleResource.Properties.(iamRole); !taggedRoleOk {
+		t.Fatalf("Failed to preserve tagged IAM role type: %T", roleResource.Properties)
+	}
+}
+
+func TestServiceDashboard(t *testing.T) {
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	template.AddResource("MyFunction", gocf.LambdaFunction{
+		Code: &gocf.LambdaFunctionCode{
+			ZipFile: gocf.String("exports.handler = () => {}"),
+		},
+		DeadLetterConfig: &gocf.LambdaFunctionDeadLetterConfig{
+			TargetArn: gocf.GetAtt("MyDLQ", "Arn"),
+		},
+	})
+	template.AddResource("MyQueue", gocf.SQSQueue{})
+	template.AddResource("MyDLQ", gocf.SQSQueue{})
+	template.AddResource("OtherQueue", gocf.SQSQueue{})
+	template.AddResource("MyMapping", gocf.LambdaEventSourceMapping{
+		EventSourceArn: gocf.GetAtt("MyQueue", "Arn"),
+		FunctionName:   gocf.GetAtt("MyFunction", "Arn"),
+	})
+	template.AddResource("MyAPI", gocf.APIGatewayRestAPI{
+		Name: gocf.String("MyAPI"),
+	})
+	template.AddResource("MyDeployment", gocf.APIGatewayDeployment{
+		RestAPIID: gocf.Ref("MyAPI").String(),
+		StageName: gocf.String("v1"),
+	})
+	template.AddResource("MyStateMachine", gocf.StepFunctionsStateMachine{
+		DefinitionString: gocf.String("{}"),
+		RoleArn:          gocf.String("arn:aws:iam::000000000000:role/Role"),
+	})
+
+	exportErr := exportServiceDashboard("DashboardService",
+		&ServiceDashboard{},
+		template,
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export service dashboard: %s", exportErr)
+	}
+	dashboardResourceName := CloudFormationResourceName("ServiceDashboard", "DashboardService")
+	if template.Resources[dashboardResourceName] == nil ||
+		template.Outputs[OutputServiceDashboardURL] == nil {
+		t.Fatalf("Failed to create service dashboard")
+	}
+	dashboardJSON, _ := json.Marshal(template.Resources[dashboardResourceName])
+	dashboard := string(dashboardJSON)
+	expected := []string{
+		`{"Ref":"MyFunction"}`,
+		`{"Fn::GetAtt":["MyQueue","QueueName"]}`,
+		`{"Fn::GetAtt":["MyDLQ","QueueName"]}`,
+		`{"Fn::GetAtt":["OtherQueue","QueueName"]}`,
+		`{"Ref":"MyStateMachine"}`,
+		`\"ApiName\",\"MyAPI\",\"Stage\",\"v1\"`,
+		`{"Ref":"AWS::StackName"}`,
+		`**SQS Queues**: 3`,
+	}
+	for _, eachExpected := range expected {
+		if !strings.Contains(dashboard, eachExpected) {
+			t.Fatalf("Failed to find %s in service dashboard: %s", eachExpected, dashboard)
+		}
+	}
+	// Queues associated with the function are grouped with it
+	resources := newDashboardResources(template)
+	if len(resources.functionQueues["MyFunction"]) != 2 ||
+		len(resources.queues) != 1 ||
+		resources.queues[0] != "OtherQueue" {
+		t.Fatalf("Unexpected service dashboard grouping: %#v", resources)
+	}
+	invalidErr := exportServiceDashboard("DashboardService",
+		&ServiceDashboard{PeriodSeconds: 90},
+		gocf.NewTemplate(),
+		logger)
+	if invalidErr == nil {
+		t.Fatalf("Failed to reject invalid ServiceDashboard PeriodSeconds")
+	}
+}
+
+func TestCostEstimate(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("CostEstimate",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.MemorySize = 1024
+	lambdaFn.Options.CostHints = &LambdaCostHints{
+		InvocationsPerMonth:   1000000,
+		AverageDurationMillis: 500,
+	}
+	defaultFn, _ := NewAWSLambda("DefaultCostEstimate",
+		mockLambda1,
+		IAMRoleDefinition{})
+
+	template := gocf.NewTemplate()
+	template.AddResource("MyAPI", gocf.APIGatewayRestAPI{
+		Name: gocf.String("MyAPI"),
+	})
+	template.AddResource("MyTable", gocf.DynamoDBTable{
+		ProvisionedThroughput: &gocf.DynamoDBTableProvisionedThroughput{
+			ReadCapacityUnits:  gocf.Integer(10),
+			WriteCapacityUnits: gocf.Integer(5),
+		},
+	})
+	template.AddResource("MyOnDemandTable", gocf.DynamoDBTable{
+		BillingMode: gocf.String("PAY_PER_REQUEST"),
+	})
+	estimate := &CostEstimate{
+		DefaultInvocationsPerMonth:    1000,
+		APIRequestsPerMonth:           2000000,
+		DynamoDBReadRequestsPerMonth:  8000000,
+		DynamoDBWriteRequestsPerMonth: 1600000,
+	}
+	items, itemsErr := estimateMonthlyCost(estimate,
+		[]*LambdaAWSInfo{lambdaFn, defaultFn},
+		template,
+		defaultCostPrice)
+	if itemsErr != nil {
+		t.Fatalf("Failed to estimate cost: %s", itemsErr)
+	}
+	expected := map[string]string{
+		// 1M requests + 500,000 GB-seconds
+		lambdaFn.LogicalResourceName(): "8.53",
+		// 1000 requests + 375 GB-seconds
+		defaultFn.LogicalResourceName(): "0.01",
+		"MyAPI":                         "7.00",
+		// 730 hours of 10 RCU and 5 WCU
+		"MyTable":         "3.32",
+		"MyOnDemandTable": "2.00",
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("Unexpected cost estimate items: %d", len(items))
+	}
+	for _, eachItem := range items {
+		monthlyUSD := fmt.Sprintf("%.2f", eachItem.monthlyUSD)
+		if expected[eachItem.resourceName] != monthlyUSD {
+			t.Fatalf("Unexpected cost estimate for %s. Expected: %s, Found: %s",
+				eachItem.resourceName,
+				expected[eachItem.resourceName],
+				monthlyUSD)
+		}
+	}
+	// Price List API products use the first tier price
+	var product map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"terms":{"OnDemand":{"TERM":{"priceDimensions":{
+		"TIER2":{"beginRange":"6000000000","pricePerUnit":{"USD":"0.0000150000"}},
+		"TIER1":{"beginRange":"0","pricePerUnit":{"USD":"0.0000166667"}}}}}}}`), &product)
+	if unitPrice, unitPriceOk := firstTierUSDPrice(product); !unitPriceOk || unitPrice != 0.0000166667 {
+		t.Fatalf("Unexpected Price List API price: %f", unitPrice)
+	}
+	lambdaFn.Options.CostHints.InvocationsPerMonth = -1
+	_, itemsErr = estimateMonthlyCost(estimate,
+		[]*LambdaAWSInfo{lambdaFn},
+		template,
+		defaultCostPrice)
+	if itemsErr == nil {
+		t.Fatalf("Failed to reject invalid CostHints")
+	}
+}
+
+func TestProvisionOptions(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ProvisionOptions", mockLambda1, IAMRoleDefinition{})
+	logger, _ := NewLogger("info")
+	provisionWithOptions := func(options *ProvisionOptions) error {
+		return ProvisionEx(true,
+			"ProvisionOptionsService",
+			"",
+			[]*LambdaAWSInfo{lambdaFn},
+			nil,
+			nil,
+			"testBucket",
+			false,
+			false,
+			"testBuildID",
+			"",
+			"",
+			"",
+			nil,
+			nil,
+			options,
+			logger)
+	}
+	// Library callers configure the workflow with the options
+	parametersErr := provisionWithOptions(&ProvisionOptions{
+		Parameters: []string{"=invalid"},
+	})
+	if parametersErr == nil || !strings.Contains(parametersErr.Error(), "Invalid parameter override") {
+		t.Fatalf("Failed to apply ProvisionOptions.Parameters: %v", parametersErr)
+	}
+	stackSetErr := provisionWithOptions(&ProvisionOptions{
+		StackSet: "missing-stackset.json",
+	})
+	if stackSetErr == nil || !strings.Contains(stackSetErr.Error(), "Failed to open StackSet deployment") {
+		t.Fatalf("Failed to apply ProvisionOptions.StackSet: %v", stackSetErr)
+	}
+
+	// The provision command flags don't apply to MarshalTemplate
+	savedOptions := optionsProvision
+	defer func() {
+		optionsProvision = savedOptions
+	}()
+	optionsProvision.Parameters = []string{"=invalid"}
+	optionsProvision.StackSet = "missing-stackset.json"
+	var templateJSON bytes.Buffer
+	marshalErr := MarshalTemplate("ProvisionOptionsService",
+		"",
+		[]*LambdaAWSInfo{lambdaFn},
+		nil,
+		nil,
+		"testBucket",
+		"testBuildID",
+		"",
+		&templateJSON,
+		nil,
+		logger)
+	if marshalErr != nil {
+		t.Fatalf("Failed to marshal template with provision command flags: %s", marshalErr)
+	}
+}
+
+func TestProvisionTemplateFormat(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ProvisionTemplateFormat", mockLambda1, IAMRoleDefinition{})
+	logger, _ := NewLogger("info")
+	provisionTemplate := func(templateFormat string, templateWriter io.Writer) error {
+		return ProvisionEx(true,
+			"ProvisionTemplateFormatService",
+			"",
+			[]*LambdaAWSInfo{lambdaFn},
+			nil,
+			nil,
+			"testBucket",
+			false,
+			false,
+			"testBuildID",
+			"",
+			"",
+			"",
+			templateWriter,
+			nil,
+			&ProvisionOptions{
+				TemplateFormat: templateFormat,
+			},
+			logger)
+	}
+	var templateYAML bytes.Buffer
+	provisionErr := provisionTemplate(TemplateFormatYAML, &templateYAML)
+	if provisionErr != nil {
+		t.Fatalf("Failed to provision YAML template: %s", provisionErr)
+	}
+	if json.Valid(templateYAML.Bytes()) ||
+		!strings.Contains(templateYAML.String(), "\nResources:\n") {
+		t.Fatalf("Unexpected YAML template:\n%s", templateYAML.String())
+	}
+	if provisionTemplate(TemplateFormatSAM, &templateYAML) == nil {
+		t.Fatalf("Failed to reject unsupported template format")
+	}
+}
+
+// mockLogGroupCloudFormation returns the resources of an existing stack, or
+// a missing stack error if there aren't any
+type mockLogGroupCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	resources []*cloudformation.StackResourceSummary
+}
+
+func (mockCF *mockLogGroupCloudFormation) ListStackResourcesPages(input *cloudformation.ListStackResourcesInput,
+	fn func(*cloudformation.ListStackResourcesOutput, bool) bool) error {
+	if len(mockCF.resources) == 0 {
+		return awserr.New("ValidationError",
+			fmt.Sprintf("Stack with id %s does not exist", aws.StringValue(input.StackName)),
+			nil)
+	}
+	fn(&cloudformation.ListStackResourcesOutput{
+		StackResourceSummaries: mockCF.resources,
+	}, true)
+	return nil
+}
+
+type mockLogGroupCloudWatchLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	logGroupNames []string
+	describeCalls int
+}
+
+func (mockLogs *mockLogGroupCloudWatchLogs) DescribeLogGroups(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	mockLogs.describeCalls++
+	output := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for _, eachName := range mockLogs.logGroupNames {
+		if strings.HasPrefix(eachName, aws.StringValue(input.LogGroupNamePrefix)) {
+			output.LogGroups = append(output.LogGroups, &cloudwatchlogs.LogGroup{
+				LogGroupName: aws.String(eachName),
+			})
+		}
+	}
+	return output, nil
+}
+
+func TestLogGroupUpgrade(t *testing.T) {
+	logger, _ := NewLogger("info")
+	serviceName := "LogGroupService"
+	lambdaFn, _ := NewAWSLambda("LogGroupUpgrade",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.LogGroup = &LogGroup{RetentionInDays: 14}
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export(serviceName,
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export LogGroup: %s", exportErr)
+	}
+	lambdaResourceName := lambdaFn.LogicalResourceName()
+	logGroupResourceName := CloudFormationResourceName("LogGroup", lambdaResourceName)
+	functionName := fmt.Sprintf("%s%s%s",
+		serviceName,
+		functionNameDelimiter,
+		awsLambdaInternalName(lambdaFn.lambdaFunctionName()))
+	// AWS Lambda created the log group when the deployed function was
+	// invoked. The log group with the same prefix doesn't conflict.
+	logGroupName := "/aws/lambda/" + functionName
+	deployedResources := []*cloudformation.StackResourceSummary{
+		{
+			LogicalResourceId:  aws.String(lambdaResourceName),
+			PhysicalResourceId: aws.String(functionName),
+			ResourceType:       aws.String("AWS::Lambda::Function"),
+		},
+	}
+
+	verify := func(resources []*cloudformation.StackResourceSummary,
+		logGroupNames ...string) (*mockLogGroupCloudWatchLogs, error) {
+		logsSvc := &mockLogGroupCloudWatchLogs{
+			logGroupNames: logGroupNames,
+		}
+		verifyErr := verifyExistingLogGroups(serviceName,
+			template,
+			&AWSClients{
+				CloudFormation: &mockLogGroupCloudFormation{resources: resources},
+				CloudWatchLogs: logsSvc,
+			},
+			logger)
+		return logsSvc, verifyErr
+	}
+
+	// Upgrading a deployed function fails before the stack update
+	_, verifyErr := verify(deployedResources, logGroupName, logGroupName+"-other")
+	if verifyErr == nil {
+		t.Fatalf("Failed to reject existing log group")
+	}
+	for _, eachExpected := range []string{logGroupResourceName, logGroupName, "Import each log group"} {
+		if !strings.Contains(verifyErr.Error(), eachExpected) {
+			t.Fatalf("Failed to find %s in existing log group error: %s", eachExpected, verifyErr)
+		}
+	}
+
+	// Deployed functions that were never invoked don't have a log group
+	_, verifyErr = verify(deployedResources, logGroupName+"-other")
+	if verifyErr != nil {
+		t.Fatalf("Unexpected error for missing log group: %s", verifyErr)
+	}
+
+	// New stacks and stacks that already manage the log group are skipped
+	logsSvc, verifyErr := verify(nil, logGroupName)
+	if verifyErr != nil || logsSvc.describeCalls != 0 {
+		t.Fatalf("Unexpected log group check for new stack: %v", verifyErr)
+	}
+	managedResources := append(deployedResources, &cloudformation.StackResourceSummary{
+		LogicalResourceId:  aws.String(logGroupResourceName),
+		PhysicalResourceId: aws.String(logGroupName),
+		ResourceType:       aws.String("AWS::Logs::LogGroup"),
+	})
+	logsSvc, verifyErr = verify(managedResources, logGroupName)
+	if verifyErr != nil || logsSvc.describeCalls != 0 {
+		t.Fatalf("Unexpected log group check for managed log group: %v", verifyErr)
+	}
+}
@@ -2,6 +2,7 @@ package sparta
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	_ "github.com/aws/aws-lambda-go/lambda"        // Force dep to resolve
@@ -47,11 +48,26 @@ const (
 	// envVarDiscoveryInformation is the name of the discovery information
 	// published into the environment
 	envVarDiscoveryInformation = "SPARTA_DISCOVERY_INFO"
+	// envVarSecretPrefix is the prefix of the environment variables
+	// that store the Secrets references
+	envVarSecretPrefix = "SPARTA_SECRET_"
+	// envVarAppConfigApplication, envVarAppConfigEnvironment and
+	// envVarAppConfigProfile identify the AppConfig configuration that
+	// FeatureFlag reads
+	envVarAppConfigApplication = "SPARTA_APPCONFIG_APPLICATION"
+	envVarAppConfigEnvironment = "SPARTA_APPCONFIG_ENVIRONMENT"
+	envVarAppConfigProfile     = "SPARTA_APPCONFIG_PROFILE"
+	// envVarAppConfigCacheTTL is the number of seconds that FeatureFlag
+	// caches the configuration
+	envVarAppConfigCacheTTL = "SPARTA_APPCONFIG_CACHE_TTL"
 )
 
 var (
 	// internal logging header
 	headerDivider = strings.Repeat("═", dividerLength)
+	// IAM role path and name constraints
+	reIAMPath     = regexp.MustCompile(`^/([\x21-\x7E]+/)?$`)
+	reIAMRoleName = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
 )
 
 // AWS Principal ARNs from http://docs.aws.amazon.com/general/latest/gr/aws-arns-and-namespaces.html
@@ -75,6 +91,103 @@ const (
 	ElasticLoadBalancingPrincipal = "elasticloadbalancing.amazonaws.com"
 	// @enum KinesisFirehosePrincipal
 	KinesisFirehosePrincipal = "firehose.amazonaws.com"
+	// @enum AWSPrincipal
+	SchedulerPrincipal = "scheduler.amazonaws.com"
+)
+
+// Lambda function configuration quotas. See
+// https://docs.aws.amazon.com/lambda/latest/dg/gettingstarted-limits.html
+const (
+	minLambdaMemorySize       = 128
+	maxLambdaMemorySize       = 10240
+	maxLambdaTimeout          = 900
+	minLambdaEphemeralStorage = 512
+	maxLambdaEphemeralStorage = 10240
+	maxLambdaEnvironmentSize  = 4096
+)
+
+// IAM role quotas. See
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_iam-quotas.html
+const (
+	maxIAMRoleManagedPolicies = 20
+)
+
+// Resource tag quotas. See
+// https://docs.aws.amazon.com/general/latest/gr/aws_tagging.html
+const (
+	maxResourceTags           = 50
+	maxResourceTagKeyLength   = 128
+	maxResourceTagValueLength = 256
+)
+
+// EventSourceMapping SourceAccessConfiguration types. See
+// https://docs.aws.amazon.com/lambda/latest/dg/API_SourceAccessConfiguration.html
+const (
+	// SourceAccessTypeBasicAuth is the Secrets Manager ARN of the SASL/PLAIN credentials
+	SourceAccessTypeBasicAuth = "BASIC_AUTH"
+	// SourceAccessTypeSASLSCRAM256Auth is the Secrets Manager ARN of the SASL SCRAM-256 credentials
+	SourceAccessTypeSASLSCRAM256Auth = "SASL_SCRAM_256_AUTH"
+	// SourceAccessTypeSASLSCRAM512Auth is the Secrets Manager ARN of the SASL SCRAM-512 credentials
+	SourceAccessTypeSASLSCRAM512Auth = "SASL_SCRAM_512_AUTH"
+	// SourceAccessTypeClientCertificateTLSAuth is the Secrets Manager ARN of the mTLS client certificate
+	SourceAccessTypeClientCertificateTLSAuth = "CLIENT_CERTIFICATE_TLS_AUTH"
+	// SourceAccessTypeServerRootCACertificate is the Secrets Manager ARN of the root CA certificate
+	SourceAccessTypeServerRootCACertificate = "SERVER_ROOT_CA_CERTIFICATE"
+	// SourceAccessTypeVPCSubnet is a subnet ID used by a self-managed Kafka cluster
+	SourceAccessTypeVPCSubnet = "VPC_SUBNET"
+	// SourceAccessTypeVPCSecurityGroup is a security group ID used by a self-managed Kafka cluster
+	SourceAccessTypeVPCSecurityGroup = "VPC_SECURITY_GROUP"
+	// SourceAccessTypeVirtualHost is the RabbitMQ virtual host name
+	SourceAccessTypeVirtualHost = "VIRTUAL_HOST"
+)
+
+// Template output formats for the provision templateWriter
+const (
+	// TemplateFormatJSON writes the template as indented JSON
+	// @enum TemplateFormat
+	TemplateFormatJSON = "json"
+	// TemplateFormatYAML writes the template as YAML with short form
+	// intrinsic functions
+	// @enum TemplateFormat
+	TemplateFormatYAML = "yaml"
+	// TemplateFormatSAM writes an AWS SAM template as YAML. Only
+	// supported by the package command.
+	// @enum TemplateFormat
+	TemplateFormatSAM = "sam"
+)
+
+// Output formats for the describe command
+const (
+	// DescribeFormatHTML writes the interactive HTML report
+	// @enum DescribeFormat
+	DescribeFormatHTML = "html"
+	// DescribeFormatMermaid writes a Mermaid flowchart
+	// @enum DescribeFormat
+	DescribeFormatMermaid = "mermaid"
+	// DescribeFormatDOT writes a Graphviz DOT digraph
+	// @enum DescribeFormat
+	DescribeFormatDOT = "dot"
+	// DescribeFormatOpenAPI writes the OpenAPI 3.0 document for the
+	// service's API Gateway
+	// @enum DescribeFormat
+	DescribeFormatOpenAPI = "openapi"
+)
+
+// Service export formats for the export command
+const (
+	// ExportFormatTerraform writes a Terraform HCL configuration
+	// @enum ExportFormat
+	ExportFormatTerraform = "terraform"
+)
+
+// Output formats for the metrics command
+const (
+	// MetricsFormatTable writes a table of function metrics
+	// @enum MetricsFormat
+	MetricsFormatTable = "table"
+	// MetricsFormatJSON writes the function metrics as JSON
+	// @enum MetricsFormat
+	MetricsFormatJSON = "json"
 )
 
 type contextKey int
@@ -100,4 +213,14 @@ const (
 	// ContextKeyAWSSession is the aws Session instance for this
 	// request
 	ContextKeyAWSSession
+	// ContextKeyMetrics is the request scoped *sparta.MetricsLogger
+	// instance. Use sparta.Metrics(ctx) to access it.
+	ContextKeyMetrics
+	// ContextKeyConfig is the *sparta.FunctionConfig instance for the
+	// executing function. Use sparta.Config(ctx) to access it.
+	ContextKeyConfig
+	// ContextKeyAWSClients is the optional *sparta.AWSClients instance
+	// that replaces the clients created from the ContextKeyAWSSession
+	// session (eg, with mocks in tests)
+	ContextKeyAWSClients
 )
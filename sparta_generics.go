@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// HandleLambda returns a *LambdaAWSInfo for a typed lambda function. The
+// request and response types are checked at compile time, so the function
+// bypasses the reflection based signature validation and dispatch used
+// by NewAWSLambda. The request is unmarshaled from the event JSON and the
+// response is marshaled to JSON. Use struct{} or json.RawMessage for
+// functions that ignore the event or don't return a value.
+// Requires Go 1.21 or later, where the build constraint raises this file's
+// language version above the module's go directive.
+func HandleLambda[Req any, Resp any](functionName string,
+	handler func(ctx context.Context, request Req) (Resp, error),
+	roleNameOrIAMRoleDefinition interface{}) (*LambdaAWSInfo, error) {
+
+	if handler == nil {
+		return nil, errors.Errorf("AWS Lambda function handler must not be nil")
+	}
+	typedHandler := LambdaHandler(func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+		var request Req
+		if len(msg) != 0 {
+			unmarshalErr := json.Unmarshal(msg, &request)
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+		}
+		response, responseErr := handler(ctx, request)
+		return response, responseErr
+	})
+	return NewAWSLambda(functionName, typedHandler, roleNameOrIAMRoleDefinition)
+}
@@ -0,0 +1,59 @@
+//go:build go1.21
+// +build go1.21
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+type typedRequest struct {
+	Name string `json:"name"`
+}
+
+type typedResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func typedHello(ctx context.Context, request typedRequest) (*typedResponse, error) {
+	return &typedResponse{Greeting: "Hello " + request.Name}, nil
+}
+
+func TestHandleLambda(t *testing.T) {
+	lambdaFn, lambdaFnErr := HandleLambda("TypedHello",
+		typedHello,
+		IAMRoleDefinition{})
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to create typed lambda: %s", lambdaFnErr)
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	lambdaHandler, lambdaHandlerOk := lambdaFn.handlerSymbol.(LambdaHandler)
+	if !lambdaHandlerOk {
+		t.Fatalf("Expected typed lambda to store a LambdaHandler")
+	}
+	response, responseErr := lambdaHandler(context.Background(),
+		json.RawMessage(`{"name": "World"}`))
+	if responseErr != nil {
+		t.Fatalf("Failed to invoke typed lambda: %s", responseErr)
+	}
+	typedResponse, typedResponseOk := response.(*typedResponse)
+	if !typedResponseOk || typedResponse.Greeting != "Hello World" {
+		t.Fatalf("Unexpected typed lambda response: %#v", response)
+	}
+	_, responseErr = lambdaHandler(context.Background(),
+		json.RawMessage(`{"name": 42}`))
+	if responseErr == nil {
+		t.Fatalf("Expected typed lambda to reject invalid request JSON")
+	}
+}
+
+func TestHandleLambdaNil(t *testing.T) {
+	var nilHandler func(context.Context, typedRequest) (*typedResponse, error)
+	_, lambdaFnErr := HandleLambda("NilHandler", nilHandler, IAMRoleDefinition{})
+	if lambdaFnErr == nil {
+		t.Fatalf("Expected error for nil typed handler")
+	}
+}
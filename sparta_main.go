@@ -6,6 +6,7 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -14,6 +15,8 @@ import (
 	"strings"
 	"time"
 
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -77,26 +80,85 @@ var CommandLineOptions = struct {
 	Root      *cobra.Command
 	Version   *cobra.Command
 	Provision *cobra.Command
+	Package   *cobra.Command
+	Export    *cobra.Command
 	Delete    *cobra.Command
 	Execute   *cobra.Command
 	Describe  *cobra.Command
 	Explore   *cobra.Command
 	Profile   *cobra.Command
 	Status    *cobra.Command
+	Metrics   *cobra.Command
+	Rollback  *cobra.Command
+	Dev       *cobra.Command
+	Local     *cobra.Command
+	// LocalInvoke is the `invoke` subcommand of Local
+	LocalInvoke *cobra.Command
+	// LocalStartAPI is the `start-api` subcommand of Local
+	LocalStartAPI *cobra.Command
 }{}
 
 /*============================================================================*/
 // Provision options
 // Ref: http://docs.aws.amazon.com/AmazonS3/latest/dev/BucketRestrictions.html
 type optionsProvisionStruct struct {
-	S3Bucket        string `validate:"required"`
-	BuildID         string `validate:"-"` // non-whitespace
-	PipelineTrigger string `validate:"-"`
-	InPlace         bool   `validate:"-"`
+	S3Bucket        string   `validate:"required"`
+	BuildID         string   `validate:"-"` // non-whitespace
+	PipelineTrigger string   `validate:"-"`
+	InPlace         bool     `validate:"-"`
+	StrictIAM       bool     `validate:"-"`
+	ValidateIAM     bool     `validate:"-"`
+	StackSet        string   `validate:"-"`
+	TemplateFile    string   `validate:"-"`
+	TemplateFormat  string   `validate:"omitempty,oneof=json yaml"`
+	OTLPEndpoint    string   `validate:"omitempty,url"`
+	Interactive     bool     `validate:"-"`
+	ForceUnlock     bool     `validate:"-"`
+	Localstack      string   `validate:"omitempty,url"`
+	MaxRetries      int      `validate:"gte=0"`
+	Parameters      []string `validate:"-"`
 }
 
 var optionsProvision optionsProvisionStruct
 
+// ProvisionOptions are the options for ProvisionEx. The provision command
+// sets them from its flags.
+type ProvisionOptions struct {
+	// StrictIAM fails the provision if a function's IAM privileges grant
+	// broad (eg, s3:*) actions
+	StrictIAM bool
+	// ValidateIAM validates the generated IAM role policies with IAM
+	// Access Analyzer
+	ValidateIAM bool
+	// ForceUnlock releases an existing provision lock for the stack before
+	// provisioning. Only use this if the lock holder is no longer running.
+	ForceUnlock bool
+	// Localstack is the optional localstack endpoint to use rather than AWS
+	Localstack string
+	// MaxRetries overrides the number of times throttled or failed AWS API
+	// requests are retried if it's greater than zero. Defaults to the
+	// WorkflowHooks.RetryPolicy or default policy value.
+	MaxRetries int
+	// OTLPEndpoint is the optional OpenTelemetry OTLP/HTTP endpoint
+	// (eg, http://localhost:4318) that receives a span for each
+	// provisioning step
+	OTLPEndpoint string
+	// Interactive displays the provisioning progress and stack events in
+	// an interactive terminal view. It falls back to the log output if
+	// there's no terminal.
+	Interactive bool
+	// Parameters are the stack parameter values as Key=Value. Use Key
+	// without a value to keep the stack's existing value.
+	Parameters []string
+	// StackSet is the optional path to a JSON StackSet deployment that
+	// publishes the service to multiple accounts and regions
+	StackSet string
+	// TemplateFormat is the format (json, yaml) of the template written to
+	// the templateWriter. Empty values write the template as a JSON encoded
+	// string.
+	TemplateFormat string
+}
+
 func provisionBuildID(userSuppliedValue string, logger *logrus.Logger) (string, error) {
 	buildID := userSuppliedValue
 	if buildID == "" {
@@ -137,11 +199,36 @@ func provisionBuildID(userSuppliedValue string, logger *logrus.Logger) (string,
 	return buildID, nil
 }
 
+/*============================================================================*/
+// Package options
+type optionsPackageStruct struct {
+	S3Bucket        string `validate:"required"`
+	BuildID         string `validate:"-"`
+	OutputDirectory string `validate:"required"`
+	Upload          bool   `validate:"-"`
+	TemplateFormat  string `validate:"omitempty,oneof=json yaml sam"`
+}
+
+var optionsPackage optionsPackageStruct
+
+/*============================================================================*/
+// Export options
+type optionsExportStruct struct {
+	S3Bucket        string `validate:"required"`
+	BuildID         string `validate:"-"`
+	OutputDirectory string `validate:"required"`
+	Upload          bool   `validate:"-"`
+	Format          string `validate:"required,oneof=terraform"`
+}
+
+var optionsExport optionsExportStruct
+
 /*============================================================================*/
 // Describe options
 type optionsDescribeStruct struct {
-	OutputFile string `validate:"required"`
-	S3Bucket   string `validate:"required"`
+	OutputFile   string `validate:"required"`
+	S3Bucket     string `validate:"required"`
+	OutputFormat string `validate:"omitempty,oneof=html mermaid dot openapi"`
 }
 
 var optionsDescribe optionsDescribeStruct
@@ -165,11 +252,136 @@ var optionsProfile optionsProfileStruct
 /*============================================================================*/
 // Status options
 type optionsStatusStruct struct {
-	Redact bool `validate:"-"`
+	Redact      bool   `validate:"-"`
+	DetectDrift bool   `validate:"-"`
+	EventCount  int    `validate:"min=0"`
+	Localstack  string `validate:"-"`
 }
 
 var optionsStatus optionsStatusStruct
 
+// StatusOptions are the options for the status report
+type StatusOptions struct {
+	// Redact replaces the AWS account ID in the report
+	Redact bool
+	// DetectDrift runs stack drift detection before reporting the stack's
+	// drift status. Otherwise the result of the most recent drift detection
+	// is reported.
+	DetectDrift bool
+	// DriftTimeout is the maximum time to wait for drift detection.
+	// Defaults to 5 minutes.
+	DriftTimeout time.Duration
+	// EventCount is the number of recent stack events to include
+	EventCount int
+	// Localstack is the optional localstack endpoint to use rather than AWS
+	Localstack string
+	// AWSClients optionally replaces the clients created from the session
+	// (eg, with mocks in tests)
+	AWSClients *AWSClients
+}
+
+/*============================================================================*/
+// Rollback options
+type optionsRollbackStruct struct {
+	Localstack string `validate:"-"`
+}
+
+var optionsRollback optionsRollbackStruct
+
+// RollbackOptions are the options for the rollback command
+type RollbackOptions struct {
+	// Noop verifies the rollback without updating the stack
+	Noop bool
+	// Localstack is the optional localstack endpoint to use rather than AWS
+	Localstack string
+	// AWSClients optionally replaces the clients created from the session
+	// (eg, with mocks in tests)
+	AWSClients *AWSClients
+}
+
+/*============================================================================*/
+// Metrics options
+type optionsMetricsStruct struct {
+	Window       time.Duration `validate:"-"`
+	OutputFormat string        `validate:"omitempty,oneof=table json"`
+}
+
+var optionsMetrics optionsMetricsStruct
+
+/*============================================================================*/
+// Dev options
+type optionsDevStruct struct {
+	Functions  []string `validate:"-"`
+	Tail       bool     `validate:"-"`
+	Watch      bool     `validate:"-"`
+	Localstack string   `validate:"-"`
+}
+
+var optionsDev optionsDevStruct
+
+// DevOptions are the options for the dev command
+type DevOptions struct {
+	// Functions are the names or logical resource IDs of the functions to
+	// update. All functions are updated if empty.
+	Functions []string
+	// Tail logs the CloudWatch Logs events of the updated functions until
+	// the process is interrupted
+	Tail bool
+	// Watch rebuilds and updates the functions when the Go source files in
+	// the working directory change, until the process is interrupted. The
+	// function logs are always tailed in watch mode.
+	Watch bool
+	// WorkflowHooks optionally provides the ArchiveHooks that add files to
+	// the code archive, as in provision. Its AWSClients optionally replace
+	// the clients created from the session.
+	WorkflowHooks *WorkflowHooks
+	// Localstack is the optional localstack endpoint to use rather than AWS
+	Localstack string
+}
+
+/*============================================================================*/
+// Local invoke options
+type optionsLocalInvokeStruct struct {
+	Function    string `validate:"required"`
+	Event       string `validate:"-"`
+	EventSource string `validate:"-"`
+}
+
+var optionsLocalInvoke optionsLocalInvokeStruct
+
+// LocalInvokeOptions are the options for the local invoke command
+type LocalInvokeOptions struct {
+	// FunctionName is the name or logical resource ID of the function
+	// to invoke
+	FunctionName string
+	// EventPath is the path to the JSON event file, or "-" to read the
+	// event from stdin. An empty object is used if neither EventPath nor
+	// EventSource is provided.
+	EventPath string
+	// EventSource is the name of the mock event (eg, "s3") to invoke the
+	// function with. See events.MockEventSources for the supported names.
+	EventSource string
+	// Output is where the response is written. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+/*============================================================================*/
+// Local start-api options
+type optionsLocalStartAPIStruct struct {
+	Host string `validate:"required"`
+	Port int    `validate:"min=1,max=65535"`
+}
+
+var optionsLocalStartAPI optionsLocalStartAPIStruct
+
+// LocalStartAPIOptions are the options for the local start-api command
+type LocalStartAPIOptions struct {
+	// Host is the interface address the API is served on
+	Host string
+	// Port is the port the API is served on
+	Port int
+}
+
 /*============================================================================*/
 // Initialization
 // Initialize all the Cobra commands and their associated flags
@@ -255,6 +467,130 @@ func init() {
 		"c",
 		false,
 		"If the provision operation results in *only* function updates, bypass CloudFormation")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.StrictIAM,
+		"strictIAM",
+		"",
+		false,
+		"Fail if a function's IAM privileges grant broad (eg, s3:*) actions")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.ValidateIAM,
+		"validateIAM",
+		"",
+		false,
+		"Validate the generated IAM role policies with IAM Access Analyzer")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.StackSet,
+		"stackSet",
+		"",
+		"",
+		"Optional path to a JSON StackSet deployment that publishes the service to multiple accounts and regions")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.TemplateFile,
+		"templateFile",
+		"",
+		"",
+		"Optional path to write the generated CloudFormation template")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.TemplateFormat,
+		"templateFormat",
+		"",
+		TemplateFormatJSON,
+		"Format of the --templateFile output (json, yaml)")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.OTLPEndpoint,
+		"otlpEndpoint",
+		"",
+		"",
+		"Optional OpenTelemetry OTLP/HTTP endpoint (eg, http://localhost:4318) that receives a span for each provisioning step")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.Interactive,
+		"interactive",
+		"",
+		false,
+		"Display provisioning progress and stack events in an interactive terminal view. Ignored in CI environments.")
+	CommandLineOptions.Provision.Flags().BoolVarP(&optionsProvision.ForceUnlock,
+		"forceUnlock",
+		"",
+		false,
+		"Release an existing provision lock for the stack before provisioning. Only use this if the lock holder is no longer running.")
+	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.Localstack,
+		"localstack",
+		"",
+		"",
+		fmt.Sprintf("Provision to the localstack endpoint rather than AWS. Defaults to %s if the flag doesn't include a value. Overrides the %s environment variable.",
+			spartaAWS.DefaultLocalstackEndpoint,
+			spartaAWS.LocalstackEndpointEnvVar))
+	CommandLineOptions.Provision.Flags().Lookup("localstack").NoOptDefVal = spartaAWS.DefaultLocalstackEndpoint
+	CommandLineOptions.Provision.Flags().IntVarP(&optionsProvision.MaxRetries,
+		"maxRetries",
+		"",
+		0,
+		"Maximum number of times throttled or failed AWS API requests are retried. Defaults to the WorkflowHooks.RetryPolicy or default policy value.")
+	CommandLineOptions.Provision.Flags().StringArrayVarP(&optionsProvision.Parameters,
+		"parameter",
+		"",
+		nil,
+		"Stack parameter value as Key=Value. Use Key without a value to keep the stack's existing value. May be repeated.")
+
+	// Package
+	CommandLineOptions.Package = &cobra.Command{
+		Use:          "package",
+		Short:        "Package service",
+		Long:         `Build the service artifacts and CloudFormation template without deploying`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Package.Flags().StringVarP(&optionsPackage.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket referenced by the template for Lambda source")
+	CommandLineOptions.Package.Flags().StringVarP(&optionsPackage.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Package.Flags().StringVarP(&optionsPackage.OutputDirectory,
+		"out",
+		"o",
+		"",
+		"Output directory for the template, artifacts and manifest.json")
+	CommandLineOptions.Package.Flags().BoolVarP(&optionsPackage.Upload,
+		"upload",
+		"u",
+		false,
+		"Upload the artifacts to the S3 bucket")
+	CommandLineOptions.Package.Flags().StringVarP(&optionsPackage.TemplateFormat,
+		"templateFormat",
+		"",
+		TemplateFormatJSON,
+		"Format of the packaged template (json, yaml, sam)")
+
+	// Export
+	CommandLineOptions.Export = &cobra.Command{
+		Use:          "export",
+		Short:        "Export service",
+		Long:         `Build the service artifacts and export the service to another infrastructure as code format`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket referenced by the exported configuration for Lambda source")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.OutputDirectory,
+		"out",
+		"o",
+		"",
+		"Output directory for the exported configuration, artifacts and manifest.json")
+	CommandLineOptions.Export.Flags().BoolVarP(&optionsExport.Upload,
+		"upload",
+		"u",
+		false,
+		"Upload the artifacts to the S3 bucket")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.Format,
+		"format",
+		"",
+		ExportFormatTerraform,
+		"Export format (terraform). Overrides the global log format flag.")
 
 	// Delete
 	CommandLineOptions.Delete = &cobra.Command{
@@ -283,12 +619,17 @@ func init() {
 		"out",
 		"o",
 		"",
-		"Output file for HTML description")
+		"Output file for the description")
 	CommandLineOptions.Describe.Flags().StringVarP(&optionsDescribe.S3Bucket,
 		"s3Bucket",
 		"s",
 		"",
 		"S3 Bucket to use for Lambda source")
+	CommandLineOptions.Describe.Flags().StringVarP(&optionsDescribe.OutputFormat,
+		"outputFormat",
+		"",
+		DescribeFormatHTML,
+		"Description format (html, mermaid, dot, openapi)")
 
 	// Explore
 	CommandLineOptions.Explore = &cobra.Command{
@@ -327,6 +668,133 @@ func init() {
 		"r",
 		false,
 		"Redact AWS Account ID from report")
+	CommandLineOptions.Status.Flags().BoolVarP(&optionsStatus.DetectDrift, "detectDrift",
+		"",
+		false,
+		"Run stack drift detection before reporting the drift status")
+	CommandLineOptions.Status.Flags().IntVarP(&optionsStatus.EventCount, "events",
+		"e",
+		10,
+		"Number of recent stack events to report")
+	CommandLineOptions.Status.Flags().StringVarP(&optionsStatus.Localstack,
+		"localstack",
+		"",
+		"",
+		fmt.Sprintf("Report the status of the stack provisioned to the localstack endpoint rather than AWS. Defaults to %s if the flag doesn't include a value. Overrides the %s environment variable.",
+			spartaAWS.DefaultLocalstackEndpoint,
+			spartaAWS.LocalstackEndpointEnvVar))
+	CommandLineOptions.Status.Flags().Lookup("localstack").NoOptDefVal = spartaAWS.DefaultLocalstackEndpoint
+
+	// Metrics
+	CommandLineOptions.Metrics = &cobra.Command{
+		Use:          "metrics",
+		Short:        "Summarize recent function performance",
+		Long:         `Summarize the CloudWatch metrics of each provisioned Lambda function`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Metrics.Flags().DurationVarP(&optionsMetrics.Window,
+		"window",
+		"w",
+		time.Hour,
+		"Metrics window ending now (eg: 15m, 1h, 24h)")
+	CommandLineOptions.Metrics.Flags().StringVarP(&optionsMetrics.OutputFormat,
+		"outputFormat",
+		"",
+		MetricsFormatTable,
+		"Metrics format (table, json)")
+
+	// Rollback
+	CommandLineOptions.Rollback = &cobra.Command{
+		Use:          "rollback",
+		Short:        "Roll back to the previous deployment",
+		Long:         `Revert the provisioned service to the template and code of the previous deployment`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Rollback.Flags().StringVarP(&optionsRollback.Localstack,
+		"localstack",
+		"",
+		"",
+		fmt.Sprintf("Roll back the stack provisioned to the localstack endpoint rather than AWS. Defaults to %s if the flag doesn't include a value. Overrides the %s environment variable.",
+			spartaAWS.DefaultLocalstackEndpoint,
+			spartaAWS.LocalstackEndpointEnvVar))
+	CommandLineOptions.Rollback.Flags().Lookup("localstack").NoOptDefVal = spartaAWS.DefaultLocalstackEndpoint
+
+	// Dev
+	CommandLineOptions.Dev = &cobra.Command{
+		Use:          "dev",
+		Short:        "Update function code without CloudFormation",
+		Long:         `Build the service and update the code of the provisioned functions directly, skipping the template, S3 upload and CloudFormation`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Dev.Flags().StringArrayVarP(&optionsDev.Functions,
+		"function",
+		"",
+		nil,
+		"Function name or logical resource ID to update. May be repeated. Defaults to all functions")
+	CommandLineOptions.Dev.Flags().BoolVarP(&optionsDev.Tail,
+		"tail",
+		"",
+		false,
+		"Tail the updated functions' CloudWatch logs")
+	CommandLineOptions.Dev.Flags().BoolVarP(&optionsDev.Watch,
+		"watch",
+		"",
+		false,
+		"Rebuild and update the functions when Go source files change")
+	CommandLineOptions.Dev.Flags().StringVarP(&optionsDev.Localstack,
+		"localstack",
+		"",
+		"",
+		fmt.Sprintf("Update the functions provisioned to the localstack endpoint rather than AWS. Defaults to %s if the flag doesn't include a value. Overrides the %s environment variable.",
+			spartaAWS.DefaultLocalstackEndpoint,
+			spartaAWS.LocalstackEndpointEnvVar))
+	CommandLineOptions.Dev.Flags().Lookup("localstack").NoOptDefVal = spartaAWS.DefaultLocalstackEndpoint
+
+	// Local
+	CommandLineOptions.Local = &cobra.Command{
+		Use:          "local",
+		Short:        "Run functions locally",
+		Long:         `Run the service's functions in-process, without Docker or a deployment`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.LocalInvoke = &cobra.Command{
+		Use:          "invoke",
+		Short:        "Invoke a function locally",
+		Long:         `Invoke a function in-process with a JSON event and print the response`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.LocalInvoke.Flags().StringVarP(&optionsLocalInvoke.Function,
+		"function",
+		"f",
+		"",
+		"Function name or logical resource ID to invoke")
+	CommandLineOptions.LocalInvoke.Flags().StringVarP(&optionsLocalInvoke.Event,
+		"event",
+		"e",
+		"",
+		"Path to the JSON event file, or \"-\" to read the event from stdin")
+	CommandLineOptions.LocalInvoke.Flags().StringVarP(&optionsLocalInvoke.EventSource,
+		"eventSource",
+		"",
+		"",
+		fmt.Sprintf("Invoke the function with a mock event. One of: %s",
+			strings.Join(spartaAWSEvents.MockEventSources(), ", ")))
+	CommandLineOptions.LocalStartAPI = &cobra.Command{
+		Use:          "start-api",
+		Short:        "Serve the API Gateway resources locally",
+		Long:         `Serve the API Gateway resources on localhost and invoke the functions in-process for each request`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.LocalStartAPI.Flags().StringVarP(&optionsLocalStartAPI.Host,
+		"host",
+		"",
+		"127.0.0.1",
+		"Interface address to serve the API on")
+	CommandLineOptions.LocalStartAPI.Flags().IntVarP(&optionsLocalStartAPI.Port,
+		"port",
+		"p",
+		3000,
+		"Port to serve the API on")
 }
 
 // CommandLineOptionsHook allows embedding applications the ability
@@ -406,12 +874,16 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 	spartaCommands := []*cobra.Command{
 		CommandLineOptions.Version,
 		CommandLineOptions.Provision,
+		CommandLineOptions.Package,
+		CommandLineOptions.Export,
 		CommandLineOptions.Delete,
 		CommandLineOptions.Execute,
 		CommandLineOptions.Describe,
 		CommandLineOptions.Explore,
 		CommandLineOptions.Profile,
 		CommandLineOptions.Status,
+		CommandLineOptions.Metrics,
+		CommandLineOptions.Rollback,
 	}
 	for _, eachCommand := range spartaCommands {
 		eachCommand.PreRunE = func(cmd *cobra.Command, args []string) error {
@@ -126,6 +126,84 @@ func Provision(noop bool,
 	return errors.New("Provision not supported for this binary")
 }
 
+// ProvisionEx is not available in the AWS Lambda binary
+func ProvisionEx(noop bool,
+	serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	inplace bool,
+	buildID string,
+	codePipelineTrigger string,
+	buildTags string,
+	linkerFlags string,
+	writer io.Writer,
+	workflowHooks *WorkflowHooks,
+	options *ProvisionOptions,
+	logger *logrus.Logger) error {
+	logger.Error("ProvisionEx() not supported in AWS Lambda binary")
+	return errors.New("ProvisionEx not supported for this binary")
+}
+
+// MarshalTemplate is not available in the AWS Lambda binary
+func MarshalTemplate(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3Bucket string,
+	buildID string,
+	buildTags string,
+	templateWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	logger.Error("MarshalTemplate() not supported in AWS Lambda binary")
+	return errors.New("MarshalTemplate not supported for this binary")
+}
+
+// Package is not available in the AWS Lambda binary
+func Package(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	outputDirectory string,
+	upload bool,
+	templateFormat string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	logger.Error("Package() not supported in AWS Lambda binary")
+	return errors.New("Package not supported for this binary")
+}
+
+// Export is not available in the AWS Lambda binary
+func Export(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3Bucket string,
+	useCGO bool,
+	buildID string,
+	outputDirectory string,
+	upload bool,
+	exportFormat string,
+	buildTags string,
+	linkerFlags string,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	logger.Error("Export() not supported in AWS Lambda binary")
+	return errors.New("Export not supported for this binary")
+}
+
 // Describe is not available in the AWS Lambda binary
 func Describe(serviceName string,
 	serviceDescription string,
@@ -142,6 +220,32 @@ func Describe(serviceName string,
 	return errors.New("Describe not supported for this binary")
 }
 
+// DescribeDiagram is not available in the AWS Lambda binary
+func DescribeDiagram(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api *API,
+	site *S3Site,
+	s3BucketName string,
+	buildTags string,
+	linkerFlags string,
+	diagramFormat string,
+	outputWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *logrus.Logger) error {
+	logger.Error("DescribeDiagram() not supported in AWS Lambda binary")
+	return errors.New("DescribeDiagram not supported for this binary")
+}
+
+// DescribeOpenAPI is not available in the AWS Lambda binary
+func DescribeOpenAPI(serviceName string,
+	api *API,
+	outputWriter io.Writer,
+	logger *logrus.Logger) error {
+	logger.Error("DescribeOpenAPI() not supported in AWS Lambda binary")
+	return errors.New("DescribeOpenAPI not supported for this binary")
+}
+
 // Explore is an interactive command that brings up a GUI to test
 // lambda functions previously deployed into AWS lambda. It's not supported in the
 // AWS binary build
@@ -176,6 +280,73 @@ func Status(serviceName string,
 	return errors.New("Status not supported for this binary")
 }
 
+// StatusEx is the command that produces a status report for a given
+// stack with the given options
+func StatusEx(serviceName string,
+	serviceDescription string,
+	options *StatusOptions,
+	logger *logrus.Logger) error {
+	return errors.New("StatusEx not supported for this binary")
+}
+
+// MetricsReport is the command that summarizes the CloudWatch metrics of the
+// provisioned functions
+func MetricsReport(serviceName string,
+	serviceDescription string,
+	window time.Duration,
+	outputFormat string,
+	logger *logrus.Logger) error {
+	return errors.New("MetricsReport not supported for this binary")
+}
+
+// Rollback is the command that reverts the provisioned stack to the
+// previous deployment
+func Rollback(serviceName string,
+	serviceDescription string,
+	noop bool,
+	logger *logrus.Logger) error {
+	return errors.New("Rollback not supported for this binary")
+}
+
+// RollbackEx is the command that reverts the provisioned stack to the
+// previous deployment
+func RollbackEx(serviceName string,
+	serviceDescription string,
+	options *RollbackOptions,
+	logger *logrus.Logger) error {
+	return errors.New("RollbackEx not supported for this binary")
+}
+
+// Dev is the command that updates the code of the provisioned functions
+// without CloudFormation
+func Dev(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	options *DevOptions,
+	buildTags string,
+	linkFlags string,
+	logger *logrus.Logger) error {
+	return errors.New("Dev not supported for this binary")
+}
+
+// LocalInvoke is the command that invokes a function in-process with an
+// event
+func LocalInvoke(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	options *LocalInvokeOptions,
+	logger *logrus.Logger) error {
+	return errors.New("LocalInvoke not supported for this binary")
+}
+
+// LocalStartAPI is the command that serves the API Gateway resources on
+// localhost
+func LocalStartAPI(serviceName string,
+	api APIGateway,
+	options *LocalStartAPIOptions,
+	logger *logrus.Logger) error {
+	return errors.New("LocalStartAPI not supported for this binary")
+}
+
 func platformLogSysInfo(lambdaFunc string, logger *logrus.Logger) {
 
 	// Setup the files and their respective log levels
@@ -245,5 +416,5 @@ func NewLoggerWithFormatter(level string, formatter logrus.Formatter) (*logrus.L
 	// writes output following an error.
 	// This was done as part of the XRay interceptor!
 	logger.Out = os.Stdout
-	return logger, nil
+	return applyLogBackend(logger), nil
 }
@@ -4,6 +4,7 @@ package sparta
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -55,7 +56,7 @@ func NewLoggerWithFormatter(level string, formatter logrus.Formatter) (*logrus.L
 		logger.Formatter = formatter
 	}
 	logger.Out = os.Stdout
-	return logger, nil
+	return applyLogBackend(logger), nil
 }
 
 // Main defines the primary handler for transforming an application into a Sparta package.  The
@@ -162,7 +163,29 @@ func MainEx(serviceName string,
 			}
 			// Save the BuildID
 			StampedBuildID = buildID
-			return Provision(OptionsGlobal.Noop,
+			provisionOptions := &ProvisionOptions{
+				StrictIAM:    optionsProvision.StrictIAM,
+				ValidateIAM:  optionsProvision.ValidateIAM,
+				ForceUnlock:  optionsProvision.ForceUnlock,
+				Localstack:   optionsProvision.Localstack,
+				MaxRetries:   optionsProvision.MaxRetries,
+				OTLPEndpoint: optionsProvision.OTLPEndpoint,
+				Interactive:  optionsProvision.Interactive,
+				Parameters:   optionsProvision.Parameters,
+				StackSet:     optionsProvision.StackSet,
+			}
+			// The --templateFormat flag only applies to the --templateFile output
+			var templateWriter io.Writer
+			if optionsProvision.TemplateFile != "" {
+				templateFile, templateFileErr := os.Create(optionsProvision.TemplateFile)
+				if templateFileErr != nil {
+					return errors.Wrapf(templateFileErr, "Failed to create template file")
+				}
+				defer templateFile.Close()
+				templateWriter = templateFile
+				provisionOptions.TemplateFormat = optionsProvision.TemplateFormat
+			}
+			return ProvisionEx(OptionsGlobal.Noop,
 				serviceName,
 				serviceDescription,
 				lambdaAWSInfos,
@@ -175,13 +198,78 @@ func MainEx(serviceName string,
 				optionsProvision.PipelineTrigger,
 				OptionsGlobal.BuildTags,
 				OptionsGlobal.LinkerFlags,
-				nil,
+				templateWriter,
 				workflowHooks,
+				provisionOptions,
 				OptionsGlobal.Logger)
 		}
 	}
 	CommandLineOptions.Root.AddCommand(CommandLineOptions.Provision)
 
+	//////////////////////////////////////////////////////////////////////////////
+	// Package
+	if nil == CommandLineOptions.Package.RunE {
+		CommandLineOptions.Package.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsPackage)
+			if nil != validateErr {
+				return validateErr
+			}
+			buildID, buildIDErr := provisionBuildID(optionsPackage.BuildID, OptionsGlobal.Logger)
+			if nil != buildIDErr {
+				return buildIDErr
+			}
+			StampedBuildID = buildID
+			return Package(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				api,
+				site,
+				optionsPackage.S3Bucket,
+				useCGO,
+				buildID,
+				optionsPackage.OutputDirectory,
+				optionsPackage.Upload,
+				optionsPackage.TemplateFormat,
+				OptionsGlobal.BuildTags,
+				OptionsGlobal.LinkerFlags,
+				workflowHooks,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Package)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Export
+	if nil == CommandLineOptions.Export.RunE {
+		CommandLineOptions.Export.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsExport)
+			if nil != validateErr {
+				return validateErr
+			}
+			buildID, buildIDErr := provisionBuildID(optionsExport.BuildID, OptionsGlobal.Logger)
+			if nil != buildIDErr {
+				return buildIDErr
+			}
+			StampedBuildID = buildID
+			return Export(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				api,
+				site,
+				optionsExport.S3Bucket,
+				useCGO,
+				buildID,
+				optionsExport.OutputDirectory,
+				optionsExport.Upload,
+				optionsExport.Format,
+				OptionsGlobal.BuildTags,
+				OptionsGlobal.LinkerFlags,
+				workflowHooks,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Export)
+
 	//////////////////////////////////////////////////////////////////////////////
 	// Delete
 	CommandLineOptions.Delete.RunE = func(cmd *cobra.Command, args []string) error {
@@ -220,17 +308,39 @@ func MainEx(serviceName string,
 				return fileWriterErr
 			}
 			defer fileWriter.Close()
-			describeErr := Describe(serviceName,
-				serviceDescription,
-				lambdaAWSInfos,
-				api,
-				site,
-				optionsDescribe.S3Bucket,
-				OptionsGlobal.BuildTags,
-				OptionsGlobal.LinkerFlags,
-				fileWriter,
-				workflowHooks,
-				OptionsGlobal.Logger)
+			var describeErr error
+			switch optionsDescribe.OutputFormat {
+			case DescribeFormatMermaid, DescribeFormatDOT:
+				describeErr = DescribeDiagram(serviceName,
+					serviceDescription,
+					lambdaAWSInfos,
+					api,
+					site,
+					optionsDescribe.S3Bucket,
+					OptionsGlobal.BuildTags,
+					OptionsGlobal.LinkerFlags,
+					optionsDescribe.OutputFormat,
+					fileWriter,
+					workflowHooks,
+					OptionsGlobal.Logger)
+			case DescribeFormatOpenAPI:
+				describeErr = DescribeOpenAPI(serviceName,
+					api,
+					fileWriter,
+					OptionsGlobal.Logger)
+			default:
+				describeErr = Describe(serviceName,
+					serviceDescription,
+					lambdaAWSInfos,
+					api,
+					site,
+					optionsDescribe.S3Bucket,
+					OptionsGlobal.BuildTags,
+					OptionsGlobal.LinkerFlags,
+					fileWriter,
+					workflowHooks,
+					OptionsGlobal.Logger)
+			}
 
 			if describeErr == nil {
 				describeErr = fileWriter.Sync()
@@ -287,14 +397,117 @@ func MainEx(serviceName string,
 			if nil != validateErr {
 				return validateErr
 			}
-			return Status(serviceName,
+			return StatusEx(serviceName,
 				serviceDescription,
-				optionsStatus.Redact,
+				&StatusOptions{
+					Redact:      optionsStatus.Redact,
+					DetectDrift: optionsStatus.DetectDrift,
+					EventCount:  optionsStatus.EventCount,
+					Localstack:  optionsStatus.Localstack,
+				},
 				OptionsGlobal.Logger)
 		}
 	}
 	CommandLineOptions.Root.AddCommand(CommandLineOptions.Status)
 
+	//////////////////////////////////////////////////////////////////////////////
+	// Metrics
+	if nil == CommandLineOptions.Metrics.RunE {
+		CommandLineOptions.Metrics.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsMetrics)
+			if nil != validateErr {
+				return validateErr
+			}
+			return MetricsReport(serviceName,
+				serviceDescription,
+				optionsMetrics.Window,
+				optionsMetrics.OutputFormat,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Metrics)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Rollback
+	if nil == CommandLineOptions.Rollback.RunE {
+		CommandLineOptions.Rollback.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsRollback)
+			if nil != validateErr {
+				return validateErr
+			}
+			return RollbackEx(serviceName,
+				serviceDescription,
+				&RollbackOptions{
+					Noop:       OptionsGlobal.Noop,
+					Localstack: optionsRollback.Localstack,
+				},
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Rollback)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Dev
+	if nil == CommandLineOptions.Dev.RunE {
+		CommandLineOptions.Dev.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsDev)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Dev(serviceName,
+				serviceDescription,
+				lambdaAWSInfos,
+				&DevOptions{
+					Functions:     optionsDev.Functions,
+					Tail:          optionsDev.Tail,
+					Watch:         optionsDev.Watch,
+					WorkflowHooks: workflowHooks,
+					Localstack:    optionsDev.Localstack,
+				},
+				OptionsGlobal.BuildTags,
+				OptionsGlobal.LinkerFlags,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Dev)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Local
+	if nil == CommandLineOptions.LocalInvoke.RunE {
+		CommandLineOptions.LocalInvoke.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsLocalInvoke)
+			if nil != validateErr {
+				return validateErr
+			}
+			return LocalInvoke(serviceName,
+				lambdaAWSInfos,
+				&LocalInvokeOptions{
+					FunctionName: optionsLocalInvoke.Function,
+					EventPath:    optionsLocalInvoke.Event,
+					EventSource:  optionsLocalInvoke.EventSource,
+				},
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Local.AddCommand(CommandLineOptions.LocalInvoke)
+	if nil == CommandLineOptions.LocalStartAPI.RunE {
+		CommandLineOptions.LocalStartAPI.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsLocalStartAPI)
+			if nil != validateErr {
+				return validateErr
+			}
+			return LocalStartAPI(serviceName,
+				api,
+				&LocalStartAPIOptions{
+					Host: optionsLocalStartAPI.Host,
+					Port: optionsLocalStartAPI.Port,
+				},
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Local.AddCommand(CommandLineOptions.LocalStartAPI)
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Local)
+
 	// Run it!
 	executedCmd, executeErr := CommandLineOptions.Root.ExecuteC()
 	if executeErr != nil {
@@ -4,12 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-xray-sdk-go/xray"
 	spartaCFResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
+	spartaIAM "github.com/mweagle/Sparta/aws/iam"
 	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
 )
 
 type StructHandler1 struct {
@@ -272,3 +280,1686 @@ func TestProvisionID(t *testing.T) {
 	}
 
 }
+
+func TestKafkaEventSourceMapping(t *testing.T) {
+	logger, _ := NewLogger("info")
+	secretArn := "arn:aws:secretsmanager:us-west-2:000000000000:secret:kafka"
+	mappings := []*EventSourceMapping{
+		{
+			EventSourceArn:   "arn:aws:kafka:us-west-2:000000000000:cluster/demo/abc",
+			StartingPosition: "LATEST",
+			Topics:           []string{"orders"},
+			ConsumerGroupID:  "orders-consumer",
+			SourceAccessConfigurations: []*SourceAccessConfiguration{
+				{
+					Type: SourceAccessTypeSASLSCRAM512Auth,
+					URI:  secretArn,
+				},
+			},
+		},
+		{
+			StartingPosition: "TRIM_HORIZON",
+			Topics:           []string{"events"},
+			SelfManagedKafka: &SelfManagedKafkaEventSource{
+				KafkaBootstrapServers: []string{"broker1.example.com:9092"},
+			},
+			SourceAccessConfigurations: []*SourceAccessConfiguration{
+				{
+					Type: SourceAccessTypeBasicAuth,
+					URI:  secretArn,
+				},
+				{
+					Type: SourceAccessTypeVPCSubnet,
+					URI:  "subnet-12345678",
+				},
+			},
+		},
+	}
+	template := gocf.NewTemplate()
+	for _, eachMapping := range mappings {
+		exportErr := eachMapping.export("KafkaService",
+			"kafkaConsumer",
+			gocf.String("arn:aws:lambda:us-west-2:000000000000:function:kafkaConsumer"),
+			"testBucket",
+			"testKey",
+			template,
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export Kafka EventSourceMapping: %s", exportErr)
+		}
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AmazonManagedKafkaEventSourceConfig",
+		"orders-consumer",
+		"KafkaBootstrapServers",
+		"SASL_SCRAM_512_AUTH",
+		"VPC_SUBNET"} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in Kafka EventSourceMapping template: %s",
+				eachExpected,
+				output)
+		}
+	}
+
+	role := IAMRoleDefinition{}
+	roleResource := role.toResource(mappings, nil, logger)
+	roleBytes, _ := json.Marshal(roleResource)
+	roleOutput := string(roleBytes)
+	for _, eachExpected := range []string{"kafka:DescribeCluster",
+		"secretsmanager:GetSecretValue",
+		"ec2:DescribeSecurityGroups"} {
+		if !strings.Contains(roleOutput, eachExpected) {
+			t.Fatalf("Failed to find %s in IAM role: %s", eachExpected, roleOutput)
+		}
+	}
+}
+
+func TestInvalidKafkaEventSourceMapping(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("InvalidKafka",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.EventSourceMappings = append(lambdaFn.EventSourceMappings, &EventSourceMapping{
+		EventSourceArn: "arn:aws:kafka:us-west-2:000000000000:cluster/demo/abc",
+		Topics:         []string{"events"},
+		SelfManagedKafka: &SelfManagedKafkaEventSource{
+			KafkaBootstrapServers: []string{"broker1.example.com:9092"},
+		},
+	})
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject self-managed Kafka with EventSourceArn"))
+}
+
+func TestScheduleExpressions(t *testing.T) {
+	validExpressions := []string{
+		"rate(1 minute)",
+		"rate(15 minutes)",
+		"rate(2 days)",
+		"at(2025-06-01T09:30:00)",
+		"cron(0 8 ? * MON-FRI *)",
+		"cron(0/15 * * * ? *)",
+		"cron(0 12 L * ? 2030)",
+		"cron(30 9 ? JAN,JUL 2#1 *)",
+	}
+	for _, eachExpression := range validExpressions {
+		if validationErr := validateScheduleExpression(eachExpression); validationErr != nil {
+			t.Fatalf("Failed to accept valid schedule expression %s: %s",
+				eachExpression,
+				validationErr)
+		}
+	}
+	invalidExpressions := []string{
+		"",
+		"rate(1 minutes)",
+		"rate(5 minute)",
+		"rate(0 hours)",
+		"rate(5 weeks)",
+		"at(2025-06-01 09:30)",
+		"cron(0 8 * * *)",
+		"cron(0 8 * * MON *)",
+		"cron(0 8 ? * ? *)",
+		"cron(60 8 ? * MON *)",
+		"cron(0 8 ? FOO MON *)",
+	}
+	for _, eachExpression := range invalidExpressions {
+		if validationErr := validateScheduleExpression(eachExpression); validationErr == nil {
+			t.Fatalf("Failed to reject invalid schedule expression %s", eachExpression)
+		}
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	logger, _ := NewLogger("info")
+	schedules := []*Schedule{
+		{
+			Expression: "cron(0 8 ? * MON-FRI *)",
+			Timezone:   "America/New_York",
+		},
+		{
+			Expression:                "rate(5 minutes)",
+			FlexibleTimeWindowMinutes: 15,
+			Input: map[string]string{
+				"source": "scheduler",
+			},
+		},
+	}
+	template := gocf.NewTemplate()
+	exportErr := exportSchedules("ScheduleService",
+		"ScheduledLambda",
+		gocf.GetAtt("ScheduledLambda", "Arn"),
+		schedules,
+		template,
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export schedules: %s", exportErr)
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AWS::Scheduler::Schedule",
+		SchedulerPrincipal,
+		"lambda:InvokeFunction",
+		"America/New_York",
+		"FLEXIBLE",
+		"MaximumWindowInMinutes",
+		`{\"source\":\"scheduler\"}`} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in schedule template: %s",
+				eachExpected,
+				output)
+		}
+	}
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("InvalidSchedule",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Schedules = append(lambdaFn.Schedules, &Schedule{
+		Expression: "rate(5 minutes)",
+		Timezone:   "Mars/Olympus_Mons",
+	})
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject invalid schedule timezone"))
+}
+
+func TestAsyncInvokeConfig(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("AsyncInvokeConfig",
+		mockLambda1,
+		IAMRoleDefinition{})
+	maxRetries := int64(1)
+	lambdaFn.Options.DeadLetterConfig = &AsyncDestination{
+		Type: AsyncDestinationSQS,
+	}
+	lambdaFn.Options.EventInvokeConfig = &EventInvokeConfig{
+		OnSuccess: &AsyncDestination{
+			Type: AsyncDestinationSNS,
+		},
+		OnFailure: &AsyncDestination{
+			Type: AsyncDestinationEventBridge,
+			Arn:  gocf.String("arn:aws:events:us-west-2:000000000000:event-bus/default"),
+		},
+		MaximumEventAgeInSeconds: 3600,
+		MaximumRetryAttempts:     &maxRetries,
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	invokeConfigResource, statements := exportEventInvokeConfig("AsyncLambda",
+		lambdaFn.Options.EventInvokeConfig,
+		"",
+		template,
+		logger)
+	if invokeConfigResource == nil || len(statements) != 2 {
+		t.Fatalf("Failed to export EventInvokeConfig")
+	}
+	policyName := exportAsyncPolicy("AsyncLambda", "AsyncLambdaRole", statements, template)
+	if policyName == "" {
+		t.Fatalf("Failed to export async invocation IAM policy")
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AWS::Lambda::EventInvokeConfig",
+		"AWS::SNS::Topic",
+		"sns:Publish",
+		"events:PutEvents",
+		"MaximumRetryAttempts"} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in async invocation template: %s",
+				eachExpected,
+				output)
+		}
+	}
+}
+
+func TestAsyncInvokeConfigQualifier(t *testing.T) {
+	logger, _ := NewLogger("info")
+	maxRetries := int64(0)
+	invokeConfig := &EventInvokeConfig{
+		MaximumRetryAttempts: &maxRetries,
+	}
+	for aliasName, expectedQualifier := range map[string]string{
+		"":     "$LATEST",
+		"live": "live",
+	} {
+		template := gocf.NewTemplate()
+		invokeConfigResource, _ := exportEventInvokeConfig("AsyncLambda",
+			invokeConfig,
+			aliasName,
+			template,
+			logger)
+		invokeConfigProperties, invokeConfigPropertiesOk := invokeConfigResource.Properties.(lambdaEventInvokeConfig)
+		if !invokeConfigPropertiesOk ||
+			invokeConfigProperties.Qualifier.Literal != expectedQualifier {
+			t.Fatalf("Unexpected EventInvokeConfig qualifier for alias %q: %#v",
+				aliasName,
+				invokeConfigResource.Properties)
+		}
+	}
+}
+
+func TestInvalidAsyncInvokeConfig(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("InvalidAsyncInvokeConfig",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.EventInvokeConfig = &EventInvokeConfig{
+		OnFailure: &AsyncDestination{
+			Type: AsyncDestinationLambda,
+		},
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject Lambda destination without an Arn"))
+}
+
+func TestProvisionedConcurrency(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ProvisionedConcurrency",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.ProvisionedConcurrency = &ProvisionedConcurrency{
+		ProvisionedConcurrentExecutions: 2,
+		AutoScaling: &ProvisionedConcurrencyAutoScaling{
+			MinCapacity: 1,
+			MaxCapacity: 10,
+		},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	template.AddResource("ProvisionedLambda", &gocf.LambdaFunction{
+		Handler: gocf.String("bootstrap"),
+	})
+	_, exportErr := exportPublishedAlias("ProvisionedService",
+		"ProvisionedLambda",
+		lambdaFn.Options,
+		"codeSHA256",
+		template,
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export provisioned concurrency: %s", exportErr)
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AWS::Lambda::Version",
+		"ProvisionedConcurrentExecutions",
+		"lambda:function:ProvisionedConcurrency",
+		"LambdaProvisionedConcurrencyUtilization",
+		`"TargetValue":0.7`} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in provisioned concurrency template: %s",
+				eachExpected,
+				output)
+		}
+	}
+}
+
+func TestInvalidProvisionedConcurrency(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("InvalidProvisionedConcurrency",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.ProvisionedConcurrency = &ProvisionedConcurrency{
+		ProvisionedConcurrentExecutions: 20,
+		AutoScaling: &ProvisionedConcurrencyAutoScaling{
+			MinCapacity: 1,
+			MaxCapacity: 10,
+		},
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject provisioned concurrency outside of the AutoScaling range"))
+}
+
+func TestDeploymentPreference(t *testing.T) {
+	hookFn, _ := NewAWSLambda("PreTrafficHook",
+		mockLambda2,
+		IAMRoleDefinition{
+			Privileges: []IAMRolePrivilege{CodeDeployLifecycleHookPrivilege},
+		})
+	lambdaFn, _ := NewAWSLambda("DeploymentPreference",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.AutoPublishAlias = "production"
+	lambdaFn.Options.DeploymentPreference = &DeploymentPreference{
+		Type:           DeploymentTypeCanary10Percent5Minutes,
+		Alarms:         []gocf.Stringable{gocf.String("ErrorAlarm")},
+		PreTrafficHook: hookFn,
+	}
+	lambdaFn.EventSourceMappings = append(lambdaFn.EventSourceMappings,
+		&EventSourceMapping{
+			StartingPosition: "TRIM_HORIZON",
+			EventSourceArn:   "arn:aws:kinesis:us-west-2:000000000000:stream/demo",
+		})
+	testProvision(t, []*LambdaAWSInfo{lambdaFn, hookFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	template.AddResource("DeploymentLambda", &gocf.LambdaFunction{
+		Handler: gocf.String("bootstrap"),
+	})
+	aliasResourceName, exportErr := exportPublishedAlias("DeploymentService",
+		"DeploymentLambda",
+		lambdaFn.Options,
+		"codeSHA256",
+		template,
+		logger)
+	if exportErr != nil || aliasResourceName == "" {
+		t.Fatalf("Failed to export published alias: %v", exportErr)
+	}
+	if template.Resources[aliasResourceName].UpdatePolicy == nil {
+		t.Fatalf("Failed to define CodeDeploy UpdatePolicy for alias")
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AWS::CodeDeploy::DeploymentGroup",
+		DeploymentTypeCanary10Percent5Minutes,
+		"CodeDeployLambdaAliasUpdate",
+		"BeforeAllowTrafficHook",
+		"ErrorAlarm",
+		"DEPLOYMENT_STOP_ON_ALARM",
+		"AWSCodeDeployRoleForLambda"} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in deployment template: %s",
+				eachExpected,
+				output)
+		}
+	}
+}
+
+func TestPublishedVersion(t *testing.T) {
+	logger, _ := NewLogger("info")
+	options := &LambdaFunctionOptions{
+		AutoPublishAlias: "live",
+	}
+	versionResourceName := func(codeSHA256 string, memorySize int64) string {
+		template := gocf.NewTemplate()
+		template.AddResource("VersionLambda", &gocf.LambdaFunction{
+			Code: &gocf.LambdaFunctionCode{
+				S3Key: gocf.String(codeSHA256 + ".zip"),
+			},
+			MemorySize: gocf.Integer(memorySize),
+		})
+		_, exportErr := exportPublishedAlias("VersionService",
+			"VersionLambda",
+			options,
+			codeSHA256,
+			template,
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export published alias: %s", exportErr)
+		}
+		for eachName, eachResource := range template.Resources {
+			if _, isVersion := eachResource.Properties.(*gocf.LambdaVersion); isVersion {
+				if eachResource.DeletionPolicy != "Retain" {
+					t.Fatalf("Failed to retain version %s", eachName)
+				}
+				return eachName
+			}
+		}
+		t.Fatalf("Failed to find AWS::Lambda::Version resource")
+		return ""
+	}
+	if versionResourceName("hash1", 128) != versionResourceName("hash1", 128) {
+		t.Fatalf("Failed to reuse version for unchanged code and configuration")
+	}
+	if versionResourceName("hash1", 128) == versionResourceName("hash2", 128) {
+		t.Fatalf("Failed to publish version for changed code")
+	}
+	if versionResourceName("hash1", 128) == versionResourceName("hash1", 256) {
+		t.Fatalf("Failed to publish version for changed configuration")
+	}
+}
+
+func TestPublishedAliasPermission(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("PublishedAliasPermission",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.AutoPublishAlias = "live"
+	lambdaFn.Permissions = append(lambdaFn.Permissions, SNSPermission{
+		BasePermission: BasePermission{
+			SourceArn: "arn:aws:sns:us-west-2:000000000000:topic",
+		},
+	})
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("PublishedAliasService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export lambda: %s", exportErr)
+	}
+	aliasArn := lambdaInvocationArn(lambdaFn)
+	permissionCount := 0
+	for eachName, eachResource := range template.Resources {
+		permission, isPermission := eachResource.Properties.(gocf.LambdaPermission)
+		if !isPermission {
+			continue
+		}
+		permissionCount++
+		if !reflect.DeepEqual(permission.FunctionName, aliasArn) {
+			t.Fatalf("Failed to target the published alias with permission %s", eachName)
+		}
+	}
+	if permissionCount == 0 {
+		t.Fatalf("Failed to find SNS permission")
+	}
+}
+
+func TestInvalidDeploymentPreference(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("InvalidDeploymentPreference",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.AutoPublishAlias = "production"
+	lambdaFn.Options.ProvisionedConcurrency = &ProvisionedConcurrency{
+		AliasName:                       "staging",
+		ProvisionedConcurrentExecutions: 1,
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject mismatched alias names"))
+}
+
+func TestEphemeralStorage(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("EphemeralStorage",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.EphemeralStorage = 2048
+	lambdaFn.Options.ReservedConcurrentExecutions = 5
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+}
+
+func TestInvalidFunctionOptions(t *testing.T) {
+	invalidOptions := []*LambdaFunctionOptions{
+		{MemorySize: 64},
+		{MemorySize: 20480},
+		{Timeout: 901},
+		{EphemeralStorage: 256},
+		{ReservedConcurrentExecutions: -1},
+		{Environment: map[string]*gocf.StringExpr{
+			"LARGE_VALUE": gocf.String(strings.Repeat("x", 4096)),
+		}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid function options: %#v", eachOptions)
+		}
+	}
+	lambdaFn, _ := NewAWSLambda("InvalidFunctionOptions",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.MemorySize = 10241
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject invalid MemorySize"))
+}
+
+func TestVPCConfig(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("VPCConfig",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.VPCDiscovery = &VPCConfig{
+		SubnetIDs:        []gocf.Stringable{gocf.String("subnet-1234"), gocf.String("subnet-5678")},
+		SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1234")},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("VPCConfigService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export VPCConfig: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{"subnet-5678", "sg-1234"} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in VPCConfig template", eachExpected)
+		}
+	}
+	// The execution role must be able to manage the network interfaces
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	if !strings.Contains(string(roleJSON), "ec2:CreateNetworkInterface") {
+		t.Fatalf("Failed to find VPC privileges in IAM role")
+	}
+}
+
+func TestInvalidVPCConfig(t *testing.T) {
+	invalidOptions := []*LambdaFunctionOptions{
+		{VPCDiscovery: &VPCConfig{
+			SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1234")},
+		}},
+		{VPCDiscovery: &VPCConfig{
+			SubnetTags: map[string]string{"Tier": "private"},
+		}},
+		{VpcConfig: &gocf.LambdaFunctionVPCConfig{},
+			VPCDiscovery: &VPCConfig{
+				SubnetIDs:        []gocf.Stringable{gocf.String("subnet-1234")},
+				SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1234")},
+			}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid VPCConfig: %#v", eachOptions)
+		}
+	}
+	// Tags must be resolved by the discovery decorator
+	lambdaFn, _ := NewAWSLambda("UnresolvedVPCConfig",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.VPCDiscovery = &VPCConfig{
+		SubnetTags:        map[string]string{"Tier": "private"},
+		SecurityGroupTags: map[string]string{"Tier": "lambda"},
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject unresolved VPCConfig tags"))
+}
+
+func TestFileSystemConfig(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("FileSystemConfig",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.VPCDiscovery = &VPCConfig{
+		SubnetIDs:        []gocf.Stringable{gocf.String("subnet-1234")},
+		SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1234")},
+	}
+	lambdaFn.Options.FileSystemConfigs = []*FileSystemConfig{
+		{
+			LocalMountPath: "/mnt/models",
+			FileSystemID:   gocf.String("fs-1234"),
+			RootDirectory:  "/lambda",
+			PosixUser: &FileSystemPosixUser{
+				UID: 1001,
+				GID: 1001,
+			},
+		},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("FileSystemConfigService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export FileSystemConfig: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{"AWS::EFS::AccessPoint", "FileSystemConfigs", "/mnt/models"} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in FileSystemConfig template", eachExpected)
+		}
+	}
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	if !strings.Contains(string(roleJSON), "elasticfilesystem:ClientWrite") {
+		t.Fatalf("Failed to find EFS privileges in IAM role")
+	}
+}
+
+func TestInvalidFileSystemConfig(t *testing.T) {
+	vpcConfig := &VPCConfig{
+		SubnetIDs:        []gocf.Stringable{gocf.String("subnet-1234")},
+		SecurityGroupIDs: []gocf.Stringable{gocf.String("sg-1234")},
+	}
+	invalidOptions := []*LambdaFunctionOptions{
+		// Missing VPC
+		{FileSystemConfigs: []*FileSystemConfig{
+			{LocalMountPath: "/mnt/data", FileSystemID: gocf.String("fs-1234")},
+		}},
+		// Invalid mount path
+		{VPCDiscovery: vpcConfig,
+			FileSystemConfigs: []*FileSystemConfig{
+				{LocalMountPath: "/tmp/data", FileSystemID: gocf.String("fs-1234")},
+			}},
+		// Both access point and file system
+		{VPCDiscovery: vpcConfig,
+			FileSystemConfigs: []*FileSystemConfig{
+				{LocalMountPath: "/mnt/data",
+					FileSystemID:   gocf.String("fs-1234"),
+					AccessPointArn: gocf.String("arn:aws:elasticfilesystem:us-west-2:123412341234:access-point/fsap-1234")},
+			}},
+		// Too many file systems
+		{VPCDiscovery: vpcConfig,
+			FileSystemConfigs: []*FileSystemConfig{
+				{LocalMountPath: "/mnt/data", FileSystemID: gocf.String("fs-1234")},
+				{LocalMountPath: "/mnt/models", FileSystemID: gocf.String("fs-5678")},
+			}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid FileSystemConfig: %#v", eachOptions)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("Secrets",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.KmsKey = gocf.GetAtt("EnvironmentKey", "Arn")
+	lambdaFn.Options.Secrets = map[string]*SecretReference{
+		"DB_PASSWORD": {
+			Source:  SecretSourceSecretsManager,
+			ID:      gocf.String("prod/db"),
+			JSONKey: "password",
+		},
+		"API_TOKEN": {
+			Source:    SecretSourceSSM,
+			ID:        gocf.String("/prod/api/token"),
+			KmsKeyArn: gocf.String("arn:aws:kms:us-west-2:123412341234:key/1234"),
+		},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("SecretsService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export Secrets: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{"SPARTA_SECRET_DB_PASSWORD", "prod/db", "EnvironmentKey"} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in Secrets template", eachExpected)
+		}
+	}
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	for _, eachExpected := range []string{"secretsmanager:GetSecretValue", "ssm:GetParameter", "kms:Decrypt"} {
+		if !strings.Contains(string(roleJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in IAM role", eachExpected)
+		}
+	}
+}
+
+func TestInvalidSecrets(t *testing.T) {
+	invalidOptions := []*LambdaFunctionOptions{
+		{KmsKeyArn: "arn:aws:kms:us-west-2:123412341234:key/1234",
+			KmsKey: gocf.String("arn:aws:kms:us-west-2:123412341234:key/5678")},
+		{Secrets: map[string]*SecretReference{
+			"INVALID-NAME": {Source: SecretSourceSSM, ID: gocf.String("/prod/token")},
+		}},
+		{Secrets: map[string]*SecretReference{
+			"TOKEN": {Source: SecretSourceSSM, ID: gocf.Ref("TokenParameter").String()},
+		}},
+		{Secrets: map[string]*SecretReference{
+			"TOKEN": {Source: SecretSourceSSM, ID: gocf.String("/prod/token"), JSONKey: "token"},
+		}},
+		{Secrets: map[string]*SecretReference{
+			"TOKEN": {Source: "vault", ID: gocf.String("token")},
+		}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid Secrets: %#v", eachOptions)
+		}
+	}
+}
+
+func TestInvalidDynamoDBResources(t *testing.T) {
+	partitionKey := &DynamoDBKey{AttributeName: "id", AttributeType: "S"}
+	tableArn := "arn:aws:dynamodb:us-west-2:123412341234:table/Orders"
+	invalidTables := []*DynamoDBResource{
+		{Name: "Invalid-Name", PartitionKey: partitionKey},
+		{Name: "Orders"},
+		{Name: "Orders", PartitionKey: partitionKey, TableArn: tableArn},
+		{Name: "Orders", TableArn: "arn:aws:s3:::orders"},
+		{Name: "Orders", TableArn: tableArn, StreamViewType: "NEW_IMAGE"},
+		{Name: "Orders", PartitionKey: &DynamoDBKey{AttributeName: "id", AttributeType: "BOOL"}},
+		{Name: "Orders", PartitionKey: partitionKey, StreamViewType: "ALL"},
+	}
+	for _, eachTable := range invalidTables {
+		options := &LambdaFunctionOptions{
+			DynamoDBResources: []*DynamoDBResource{eachTable},
+		}
+		if len(options.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid DynamoDBResource: %#v", eachTable)
+		}
+	}
+	duplicateOptions := &LambdaFunctionOptions{
+		DynamoDBResources: []*DynamoDBResource{
+			{Name: "Orders", PartitionKey: partitionKey},
+			{Name: "Orders", TableArn: tableArn},
+		},
+	}
+	if len(duplicateOptions.validate()) == 0 {
+		t.Fatalf("Failed to reject duplicate DynamoDBResource names")
+	}
+}
+
+func TestInvalidMessagingResources(t *testing.T) {
+	queueArn := "arn:aws:sqs:us-west-2:123412341234:orders"
+	topicArn := "arn:aws:sns:us-west-2:123412341234:orders"
+	invalidOptions := []*LambdaFunctionOptions{
+		{SQSResources: []*SQSResource{{Name: "Invalid-Name"}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", QueueArn: "arn:aws:sns:us-west-2:123412341234:orders"}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", QueueArn: queueArn, FIFO: true}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", QueueName: "orders", FIFO: true}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", QueueName: "orders.fifo"}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", ContentBasedDeduplication: true}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", RedrivePolicy: &SQSRedrivePolicy{}}}},
+		{SQSResources: []*SQSResource{{Name: "Orders", SendOnly: true, EventSource: &SQSEventSource{}}}},
+		{Timeout: 60,
+			SQSResources: []*SQSResource{{Name: "Orders", EventSource: &SQSEventSource{}}}},
+		{SQSResources: []*SQSResource{{Name: "Orders"}, {Name: "Orders", QueueArn: queueArn}}},
+		{SNSResources: []*SNSResource{{Name: "Invalid-Name"}}},
+		{SNSResources: []*SNSResource{{Name: "Orders", TopicArn: queueArn}}},
+		{SNSResources: []*SNSResource{{Name: "Orders", TopicArn: topicArn, DisplayName: "Orders"}}},
+		{SNSResources: []*SNSResource{{Name: "Orders", TopicName: "orders", FIFO: true}}},
+		{SNSResources: []*SNSResource{{Name: "Orders", ContentBasedDeduplication: true}}},
+		{SNSResources: []*SNSResource{{Name: "Orders"}, {Name: "Orders"}}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid messaging resources: %#v", eachOptions)
+		}
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	_, resolveErr := ResolveSecret(context.Background(), "UNDEFINED_SECRET")
+	if resolveErr == nil {
+		t.Fatalf("Failed to reject undefined secret")
+	}
+	// Previously resolved values are served from the cache
+	envValue := `{"source":"ssm","id":"/test/cached"}`
+	os.Setenv(envVarSecretPrefix+"CACHED_SECRET", envValue)
+	defer os.Unsetenv(envVarSecretPrefix + "CACHED_SECRET")
+	resolvedSecrets[envValue] = "cachedValue"
+	secretValue, resolveErr := ResolveSecret(context.Background(), "CACHED_SECRET")
+	if resolveErr != nil || secretValue != "cachedValue" {
+		t.Fatalf("Failed to resolve cached secret: %s (%v)", secretValue, resolveErr)
+	}
+}
+
+func TestSecretEnvValue(t *testing.T) {
+	// Keys and IDs may include the characters that a delimited format
+	// would split on
+	secretRef := &SecretReference{
+		Source:  SecretSourceSecretsManager,
+		ID:      gocf.String("arn:aws:secretsmanager:us-west-2:123412341234:secret:prod/db"),
+		JSONKey: "primary:password",
+	}
+	envRef := secretEnvReference{}
+	unmarshalErr := json.Unmarshal([]byte(secretRef.envValue().Literal), &envRef)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal secret reference: %s", unmarshalErr)
+	}
+	if envRef.Source != SecretSourceSecretsManager ||
+		envRef.JSONKey != "primary:password" ||
+		envRef.ID != "arn:aws:secretsmanager:us-west-2:123412341234:secret:prod/db" {
+		t.Fatalf("Unexpected secret reference: %#v", envRef)
+	}
+
+	// References are joined into the document
+	refSecret := &SecretReference{
+		Source: SecretSourceSecretsManager,
+		ID:     gocf.Ref("DatabaseSecret").String(),
+	}
+	joinParts := refSecret.envValue().Func.(gocf.JoinFunc).Items.Literal
+	if len(joinParts) != 3 ||
+		joinParts[0].Literal != `{"source":"secretsmanager","id":"` ||
+		joinParts[2].Literal != `"}` {
+		t.Fatalf("Unexpected secret reference: %#v", joinParts)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("Config",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.Config = map[string]*ConfigVariable{
+		"TABLE_NAME": {
+			Required: true,
+			Value:    gocf.Ref("OrdersTable").String(),
+		},
+		"BATCH_SIZE": {
+			Type:    ConfigValueInt,
+			Default: "25",
+		},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("ConfigService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export Config: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	if !strings.Contains(string(templateJSON), `"TABLE_NAME":{"Ref":"OrdersTable"}`) {
+		t.Fatalf("Failed to find TABLE_NAME in Config template: %s", string(templateJSON))
+	}
+	if strings.Contains(string(templateJSON), "BATCH_SIZE") {
+		t.Fatalf("Unexpected BATCH_SIZE in Config template: %s", string(templateJSON))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	invalidOptions := []*LambdaFunctionOptions{
+		{Config: map[string]*ConfigVariable{
+			"INVALID-NAME": {},
+		}},
+		{Config: map[string]*ConfigVariable{
+			"AWS_REGION": {},
+		}},
+		{Config: map[string]*ConfigVariable{
+			"BATCH_SIZE": {Type: "uint"},
+		}},
+		{Config: map[string]*ConfigVariable{
+			"BATCH_SIZE": {Type: ConfigValueInt, Default: "ten"},
+		}},
+		{Config: map[string]*ConfigVariable{
+			"BATCH_SIZE": {Type: ConfigValueInt, Required: true, Default: "10"},
+		}},
+		{Environment: map[string]*gocf.StringExpr{
+			"TABLE_NAME": gocf.String("orders"),
+		},
+			Config: map[string]*ConfigVariable{
+				"TABLE_NAME": {Value: gocf.String("customers")},
+			}},
+	}
+	for _, eachOptions := range invalidOptions {
+		if len(eachOptions.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid Config: %#v", eachOptions)
+		}
+	}
+}
+
+func TestLoadFunctionConfig(t *testing.T) {
+	declared := map[string]*ConfigVariable{
+		"TABLE_NAME": {Required: true},
+		"BATCH_SIZE": {Type: ConfigValueInt, Default: "25"},
+		"RATIO":      {Type: ConfigValueFloat},
+		"VERBOSE":    {Type: ConfigValueBool},
+		"DEADLINE":   {Type: ConfigValueDuration},
+		"API_URL":    {Required: true},
+	}
+	lookupEnv := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, exists := env[name]
+			return value, exists
+		}
+	}
+	config, configErr := loadFunctionConfig(declared, lookupEnv(map[string]string{
+		"TABLE_NAME": "orders",
+		"API_URL":    "https://example.com",
+		"RATIO":      "0.5",
+		"VERBOSE":    "true",
+		"DEADLINE":   "250ms",
+	}))
+	if configErr != nil {
+		t.Fatalf("Failed to load config: %s", configErr)
+	}
+	ctx := context.WithValue(context.Background(), ContextKeyConfig, config)
+	if Config(ctx).String("TABLE_NAME") != "orders" ||
+		Config(ctx).Int("BATCH_SIZE") != 25 ||
+		Config(ctx).Float("RATIO") != 0.5 ||
+		!Config(ctx).Bool("VERBOSE") ||
+		Config(ctx).Duration("DEADLINE") != 250*time.Millisecond {
+		t.Fatalf("Unexpected config values: %#v", config.values)
+	}
+	if _, exists := Config(context.Background()).Lookup("TABLE_NAME"); exists {
+		t.Fatalf("Expected an empty config without a context value")
+	}
+
+	// All missing and invalid values are reported together
+	_, configErr = loadFunctionConfig(declared, lookupEnv(map[string]string{
+		"BATCH_SIZE": "ten",
+	}))
+	if configErr == nil {
+		t.Fatalf("Failed to reject invalid config")
+	}
+	for _, eachExpected := range []string{"API_URL, TABLE_NAME", "BATCH_SIZE (int)"} {
+		if !strings.Contains(configErr.Error(), eachExpected) {
+			t.Fatalf("Failed to find %s in error: %s", eachExpected, configErr)
+		}
+	}
+}
+
+func TestCodeSigningConfig(t *testing.T) {
+	signingConfig := &CodeSigningConfig{
+		SigningProfileVersionArns: []gocf.Stringable{
+			gocf.String("arn:aws:signer:us-west-2:123412341234:/signing-profiles/SpartaProfile/abcdef"),
+		},
+		UntrustedArtifactOnDeployment: UntrustedArtifactOnDeploymentEnforce,
+		SigningProfileName:            "SpartaProfile",
+	}
+	lambdaFn1, _ := NewAWSLambda("CodeSigning1",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn1.Options.CodeSigningConfig = signingConfig
+	lambdaFn2, _ := NewAWSLambda("CodeSigning2",
+		mockLambda2,
+		IAMRoleDefinition{})
+	lambdaFn2.Options.CodeSigningConfig = signingConfig
+	testProvision(t, []*LambdaAWSInfo{lambdaFn1, lambdaFn2}, nil)
+
+	// Functions with the same configuration share the resource
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	for _, eachLambda := range []*LambdaAWSInfo{lambdaFn1, lambdaFn2} {
+		exportErr := eachLambda.export("CodeSigningService",
+			"testBucket",
+			"testKey",
+			"",
+			"testBuildID",
+			map[string]*gocf.StringExpr{},
+			template,
+			NewWorkflowHookContext(nil),
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export CodeSigningConfig: %s", exportErr)
+		}
+	}
+	signingConfigCount := 0
+	for _, eachResource := range template.Resources {
+		if eachResource.Properties.CfnResourceType() == "AWS::Lambda::CodeSigningConfig" {
+			signingConfigCount++
+		}
+	}
+	if signingConfigCount != 1 {
+		t.Fatalf("Expected a single CodeSigningConfig resource. Found: %d", signingConfigCount)
+	}
+}
+
+func TestInvalidCodeSigningConfig(t *testing.T) {
+	invalidConfigs := []*CodeSigningConfig{
+		{},
+		{Arn: gocf.String("arn:aws:lambda:us-west-2:123412341234:code-signing-config:csc-1234"),
+			SigningProfileVersionArns: []gocf.Stringable{gocf.String("arn:aws:signer:us-west-2:123412341234:/signing-profiles/Profile/abcdef")}},
+		{SigningProfileVersionArns: []gocf.Stringable{gocf.String("arn:aws:signer:us-west-2:123412341234:/signing-profiles/Profile/abcdef")},
+			UntrustedArtifactOnDeployment: "Ignore"},
+	}
+	for _, eachConfig := range invalidConfigs {
+		if eachConfig.validate() == nil {
+			t.Fatalf("Failed to reject invalid CodeSigningConfig: %#v", eachConfig)
+		}
+	}
+	// All functions share the same archive
+	lambdaFn1, _ := NewAWSLambda("CodeSigningProfile1",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn1.Options.CodeSigningConfig = &CodeSigningConfig{
+		Arn:                gocf.String("arn:aws:lambda:us-west-2:123412341234:code-signing-config:csc-1234"),
+		SigningProfileName: "Profile1",
+	}
+	lambdaFn2, _ := NewAWSLambda("CodeSigningProfile2",
+		mockLambda2,
+		IAMRoleDefinition{})
+	lambdaFn2.Options.CodeSigningConfig = &CodeSigningConfig{
+		Arn:                gocf.String("arn:aws:lambda:us-west-2:123412341234:code-signing-config:csc-1234"),
+		SigningProfileName: "Profile2",
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn1, lambdaFn2},
+		assertError("Failed to reject multiple signing profiles"))
+}
+
+func TestActiveTracing(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("ActiveTracing",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.ActiveTracing = true
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("ActiveTracingService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export ActiveTracing: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	if !strings.Contains(string(templateJSON), `"TracingConfig":{"Mode":"Active"}`) {
+		t.Fatalf("Failed to find Active TracingConfig in template")
+	}
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	if !strings.Contains(string(roleJSON), "xray:PutTraceSegments") {
+		t.Fatalf("Failed to find X-Ray privileges in IAM role")
+	}
+}
+
+func TestInvalidTracing(t *testing.T) {
+	invalidOptions := &LambdaFunctionOptions{
+		MemorySize:    128,
+		Timeout:       3,
+		ActiveTracing: true,
+		TracingConfig: &gocf.LambdaFunctionTracingConfig{
+			Mode: gocf.String(LambdaTracingModePassThrough),
+		},
+	}
+	if len(invalidOptions.validate()) == 0 {
+		t.Fatalf("Failed to reject conflicting TracingConfig")
+	}
+}
+
+func TestTraceSubsegment(t *testing.T) {
+	// Untraced contexts call the function directly
+	called := false
+	traceErr := TraceSubsegment(context.Background(),
+		"Untraced",
+		func(ctx context.Context) error {
+			called = true
+			if xray.GetSegment(ctx) != nil {
+				return errors.New("unexpected segment")
+			}
+			return nil
+		})
+	if traceErr != nil || !called {
+		t.Fatalf("Failed to call untraced function: %v", traceErr)
+	}
+
+	segmentCtx, segment := xray.BeginSegment(context.Background(), "TraceSubsegment")
+	defer segment.Close(nil)
+	traceErr = TraceSubsegment(segmentCtx,
+		"Traced",
+		func(ctx context.Context) error {
+			subsegment := xray.GetSegment(ctx)
+			if subsegment == nil || subsegment.Name != "Traced" {
+				return errors.New("missing subsegment")
+			}
+			return nil
+		})
+	if traceErr != nil {
+		t.Fatalf("Failed to trace subsegment: %s", traceErr)
+	}
+}
+
+func TestIAMRoleDefinitionOptions(t *testing.T) {
+	roleDefinition := IAMRoleDefinition{
+		PermissionsBoundary: gocf.String("arn:aws:iam::123412341234:policy/Boundary"),
+		Path:                "/sparta/",
+		RoleName:            "SpartaRoleDefinition",
+		ManagedPolicyArns: []gocf.Stringable{
+			gocf.String("arn:aws:iam::aws:policy/AWSXrayWriteOnlyAccess"),
+		},
+	}
+	lambdaFn, _ := NewAWSLambda("IAMRoleDefinitionOptions",
+		mockLambda1,
+		roleDefinition)
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	for _, eachExpected := range []string{"PermissionsBoundary",
+		"/sparta/",
+		"SpartaRoleDefinition",
+		"AWSXrayWriteOnlyAccess"} {
+		if !strings.Contains(string(roleJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in IAM role", eachExpected)
+		}
+	}
+}
+
+func TestInvalidIAMRoleDefinitionOptions(t *testing.T) {
+	invalidDefinitions := []*IAMRoleDefinition{
+		{Path: "sparta"},
+		{RoleName: "Invalid Role Name"},
+		{RoleName: strings.Repeat("x", 65)},
+	}
+	for _, eachDefinition := range invalidDefinitions {
+		if len(eachDefinition.validate()) == 0 {
+			t.Fatalf("Failed to reject invalid IAMRoleDefinition: %#v", eachDefinition)
+		}
+	}
+	lambdaFn1, _ := NewAWSLambda("IAMRoleName1",
+		mockLambda1,
+		IAMRoleDefinition{RoleName: "SpartaDuplicateRole"})
+	lambdaFn2, _ := NewAWSLambda("IAMRoleName2",
+		mockLambda2,
+		IAMRoleDefinition{RoleName: "SpartaDuplicateRole"})
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn1, lambdaFn2},
+		assertError("Failed to reject duplicate IAM role names"))
+}
+
+func TestIAMRolePrivilegeConditions(t *testing.T) {
+	roleDefinition := IAMRoleDefinition{
+		Privileges: []IAMRolePrivilege{
+			{
+				Effect:   "Deny",
+				Actions:  []string{"s3:*"},
+				Resource: spartaIAM.GlobalARN("s3", gocf.Ref("MyBucket"), gocf.String("/*")),
+				Condition: map[string]interface{}{
+					"Bool": map[string]string{
+						"aws:SecureTransport": "false",
+					},
+				},
+			},
+			{
+				NotActions:  []string{"iam:*"},
+				NotResource: spartaIAM.RegionalARN("sqs", gocf.String("MyQueue")),
+			},
+		},
+	}
+	lambdaFn, _ := NewAWSLambda("IAMRolePrivilegeConditions",
+		mockLambda1,
+		roleDefinition)
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	roleJSON, _ := json.Marshal(lambdaFn.RoleDefinition.toResource(nil,
+		lambdaFn.Options,
+		logger))
+	for _, eachExpected := range []string{`"Deny"`,
+		"aws:SecureTransport",
+		"NotAction",
+		"NotResource",
+		"AWS::Partition"} {
+		if !strings.Contains(string(roleJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in IAM role", eachExpected)
+		}
+	}
+}
+
+func TestInvalidIAMRolePrivilege(t *testing.T) {
+	invalidPrivileges := []IAMRolePrivilege{
+		{Actions: []string{"unknownservice:GetObject"}, Resource: "*"},
+		{Actions: []string{"s3GetObject"}, Resource: "*"},
+		{Actions: []string{"s3:GetObject"}, NotActions: []string{"s3:PutObject"}, Resource: "*"},
+		{Actions: []string{"s3:GetObject"}},
+		{Actions: []string{"s3:GetObject"}, Resource: "*", NotResource: "*"},
+		{Effect: "Maybe", Actions: []string{"s3:GetObject"}, Resource: "*"},
+	}
+	for _, eachPrivilege := range invalidPrivileges {
+		if eachPrivilege.validate() == nil {
+			t.Fatalf("Failed to reject invalid IAMRolePrivilege: %#v", eachPrivilege)
+		}
+	}
+	spartaIAM.RegisterServicePrefix("unknownservice")
+	if privilegeErr := invalidPrivileges[0].validate(); privilegeErr != nil {
+		t.Fatalf("Failed to accept registered service prefix: %s", privilegeErr)
+	}
+	mixedCasePrivilege := IAMRolePrivilege{
+		Actions:  []string{"SQS:ReceiveMessage", "UnknownService:GetObject"},
+		Resource: "*",
+	}
+	if privilegeErr := mixedCasePrivilege.validate(); privilegeErr != nil {
+		t.Fatalf("Failed to accept mixed case service prefix: %s", privilegeErr)
+	}
+	lambdaFn, _ := NewAWSLambda("InvalidIAMRolePrivilege",
+		mockLambda1,
+		IAMRoleDefinition{Privileges: invalidPrivileges[1:2]})
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject invalid IAM action"))
+}
+
+func TestTemplateParameters(t *testing.T) {
+	maxMemory := int64(3008)
+	parameters := map[string]*TemplateParameter{
+		"Stage": {
+			Default:       "dev",
+			AllowedValues: []string{"dev", "prod"},
+		},
+		"MemorySize": {
+			Type:     TemplateParameterTypeNumber,
+			Default:  "256",
+			MaxValue: &maxMemory,
+		},
+		"APIKey": {
+			NoEcho: true,
+		},
+	}
+	conditions := map[string]*TemplateCondition{
+		"IsProd": ConditionEquals(ParameterRef("Stage"), gocf.String("prod")),
+		"IsDev":  ConditionNot(ConditionReference("IsProd")),
+	}
+	template := gocf.NewTemplate()
+	exportErr := exportTemplateParameters(parameters, conditions, template)
+	if exportErr != nil {
+		t.Fatalf("Failed to export template parameters: %s", exportErr)
+	}
+	lambdaFn, _ := NewAWSLambda("TemplateParameters",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.MemorySizeParameter = "MemorySize"
+	lambdaFn.Options.Environment = map[string]*gocf.StringExpr{
+		"STAGE":     ParameterRef("Stage"),
+		"LOG_LEVEL": gocf.If("IsProd", gocf.String("warn"), gocf.String("debug")).String(),
+	}
+	logger, _ := NewLogger("info")
+	exportErr = lambdaFn.export("TemplateParametersService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export lambda with parameters: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{
+		`"AllowedValues":["dev","prod"]`,
+		`"NoEcho":true`,
+		`"IsProd":{"Fn::Equals":[{"Ref":"Stage"},"prod"]}`,
+		`"IsDev":{"Fn::Not":[{"Condition":"IsProd"}]}`,
+		`"MemorySize":{"Ref":"MemorySize"}`,
+		`"Fn::If":["IsProd","warn","debug"]`,
+	} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in template: %s", eachExpected, string(templateJSON))
+		}
+	}
+}
+
+func TestInvalidTemplateParameters(t *testing.T) {
+	invalidParameters := []map[string]*TemplateParameter{
+		{"Invalid-Name": {}},
+		{"Stage": {Default: "test", AllowedValues: []string{"dev", "prod"}}},
+		{"Memory": {Type: TemplateParameterTypeNumber, Default: "large"}},
+		{"Pattern": {AllowedPattern: "("}},
+	}
+	for _, eachParameters := range invalidParameters {
+		exportErr := exportTemplateParameters(eachParameters, nil, gocf.NewTemplate())
+		if exportErr == nil {
+			t.Fatalf("Failed to reject invalid parameters: %#v", eachParameters)
+		}
+	}
+	invalidConditions := []map[string]*TemplateCondition{
+		{"Missing": ConditionReference("Undefined")},
+		{"SingleAnd": ConditionAnd(ConditionReference("SingleAnd"))},
+	}
+	for _, eachConditions := range invalidConditions {
+		exportErr := exportTemplateParameters(nil, eachConditions, gocf.NewTemplate())
+		if exportErr == nil {
+			t.Fatalf("Failed to reject invalid conditions: %#v", eachConditions)
+		}
+	}
+	// Lambda parameters must be defined Numbers
+	template := gocf.NewTemplate()
+	exportErr := exportTemplateParameters(map[string]*TemplateParameter{
+		"Timeout": {},
+	}, nil, template)
+	if exportErr != nil {
+		t.Fatalf("Failed to export template parameters: %s", exportErr)
+	}
+	for _, eachParameter := range []string{"Timeout", "Undefined"} {
+		lambdaFn, _ := NewAWSLambda("InvalidTemplateParameters",
+			mockLambda1,
+			IAMRoleDefinition{})
+		lambdaFn.Options.TimeoutParameter = eachParameter
+		logger, _ := NewLogger("info")
+		exportErr = lambdaFn.export("InvalidTemplateParametersService",
+			"testBucket",
+			"testKey",
+			"",
+			"testBuildID",
+			map[string]*gocf.StringExpr{},
+			template,
+			NewWorkflowHookContext(nil),
+			logger)
+		if exportErr == nil {
+			t.Fatalf("Failed to reject invalid TimeoutParameter: %s", eachParameter)
+		}
+	}
+}
+
+func mockStreamingLambda(ctx context.Context,
+	msg json.RawMessage,
+	stream *ResponseStream) error {
+	_, writeErr := stream.Write([]byte("Hello World"))
+	return writeErr
+}
+
+func TestFunctionURL(t *testing.T) {
+	lambdaFn, _ := NewStreamingAWSLambda("FunctionURL",
+		mockStreamingLambda,
+		IAMRoleDefinition{})
+	lambdaFn.Options.AutoPublishAlias = "live"
+	lambdaFn.Options.FunctionURL = &FunctionURL{
+		AuthType:   FunctionURLAuthTypeNone,
+		InvokeMode: FunctionURLInvokeModeResponseStream,
+		Cors: &FunctionURLCors{
+			AllowOrigins: []string{"*"},
+			MaxAge:       300,
+		},
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	logger, _ := NewLogger("info")
+	template := gocf.NewTemplate()
+	exportErr := lambdaFn.export("FunctionURLService",
+		"testBucket",
+		"testKey",
+		"",
+		"testBuildID",
+		map[string]*gocf.StringExpr{},
+		template,
+		NewWorkflowHookContext(nil),
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export FunctionURL: %s", exportErr)
+	}
+	templateJSON, _ := json.Marshal(template)
+	for _, eachExpected := range []string{"AWS::Lambda::Url",
+		FunctionURLInvokeModeResponseStream,
+		`"Qualifier":"live"`,
+		"lambda:InvokeFunctionUrl",
+		`"FunctionUrlAuthType":"NONE"`,
+		StreamingLambdaRuntime} {
+		if !strings.Contains(string(templateJSON), eachExpected) {
+			t.Fatalf("Failed to find %s in FunctionURL template: %s",
+				eachExpected,
+				string(templateJSON))
+		}
+	}
+}
+
+func TestInvalidFunctionURL(t *testing.T) {
+	// Response streaming requires a StreamingHandler
+	lambdaFn, _ := NewAWSLambda("InvalidFunctionURL",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.FunctionURL = &FunctionURL{
+		InvokeMode: FunctionURLInvokeModeResponseStream,
+	}
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject RESPONSE_STREAM for a buffered handler"))
+
+	invalidURLs := []*FunctionURL{
+		{AuthType: "COGNITO"},
+		{InvokeMode: "STREAMING"},
+		{Cors: &FunctionURLCors{MaxAge: -1}},
+	}
+	for _, eachURL := range invalidURLs {
+		if eachURL.validate() == nil {
+			t.Fatalf("Failed to reject invalid FunctionURL: %#v", eachURL)
+		}
+	}
+}
+
+func TestLogGroup(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("LogGroup",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.LogGroup = &LogGroup{
+		RetentionInDays: 30,
+		KmsKeyArn:       gocf.GetAtt("LogsKey", "Arn"),
+		DataProtectionPolicy: ArbitraryJSONObject{
+			"Name": "data-protection-policy",
+		},
+		RetainOnDelete: true,
+	}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	exportTemplate := func(lambdaFn *LambdaAWSInfo) string {
+		logger, _ := NewLogger("info")
+		template := gocf.NewTemplate()
+		exportErr := lambdaFn.export("LogGroupService",
+			"testBucket",
+			"testKey",
+			"",
+			"testBuildID",
+			map[string]*gocf.StringExpr{},
+			template,
+			NewWorkflowHookContext(nil),
+			logger)
+		if exportErr != nil {
+			t.Fatalf("Failed to export LogGroup: %s", exportErr)
+		}
+		templateJSON, _ := json.Marshal(template)
+		return string(templateJSON)
+	}
+	templateJSON := exportTemplate(lambdaFn)
+	logGroupResourceName := CloudFormationResourceName("LogGroup",
+		lambdaFn.LogicalResourceName())
+	for _, eachExpected := range []string{"AWS::Logs::LogGroup",
+		`"RetentionInDays":30`,
+		`"KmsKeyId":{"Fn::GetAtt":["LogsKey","Arn"]}`,
+		"data-protection-policy",
+		`"DeletionPolicy":"Retain"`,
+		`"/aws/lambda/"`,
+		logGroupResourceName} {
+		if !strings.Contains(templateJSON, eachExpected) {
+			t.Fatalf("Failed to find %s in LogGroup template: %s",
+				eachExpected,
+				templateJSON)
+		}
+	}
+	if strings.Contains(templateJSON, "LoggingConfig") {
+		t.Fatalf("Unexpected LoggingConfig in LogGroup template: %s", templateJSON)
+	}
+
+	// Custom names are set in the function's LoggingConfig
+	lambdaFn, _ = NewAWSLambda("NamedLogGroup",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.LogGroup = &LogGroup{
+		Name: "/sparta/orders",
+	}
+	templateJSON = exportTemplate(lambdaFn)
+	if !strings.Contains(templateJSON, `"LoggingConfig":{"LogGroup":"/sparta/orders"}`) {
+		t.Fatalf("Failed to find LoggingConfig in LogGroup template: %s", templateJSON)
+	}
+}
+
+func TestDefaultLogGroup(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("DefaultLogGroup",
+		mockLambda1,
+		IAMRoleDefinition{})
+	customResourceName, _ := lambdaFn.RequireCustomResource(IAMRoleDefinition{},
+		userDefinedCustomResource1,
+		nil,
+		nil)
+	if customResourceName == "" {
+		t.Fatalf("Failed to create custom resource")
+	}
+	defaultLogGroup := &LogGroup{RetentionInDays: 14}
+	applyErr := applyDefaultLogGroup(lambdaFn, defaultLogGroup)
+	if applyErr != nil {
+		t.Fatalf("Failed to apply default LogGroup: %s", applyErr)
+	}
+	if lambdaFn.Options.LogGroup != defaultLogGroup ||
+		lambdaFn.customResources[0].options.LogGroup != defaultLogGroup {
+		t.Fatalf("Failed to apply default LogGroup")
+	}
+
+	// Function values take precedence
+	lambdaFn, _ = NewAWSLambda("ExplicitLogGroup",
+		mockLambda1,
+		IAMRoleDefinition{})
+	explicitLogGroup := &LogGroup{RetentionInDays: 365}
+	lambdaFn.Options.LogGroup = explicitLogGroup
+	_ = applyDefaultLogGroup(lambdaFn, defaultLogGroup)
+	if lambdaFn.Options.LogGroup != explicitLogGroup {
+		t.Fatalf("Failed to preserve function LogGroup")
+	}
+	if applyDefaultLogGroup(lambdaFn, &LogGroup{Name: "/shared"}) == nil {
+		t.Fatalf("Failed to reject default LogGroup Name")
+	}
+}
+
+func TestInvalidLogGroup(t *testing.T) {
+	invalidLogGroups := []*LogGroup{
+		{RetentionInDays: 2},
+		{RetentionInDays: -1},
+		{Name: "invalid name"},
+	}
+	for _, eachLogGroup := range invalidLogGroups {
+		if eachLogGroup.validate() == nil {
+			t.Fatalf("Failed to reject invalid LogGroup: %#v", eachLogGroup)
+		}
+	}
+	lambdaFn, _ := NewAWSLambda("InvalidLogGroup",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.LogGroup = invalidLogGroups[0]
+	testProvision(t,
+		[]*LambdaAWSInfo{lambdaFn},
+		assertError("Failed to reject invalid LogGroup RetentionInDays"))
+}
+
+func TestLambdaInsights(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("Insights",
+		mockLambda1,
+		IAMRoleDefinition{})
+	lambdaFn.Options.LambdaInsights = &LambdaInsights{}
+	testProvision(t, []*LambdaAWSInfo{lambdaFn}, nil)
+
+	template := gocf.NewTemplate()
+	layers, layersErr := lambdaLayers(lambdaFn, template)
+	if layersErr != nil || len(layers) != 1 {
+		t.Fatalf("Failed to add Lambda Insights layer: %v", layersErr)
+	}
+	if _, exists := template.Mappings[lambdaInsightsMappingName]; !exists {
+		t.Fatalf("Failed to add Lambda Insights layer mapping")
+	}
+	// Explicit layer ARNs don't require the mapping
+	lambdaFn.Options.LambdaInsights = &LambdaInsights{
+		LayerArn: gocf.String("arn:aws:lambda:us-west-2:580247275435:layer:LambdaInsightsExtension:14"),
+	}
+	template = gocf.NewTemplate()
+	layers, layersErr = lambdaLayers(lambdaFn, template)
+	if layersErr != nil || len(layers) != 1 || len(template.Mappings) != 0 {
+		t.Fatalf("Failed to use Lambda Insights LayerArn: %v", layersErr)
+	}
+	// Including the extension layer, functions support at most 5 layers
+	for i := 0; i != maxLambdaLayers; i++ {
+		lambdaFn.Layers = append(lambdaFn.Layers, gocf.String(fmt.Sprintf("layer%d", i)))
+	}
+	_, layersErr = lambdaLayers(lambdaFn, template)
+	if layersErr == nil {
+		t.Fatalf("Failed to reject too many layers")
+	}
+
+	logger, _ := NewLogger("info")
+	roleResource := &gocf.Resource{
+		Properties: lambdaFn.RoleDefinition.toResource(nil, lambdaFn.Options, logger),
+	}
+	roleJSON, _ := json.Marshal(roleResource.Properties)
+	if !strings.Contains(string(roleJSON), "CloudWatchLambdaInsightsExecutionRolePolicy") {
+		t.Fatalf("Failed to find Lambda Insights policy in IAM role")
+	}
+	// Shared roles only include the policy once
+	addLambdaInsightsPolicy(roleResource)
+	if len(roleResource.Properties.(gocf.IAMRole).ManagedPolicyArns.Literal) != 1 {
+		t.Fatalf("Failed to deduplicate Lambda Insights policy")
+	}
+}
+
+func TestDefaultLambdaInsights(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("DefaultInsights",
+		mockLambda1,
+		IAMRoleDefinition{})
+	defaultInsights := &LambdaInsights{}
+	applyDefaultLambdaInsights(lambdaFn, defaultInsights)
+	if lambdaFn.Options.LambdaInsights != defaultInsights {
+		t.Fatalf("Failed to apply default LambdaInsights")
+	}
+	// Function values take precedence
+	functionInsights := &LambdaInsights{LayerArn: gocf.String("layerArn")}
+	lambdaFn.Options.LambdaInsights = functionInsights
+	applyDefaultLambdaInsights(lambdaFn, defaultInsights)
+	if lambdaFn.Options.LambdaInsights != functionInsights {
+		t.Fatalf("Failed to preserve function LambdaInsights")
+	}
+}
+
+func TestFeatureFlag(t *testing.T) {
+	_, flagErr := FeatureFlag(context.Background(), "checkout")
+	if flagErr == nil {
+		t.Fatalf("Failed to reject FeatureFlag without AppConfig")
+	}
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if r.URL.Path != "/applications/orders/environments/production/configurations/flags" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"checkout":{"enabled":true},"beta":{"enabled":false}}`)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	testEnv := map[string]string{
+		"AWS_APPCONFIG_EXTENSION_HTTP_PORT": serverURL.Port(),
+		envVarAppConfigApplication:          "orders",
+		envVarAppConfigEnvironment:          "production",
+		envVarAppConfigProfile:              "flags",
+	}
+	for eachKey, eachValue := range testEnv {
+		os.Setenv(eachKey, eachValue)
+	}
+	defer func() {
+		for eachKey := range testEnv {
+			os.Unsetenv(eachKey)
+		}
+		appConfigFlags = nil
+	}()
+
+	enabled, flagErr := FeatureFlag(context.Background(), "checkout")
+	if flagErr != nil || !enabled {
+		t.Fatalf("Unexpected checkout flag: %t, %v", enabled, flagErr)
+	}
+	enabled, flagErr = FeatureFlag(context.Background(), "beta")
+	if flagErr != nil || enabled {
+		t.Fatalf("Unexpected beta flag: %t, %v", enabled, flagErr)
+	}
+	_, flagErr = FeatureFlag(context.Background(), "undefined")
+	if flagErr == nil {
+		t.Fatalf("Failed to reject undefined feature flag")
+	}
+	// The configuration is cached
+	if requestCount != 1 {
+		t.Fatalf("Unexpected AppConfig extension request count: %d", requestCount)
+	}
+}
@@ -3,24 +3,52 @@
 package sparta
 
 import (
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/sts"
-	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultDriftTimeout is the maximum time to wait for drift detection if
+// StatusOptions doesn't define one
+const defaultDriftTimeout = 5 * time.Minute
+
 // Status produces a status report for the given stack
 func Status(serviceName string,
 	serviceDescription string,
 	redact bool,
 	logger *logrus.Logger) error {
+	return StatusEx(serviceName,
+		serviceDescription,
+		&StatusOptions{
+			Redact:     redact,
+			EventCount: 10,
+		},
+		logger)
+}
 
-	awsSession := spartaAWS.NewSession(logger)
-	cfSvc := cloudformation.New(awsSession)
+// StatusEx produces a status report for the given stack that includes the
+// stack's build ID, drift status, recent stack events and the code SHA of
+// each deployed Lambda function.
+func StatusEx(serviceName string,
+	serviceDescription string,
+	options *StatusOptions,
+	logger *logrus.Logger) error {
+
+	if options == nil {
+		options = &StatusOptions{}
+	}
+	redact := options.Redact
+	awsSession := newWorkflowSession(options.Localstack, logger)
+	awsClients := newAWSClients(awsSession, options.AWSClients)
+	cfSvc := awsClients.CloudFormation
 
 	params := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(serviceName),
@@ -29,7 +57,7 @@ func Status(serviceName string,
 
 	if describeStacksResponseErr != nil {
 		if strings.Contains(describeStacksResponseErr.Error(), "does not exist") {
-			logger.WithField("Region", *awsSession.Config.Region).Info("Stack does not exist")
+			logger.WithField("Region", aws.StringValue(awsSession.Config.Region)).Info("Stack does not exist")
 			return nil
 		}
 		return describeStacksResponseErr
@@ -76,6 +104,39 @@ func Status(serviceName string,
 	if stackInfo.DeletionTime != nil {
 		logger.WithField("Time", stackInfo.DeletionTime.UTC().String()).Info("Deleted")
 	}
+	for _, eachTag := range stackInfo.Tags {
+		if *eachTag.Key == SpartaTagBuildIDKey {
+			logger.WithField("BuildID", *eachTag.Value).Info("Last Deployment")
+		}
+	}
+
+	// Drift?
+	driftFields := logrus.Fields{}
+	if options.DetectDrift {
+		driftTimeout := options.DriftTimeout
+		if driftTimeout <= 0 {
+			driftTimeout = defaultDriftTimeout
+		}
+		driftResponse, driftErr := spartaCF.DetectStackDrift(serviceName,
+			driftTimeout,
+			cfSvc,
+			nil,
+			logger)
+		if driftErr != nil {
+			return driftErr
+		}
+		driftFields["State"] = *driftResponse.StackDriftStatus
+		driftFields["DriftedResources"] = aws.Int64Value(driftResponse.DriftedStackResourceCount)
+		driftFields["Time"] = driftResponse.Timestamp.UTC().String()
+	} else if stackInfo.DriftInformation != nil {
+		driftFields["State"] = *stackInfo.DriftInformation.StackDriftStatus
+		if stackInfo.DriftInformation.LastCheckTimestamp != nil {
+			driftFields["Time"] = stackInfo.DriftInformation.LastCheckTimestamp.UTC().String()
+		}
+	}
+	if len(driftFields) != 0 {
+		logger.WithFields(driftFields).Info("Drift")
+	}
 
 	logger.Info()
 	if len(stackInfo.Parameters) != 0 {
@@ -106,5 +167,65 @@ func Status(serviceName string,
 		}
 		logger.Info()
 	}
+
+	// What code is deployed?
+	functions := make(map[string]string)
+	functionsErr := stackLambdaFunctions(cfSvc, serviceName, functions)
+	if functionsErr != nil {
+		return functionsErr
+	}
+	if len(functions) != 0 {
+		logSectionHeader("Lambda Functions", dividerLength, logger)
+		lambdaSvc := awsClients.Lambda
+		functionNames := make([]string, 0, len(functions))
+		for eachFunctionName := range functions {
+			functionNames = append(functionNames, eachFunctionName)
+		}
+		sort.Slice(functionNames, func(i, j int) bool {
+			return functions[functionNames[i]] < functions[functionNames[j]]
+		})
+		for _, eachFunctionName := range functionNames {
+			configResponse, configErr := lambdaSvc.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+				FunctionName: aws.String(eachFunctionName),
+			})
+			if configErr != nil {
+				return errors.Wrapf(configErr, "Failed to get configuration for function: %s", eachFunctionName)
+			}
+			logger.WithFields(logrus.Fields{
+				"FunctionName": eachFunctionName,
+				"CodeSha256":   aws.StringValue(configResponse.CodeSha256),
+				"LastModified": aws.StringValue(configResponse.LastModified),
+			}).Info(functions[eachFunctionName])
+		}
+		logger.Info()
+	}
+
+	// And the most recent stack events
+	if options.EventCount > 0 {
+		eventsResponse, eventsErr := cfSvc.DescribeStackEvents(&cloudformation.DescribeStackEventsInput{
+			StackName: aws.String(serviceName),
+		})
+		if eventsErr != nil {
+			return errors.Wrapf(eventsErr, "Failed to describe events for stack: %s", serviceName)
+		}
+		stackEvents := eventsResponse.StackEvents
+		if len(stackEvents) > options.EventCount {
+			stackEvents = stackEvents[0:options.EventCount]
+		}
+		if len(stackEvents) != 0 {
+			logSectionHeader("Recent Events", dividerLength, logger)
+			for _, eachEvent := range stackEvents {
+				eventFields := logrus.Fields{
+					"Time":   eachEvent.Timestamp.UTC().String(),
+					"Status": aws.StringValue(eachEvent.ResourceStatus),
+				}
+				if eachEvent.ResourceStatusReason != nil {
+					eventFields["Reason"] = redactor(*eachEvent.ResourceStatusReason)
+				}
+				logger.WithFields(eventFields).Info(aws.StringValue(eachEvent.LogicalResourceId))
+			}
+			logger.Info()
+		}
+	}
 	return nil
 }
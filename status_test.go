@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
 
 func TestStatus(t *testing.T) {
@@ -14,3 +18,32 @@ func TestStatus(t *testing.T) {
 		t.Fatalf("Failed to error for non-existent stack")
 	}
 }
+
+type mockStatusCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	describeCalls int
+}
+
+func (mockCF *mockStatusCloudFormation) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	mockCF.describeCalls++
+	return nil, awserr.New("ValidationError", "Stack with id StatusClients does not exist", nil)
+}
+
+func TestStatusAWSClients(t *testing.T) {
+	logger, _ := NewLogger("info")
+	cfSvc := &mockStatusCloudFormation{}
+	statusErr := StatusEx("StatusClients",
+		"Test desc",
+		&StatusOptions{
+			AWSClients: &AWSClients{
+				CloudFormation: cfSvc,
+			},
+		},
+		logger)
+	if statusErr != nil {
+		t.Fatalf("Failed to report non-existent stack: %s", statusErr)
+	}
+	if cfSvc.describeCalls != 1 {
+		t.Fatalf("Failed to use the injected CloudFormation client")
+	}
+}
@@ -0,0 +1,171 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Template limits
+//
+
+// CloudFormation template quotas
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/cloudformation-limits.html
+const (
+	maxTemplateResources  = 500
+	maxTemplateOutputs    = 200
+	maxTemplateParameters = 200
+	// Templates are provisioned from S3
+	maxTemplateBodyBytes = 1024 * 1024
+	// Percentage of a quota that triggers a warning
+	templateLimitWarningPercent = 80
+	// Number of constructs included in the report
+	templateLimitReportCount = 10
+)
+
+// templateLimit is a single CloudFormation template quota
+type templateLimit struct {
+	name       string
+	value      int
+	maximum    int
+	mitigation string
+}
+
+// templateContribution is the number of resources that a Sparta
+// construct contributed to the template
+type templateContribution struct {
+	construct string
+	count     int
+}
+
+// templateContributions returns the number of resources each Sparta
+// construct contributed to the template, sorted by descending count.
+// Resources that reference a lambda function are attributed to that
+// function. All other resources are grouped by type.
+func templateContributions(lambdaAWSInfos []*LambdaAWSInfo,
+	template *gocf.Template) ([]templateContribution, error) {
+
+	counts := make(map[string]int)
+	for eachResourceName, eachResource := range template.Resources {
+		resourceJSON, resourceJSONErr := json.Marshal(eachResource)
+		if resourceJSONErr != nil {
+			return nil, errors.Wrapf(resourceJSONErr,
+				"Failed to marshal resource: %s",
+				eachResourceName)
+		}
+		construct := ""
+		for _, eachLambda := range lambdaAWSInfos {
+			lambdaResourceName := eachLambda.LogicalResourceName()
+			if eachResourceName == lambdaResourceName ||
+				strings.Contains(string(resourceJSON), fmt.Sprintf(`"%s"`, lambdaResourceName)) {
+				construct = fmt.Sprintf("Lambda: %s", eachLambda.lambdaFunctionName())
+				break
+			}
+		}
+		if construct == "" && eachResource.Properties != nil {
+			construct = eachResource.Properties.CfnResourceType()
+		}
+		counts[construct]++
+	}
+	contributions := make([]templateContribution, 0)
+	for eachConstruct, eachCount := range counts {
+		contributions = append(contributions, templateContribution{
+			construct: eachConstruct,
+			count:     eachCount,
+		})
+	}
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].count != contributions[j].count {
+			return contributions[i].count > contributions[j].count
+		}
+		return contributions[i].construct < contributions[j].construct
+	})
+	return contributions, nil
+}
+
+// validateTemplateLimits ensures the marshaled template is within the
+// CloudFormation quotas. Limits that are nearly exceeded are logged as
+// warnings. If a limit is exceeded, the resources contributed by each
+// Sparta construct are logged together with mitigation hints.
+func validateTemplateLimits(lambdaAWSInfos []*LambdaAWSInfo,
+	template *gocf.Template,
+	templateBody []byte,
+	logger *logrus.Logger) error {
+
+	limits := []templateLimit{
+		{
+			name:       "Resources",
+			value:      len(template.Resources),
+			maximum:    maxTemplateResources,
+			mitigation: "Share IAMRoleDefinition pointers across functions, move infrastructure into a separate service, or use WorkflowHooks.NestedStacks to split the service into nested stacks",
+		},
+		{
+			name:       "Body size (bytes)",
+			value:      len(templateBody),
+			maximum:    maxTemplateBodyBytes,
+			mitigation: "Reduce inline content such as API Gateway mapping templates, Step Functions definitions, and CloudFormation Metadata",
+		},
+		{
+			name:       "Outputs",
+			value:      len(template.Outputs),
+			maximum:    maxTemplateOutputs,
+			mitigation: "Remove unused Outputs. Use sparta.Discover() to share resource information with functions.",
+		},
+		{
+			name:       "Parameters",
+			value:      len(template.Parameters),
+			maximum:    maxTemplateParameters,
+			mitigation: "Combine related Parameters or move configuration into SSM Parameter Store",
+		},
+	}
+	var errorText []string
+	for _, eachLimit := range limits {
+		logEntry := logger.WithFields(logrus.Fields{
+			"Limit":   eachLimit.name,
+			"Value":   eachLimit.value,
+			"Maximum": eachLimit.maximum,
+		})
+		if eachLimit.value > eachLimit.maximum {
+			logEntry.WithField("Mitigation", eachLimit.mitigation).
+				Error("CloudFormation template exceeds limit")
+			errorText = append(errorText, fmt.Sprintf("%s: %d (maximum: %d)",
+				eachLimit.name,
+				eachLimit.value,
+				eachLimit.maximum))
+		} else if eachLimit.value*100 >= eachLimit.maximum*templateLimitWarningPercent {
+			logEntry.WithField("Mitigation", eachLimit.mitigation).
+				Warn("CloudFormation template is approaching limit")
+		}
+	}
+	if len(errorText) == 0 {
+		return nil
+	}
+	// Report the largest contributors
+	contributions, contributionsErr := templateContributions(lambdaAWSInfos, template)
+	if contributionsErr != nil {
+		return contributionsErr
+	}
+	logger.Info("CloudFormation resources by Sparta construct")
+	for eachIndex, eachContribution := range contributions {
+		if eachIndex >= templateLimitReportCount {
+			break
+		}
+		logger.WithFields(logrus.Fields{
+			"Resources": eachContribution.count,
+		}).Info(eachContribution.construct)
+	}
+	return errors.Errorf("CloudFormation template exceeds limits: %s",
+		strings.Join(errorText, ", "))
+}
+
+//
+// END - Template limits
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,319 @@
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - Template Parameters & Conditions
+//
+
+// CloudFormation Parameter types
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/parameters-section-structure.html
+const (
+	// @enum TemplateParameterType
+	TemplateParameterTypeString = "String"
+	// @enum TemplateParameterType
+	TemplateParameterTypeNumber = "Number"
+	// @enum TemplateParameterType
+	TemplateParameterTypeNumberList = "List<Number>"
+	// @enum TemplateParameterType
+	TemplateParameterTypeCommaDelimitedList = "CommaDelimitedList"
+)
+
+var reTemplateLogicalName = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// TemplateParameter is a CloudFormation template Parameter. Parameter
+// values are supplied when the stack is created or updated (eg, by
+// CodePipeline or StackSet ParameterOverrides). Use ParameterRef to
+// reference the value in LambdaFunctionOptions.
+type TemplateParameter struct {
+	// Type is the parameter type. Defaults to TemplateParameterTypeString.
+	// AWS-specific types (eg, AWS::EC2::VPC::Id) are also supported.
+	Type string
+	// Description of the parameter
+	Description string
+	// Default is the value used if no value is supplied
+	Default string
+	// AllowedValues restricts the parameter to the set of values
+	AllowedValues []string
+	// AllowedPattern is a regular expression that String values must match
+	AllowedPattern string
+	// ConstraintDescription is displayed if the value is not allowed
+	ConstraintDescription string
+	// NoEcho masks the value in the console and API responses
+	NoEcho bool
+	// MinLength and MaxLength constrain String values. Zero values
+	// are ignored.
+	MinLength int64
+	MaxLength int64
+	// MinValue and MaxValue constrain Number values. Nil values are ignored.
+	MinValue *int64
+	MaxValue *int64
+}
+
+// validate ensures the parameter is well formed
+func (param *TemplateParameter) validate(name string) error {
+	if !reTemplateLogicalName.MatchString(name) {
+		return errors.Errorf("Parameter name %s must be alphanumeric", name)
+	}
+	if param.AllowedPattern != "" {
+		if _, patternErr := regexp.Compile(param.AllowedPattern); patternErr != nil {
+			return errors.Wrapf(patternErr, "Invalid AllowedPattern for Parameter %s", name)
+		}
+	}
+	if param.Default != "" && len(param.AllowedValues) != 0 {
+		defaultAllowed := false
+		for _, eachValue := range param.AllowedValues {
+			defaultAllowed = defaultAllowed || eachValue == param.Default
+		}
+		if !defaultAllowed {
+			return errors.Errorf("Parameter %s Default (%s) is not in AllowedValues",
+				name,
+				param.Default)
+		}
+	}
+	if param.Type == TemplateParameterTypeNumber && param.Default != "" {
+		if _, parseErr := strconv.ParseFloat(param.Default, 64); parseErr != nil {
+			return errors.Errorf("Parameter %s Default (%s) is not a Number",
+				name,
+				param.Default)
+		}
+	}
+	if param.MaxLength != 0 && param.MinLength > param.MaxLength {
+		return errors.Errorf("Parameter %s MinLength exceeds MaxLength", name)
+	}
+	if param.MinValue != nil && param.MaxValue != nil && *param.MinValue > *param.MaxValue {
+		return errors.Errorf("Parameter %s MinValue exceeds MaxValue", name)
+	}
+	return nil
+}
+
+// cfParameter returns the template representation
+func (param *TemplateParameter) cfParameter() *gocf.Parameter {
+	cfParam := &gocf.Parameter{
+		Type:                  param.Type,
+		Description:           param.Description,
+		Default:               param.Default,
+		AllowedValues:         param.AllowedValues,
+		AllowedPattern:        param.AllowedPattern,
+		ConstraintDescription: param.ConstraintDescription,
+	}
+	if cfParam.Type == "" {
+		cfParam.Type = TemplateParameterTypeString
+	}
+	if param.NoEcho {
+		cfParam.NoEcho = gocf.Bool(true)
+	}
+	if param.MinLength != 0 {
+		cfParam.MinLength = gocf.Integer(param.MinLength)
+	}
+	if param.MaxLength != 0 {
+		cfParam.MaxLength = gocf.Integer(param.MaxLength)
+	}
+	if param.MinValue != nil {
+		cfParam.MinValue = gocf.Integer(*param.MinValue)
+	}
+	if param.MaxValue != nil {
+		cfParam.MaxValue = gocf.Integer(*param.MaxValue)
+	}
+	return cfParam
+}
+
+// ParameterRef returns a reference to the named TemplateParameter that
+// can be used as a LambdaFunctionOptions value (eg, an Environment variable)
+func ParameterRef(name string) *gocf.StringExpr {
+	return gocf.Ref(name).String()
+}
+
+// TemplateCondition is a CloudFormation condition function. Create
+// conditions with ConditionEquals, ConditionAnd, ConditionOr, ConditionNot
+// and ConditionReference. Use gocf.If to select a value based on a
+// named condition.
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/intrinsic-function-reference-conditions.html
+type TemplateCondition struct {
+	fnName string
+	args   []interface{}
+}
+
+// MarshalJSON returns the condition function JSON
+func (condition *TemplateCondition) MarshalJSON() ([]byte, error) {
+	if condition.fnName == "Condition" {
+		return json.Marshal(map[string]interface{}{
+			condition.fnName: condition.args[0],
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		condition.fnName: condition.args,
+	})
+}
+
+// conditionReferences returns the names of the conditions that this
+// condition references
+func (condition *TemplateCondition) conditionReferences() []string {
+	if condition.fnName == "Condition" {
+		return []string{fmt.Sprintf("%v", condition.args[0])}
+	}
+	references := make([]string, 0)
+	for _, eachArg := range condition.args {
+		if childCondition, childConditionOk := eachArg.(*TemplateCondition); childConditionOk {
+			references = append(references, childCondition.conditionReferences()...)
+		}
+	}
+	return references
+}
+
+// ConditionEquals is true if the two values are equal (Fn::Equals)
+func ConditionEquals(left gocf.Stringable, right gocf.Stringable) *TemplateCondition {
+	return &TemplateCondition{
+		fnName: "Fn::Equals",
+		args:   []interface{}{left.String(), right.String()},
+	}
+}
+
+// ConditionAnd is true if all the conditions are true (Fn::And)
+func ConditionAnd(conditions ...*TemplateCondition) *TemplateCondition {
+	return newCompositeCondition("Fn::And", conditions)
+}
+
+// ConditionOr is true if any of the conditions is true (Fn::Or)
+func ConditionOr(conditions ...*TemplateCondition) *TemplateCondition {
+	return newCompositeCondition("Fn::Or", conditions)
+}
+
+// ConditionNot negates the condition (Fn::Not)
+func ConditionNot(condition *TemplateCondition) *TemplateCondition {
+	return newCompositeCondition("Fn::Not", []*TemplateCondition{condition})
+}
+
+// ConditionReference refers to another named condition
+func ConditionReference(name string) *TemplateCondition {
+	return &TemplateCondition{
+		fnName: "Condition",
+		args:   []interface{}{name},
+	}
+}
+
+func newCompositeCondition(fnName string, conditions []*TemplateCondition) *TemplateCondition {
+	args := make([]interface{}, len(conditions))
+	for eachIndex, eachCondition := range conditions {
+		args[eachIndex] = eachCondition
+	}
+	return &TemplateCondition{
+		fnName: fnName,
+		args:   args,
+	}
+}
+
+// validate ensures the condition is well formed
+func (condition *TemplateCondition) validate(name string) error {
+	if condition == nil {
+		return errors.Errorf("Condition %s is empty", name)
+	}
+	switch condition.fnName {
+	case "Fn::And", "Fn::Or":
+		if len(condition.args) < 2 || len(condition.args) > 10 {
+			return errors.Errorf("Condition %s %s requires between 2 and 10 conditions",
+				name,
+				condition.fnName)
+		}
+	case "Fn::Not":
+		if len(condition.args) != 1 {
+			return errors.Errorf("Condition %s Fn::Not requires a single condition", name)
+		}
+	}
+	for _, eachArg := range condition.args {
+		if childCondition, childConditionOk := eachArg.(*TemplateCondition); childConditionOk {
+			if childErr := childCondition.validate(name); childErr != nil {
+				return childErr
+			}
+		}
+	}
+	return nil
+}
+
+// exportTemplateParameters adds the user-defined Parameters and Conditions
+// to the template
+func exportTemplateParameters(parameters map[string]*TemplateParameter,
+	conditions map[string]*TemplateCondition,
+	template *gocf.Template) error {
+
+	// Stable ordering for error messages
+	parameterNames := make([]string, 0, len(parameters))
+	for eachName := range parameters {
+		parameterNames = append(parameterNames, eachName)
+	}
+	sort.Strings(parameterNames)
+	for _, eachName := range parameterNames {
+		eachParam := parameters[eachName]
+		if eachParam == nil {
+			return errors.Errorf("Parameter %s is empty", eachName)
+		}
+		if _, exists := template.Parameters[eachName]; exists {
+			return errors.Errorf("Parameter %s is already defined", eachName)
+		}
+		if validateErr := eachParam.validate(eachName); validateErr != nil {
+			return validateErr
+		}
+		if template.Parameters == nil {
+			template.Parameters = make(map[string]*gocf.Parameter)
+		}
+		template.Parameters[eachName] = eachParam.cfParameter()
+	}
+
+	conditionNames := make([]string, 0, len(conditions))
+	for eachName := range conditions {
+		conditionNames = append(conditionNames, eachName)
+	}
+	sort.Strings(conditionNames)
+	for _, eachName := range conditionNames {
+		eachCondition := conditions[eachName]
+		if !reTemplateLogicalName.MatchString(eachName) {
+			return errors.Errorf("Condition name %s must be alphanumeric", eachName)
+		}
+		if _, exists := template.Conditions[eachName]; exists {
+			return errors.Errorf("Condition %s is already defined", eachName)
+		}
+		if validateErr := eachCondition.validate(eachName); validateErr != nil {
+			return validateErr
+		}
+		for _, eachReference := range eachCondition.conditionReferences() {
+			if _, referenceExists := conditions[eachReference]; !referenceExists {
+				return errors.Errorf("Condition %s references undefined condition: %s",
+					eachName,
+					eachReference)
+			}
+		}
+		if template.Conditions == nil {
+			template.Conditions = make(map[string]interface{})
+		}
+		template.Conditions[eachName] = eachCondition
+	}
+	return nil
+}
+
+// templateParameterInteger returns a Number parameter reference. The
+// parameter must be defined in the template.
+func templateParameterInteger(name string, template *gocf.Template) (*gocf.IntegerExpr, error) {
+	param, paramExists := template.Parameters[name]
+	if !paramExists {
+		return nil, errors.Errorf("Parameter %s is not defined", name)
+	}
+	if param.Type != TemplateParameterTypeNumber {
+		return nil, errors.Errorf("Parameter %s must be of type %s",
+			name,
+			TemplateParameterTypeNumber)
+	}
+	return gocf.Ref(name).Integer(), nil
+}
+
+//
+// END - Template Parameters & Conditions
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,317 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	gocc "github.com/mweagle/go-cloudcondenser"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCodeStubAWSRequest is the AWS error code returned by the stub session
+// for requests that aren't handled
+const ErrCodeStubAWSRequest = "SpartaTestingStubRequest"
+
+// StubAWSRequestHandler is called for each AWS API request made with a stub
+// session. Populate the request's Data output (eg,
+// r.Data.(*s3.GetBucketLocationOutput)) or set r.Error.
+type StubAWSRequestHandler func(r *request.Request)
+
+// NewStubAWSSession returns an AWS session that doesn't make network
+// requests. Each API request is passed to the handler. If the handler is
+// nil, every request fails with an ErrCodeStubAWSRequest error.
+func NewStubAWSSession(handler StubAWSRequestHandler) *session.Session {
+	stubSession := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKIDSPARTATESTING", "SPARTATESTING", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	stubSession.Handlers.Send.Clear()
+	stubSession.Handlers.UnmarshalMeta.Clear()
+	stubSession.Handlers.ValidateResponse.Clear()
+	stubSession.Handlers.Unmarshal.Clear()
+	stubSession.Handlers.UnmarshalError.Clear()
+	stubSession.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+		if handler == nil {
+			r.Error = awserr.New(ErrCodeStubAWSRequest,
+				"AWS API requests aren't supported by the stub session: "+r.Operation.Name,
+				nil)
+			return
+		}
+		handler(r)
+	})
+	return stubSession
+}
+
+// DecoratorHarness calls workflow hooks and decorators with the same
+// arguments that the provision workflow supplies, without building or
+// provisioning the service. The templates produced by the decorators are
+// merged into Template so that tests can assert on the result.
+type DecoratorHarness struct {
+	ServiceName string
+	S3Bucket    string
+	S3Key       string
+	BuildID     string
+	Noop        bool
+	// Context is shared by all the hooks called by the harness
+	Context *sparta.WorkflowHookContext
+	// AWSSession defaults to a NewStubAWSSession(nil) session
+	AWSSession *session.Session
+	Logger     *logrus.Logger
+	// Template is the merged result of the decorators
+	Template *gocf.Template
+	// ResourceMetadata is the metadata published by TemplateDecorators,
+	// keyed by the Lambda function's logical resource name
+	ResourceMetadata map[string]map[string]interface{}
+}
+
+// NewDecoratorHarness returns a harness with default values
+func NewDecoratorHarness(t *testing.T) *DecoratorHarness {
+	logger, loggerErr := sparta.NewLogger("info")
+	if loggerErr != nil {
+		t.Fatalf("Failed to create test logger: %s", loggerErr)
+	}
+	harness := &DecoratorHarness{
+		ServiceName:      "SpartaTestingService",
+		S3Bucket:         "sparta-testing-bucket",
+		S3Key:            "SpartaTestingService/SpartaTestingService-code.zip",
+		BuildID:          "testBuildID",
+		Noop:             true,
+		AWSSession:       NewStubAWSSession(nil),
+		Logger:           logger,
+		Template:         gocf.NewTemplate(),
+		ResourceMetadata: make(map[string]map[string]interface{}),
+	}
+	harness.Context = sparta.NewWorkflowHookContext(nil)
+	harness.Context.Set(sparta.WorkflowHookContextKeyServiceName, harness.ServiceName)
+	harness.Context.Set(sparta.WorkflowHookContextKeyBuildID, harness.BuildID)
+	harness.Context.Set(sparta.WorkflowHookContextKeyS3Bucket, harness.S3Bucket)
+	harness.Context.Set(sparta.WorkflowHookContextKeyTemplate, harness.Template)
+	harness.Context.Set(sparta.WorkflowHookContextKeyCodeArchiveURL,
+		fmt.Sprintf("https://%s.s3.amazonaws.com/%s", harness.S3Bucket, harness.S3Key))
+	return harness
+}
+
+// mergeTemplate merges the decorator template into the harness template
+func (harness *DecoratorHarness) mergeTemplate(decoratorTemplate *gocf.Template) error {
+	safeMergeErrs := gocc.SafeMerge(decoratorTemplate, harness.Template)
+	if len(safeMergeErrs) != 0 {
+		return errors.Errorf("Failed to merge templates: %v", safeMergeErrs)
+	}
+	return nil
+}
+
+// RunWorkflowHook calls the WorkflowHook (eg, PreBuild, PostMarshall)
+func (harness *DecoratorHarness) RunWorkflowHook(hook sparta.WorkflowHookHandler) error {
+	return hook.DecorateWorkflow(harness.Context,
+		harness.ServiceName,
+		harness.S3Bucket,
+		harness.BuildID,
+		harness.AWSSession,
+		harness.Noop,
+		harness.Logger)
+}
+
+// RunServiceDecorator calls the ServiceDecorator with an empty template and
+// merges the result into Template
+func (harness *DecoratorHarness) RunServiceDecorator(decorator sparta.ServiceDecoratorHookHandler) error {
+	decoratorTemplate := gocf.NewTemplate()
+	decoratorErr := decorator.DecorateService(harness.Context,
+		harness.ServiceName,
+		decoratorTemplate,
+		harness.S3Bucket,
+		harness.S3Key,
+		harness.BuildID,
+		harness.AWSSession,
+		harness.Noop,
+		harness.Logger)
+	if decoratorErr != nil {
+		return decoratorErr
+	}
+	return harness.mergeTemplate(decoratorTemplate)
+}
+
+// RunTemplateDecorator calls the TemplateDecorator for the Lambda function
+// with an empty template and merges the result into Template
+func (harness *DecoratorHarness) RunTemplateDecorator(lambdaAWSInfo *sparta.LambdaAWSInfo,
+	decorator sparta.TemplateDecoratorHandler) error {
+
+	logicalResourceName := lambdaAWSInfo.LogicalResourceName()
+	lambdaResource := gocf.LambdaFunction{
+		Code: &gocf.LambdaFunctionCode{
+			S3Bucket: gocf.String(harness.S3Bucket),
+			S3Key:    gocf.String(harness.S3Key),
+		},
+		Handler: gocf.String(sparta.SpartaBinaryName),
+		Runtime: gocf.String(sparta.GoLambdaVersion),
+	}
+	if lambdaAWSInfo.Options != nil {
+		lambdaResource.Description = gocf.String(lambdaAWSInfo.Options.Description)
+		lambdaResource.MemorySize = gocf.Integer(lambdaAWSInfo.Options.MemorySize)
+		lambdaResource.Timeout = gocf.Integer(lambdaAWSInfo.Options.Timeout)
+		if lambdaAWSInfo.Options.DeadLetterConfigArn != nil {
+			lambdaResource.DeadLetterConfig = &gocf.LambdaFunctionDeadLetterConfig{
+				TargetArn: lambdaAWSInfo.Options.DeadLetterConfigArn.String(),
+			}
+		}
+	}
+	metadata := make(map[string]interface{})
+	decoratorTemplate := gocf.NewTemplate()
+	decoratorErr := decorator.DecorateTemplate(harness.ServiceName,
+		logicalResourceName,
+		lambdaResource,
+		metadata,
+		harness.S3Bucket,
+		harness.S3Key,
+		harness.BuildID,
+		decoratorTemplate,
+		harness.Context,
+		harness.Logger)
+	if decoratorErr != nil {
+		return decoratorErr
+	}
+	if len(metadata) != 0 {
+		harness.ResourceMetadata[logicalResourceName] = metadata
+	}
+	return harness.mergeTemplate(decoratorTemplate)
+}
+
+// RunServiceValidation calls the ServiceValidationHook with Template
+func (harness *DecoratorHarness) RunServiceValidation(hook sparta.ServiceValidationHookHandler) error {
+	return hook.ValidateService(harness.Context,
+		harness.ServiceName,
+		harness.Template,
+		harness.S3Bucket,
+		harness.S3Key,
+		harness.BuildID,
+		harness.AWSSession,
+		harness.Noop,
+		harness.Logger)
+}
+
+// ResourceNames returns the sorted logical names of the Template resources
+// with the given CloudFormation type (eg, AWS::SNS::Topic)
+func (harness *DecoratorHarness) ResourceNames(resourceType string) []string {
+	resourceNames := []string{}
+	for eachName, eachResource := range harness.Template.Resources {
+		if eachResource.Properties != nil &&
+			eachResource.Properties.CfnResourceType() == resourceType {
+			resourceNames = append(resourceNames, eachName)
+		}
+	}
+	sort.Strings(resourceNames)
+	return resourceNames
+}
+
+// AssertResource fails the test if the Template doesn't include the
+// resource with the given type. The resource properties are returned.
+func (harness *DecoratorHarness) AssertResource(t *testing.T,
+	logicalName string,
+	resourceType string) gocf.ResourceProperties {
+	resource, resourceExists := harness.Template.Resources[logicalName]
+	if !resourceExists || resource.Properties == nil {
+		t.Fatalf("Template doesn't include resource: %s", logicalName)
+	}
+	if resource.Properties.CfnResourceType() != resourceType {
+		t.Fatalf("Resource %s has type %s. Expected: %s",
+			logicalName,
+			resource.Properties.CfnResourceType(),
+			resourceType)
+	}
+	return resource.Properties
+}
+
+// AssertOutput fails the test if the Template doesn't include the Output
+func (harness *DecoratorHarness) AssertOutput(t *testing.T, outputName string) *gocf.Output {
+	output, outputExists := harness.Template.Outputs[outputName]
+	if !outputExists {
+		t.Fatalf("Template doesn't include output: %s", outputName)
+	}
+	return output
+}
+
+// ResourceProperties fails the test if the Template doesn't include the
+// resource with the given type. The JSON decoded resource properties are
+// returned so that intrinsic function values (eg, {"Ref": "MyTopic"}) can
+// be compared with TemplateValue and AssertTemplateValue.
+func (harness *DecoratorHarness) ResourceProperties(t *testing.T,
+	logicalName string,
+	resourceType string) map[string]interface{} {
+	t.Helper()
+	properties := harness.AssertResource(t, logicalName, resourceType)
+	propertiesJSON, propertiesJSONErr := json.Marshal(properties)
+	if propertiesJSONErr != nil {
+		t.Fatalf("Failed to marshal resource %s: %s", logicalName, propertiesJSONErr)
+	}
+	decoded := make(map[string]interface{})
+	unmarshalErr := json.Unmarshal(propertiesJSON, &decoded)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to decode resource %s: %s", logicalName, unmarshalErr)
+	}
+	return decoded
+}
+
+// TemplateValue returns the value at the path of map keys and slice
+// indices in a JSON decoded value, or nil if the path doesn't exist
+func TemplateValue(value interface{}, path ...interface{}) interface{} {
+	for _, eachElement := range path {
+		switch element := eachElement.(type) {
+		case string:
+			mapValue, mapValueOk := value.(map[string]interface{})
+			if !mapValueOk {
+				return nil
+			}
+			value = mapValue[element]
+		case int:
+			sliceValue, sliceValueOk := value.([]interface{})
+			if !sliceValueOk || element < 0 || element >= len(sliceValue) {
+				return nil
+			}
+			value = sliceValue[element]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// AssertTemplateValue fails the test if the JSON decoded value at the path
+// isn't equal to the JSON representation of expected
+func AssertTemplateValue(t *testing.T,
+	value interface{},
+	expected interface{},
+	path ...interface{}) {
+	t.Helper()
+	expectedJSON, expectedJSONErr := json.Marshal(expected)
+	if expectedJSONErr != nil {
+		t.Fatalf("Failed to marshal expected value: %s", expectedJSONErr)
+	}
+	var expectedValue interface{}
+	unmarshalErr := json.Unmarshal(expectedJSON, &expectedValue)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to decode expected value: %s", unmarshalErr)
+	}
+	actual := TemplateValue(value, path...)
+	if !reflect.DeepEqual(actual, expectedValue) {
+		t.Fatalf("Unexpected value at %v: %#v (expected: %#v)", path, actual, expectedValue)
+	}
+}
@@ -0,0 +1,132 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/sirupsen/logrus"
+)
+
+const regionContextKey sparta.WorkflowHookContextKey = "test.bucketRegion"
+
+func bucketRegionHook(context *sparta.WorkflowHookContext,
+	serviceName string,
+	S3Bucket string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+	locationOutput, locationErr := s3.New(awsSession).GetBucketLocation(&s3.GetBucketLocationInput{
+		Bucket: aws.String(S3Bucket),
+	})
+	if locationErr != nil {
+		return locationErr
+	}
+	context.Set(regionContextKey, aws.StringValue(locationOutput.LocationConstraint))
+	return nil
+}
+
+func regionTopicDecorator(context *sparta.WorkflowHookContext,
+	serviceName string,
+	template *gocf.Template,
+	S3Bucket string,
+	S3Key string,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *logrus.Logger) error {
+	region, _ := context.GetString(regionContextKey)
+	template.AddResource("RegionTopic", &gocf.SNSTopic{
+		DisplayName: gocf.String(region),
+	})
+	template.Outputs["RegionTopic"] = &gocf.Output{
+		Value: gocf.Ref("RegionTopic"),
+	}
+	return nil
+}
+
+func TestDecoratorHarness(t *testing.T) {
+	harness := NewDecoratorHarness(t)
+
+	// Unhandled AWS requests fail
+	hookErr := harness.RunWorkflowHook(sparta.WorkflowHookFunc(bucketRegionHook))
+	if awsErr, isAWSErr := hookErr.(awserr.Error); !isAWSErr || awsErr.Code() != ErrCodeStubAWSRequest {
+		t.Fatalf("Failed to reject unhandled AWS request: %v", hookErr)
+	}
+	harness.AWSSession = NewStubAWSSession(func(r *request.Request) {
+		if r.Operation.Name == "GetBucketLocation" {
+			r.Data.(*s3.GetBucketLocationOutput).LocationConstraint = aws.String("us-west-2")
+		}
+	})
+	hookErr = harness.RunWorkflowHook(sparta.WorkflowHookFunc(bucketRegionHook))
+	if hookErr != nil {
+		t.Fatalf("Failed to run WorkflowHook: %s", hookErr)
+	}
+	decoratorErr := harness.RunServiceDecorator(sparta.ServiceDecoratorHookFunc(regionTopicDecorator))
+	if decoratorErr != nil {
+		t.Fatalf("Failed to run ServiceDecorator: %s", decoratorErr)
+	}
+	topic := harness.AssertResource(t, "RegionTopic", "AWS::SNS::Topic").(*gocf.SNSTopic)
+	if topic.DisplayName.Literal != "us-west-2" {
+		t.Fatalf("ServiceDecorator didn't read the WorkflowHook value")
+	}
+	harness.AssertOutput(t, "RegionTopic")
+	topicProperties := harness.ResourceProperties(t, "RegionTopic", "AWS::SNS::Topic")
+	AssertTemplateValue(t, topicProperties, "us-west-2", "DisplayName")
+	if TemplateValue(topicProperties, "TopicName") != nil ||
+		TemplateValue(topicProperties, "DisplayName", 0) != nil {
+		t.Fatalf("Unexpected TemplateValue for missing path")
+	}
+
+	// Conflicting resources fail to merge
+	decoratorErr = harness.RunServiceDecorator(sparta.ServiceDecoratorHookFunc(regionTopicDecorator))
+	if decoratorErr == nil {
+		t.Fatalf("Failed to reject conflicting ServiceDecorator resources")
+	}
+
+	// TemplateDecorators receive the function's logical name
+	lambdaFn, _ := sparta.NewAWSLambda("Harness",
+		func() (string, error) {
+			return "Hello World", nil
+		},
+		sparta.IAMRoleDefinition{})
+	lambdaFn.Options.DeadLetterConfigArn = gocf.GetAtt("HarnessDLQ", "Arn")
+	decoratorErr = harness.RunTemplateDecorator(lambdaFn,
+		sparta.TemplateDecoratorHookFunc(func(serviceName string,
+			lambdaResourceName string,
+			lambdaResource gocf.LambdaFunction,
+			resourceMetadata map[string]interface{},
+			S3Bucket string,
+			S3Key string,
+			buildID string,
+			template *gocf.Template,
+			context *sparta.WorkflowHookContext,
+			logger *logrus.Logger) error {
+			resourceMetadata["TopicName"] = "RegionTopic"
+			alarm := &gocf.CloudWatchAlarm{}
+			if lambdaResource.DeadLetterConfig != nil {
+				alarm.AlarmActions = gocf.StringList(lambdaResource.DeadLetterConfig.TargetArn)
+			}
+			template.AddResource(lambdaResourceName+"Alarm", alarm)
+			return nil
+		}))
+	if decoratorErr != nil {
+		t.Fatalf("Failed to run TemplateDecorator: %s", decoratorErr)
+	}
+	alarmNames := harness.ResourceNames("AWS::CloudWatch::Alarm")
+	if len(alarmNames) != 1 ||
+		alarmNames[0] != lambdaFn.LogicalResourceName()+"Alarm" ||
+		harness.ResourceMetadata[lambdaFn.LogicalResourceName()]["TopicName"] != "RegionTopic" {
+		t.Fatalf("Unexpected TemplateDecorator result: %v", alarmNames)
+	}
+	alarmProperties := harness.ResourceProperties(t, alarmNames[0], "AWS::CloudWatch::Alarm")
+	AssertTemplateValue(t, alarmProperties,
+		[]*gocf.StringExpr{gocf.GetAtt("HarnessDLQ", "Arn")},
+		"AlarmActions")
+}
@@ -0,0 +1,264 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/pkg/errors"
+)
+
+const (
+	// UpdateGoldenEnvVar is the environment variable that rewrites the golden
+	// files with the current templates rather than comparing them
+	// (eg, SPARTA_UPDATE_GOLDEN=true go test ./...)
+	UpdateGoldenEnvVar = "SPARTA_UPDATE_GOLDEN"
+	// GoldenBuildIDPlaceholder replaces the BuildID in normalized templates
+	GoldenBuildIDPlaceholder = "{{BuildID}}"
+	// GoldenHashPlaceholder replaces the unique hash in S3 archive keys in
+	// normalized templates
+	GoldenHashPlaceholder = "{{Hash}}"
+)
+
+// goldenDiffContext is the number of unchanged lines around each change in
+// the golden file diff
+const goldenDiffContext = 3
+
+// s3ArchiveHashRegexp matches the unique suffix that's added to the S3 keys
+// of the code and site archives
+var s3ArchiveHashRegexp = regexp.MustCompile(`-[0-9a-f]{40}(\.zip)`)
+
+// GoldenReplacement is a normalization applied to the indented template
+// JSON. Each Pattern match is replaced with Replacement, which may include
+// regexp.Expand submatch references (eg, ${1}).
+type GoldenReplacement struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// GoldenTemplate compares the CloudFormation template for a service to a
+// golden JSON file. The template is marshaled offline with
+// sparta.MarshalTemplate and normalized so that the BuildID and S3 archive
+// hashes don't change the result. Set the SPARTA_UPDATE_GOLDEN environment
+// variable to write the golden files.
+type GoldenTemplate struct {
+	ServiceName        string
+	ServiceDescription string
+	S3Bucket           string
+	BuildID            string
+	BuildTags          string
+	API                sparta.APIGateway
+	Site               *sparta.S3Site
+	WorkflowHooks      *sparta.WorkflowHooks
+	// Replacements are additional normalizations for values that change
+	// between runs (eg, timestamped resource names)
+	Replacements []GoldenReplacement
+}
+
+// NewGoldenTemplate returns a GoldenTemplate with default values
+func NewGoldenTemplate() *GoldenTemplate {
+	return &GoldenTemplate{
+		ServiceName: "SpartaGoldenService",
+		S3Bucket:    "sparta-golden-bucket",
+		BuildID:     "goldenBuildID",
+	}
+}
+
+// Template returns the normalized, indented template JSON for the functions
+func (golden *GoldenTemplate) Template(lambdaAWSInfos []*sparta.LambdaAWSInfo) ([]byte, error) {
+	logger, loggerErr := sparta.NewLogger("info")
+	if loggerErr != nil {
+		return nil, errors.Wrapf(loggerErr, "Failed to create logger")
+	}
+	var templateJSON bytes.Buffer
+	marshalErr := sparta.MarshalTemplate(golden.ServiceName,
+		golden.ServiceDescription,
+		lambdaAWSInfos,
+		golden.API,
+		golden.Site,
+		golden.S3Bucket,
+		golden.BuildID,
+		golden.BuildTags,
+		&templateJSON,
+		golden.WorkflowHooks,
+		logger)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	return NormalizeTemplate(templateJSON.Bytes(), golden.BuildID, golden.Replacements...)
+}
+
+// Assert fails the test if the normalized template for the functions differs
+// from the golden file. The failure includes a line diff of the changes. If
+// the SPARTA_UPDATE_GOLDEN environment variable is set, the golden file is
+// written instead.
+func (golden *GoldenTemplate) Assert(t *testing.T,
+	goldenPath string,
+	lambdaAWSInfos []*sparta.LambdaAWSInfo) {
+
+	actual, actualErr := golden.Template(lambdaAWSInfos)
+	if actualErr != nil {
+		t.Fatalf("Failed to marshal template: %s", actualErr)
+	}
+	if os.Getenv(UpdateGoldenEnvVar) != "" {
+		mkdirErr := os.MkdirAll(filepath.Dir(goldenPath), os.ModePerm)
+		if mkdirErr != nil {
+			t.Fatalf("Failed to create golden file directory: %s", mkdirErr)
+		}
+		writeErr := ioutil.WriteFile(goldenPath, actual, 0644)
+		if writeErr != nil {
+			t.Fatalf("Failed to write golden file: %s", writeErr)
+		}
+		t.Logf("Updated golden file: %s", goldenPath)
+		return
+	}
+	expected, expectedErr := ioutil.ReadFile(goldenPath)
+	if os.IsNotExist(expectedErr) {
+		t.Fatalf("Golden file %s doesn't exist. Run the test with %s=true to create it.",
+			goldenPath,
+			UpdateGoldenEnvVar)
+	} else if expectedErr != nil {
+		t.Fatalf("Failed to read golden file: %s", expectedErr)
+	}
+	diff := GoldenDiff(goldenPath, string(expected), "template", string(actual))
+	if diff != "" {
+		t.Fatalf("Template differs from golden file %s. Run the test with %s=true to accept the changes.\n%s",
+			goldenPath,
+			UpdateGoldenEnvVar,
+			diff)
+	}
+}
+
+// NormalizeTemplate returns the indented template JSON with sorted keys.
+// The buildID and the unique S3 archive key hashes are replaced by
+// placeholders, followed by the additional replacements.
+func NormalizeTemplate(templateJSON []byte,
+	buildID string,
+	replacements ...GoldenReplacement) ([]byte, error) {
+	var template interface{}
+	unmarshalErr := json.Unmarshal(templateJSON, &template)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal template")
+	}
+	indented, indentedErr := json.MarshalIndent(template, "", "  ")
+	if indentedErr != nil {
+		return nil, errors.Wrapf(indentedErr, "Failed to marshal template")
+	}
+	normalized := string(indented)
+	if buildID != "" {
+		normalized = strings.Replace(normalized, buildID, GoldenBuildIDPlaceholder, -1)
+	}
+	normalized = s3ArchiveHashRegexp.ReplaceAllString(normalized,
+		fmt.Sprintf("-%s${1}", GoldenHashPlaceholder))
+	for _, eachReplacement := range replacements {
+		if eachReplacement.Pattern == nil {
+			continue
+		}
+		normalized = eachReplacement.Pattern.ReplaceAllString(normalized,
+			eachReplacement.Replacement)
+	}
+	return []byte(normalized + "\n"), nil
+}
+
+// GoldenDiff returns a unified line diff from the expected to the actual
+// value, or an empty string if they're the same
+func GoldenDiff(expectedName string,
+	expected string,
+	actualName string,
+	actual string) string {
+	if expected == actual {
+		return ""
+	}
+	expectedLines := strings.Split(strings.TrimSuffix(expected, "\n"), "\n")
+	actualLines := strings.Split(strings.TrimSuffix(actual, "\n"), "\n")
+
+	// Longest common subsequence lengths for the line suffixes
+	lcs := make([][]int, len(expectedLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actualLines)+1)
+	}
+	for i := len(expectedLines) - 1; i >= 0; i-- {
+		for j := len(actualLines) - 1; j >= 0; j-- {
+			if expectedLines[i] == actualLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// Edit script with the line numbers in each file
+	type diffLine struct {
+		op           byte
+		text         string
+		expectedLine int
+		actualLine   int
+	}
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(expectedLines) || j < len(actualLines) {
+		switch {
+		case i < len(expectedLines) && j < len(actualLines) && expectedLines[i] == actualLines[j]:
+			lines = append(lines, diffLine{' ', expectedLines[i], i, j})
+			i++
+			j++
+		case j < len(actualLines) && (i == len(expectedLines) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', actualLines[j], i, j})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', expectedLines[i], i, j})
+			i++
+		}
+	}
+	// Group the changes into hunks with the surrounding context
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", expectedName, actualName)
+	for start := 0; start < len(lines); start++ {
+		if lines[start].op == ' ' {
+			continue
+		}
+		hunkStart := start - goldenDiffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		// Changes separated by fewer unchanged lines than the leading and
+		// trailing context share a hunk
+		lastChange := start
+		for k := start + 1; k < len(lines) && k-lastChange <= 2*goldenDiffContext+1; k++ {
+			if lines[k].op != ' ' {
+				lastChange = k
+			}
+		}
+		hunkEnd := lastChange + goldenDiffContext + 1
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+		expectedCount, actualCount := 0, 0
+		for _, eachLine := range lines[hunkStart:hunkEnd] {
+			if eachLine.op != '+' {
+				expectedCount++
+			}
+			if eachLine.op != '-' {
+				actualCount++
+			}
+		}
+		fmt.Fprintf(&diff, "@@ -%d,%d +%d,%d @@\n",
+			lines[hunkStart].expectedLine+1,
+			expectedCount,
+			lines[hunkStart].actualLine+1,
+			actualCount)
+		for _, eachLine := range lines[hunkStart:hunkEnd] {
+			fmt.Fprintf(&diff, "%c%s\n", eachLine.op, eachLine.text)
+		}
+		start = hunkEnd - 1
+	}
+	return diff.String()
+}
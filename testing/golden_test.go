@@ -0,0 +1,84 @@
+package testing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+)
+
+func goldenHelloWorld(ctx context.Context) (string, error) {
+	return "Hello World", nil
+}
+
+func goldenLambdaAWSInfos(t *testing.T) []*sparta.LambdaAWSInfo {
+	lambdaFn, lambdaFnErr := sparta.NewAWSLambda("GoldenHelloWorld",
+		goldenHelloWorld,
+		sparta.IAMRoleDefinition{})
+	if lambdaFnErr != nil {
+		t.Fatalf("Failed to create Lambda function: %s", lambdaFnErr)
+	}
+	return []*sparta.LambdaAWSInfo{lambdaFn}
+}
+
+func TestGoldenTemplate(t *testing.T) {
+	golden := NewGoldenTemplate()
+	golden.Assert(t, "testdata/golden_template.json", goldenLambdaAWSInfos(t))
+
+	// The BuildID doesn't change the normalized template
+	golden.BuildID = "anotherBuildID"
+	golden.Assert(t, "testdata/golden_template.json", goldenLambdaAWSInfos(t))
+}
+
+func TestNormalizeTemplate(t *testing.T) {
+	templateJSON := `{"Resources":{"Fn":{"Properties":{"Code":{"S3Key":"Svc/Svc-code-b244a806c10eb519a3566c1a800fc92181210b4a.zip"},"Description":"build-1234","Timestamp":"2020-01-01"}}}}`
+	normalized, normalizedErr := NormalizeTemplate([]byte(templateJSON),
+		"build-1234",
+		GoldenReplacement{
+			Pattern:     regexp.MustCompile(`\d{4}-\d{2}-\d{2}`),
+			Replacement: "{{Date}}",
+		})
+	if normalizedErr != nil {
+		t.Fatalf("Failed to normalize template: %s", normalizedErr)
+	}
+	for _, eachExpected := range []string{
+		`"S3Key": "Svc/Svc-code-{{Hash}}.zip"`,
+		`"Description": "{{BuildID}}"`,
+		`"Timestamp": "{{Date}}"`,
+	} {
+		if !strings.Contains(string(normalized), eachExpected) {
+			t.Fatalf("Normalized template doesn't include %s:\n%s", eachExpected, normalized)
+		}
+	}
+}
+
+func TestGoldenDiff(t *testing.T) {
+	if diff := GoldenDiff("expected", "a\nb\n", "actual", "a\nb\n"); diff != "" {
+		t.Fatalf("Unexpected diff for identical values: %s", diff)
+	}
+	expected := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	actual := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	diff := GoldenDiff("expected", expected, "actual", actual)
+	expectedDiff := `--- expected
++++ actual
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if diff != expectedDiff {
+		t.Fatalf("Unexpected diff:\n%s\nExpected:\n%s", diff, expectedDiff)
+	}
+}
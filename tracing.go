@@ -0,0 +1,125 @@
+package sparta
+
+import (
+	"context"
+	"os"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-xray-sdk-go/header"
+	"github.com/aws/aws-xray-sdk-go/xray"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// LambdaTracingModeActive samples and traces a subset of incoming requests
+	// @enum LambdaTracingMode
+	LambdaTracingModeActive = "Active"
+	// LambdaTracingModePassThrough only traces requests that include a
+	// sampled trace header
+	// @enum LambdaTracingMode
+	LambdaTracingModePassThrough = "PassThrough"
+)
+
+const (
+	// XRayAnnotationRequestID is the X-Ray annotation that stores the AWS
+	// request ID on every Sparta created segment and subsegment
+	XRayAnnotationRequestID = LogFieldRequestID
+)
+
+// lambdaTraceIDContextKey is the key the aws-lambda-go runtime uses to
+// store the X-Ray trace header in the invocation context
+const lambdaTraceIDContextKey = "x-amzn-trace-id"
+
+// tracingConfig returns the TracingConfig for the function, honoring the
+// ActiveTracing shortcut
+func (options *LambdaFunctionOptions) tracingConfig() *gocf.LambdaFunctionTracingConfig {
+	if options.TracingConfig != nil {
+		return options.TracingConfig
+	}
+	if options.ActiveTracing {
+		return &gocf.LambdaFunctionTracingConfig{
+			Mode: gocf.String(LambdaTracingModeActive),
+		}
+	}
+	return nil
+}
+
+// validateTracing ensures the ActiveTracing shortcut doesn't conflict
+// with an explicit TracingConfig
+func validateTracing(options *LambdaFunctionOptions) error {
+	if !options.ActiveTracing || options.TracingConfig == nil {
+		return nil
+	}
+	mode := options.TracingConfig.Mode
+	if mode != nil && mode.Func == nil && mode.Literal != LambdaTracingModeActive {
+		return errors.Errorf("ActiveTracing conflicts with TracingConfig Mode: %s",
+			mode.Literal)
+	}
+	return nil
+}
+
+// requestIDFromContext returns the AWS request ID, if available
+func requestIDFromContext(ctx context.Context) string {
+	lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+	if !lambdaContextOk {
+		return ""
+	}
+	return lambdaContext.AwsRequestID
+}
+
+// beginRequestSegment starts an X-Ray segment for the invocation using the
+// trace header supplied by the AWS Lambda runtime so that subsegments
+// created by TraceSubsegment, TraceAWSClient and interceptors have a parent.
+// The returned segment is nil if the request isn't traced.
+func beginRequestSegment(ctx context.Context, name string) (context.Context, *xray.Segment) {
+	if xray.GetSegment(ctx) != nil {
+		return ctx, nil
+	}
+	traceHeader, _ := ctx.Value(lambdaTraceIDContextKey).(string)
+	if traceHeader == "" {
+		traceHeader = os.Getenv("_X_AMZN_TRACE_ID")
+	}
+	if traceHeader == "" {
+		return ctx, nil
+	}
+	segmentCtx, segment := xray.NewSegmentFromHeader(ctx,
+		name,
+		header.FromString(traceHeader))
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		// Annotation errors only occur for invalid keys
+		_ = segment.AddAnnotation(XRayAnnotationRequestID, requestID)
+	}
+	return segmentCtx, segment
+}
+
+// TraceSubsegment runs fn inside a new X-Ray subsegment with the given name.
+// The subsegment is annotated with the AWS request ID and records the error
+// returned by fn. If the context isn't traced (eg, TracingConfig isn't
+// enabled or the function is run locally), fn is called directly.
+func TraceSubsegment(ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error) error {
+	if xray.GetSegment(ctx) == nil {
+		return fn(ctx)
+	}
+	return xray.Capture(ctx, name, func(subsegmentCtx context.Context) error {
+		if requestID := requestIDFromContext(ctx); requestID != "" {
+			_ = xray.AddAnnotation(subsegmentCtx, XRayAnnotationRequestID, requestID)
+		}
+		return fn(subsegmentCtx)
+	})
+}
+
+// TraceAWSClient instruments an AWS SDK client so that each request made
+// with a traced context (eg, s3Svc.GetObjectWithContext(ctx, ...)) is
+// recorded as an X-Ray subsegment. The client is only instrumented when
+// running in AWS Lambda with an X-Ray daemon available.
+func TraceAWSClient(awsClient *client.Client) *client.Client {
+	if os.Getenv("AWS_XRAY_DAEMON_ADDRESS") != "" &&
+		os.Getenv("AWS_EXECUTION_ENV") != "" {
+		xray.AWS(awsClient)
+	}
+	return awsClient
+}
@@ -19,7 +19,7 @@ import (
 // step.
 func DriftDetector(errorOnDrift bool) sparta.ServiceValidationHookHandler {
 
-	driftDetector := func(context map[string]interface{},
+	driftDetector := func(context *sparta.WorkflowHookContext,
 		serviceName string,
 		template *gocf.Template,
 		S3Bucket string,
@@ -0,0 +1,156 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/system"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// cfn-lint exit codes are a bitmask of the most severe findings
+// Ref: https://github.com/aws-cloudformation/cfn-lint#exit-codes
+const (
+	cfnLintExitCodeFailure = 1
+	cfnLintExitCodeError   = 2
+	cfnLintExitCodeWarning = 4
+)
+
+var (
+	// CFNLintPath is the cfn-lint executable used by the CFNLint validator
+	CFNLintPath = "cfn-lint"
+	// CloudFormationGuardPath is the cfn-guard executable used by the
+	// CloudFormationGuard validator
+	CloudFormationGuardPath = "cfn-guard"
+)
+
+// writeTemplate saves the template to a temporary file and returns the path
+func writeTemplate(serviceName string, template *gocf.Template) (string, error) {
+	templateJSON, templateJSONErr := json.MarshalIndent(template, "", " ")
+	if templateJSONErr != nil {
+		return "", errors.Wrapf(templateJSONErr, "Failed to marshal template")
+	}
+	templateFile, templateFileErr := ioutil.TempFile("", serviceName+"-*.json")
+	if templateFileErr != nil {
+		return "", errors.Wrapf(templateFileErr, "Failed to create template file")
+	}
+	_, writeErr := templateFile.Write(templateJSON)
+	closeErr := templateFile.Close()
+	if writeErr != nil || closeErr != nil {
+		os.Remove(templateFile.Name())
+		return "", errors.Errorf("Failed to write template file: %v, %v", writeErr, closeErr)
+	}
+	return templateFile.Name(), nil
+}
+
+// runTemplateCommand runs the command, logs its output, and returns the
+// process exit code
+func runTemplateCommand(cmd *exec.Cmd, logger *logrus.Logger) (int, error) {
+	var output bytes.Buffer
+	runErr := system.RunAndCaptureOSCommand(cmd, &output, &output, logger)
+	for _, eachLine := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if eachLine != "" {
+			logger.WithField("Command", cmd.Args[0]).Info(eachLine)
+		}
+	}
+	if runErr == nil {
+		return 0, nil
+	}
+	if exitErr, exitErrOk := runErr.(*exec.ExitError); exitErrOk {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, errors.Wrapf(runErr, "Failed to run %s", cmd.Args[0])
+}
+
+// CFNLint is a validator that runs the marshaled template through
+// cfn-lint (https://github.com/aws-cloudformation/cfn-lint). Errors prevent
+// the operation. Warnings prevent the operation if failOnWarnings is true.
+// The optional args are passed to cfn-lint (eg, "--ignore-checks", "W3005").
+func CFNLint(failOnWarnings bool, args ...string) sparta.ServiceValidationHookHandler {
+	cfnLint := func(context *sparta.WorkflowHookContext,
+		serviceName string,
+		template *gocf.Template,
+		S3Bucket string,
+		S3Key string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+
+		templatePath, templatePathErr := writeTemplate(serviceName, template)
+		if templatePathErr != nil {
+			return templatePathErr
+		}
+		defer os.Remove(templatePath)
+
+		cmdArgs := append(append([]string{}, args...), "--", templatePath)
+		exitCode, exitCodeErr := runTemplateCommand(exec.Command(CFNLintPath, cmdArgs...), logger)
+		if exitCodeErr != nil {
+			return exitCodeErr
+		}
+		if exitCode&cfnLintExitCodeFailure != 0 {
+			return errors.Errorf("cfn-lint failed with exit code: %d", exitCode)
+		}
+		if exitCode&cfnLintExitCodeError != 0 {
+			return errors.Errorf("cfn-lint reported template errors")
+		}
+		if exitCode&cfnLintExitCodeWarning != 0 {
+			if failOnWarnings {
+				return errors.Errorf("cfn-lint reported template warnings")
+			}
+			logger.Warn("cfn-lint reported template warnings")
+		}
+		return nil
+	}
+	return sparta.ServiceValidationHookFunc(cfnLint)
+}
+
+// CloudFormationGuard is a validator that evaluates the marshaled template
+// against the user-supplied CloudFormation Guard rules files
+// (https://github.com/aws-cloudformation/cloudformation-guard). Any rule
+// violation prevents the operation.
+func CloudFormationGuard(rulesFiles ...string) sparta.ServiceValidationHookHandler {
+	cfnGuard := func(context *sparta.WorkflowHookContext,
+		serviceName string,
+		template *gocf.Template,
+		S3Bucket string,
+		S3Key string,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *logrus.Logger) error {
+
+		if len(rulesFiles) == 0 {
+			return errors.Errorf("CloudFormationGuard requires at least one rules file")
+		}
+		templatePath, templatePathErr := writeTemplate(serviceName, template)
+		if templatePathErr != nil {
+			return templatePathErr
+		}
+		defer os.Remove(templatePath)
+
+		cmdArgs := []string{"validate",
+			"--data", templatePath,
+			"--show-summary", "fail"}
+		for _, eachRulesFile := range rulesFiles {
+			cmdArgs = append(cmdArgs, "--rules", eachRulesFile)
+		}
+		exitCode, exitCodeErr := runTemplateCommand(exec.Command(CloudFormationGuardPath, cmdArgs...), logger)
+		if exitCodeErr != nil {
+			return exitCodeErr
+		}
+		if exitCode != 0 {
+			return errors.Errorf("cfn-guard reported rule violations (exit code: %d)", exitCode)
+		}
+		return nil
+	}
+	return sparta.ServiceValidationHookFunc(cfnGuard)
+}
@@ -0,0 +1,91 @@
+package validator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+// fakeCommand creates a shell script that exits with the given code
+func fakeCommand(t *testing.T, exitCode int) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake commands require a POSIX shell")
+	}
+	scriptDir, scriptDirErr := ioutil.TempDir("", "validator")
+	if scriptDirErr != nil {
+		t.Fatalf("Failed to create temp dir: %s", scriptDirErr)
+	}
+	scriptPath := filepath.Join(scriptDir, "fake-lint")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\"\nexit %d\n", exitCode)
+	writeErr := ioutil.WriteFile(scriptPath, []byte(script), 0755)
+	if writeErr != nil {
+		t.Fatalf("Failed to write fake command: %s", writeErr)
+	}
+	return scriptPath
+}
+
+func runValidator(validator sparta.ServiceValidationHookHandler) error {
+	logger, _ := sparta.NewLogger("info")
+	return validator.ValidateService(sparta.NewWorkflowHookContext(nil),
+		"SpartaValidator",
+		gocf.NewTemplate(),
+		"",
+		"",
+		"",
+		nil,
+		true,
+		logger)
+}
+
+func TestCFNLint(t *testing.T) {
+	defer func(lintPath string) {
+		CFNLintPath = lintPath
+	}(CFNLintPath)
+
+	expectations := []struct {
+		exitCode       int
+		failOnWarnings bool
+		expectError    bool
+	}{
+		{0, true, false},
+		{4, false, false},
+		{4, true, true},
+		{2, false, true},
+		{8, true, false},
+		{1, false, true},
+	}
+	for _, eachExpectation := range expectations {
+		CFNLintPath = fakeCommand(t, eachExpectation.exitCode)
+		defer os.RemoveAll(filepath.Dir(CFNLintPath))
+		validateErr := runValidator(CFNLint(eachExpectation.failOnWarnings))
+		if (validateErr != nil) != eachExpectation.expectError {
+			t.Fatalf("Unexpected cfn-lint result for %#v: %v", eachExpectation, validateErr)
+		}
+	}
+}
+
+func TestCloudFormationGuard(t *testing.T) {
+	defer func(guardPath string) {
+		CloudFormationGuardPath = guardPath
+	}(CloudFormationGuardPath)
+
+	CloudFormationGuardPath = fakeCommand(t, 0)
+	defer os.RemoveAll(filepath.Dir(CloudFormationGuardPath))
+	if validateErr := runValidator(CloudFormationGuard("rules.guard")); validateErr != nil {
+		t.Fatalf("Failed to accept compliant template: %s", validateErr)
+	}
+	if validateErr := runValidator(CloudFormationGuard()); validateErr == nil {
+		t.Fatalf("Failed to require rules files")
+	}
+	CloudFormationGuardPath = fakeCommand(t, 19)
+	defer os.RemoveAll(filepath.Dir(CloudFormationGuardPath))
+	if validateErr := runValidator(CloudFormationGuard("rules.guard")); validateErr == nil {
+		t.Fatalf("Failed to reject rule violations")
+	}
+}
@@ -0,0 +1,66 @@
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	// WarmupEventSource is the source value of a Sparta warmup event
+	WarmupEventSource = "sparta.warmup"
+	// DefaultWarmupScheduleExpression is the default schedule used by
+	// NewWarmupPermission
+	DefaultWarmupScheduleExpression = "rate(5 minutes)"
+	// warmupRuleName is the CloudWatchEventsPermission rule name for the
+	// scheduled warmup event
+	warmupRuleName = "SpartaWarmup"
+)
+
+// WarmupEvent is the payload that keeps an AWS Lambda function
+// execution environment warm. The Sparta dispatcher recognizes this event
+// and returns without calling the user handler, interceptors or
+// middleware.
+type WarmupEvent struct {
+	Source string `json:"source"`
+}
+
+// warmupEventBytes is the marker used to cheaply reject non-warmup events
+// before unmarshalling
+var warmupEventBytes = []byte(WarmupEventSource)
+
+// isWarmupEvent returns true if the message is a WarmupEvent
+func isWarmupEvent(msg json.RawMessage) bool {
+	if !bytes.Contains(msg, warmupEventBytes) {
+		return false
+	}
+	var event WarmupEvent
+	if json.Unmarshal(msg, &event) != nil {
+		return false
+	}
+	return event.Source == WarmupEventSource
+}
+
+// NewWarmupPermission returns a CloudWatchEventsPermission that sends a
+// WarmupEvent to the function on the given schedule. If scheduleExpression
+// is empty, DefaultWarmupScheduleExpression is used. Append the permission
+// to the LambdaAWSInfo.Permissions slice to keep the function warm.
+func NewWarmupPermission(scheduleExpression string) CloudWatchEventsPermission {
+	if scheduleExpression == "" {
+		scheduleExpression = DefaultWarmupScheduleExpression
+	}
+	// Marshalling a WarmupEvent can't fail
+	eventBytes, _ := json.Marshal(WarmupEvent{
+		Source: WarmupEventSource,
+	})
+	return CloudWatchEventsPermission{
+		Rules: map[string]CloudWatchEventsRule{
+			warmupRuleName: {
+				Description:        "Sparta warmup event",
+				ScheduleExpression: scheduleExpression,
+				RuleTarget: &CloudWatchEventsRuleTarget{
+					Input: string(eventBytes),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package sparta
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+func TestIsWarmupEvent(t *testing.T) {
+	testCases := map[string]bool{
+		`{"source":"sparta.warmup"}`:                        true,
+		`{"source": "sparta.warmup", "id": "1234"}`:         true,
+		`{"source":"aws.events","detail-type":"Scheduled"}`: false,
+		`{"message":"sparta.warmup"}`:                       false,
+		`"sparta.warmup"`:                                   false,
+		`{}`:                                                false,
+	}
+	for eachEvent, expected := range testCases {
+		if isWarmupEvent(json.RawMessage(eachEvent)) != expected {
+			t.Fatalf("Expected isWarmupEvent(%s) to be %t", eachEvent, expected)
+		}
+	}
+}
+
+func TestWarmupPermission(t *testing.T) {
+	logger, _ := NewLogger("info")
+	permission := NewWarmupPermission("")
+	template := gocf.NewTemplate()
+	_, exportErr := permission.export("WarmupService",
+		"WarmupLambda",
+		"WarmupLambdaResource",
+		gocf.GetAtt("WarmupLambdaResource", "Arn"),
+		template,
+		"",
+		"",
+		logger)
+	if exportErr != nil {
+		t.Fatalf("Failed to export warmup permission: %s", exportErr)
+	}
+	jsonBytes, _ := json.Marshal(template)
+	output := string(jsonBytes)
+	for _, eachExpected := range []string{"AWS::Events::Rule",
+		DefaultWarmupScheduleExpression,
+		`{\"source\":\"sparta.warmup\"}`} {
+		if !strings.Contains(output, eachExpected) {
+			t.Fatalf("Failed to find %s in warmup template: %s",
+				eachExpected,
+				output)
+		}
+	}
+}
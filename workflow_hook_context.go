@@ -0,0 +1,206 @@
+package sparta
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// START - WorkflowHookContext
+//
+
+// WorkflowHookContextKey is the type of the keys in a WorkflowHookContext
+type WorkflowHookContextKey string
+
+const (
+	// WorkflowHookContextKeyServiceName is the name of the service
+	// being provisioned. The value is a string.
+	WorkflowHookContextKeyServiceName WorkflowHookContextKey = "sparta.serviceName"
+	// WorkflowHookContextKeyBuildID is the BuildID of the provision
+	// operation. The value is a string.
+	WorkflowHookContextKeyBuildID WorkflowHookContextKey = "sparta.buildID"
+	// WorkflowHookContextKeyS3Bucket is the S3 bucket that stores the
+	// service's artifacts. The value is a string.
+	WorkflowHookContextKeyS3Bucket WorkflowHookContextKey = "sparta.s3Bucket"
+	// WorkflowHookContextKeyTemplate is the CloudFormation template being
+	// built. The value is a *gocf.Template.
+	WorkflowHookContextKeyTemplate WorkflowHookContextKey = "sparta.template"
+	// WorkflowHookContextKeyCodeArchiveURL is the S3 URL of the uploaded
+	// Lambda code archive. The value is a string and is available after
+	// the archive is uploaded.
+	WorkflowHookContextKeyCodeArchiveURL WorkflowHookContextKey = "sparta.codeArchiveURL"
+	// WorkflowHookContextKeyCodeArchiveSHA256 is the hex encoded SHA-256
+	// hash of the Lambda code archive. The value is a string and is
+	// available after the archive is uploaded.
+	WorkflowHookContextKeyCodeArchiveSHA256 WorkflowHookContextKey = "sparta.codeArchiveSHA256"
+	// WorkflowHookContextKeyAWSClients are the AWS service clients used by
+	// the provision operation. The value is a *AWSClients.
+	WorkflowHookContextKeyAWSClients WorkflowHookContextKey = "sparta.awsClients"
+)
+
+// WorkflowHookContext is the context shared by the workflow hooks in a
+// provision operation. Hooks use it to publish values that are consumed
+// by later hooks and decorators. It's safe for concurrent use.
+//
+// The template isn't safe for concurrent use. ServiceDecorators that run
+// concurrently take turns with the template: the first Template() call
+// waits until no other decorator in the layer holds the template, and the
+// decorator holds it until it returns.
+type WorkflowHookContext struct {
+	mutex  sync.RWMutex
+	values map[WorkflowHookContextKey]interface{}
+	// parent is the shared context of a decorator scoped context
+	parent *WorkflowHookContext
+	// templateMutex serializes template access in a decorator layer
+	templateMutex  *sync.Mutex
+	templateLocked bool
+}
+
+// NewWorkflowHookContext returns a WorkflowHookContext initialized with
+// the given values, which may be nil
+func NewWorkflowHookContext(values map[string]interface{}) *WorkflowHookContext {
+	hookContext := &WorkflowHookContext{
+		values: make(map[WorkflowHookContextKey]interface{}),
+	}
+	for eachKey, eachValue := range values {
+		hookContext.values[WorkflowHookContextKey(eachKey)] = eachValue
+	}
+	return hookContext
+}
+
+// decoratorScope returns a context for a single ServiceDecorator call. The
+// scoped context shares the values of hookContext. Template access is
+// serialized with the other decorators that share the templateMutex until
+// releaseTemplate is called.
+func (hookContext *WorkflowHookContext) decoratorScope(templateMutex *sync.Mutex) *WorkflowHookContext {
+	return &WorkflowHookContext{
+		parent:        hookContext,
+		templateMutex: templateMutex,
+	}
+}
+
+// lockTemplate waits for exclusive template access in the decorator layer
+func (hookContext *WorkflowHookContext) lockTemplate() {
+	hookContext.mutex.Lock()
+	defer hookContext.mutex.Unlock()
+	if !hookContext.templateLocked {
+		hookContext.templateMutex.Lock()
+		hookContext.templateLocked = true
+	}
+}
+
+// releaseTemplate releases the template access acquired by lockTemplate
+func (hookContext *WorkflowHookContext) releaseTemplate() {
+	hookContext.mutex.Lock()
+	defer hookContext.mutex.Unlock()
+	if hookContext.templateLocked {
+		hookContext.templateMutex.Unlock()
+		hookContext.templateLocked = false
+	}
+}
+
+// Get returns the value for key and whether the value exists
+func (hookContext *WorkflowHookContext) Get(key WorkflowHookContextKey) (interface{}, bool) {
+	if hookContext.parent != nil {
+		if key == WorkflowHookContextKeyTemplate {
+			hookContext.lockTemplate()
+		}
+		return hookContext.parent.Get(key)
+	}
+	hookContext.mutex.RLock()
+	defer hookContext.mutex.RUnlock()
+	value, valueExists := hookContext.values[key]
+	return value, valueExists
+}
+
+// Set publishes the value for key, replacing any existing value
+func (hookContext *WorkflowHookContext) Set(key WorkflowHookContextKey, value interface{}) {
+	if hookContext.parent != nil {
+		hookContext.parent.Set(key, value)
+		return
+	}
+	hookContext.mutex.Lock()
+	defer hookContext.mutex.Unlock()
+	hookContext.values[key] = value
+}
+
+// Delete removes the value for key
+func (hookContext *WorkflowHookContext) Delete(key WorkflowHookContextKey) {
+	if hookContext.parent != nil {
+		hookContext.parent.Delete(key)
+		return
+	}
+	hookContext.mutex.Lock()
+	defer hookContext.mutex.Unlock()
+	delete(hookContext.values, key)
+}
+
+// GetString returns the string value for key. The boolean is false if
+// the value doesn't exist or isn't a string.
+func (hookContext *WorkflowHookContext) GetString(key WorkflowHookContextKey) (string, bool) {
+	value, _ := hookContext.Get(key)
+	stringValue, stringValueOk := value.(string)
+	return stringValue, stringValueOk
+}
+
+// GetBool returns the bool value for key. The boolean is false if the
+// value doesn't exist or isn't a bool.
+func (hookContext *WorkflowHookContext) GetBool(key WorkflowHookContextKey) (bool, bool) {
+	value, _ := hookContext.Get(key)
+	boolValue, boolValueOk := value.(bool)
+	return boolValue, boolValueOk
+}
+
+// Keys returns the sorted keys
+func (hookContext *WorkflowHookContext) Keys() []WorkflowHookContextKey {
+	if hookContext.parent != nil {
+		return hookContext.parent.Keys()
+	}
+	hookContext.mutex.RLock()
+	defer hookContext.mutex.RUnlock()
+	keys := make([]WorkflowHookContextKey, 0, len(hookContext.values))
+	for eachKey := range hookContext.values {
+		keys = append(keys, eachKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Template returns the WorkflowHookContextKeyTemplate value
+func (hookContext *WorkflowHookContext) Template() *gocf.Template {
+	value, _ := hookContext.Get(WorkflowHookContextKeyTemplate)
+	template, _ := value.(*gocf.Template)
+	return template
+}
+
+// CodeArchiveURL returns the WorkflowHookContextKeyCodeArchiveURL value
+func (hookContext *WorkflowHookContext) CodeArchiveURL() string {
+	codeArchiveURL, _ := hookContext.GetString(WorkflowHookContextKeyCodeArchiveURL)
+	return codeArchiveURL
+}
+
+// CodeArchiveSHA256 returns the WorkflowHookContextKeyCodeArchiveSHA256 value
+func (hookContext *WorkflowHookContext) CodeArchiveSHA256() string {
+	codeArchiveSHA256, _ := hookContext.GetString(WorkflowHookContextKeyCodeArchiveSHA256)
+	return codeArchiveSHA256
+}
+
+// String returns the keys in the context. Values aren't included since
+// they may be large (eg, the template).
+func (hookContext *WorkflowHookContext) String() string {
+	keyNames := []string{}
+	for _, eachKey := range hookContext.Keys() {
+		keyNames = append(keyNames, string(eachKey))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(keyNames, ", "))
+}
+
+//
+// END - WorkflowHookContext
+////////////////////////////////////////////////////////////////////////////////